@@ -1,6 +1,7 @@
 //! Command line argument parsing
 
 use crate::models::project::BuildStrategy;
+use crate::projects::json_output::OutputFormat;
 use clap::{Parser, Subcommand};
 use std::path::PathBuf;
 
@@ -16,7 +17,11 @@ pub struct Cli {
     pub project_dir: Option<PathBuf>,
 
     /// Run in CLI mode without TUI - for automation and scripting
-    #[arg(long, help = "Run in CLI mode without interactive TUI")]
+    #[arg(
+        long,
+        visible_alias = "no-tui",
+        help = "Run in CLI mode without interactive TUI"
+    )]
     pub cli: bool,
 
     /// Increase logging verbosity (-v for debug, -vv for trace)
@@ -27,6 +32,17 @@ pub struct Cli {
     #[arg(short = 'q', long = "quiet")]
     pub quiet: bool,
 
+    /// Plain sequential text instead of the TUI: no alternate screen, colors,
+    /// emoji or hyperlinks, for screen readers, dumb terminals and pipes (on
+    /// by itself when TERM=dumb)
+    #[arg(long, global = true, help = "Plain text output without the TUI")]
+    pub plain: bool,
+
+    /// Output of the build and flash commands: `text`, or `json` for JSON
+    /// lines of events and a final summary on stdout (implies --no-tui)
+    #[arg(long, global = true, value_enum, default_value = "text")]
+    pub output: OutputFormat,
+
     /// Build strategy: 'idf-build-apps' (default, professional), 'sequential' (safe) or 'parallel' (may have conflicts)
     #[arg(
         long,
@@ -35,6 +51,23 @@ pub struct Cli {
     )]
     pub build_strategy: BuildStrategy,
 
+    /// Build slots shared by concurrent board builds, each board taking its weight (defaults to the CPU count)
+    #[arg(long, help = "Build slots shared by concurrent board builds")]
+    pub jobs: Option<usize>,
+
+    /// Load average above which no further build starts (defaults to the CPU count, 0 disables)
+    #[arg(long, help = "Load average above which no further build starts")]
+    pub max_load: Option<f64>,
+
+    /// Remote build agents, `user@host` for SSH or `http://host:9090` for `espbrew agent` (repeatable)
+    #[arg(
+        long = "agent",
+        global = true,
+        value_name = "AGENT",
+        help = "Build boards on a remote agent (repeatable)"
+    )]
+    pub agents: Vec<String>,
+
     /// Remote ESPBrew server URL for remote flashing
     #[arg(
         long,
@@ -46,6 +79,14 @@ pub struct Cli {
     #[arg(long, help = "Target board MAC address for remote flashing")]
     pub board_mac: Option<String>,
 
+    /// Record the TUI session's board statuses and logs to this file, for `espbrew replay`
+    #[arg(long, value_name = "FILE", help = "Record the TUI session to a file")]
+    pub record: Option<PathBuf>,
+
+    /// Color theme of the TUI: dark, light, high-contrast or a theme file (defaults to $ESPBREW_THEME, else dark)
+    #[arg(long, value_name = "THEME", help = "Color theme of the TUI")]
+    pub theme: Option<String>,
+
     /// Handle espbrew:// URL (internal use by URL handler)
     #[arg(long, hide = true, help = "Handle espbrew:// URL (internal use)")]
     pub handle_url: Option<String>,
@@ -70,13 +111,161 @@ pub struct Cli {
 pub enum Commands {
     /// List boards and components (default CLI behavior)
     List,
-    /// List connected USB boards (serial ports)
-    Boards,
+    /// List connected USB boards (serial ports), or manage board configurations
+    Boards {
+        #[command(subcommand)]
+        action: Option<BoardsAction>,
+    },
     /// Build all boards
     Build {
         /// Build only specific board (if not specified, builds all boards)
         #[arg(short, long, help = "Build only specific board configuration")]
         board: Option<String>,
+        /// Build only boards matching these tags (comma separated, `!tag` excludes, e.g. psram,!c3)
+        #[arg(long)]
+        tags: Option<String>,
+        /// Refuse to build if toolchains or dependencies differ from espbrew.lock
+        #[arg(long)]
+        locked: bool,
+        /// Rebuild boards even if their inputs are unchanged since the last successful build
+        #[arg(long)]
+        force: bool,
+        /// Check the boards to build and assign connected devices to them in a
+        /// picker before the build starts
+        #[arg(long, conflicts_with = "board")]
+        pick: bool,
+        /// Print the commands, environment and working directories each board
+        /// build would run, without running them
+        #[arg(long)]
+        dry_run: bool,
+        /// Print the dry-run plan as JSON
+        #[arg(long, requires = "dry_run")]
+        json: bool,
+    },
+    /// Continue an interrupted build, rebuilding only its unfinished boards
+    Resume {
+        /// Forget the interrupted build instead of continuing it
+        #[arg(long)]
+        discard: bool,
+    },
+    /// Show build durations, results and firmware sizes recorded per board
+    Stats {
+        /// Show the recent builds of this board
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Number of builds listed with --board
+        #[arg(long, default_value = "10")]
+        limit: usize,
+    },
+    /// Install the toolchains the project's boards build with into ~/.espbrew/toolchains
+    Setup {
+        /// Print the install commands without running them
+        #[arg(long)]
+        dry_run: bool,
+        /// Print shell exports of the installed toolchains, for `eval "$(espbrew setup --print-env)"`
+        #[arg(long, conflicts_with = "dry_run")]
+        print_env: bool,
+    },
+    /// Pull the project's branch and build every board on the schedule of espbrew.yaml
+    Daemon {
+        /// Pull and build once right away, then exit; fails if a board failed
+        #[arg(long)]
+        once: bool,
+        /// Serve the trigger webhook on this address, e.g. 0.0.0.0:8087 (overrides daemon.listen)
+        #[arg(long)]
+        listen: Option<String>,
+    },
+    /// Run the TUI and mirror it in a browser dashboard, for watching a shared build machine
+    Serve {
+        /// Address of the dashboard, e.g. :8080 for this machine only or 0.0.0.0:8080
+        /// for every interface
+        #[arg(long, default_value = ":8080")]
+        web: String,
+    },
+    /// Play a session recorded with --record back in the TUI (--cli prints it)
+    Replay {
+        /// The recording
+        file: PathBuf,
+        /// How many times as fast as it happened
+        #[arg(long, default_value_t = 1.0)]
+        speed: f64,
+    },
+    /// Rebuild boards whenever their sources change
+    Watch {
+        /// Watch only these boards (repeatable; defaults to all boards)
+        #[arg(short, long = "board")]
+        boards: Vec<String>,
+        /// Watch only boards matching these tags (comma separated, `!tag` excludes)
+        #[arg(long)]
+        tags: Option<String>,
+        /// Milliseconds without further changes before rebuilding
+        #[arg(long, default_value_t = crate::projects::watch::DEFAULT_DEBOUNCE_MS)]
+        debounce: u64,
+        /// Flash the board after every successful build (needs a single board)
+        #[arg(long)]
+        flash: bool,
+        /// Flash and monitor the board after every successful build, until the next change
+        #[arg(long)]
+        monitor: bool,
+        /// Serial port to flash and monitor (auto-detect if not specified)
+        #[arg(short, long)]
+        port: Option<String>,
+        /// Baud rate for monitoring
+        #[arg(long, default_value = "115200")]
+        baud_rate: u32,
+    },
+    /// Inspect board configurations
+    Config {
+        #[command(subcommand)]
+        action: ConfigAction,
+    },
+    /// Create a new starter project from a template
+    New {
+        /// Project template to generate
+        #[arg(value_enum)]
+        template: crate::projects::templates::ProjectTemplate,
+        /// Chips to create board configurations for (comma separated, e.g. esp32s3,esp32c6)
+        #[arg(long, value_delimiter = ',')]
+        chips: Vec<String>,
+    },
+    /// Update devices over the air with the app binaries of their boards
+    Ota {
+        #[command(subcommand)]
+        action: OtaAction,
+    },
+    /// Export the built images of the boards for distribution
+    Export {
+        #[command(subcommand)]
+        action: ExportAction,
+    },
+    /// Search the stored build and monitor logs of past sessions
+    Logs {
+        #[command(subcommand)]
+        action: LogsAction,
+    },
+    /// Discover and build all projects of a monorepo workspace
+    Workspace {
+        #[command(subcommand)]
+        action: WorkspaceAction,
+    },
+    /// Serve board builds to coordinators running `espbrew build --agent http://<host>:<port>`
+    Agent {
+        /// Address to listen on, e.g. 0.0.0.0:9090 for every interface
+        #[arg(
+            long,
+            value_name = "ADDR",
+            num_args = 0..=1,
+            default_value = "127.0.0.1:9090",
+            default_missing_value = "127.0.0.1:9090"
+        )]
+        listen: String,
+        /// Token coordinators must send with every job (defaults to
+        /// $ESPBREW_AGENT_TOKEN), required unless listening on loopback
+        #[arg(long, value_name = "TOKEN")]
+        token: Option<String>,
+        /// Directory the shipped projects are built in (defaults to the user cache directory)
+        #[arg(long)]
+        work_dir: Option<PathBuf>,
     },
     /// Discover ESPBrew servers on the local network via mDNS
     Discover {
@@ -98,6 +287,29 @@ pub enum Commands {
         /// Force rebuild even if artifacts exist
         #[arg(long)]
         force_rebuild: bool,
+        /// Flash every connected device at once, each with the board configuration matching it
+        #[arg(long, conflicts_with_all = ["binary", "config", "port"])]
+        all_devices: bool,
+        /// Flash only these parts of the build (repeatable or comma-separated)
+        #[arg(long, value_enum, value_delimiter = ',', conflicts_with_all = ["binary", "all_devices"])]
+        only: Vec<crate::projects::flash_parts::FlashPart>,
+    },
+    /// Erase the flash of a board's device, or only a region or partition of it
+    Erase {
+        /// Board whose device, chip and partition table to use (defaults to the only board)
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Serial port to erase (defaults to the board's port or registered device)
+        #[arg(short, long)]
+        port: Option<String>,
+        /// Erase only this partition (e.g. nvs) or `offset:size` (e.g. 0x9000:0x6000)
+        #[arg(long)]
+        region: Option<String>,
+    },
+    /// Record golden images of a board and return devices to them
+    Device {
+        #[command(subcommand)]
+        action: DeviceAction,
     },
     /// Flash firmware to remote board(s) via ESPBrew server API
     RemoteFlash {
@@ -172,6 +384,9 @@ pub enum Commands {
         /// Serial port (auto-detect if not specified)
         #[arg(short, long, help = "Serial port (auto-detect if not specified)")]
         port: Option<String>,
+        /// Monitor this board's `port:` from espbrew.yaml or its device registered with `espbrew boards assign`
+        #[arg(long, conflicts_with = "port")]
+        board: Option<String>,
         /// Baud rate for serial monitoring (default: 115200)
         #[arg(
             short,
@@ -198,6 +413,19 @@ pub enum Commands {
             help = "Disable address resolution for stack traces"
         )]
         no_addresses: bool,
+        /// Record the session to logs/<board>/<device>/<timestamp>.log
+        #[arg(
+            long,
+            help = "Record the session to logs/<board>/<device>/<timestamp>.log"
+        )]
+        record: bool,
+        /// Write the output as JSON lines with parsed ESP-IDF fields to this file, or stdout for -
+        #[arg(
+            long,
+            value_name = "FILE",
+            help = "Write the output as JSON lines with parsed ESP-IDF fields to FILE, or stdout for -"
+        )]
+        jsonl: Option<PathBuf>,
         /// Maximum monitoring duration in seconds (0 = infinite)
         #[arg(
             long,
@@ -224,4 +452,192 @@ impl Cli {
     pub fn parse_args() -> Self {
         Self::parse()
     }
+
+    /// Whether `--plain` is given or the terminal is dumb
+    pub fn plain_output(&self) -> bool {
+        self.plain || std::env::var("TERM").is_ok_and(|term| term == "dumb")
+    }
+
+    /// Whether `--output json` is given
+    pub fn json_output(&self) -> bool {
+        self.output == OutputFormat::Json
+    }
+}
+
+/// Board configuration subcommands
+#[derive(Subcommand, Clone)]
+pub enum BoardsAction {
+    /// List boards of the ESP-BSP catalog
+    Catalog,
+    /// Add an ESP-BSP board configuration to the ESP-IDF project
+    Add {
+        /// BSP name from the catalog (e.g. m5stack_core_s3)
+        bsp: String,
+        /// Board configuration name (defaults to the BSP name)
+        #[arg(long)]
+        name: Option<String>,
+    },
+    /// Generate a board configuration from a PlatformIO board manifest
+    Import {
+        /// PlatformIO board id (e.g. esp32-s3-devkitc-1) or path to a board JSON file
+        #[arg(long = "from-platformio", value_name = "BOARD_ID")]
+        from_platformio: String,
+        /// Board configuration name (defaults to the board id)
+        #[arg(long)]
+        name: Option<String>,
+    },
+    /// Probe connected devices and generate board configurations matching their hardware
+    Detect {
+        /// Probe only this serial port (defaults to all ESP-compatible ports)
+        #[arg(short, long)]
+        port: Option<String>,
+        /// Show the detected boards without writing configuration files
+        #[arg(long)]
+        dry_run: bool,
+    },
+    /// Register the device on a serial port for a board, so flash and monitor find it on any port
+    Assign {
+        /// Board configuration
+        board: String,
+        /// Serial port of the device (defaults to the only connected ESP device)
+        #[arg(short, long)]
+        port: Option<String>,
+    },
+    /// Forget the device registered for a board
+    Unassign {
+        /// Board configuration
+        board: String,
+    },
+    /// List the registered devices and the ports they are on now
+    Devices,
+}
+
+/// Board configuration inspection subcommands
+#[derive(Subcommand, Clone)]
+pub enum ConfigAction {
+    /// Show the differences between the effective sdkconfig of two boards
+    Diff {
+        /// First board configuration
+        left: String,
+        /// Second board configuration
+        right: String,
+    },
+    /// Show and validate the custom partition table of a board
+    Partitions {
+        /// Board configuration
+        board: String,
+    },
+    /// Check board configs for options their target chip doesn't support; fails on errors
+    Lint {
+        /// Board configurations to check (defaults to all boards)
+        boards: Vec<String>,
+        /// Fail on warnings too
+        #[arg(long)]
+        strict: bool,
+    },
+}
+
+/// Over-the-air update subcommands
+#[derive(Subcommand, Clone)]
+pub enum OtaAction {
+    /// Send the built app binary to the devices of the ota: section of espbrew.yaml
+    Deploy {
+        /// Update only devices running this board (repeatable; defaults to all devices)
+        #[arg(short, long = "board")]
+        boards: Vec<String>,
+        /// Update only this device (repeatable)
+        #[arg(short, long = "device")]
+        devices: Vec<String>,
+    },
+}
+
+/// Export subcommands
+#[derive(Subcommand, Clone)]
+pub enum ExportAction {
+    /// Write an ESP Web Tools manifest.json and the images of each board, for a browser installer
+    Webflash {
+        /// Export only these boards (repeatable; defaults to all boards)
+        #[arg(short, long = "board")]
+        boards: Vec<String>,
+        /// Directory the installers are written to, one subdirectory per board
+        #[arg(short, long, default_value = crate::projects::webflash::WEBFLASH_DIR)]
+        out: PathBuf,
+        /// Name the installer shows (defaults to the project name of the build)
+        #[arg(long)]
+        name: Option<String>,
+        /// Version the installer shows (defaults to the project version of the build)
+        #[arg(long)]
+        firmware_version: Option<String>,
+    },
+}
+
+/// Logs subcommands
+#[derive(Subcommand, Clone)]
+pub enum LogsAction {
+    /// Print the lines of the stored logs matching a regex, e.g. `error:`
+    Search {
+        /// Regex the lines are matched against
+        pattern: String,
+        /// Search only the logs whose path names this board
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Match regardless of case
+        #[arg(short, long)]
+        ignore_case: bool,
+        /// Maximum number of lines printed
+        #[arg(long, default_value = "1000")]
+        limit: usize,
+    },
+}
+
+/// Device subcommands
+#[derive(Subcommand, Clone)]
+pub enum DeviceAction {
+    /// Record the images of a board's last build as the golden images its devices are reset to
+    Golden {
+        /// Board whose build to record (defaults to the only board)
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Default NVS image to write to the board's NVS partition on reset
+        #[arg(long)]
+        nvs: Option<PathBuf>,
+    },
+    /// Erase a device's flash and write the golden images of its board
+    FactoryReset {
+        /// Board whose golden images to write (defaults to the only board)
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Serial port of the device (defaults to the board's port or registered device)
+        #[arg(short, long)]
+        port: Option<String>,
+    },
+}
+
+/// Workspace subcommands
+#[derive(Subcommand, Clone)]
+pub enum WorkspaceAction {
+    /// List all projects found below the project directory
+    List {
+        /// Maximum directory depth to search for projects
+        #[arg(long, default_value = "4")]
+        depth: usize,
+    },
+    /// Build all workspace projects, or only the selected ones
+    Build {
+        /// Build only projects matching this path (repeatable, e.g. -p apps/sensor -p tools)
+        #[arg(short, long = "project")]
+        projects: Vec<String>,
+        /// Build only this board in each selected project
+        #[arg(short, long)]
+        board: Option<String>,
+        /// Build only boards matching these tags (comma separated, `!tag` excludes)
+        #[arg(long)]
+        tags: Option<String>,
+        /// Maximum directory depth to search for projects
+        #[arg(long, default_value = "4")]
+        depth: usize,
+        /// Keep building remaining projects after a failure
+        #[arg(long)]
+        keep_going: bool,
+    },
 }
@@ -0,0 +1,62 @@
+//! Agent command implementation
+
+use crate::projects::remote_build::{AGENT_TOKEN_ENV, agent_token};
+use crate::server::routes::agent::create_agent_routes;
+use crate::server::routes::health::create_health_route;
+use crate::server::services::BuildAgentService;
+use anyhow::{Context, Result};
+use std::net::SocketAddr;
+use std::path::PathBuf;
+use std::sync::Arc;
+use warp::Filter;
+
+pub async fn execute_agent_command(
+    listen: &str,
+    work_dir: Option<PathBuf>,
+    token: Option<String>,
+) -> Result<()> {
+    let address: SocketAddr = listen
+        .parse()
+        .with_context(|| format!("Invalid listen address '{}', expected host:port", listen))?;
+    // Jobs run the shipped project's hooks, so only the local machine gets
+    // to send them without a token
+    let token = token.filter(|t| !t.is_empty()).or_else(agent_token);
+    if token.is_none() && !address.ip().is_loopback() {
+        return Err(anyhow::anyhow!(
+            "Listening on {} needs a token: pass --token or set {}",
+            address,
+            AGENT_TOKEN_ENV
+        ));
+    }
+    let work_root = work_dir.unwrap_or_else(|| {
+        dirs::cache_dir()
+            .unwrap_or_else(std::env::temp_dir)
+            .join("espbrew")
+            .join("agent")
+    });
+    std::fs::create_dir_all(&work_root)
+        .with_context(|| format!("Failed to create {}", work_root.display()))?;
+
+    log::info!("🤖 ESPBrew Build Agent");
+    log::info!("📁 Work directory: {}", work_root.display());
+    log::info!(
+        "🌐 Listening on http://{}, build here with: espbrew build --agent http://<host>:{}{}",
+        address,
+        address.port(),
+        if token.is_some() {
+            format!(" ({} required)", AGENT_TOKEN_ENV)
+        } else {
+            String::new()
+        }
+    );
+
+    let service = Arc::new(BuildAgentService::new(work_root));
+    let routes = create_health_route().or(create_agent_routes(service, token));
+    let (_, server) = warp::serve(routes).try_bind_with_graceful_shutdown(address, async {
+        let _ = tokio::signal::ctrl_c().await;
+    })?;
+    server.await;
+
+    log::info!("👋 Build agent stopped");
+    Ok(())
+}
@@ -1,7 +1,18 @@
 //! Boards command implementation - List connected USB boards
 
+use crate::cli::args::{BoardsAction, Cli};
+use crate::projects::ProjectRegistry;
+use crate::projects::board_detect::{DetectedBoard, write_detected_board};
+use crate::projects::bsp_catalog::{BSP_CATALOG, add_bsp_board, find_bsp};
+use crate::projects::device_registry::{DeviceRegistry, register_device, resolve_port};
+use crate::projects::platformio_boards::{
+    PioBoardManifest, find_board_manifest, import_platformio_board,
+};
+use crate::utils::espflash_utils::{find_esp_ports, identify_esp_board};
+use crate::utils::native_usb::UsbInterface;
 use anyhow::Result;
-use log::{debug, info};
+use log::{debug, info, warn};
+use std::path::Path;
 
 /// Execute the boards command to list connected USB serial ports
 pub async fn execute_boards_command() -> Result<()> {
@@ -39,6 +50,11 @@ pub async fn execute_boards_command() -> Result<()> {
                     println!("  Serial: {}", serial);
                 }
 
+                let interface = UsbInterface::from_ids(usb_info.vid, usb_info.pid);
+                if interface.is_native() {
+                    println!("  Interface: {} (no UART bridge)", interface.describe());
+                }
+
                 // Check if it looks like an ESP32 device
                 let is_esp_vid = matches!(
                     usb_info.vid,
@@ -77,3 +93,209 @@ pub async fn execute_boards_command() -> Result<()> {
 
     Ok(())
 }
+
+/// Execute a `boards` subcommand
+pub async fn execute_boards_action(cli: &Cli, action: BoardsAction) -> Result<()> {
+    match action {
+        BoardsAction::Catalog => {
+            info!("📚 ESP-BSP board catalog ({} boards):", BSP_CATALOG.len());
+            for bsp in BSP_CATALOG {
+                info!("  {:<28} {:<8} {}", bsp.name, bsp.target, bsp.description);
+            }
+            Ok(())
+        }
+        BoardsAction::Add { bsp, name } => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let board = find_bsp(&bsp).ok_or_else(|| {
+                anyhow::anyhow!(
+                    "Unknown BSP '{}'. Run 'espbrew boards catalog' to list available boards",
+                    bsp
+                )
+            })?;
+
+            info!(
+                "➕ Adding {} ({}, {}) to {}",
+                board.description,
+                board.component(),
+                board.target,
+                project_dir.display()
+            );
+
+            for file in add_bsp_board(&project_dir, board, name.as_deref())? {
+                info!(
+                    "  📄 {}",
+                    file.strip_prefix(&project_dir).unwrap_or(&file).display()
+                );
+            }
+
+            list_project_boards(&project_dir)
+        }
+        BoardsAction::Import {
+            from_platformio,
+            name,
+        } => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let manifest_path = find_board_manifest(&project_dir, &from_platformio)?;
+            let manifest = PioBoardManifest::load(&manifest_path)?;
+            let board_id = manifest_path
+                .file_stem()
+                .map(|stem| stem.to_string_lossy().to_string())
+                .unwrap_or(from_platformio);
+
+            info!(
+                "📥 Importing {} ({}) from {}",
+                manifest.name,
+                manifest.chip(),
+                manifest_path.display()
+            );
+
+            for file in
+                import_platformio_board(&project_dir, &manifest, &board_id, name.as_deref())?
+            {
+                info!(
+                    "  📄 {}",
+                    file.strip_prefix(&project_dir).unwrap_or(&file).display()
+                );
+            }
+
+            list_project_boards(&project_dir)
+        }
+        BoardsAction::Detect { port, dry_run } => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let ports = match port {
+                Some(port) => vec![port],
+                None => find_esp_ports()?,
+            };
+            if ports.is_empty() {
+                return Err(anyhow::anyhow!("No ESP-compatible serial ports found"));
+            }
+
+            info!("🔍 Probing {} serial port(s)...", ports.len());
+            let mut written = 0;
+            for port in &ports {
+                let Some(info) = identify_esp_board(port).await? else {
+                    warn!("⚠️  {}: no ESP device responded", port);
+                    continue;
+                };
+                let board = DetectedBoard::from_board_info(&info);
+                info!("📟 {}: {} → {}", port, board.summary(), board.config_name());
+
+                if dry_run {
+                    continue;
+                }
+                match write_detected_board(&project_dir, &board)? {
+                    Some(file) => {
+                        written += 1;
+                        info!(
+                            "  📄 {}",
+                            file.strip_prefix(&project_dir).unwrap_or(&file).display()
+                        );
+                    }
+                    None => info!("  ⏭️  {} already exists", board.config_name()),
+                }
+            }
+
+            if written > 0 {
+                list_project_boards(&project_dir)?;
+            }
+            Ok(())
+        }
+        BoardsAction::Assign { board, port } => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let registry = ProjectRegistry::new();
+            if let Some(handler) = registry.detect_project(&project_dir)
+                && !handler
+                    .discover_boards(&project_dir)?
+                    .iter()
+                    .any(|b| b.name == board)
+            {
+                warn!("⚠️  The project has no board configuration named {}", board);
+            }
+
+            let port = match port {
+                Some(port) => port,
+                None => match find_esp_ports()?.as_slice() {
+                    [port] => port.clone(),
+                    [] => return Err(anyhow::anyhow!("No ESP-compatible serial ports found")),
+                    ports => {
+                        return Err(anyhow::anyhow!(
+                            "Several devices are connected ({}), choose one with --port",
+                            ports.join(", ")
+                        ));
+                    }
+                },
+            };
+
+            let device = register_device(&project_dir, &board, &port).await?;
+            info!(
+                "📌 {} → {} ({})",
+                board,
+                device.description,
+                device.identity()
+            );
+            Ok(())
+        }
+        BoardsAction::Unassign { board } => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let mut registry = DeviceRegistry::load(&project_dir)?;
+            match registry.boards.remove(&board) {
+                Some(device) => {
+                    registry.save(&project_dir)?;
+                    info!(
+                        "🗑️  {} no longer has a registered device ({})",
+                        board,
+                        device.identity()
+                    );
+                }
+                None => info!("ℹ️  No device is registered for {}", board),
+            }
+            Ok(())
+        }
+        BoardsAction::Devices => {
+            let current_dir = std::env::current_dir()?;
+            let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+            let registry = DeviceRegistry::load(&project_dir)?;
+            if registry.boards.is_empty() {
+                info!("ℹ️  No devices registered, add one with: espbrew boards assign <board>");
+                return Ok(());
+            }
+            info!("📌 Registered devices:");
+            for (board, device) in &registry.boards {
+                let location = match resolve_port(&project_dir, board).await {
+                    Ok(Some(port)) => format!("on {}", port),
+                    _ => "not connected".to_string(),
+                };
+                info!("  {:<24} {} - {}", board, device.identity(), location);
+            }
+            Ok(())
+        }
+    }
+}
+
+/// Log the boards the project has after configurations were added
+fn list_project_boards(project_dir: &Path) -> Result<()> {
+    if let Some(handler) = ProjectRegistry::new().detect_project(project_dir) {
+        let boards = handler.discover_boards(project_dir)?;
+        info!("🎯 Project now has {} board(s):", boards.len());
+        for board in &boards {
+            info!(
+                "  - {} ({})",
+                board.name,
+                board.target.as_deref().unwrap_or("auto-detect")
+            );
+        }
+    }
+
+    Ok(())
+}
@@ -1,12 +1,89 @@
 //! Build command implementation
 
 use crate::cli::args::Cli;
-use crate::models::AppEvent;
-use crate::projects::ProjectRegistry;
+use crate::cli::tui::board_picker::run_board_picker;
+use crate::cli::tui::theme::Theme;
+use crate::models::project::BuildStrategy;
+use crate::models::{AppEvent, ProjectBoardConfig, ProjectType};
+use crate::projects::board_picker::BoardPicker;
+use crate::projects::board_tags::{TagFilter, filter_boards_by_tags};
+use crate::projects::build_history::{estimate_duration, format_duration, load_history};
+use crate::projects::build_plan::{PlanFormat, board_plan, format_board_plan};
+use crate::projects::build_scheduler::{
+    BuildScheduler, SchedulerSettings, board_priority, board_weight,
+};
+use crate::projects::build_session::{BUILD_SESSION_FILE, BuildSession};
+use crate::projects::device_registry::{DeviceRegistry, connected_ports, register_device};
+use crate::projects::incremental::{BuildOutcome, build_board_incremental};
+use crate::projects::json_output::{
+    BoardReport, BoardStatus, JsonEvent, OutputTails, RunSummary, emit,
+};
+use crate::projects::lockfile::{BUILD_LOCK_FILE, BuildLock};
+use crate::projects::merged_binary::{merged_binary_enabled, merged_binary_path};
+use crate::projects::notifications::{
+    NotificationEvent, configured_notifications, notify_desktop, run_summary,
+};
+use crate::projects::remote_build::{AgentPool, build_board_on_agent};
+use crate::projects::retry::{RetryTally, prepare_build_with_retries};
+use crate::projects::source_links::{hyperlink_locations, link_url_template};
+use crate::projects::uf2::{uf2_enabled, uf2_path};
+use crate::projects::{ProjectHandler, ProjectRegistry};
+use crate::utils::compiler_cache::{self, CacheStats};
+use crate::utils::diagnostics::{DiagnosticsCollector, Severity};
+use crate::utils::firmware_size::SizeReport;
+use crate::utils::logging::is_plain_output;
 use anyhow::Result;
+use futures_util::future::join_all;
+use std::collections::HashMap;
+use std::io::IsTerminal;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
 use tokio::sync::mpsc;
 
-pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Result<()> {
+/// Diagnostics listed after a build run, errors and the most shared ones first
+const MAX_LISTED_DIAGNOSTICS: usize = 20;
+
+/// Boards a build run covers
+pub enum BoardSelection<'a> {
+    All,
+    Board(&'a str),
+    Tags(&'a str),
+    /// Boards checked in the picker, which starts with all boards or those
+    /// matching the tags checked
+    Pick(Option<&'a str>),
+    /// The unfinished boards of an interrupted session
+    Resume(BuildSession),
+}
+
+pub async fn execute_build_command(
+    cli: &Cli,
+    board_filter: Option<&str>,
+    tag_filter: Option<&str>,
+    locked: bool,
+    force: bool,
+    pick: bool,
+    plan: Option<PlanFormat>,
+) -> Result<()> {
+    let selection = match (board_filter, tag_filter) {
+        (None, spec) if pick => BoardSelection::Pick(spec),
+        (Some(board_name), _) => BoardSelection::Board(board_name),
+        (None, Some(spec)) => BoardSelection::Tags(spec),
+        (None, None) => BoardSelection::All,
+    };
+    execute_build_selection(cli, selection, locked, force, plan).await
+}
+
+/// Build the selected boards, recording their progress in the build session.
+/// With `plan` the commands are printed in that format instead of being run.
+pub async fn execute_build_selection(
+    cli: &Cli,
+    selection: BoardSelection<'_>,
+    locked: bool,
+    force: bool,
+    plan: Option<PlanFormat>,
+) -> Result<()> {
     let current_dir = std::env::current_dir()?;
     let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
 
@@ -35,14 +112,21 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
     );
     log::info!("📝 Description: {}", handler.project_type().description());
 
-    // Check if required tools are available
-    if let Err(error_msg) = handler.check_tools_available() {
+    // Remote agents bring their own tools
+    let agent_pool = AgentPool::resolve(project_dir, &cli.agents)?;
+
+    // Check if required tools are available; a dry run still shows what would run
+    if agent_pool.is_none()
+        && let Err(error_msg) = handler.check_tools_available()
+    {
         log::warn!("⚠️  Tool check failed: {}", error_msg);
-        log::info!("\n{}", handler.get_missing_tools_message());
-        return Err(anyhow::anyhow!(
-            "Required tools not available: {}",
-            error_msg
-        ));
+        if plan.is_none() {
+            log::info!("\n{}", handler.get_missing_tools_message());
+            return Err(anyhow::anyhow!(
+                "Required tools not available: {}",
+                error_msg
+            ));
+        }
     }
 
     // Discover board configurations
@@ -54,8 +138,146 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
         ));
     }
 
+    // Config files of every board, so editing one board only rebuilds that board
+    let config_files: Vec<PathBuf> = all_board_configs
+        .iter()
+        .map(|c| c.config_file.clone())
+        .collect();
+
     // Filter board configurations if specified
-    let board_configs = if let Some(board_name) = board_filter {
+    let (board_configs, session) = match selection {
+        BoardSelection::Resume(session) => {
+            let unfinished = session.unfinished();
+            let filtered: Vec<_> = all_board_configs
+                .into_iter()
+                .filter(|config| unfinished.contains(&config.name.as_str()))
+                .collect();
+            if filtered.len() < unfinished.len() {
+                log::warn!(
+                    "⚠️  {} board(s) of the session no longer exist and are skipped",
+                    unfinished.len() - filtered.len()
+                );
+            }
+            if filtered.is_empty() {
+                BuildSession::remove(project_dir)?;
+                return Err(anyhow::anyhow!(
+                    "None of the unfinished boards of the session exist anymore, discarded {}",
+                    BUILD_SESSION_FILE
+                ));
+            }
+
+            log::info!(
+                "▶️  Resuming the build session started {}: {} of {} board(s) left",
+                session.started.format("%Y-%m-%d %H:%M:%S"),
+                filtered.len(),
+                session.boards.len()
+            );
+            (filtered, session)
+        }
+        selection => {
+            if plan.is_none()
+                && let Ok(Some(previous)) = BuildSession::load(project_dir)
+            {
+                log::warn!(
+                    "⚠️  Replacing the unfinished build session started {} (`espbrew resume` continues it instead)",
+                    previous.started.format("%Y-%m-%d %H:%M:%S")
+                );
+            }
+            let filtered = match selection {
+                BoardSelection::Pick(spec) => {
+                    match pick_boards(cli, project_dir, all_board_configs, spec).await? {
+                        Some(picked) => picked,
+                        None => return Ok(()),
+                    }
+                }
+                selection => select_boards(project_dir, all_board_configs, selection)?,
+            };
+            let session = BuildSession::new(&filtered, locked, force);
+            (filtered, session)
+        }
+    };
+
+    let history = load_history(project_dir);
+    for config in &board_configs {
+        let target_info = config.target.as_deref().unwrap_or("unknown");
+        match estimate_duration(&history, &config.name) {
+            Some(estimate) => log::info!(
+                "  - {} ({}, usually ~{})",
+                config.name,
+                target_info,
+                format_duration(estimate)
+            ),
+            None => log::info!("  - {} ({})", config.name, target_info),
+        }
+    }
+
+    if let Some(format) = plan {
+        if agent_pool.is_some() {
+            log::info!(
+                "🛰️  The boards would build on remote agents, which run these commands there"
+            );
+        }
+        return print_build_plan(
+            handler.as_ref(),
+            project_dir,
+            &config_files,
+            &board_configs,
+            force,
+            format,
+        )
+        .await;
+    }
+
+    run_build(
+        cli,
+        project_dir,
+        handler.as_ref(),
+        agent_pool.as_ref(),
+        &config_files,
+        board_configs,
+        session,
+        locked,
+        force,
+    )
+    .await
+}
+
+/// Print what building the boards would run, in build order, without running anything
+async fn print_build_plan(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    config_files: &[PathBuf],
+    board_configs: &[ProjectBoardConfig],
+    force: bool,
+    format: PlanFormat,
+) -> Result<()> {
+    let mut plans = Vec::new();
+    for board_config in board_configs {
+        plans.push(board_plan(handler, project_dir, board_config, config_files, force).await?);
+    }
+
+    match format {
+        PlanFormat::Json => println!("{}", serde_json::to_string_pretty(&plans)?),
+        PlanFormat::Text => {
+            println!(
+                "🧪 Dry run of {} board(s), nothing is executed",
+                plans.len()
+            );
+            for plan in &plans {
+                println!("\n{}", format_board_plan(plan));
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Boards matching a `--board` or `--tags` selection, all boards otherwise
+fn select_boards(
+    project_dir: &Path,
+    all_board_configs: Vec<ProjectBoardConfig>,
+    selection: BoardSelection<'_>,
+) -> Result<Vec<ProjectBoardConfig>> {
+    let board_configs = if let BoardSelection::Board(board_name) = selection {
         let available_boards: Vec<String> =
             all_board_configs.iter().map(|c| c.name.clone()).collect();
         let filtered: Vec<_> = all_board_configs
@@ -73,6 +295,23 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
 
         log::info!("🎯 Building specific board: {}", board_name);
         filtered
+    } else if let BoardSelection::Tags(spec) = selection {
+        let filter = TagFilter::parse(spec)?;
+        let filtered = filter_boards_by_tags(project_dir, all_board_configs, &filter);
+
+        if filtered.is_empty() {
+            return Err(anyhow::anyhow!(
+                "No board configurations match tags '{}'",
+                filter
+            ));
+        }
+
+        log::info!(
+            "🏷️  {} board configuration(s) match tags '{}':",
+            filtered.len(),
+            filter
+        );
+        filtered
     } else {
         log::info!(
             "🎯 Found {} board configuration(s) (building all):",
@@ -80,44 +319,383 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
         );
         all_board_configs
     };
+    Ok(board_configs)
+}
 
-    for config in &board_configs {
-        let target_info = config.target.as_deref().unwrap_or("unknown");
-        log::info!("  - {} ({})", config.name, target_info);
+/// Boards checked in the picker, after registering the devices assigned to
+/// them; `None` if the picker was cancelled
+async fn pick_boards(
+    cli: &Cli,
+    project_dir: &Path,
+    all_board_configs: Vec<ProjectBoardConfig>,
+    tag_spec: Option<&str>,
+) -> Result<Option<Vec<ProjectBoardConfig>>> {
+    if is_plain_output() {
+        return Err(anyhow::anyhow!(
+            "--pick opens an interactive picker, which plain output leaves out; use --board or --tags"
+        ));
     }
+    let checked: Vec<String> = match tag_spec {
+        Some(spec) => {
+            let filter = TagFilter::parse(spec)?;
+            filter_boards_by_tags(project_dir, all_board_configs.clone(), &filter)
+                .into_iter()
+                .map(|config| config.name)
+                .collect()
+        }
+        None => all_board_configs.iter().map(|c| c.name.clone()).collect(),
+    };
+    let ports = connected_ports().unwrap_or_else(|e| {
+        log::warn!("⚠️  Failed to list the connected devices: {}", e);
+        Vec::new()
+    });
+    let registry = DeviceRegistry::load(project_dir)?;
+    let picker = BoardPicker::new(&all_board_configs, &checked, &ports, &registry);
+    let theme = Theme::resolve(cli.theme.as_deref())?;
+
+    let Some(picker) = run_board_picker(picker, &theme)? else {
+        log::info!("🚫 Board picker cancelled, nothing is built");
+        return Ok(None);
+    };
+
+    for (board, port) in picker.assignments() {
+        match register_device(project_dir, &board, &port).await {
+            Ok(device) => log::info!(
+                "📌 {} → {} ({})",
+                board,
+                device.description,
+                device.identity()
+            ),
+            Err(e) => log::warn!(
+                "⚠️  Failed to register the device on {} for {}: {}",
+                port,
+                board,
+                e
+            ),
+        }
+    }
+
+    let picked = picker.picked();
+    if picked.is_empty() {
+        log::info!("ℹ️  No boards picked, nothing is built");
+        return Ok(None);
+    }
+    log::info!("🎯 {} board configuration(s) picked:", picked.len());
+    Ok(Some(
+        all_board_configs
+            .into_iter()
+            .filter(|config| picked.contains(&config.name))
+            .collect(),
+    ))
+}
+
+async fn run_build(
+    cli: &Cli,
+    project_dir: &Path,
+    handler: &dyn ProjectHandler,
+    agent_pool: Option<&AgentPool>,
+    config_files: &[PathBuf],
+    mut board_configs: Vec<ProjectBoardConfig>,
+    session: BuildSession,
+    locked: bool,
+    force: bool,
+) -> Result<()> {
+    // Boards with a higher `priority:` start first, the others in discovery order
+    board_configs.sort_by_cached_key(|c| std::cmp::Reverse(board_priority(project_dir, &c.name)));
 
     // Create a channel for build events
     let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
 
-    // Spawn a task to handle build events and log them
+    // Spawn a task to handle build events and log them, collecting the
+    // compiler diagnostics of all boards on the way
+    let build_dirs: HashMap<String, PathBuf> = board_configs
+        .iter()
+        .map(|c| (c.name.clone(), c.build_dir.clone()))
+        .collect();
+    let mut diagnostics = DiagnosticsCollector::new(project_dir);
+    // With JSON output the lines are events on stdout, the failed boards'
+    // last ones going into the summary
+    let json = cli.json_output();
+    let mut tails = OutputTails::default();
+    // Terminals open the hyperlinked source locations on a click
+    let link_template =
+        (std::io::stderr().is_terminal() && !is_plain_output() && !json).then(link_url_template);
+    let link_project_dir = project_dir.to_path_buf();
     let log_handler = tokio::spawn(async move {
+        let mut retries = RetryTally::default();
         while let Some(event) = rx.recv().await {
             match event {
-                AppEvent::BuildOutput(board_name, message) => {
-                    log::info!("[{}] {}", board_name, message);
+                AppEvent::BuildOutput(board_name, mut message) => {
+                    if let Some(build_dir) = build_dirs.get(&board_name) {
+                        diagnostics.add_line(&board_name, build_dir, &message);
+                        if let Some(template) = &link_template {
+                            message = hyperlink_locations(
+                                &message,
+                                build_dir,
+                                &link_project_dir,
+                                template,
+                            );
+                        }
+                    }
+                    if json {
+                        tails.push(&board_name, &message);
+                        emit(&JsonEvent::Output {
+                            board: board_name,
+                            line: message,
+                        });
+                    } else {
+                        log::info!("[{}] {}", board_name, message);
+                    }
                 }
+                AppEvent::StepRetried(board_name, step) => retries.record(&board_name, &step),
                 _ => {}
             }
         }
+        (retries, diagnostics, tails)
     });
 
-    // Build all board configurations
-    let mut build_results = Vec::new();
-    let mut failed_builds = Vec::new();
+    // Fetch shared dependencies once before building the boards here
+    if agent_pool.is_none()
+        && let Err(e) =
+            prepare_build_with_retries(handler, project_dir, &board_configs, tx.clone()).await
+    {
+        log::warn!(
+            "⚠️  Dependency prefetch failed, boards will resolve them individually: {}",
+            e
+        );
+    }
 
-    for board_config in &board_configs {
-        log::info!("🔨 Building board configuration: {}", board_config.name);
+    // Compare the resolved inputs with the lock before anything is built
+    let build_lock = BuildLock::capture(project_dir, &handler.project_type()).await?;
+    if locked {
+        let lock = BuildLock::load(project_dir)?.ok_or_else(|| {
+            anyhow::anyhow!(
+                "--locked needs {}, run a build without --locked first",
+                BUILD_LOCK_FILE
+            )
+        })?;
+        let drift = lock.drift(&build_lock);
+        if !drift.is_empty() {
+            for line in &drift {
+                log::error!("  🔒 {}", line);
+            }
+            return Err(anyhow::anyhow!(
+                "{} change(s) since {} was written, refusing to build with --locked",
+                drift.len(),
+                BUILD_LOCK_FILE
+            ));
+        }
+        log::info!("🔒 Build inputs match {}", BUILD_LOCK_FILE);
+    }
 
-        match handler
-            .build_board(project_dir, board_config, tx.clone())
-            .await
+    // Recorded before anything is built, so an interruption leaves the pending boards behind
+    if let Err(e) = session.save(project_dir) {
+        log::warn!("⚠️  Unable to record the build session: {}", e);
+    }
+    let session = Mutex::new(session);
+    let notifications = configured_notifications(project_dir);
+    let started = Instant::now();
+    let failure_told = AtomicBool::new(false);
+    let board_started = |board_name: &str| {
+        if json {
+            emit(&JsonEvent::BoardStarted {
+                board: board_name.to_string(),
+            });
+        }
+        Instant::now()
+    };
+    let record_result = |board_name: &str, result: &Result<BuildOutcome>, duration: Duration| {
+        let success = result.is_ok();
+        if json {
+            let status = match result {
+                Ok(outcome) if outcome.up_to_date => BoardStatus::UpToDate,
+                Ok(_) => BoardStatus::Built,
+                Err(_) => BoardStatus::Failed,
+            };
+            emit(&JsonEvent::finished(board_name, status, duration));
+        }
+        let mut session = session.lock().unwrap();
+        session.mark(board_name, success);
+        if let Err(e) = session.save(project_dir) {
+            log::warn!("⚠️  Unable to record the build session: {}", e);
+        }
+        // The desktop hears of the first failure while the other boards build
+        if !success
+            && notifications.wants(NotificationEvent::FirstFailure)
+            && !failure_told.swap(true, Ordering::Relaxed)
         {
-            Ok(artifacts) => {
+            tokio::spawn(notify_desktop(
+                project_dir.to_path_buf(),
+                format!("{} build failed", board_name),
+            ));
+        }
+    };
+
+    // Build all board configurations: on the remote agents if there are any,
+    // otherwise in parallel within the scheduler limits if requested
+    let results = if let Some(pool) = agent_pool {
+        log::info!(
+            "🌐 Building on {} agent(s): {}",
+            pool.agents().len(),
+            pool.agents()
+                .iter()
+                .map(ToString::to_string)
+                .collect::<Vec<_>>()
+                .join(", ")
+        );
+
+        join_all(board_configs.iter().map(|board_config| {
+            let tx = tx.clone();
+            async move {
+                let lease = pool.acquire().await;
+                log::info!(
+                    "🔨 Building board configuration: {} on {}",
+                    board_config.name,
+                    lease.agent()
+                );
+                let board_start = board_started(&board_config.name);
+                let result =
+                    build_board_on_agent(lease.agent(), project_dir, board_config, force, tx)
+                        .await
+                        .map(|artifacts| BuildOutcome {
+                            artifacts,
+                            up_to_date: false,
+                        });
+                let duration = board_start.elapsed();
+                record_result(&board_config.name, &result, duration);
+                (board_config, result, duration)
+            }
+        }))
+        .await
+    } else if cli.build_strategy == BuildStrategy::Parallel {
+        let scheduler = BuildScheduler::new(SchedulerSettings::resolve(
+            project_dir,
+            cli.jobs,
+            cli.max_load,
+        ));
+        let settings = scheduler.settings();
+        log::info!(
+            "⚙️  Building in parallel with {} slot(s){}",
+            settings.jobs,
+            settings
+                .max_load
+                .map(|load| format!(", max load {:.1}", load))
+                .unwrap_or_default()
+        );
+
+        join_all(board_configs.iter().map(|board_config| {
+            let scheduler = scheduler.clone();
+            let tx = tx.clone();
+            async move {
+                let weight = board_weight(project_dir, board_config);
+                let priority = board_priority(project_dir, &board_config.name);
+                let _slot = scheduler
+                    .acquire_queued(&board_config.name, weight, priority)
+                    .await;
                 log::info!(
-                    "✅ Build successful for {}: {} artifacts generated",
+                    "🔨 Building board configuration: {} (weight {})",
                     board_config.name,
-                    artifacts.len()
+                    weight
                 );
+                let board_start = board_started(&board_config.name);
+                let result = build_board_incremental(
+                    handler,
+                    project_dir,
+                    board_config,
+                    config_files,
+                    force,
+                    tx,
+                )
+                .await;
+                let duration = board_start.elapsed();
+                record_result(&board_config.name, &result, duration);
+                (board_config, result, duration)
+            }
+        }))
+        .await
+    } else {
+        let mut results = Vec::new();
+        for board_config in &board_configs {
+            log::info!("🔨 Building board configuration: {}", board_config.name);
+            let board_start = board_started(&board_config.name);
+            let result = build_board_incremental(
+                handler,
+                project_dir,
+                board_config,
+                config_files,
+                force,
+                tx.clone(),
+            )
+            .await;
+            let duration = board_start.elapsed();
+            record_result(&board_config.name, &result, duration);
+            results.push((board_config, result, duration));
+        }
+        results
+    };
+
+    let mut build_results = Vec::new();
+    let mut failed_builds = Vec::new();
+    let mut up_to_date = 0;
+    let mut cache_reports = Vec::new();
+    let mut size_reports = Vec::new();
+    let mut merged_images = Vec::new();
+    let mut uf2_images = Vec::new();
+    let mut reports = Vec::new();
+    let uses_compiler_cache = handler.project_type() == ProjectType::EspIdf
+        && compiler_cache::select_cache(project_dir).is_some();
+    let writes_merged_binary =
+        handler.project_type() == ProjectType::EspIdf && merged_binary_enabled(project_dir);
+
+    for (board_config, result, duration) in results {
+        match result {
+            Ok(outcome) => {
+                let artifacts = outcome.artifacts;
+                let status = if outcome.up_to_date {
+                    BoardStatus::UpToDate
+                } else {
+                    BoardStatus::Built
+                };
+                let mut report = BoardReport::new(&board_config.name, status, duration);
+                report.artifacts = artifacts.iter().map(|a| a.file_path.clone()).collect();
+                if outcome.up_to_date {
+                    up_to_date += 1;
+                    log::info!(
+                        "⏭️  {} is up to date: {} artifacts from the last build",
+                        board_config.name,
+                        artifacts.len()
+                    );
+                } else {
+                    log::info!(
+                        "✅ Build successful for {}: {} artifacts generated",
+                        board_config.name,
+                        artifacts.len()
+                    );
+                    if uses_compiler_cache
+                        && let Some(stats) = CacheStats::load(&board_config.build_dir)
+                    {
+                        cache_reports.push(format!("  {}: {}", board_config.name, stats.summary()));
+                    }
+                    if let Some(report) = SizeReport::load(project_dir, &board_config.name) {
+                        size_reports.push(format!(
+                            "  {} {}: {}",
+                            if report.grew() { "📈" } else { "  " },
+                            board_config.name,
+                            report.summary()
+                        ));
+                    }
+                }
+                // Up-to-date boards keep the merged and UF2 images of their last build
+                let merged = merged_binary_path(&board_config.build_dir, &board_config.name);
+                if writes_merged_binary && merged.exists() {
+                    report.artifacts.push(merged.clone());
+                    merged_images.push(format!("  {}: {}", board_config.name, merged.display()));
+                }
+                let uf2 = uf2_path(&board_config.build_dir, &board_config.name);
+                if uf2_enabled(project_dir, &board_config.name) && uf2.exists() {
+                    report.artifacts.push(uf2.clone());
+                    uf2_images.push(format!("  {}: {}", board_config.name, uf2.display()));
+                }
                 for artifact in &artifacts {
                     log::debug!(
                         "   📦 {}: {} ({:?})",
@@ -127,17 +705,60 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
                     );
                 }
                 build_results.push((board_config.name.clone(), artifacts));
+                reports.push(report);
             }
             Err(e) => {
                 log::error!("❌ Build failed for {}: {}", board_config.name, e);
                 failed_builds.push(board_config.name.clone());
+                reports.push(BoardReport::failed(&board_config.name, duration, &e));
             }
         }
     }
 
     // Close the channel and wait for log handler to finish
     drop(tx);
-    log_handler.await?;
+    let (retries, diagnostics, tails) = log_handler.await?;
+    if retries.total() > 0 {
+        log::info!(
+            "🔁 {} retried step(s): {}",
+            retries.total(),
+            retries.summary()
+        );
+    }
+    report_diagnostics(&diagnostics);
+
+    let duration = started.elapsed();
+    if json {
+        for report in reports
+            .iter_mut()
+            .filter(|r| r.status == BoardStatus::Failed)
+        {
+            let errors: Vec<String> = diagnostics
+                .diagnostics()
+                .iter()
+                .filter(|d| d.severity == Severity::Error && d.boards.contains(&report.name))
+                .map(|d| format!("{}: {}", d.location, d.message))
+                .collect();
+            report.error_excerpt = tails.excerpt(&report.name, &errors);
+        }
+        emit(&JsonEvent::Summary(RunSummary::new(
+            "build", reports, duration,
+        )));
+    }
+    if notifications.wants(NotificationEvent::BuildsFinished)
+        && duration >= notifications.min_duration
+    {
+        let results: Vec<(String, bool)> = build_results
+            .iter()
+            .map(|(board, _)| (board.clone(), true))
+            .chain(failed_builds.iter().map(|board| (board.clone(), false)))
+            .collect();
+        notify_desktop(
+            project_dir.to_path_buf(),
+            run_summary("build(s)", &results, duration),
+        )
+        .await;
+    }
 
     // Report results
     if !failed_builds.is_empty() {
@@ -146,13 +767,56 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
             failed_builds.len(),
             failed_builds.join(", ")
         );
+        log::info!(
+            "▶️  Run `espbrew resume` to rebuild the {} unfinished board(s) of this session",
+            session.lock().unwrap().unfinished().len()
+        );
         return Err(anyhow::anyhow!("Some builds failed"));
     }
 
+    if let Err(e) = BuildSession::remove(project_dir) {
+        log::warn!("⚠️  Unable to remove the finished build session: {}", e);
+    }
+
+    if !locked {
+        build_lock.save(project_dir)?;
+        log::info!("🔒 Recorded build inputs in {}", BUILD_LOCK_FILE);
+    }
+
     log::info!(
         "🎉 All {} build(s) completed successfully!",
         build_results.len()
     );
+    if !cache_reports.is_empty() {
+        log::info!("📊 Compiler cache hit rates:");
+        for report in &cache_reports {
+            log::info!("{}", report);
+        }
+    }
+    if !size_reports.is_empty() {
+        log::info!("📏 Firmware size (delta against the previous build):");
+        for report in &size_reports {
+            log::info!("{}", report);
+        }
+    }
+    if !merged_images.is_empty() {
+        log::info!("📦 Merged images (flash at 0x0):");
+        for image in &merged_images {
+            log::info!("{}", image);
+        }
+    }
+    if !uf2_images.is_empty() {
+        log::info!("🪄 UF2 images (copy onto the board's UF2 drive):");
+        for image in &uf2_images {
+            log::info!("{}", image);
+        }
+    }
+    if up_to_date > 0 {
+        log::info!(
+            "⏭️  {} board(s) skipped with unchanged inputs (use --force to rebuild)",
+            up_to_date
+        );
+    }
     log::info!(
         "📦 Total artifacts generated: {}",
         build_results
@@ -163,3 +827,26 @@ pub async fn execute_build_command(cli: &Cli, board_filter: Option<&str>) -> Res
 
     Ok(())
 }
+
+/// List the distinct compiler diagnostics of the run once each, with their boards
+fn report_diagnostics(diagnostics: &DiagnosticsCollector) {
+    if diagnostics.is_empty() {
+        return;
+    }
+
+    log::info!(
+        "🩺 {} distinct warning(s) and {} error(s) across the boards:",
+        diagnostics.count(Severity::Warning),
+        diagnostics.count(Severity::Error)
+    );
+    let listed = diagnostics.diagnostics();
+    for diagnostic in listed.iter().take(MAX_LISTED_DIAGNOSTICS) {
+        log::info!("  {}", diagnostic.summary());
+    }
+    if listed.len() > MAX_LISTED_DIAGNOSTICS {
+        log::info!(
+            "  … and {} more, see the board logs",
+            listed.len() - MAX_LISTED_DIAGNOSTICS
+        );
+    }
+}
@@ -0,0 +1,121 @@
+//! Config command implementation - Inspect board configurations
+
+use crate::cli::args::{Cli, ConfigAction};
+use crate::config::sdkconfig_diff::diff_board_configs;
+use crate::config::sdkconfig_lint::{self, LintSeverity};
+use crate::models::{ProjectBoardConfig, ProjectType};
+use crate::projects::ProjectRegistry;
+use crate::projects::handlers::esp_idf::EspIdfHandler;
+use anyhow::Result;
+use log::info;
+
+/// Execute a `config` subcommand
+pub async fn execute_config_command(cli: &Cli, action: ConfigAction) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.clone().unwrap_or(current_dir);
+
+    let handler = ProjectRegistry::new()
+        .detect_project(&project_dir)
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "Unable to detect project type in: {}",
+                project_dir.display()
+            )
+        })?;
+    let boards = handler.discover_boards(&project_dir)?;
+
+    match action {
+        ConfigAction::Diff { left, right } => {
+            let left_board = find_board(&boards, &left)?;
+            let right_board = find_board(&boards, &right)?;
+
+            let diff = diff_board_configs(&left_board.config_file, &right_board.config_file)?;
+            for line in diff.report_lines(&left, &right) {
+                info!("{}", line);
+            }
+
+            Ok(())
+        }
+        ConfigAction::Partitions { board } => {
+            let board_config = find_board(&boards, &board)?;
+            let Some(layout) = EspIdfHandler::partition_layout(&project_dir, board_config)? else {
+                info!("ℹ️ {} uses a built-in ESP-IDF partition table", board);
+                return Ok(());
+            };
+
+            for line in layout.report_lines() {
+                info!("{}", line);
+            }
+            let problems = layout.problems();
+            if !problems.is_empty() {
+                return Err(anyhow::anyhow!(
+                    "Partition table {} is invalid: {} problem(s)",
+                    layout.csv.display(),
+                    problems.len()
+                ));
+            }
+
+            Ok(())
+        }
+        ConfigAction::Lint {
+            boards: names,
+            strict,
+        } => {
+            if handler.project_type() != ProjectType::EspIdf {
+                return Err(anyhow::anyhow!(
+                    "sdkconfig lint is only available for ESP-IDF projects"
+                ));
+            }
+
+            let selected: Vec<&ProjectBoardConfig> = if names.is_empty() {
+                boards.iter().collect()
+            } else {
+                names
+                    .iter()
+                    .map(|name| find_board(&boards, name))
+                    .collect::<Result<_>>()?
+            };
+
+            let (mut errors, mut warnings) = (0, 0);
+            for board in selected {
+                let issues = EspIdfHandler::lint_board(&project_dir, board)?;
+                for line in sdkconfig_lint::report_lines(&board.name, &board.config_file, &issues) {
+                    info!("{}", line);
+                }
+                errors += issues
+                    .iter()
+                    .filter(|i| i.severity == LintSeverity::Error)
+                    .count();
+                warnings += issues
+                    .iter()
+                    .filter(|i| i.severity == LintSeverity::Warning)
+                    .count();
+            }
+
+            info!("📋 {} error(s), {} warning(s)", errors, warnings);
+            if errors > 0 || (strict && warnings > 0) {
+                return Err(anyhow::anyhow!(
+                    "sdkconfig lint found {} error(s) and {} warning(s)",
+                    errors,
+                    warnings
+                ));
+            }
+
+            Ok(())
+        }
+    }
+}
+
+fn find_board<'a>(boards: &'a [ProjectBoardConfig], name: &str) -> Result<&'a ProjectBoardConfig> {
+    boards.iter().find(|b| b.name == name).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Board configuration '{}' not found. Available boards: {}",
+            name,
+            boards
+                .iter()
+                .map(|b| b.name.as_str())
+                .collect::<Vec<_>>()
+                .join(", ")
+        )
+    })
+}
@@ -0,0 +1,160 @@
+//! Daemon command implementation
+
+use crate::cli::args::Cli;
+use crate::cli::commands::build::{BoardSelection, execute_build_selection};
+use crate::config::{DaemonSection, ProjectConfig};
+use crate::projects::daemon::{RunSummary, Schedule, notify, pull_branch};
+use crate::server::routes::daemon::create_daemon_routes;
+use crate::server::routes::health::create_health_route;
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use std::net::SocketAddr;
+use std::path::Path;
+use tokio::sync::mpsc;
+use warp::Filter;
+
+pub async fn execute_daemon_command(cli: &Cli, once: bool, listen: Option<String>) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    let mut section = ProjectConfig::load(project_dir)?
+        .map(|config| config.daemon)
+        .unwrap_or_default();
+    if listen.is_some() {
+        section.listen = listen;
+    }
+    let schedule = Schedule::from_config(&section)?;
+
+    log::info!("🌙 ESPBrew Daemon");
+    log::info!("📁 Project directory: {}", project_dir.display());
+
+    if once {
+        let summary = run(cli, project_dir, &section, "--once", &mut None).await;
+        return match summary {
+            Some(summary) if !summary.success() => Err(anyhow::anyhow!("{}", summary.text())),
+            _ => Ok(()),
+        };
+    }
+
+    // The sender lives as long as the loop, so without a webhook only the schedule starts runs
+    let (trigger_tx, mut triggers) = mpsc::unbounded_channel::<String>();
+    if let Some(listen) = &section.listen {
+        let address: SocketAddr = listen
+            .parse()
+            .with_context(|| format!("Invalid daemon.listen '{}', expected host:port", listen))?;
+        // Triggered runs pull and build the branch, so only the local machine
+        // gets to start them without a token
+        section.token = section.token.filter(|t| !t.is_empty());
+        if section.token.is_none() && !address.ip().is_loopback() {
+            return Err(anyhow::anyhow!(
+                "Listening on {} needs a token: set daemon.token in espbrew.yaml",
+                address
+            ));
+        }
+        let routes = create_health_route().or(create_daemon_routes(
+            section.token.clone(),
+            trigger_tx.clone(),
+        ));
+        let (address, server) = warp::serve(routes).try_bind_ephemeral(address)?;
+        tokio::spawn(server);
+        log::info!(
+            "🌐 Webhook: POST http://{}/api/v1/daemon/trigger{}",
+            address,
+            if section.token.is_some() {
+                " (token required)"
+            } else {
+                ""
+            }
+        );
+    }
+    log::info!("⏰ Building {}", schedule.describe());
+
+    let mut last_run: Option<DateTime<Local>> = None;
+    let mut last_head: Option<String> = None;
+    loop {
+        let next = schedule.next_run(Local::now(), last_run);
+        if let Some(next) = next.filter(|next| *next > Local::now()) {
+            log::info!("💤 Next run at {}", next.format("%Y-%m-%d %H:%M"));
+        }
+
+        let reason = tokio::select! {
+            _ = sleep_until(next) => "schedule".to_string(),
+            Some(reason) = triggers.recv() => reason,
+            _ = tokio::signal::ctrl_c() => break,
+        };
+        // Triggers that arrived meanwhile are covered by this run
+        while triggers.try_recv().is_ok() {}
+
+        last_run = Some(Local::now());
+        tokio::select! {
+            _ = run(cli, project_dir, &section, &reason, &mut last_head) => {}
+            _ = tokio::signal::ctrl_c() => break,
+        }
+    }
+
+    log::info!("👋 Daemon stopped");
+    Ok(())
+}
+
+async fn sleep_until(time: Option<DateTime<Local>>) {
+    match time {
+        Some(time) => {
+            let wait = (time - Local::now()).to_std().unwrap_or_default();
+            tokio::time::sleep(wait).await;
+        }
+        None => std::future::pending().await,
+    }
+}
+
+/// Pull and build once, unless `HEAD` is still the last built commit.
+/// Returns the result the notifications were sent for.
+async fn run(
+    cli: &Cli,
+    project_dir: &Path,
+    section: &DaemonSection,
+    reason: &str,
+    last_head: &mut Option<String>,
+) -> Option<RunSummary> {
+    let started = Local::now();
+    log::info!("🌙 Run started by {}", reason);
+
+    let (branch, head) = match pull_branch(project_dir, section).await {
+        Ok(pulled) => pulled,
+        Err(e) => {
+            log::error!("❌ Pull failed: {:#}", e);
+            let summary = RunSummary::from_history(
+                project_dir,
+                started,
+                section.branch.clone(),
+                None,
+                Some(format!("pull failed: {:#}", e)),
+            );
+            notify(project_dir, &section.notify, &summary).await;
+            return Some(summary);
+        }
+    };
+    if last_head.as_ref() == Some(&head) {
+        log::info!("⏭️  No new commits on {} since the last run", branch);
+        return None;
+    }
+    log::info!("📥 {} at {}", branch, &head[..head.len().min(8)]);
+
+    let result =
+        execute_build_selection(cli, BoardSelection::All, false, section.force, None).await;
+    *last_head = Some(head.clone());
+
+    let summary = RunSummary::from_history(
+        project_dir,
+        started,
+        Some(branch),
+        Some(head),
+        result.err().map(|e| format!("{:#}", e)),
+    );
+    if summary.success() {
+        log::info!("{}", summary.text());
+    } else {
+        log::error!("{}", summary.text());
+    }
+    notify(project_dir, &section.notify, &summary).await;
+    Some(summary)
+}
@@ -0,0 +1,71 @@
+//! Device command implementation
+
+use crate::cli::args::{Cli, DeviceAction};
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::ProjectRegistry;
+use crate::projects::golden::{factory_reset, record_golden};
+use anyhow::Result;
+use std::path::Path;
+use tokio::sync::mpsc;
+
+pub async fn execute_device_command(cli: &Cli, action: DeviceAction) -> Result<()> {
+    let project_dir = cli.project_dir.as_deref().unwrap_or_else(|| Path::new("."));
+
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    let boards = handler.discover_boards(project_dir)?;
+
+    let board = match &action {
+        DeviceAction::Golden { board, .. } | DeviceAction::FactoryReset { board, .. } => board,
+    };
+    let board_config = select_board(&boards, board.as_deref())?;
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let output_handle = tokio::spawn(async move {
+        while let Some(event) = rx.recv().await {
+            if let AppEvent::BuildOutput(name, message) = event {
+                println!("[{}] {}", name, message);
+            }
+        }
+    });
+    let result = match action {
+        DeviceAction::Golden { nvs, .. } => {
+            let nvs = nvs.map(|nvs| project_dir.join(nvs));
+            record_golden(project_dir, board_config, nvs.as_deref(), &tx)
+                .await
+                .map(|_| ())
+        }
+        DeviceAction::FactoryReset { port, .. } => {
+            factory_reset(project_dir, board_config, port.as_deref(), &tx).await
+        }
+    };
+    drop(tx);
+    output_handle.await?;
+    result
+}
+
+/// The named board, or the only one
+fn select_board<'a>(
+    boards: &'a [ProjectBoardConfig],
+    name: Option<&str>,
+) -> Result<&'a ProjectBoardConfig> {
+    match name {
+        Some(name) => boards
+            .iter()
+            .find(|b| b.name == name)
+            .ok_or_else(|| anyhow::anyhow!("Board '{}' not found", name)),
+        None if boards.len() == 1 => Ok(&boards[0]),
+        None => {
+            let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+            Err(anyhow::anyhow!(
+                "Pick the board with --board ({})",
+                names.join(", ")
+            ))
+        }
+    }
+}
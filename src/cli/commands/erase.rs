@@ -0,0 +1,61 @@
+//! Erase command implementation
+
+use crate::cli::args::Cli;
+use crate::models::AppEvent;
+use crate::projects::ProjectRegistry;
+use crate::projects::erase::{EraseTarget, board_partitions, erase_board, resolve_region};
+use anyhow::Result;
+use std::path::Path;
+use tokio::sync::mpsc;
+
+pub async fn execute_erase_command(
+    cli: &Cli,
+    board: Option<String>,
+    port: Option<String>,
+    region: Option<String>,
+) -> Result<()> {
+    let project_dir = cli.project_dir.as_deref().unwrap_or_else(|| Path::new("."));
+
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    let boards = handler.discover_boards(project_dir)?;
+
+    // The board gives the chip, baud rate, port and partition table
+    let board_config = match &board {
+        Some(name) => boards
+            .iter()
+            .find(|b| &b.name == name)
+            .ok_or_else(|| anyhow::anyhow!("Board '{}' not found", name))?,
+        None if boards.len() == 1 => &boards[0],
+        None => {
+            let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+            return Err(anyhow::anyhow!(
+                "Pick the board to erase with --board ({})",
+                names.join(", ")
+            ));
+        }
+    };
+
+    let target = match &region {
+        Some(region) => resolve_region(&board_partitions(project_dir, board_config)?, region)?,
+        None => EraseTarget::All,
+    };
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let output_handle = tokio::spawn(async move {
+        while let Some(event) = rx.recv().await {
+            if let AppEvent::BuildOutput(name, message) = event {
+                println!("[{}] {}", name, message);
+            }
+        }
+    });
+    let result = erase_board(project_dir, board_config, port.as_deref(), &target, &tx).await;
+    drop(tx);
+    output_handle.await?;
+    result
+}
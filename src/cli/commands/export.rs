@@ -0,0 +1,96 @@
+//! Export command implementation
+
+use crate::cli::args::{Cli, ExportAction};
+use crate::models::AppEvent;
+use crate::projects::ProjectRegistry;
+use crate::projects::webflash::export_webflash;
+use anyhow::Result;
+use std::path::Path;
+use tokio::sync::mpsc;
+
+pub async fn execute_export_command(cli: &Cli, action: ExportAction) -> Result<()> {
+    let project_dir = cli.project_dir.as_deref().unwrap_or_else(|| Path::new("."));
+
+    match action {
+        ExportAction::Webflash {
+            boards,
+            out,
+            name,
+            firmware_version,
+        } => {
+            export_webflash_installers(
+                project_dir,
+                &boards,
+                &project_dir.join(out),
+                name.as_deref(),
+                firmware_version.as_deref(),
+            )
+            .await
+        }
+    }
+}
+
+async fn export_webflash_installers(
+    project_dir: &Path,
+    board_names: &[String],
+    out_dir: &Path,
+    name: Option<&str>,
+    version: Option<&str>,
+) -> Result<()> {
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    let boards = handler.discover_boards(project_dir)?;
+    for name in board_names {
+        if !boards.iter().any(|b| &b.name == name) {
+            return Err(anyhow::anyhow!("Board '{}' not found", name));
+        }
+    }
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let output_handle = tokio::spawn(async move {
+        while let Some(event) = rx.recv().await {
+            if let AppEvent::BuildOutput(name, message) = event {
+                println!("[{}] {}", name, message);
+            }
+        }
+    });
+
+    let mut manifests = Vec::new();
+    let mut failed = Vec::new();
+    for board in boards
+        .iter()
+        .filter(|b| board_names.is_empty() || board_names.contains(&b.name))
+    {
+        match export_webflash(project_dir, board, out_dir, name, version, &tx).await {
+            Ok(manifest) => manifests.push(manifest),
+            Err(e) => {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board.name.clone(),
+                    format!("❌ {:#}", e),
+                ));
+                failed.push(board.name.clone());
+            }
+        }
+    }
+    drop(tx);
+    output_handle.await?;
+
+    println!(
+        "🌐 Exported {} ESP Web Tools installer(s) to {}",
+        manifests.len(),
+        out_dir.display()
+    );
+    if !failed.is_empty() {
+        return Err(anyhow::anyhow!(
+            "{} board(s) not exported: {}",
+            failed.len(),
+            failed.join(", ")
+        ));
+    }
+    Ok(())
+}
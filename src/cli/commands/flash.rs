@@ -1,17 +1,32 @@
 use crate::cli::args::Cli;
 use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
 use crate::projects::ProjectRegistry;
+use crate::projects::flash_orchestrator::{flash_devices, match_devices, probe_devices};
+use crate::projects::flash_parts::FlashPart;
+use crate::projects::incremental::build_board_checked;
+use crate::projects::json_output::{
+    BoardReport, BoardStatus, JsonEvent, OutputTails, RunSummary, emit,
+};
 use crate::projects::registry::ProjectHandler;
+use crate::projects::retry::{RetryTally, flash_board_parts_with_retries};
 use anyhow::Result;
+use std::collections::{HashMap, HashSet};
 use std::path::PathBuf;
+use std::time::Instant;
 use tokio::sync::mpsc;
 
+/// Name of the flashed board in the JSON summary of a project espbrew
+/// doesn't detect
+const FALLBACK_BOARD: &str = "ESP-IDF";
+
 pub async fn execute_flash_command(
     cli: &Cli,
     binary: Option<PathBuf>,
     config: Option<PathBuf>,
     port: Option<String>,
     force_rebuild: bool,
+    all_devices: bool,
+    only: &[FlashPart],
 ) -> Result<()> {
     log::info!("⚡ ESPBrew Local Flash Command");
 
@@ -23,16 +38,32 @@ pub async fn execute_flash_command(
 
     log::info!("📁 Project directory: {}", project_dir.display());
 
+    // With JSON output the progress lines are events on stdout
+    let json = cli.json_output();
+    if all_devices {
+        return flash_all_devices(project_dir, force_rebuild, json).await;
+    }
+
     // Create event channel for progress tracking
     let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
 
     // Spawn a task to handle progress events
     let progress_handle = tokio::spawn(async move {
+        let mut retries = RetryTally::default();
+        let mut tails = OutputTails::default();
         while let Some(event) = rx.recv().await {
             match event {
+                AppEvent::BuildOutput(board_name, message) if json => {
+                    tails.push(&board_name, &message);
+                    emit(&JsonEvent::Output {
+                        board: board_name,
+                        line: message,
+                    });
+                }
                 AppEvent::BuildOutput(board_name, message) => {
                     println!("[{}] {}", board_name, message);
                 }
+                AppEvent::ActionFinished(..) if json => {}
                 AppEvent::ActionFinished(board_name, action, success) => {
                     if success {
                         println!("✅ Flash completed successfully for {}", board_name);
@@ -40,53 +71,270 @@ pub async fn execute_flash_command(
                         println!("❌ Flash failed for {}: {}", board_name, action);
                     }
                 }
+                AppEvent::StepRetried(board_name, step) => retries.record(&board_name, &step),
                 _ => {} // Ignore other event types
             }
         }
+        (retries, tails)
     });
 
     // Try to detect project type and get appropriate handler
     let registry = ProjectRegistry::new();
     let project_handler = registry.detect_project(project_dir);
 
-    if let Some(handler) = project_handler {
+    let started = Instant::now();
+    let (board_name, result) = if let Some(handler) = project_handler {
         log::info!("🔍 Detected project type: {:?}", handler.project_type());
-        flash_with_project_handler(
+        let board_config = select_board_config(handler, project_dir, config)?;
+        if json {
+            emit(&JsonEvent::BoardStarted {
+                board: board_config.name.clone(),
+            });
+        }
+        let result = flash_with_project_handler(
             handler,
             project_dir,
+            &board_config,
             binary,
-            config,
             port,
             force_rebuild,
+            only,
             tx,
         )
-        .await?
+        .await;
+        (board_config.name, result)
+    } else if !only.is_empty() {
+        return Err(anyhow::anyhow!(
+            "Unable to detect the project type, --only needs the board's build"
+        ));
     } else {
         log::info!("🔍 No specific project type detected, trying ESP-IDF fallback...");
-        flash_esp_idf_fallback(project_dir, binary, config, port, tx).await?
+        if json {
+            emit(&JsonEvent::BoardStarted {
+                board: FALLBACK_BOARD.to_string(),
+            });
+        }
+        let artifacts = binary.iter().cloned().collect();
+        let result = flash_esp_idf_fallback(project_dir, binary, config, port, tx).await;
+        (FALLBACK_BOARD.to_string(), result.map(|()| artifacts))
+    };
+
+    // Wait for progress handling to complete; every sender is gone by now
+    let (retries, tails) = progress_handle.await?;
+    if retries.total() > 0 {
+        log::info!(
+            "🔁 {} retried step(s): {}",
+            retries.total(),
+            retries.summary()
+        );
     }
 
-    // Wait for progress handling to complete
-    progress_handle.abort();
+    if json {
+        let duration = started.elapsed();
+        let report = match &result {
+            Ok(artifacts) => BoardReport {
+                artifacts: artifacts.clone(),
+                ..BoardReport::new(&board_name, BoardStatus::Flashed, duration)
+            },
+            Err(e) => BoardReport {
+                error_excerpt: tails.excerpt(&board_name, &[]),
+                ..BoardReport::failed(&board_name, duration, e)
+            },
+        };
+        emit(&JsonEvent::finished(&board_name, report.status, duration));
+        emit(&JsonEvent::Summary(RunSummary::new(
+            "flash",
+            vec![report],
+            duration,
+        )));
+    }
+    result?;
 
     log::info!("🎉 Flash operation completed!");
     Ok(())
 }
 
-async fn flash_with_project_handler(
-    handler: &dyn ProjectHandler,
+/// Flash every connected device at once with the board configuration matching it
+async fn flash_all_devices(
     project_dir: &std::path::Path,
-    binary: Option<PathBuf>,
-    config: Option<PathBuf>,
-    port: Option<String>,
     force_rebuild: bool,
-    tx: mpsc::UnboundedSender<AppEvent>,
+    json: bool,
 ) -> Result<()> {
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    let boards = handler.discover_boards(project_dir)?;
+
+    log::info!("🔍 Probing connected devices...");
+    let devices = probe_devices().await?;
+    if devices.is_empty() {
+        return Err(anyhow::anyhow!("No ESP devices found on the serial ports"));
+    }
+    let plan = match_devices(project_dir, &boards, devices);
+    for (device, reason) in &plan.skipped {
+        log::warn!("⏭️  {}: {}", device.port, reason);
+    }
+    if plan.targets.is_empty() {
+        return Err(anyhow::anyhow!(
+            "None of the connected devices matches a board configuration"
+        ));
+    }
+    for target in &plan.targets {
+        log::info!(
+            "📟 {}: {} → {}",
+            target.device.port,
+            target.device.summary(),
+            target.board.name
+        );
+    }
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let started = Instant::now();
+    let labels: HashSet<String> = plan.targets.iter().map(|t| t.label()).collect();
+    let progress_handle = tokio::spawn(async move {
+        let mut retries = RetryTally::default();
+        let mut shown: HashMap<String, u8> = HashMap::new();
+        let mut verified = HashSet::new();
+        // A device's flash is timed from its first line; the build before it
+        // reports under the board's name
+        let mut first_seen: HashMap<String, Instant> = HashMap::new();
+        let mut tails = OutputTails::default();
+        let mut reports = Vec::new();
+        while let Some(event) = rx.recv().await {
+            match event {
+                AppEvent::BuildOutput(name, message) if json => {
+                    if labels.contains(&name) && !first_seen.contains_key(&name) {
+                        first_seen.insert(name.clone(), Instant::now());
+                        emit(&JsonEvent::BoardStarted {
+                            board: name.clone(),
+                        });
+                    }
+                    tails.push(&name, &message);
+                    emit(&JsonEvent::Output {
+                        board: name,
+                        line: message,
+                    });
+                }
+                AppEvent::BuildOutput(name, message) => {
+                    println!("[{}] {}", name, message);
+                }
+                // Every 10% only, so the devices' output stays readable side by side
+                AppEvent::FlashProgress(label, percent) => {
+                    let step = percent / 10 * 10;
+                    if shown.get(&label).is_none_or(|last| step > *last) {
+                        if json {
+                            emit(&JsonEvent::FlashProgress {
+                                board: label.clone(),
+                                percent: step,
+                            });
+                        } else {
+                            println!("[{}] 📶 {}%", label, step);
+                        }
+                        shown.insert(label, step);
+                    }
+                }
+                AppEvent::FlashVerified(label) => {
+                    verified.insert(label);
+                }
+                AppEvent::DeviceFlashFinished(label, success) if json => {
+                    let duration = first_seen
+                        .get(&label)
+                        .map(Instant::elapsed)
+                        .unwrap_or_default();
+                    let status = if success {
+                        BoardStatus::Flashed
+                    } else {
+                        BoardStatus::Failed
+                    };
+                    emit(&JsonEvent::finished(&label, status, duration));
+                    let mut report = BoardReport::new(&label, status, duration);
+                    if !success {
+                        // The last line is the device's error
+                        report.error_excerpt = tails.excerpt(&label, &[]);
+                        report.error = report.error_excerpt.last().cloned();
+                    }
+                    reports.push(report);
+                }
+                AppEvent::DeviceFlashFinished(label, success) => {
+                    if success && verified.contains(&label) {
+                        println!("✅ Flash completed and verified for {}", label);
+                    } else if success {
+                        println!("✅ Flash completed successfully for {}", label);
+                    } else {
+                        println!("❌ Flash failed for {}", label);
+                    }
+                }
+                AppEvent::StepRetried(name, step) => retries.record(&name, &step),
+                _ => {}
+            }
+        }
+        (retries, verified.len(), reports)
+    });
+
+    // Each board configuration is built once, however many devices get it
+    let mut checked = HashSet::new();
+    for target in &plan.targets {
+        let board = &target.board;
+        if checked.insert(board.name.clone())
+            && (force_rebuild || !handler.check_artifacts_exist(project_dir, board))
+        {
+            log::info!("🔨 Building {} before flashing", board.name);
+            build_board_checked(handler, project_dir, board, tx.clone()).await?;
+        }
+    }
+
+    let failed = flash_devices(project_dir, &plan, tx).await;
+    let (retries, verified, reports) = progress_handle.await?;
+    if retries.total() > 0 {
+        log::info!(
+            "🔁 {} retried step(s): {}",
+            retries.total(),
+            retries.summary()
+        );
+    }
+    if json {
+        emit(&JsonEvent::Summary(RunSummary::new(
+            "flash",
+            reports,
+            started.elapsed(),
+        )));
+    }
+
+    if !failed.is_empty() {
+        return Err(anyhow::anyhow!(
+            "{} of {} device(s) failed: {}",
+            failed.len(),
+            plan.targets.len(),
+            failed.join(", ")
+        ));
+    }
+    if verified > 0 {
+        log::info!(
+            "🎉 Flashed {} device(s), {} verified",
+            plan.targets.len(),
+            verified
+        );
+    } else {
+        log::info!("🎉 Flashed {} device(s)", plan.targets.len());
+    }
+    Ok(())
+}
+
+/// The board configuration of the given config file, or the project's first
+fn select_board_config(
+    handler: &dyn ProjectHandler,
+    project_dir: &std::path::Path,
+    config: Option<PathBuf>,
+) -> Result<ProjectBoardConfig> {
     // First, try to discover boards from the project
     let discovered_boards = handler.discover_boards(project_dir)?;
 
     let board_config = if let Some(config_path) = config {
-        println!(
+        log::info!(
             "📋 Loading board configuration from: {}",
             config_path.display()
         );
@@ -101,14 +349,14 @@ async fn flash_with_project_handler(
                 )
             })?
     } else if !discovered_boards.is_empty() {
-        println!(
+        log::info!(
             "📋 Using first discovered board configuration: {}",
             discovered_boards[0].name
         );
         discovered_boards[0].clone()
     } else {
         // Create a minimal default config for projects without board discovery
-        println!("📋 Creating default board configuration");
+        log::info!("📋 Creating default board configuration");
         ProjectBoardConfig {
             name: "default".to_string(),
             config_file: project_dir.join("sdkconfig.defaults"),
@@ -117,8 +365,22 @@ async fn flash_with_project_handler(
             project_type: handler.project_type(),
         }
     };
+    Ok(board_config)
+}
 
-    println!("🔨 Starting flash process for board: {}", board_config.name);
+/// Flash the board, building it first unless its build is there; returns
+/// the artifacts' paths
+async fn flash_with_project_handler(
+    handler: &dyn ProjectHandler,
+    project_dir: &std::path::Path,
+    board_config: &ProjectBoardConfig,
+    binary: Option<PathBuf>,
+    port: Option<String>,
+    force_rebuild: bool,
+    only: &[FlashPart],
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<PathBuf>> {
+    log::info!("🔨 Starting flash process for board: {}", board_config.name);
 
     // First check for existing artifacts before building
     let artifacts = if binary.is_some() {
@@ -133,13 +395,11 @@ async fn flash_with_project_handler(
         // Check if we should force rebuild or try to find existing artifacts
         if force_rebuild {
             log::info!("🔄 Force rebuild requested, building project...");
-            handler
-                .build_board(project_dir, &board_config, tx.clone())
-                .await?
+            build_board_checked(handler, project_dir, board_config, tx.clone()).await?
         } else {
             // Try to find existing build artifacts first
             let existing_artifacts =
-                try_find_existing_artifacts(handler, project_dir, &board_config);
+                try_find_existing_artifacts(handler, project_dir, board_config);
 
             match existing_artifacts {
                 Ok(artifacts) if !artifacts.is_empty() => {
@@ -151,9 +411,7 @@ async fn flash_with_project_handler(
                 }
                 _ => {
                     log::info!("🔧 No existing artifacts found, building project...");
-                    handler
-                        .build_board(project_dir, &board_config, tx.clone())
-                        .await?
+                    build_board_checked(handler, project_dir, board_config, tx.clone()).await?
                 }
             }
         }
@@ -163,10 +421,18 @@ async fn flash_with_project_handler(
     let port_ref = port.as_deref();
 
     // Call the project handler's flash method
-    handler
-        .flash_board(project_dir, &board_config, &artifacts, port_ref, tx)
-        .await
-        .map_err(|e| anyhow::anyhow!("Flash failed: {}", e))
+    flash_board_parts_with_retries(
+        handler,
+        project_dir,
+        board_config,
+        &artifacts,
+        port_ref,
+        only,
+        tx,
+    )
+    .await
+    .map_err(|e| anyhow::anyhow!("Flash failed: {}", e))?;
+    Ok(artifacts.into_iter().map(|a| a.file_path).collect())
 }
 
 async fn flash_esp_idf_fallback(
@@ -178,7 +444,7 @@ async fn flash_esp_idf_fallback(
 ) -> Result<()> {
     use crate::services::UnifiedFlashService;
 
-    println!("🔄 Attempting ESP-IDF flash using unified service...");
+    log::info!("🔄 Attempting ESP-IDF flash using unified service...");
 
     let flash_service = UnifiedFlashService::new();
 
@@ -189,7 +455,7 @@ async fn flash_esp_idf_fallback(
         crate::utils::espflash_utils::select_esp_port()?
     };
 
-    println!("🔌 Using flash port: {}", flash_port);
+    log::info!("🔌 Using flash port: {}", flash_port);
 
     if let Some(binary_path) = binary {
         // Flash single binary
@@ -227,7 +493,7 @@ async fn flash_esp_idf_fallback(
         }
     }
 
-    println!("✅ ESP-IDF flash completed successfully");
+    log::info!("✅ ESP-IDF flash completed successfully");
     Ok(())
 }
 
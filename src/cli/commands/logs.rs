@@ -0,0 +1,68 @@
+//! Logs command implementation
+
+use crate::cli::args::{Cli, LogsAction};
+use crate::projects::log_search::{names_board, search_logs, stored_logs};
+use anyhow::{Context, Result};
+use regex::RegexBuilder;
+use std::path::Path;
+
+pub async fn execute_logs_command(cli: &Cli, action: LogsAction) -> Result<()> {
+    let project_dir = cli.project_dir.as_deref().unwrap_or_else(|| Path::new("."));
+
+    match action {
+        LogsAction::Search {
+            pattern,
+            board,
+            ignore_case,
+            limit,
+        } => {
+            let regex = RegexBuilder::new(&pattern)
+                .case_insensitive(ignore_case)
+                .build()
+                .with_context(|| format!("Invalid search regex '{}'", pattern))?;
+            let files: Vec<_> = stored_logs(project_dir)
+                .into_iter()
+                .filter(|path| {
+                    board
+                        .as_deref()
+                        .is_none_or(|board| names_board(project_dir, path, board))
+                })
+                .collect();
+            if files.is_empty() {
+                eprintln!("🔍 No stored logs found in {}", project_dir.display());
+                return Ok(());
+            }
+
+            let matches = search_logs(&files, &regex, limit)?;
+            for found in &matches {
+                println!(
+                    "{}:{}: {}",
+                    found
+                        .path
+                        .strip_prefix(project_dir)
+                        .unwrap_or(&found.path)
+                        .display(),
+                    found.line_number,
+                    found.line
+                );
+            }
+            let in_files = {
+                let mut paths: Vec<_> = matches.iter().map(|m| &m.path).collect();
+                paths.dedup();
+                paths.len()
+            };
+            eprintln!(
+                "🔍 {} matching line(s) in {} of {} log(s){}",
+                matches.len(),
+                in_files,
+                files.len(),
+                if matches.len() >= limit {
+                    format!(", stopped at --limit {}", limit)
+                } else {
+                    String::new()
+                }
+            );
+            Ok(())
+        }
+    }
+}
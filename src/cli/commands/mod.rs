@@ -1,30 +1,139 @@
 //! CLI command implementations
 
+pub mod agent;
 pub mod boards;
 pub mod build;
+pub mod config;
+pub mod daemon;
+pub mod device;
 pub mod discover;
+pub mod erase;
+pub mod export;
 pub mod flash;
 pub mod list;
+pub mod logs;
 pub mod monitor;
+pub mod new;
+pub mod ota;
 pub mod remote_flash;
 pub mod remote_monitor;
+pub mod replay;
+pub mod resume;
+pub mod serve;
+pub mod setup;
+pub mod stats;
+pub mod watch;
+pub mod workspace;
 
 use crate::cli::args::{Cli, Commands};
+use crate::projects::build_plan::PlanFormat;
 use anyhow::Result;
 
 /// Execute a CLI command
 pub async fn execute_command(command: Commands, cli: &Cli) -> Result<()> {
     match command {
         Commands::List => list::execute_list_command(cli).await,
-        Commands::Boards => boards::execute_boards_command().await,
-        Commands::Build { board } => build::execute_build_command(cli, board.as_deref()).await,
+        Commands::Boards { action: None } => boards::execute_boards_command().await,
+        Commands::Boards {
+            action: Some(action),
+        } => boards::execute_boards_action(cli, action).await,
+        Commands::Build {
+            board,
+            tags,
+            locked,
+            force,
+            pick,
+            dry_run,
+            json,
+        } => {
+            let plan = dry_run.then_some(if json || cli.json_output() {
+                PlanFormat::Json
+            } else {
+                PlanFormat::Text
+            });
+            build::execute_build_command(
+                cli,
+                board.as_deref(),
+                tags.as_deref(),
+                locked,
+                force,
+                pick,
+                plan,
+            )
+            .await
+        }
+        Commands::Resume { discard } => resume::execute_resume_command(cli, discard).await,
+        Commands::Stats { board, limit } => {
+            stats::execute_stats_command(cli, board.as_deref(), limit).await
+        }
+        Commands::Daemon { once, listen } => {
+            daemon::execute_daemon_command(cli, once, listen).await
+        }
+        Commands::Setup { dry_run, print_env } => {
+            setup::execute_setup_command(cli, dry_run, print_env).await
+        }
+        Commands::Serve { web } => serve::execute_serve_command(cli, &web).await,
+        Commands::Replay { file, speed } => replay::execute_replay_command(cli, &file, speed).await,
+        Commands::Watch {
+            boards,
+            tags,
+            debounce,
+            flash,
+            monitor,
+            port,
+            baud_rate,
+        } => {
+            watch::execute_watch_command(
+                cli,
+                watch::WatchOptions {
+                    boards,
+                    tags,
+                    debounce,
+                    flash,
+                    monitor,
+                    port,
+                    baud_rate,
+                },
+            )
+            .await
+        }
+        Commands::Config { action } => config::execute_config_command(cli, action).await,
+        Commands::New { template, chips } => new::execute_new_command(cli, template, &chips).await,
+        Commands::Ota { action } => ota::execute_ota_command(cli, action).await,
+        Commands::Export { action } => export::execute_export_command(cli, action).await,
+        Commands::Logs { action } => logs::execute_logs_command(cli, action).await,
+        Commands::Workspace { action } => workspace::execute_workspace_command(cli, action).await,
+        Commands::Agent {
+            listen,
+            work_dir,
+            token,
+        } => agent::execute_agent_command(&listen, work_dir, token).await,
         Commands::Discover { timeout } => discover::execute_discover_command(timeout).await,
         Commands::Flash {
             binary,
             config,
             port,
             force_rebuild,
-        } => flash::execute_flash_command(cli, binary, config, port, force_rebuild).await,
+            all_devices,
+            only,
+        } => {
+            flash::execute_flash_command(
+                cli,
+                binary,
+                config,
+                port,
+                force_rebuild,
+                all_devices,
+                &only,
+            )
+            .await
+        }
+        Commands::Erase {
+            board,
+            port,
+            region,
+        } => erase::execute_erase_command(cli, board, port, region).await,
+        Commands::Device { action } => device::execute_device_command(cli, action).await,
         Commands::RemoteFlash {
             binary,
             config,
@@ -67,16 +176,23 @@ pub async fn execute_command(command: Commands, cli: &Cli) -> Result<()> {
         }
         Commands::Monitor {
             port,
+            board,
             baud_rate,
             elf,
             log_format,
             reset,
             non_interactive,
             no_addresses,
+            record,
+            jsonl,
             timeout,
             success_pattern,
             failure_pattern,
         } => {
+            let elf = monitor::monitor_elf(cli, board.as_deref(), elf);
+            let export = jsonl.map(|path| (path, board.clone()));
+            let record = monitor::monitor_recording(cli, board.as_deref(), record);
+            let port = monitor::monitor_port(cli, board, port).await?;
             monitor::execute_monitor_command(
                 port,
                 baud_rate,
@@ -88,6 +204,8 @@ pub async fn execute_command(command: Commands, cli: &Cli) -> Result<()> {
                 timeout,
                 success_pattern,
                 failure_pattern,
+                record,
+                export,
             )
             .await
         }
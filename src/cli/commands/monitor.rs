@@ -1,12 +1,85 @@
 //! Local ESP32 monitoring command implementation
 
+use crate::cli::args::Cli;
+use crate::projects::ProjectRegistry;
+use crate::projects::device_registry::{configured_port, resolve_port};
+use crate::projects::log_export::JsonlExport;
+use crate::projects::monitor_log::{MonitorRecorder, RecordSettings};
+use crate::utils::backtrace::{BacktraceDecoder, board_elf, frame_hyperlink, frame_line};
+use crate::utils::defmt::{DefmtChunk, DefmtDecoder, DefmtSplitter, has_defmt_table};
+use crate::utils::logging::is_plain_output;
+use crate::utils::native_usb::{
+    RECONNECT_TIMEOUT, REENUMERATION_TIMEOUT, UsbInterface, wait_for_port, wait_for_reconnect,
+};
+use crate::utils::serial_tcp::{NetworkPort, NetworkSerial, is_network_port};
 use anyhow::{Context, Result};
-use log::{debug, error, info};
+use log::{debug, error, info, warn};
 use regex::Regex;
 use serialport::SerialPortInfo;
 use std::path::PathBuf;
 use std::time::{Duration, Instant};
 
+/// `--port`, or the `port:` of `--board` in `espbrew.yaml`, or the port the
+/// device registered for it is on now
+pub async fn monitor_port(
+    cli: &Cli,
+    board: Option<String>,
+    port: Option<String>,
+) -> Result<Option<String>> {
+    let Some(board) = board else {
+        return Ok(port);
+    };
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    if let Some(port) = configured_port(project_dir, &board) {
+        info!("📌 {} is configured on {}", board, port);
+        return Ok(Some(port));
+    }
+    let port = resolve_port(project_dir, &board).await?.ok_or_else(|| {
+        anyhow::anyhow!(
+            "No device is registered for {}, register one with: espbrew boards assign {}",
+            board,
+            board
+        )
+    })?;
+    info!("📌 Registered device of {} found on {}", board, port);
+    Ok(Some(port))
+}
+
+/// `--elf`, or the firmware ELF of the last build of `--board`
+pub fn monitor_elf(cli: &Cli, board: Option<&str>, elf: Option<PathBuf>) -> Option<PathBuf> {
+    if elf.is_some() {
+        return elf;
+    }
+    let board = board?;
+    let current_dir = std::env::current_dir().ok()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+    let boards = ProjectRegistry::new()
+        .detect_project(project_dir)?
+        .discover_boards(project_dir)
+        .ok()?;
+    let board_config = boards.iter().find(|b| b.name == board)?;
+    let elf = board_elf(&project_dir.join(&board_config.build_dir));
+    if let Some(elf) = &elf {
+        info!("🔎 Decoding backtraces with {}", elf.display());
+    }
+    elf
+}
+
+/// Recording settings of the project when `--record` is given or
+/// `espbrew.yaml` turns recording on, with the board of the device
+pub fn monitor_recording(
+    cli: &Cli,
+    board: Option<&str>,
+    record: bool,
+) -> Option<(RecordSettings, Option<String>)> {
+    let current_dir = std::env::current_dir().ok()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+    let settings = RecordSettings::load(project_dir);
+    (record || settings.enabled).then(|| (settings, board.map(str::to_string)))
+}
+
 /// Execute the local monitor command
 pub async fn execute_monitor_command(
     port: Option<String>,
@@ -19,6 +92,8 @@ pub async fn execute_monitor_command(
     timeout: u64,
     success_pattern: Option<String>,
     failure_pattern: Option<String>,
+    record: Option<(RecordSettings, Option<String>)>,
+    export: Option<(PathBuf, Option<String>)>,
 ) -> Result<()> {
     info!("Starting local monitor with baud rate: {}", baud_rate);
 
@@ -40,6 +115,30 @@ pub async fn execute_monitor_command(
             elf_path.display()
         );
     }
+    let defmt = if log_format == "defmt" {
+        let elf_path = elf.as_deref().ok_or_else(|| {
+            anyhow::anyhow!("defmt logs are decoded with the firmware's ELF, pass --elf or --board")
+        })?;
+        if !has_defmt_table(elf_path) {
+            anyhow::bail!(
+                "{} has no .defmt section, is the firmware built with defmt?",
+                elf_path.display()
+            );
+        }
+        Some(DefmtStream::start(elf_path)?)
+    } else {
+        None
+    };
+    let decoder = match elf.as_deref().filter(|_| !no_addresses) {
+        Some(elf_path) => match BacktraceDecoder::new(elf_path) {
+            Ok(decoder) => Some(decoder),
+            Err(e) => {
+                warn!("Backtraces won't be decoded: {:#}", e);
+                None
+            }
+        },
+        None => None,
+    };
 
     // Validate and compile regex patterns
     let success_regex = match success_pattern {
@@ -79,31 +178,71 @@ pub async fn execute_monitor_command(
         .context("Failed to detect or validate serial port")?;
 
     info!("Using serial port: {}", serial_port.port_name);
+    let recorder = match record {
+        Some((settings, board)) => {
+            let recorder =
+                MonitorRecorder::start(&settings, board.as_deref(), &serial_port.port_name)?;
+            info!("📼 Recording to {}", recorder.path().display());
+            Some(recorder)
+        }
+        None => None,
+    };
+    let export = match export {
+        Some((path, board)) => {
+            let export = JsonlExport::create(&path, &serial_port.port_name, board.as_deref())?;
+            info!("🧾 Writing JSON lines to {}", path.display());
+            Some(export)
+        }
+        None => None,
+    };
 
-    // Print configuration
-    print_monitor_configuration(
-        &serial_port,
-        baud_rate,
-        elf.as_ref(),
-        log_format,
-        reset,
-        non_interactive,
-        no_addresses,
-        timeout,
-        &success_pattern,
-        &failure_pattern,
-    );
+    // Print configuration, unless stdout is for the JSON lines
+    if !export.as_ref().is_some_and(JsonlExport::to_stdout) {
+        print_monitor_configuration(
+            &serial_port,
+            baud_rate,
+            elf.as_ref(),
+            log_format,
+            reset,
+            non_interactive,
+            no_addresses,
+            timeout,
+            &success_pattern,
+            &failure_pattern,
+        );
+    }
 
-    // Implement real ESP32 monitoring using espflash library
-    let result = run_real_monitoring(
-        &serial_port,
-        baud_rate,
-        timeout_duration,
-        success_regex,
-        failure_regex,
-        reset,
-    )
-    .await;
+    // Implement real ESP32 monitoring using espflash library; ports behind
+    // ser2net are read over TCP
+    let result = if is_network_port(&serial_port.port_name) {
+        run_network_monitoring(
+            &serial_port.port_name,
+            baud_rate,
+            timeout_duration,
+            success_regex,
+            failure_regex,
+            decoder,
+            defmt,
+            recorder,
+            export,
+            reset,
+        )
+        .await
+    } else {
+        run_real_monitoring(
+            &serial_port,
+            baud_rate,
+            timeout_duration,
+            success_regex,
+            failure_regex,
+            decoder,
+            defmt,
+            recorder,
+            export,
+            reset,
+        )
+        .await
+    };
 
     // Handle the special success case
     if let Err(ref e) = result {
@@ -135,8 +274,17 @@ async fn detect_or_validate_port(port_option: Option<String>) -> Result<SerialPo
     }
 }
 
-/// Validate that a specific serial port exists
+/// Validate that a specific serial port exists; serial-over-TCP URLs are
+/// checked when connecting
 fn validate_port(port_name: &str) -> Result<SerialPortInfo> {
+    if is_network_port(port_name) {
+        NetworkPort::parse(port_name)?;
+        return Ok(SerialPortInfo {
+            port_name: port_name.to_string(),
+            port_type: serialport::SerialPortType::Unknown,
+        });
+    }
+
     let available_ports =
         serialport::available_ports().context("Failed to enumerate serial ports")?;
 
@@ -256,6 +404,10 @@ async fn run_real_monitoring(
     timeout_duration: Option<Duration>,
     success_regex: Option<Regex>,
     failure_regex: Option<Regex>,
+    mut decoder: Option<BacktraceDecoder>,
+    mut defmt: Option<DefmtStream>,
+    mut recorder: Option<MonitorRecorder>,
+    mut export: Option<JsonlExport>,
     reset: bool,
 ) -> Result<()> {
     use espflash::connection::{Connection, ResetAfterOperation, ResetBeforeOperation};
@@ -305,7 +457,8 @@ async fn run_real_monitoring(
     };
 
     // Open the serial port for reading
-    let mut serial_port = serialport::new(&port_info.port_name, baud_rate)
+    let mut port_name = port_info.port_name.clone();
+    let mut serial_port = serialport::new(&port_name, baud_rate)
         .timeout(Duration::from_millis(100))
         .open_native()
         .with_context(|| {
@@ -318,7 +471,6 @@ async fn run_real_monitoring(
     // If reset was requested, perform it before establishing monitoring connection
     if reset {
         info!("Resetting ESP32 device to capture boot sequence");
-        let port_name = port_info.port_name.clone();
         let usb_info_clone = usb_info.clone();
         let baud_clone = baud_rate;
 
@@ -344,6 +496,17 @@ async fn run_real_monitoring(
 
         // Give the device time to start booting
         tokio::time::sleep(Duration::from_secs(2)).await;
+
+        // The chip's own USB port goes away during the reset and may come
+        // back under another name, so the monitor reopens it
+        if UsbInterface::of_port(&port_info.port_type).is_native() {
+            port_name = wait_for_port(&port_name, &usb_info, REENUMERATION_TIMEOUT).await?;
+            serial_port = serialport::new(&port_name, baud_rate)
+                .timeout(Duration::from_millis(100))
+                .open_native()
+                .with_context(|| format!("Failed to reopen serial port: {}", port_name))?;
+            info!("Reconnected to {} after the reset", port_name);
+        }
     }
 
     // Set a reasonable timeout for reads
@@ -351,6 +514,8 @@ async fn run_real_monitoring(
 
     let mut buffer = [0u8; 1024];
     let mut line_buffer = String::new();
+    // Since when the port fails, until it reads again
+    let mut lost_since: Option<Instant> = None;
 
     loop {
         // Check for exit conditions
@@ -380,30 +545,67 @@ async fn run_real_monitoring(
                 continue;
             }
             Ok(bytes_read) => {
-                // Convert bytes to UTF-8 string, handling partial UTF-8 sequences
-                let chunk = String::from_utf8_lossy(&buffer[..bytes_read]);
-
-                // Process the chunk line by line
-                for ch in chunk.chars() {
-                    if ch == '\n' || ch == '\r' {
-                        if !line_buffer.is_empty() {
-                            // We have a complete line
-                            process_line(&line_buffer, &success_regex, &failure_regex)?;
-                            line_buffer.clear();
-                        }
-                    } else if ch.is_control() {
-                        // Skip other control characters
-                        continue;
-                    } else {
-                        line_buffer.push(ch);
-                    }
-                }
+                lost_since = None;
+                process_chunk(
+                    &buffer[..bytes_read],
+                    &mut line_buffer,
+                    &success_regex,
+                    &failure_regex,
+                    &mut decoder,
+                    &mut defmt,
+                    &mut recorder,
+                    &mut export,
+                )?;
             }
             Err(ref e) if (*e).kind() == std::io::ErrorKind::TimedOut => {
                 // Timeout is expected, continue loop
+                lost_since = None;
                 tokio::time::sleep(Duration::from_millis(10)).await;
                 continue;
             }
+            // A USB device whose port went away, e.g. resetting with its
+            // native USB port, is waited for and the monitor goes on with it
+            Err(e) if usb_info.vid != 0 => {
+                warn!(
+                    "{} went away ({}), waiting for the device to come back",
+                    port_name, e
+                );
+                let lost = *lost_since.get_or_insert_with(Instant::now);
+                let remaining = RECONNECT_TIMEOUT.saturating_sub(lost.elapsed());
+                let found = if remaining.is_zero() {
+                    None
+                } else {
+                    wait_for_reconnect(&port_name, &usb_info, remaining, || {
+                        should_exit.load(Ordering::Relaxed)
+                    })
+                    .await
+                };
+                let reopened = match found {
+                    Some(name) => serialport::new(&name, baud_rate)
+                        .timeout(Duration::from_millis(100))
+                        .open_native()
+                        .map(|port| (name, port)),
+                    None if should_exit.load(Ordering::Relaxed) => continue,
+                    None => {
+                        ctrl_c_handle.abort();
+                        anyhow::bail!(
+                            "{} didn't come back within {}s",
+                            port_name,
+                            RECONNECT_TIMEOUT.as_secs()
+                        );
+                    }
+                };
+                match reopened {
+                    Ok((name, port)) => {
+                        info!("🔌 Reconnected to {}", name);
+                        port_name = name;
+                        serial_port = port;
+                    }
+                    // Retried on the next read, e.g. before udev set the
+                    // port's permissions
+                    Err(e) => warn!("Failed to reopen {}: {}", port_name, e),
+                }
+            }
             Err(e) => {
                 error!("Serial port read error: {}", e);
                 ctrl_c_handle.abort();
@@ -416,11 +618,200 @@ async fn run_real_monitoring(
     }
 }
 
-/// Process a single line of serial output for pattern matching
+/// Monitor a serial port behind a ser2net-style TCP server
+async fn run_network_monitoring(
+    port_name: &str,
+    baud_rate: u32,
+    timeout_duration: Option<Duration>,
+    success_regex: Option<Regex>,
+    failure_regex: Option<Regex>,
+    mut decoder: Option<BacktraceDecoder>,
+    mut defmt: Option<DefmtStream>,
+    mut recorder: Option<MonitorRecorder>,
+    mut export: Option<JsonlExport>,
+    reset: bool,
+) -> Result<()> {
+    let port = NetworkPort::parse(port_name)?;
+    info!("Connecting to serial-over-TCP port: {}", port_name);
+    let mut serial = NetworkSerial::connect(&port, baud_rate).await?;
+
+    if reset {
+        info!("Resetting ESP32 device to capture boot sequence");
+        serial.reset().await?;
+    }
+
+    let deadline = timeout_duration.map(|timeout| tokio::time::Instant::now() + timeout);
+    let mut line_buffer = String::new();
+    loop {
+        let data = tokio::select! {
+            data = serial.read() => data?,
+            _ = tokio::signal::ctrl_c() => {
+                info!("Monitoring stopped by user");
+                return Ok(());
+            }
+            _ = async {
+                match deadline {
+                    Some(deadline) => tokio::time::sleep_until(deadline).await,
+                    None => std::future::pending().await,
+                }
+            } => {
+                info!(
+                    "Monitor timeout reached after {} seconds",
+                    timeout_duration.unwrap_or_default().as_secs()
+                );
+                anyhow::bail!("Monitor timeout reached");
+            }
+        };
+        if data.is_empty() {
+            anyhow::bail!("{} closed the connection", port.address);
+        }
+        process_chunk(
+            &data,
+            &mut line_buffer,
+            &success_regex,
+            &failure_regex,
+            &mut decoder,
+            &mut defmt,
+            &mut recorder,
+            &mut export,
+        )?;
+    }
+}
+
+/// Time defmt-print gets to print the line of a frame, so it shows in order
+const DEFMT_LINE_TIMEOUT: Duration = Duration::from_millis(100);
+
+/// defmt frames of the output and the defmt-print decoding them
+struct DefmtStream {
+    splitter: DefmtSplitter,
+    decoder: DefmtDecoder,
+    lines: std::sync::mpsc::Receiver<String>,
+}
+
+impl DefmtStream {
+    fn start(elf: &std::path::Path) -> Result<Self> {
+        let (tx, lines) = std::sync::mpsc::channel();
+        let decoder = DefmtDecoder::spawn(elf, move |line| {
+            let _ = tx.send(line);
+        })?;
+        info!("Decoding defmt frames with {}", elf.display());
+        Ok(Self {
+            splitter: DefmtSplitter::default(),
+            decoder,
+            lines,
+        })
+    }
+}
+
+/// Split received bytes into lines, processing every completed one; defmt
+/// frames are processed as the lines they decode to
+fn process_chunk(
+    bytes: &[u8],
+    line_buffer: &mut String,
+    success_regex: &Option<Regex>,
+    failure_regex: &Option<Regex>,
+    decoder: &mut Option<BacktraceDecoder>,
+    defmt: &mut Option<DefmtStream>,
+    recorder: &mut Option<MonitorRecorder>,
+    export: &mut Option<JsonlExport>,
+) -> Result<()> {
+    let Some(stream) = defmt else {
+        return process_text(
+            bytes,
+            line_buffer,
+            success_regex,
+            failure_regex,
+            decoder,
+            recorder,
+            export,
+        );
+    };
+    for chunk in stream.splitter.push(bytes) {
+        match chunk {
+            DefmtChunk::Text(text) => process_text(
+                &text,
+                line_buffer,
+                success_regex,
+                failure_regex,
+                decoder,
+                recorder,
+                export,
+            )?,
+            DefmtChunk::Frame(frame) => {
+                stream.decoder.decode(&frame)?;
+                if let Ok(line) = stream.lines.recv_timeout(DEFMT_LINE_TIMEOUT) {
+                    process_line(
+                        &line,
+                        success_regex,
+                        failure_regex,
+                        decoder,
+                        recorder,
+                        export,
+                    )?;
+                }
+            }
+        }
+    }
+    // Lines defmt-print took longer for
+    for line in stream.lines.try_iter() {
+        process_line(
+            &line,
+            success_regex,
+            failure_regex,
+            decoder,
+            recorder,
+            export,
+        )?;
+    }
+    Ok(())
+}
+
+fn process_text(
+    bytes: &[u8],
+    line_buffer: &mut String,
+    success_regex: &Option<Regex>,
+    failure_regex: &Option<Regex>,
+    decoder: &mut Option<BacktraceDecoder>,
+    recorder: &mut Option<MonitorRecorder>,
+    export: &mut Option<JsonlExport>,
+) -> Result<()> {
+    // Convert bytes to UTF-8 string, handling partial UTF-8 sequences
+    let chunk = String::from_utf8_lossy(bytes);
+
+    // Process the chunk line by line
+    for ch in chunk.chars() {
+        if ch == '\n' || ch == '\r' {
+            if !line_buffer.is_empty() {
+                // We have a complete line
+                process_line(
+                    line_buffer,
+                    success_regex,
+                    failure_regex,
+                    decoder,
+                    recorder,
+                    export,
+                )?;
+                line_buffer.clear();
+            }
+        } else if ch.is_control() {
+            // Skip other control characters
+            continue;
+        } else {
+            line_buffer.push(ch);
+        }
+    }
+    Ok(())
+}
+
+/// Process a single line of serial output for pattern matching, followed by
+/// the frames of any code addresses in it
 fn process_line(
     line: &str,
     success_regex: &Option<Regex>,
     failure_regex: &Option<Regex>,
+    decoder: &mut Option<BacktraceDecoder>,
+    recorder: &mut Option<MonitorRecorder>,
+    export: &mut Option<JsonlExport>,
 ) -> Result<()> {
     let trimmed_line = line.trim();
 
@@ -435,15 +826,54 @@ fn process_line(
     // Clean ANSI escape sequences for pattern matching and logging
     let clean_line = strip_ansi_codes(trimmed_line);
 
-    // Try to fix ANSI codes that might be missing ESC character
-    let display_line = fix_ansi_codes(trimmed_line);
+    // Try to fix ANSI codes that might be missing ESC character; plain
+    // output has none
+    let display_line = if is_plain_output() {
+        clean_line.clone()
+    } else {
+        fix_ansi_codes(trimmed_line)
+    };
+
+    use std::io::{self, IsTerminal, Write};
+
+    // JSON lines written to stdout replace the text
+    let print_text = !export.as_ref().is_some_and(JsonlExport::to_stdout);
 
     // Print the line with ANSI codes preserved for terminal colors
     // Use print! instead of println! to avoid extra newline that might interfere with sequences
-    print!("{}\n", display_line);
+    if print_text {
+        print!("{}\n", display_line);
+    }
+    let mut recorded = vec![clean_line.clone()];
+    if let Some(decoder) = decoder {
+        let terminal = io::stdout().is_terminal() && !is_plain_output();
+        for frame in decoder.decode_line(&clean_line) {
+            recorded.push(frame_line(&frame));
+            // Terminals open the hyperlinked source location on a click
+            let frame = if terminal {
+                frame_hyperlink(&frame)
+            } else {
+                frame
+            };
+            if print_text {
+                println!("{}", frame_line(&frame));
+            }
+        }
+    }
+    if let Some(file) = recorder {
+        if let Err(e) = recorded.iter().try_for_each(|line| file.record(line)) {
+            warn!("Recording stopped: {:#}", e);
+            *recorder = None;
+        }
+    }
+    if let Some(out) = export {
+        if let Err(e) = recorded.iter().try_for_each(|line| out.write(line)) {
+            warn!("JSON lines export stopped: {:#}", e);
+            *export = None;
+        }
+    }
 
     // Ensure output is flushed immediately
-    use std::io::{self, Write};
     let _ = io::stdout().flush();
 
     // Check for success pattern on clean text (not ANSI codes)
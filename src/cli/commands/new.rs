@@ -0,0 +1,56 @@
+//! New project command implementation
+
+use crate::cli::args::Cli;
+use crate::projects::ProjectRegistry;
+use crate::projects::templates::{ProjectTemplate, generate_project};
+use anyhow::Result;
+
+pub async fn execute_new_command(
+    cli: &Cli,
+    template: ProjectTemplate,
+    chips: &[String],
+) -> Result<()> {
+    let dest = cli.project_dir.clone().ok_or_else(|| {
+        anyhow::anyhow!(
+            "Please specify the directory to create, e.g. espbrew new {} my-project",
+            template.name()
+        )
+    })?;
+
+    log::info!(
+        "🍺 Creating {} project in {}",
+        template.name(),
+        dest.display()
+    );
+
+    let files = generate_project(template, &dest, chips)?;
+    for file in &files {
+        log::info!(
+            "  📄 {}",
+            file.strip_prefix(&dest).unwrap_or(file).display()
+        );
+    }
+
+    // Show the boards espbrew will pick up from the generated configs
+    if let Some(handler) = ProjectRegistry::new().detect_project(&dest) {
+        let boards = handler.discover_boards(&dest)?;
+        log::info!(
+            "🎯 {} project with {} board(s):",
+            handler.project_type().name(),
+            boards.len()
+        );
+        for board in &boards {
+            log::info!(
+                "  - {} ({})",
+                board.name,
+                board.target.as_deref().unwrap_or("auto-detect")
+            );
+        }
+    }
+
+    log::info!("✅ Project created. Next steps:");
+    log::info!("   cd {}", dest.display());
+    log::info!("   espbrew --cli build");
+
+    Ok(())
+}
@@ -0,0 +1,119 @@
+//! OTA command implementation
+
+use crate::cli::args::{Cli, OtaAction};
+use crate::config::ProjectConfig;
+use crate::models::{AppEvent, OtaStatus};
+use crate::projects::ProjectRegistry;
+use crate::projects::incremental::build_board_checked;
+use crate::projects::ota::{deploy, find_app_binary, plan_rollout};
+use crate::projects::signing::ensure_signed;
+use anyhow::Result;
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+use tokio::sync::mpsc;
+
+pub async fn execute_ota_command(cli: &Cli, action: OtaAction) -> Result<()> {
+    let project_dir = cli.project_dir.as_deref().unwrap_or_else(|| Path::new("."));
+
+    match action {
+        OtaAction::Deploy { boards, devices } => {
+            deploy_devices(project_dir, &boards, &devices).await
+        }
+    }
+}
+
+async fn deploy_devices(project_dir: &Path, boards: &[String], devices: &[String]) -> Result<()> {
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    let project_boards = handler.discover_boards(project_dir)?;
+    let section = ProjectConfig::load(project_dir)?
+        .map(|config| config.ota)
+        .unwrap_or_default();
+    if section.devices.is_empty() {
+        return Err(anyhow::anyhow!(
+            "No OTA devices configured, add them to the ota: section of espbrew.yaml"
+        ));
+    }
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+
+    // Boards that were never built are built once, however many devices run them
+    let mut checked = HashSet::new();
+    for device in &section.devices {
+        let wanted = (boards.is_empty() || boards.contains(&device.board))
+            && (devices.is_empty() || devices.contains(&device.name));
+        if !wanted || !checked.insert(device.board.clone()) {
+            continue;
+        }
+        if let Some(board) = project_boards.iter().find(|b| b.name == device.board)
+            && find_app_binary(&board.build_dir).is_none()
+        {
+            log::info!("🔨 Building {} before the rollout", board.name);
+            build_board_checked(handler, project_dir, board, tx.clone()).await?;
+        }
+    }
+
+    let targets = plan_rollout(&section, &project_boards, boards, devices)?;
+    if targets.is_empty() {
+        return Err(anyhow::anyhow!(
+            "No OTA device matches the given boards and devices"
+        ));
+    }
+    for board in project_boards
+        .iter()
+        .filter(|b| targets.iter().any(|t| t.device.board == b.name))
+    {
+        ensure_signed(project_dir, board)?;
+    }
+    for target in &targets {
+        log::info!(
+            "📡 {}: {} → {}",
+            target.device.name,
+            target.device.board,
+            target.image.display()
+        );
+    }
+
+    let progress_handle = tokio::spawn(async move {
+        let mut shown: HashMap<String, u8> = HashMap::new();
+        while let Some(event) = rx.recv().await {
+            match event {
+                AppEvent::BuildOutput(name, message) => {
+                    println!("[{}] {}", name, message);
+                }
+                // Downloads every 10% only, so the devices' output stays readable side by side
+                AppEvent::OtaStatusChanged(name, status) => {
+                    if let OtaStatus::Downloading(percent) = status {
+                        let step = percent / 10 * 10;
+                        if shown.get(&name).is_some_and(|last| step <= *last) {
+                            continue;
+                        }
+                        shown.insert(name.clone(), step);
+                    }
+                    println!("[{}] {}", name, status.describe());
+                }
+                _ => {}
+            }
+        }
+    });
+
+    let total = targets.len();
+    let failed = deploy(project_dir, &section, targets, tx).await?;
+    progress_handle.await?;
+
+    if !failed.is_empty() {
+        return Err(anyhow::anyhow!(
+            "{} of {} device(s) failed: {}",
+            failed.len(),
+            total,
+            failed.join(", ")
+        ));
+    }
+    log::info!("🎉 Updated {} device(s) over the air", total);
+    Ok(())
+}
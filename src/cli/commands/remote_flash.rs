@@ -612,9 +612,16 @@ pub async fn execute_remote_flash_command_url(
         cli: true,
         verbose: 0,
         quiet: false,
+        plain: crate::utils::logging::is_plain_output(),
+        output: crate::projects::json_output::OutputFormat::Text,
         build_strategy: crate::models::project::BuildStrategy::IdfBuildApps,
+        jobs: None,
+        max_load: None,
+        agents: Vec::new(),
         server_url: Some(server_url.to_string()),
         board_mac: board_mac.map(|s| s.to_string()),
+        record: None,
+        theme: None,
         handle_url: None,
         register_handler: false,
         unregister_handler: false,
@@ -0,0 +1,61 @@
+//! Replay command implementation
+
+use crate::cli::args::Cli;
+use crate::cli::tui::event_loop::run_tui_event_loop;
+use crate::cli::tui::keymap::Keymap;
+use crate::cli::tui::main_app::App;
+use crate::cli::tui::theme::Theme;
+use crate::projects::build_history::format_duration;
+use crate::projects::session_recording::SessionReplay;
+use crate::utils::logging::plain_text;
+use anyhow::Result;
+use std::path::Path;
+
+pub async fn execute_replay_command(cli: &Cli, file: &Path, speed: f64) -> Result<()> {
+    if speed <= 0.0 {
+        return Err(anyhow::anyhow!("--speed must be above 0, not {}", speed));
+    }
+    let mut replay = SessionReplay::load(file)?;
+    replay.speed = speed;
+
+    // Without the TUI the recording is printed as it was recorded
+    if cli.cli || cli.plain_output() {
+        println!(
+            "{} recorded {} by espbrew {}, {} board(s), {}",
+            replay.header.project,
+            replay.header.started.format("%Y-%m-%d %H:%M"),
+            replay.header.espbrew,
+            replay.header.boards.len(),
+            format_duration(replay.duration())
+        );
+        for entry in &replay.entries {
+            for line in entry.text() {
+                if cli.plain_output() {
+                    println!("{}", plain_text(&line));
+                } else {
+                    println!("{}", line);
+                }
+            }
+        }
+        return Ok(());
+    }
+
+    // The TUI runs in a scratch directory, so nothing of the project it is
+    // started in shows up or runs
+    let scratch_dir = std::env::temp_dir().join(format!("espbrew-replay-{}", std::process::id()));
+    std::fs::create_dir_all(&scratch_dir)?;
+    let mut app = App::new(
+        scratch_dir.clone(),
+        cli.build_strategy.clone(),
+        None,
+        None,
+        None,
+    )?;
+    app.theme = Theme::resolve(cli.theme.as_deref())?;
+    app.keymap = Keymap::resolve()?;
+    app.start_replay(replay);
+
+    let result = run_tui_event_loop(app).await;
+    let _ = std::fs::remove_dir_all(&scratch_dir);
+    result
+}
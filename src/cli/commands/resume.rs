@@ -0,0 +1,44 @@
+//! Resume command implementation
+
+use crate::cli::args::Cli;
+use crate::cli::commands::build::{BoardSelection, execute_build_selection};
+use crate::projects::build_session::{BUILD_SESSION_FILE, BuildSession, SessionBoardState};
+use anyhow::Result;
+
+pub async fn execute_resume_command(cli: &Cli, discard: bool) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    let Some(session) = BuildSession::load(project_dir)? else {
+        return Err(anyhow::anyhow!(
+            "No interrupted build to resume in {} ({} not found)",
+            project_dir.display(),
+            BUILD_SESSION_FILE
+        ));
+    };
+
+    if discard {
+        BuildSession::remove(project_dir)?;
+        log::info!(
+            "🗑️  Discarded the build session started {}",
+            session.started.format("%Y-%m-%d %H:%M:%S")
+        );
+        return Ok(());
+    }
+
+    log::info!(
+        "▶️  Build session started {}: {} succeeded, {} failed, {} pending",
+        session.started.format("%Y-%m-%d %H:%M:%S"),
+        session.count(SessionBoardState::Succeeded),
+        session.count(SessionBoardState::Failed),
+        session.count(SessionBoardState::Pending)
+    );
+    if session.unfinished().is_empty() {
+        BuildSession::remove(project_dir)?;
+        log::info!("🎉 Every board of the session was built already");
+        return Ok(());
+    }
+
+    let (locked, force) = (session.locked, session.force);
+    execute_build_selection(cli, BoardSelection::Resume(session), locked, force, None).await
+}
@@ -0,0 +1,41 @@
+//! Serve command implementation
+
+use crate::cli::args::Cli;
+use crate::projects::web_dashboard::{
+    SharedWebDashboard, WebDashboardLink, new_web_token, parse_listen_address,
+};
+use crate::server::routes::health::create_health_route;
+use crate::server::routes::serve::create_serve_routes;
+use anyhow::Result;
+use tokio::sync::mpsc;
+use warp::Filter;
+
+/// Serve the browser dashboard on the address, for the TUI to publish to
+pub fn start_web_dashboard(listen: &str) -> Result<WebDashboardLink> {
+    let address = parse_listen_address(listen)?;
+    let dashboard = SharedWebDashboard::default();
+    let (commands_tx, commands) = mpsc::unbounded_channel();
+    let token = new_web_token();
+    let routes = create_health_route().or(create_serve_routes(
+        dashboard.clone(),
+        commands_tx,
+        token.clone(),
+    ));
+    let (address, server) = warp::serve(routes).try_bind_ephemeral(address)?;
+    tokio::spawn(server);
+    // The token in the URL lets the page's buttons act
+    let url = format!("http://{}/?token={}", address, token);
+    log::info!("🌐 Web dashboard: {}", url);
+    Ok(WebDashboardLink {
+        url,
+        dashboard,
+        commands,
+    })
+}
+
+/// The dashboard mirrors the TUI, so there is nothing to serve without it
+pub async fn execute_serve_command(_cli: &Cli, _web: &str) -> Result<()> {
+    Err(anyhow::anyhow!(
+        "espbrew serve mirrors the TUI in the browser, run it without --cli or --plain"
+    ))
+}
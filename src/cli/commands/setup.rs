@@ -0,0 +1,56 @@
+//! Setup command implementation
+
+use crate::cli::args::Cli;
+use crate::projects::ProjectRegistry;
+use crate::projects::toolchain_setup::{run_setup, setup_plan, shell_exports, write_env_script};
+use crate::utils::esp_idf_utils::managed_toolchains_dir;
+use anyhow::Result;
+
+pub async fn execute_setup_command(cli: &Cli, dry_run: bool, print_env: bool) -> Result<()> {
+    let toolchains_dir = managed_toolchains_dir();
+    if print_env {
+        print!("{}", shell_exports(&toolchains_dir));
+        return Ok(());
+    }
+
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project_boxed(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    // Boards only narrow down the chips to install tools for
+    let boards = handler.discover_boards(project_dir).unwrap_or_else(|e| {
+        println!(
+            "⚠️  Board discovery failed, installing tools for all chips: {}",
+            e
+        );
+        Vec::new()
+    });
+
+    let plan = setup_plan(project_dir, &handler.project_type(), &boards);
+    println!(
+        "🧰 Setting up toolchains for the {} project in {}",
+        handler.project_type().name(),
+        project_dir.display()
+    );
+    println!("📁 Toolchains directory: {}", toolchains_dir.display());
+    if !plan.targets.is_empty() {
+        println!("🎯 Chips: {}", plan.targets.join(", "));
+    }
+
+    run_setup(project_dir, &toolchains_dir, &plan, dry_run).await?;
+
+    if dry_run {
+        println!("🔍 Dry run, nothing was installed");
+        return Ok(());
+    }
+    let script = write_env_script(&toolchains_dir)?;
+    println!("✅ Toolchains ready; espbrew builds pick up the ESP-IDF installation by itself");
+    println!("👉 For other tools in this shell: . {}", script.display());
+    Ok(())
+}
@@ -0,0 +1,97 @@
+//! Stats command implementation
+
+use crate::cli::args::Cli;
+use crate::projects::build_history::{
+    BUILD_HISTORY_FILE, board_stats, format_duration, load_history, sparkline,
+};
+use crate::utils::firmware_size::format_bytes;
+use anyhow::Result;
+
+pub async fn execute_stats_command(cli: &Cli, board: Option<&str>, limit: usize) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    let entries = load_history(project_dir);
+    if entries.is_empty() {
+        println!(
+            "📊 No builds recorded yet in {}",
+            project_dir.join(BUILD_HISTORY_FILE).display()
+        );
+        return Ok(());
+    }
+
+    if let Some(board_name) = board {
+        let builds: Vec<_> = entries.iter().filter(|e| e.board == board_name).collect();
+        if builds.is_empty() {
+            return Err(anyhow::anyhow!("No builds of '{}' recorded", board_name));
+        }
+
+        println!(
+            "📊 Last {} of {} build(s) of {}:",
+            builds.len().min(limit),
+            builds.len(),
+            board_name
+        );
+        for entry in builds.iter().rev().take(limit) {
+            println!(
+                "  {} {} {:>8}  {:>11}  {}",
+                entry.finished.format("%Y-%m-%d %H:%M"),
+                if entry.success { "✅" } else { "❌" },
+                format_duration(entry.duration()),
+                entry.flash_size.map(format_bytes).unwrap_or_default(),
+                entry.commit.as_deref().unwrap_or("-")
+            );
+        }
+        return Ok(());
+    }
+
+    let stats = board_stats(&entries);
+    let width = stats
+        .iter()
+        .map(|s| s.board.chars().count())
+        .max()
+        .unwrap_or(0)
+        .max("board".len());
+
+    println!(
+        "📊 {} build(s) of {} board(s) since {}",
+        entries.len(),
+        stats.len(),
+        entries[0].finished.format("%Y-%m-%d")
+    );
+    println!(
+        "  {:<width$}  {:>6}  {:>5}  {:>8}  {:>8}  {:>8}  {:>11}  recent",
+        "board", "builds", "ok", "average", "last", "trend", "size Δ"
+    );
+    for board in &stats {
+        println!(
+            "  {:<width$}  {:>6}  {:>4.0}%  {:>8}  {:>8}  {:>8}  {:>11}  {}",
+            board.board,
+            board.builds,
+            board.success_rate(),
+            board
+                .average
+                .map(format_duration)
+                .unwrap_or_else(|| "-".to_string()),
+            format!(
+                "{}{}",
+                if board.last.success { "" } else { "❌" },
+                format_duration(board.last.duration())
+            ),
+            board
+                .trend
+                .map(|ms| format!("{:+}s", ms / 1000))
+                .unwrap_or_else(|| "-".to_string()),
+            board
+                .size_delta
+                .map(|delta| match delta {
+                    0 => "±0".to_string(),
+                    d if d > 0 => format!("+{}", format_bytes(d as u64)),
+                    d => format!("-{}", format_bytes(d.unsigned_abs())),
+                })
+                .unwrap_or_else(|| "-".to_string()),
+            sparkline(&board.recent_durations)
+        );
+    }
+    Ok(())
+}
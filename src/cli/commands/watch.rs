@@ -0,0 +1,233 @@
+//! Watch command implementation
+
+use crate::cli::args::Cli;
+use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
+use crate::projects::ProjectRegistry;
+use crate::projects::board_tags::{TagFilter, filter_boards_by_tags};
+use crate::projects::command_templates;
+use crate::projects::incremental::build_board_incremental;
+use crate::projects::registry::ProjectHandler;
+use crate::projects::retry::flash_board_with_retries;
+use crate::projects::watch::{SourceWatcher, affects_board, describe_changes};
+use anyhow::Result;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+use tokio::sync::mpsc;
+
+/// Options of `espbrew watch`
+#[derive(Debug, Clone)]
+pub struct WatchOptions {
+    pub boards: Vec<String>,
+    pub tags: Option<String>,
+    pub debounce: u64,
+    pub flash: bool,
+    pub monitor: bool,
+    pub port: Option<String>,
+    pub baud_rate: u32,
+}
+
+pub async fn execute_watch_command(cli: &Cli, options: WatchOptions) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let project_dir = cli.project_dir.as_ref().unwrap_or(&current_dir);
+
+    log::info!("👀 ESPBrew Watch Command");
+    log::info!("📁 Project directory: {}", project_dir.display());
+
+    let registry = ProjectRegistry::new();
+    let handler = registry.detect_project_boxed(project_dir).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Unable to detect project type in: {}",
+            project_dir.display()
+        )
+    })?;
+    if let Err(error_msg) = handler.check_tools_available() {
+        log::info!("\n{}", handler.get_missing_tools_message());
+        return Err(anyhow::anyhow!(
+            "Required tools not available: {}",
+            error_msg
+        ));
+    }
+
+    let all_board_configs = handler.discover_boards(project_dir)?;
+    let config_files: Vec<PathBuf> = all_board_configs
+        .iter()
+        .map(|c| c.config_file.clone())
+        .collect();
+    let board_configs = select_boards(project_dir, all_board_configs, &options)?;
+
+    let flash = options.flash || options.monitor;
+    if flash && board_configs.len() != 1 {
+        return Err(anyhow::anyhow!(
+            "--flash and --monitor need a single board, {} are selected; pick one with --board",
+            board_configs.len()
+        ));
+    }
+
+    log::info!(
+        "👀 Watching {} board(s): {}",
+        board_configs.len(),
+        board_configs
+            .iter()
+            .map(|c| c.name.as_str())
+            .collect::<Vec<_>>()
+            .join(", ")
+    );
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let log_handler = tokio::spawn(async move {
+        while let Some(event) = rx.recv().await {
+            if let AppEvent::BuildOutput(board_name, message) = event {
+                log::info!("[{}] {}", board_name, message);
+            }
+        }
+    });
+
+    // Watch before the first build, so edits made while it runs are picked up
+    let mut watcher = SourceWatcher::new(project_dir, Duration::from_millis(options.debounce))?;
+    let mut affected: Vec<&ProjectBoardConfig> = board_configs.iter().collect();
+
+    loop {
+        let mut flashed = None;
+        for board_config in &affected {
+            let artifacts = match build_board_incremental(
+                handler.as_ref(),
+                project_dir,
+                board_config,
+                &config_files,
+                false,
+                tx.clone(),
+            )
+            .await
+            {
+                Ok(outcome) => {
+                    log::info!(
+                        "{} {}: {} artifacts",
+                        if outcome.up_to_date {
+                            "⏭️  Up to date"
+                        } else {
+                            "✅ Built"
+                        },
+                        board_config.name,
+                        outcome.artifacts.len()
+                    );
+                    outcome.artifacts
+                }
+                Err(e) => {
+                    log::error!("❌ Build failed for {}: {}", board_config.name, e);
+                    continue;
+                }
+            };
+
+            if flash {
+                match flash_board(
+                    handler.as_ref(),
+                    project_dir,
+                    board_config,
+                    &artifacts,
+                    &options,
+                    &tx,
+                )
+                .await
+                {
+                    Ok(()) => flashed = Some(*board_config),
+                    Err(e) => log::error!("❌ Flash failed for {}: {}", board_config.name, e),
+                }
+            }
+        }
+
+        log::info!("👀 Waiting for changes (Ctrl+C to stop)...");
+        let changed = match flashed.filter(|_| options.monitor) {
+            // A change ends the monitor so the next build can flash again
+            Some(board_config) => tokio::select! {
+                changed = watcher.next_change() => changed,
+                result = command_templates::monitor_board(
+                    handler.as_ref(),
+                    project_dir,
+                    board_config,
+                    options.port.as_deref(),
+                    options.baud_rate,
+                    tx.clone(),
+                ) => {
+                    if let Err(e) = result {
+                        log::error!("❌ Monitor failed for {}: {}", board_config.name, e);
+                    }
+                    watcher.next_change().await
+                }
+            },
+            None => watcher.next_change().await,
+        };
+        let Some(changed) = changed else {
+            break;
+        };
+
+        affected = board_configs
+            .iter()
+            .filter(|c| affects_board(project_dir, &c.config_file, &config_files, &changed))
+            .collect();
+        log::info!(
+            "🔄 Changed: {} - rebuilding {} board(s)",
+            describe_changes(project_dir, &changed),
+            affected.len()
+        );
+    }
+
+    drop(tx);
+    log_handler.await?;
+    log::info!("👋 Watch stopped");
+    Ok(())
+}
+
+/// Boards selected by `--board` or `--tags`, all boards otherwise
+fn select_boards(
+    project_dir: &Path,
+    all_board_configs: Vec<ProjectBoardConfig>,
+    options: &WatchOptions,
+) -> Result<Vec<ProjectBoardConfig>> {
+    if !options.boards.is_empty() {
+        let available: Vec<String> = all_board_configs.iter().map(|c| c.name.clone()).collect();
+        if let Some(missing) = options.boards.iter().find(|b| !available.contains(b)) {
+            return Err(anyhow::anyhow!(
+                "Board configuration '{}' not found. Available boards: {}",
+                missing,
+                available.join(", ")
+            ));
+        }
+        return Ok(all_board_configs
+            .into_iter()
+            .filter(|c| options.boards.contains(&c.name))
+            .collect());
+    }
+
+    let board_configs = match &options.tags {
+        Some(spec) => {
+            let filter = TagFilter::parse(spec)?;
+            filter_boards_by_tags(project_dir, all_board_configs, &filter)
+        }
+        None => all_board_configs,
+    };
+    if board_configs.is_empty() {
+        return Err(anyhow::anyhow!("No board configurations to watch"));
+    }
+    Ok(board_configs)
+}
+
+async fn flash_board(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    artifacts: &[BuildArtifact],
+    options: &WatchOptions,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    flash_board_with_retries(
+        handler,
+        project_dir,
+        board_config,
+        artifacts,
+        options.port.as_deref(),
+        tx.clone(),
+    )
+    .await?;
+    log::info!("⚡ Flashed {}", board_config.name);
+    Ok(())
+}
@@ -0,0 +1,221 @@
+//! Workspace command implementation
+
+use crate::cli::args::{Cli, WorkspaceAction};
+use crate::config::ProjectConfig;
+use crate::models::AppEvent;
+use crate::projects::ProjectRegistry;
+use crate::projects::board_tags::{TagFilter, tags_from_config};
+use crate::projects::incremental::build_board_checked;
+use crate::projects::retry::{RetryTally, prepare_build_with_retries};
+use crate::projects::workspace::{WorkspaceProject, discover_workspace, select_projects};
+use anyhow::Result;
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+pub async fn execute_workspace_command(cli: &Cli, action: WorkspaceAction) -> Result<()> {
+    let current_dir = std::env::current_dir()?;
+    let root = cli.project_dir.clone().unwrap_or(current_dir);
+
+    if !root.exists() {
+        return Err(anyhow::anyhow!(
+            "Workspace directory does not exist: {:?}",
+            root
+        ));
+    }
+
+    match action {
+        WorkspaceAction::List { depth } => list_workspace(root, depth),
+        WorkspaceAction::Build {
+            projects,
+            board,
+            tags,
+            depth,
+            keep_going,
+        } => {
+            let tag_filter = tags.as_deref().map(TagFilter::parse).transpose()?;
+            build_workspace(
+                root,
+                &projects,
+                board.as_deref(),
+                tag_filter.as_ref(),
+                depth,
+                keep_going,
+            )
+            .await
+        }
+    }
+}
+
+fn discover(root: &Path, depth: usize) -> Result<Vec<WorkspaceProject>> {
+    log::info!("🔍 Scanning workspace: {}", root.display());
+    let projects = discover_workspace(root, depth)?;
+
+    if projects.is_empty() {
+        return Err(anyhow::anyhow!(
+            "No buildable projects found below {} (searched {} level(s) deep)",
+            root.display(),
+            depth
+        ));
+    }
+
+    Ok(projects)
+}
+
+fn list_workspace(root: PathBuf, depth: usize) -> Result<()> {
+    let projects = discover(&root, depth)?;
+
+    log::info!("📦 Found {} project(s):", projects.len());
+    for project in &projects {
+        log::info!(
+            "  {} [{}] - {} board(s)",
+            project.name(),
+            project.project_type.name(),
+            project.boards.len()
+        );
+        for board in &project.boards {
+            log::info!(
+                "    - {} ({})",
+                board.name,
+                board.target.as_deref().unwrap_or("auto-detect")
+            );
+        }
+    }
+
+    Ok(())
+}
+
+async fn build_workspace(
+    root: PathBuf,
+    filters: &[String],
+    board_filter: Option<&str>,
+    tag_filter: Option<&TagFilter>,
+    depth: usize,
+    keep_going: bool,
+) -> Result<()> {
+    let projects = select_projects(discover(&root, depth)?, filters)?;
+
+    log::info!("🔨 ESPBrew Workspace Build");
+    log::info!("🎯 Building {} project(s):", projects.len());
+    for project in &projects {
+        log::info!("  - {} [{}]", project.name(), project.project_type.name());
+    }
+
+    let (tx, mut rx) = mpsc::unbounded_channel::<AppEvent>();
+    let log_handler = tokio::spawn(async move {
+        let mut retries = RetryTally::default();
+        while let Some(event) = rx.recv().await {
+            match event {
+                AppEvent::BuildOutput(board_name, message) => {
+                    log::info!("[{}] {}", board_name, message);
+                }
+                AppEvent::StepRetried(board_name, step) => retries.record(&board_name, &step),
+                _ => {}
+            }
+        }
+        retries
+    });
+
+    let mut succeeded = Vec::new();
+    let mut failed = Vec::new();
+
+    'projects: for project in &projects {
+        let handler = ProjectRegistry::create_handler(project.project_type.clone());
+
+        if let Err(error_msg) = handler.check_tools_available() {
+            log::error!(
+                "❌ {}: required tools not available: {}",
+                project.name(),
+                error_msg
+            );
+            failed.push(project.name());
+            if !keep_going {
+                break;
+            }
+            continue;
+        }
+
+        let config = ProjectConfig::load(&project.path).ok().flatten();
+        let boards: Vec<_> = project
+            .boards
+            .iter()
+            .filter(|b| board_filter.is_none_or(|name| b.name == name))
+            .filter(|b| {
+                tag_filter.is_none_or(|filter| {
+                    filter.matches(&tags_from_config(
+                        config.as_ref(),
+                        &b.name,
+                        b.target.as_deref(),
+                    ))
+                })
+            })
+            .collect();
+
+        if boards.is_empty() {
+            log::warn!("⚠️  {}: no matching board configurations", project.name());
+            continue;
+        }
+
+        let prepare_boards: Vec<_> = boards.iter().map(|b| (*b).clone()).collect();
+        if let Err(e) =
+            prepare_build_with_retries(handler.as_ref(), &project.path, &prepare_boards, tx.clone())
+                .await
+        {
+            log::warn!(
+                "⚠️  {}: dependency prefetch failed, boards will resolve them individually: {}",
+                project.name(),
+                e
+            );
+        }
+
+        for board_config in boards {
+            let label = format!("{}:{}", project.name(), board_config.name);
+            log::info!("🔨 Building {}", label);
+
+            match build_board_checked(handler.as_ref(), &project.path, board_config, tx.clone())
+                .await
+            {
+                Ok(artifacts) => {
+                    log::info!(
+                        "✅ Build successful for {}: {} artifacts generated",
+                        label,
+                        artifacts.len()
+                    );
+                    succeeded.push(label);
+                }
+                Err(e) => {
+                    log::error!("❌ Build failed for {}: {}", label, e);
+                    failed.push(label);
+                    if !keep_going {
+                        break 'projects;
+                    }
+                }
+            }
+        }
+    }
+
+    drop(tx);
+    let retries = log_handler.await?;
+    if retries.total() > 0 {
+        log::info!(
+            "🔁 {} retried step(s): {}",
+            retries.total(),
+            retries.summary()
+        );
+    }
+
+    if !failed.is_empty() {
+        log::error!(
+            "❌ {} workspace build(s) failed: {}",
+            failed.len(),
+            failed.join(", ")
+        );
+        return Err(anyhow::anyhow!("Some workspace builds failed"));
+    }
+
+    log::info!(
+        "🎉 All {} workspace build(s) completed successfully!",
+        succeeded.len()
+    );
+
+    Ok(())
+}
@@ -23,7 +23,7 @@ pub async fn run() -> Result<()> {
         }
         None => {
             // Default behavior - run TUI or CLI based on flags
-            if cli.cli {
+            if cli.cli || cli.plain_output() {
                 commands::list::execute_list_command(&cli).await
             } else {
                 tui::run_tui(cli).await
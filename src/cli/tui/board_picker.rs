@@ -0,0 +1,136 @@
+//! Full-screen picker of the boards and devices of `espbrew build --pick`
+
+use anyhow::Result;
+use crossterm::{
+    event::{self, Event, KeyCode, KeyEventKind, KeyModifiers},
+    execute,
+    terminal::{EnterAlternateScreen, LeaveAlternateScreen, disable_raw_mode, enable_raw_mode},
+};
+use ratatui::{
+    Frame, Terminal,
+    backend::CrosstermBackend,
+    layout::{Constraint, Direction, Layout},
+    style::{Modifier, Style},
+    text::{Line, Span},
+    widgets::{Block, Borders, List, ListItem, ListState, Paragraph},
+};
+use std::io;
+
+use crate::cli::tui::theme::Theme;
+use crate::projects::board_picker::BoardPicker;
+
+/// Let the user pick the boards and their devices; `None` if they cancelled
+pub fn run_board_picker(mut picker: BoardPicker, theme: &Theme) -> Result<Option<BoardPicker>> {
+    enable_raw_mode()?;
+    let mut stdout = io::stdout();
+    execute!(stdout, EnterAlternateScreen)?;
+    let mut terminal = Terminal::new(CrosstermBackend::new(stdout))?;
+
+    let result = loop {
+        if let Err(e) = terminal.draw(|f| render_board_picker(f, &picker, theme)) {
+            break Err(e.into());
+        }
+        let key = match event::read() {
+            Ok(Event::Key(key)) if key.kind == KeyEventKind::Press => key,
+            Ok(_) => continue,
+            Err(e) => break Err(e.into()),
+        };
+        match key.code {
+            KeyCode::Char('c') if key.modifiers.contains(KeyModifiers::CONTROL) => break Ok(None),
+            KeyCode::Esc | KeyCode::Char('q') => break Ok(None),
+            KeyCode::Enter => break Ok(Some(picker)),
+            KeyCode::Up | KeyCode::Char('k') => picker.move_selection(-1),
+            KeyCode::Down | KeyCode::Char('j') => picker.move_selection(1),
+            KeyCode::Char(' ') => picker.toggle(),
+            KeyCode::Char('a') => picker.toggle_all(),
+            KeyCode::Left | KeyCode::Char('h') => picker.cycle_port(-1),
+            KeyCode::Right | KeyCode::Char('l') | KeyCode::Char('d') => picker.cycle_port(1),
+            _ => {}
+        }
+    };
+
+    disable_raw_mode()?;
+    execute!(terminal.backend_mut(), LeaveAlternateScreen)?;
+    terminal.show_cursor()?;
+    result
+}
+
+fn render_board_picker(f: &mut Frame, picker: &BoardPicker, theme: &Theme) {
+    let chunks = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints([Constraint::Min(3), Constraint::Length(3)])
+        .split(f.area());
+
+    let name_width = picker
+        .boards
+        .iter()
+        .map(|board| board.name.chars().count())
+        .max()
+        .unwrap_or(0)
+        + 2;
+    let items: Vec<ListItem> = picker
+        .boards
+        .iter()
+        .map(|board| {
+            let (check, check_color) = if board.checked {
+                ("[x] ", theme.success)
+            } else {
+                ("[ ] ", theme.muted)
+            };
+            let target = board.target.as_deref().unwrap_or("unknown");
+            let device = match &board.port {
+                Some(port) if board.port == board.registered_port => {
+                    Span::styled(format!("📌 {}", port), Style::default().fg(theme.info))
+                }
+                Some(port) => Span::styled(
+                    format!("📌 {} (new)", port),
+                    Style::default().fg(theme.warning),
+                ),
+                None => Span::styled("no device", Style::default().fg(theme.muted)),
+            };
+            ListItem::new(Line::from(vec![
+                Span::styled(check, Style::default().fg(check_color)),
+                Span::styled(
+                    format!("{:<width$}", board.name, width = name_width),
+                    Style::default().fg(theme.text),
+                ),
+                Span::styled(format!("{:<12}", target), Style::default().fg(theme.muted)),
+                device,
+            ]))
+        })
+        .collect();
+
+    let title = format!(
+        " Boards to build ({} of {}), {} device(s) connected ",
+        picker.boards.iter().filter(|board| board.checked).count(),
+        picker.boards.len(),
+        picker.ports.len()
+    );
+    let list = List::new(items)
+        .block(
+            Block::default()
+                .title(title)
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .highlight_style(
+            Style::default()
+                .bg(theme.selection)
+                .add_modifier(Modifier::BOLD),
+        )
+        .highlight_symbol("▶ ");
+    let mut state = ListState::default();
+    state.select((!picker.boards.is_empty()).then_some(picker.selected));
+    f.render_stateful_widget(list, chunks[0], &mut state);
+
+    let hints = Paragraph::new(Line::from(Span::styled(
+        "[↑↓]Select [Space]Check [a]All [←→]Device [Enter]Build [Esc/q]Cancel",
+        Style::default().fg(theme.muted),
+    )))
+    .block(
+        Block::default()
+            .borders(Borders::ALL)
+            .border_style(Style::default().fg(theme.border)),
+    );
+    f.render_widget(hints, chunks[1]);
+}
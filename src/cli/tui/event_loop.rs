@@ -2,7 +2,10 @@
 
 use anyhow::Result;
 use crossterm::{
-    event::{self, Event, KeyCode, KeyEventKind, KeyModifiers},
+    event::{
+        self, DisableFocusChange, DisableMouseCapture, EnableFocusChange, EnableMouseCapture,
+        Event, KeyCode, KeyEvent, KeyEventKind, KeyModifiers,
+    },
     execute,
     terminal::{EnterAlternateScreen, LeaveAlternateScreen, disable_raw_mode, enable_raw_mode},
 };
@@ -11,16 +14,24 @@ use std::{io, time::Duration};
 use tokio::sync::mpsc;
 
 use crate::cli::tui::main_app::App;
+use crate::cli::tui::palette::PaletteCommand;
 use crate::cli::tui::ui::ui;
+use crate::models::board::{BoardAction, BoardListFilter, MatrixSelection, MonitorInput};
 use crate::models::project::{BuildStatus, ComponentAction};
 use crate::models::{AppEvent, FocusedPane};
+use crate::projects::build_scheduler::QueueMove;
 
 /// Run the main TUI event loop
 pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
     // Setup terminal
     enable_raw_mode()?;
     let mut stdout = io::stdout();
-    execute!(stdout, EnterAlternateScreen)?;
+    execute!(
+        stdout,
+        EnterAlternateScreen,
+        EnableMouseCapture,
+        EnableFocusChange
+    )?;
 
     let backend = CrosstermBackend::new(stdout);
     let mut terminal = Terminal::new(backend)?;
@@ -41,6 +52,17 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
     // Start server discovery
     app.start_server_discovery(tx.clone());
 
+    // Durations of earlier builds for the progress estimates
+    app.refresh_build_history();
+
+    // Back to the selection, split and filters of the last session
+    app.restore_state();
+
+    // `espbrew watch` starts with watch mode on
+    if app.watch_on_start {
+        app.toggle_watch(tx.clone());
+    }
+
     // Main loop
     let result = loop {
         terminal.draw(|f| ui(f, &app))?;
@@ -50,7 +72,19 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
             // Handle crossterm events
             _ = tokio::task::spawn_blocking(|| event::poll(Duration::from_millis(50))) => {
                 if event::poll(Duration::from_millis(0))? {
-                    match event::read()? {
+                    let event = match event::read()? {
+                        // A click on a key hint of the help bar presses its key
+                        Event::Mouse(mouse) => {
+                            let size = terminal.size()?;
+                            let area = ratatui::layout::Rect::new(0, 0, size.width, size.height);
+                            match app.handle_mouse(mouse, area) {
+                                Some(code) => Event::Key(KeyEvent::new(code, KeyModifiers::NONE)),
+                                None => Event::Mouse(mouse),
+                            }
+                        }
+                        event => event,
+                    };
+                    match event {
                         Event::Key(key) => {
                             if key.kind == KeyEventKind::Press {
                                 // Handle tool warning modal first
@@ -65,6 +99,406 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                     continue;
                                 }
 
+                                // Handle the command palette. The chosen command goes on below: a
+                                // main view action as its default key, a board action picked in the
+                                // action menu opened on it
+                                let mut palette_code = None;
+                                if let Some(palette) = app.command_palette.as_mut() {
+                                    let control = key.modifiers.contains(KeyModifiers::CONTROL);
+                                    match key.code {
+                                        KeyCode::Esc => {
+                                            app.command_palette = None;
+                                            continue;
+                                        }
+                                        KeyCode::Char('c') if control => break Ok(()),
+                                        KeyCode::Up => palette.move_selection(-1),
+                                        KeyCode::Char('p') if control => palette.move_selection(-1),
+                                        KeyCode::Down => palette.move_selection(1),
+                                        KeyCode::Char('n') if control => palette.move_selection(1),
+                                        KeyCode::PageUp => palette.move_selection(-10),
+                                        KeyCode::PageDown => palette.move_selection(10),
+                                        KeyCode::Backspace => palette.pop(),
+                                        KeyCode::Char(c) if !control => palette.push(c),
+                                        KeyCode::Enter => {
+                                            let command = palette.selected_entry().map(|entry| entry.command.clone());
+                                            app.command_palette = None;
+                                            match command {
+                                                Some(PaletteCommand::Key(code)) => palette_code = Some(code),
+                                                Some(PaletteCommand::Board(board, action)) => {
+                                                    if !app.select_board_action(&board, &action) {
+                                                        continue;
+                                                    }
+                                                }
+                                                Some(PaletteCommand::MonitorPort(port)) => {
+                                                    app.monitor_port(&port, tx.clone());
+                                                    continue;
+                                                }
+                                                None => continue,
+                                            }
+                                        }
+                                        _ => {}
+                                    }
+                                    if palette_code.is_none() && !app.show_action_menu {
+                                        continue;
+                                    }
+                                }
+
+                                // Handle tag filter input
+                                if let Some(input) = app.tag_filter_input.as_mut() {
+                                    match key.code {
+                                        KeyCode::Enter => {
+                                            if let Err(e) = app.submit_tag_filter_input() {
+                                                let _ = tx.send(AppEvent::Error(format!("Invalid tag filter: {}", e)));
+                                            }
+                                        }
+                                        KeyCode::Esc => {
+                                            app.tag_filter_input = None;
+                                        }
+                                        KeyCode::Backspace => {
+                                            input.pop();
+                                        }
+                                        KeyCode::Char(c) => {
+                                            input.push(c);
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the board name filter being typed, applied as it is
+                                if let Some(input) = app.list_filter_input.as_mut() {
+                                    match key.code {
+                                        KeyCode::Enter => {
+                                            app.list_filter_input = None;
+                                        }
+                                        KeyCode::Esc => {
+                                            app.list_filter_input = None;
+                                            app.apply_list_filter(None);
+                                        }
+                                        KeyCode::Backspace => {
+                                            input.pop();
+                                            app.update_list_filter_input();
+                                        }
+                                        KeyCode::Char(c) => {
+                                            input.push(c);
+                                            app.update_list_filter_input();
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the log search being typed
+                                if let Some(input) = app.log_search_input.as_mut() {
+                                    match key.code {
+                                        KeyCode::Enter => {
+                                            if let Err(e) = app.submit_log_search_input() {
+                                                let _ = tx.send(AppEvent::Error(format!("Invalid search: {:#}", e)));
+                                            }
+                                        }
+                                        KeyCode::Esc => {
+                                            app.log_search_input = None;
+                                        }
+                                        KeyCode::Backspace => {
+                                            input.pop();
+                                        }
+                                        KeyCode::Char(c) => {
+                                            input.push(c);
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the diagnostics panel
+                                if app.diagnostics.is_some() {
+                                    if matches!(key.code, KeyCode::Esc | KeyCode::Char('d')) {
+                                        app.toggle_diagnostics();
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the device flash panel
+                                if app.show_device_flash {
+                                    match key.code {
+                                        KeyCode::Esc | KeyCode::Char('u') => {
+                                            app.show_device_flash = false;
+                                        }
+                                        KeyCode::Char('r') => {
+                                            app.start_device_flash(tx.clone());
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the OTA rollout panel
+                                if app.show_ota {
+                                    match key.code {
+                                        KeyCode::Esc | KeyCode::Char('o') => {
+                                            app.show_ota = false;
+                                        }
+                                        KeyCode::Char('r') => {
+                                            app.start_ota_rollout(tx.clone());
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the core dump view
+                                if app.show_core_dumps {
+                                    match key.code {
+                                        KeyCode::Esc | KeyCode::Char('D') => {
+                                            app.show_core_dumps = false;
+                                        }
+                                        KeyCode::Tab | KeyCode::Right | KeyCode::Char('l') => {
+                                            app.cycle_core_dump(true);
+                                        }
+                                        KeyCode::BackTab | KeyCode::Left | KeyCode::Char('h') => {
+                                            app.cycle_core_dump(false);
+                                        }
+                                        KeyCode::Up | KeyCode::Char('k') => {
+                                            app.scroll_core_dump(-1);
+                                        }
+                                        KeyCode::Down | KeyCode::Char('j') => {
+                                            app.scroll_core_dump(1);
+                                        }
+                                        KeyCode::PageUp => {
+                                            app.scroll_core_dump(-20);
+                                        }
+                                        KeyCode::PageDown => {
+                                            app.scroll_core_dump(20);
+                                        }
+                                        KeyCode::Char('s') => {
+                                            app.save_core_dump_report();
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the serial monitor view; its panes keep reading when it's closed
+                                if app.show_serial_monitor {
+                                    // Tags, a highlight regex or a console line being typed
+                                    if let Some((kind, input)) = app.monitor_input.as_mut() {
+                                        let console = *kind == MonitorInput::Console;
+                                        match key.code {
+                                            KeyCode::Enter => {
+                                                if let Err(e) = app.submit_monitor_input() {
+                                                    let _ = tx.send(AppEvent::Error(format!("Invalid highlight: {}", e)));
+                                                }
+                                            }
+                                            KeyCode::Esc => {
+                                                app.monitor_input = None;
+                                            }
+                                            KeyCode::Backspace => {
+                                                input.pop();
+                                            }
+                                            KeyCode::Up if console => {
+                                                app.recall_console_line(true);
+                                            }
+                                            KeyCode::Down if console => {
+                                                app.recall_console_line(false);
+                                            }
+                                            KeyCode::Tab if console => {
+                                                app.cycle_console_line_ending();
+                                            }
+                                            KeyCode::Char(c) if console && key.modifiers.contains(KeyModifiers::CONTROL) => {
+                                                app.send_console_control(c);
+                                            }
+                                            KeyCode::Char(c) => {
+                                                input.push(c);
+                                            }
+                                            _ => {}
+                                        }
+                                        continue;
+                                    }
+                                    match key.code {
+                                        KeyCode::Esc | KeyCode::Char('M') => {
+                                            app.show_serial_monitor = false;
+                                        }
+                                        KeyCode::Tab | KeyCode::Right | KeyCode::Char('l') => {
+                                            app.cycle_serial_monitor(true);
+                                        }
+                                        KeyCode::BackTab | KeyCode::Left | KeyCode::Char('h') => {
+                                            app.cycle_serial_monitor(false);
+                                        }
+                                        KeyCode::Up | KeyCode::Char('k') => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.scroll_up(1);
+                                            }
+                                        }
+                                        KeyCode::Down | KeyCode::Char('j') => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.scroll_down(1);
+                                            }
+                                        }
+                                        KeyCode::PageUp => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.scroll_up(20);
+                                            }
+                                        }
+                                        KeyCode::PageDown => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.scroll_down(20);
+                                            }
+                                        }
+                                        KeyCode::End => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.scroll_offset = 0;
+                                            }
+                                        }
+                                        KeyCode::Char(' ') | KeyCode::Char('p') => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.toggle_pause();
+                                            }
+                                        }
+                                        KeyCode::Char('c') => {
+                                            if let Some(monitor) = app.selected_serial_monitor() {
+                                                monitor.clear();
+                                            }
+                                        }
+                                        KeyCode::Char('r') => {
+                                            if app.serial_monitors.is_empty() {
+                                                app.open_serial_monitors(tx.clone());
+                                            } else {
+                                                app.reconnect_serial_monitor(tx.clone());
+                                            }
+                                        }
+                                        KeyCode::Char('x') => {
+                                            app.close_serial_monitor();
+                                        }
+                                        KeyCode::Char('v') => {
+                                            app.cycle_monitor_layout();
+                                        }
+                                        KeyCode::Char('y') => {
+                                            app.copy_backtrace();
+                                        }
+                                        KeyCode::Char('w') => {
+                                            app.toggle_recording();
+                                        }
+                                        KeyCode::Char('g') => {
+                                            app.toggle_plotter();
+                                        }
+                                        KeyCode::Char('m') => {
+                                            app.toggle_memory_panel();
+                                        }
+                                        KeyCode::Char('D') => {
+                                            app.show_core_dumps = true;
+                                        }
+                                        KeyCode::Char('L') => {
+                                            app.cycle_monitor_level();
+                                        }
+                                        KeyCode::Char('T') => {
+                                            app.start_monitor_input(MonitorInput::Tags);
+                                        }
+                                        KeyCode::Char('/') => {
+                                            app.start_monitor_input(MonitorInput::Highlight);
+                                        }
+                                        KeyCode::Char('H') => {
+                                            app.toggle_monitor_highlights();
+                                        }
+                                        KeyCode::Char('i') => {
+                                            app.start_monitor_input(MonitorInput::Console);
+                                        }
+                                        KeyCode::Char('S') => {
+                                            app.show_session_summary();
+                                        }
+                                        KeyCode::Char('E') => {
+                                            app.start_or_stop_console_script();
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the side-by-side log comparison
+                                if app.log_comparison.is_some() {
+                                    match key.code {
+                                        KeyCode::Up | KeyCode::Char('k') => app.scroll_log_comparison(-1),
+                                        KeyCode::Down | KeyCode::Char('j') => app.scroll_log_comparison(1),
+                                        KeyCode::PageUp => app.scroll_log_comparison(-20),
+                                        KeyCode::PageDown => app.scroll_log_comparison(20),
+                                        KeyCode::Home => app.scroll_log_comparison(isize::MIN),
+                                        KeyCode::End => app.scroll_log_comparison(isize::MAX),
+                                        KeyCode::Char('n') => app.move_to_difference(true),
+                                        KeyCode::Char('N') => app.move_to_difference(false),
+                                        KeyCode::Char('d') => app.toggle_comparison_differences(),
+                                        KeyCode::Char('x') => app.swap_log_comparison(),
+                                        KeyCode::Esc | KeyCode::Char('q') | KeyCode::Char('L') => {
+                                            app.log_comparison = None;
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the build history panel
+                                if app.show_history {
+                                    if matches!(key.code, KeyCode::Esc | KeyCode::Char('s')) {
+                                        app.show_history = false;
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the run dashboard
+                                if app.show_dashboard {
+                                    match key.code {
+                                        KeyCode::Esc | KeyCode::Char('i') | KeyCode::Char('q') => {
+                                            app.toggle_dashboard();
+                                        }
+                                        KeyCode::Char('r') => {
+                                            app.refresh_dashboard_devices();
+                                        }
+                                        KeyCode::Char('y') => {
+                                            app.copy_dashboard();
+                                        }
+                                        _ => {}
+                                    }
+                                    continue;
+                                }
+
+                                // Handle the profile matrix
+                                if app.profile_matrix.is_some() {
+                                    let selection = match key.code {
+                                        KeyCode::Up | KeyCode::Char('k') => {
+                                            app.move_matrix_cursor(-1, 0);
+                                            None
+                                        }
+                                        KeyCode::Down | KeyCode::Char('j') => {
+                                            app.move_matrix_cursor(1, 0);
+                                            None
+                                        }
+                                        KeyCode::Left | KeyCode::Char('h') => {
+                                            app.move_matrix_cursor(0, -1);
+                                            None
+                                        }
+                                        KeyCode::Right | KeyCode::Char('l') => {
+                                            app.move_matrix_cursor(0, 1);
+                                            None
+                                        }
+                                        KeyCode::Enter | KeyCode::Char('b') | KeyCode::Char(' ') => Some(MatrixSelection::Cell),
+                                        KeyCode::Char('r') => Some(MatrixSelection::Row),
+                                        KeyCode::Char('c') => Some(MatrixSelection::Column),
+                                        KeyCode::Esc | KeyCode::Char('g') => {
+                                            app.toggle_profile_matrix();
+                                            None
+                                        }
+                                        _ => None,
+                                    };
+                                    if let Some(selection) = selection
+                                        && !app.build_in_progress
+                                    {
+                                        if let Err(e) = app.build_matrix_selection(selection, tx.clone()).await {
+                                            let error_msg = format!("Profile matrix build failed: {}", e);
+                                            log::error!("{}", error_msg);
+                                            let _ = tx.send(AppEvent::Error(error_msg));
+                                        }
+                                    }
+                                    continue;
+                                }
+
                                 // Handle action menus
                                 if app.show_action_menu {
                                     match key.code {
@@ -83,6 +517,22 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                                 let action = app.available_actions[app.action_menu_selected].clone();
                                                 app.show_action_menu = false;
 
+                                                // GDB takes over the terminal until it quits
+                                                if action == BoardAction::Debug {
+                                                    disable_raw_mode()?;
+                                                    execute!(terminal.backend_mut(), LeaveAlternateScreen, DisableMouseCapture, DisableFocusChange)?;
+                                                    let result = app.run_debug_session(app.selected_board);
+                                                    enable_raw_mode()?;
+                                                    execute!(terminal.backend_mut(), EnterAlternateScreen, EnableMouseCapture, EnableFocusChange)?;
+                                                    terminal.clear()?;
+                                                    if let Err(e) = result {
+                                                        let error_msg = format!("Debug session failed: {:#}", e);
+                                                        log::error!("{}", error_msg);
+                                                        let _ = tx.send(AppEvent::Error(error_msg));
+                                                    }
+                                                    continue;
+                                                }
+
                                                 // Extract data needed for action execution
                                                 if let Some(board) = app.boards.get(app.selected_board) {
                                                     let _board_name = board.name.clone();
@@ -167,7 +617,7 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                             }
                                         }
                                         KeyCode::Esc => {
-                                            app.show_local_board_dialog = false;
+                                            app.close_local_board_dialog(tx.clone());
                                         }
                                         _ => {}
                                     }
@@ -211,7 +661,27 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                     continue;
                                 }
 
-                                match key.code {
+                                // Ctrl+P opens the command palette
+                                if palette_code.is_none()
+                                    && key.code == KeyCode::Char('p')
+                                    && key.modifiers.contains(KeyModifiers::CONTROL)
+                                {
+                                    app.open_command_palette();
+                                    continue;
+                                }
+
+                                // The main view handles a remapped key as its action's default key
+                                let code = if let Some(code) = palette_code {
+                                    code
+                                } else if key.modifiers.contains(KeyModifiers::CONTROL) {
+                                    key.code
+                                } else {
+                                    match app.keymap.translate(key.code) {
+                                        Some(code) => code,
+                                        None => continue,
+                                    }
+                                };
+                                match code {
                                     KeyCode::Char('q') => break Ok(()),
                                     KeyCode::Char('c') if key.modifiers.contains(KeyModifiers::CONTROL) => {
                                         break Ok(());
@@ -305,6 +775,38 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                             }
                                         }
                                     }
+                                    KeyCode::Char('p') => {
+                                        if !app.build_in_progress && !app.boards.is_empty() {
+                                            if let Err(e) = app.build_selected_project(tx.clone()).await {
+                                                let error_msg = format!("Project build failed: {}", e);
+                                                log::error!("{}", error_msg);
+                                                let _ = tx.send(AppEvent::Error(error_msg));
+                                            }
+                                        }
+                                    }
+                                    KeyCode::Char('g') => {
+                                        if !app.boards.is_empty() {
+                                            app.toggle_profile_matrix();
+                                        }
+                                    }
+                                    // Cancel or restart the selected board, the others keep running
+                                    KeyCode::Char('c') => {
+                                        if let Some(board) = app.boards.get(app.selected_board) {
+                                            let board_name = board.name.clone();
+                                            if app.cancel_board_action(app.selected_board).is_some() {
+                                                app.resume_serial_monitors(&board_name, tx.clone());
+                                            } else {
+                                                app.add_log_line(&board_name, "ℹ️ Nothing running to cancel".to_string());
+                                            }
+                                        }
+                                    }
+                                    KeyCode::Char('a') => {
+                                        if let Err(e) = app.restart_board_action(app.selected_board, tx.clone()).await {
+                                            let error_msg = format!("Restart failed: {}", e);
+                                            log::error!("{}", error_msg);
+                                            let _ = tx.send(AppEvent::Error(error_msg));
+                                        }
+                                    }
                                     // Action menus
                                     KeyCode::Enter => {
                                         match app.focused_pane {
@@ -351,10 +853,127 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                                             app.show_component_action_menu = false;
                                         } else if app.show_help {
                                             app.show_help = false;
+                                        } else if app.log_search.is_some() {
+                                            app.log_search = None;
                                         } else {
                                             break Ok(());
                                         }
                                     }
+                                    // Log search
+                                    KeyCode::Char('/') => {
+                                        app.log_search_input = Some(
+                                            app.log_search.as_ref().map(|s| s.pattern.clone()).unwrap_or_default(),
+                                        );
+                                    }
+                                    KeyCode::Char('n') => {
+                                        app.move_to_log_match(true);
+                                    }
+                                    KeyCode::Char('N') => {
+                                        app.move_to_log_match(false);
+                                    }
+                                    // Tag filter
+                                    KeyCode::Char('t') => {
+                                        app.tag_filter_input = Some(
+                                            app.tag_filter.as_ref().map(|f| f.to_string()).unwrap_or_default(),
+                                        );
+                                    }
+                                    // Failed, building and name filters of the board list
+                                    KeyCode::Char('F') => {
+                                        app.apply_list_filter(BoardListFilter::next_status(app.list_filter.as_ref()));
+                                    }
+                                    KeyCode::Char('&') => {
+                                        app.list_filter_input = Some(match &app.list_filter {
+                                            Some(BoardListFilter::Name(text)) => text.clone(),
+                                            _ => String::new(),
+                                        });
+                                    }
+                                    KeyCode::Char('R') => {
+                                        if !app.build_in_progress {
+                                            if let Err(e) = app.rerun_failed_boards(tx.clone()).await {
+                                                let _ = tx.send(AppEvent::Error(format!("Re-run failed: {}", e)));
+                                            }
+                                        }
+                                    }
+                                    // Watch mode
+                                    KeyCode::Char('w') => {
+                                        app.toggle_watch(tx.clone());
+                                    }
+                                    // Build history
+                                    KeyCode::Char('s') => {
+                                        app.refresh_build_history();
+                                        app.show_history = true;
+                                    }
+                                    KeyCode::Char(':') => {
+                                        app.open_command_palette();
+                                    }
+                                    // Totals and timings of the run
+                                    KeyCode::Char('i') => {
+                                        app.toggle_dashboard();
+                                    }
+                                    // Compiler diagnostics shared across boards
+                                    KeyCode::Char('d') => {
+                                        app.toggle_diagnostics();
+                                    }
+                                    // Flash all connected devices at once
+                                    KeyCode::Char('u') => {
+                                        app.open_device_flash(tx.clone());
+                                    }
+                                    // Update the ota: devices over the air
+                                    KeyCode::Char('o') => {
+                                        app.open_ota(tx.clone());
+                                    }
+                                    // Serial monitor panes of the connected devices
+                                    KeyCode::Char('M') => {
+                                        app.open_serial_monitors(tx.clone());
+                                    }
+                                    // Crash reports of the core dumps the panes captured
+                                    KeyCode::Char('D') => {
+                                        app.show_core_dumps = true;
+                                    }
+                                    // Two boards' logs side by side
+                                    KeyCode::Char('L') => {
+                                        app.compare_logs(app.selected_board);
+                                    }
+                                    // Reorder the builds waiting for slots
+                                    KeyCode::Char('f') => {
+                                        app.move_in_build_queue(QueueMove::Front);
+                                    }
+                                    KeyCode::Char('+') => {
+                                        app.move_in_build_queue(QueueMove::Earlier);
+                                    }
+                                    KeyCode::Char('-') => {
+                                        app.move_in_build_queue(QueueMove::Later);
+                                    }
+                                    // A terminal editor takes over the terminal until it exits
+                                    KeyCode::Char('e') => {
+                                        disable_raw_mode()?;
+                                        execute!(terminal.backend_mut(), LeaveAlternateScreen, DisableMouseCapture, DisableFocusChange)?;
+                                        let result = app.open_in_editor();
+                                        enable_raw_mode()?;
+                                        execute!(terminal.backend_mut(), EnterAlternateScreen, EnableMouseCapture, EnableFocusChange)?;
+                                        terminal.clear()?;
+                                        if let Err(e) = result {
+                                            let error_msg = format!("Opening the editor failed: {:#}", e);
+                                            log::error!("{}", error_msg);
+                                            let _ = tx.send(AppEvent::Error(error_msg));
+                                        }
+                                    }
+                                    // menuconfig takes over the terminal until it exits
+                                    KeyCode::Char('m') => {
+                                        if !app.build_in_progress && app.selected_board < app.boards.len() {
+                                            disable_raw_mode()?;
+                                            execute!(terminal.backend_mut(), LeaveAlternateScreen, DisableMouseCapture, DisableFocusChange)?;
+                                            let result = app.run_menuconfig(app.selected_board);
+                                            enable_raw_mode()?;
+                                            execute!(terminal.backend_mut(), EnterAlternateScreen, EnableMouseCapture, EnableFocusChange)?;
+                                            terminal.clear()?;
+                                            if let Err(e) = result {
+                                                let error_msg = format!("menuconfig failed: {:#}", e);
+                                                log::error!("{}", error_msg);
+                                                let _ = tx.send(AppEvent::Error(error_msg));
+                                            }
+                                        }
+                                    }
                                     // Refresh
                                     KeyCode::Char('r') => {
                                         if !app.build_in_progress {
@@ -371,7 +990,14 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                             }
                         }
                         Event::Mouse(_mouse) => {
-                            // Mouse events are not captured
+                            // Handled by app.handle_mouse above
+                        }
+                        // Desktop notifications are skipped while the terminal has focus
+                        Event::FocusGained => {
+                            app.terminal_focused = Some(true);
+                        }
+                        Event::FocusLost => {
+                            app.terminal_focused = Some(false);
                         }
                         _ => {}
                     }
@@ -382,7 +1008,27 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
             Some(event) = rx.recv() => {
                 match event {
                     AppEvent::BuildOutput(board_name, line) => {
-                        app.add_log_line(&board_name, line);
+                        if !app.record_device_flash_output(&board_name, &line) {
+                            app.add_log_line(&board_name, line);
+                        }
+                    }
+                    AppEvent::DevicesMatched(devices, skipped) => {
+                        app.handle_devices_matched(devices, skipped, tx.clone());
+                    }
+                    AppEvent::FlashProgress(label, percent) => {
+                        app.handle_flash_progress(&label, percent);
+                    }
+                    AppEvent::FlashVerified(label) => {
+                        app.handle_flash_verified(&label);
+                    }
+                    AppEvent::DeviceFlashFinished(label, success) => {
+                        app.handle_device_flash_finished(&label, success, tx.clone());
+                    }
+                    AppEvent::OtaRolloutStarted(devices, error) => {
+                        app.handle_ota_rollout_started(devices, error);
+                    }
+                    AppEvent::OtaStatusChanged(device, status) => {
+                        app.handle_ota_status(&device, status);
                     }
                     AppEvent::BuildFinished(board_name, success) => {
                         let status = if success {
@@ -391,6 +1037,8 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                             BuildStatus::Failed
                         };
                         app.update_board_status(&board_name, status);
+                        app.refresh_build_history();
+                        app.refresh_diagnostics();
                     }
                     AppEvent::ActionFinished(board_name, action_name, success) => {
                         let status = if success {
@@ -399,6 +1047,8 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                             BuildStatus::Failed
                         };
                         app.update_board_status(&board_name, status);
+                        app.refresh_build_history();
+                        app.refresh_diagnostics();
 
                         // Add completion message to logs
                         let completion_msg = if success {
@@ -407,6 +1057,34 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                             format!("❌ {} failed!", action_name)
                         };
                         app.add_log_line(&board_name, completion_msg);
+                        app.resume_serial_monitors(&board_name, tx.clone());
+                    }
+                    AppEvent::SerialMonitorRequested(board_name, port) => {
+                        app.open_serial_monitor(&port, Some(board_name), tx.clone());
+                    }
+                    AppEvent::SerialOutput(port, reader, data) => {
+                        app.handle_serial_output(&port, reader, &data, tx.clone());
+                    }
+                    AppEvent::SerialClosed(port, reader, error) => {
+                        app.handle_serial_closed(&port, reader, error);
+                    }
+                    AppEvent::SerialDecoded(port, reader, line, frames) => {
+                        app.handle_serial_decoded(&port, reader, &line, &frames);
+                    }
+                    AppEvent::SerialDefmt(port, reader, line) => {
+                        app.handle_serial_defmt(&port, reader, &line, tx.clone());
+                    }
+                    AppEvent::SerialReconnecting(port, reader, error) => {
+                        app.handle_serial_reconnecting(&port, reader, &error);
+                    }
+                    AppEvent::SerialReconnected(port, reader, new_port) => {
+                        app.handle_serial_reconnected(&port, reader, &new_port, tx.clone());
+                    }
+                    AppEvent::MonitorTriggerRan(port, trigger, outcome) => {
+                        app.handle_monitor_trigger_ran(&port, &trigger, outcome);
+                    }
+                    AppEvent::CoreDumpDecoded(report) => {
+                        app.handle_core_dump_decoded(report, tx.clone());
                     }
                     AppEvent::LocalBoardScanStarted => {
                         app.handle_local_board_scan_started();
@@ -444,8 +1122,27 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
                     AppEvent::RemoteMonitorFailed(error) => {
                         app.handle_remote_monitor_failed(error);
                     }
+                    AppEvent::SourcesChanged(changed) => {
+                        if app.is_watching()
+                            && let Err(e) = app.rebuild_changed_boards(changed, tx.clone()).await
+                        {
+                            let _ = tx.send(AppEvent::Error(format!("Watch rebuild failed: {}", e)));
+                        }
+                    }
                     AppEvent::Tick => {
-                        // Regular tick for UI updates
+                        // Regular tick for UI updates, the console scripts' steps,
+                        // the board list's progress and filter, the compared logs,
+                        // the state kept for the next session, the web dashboard and
+                        // the session's recording or replay
+                        app.advance_replay();
+                        app.poll_console_scripts();
+                        app.track_board_activity();
+                        app.refresh_list_filter();
+                        app.refresh_log_comparison();
+                        app.persist_state();
+                        app.publish_web_dashboard();
+                        app.run_web_commands(tx.clone()).await;
+                        app.record_session();
                     }
                     AppEvent::Error(error_msg) => {
                         // Display error message in the current board's log
@@ -474,9 +1171,17 @@ pub async fn run_tui_event_loop(mut app: App) -> Result<()> {
         }
     };
 
+    app.persist_state();
+    app.record_session();
+
     // Cleanup
     disable_raw_mode()?;
-    execute!(terminal.backend_mut(), LeaveAlternateScreen)?;
+    execute!(
+        terminal.backend_mut(),
+        LeaveAlternateScreen,
+        DisableMouseCapture,
+        DisableFocusChange
+    )?;
     terminal.show_cursor()?;
 
     result
@@ -0,0 +1,338 @@
+//! Key bindings of the TUI's main view
+//!
+//! The `[keys]` section of `~/.config/espbrew/config.toml` binds the main
+//! view's actions to other keys. A binding replaces the action's default
+//! keys and takes its keys away from the actions they were defaults of; an
+//! empty list leaves the action unbound:
+//!
+//! ```toml
+//! [keys]
+//! build = ["B", "space"]
+//! cancel = "C"
+//! refresh = "f5"
+//! profile_matrix = []
+//! ```
+//!
+//! Keys are single characters, or `space`, `enter`, `esc`, `tab`,
+//! `backspace`, `up`, `down`, `left`, `right`, `pageup`, `pagedown`,
+//! `home`, `end`, `delete`, `insert` and `f1` to `f12`. Ctrl+C always quits
+//! and Ctrl+P opens the command palette, and the panels and the serial
+//! monitor keep their keys. The help popup lists the active bindings.
+
+use anyhow::{Context, Result};
+use crossterm::event::KeyCode;
+use serde::Deserialize;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+/// An action of the main view
+#[derive(Debug)]
+pub struct KeyAction {
+    /// Name in the `[keys]` section
+    pub name: &'static str,
+    pub title: &'static str,
+    /// The first is the key the main view handles the action by
+    pub defaults: &'static [KeyCode],
+}
+
+const fn key_action(
+    name: &'static str,
+    title: &'static str,
+    defaults: &'static [KeyCode],
+) -> KeyAction {
+    KeyAction {
+        name,
+        title,
+        defaults,
+    }
+}
+
+/// The main view's actions, in the order the help popup lists them
+pub const ACTIONS: &[KeyAction] = &[
+    key_action("up", "Up", &[KeyCode::Up, KeyCode::Char('k')]),
+    key_action("down", "Down", &[KeyCode::Down, KeyCode::Char('j')]),
+    key_action("page_up", "Page up", &[KeyCode::PageUp]),
+    key_action("page_down", "Page down", &[KeyCode::PageDown]),
+    key_action("top", "Top", &[KeyCode::Home]),
+    key_action("bottom", "Bottom", &[KeyCode::End]),
+    key_action("switch_pane", "Switch Pane", &[KeyCode::Tab]),
+    key_action("actions", "Actions", &[KeyCode::Enter]),
+    key_action("back", "Back", &[KeyCode::Esc]),
+    key_action(
+        "build",
+        "Build Selected",
+        &[KeyCode::Char('b'), KeyCode::Char(' ')],
+    ),
+    key_action("build_all", "Build All", &[KeyCode::Char('x')]),
+    key_action("build_project", "Build Project", &[KeyCode::Char('p')]),
+    key_action("profile_matrix", "Profiles", &[KeyCode::Char('g')]),
+    key_action("cancel", "Cancel", &[KeyCode::Char('c')]),
+    key_action("restart", "Restart", &[KeyCode::Char('a')]),
+    key_action("menuconfig", "Menuconfig", &[KeyCode::Char('m')]),
+    key_action("open_in_editor", "Open in editor", &[KeyCode::Char('e')]),
+    key_action("refresh", "Refresh", &[KeyCode::Char('r')]),
+    key_action("search", "Search", &[KeyCode::Char('/')]),
+    key_action("next_match", "Next match", &[KeyCode::Char('n')]),
+    key_action("previous_match", "Previous match", &[KeyCode::Char('N')]),
+    key_action("tags", "Tags", &[KeyCode::Char('t')]),
+    key_action("status_filter", "Failed/Building", &[KeyCode::Char('F')]),
+    key_action("name_filter", "Name filter", &[KeyCode::Char('&')]),
+    key_action("rerun_failed", "Re-run failed", &[KeyCode::Char('R')]),
+    key_action("watch", "Watch", &[KeyCode::Char('w')]),
+    key_action("history", "History", &[KeyCode::Char('s')]),
+    key_action("dashboard", "Dashboard", &[KeyCode::Char('i')]),
+    key_action("diagnostics", "Diagnostics", &[KeyCode::Char('d')]),
+    key_action("flash_devices", "Flash devices", &[KeyCode::Char('u')]),
+    key_action("ota", "OTA", &[KeyCode::Char('o')]),
+    key_action("serial_monitors", "Serial monitors", &[KeyCode::Char('M')]),
+    key_action("core_dumps", "Core dumps", &[KeyCode::Char('D')]),
+    key_action("compare_logs", "Compare logs", &[KeyCode::Char('L')]),
+    key_action("queue_front", "Queue front", &[KeyCode::Char('f')]),
+    key_action("queue_earlier", "Queue earlier", &[KeyCode::Char('+')]),
+    key_action("queue_later", "Queue later", &[KeyCode::Char('-')]),
+    key_action("command_palette", "Commands", &[KeyCode::Char(':')]),
+    key_action("help", "Help", &[KeyCode::Char('h'), KeyCode::Char('?')]),
+    key_action("quit", "Quit", &[KeyCode::Char('q')]),
+];
+
+/// A key as `B`, `space` or `f5`
+pub fn parse_key(value: &str) -> Result<KeyCode> {
+    let mut chars = value.chars();
+    if let (Some(c), None) = (chars.next(), chars.next()) {
+        return Ok(KeyCode::Char(c));
+    }
+    let key = match value.to_lowercase().as_str() {
+        "space" => KeyCode::Char(' '),
+        "enter" => KeyCode::Enter,
+        "esc" => KeyCode::Esc,
+        "tab" => KeyCode::Tab,
+        "backspace" => KeyCode::Backspace,
+        "up" => KeyCode::Up,
+        "down" => KeyCode::Down,
+        "left" => KeyCode::Left,
+        "right" => KeyCode::Right,
+        "pageup" => KeyCode::PageUp,
+        "pagedown" => KeyCode::PageDown,
+        "home" => KeyCode::Home,
+        "end" => KeyCode::End,
+        "delete" => KeyCode::Delete,
+        "insert" => KeyCode::Insert,
+        name => match name.strip_prefix('f').and_then(|n| n.parse::<u8>().ok()) {
+            Some(n) if (1..=12).contains(&n) => KeyCode::F(n),
+            _ => return Err(anyhow::anyhow!("Invalid key '{}'", value)),
+        },
+    };
+    Ok(key)
+}
+
+/// A key as the help shows it, e.g. `Space` or `PgUp`
+pub fn key_label(key: KeyCode) -> String {
+    match key {
+        KeyCode::Char(' ') => "Space".to_string(),
+        KeyCode::Char(c) => c.to_string(),
+        KeyCode::Up => "↑".to_string(),
+        KeyCode::Down => "↓".to_string(),
+        KeyCode::Left => "←".to_string(),
+        KeyCode::Right => "→".to_string(),
+        KeyCode::PageUp => "PgUp".to_string(),
+        KeyCode::PageDown => "PgDn".to_string(),
+        KeyCode::F(n) => format!("F{}", n),
+        key => format!("{:?}", key),
+    }
+}
+
+/// Keys of a binding: one as a string, or a list
+#[derive(Debug, Clone, Deserialize)]
+#[serde(untagged)]
+pub enum KeyList {
+    One(String),
+    Many(Vec<String>),
+}
+
+impl KeyList {
+    fn values(&self) -> &[String] {
+        match self {
+            KeyList::One(value) => std::slice::from_ref(value),
+            KeyList::Many(values) => values,
+        }
+    }
+}
+
+/// `config.toml` of the user's espbrew configuration
+#[derive(Debug, Default, Deserialize)]
+pub struct UserConfig {
+    #[serde(default)]
+    pub keys: BTreeMap<String, KeyList>,
+}
+
+/// The user's configuration file
+pub fn config_path() -> Option<PathBuf> {
+    dirs::config_dir().map(|dir| dir.join("espbrew").join("config.toml"))
+}
+
+/// The keys of the main view's actions
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Keymap {
+    /// Keys of each of `ACTIONS`
+    keys: Vec<Vec<KeyCode>>,
+    /// Whether each of `ACTIONS` is bound by the user
+    remapped: Vec<bool>,
+}
+
+impl Default for Keymap {
+    fn default() -> Self {
+        Self {
+            keys: ACTIONS.iter().map(|a| a.defaults.to_vec()).collect(),
+            remapped: vec![false; ACTIONS.len()],
+        }
+    }
+}
+
+fn action_index(name: &str) -> Option<usize> {
+    ACTIONS.iter().position(|a| a.name == name)
+}
+
+/// The action named in `[keys]`
+pub fn find_action(name: &str) -> Option<&'static KeyAction> {
+    ACTIONS.iter().find(|a| a.name == name)
+}
+
+impl Keymap {
+    /// The defaults changed by the bindings of a `[keys]` section
+    pub fn new(bindings: &BTreeMap<String, KeyList>) -> Result<Self> {
+        let mut keymap = Self::default();
+        let mut bound: Vec<(KeyCode, &str)> = Vec::new();
+        for (name, keys) in bindings {
+            let index = action_index(name).ok_or_else(|| {
+                let names: Vec<&str> = ACTIONS.iter().map(|a| a.name).collect();
+                anyhow::anyhow!("Unknown action '{}', one of {}", name, names.join(", "))
+            })?;
+            let mut codes = Vec::new();
+            for value in keys.values() {
+                let code = parse_key(value).with_context(|| format!("Key of {}", name))?;
+                if let Some((_, other)) = bound.iter().find(|(key, _)| *key == code) {
+                    return Err(anyhow::anyhow!(
+                        "Key '{}' is bound to both {} and {}",
+                        value,
+                        other,
+                        name
+                    ));
+                }
+                bound.push((code, name));
+                codes.push(code);
+            }
+            keymap.keys[index] = codes;
+            keymap.remapped[index] = true;
+        }
+        // The keys bound by the user no longer do what they did by default
+        for (index, keys) in keymap.keys.iter_mut().enumerate() {
+            if !keymap.remapped[index] {
+                keys.retain(|key| !bound.iter().any(|(code, _)| code == key));
+            }
+        }
+        Ok(keymap)
+    }
+
+    /// Bindings of a configuration file, the defaults if it has no `[keys]`
+    pub fn load(path: &Path) -> Result<Self> {
+        let content = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        let config: UserConfig =
+            toml::from_str(&content).with_context(|| format!("Invalid {}", path.display()))?;
+        Self::new(&config.keys).with_context(|| format!("Invalid [keys] in {}", path.display()))
+    }
+
+    /// Bindings of the user's configuration file, if there is one
+    pub fn resolve() -> Result<Self> {
+        match config_path() {
+            Some(path) if path.is_file() => Self::load(&path),
+            _ => Ok(Self::default()),
+        }
+    }
+
+    /// The key the main view handles the pressed key's action by; `None` if
+    /// the key isn't bound
+    pub fn translate(&self, key: KeyCode) -> Option<KeyCode> {
+        self.keys
+            .iter()
+            .position(|keys| keys.contains(&key))
+            .map(|index| ACTIONS[index].defaults[0])
+    }
+
+    pub fn keys(&self, name: &str) -> &[KeyCode] {
+        action_index(name).map_or(&[], |index| &self.keys[index])
+    }
+
+    pub fn is_remapped(&self, name: &str) -> bool {
+        action_index(name).is_some_and(|index| self.remapped[index])
+    }
+
+    /// The action's keys, e.g. `b/Space`, or `-` if unbound
+    pub fn label(&self, name: &str) -> String {
+        let keys = self.keys(name);
+        if keys.is_empty() {
+            return "-".to_string();
+        }
+        keys.iter()
+            .map(|key| key_label(*key))
+            .collect::<Vec<_>>()
+            .join("/")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_tui_key_bindings() {
+        assert_eq!(parse_key("B").unwrap(), KeyCode::Char('B'));
+        assert_eq!(parse_key("space").unwrap(), KeyCode::Char(' '));
+        assert_eq!(parse_key("F5").unwrap(), KeyCode::F(5));
+        assert!(parse_key("f13").is_err());
+        assert!(parse_key("hyper").is_err());
+
+        let defaults = Keymap::default();
+        assert_eq!(
+            defaults.translate(KeyCode::Char(' ')),
+            Some(KeyCode::Char('b'))
+        );
+        assert_eq!(defaults.translate(KeyCode::Char('k')), Some(KeyCode::Up));
+        assert_eq!(defaults.translate(KeyCode::Char('z')), None);
+        assert_eq!(defaults.label("build"), "b/Space");
+
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("config.toml");
+        fs::write(
+            &path,
+            "[keys]\nbuild = [\"B\", \"space\"]\nrefresh = \"f5\"\nup = \"b\"\nprofile_matrix = []\n",
+        )
+        .unwrap();
+        let keymap = Keymap::load(&path).unwrap();
+        // Remapped keys act as the default key of their action
+        assert_eq!(
+            keymap.translate(KeyCode::Char('B')),
+            Some(KeyCode::Char('b'))
+        );
+        assert_eq!(keymap.translate(KeyCode::F(5)), Some(KeyCode::Char('r')));
+        assert_eq!(keymap.translate(KeyCode::Char('b')), Some(KeyCode::Up));
+        // The replaced defaults do nothing
+        assert_eq!(keymap.translate(KeyCode::Char('r')), None);
+        assert_eq!(keymap.translate(KeyCode::Char('k')), None);
+        assert_eq!(keymap.translate(KeyCode::Char('g')), None);
+        assert_eq!(keymap.label("profile_matrix"), "-");
+        assert!(keymap.is_remapped("refresh"));
+        assert!(!keymap.is_remapped("cancel"));
+
+        // A file without [keys] keeps the defaults
+        fs::write(&path, "# nothing bound\n").unwrap();
+        assert_eq!(Keymap::load(&path).unwrap(), defaults);
+
+        fs::write(&path, "[keys]\nbuild = \"B\"\ncancel = \"B\"\n").unwrap();
+        assert!(Keymap::load(&path).is_err());
+        fs::write(&path, "[keys]\nteleport = \"T\"\n").unwrap();
+        assert!(Keymap::load(&path).is_err());
+    }
+}
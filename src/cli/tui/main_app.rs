@@ -2,6 +2,8 @@
 
 use anyhow::Result;
 use chrono::Local;
+use crossterm::event::{KeyCode, MouseButton, MouseEvent, MouseEventKind};
+use ratatui::layout::{Position, Rect};
 use ratatui::widgets::ListState;
 use std::{fs, path::PathBuf};
 
@@ -9,11 +11,114 @@ use crate::models::FocusedPane;
 
 // Use qualified imports to avoid conflicts
 use crate::ProjectBoardConfig;
-use crate::models::board::{BoardAction, BoardConfig, RemoteBoard};
+use crate::cli::tui::keymap::Keymap;
+use crate::cli::tui::palette::{CommandPalette, palette_entries};
+use crate::cli::tui::serial_monitor::{
+    MONITOR_BAUD_RATE, PORT_RELEASE_DELAY, spawn_backtrace_decoder, spawn_defmt_decoder,
+    spawn_serial_reader,
+};
+use crate::cli::tui::theme::Theme;
+use crate::cli::tui::tui_state::TuiState;
+use crate::config::build_profiles::ProfileMatrix;
+use crate::models::board::{
+    BoardAction, BoardActivity, BoardConfig, BoardListFilter, CoreDumpReport, DeviceFlash,
+    DeviceFlashRun, HighlightRule, InputHistory, LineEnding, LogComparison, MatrixSelection,
+    MonitorFilter, MonitorInput, MonitorLayout, MonitorLevel, MonitorState, OtaRollout, OtaStatus,
+    PlotRule, RemoteBoard, RunningAction, SerialMonitor, WorkspaceMember, merged_line, parse_tags,
+    plot_values, strip_ansi,
+};
 use crate::models::project::{BuildStatus, BuildStrategy, ComponentAction, ComponentConfig};
 use crate::models::server::{DiscoveredServer, RemoteActionType};
 use crate::models::tui::LocalBoard;
-use crate::projects::{ProjectHandler, ProjectType};
+use crate::projects::board_tags::{TagFilter, board_tags};
+use crate::projects::build_history::{
+    BoardStats, board_stats, estimate_duration, estimated_progress, load_history,
+};
+use crate::projects::build_scheduler::{
+    BuildScheduler, BuildSlot, QueueMove, SchedulerSettings, board_priority, board_weight,
+};
+use crate::projects::command_templates::{
+    TemplateStep, command_template, expand_template, run_template,
+};
+use crate::projects::console_script::{ConsoleScript, ScriptEvent, ScriptRun, configured_scripts};
+use crate::projects::core_dump::{CoreDumpLine, core_dump_line, decode_core_dump, save_report};
+use crate::projects::crash_loop::{
+    CrashLoopAlert, configured_crash_loop, notify_crash_loop, resets_per_minute,
+};
+use crate::projects::dashboard::{
+    BoardSummary, DashboardTotals, DeviceState, DeviceSummary, RunOutcome, board_columns,
+    dashboard_markdown, registered_board,
+};
+use crate::projects::device_registry::{
+    DeviceRegistry, configured_port, connected_ports, find_by_usb, port_or_registered,
+};
+use crate::projects::erase;
+use crate::projects::flash_orchestrator::{flash_devices, match_devices, probe_devices};
+use crate::projects::hooks::run_shell_command;
+use crate::projects::log_diff::{diff_logs, differing_rows};
+use crate::projects::log_search::LogSearch;
+use crate::projects::monitor_log::{MonitorRecorder, RecordSettings};
+use crate::projects::monitor_triggers::{
+    MonitorTrigger, TriggerAction, configured_triggers, save_trigger_log, trigger_env,
+    trigger_log_path,
+};
+use crate::projects::notifications::{
+    ActivityRun, NotificationEvent, NotificationSettings, configured_notifications, notify_desktop,
+    run_summary,
+};
+use crate::projects::ota;
+use crate::projects::remote_build::{AgentPool, build_board_on_agent};
+use crate::projects::session_recording::{
+    RecordedBoard, SessionEvent, SessionHeader, SessionRecorder, SessionReplay,
+};
+use crate::projects::source_links::{SourceLocation, configured_editor, editor_command};
+use crate::projects::watch::{DEFAULT_DEBOUNCE_MS, SourceWatcher, affects_board, describe_changes};
+use crate::projects::web_dashboard::{
+    MONITOR_TAIL, WebAction, WebBoard, WebCommand, WebDashboardLink, WebMonitor, WebSnapshot,
+};
+use crate::projects::{ProjectHandler, ProjectRegistry, ProjectType};
+use crate::utils::backtrace::{BacktraceDecoder, board_elf, code_addresses, osc52_copy};
+use crate::utils::compiler_cache::CacheStats;
+use crate::utils::defmt::{DefmtChunk, DefmtSplitter, has_defmt_table};
+use crate::utils::diagnostics::{DiagnosticsCollector, SharedDiagnostic, diagnostic_location};
+use crate::utils::espflash_utils::{find_esp_ports, select_esp_port};
+use crate::utils::firmware_size::SizeReport;
+use crate::utils::process_group::BoardJob;
+
+/// Holder of the ports of the serial monitor panes while 'u' flashes all devices
+const DEVICE_FLASH_HOLDER: &str = "the device flash";
+const CORE_DUMP_HOLDER: &str = "the core dump";
+/// Time for a device that saved a core dump to reboot before it is read
+const CORE_DUMP_REBOOT_DELAY: std::time::Duration = std::time::Duration::from_secs(1);
+/// Width of the board and component lists, in percent of the terminal
+pub const DEFAULT_BOARD_LIST_PERCENT: u16 = 32;
+/// Narrowest and widest the lists can be dragged to
+const MIN_BOARD_LIST_PERCENT: u16 = 15;
+const MAX_BOARD_LIST_PERCENT: u16 = 70;
+/// Lines a turn of the mouse wheel scrolls
+const MOUSE_SCROLL_LINES: usize = 3;
+
+/// Item of a bordered list at the row of its area, the list scrolled as
+/// ratatui does from the top to keep the selected item in view
+pub fn list_item_at(heights: &[u16], selected: usize, area: Rect, row: u16) -> Option<usize> {
+    let inner_height = area.height.saturating_sub(2);
+    if row <= area.y || row >= area.y + 1 + inner_height || heights.is_empty() {
+        return None;
+    }
+    let selected = selected.min(heights.len() - 1);
+    let mut first = 0;
+    while first < selected && heights[first..=selected].iter().sum::<u16>() > inner_height {
+        first += 1;
+    }
+    let mut offset = row - area.y - 1;
+    for (index, height) in heights.iter().enumerate().skip(first) {
+        if offset < *height {
+            return Some(index);
+        }
+        offset -= height;
+    }
+    None
+}
 
 pub struct App {
     pub boards: Vec<BoardConfig>,
@@ -28,6 +133,13 @@ pub struct App {
     pub project_type: Option<ProjectType>,
     pub project_handler: Option<Box<dyn ProjectHandler>>,
     pub show_help: bool,
+    pub theme: Theme,
+    /// Keys of the main view's actions, from the user's `[keys]`
+    pub keymap: Keymap,
+    /// Width of the board and component lists, in percent of the terminal
+    pub board_list_percent: u16,
+    /// The split between the lists and the log is being dragged
+    pub dragging_split: bool,
     pub focused_pane: FocusedPane,
     pub log_scroll_offset: usize,
     pub log_auto_scroll: bool,
@@ -42,6 +154,10 @@ pub struct App {
     pub available_component_actions: Vec<ComponentAction>,
     pub build_strategy: BuildStrategy,
     pub build_in_progress: bool,
+    /// Limits how many board builds run at once
+    pub build_scheduler: BuildScheduler,
+    /// Remote agents board builds are sent to instead of building locally
+    pub agent_pool: Option<AgentPool>,
     pub server_url: Option<String>,
     pub board_mac: Option<String>,
     // Remote board dialog state
@@ -80,6 +196,124 @@ pub struct App {
     pub local_board_list_state: ListState,
     pub local_boards_loading: bool,
     pub local_boards_fetch_error: Option<String>,
+    // Tag filter state; boards hidden by the filter keep their original index
+    pub tag_filter: Option<TagFilter>,
+    pub tag_filter_input: Option<String>,
+    /// Failed, building or name filter of the board list, and the name being
+    /// typed
+    pub list_filter: Option<BoardListFilter>,
+    pub list_filter_input: Option<String>,
+    /// Search of the selected board's log, and the regex being typed
+    pub log_search: Option<LogSearch>,
+    pub log_search_input: Option<String>,
+    /// Log line of the diagnostic last opened in the editor with 'e'
+    pub editor_line: Option<usize>,
+    /// Board marked as the left side of the next config diff
+    pub config_diff_base: Option<String>,
+    /// Board marked as the left side of the next log comparison
+    pub log_compare_base: Option<String>,
+    /// Two boards' logs side by side while the comparison view is open
+    pub log_comparison: Option<LogComparison>,
+    /// Boards × profiles grid while the matrix view is open
+    pub profile_matrix: Option<ProfileMatrix>,
+    /// Selected (row, column) of the matrix view
+    pub matrix_cursor: (usize, usize),
+    pub hidden_boards: Vec<(usize, BoardConfig)>,
+    /// Boards rebuilt by watch mode, all boards if empty
+    pub watch_boards: Vec<String>,
+    /// Turn watch mode on when the TUI starts, set by `espbrew watch`
+    pub watch_on_start: bool,
+    pub watch_debounce: std::time::Duration,
+    /// Task reporting source changes while watch mode is on
+    pub watch_task: Option<tokio::task::JoinHandle<()>>,
+    /// Whether the build history panel is open
+    pub show_history: bool,
+    /// Build statistics of the boards, from the projects' build history
+    pub build_history: Vec<BoardStats>,
+    /// Expected build duration per board
+    pub build_estimates: std::collections::HashMap<String, std::time::Duration>,
+    /// Build or flash of each board, for the board list's progress
+    pub board_activity: std::collections::HashMap<String, BoardActivity>,
+    /// Application size of each board's last build, from its size report
+    pub board_flash_sizes: std::collections::HashMap<String, u64>,
+    /// Compiler cache hits of each board's last build
+    pub board_cache_stats: std::collections::HashMap<String, CacheStats>,
+    /// Wall time of the last builds and flashes, from a board getting busy
+    /// until all were idle again
+    pub last_run_time: Option<std::time::Duration>,
+    /// Whether the run dashboard is open
+    pub show_dashboard: bool,
+    /// Commands of the palette while it is open, with Ctrl+P
+    pub command_palette: Option<CommandPalette>,
+    /// Devices connected when the dashboard was opened or refreshed
+    pub dashboard_devices: Vec<DeviceSummary>,
+    /// Whether the dashboard was copied since it was opened
+    pub dashboard_copied: bool,
+    /// Actions still running, per board
+    pub running_actions: std::collections::HashMap<String, RunningAction>,
+    /// Compiler diagnostics of all board logs, deduplicated; `Some` while the panel is open
+    pub diagnostics: Option<Vec<SharedDiagnostic>>,
+    /// Latest flash of all connected devices, started with 'u'
+    pub device_flash: Option<DeviceFlashRun>,
+    /// Whether the device flash panel is open
+    pub show_device_flash: bool,
+    /// Latest OTA rollout, started with 'o'
+    pub ota_rollout: Option<OtaRollout>,
+    /// Whether the OTA rollout panel is open
+    pub show_ota: bool,
+    /// Serial monitor panes, one per device, opened with 'M' or the Monitor action
+    pub serial_monitors: Vec<SerialMonitor>,
+    pub selected_monitor: usize,
+    /// Whether the serial monitor view is open; the panes keep reading while it is closed
+    pub show_serial_monitor: bool,
+    /// Last reader started for a pane
+    pub monitor_reader: u64,
+    pub monitor_layout: MonitorLayout,
+    /// Output of all panes interleaved, for the merged layout
+    pub merged_monitor: SerialMonitor,
+    /// Filters and highlight rules of the serial monitor view
+    pub monitor_filter: MonitorFilter,
+    /// Tags, highlight regex or console line being typed in the serial monitor view
+    pub monitor_input: Option<(MonitorInput, String)>,
+    /// Appended to the lines sent to the consoles, cycled with Tab while typing
+    pub console_line_ending: LineEnding,
+    /// Lines sent to the consoles, recalled with ↑↓
+    pub console_history: InputHistory,
+    /// Rules reading the values to plot, besides `>>name:value`
+    pub plot_rules: Vec<PlotRule>,
+    /// Actions taken on the lines the panes' devices print
+    pub monitor_triggers: Vec<MonitorTrigger>,
+    /// When the panes' devices count as crash-looping, and who is told
+    pub crash_loop: crate::config::CrashLoopSection,
+    /// Events of finished builds and flashes the desktop is told about
+    pub notifications: NotificationSettings,
+    /// Builds and flashes since the boards were last all idle
+    pub activity_run: ActivityRun,
+    /// Whether the terminal has focus, `None` until it tells
+    pub terminal_focused: Option<bool>,
+    /// Console scripts run against the panes' devices with 'E'
+    pub console_scripts: Vec<ConsoleScript>,
+    /// Whether the serial monitor view plots the selected pane's values
+    pub show_plotter: bool,
+    /// Whether the serial monitor view shows the devices' memory trends
+    pub show_memory: bool,
+    /// Where the panes' sessions are recorded, and whether from the start
+    pub monitor_recording: RecordSettings,
+    /// Recordings of the panes by port, started with 'w'
+    pub monitor_recorders: std::collections::HashMap<String, MonitorRecorder>,
+    /// Crash reports of the core dumps the panes captured, oldest first
+    pub core_dumps: Vec<CoreDumpReport>,
+    pub selected_core_dump: usize,
+    /// Whether the core dump view is open
+    pub show_core_dumps: bool,
+    /// Selection, split and filters as last saved to the state file
+    pub saved_state: Option<TuiState>,
+    /// Browser dashboard of `espbrew serve --web`
+    pub web_dashboard: Option<WebDashboardLink>,
+    /// Recording of the session, with `--record`
+    pub recorder: Option<SessionRecorder>,
+    /// Recording played back by `espbrew replay`, which runs no actions
+    pub replay: Option<SessionReplay>,
 }
 
 impl App {
@@ -92,6 +326,14 @@ impl App {
     ) -> Result<Self> {
         let logs_dir = project_dir.join("logs");
         let support_dir = project_dir.join("support");
+        let monitor_filter = Self::configured_monitor_filter(&project_dir);
+        let monitor_recording = RecordSettings::load(&project_dir);
+        let plot_rules = Self::configured_plot_rules(&project_dir);
+        let console_line_ending = Self::configured_line_ending(&project_dir);
+        let monitor_triggers = configured_triggers(&project_dir);
+        let crash_loop = configured_crash_loop(&project_dir);
+        let notifications = configured_notifications(&project_dir);
+        let console_scripts = configured_scripts(&project_dir);
 
         // Create directories if they don't exist
         fs::create_dir_all(&logs_dir)?;
@@ -104,15 +346,18 @@ impl App {
                 Ok(project_boards) => project_boards
                     .into_iter()
                     .map(|board| BoardConfig {
+                        tags: board_tags(&project_dir, &board.name, board.target.as_deref()),
                         name: board.name,
                         config_file: board.config_file,
                         build_dir: board.build_dir,
                         status: BuildStatus::Pending,
                         log_lines: Vec::new(),
+                        log_resets: 0,
                         build_time: None,
                         last_updated: Local::now(),
                         target: board.target,
                         project_type: board.project_type,
+                        workspace: None,
                     })
                     .collect(),
                 Err(_e) => {
@@ -121,8 +366,14 @@ impl App {
                 }
             }
         } else {
-            // Fallback to ESP-IDF discovery for unknown projects
-            Self::discover_boards(&project_dir)?
+            // Fallback to ESP-IDF discovery for unknown projects, then to a
+            // monorepo workspace scan when the root has no boards of its own
+            let boards = Self::discover_boards(&project_dir)?;
+            if boards.is_empty() {
+                Self::discover_workspace_boards(&project_dir)
+            } else {
+                boards
+            }
         };
 
         let components = Self::discover_components(&project_dir)?;
@@ -155,24 +406,44 @@ impl App {
                 (false, String::new(), None)
             };
 
-        let available_actions = vec![
+        let mut available_actions = vec![
             BoardAction::Build,
             BoardAction::GenerateBinary,
             BoardAction::Flash,
             BoardAction::FlashAppOnly,
             BoardAction::Monitor,
+            BoardAction::Debug,
             BoardAction::Clean,
             BoardAction::Purge,
             BoardAction::RemoteFlash,
             BoardAction::RemoteMonitor,
+            BoardAction::EraseFlash,
+            BoardAction::EraseNvs,
+            BoardAction::CompareLogs,
         ];
 
+        // MicroPython boards get a combined firmware + filesystem deploy
+        if detected_project_type == Some(ProjectType::MicroPython) {
+            available_actions.insert(3, BoardAction::Deploy);
+        }
+
+        // ESP-IDF boards may inherit sdkconfig fragments
+        if detected_project_type == Some(ProjectType::EspIdf) {
+            available_actions.push(BoardAction::EffectiveConfig);
+            available_actions.push(BoardAction::DiffConfig);
+            available_actions.push(BoardAction::PartitionTable);
+        }
+
         let available_component_actions = vec![
             ComponentAction::CloneFromRepository,
             ComponentAction::Update,
             ComponentAction::Remove,
         ];
 
+        let build_scheduler =
+            BuildScheduler::new(SchedulerSettings::resolve(&project_dir, None, None));
+        let agent_pool = AgentPool::resolve(&project_dir, &[]).unwrap_or_default();
+
         Ok(Self {
             boards,
             selected_board: 0,
@@ -186,6 +457,10 @@ impl App {
             project_type: detected_project_type,
             project_handler,
             show_help: false,
+            theme: Theme::default(),
+            keymap: Keymap::default(),
+            board_list_percent: DEFAULT_BOARD_LIST_PERCENT,
+            dragging_split: false,
             focused_pane: FocusedPane::BoardList,
             log_scroll_offset: 0,
             log_auto_scroll: true,
@@ -200,6 +475,8 @@ impl App {
             available_component_actions,
             build_strategy,
             build_in_progress: false,
+            build_scheduler,
+            agent_pool,
             server_url,
             board_mac,
             show_remote_board_dialog: false,
@@ -232,6 +509,68 @@ impl App {
             local_board_list_state: ListState::default(),
             local_boards_loading: false,
             local_boards_fetch_error: None,
+            tag_filter: None,
+            tag_filter_input: None,
+            list_filter: None,
+            list_filter_input: None,
+            log_search: None,
+            log_search_input: None,
+            editor_line: None,
+            config_diff_base: None,
+            log_compare_base: None,
+            log_comparison: None,
+            profile_matrix: None,
+            matrix_cursor: (0, 0),
+            hidden_boards: Vec::new(),
+            watch_boards: Vec::new(),
+            watch_on_start: false,
+            watch_debounce: std::time::Duration::from_millis(DEFAULT_DEBOUNCE_MS),
+            watch_task: None,
+            show_history: false,
+            build_history: Vec::new(),
+            build_estimates: std::collections::HashMap::new(),
+            board_activity: std::collections::HashMap::new(),
+            board_flash_sizes: std::collections::HashMap::new(),
+            board_cache_stats: std::collections::HashMap::new(),
+            last_run_time: None,
+            show_dashboard: false,
+            command_palette: None,
+            dashboard_devices: Vec::new(),
+            dashboard_copied: false,
+            running_actions: std::collections::HashMap::new(),
+            diagnostics: None,
+            device_flash: None,
+            show_device_flash: false,
+            ota_rollout: None,
+            show_ota: false,
+            serial_monitors: Vec::new(),
+            selected_monitor: 0,
+            show_serial_monitor: false,
+            monitor_reader: 0,
+            monitor_layout: MonitorLayout::default(),
+            merged_monitor: SerialMonitor::new("merged", None),
+            monitor_filter,
+            monitor_input: None,
+            console_line_ending,
+            console_history: InputHistory::default(),
+            plot_rules,
+            monitor_triggers,
+            crash_loop,
+            notifications,
+            activity_run: ActivityRun::default(),
+            terminal_focused: None,
+            console_scripts,
+            show_plotter: false,
+            show_memory: false,
+            monitor_recording,
+            monitor_recorders: std::collections::HashMap::new(),
+            core_dumps: Vec::new(),
+            selected_core_dump: 0,
+            show_core_dumps: false,
+            saved_state: None,
+            web_dashboard: None,
+            recorder: None,
+            replay: None,
         })
     }
 
@@ -254,10 +593,13 @@ impl App {
                             build_dir,
                             status: BuildStatus::Pending,
                             log_lines: Vec::new(),
+                            log_resets: 0,
                             build_time: None,
                             last_updated: Local::now(),
                             target: None,
                             project_type: crate::projects::ProjectType::EspIdf,
+                            workspace: None,
+                            tags: board_tags(project_dir, board_name, None),
                         });
                     }
                 }
@@ -268,6 +610,84 @@ impl App {
         Ok(boards)
     }
 
+    /// Board discovery for a monorepo root that is not a project itself.
+    ///
+    /// Boards of every nested project are listed grouped by project, named
+    /// `<project>.<board>` so that boards of different apps don't collide.
+    fn discover_workspace_boards(project_dir: &std::path::Path) -> Vec<BoardConfig> {
+        let projects = match crate::projects::discover_workspace(
+            project_dir,
+            crate::projects::workspace::DEFAULT_WORKSPACE_DEPTH,
+        ) {
+            Ok(projects) => projects,
+            Err(_) => return Vec::new(),
+        };
+
+        projects
+            .into_iter()
+            .flat_map(|project| {
+                let label = project.name();
+                let slug = project.slug();
+                let dir = project.path.clone();
+                project.boards.into_iter().map(move |board| BoardConfig {
+                    tags: board_tags(&dir, &board.name, board.target.as_deref()),
+                    name: format!("{}.{}", slug, board.name),
+                    config_file: board.config_file,
+                    build_dir: board.build_dir,
+                    status: BuildStatus::Pending,
+                    log_lines: Vec::new(),
+                    log_resets: 0,
+                    build_time: None,
+                    last_updated: Local::now(),
+                    target: board.target,
+                    project_type: board.project_type,
+                    workspace: Some(WorkspaceMember {
+                        project: label.clone(),
+                        project_dir: dir.clone(),
+                        board_name: board.name,
+                    }),
+                })
+            })
+            .collect()
+    }
+
+    /// Forward handler output under the TUI board name.
+    ///
+    /// Handlers report progress using their own board name; workspace boards
+    /// are listed under a qualified name, so their events are rewritten.
+    fn relay_board_events(
+        board_name: &str,
+        handler_board_name: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent> {
+        if board_name == handler_board_name {
+            return tx;
+        }
+
+        let (relay_tx, mut relay_rx) = tokio::sync::mpsc::unbounded_channel();
+        let board_name = board_name.to_string();
+        let handler_board_name = handler_board_name.to_string();
+        tokio::spawn(async move {
+            while let Some(event) = relay_rx.recv().await {
+                let event = match event {
+                    crate::models::AppEvent::BuildOutput(name, line)
+                        if name == handler_board_name =>
+                    {
+                        crate::models::AppEvent::BuildOutput(board_name.clone(), line)
+                    }
+                    crate::models::AppEvent::FlashVerified(name) if name == handler_board_name => {
+                        crate::models::AppEvent::FlashVerified(board_name.clone())
+                    }
+                    other => other,
+                };
+                if tx.send(event).is_err() {
+                    break;
+                }
+            }
+        });
+        relay_tx
+    }
+
     fn discover_components(project_dir: &std::path::Path) -> Result<Vec<ComponentConfig>> {
         let mut components = Vec::new();
 
@@ -333,7 +753,7 @@ impl App {
                 } else {
                     0
                 };
-                board.log_lines = lines[start_idx..].to_vec();
+                board.reset_log(lines[start_idx..].to_vec());
 
                 // Update status based on log content
                 if lines.iter().any(|line| {
@@ -398,9 +818,11 @@ impl App {
         deduplicated
     }
 
-    /// Scan for local boards connected via USB/serial (async non-blocking)
+    /// Scan for local boards connected via USB/serial (async non-blocking);
+    /// with `settle` after the serial monitor panes released their ports
     pub fn scan_local_boards(
         &mut self,
+        settle: bool,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
     ) {
         // Set loading state and clear previous results
@@ -413,6 +835,9 @@ impl App {
 
         // Spawn background task for scanning
         tokio::spawn(async move {
+            if settle {
+                tokio::time::sleep(PORT_RELEASE_DELAY).await;
+            }
             // Use serialport to discover serial ports
             match serialport::available_ports() {
                 Ok(ports) => {
@@ -498,8 +923,29 @@ impl App {
         &mut self,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
     ) {
+        // The scan opens every port, so the panes release theirs until the
+        // board's flash is done or the dialog is closed
+        let settle = match self.boards.get(self.selected_board) {
+            Some(board) => {
+                let board_name = board.name.clone();
+                self.suspend_serial_monitors(&board_name, |_| true)
+            }
+            None => false,
+        };
         self.show_local_board_dialog = true;
-        self.scan_local_boards(tx);
+        self.scan_local_boards(settle, tx);
+    }
+
+    /// Close the local board dialog without flashing
+    pub fn close_local_board_dialog(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.show_local_board_dialog = false;
+        if let Some(board) = self.boards.get(self.selected_board) {
+            let board_name = board.name.clone();
+            self.resume_serial_monitors(&board_name, tx);
+        }
     }
 
     /// Scan for local boards with logging (for CLI or when logging is desired)
@@ -660,82 +1106,66 @@ impl App {
             return Err(anyhow::anyhow!("No project board selected"));
         }
 
+        let selected_port = self.local_boards[self.selected_local_board].port.clone();
+
+        // Close the dialog and start flashing
+        self.show_local_board_dialog = false;
+        self.flash_board_on_port(self.selected_board, selected_port, false, tx);
+        Ok(())
+    }
+
+    /// Flash the board's build to the device on `selected_port`, with `settle` after
+    /// the serial monitor panes released the port
+    pub fn flash_board_on_port(
+        &mut self,
+        board_index: usize,
+        selected_port: String,
+        settle: bool,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
         // Clone data first before any mutations to avoid borrow checker issues
-        let local_board = self.local_boards[self.selected_local_board].clone();
-        let project_board = self.boards[self.selected_board].clone();
+        let project_board = self.boards[board_index].clone();
         let board_name = project_board.name.clone();
         let config_file = project_board.config_file.clone();
         let build_dir = project_board.build_dir.clone();
-        let project_dir = self.project_dir.clone();
+        let workspace = project_board.workspace.clone();
+        let project_board_type = project_board.project_type.clone();
+        let (project_dir, handler_board_name) = match workspace {
+            Some(ref member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board_name.clone()),
+        };
         let _logs_dir = self.logs_dir.clone();
-        let selected_port = local_board.port.clone();
-
-        // Close the dialog and start flashing
-        self.show_local_board_dialog = false;
 
         // Update status to flashing
-        self.boards[self.selected_board].status = BuildStatus::Flashing;
-        self.boards[self.selected_board].last_updated = Local::now();
-        self.boards[self.selected_board].log_lines.clear();
+        self.boards[board_index].status = BuildStatus::Flashing;
+        self.boards[board_index].last_updated = Local::now();
+        self.boards[board_index].reset_log(Vec::new());
         self.reset_log_scroll();
 
-        let tx_clone = tx.clone();
         let action_name = "Flash".to_string();
-        let project_handler = self.project_handler.as_ref().map(|h| {
-            // Clone the handler for use in async context
-            match h.project_type() {
-                crate::projects::ProjectType::RustNoStd => {
-                    Box::new(crate::projects::handlers::rust_nostd::RustNoStdHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Arduino => {
-                    Box::new(crate::projects::handlers::arduino::ArduinoHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::PlatformIO => {
-                    Box::new(crate::projects::handlers::platformio::PlatformIOHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::MicroPython => {
-                    Box::new(crate::projects::handlers::micropython::MicroPythonHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::CircuitPython => {
-                    Box::new(crate::projects::handlers::circuitpython::CircuitPythonHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Zephyr => {
-                    Box::new(crate::projects::handlers::zephyr::ZephyrHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::NuttX => {
-                    Box::new(crate::projects::handlers::nuttx::NuttXHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::TinyGo => {
-                    Box::new(crate::projects::handlers::tinygo::TinyGoHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Jaculus => {
-                    Box::new(crate::projects::handlers::jaculus::JaculusHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::EspIdf => {
-                    Box::new(crate::projects::handlers::esp_idf::EspIdfHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-            }
-        });
+        // Clone the handler for use in async context; workspace boards get
+        // a handler for their own project type
+        let project_handler = if workspace.is_some() {
+            Some(ProjectRegistry::create_handler(project_board_type.clone()))
+        } else {
+            self.project_handler
+                .as_ref()
+                .map(|h| ProjectRegistry::create_handler(h.project_type()))
+        };
+        let tx_clone = Self::relay_board_events(&board_name, &handler_board_name, tx.clone());
 
         // Spawn the flash task using unified flash service
         tokio::spawn(async move {
             use crate::services::UnifiedFlashService;
+            if settle {
+                tokio::time::sleep(PORT_RELEASE_DELAY).await;
+            }
             let flash_service = UnifiedFlashService::new();
 
             let result = if let Some(handler) = project_handler.as_ref() {
                 // Use project handler's flash_board method with the selected port
                 let project_board_config = crate::models::ProjectBoardConfig {
-                    name: board_name.clone(),
+                    name: handler_board_name.clone(),
                     config_file,
                     build_dir: build_dir.clone(),
                     target: None,
@@ -768,15 +1198,15 @@ impl App {
                     // Try to flash directly - handler will use existing artifacts
                     // Most handlers' flash_board methods can work with pre-built artifacts
                     let empty_artifacts = Vec::new();
-                    handler
-                        .flash_board(
-                            &project_dir,
-                            &project_board_config,
-                            &empty_artifacts,
-                            Some(&selected_port),
-                            tx_clone.clone(),
-                        )
-                        .await
+                    crate::projects::retry::flash_board_with_retries(
+                        handler.as_ref(),
+                        &project_dir,
+                        &project_board_config,
+                        &empty_artifacts,
+                        Some(&selected_port),
+                        tx_clone.clone(),
+                    )
+                    .await
                 }
             } else {
                 // Use unified flash service for ESP-IDF projects as fallback
@@ -805,8 +1235,6 @@ impl App {
                 result.is_ok(),
             ));
         });
-
-        Ok(())
     }
 
     /// Navigate to previous local board
@@ -1466,6 +1894,179 @@ echo "🎉 Clean all completed!"
         }
     }
 
+    /// Whether the board at the index is the first of its workspace project,
+    /// listed under the project's header line
+    pub fn starts_workspace_group(&self, index: usize) -> bool {
+        let Some(member) = self.boards.get(index).and_then(|b| b.workspace.as_ref()) else {
+            return false;
+        };
+        index == 0
+            || self.boards[index - 1]
+                .workspace
+                .as_ref()
+                .map(|prev| prev.project != member.project)
+                .unwrap_or(true)
+    }
+
+    /// Whether a popup, dialog or prompt covers the main view
+    pub fn is_overlay_open(&self) -> bool {
+        (self.show_tool_warning && !self.tool_warning_acknowledged)
+            || self.show_help
+            || self.show_action_menu
+            || self.show_component_action_menu
+            || self.show_remote_board_dialog
+            || self.show_local_board_dialog
+            || self.profile_matrix.is_some()
+            || self.show_history
+            || self.show_dashboard
+            || self.command_palette.is_some()
+            || self.diagnostics.is_some()
+            || self.show_device_flash
+            || self.show_ota
+            || self.show_serial_monitor
+            || self.show_core_dumps
+            || self.tag_filter_input.is_some()
+            || self.list_filter_input.is_some()
+            || self.log_search_input.is_some()
+            || self.log_comparison.is_some()
+    }
+
+    /// Handle a mouse event on the terminal's `area`: clicks select boards
+    /// and components, the wheel scrolls, dragging the border between the
+    /// lists and the log moves it. A click on a key hint of the help bar
+    /// returns the key to press.
+    pub fn handle_mouse(&mut self, mouse: MouseEvent, area: Rect) -> Option<KeyCode> {
+        use crate::cli::tui::ui::{help_bar_key_at, main_layout};
+
+        let scroll = match mouse.kind {
+            MouseEventKind::ScrollUp => Some(false),
+            MouseEventKind::ScrollDown => Some(true),
+            _ => None,
+        };
+        // Popups over the main view take the wheel, if they scroll at all
+        if self.show_core_dumps {
+            if let Some(down) = scroll {
+                let lines = MOUSE_SCROLL_LINES as isize;
+                self.scroll_core_dump(if down { lines } else { -lines });
+            }
+            return None;
+        }
+        if self.show_serial_monitor {
+            if let Some(down) = scroll
+                && let Some(monitor) = self.selected_serial_monitor()
+            {
+                if down {
+                    monitor.scroll_down(MOUSE_SCROLL_LINES);
+                } else {
+                    monitor.scroll_up(MOUSE_SCROLL_LINES);
+                }
+            }
+            return None;
+        }
+        if self.is_overlay_open() {
+            return None;
+        }
+
+        let layout = main_layout(area, self.board_list_percent);
+        let position = Position::new(mouse.column, mouse.row);
+        let on_split = mouse.row < layout.help_bar.y
+            && (mouse.column == layout.log.x || mouse.column + 1 == layout.log.x);
+        match mouse.kind {
+            MouseEventKind::Down(MouseButton::Left) if on_split => {
+                self.dragging_split = true;
+            }
+            MouseEventKind::Down(MouseButton::Left) => {
+                if layout.board_list.contains(position) {
+                    if let Some(index) = self.board_at(layout.board_list, mouse.row) {
+                        self.select_board(index);
+                        self.focused_pane = FocusedPane::LogPane;
+                    }
+                } else if layout.component_list.contains(position) {
+                    self.focused_pane = FocusedPane::ComponentList;
+                    let heights = vec![1; self.components.len()];
+                    if let Some(index) = list_item_at(
+                        &heights,
+                        self.selected_component,
+                        layout.component_list,
+                        mouse.row,
+                    ) {
+                        self.selected_component = index;
+                        self.component_list_state.select(Some(index));
+                    }
+                } else if layout.log.contains(position) || layout.details.contains(position) {
+                    self.focused_pane = FocusedPane::LogPane;
+                } else if layout.help_bar.contains(position) {
+                    return help_bar_key_at(
+                        self,
+                        mouse.column.saturating_sub(layout.help_bar.x + 1),
+                    );
+                }
+            }
+            MouseEventKind::Drag(MouseButton::Left) if self.dragging_split => {
+                let column = u32::from(mouse.column.saturating_sub(area.x));
+                let percent = column * 100 / u32::from(area.width.max(1));
+                self.board_list_percent =
+                    (percent as u16).clamp(MIN_BOARD_LIST_PERCENT, MAX_BOARD_LIST_PERCENT);
+            }
+            MouseEventKind::Up(_) => {
+                self.dragging_split = false;
+            }
+            MouseEventKind::ScrollUp | MouseEventKind::ScrollDown => {
+                let down = mouse.kind == MouseEventKind::ScrollDown;
+                if layout.board_list.contains(position) {
+                    let old_board = self.selected_board;
+                    if down {
+                        self.next_board();
+                    } else {
+                        self.previous_board();
+                    }
+                    if old_board != self.selected_board {
+                        self.reset_log_scroll();
+                    }
+                } else if layout.component_list.contains(position) {
+                    if down {
+                        self.next_component();
+                    } else {
+                        self.previous_component();
+                    }
+                } else if layout.log.contains(position) {
+                    for _ in 0..MOUSE_SCROLL_LINES {
+                        if down {
+                            self.scroll_log_down();
+                        } else {
+                            self.scroll_log_up();
+                        }
+                    }
+                }
+            }
+            _ => {}
+        }
+        None
+    }
+
+    /// Board listed at the row of the board list's area
+    fn board_at(&self, area: Rect, row: u16) -> Option<usize> {
+        let heights: Vec<u16> = (0..self.boards.len())
+            .map(|index| {
+                if self.starts_workspace_group(index) {
+                    2
+                } else {
+                    1
+                }
+            })
+            .collect();
+        list_item_at(&heights, self.selected_board, area, row)
+    }
+
+    /// Select the board and show its log from the end
+    pub fn select_board(&mut self, index: usize) {
+        if index < self.boards.len() && index != self.selected_board {
+            self.selected_board = index;
+            self.list_state.select(Some(index));
+            self.reset_log_scroll();
+        }
+    }
+
     pub fn toggle_focused_pane(&mut self) {
         self.focused_pane = match self.focused_pane {
             FocusedPane::BoardList => FocusedPane::ComponentList,
@@ -1481,6 +2082,236 @@ echo "🎉 Clean all completed!"
     pub fn reset_log_scroll(&mut self) {
         self.log_scroll_offset = 0;
         self.log_auto_scroll = true;
+        self.editor_line = None;
+        if let Some(search) = self.log_search.as_mut() {
+            search.current = None;
+        }
+    }
+
+    /// Search the selected board's log for the regex typed, moving to the
+    /// first match; an empty regex ends the search
+    pub fn submit_log_search_input(&mut self) -> Result<()> {
+        let Some(input) = self.log_search_input.take() else {
+            return Ok(());
+        };
+        if input.is_empty() {
+            self.log_search = None;
+            return Ok(());
+        }
+        self.log_search = Some(LogSearch::new(&input)?);
+        self.move_to_log_match(true);
+        Ok(())
+    }
+
+    /// Scroll the log to the next match of the search, or the previous one
+    pub fn move_to_log_match(&mut self, forward: bool) {
+        let (Some(search), Some(board)) = (
+            self.log_search.as_mut(),
+            self.boards.get(self.selected_board),
+        ) else {
+            return;
+        };
+        let line = if forward {
+            search.next(&board.log_lines)
+        } else {
+            search.previous(&board.log_lines)
+        };
+        if let Some(line) = line {
+            // A few lines of context above the match
+            self.log_scroll_offset = line.saturating_sub(3);
+            self.log_auto_scroll = false;
+        }
+    }
+
+    /// Source location to open in the editor: the current search match's if
+    /// it is a compiler diagnostic, else the diagnostic after the one opened
+    /// last, wrapping around; the log scrolls to it
+    pub fn next_source_location(&mut self) -> Option<SourceLocation> {
+        let board = self.boards.get(self.selected_board)?;
+        let project_dir = match &board.workspace {
+            Some(member) => member.project_dir.clone(),
+            None => self.project_dir.clone(),
+        };
+        let lines = &board.log_lines;
+        let searched = self
+            .log_search
+            .as_ref()
+            .and_then(|search| search.current)
+            .filter(|&line| Some(line) != self.editor_line)
+            .filter(|&line| {
+                lines
+                    .get(line)
+                    .and_then(|l| diagnostic_location(l))
+                    .is_some()
+            });
+        let start = self.editor_line.map_or(0, |line| line + 1);
+        let line = searched.or_else(|| {
+            (start..lines.len())
+                .chain(0..start.min(lines.len()))
+                .find(|&index| diagnostic_location(&lines[index]).is_some())
+        })?;
+        let location = SourceLocation::parse(
+            &diagnostic_location(&lines[line])?,
+            &board.build_dir,
+            &project_dir,
+        )?;
+
+        self.editor_line = Some(line);
+        self.log_scroll_offset = line.saturating_sub(3);
+        self.log_auto_scroll = false;
+        Some(location)
+    }
+
+    /// Open the next source location of the selected board's log in
+    /// `$VISUAL` or `$EDITOR`; a terminal editor takes over the terminal, so
+    /// the TUI must be suspended
+    pub fn open_in_editor(&mut self) -> Result<()> {
+        let editor = configured_editor()
+            .ok_or_else(|| anyhow::anyhow!("Set $VISUAL or $EDITOR to open source locations"))?;
+        let location = self
+            .next_source_location()
+            .ok_or_else(|| anyhow::anyhow!("No compiler diagnostics in the log to open"))?;
+        let planned = editor_command(&editor, &location, &self.project_dir);
+        let status = std::process::Command::new(&planned.program)
+            .args(&planned.args)
+            .current_dir(&planned.working_dir)
+            .status()
+            .map_err(|e| anyhow::anyhow!("Failed to start {}: {}", planned.program, e))?;
+        if !status.success() {
+            return Err(anyhow::anyhow!(
+                "{} exited with {} opening {}",
+                planned.program,
+                status,
+                location.display()
+            ));
+        }
+        Ok(())
+    }
+
+    /// Log of the board, hidden by the tag filter or not
+    pub fn board_log(&self, name: &str) -> Option<&[String]> {
+        self.boards
+            .iter()
+            .chain(self.hidden_boards.iter().map(|(_, b)| b))
+            .find(|b| b.name == name)
+            .map(|b| b.log_lines.as_slice())
+    }
+
+    /// First use marks the board; the next use on another board shows both
+    /// logs side by side, the marked one on the left. With two boards there
+    /// is nothing to pick, they are compared right away.
+    pub fn compare_logs(&mut self, board_index: usize) {
+        let Some(board) = self.boards.get(board_index) else {
+            return;
+        };
+        let board_name = board.name.clone();
+        let other = match self.log_compare_base.take() {
+            Some(base) if base != board_name && self.board_log(&base).is_some() => Some(base),
+            // Using it on the marked board again drops the mark
+            Some(_) => return,
+            None if self.boards.len() == 2 => Some(self.boards[1 - board_index].name.clone()),
+            None => None,
+        };
+        match other {
+            Some(left) => self.open_log_comparison(&left, &board_name),
+            None => self.log_compare_base = Some(board_name),
+        }
+    }
+
+    pub fn open_log_comparison(&mut self, left: &str, right: &str) {
+        self.log_comparison = Some(LogComparison {
+            left: left.to_string(),
+            right: right.to_string(),
+            rows: Vec::new(),
+            lengths: (0, 0),
+            scroll: 0,
+            differences_only: false,
+        });
+        self.refresh_log_comparison();
+        // Starting at the first difference
+        if let Some(comparison) = &mut self.log_comparison {
+            comparison.scroll = differing_rows(&comparison.rows)
+                .first()
+                .copied()
+                .unwrap_or(0);
+        }
+    }
+
+    /// Align the compared logs again when they grew, e.g. while building
+    pub fn refresh_log_comparison(&mut self) {
+        let Some(comparison) = &self.log_comparison else {
+            return;
+        };
+        let (Some(left), Some(right)) = (
+            self.board_log(&comparison.left),
+            self.board_log(&comparison.right),
+        ) else {
+            self.log_comparison = None;
+            return;
+        };
+        let lengths = (left.len(), right.len());
+        if comparison.lengths == lengths && !comparison.rows.is_empty() {
+            return;
+        }
+        let boards: Vec<&str> = self
+            .boards
+            .iter()
+            .chain(self.hidden_boards.iter().map(|(_, b)| b))
+            .flat_map(|b| {
+                [
+                    b.name.as_str(),
+                    b.workspace.as_ref().map_or("", |m| m.board_name.as_str()),
+                ]
+            })
+            .collect();
+        let rows = diff_logs(left, right, &boards);
+        if let Some(comparison) = &mut self.log_comparison {
+            comparison.rows = rows;
+            comparison.lengths = lengths;
+        }
+    }
+
+    /// Scroll both sides of the comparison together
+    pub fn scroll_log_comparison(&mut self, delta: isize) {
+        if let Some(comparison) = &mut self.log_comparison {
+            let last = comparison.visible_rows().len().saturating_sub(1);
+            comparison.scroll = comparison.scroll.saturating_add_signed(delta).min(last);
+        }
+    }
+
+    /// Scroll the comparison to the next difference, or the previous one
+    pub fn move_to_difference(&mut self, forward: bool) {
+        let Some(comparison) = &mut self.log_comparison else {
+            return;
+        };
+        let differences = differing_rows(&comparison.visible_rows());
+        // The difference shown at the top is the current one
+        let target = if forward {
+            differences.iter().find(|row| **row > comparison.scroll)
+        } else {
+            differences
+                .iter()
+                .rev()
+                .find(|row| **row < comparison.scroll)
+        };
+        if let Some(row) = target {
+            comparison.scroll = *row;
+        }
+    }
+
+    /// Show only the differing rows, or all rows again
+    pub fn toggle_comparison_differences(&mut self) {
+        if let Some(comparison) = &mut self.log_comparison {
+            comparison.differences_only = !comparison.differences_only;
+            comparison.scroll = 0;
+        }
+    }
+
+    /// Put the right board's log on the left
+    pub fn swap_log_comparison(&mut self) {
+        if let Some(comparison) = self.log_comparison.take() {
+            self.open_log_comparison(&comparison.right, &comparison.left);
+        }
     }
 
     // Component navigation
@@ -1529,7 +2360,12 @@ echo "🎉 Clean all completed!"
 
     // Board and log management
     pub fn add_log_line(&mut self, board_name: &str, line: String) {
-        if let Some(board) = self.boards.iter_mut().find(|b| b.name == board_name) {
+        if let Some(board) = self
+            .boards
+            .iter_mut()
+            .chain(self.hidden_boards.iter_mut().map(|(_, b)| b))
+            .find(|b| b.name == board_name)
+        {
             board.log_lines.push(line);
             board.last_updated = chrono::Local::now();
 
@@ -1541,52 +2377,558 @@ echo "🎉 Clean all completed!"
         }
     }
 
-    pub fn update_board_status(&mut self, board_name: &str, status: BuildStatus) {
-        if let Some(board) = self.boards.iter_mut().find(|b| b.name == board_name) {
-            board.status = status;
-            board.last_updated = chrono::Local::now();
+    /// Show only boards matching the filter; `None` shows every board again
+    pub fn apply_tag_filter(&mut self, filter: Option<TagFilter>) {
+        self.tag_filter = filter.filter(|f| !f.is_empty());
+        self.filter_boards();
+
+        self.selected_board = 0;
+        self.list_state.select(if self.boards.is_empty() {
+            None
+        } else {
+            Some(0)
+        });
+        self.reset_log_scroll();
+    }
+
+    /// Whether the board passes the tag filter and the list filter
+    fn is_listed(&self, board: &BoardConfig, queued: &[String]) -> bool {
+        self.tag_filter
+            .as_ref()
+            .is_none_or(|f| f.matches(&board.tags))
+            && self
+                .list_filter
+                .as_ref()
+                .is_none_or(|f| f.matches(board, queued.contains(&board.name)))
+    }
+
+    /// Split the boards into the listed ones and those hidden by the filters
+    fn filter_boards(&mut self) {
+        let mut all = std::mem::take(&mut self.boards);
+        let mut hidden = std::mem::take(&mut self.hidden_boards);
+        hidden.sort_by_key(|(index, _)| *index);
+        for (index, board) in hidden {
+            let index = index.min(all.len());
+            all.insert(index, board);
+        }
+
+        let queued = self.build_scheduler.queued();
+        for (index, board) in all.into_iter().enumerate() {
+            if self.is_listed(&board, &queued) {
+                self.boards.push(board);
+            } else {
+                self.hidden_boards.push((index, board));
+            }
         }
     }
 
-    /// Execute a board action asynchronously
-    pub async fn execute_action(
-        &mut self,
-        action: BoardAction,
-        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
-    ) -> Result<()> {
-        // Handle Flash, RemoteFlash and RemoteMonitor specially
-        if action == BoardAction::Flash {
-            // Flash action should show local board selection dialog
-            self.start_local_board_scan_for_flash(tx.clone());
-            return Ok(());
+    /// Show only failed, building or named boards; `None` shows the boards of
+    /// the tag filter again. The selected board stays selected if it is
+    /// still listed.
+    pub fn apply_list_filter(&mut self, filter: Option<BoardListFilter>) {
+        let selected = self.boards.get(self.selected_board).map(|b| b.name.clone());
+        self.list_filter = filter.filter(|f| *f != BoardListFilter::Name(String::new()));
+        self.filter_boards();
+
+        let index = selected
+            .and_then(|name| self.boards.iter().position(|b| b.name == name))
+            .unwrap_or(0);
+        if index != self.selected_board || selected.is_none() {
+            self.reset_log_scroll();
         }
-        if action == BoardAction::RemoteFlash {
-            self.start_fetching_remote_boards(tx);
-            return Ok(());
+        self.selected_board = index;
+        self.list_state
+            .select((!self.boards.is_empty()).then_some(index));
+    }
+
+    /// Apply the name being typed as the list filter
+    pub fn update_list_filter_input(&mut self) {
+        if let Some(input) = &self.list_filter_input {
+            let filter = BoardListFilter::Name(input.clone());
+            self.apply_list_filter(Some(filter));
         }
-        if action == BoardAction::RemoteMonitor {
-            self.remote_action_type = crate::models::server::RemoteActionType::Monitor;
-            self.start_fetching_remote_boards(tx);
-            return Ok(());
+    }
+
+    /// Boards come and go from a failed or building list as their builds
+    /// start and end
+    pub fn refresh_list_filter(&mut self) {
+        if !matches!(
+            self.list_filter,
+            Some(BoardListFilter::Failed | BoardListFilter::Building)
+        ) {
+            return;
+        }
+        let queued = self.build_scheduler.queued();
+        let changed = self.boards.iter().any(|b| !self.is_listed(b, &queued))
+            || self
+                .hidden_boards
+                .iter()
+                .any(|(_, b)| self.is_listed(b, &queued));
+        if changed {
+            self.apply_list_filter(self.list_filter.clone());
         }
+    }
 
-        if self.selected_board >= self.boards.len() {
-            return Err(anyhow::anyhow!("No board selected"));
+    /// Selection, split and filters as the state file keeps them
+    pub fn current_state(&self) -> TuiState {
+        TuiState {
+            selected_board: self.boards.get(self.selected_board).map(|b| b.name.clone()),
+            selected_component: self
+                .components
+                .get(self.selected_component)
+                .map(|c| c.name.clone()),
+            focused_pane: self.focused_pane,
+            board_list_percent: self.board_list_percent,
+            tag_filter: self.tag_filter.as_ref().map(|f| f.to_string()),
+            list_filter: self.list_filter.clone(),
         }
+    }
 
-        let board_index = self.selected_board;
-        let board = &self.boards[board_index];
-        let board_name = board.name.clone();
-        let config_file = board.config_file.clone();
-        let build_dir = board.build_dir.clone();
-        let project_dir = self.project_dir.clone();
-        let logs_dir = self.logs_dir.clone();
+    /// Save the state once it changed since it was last saved or restored
+    pub fn persist_state(&mut self) {
+        let state = self.current_state();
+        if self.saved_state.as_ref() == Some(&state) {
+            return;
+        }
+        if let Err(e) = state.save(&self.project_dir) {
+            log::warn!("⚠️  Failed to save the TUI state: {}", e);
+        }
+        self.saved_state = Some(state);
+    }
 
-        // Update status immediately
-        self.boards[board_index].status = match action {
-            BoardAction::Build => BuildStatus::Building,
-            BoardAction::Flash => BuildStatus::Flashing,
+    /// Go back to where the last session in the project was left
+    pub fn restore_state(&mut self) {
+        let state = match TuiState::load(&self.project_dir) {
+            Ok(Some(state)) => state,
+            Ok(None) => return,
+            Err(e) => {
+                log::warn!("⚠️  Ignoring the last TUI state: {:#}", e);
+                return;
+            }
+        };
+
+        match state.tag_filter.as_deref().map(TagFilter::parse) {
+            Some(Ok(filter)) => self.apply_tag_filter(Some(filter)),
+            Some(Err(e)) => log::warn!("⚠️  Ignoring the last tag filter: {}", e),
+            None => {}
+        }
+        if state.list_filter.is_some() {
+            self.apply_list_filter(state.list_filter.clone());
+        }
+        if let Some(index) = state
+            .selected_board
+            .as_ref()
+            .and_then(|name| self.boards.iter().position(|b| &b.name == name))
+        {
+            self.select_board(index);
+        }
+        if let Some(index) = state
+            .selected_component
+            .as_ref()
+            .and_then(|name| self.components.iter().position(|c| &c.name == name))
+        {
+            self.selected_component = index;
+            self.component_list_state.select(Some(index));
+        }
+        if state.focused_pane != FocusedPane::ComponentList || !self.components.is_empty() {
+            self.focused_pane = state.focused_pane;
+        }
+        self.board_list_percent = state
+            .board_list_percent
+            .clamp(MIN_BOARD_LIST_PERCENT, MAX_BOARD_LIST_PERCENT);
+        self.saved_state = Some(state);
+    }
+
+    /// Rebuild the listed boards whose builds failed
+    pub async fn rerun_failed_boards(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<usize> {
+        let indices: Vec<usize> = self
+            .boards
+            .iter()
+            .enumerate()
+            .filter(|(_, b)| matches!(b.status, BuildStatus::Failed))
+            .map(|(i, _)| i)
+            .collect();
+        if indices.is_empty() {
+            return Err(anyhow::anyhow!("No failed board in the list"));
+        }
+        let count = indices.len();
+        self.build_board_group(indices, "the re-run of the failed boards", tx)
+            .await?;
+        Ok(count)
+    }
+
+    /// Parse and apply the tag filter being edited
+    pub fn submit_tag_filter_input(&mut self) -> Result<()> {
+        let Some(input) = self.tag_filter_input.take() else {
+            return Ok(());
+        };
+        let filter = TagFilter::parse(&input)?;
+        self.apply_tag_filter(Some(filter));
+        Ok(())
+    }
+
+    /// Replace a board's log with its effective sdkconfig and the fragment each option comes from
+    pub fn show_effective_config(&mut self, board_index: usize) {
+        use crate::config::sdkconfig_fragments::{
+            apply_overrides, effective_options, fragment_chain,
+        };
+        use crate::projects::handlers::esp_idf::EspIdfHandler;
+
+        let Some(board) = self.boards.get_mut(board_index) else {
+            return;
+        };
+        board.reset_log(Vec::new());
+
+        // Board metadata and the build profile from espbrew.yaml are applied on top of the fragments
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board.name.clone()),
+        };
+        let board_config = ProjectBoardConfig {
+            name: handler_board_name,
+            config_file: board.config_file.clone(),
+            build_dir: board.build_dir.clone(),
+            target: board.target.clone(),
+            project_type: board.project_type.clone(),
+        };
+
+        let file_name = |path: &std::path::Path| {
+            path.file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_else(|| path.display().to_string())
+        };
+
+        match fragment_chain(&board.config_file)
+            .and_then(|chain| Ok((chain, effective_options(&board.config_file)?)))
+            .and_then(|(chain, options)| {
+                let overrides = EspIdfHandler::board_overrides(&project_dir, &board_config)?;
+                Ok((chain, options, overrides))
+            }) {
+            Ok((chain, mut options, overrides)) => {
+                apply_overrides(&mut options, &overrides);
+                board.log_lines.push(format!(
+                    "⚙️  Effective config of {}: {}",
+                    board.name,
+                    chain
+                        .iter()
+                        .map(|f| file_name(f.as_path()))
+                        .collect::<Vec<_>>()
+                        .join(" → ")
+                ));
+                for option in &options {
+                    board.log_lines.push(format!(
+                        "{}  # {}",
+                        option.to_line(),
+                        file_name(option.source.as_path())
+                    ));
+                }
+                board
+                    .log_lines
+                    .push(format!("📋 {} option(s)", options.len()));
+            }
+            Err(e) => board
+                .log_lines
+                .push(format!("❌ Failed to resolve config: {:#}", e)),
+        }
+
+        board.last_updated = Local::now();
+        self.reset_log_scroll();
+    }
+
+    /// Write a board's custom partition table and its validation to the board's log
+    pub fn show_partition_table(&mut self, board_index: usize) {
+        use crate::projects::handlers::esp_idf::EspIdfHandler;
+
+        let Some(board) = self.boards.get_mut(board_index) else {
+            return;
+        };
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board.name.clone()),
+        };
+        let board_config = ProjectBoardConfig {
+            name: handler_board_name,
+            config_file: board.config_file.clone(),
+            build_dir: board.build_dir.clone(),
+            target: board.target.clone(),
+            project_type: board.project_type.clone(),
+        };
+
+        let lines = match EspIdfHandler::partition_layout(&project_dir, &board_config) {
+            Ok(Some(layout)) => layout.report_lines(),
+            Ok(None) => vec![format!(
+                "ℹ️ {} uses a built-in ESP-IDF partition table; set partitions: in espbrew.yaml for a custom one",
+                board.name
+            )],
+            Err(e) => vec![format!("❌ Failed to load partition table: {:#}", e)],
+        };
+        board.reset_log(lines);
+        board.last_updated = Local::now();
+        self.reset_log_scroll();
+    }
+
+    /// First use marks the diff base; the next use on another board writes the
+    /// differences between both effective configs to that board's log
+    pub fn diff_config(&mut self, board_index: usize) {
+        use crate::config::sdkconfig_diff::diff_board_configs;
+
+        let Some(board) = self.boards.get(board_index) else {
+            return;
+        };
+        let board_name = board.name.clone();
+        let config_file = board.config_file.clone();
+
+        let base = self.config_diff_base.take().and_then(|base| {
+            self.boards
+                .iter()
+                .chain(self.hidden_boards.iter().map(|(_, b)| b))
+                .find(|b| b.name == base && b.name != board_name)
+                .map(|b| (b.name.clone(), b.config_file.clone()))
+        });
+
+        let lines = match base {
+            None => {
+                self.config_diff_base = Some(board_name.clone());
+                vec![format!(
+                    "📌 {} marked as diff base, select another board and run Diff Config again",
+                    board_name
+                )]
+            }
+            Some((base_name, base_config)) => {
+                match diff_board_configs(&base_config, &config_file) {
+                    Ok(diff) => diff.report_lines(&base_name, &board_name),
+                    Err(e) => vec![format!("❌ Failed to compare configs: {:#}", e)],
+                }
+            }
+        };
+
+        let board = &mut self.boards[board_index];
+        board.reset_log(lines);
+        board.last_updated = Local::now();
+        self.reset_log_scroll();
+    }
+
+    /// Run `idf.py menuconfig` for a board and save the options changed in it
+    /// to the board's defaults fragment.
+    ///
+    /// menuconfig takes over the terminal, so the TUI must be suspended.
+    pub fn run_menuconfig(&mut self, board_index: usize) -> Result<()> {
+        use crate::config::is_cmake_presets_file;
+        use crate::config::sdkconfig_fragments::{changed_options, read_options, update_fragment};
+        use crate::projects::component_harness;
+        use crate::projects::handlers::esp_idf::EspIdfHandler;
+        use anyhow::Context;
+
+        let board = self
+            .boards
+            .get(board_index)
+            .ok_or_else(|| anyhow::anyhow!("No board selected"))?;
+        if board.project_type != ProjectType::EspIdf {
+            return Err(anyhow::anyhow!(
+                "menuconfig is only available for ESP-IDF boards"
+            ));
+        }
+
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board.name.clone()),
+        };
+        let board_config = ProjectBoardConfig {
+            name: handler_board_name,
+            config_file: board.config_file.clone(),
+            build_dir: board.build_dir.clone(),
+            target: board.target.clone(),
+            project_type: ProjectType::EspIdf,
+        };
+        if is_cmake_presets_file(&board_config.config_file)
+            || component_harness::board_harness_dir(&project_dir, &board_config).is_some()
+        {
+            return Err(anyhow::anyhow!(
+                "menuconfig needs a board with its own sdkconfig defaults file"
+            ));
+        }
+
+        let handler = EspIdfHandler;
+        let sdkconfig = board_config.build_dir.join("sdkconfig");
+        // The baseline to compare against has to exist before menuconfig starts
+        if !sdkconfig.exists() {
+            let status = handler
+                .interactive_idf_command(&project_dir, &board_config, &["reconfigure"])?
+                .status()
+                .context("Failed to start idf.py reconfigure")?;
+            if !status.success() {
+                return Err(anyhow::anyhow!("idf.py reconfigure failed"));
+            }
+        }
+
+        let before = read_options(&sdkconfig)?;
+        let status = handler
+            .interactive_idf_command(&project_dir, &board_config, &["menuconfig"])?
+            .status()
+            .context("Failed to start idf.py menuconfig")?;
+        if !status.success() {
+            return Err(anyhow::anyhow!("idf.py menuconfig failed"));
+        }
+        let changed = changed_options(&before, &read_options(&sdkconfig)?);
+
+        let board = &mut self.boards[board_index];
+        board.reset_log(Vec::new());
+        if changed.is_empty() {
+            board
+                .log_lines
+                .push("ℹ️ menuconfig closed without changes".to_string());
+        } else {
+            update_fragment(&board.config_file, &changed)?;
+            board.log_lines.push(format!(
+                "💾 Saved {} changed option(s) to {}",
+                changed.len(),
+                board.config_file.display()
+            ));
+            for option in &changed {
+                board.log_lines.push(format!("  {}", option.to_line()));
+            }
+        }
+        board.last_updated = Local::now();
+        self.reset_log_scroll();
+
+        Ok(())
+    }
+
+    pub fn update_board_status(&mut self, board_name: &str, status: BuildStatus) {
+        if let Some(board) = self
+            .boards
+            .iter_mut()
+            .chain(self.hidden_boards.iter_mut().map(|(_, b)| b))
+            .find(|b| b.name == board_name)
+        {
+            board.status = status;
+            board.last_updated = chrono::Local::now();
+        }
+    }
+
+    /// Debug the board's device with OpenOCD and GDB, which takes over the
+    /// terminal, so the TUI must be suspended
+    pub fn run_debug_session(&mut self, board_index: usize) -> Result<()> {
+        use crate::projects::debug_session::{debug_target, run_debug_session};
+
+        let board = self
+            .boards
+            .get(board_index)
+            .ok_or_else(|| anyhow::anyhow!("No board selected"))?;
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board.name.clone()),
+        };
+        let board_config = ProjectBoardConfig {
+            name: handler_board_name,
+            config_file: board.config_file.clone(),
+            build_dir: board.build_dir.clone(),
+            target: board.target.clone(),
+            project_type: board.project_type.clone(),
+        };
+        let target = debug_target(&project_dir, &board_config)?;
+        let log_file = self.logs_dir.join(format!("{}-openocd.log", board.name));
+        run_debug_session(&target, &log_file)?;
+
+        let board = &mut self.boards[board_index];
+        board.log_lines.push(format!(
+            "🐞 Debug session of {} on the {} ended, OpenOCD's log is in {}",
+            target.elf.display(),
+            target.chip,
+            log_file.display()
+        ));
+        board.last_updated = Local::now();
+        Ok(())
+    }
+
+    /// Execute a board action asynchronously
+    pub async fn execute_action(
+        &mut self,
+        action: BoardAction,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        if self.replay.is_some() {
+            return Err(anyhow::anyhow!(
+                "Nothing runs while a recording is replayed"
+            ));
+        }
+        // Handle Flash, RemoteFlash and RemoteMonitor specially
+        if action == BoardAction::Flash {
+            // Flash action should show local board selection dialog
+            self.start_local_board_scan_for_flash(tx.clone());
+            return Ok(());
+        }
+        if action == BoardAction::RemoteFlash {
+            self.start_fetching_remote_boards(tx);
+            return Ok(());
+        }
+        if action == BoardAction::RemoteMonitor {
+            self.remote_action_type = crate::models::server::RemoteActionType::Monitor;
+            self.start_fetching_remote_boards(tx);
+            return Ok(());
+        }
+
+        if self.selected_board >= self.boards.len() {
+            return Err(anyhow::anyhow!("No board selected"));
+        }
+
+        // Nothing to run, the merged config goes straight to the board's log
+        if action == BoardAction::EffectiveConfig {
+            self.show_effective_config(self.selected_board);
+            return Ok(());
+        }
+        if action == BoardAction::DiffConfig {
+            self.diff_config(self.selected_board);
+            return Ok(());
+        }
+        if action == BoardAction::CompareLogs {
+            self.compare_logs(self.selected_board);
+            return Ok(());
+        }
+        if action == BoardAction::PartitionTable {
+            self.show_partition_table(self.selected_board);
+            return Ok(());
+        }
+        // Without a monitor template the board's device opens in a serial monitor pane
+        if action == BoardAction::Monitor && self.monitors_in_pane(self.selected_board) {
+            self.monitor_board(self.selected_board, tx);
+            return Ok(());
+        }
+
+        let board_index = self.selected_board;
+        let board = &self.boards[board_index];
+        let board_name = board.name.clone();
+        let config_file = board.config_file.clone();
+        let build_dir = board.build_dir.clone();
+        let target = board.target.clone();
+        let workspace = board.workspace.clone();
+        let project_board_type = board.project_type.clone();
+        let (project_dir, handler_board_name) = match workspace {
+            Some(ref member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board_name.clone()),
+        };
+        let logs_dir = self.logs_dir.clone();
+        // Config files of the project's boards, for the build's input hash
+        let other_configs: Vec<std::path::PathBuf> = self
+            .boards
+            .iter()
+            .filter(|other| {
+                other.workspace.as_ref().map(|m| &m.project_dir)
+                    == workspace.as_ref().map(|m| &m.project_dir)
+            })
+            .map(|other| other.config_file.clone())
+            .collect();
+
+        // Update status immediately
+        self.boards[board_index].status = match action {
+            BoardAction::Build => BuildStatus::Building,
+            BoardAction::Flash => BuildStatus::Flashing,
             BoardAction::FlashAppOnly => BuildStatus::Flashing,
+            BoardAction::Deploy => BuildStatus::Flashing,
+            BoardAction::EraseFlash | BoardAction::EraseNvs => BuildStatus::Flashing,
             BoardAction::GenerateBinary => BuildStatus::Building,
             BoardAction::Monitor => BuildStatus::Monitoring,
             _ => BuildStatus::Building, // For clean/purge operations
@@ -1594,84 +2936,102 @@ echo "🎉 Clean all completed!"
         self.boards[board_index].last_updated = Local::now();
 
         // Clear previous logs for this board
-        self.boards[board_index].log_lines.clear();
+        self.boards[board_index].reset_log(Vec::new());
         self.reset_log_scroll();
 
-        let tx_clone = tx.clone();
         let action_name = action.name().to_string();
-        let project_handler = self.project_handler.as_ref().map(|h| {
-            // Clone the handler for use in async context
-            match h.project_type() {
-                crate::projects::ProjectType::RustNoStd => {
-                    Box::new(crate::projects::handlers::rust_nostd::RustNoStdHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Arduino => {
-                    Box::new(crate::projects::handlers::arduino::ArduinoHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::PlatformIO => {
-                    Box::new(crate::projects::handlers::platformio::PlatformIOHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::MicroPython => {
-                    Box::new(crate::projects::handlers::micropython::MicroPythonHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::CircuitPython => {
-                    Box::new(crate::projects::handlers::circuitpython::CircuitPythonHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Zephyr => {
-                    Box::new(crate::projects::handlers::zephyr::ZephyrHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::NuttX => {
-                    Box::new(crate::projects::handlers::nuttx::NuttXHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::TinyGo => {
-                    Box::new(crate::projects::handlers::tinygo::TinyGoHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::Jaculus => {
-                    Box::new(crate::projects::handlers::jaculus::JaculusHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
-                crate::projects::ProjectType::EspIdf => {
-                    Box::new(crate::projects::handlers::esp_idf::EspIdfHandler)
-                        as Box<dyn crate::projects::ProjectHandler>
-                }
+        // Clone the handler for use in async context; workspace boards get
+        // a handler for their own project type
+        let project_handler = if workspace.is_some() {
+            Some(ProjectRegistry::create_handler(project_board_type.clone()))
+        } else {
+            self.project_handler
+                .as_ref()
+                .map(|h| ProjectRegistry::create_handler(h.project_type()))
+        };
+        let tx_clone = Self::relay_board_events(&board_name, &handler_board_name, tx.clone());
+        let build_scheduler = self.build_scheduler.clone();
+        let agent_pool = self.agent_pool.clone();
+        let running_board = board_name.clone();
+        let running_action = action.clone();
+        let job = BoardJob::new();
+        // The panes reading the board's device release its port
+        let settle = matches!(
+            action,
+            BoardAction::FlashAppOnly
+                | BoardAction::Deploy
+                | BoardAction::EraseFlash
+                | BoardAction::EraseNvs
+                | BoardAction::Monitor
+        ) && self.suspend_board_monitors(&board_name);
+
+        // Spawn the action execution task; the processes it starts belong to
+        // the board's job, so it can be cancelled on its own
+        let task = tokio::spawn(job.clone().scope(async move {
+            if settle {
+                tokio::time::sleep(PORT_RELEASE_DELAY).await;
             }
-        });
-
-        // Spawn the action execution task
-        tokio::spawn(async move {
             let log_file = logs_dir.join(format!("{}.log", board_name));
             let result = match action {
                 BoardAction::Build => {
-                    if let Some(handler) = project_handler.as_ref() {
-                        Self::build_board_with_handler(
-                            handler.as_ref(),
-                            &board_name,
+                    let slot_board = ProjectBoardConfig {
+                        name: handler_board_name.clone(),
+                        config_file: config_file.clone(),
+                        build_dir: build_dir.clone(),
+                        target: target.clone(),
+                        project_type: project_handler
+                            .as_ref()
+                            .map(|h| h.project_type())
+                            .unwrap_or(ProjectType::EspIdf),
+                    };
+                    if let Some(pool) = agent_pool.as_ref() {
+                        if pool.is_saturated() {
+                            let _ = tx_clone.send(crate::models::AppEvent::BuildOutput(
+                                handler_board_name.clone(),
+                                "⏳ Waiting for an idle build agent".to_string(),
+                            ));
+                        }
+                        let lease = pool.acquire().await;
+                        build_board_on_agent(
+                            lease.agent(),
                             &project_dir,
-                            &config_file,
-                            &build_dir,
-                            &log_file,
+                            &slot_board,
+                            false,
                             tx_clone.clone(),
                         )
                         .await
+                        .map(|_| ())
                     } else {
-                        // Fallback to ESP-IDF if no project handler
-                        Self::build_board_esp_idf(
-                            &board_name,
+                        let _slot = Self::acquire_build_slot(
+                            &build_scheduler,
                             &project_dir,
-                            &config_file,
-                            &build_dir,
-                            &log_file,
-                            tx_clone.clone(),
+                            &board_name,
+                            &slot_board,
+                            &tx_clone,
                         )
-                        .await
+                        .await;
+
+                        if let Some(handler) = project_handler.as_ref() {
+                            Self::build_board_with_handler(
+                                handler.as_ref(),
+                                &project_dir,
+                                &slot_board,
+                                &other_configs,
+                                tx_clone.clone(),
+                            )
+                            .await
+                        } else {
+                            // Fallback to ESP-IDF if no project handler
+                            Self::build_board_esp_idf(
+                                &handler_board_name,
+                                &project_dir,
+                                &config_file,
+                                &build_dir,
+                                &log_file,
+                                tx_clone.clone(),
+                            )
+                            .await
+                        }
                     }
                 }
                 BoardAction::Flash => {
@@ -1685,7 +3045,7 @@ echo "🎉 Clean all completed!"
                     if let Some(handler) = project_handler.as_ref() {
                         Self::clean_board_with_handler(
                             handler.as_ref(),
-                            &board_name,
+                            &handler_board_name,
                             &project_dir,
                             &config_file,
                             &build_dir,
@@ -1694,7 +3054,7 @@ echo "🎉 Clean all completed!"
                         .await
                     } else {
                         Self::clean_board_esp_idf(
-                            &board_name,
+                            &handler_board_name,
                             &project_dir,
                             &build_dir,
                             &log_file,
@@ -1704,8 +3064,54 @@ echo "🎉 Clean all completed!"
                     }
                 }
                 BoardAction::Monitor => {
-                    Self::monitor_board_esp_idf(
-                        &board_name,
+                    let monitor_board = ProjectBoardConfig {
+                        name: handler_board_name.clone(),
+                        config_file: config_file.clone(),
+                        build_dir: build_dir.clone(),
+                        target: target.clone(),
+                        project_type: project_handler
+                            .as_ref()
+                            .map(|h| h.project_type())
+                            .unwrap_or(ProjectType::EspIdf),
+                    };
+                    match command_template(&project_dir, &monitor_board, TemplateStep::Monitor) {
+                        Ok(Some(template)) => {
+                            async {
+                                let command = expand_template(
+                                    &template,
+                                    &project_dir,
+                                    &monitor_board,
+                                    None,
+                                    Some(115200),
+                                )?;
+                                run_template(
+                                    TemplateStep::Monitor,
+                                    &command,
+                                    &project_dir,
+                                    &monitor_board,
+                                    None,
+                                    &tx_clone,
+                                )
+                                .await
+                            }
+                            .await
+                        }
+                        Ok(None) => {
+                            Self::monitor_board_esp_idf(
+                                &handler_board_name,
+                                &project_dir,
+                                &build_dir,
+                                &log_file,
+                                tx_clone.clone(),
+                            )
+                            .await
+                        }
+                        Err(e) => Err(e),
+                    }
+                }
+                BoardAction::FlashAppOnly => {
+                    Self::flash_app_only_esp_idf(
+                        &handler_board_name,
                         &project_dir,
                         &build_dir,
                         &log_file,
@@ -1713,30 +3119,74 @@ echo "🎉 Clean all completed!"
                     )
                     .await
                 }
-                BoardAction::FlashAppOnly => {
-                    Self::flash_app_only_esp_idf(
-                        &board_name,
-                        &project_dir,
+                BoardAction::Purge => {
+                    Self::purge_board_esp_idf(
+                        &handler_board_name,
                         &build_dir,
                         &log_file,
                         tx_clone.clone(),
                     )
                     .await
                 }
-                BoardAction::Purge => {
-                    Self::purge_board_esp_idf(&board_name, &build_dir, &log_file, tx_clone.clone())
-                        .await
-                }
                 BoardAction::GenerateBinary => {
-                    Self::generate_binary_esp_idf(
-                        &board_name,
+                    let merged_board = ProjectBoardConfig {
+                        name: handler_board_name.clone(),
+                        config_file: config_file.clone(),
+                        build_dir: build_dir.clone(),
+                        target: target.clone(),
+                        project_type: project_handler
+                            .as_ref()
+                            .map(|h| h.project_type())
+                            .unwrap_or(ProjectType::EspIdf),
+                    };
+                    crate::projects::merged_binary::write_merged_binary(
                         &project_dir,
+                        &merged_board,
+                        &tx_clone,
+                    )
+                    .await
+                    .map(|_| ())
+                }
+                BoardAction::Deploy => {
+                    Self::deploy_board_micropython(
+                        &handler_board_name,
+                        &project_dir,
+                        &config_file,
                         &build_dir,
-                        &log_file,
+                        target,
                         tx_clone.clone(),
                     )
                     .await
                 }
+                BoardAction::EraseFlash | BoardAction::EraseNvs => {
+                    let erase_board = ProjectBoardConfig {
+                        name: handler_board_name.clone(),
+                        config_file: config_file.clone(),
+                        build_dir: build_dir.clone(),
+                        target: target.clone(),
+                        project_type: project_handler
+                            .as_ref()
+                            .map(|h| h.project_type())
+                            .unwrap_or(ProjectType::EspIdf),
+                    };
+                    async {
+                        let erase_target = if action == BoardAction::EraseNvs {
+                            let partitions = erase::board_partitions(&project_dir, &erase_board)?;
+                            erase::resolve_region(&partitions, "nvs")?
+                        } else {
+                            erase::EraseTarget::All
+                        };
+                        erase::erase_board(
+                            &project_dir,
+                            &erase_board,
+                            None,
+                            &erase_target,
+                            &tx_clone,
+                        )
+                        .await
+                    }
+                    .await
+                }
                 _ => {
                     let _ = tx_clone.send(crate::models::AppEvent::BuildOutput(
                         board_name.clone(),
@@ -1752,38 +3202,205 @@ echo "🎉 Clean all completed!"
                 action_name,
                 result.is_ok(),
             ));
-        });
+        }));
+
+        self.running_actions.insert(
+            running_board,
+            RunningAction {
+                action: running_action,
+                job,
+                task,
+            },
+        );
 
         Ok(())
     }
 
-    /// Build board using project handler
+    /// Whether the board's Monitor action opens a pane rather than running
+    /// its `monitor` command template
+    fn monitors_in_pane(&self, board_index: usize) -> bool {
+        let Some(board) = self.boards.get(board_index) else {
+            return false;
+        };
+        let (project_dir, name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board.name.clone()),
+        };
+        let board_config = ProjectBoardConfig {
+            name,
+            config_file: board.config_file.clone(),
+            build_dir: board.build_dir.clone(),
+            target: board.target.clone(),
+            project_type: board.project_type.clone(),
+        };
+        matches!(
+            command_template(&project_dir, &board_config, TemplateStep::Monitor),
+            Ok(None)
+        )
+    }
+
+    /// Whether an action started for the board is still running
+    pub fn is_action_running(&self, board_name: &str) -> bool {
+        self.running_actions
+            .get(board_name)
+            .is_some_and(|running| !running.task.is_finished())
+    }
+
+    /// Cancel the running action of a board: the task stops and the process
+    /// groups it started are terminated, other boards keep running
+    pub fn cancel_board_action(&mut self, board_index: usize) -> Option<BoardAction> {
+        let board_name = self.boards.get(board_index)?.name.clone();
+        if !self.is_action_running(&board_name) {
+            return None;
+        }
+        let running = self.running_actions.remove(&board_name)?;
+
+        running.task.abort();
+        let groups = running.job.terminate();
+        self.update_board_status(&board_name, BuildStatus::Cancelled);
+        self.add_log_line(
+            &board_name,
+            format!(
+                "🛑 {} cancelled, {} process group(s) terminated",
+                running.action.name(),
+                groups
+            ),
+        );
+        Some(running.action)
+    }
+
+    /// Cancel the running action of a board and start it over, or build the
+    /// board if nothing is running
+    pub async fn restart_board_action(
+        &mut self,
+        board_index: usize,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        if board_index >= self.boards.len() {
+            return Err(anyhow::anyhow!("No board selected"));
+        }
+        let cancelled = self.cancel_board_action(board_index);
+        let action = cancelled.clone().unwrap_or(BoardAction::Build);
+
+        let original_selection = self.selected_board;
+        self.selected_board = board_index;
+        let result = self.execute_action(action.clone(), tx).await;
+        self.selected_board = original_selection;
+
+        if cancelled.is_some() {
+            let board_name = self.boards[board_index].name.clone();
+            self.add_log_line(&board_name, format!("🔄 Restarted {}", action.name()));
+        }
+        result
+    }
+
+    /// Wait until the scheduler has build slots for a board; it queues under
+    /// the board's name in the list, so it can be moved from there
+    async fn acquire_build_slot(
+        scheduler: &BuildScheduler,
+        project_dir: &std::path::Path,
+        queue_name: &str,
+        board_config: &ProjectBoardConfig,
+        tx: &tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> BuildSlot {
+        let weight = board_weight(project_dir, board_config);
+        let priority = board_priority(project_dir, &board_config.name);
+        if scheduler.is_saturated(weight) {
+            let _ = tx.send(crate::models::AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!(
+                    "⏳ Waiting for {} build slot(s), {} build(s) running (f moves it to the front)",
+                    weight,
+                    scheduler.running()
+                ),
+            ));
+        }
+        scheduler.acquire_queued(queue_name, weight, priority).await
+    }
+
+    /// Move the selected board within the queue of builds waiting for slots
+    pub fn move_in_build_queue(&mut self, to: QueueMove) {
+        let Some(board) = self.boards.get(self.selected_board) else {
+            return;
+        };
+        let board_name = board.name.clone();
+        if self.build_scheduler.move_queued(&board_name, to) {
+            let queued = self.build_scheduler.queued();
+            let position = queued
+                .iter()
+                .position(|name| *name == board_name)
+                .unwrap_or(0);
+            self.add_log_line(
+                &board_name,
+                format!(
+                    "🔀 Moved to #{} of {} waiting build(s)",
+                    position + 1,
+                    queued.len()
+                ),
+            );
+        } else if !self.build_scheduler.queued().contains(&board_name) {
+            self.add_log_line(
+                &board_name,
+                "🔀 Not waiting for a build slot, nothing to reorder".to_string(),
+            );
+        }
+    }
+
+    /// Board indices in build start order: higher `priority:` first, list order otherwise
+    fn build_order(&self) -> Vec<usize> {
+        let mut order: Vec<usize> = (0..self.boards.len()).collect();
+        order.sort_by_cached_key(|&index| {
+            let board = &self.boards[index];
+            let priority = match &board.workspace {
+                Some(member) => board_priority(&member.project_dir, &member.board_name),
+                None => board_priority(&self.project_dir, &board.name),
+            };
+            std::cmp::Reverse(priority)
+        });
+        order
+    }
+
+    /// Build board using project handler, always rebuilding it but recording
+    /// its size, history and inputs as the CLI's builds do
     pub async fn build_board_with_handler(
         project_handler: &dyn crate::projects::ProjectHandler,
+        project_dir: &std::path::Path,
+        board_config: &ProjectBoardConfig,
+        other_configs: &[std::path::PathBuf],
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        crate::projects::incremental::build_board_incremental(
+            project_handler,
+            project_dir,
+            board_config,
+            other_configs,
+            true,
+            tx,
+        )
+        .await
+        .map(|_| ())
+    }
+
+    /// Deploy a MicroPython board: flash the firmware image, then sync the Python tree
+    pub async fn deploy_board_micropython(
         board_name: &str,
         project_dir: &std::path::Path,
         config_file: &std::path::Path,
         build_dir: &std::path::Path,
-        _log_file: &std::path::Path,
+        target: Option<String>,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
     ) -> Result<()> {
-        // Create a ProjectBoardConfig from the individual parameters
         let board_config = ProjectBoardConfig {
             name: board_name.to_string(),
             config_file: config_file.to_path_buf(),
             build_dir: build_dir.to_path_buf(),
-            target: None, // Will be auto-detected
-            project_type: project_handler.project_type(),
+            target,
+            project_type: ProjectType::MicroPython,
         };
 
-        // Call the project handler's build method
-        match project_handler
-            .build_board(project_dir, &board_config, tx)
+        crate::projects::handlers::micropython::MicroPythonHandler
+            .deploy_board(project_dir, &board_config, None, tx)
             .await
-        {
-            Ok(_artifacts) => Ok(()),
-            Err(e) => Err(e),
-        }
     }
 
     /// Flash board using project handler
@@ -1805,9 +3422,13 @@ echo "🎉 Clean all completed!"
         };
 
         // Build first to get artifacts
-        let artifacts = match project_handler
-            .build_board(project_dir, &board_config, tx.clone())
-            .await
+        let artifacts = match crate::projects::incremental::build_board_checked(
+            project_handler,
+            project_dir,
+            &board_config,
+            tx.clone(),
+        )
+        .await
         {
             Ok(artifacts) => artifacts,
             Err(e) => {
@@ -1820,9 +3441,15 @@ echo "🎉 Clean all completed!"
         };
 
         // Call the project handler's flash method
-        project_handler
-            .flash_board(project_dir, &board_config, &artifacts, None, tx)
-            .await
+        crate::projects::retry::flash_board_with_retries(
+            project_handler,
+            project_dir,
+            &board_config,
+            &artifacts,
+            None,
+            tx,
+        )
+        .await
     }
 
     /// Flash board using project handler with specific port
@@ -1850,9 +3477,13 @@ echo "🎉 Clean all completed!"
         ));
 
         // Build first to get artifacts
-        let artifacts = match project_handler
-            .build_board(project_dir, &board_config, tx.clone())
-            .await
+        let artifacts = match crate::projects::incremental::build_board_checked(
+            project_handler,
+            project_dir,
+            &board_config,
+            tx.clone(),
+        )
+        .await
         {
             Ok(artifacts) => artifacts,
             Err(e) => {
@@ -1977,7 +3608,7 @@ echo "🎉 Clean all completed!"
             cmd.env(key, value);
         }
 
-        let mut child = cmd.spawn()?;
+        let mut child = crate::utils::process_group::spawn(&mut cmd)?;
 
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
@@ -2510,116 +4141,6 @@ echo "🎉 Clean all completed!"
         }
     }
 
-    /// Generate single binary file for distribution
-    pub async fn generate_binary_esp_idf(
-        board_name: &str,
-        project_dir: &std::path::Path,
-        build_dir: &std::path::Path,
-        _log_file: &std::path::Path,
-        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
-    ) -> Result<()> {
-        let _ = tx.send(crate::models::AppEvent::BuildOutput(
-            board_name.to_string(),
-            format!("📦 Generating single binary for {}...", board_name),
-        ));
-
-        // Check if build directory exists
-        if !build_dir.exists() {
-            let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                board_name.to_string(),
-                "❌ Build directory not found! Please build the project first.".to_string(),
-            ));
-            return Err(anyhow::anyhow!("Build directory not found"));
-        }
-
-        // Look for flash_args file (generated by ESP-IDF build)
-        let flash_args_file = build_dir.join("flash_args");
-        if !flash_args_file.exists() {
-            let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                board_name.to_string(),
-                "❌ flash_args file not found! Please build the project first.".to_string(),
-            ));
-            return Err(anyhow::anyhow!("flash_args file not found"));
-        }
-
-        // Generate output filename
-        let output_file = build_dir.join(format!("{}-merged.bin", board_name));
-
-        let _ = tx.send(crate::models::AppEvent::BuildOutput(
-            board_name.to_string(),
-            "🔧 Merging binaries using ESP-IDF merge_bin.py tool...".to_string(),
-        ));
-
-        // Use esptool.py merge_bin to create single binary
-        let merge_args = vec![
-            "--chip".to_string(),
-            "auto".to_string(), // Let esptool detect the chip
-            "merge_bin".to_string(),
-            "-o".to_string(),
-            output_file.to_string_lossy().to_string(),
-            "--flash_mode".to_string(),
-            "dio".to_string(), // Default flash mode
-            "--flash_freq".to_string(),
-            "40m".to_string(), // Default flash frequency
-            "--flash_size".to_string(),
-            "4MB".to_string(), // Default flash size
-            "@".to_string() + &flash_args_file.to_string_lossy(), // Read args from file
-        ];
-
-        let merge_args_str: Vec<&str> = merge_args.iter().map(|s| s.as_str()).collect();
-        let env_vars = vec![];
-
-        let success = Self::execute_command_streaming(
-            "esptool.py",
-            &merge_args_str,
-            project_dir,
-            env_vars,
-            board_name,
-            tx.clone(),
-        )
-        .await?;
-
-        if success {
-            // Get file size for user info
-            match std::fs::metadata(&output_file) {
-                Ok(metadata) => {
-                    let size_kb = metadata.len() / 1024;
-                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                        board_name.to_string(),
-                        format!(
-                            "✅ Binary generation completed! File: {} ({} KB)",
-                            output_file.display(),
-                            size_kb
-                        ),
-                    ));
-                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                        board_name.to_string(),
-                        format!(
-                            "💡 Flash with: esptool.py write_flash 0x0 {}",
-                            output_file.display()
-                        ),
-                    ));
-                }
-                Err(_) => {
-                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                        board_name.to_string(),
-                        format!(
-                            "✅ Binary generation completed! File: {}",
-                            output_file.display()
-                        ),
-                    ));
-                }
-            }
-            Ok(())
-        } else {
-            let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                board_name.to_string(),
-                "❌ Binary generation failed!".to_string(),
-            ));
-            Err(anyhow::anyhow!("Binary generation failed"))
-        }
-    }
-
     // Remote board functionality
     pub fn get_server_url(&self) -> String {
         // If we have discovered servers, use hostname.local instead of IP addresses
@@ -3826,147 +5347,2360 @@ echo "🎉 Clean all completed!"
                     }
                 }
                 Err(e) => {
-                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                        "remote".to_string(),
-                        format!("✅ Flash request accepted by server (parse error: {})", e),
+                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
+                        "remote".to_string(),
+                        format!("✅ Flash request accepted by server (parse error: {})", e),
+                    ));
+                }
+            }
+            Ok(())
+        } else {
+            let status = response.status();
+            let error_text = response
+                .text()
+                .await
+                .unwrap_or_else(|_| "Unknown error".to_string());
+            let _ = tx.send(crate::models::AppEvent::BuildOutput(
+                "remote".to_string(),
+                format!(
+                    "❌ Server rejected flash request ({}): {}",
+                    status, error_text
+                ),
+            ));
+            Err(anyhow::anyhow!(
+                "Server rejected flash request: {}",
+                error_text
+            ))
+        }
+    }
+
+    /// Build the currently selected board
+    pub async fn build_selected_board(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        if self.selected_board >= self.boards.len() {
+            return Err(anyhow::anyhow!("No board selected"));
+        }
+
+        let board = &self.boards[self.selected_board];
+        let board_name = board.name.clone();
+
+        // Set build in progress
+        self.build_in_progress = true;
+
+        // Update board status to building
+        self.boards[self.selected_board].status = BuildStatus::Building;
+
+        // Add build start message to logs
+        self.add_log_line(
+            &board_name,
+            format!("🔨 Starting build for {}...", board_name),
+        );
+
+        // Execute build action
+        let tx_clone = tx.clone();
+        let build_result = self.execute_action(BoardAction::Build, tx_clone).await;
+
+        // Reset build in progress flag
+        self.build_in_progress = false;
+
+        match build_result {
+            Ok(()) => {
+                self.add_log_line(&board_name, "✅ Build initiated successfully".to_string());
+                Ok(())
+            }
+            Err(e) => {
+                self.boards[self.selected_board].status = BuildStatus::Failed;
+                self.add_log_line(&board_name, format!("❌ Build initiation failed: {}", e));
+                Err(e)
+            }
+        }
+    }
+
+    /// Build all boards (sequential or parallel based on build strategy)
+    pub async fn build_all_boards(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        if self.boards.is_empty() {
+            return Err(anyhow::anyhow!("No boards to build"));
+        }
+        if self.replay.is_some() {
+            return Err(anyhow::anyhow!(
+                "Nothing runs while a recording is replayed"
+            ));
+        }
+
+        // Set build in progress
+        self.build_in_progress = true;
+
+        let board_count = self.boards.len();
+
+        // Update all board statuses first
+        let build_strategy_debug = format!("{:?}", self.build_strategy);
+        for board in &mut self.boards {
+            board.status = BuildStatus::Pending;
+        }
+
+        // Then add log messages
+        let board_names: Vec<String> = self.boards.iter().map(|b| b.name.clone()).collect();
+        for board_name in &board_names {
+            self.add_log_line(
+                board_name,
+                format!("📅 Queued for build (strategy: {})", build_strategy_debug),
+            );
+        }
+
+        // Log overall build start
+        if !self.boards.is_empty() {
+            let first_board_name = self.boards[0].name.clone();
+            self.add_log_line(
+                &first_board_name,
+                format!(
+                    "🔨 Starting build for {} boards using {} strategy...",
+                    board_count, build_strategy_debug
+                ),
+            );
+        }
+
+        let all_boards: Vec<usize> = (0..self.boards.len()).collect();
+        self.prepare_board_builds(&all_boards, tx.clone()).await;
+
+        let result = match self.build_strategy {
+            BuildStrategy::Sequential => self.build_all_sequential(tx.clone()).await,
+            BuildStrategy::Parallel => self.build_all_parallel(tx.clone()).await,
+            BuildStrategy::IdfBuildApps => self.build_all_idf_build_apps(tx.clone()).await,
+        };
+
+        // Reset build in progress flag
+        self.build_in_progress = false;
+
+        match result {
+            Ok(success_count) => {
+                if !self.boards.is_empty() {
+                    let first_board_name = self.boards[0].name.clone();
+                    self.add_log_line(
+                        &first_board_name,
+                        format!(
+                            "✅ Build all completed: {}/{} boards successful",
+                            success_count, board_count
+                        ),
+                    );
+                }
+                Ok(())
+            }
+            Err(e) => {
+                if !self.boards.is_empty() {
+                    let first_board_name = self.boards[0].name.clone();
+                    self.add_log_line(&first_board_name, format!("❌ Build all failed: {}", e));
+                }
+                Err(e)
+            }
+        }
+    }
+
+    /// Build every board of the workspace project the selected board belongs to
+    pub async fn build_selected_project(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        let project = self
+            .boards
+            .get(self.selected_board)
+            .and_then(|b| b.workspace.as_ref())
+            .map(|member| member.project.clone())
+            .ok_or_else(|| anyhow::anyhow!("Selected board is not part of a workspace project"))?;
+
+        let indices: Vec<usize> = self
+            .boards
+            .iter()
+            .enumerate()
+            .filter(|(_, b)| b.workspace.as_ref().map(|m| &m.project) == Some(&project))
+            .map(|(i, _)| i)
+            .collect();
+
+        self.build_board_group(indices, &format!("project {}", project), tx)
+            .await
+    }
+
+    /// Start watching the project sources, or stop if watch mode is on
+    pub fn toggle_watch(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if let Some(task) = self.watch_task.take() {
+            task.abort();
+            let _ = tx.send(crate::models::AppEvent::Info(
+                "👀 Watch mode off".to_string(),
+            ));
+            return;
+        }
+
+        let mut watcher = match SourceWatcher::new(&self.project_dir, self.watch_debounce) {
+            Ok(watcher) => watcher,
+            Err(e) => {
+                let _ = tx.send(crate::models::AppEvent::Error(format!(
+                    "Unable to watch the sources: {:#}",
+                    e
+                )));
+                return;
+            }
+        };
+        let watched = if self.watch_boards.is_empty() {
+            "all boards".to_string()
+        } else {
+            self.watch_boards.join(", ")
+        };
+        let _ = tx.send(crate::models::AppEvent::Info(format!(
+            "👀 Watch mode on, rebuilding {} when sources change",
+            watched
+        )));
+        self.watch_task = Some(tokio::spawn(async move {
+            while let Some(changed) = watcher.next_change().await {
+                let _ = tx.send(crate::models::AppEvent::SourcesChanged(changed));
+            }
+        }));
+    }
+
+    /// Whether watch mode is on
+    pub fn is_watching(&self) -> bool {
+        self.watch_task.is_some()
+    }
+
+    /// Firmware size of a board's last build, with the delta to the build before
+    pub fn board_size_report(&self, board: &BoardConfig) -> Option<SizeReport> {
+        match &board.workspace {
+            Some(member) => SizeReport::load(&member.project_dir, &member.board_name),
+            None => SizeReport::load(&self.project_dir, &board.name),
+        }
+    }
+
+    /// Whether the images of a board's last build are signed, if its project signs them
+    pub fn board_signature_status(&self, board: &BoardConfig) -> Option<Vec<(&'static str, bool)>> {
+        let project_dir = match &board.workspace {
+            Some(member) => &member.project_dir,
+            None => &self.project_dir,
+        };
+        crate::config::ProjectConfig::load(project_dir)
+            .ok()??
+            .signing?;
+        Some(
+            crate::projects::signing::signable_images(&board.build_dir)
+                .into_iter()
+                .map(|(name, path)| {
+                    (
+                        name,
+                        crate::projects::signing::is_signed(&path).unwrap_or(false),
+                    )
+                })
+                .collect(),
+        )
+    }
+
+    /// Track when the boards start and finish building or flashing, keeping
+    /// the duration and the application size of their last builds, and tell
+    /// the desktop about the configured events
+    pub fn track_board_activity(&mut self) {
+        let now = std::time::Instant::now();
+        let queued = self.build_scheduler.queued();
+        let mut sized = Vec::new();
+        let mut notices = Vec::new();
+        for board in &mut self.boards {
+            let seen = self.board_activity.contains_key(&board.name);
+            let activity = self
+                .board_activity
+                .entry(board.name.clone())
+                .or_insert_with(|| BoardActivity::new(now));
+            let was = activity.running.clone();
+            let took = activity.observe(&board.status, queued.contains(&board.name), now);
+            if let Some(took) = took {
+                board.build_time = Some(took);
+            }
+            if !seen || (took.is_some() && matches!(board.status, BuildStatus::Success)) {
+                sized.push(board.name.clone());
+            }
+            // Cancelled builds neither succeeded nor failed
+            if let (Some(was), Some(_)) = (was, took)
+                && !matches!(board.status, BuildStatus::Cancelled)
+            {
+                let flash = matches!(was, BuildStatus::Flashing);
+                let success = !matches!(board.status, BuildStatus::Failed);
+                if self.activity_run.finished(&board.name, flash, success)
+                    && self.notifications.wants(NotificationEvent::FirstFailure)
+                {
+                    notices.push(format!(
+                        "{} {} failed",
+                        board.name,
+                        if flash { "flash" } else { "build" }
+                    ));
+                }
+            }
+        }
+        let busy = !queued.is_empty()
+            || self
+                .board_activity
+                .values()
+                .any(|activity| activity.running.is_some());
+        if let Some((run, duration)) = self.activity_run.update(busy, now) {
+            self.last_run_time = Some(duration);
+            if duration >= self.notifications.min_duration {
+                if !run.builds.is_empty()
+                    && self.notifications.wants(NotificationEvent::BuildsFinished)
+                {
+                    notices.push(run_summary("build(s)", &run.builds, duration));
+                }
+                if !run.flashes.is_empty()
+                    && self.notifications.wants(NotificationEvent::FlashesFinished)
+                {
+                    notices.push(run_summary("flash(es)", &run.flashes, duration));
+                }
+            }
+        }
+        self.tell_desktop(notices);
+        for name in sized {
+            let board = self.boards.iter().find(|board| board.name == name);
+            let size = board.and_then(|board| self.board_size_report(board));
+            let cache = board.and_then(|board| CacheStats::load(&board.build_dir));
+            match size {
+                Some(report) => {
+                    self.board_flash_sizes
+                        .insert(name.clone(), report.size.flash);
+                }
+                None => {
+                    self.board_flash_sizes.remove(&name);
+                }
+            }
+            match cache {
+                Some(stats) => {
+                    self.board_cache_stats.insert(name, stats);
+                }
+                None => {
+                    self.board_cache_stats.remove(&name);
+                }
+            }
+        }
+    }
+
+    /// Rows of the dashboard: the listed boards and their last builds
+    pub fn dashboard_boards(&self) -> Vec<BoardSummary> {
+        let queued = self.build_scheduler.queued();
+        self.boards
+            .iter()
+            .map(|board| {
+                let (_, elapsed) = self.board_progress(board);
+                BoardSummary {
+                    board: board.name.clone(),
+                    outcome: RunOutcome::of(&board.status, queued.contains(&board.name)),
+                    duration: elapsed.or(board.build_time),
+                    size: self.board_flash_sizes.get(&board.name).copied(),
+                    cache: self.board_cache_stats.get(&board.name).copied(),
+                }
+            })
+            .collect()
+    }
+
+    /// Wall time of the builds and flashes going on, else of the last ones
+    pub fn dashboard_wall_time(&self) -> Option<std::time::Duration> {
+        self.activity_run
+            .started
+            .map(|started| started.elapsed())
+            .or(self.last_run_time)
+    }
+
+    /// Publish the boards, their logs and the monitor panes to the browser
+    /// dashboard of `espbrew serve --web`, if it runs
+    pub fn publish_web_dashboard(&self) {
+        let Some(link) = &self.web_dashboard else {
+            return;
+        };
+        let summaries = self.dashboard_boards();
+        let totals = DashboardTotals::new(&summaries);
+        let boards = self
+            .boards
+            .iter()
+            .zip(&summaries)
+            .enumerate()
+            .map(|(index, (board, summary))| {
+                let [duration, size, cache] = board_columns(summary);
+                WebBoard {
+                    name: board.name.clone(),
+                    target: board.target.clone(),
+                    status: board.status.label().to_string(),
+                    outcome: summary.outcome.label().to_string(),
+                    duration,
+                    size,
+                    cache,
+                    selected: index == self.selected_board,
+                }
+            })
+            .collect();
+        let monitors = self
+            .serial_monitors
+            .iter()
+            .map(|monitor| WebMonitor {
+                port: monitor.port.clone(),
+                board: monitor.board.clone(),
+                state: self.monitor_device_state(monitor).label().to_string(),
+                lines: monitor
+                    .lines
+                    .iter()
+                    .skip(monitor.lines.len().saturating_sub(MONITOR_TAIL))
+                    .cloned()
+                    .collect(),
+            })
+            .collect();
+        let snapshot = WebSnapshot {
+            project: self
+                .project_dir
+                .file_name()
+                .map(|name| name.to_string_lossy().to_string())
+                .unwrap_or_else(|| self.project_dir.display().to_string()),
+            headline: totals.headline(),
+            timings: totals.timings(self.dashboard_wall_time()),
+            build_in_progress: self.build_in_progress,
+            boards,
+            monitors,
+        };
+
+        let mut dashboard = link.dashboard.write().unwrap();
+        dashboard.publish(snapshot);
+        for board in &self.boards {
+            dashboard.publish_log(&board.name, board.log_resets, &board.log_lines);
+        }
+    }
+
+    /// Record the session to the file, starting with every board
+    pub fn start_recording(&mut self, path: &std::path::Path) -> Result<()> {
+        let boards: Vec<RecordedBoard> = self
+            .boards
+            .iter()
+            .chain(self.hidden_boards.iter().map(|(_, b)| b))
+            .map(|board| RecordedBoard {
+                name: board.name.clone(),
+                target: board.target.clone(),
+                tags: board.tags.clone(),
+            })
+            .collect();
+        let project = self
+            .project_dir
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+            .unwrap_or_else(|| self.project_dir.display().to_string());
+        self.recorder = Some(SessionRecorder::create(
+            path,
+            &SessionHeader::new(&project, &boards),
+        )?);
+        Ok(())
+    }
+
+    /// Record what the boards went through since the last tick; a recording
+    /// that fails to be written stops
+    pub fn record_session(&mut self) {
+        let Some(recorder) = &mut self.recorder else {
+            return;
+        };
+        let boards = self
+            .boards
+            .iter()
+            .chain(self.hidden_boards.iter().map(|(_, b)| b));
+        if let Err(e) = recorder.record(boards) {
+            log::warn!("⚠️  Recording stopped: {:#}", e);
+            self.recorder = None;
+        }
+    }
+
+    /// Show the recorded session's boards in place of the project's and play
+    /// it back
+    pub fn start_replay(&mut self, replay: SessionReplay) {
+        self.boards = replay
+            .header
+            .boards
+            .iter()
+            .map(|board| BoardConfig {
+                name: board.name.clone(),
+                config_file: PathBuf::new(),
+                build_dir: PathBuf::new(),
+                status: BuildStatus::Pending,
+                log_lines: Vec::new(),
+                log_resets: 0,
+                build_time: None,
+                last_updated: Local::now(),
+                target: board.target.clone(),
+                project_type: ProjectType::EspIdf,
+                workspace: None,
+                tags: board.tags.clone(),
+            })
+            .collect();
+        self.hidden_boards.clear();
+        self.components.clear();
+        self.selected_component = 0;
+        self.component_list_state.select(None);
+        self.selected_board = 0;
+        self.list_state
+            .select((!self.boards.is_empty()).then_some(0));
+        self.reset_log_scroll();
+        self.replay = Some(replay);
+    }
+
+    /// Apply the recorded events that are due
+    pub fn advance_replay(&mut self) {
+        let Some(replay) = &mut self.replay else {
+            return;
+        };
+        for entry in replay.advance() {
+            match entry.event {
+                SessionEvent::Status { board, status } => self.update_board_status(&board, status),
+                SessionEvent::Log { board, lines } => {
+                    for line in lines {
+                        self.add_log_line(&board, line);
+                    }
+                }
+                SessionEvent::Clear { board } => {
+                    if let Some(board) = self
+                        .boards
+                        .iter_mut()
+                        .chain(self.hidden_boards.iter_mut().map(|(_, b)| b))
+                        .find(|b| b.name == board)
+                    {
+                        board.reset_log(Vec::new());
+                    }
+                }
+            }
+        }
+    }
+
+    /// Run the actions the browser dashboard queued
+    pub async fn run_web_commands(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let mut commands = Vec::new();
+        if let Some(link) = &mut self.web_dashboard {
+            while let Ok(command) = link.commands.try_recv() {
+                commands.push(command);
+            }
+        }
+        for command in commands {
+            if let Err(e) = self.run_web_command(command, tx.clone()).await {
+                let _ = tx.send(crate::models::AppEvent::Error(format!(
+                    "Web dashboard action failed: {:#}",
+                    e
+                )));
+            }
+        }
+    }
+
+    /// Run a dashboard action on its board, as the action menu would, leaving
+    /// the selection where it is
+    async fn run_web_command(
+        &mut self,
+        command: WebCommand,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        if command.action == WebAction::BuildAll {
+            return self.build_all_boards(tx).await;
+        }
+        let board_name = command.board.unwrap_or_default();
+        let Some(board_index) = self.boards.iter().position(|b| b.name == board_name) else {
+            return Err(anyhow::anyhow!("Unknown board '{}'", board_name));
+        };
+        if self.is_action_running(&board_name) {
+            self.add_log_line(
+                &board_name,
+                "⚠️  Busy, the web dashboard's action was not run".to_string(),
+            );
+            return Ok(());
+        }
+
+        let action = match command.action {
+            WebAction::Flash => return self.flash_for_web(board_index, tx),
+            WebAction::Monitor => BoardAction::Monitor,
+            _ => BoardAction::Build,
+        };
+        let original_selection = self.selected_board;
+        self.selected_board = board_index;
+        let result = self.execute_action(action, tx).await;
+        self.selected_board = original_selection;
+        result
+    }
+
+    /// Flash the board to the device of its `port:` or registered for it;
+    /// the local board dialog of the Flash action needs the terminal
+    fn flash_for_web(
+        &mut self,
+        board_index: usize,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        let board = &self.boards[board_index];
+        let board_name = board.name.clone();
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board_name.clone()),
+        };
+        let port = configured_port(&project_dir, &handler_board_name).or_else(|| {
+            let registry = DeviceRegistry::load(&project_dir).ok()?;
+            let device = registry.device(&handler_board_name)?;
+            find_by_usb(device, &connected_ports().ok()?)
+        });
+        let Some(port) = port else {
+            return Err(anyhow::anyhow!(
+                "No device of {} is connected, assign one with `espbrew boards assign`",
+                board_name
+            ));
+        };
+        let settle = self.suspend_board_monitors(&board_name);
+        self.flash_board_on_port(board_index, port, settle, tx);
+        Ok(())
+    }
+
+    /// Open the command palette with the listed boards and the devices
+    /// connected now
+    pub fn open_command_palette(&mut self) {
+        let boards: Vec<&str> = self.boards.iter().map(|b| b.name.as_str()).collect();
+        let ports = find_esp_ports().unwrap_or_default();
+        let entries = palette_entries(&self.keymap, &boards, &self.available_actions, &ports);
+        self.command_palette = Some(CommandPalette::new(entries));
+    }
+
+    /// Select the board and open the action menu on the action, for the menu
+    /// to run it; `false` if the board or the action is gone
+    pub fn select_board_action(&mut self, board: &str, action: &BoardAction) -> bool {
+        let Some(index) = self.boards.iter().position(|b| b.name == board) else {
+            return false;
+        };
+        let Some(action_index) = self.available_actions.iter().position(|a| a == action) else {
+            return false;
+        };
+        self.select_board(index);
+        self.action_menu_selected = action_index;
+        self.show_action_menu = true;
+        true
+    }
+
+    /// Open the dashboard with the devices connected now, or close it
+    pub fn toggle_dashboard(&mut self) {
+        self.show_dashboard = !self.show_dashboard;
+        self.dashboard_copied = false;
+        if self.show_dashboard {
+            self.refresh_dashboard_devices();
+        }
+    }
+
+    /// List the connected devices with the boards registered for them and
+    /// the states of their monitor panes
+    pub fn refresh_dashboard_devices(&mut self) {
+        let ports = connected_ports().unwrap_or_else(|e| {
+            log::warn!("⚠️  Unable to list the serial ports: {}", e);
+            Vec::new()
+        });
+        let registry = DeviceRegistry::load(&self.project_dir).unwrap_or_default();
+        let devices = ports
+            .iter()
+            .map(|port| {
+                let monitor = self.serial_monitors.iter().find(|m| m.port == port.port);
+                let state = monitor.map_or(DeviceState::Idle, |m| self.monitor_device_state(m));
+                DeviceSummary {
+                    port: port.port.clone(),
+                    board: registered_board(&registry, port)
+                        .or_else(|| monitor.and_then(|m| m.board.clone())),
+                    state,
+                }
+            })
+            .collect();
+        self.dashboard_devices = devices;
+    }
+
+    /// What the pane's device is used for
+    fn monitor_device_state(&self, monitor: &SerialMonitor) -> DeviceState {
+        if self.is_monitor_crash_looping(monitor) {
+            return DeviceState::CrashLooping;
+        }
+        match monitor.state {
+            MonitorState::Connected => DeviceState::Monitored,
+            MonitorState::Suspended(_) => DeviceState::Flashing,
+            MonitorState::Reconnecting => DeviceState::Reconnecting,
+            MonitorState::Closed(_) => DeviceState::MonitorClosed,
+        }
+    }
+
+    /// Copy the dashboard to the terminal's clipboard as Markdown
+    pub fn copy_dashboard(&mut self) {
+        let markdown = dashboard_markdown(
+            &self.dashboard_boards(),
+            &self.dashboard_devices,
+            self.dashboard_wall_time(),
+        );
+        use std::io::Write;
+        let mut stdout = std::io::stdout();
+        let _ = stdout.write_all(osc52_copy(&markdown).as_bytes());
+        let _ = stdout.flush();
+        self.dashboard_copied = true;
+    }
+
+    /// Show the notices on the desktop, unless the TUI's terminal has focus
+    fn tell_desktop(&self, notices: Vec<String>) {
+        if !self.notifications.when_focused && self.terminal_focused == Some(true) {
+            return;
+        }
+        for notice in notices {
+            tokio::spawn(notify_desktop(self.project_dir.clone(), notice));
+        }
+    }
+
+    /// How far the board's build is along its usual duration, and how long
+    /// it has been building or flashing
+    pub fn board_progress(&self, board: &BoardConfig) -> (Option<u8>, Option<std::time::Duration>) {
+        let elapsed = self
+            .board_activity
+            .get(&board.name)
+            .and_then(|activity| activity.elapsed(std::time::Instant::now()));
+        let progress = match (elapsed, self.build_estimates.get(&board.name)) {
+            (Some(elapsed), Some(estimate)) if matches!(board.status, BuildStatus::Building) => {
+                Some(estimated_progress(elapsed, *estimate))
+            }
+            _ => None,
+        };
+        (progress, elapsed)
+    }
+
+    /// Reload the build statistics and duration estimates of all boards
+    pub fn refresh_build_history(&mut self) {
+        let mut histories = std::collections::HashMap::new();
+        self.build_history.clear();
+        self.build_estimates.clear();
+        for board in &self.boards {
+            let (project_dir, board_name) = match &board.workspace {
+                Some(member) => (member.project_dir.clone(), member.board_name.as_str()),
+                None => (self.project_dir.clone(), board.name.as_str()),
+            };
+            let entries = histories
+                .entry(project_dir)
+                .or_insert_with_key(|dir| load_history(dir));
+
+            if let Some(estimate) = estimate_duration(entries, board_name) {
+                self.build_estimates.insert(board.name.clone(), estimate);
+            }
+            if let Some(mut stats) = board_stats(entries)
+                .into_iter()
+                .find(|stats| stats.board == board_name)
+            {
+                stats.board = board.name.clone();
+                self.build_history.push(stats);
+            }
+        }
+    }
+
+    /// Collect the compiler diagnostics of every board's log, each one once
+    pub fn collect_diagnostics(&self) -> Vec<SharedDiagnostic> {
+        let mut collector = DiagnosticsCollector::new(&self.project_dir);
+        for board in self
+            .boards
+            .iter()
+            .chain(self.hidden_boards.iter().map(|(_, b)| b))
+        {
+            for line in &board.log_lines {
+                collector.add_line(&board.name, &board.build_dir, line);
+            }
+        }
+        collector.diagnostics().into_iter().cloned().collect()
+    }
+
+    /// Open or close the diagnostics panel
+    pub fn toggle_diagnostics(&mut self) {
+        self.diagnostics = match self.diagnostics {
+            Some(_) => None,
+            None => Some(self.collect_diagnostics()),
+        };
+    }
+
+    /// Refresh the open diagnostics panel, e.g. after a board finished
+    pub fn refresh_diagnostics(&mut self) {
+        if self.diagnostics.is_some() {
+            self.diagnostics = Some(self.collect_diagnostics());
+        }
+    }
+
+    /// Open the device flash panel; the first time it flashes all connected devices
+    pub fn open_device_flash(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.show_device_flash = true;
+        if self.device_flash.is_none() {
+            self.start_device_flash(tx);
+        }
+    }
+
+    /// Identify the connected devices and flash each with the listed board
+    /// configuration matching it, all at once
+    pub fn start_device_flash(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if self
+            .device_flash
+            .as_ref()
+            .is_some_and(|run| run.is_running())
+        {
+            return;
+        }
+        self.device_flash = Some(DeviceFlashRun {
+            probing: true,
+            ..Default::default()
+        });
+
+        // Boards hidden by the tag filter aren't flashed; workspace members
+        // belong to other projects
+        let boards: Vec<ProjectBoardConfig> = self
+            .boards
+            .iter()
+            .filter(|board| board.workspace.is_none())
+            .map(|board| ProjectBoardConfig {
+                name: board.name.clone(),
+                config_file: board.config_file.clone(),
+                build_dir: board.build_dir.clone(),
+                target: board.target.clone(),
+                project_type: board.project_type.clone(),
+            })
+            .collect();
+        let project_dir = self.project_dir.clone();
+        let settle = self.suspend_serial_monitors(DEVICE_FLASH_HOLDER, |_| true);
+        tokio::spawn(async move {
+            if settle {
+                tokio::time::sleep(PORT_RELEASE_DELAY).await;
+            }
+            let devices = match probe_devices().await {
+                Ok(devices) => devices,
+                Err(e) => {
+                    let _ = tx.send(crate::models::AppEvent::DevicesMatched(
+                        Vec::new(),
+                        vec![("serial ports".to_string(), e.to_string())],
+                    ));
+                    return;
+                }
+            };
+            let plan = match_devices(&project_dir, &boards, devices);
+            let _ = tx.send(crate::models::AppEvent::DevicesMatched(
+                plan.targets
+                    .iter()
+                    .map(|target| (target.label(), target.device.summary()))
+                    .collect(),
+                plan.skipped
+                    .iter()
+                    .map(|(device, reason)| (device.port.clone(), reason.clone()))
+                    .collect(),
+            ));
+            flash_devices(&project_dir, &plan, tx).await;
+        });
+    }
+
+    pub fn handle_devices_matched(
+        &mut self,
+        devices: Vec<(String, String)>,
+        skipped: Vec<(String, String)>,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(run) = self.device_flash.as_mut() else {
+            return;
+        };
+        run.probing = false;
+        run.skipped = skipped;
+        run.devices = devices
+            .into_iter()
+            .map(|(label, hardware)| DeviceFlash {
+                label,
+                hardware,
+                progress: 0,
+                status: BuildStatus::Flashing,
+                last_line: String::new(),
+                verified: false,
+            })
+            .collect();
+        self.resume_after_device_flash(tx);
+    }
+
+    fn device_flash_entry(&mut self, label: &str) -> Option<&mut DeviceFlash> {
+        self.device_flash
+            .as_mut()?
+            .devices
+            .iter_mut()
+            .find(|device| device.label == label)
+    }
+
+    /// Output of a device of the flash run: shown in the panel and logged
+    /// to its board. `false` if the output isn't from such a device.
+    pub fn record_device_flash_output(&mut self, label: &str, line: &str) -> bool {
+        let Some(device) = self.device_flash_entry(label) else {
+            return false;
+        };
+        device.last_line = line.to_string();
+        if let Some((board_name, port)) = label.rsplit_once('@') {
+            self.add_log_line(board_name, format!("[{}] {}", port, line));
+        }
+        true
+    }
+
+    pub fn handle_flash_progress(&mut self, label: &str, percent: u8) {
+        if let Some(device) = self.device_flash_entry(label) {
+            device.progress = device.progress.max(percent);
+        }
+    }
+
+    pub fn handle_flash_verified(&mut self, label: &str) {
+        if let Some(device) = self.device_flash_entry(label) {
+            device.verified = true;
+        }
+    }
+
+    pub fn handle_device_flash_finished(
+        &mut self,
+        label: &str,
+        success: bool,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if let Some(device) = self.device_flash_entry(label) {
+            if success {
+                device.progress = 100;
+                device.status = BuildStatus::Flashed;
+            } else {
+                device.status = BuildStatus::Failed;
+            }
+        }
+        self.resume_after_device_flash(tx);
+    }
+
+    /// Give the serial monitor panes their ports back once every device is done
+    fn resume_after_device_flash(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if !self
+            .device_flash
+            .as_ref()
+            .is_some_and(|run| run.is_running())
+        {
+            self.resume_serial_monitors(DEVICE_FLASH_HOLDER, tx);
+        }
+    }
+
+    /// Open the serial monitor view; the first time it monitors every
+    /// connected device
+    pub fn open_serial_monitors(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.show_serial_monitor = true;
+        if !self.serial_monitors.is_empty() {
+            return;
+        }
+        match find_esp_ports() {
+            Ok(ports) => {
+                for port in ports {
+                    let board = self.board_on_port(&port);
+                    self.open_serial_monitor(&port, board, tx.clone());
+                }
+                self.selected_monitor = 0;
+            }
+            Err(e) => {
+                let _ = tx.send(crate::models::AppEvent::Error(format!(
+                    "Failed to list serial ports: {}",
+                    e
+                )));
+            }
+        }
+    }
+
+    /// Open the serial monitor view on the device of the port
+    pub fn monitor_port(
+        &mut self,
+        port: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let board = self.board_on_port(port);
+        self.open_serial_monitor(port, board, tx);
+    }
+
+    /// Board whose `port:` in `espbrew.yaml` is `port`
+    fn board_on_port(&self, port: &str) -> Option<String> {
+        self.boards
+            .iter()
+            .filter(|board| board.workspace.is_none())
+            .find(|board| configured_port(&self.project_dir, &board.name).as_deref() == Some(port))
+            .map(|board| board.name.clone())
+    }
+
+    /// Show the pane of `port`, opening it if it has none or its reader stopped
+    pub fn open_serial_monitor(
+        &mut self,
+        port: &str,
+        board: Option<String>,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.show_serial_monitor = true;
+        let index = match self.serial_monitors.iter().position(|m| m.port == port) {
+            Some(index) => {
+                if board.is_some() {
+                    self.serial_monitors[index].board = board;
+                }
+                index
+            }
+            None => {
+                self.serial_monitors.push(SerialMonitor::new(port, board));
+                if self.monitor_recording.enabled {
+                    self.start_recording(self.serial_monitors.len() - 1);
+                }
+                self.serial_monitors.len() - 1
+            }
+        };
+        self.selected_monitor = index;
+        if matches!(self.serial_monitors[index].state, MonitorState::Closed(_)) {
+            self.start_serial_reader(index, tx);
+        }
+    }
+
+    fn start_serial_reader(
+        &mut self,
+        index: usize,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.monitor_reader += 1;
+        let monitor = &mut self.serial_monitors[index];
+        monitor.reader = self.monitor_reader;
+        monitor.stop = Default::default();
+        monitor.state = MonitorState::Connected;
+        self.start_monitor_decoders(index, tx.clone());
+        let monitor = &mut self.serial_monitors[index];
+        monitor.console = Some(spawn_serial_reader(
+            monitor.port.clone(),
+            MONITOR_BAUD_RATE,
+            monitor.reader,
+            monitor.stop.clone(),
+            tx,
+        ));
+    }
+
+    /// Start the pane's backtrace and defmt decoders for its reader
+    fn start_monitor_decoders(
+        &mut self,
+        index: usize,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        // Looked up on every start, e.g. after a flash, for the ELF just built
+        let elf = self.serial_monitors[index]
+            .board
+            .as_deref()
+            .and_then(|board| self.board_build_elf(board));
+        let decoder = elf.as_deref().map(BacktraceDecoder::new);
+        let monitor = &mut self.serial_monitors[index];
+        monitor.backtraces = match decoder {
+            Some(Ok(decoder)) => {
+                monitor.push_line(format!(
+                    "🔎 Decoding backtraces with {}",
+                    decoder.elf().display()
+                ));
+                Some(spawn_backtrace_decoder(
+                    monitor.port.clone(),
+                    monitor.reader,
+                    decoder,
+                    tx.clone(),
+                ))
+            }
+            Some(Err(e)) => {
+                monitor.push_line(format!("⚠️  Backtraces won't be decoded: {:#}", e));
+                None
+            }
+            None => None,
+        };
+        monitor.defmt = None;
+        if let Some(elf) = elf.as_deref().filter(|elf| has_defmt_table(elf)) {
+            match spawn_defmt_decoder(monitor.port.clone(), monitor.reader, elf, tx) {
+                Ok(frames) => {
+                    monitor.push_line(format!("🧩 Decoding defmt frames with {}", elf.display()));
+                    monitor.defmt = Some((DefmtSplitter::default(), frames));
+                }
+                Err(e) => {
+                    monitor.push_line(format!("⚠️  defmt frames won't be decoded: {:#}", e));
+                }
+            }
+        }
+    }
+
+    /// ELF of the board's last build, `None` before it is built
+    fn board_build_elf(&self, board_name: &str) -> Option<PathBuf> {
+        let board = self.boards.iter().find(|b| b.name == board_name)?;
+        let project_dir = board
+            .workspace
+            .as_ref()
+            .map_or(&self.project_dir, |member| &member.project_dir);
+        board_elf(&project_dir.join(&board.build_dir))
+    }
+
+    /// Open the pane of the board's device: its configured or registered
+    /// port, else the only ESP port connected
+    pub fn monitor_board(
+        &mut self,
+        board_index: usize,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(board) = self.boards.get(board_index) else {
+            return;
+        };
+        let board_name = board.name.clone();
+        let (project_dir, handler_board_name) = match &board.workspace {
+            Some(member) => (member.project_dir.clone(), member.board_name.clone()),
+            None => (self.project_dir.clone(), board_name.clone()),
+        };
+        let tx_board = Self::relay_board_events(&board_name, &handler_board_name, tx.clone());
+        tokio::spawn(async move {
+            let port = match port_or_registered(&project_dir, &handler_board_name, None, &tx_board)
+                .await
+            {
+                Ok(Some(port)) => Ok(port),
+                Ok(None) => select_esp_port(),
+                Err(e) => Err(e),
+            };
+            match port {
+                Ok(port) => {
+                    let _ = tx.send(crate::models::AppEvent::SerialMonitorRequested(
+                        board_name, port,
+                    ));
+                }
+                Err(e) => {
+                    let _ = tx.send(crate::models::AppEvent::BuildOutput(
+                        board_name,
+                        format!("❌ No port to monitor: {:#}", e),
+                    ));
+                }
+            }
+        });
+    }
+
+    pub fn handle_serial_output(
+        &mut self,
+        port: &str,
+        reader: u64,
+        data: &[u8],
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(index) = self
+            .serial_monitors
+            .iter()
+            .position(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        let monitor = &mut self.serial_monitors[index];
+        let chunks = match &mut monitor.defmt {
+            Some((splitter, _)) => splitter.push(data),
+            None => vec![DefmtChunk::Text(data.to_vec())],
+        };
+        let mut lines = Vec::new();
+        for chunk in chunks {
+            match chunk {
+                DefmtChunk::Text(text) => lines.extend(monitor.push_output(&text)),
+                DefmtChunk::Frame(frame) => {
+                    if let Some((_, frames)) = &monitor.defmt {
+                        let _ = frames.send(frame);
+                    }
+                }
+            }
+        }
+        self.process_serial_lines(index, lines, tx);
+    }
+
+    /// Show a line the pane's `defmt-print` decoded from a frame
+    pub fn handle_serial_defmt(
+        &mut self,
+        port: &str,
+        reader: u64,
+        line: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(index) = self
+            .serial_monitors
+            .iter()
+            .position(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        let line = strip_ansi(line);
+        self.serial_monitors[index].push_line(line.clone());
+        self.process_serial_lines(index, vec![line], tx);
+    }
+
+    /// Merge, decode and capture core dumps of the lines the pane just showed
+    fn process_serial_lines(
+        &mut self,
+        index: usize,
+        lines: Vec<String>,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        self.record_lines(index, &lines);
+        let monitor = &mut self.serial_monitors[index];
+        let (title, port) = (monitor.title(), monitor.port.clone());
+        let mut core_dumps = Vec::new();
+        let mut fired = Vec::new();
+        let mut crash_looping = false;
+        let mut script_events = Vec::new();
+        let mut falling = Vec::new();
+        let resets_per_minute = resets_per_minute(&self.crash_loop);
+        monitor.session.lines += lines.len();
+        for line in lines {
+            let now = std::time::Instant::now();
+            crash_looping |= monitor.resets.observe(&line, now, resets_per_minute);
+            if let Some(script) = &mut monitor.script {
+                script_events.extend(script.on_line(&line, now));
+            }
+            falling.extend(monitor.memory.observe(&line, now));
+            for trigger in
+                monitor
+                    .session
+                    .fire(&self.monitor_triggers, &line, std::time::Instant::now())
+            {
+                fired.push((trigger.clone(), line.clone()));
+            }
+            for (name, value) in plot_values(&line, &self.plot_rules) {
+                monitor.plot.push(&name, value);
+            }
+            if let Some(backtraces) = &monitor.backtraces
+                && !code_addresses(&line).is_empty()
+            {
+                let _ = backtraces.send(line.clone());
+            }
+            match core_dump_line(&line) {
+                CoreDumpLine::Start => monitor.core_dump = Some(Vec::new()),
+                CoreDumpLine::End => {
+                    if let Some(dump) = monitor.core_dump.take() {
+                        core_dumps.push(Some(dump));
+                    }
+                }
+                CoreDumpLine::SavedToFlash => core_dumps.push(None),
+                CoreDumpLine::Other => {
+                    if let Some(dump) = &mut monitor.core_dump {
+                        dump.push(line.trim().to_string());
+                    }
+                }
+            }
+            self.merged_monitor.push_line(merged_line(&title, &line));
+        }
+        for dump in core_dumps {
+            self.decode_core_dump(&port, dump, tx.clone());
+        }
+        for series in falling {
+            let monitor = &mut self.serial_monitors[index];
+            let slope = monitor
+                .memory
+                .series
+                .iter()
+                .find(|(name, _)| *name == series)
+                .and_then(|(_, trend)| trend.slope_per_minute())
+                .unwrap_or_default();
+            monitor.push_line(format!(
+                "📉 The {} of {} keeps falling, {:+.0} B/min: a leak?",
+                series, title, slope
+            ));
+        }
+        if crash_looping {
+            self.alert_crash_loop(index);
+        }
+        self.apply_script_events(index, script_events);
+        for (trigger, line) in fired {
+            self.run_trigger(index, &trigger, &line, tx.clone());
+        }
+    }
+
+    /// Tell the pane and the configured notifiers that its device started
+    /// crash-looping
+    fn alert_crash_loop(&mut self, index: usize) {
+        let monitor = &mut self.serial_monitors[index];
+        let alert = CrashLoopAlert::new(
+            &monitor.title(),
+            monitor.board.as_deref(),
+            &monitor.port,
+            &monitor.resets,
+        );
+        monitor.push_line(alert.text());
+        let (project_dir, section) = (self.project_dir.clone(), self.crash_loop.clone());
+        tokio::spawn(async move {
+            notify_crash_loop(&project_dir, &section, &alert).await;
+        });
+    }
+
+    /// Whether the pane's device reset too often in the last minute
+    pub fn is_monitor_crash_looping(&self, monitor: &SerialMonitor) -> bool {
+        monitor.resets.is_crash_looping(
+            std::time::Instant::now(),
+            resets_per_minute(&self.crash_loop),
+        )
+    }
+
+    /// Whether a pane of the board's devices is crash-looping
+    pub fn is_board_crash_looping(&self, board: &str) -> bool {
+        self.serial_monitors
+            .iter()
+            .any(|m| m.board.as_deref() == Some(board) && self.is_monitor_crash_looping(m))
+    }
+
+    /// Take the actions of a trigger that fired on a line of the pane
+    fn run_trigger(
+        &mut self,
+        index: usize,
+        trigger: &MonitorTrigger,
+        line: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let monitor = &mut self.serial_monitors[index];
+        let (port, board) = (monitor.port.clone(), monitor.board.clone());
+        monitor.push_line(format!("⚡ Trigger {} fired", trigger.name));
+        for action in &trigger.actions {
+            let outcome = match action {
+                TriggerAction::SaveLog => {
+                    let monitor = &self.serial_monitors[index];
+                    let path = trigger_log_path(
+                        &self.project_dir,
+                        board.as_deref(),
+                        &port,
+                        &trigger.name,
+                        Local::now(),
+                    );
+                    match save_trigger_log(&path, &monitor.lines) {
+                        Ok(()) => format!("💾 Log saved to {}", path.display()),
+                        Err(e) => format!("⚠️  Log not saved: {:#}", e),
+                    }
+                }
+                TriggerAction::Flash => self.flash_for_trigger(board.as_deref(), &port, tx.clone()),
+                TriggerAction::Run(command) => {
+                    let (project_dir, command) = (self.project_dir.clone(), command.clone());
+                    let env = trigger_env(&trigger.name, line, board.as_deref(), &port);
+                    let log_board = board.clone().unwrap_or_else(|| port.clone());
+                    let (tx, port, name) = (tx.clone(), port.clone(), trigger.name.clone());
+                    tokio::spawn(async move {
+                        let outcome =
+                            match run_shell_command(&project_dir, &command, &env, &log_board, &tx)
+                                .await
+                            {
+                                Ok(status) if status.success() => {
+                                    format!("✅ {} succeeded", command)
+                                }
+                                Ok(status) => format!("❌ {} failed with {}", command, status),
+                                Err(e) => format!("❌ {} didn't run: {:#}", command, e),
+                            };
+                        let _ = tx.send(crate::models::AppEvent::MonitorTriggerRan(
+                            port, name, outcome,
+                        ));
+                    });
+                    format!("▶️  Running {}", command)
+                }
+            };
+            let monitor = &mut self.serial_monitors[index];
+            monitor.push_line(format!("  {}", outcome));
+            monitor.session.record_outcome(&trigger.name, outcome);
+        }
+    }
+
+    /// Flash the board of a pane's device again, releasing the port meanwhile
+    fn flash_for_trigger(
+        &mut self,
+        board: Option<&str>,
+        port: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> String {
+        let Some(board_name) = board else {
+            return format!("⚠️  Not flashed, the board of {} is unknown", port);
+        };
+        let Some(board_index) = self.boards.iter().position(|b| b.name == board_name) else {
+            return format!("⚠️  Not flashed, {} is no board of the project", board_name);
+        };
+        if matches!(
+            self.boards[board_index].status,
+            BuildStatus::Building | BuildStatus::Flashing
+        ) {
+            return format!("⚠️  Not flashed, {} is busy", board_name);
+        }
+        let settle = self.suspend_board_monitors(board_name);
+        self.flash_board_on_port(board_index, port.to_string(), settle, tx);
+        format!("🔥 Flashing {} again", board_name)
+    }
+
+    /// What the command of a pane's trigger did, once it finished
+    pub fn handle_monitor_trigger_ran(&mut self, port: &str, trigger: &str, outcome: String) {
+        let Some(monitor) = self.serial_monitors.iter_mut().find(|m| m.port == port) else {
+            return;
+        };
+        monitor.push_line(format!("  {}", outcome));
+        monitor.session.record_outcome(trigger, outcome);
+    }
+
+    /// Show the selected pane's session summary in the pane
+    pub fn show_session_summary(&mut self) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        let mut summary = monitor.session.summary(&monitor.title(), Local::now());
+        summary.push(format!("  {}", monitor.resets.summary()));
+        for line in summary {
+            monitor.push_line(line);
+        }
+    }
+
+    /// Decode a core dump the pane on `port` captured, or with `dump` `None`
+    /// read the one its device saved to flash, releasing the port meanwhile
+    fn decode_core_dump(
+        &mut self,
+        port: &str,
+        dump: Option<Vec<String>>,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(monitor) = self.serial_monitors.iter().find(|m| m.port == port) else {
+            return;
+        };
+        let board_name = monitor.board.clone();
+        let board = board_name
+            .as_deref()
+            .and_then(|name| self.boards.iter().find(|b| b.name == name));
+        let elf = board_name
+            .as_deref()
+            .and_then(|name| self.board_build_elf(name));
+        let chip = board
+            .and_then(|board| board.target.as_deref())
+            .map(|target| target.to_lowercase().replace('-', ""));
+        let from_flash = dump.is_none();
+        let message = if from_flash {
+            self.suspend_serial_monitors(CORE_DUMP_HOLDER, |m| m.port == port);
+            "🧾 Core dump saved to flash, reading it from the device..."
+        } else {
+            "🧾 Core dump captured, decoding it..."
+        };
+        if let Some(monitor) = self.serial_monitors.iter_mut().find(|m| m.port == port) {
+            monitor.push_line(message.to_string());
+        }
+
+        let (project_dir, port) = (self.project_dir.clone(), port.to_string());
+        tokio::spawn(async move {
+            if from_flash {
+                tokio::time::sleep(PORT_RELEASE_DELAY + CORE_DUMP_REBOOT_DELAY).await;
+            }
+            let report = decode_core_dump(&project_dir, &port, board_name, elf, chip, dump).await;
+            let _ = tx.send(crate::models::AppEvent::CoreDumpDecoded(report));
+        });
+    }
+
+    /// Show a decoded core dump, and reopen the port it was read from
+    pub fn handle_core_dump_decoded(
+        &mut self,
+        report: CoreDumpReport,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if report.from_flash {
+            self.resume_serial_monitors(CORE_DUMP_HOLDER, tx);
+        }
+        if let Some(monitor) = self
+            .serial_monitors
+            .iter_mut()
+            .find(|m| m.port == report.port)
+        {
+            monitor.push_line(match &report.report {
+                Ok(_) => "🧾 Core dump decoded, D shows the crash report".to_string(),
+                Err(error) => format!("❌ Core dump not decoded: {}", error),
+            });
+        }
+        self.core_dumps.push(report);
+        self.selected_core_dump = self.core_dumps.len() - 1;
+        self.show_core_dumps = true;
+    }
+
+    /// Show the previous or next crash report
+    pub fn cycle_core_dump(&mut self, forward: bool) {
+        let count = self.core_dumps.len();
+        if count == 0 {
+            return;
+        }
+        self.selected_core_dump = if forward {
+            (self.selected_core_dump + 1) % count
+        } else {
+            (self.selected_core_dump + count - 1) % count
+        };
+    }
+
+    pub fn scroll_core_dump(&mut self, lines: isize) {
+        if let Some(report) = self.core_dumps.get_mut(self.selected_core_dump) {
+            let length = match &report.report {
+                Ok(text) => text.lines().count(),
+                Err(_) => 1,
+            };
+            report.scroll_offset = report
+                .scroll_offset
+                .saturating_add_signed(lines)
+                .min(length.saturating_sub(1));
+        }
+    }
+
+    /// Save the shown crash report to a file for bug reports
+    pub fn save_core_dump_report(&mut self) {
+        let Some(report) = self.core_dumps.get_mut(self.selected_core_dump) else {
+            return;
+        };
+        report.saved = Some(save_report(&self.project_dir, report).map_err(|e| format!("{:#}", e)));
+    }
+
+    pub fn handle_serial_decoded(
+        &mut self,
+        port: &str,
+        reader: u64,
+        line: &str,
+        frames: &[String],
+    ) {
+        let Some(index) = self
+            .serial_monitors
+            .iter()
+            .position(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        let monitor = &mut self.serial_monitors[index];
+        let title = monitor.title();
+        let frame_lines = monitor.push_frames(line, frames);
+        for frame_line in &frame_lines {
+            self.merged_monitor
+                .push_line(merged_line(&title, frame_line));
+        }
+        self.record_lines(index, &frame_lines);
+    }
+
+    /// Record the pane's session to `logs/<board>/<device>/`
+    fn start_recording(&mut self, index: usize) {
+        let monitor = &mut self.serial_monitors[index];
+        match MonitorRecorder::start(
+            &self.monitor_recording,
+            monitor.board.as_deref(),
+            &monitor.port,
+        ) {
+            Ok(recorder) => {
+                monitor.push_line(format!("📼 Recording to {}", recorder.path().display()));
+                self.monitor_recorders
+                    .insert(monitor.port.clone(), recorder);
+            }
+            Err(e) => monitor.push_line(format!("⚠️  Not recording: {:#}", e)),
+        }
+    }
+
+    /// Start or stop recording the selected pane's session
+    pub fn toggle_recording(&mut self) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        match self.monitor_recorders.remove(&monitor.port) {
+            Some(recorder) => monitor.push_line(format!(
+                "📼 Recording stopped, saved to {}",
+                recorder.path().display()
+            )),
+            None => self.start_recording(self.selected_monitor),
+        }
+    }
+
+    /// Write the lines the pane just showed to its recording, if any
+    fn record_lines(&mut self, index: usize, lines: &[String]) {
+        let monitor = &mut self.serial_monitors[index];
+        let Some(recorder) = self.monitor_recorders.get_mut(&monitor.port) else {
+            return;
+        };
+        if let Err(e) = lines.iter().try_for_each(|line| recorder.record(line)) {
+            self.monitor_recorders.remove(&monitor.port);
+            monitor.push_line(format!("⚠️  Recording stopped: {:#}", e));
+        }
+    }
+
+    /// Copy the selected pane's last crash with its decoded frames to the
+    /// terminal's clipboard
+    pub fn copy_backtrace(&mut self) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        if monitor.backtrace.is_empty() {
+            monitor.push_line("📋 No decoded backtrace to copy yet".to_string());
+            return;
+        }
+        use std::io::Write;
+        let mut stdout = std::io::stdout();
+        let _ = stdout.write_all(osc52_copy(&monitor.backtrace.join("\n")).as_bytes());
+        let _ = stdout.flush();
+        let copied = monitor.backtrace.len();
+        monitor.push_line(format!("📋 Copied the last backtrace ({} lines)", copied));
+    }
+
+    pub fn handle_serial_closed(&mut self, port: &str, reader: u64, error: Option<String>) {
+        let Some(monitor) = self
+            .serial_monitors
+            .iter_mut()
+            .find(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        // A suspended pane stopped its reader itself
+        if matches!(
+            monitor.state,
+            MonitorState::Connected | MonitorState::Reconnecting
+        ) {
+            if let Some(error) = &error {
+                monitor.push_line(format!("❌ {}", error));
+            }
+            monitor.state = MonitorState::Closed(error);
+        }
+    }
+
+    /// The pane's port went away; its reader waits for the device to come back
+    pub fn handle_serial_reconnecting(&mut self, port: &str, reader: u64, error: &str) {
+        let Some(monitor) = self
+            .serial_monitors
+            .iter_mut()
+            .find(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        if monitor.state == MonitorState::Connected {
+            monitor.push_line(format!(
+                "🔌 {} went away ({}), waiting for the device to come back",
+                port, error
+            ));
+            monitor.state = MonitorState::Reconnecting;
+        }
+    }
+
+    /// The pane's device came back, possibly on another port, which the pane
+    /// then goes on with, keeping its lines and recording
+    pub fn handle_serial_reconnected(
+        &mut self,
+        port: &str,
+        reader: u64,
+        new_port: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        let Some(index) = self
+            .serial_monitors
+            .iter()
+            .position(|m| m.port == port && m.reader == reader)
+        else {
+            return;
+        };
+        let monitor = &mut self.serial_monitors[index];
+        if monitor.state != MonitorState::Reconnecting {
+            return;
+        }
+        monitor.state = MonitorState::Connected;
+        monitor.partial.clear();
+        monitor.push_line(format!("🔌 Reconnected to {}", new_port));
+        if new_port != port {
+            monitor.port = new_port.to_string();
+            if let Some(recorder) = self.monitor_recorders.remove(port) {
+                self.monitor_recorders
+                    .insert(new_port.to_string(), recorder);
+            }
+            // The decoders send what they decode for the old port
+            self.start_monitor_decoders(index, tx);
+        }
+    }
+
+    /// Release the ports of the panes `affected` picks for `holder`, a board
+    /// flashing or the device flash; whether a reader had to be stopped
+    pub fn suspend_serial_monitors(
+        &mut self,
+        holder: &str,
+        affected: impl Fn(&SerialMonitor) -> bool,
+    ) -> bool {
+        let mut stopped = false;
+        for monitor in self.serial_monitors.iter_mut().filter(|m| affected(m)) {
+            if monitor.suspend(holder) {
+                monitor
+                    .stop
+                    .store(true, std::sync::atomic::Ordering::Relaxed);
+                stopped = true;
+            }
+        }
+        stopped
+    }
+
+    /// Release the ports a flash of the board may use: its pane and the panes
+    /// of devices not known to belong to a board
+    pub fn suspend_board_monitors(&mut self, board_name: &str) -> bool {
+        self.suspend_serial_monitors(board_name, |monitor| {
+            monitor
+                .board
+                .as_deref()
+                .is_none_or(|board| board == board_name)
+        })
+    }
+
+    /// `holder` is done with the ports; panes nothing else holds read again
+    pub fn resume_serial_monitors(
+        &mut self,
+        holder: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        for index in 0..self.serial_monitors.len() {
+            if self.serial_monitors[index].release(holder) {
+                self.serial_monitors[index].push_line("▶️  Port reopened".to_string());
+                self.start_serial_reader(index, tx.clone());
+            }
+        }
+    }
+
+    /// Close the selected pane and stop its reader
+    pub fn close_serial_monitor(&mut self) {
+        if self.selected_monitor >= self.serial_monitors.len() {
+            return;
+        }
+        let monitor = self.serial_monitors.remove(self.selected_monitor);
+        monitor
+            .stop
+            .store(true, std::sync::atomic::Ordering::Relaxed);
+        self.monitor_recorders.remove(&monitor.port);
+        self.selected_monitor = self
+            .selected_monitor
+            .min(self.serial_monitors.len().saturating_sub(1));
+        if self.serial_monitors.is_empty() {
+            self.show_serial_monitor = false;
+        }
+    }
+
+    /// Switch to the next or previous pane
+    pub fn cycle_serial_monitor(&mut self, forward: bool) {
+        let count = self.serial_monitors.len();
+        if count == 0 {
+            return;
+        }
+        self.selected_monitor = if forward {
+            (self.selected_monitor + 1) % count
+        } else {
+            (self.selected_monitor + count - 1) % count
+        };
+    }
+
+    /// Pane the scroll, pause and clear keys act on; the merged layout has its own
+    pub fn selected_serial_monitor(&mut self) -> Option<&mut SerialMonitor> {
+        if self.monitor_layout == MonitorLayout::Merged {
+            return Some(&mut self.merged_monitor);
+        }
+        self.serial_monitors.get_mut(self.selected_monitor)
+    }
+
+    /// Switch between tabs, tiled panes and the merged view
+    pub fn cycle_monitor_layout(&mut self) {
+        self.monitor_layout = self.monitor_layout.next();
+    }
+
+    /// Filters of the `monitor:` section of `espbrew.yaml`; invalid ones are skipped
+    fn configured_monitor_filter(project_dir: &std::path::Path) -> MonitorFilter {
+        let mut filter = MonitorFilter::default();
+        let Ok(Some(config)) = crate::config::ProjectConfig::load(project_dir) else {
+            return filter;
+        };
+        let section = config.monitor;
+        match section.level.as_deref().map(MonitorLevel::parse) {
+            Some(Some(level)) => filter.level = level,
+            Some(None) => log::warn!("Unknown monitor level in espbrew.yaml"),
+            None => {}
+        }
+        filter.tags = section.tags;
+        for pattern in &section.highlights {
+            match HighlightRule::new(pattern) {
+                Ok(rule) => filter.highlights.push(rule),
+                Err(e) => log::warn!("Invalid monitor highlight '{}': {}", pattern, e),
+            }
+        }
+        filter
+    }
+
+    fn configured_line_ending(project_dir: &std::path::Path) -> LineEnding {
+        let Ok(Some(config)) = crate::config::ProjectConfig::load(project_dir) else {
+            return LineEnding::default();
+        };
+        match config.monitor.line_ending.as_deref().map(LineEnding::parse) {
+            Some(Some(ending)) => ending,
+            Some(None) => {
+                log::warn!("Unknown monitor line_ending in espbrew.yaml");
+                LineEnding::default()
+            }
+            None => LineEnding::default(),
+        }
+    }
+
+    fn configured_plot_rules(project_dir: &std::path::Path) -> Vec<PlotRule> {
+        let Ok(Some(config)) = crate::config::ProjectConfig::load(project_dir) else {
+            return Vec::new();
+        };
+        config
+            .monitor
+            .plot
+            .iter()
+            .filter_map(|pattern| match PlotRule::new(pattern) {
+                Ok(rule) => Some(rule),
+                Err(e) => {
+                    log::warn!("Invalid monitor plot regex '{}': {}", pattern, e);
+                    None
+                }
+            })
+            .collect()
+    }
+
+    /// Plot the selected pane's values instead of showing its lines
+    pub fn toggle_plotter(&mut self) {
+        self.show_plotter = !self.show_plotter;
+    }
+
+    /// Show the memory trends of all panes' devices instead of the lines
+    pub fn toggle_memory_panel(&mut self) {
+        self.show_memory = !self.show_memory;
+    }
+
+    /// Show all levels, warnings and errors or errors only
+    pub fn cycle_monitor_level(&mut self) {
+        self.monitor_filter.level = self.monitor_filter.level.next();
+        self.reset_monitor_scroll();
+    }
+
+    pub fn toggle_monitor_highlights(&mut self) {
+        self.monitor_filter.highlighting = !self.monitor_filter.highlighting;
+    }
+
+    /// Start typing the tags to show, a regex to highlight or a line to send
+    pub fn start_monitor_input(&mut self, input: MonitorInput) {
+        let text = match input {
+            MonitorInput::Tags => self.monitor_filter.tags.join(","),
+            MonitorInput::Highlight | MonitorInput::Console => String::new(),
+            // The only script is the one to run
+            MonitorInput::Script => match self.console_scripts.as_slice() {
+                [script] => script.name.clone(),
+                _ => String::new(),
+            },
+        };
+        self.console_history.reset();
+        self.monitor_input = Some((input, text));
+    }
+
+    /// Apply the tags or highlight being typed, an empty input clearing them,
+    /// or send the console line and start the next one
+    pub fn submit_monitor_input(&mut self) -> Result<()> {
+        let Some((input, text)) = self.monitor_input.take() else {
+            return Ok(());
+        };
+        match input {
+            MonitorInput::Console => {
+                let line = self.console_line_ending.terminate(&text);
+                self.send_to_console(line);
+                self.console_history.push(&text);
+                self.monitor_input = Some((MonitorInput::Console, String::new()));
+            }
+            MonitorInput::Script => self.run_console_script(text.trim()),
+            MonitorInput::Tags => {
+                self.monitor_filter.tags = parse_tags(&text);
+                self.reset_monitor_scroll();
+            }
+            MonitorInput::Highlight if text.trim().is_empty() => {
+                self.monitor_filter.highlights.clear();
+            }
+            MonitorInput::Highlight => {
+                let rule = HighlightRule::new(text.trim())?;
+                self.monitor_filter.highlights.push(rule);
+                self.monitor_filter.highlighting = true;
+            }
+        }
+        Ok(())
+    }
+
+    /// Put the previous or next line sent in the console input
+    pub fn recall_console_line(&mut self, older: bool) {
+        let Some((MonitorInput::Console, text)) = &mut self.monitor_input else {
+            return;
+        };
+        let recalled = if older {
+            self.console_history.previous()
+        } else {
+            self.console_history.next()
+        };
+        match recalled {
+            Some(line) => *text = line.to_string(),
+            // Past the newest line an older one stays, or typing goes on
+            None if older => {}
+            None => text.clear(),
+        }
+    }
+
+    pub fn cycle_console_line_ending(&mut self) {
+        self.console_line_ending = self.console_line_ending.next();
+    }
+
+    /// Send a control character, e.g. Ctrl-C interrupting a MicroPython REPL
+    pub fn send_console_control(&mut self, key: char) {
+        if key.is_ascii_alphabetic() {
+            self.send_to_console(vec![key.to_ascii_uppercase() as u8 - b'@']);
+        }
+    }
+
+    /// Write to the selected pane's device, noting in the pane when it can't
+    fn send_to_console(&mut self, data: Vec<u8>) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        if !monitor.send_console(data) {
+            monitor.push_line(format!("⌨️  Not sent, {} isn't open", monitor.port));
+        }
+    }
+
+    /// Run the named console script against the selected pane's device, or
+    /// stop the one running there
+    pub fn start_or_stop_console_script(&mut self) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        if let Some(script) = monitor.script.take() {
+            monitor.push_line(format!("📜 Script {} stopped", script.script.name));
+            return;
+        }
+        if self.console_scripts.is_empty() {
+            monitor.push_line(
+                "📜 No scripts, add them to monitor: scripts: in espbrew.yaml".to_string(),
+            );
+            return;
+        }
+        self.start_monitor_input(MonitorInput::Script);
+    }
+
+    fn run_console_script(&mut self, name: &str) {
+        let Some(monitor) = self.serial_monitors.get_mut(self.selected_monitor) else {
+            return;
+        };
+        let Some(script) = self.console_scripts.iter().find(|s| s.name == name) else {
+            monitor.push_line(format!("📜 No script named '{}'", name));
+            return;
+        };
+        monitor.push_line(format!("📜 Running script {}", script.name));
+        monitor.script = Some(ScriptRun::start(script.clone(), std::time::Instant::now()));
+        self.poll_console_scripts();
+    }
+
+    /// Take the steps of the running scripts that are due, e.g. on a tick
+    pub fn poll_console_scripts(&mut self) {
+        let now = std::time::Instant::now();
+        for index in 0..self.serial_monitors.len() {
+            let monitor = &mut self.serial_monitors[index];
+            let partial = String::from_utf8_lossy(&monitor.partial).to_string();
+            let Some(script) = &mut monitor.script else {
+                continue;
+            };
+            let events = script.poll(&partial, now);
+            self.apply_script_events(index, events);
+        }
+    }
+
+    /// Send the lines a pane's script sent and show how it goes
+    fn apply_script_events(&mut self, index: usize, events: Vec<ScriptEvent>) {
+        let line_ending = self.console_line_ending;
+        let monitor = &mut self.serial_monitors[index];
+        for event in events {
+            let Some(name) = monitor.script.as_ref().map(|s| s.script.name.clone()) else {
+                return;
+            };
+            match event {
+                ScriptEvent::Send(line) => {
+                    if monitor.send_console(line_ending.terminate(&line)) {
+                        monitor.push_line(format!("📜 → {}", line));
+                    } else {
+                        monitor.script = None;
+                        monitor.push_line(format!(
+                            "📜 ❌ Script {} failed: {} isn't open",
+                            name, monitor.port
+                        ));
+                    }
+                }
+                ScriptEvent::Matched(output) => monitor.push_line(format!("📜 ✓ {}", output)),
+                ScriptEvent::Passed => {
+                    monitor.script = None;
+                    monitor.push_line(format!("📜 ✅ Script {} passed", name));
+                }
+                ScriptEvent::Failed(error) => {
+                    monitor.script = None;
+                    monitor.push_line(format!("📜 ❌ Script {} failed: {}", name, error));
+                }
+            }
+        }
+    }
+
+    /// Changed filters show other lines, so the panes follow the output again
+    fn reset_monitor_scroll(&mut self) {
+        for monitor in &mut self.serial_monitors {
+            monitor.scroll_offset = 0;
+        }
+        self.merged_monitor.scroll_offset = 0;
+    }
+
+    /// Read the selected pane's port again after its reader stopped
+    pub fn reconnect_serial_monitor(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if self
+            .serial_monitors
+            .get(self.selected_monitor)
+            .is_some_and(|m| matches!(m.state, MonitorState::Closed(_)))
+        {
+            self.start_serial_reader(self.selected_monitor, tx);
+        }
+    }
+
+    /// Open the OTA panel; the first time it updates all `ota:` devices
+    pub fn open_ota(&mut self, tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>) {
+        self.show_ota = true;
+        if self.ota_rollout.is_none() {
+            self.start_ota_rollout(tx);
+        }
+    }
+
+    /// Send each device of the `ota:` section the app binary of its board
+    pub fn start_ota_rollout(
+        &mut self,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        if self
+            .ota_rollout
+            .as_ref()
+            .is_some_and(|run| run.is_running())
+        {
+            return;
+        }
+        self.ota_rollout = Some(OtaRollout {
+            preparing: true,
+            ..Default::default()
+        });
+
+        let boards: Vec<ProjectBoardConfig> = self
+            .boards
+            .iter()
+            .filter(|board| board.workspace.is_none())
+            .map(|board| ProjectBoardConfig {
+                name: board.name.clone(),
+                config_file: board.config_file.clone(),
+                build_dir: board.build_dir.clone(),
+                target: board.target.clone(),
+                project_type: board.project_type.clone(),
+            })
+            .collect();
+        let project_dir = self.project_dir.clone();
+        tokio::spawn(async move {
+            let section = match crate::config::ProjectConfig::load(&project_dir) {
+                Ok(config) => config.map(|config| config.ota).unwrap_or_default(),
+                Err(e) => {
+                    let _ = tx.send(crate::models::AppEvent::OtaRolloutStarted(
+                        Vec::new(),
+                        Some(e.to_string()),
+                    ));
+                    return;
+                }
+            };
+            let targets = match ota::plan_rollout(&section, &boards, &[], &[]) {
+                Ok(targets) if targets.is_empty() => {
+                    let _ = tx.send(crate::models::AppEvent::OtaRolloutStarted(
+                        Vec::new(),
+                        Some("No OTA devices in the ota: section of espbrew.yaml".to_string()),
+                    ));
+                    return;
+                }
+                Ok(targets) => targets,
+                Err(e) => {
+                    let _ = tx.send(crate::models::AppEvent::OtaRolloutStarted(
+                        Vec::new(),
+                        Some(e.to_string()),
                     ));
+                    return;
                 }
-            }
-            Ok(())
-        } else {
-            let status = response.status();
-            let error_text = response
-                .text()
-                .await
-                .unwrap_or_else(|_| "Unknown error".to_string());
-            let _ = tx.send(crate::models::AppEvent::BuildOutput(
-                "remote".to_string(),
-                format!(
-                    "❌ Server rejected flash request ({}): {}",
-                    status, error_text
-                ),
+            };
+            let names: Vec<String> = targets
+                .iter()
+                .map(|target| target.device.name.clone())
+                .collect();
+            let _ = tx.send(crate::models::AppEvent::OtaRolloutStarted(
+                names.clone(),
+                None,
             ));
-            Err(anyhow::anyhow!(
-                "Server rejected flash request: {}",
-                error_text
-            ))
+            // Failing to serve the images fails every device
+            if let Err(e) = ota::deploy(&project_dir, &section, targets, tx.clone()).await {
+                for name in names {
+                    let _ = tx.send(crate::models::AppEvent::OtaStatusChanged(
+                        name,
+                        OtaStatus::Failed(e.to_string()),
+                    ));
+                }
+            }
+        });
+    }
+
+    pub fn handle_ota_rollout_started(&mut self, devices: Vec<String>, error: Option<String>) {
+        let Some(rollout) = self.ota_rollout.as_mut() else {
+            return;
+        };
+        rollout.preparing = false;
+        rollout.error = error;
+        rollout.devices = devices
+            .into_iter()
+            .map(|name| (name, OtaStatus::Pending))
+            .collect();
+    }
+
+    pub fn handle_ota_status(&mut self, device: &str, status: OtaStatus) {
+        if let Some((_, current)) = self
+            .ota_rollout
+            .as_mut()
+            .and_then(|rollout| rollout.devices.iter_mut().find(|(name, _)| name == device))
+        {
+            *current = status;
         }
     }
 
-    /// Build the currently selected board
-    pub async fn build_selected_board(
+    /// Rebuild the watched boards affected by changed sources; boards that
+    /// are still building pick the change up on the next round
+    pub async fn rebuild_changed_boards(
         &mut self,
+        changed: Vec<PathBuf>,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
-    ) -> Result<()> {
-        if self.selected_board >= self.boards.len() {
-            return Err(anyhow::anyhow!("No board selected"));
-        }
-
-        let board = &self.boards[self.selected_board];
-        let board_name = board.name.clone();
-
-        // Set build in progress
-        self.build_in_progress = true;
+    ) -> Result<usize> {
+        let board_project_dir = |board: &BoardConfig| {
+            board
+                .workspace
+                .as_ref()
+                .map(|w| w.project_dir.clone())
+                .unwrap_or_else(|| self.project_dir.clone())
+        };
 
-        // Update board status to building
-        self.boards[self.selected_board].status = BuildStatus::Building;
+        let mut affected = Vec::new();
+        for (i, board) in self.boards.iter().enumerate() {
+            if matches!(board.status, BuildStatus::Building)
+                || (!self.watch_boards.is_empty() && !self.watch_boards.contains(&board.name))
+            {
+                continue;
+            }
+            let project_dir = board_project_dir(board);
+            let project_configs: Vec<PathBuf> = self
+                .boards
+                .iter()
+                .filter(|other| board_project_dir(other) == project_dir)
+                .map(|other| other.config_file.clone())
+                .collect();
+            if affects_board(&project_dir, &board.config_file, &project_configs, &changed) {
+                affected.push(i);
+            }
+        }
 
-        // Add build start message to logs
-        self.add_log_line(
-            &board_name,
-            format!("🔨 Starting build for {}...", board_name),
-        );
+        let original_selection = self.selected_board;
+        let changes = describe_changes(&self.project_dir, &changed);
+        for &i in &affected {
+            let board_name = self.boards[i].name.clone();
+            self.boards[i].status = BuildStatus::Building;
+            self.add_log_line(
+                &board_name,
+                format!("🔄 {} changed, rebuilding {}", changes, board_name),
+            );
+            self.selected_board = i;
+            if let Err(e) = self.execute_action(BoardAction::Build, tx.clone()).await {
+                self.boards[i].status = BuildStatus::Failed;
+                self.add_log_line(&board_name, format!("❌ Rebuild failed: {}", e));
+            }
+        }
+        self.selected_board = original_selection;
 
-        // Execute build action
-        let tx_clone = tx.clone();
-        let build_result = self.execute_action(BoardAction::Build, tx_clone).await;
+        Ok(affected.len())
+    }
 
-        // Reset build in progress flag
-        self.build_in_progress = false;
+    /// Open the boards × profiles matrix, or close it if it is open
+    pub fn toggle_profile_matrix(&mut self) {
+        if self.profile_matrix.take().is_some() {
+            return;
+        }
 
-        match build_result {
-            Ok(()) => {
-                self.add_log_line(&board_name, "✅ Build initiated successfully".to_string());
-                Ok(())
+        let names: Vec<String> = self.boards.iter().map(|b| b.name.clone()).collect();
+        let matrix = crate::config::ProjectConfig::load(&self.project_dir)
+            .ok()
+            .flatten()
+            .and_then(|config| ProfileMatrix::from_board_names(&config, &names));
+        match matrix {
+            Some(matrix) => {
+                self.matrix_cursor = (0, 0);
+                self.profile_matrix = Some(matrix);
             }
-            Err(e) => {
-                self.boards[self.selected_board].status = BuildStatus::Failed;
-                self.add_log_line(&board_name, format!("❌ Build initiation failed: {}", e));
-                Err(e)
+            None => {
+                if let Some(board) = self.boards.get(self.selected_board) {
+                    let board_name = board.name.clone();
+                    self.add_log_line(
+                        &board_name,
+                        "ℹ️ No build profiles: add a profiles: section to espbrew.yaml".to_string(),
+                    );
+                }
             }
         }
     }
 
-    /// Build all boards (sequential or parallel based on build strategy)
-    pub async fn build_all_boards(
+    /// Move the matrix cursor, staying inside the grid
+    pub fn move_matrix_cursor(&mut self, rows: isize, columns: isize) {
+        let Some(matrix) = &self.profile_matrix else {
+            return;
+        };
+        let (row, column) = self.matrix_cursor;
+        self.matrix_cursor = (
+            row.saturating_add_signed(rows)
+                .min(matrix.boards.len().saturating_sub(1)),
+            column
+                .saturating_add_signed(columns)
+                .min(matrix.profiles.len().saturating_sub(1)),
+        );
+    }
+
+    /// Build the cell, row or column of the matrix under the cursor
+    pub async fn build_matrix_selection(
         &mut self,
+        selection: MatrixSelection,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
     ) -> Result<()> {
-        if self.boards.is_empty() {
-            return Err(anyhow::anyhow!("No boards to build"));
-        }
+        let matrix = self
+            .profile_matrix
+            .as_ref()
+            .ok_or_else(|| anyhow::anyhow!("Profile matrix is not open"))?;
+        let (row, column) = self.matrix_cursor;
+
+        let (names, label): (Vec<String>, String) = match selection {
+            MatrixSelection::Cell => (
+                matrix
+                    .cell(row, column)
+                    .into_iter()
+                    .map(String::from)
+                    .collect(),
+                "profile matrix cell".to_string(),
+            ),
+            MatrixSelection::Row => (
+                matrix.row(row).into_iter().map(String::from).collect(),
+                format!("board {}", matrix.boards[row]),
+            ),
+            MatrixSelection::Column => (
+                matrix
+                    .column(column)
+                    .into_iter()
+                    .map(String::from)
+                    .collect(),
+                format!("profile {}", matrix.profiles[column]),
+            ),
+        };
 
-        // Set build in progress
-        self.build_in_progress = true;
+        let indices: Vec<usize> = self
+            .boards
+            .iter()
+            .enumerate()
+            .filter(|(_, b)| names.contains(&b.name))
+            .map(|(i, _)| i)
+            .collect();
+        if indices.is_empty() {
+            return Err(anyhow::anyhow!("No board in the selected matrix cells"));
+        }
 
-        let board_count = self.boards.len();
+        self.build_board_group(indices, &label, tx).await
+    }
 
-        // Update all board statuses first
-        let build_strategy_debug = format!("{:?}", self.build_strategy);
-        for board in &mut self.boards {
-            board.status = BuildStatus::Pending;
-        }
+    /// Build a group of boards one after another
+    async fn build_board_group(
+        &mut self,
+        indices: Vec<usize>,
+        label: &str,
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) -> Result<()> {
+        self.build_in_progress = true;
+        let original_selection = self.selected_board;
+        self.prepare_board_builds(&indices, tx.clone()).await;
 
-        // Then add log messages
-        let board_names: Vec<String> = self.boards.iter().map(|b| b.name.clone()).collect();
-        for board_name in &board_names {
+        for i in indices {
+            let board_name = self.boards[i].name.clone();
             self.add_log_line(
-                board_name,
-                format!("📅 Queued for build (strategy: {})", build_strategy_debug),
+                &board_name,
+                format!("🔨 Building {} as part of {}", board_name, label),
             );
-        }
 
-        // Log overall build start
-        if !self.boards.is_empty() {
-            let first_board_name = self.boards[0].name.clone();
-            self.add_log_line(
-                &first_board_name,
-                format!(
-                    "🔨 Starting build for {} boards using {} strategy...",
-                    board_count, build_strategy_debug
-                ),
-            );
+            self.selected_board = i;
+            if let Err(e) = self.execute_action(BoardAction::Build, tx.clone()).await {
+                self.boards[i].status = BuildStatus::Failed;
+                self.add_log_line(
+                    &board_name,
+                    format!("❌ Build {} failed: {}", board_name, e),
+                );
+            }
         }
 
-        let result = match self.build_strategy {
-            BuildStrategy::Sequential => self.build_all_sequential(tx.clone()).await,
-            BuildStrategy::Parallel => self.build_all_parallel(tx.clone()).await,
-            BuildStrategy::IdfBuildApps => self.build_all_idf_build_apps(tx.clone()).await,
-        };
-
-        // Reset build in progress flag
+        self.selected_board = original_selection;
         self.build_in_progress = false;
+        Ok(())
+    }
 
-        match result {
-            Ok(success_count) => {
-                if !self.boards.is_empty() {
-                    let first_board_name = self.boards[0].name.clone();
-                    self.add_log_line(
-                        &first_board_name,
-                        format!(
-                            "✅ Build all completed: {}/{} boards successful",
-                            success_count, board_count
-                        ),
-                    );
-                }
-                Ok(())
+    /// Let each project's handler fetch shared dependencies once before its boards build
+    async fn prepare_board_builds(
+        &mut self,
+        indices: &[usize],
+        tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
+    ) {
+        // Workspace boards are grouped per project, each with its own handler
+        let mut groups: Vec<(PathBuf, ProjectType, Vec<(String, ProjectBoardConfig)>)> = Vec::new();
+        for &i in indices {
+            let board = &self.boards[i];
+            let (project_dir, handler_board_name, project_type) = match &board.workspace {
+                Some(member) => (
+                    member.project_dir.clone(),
+                    member.board_name.clone(),
+                    Some(board.project_type.clone()),
+                ),
+                None => (
+                    self.project_dir.clone(),
+                    board.name.clone(),
+                    self.project_handler.as_ref().map(|h| h.project_type()),
+                ),
+            };
+            let Some(project_type) = project_type else {
+                continue;
+            };
+
+            let board_config = ProjectBoardConfig {
+                name: handler_board_name,
+                config_file: board.config_file.clone(),
+                build_dir: board.build_dir.clone(),
+                target: board.target.clone(),
+                project_type: project_type.clone(),
+            };
+            match groups.iter_mut().find(|(dir, _, _)| *dir == project_dir) {
+                Some((_, _, boards)) => boards.push((board.name.clone(), board_config)),
+                None => groups.push((
+                    project_dir,
+                    project_type,
+                    vec![(board.name.clone(), board_config)],
+                )),
             }
-            Err(e) => {
-                if !self.boards.is_empty() {
-                    let first_board_name = self.boards[0].name.clone();
-                    self.add_log_line(&first_board_name, format!("❌ Build all failed: {}", e));
-                }
-                Err(e)
+        }
+
+        for (project_dir, project_type, boards) in groups {
+            let handler = ProjectRegistry::create_handler(project_type);
+            let (first_board_name, first_config) = &boards[0];
+            let relay = Self::relay_board_events(first_board_name, &first_config.name, tx.clone());
+            let first_board_name = first_board_name.clone();
+            let configs: Vec<ProjectBoardConfig> =
+                boards.into_iter().map(|(_, config)| config).collect();
+
+            if let Err(e) = crate::projects::retry::prepare_build_with_retries(
+                handler.as_ref(),
+                &project_dir,
+                &configs,
+                relay,
+            )
+            .await
+            {
+                self.add_log_line(
+                    &first_board_name,
+                    format!(
+                        "⚠️  Dependency prefetch failed, boards will resolve them individually: {}",
+                        e
+                    ),
+                );
             }
         }
     }
@@ -3978,7 +7712,7 @@ echo "🎉 Clean all completed!"
     ) -> Result<usize> {
         let mut success_count = 0;
 
-        for i in 0..self.boards.len() {
+        for (position, i) in self.build_order().into_iter().enumerate() {
             let board_name = self.boards[i].name.clone();
             self.boards[i].status = BuildStatus::Building;
 
@@ -3987,7 +7721,7 @@ echo "🎉 Clean all completed!"
                 format!(
                     "🔨 Building {} ({}/{})",
                     board_name,
-                    i + 1,
+                    position + 1,
                     self.boards.len()
                 ),
             );
@@ -4022,58 +7756,45 @@ echo "🎉 Clean all completed!"
         Ok(success_count)
     }
 
-    /// Build all boards in parallel
+    /// Build all boards in parallel, as many at once as the build scheduler allows
     async fn build_all_parallel(
         &mut self,
         tx: tokio::sync::mpsc::UnboundedSender<crate::models::AppEvent>,
     ) -> Result<usize> {
-        // For parallel builds, we need to be more careful about shared state
-        let mut build_tasks = Vec::new();
-
-        let board_names: Vec<String> = self.boards.iter().map(|b| b.name.clone()).collect();
-        for board in &mut self.boards {
-            board.status = BuildStatus::Building;
-        }
-
-        for board_name in &board_names {
-            self.add_log_line(
-                board_name,
-                format!("🔨 Starting parallel build for {}", board_name),
-            );
-        }
+        let settings = self.build_scheduler.settings().clone();
+        let limits = match settings.max_load {
+            Some(max_load) => format!("{} slot(s), max load {:.1}", settings.jobs, max_load),
+            None => format!("{} slot(s)", settings.jobs),
+        };
 
-        // Create build tasks (simplified - in reality this would need more coordination)
-        for i in 0..self.boards.len() {
+        let original_selection = self.selected_board;
+        let mut started = 0;
+        for i in self.build_order() {
             let board_name = self.boards[i].name.clone();
-            let tx_task = tx.clone();
-
-            // For now, just queue them with a small delay to avoid resource conflicts
-            let delay_ms = i as u64 * 1000; // 1 second delay between starts
-
-            build_tasks.push(tokio::spawn(async move {
-                tokio::time::sleep(tokio::time::Duration::from_millis(delay_ms)).await;
-                let _ = tx_task.send(crate::models::AppEvent::BuildOutput(
-                    board_name.clone(),
-                    format!("🔨 Parallel build for {} (simulated)", board_name),
-                ));
-
-                // Simulate build time
-                tokio::time::sleep(tokio::time::Duration::from_secs(2)).await;
-
-                let _ = tx_task.send(crate::models::AppEvent::ActionFinished(
-                    board_name,
-                    "Parallel Build".to_string(),
-                    true, // Assume success for now
-                ));
-            }));
-        }
-
-        // Wait for all tasks to complete
-        for task in build_tasks {
-            let _ = task.await;
+            self.selected_board = i;
+            match self.execute_action(BoardAction::Build, tx.clone()).await {
+                Ok(()) => {
+                    started += 1;
+                    self.add_log_line(
+                        &board_name,
+                        format!(
+                            "🔨 Parallel build for {} scheduled ({})",
+                            board_name, limits
+                        ),
+                    );
+                }
+                Err(e) => {
+                    self.boards[i].status = BuildStatus::Failed;
+                    self.add_log_line(
+                        &board_name,
+                        format!("❌ Build {} failed: {}", board_name, e),
+                    );
+                }
+            }
         }
+        self.selected_board = original_selection;
 
-        Ok(self.boards.len()) // Assume all succeeded for now
+        Ok(started)
     }
 
     /// Build all boards using idf-build-apps (professional mode)
@@ -4133,15 +7854,22 @@ echo "🎉 Clean all completed!"
                     project_boards
                         .into_iter()
                         .map(|board| BoardConfig {
+                            tags: board_tags(
+                                &self.project_dir,
+                                &board.name,
+                                board.target.as_deref(),
+                            ),
                             name: board.name,
                             config_file: board.config_file,
                             build_dir: board.build_dir,
                             status: BuildStatus::Pending,
                             log_lines: Vec::new(),
+                            log_resets: 0,
                             build_time: None,
                             last_updated: Local::now(),
                             target: board.target,
                             project_type: board.project_type,
+                            workspace: None,
                         })
                         .collect()
                 }
@@ -4158,7 +7886,12 @@ echo "🎉 Clean all completed!"
                 "system".to_string(),
                 "Using fallback ESP-IDF board discovery".to_string(),
             ));
-            Self::discover_boards(&self.project_dir)?
+            let boards = Self::discover_boards(&self.project_dir)?;
+            if boards.is_empty() {
+                Self::discover_workspace_boards(&self.project_dir)
+            } else {
+                boards
+            }
         };
 
         // Load existing logs for new boards
@@ -4170,8 +7903,12 @@ echo "🎉 Clean all completed!"
         let old_count = self.boards.len();
         let new_count = refreshed_boards.len();
 
-        // Update board list
+        // Update board list, keeping the active filters
         self.boards = refreshed_boards;
+        self.hidden_boards.clear();
+        if self.tag_filter.is_some() || self.list_filter.is_some() {
+            self.filter_boards();
+        }
 
         // Try to restore selection to the same board name if it still exists
         if let Some(board_name) = current_board_name {
@@ -1,10 +1,16 @@
 //! Terminal User Interface components
 
 pub mod app;
+pub mod board_picker;
 pub mod components;
 pub mod event_loop;
 pub mod events;
+pub mod keymap;
 pub mod main_app;
+pub mod palette;
+pub mod serial_monitor;
+pub mod theme;
+pub mod tui_state;
 pub mod ui;
 
 #[cfg(test)]
@@ -0,0 +1,282 @@
+//! Command palette of the TUI
+//!
+//! **Ctrl+P** (or **:**) lists every action of the main view, every board
+//! action of each listed board and a monitor of each connected device, e.g.
+//! `Build esp32s3`, `Flash App Only esp32c3` or `Monitor /dev/ttyACM0`.
+//! Typing narrows the list by fuzzy matching: the typed characters appear in
+//! order, best where they start words or follow each other, so `flc3` finds
+//! `Flash esp32c3`. Enter runs the selected command.
+
+use crossterm::event::KeyCode;
+
+use crate::cli::tui::keymap::{ACTIONS, Keymap};
+use crate::models::board::BoardAction;
+
+/// Main view actions the palette leaves out: moving around, and itself
+const UNLISTED_ACTIONS: &[&str] = &[
+    "up",
+    "down",
+    "page_up",
+    "page_down",
+    "top",
+    "bottom",
+    "back",
+    "next_match",
+    "previous_match",
+    "command_palette",
+];
+
+/// Where and how well a query matched a text
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct FuzzyMatch {
+    pub score: i32,
+    /// Indexes of the matched characters of the text
+    pub positions: Vec<usize>,
+}
+
+fn starts_word(chars: &[char], index: usize) -> bool {
+    index == 0 || matches!(chars[index - 1], ' ' | '_' | '-' | '/' | ':' | '.')
+}
+
+/// The query's characters in order in the text, ignoring case; matches
+/// starting words and runs of adjacent characters score higher, gaps lower
+pub fn fuzzy_match(query: &str, text: &str) -> Option<FuzzyMatch> {
+    let query: Vec<char> = query
+        .chars()
+        .filter(|c| !c.is_whitespace())
+        .flat_map(char::to_lowercase)
+        .collect();
+    let original: Vec<char> = text.chars().collect();
+    let chars: Vec<char> = original
+        .iter()
+        .map(|c| c.to_lowercase().next().unwrap_or(*c))
+        .collect();
+    if query.is_empty() {
+        return Some(FuzzyMatch {
+            score: 0,
+            positions: Vec::new(),
+        });
+    }
+
+    // Each place the first character matches is tried, the rest matched as
+    // early as possible from there
+    let mut best: Option<FuzzyMatch> = None;
+    for start in (0..chars.len()).filter(|&i| chars[i] == query[0]) {
+        let mut positions = vec![start];
+        let mut next = start + 1;
+        for c in &query[1..] {
+            match chars[next..].iter().position(|other| other == c) {
+                Some(offset) => {
+                    positions.push(next + offset);
+                    next += offset + 1;
+                }
+                None => break,
+            }
+        }
+        if positions.len() < query.len() {
+            break;
+        }
+
+        let mut score = 0;
+        for (n, &position) in positions.iter().enumerate() {
+            score += 1;
+            if starts_word(&original, position) {
+                score += 8;
+            }
+            if n > 0 {
+                let gap = position - positions[n - 1] - 1;
+                if gap == 0 {
+                    score += 5;
+                } else {
+                    score -= gap.min(10) as i32;
+                }
+            }
+        }
+        score -= start.min(10) as i32;
+        if best.as_ref().is_none_or(|best| score > best.score) {
+            best = Some(FuzzyMatch { score, positions });
+        }
+    }
+    best
+}
+
+/// What a palette entry does
+#[derive(Debug, Clone, PartialEq)]
+pub enum PaletteCommand {
+    /// Action of the main view, as its default key does it
+    Key(KeyCode),
+    /// Action of the action menu on the named board
+    Board(String, BoardAction),
+    /// Monitor of the device on the port
+    MonitorPort(String),
+}
+
+/// A command of the palette
+#[derive(Debug, Clone, PartialEq)]
+pub struct PaletteEntry {
+    pub title: String,
+    /// Keys doing it in the main view, if any
+    pub keys: String,
+    pub command: PaletteCommand,
+}
+
+/// Commands of the palette: the main view's actions, the board actions of
+/// each board, and a monitor of each connected device
+pub fn palette_entries(
+    keymap: &Keymap,
+    boards: &[&str],
+    actions: &[BoardAction],
+    ports: &[String],
+) -> Vec<PaletteEntry> {
+    let mut entries: Vec<PaletteEntry> = ACTIONS
+        .iter()
+        .filter(|action| !UNLISTED_ACTIONS.contains(&action.name))
+        .map(|action| PaletteEntry {
+            title: action.title.to_string(),
+            keys: keymap.label(action.name),
+            command: PaletteCommand::Key(action.defaults[0]),
+        })
+        .collect();
+    for board in boards {
+        entries.extend(actions.iter().map(|action| PaletteEntry {
+            title: format!("{} {}", action.name(), board),
+            keys: String::new(),
+            command: PaletteCommand::Board(board.to_string(), action.clone()),
+        }));
+    }
+    entries.extend(ports.iter().map(|port| PaletteEntry {
+        title: format!("Monitor {}", port),
+        keys: String::new(),
+        command: PaletteCommand::MonitorPort(port.clone()),
+    }));
+    entries
+}
+
+/// The palette while it is open: its commands, the query and the ones
+/// matching it, best first
+#[derive(Debug, Clone)]
+pub struct CommandPalette {
+    pub entries: Vec<PaletteEntry>,
+    pub query: String,
+    /// Index of each matching entry, with its match
+    pub matches: Vec<(usize, FuzzyMatch)>,
+    /// Selected of the matches
+    pub selected: usize,
+}
+
+impl CommandPalette {
+    pub fn new(entries: Vec<PaletteEntry>) -> Self {
+        let mut palette = Self {
+            entries,
+            query: String::new(),
+            matches: Vec::new(),
+            selected: 0,
+        };
+        palette.update_matches();
+        palette
+    }
+
+    /// Match the entries against the query; equally good ones keep their order
+    fn update_matches(&mut self) {
+        let mut matches: Vec<(usize, FuzzyMatch)> = self
+            .entries
+            .iter()
+            .enumerate()
+            .filter_map(|(index, entry)| {
+                fuzzy_match(&self.query, &entry.title).map(|found| (index, found))
+            })
+            .collect();
+        matches.sort_by_key(|(_, found)| std::cmp::Reverse(found.score));
+        self.matches = matches;
+        self.selected = 0;
+    }
+
+    pub fn push(&mut self, c: char) {
+        self.query.push(c);
+        self.update_matches();
+    }
+
+    pub fn pop(&mut self) {
+        self.query.pop();
+        self.update_matches();
+    }
+
+    /// Move the selection, wrapping around the matches
+    pub fn move_selection(&mut self, delta: isize) {
+        let count = self.matches.len() as isize;
+        if count > 0 {
+            self.selected = (self.selected as isize + delta).rem_euclid(count) as usize;
+        }
+    }
+
+    pub fn selected_entry(&self) -> Option<&PaletteEntry> {
+        self.matches
+            .get(self.selected)
+            .map(|(index, _)| &self.entries[*index])
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_command_palette() {
+        let found = fuzzy_match("flc3", "Flash esp32c3").unwrap();
+        assert_eq!(found.positions, [0, 1, 11, 12]);
+        assert!(fuzzy_match("FLASH", "Flash esp32c3").is_some());
+        assert!(fuzzy_match("c3f", "Flash esp32c3").is_none());
+        assert_eq!(
+            fuzzy_match("", "Build").unwrap().positions,
+            Vec::<usize>::new()
+        );
+        // Word starts and adjacent letters beat letters scattered mid-word
+        assert!(
+            fuzzy_match("bu", "Build esp32").unwrap().score
+                > fuzzy_match("bu", "Debug esp32").unwrap().score
+        );
+
+        let entries = palette_entries(
+            &Keymap::default(),
+            &["esp32s3", "esp32c3"],
+            &[BoardAction::Build, BoardAction::Flash],
+            &["/dev/ttyACM0".to_string()],
+        );
+        let titles: Vec<&str> = entries.iter().map(|e| e.title.as_str()).collect();
+        assert!(titles.contains(&"Build Selected"));
+        assert!(!titles.contains(&"Up"));
+        assert!(!titles.contains(&"Commands"));
+        let build = entries
+            .iter()
+            .find(|e| e.title == "Build Selected")
+            .unwrap();
+        assert_eq!(build.keys, "b/Space");
+        assert_eq!(build.command, PaletteCommand::Key(KeyCode::Char('b')));
+        assert_eq!(
+            entries.last().unwrap().command,
+            PaletteCommand::MonitorPort("/dev/ttyACM0".to_string())
+        );
+
+        let mut palette = CommandPalette::new(entries.clone());
+        assert_eq!(palette.matches.len(), entries.len());
+        palette.move_selection(-1);
+        assert_eq!(palette.selected, entries.len() - 1);
+
+        for c in "flc3".chars() {
+            palette.push(c);
+        }
+        assert_eq!(palette.selected, 0);
+        let entry = palette.selected_entry().unwrap();
+        assert_eq!(entry.title, "Flash esp32c3");
+        assert_eq!(
+            entry.command,
+            PaletteCommand::Board("esp32c3".to_string(), BoardAction::Flash)
+        );
+
+        palette.pop();
+        palette.pop();
+        palette.push('z');
+        palette.push('q');
+        assert!(palette.selected_entry().is_none());
+    }
+}
@@ -0,0 +1,251 @@
+//! Readers of the TUI's serial monitor panes
+//!
+//! Each pane has a reader sending what its port prints as
+//! [`AppEvent::SerialOutput`] and writing what the pane's console input sends
+//! to the device, until the pane stops it, e.g. to release the
+//! port for a flash, or the TUI exits. Reads time out after [`READ_TIMEOUT`]
+//! to check for that, so a port is free again [`PORT_RELEASE_DELAY`] after
+//! its reader was stopped. Lines with code addresses go to the pane's
+//! backtrace decoder, whose frames come back as [`AppEvent::SerialDecoded`].
+//! The defmt frames of firmware logging with defmt go to the pane's
+//! `defmt-print`, whose lines come back as [`AppEvent::SerialDefmt`].
+//! A USB device whose port goes away, e.g. an S3 resetting with its native
+//! USB port, is waited for and its port reopened, reported with
+//! [`AppEvent::SerialReconnecting`] and [`AppEvent::SerialReconnected`], so
+//! the pane goes on where it was.
+
+use anyhow::{Context, Result};
+use std::io::{Read, Write};
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::time::{Duration, Instant};
+use tokio::sync::mpsc;
+
+use crate::models::AppEvent;
+use crate::utils::backtrace::BacktraceDecoder;
+use crate::utils::defmt::DefmtDecoder;
+use crate::utils::native_usb::{RECONNECT_TIMEOUT, usb_device, wait_for_reconnect};
+use crate::utils::serial_tcp::{NetworkPort, NetworkSerial, is_network_port};
+
+/// Baud rate of the panes, the ESP-IDF console's default
+pub const MONITOR_BAUD_RATE: u32 = 115200;
+const READ_TIMEOUT: Duration = Duration::from_millis(100);
+/// Time for stopped readers to close their ports
+pub const PORT_RELEASE_DELAY: Duration = Duration::from_millis(250);
+/// A port failing this soon after it was reopened didn't really come back
+const RECONNECT_STABLE: Duration = Duration::from_secs(1);
+/// Reopened ports failing that soon in a row before the reader gives up
+const MAX_UNSTABLE_RECONNECTS: usize = 5;
+
+/// Read `port` for the pane until `stop` is set; what is sent to the
+/// returned sender is written to the device
+pub fn spawn_serial_reader(
+    port: String,
+    baud_rate: u32,
+    reader: u64,
+    stop: Arc<AtomicBool>,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> mpsc::UnboundedSender<Vec<u8>> {
+    let (console, mut input) = mpsc::unbounded_channel::<Vec<u8>>();
+    tokio::spawn(async move {
+        let (port, result) = if is_network_port(&port) {
+            let result = read_network_port(&port, baud_rate, reader, &stop, &mut input, &tx).await;
+            (port, result)
+        } else {
+            read_local_device(port, baud_rate, reader, &stop, input, &tx).await
+        };
+        let _ = tx.send(AppEvent::SerialClosed(
+            port,
+            reader,
+            result.err().map(|e| format!("{:#}", e)),
+        ));
+    });
+    console
+}
+
+/// Decode the lines sent for the pane one after the other, so their frames
+/// come in the order the lines were printed
+pub fn spawn_backtrace_decoder(
+    port: String,
+    reader: u64,
+    decoder: BacktraceDecoder,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> mpsc::UnboundedSender<String> {
+    let (lines_tx, mut lines) = mpsc::unbounded_channel::<String>();
+    tokio::spawn(async move {
+        let mut decoder = decoder;
+        while let Some(line) = lines.recv().await {
+            // addr2line runs off the async threads
+            let Ok((returned, line, frames)) = tokio::task::spawn_blocking(move || {
+                let frames = decoder.decode_line(&line);
+                (decoder, line, frames)
+            })
+            .await
+            else {
+                return;
+            };
+            decoder = returned;
+            if !frames.is_empty()
+                && tx
+                    .send(AppEvent::SerialDecoded(port.clone(), reader, line, frames))
+                    .is_err()
+            {
+                return;
+            }
+        }
+    });
+    lines_tx
+}
+
+/// Decode the defmt frames sent for the pane with the format strings in `elf`
+pub fn spawn_defmt_decoder(
+    port: String,
+    reader: u64,
+    elf: &std::path::Path,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<mpsc::UnboundedSender<Vec<u8>>> {
+    let mut decoder = DefmtDecoder::spawn(elf, move |line| {
+        let _ = tx.send(AppEvent::SerialDefmt(port.clone(), reader, line));
+    })?;
+    let (frames_tx, mut frames) = mpsc::unbounded_channel::<Vec<u8>>();
+    // defmt-print stops with the decoder once the pane drops the sender
+    std::thread::spawn(move || {
+        while let Some(frame) = frames.blocking_recv() {
+            if decoder.decode(&frame).is_err() {
+                return;
+            }
+        }
+    });
+    Ok(frames_tx)
+}
+
+/// Read a local port, reopening it whenever its USB device comes back after
+/// the port went away; the port last read and why reading stopped
+async fn read_local_device(
+    mut port: String,
+    baud_rate: u32,
+    reader: u64,
+    stop: &Arc<AtomicBool>,
+    mut input: mpsc::UnboundedReceiver<Vec<u8>>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> (String, Result<()>) {
+    let device = usb_device(&port);
+    let mut unstable = 0;
+    loop {
+        let opened = Instant::now();
+        let (name, stop_reader, tx_reader) = (port.clone(), stop.clone(), tx.clone());
+        // The input goes to the blocking reader and back for the next port
+        let read = tokio::task::spawn_blocking(move || {
+            let result = read_local_port(
+                &name,
+                baud_rate,
+                reader,
+                &stop_reader,
+                &mut input,
+                &tx_reader,
+            );
+            (input, result)
+        })
+        .await;
+        let result = match read {
+            Ok((returned, result)) => {
+                input = returned;
+                result
+            }
+            Err(e) => return (port, Err(anyhow::anyhow!("Serial reader failed: {}", e))),
+        };
+        let (Err(e), Some(device)) = (&result, &device) else {
+            return (port, result);
+        };
+        unstable = if opened.elapsed() < RECONNECT_STABLE {
+            unstable + 1
+        } else {
+            0
+        };
+        if unstable > MAX_UNSTABLE_RECONNECTS {
+            return (port, result);
+        }
+        let _ = tx.send(AppEvent::SerialReconnecting(
+            port.clone(),
+            reader,
+            format!("{:#}", e),
+        ));
+        let cancelled = || stop.load(Ordering::Relaxed) || tx.is_closed();
+        match wait_for_reconnect(&port, device, RECONNECT_TIMEOUT, cancelled).await {
+            Some(found) => {
+                let _ = tx.send(AppEvent::SerialReconnected(port, reader, found.clone()));
+                port = found;
+            }
+            None if cancelled() => return (port, Ok(())),
+            None => {
+                let error = anyhow::anyhow!(
+                    "{} didn't come back within {}s",
+                    port,
+                    RECONNECT_TIMEOUT.as_secs()
+                );
+                return (port, Err(error));
+            }
+        }
+    }
+}
+
+fn read_local_port(
+    port: &str,
+    baud_rate: u32,
+    reader: u64,
+    stop: &AtomicBool,
+    input: &mut mpsc::UnboundedReceiver<Vec<u8>>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let mut serial = serialport::new(port, baud_rate)
+        .timeout(READ_TIMEOUT)
+        .open()
+        .with_context(|| format!("Failed to open {}", port))?;
+    let mut buffer = [0u8; 1024];
+    while !stop.load(Ordering::Relaxed) && !tx.is_closed() {
+        while let Ok(data) = input.try_recv() {
+            serial
+                .write_all(&data)
+                .with_context(|| format!("Failed to write to {}", port))?;
+        }
+        match serial.read(&mut buffer) {
+            Ok(0) => {}
+            Ok(read) => {
+                let _ = tx.send(AppEvent::SerialOutput(
+                    port.to_string(),
+                    reader,
+                    buffer[..read].to_vec(),
+                ));
+            }
+            Err(e) if e.kind() == std::io::ErrorKind::TimedOut => {}
+            Err(e) => return Err(e).with_context(|| format!("Failed to read from {}", port)),
+        }
+    }
+    Ok(())
+}
+
+async fn read_network_port(
+    port: &str,
+    baud_rate: u32,
+    reader: u64,
+    stop: &AtomicBool,
+    input: &mut mpsc::UnboundedReceiver<Vec<u8>>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let mut serial = NetworkSerial::connect(&NetworkPort::parse(port)?, baud_rate).await?;
+    while !stop.load(Ordering::Relaxed) && !tx.is_closed() {
+        while let Ok(data) = input.try_recv() {
+            serial.write(&data).await?;
+        }
+        // A read cut short by the timeout hasn't taken anything from the stream
+        let Ok(data) = tokio::time::timeout(READ_TIMEOUT, serial.read()).await else {
+            continue;
+        };
+        let data = data?;
+        if data.is_empty() {
+            return Err(anyhow::anyhow!("{} closed the connection", port));
+        }
+        let _ = tx.send(AppEvent::SerialOutput(port.to_string(), reader, data));
+    }
+    Ok(())
+}
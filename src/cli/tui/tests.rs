@@ -279,3 +279,276 @@ fn test_app_initialization_without_project_handler() {
     // Clean up
     let _ = std::fs::remove_dir_all(&temp_dir);
 }
+
+#[test]
+fn test_board_list_tag_filter() {
+    use crate::projects::board_tags::TagFilter;
+
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project = temp_dir.path();
+    for board in ["box", "c3_mini", "devkit"] {
+        std::fs::write(project.join(format!("sdkconfig.defaults.{}", board)), "").unwrap();
+    }
+    std::fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    tags: [psram, customer-x]\n  c3_mini:\n    tags: [psram, c3]\n",
+    )
+    .unwrap();
+
+    let mut app = App::new(
+        project.to_path_buf(),
+        BuildStrategy::Sequential,
+        None,
+        None,
+        None,
+    )
+    .unwrap();
+    let names = |app: &App| {
+        app.boards
+            .iter()
+            .map(|b| b.name.clone())
+            .collect::<Vec<_>>()
+    };
+
+    app.apply_tag_filter(Some(TagFilter::parse("psram,!c3").unwrap()));
+    assert_eq!(names(&app), vec!["box"]);
+    assert_eq!(app.hidden_boards.len(), 2);
+
+    // Events for hidden boards still reach them
+    app.add_log_line("devkit", "hidden".to_string());
+    assert_eq!(app.hidden_boards[1].1.log_lines.last().unwrap(), "hidden");
+
+    app.tag_filter_input = Some(String::new());
+    app.submit_tag_filter_input().unwrap();
+    assert!(app.tag_filter.is_none());
+    assert_eq!(names(&app), vec!["box", "c3_mini", "devkit"]);
+}
+
+#[test]
+fn test_mouse_in_main_view() {
+    use crate::cli::tui::ui::{help_bar_hints, main_layout};
+    use crate::models::FocusedPane;
+    use crossterm::event::{KeyCode, KeyModifiers, MouseButton, MouseEvent, MouseEventKind};
+    use ratatui::layout::Rect;
+
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project = temp_dir.path();
+    for board in ["box", "c3_mini", "devkit"] {
+        std::fs::write(project.join(format!("sdkconfig.defaults.{}", board)), "").unwrap();
+    }
+    let mut app = App::new(
+        project.to_path_buf(),
+        BuildStrategy::Sequential,
+        None,
+        None,
+        None,
+    )
+    .unwrap();
+    let area = Rect::new(0, 0, 120, 40);
+    let mouse = |kind, column, row| MouseEvent {
+        kind,
+        column,
+        row,
+        modifiers: KeyModifiers::NONE,
+    };
+    let click = MouseEventKind::Down(MouseButton::Left);
+    let layout = main_layout(area, app.board_list_percent);
+
+    // The second board is on the second row inside the border
+    let list = layout.board_list;
+    assert_eq!(
+        app.handle_mouse(mouse(click, list.x + 3, list.y + 2), area),
+        None
+    );
+    assert_eq!(app.selected_board, 1);
+    assert_eq!(app.focused_pane, FocusedPane::LogPane);
+    app.handle_mouse(mouse(click, list.x + 3, list.y), area);
+    assert_eq!(app.selected_board, 1);
+
+    app.handle_mouse(
+        mouse(MouseEventKind::ScrollDown, list.x + 3, list.y + 3),
+        area,
+    );
+    assert_eq!(app.selected_board, 2);
+
+    // Dragging the split widens the lists
+    app.handle_mouse(mouse(click, layout.log.x, layout.log.y + 5), area);
+    assert!(app.dragging_split);
+    app.handle_mouse(mouse(MouseEventKind::Drag(MouseButton::Left), 60, 10), area);
+    assert_eq!(app.board_list_percent, 50);
+    app.handle_mouse(mouse(MouseEventKind::Up(MouseButton::Left), 60, 10), area);
+    assert!(!app.dragging_split);
+    app.handle_mouse(mouse(click, 5, 10), area);
+    app.handle_mouse(
+        mouse(MouseEventKind::Drag(MouseButton::Left), 119, 10),
+        area,
+    );
+    assert_eq!(app.board_list_percent, 50);
+
+    // Hints of the help bar press their keys
+    let hints = help_bar_hints(&app);
+    let tab = hints
+        .iter()
+        .position(|(_, key)| *key == Some(KeyCode::Tab))
+        .unwrap();
+    let column: usize = hints[..tab].iter().map(|(span, _)| span.width()).sum();
+    let bar = main_layout(area, app.board_list_percent).help_bar;
+    assert_eq!(
+        app.handle_mouse(mouse(click, bar.x + 1 + column as u16, bar.y + 1), area),
+        Some(KeyCode::Tab)
+    );
+    assert_eq!(
+        app.handle_mouse(mouse(click, bar.x + 2, bar.y + 1), area),
+        None
+    );
+
+    // Popups keep the clicks from the view below
+    app.show_help = true;
+    app.handle_mouse(mouse(click, list.x + 3, list.y + 1), area);
+    assert_eq!(app.selected_board, 2);
+}
+
+#[test]
+fn test_board_list_status_filter() {
+    use crate::models::board::BoardListFilter;
+    use crate::models::project::BuildStatus;
+    use crate::projects::board_tags::TagFilter;
+
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project = temp_dir.path();
+    for board in ["box", "c3_mini", "devkit", "s3_box"] {
+        std::fs::write(project.join(format!("sdkconfig.defaults.{}", board)), "").unwrap();
+    }
+    std::fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    tags: [psram]\n  c3_mini:\n    tags: [psram]\n",
+    )
+    .unwrap();
+
+    let mut app = App::new(
+        project.to_path_buf(),
+        BuildStrategy::Sequential,
+        None,
+        None,
+        None,
+    )
+    .unwrap();
+    let names = |app: &App| {
+        app.boards
+            .iter()
+            .map(|b| b.name.clone())
+            .collect::<Vec<_>>()
+    };
+    app.boards[0].status = BuildStatus::Failed;
+    app.boards[1].status = BuildStatus::Building;
+    app.boards[3].status = BuildStatus::Failed;
+
+    // F goes through failed, building and all boards
+    let filter = BoardListFilter::next_status(app.list_filter.as_ref());
+    app.apply_list_filter(filter);
+    assert_eq!(app.list_filter, Some(BoardListFilter::Failed));
+    assert_eq!(names(&app), vec!["box", "s3_box"]);
+    app.apply_list_filter(BoardListFilter::next_status(app.list_filter.as_ref()));
+    assert_eq!(names(&app), vec!["c3_mini"]);
+    assert_eq!(BoardListFilter::next_status(app.list_filter.as_ref()), None);
+
+    // The building list drops boards as they finish
+    app.hidden_boards[0].1.status = BuildStatus::Building;
+    app.boards[0].status = BuildStatus::Failed;
+    app.refresh_list_filter();
+    assert_eq!(names(&app), vec!["box"]);
+
+    // Names match ignoring case, and the selection stays where it was
+    app.apply_list_filter(None);
+    app.selected_board = 3;
+    app.apply_list_filter(Some(BoardListFilter::Name("BOX".to_string())));
+    assert_eq!(names(&app), vec!["box", "s3_box"]);
+    assert_eq!(app.selected_board, 1);
+    app.refresh_list_filter();
+    assert_eq!(names(&app), vec!["box", "s3_box"]);
+
+    // On top of the tag filter
+    app.apply_tag_filter(Some(TagFilter::parse("psram").unwrap()));
+    assert_eq!(names(&app), vec!["box"]);
+    app.apply_list_filter(Some(BoardListFilter::Name(String::new())));
+    assert!(app.list_filter.is_none());
+    assert_eq!(names(&app), vec!["box", "c3_mini"]);
+    app.apply_tag_filter(None);
+    assert_eq!(names(&app), vec!["box", "c3_mini", "devkit", "s3_box"]);
+}
+
+#[test]
+fn test_tui_state_restored() {
+    use crate::cli::tui::tui_state::{TUI_STATE_FILE, TuiState};
+    use crate::models::FocusedPane;
+    use crate::models::board::BoardListFilter;
+    use crate::projects::board_tags::TagFilter;
+
+    let temp_dir = tempfile::TempDir::new().unwrap();
+    let project = temp_dir.path();
+    for board in ["box", "c3_mini", "devkit", "s3_box"] {
+        std::fs::write(project.join(format!("sdkconfig.defaults.{}", board)), "").unwrap();
+    }
+    std::fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    tags: [psram]\n  s3_box:\n    tags: [psram]\n",
+    )
+    .unwrap();
+    let new_app = || {
+        App::new(
+            project.to_path_buf(),
+            BuildStrategy::Sequential,
+            None,
+            None,
+            None,
+        )
+        .unwrap()
+    };
+
+    // Nothing to restore in a new project
+    let mut app = new_app();
+    app.restore_state();
+    assert_eq!(app.selected_board, 0);
+    assert!(app.saved_state.is_none());
+
+    app.apply_tag_filter(Some(TagFilter::parse("psram").unwrap()));
+    app.apply_list_filter(Some(BoardListFilter::Name("s3".to_string())));
+    app.apply_list_filter(None);
+    app.select_board(1);
+    app.focused_pane = FocusedPane::LogPane;
+    app.board_list_percent = 45;
+    app.persist_state();
+    let saved = TuiState::load(project).unwrap().unwrap();
+    assert_eq!(saved.selected_board.as_deref(), Some("s3_box"));
+    assert_eq!(saved.tag_filter.as_deref(), Some("psram"));
+
+    // A new session starts where this one was left
+    let mut app = new_app();
+    app.restore_state();
+    assert_eq!(
+        app.boards
+            .iter()
+            .map(|b| b.name.as_str())
+            .collect::<Vec<_>>(),
+        vec!["box", "s3_box"]
+    );
+    assert_eq!(app.selected_board, 1);
+    assert_eq!(app.focused_pane, FocusedPane::LogPane);
+    assert_eq!(app.board_list_percent, 45);
+    assert_eq!(app.current_state(), saved);
+
+    // Boards that are gone are skipped, splits out of range clamped and
+    // unreadable files ignored
+    let mut gone = saved.clone();
+    gone.selected_board = Some("removed".to_string());
+    gone.board_list_percent = 99;
+    gone.save(project).unwrap();
+    let mut app = new_app();
+    app.restore_state();
+    assert_eq!(app.selected_board, 0);
+    assert!(app.board_list_percent < 99);
+    std::fs::write(project.join(TUI_STATE_FILE), "{").unwrap();
+    let mut app = new_app();
+    app.restore_state();
+    assert!(app.tag_filter.is_none());
+}
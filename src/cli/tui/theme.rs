@@ -0,0 +1,464 @@
+//! Color themes of the TUI
+//!
+//! Every color the TUI draws comes from the theme's roles: the status of the
+//! boards, the highlighting of log lines and the chrome of the panes. `dark`
+//! is the default, `light` is readable on light terminal backgrounds and
+//! `high-contrast` uses the bright colors only. `--theme <name>` or
+//! `ESPBREW_THEME` picks one of those, or a theme file: a path to a YAML file
+//! or `<name>` for `~/.config/espbrew/themes/<name>.yaml`. A theme file
+//! changes the roles it lists of the theme it extends:
+//!
+//! ```yaml
+//! extends: light
+//! colors:
+//!   failed: "#d70000"
+//!   border_focused: blue
+//! panes: [blue, magenta, "#af5f00", green]
+//! ```
+
+use anyhow::{Context, Result};
+use ratatui::style::Color;
+use serde::Deserialize;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use std::str::FromStr;
+
+use crate::models::project::BuildStatus;
+
+/// Environment variable naming the theme when `--theme` doesn't
+pub const THEME_ENV: &str = "ESPBREW_THEME";
+/// Themes built into espbrew
+pub const BUILTIN_THEMES: &[&str] = &["dark", "light", "high-contrast"];
+
+/// Colors of the TUI by role
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Theme {
+    pub name: String,
+    // Status of the boards
+    pub pending: Color,
+    pub building: Color,
+    pub success: Color,
+    pub failed: Color,
+    pub flashing: Color,
+    pub flashed: Color,
+    pub monitoring: Color,
+    pub cancelled: Color,
+    // Log highlighting
+    pub log_error: Color,
+    pub log_warning: Color,
+    pub log_success: Color,
+    pub log_info: Color,
+    /// Decoded backtrace frames
+    pub log_frame: Color,
+    // Text and pane chrome
+    pub text: Color,
+    /// Hints, labels and secondary details
+    pub muted: Color,
+    /// Inactive elements, e.g. the borders of unselected tiles
+    pub dim: Color,
+    /// Keys, headings and selected tabs
+    pub accent: Color,
+    pub warning: Color,
+    pub error: Color,
+    pub info: Color,
+    pub highlight: Color,
+    pub border: Color,
+    pub border_focused: Color,
+    /// Background of the selected list item
+    pub selection: Color,
+    /// Text on the colored background of a highlighted line or menu item
+    pub selected_text: Color,
+    /// Background of the popups
+    pub background: Color,
+    /// Background of the help bar and its prompts
+    pub bar: Color,
+    /// Backgrounds of the serial monitor's highlight rules, in rule order
+    pub highlights: Vec<Color>,
+    /// Text of the lines a highlight rule matched
+    pub highlight_text: Color,
+    /// Colors telling the serial monitor panes and plotted series apart
+    pub panes: Vec<Color>,
+}
+
+impl Default for Theme {
+    fn default() -> Self {
+        Self::dark()
+    }
+}
+
+impl Theme {
+    pub fn dark() -> Self {
+        Self {
+            name: "dark".to_string(),
+            pending: Color::Gray,
+            building: Color::Yellow,
+            success: Color::Green,
+            failed: Color::Red,
+            flashing: Color::Cyan,
+            flashed: Color::Blue,
+            monitoring: Color::Magenta,
+            cancelled: Color::DarkGray,
+            log_error: Color::Red,
+            log_warning: Color::Yellow,
+            log_success: Color::Green,
+            log_info: Color::Cyan,
+            log_frame: Color::LightMagenta,
+            text: Color::White,
+            muted: Color::Gray,
+            dim: Color::DarkGray,
+            accent: Color::Cyan,
+            warning: Color::Yellow,
+            error: Color::Red,
+            info: Color::Blue,
+            highlight: Color::Magenta,
+            border: Color::Reset,
+            border_focused: Color::Cyan,
+            selection: Color::DarkGray,
+            selected_text: Color::Black,
+            background: Color::Black,
+            bar: Color::DarkGray,
+            highlights: vec![
+                Color::Yellow,
+                Color::LightGreen,
+                Color::LightCyan,
+                Color::LightMagenta,
+                Color::LightRed,
+            ],
+            highlight_text: Color::Black,
+            panes: vec![
+                Color::Cyan,
+                Color::Magenta,
+                Color::Yellow,
+                Color::Green,
+                Color::LightBlue,
+                Color::LightRed,
+            ],
+        }
+    }
+
+    /// Dark colors for light terminal backgrounds, where yellow, cyan and
+    /// gray text can't be read
+    pub fn light() -> Self {
+        let green = Color::Rgb(0x00, 0x87, 0x00);
+        let red = Color::Rgb(0xaf, 0x00, 0x00);
+        let amber = Color::Rgb(0x87, 0x5f, 0x00);
+        let teal = Color::Rgb(0x00, 0x5f, 0x87);
+        let blue = Color::Rgb(0x00, 0x00, 0xaf);
+        let purple = Color::Rgb(0x87, 0x00, 0x87);
+        let gray = Color::Rgb(0x58, 0x58, 0x58);
+        Self {
+            name: "light".to_string(),
+            pending: gray,
+            building: amber,
+            success: green,
+            failed: red,
+            flashing: teal,
+            flashed: blue,
+            monitoring: purple,
+            cancelled: Color::Rgb(0x8a, 0x8a, 0x8a),
+            log_error: red,
+            log_warning: amber,
+            log_success: green,
+            log_info: teal,
+            log_frame: purple,
+            text: Color::Black,
+            muted: gray,
+            dim: Color::Rgb(0x8a, 0x8a, 0x8a),
+            accent: teal,
+            warning: amber,
+            error: red,
+            info: blue,
+            highlight: purple,
+            border: Color::Rgb(0x8a, 0x8a, 0x8a),
+            border_focused: teal,
+            selection: Color::Rgb(0xd0, 0xd0, 0xd0),
+            selected_text: Color::White,
+            background: Color::White,
+            bar: Color::Rgb(0xe4, 0xe4, 0xe4),
+            highlights: vec![
+                Color::Rgb(0xff, 0xd7, 0x5f),
+                Color::Rgb(0xaf, 0xf0, 0xaf),
+                Color::Rgb(0xaf, 0xe4, 0xff),
+                Color::Rgb(0xf0, 0xc0, 0xf0),
+                Color::Rgb(0xff, 0xc0, 0xc0),
+            ],
+            highlight_text: Color::Black,
+            panes: vec![teal, purple, amber, green, blue, red],
+        }
+    }
+
+    /// Bright colors only, on black
+    pub fn high_contrast() -> Self {
+        Self {
+            name: "high-contrast".to_string(),
+            pending: Color::White,
+            building: Color::LightYellow,
+            success: Color::LightGreen,
+            failed: Color::LightRed,
+            flashing: Color::LightCyan,
+            flashed: Color::LightBlue,
+            monitoring: Color::LightMagenta,
+            cancelled: Color::Gray,
+            log_error: Color::LightRed,
+            log_warning: Color::LightYellow,
+            log_success: Color::LightGreen,
+            log_info: Color::LightCyan,
+            log_frame: Color::LightMagenta,
+            text: Color::White,
+            muted: Color::White,
+            dim: Color::Gray,
+            accent: Color::LightCyan,
+            warning: Color::LightYellow,
+            error: Color::LightRed,
+            info: Color::LightBlue,
+            highlight: Color::LightMagenta,
+            border: Color::White,
+            border_focused: Color::LightYellow,
+            selection: Color::Blue,
+            selected_text: Color::Black,
+            background: Color::Black,
+            bar: Color::Blue,
+            highlights: vec![
+                Color::LightYellow,
+                Color::LightGreen,
+                Color::LightCyan,
+                Color::LightMagenta,
+                Color::LightRed,
+            ],
+            highlight_text: Color::Black,
+            panes: vec![
+                Color::LightCyan,
+                Color::LightMagenta,
+                Color::LightYellow,
+                Color::LightGreen,
+                Color::LightBlue,
+                Color::LightRed,
+            ],
+        }
+    }
+
+    /// The built-in theme of that name
+    pub fn builtin(name: &str) -> Option<Self> {
+        match name {
+            "dark" => Some(Self::dark()),
+            "light" => Some(Self::light()),
+            "high-contrast" => Some(Self::high_contrast()),
+            _ => None,
+        }
+    }
+
+    /// The theme of `--theme`, else of `ESPBREW_THEME`, else `dark`
+    pub fn resolve(name: Option<&str>) -> Result<Self> {
+        let name = match name {
+            Some(name) => name.to_string(),
+            None => match std::env::var(THEME_ENV) {
+                Ok(name) if !name.is_empty() => name,
+                _ => return Ok(Self::default()),
+            },
+        };
+        if let Some(theme) = Self::builtin(&name) {
+            return Ok(theme);
+        }
+        match theme_path(&name) {
+            Some(path) if path.is_file() => Self::load(&path),
+            path => Err(anyhow::anyhow!(
+                "Unknown theme '{}': use {} or a theme file{}",
+                name,
+                BUILTIN_THEMES.join(", "),
+                path.map(|path| format!(" like {}", path.display()))
+                    .unwrap_or_default()
+            )),
+        }
+    }
+
+    /// Load a theme file
+    pub fn load(path: &Path) -> Result<Self> {
+        let content = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read theme {}", path.display()))?;
+        let file: ThemeFile = serde_yaml::from_str(&content)
+            .with_context(|| format!("Failed to parse theme {}", path.display()))?;
+        let base = file.extends.as_deref().unwrap_or("dark");
+        let mut theme = Self::builtin(base).ok_or_else(|| {
+            anyhow::anyhow!(
+                "{} extends unknown theme '{}': use {}",
+                path.display(),
+                base,
+                BUILTIN_THEMES.join(", ")
+            )
+        })?;
+        theme.name = path
+            .file_stem()
+            .map(|stem| stem.to_string_lossy().to_string())
+            .unwrap_or_else(|| base.to_string());
+        for (role, value) in &file.colors {
+            let slot = theme.role_mut(role).ok_or_else(|| {
+                anyhow::anyhow!("{}: unknown color role '{}'", path.display(), role)
+            })?;
+            *slot = parse_color(value).with_context(|| format!("{}: {}", path.display(), role))?;
+        }
+        if let Some(highlights) = &file.highlights {
+            theme.highlights = parse_colors(highlights)
+                .with_context(|| format!("{}: highlights", path.display()))?;
+        }
+        if let Some(panes) = &file.panes {
+            theme.panes =
+                parse_colors(panes).with_context(|| format!("{}: panes", path.display()))?;
+        }
+        Ok(theme)
+    }
+
+    /// The color of a role, by its name in theme files
+    pub fn role_mut(&mut self, role: &str) -> Option<&mut Color> {
+        Some(match role {
+            "pending" => &mut self.pending,
+            "building" => &mut self.building,
+            "success" => &mut self.success,
+            "failed" => &mut self.failed,
+            "flashing" => &mut self.flashing,
+            "flashed" => &mut self.flashed,
+            "monitoring" => &mut self.monitoring,
+            "cancelled" => &mut self.cancelled,
+            "log_error" => &mut self.log_error,
+            "log_warning" => &mut self.log_warning,
+            "log_success" => &mut self.log_success,
+            "log_info" => &mut self.log_info,
+            "log_frame" => &mut self.log_frame,
+            "text" => &mut self.text,
+            "muted" => &mut self.muted,
+            "dim" => &mut self.dim,
+            "accent" => &mut self.accent,
+            "warning" => &mut self.warning,
+            "error" => &mut self.error,
+            "info" => &mut self.info,
+            "highlight" => &mut self.highlight,
+            "border" => &mut self.border,
+            "border_focused" => &mut self.border_focused,
+            "selection" => &mut self.selection,
+            "selected_text" => &mut self.selected_text,
+            "background" => &mut self.background,
+            "bar" => &mut self.bar,
+            "highlight_text" => &mut self.highlight_text,
+            _ => return None,
+        })
+    }
+
+    /// Color of a board's status
+    pub fn status(&self, status: &BuildStatus) -> Color {
+        match status {
+            BuildStatus::Pending => self.pending,
+            BuildStatus::Building => self.building,
+            BuildStatus::Success => self.success,
+            BuildStatus::Failed => self.failed,
+            BuildStatus::Flashing => self.flashing,
+            BuildStatus::Flashed => self.flashed,
+            BuildStatus::Monitoring => self.monitoring,
+            BuildStatus::Cancelled => self.cancelled,
+        }
+    }
+
+    /// Background of the lines matching the highlight rule
+    pub fn highlight_color(&self, rule: usize) -> Color {
+        cycle(&self.highlights, rule).unwrap_or(self.selection)
+    }
+
+    /// Color of the pane, or plotted series, at the index
+    pub fn pane_color(&self, index: usize) -> Color {
+        cycle(&self.panes, index).unwrap_or(self.accent)
+    }
+}
+
+fn cycle(colors: &[Color], index: usize) -> Option<Color> {
+    (!colors.is_empty()).then(|| colors[index % colors.len()])
+}
+
+/// A theme file: the theme it extends and the colors it changes
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct ThemeFile {
+    pub extends: Option<String>,
+    #[serde(default)]
+    pub colors: BTreeMap<String, String>,
+    pub highlights: Option<Vec<String>>,
+    pub panes: Option<Vec<String>>,
+}
+
+/// A color as `red`, `light-blue`, `#rrggbb` or an ANSI index like `208`
+pub fn parse_color(value: &str) -> Result<Color> {
+    Color::from_str(value.trim()).map_err(|_| anyhow::anyhow!("Invalid color '{}'", value))
+}
+
+fn parse_colors(values: &[String]) -> Result<Vec<Color>> {
+    values.iter().map(|value| parse_color(value)).collect()
+}
+
+/// Directory of the user's theme files
+pub fn themes_dir() -> Option<PathBuf> {
+    dirs::config_dir().map(|dir| dir.join("espbrew").join("themes"))
+}
+
+/// File of a theme that isn't built in: a path to a YAML file, or the
+/// `<name>.yaml` of the user's themes
+pub fn theme_path(name: &str) -> Option<PathBuf> {
+    let path = Path::new(name);
+    let is_path = path.components().count() > 1
+        || path
+            .extension()
+            .is_some_and(|ext| ext == "yaml" || ext == "yml");
+    if is_path {
+        Some(path.to_path_buf())
+    } else {
+        themes_dir().map(|dir| dir.join(format!("{}.yaml", name)))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_tui_themes() {
+        for name in BUILTIN_THEMES {
+            let theme = Theme::resolve(Some(name)).unwrap();
+            assert_eq!(theme.name, *name);
+        }
+        let dark = Theme::default();
+        assert_eq!(dark.status(&BuildStatus::Failed), Color::Red);
+        assert_eq!(dark.pane_color(7), dark.panes[1]);
+        // Yellow and white text don't show on light backgrounds
+        let light = Theme::light();
+        assert_ne!(light.status(&BuildStatus::Building), Color::Yellow);
+        assert_ne!(light.text, Color::White);
+
+        assert_eq!(parse_color("light-blue").unwrap(), Color::LightBlue);
+        assert_eq!(parse_color("#d70000").unwrap(), Color::Rgb(0xd7, 0, 0));
+        assert_eq!(parse_color("208").unwrap(), Color::Indexed(208));
+        assert!(parse_color("sunset").is_err());
+
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("paper.yaml");
+        fs::write(
+            &path,
+            "extends: light\ncolors:\n  failed: \"#d70000\"\n  border_focused: blue\npanes: [blue, magenta]\n",
+        )
+        .unwrap();
+        let theme = Theme::resolve(Some(path.to_str().unwrap())).unwrap();
+        assert_eq!(theme.name, "paper");
+        assert_eq!(theme.status(&BuildStatus::Failed), Color::Rgb(0xd7, 0, 0));
+        assert_eq!(theme.border_focused, Color::Blue);
+        assert_eq!(theme.panes, [Color::Blue, Color::Magenta]);
+        assert_eq!(theme.text, light.text);
+
+        // Files without extends change the dark theme
+        fs::write(&path, "colors:\n  accent: green\n").unwrap();
+        let theme = Theme::load(&path).unwrap();
+        assert_eq!(theme.accent, Color::Green);
+        assert_eq!(theme.failed, dark.failed);
+
+        fs::write(&path, "colors:\n  sparkle: red\n").unwrap();
+        assert!(Theme::load(&path).is_err());
+        fs::write(&path, "extends: neon\n").unwrap();
+        assert!(Theme::load(&path).is_err());
+        assert!(Theme::resolve(Some("no-such-theme")).is_err());
+    }
+}
@@ -0,0 +1,67 @@
+//! Where the TUI was left, restored when it starts again
+//!
+//! The selected board and component, the focused pane, the width of the
+//! lists and the tag and list filters are kept in `.espbrew/tui-state.json`
+//! as they change, so after a crash or a reboot espbrew opens where it was.
+//! Boards and components are remembered by name; ones that are gone are
+//! skipped. Deleting the file starts from the defaults again.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+
+use crate::models::board::BoardListFilter;
+use crate::models::tui::FocusedPane;
+
+/// State file, relative to the project
+pub const TUI_STATE_FILE: &str = ".espbrew/tui-state.json";
+
+/// What the TUI restores of its last session
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct TuiState {
+    #[serde(default)]
+    pub selected_board: Option<String>,
+    #[serde(default)]
+    pub selected_component: Option<String>,
+    pub focused_pane: FocusedPane,
+    /// Width of the board and component lists, in percent of the terminal
+    pub board_list_percent: u16,
+    /// Tag expression of the tag filter, e.g. `psram,!c3`
+    #[serde(default)]
+    pub tag_filter: Option<String>,
+    #[serde(default)]
+    pub list_filter: Option<BoardListFilter>,
+}
+
+impl TuiState {
+    pub fn path(project_dir: &Path) -> PathBuf {
+        project_dir.join(TUI_STATE_FILE)
+    }
+
+    /// The state the TUI was left in, if it ran in the project before
+    pub fn load(project_dir: &Path) -> Result<Option<Self>> {
+        let path = Self::path(project_dir);
+        if !path.exists() {
+            return Ok(None);
+        }
+
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        let state = serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", path.display()))?;
+        Ok(Some(state))
+    }
+
+    pub fn save(&self, project_dir: &Path) -> Result<()> {
+        let path = Self::path(project_dir);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        // Written aside and renamed, so a crash never leaves half a file
+        let tmp = path.with_extension("json.tmp");
+        std::fs::write(&tmp, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("Failed to write {}", tmp.display()))?;
+        std::fs::rename(&tmp, &path).with_context(|| format!("Failed to write {}", path.display()))
+    }
+}
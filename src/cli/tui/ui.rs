@@ -1,27 +1,57 @@
 //! TUI rendering logic
 
+use crossterm::event::KeyCode;
 use ratatui::{
     Frame,
     layout::{Alignment, Constraint, Direction, Layout, Rect},
     style::{Color, Modifier, Style},
+    symbols,
     text::{Line, Span},
-    widgets::{Block, Borders, Clear, List, ListItem, ListState, Paragraph, Wrap},
+    widgets::{
+        Axis, Block, Borders, Chart, Clear, Dataset, GraphType, LegendPosition, List, ListItem,
+        ListState, Paragraph, Tabs, Wrap,
+    },
 };
 
+use crate::cli::tui::keymap::find_action;
 use crate::cli::tui::main_app::App;
-use crate::models::FocusedPane;
+use crate::cli::tui::serial_monitor::MONITOR_BAUD_RATE;
+use crate::cli::tui::theme::Theme;
+use crate::models::project::BuildStatus;
+use crate::models::{
+    BoardConfig, FocusedPane, MonitorInput, MonitorLayout, MonitorState, OtaStatus, SerialMonitor,
+    merged_source, tile_grid,
+};
+use crate::projects::build_history::{format_duration, sparkline};
+use crate::projects::dashboard::{DashboardTotals, DeviceState, RunOutcome, board_columns};
+use crate::projects::log_diff::{DiffKind, differing_rows};
+use crate::utils::diagnostics::Severity;
+use crate::utils::firmware_size::format_bytes;
+
+/// Areas of the main view, shared by the rendering and the mouse
+pub struct MainLayout {
+    pub board_list: Rect,
+    pub component_list: Rect,
+    pub details: Rect,
+    pub log: Rect,
+    pub help_bar: Rect,
+}
 
-/// Main UI rendering function
-pub fn ui(f: &mut Frame, app: &App) {
+/// Split the terminal into the panes, the left ones taking `left_percent`
+/// of the width
+pub fn main_layout(area: Rect, left_percent: u16) -> MainLayout {
     // Main layout with help bar at bottom
     let main_chunks = Layout::default()
         .direction(Direction::Vertical)
         .constraints([Constraint::Min(0), Constraint::Length(3)])
-        .split(f.area());
+        .split(area);
 
     let chunks = Layout::default()
         .direction(Direction::Horizontal)
-        .constraints([Constraint::Percentage(32), Constraint::Percentage(68)])
+        .constraints([
+            Constraint::Percentage(left_percent),
+            Constraint::Percentage(100 - left_percent),
+        ])
         .split(main_chunks[0]);
 
     // Split left panel into boards (top) and components (bottom)
@@ -30,29 +60,89 @@ pub fn ui(f: &mut Frame, app: &App) {
         .constraints([Constraint::Percentage(60), Constraint::Percentage(40)])
         .split(chunks[0]);
 
+    // Right panel - Details
+    let right_chunks = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints([Constraint::Length(11), Constraint::Min(0)])
+        .split(chunks[1]);
+
+    MainLayout {
+        board_list: left_chunks[0],
+        component_list: left_chunks[1],
+        details: right_chunks[0],
+        log: right_chunks[1],
+        help_bar: main_chunks[1],
+    }
+}
+
+/// Main UI rendering function
+pub fn ui(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    let layout = main_layout(f.area(), app.board_list_percent);
+
     // Board list (top of left panel)
+    let queued = app.build_scheduler.queued();
     let board_items: Vec<ListItem> = app
         .boards
         .iter()
-        .map(|board| {
+        .enumerate()
+        .map(|(index, board)| {
             let status_symbol = board.status.symbol();
-            let time_info = if let Some(duration) = board.build_time {
-                format!(" ({}s)", duration.as_secs())
+            let queue_position = queued.iter().position(|name| *name == board.name);
+            let crash_loop = if app.is_board_crash_looping(&board.name) {
+                " 🔁 crash-looping"
             } else {
-                String::new()
+                ""
             };
 
-            ListItem::new(Line::from(vec![
-                Span::styled(status_symbol, Style::default().fg(board.status.color())),
+            // Workspace boards are grouped under a header line per project
+            let (indent, name) = match &board.workspace {
+                Some(member) => ("  ", member.board_name.as_str()),
+                None => ("", board.name.as_str()),
+            };
+            let mut spans = vec![
+                Span::raw(indent),
+                Span::styled(
+                    status_symbol,
+                    Style::default().fg(theme.status(&board.status)),
+                ),
                 Span::raw(" "),
-                Span::raw(&board.name),
-                Span::styled(time_info, Style::default().fg(Color::Gray)),
-            ]))
+                Span::raw(name),
+            ];
+            spans.extend(board_progress_spans(app, board, queue_position));
+            // Marked as the left side of the next log comparison
+            if app.log_compare_base.as_ref() == Some(&board.name) {
+                spans.push(Span::styled(" 📌", Style::default().fg(theme.accent)));
+            }
+            spans.push(Span::styled(crash_loop, Style::default().fg(theme.error)));
+            let board_line = Line::from(spans);
+            let Some(member) = &board.workspace else {
+                return ListItem::new(board_line);
+            };
+            if app.starts_workspace_group(index) {
+                let header = Line::from(vec![
+                    Span::styled(
+                        format!("📁 {}", member.project),
+                        Style::default()
+                            .fg(theme.warning)
+                            .add_modifier(Modifier::BOLD),
+                    ),
+                    Span::styled(
+                        format!(" ({})", board.project_type.name()),
+                        Style::default().fg(theme.muted),
+                    ),
+                ]);
+                ListItem::new(vec![header, board_line])
+            } else {
+                ListItem::new(board_line)
+            }
         })
         .collect();
 
     let project_type_display = if let Some(project_type) = &app.project_type {
         format!(" ({})", project_type.name())
+    } else if app.boards.iter().any(|b| b.workspace.is_some()) {
+        " (Workspace)".to_string()
     } else {
         String::new()
     };
@@ -65,35 +155,65 @@ pub fn ui(f: &mut Frame, app: &App) {
         " ❌"
     };
 
+    let tag_filter_display = match &app.tag_filter {
+        Some(filter) => format!(
+            " 🏷️ {} ({}/{})",
+            filter,
+            app.boards.len(),
+            app.boards.len() + app.hidden_boards.len()
+        ),
+        None => String::new(),
+    };
+
+    let list_filter_display = match &app.list_filter {
+        Some(filter) => format!(
+            " 🔎 {} ({}/{})",
+            filter,
+            app.boards.len(),
+            app.boards.len() + app.hidden_boards.len()
+        ),
+        None => String::new(),
+    };
+
     let board_list_title = if app.focused_pane == FocusedPane::BoardList {
         format!(
-            "🍺 Boards{}{} [FOCUSED]",
-            project_type_display, server_indicator
+            "🍺 Boards{}{}{}{} [FOCUSED]",
+            project_type_display, server_indicator, tag_filter_display, list_filter_display
         )
     } else {
-        format!("🍺 Boards{}{}", project_type_display, server_indicator)
+        format!(
+            "🍺 Boards{}{}{}{}",
+            project_type_display, server_indicator, tag_filter_display, list_filter_display
+        )
     };
 
     let board_list_block = if app.focused_pane == FocusedPane::BoardList {
         Block::default()
             .title(board_list_title.clone())
             .borders(Borders::ALL)
-            .border_style(Style::default().fg(Color::Cyan))
+            .border_style(Style::default().fg(theme.border_focused))
     } else {
         Block::default()
             .title(board_list_title.clone())
             .borders(Borders::ALL)
+            .border_style(Style::default().fg(theme.border))
+    };
+
+    // The dashboard's URL holds its token, the TUI is where to find it
+    let board_list_block = match &app.web_dashboard {
+        Some(link) => board_list_block.title_bottom(format!(" 🌐 {} ", link.url)),
+        None => board_list_block,
     };
 
     let board_list = List::new(board_items)
         .block(board_list_block)
         .highlight_style(
             Style::default()
-                .bg(Color::DarkGray)
+                .bg(theme.selection)
                 .add_modifier(Modifier::BOLD),
         );
 
-    f.render_stateful_widget(board_list, left_chunks[0], &mut app.list_state.clone());
+    f.render_stateful_widget(board_list, layout.board_list, &mut app.list_state.clone());
 
     // Component list (bottom of left panel)
     let component_items: Vec<ListItem> = app
@@ -107,7 +227,7 @@ pub fn ui(f: &mut Frame, app: &App) {
             };
 
             let mut spans = vec![
-                Span::styled(type_indicator, Style::default().fg(Color::White)),
+                Span::styled(type_indicator, Style::default().fg(theme.text)),
                 Span::raw(" "),
                 Span::raw(&component.name),
             ];
@@ -117,7 +237,7 @@ pub fn ui(f: &mut Frame, app: &App) {
                 spans.push(Span::styled(
                     format!(" [{}]", action_status),
                     Style::default()
-                        .fg(Color::Cyan)
+                        .fg(theme.accent)
                         .add_modifier(Modifier::ITALIC),
                 ));
             } else {
@@ -125,10 +245,10 @@ pub fn ui(f: &mut Frame, app: &App) {
                 if component.is_managed {
                     spans.push(Span::styled(
                         " (managed)",
-                        Style::default().fg(Color::Yellow),
+                        Style::default().fg(theme.warning),
                     ));
                 } else {
-                    spans.push(Span::styled(" (local)", Style::default().fg(Color::Green)));
+                    spans.push(Span::styled(" (local)", Style::default().fg(theme.success)));
                 }
             }
 
@@ -146,33 +266,28 @@ pub fn ui(f: &mut Frame, app: &App) {
         Block::default()
             .title(component_list_title)
             .borders(Borders::ALL)
-            .border_style(Style::default().fg(Color::Cyan))
+            .border_style(Style::default().fg(theme.border_focused))
     } else {
         Block::default()
             .title(component_list_title)
             .borders(Borders::ALL)
+            .border_style(Style::default().fg(theme.border))
     };
 
     let component_list = List::new(component_items)
         .block(component_list_block)
         .highlight_style(
             Style::default()
-                .bg(Color::DarkGray)
+                .bg(theme.selection)
                 .add_modifier(Modifier::BOLD),
         );
 
     f.render_stateful_widget(
         component_list,
-        left_chunks[1],
+        layout.component_list,
         &mut app.component_list_state.clone(),
     );
 
-    // Right panel - Details
-    let right_chunks = Layout::default()
-        .direction(Direction::Vertical)
-        .constraints([Constraint::Length(8), Constraint::Min(0)])
-        .split(chunks[1]);
-
     // Board details
     if let Some(selected_board) = app.boards.get(app.selected_board) {
         let details = vec![
@@ -188,17 +303,87 @@ pub fn ui(f: &mut Frame, app: &App) {
                         selected_board.status.symbol(),
                         selected_board.status
                     ),
-                    Style::default().fg(selected_board.status.color()),
+                    Style::default().fg(theme.status(&selected_board.status)),
                 ),
             ]),
             Line::from(vec![
                 Span::styled("Config: ", Style::default().add_modifier(Modifier::BOLD)),
                 Span::raw(selected_board.config_file.display().to_string()),
             ]),
+            Line::from(vec![
+                Span::styled("Extends: ", Style::default().add_modifier(Modifier::BOLD)),
+                Span::raw(
+                    crate::config::sdkconfig_fragments::declared_bases(&selected_board.config_file)
+                        .ok()
+                        .filter(|bases| !bases.is_empty())
+                        .map(|bases| {
+                            bases
+                                .iter()
+                                .filter_map(|b| b.file_name())
+                                .map(|n| n.to_string_lossy().to_string())
+                                .collect::<Vec<_>>()
+                                .join(", ")
+                        })
+                        .unwrap_or_else(|| "-".to_string()),
+                ),
+            ]),
             Line::from(vec![
                 Span::styled("Build Dir: ", Style::default().add_modifier(Modifier::BOLD)),
                 Span::raw(selected_board.build_dir.display().to_string()),
             ]),
+            Line::from(vec![
+                Span::styled("Size: ", Style::default().add_modifier(Modifier::BOLD)),
+                match app.board_size_report(selected_board) {
+                    Some(report) if report.grew() => {
+                        Span::styled(report.summary(), Style::default().fg(theme.warning))
+                    }
+                    Some(report) => Span::raw(report.summary()),
+                    None => Span::raw("-"),
+                },
+            ]),
+            Line::from(vec![
+                Span::styled("Merged: ", Style::default().add_modifier(Modifier::BOLD)),
+                Span::raw(
+                    std::fs::metadata(crate::projects::merged_binary::merged_binary_path(
+                        &selected_board.build_dir,
+                        &selected_board.name,
+                    ))
+                    .map(|metadata| {
+                        format!(
+                            "merged-{}.bin ({} KB, flash at 0x0)",
+                            selected_board.name,
+                            metadata.len() / 1024
+                        )
+                    })
+                    .unwrap_or_else(|_| "-".to_string()),
+                ),
+            ]),
+            Line::from(
+                std::iter::once(Span::styled(
+                    "Signed: ",
+                    Style::default().add_modifier(Modifier::BOLD),
+                ))
+                .chain(match app.board_signature_status(selected_board) {
+                    Some(images) if !images.is_empty() => images
+                        .into_iter()
+                        .map(|(name, signed)| {
+                            if signed {
+                                Span::styled(
+                                    format!("{} ✔ signed  ", name),
+                                    Style::default().fg(theme.success),
+                                )
+                            } else {
+                                Span::styled(
+                                    format!("{} ✘ unsigned  ", name),
+                                    Style::default().fg(theme.error),
+                                )
+                            }
+                        })
+                        .collect(),
+                    _ => vec![Span::raw("-")],
+                })
+                .collect::<Vec<_>>(),
+            ),
             Line::from(vec![
                 Span::styled("Updated: ", Style::default().add_modifier(Modifier::BOLD)),
                 Span::raw(selected_board.last_updated.format("%H:%M:%S").to_string()),
@@ -213,11 +398,11 @@ pub fn ui(f: &mut Frame, app: &App) {
             )
             .wrap(Wrap { trim: true });
 
-        f.render_widget(details_paragraph, right_chunks[0]);
+        f.render_widget(details_paragraph, layout.details);
 
         // Build log with scrolling support
         let total_lines = selected_board.log_lines.len();
-        let available_height = right_chunks[1].height.saturating_sub(2) as usize; // Account for borders
+        let available_height = layout.log.height.saturating_sub(2) as usize; // Account for borders
 
         // Auto-adjust scroll for real-time streaming (show latest content)
         let adjusted_scroll_offset = if total_lines > available_height {
@@ -243,7 +428,21 @@ pub fn ui(f: &mut Frame, app: &App) {
                 .get(start_index..end_index)
                 .unwrap_or_default()
                 .iter()
-                .map(|line| colorize_log_line(line))
+                .enumerate()
+                .map(|(offset, line)| {
+                    let colored = colorize_log_line(theme, line);
+                    // Matches of the search stand out, the current one most
+                    match &app.log_search {
+                        Some(search) if search.current == Some(start_index + offset) => colored
+                            .patch_style(
+                                Style::default().bg(theme.warning).fg(theme.selected_text),
+                            ),
+                        Some(search) if search.regex.is_match(line) => {
+                            colored.patch_style(Style::default().bg(theme.selection))
+                        }
+                        _ => colored,
+                    }
+                })
                 .collect()
         } else {
             vec![Line::from("No logs available")]
@@ -276,185 +475,1796 @@ pub fn ui(f: &mut Frame, app: &App) {
         } else {
             "Build Log".to_string()
         };
+        let log_title = match &app.log_search {
+            Some(search) => format!(
+                "{} 🔍 '{}' {} [N/n]Prev/Next",
+                log_title,
+                search.pattern,
+                search.position(&selected_board.log_lines)
+            ),
+            None => log_title,
+        };
 
         let log_block = if app.focused_pane == FocusedPane::LogPane {
             Block::default()
                 .title(log_title)
                 .borders(Borders::ALL)
-                .border_style(Style::default().fg(Color::Cyan))
+                .border_style(Style::default().fg(theme.border_focused))
         } else {
-            Block::default().title(log_title).borders(Borders::ALL)
+            Block::default()
+                .title(log_title)
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border))
         };
 
         let log_paragraph = Paragraph::new(log_lines)
             .block(log_block)
             .wrap(Wrap { trim: true });
 
-        f.render_widget(log_paragraph, right_chunks[1]);
+        f.render_widget(log_paragraph, layout.log);
+    }
+
+    // Tool warning modal (project-specific)
+    if app.show_tool_warning && !app.tool_warning_acknowledged {
+        let area = centered_rect(70, 20, f.area());
+        f.render_widget(Clear, area);
+
+        let warning_lines: Vec<Line> = app
+            .tool_warning_message
+            .split('\n')
+            .map(Line::from)
+            .collect();
+
+        let warning_paragraph = Paragraph::new(warning_lines)
+            .block(
+                Block::default()
+                    .title("Build Tools Notice - Flashing Still Available!")
+                    .borders(Borders::ALL)
+                    .border_style(Style::default().fg(theme.warning)),
+            )
+            .style(Style::default().bg(theme.background))
+            .wrap(Wrap { trim: true });
+
+        f.render_widget(warning_paragraph, area);
+    }
+    // Help popup
+    else if app.show_help {
+        let area = centered_rect(60, 20, f.area());
+        f.render_widget(Clear, area);
+
+        // The keys are the active bindings, remapped by the user's [keys]
+        let keys = |names: &[&str], description: &str| {
+            let labels: Vec<String> = names.iter().map(|name| app.keymap.label(name)).collect();
+            Line::from(format!("{:<13} {}", labels.join(" / "), description))
+        };
+        let help_text = vec![
+            Line::from("🍺 ESPBrew Help"),
+            Line::from(""),
+            Line::from("Navigation:"),
+            keys(
+                &["up", "down"],
+                "Navigate boards (Board List) / Scroll logs (Log Pane)",
+            ),
+            keys(&["switch_pane"], "Switch between Board List and Log Pane"),
+            keys(
+                &["page_up", "page_down"],
+                "Scroll logs by page (Log Pane only)",
+            ),
+            keys(
+                &["top", "bottom"],
+                "Jump to top/bottom of logs (Log Pane only)",
+            ),
+            Line::from(""),
+            Line::from("Building:"),
+            keys(&["build"], "Build selected board only"),
+            keys(&["build_all"], "Build all boards (rebuild all)"),
+            keys(
+                &["build_project"],
+                "Build all boards of the selected workspace project",
+            ),
+            keys(
+                &["profile_matrix"],
+                "Boards × profiles matrix (Enter cell, r row, c column)",
+            ),
+            keys(
+                &["cancel"],
+                "Cancel the selected board's build, others keep running",
+            ),
+            keys(
+                &["restart"],
+                "Restart the selected board's build (build again when idle)",
+            ),
+            keys(&["rerun_failed"], "Rebuild the listed boards that failed"),
+            Line::from(""),
+            Line::from("Other Actions:"),
+            keys(
+                &["actions"],
+                "Show action menu (Build/Flash/Monitor/Clean/Purge)",
+            ),
+            keys(&["refresh"], "Refresh board list"),
+            keys(
+                &["tags"],
+                "Filter boards by tags (e.g. psram,!c3; empty clears)",
+            ),
+            keys(
+                &["status_filter"],
+                "List only failed boards, then only building ones, then all",
+            ),
+            keys(
+                &["name_filter"],
+                "List only boards whose name contains the typed text",
+            ),
+            keys(
+                &["search", "next_match", "previous_match"],
+                "Search the selected board's log, next / previous match",
+            ),
+            keys(
+                &["menuconfig"],
+                "Run menuconfig for the selected ESP-IDF board",
+            ),
+            keys(
+                &["open_in_editor"],
+                "Open the log's next compiler diagnostic in $EDITOR",
+            ),
+            keys(
+                &["watch"],
+                "Watch mode: rebuild affected boards when sources change",
+            ),
+            keys(&["history"], "Build history and timing trends"),
+            keys(
+                &["dashboard"],
+                "Dashboard of the run: results, timings, sizes, cache, devices",
+            ),
+            keys(
+                &["diagnostics"],
+                "Compiler diagnostics of all boards, each listed once",
+            ),
+            keys(
+                &["queue_front", "queue_earlier", "queue_later"],
+                "Move a queued build to the front, earlier or later",
+            ),
+            keys(
+                &["flash_devices"],
+                "Flash all connected devices at once, each with its board",
+            ),
+            keys(
+                &["ota"],
+                "Update the devices of espbrew.yaml's ota: section over the air",
+            ),
+            keys(
+                &["serial_monitors"],
+                "Serial monitor of each connected device, v tiles or merges them",
+            ),
+            keys(
+                &["core_dumps"],
+                "Crash reports of the core dumps the monitors captured",
+            ),
+            keys(
+                &["compare_logs"],
+                "Mark a board, then compare its log side by side with another's",
+            ),
+            keys(
+                &["command_palette"],
+                "Command palette: find any action by typing (also Ctrl+P)",
+            ),
+            keys(&["help"], "Toggle this help"),
+            keys(
+                &["quit"],
+                "Quit (Ctrl+C always, Esc / back when nothing is open)",
+            ),
+            Line::from(""),
+            Line::from("Note: Focused pane is highlighted with a colored border"),
+            Line::from("Logs are saved in ./logs/ | Scripts in ./support/"),
+            Line::from(
+                "Mouse: click boards and hints, wheel scrolls, drag the split | Shift+drag selects text",
+            ),
+            Line::from("Keys are remapped in the [keys] of ~/.config/espbrew/config.toml"),
+        ];
+
+        let help_paragraph = Paragraph::new(help_text)
+            .block(Block::default().title("Help").borders(Borders::ALL))
+            .style(Style::default().bg(theme.background));
+
+        f.render_widget(help_paragraph, area);
+    }
+
+    render_help_bar(f, app, layout.help_bar);
+    render_profile_matrix(f, app);
+    render_history_panel(f, app);
+    render_dashboard_panel(f, app);
+    render_diagnostics_panel(f, app);
+    render_device_flash_panel(f, app);
+    render_ota_panel(f, app);
+    render_serial_monitor_panel(f, app);
+    render_core_dump_panel(f, app);
+    render_log_comparison_panel(f, app);
+    render_action_menu(f, app);
+    render_component_action_menu(f, app);
+    render_remote_board_dialog(f, app);
+    render_local_board_dialog(f, app);
+    render_command_palette(f, app);
+}
+
+/// Render the command palette over everything else
+fn render_command_palette(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    let Some(palette) = &app.command_palette else {
+        return;
+    };
+
+    let area = centered_rect(60, 60, f.area());
+    let width = area.width.saturating_sub(2) as usize;
+    // The query, the matches and the footer inside the border
+    let visible = area.height.saturating_sub(5).max(1) as usize;
+    let first = palette.selected.saturating_sub(visible - 1);
+
+    let mut lines = vec![
+        Line::from(vec![
+            Span::styled(
+                "> ",
+                Style::default()
+                    .fg(theme.accent)
+                    .add_modifier(Modifier::BOLD),
+            ),
+            Span::raw(format!("{}█", palette.query)),
+        ]),
+        Line::from(""),
+    ];
+    for (row, (index, found)) in palette.matches.iter().enumerate().skip(first).take(visible) {
+        let entry = &palette.entries[*index];
+        let selected = row == palette.selected;
+        let base = if selected {
+            Style::default().bg(theme.selection).fg(theme.selected_text)
+        } else {
+            Style::default().fg(theme.text)
+        };
+        let mut spans: Vec<Span> = entry
+            .title
+            .chars()
+            .enumerate()
+            .map(|(i, c)| {
+                let style = if found.positions.contains(&i) {
+                    base.fg(theme.highlight).add_modifier(Modifier::BOLD)
+                } else {
+                    base
+                };
+                Span::styled(c.to_string(), style)
+            })
+            .collect();
+        let padding =
+            width.saturating_sub(entry.title.chars().count() + entry.keys.chars().count() + 1);
+        spans.push(Span::styled(" ".repeat(padding), base));
+        spans.push(Span::styled(entry.keys.clone(), base.fg(theme.muted)));
+        lines.push(Line::from(spans));
+    }
+    if palette.matches.is_empty() {
+        lines.push(Line::from(Span::styled(
+            "No matching command",
+            Style::default().fg(theme.muted),
+        )));
+    }
+    while lines.len() < visible + 2 {
+        lines.push(Line::from(""));
+    }
+    lines.push(Line::from(Span::styled(
+        format!(
+            "{} of {} | [↑↓]Select [Enter]Run [Esc]Close",
+            palette.matches.len(),
+            palette.entries.len()
+        ),
+        Style::default().fg(theme.muted),
+    )));
+
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("⌨️  Commands")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// Colorize log lines based on content
+fn colorize_log_line<'a>(theme: &Theme, line: &'a str) -> Line<'a> {
+    use crate::config::sdkconfig_diff::{CHANGED_MARKER, LEFT_ONLY_MARKER, RIGHT_ONLY_MARKER};
+    use crate::utils::backtrace::FRAME_MARKER;
+
+    let line_lower = line.to_lowercase();
+
+    // Config diff lines are colored by kind, whatever option names they contain
+    if line.starts_with(CHANGED_MARKER) {
+        Line::from(Span::styled(line, Style::default().fg(theme.warning)))
+    } else if line.starts_with(LEFT_ONLY_MARKER) {
+        Line::from(Span::styled(line, Style::default().fg(theme.highlight)))
+    } else if line.starts_with(RIGHT_ONLY_MARKER) {
+        Line::from(Span::styled(line, Style::default().fg(theme.accent)))
+    } else if line.starts_with(FRAME_MARKER) {
+        // Decoded backtrace frames, whatever their function names contain
+        Line::from(Span::styled(line, Style::default().fg(theme.log_frame)))
+    } else if line_lower.contains("error")
+        || line_lower.contains("failed")
+        || line_lower.contains("panicked")
+        || line_lower.contains("❌")
+    {
+        Line::from(Span::styled(line, Style::default().fg(theme.log_error)))
+    } else if line_lower.contains("warning") || line_lower.contains("warn") {
+        Line::from(Span::styled(line, Style::default().fg(theme.log_warning)))
+    } else if line_lower.contains("success")
+        || line_lower.contains("✅")
+        || line_lower.contains("completed")
+    {
+        Line::from(Span::styled(line, Style::default().fg(theme.log_success)))
+    } else if line_lower.contains("info") || line_lower.contains("note") {
+        Line::from(Span::styled(line, Style::default().fg(theme.log_info)))
+    } else {
+        Line::from(line)
+    }
+}
+
+/// Create a centered rectangle
+fn centered_rect(percent_x: u16, percent_y: u16, r: Rect) -> Rect {
+    let popup_layout = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints([
+            Constraint::Percentage((100 - percent_y) / 2),
+            Constraint::Percentage(percent_y),
+            Constraint::Percentage((100 - percent_y) / 2),
+        ])
+        .split(r);
+
+    Layout::default()
+        .direction(Direction::Horizontal)
+        .constraints([
+            Constraint::Percentage((100 - percent_x) / 2),
+            Constraint::Percentage(percent_x),
+            Constraint::Percentage((100 - percent_x) / 2),
+        ])
+        .split(popup_layout[1])[1]
+}
+
+/// Render the boards × profiles grid over the main layout
+fn render_profile_matrix(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    let Some(matrix) = &app.profile_matrix else {
+        return;
+    };
+
+    let board_width = matrix
+        .boards
+        .iter()
+        .map(|b| b.chars().count())
+        .max()
+        .unwrap_or(0)
+        .max("board".len())
+        + 2;
+    let column_width = matrix
+        .profiles
+        .iter()
+        .map(|p| p.chars().count())
+        .max()
+        .unwrap_or(0)
+        .max(4)
+        + 4;
+
+    let mut header = vec![Span::styled(
+        format!("{:<width$}", "board", width = board_width),
+        Style::default().fg(theme.muted),
+    )];
+    for (column, profile) in matrix.profiles.iter().enumerate() {
+        let style = if column == app.matrix_cursor.1 {
+            Style::default()
+                .fg(theme.warning)
+                .add_modifier(Modifier::BOLD)
+        } else {
+            Style::default().fg(theme.warning)
+        };
+        header.push(Span::styled(
+            format!("{:<width$}", profile, width = column_width),
+            style,
+        ));
+    }
+
+    let mut lines = vec![Line::from(header), Line::from("")];
+    for (row, board_name) in matrix.boards.iter().enumerate() {
+        let row_style = if row == app.matrix_cursor.0 {
+            Style::default().add_modifier(Modifier::BOLD)
+        } else {
+            Style::default()
+        };
+        let mut spans = vec![Span::styled(
+            format!("{:<width$}", board_name, width = board_width),
+            row_style,
+        )];
+
+        for column in 0..matrix.profiles.len() {
+            let board = matrix
+                .cell(row, column)
+                .and_then(|cell| app.boards.iter().find(|b| b.name == cell));
+            let (symbol, color) = match board {
+                Some(board) => (board.status.symbol(), theme.status(&board.status)),
+                None => ("·", theme.dim),
+            };
+            let mut style = Style::default().fg(color);
+            if (row, column) == app.matrix_cursor {
+                style = style.bg(theme.selection).add_modifier(Modifier::BOLD);
+            }
+            spans.push(Span::styled(
+                format!(" {:<width$}", symbol, width = column_width - 1),
+                style,
+            ));
+        }
+        lines.push(Line::from(spans));
+    }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "[←↑↓→]Move [Enter/B]Cell [R]Row [C]Column [Esc/G]Close",
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(60, 50, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("🧮 Profile Matrix")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// Render the build statistics of the boards over the main layout
+fn render_history_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_history {
+        return;
+    }
+
+    let board_width = app
+        .build_history
+        .iter()
+        .map(|stats| stats.board.chars().count())
+        .max()
+        .unwrap_or(0)
+        .max("board".len())
+        + 2;
+
+    let mut lines = vec![
+        Line::from(Span::styled(
+            format!(
+                "{:<width$}{:>7}{:>6}{:>10}{:>10}{:>8}  recent",
+                "board",
+                "builds",
+                "ok",
+                "average",
+                "trend",
+                "size Δ",
+                width = board_width
+            ),
+            Style::default().fg(theme.muted),
+        )),
+        Line::from(""),
+    ];
+
+    if app.build_history.is_empty() {
+        lines.push(Line::from(Span::styled(
+            "No builds recorded yet",
+            Style::default().fg(theme.muted),
+        )));
+    }
+
+    let selected = app.boards.get(app.selected_board).map(|b| b.name.as_str());
+    for stats in &app.build_history {
+        let row_style = if Some(stats.board.as_str()) == selected {
+            Style::default().add_modifier(Modifier::BOLD)
+        } else {
+            Style::default()
+        };
+        let (trend, trend_color) = match stats.trend {
+            Some(ms) if ms.abs() >= 1000 => (
+                format!("{:+}s", ms / 1000),
+                if ms > 0 { theme.error } else { theme.success },
+            ),
+            Some(_) => ("±0s".to_string(), theme.muted),
+            None => ("-".to_string(), theme.muted),
+        };
+        let (size_delta, size_color) = match stats.size_delta {
+            Some(delta) if delta != 0 => (
+                format!(
+                    "{}{}",
+                    if delta > 0 { "+" } else { "-" },
+                    format_bytes(delta.unsigned_abs())
+                ),
+                if delta > 0 {
+                    theme.warning
+                } else {
+                    theme.success
+                },
+            ),
+            _ => ("-".to_string(), theme.muted),
+        };
+        let success_color = if stats.failures == 0 {
+            theme.success
+        } else {
+            theme.warning
+        };
+
+        lines.push(Line::from(vec![
+            Span::styled(
+                format!("{:<width$}", stats.board, width = board_width),
+                row_style,
+            ),
+            Span::raw(format!("{:>7}", stats.builds)),
+            Span::styled(
+                format!("{:>5.0}%", stats.success_rate()),
+                Style::default().fg(success_color),
+            ),
+            Span::raw(format!(
+                "{:>10}",
+                stats
+                    .average
+                    .map(format_duration)
+                    .unwrap_or_else(|| "-".to_string())
+            )),
+            Span::styled(format!("{:>10}", trend), Style::default().fg(trend_color)),
+            Span::styled(
+                format!("{:>8}", size_delta),
+                Style::default().fg(size_color),
+            ),
+            Span::raw("  "),
+            Span::styled(
+                sparkline(&stats.recent_durations),
+                Style::default().fg(theme.accent),
+            ),
+        ]));
+    }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "Trend: recent successful builds against the ones before | [Esc/S]Close",
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(70, 50, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("📈 Build History")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// Render the totals and timings of the run over the main layout
+fn render_dashboard_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_dashboard {
+        return;
+    }
+
+    let boards = app.dashboard_boards();
+    let totals = DashboardTotals::new(&boards);
+    let outcome_color = |outcome: RunOutcome| match outcome {
+        RunOutcome::Passed => theme.success,
+        RunOutcome::Failed => theme.error,
+        RunOutcome::Skipped => theme.muted,
+        RunOutcome::Running => theme.warning,
+    };
+    let bold = |color: Color| Style::default().fg(color).add_modifier(Modifier::BOLD);
+
+    let mut headline = vec![
+        Span::styled(
+            format!("✅ {} passed  ", totals.passed),
+            bold(theme.success),
+        ),
+        Span::styled(format!("❌ {} failed  ", totals.failed), bold(theme.error)),
+        Span::styled(format!("⏭️  {} skipped", totals.skipped), bold(theme.muted)),
+    ];
+    if totals.running > 0 {
+        headline.push(Span::styled(
+            format!("  ⚙️  {} running", totals.running),
+            bold(theme.warning),
+        ));
+    }
+    let board_width = boards
+        .iter()
+        .map(|board| board.board.chars().count())
+        .max()
+        .unwrap_or(0)
+        .max("board".len())
+        + 2;
+    let mut lines = vec![
+        Line::from(headline),
+        Line::from(Span::styled(
+            totals.timings(app.dashboard_wall_time()),
+            Style::default().fg(theme.text),
+        )),
+        Line::from(""),
+        Line::from(Span::styled(
+            format!(
+                "{:<width$}{:<9}{:>10}{:>13}{:>8}",
+                "board",
+                "result",
+                "time",
+                "size",
+                "cache",
+                width = board_width
+            ),
+            Style::default().fg(theme.muted),
+        )),
+    ];
+    for board in &boards {
+        let [duration, size, cache] = board_columns(board);
+        lines.push(Line::from(vec![
+            Span::raw(format!("{:<width$}", board.board, width = board_width)),
+            Span::styled(
+                format!("{:<9}", board.outcome.label()),
+                Style::default().fg(outcome_color(board.outcome)),
+            ),
+            Span::raw(format!("{:>10}{:>13}{:>8}", duration, size, cache)),
+        ]));
+    }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "Devices",
+        Style::default()
+            .fg(theme.accent)
+            .add_modifier(Modifier::BOLD),
+    )));
+    if app.dashboard_devices.is_empty() {
+        lines.push(Line::from(Span::styled(
+            "No ESP devices connected",
+            Style::default().fg(theme.muted),
+        )));
+    }
+    for device in &app.dashboard_devices {
+        let state_color = match device.state {
+            DeviceState::CrashLooping => theme.error,
+            DeviceState::Monitored => theme.success,
+            DeviceState::Idle => theme.muted,
+            _ => theme.warning,
+        };
+        lines.push(Line::from(vec![
+            Span::raw(format!(
+                "{:<24}{:<width$}",
+                device.port,
+                device.board.as_deref().unwrap_or("-"),
+                width = board_width
+            )),
+            Span::styled(device.state.label(), Style::default().fg(state_color)),
+        ]));
+    }
+
+    lines.push(Line::from(""));
+    let footer = if app.dashboard_copied {
+        "📋 Copied as Markdown | [y]Copy [r]Refresh devices [Esc/i]Close"
+    } else {
+        "[y]Copy as Markdown [r]Refresh devices [Esc/i]Close"
+    };
+    lines.push(Line::from(Span::styled(
+        footer,
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(70, 70, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("📊 Dashboard")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// Render the deduplicated compiler diagnostics of all boards over the main layout
+fn render_diagnostics_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    let Some(diagnostics) = &app.diagnostics else {
+        return;
+    };
+
+    let count = |severity: Severity| {
+        diagnostics
+            .iter()
+            .filter(|d| d.severity == severity)
+            .count()
+    };
+    let mut lines = vec![
+        Line::from(Span::styled(
+            format!(
+                "{} warning(s), {} error(s), each listed once with the boards it occurred on",
+                count(Severity::Warning),
+                count(Severity::Error)
+            ),
+            Style::default().fg(theme.muted),
+        )),
+        Line::from(""),
+    ];
+
+    if diagnostics.is_empty() {
+        lines.push(Line::from(Span::styled(
+            "No compiler warnings or errors in the board logs",
+            Style::default().fg(theme.muted),
+        )));
+    }
+
+    for diagnostic in diagnostics {
+        let color = match diagnostic.severity {
+            Severity::Error => theme.error,
+            Severity::Warning => theme.warning,
+        };
+        lines.push(Line::from(vec![
+            Span::styled(
+                format!("{} {}: ", diagnostic.severity.icon(), diagnostic.location),
+                Style::default().fg(color).add_modifier(Modifier::BOLD),
+            ),
+            Span::raw(diagnostic.message.clone()),
+        ]));
+        lines.push(Line::from(Span::styled(
+            format!(
+                "    {} board(s): {}",
+                diagnostic.boards.len(),
+                diagnostic.boards.join(", ")
+            ),
+            Style::default().fg(theme.accent),
+        )));
+    }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "Errors first, then the most shared | [Esc/D]Close",
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(80, 60, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("🩺 Diagnostics")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .wrap(Wrap { trim: false })
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// State of a board in the list: its place in the build queue, or the
+/// progress of its build against the usual duration and the time taken, and
+/// the application size once built
+fn board_progress_spans(
+    app: &App,
+    board: &BoardConfig,
+    queue_position: Option<usize>,
+) -> Vec<Span<'static>> {
+    let theme = &app.theme;
+    let muted = Style::default().fg(theme.muted);
+    if let Some(position) = queue_position {
+        return vec![Span::styled(format!(" queued #{}", position + 1), muted)];
+    }
+    let label = board.status.label();
+    if label.is_empty() {
+        return Vec::new();
+    }
+    let mut spans = vec![Span::styled(
+        format!(" {}", label),
+        Style::default().fg(theme.status(&board.status)),
+    )];
+    let (progress, elapsed) = app.board_progress(board);
+    if let Some(percent) = progress {
+        spans.push(Span::styled(
+            format!(" {} {:>2}%", progress_bar(percent, 8), percent),
+            Style::default().fg(theme.status(&board.status)),
+        ));
+    }
+    if let Some(took) = elapsed.or(board.build_time) {
+        spans.push(Span::styled(format!(" {}", format_duration(took)), muted));
+    }
+    if elapsed.is_none()
+        && matches!(board.status, BuildStatus::Success | BuildStatus::Flashed)
+        && let Some(size) = app.board_flash_sizes.get(&board.name)
+    {
+        spans.push(Span::styled(format!(" {}", format_bytes(*size)), muted));
+    }
+    spans
+}
+
+/// Render two boards' logs side by side over the main layout, scrolled
+/// together, the lines differing between them highlighted
+fn render_log_comparison_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    let Some(comparison) = &app.log_comparison else {
+        return;
+    };
+    let (Some(left_log), Some(right_log)) = (
+        app.board_log(&comparison.left),
+        app.board_log(&comparison.right),
+    ) else {
+        return;
+    };
+
+    let area = centered_rect(96, 90, f.area());
+    f.render_widget(Clear, area);
+    let differences = differing_rows(&comparison.rows).len();
+    let block = Block::default()
+        .title(format!(
+            "🔀 {} ↔ {} ({} differing line(s))",
+            comparison.left, comparison.right, differences
+        ))
+        .borders(Borders::ALL)
+        .border_style(Style::default().fg(theme.border_focused))
+        .style(Style::default().bg(theme.background));
+    let inner = block.inner(area);
+    f.render_widget(block, area);
+    let chunks = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints([Constraint::Min(0), Constraint::Length(1)])
+        .split(inner);
+    let columns = Layout::default()
+        .direction(Direction::Horizontal)
+        .constraints([Constraint::Percentage(50), Constraint::Percentage(50)])
+        .split(chunks[0]);
+
+    // Diff-style markers: ~ printed differently, - left only, + right only
+    let side = |log: &[String], index: Option<usize>, kind: DiffKind| -> Line<'static> {
+        let Some(index) = index else {
+            return Line::from("");
+        };
+        let (marker, color) = match kind {
+            DiffKind::Same => ("  ", theme.text),
+            DiffKind::Changed => ("~ ", theme.warning),
+            DiffKind::LeftOnly => ("- ", theme.log_error),
+            DiffKind::RightOnly => ("+ ", theme.log_success),
+        };
+        Line::from(vec![
+            Span::styled(
+                format!("{:>5} ", index + 1),
+                Style::default().fg(theme.muted),
+            ),
+            Span::styled(
+                format!("{}{}", marker, log.get(index).map_or("", String::as_str)),
+                Style::default().fg(color),
+            ),
+        ])
+    };
+    let rows = comparison.visible_rows();
+    let height = usize::from(columns[0].height.saturating_sub(2));
+    let shown = rows.iter().skip(comparison.scroll).take(height);
+    let (left_lines, right_lines): (Vec<_>, Vec<_>) = shown
+        .map(|row| {
+            (
+                side(left_log, row.left, row.kind),
+                side(right_log, row.right, row.kind),
+            )
+        })
+        .unzip();
+
+    for ((name, lines), column) in [
+        (&comparison.left, left_lines),
+        (&comparison.right, right_lines),
+    ]
+    .into_iter()
+    .zip(columns.iter())
+    {
+        let status = app
+            .boards
+            .iter()
+            .find(|board| board.name == *name)
+            .map(|board| (board.status.symbol(), theme.status(&board.status)));
+        let (symbol, color) = status.unwrap_or(("", theme.text));
+        let pane = Paragraph::new(lines).block(
+            Block::default()
+                .title(Span::styled(
+                    format!("{} {}", symbol, name),
+                    Style::default().fg(color).add_modifier(Modifier::BOLD),
+                ))
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border)),
+        );
+        f.render_widget(pane, *column);
+    }
+
+    let footer = Paragraph::new(Line::from(Span::styled(
+        format!(
+            "Row {}/{}{} | [↑↓/PgUp/PgDn]Scroll [n/N]Next/Prev difference [d]Differences only [x]Swap [Esc/L]Close",
+            (comparison.scroll + 1).min(rows.len()),
+            rows.len(),
+            if comparison.differences_only {
+                " (differences only)"
+            } else {
+                ""
+            }
+        ),
+        Style::default().fg(theme.muted),
+    )));
+    f.render_widget(footer, chunks[1]);
+}
+
+/// `██████░░░░` for a share of `width` cells
+fn progress_bar(percent: u8, width: usize) -> String {
+    let filled = width * usize::from(percent.min(100)) / 100;
+    format!("{}{}", "█".repeat(filled), "░".repeat(width - filled))
+}
+
+/// Render the devices flashed at once, each with its progress, over the main layout
+fn render_device_flash_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_device_flash {
+        return;
+    }
+    let Some(run) = &app.device_flash else {
+        return;
+    };
+
+    let mut lines = Vec::new();
+    if run.probing {
+        lines.push(Line::from(Span::styled(
+            "🔍 Identifying the devices on the serial ports...",
+            Style::default().fg(theme.warning),
+        )));
+    } else if run.devices.is_empty() {
+        lines.push(Line::from(Span::styled(
+            "No connected device matches a board configuration",
+            Style::default().fg(theme.muted),
+        )));
+    }
+
+    let label_width = run
+        .devices
+        .iter()
+        .map(|device| device.label.chars().count())
+        .max()
+        .unwrap_or(0);
+    for device in &run.devices {
+        let color = theme.status(&device.status);
+        lines.push(Line::from(vec![
+            Span::raw(format!("{} ", device.status.symbol())),
+            Span::styled(
+                format!("{:<width$} ", device.label, width = label_width),
+                Style::default().add_modifier(Modifier::BOLD),
+            ),
+            Span::styled(
+                progress_bar(device.progress, 24),
+                Style::default().fg(color),
+            ),
+            Span::raw(format!(" {:>3}%", device.progress)),
+            Span::styled(
+                if device.verified { " ✔ verified" } else { "" },
+                Style::default().fg(theme.success),
+            ),
+        ]));
+        lines.push(Line::from(Span::styled(
+            format!("    {} | {}", device.hardware, device.last_line),
+            Style::default().fg(theme.muted),
+        )));
+    }
+
+    if !run.skipped.is_empty() {
+        lines.push(Line::from(""));
+    }
+    for (port, reason) in &run.skipped {
+        lines.push(Line::from(Span::styled(
+            format!("⏭️  {}: {}", port, reason),
+            Style::default().fg(theme.warning),
+        )));
+    }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "Output also goes to each board's log | [R]Flash again | [Esc/U]Close",
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(80, 60, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("🔥 Flash Connected Devices")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .wrap(Wrap { trim: false })
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
+}
+
+/// Render the serial monitor panes over the main layout: one tab at a time,
+/// all panes tiled, or their output merged
+fn render_serial_monitor_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_serial_monitor {
+        return;
     }
 
-    // Tool warning modal (project-specific)
-    if app.show_tool_warning && !app.tool_warning_acknowledged {
-        let area = centered_rect(70, 20, f.area());
-        f.render_widget(Clear, area);
+    let area = centered_rect(90, 85, f.area());
+    f.render_widget(Clear, area);
+    let block = Block::default()
+        .title(format!("📟 Serial Monitor ({})", app.monitor_layout.name()))
+        .borders(Borders::ALL)
+        .border_style(Style::default().fg(theme.border_focused))
+        .style(Style::default().bg(theme.background));
+    let inner = block.inner(area);
+    f.render_widget(block, area);
+
+    let Some(monitor) = app.serial_monitors.get(app.selected_monitor) else {
+        let empty = Paragraph::new(Line::from(Span::styled(
+            "No ESP device connected | [R]Look again | [Esc]Back",
+            Style::default().fg(theme.muted),
+        )));
+        f.render_widget(empty, inner);
+        return;
+    };
 
-        let warning_lines: Vec<Line> = app
-            .tool_warning_message
-            .split('\n')
-            .map(Line::from)
-            .collect();
+    let chunks = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints([
+            Constraint::Length(1),
+            Constraint::Min(0),
+            Constraint::Length(1),
+            Constraint::Length(1),
+        ])
+        .split(inner);
 
-        let warning_paragraph = Paragraph::new(warning_lines)
-            .block(
-                Block::default()
-                    .title("Build Tools Notice - Flashing Still Available!")
-                    .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Yellow)),
-            )
-            .style(Style::default().bg(Color::Black))
-            .wrap(Wrap { trim: true });
+    let titles: Vec<Line> = app
+        .serial_monitors
+        .iter()
+        .enumerate()
+        .map(|(index, monitor)| monitor_title(app, index, monitor))
+        .collect();
+    let tabs = Tabs::new(titles)
+        .select(app.selected_monitor)
+        .highlight_style(
+            Style::default()
+                .fg(theme.accent)
+                .add_modifier(Modifier::BOLD | Modifier::UNDERLINED),
+        );
+    f.render_widget(tabs, chunks[0]);
+
+    // Unwrapped, so the newest lines fill each pane exactly
+    let shown = match app.monitor_layout {
+        _ if app.show_memory => {
+            render_memory(f, app, chunks[1]);
+            monitor
+        }
+        _ if app.show_plotter => {
+            render_plot(f, theme, monitor, chunks[1]);
+            monitor
+        }
+        MonitorLayout::Tabs => {
+            let lines: Vec<Line> = monitor
+                .filtered_lines(usize::from(chunks[1].height), &app.monitor_filter)
+                .into_iter()
+                .map(|line| monitor_line(app, line))
+                .collect();
+            f.render_widget(Paragraph::new(lines), chunks[1]);
+            monitor
+        }
+        MonitorLayout::Tiled => {
+            render_monitor_tiles(f, app, chunks[1]);
+            monitor
+        }
+        MonitorLayout::Merged => {
+            let lines: Vec<Line> = app
+                .merged_monitor
+                .filtered_lines(usize::from(chunks[1].height), &app.monitor_filter)
+                .into_iter()
+                .map(|line| merged_monitor_line(app, line))
+                .collect();
+            f.render_widget(Paragraph::new(lines), chunks[1]);
+            &app.merged_monitor
+        }
+    };
 
-        f.render_widget(warning_paragraph, area);
+    let mut status = vec![match &monitor.state {
+        MonitorState::Connected => Span::styled(
+            format!("{} baud", MONITOR_BAUD_RATE),
+            Style::default().fg(theme.success),
+        ),
+        MonitorState::Suspended(holders) => Span::styled(
+            format!("port released for {}", holders.join(", ")),
+            Style::default().fg(theme.warning),
+        ),
+        MonitorState::Reconnecting => Span::styled(
+            "waiting for the device to come back",
+            Style::default().fg(theme.warning),
+        ),
+        MonitorState::Closed(None) => Span::styled("closed", Style::default().fg(theme.muted)),
+        MonitorState::Closed(Some(error)) => {
+            Span::styled(error.clone(), Style::default().fg(theme.error))
+        }
+    }];
+    status.push(Span::raw(format!(" | {} lines", shown.lines.len())));
+    if shown.paused {
+        status.push(Span::styled(
+            format!(" | ⏸️  PAUSED, {} new lines held", shown.held.len()),
+            Style::default()
+                .fg(theme.warning)
+                .add_modifier(Modifier::BOLD),
+        ));
     }
-    // Help popup
-    else if app.show_help {
-        let area = centered_rect(60, 20, f.area());
-        f.render_widget(Clear, area);
+    if shown.scroll_offset > 0 {
+        status.push(Span::styled(
+            format!(" | {} lines back", shown.scroll_offset),
+            Style::default().fg(theme.accent),
+        ));
+    }
+    let filter = &app.monitor_filter;
+    if filter.is_filtering() || !filter.highlights.is_empty() {
+        status.push(Span::styled(
+            format!(" | 🔍 {}", filter.describe()),
+            Style::default().fg(theme.highlight),
+        ));
+    }
+    if let Some(script) = &monitor.script {
+        status.push(Span::styled(
+            format!(" | 📜 {}", script.progress()),
+            Style::default().fg(theme.accent),
+        ));
+    }
+    if let Some(recorder) = app.monitor_recorders.get(&monitor.port) {
+        status.push(Span::styled(
+            format!(" | 📼 REC {}", recorder.path().display()),
+            Style::default().fg(theme.error),
+        ));
+    }
+    f.render_widget(Paragraph::new(Line::from(status)), chunks[2]);
+
+    // The tags, highlight or console line being typed replace the key hints
+    let footer = match &app.monitor_input {
+        Some((input, text)) => {
+            let (prompt, hints) = match input {
+                MonitorInput::Tags => (
+                    "🏷️  Tags to show: ".to_string(),
+                    "  [Enter]Apply, empty clears [Esc]Cancel".to_string(),
+                ),
+                MonitorInput::Highlight => (
+                    "🖍️  Highlight regex: ".to_string(),
+                    "  [Enter]Apply, empty clears [Esc]Cancel".to_string(),
+                ),
+                MonitorInput::Script => (
+                    "📜 Script: ".to_string(),
+                    format!(
+                        "  [Enter]Run, one of {} [Esc]Cancel",
+                        app.console_scripts
+                            .iter()
+                            .map(|script| script.name.as_str())
+                            .collect::<Vec<_>>()
+                            .join(", ")
+                    ),
+                ),
+                MonitorInput::Console => (
+                    format!("⌨️  {} > ", monitor.port),
+                    format!(
+                        "  [Enter]Send +{} [Tab]Line ending [↑↓]History [Ctrl-C/D]Send ^C/^D [Esc]Done",
+                        app.console_line_ending.name()
+                    ),
+                ),
+            };
+            Line::from(vec![
+                Span::styled(
+                    prompt,
+                    Style::default()
+                        .fg(theme.warning)
+                        .add_modifier(Modifier::BOLD),
+                ),
+                Span::raw(format!("{}█", text)),
+                Span::styled(hints, Style::default().fg(theme.muted)),
+            ])
+        }
+        None => Line::from(Span::styled(
+            "[Tab/←→]Device [↑↓/PgUp/PgDn]Scroll [End]Follow [Space]Pause [C]Clear \
+             [L]Level [T]Tags [/]Highlight [H]Highlights on/off [G]Plot [M]Memory [I]Input [E]Script \
+             [V]Layout [Y]Copy backtrace [D]Core dumps [W]Record [S]Summary [R]Reconnect [X]Close pane [Esc/M]Back, panes keep reading",
+            Style::default().fg(theme.muted),
+        )),
+    };
+    f.render_widget(Paragraph::new(footer), chunks[3]);
+}
 
-        let help_text = vec![
-            Line::from("🍺 ESPBrew Help"),
-            Line::from(""),
-            Line::from("Navigation:"),
-            Line::from("↑/↓ or j/k    Navigate boards (Board List) / Scroll logs (Log Pane)"),
-            Line::from("Tab           Switch between Board List and Log Pane"),
-            Line::from("PgUp/PgDn     Scroll logs by page (Log Pane only)"),
-            Line::from("Home/End      Jump to top/bottom of logs (Log Pane only)"),
-            Line::from(""),
-            Line::from("Building:"),
-            Line::from("Space or b    Build selected board only"),
-            Line::from("x             Build all boards (rebuild all)"),
+/// Free heap and stack watermark trends of all panes' devices, those
+/// falling flagged
+fn render_memory(f: &mut Frame, app: &App, area: Rect) {
+    let theme = &app.theme;
+    let watched: Vec<(usize, &SerialMonitor)> = app
+        .serial_monitors
+        .iter()
+        .enumerate()
+        .filter(|(_, monitor)| !monitor.memory.is_empty())
+        .collect();
+    if watched.is_empty() {
+        let hint = Paragraph::new(vec![
+            Line::from("No heap or stack figures reported yet."),
             Line::from(""),
-            Line::from("Other Actions:"),
-            Line::from("Enter         Show action menu (Build/Flash/Monitor/Clean/Purge)"),
-            Line::from("r             Refresh board list"),
-            Line::from("h or ?        Toggle this help"),
-            Line::from("q/Ctrl+C/ESC Quit"),
+            Line::from("Print them as Free heap: <bytes>, >>heap:<bytes>,"),
+            Line::from("or stack watermark <task>: <bytes> and >>stack.<task>:<bytes>."),
+        ])
+        .style(Style::default().fg(theme.muted))
+        .alignment(Alignment::Center);
+        f.render_widget(hint, area);
+        return;
+    }
+    // The newest samples that fit next to the figures
+    let width = usize::from(area.width).saturating_sub(64).clamp(10, 120);
+    let mut lines = Vec::new();
+    for (index, monitor) in watched {
+        lines.push(Line::from(Span::styled(
+            monitor.title(),
+            Style::default()
+                .fg(theme.pane_color(index))
+                .add_modifier(Modifier::BOLD),
+        )));
+        for (name, trend) in &monitor.memory.series {
+            let values = trend.values();
+            let recent = &values[values.len().saturating_sub(width)..];
+            let floor = recent.iter().copied().min().unwrap_or(0);
+            let bars = sparkline(&recent.iter().map(|value| value - floor).collect::<Vec<_>>());
+            let falling = monitor.memory.falling().contains(name);
+            let slope = trend
+                .slope_per_minute()
+                .map_or(String::new(), |slope| format!(" {:+.0} B/min", slope));
+            lines.push(Line::from(vec![
+                Span::raw(format!("  {:<20}", name)),
+                Span::raw(format!("{:>10}", format_bytes(trend.last().unwrap_or(0)))),
+                Span::styled(
+                    format!("  min {:>10}  ", format_bytes(trend.min().unwrap_or(0))),
+                    Style::default().fg(theme.muted),
+                ),
+                Span::styled(
+                    bars,
+                    Style::default().fg(if falling { theme.error } else { theme.success }),
+                ),
+                Span::styled(slope, Style::default().fg(theme.muted)),
+                Span::styled(
+                    if falling { "  ⚠ keeps falling" } else { "" },
+                    Style::default()
+                        .fg(theme.error)
+                        .add_modifier(Modifier::BOLD),
+                ),
+            ]));
+        }
+    }
+    f.render_widget(Paragraph::new(lines), area);
+}
+
+/// Line charts of the values the pane's device printed, with their latest
+/// values in the legend
+fn render_plot(f: &mut Frame, theme: &Theme, monitor: &SerialMonitor, area: Rect) {
+    let plot = &monitor.plot;
+    if plot.is_empty() {
+        let hint = Paragraph::new(vec![
+            Line::from("No values to plot yet."),
             Line::from(""),
-            Line::from("Note: Focused pane is highlighted with cyan border"),
-            Line::from("Logs are saved in ./logs/ | Scripts in ./support/"),
-            Line::from("Text selection: Mouse support enabled for copy/paste"),
-        ];
+            Line::from(
+                "Print them as >>name:value, e.g. printf(\">>temp:%.1f >>hum:%d\\n\", t, h),",
+            ),
+            Line::from("or read them with the monitor.plot regexes of espbrew.yaml."),
+        ])
+        .style(Style::default().fg(theme.muted))
+        .alignment(Alignment::Center);
+        f.render_widget(hint, area);
+        return;
+    }
+    let points: Vec<Vec<(f64, f64)>> = plot
+        .series
+        .iter()
+        .map(|series| series.points.iter().copied().collect())
+        .collect();
+    let datasets: Vec<Dataset> = plot
+        .series
+        .iter()
+        .zip(&points)
+        .enumerate()
+        .map(|(index, (series, points))| {
+            let latest = points.last().map_or(0.0, |(_, value)| *value);
+            Dataset::default()
+                .name(format!("{} {}", series.name, latest))
+                .marker(symbols::Marker::Braille)
+                .graph_type(GraphType::Line)
+                .style(Style::default().fg(theme.pane_color(index)))
+                .data(points)
+        })
+        .collect();
+    let [x_start, x_end] = plot.x_bounds();
+    let [y_low, y_high] = plot.y_bounds();
+    let chart = Chart::new(datasets)
+        .x_axis(
+            Axis::default()
+                .title("s")
+                .style(Style::default().fg(theme.muted))
+                .bounds([x_start, x_end])
+                .labels([format!("{:.0}", x_start), format!("{:.0}", x_end)]),
+        )
+        .y_axis(
+            Axis::default()
+                .style(Style::default().fg(theme.muted))
+                .bounds([y_low, y_high])
+                .labels([
+                    format!("{:.2}", y_low),
+                    format!("{:.2}", (y_low + y_high) / 2.0),
+                    format!("{:.2}", y_high),
+                ]),
+        )
+        .legend_position(Some(LegendPosition::TopLeft));
+    f.render_widget(chart, area);
+}
 
-        let help_paragraph = Paragraph::new(help_text)
-            .block(Block::default().title("Help").borders(Borders::ALL))
-            .style(Style::default().bg(Color::Black));
+/// Line of a pane, highlighted by the first matching rule, else colored by content
+fn monitor_line<'a>(app: &App, line: &'a str) -> Line<'a> {
+    let theme = &app.theme;
+    match app.monitor_filter.highlight(line) {
+        Some(rule) => Line::from(Span::styled(
+            line,
+            Style::default()
+                .fg(theme.highlight_text)
+                .bg(theme.highlight_color(rule)),
+        )),
+        None => colorize_log_line(theme, line),
+    }
+}
 
-        f.render_widget(help_paragraph, area);
+/// A pane's state symbol and title in its color
+fn monitor_title(app: &App, index: usize, monitor: &SerialMonitor) -> Line<'static> {
+    let theme = &app.theme;
+    let (symbol, color) = match &monitor.state {
+        MonitorState::Connected => ("●", theme.success),
+        MonitorState::Suspended(_) => ("⏸", theme.warning),
+        MonitorState::Reconnecting => ("◌", theme.warning),
+        MonitorState::Closed(None) => ("○", theme.muted),
+        MonitorState::Closed(Some(_)) => ("✖", theme.error),
+    };
+    let mut spans = vec![
+        Span::styled(format!("{} ", symbol), Style::default().fg(color)),
+        Span::styled(
+            monitor.title(),
+            Style::default().fg(theme.pane_color(index)),
+        ),
+    ];
+    if app.is_monitor_crash_looping(monitor) {
+        spans.push(Span::styled(" 🔁", Style::default().fg(theme.error)));
     }
+    if !monitor.memory.falling().is_empty() {
+        spans.push(Span::styled(" 📉", Style::default().fg(theme.warning)));
+    }
+    Line::from(spans)
+}
 
-    render_help_bar(f, app, main_chunks[1]);
-    render_action_menu(f, app);
-    render_component_action_menu(f, app);
-    render_remote_board_dialog(f, app);
-    render_local_board_dialog(f, app);
+/// All panes in a grid, the selected one with a highlighted border
+fn render_monitor_tiles(f: &mut Frame, app: &App, area: Rect) {
+    let theme = &app.theme;
+    let count = app.serial_monitors.len();
+    let (rows, columns) = tile_grid(count);
+    let row_areas = Layout::default()
+        .direction(Direction::Vertical)
+        .constraints(vec![Constraint::Ratio(1, rows as u32); rows])
+        .split(area);
+    for (row, row_area) in row_areas.iter().enumerate() {
+        let first = row * columns;
+        // The panes of the last row share its width
+        let in_row = columns.min(count - first);
+        let tile_areas = Layout::default()
+            .direction(Direction::Horizontal)
+            .constraints(vec![Constraint::Ratio(1, in_row as u32); in_row])
+            .split(*row_area);
+        for (column, tile_area) in tile_areas.iter().enumerate() {
+            let index = first + column;
+            let monitor = &app.serial_monitors[index];
+            let border = if index == app.selected_monitor {
+                theme.border_focused
+            } else {
+                theme.dim
+            };
+            let block = Block::default()
+                .title(monitor_title(app, index, monitor))
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(border));
+            let inner = block.inner(*tile_area);
+            f.render_widget(block, *tile_area);
+            let lines: Vec<Line> = monitor
+                .filtered_lines(usize::from(inner.height), &app.monitor_filter)
+                .into_iter()
+                .map(|line| monitor_line(app, line))
+                .collect();
+            f.render_widget(Paragraph::new(lines), inner);
+        }
+    }
 }
 
-/// Colorize log lines based on content
-fn colorize_log_line(line: &str) -> Line<'_> {
-    let line_lower = line.to_lowercase();
+/// Line of the merged view with its device prefix in the pane's color
+fn merged_monitor_line<'a>(app: &App, line: &'a str) -> Line<'a> {
+    let theme = &app.theme;
+    let color = merged_source(line)
+        .and_then(|title| app.serial_monitors.iter().position(|m| m.title() == title))
+        .map(|index| theme.pane_color(index))
+        .unwrap_or(theme.muted);
+    match line.split_once("] ") {
+        Some((prefix, text)) => Line::from(vec![
+            Span::styled(
+                format!("{}] ", prefix),
+                Style::default().fg(color).add_modifier(Modifier::BOLD),
+            ),
+            match app.monitor_filter.highlight(text) {
+                Some(rule) => Span::styled(
+                    text,
+                    Style::default()
+                        .fg(theme.highlight_text)
+                        .bg(theme.highlight_color(rule)),
+                ),
+                None => Span::raw(text),
+            },
+        ]),
+        None => Line::from(line),
+    }
+}
 
-    if line_lower.contains("error") || line_lower.contains("failed") || line_lower.contains("❌") {
-        Line::from(Span::styled(line, Style::default().fg(Color::Red)))
-    } else if line_lower.contains("warning") || line_lower.contains("warn") {
-        Line::from(Span::styled(line, Style::default().fg(Color::Yellow)))
-    } else if line_lower.contains("success")
-        || line_lower.contains("✅")
-        || line_lower.contains("completed")
-    {
-        Line::from(Span::styled(line, Style::default().fg(Color::Green)))
-    } else if line_lower.contains("info") || line_lower.contains("note") {
-        Line::from(Span::styled(line, Style::default().fg(Color::Cyan)))
-    } else {
-        Line::from(line)
+/// Render the devices of an OTA rollout, each with its status, over the main layout
+fn render_ota_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_ota {
+        return;
+    }
+    let Some(rollout) = &app.ota_rollout else {
+        return;
+    };
+
+    let mut lines = Vec::new();
+    if rollout.preparing {
+        lines.push(Line::from(Span::styled(
+            "📦 Looking up the devices and their app binaries...",
+            Style::default().fg(theme.warning),
+        )));
+    }
+    if let Some(error) = &rollout.error {
+        lines.push(Line::from(Span::styled(
+            format!("❌ {}", error),
+            Style::default().fg(theme.error),
+        )));
+    }
+
+    let name_width = rollout
+        .devices
+        .iter()
+        .map(|(name, _)| name.chars().count())
+        .max()
+        .unwrap_or(0);
+    for (name, status) in &rollout.devices {
+        let color = match status {
+            OtaStatus::Done => theme.success,
+            OtaStatus::Failed(_) => theme.error,
+            OtaStatus::Pending => theme.muted,
+            _ => theme.warning,
+        };
+        lines.push(Line::from(vec![
+            Span::styled(
+                format!("{:<width$} ", name, width = name_width),
+                Style::default().add_modifier(Modifier::BOLD),
+            ),
+            Span::styled(
+                progress_bar(status.progress(), 24),
+                Style::default().fg(color),
+            ),
+            Span::styled(
+                format!(" {}", status.describe()),
+                Style::default().fg(color),
+            ),
+        ]));
     }
+
+    lines.push(Line::from(""));
+    lines.push(Line::from(Span::styled(
+        "[R]Deploy again | [Esc/O]Close",
+        Style::default().fg(theme.muted),
+    )));
+
+    let area = centered_rect(80, 60, f.area());
+    f.render_widget(Clear, area);
+    let popup = Paragraph::new(lines)
+        .block(
+            Block::default()
+                .title("📡 OTA Rollout")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .wrap(Wrap { trim: false })
+        .style(Style::default().bg(theme.background));
+    f.render_widget(popup, area);
 }
 
-/// Create a centered rectangle
-fn centered_rect(percent_x: u16, percent_y: u16, r: Rect) -> Rect {
-    let popup_layout = Layout::default()
-        .direction(Direction::Vertical)
-        .constraints([
-            Constraint::Percentage((100 - percent_y) / 2),
-            Constraint::Percentage(percent_y),
-            Constraint::Percentage((100 - percent_y) / 2),
+/// Render the selected crash report of the captured core dumps over the main layout
+fn render_core_dump_panel(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
+    if !app.show_core_dumps {
+        return;
+    }
+    let area = centered_rect(90, 85, f.area());
+    f.render_widget(Clear, area);
+    let Some(report) = app.core_dumps.get(app.selected_core_dump) else {
+        let empty = Paragraph::new(vec![
+            Line::from(Span::styled(
+                "No core dump captured yet; they are caught in the serial monitor panes (M)",
+                Style::default().fg(theme.muted),
+            )),
+            Line::from(""),
+            Line::from(Span::styled(
+                "[Esc/D]Close",
+                Style::default().fg(theme.muted),
+            )),
         ])
-        .split(r);
+        .block(
+            Block::default()
+                .title("🧾 Core Dumps")
+                .borders(Borders::ALL)
+                .border_style(Style::default().fg(theme.border_focused)),
+        )
+        .style(Style::default().bg(theme.background));
+        f.render_widget(empty, area);
+        return;
+    };
 
-    Layout::default()
-        .direction(Direction::Horizontal)
+    let block = Block::default()
+        .title(format!(
+            "🧾 Core Dump {}/{}: {}",
+            app.selected_core_dump + 1,
+            app.core_dumps.len(),
+            report.title()
+        ))
+        .borders(Borders::ALL)
+        .border_style(Style::default().fg(theme.border_focused));
+    let inner = block.inner(area);
+    f.render_widget(block.style(Style::default().bg(theme.background)), area);
+    let chunks = Layout::default()
+        .direction(Direction::Vertical)
         .constraints([
-            Constraint::Percentage((100 - percent_x) / 2),
-            Constraint::Percentage(percent_x),
-            Constraint::Percentage((100 - percent_x) / 2),
+            Constraint::Length(2),
+            Constraint::Min(1),
+            Constraint::Length(1),
         ])
-        .split(popup_layout[1])[1]
+        .split(inner);
+
+    let mut header = vec![Line::from(format!(
+        "Captured {} from {}{}",
+        report.captured.format("%Y-%m-%d %H:%M:%S"),
+        if report.from_flash { "flash" } else { "UART" },
+        report
+            .elf
+            .as_ref()
+            .map(|elf| format!(", decoded with {}", elf.display()))
+            .unwrap_or_default()
+    ))];
+    header.push(match &report.saved {
+        Some(Ok(path)) => Line::from(Span::styled(
+            format!("💾 Saved to {}", path.display()),
+            Style::default().fg(theme.success),
+        )),
+        Some(Err(error)) => Line::from(Span::styled(
+            format!("❌ {}", error),
+            Style::default().fg(theme.error),
+        )),
+        None => Line::from(""),
+    });
+    f.render_widget(Paragraph::new(header), chunks[0]);
+
+    let lines: Vec<Line> = match &report.report {
+        Ok(text) => text
+            .lines()
+            .skip(report.scroll_offset)
+            .map(|line| colorize_log_line(theme, line))
+            .collect(),
+        Err(error) => {
+            let mut lines = vec![Line::from(Span::styled(
+                format!("❌ {}", error),
+                Style::default().fg(theme.error),
+            ))];
+            if let Some(dump_file) = &report.dump_file {
+                lines.push(Line::from(format!(
+                    "The dump is kept in {}",
+                    dump_file.display()
+                )));
+            }
+            lines
+        }
+    };
+    f.render_widget(Paragraph::new(lines), chunks[1]);
+    f.render_widget(
+        Paragraph::new(Line::from(Span::styled(
+            "[Tab/←→]Dump [↑↓/PgUp/PgDn]Scroll [S]Save report [Esc/D]Close",
+            Style::default().fg(theme.muted),
+        ))),
+        chunks[2],
+    );
 }
 
-/// Render the help bar at the bottom
-fn render_help_bar(f: &mut Frame, app: &App, area: Rect) {
-    let mut help_text = if app.focused_pane == FocusedPane::LogPane {
+/// Key hints of the help bar, each with the key a click on it presses
+pub fn help_bar_hints(app: &App) -> Vec<(Span<'static>, Option<KeyCode>)> {
+    let theme = &app.theme;
+    // Hints of remapped actions name their keys, and a click presses the first
+    let hint = |text: &'static str, color: Color, action: Option<&str>| {
+        let key = action.and_then(|name| app.keymap.keys(name).first().copied());
+        let text = match action.and_then(find_action) {
+            Some(action) if app.keymap.is_remapped(action.name) => {
+                format!("[{}]{} ", app.keymap.label(action.name), action.title)
+            }
+            _ => text.to_string(),
+        };
+        (Span::styled(text, Style::default().fg(color)), key)
+    };
+
+    let mut hints = if app.focused_pane == FocusedPane::LogPane {
         vec![
-            Span::styled("[↑↓]Scroll ", Style::default().fg(Color::Cyan)),
-            Span::styled("[PgUp/PgDn]Page ", Style::default().fg(Color::Cyan)),
-            Span::styled("[Home/End]Top/Bottom ", Style::default().fg(Color::Cyan)),
-            Span::styled("[Tab]Switch Pane ", Style::default().fg(Color::White)),
-            Span::styled("[Enter]Actions ", Style::default().fg(Color::Green)),
+            hint("[↑↓]Scroll ", theme.accent, None),
+            hint("[PgUp/PgDn]Page ", theme.accent, None),
+            hint("[Home/End]Top/Bottom ", theme.accent, None),
+            hint("[Tab]Switch Pane ", theme.text, Some("switch_pane")),
+            hint("[Enter]Actions ", theme.success, Some("actions")),
         ]
     } else {
         vec![
-            Span::styled("[↑↓]Navigate ", Style::default().fg(Color::Cyan)),
-            Span::styled("[Tab]Switch Pane ", Style::default().fg(Color::White)),
-            Span::styled("[Enter]Actions ", Style::default().fg(Color::Green)),
+            hint("[↑↓]Navigate ", theme.accent, None),
+            hint("[Tab]Switch Pane ", theme.text, Some("switch_pane")),
+            hint("[Enter]Actions ", theme.success, Some("actions")),
         ]
     };
 
     // Add build status and controls
     if app.build_in_progress {
-        help_text.extend(vec![Span::styled(
-            "🔨 Building... ",
-            Style::default()
-                .fg(Color::Yellow)
-                .add_modifier(Modifier::BOLD),
-        )]);
-    } else {
-        help_text.extend(vec![
+        hints.push((
             Span::styled(
-                "[Space/B]Build Selected ",
-                Style::default().fg(Color::LightYellow),
+                "🔨 Building... ",
+                Style::default()
+                    .fg(theme.warning)
+                    .add_modifier(Modifier::BOLD),
             ),
-            Span::styled("[X]Build All ", Style::default().fg(Color::Yellow)),
+            None,
+        ));
+    } else {
+        hints.extend([
+            hint("[Space/B]Build Selected ", theme.warning, Some("build")),
+            hint("[X]Build All ", theme.warning, Some("build_all")),
+        ]);
+    }
+
+    // The selected board's running action can be stopped on its own
+    if app
+        .boards
+        .get(app.selected_board)
+        .is_some_and(|board| app.is_action_running(&board.name))
+    {
+        hints.extend([
+            hint("[C]ancel ", theme.error, Some("cancel")),
+            hint("[A]Restart ", theme.error, Some("restart")),
         ]);
     }
 
     // Add remaining controls
     if !app.build_in_progress {
-        help_text.push(Span::styled(
-            "[R]Refresh ",
-            Style::default().fg(Color::Magenta),
-        ));
+        hints.push(hint("[R]Refresh ", theme.highlight, Some("refresh")));
+        if app
+            .boards
+            .iter()
+            .any(|board| matches!(board.status, BuildStatus::Failed))
+        {
+            hints.push(hint(
+                "[Shift+R]Re-run Failed ",
+                theme.error,
+                Some("rerun_failed"),
+            ));
+        }
+    }
+    hints.push(hint("[T]Tags ", theme.accent, Some("tags")));
+    hints.push(hint("[/]Search ", theme.accent, Some("search")));
+    if !app.build_in_progress && app.project_type == Some(crate::projects::ProjectType::EspIdf) {
+        hints.push(hint("[M]enuconfig ", theme.success, Some("menuconfig")));
+        hints.push(hint("[G]Profiles ", theme.warning, Some("profile_matrix")));
     }
-    help_text.extend(vec![
-        Span::styled("[H/?]Help ", Style::default().fg(Color::Blue)),
-        Span::styled("[Q/Ctrl+C/ESC]Quit ", Style::default().fg(Color::Red)),
+    hints.extend([
+        hint("[Ctrl+P]Commands ", theme.info, Some("command_palette")),
+        hint("[H/?]Help ", theme.info, Some("help")),
+        hint("[Q/Ctrl+C/ESC]Quit ", theme.error, Some("quit")),
     ]);
+    hints
+}
+
+/// Key of the help bar's hint at the column inside its border
+pub fn help_bar_key_at(app: &App, column: u16) -> Option<KeyCode> {
+    let mut start = 0;
+    for (span, key) in help_bar_hints(app) {
+        let end = start + span.width();
+        if (start..end).contains(&usize::from(column)) {
+            return key;
+        }
+        start = end;
+    }
+    None
+}
+
+/// Render the help bar at the bottom
+fn render_help_bar(f: &mut Frame, app: &App, area: Rect) {
+    let theme = &app.theme;
+    // The log search prompt replaces the key hints while it is typed
+    if let Some(input) = &app.log_search_input {
+        let prompt = Paragraph::new(Line::from(vec![
+            Span::styled(
+                "🔍 Search log: /",
+                Style::default()
+                    .fg(theme.warning)
+                    .add_modifier(Modifier::BOLD),
+            ),
+            Span::raw(format!("{}█", input)),
+            Span::styled(
+                "  [Enter]Find [Esc]Cancel (empty ends the search)",
+                Style::default().fg(theme.muted),
+            ),
+        ]))
+        .block(Block::default().borders(Borders::ALL))
+        .style(Style::default().bg(theme.bar));
+        f.render_widget(prompt, area);
+        return;
+    }
+
+    // The tag filter prompt replaces the key hints while it is edited
+    if let Some(input) = &app.tag_filter_input {
+        let prompt = Paragraph::new(Line::from(vec![
+            Span::styled(
+                "🏷️  Tag filter: ",
+                Style::default()
+                    .fg(theme.warning)
+                    .add_modifier(Modifier::BOLD),
+            ),
+            Span::raw(format!("{}█", input)),
+            Span::styled(
+                "  [Enter]Apply [Esc]Cancel",
+                Style::default().fg(theme.muted),
+            ),
+        ]))
+        .block(Block::default().borders(Borders::ALL))
+        .style(Style::default().bg(theme.bar));
+        f.render_widget(prompt, area);
+        return;
+    }
+
+    // So does the board name filter, applied while it is typed
+    if let Some(input) = &app.list_filter_input {
+        let prompt = Paragraph::new(Line::from(vec![
+            Span::styled(
+                "🔎 Board name: ",
+                Style::default()
+                    .fg(theme.warning)
+                    .add_modifier(Modifier::BOLD),
+            ),
+            Span::raw(format!("{}█", input)),
+            Span::styled("  [Enter]Keep [Esc]Clear", Style::default().fg(theme.muted)),
+        ]))
+        .block(Block::default().borders(Borders::ALL))
+        .style(Style::default().bg(theme.bar));
+        f.render_widget(prompt, area);
+        return;
+    }
+
+    let mut help_text: Vec<Span> = help_bar_hints(app)
+        .into_iter()
+        .map(|(span, _)| span)
+        .collect();
 
     // Add server discovery status with visual indicators
     let server_status_color = if app.server_discovery_in_progress {
-        Color::Yellow
+        theme.warning
     } else if app.discovered_servers.is_empty() {
-        Color::Gray
+        theme.muted
     } else {
-        Color::Green
+        theme.success
     };
 
     // Add animated indicator for discovery in progress
@@ -467,7 +2277,7 @@ fn render_help_bar(f: &mut Frame, app: &App, area: Rect) {
     };
 
     // Add a separator and prominent server discovery status
-    help_text.push(Span::styled(" | ", Style::default().fg(Color::White)));
+    help_text.push(Span::styled(" | ", Style::default().fg(theme.text)));
 
     if !app.discovered_servers.is_empty() {
         let server = &app.discovered_servers[0];
@@ -502,13 +2312,14 @@ fn render_help_bar(f: &mut Frame, app: &App, area: Rect) {
 
     let help_bar = Paragraph::new(Line::from(help_text))
         .block(Block::default().borders(Borders::ALL))
-        .style(Style::default().bg(Color::DarkGray));
+        .style(Style::default().bg(theme.bar));
 
     f.render_widget(help_bar, area);
 }
 
 /// Render the board action menu modal
 fn render_action_menu(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
     if !app.show_action_menu {
         return;
     }
@@ -530,7 +2341,7 @@ fn render_action_menu(f: &mut Frame, app: &App) {
                 Span::raw(action.name()),
                 Span::styled(
                     format!(" - {}", action.description()),
-                    Style::default().fg(Color::Gray),
+                    Style::default().fg(theme.muted),
                 ),
             ]))
         })
@@ -544,12 +2355,12 @@ fn render_action_menu(f: &mut Frame, app: &App) {
             Block::default()
                 .title(format!("Actions for: {}", selected_board_name))
                 .borders(Borders::ALL)
-                .border_style(Style::default().fg(Color::Green)),
+                .border_style(Style::default().fg(theme.success)),
         )
         .highlight_style(
             Style::default()
-                .bg(Color::Green)
-                .fg(Color::Black)
+                .bg(theme.success)
+                .fg(theme.selected_text)
                 .add_modifier(Modifier::BOLD),
         );
 
@@ -564,11 +2375,11 @@ fn render_action_menu(f: &mut Frame, app: &App) {
     };
 
     let instructions = Paragraph::new(Line::from(vec![
-        Span::styled("[↑↓]", Style::default().fg(Color::Cyan)),
+        Span::styled("[↑↓]", Style::default().fg(theme.accent)),
         Span::raw(" Navigate "),
-        Span::styled("[Enter]", Style::default().fg(Color::Green)),
+        Span::styled("[Enter]", Style::default().fg(theme.success)),
         Span::raw(" Execute "),
-        Span::styled("[ESC]", Style::default().fg(Color::Red)),
+        Span::styled("[ESC]", Style::default().fg(theme.error)),
         Span::raw(" Cancel"),
     ]));
 
@@ -577,6 +2388,7 @@ fn render_action_menu(f: &mut Frame, app: &App) {
 
 /// Render the component action menu modal
 fn render_component_action_menu(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
     if !app.show_component_action_menu {
         return;
     }
@@ -611,7 +2423,7 @@ fn render_component_action_menu(f: &mut Frame, app: &App) {
                 Span::raw(action.name()),
                 Span::styled(
                     format!(" - {}", action.description()),
-                    Style::default().fg(Color::Gray),
+                    Style::default().fg(theme.muted),
                 ),
             ]))
         })
@@ -634,12 +2446,12 @@ fn render_component_action_menu(f: &mut Frame, app: &App) {
                     selected_component_name
                 ))
                 .borders(Borders::ALL)
-                .border_style(Style::default().fg(Color::Magenta)),
+                .border_style(Style::default().fg(theme.highlight)),
         )
         .highlight_style(
             Style::default()
-                .bg(Color::Magenta)
-                .fg(Color::Black)
+                .bg(theme.highlight)
+                .fg(theme.selected_text)
                 .add_modifier(Modifier::BOLD),
         );
 
@@ -658,11 +2470,11 @@ fn render_component_action_menu(f: &mut Frame, app: &App) {
     };
 
     let instructions = Paragraph::new(Line::from(vec![
-        Span::styled("[↑↓]", Style::default().fg(Color::Cyan)),
+        Span::styled("[↑↓]", Style::default().fg(theme.accent)),
         Span::raw(" Navigate "),
-        Span::styled("[Enter]", Style::default().fg(Color::Green)),
+        Span::styled("[Enter]", Style::default().fg(theme.success)),
         Span::raw(" Execute "),
-        Span::styled("[ESC]", Style::default().fg(Color::Red)),
+        Span::styled("[ESC]", Style::default().fg(theme.error)),
         Span::raw(" Cancel"),
     ]));
 
@@ -671,6 +2483,7 @@ fn render_component_action_menu(f: &mut Frame, app: &App) {
 
 /// Render the remote board selection dialog
 fn render_remote_board_dialog(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
     if !app.show_remote_board_dialog {
         return;
     }
@@ -691,9 +2504,9 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Remote Flash - Loading")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Yellow)),
+                    .border_style(Style::default().fg(theme.warning)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true });
 
         f.render_widget(loading_paragraph, area);
@@ -715,9 +2528,9 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Remote Flash - Connection Error")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Red)),
+                    .border_style(Style::default().fg(theme.error)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true });
 
         f.render_widget(error_paragraph, area);
@@ -742,9 +2555,9 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Remote Flash - No Boards")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Yellow)),
+                    .border_style(Style::default().fg(theme.warning)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true });
 
         f.render_widget(empty_paragraph, area);
@@ -764,19 +2577,17 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
         .map(|board| {
             let display_name = board.logical_name.as_ref().unwrap_or(&board.id);
             ListItem::new(Line::from(vec![
-                Span::styled("📟 ", Style::default().fg(Color::Cyan)),
+                Span::styled("📟 ", Style::default().fg(theme.accent)),
                 Span::styled(
                     display_name.clone(),
-                    Style::default()
-                        .fg(Color::White)
-                        .add_modifier(Modifier::BOLD),
+                    Style::default().fg(theme.text).add_modifier(Modifier::BOLD),
                 ),
                 Span::styled(
                     format!(" ({})", board.chip_type),
-                    Style::default().fg(Color::Green),
+                    Style::default().fg(theme.success),
                 ),
                 Span::raw(" - "),
-                Span::styled(&board.device_description, Style::default().fg(Color::Gray)),
+                Span::styled(&board.device_description, Style::default().fg(theme.muted)),
             ]))
         })
         .collect();
@@ -791,12 +2602,12 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
                     app.remote_boards.len()
                 ))
                 .borders(Borders::ALL)
-                .border_style(Style::default().fg(Color::Green)),
+                .border_style(Style::default().fg(theme.success)),
         )
         .highlight_style(
             Style::default()
-                .bg(Color::Green)
-                .fg(Color::Black)
+                .bg(theme.success)
+                .fg(theme.selected_text)
                 .add_modifier(Modifier::BOLD),
         );
 
@@ -823,18 +2634,18 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
         );
 
         let details_paragraph = Paragraph::new(details)
-            .style(Style::default().fg(Color::White))
+            .style(Style::default().fg(theme.text))
             .wrap(Wrap { trim: true });
 
         f.render_widget(details_paragraph, detail_chunks[0]);
 
         // Instructions
         let instructions = Paragraph::new(Line::from(vec![
-            Span::styled("[↑↓]", Style::default().fg(Color::Cyan)),
+            Span::styled("[↑↓]", Style::default().fg(theme.accent)),
             Span::raw(" Navigate "),
-            Span::styled("[Enter]", Style::default().fg(Color::Green)),
+            Span::styled("[Enter]", Style::default().fg(theme.success)),
             Span::raw(" Flash "),
-            Span::styled("[ESC]", Style::default().fg(Color::Red)),
+            Span::styled("[ESC]", Style::default().fg(theme.error)),
             Span::raw(" Cancel"),
         ]));
 
@@ -844,6 +2655,7 @@ fn render_remote_board_dialog(f: &mut Frame, app: &App) {
 
 /// Render the local board selection dialog
 fn render_local_board_dialog(f: &mut Frame, app: &App) {
+    let theme = &app.theme;
     if !app.show_local_board_dialog {
         return;
     }
@@ -867,7 +2679,7 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
             Line::from(Span::styled(
                 board_count_msg,
                 Style::default()
-                    .fg(Color::Green)
+                    .fg(theme.success)
                     .add_modifier(Modifier::BOLD),
             )),
             Line::from(""),
@@ -880,9 +2692,9 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Local Flash - Scanning")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Yellow)),
+                    .border_style(Style::default().fg(theme.warning)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true })
             .alignment(Alignment::Center);
 
@@ -905,9 +2717,9 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Local Flash - Scan Error")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Red)),
+                    .border_style(Style::default().fg(theme.error)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true });
 
         f.render_widget(error_paragraph, area);
@@ -933,9 +2745,9 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
                 Block::default()
                     .title("Local Flash - No Boards")
                     .borders(Borders::ALL)
-                    .border_style(Style::default().fg(Color::Yellow)),
+                    .border_style(Style::default().fg(theme.warning)),
             )
-            .style(Style::default().bg(Color::Black))
+            .style(Style::default().bg(theme.background))
             .wrap(Wrap { trim: true });
 
         f.render_widget(empty_paragraph, area);
@@ -955,19 +2767,17 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
         .map(|board| {
             let port_name = board.port.split('/').next_back().unwrap_or(&board.port);
             ListItem::new(Line::from(vec![
-                Span::styled("🔌 ", Style::default().fg(Color::Blue)),
+                Span::styled("🔌 ", Style::default().fg(theme.info)),
                 Span::styled(
                     port_name.to_string(),
-                    Style::default()
-                        .fg(Color::White)
-                        .add_modifier(Modifier::BOLD),
+                    Style::default().fg(theme.text).add_modifier(Modifier::BOLD),
                 ),
                 Span::styled(
                     format!(" ({})", board.chip_type),
-                    Style::default().fg(Color::Green),
+                    Style::default().fg(theme.success),
                 ),
                 Span::raw(" - "),
-                Span::styled(&board.device_description, Style::default().fg(Color::Gray)),
+                Span::styled(&board.device_description, Style::default().fg(theme.muted)),
             ]))
         })
         .collect();
@@ -982,12 +2792,12 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
                     app.local_boards.len()
                 ))
                 .borders(Borders::ALL)
-                .border_style(Style::default().fg(Color::Blue)),
+                .border_style(Style::default().fg(theme.info)),
         )
         .highlight_style(
             Style::default()
-                .bg(Color::Blue)
-                .fg(Color::Black)
+                .bg(theme.info)
+                .fg(theme.selected_text)
                 .add_modifier(Modifier::BOLD),
         );
 
@@ -1011,18 +2821,18 @@ fn render_local_board_dialog(f: &mut Frame, app: &App) {
         );
 
         let details_paragraph = Paragraph::new(details)
-            .style(Style::default().fg(Color::White))
+            .style(Style::default().fg(theme.text))
             .wrap(Wrap { trim: true });
 
         f.render_widget(details_paragraph, detail_chunks[0]);
 
         // Instructions
         let instructions = Paragraph::new(Line::from(vec![
-            Span::styled("[↑↓]", Style::default().fg(Color::Cyan)),
+            Span::styled("[↑↓]", Style::default().fg(theme.accent)),
             Span::raw(" Navigate "),
-            Span::styled("[Enter]", Style::default().fg(Color::Green)),
+            Span::styled("[Enter]", Style::default().fg(theme.success)),
             Span::raw(" Flash "),
-            Span::styled("[ESC]", Style::default().fg(Color::Red)),
+            Span::styled("[ESC]", Style::default().fg(theme.error)),
             Span::raw(" Cancel"),
         ]));
 
@@ -0,0 +1,414 @@
+//! Hardware description of a board from the `boards:` section of `espbrew.yaml`
+//!
+//! ```yaml
+//! boards:
+//!   box:
+//!     chip: esp32s3
+//!     flash_size: 16MB
+//!     psram: octal
+//!     crystal: 40
+//!     console_uart: 0
+//!     partitions: partitions.box.csv
+//!     upload_speed: 921600
+//!     flash_mode: dio
+//!     flash_freq: 80m
+//!     no_stub: false
+//! ```
+//!
+//! ESP-IDF builds get the matching sdkconfig options and esptool based
+//! flashers get the matching `write_flash` arguments and baud rate, so the
+//! values are not repeated per command.
+
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+
+use crate::config::project_config::{PROJECT_CONFIG_FILE, ProjectConfig};
+use crate::config::sdkconfig_fragments::SdkconfigOption;
+
+/// Kconfig choices set by board metadata and build profiles, by option prefix.
+///
+/// Longer prefixes come first, as the first match wins.
+const CHOICE_PREFIXES: &[&str] = &[
+    "CONFIG_COMPILER_OPTIMIZATION_ASSERTIONS_",
+    "CONFIG_COMPILER_OPTIMIZATION_",
+    "CONFIG_LOG_DEFAULT_LEVEL_",
+    "CONFIG_ESPTOOLPY_FLASHSIZE_",
+    "CONFIG_ESPTOOLPY_FLASHMODE_",
+    "CONFIG_ESPTOOLPY_FLASHFREQ_",
+    "CONFIG_SPIRAM_MODE_",
+    "CONFIG_XTAL_FREQ_",
+    "CONFIG_ESP_CONSOLE_UART_CUSTOM_NUM_",
+];
+
+/// Members of the console output choice
+const CONSOLE_CHOICE: &[&str] = &[
+    "CONFIG_ESP_CONSOLE_UART_DEFAULT",
+    "CONFIG_ESP_CONSOLE_UART_CUSTOM",
+    "CONFIG_ESP_CONSOLE_USB_CDC",
+    "CONFIG_ESP_CONSOLE_USB_SERIAL_JTAG",
+    "CONFIG_ESP_CONSOLE_NONE",
+];
+
+/// Members of the partition table choice
+const PARTITION_TABLE_CHOICE: &[&str] = &[
+    "CONFIG_PARTITION_TABLE_SINGLE_APP",
+    "CONFIG_PARTITION_TABLE_SINGLE_APP_LARGE",
+    "CONFIG_PARTITION_TABLE_TWO_OTA",
+    "CONFIG_PARTITION_TABLE_TWO_OTA_LARGE",
+    "CONFIG_PARTITION_TABLE_CUSTOM",
+];
+
+/// PSRAM fitted to a board
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum PsramMode {
+    None,
+    /// PSRAM enabled with the chip's default mode
+    Enabled,
+    Quad,
+    Octal,
+}
+
+/// Hardware metadata of a board; every field is optional
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct BoardMetadata {
+    /// Chip, e.g. `esp32s3`
+    #[serde(default)]
+    pub chip: Option<String>,
+    /// Flash size, e.g. `16MB`
+    #[serde(default)]
+    pub flash_size: Option<String>,
+    #[serde(default)]
+    pub psram: Option<PsramMode>,
+    /// Minimum chip revision the firmware supports, e.g. `v0.3`
+    #[serde(default)]
+    pub revision: Option<String>,
+    /// Crystal frequency in MHz
+    #[serde(default)]
+    pub crystal: Option<u32>,
+    /// UART used for the console
+    #[serde(default)]
+    pub console_uart: Option<u8>,
+    /// Custom partition table CSV, relative to the project root
+    #[serde(default)]
+    pub partitions: Option<PathBuf>,
+    /// Baud rate for flashing
+    #[serde(default)]
+    pub upload_speed: Option<u32>,
+    /// SPI flash mode: `qio`, `qout`, `dio` or `dout`
+    #[serde(default)]
+    pub flash_mode: Option<String>,
+    /// SPI flash frequency, e.g. `80m`
+    #[serde(default)]
+    pub flash_freq: Option<String>,
+    /// Flash through the ROM loader instead of the flasher stub, for boards
+    /// the stub doesn't run on
+    #[serde(default)]
+    pub no_stub: bool,
+}
+
+impl BoardMetadata {
+    /// Metadata of a board, empty when the project or board declares none
+    pub fn load(project_dir: &Path, board_name: &str) -> Self {
+        ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .and_then(|config| config.board_section(board_name).map(|b| b.metadata.clone()))
+            .unwrap_or_default()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        *self == Self::default()
+    }
+
+    /// Flash size in esptool notation (`16MB`); `16M` and `16mb` are accepted
+    pub fn esptool_flash_size(&self) -> Option<String> {
+        let size = self.flash_size.as_ref()?.trim().to_uppercase();
+        let size = size.strip_suffix('B').unwrap_or(&size);
+        let size = size.strip_suffix('M').unwrap_or(size);
+        Some(format!("{}MB", size))
+    }
+
+    /// Baud rate for flashing, `default` unless the board declares one
+    pub fn upload_baud(&self, default: u32) -> String {
+        self.upload_speed.unwrap_or(default).to_string()
+    }
+
+    /// Flash mode in esptool notation (`dio`)
+    pub fn esptool_flash_mode(&self) -> Option<String> {
+        Some(self.flash_mode.as_ref()?.trim().to_lowercase())
+    }
+
+    /// Flash frequency in esptool notation (`80m`); `80M` and `80MHz` are accepted
+    pub fn esptool_flash_freq(&self) -> Option<String> {
+        let freq = self.flash_freq.as_ref()?.trim().to_lowercase();
+        let freq = freq.strip_suffix("hz").unwrap_or(&freq);
+        Some(format!("{}m", freq.strip_suffix('m').unwrap_or(freq)))
+    }
+
+    /// Arguments for esptool ahead of its command, e.g. `--no-stub`
+    pub fn esptool_args(&self) -> Vec<String> {
+        if self.no_stub {
+            vec!["--no-stub".to_string()]
+        } else {
+            Vec::new()
+        }
+    }
+
+    /// Extra `write_flash` arguments for esptool
+    pub fn esptool_write_flash_args(&self) -> Vec<String> {
+        let mut args = Vec::new();
+        if let Some(mode) = self.esptool_flash_mode() {
+            args.extend(["--flash_mode".to_string(), mode]);
+        }
+        if let Some(freq) = self.esptool_flash_freq() {
+            args.extend(["--flash_freq".to_string(), freq]);
+        }
+        if let Some(size) = self.esptool_flash_size() {
+            args.extend(["--flash_size".to_string(), size]);
+        }
+        args
+    }
+
+    /// sdkconfig options implied by the metadata.
+    ///
+    /// `target` is used for chip specific options when no `chip` is declared.
+    pub fn sdkconfig_options(&self, target: Option<&str>) -> Vec<SdkconfigOption> {
+        let mut lines: Vec<(String, Option<String>)> = Vec::new();
+        let set = |key: &str| (key.to_string(), Some("y".to_string()));
+
+        let chip = self.chip.as_deref().or(target);
+        if let Some(chip) = &self.chip {
+            lines.push((
+                "CONFIG_IDF_TARGET".to_string(),
+                Some(format!("\"{}\"", chip)),
+            ));
+        }
+        if let Some(size) = self.esptool_flash_size() {
+            lines.push(set(&format!("CONFIG_ESPTOOLPY_FLASHSIZE_{}", size)));
+        }
+        if let Some(mode) = self.esptool_flash_mode() {
+            lines.push(set(&format!(
+                "CONFIG_ESPTOOLPY_FLASHMODE_{}",
+                mode.to_uppercase()
+            )));
+        }
+        if let Some(freq) = self.esptool_flash_freq() {
+            lines.push(set(&format!(
+                "CONFIG_ESPTOOLPY_FLASHFREQ_{}",
+                freq.to_uppercase()
+            )));
+        }
+        match self.psram {
+            Some(PsramMode::None) => lines.push(("CONFIG_SPIRAM".to_string(), None)),
+            Some(PsramMode::Enabled) => lines.push(set("CONFIG_SPIRAM")),
+            Some(PsramMode::Quad) => {
+                lines.push(set("CONFIG_SPIRAM"));
+                lines.push(set("CONFIG_SPIRAM_MODE_QUAD"));
+            }
+            Some(PsramMode::Octal) => {
+                lines.push(set("CONFIG_SPIRAM"));
+                lines.push(set("CONFIG_SPIRAM_MODE_OCT"));
+            }
+            None => {}
+        }
+        if let (Some(revision), Some(chip)) = (&self.revision, chip)
+            && let Some(key) = revision_option(chip, revision)
+        {
+            lines.push(set(&key));
+        }
+        if let Some(crystal) = self.crystal {
+            lines.push(set(&format!("CONFIG_XTAL_FREQ_{}", crystal)));
+        }
+        match self.console_uart {
+            Some(0) => lines.push(set("CONFIG_ESP_CONSOLE_UART_DEFAULT")),
+            Some(uart) => {
+                lines.push(set("CONFIG_ESP_CONSOLE_UART_CUSTOM"));
+                lines.push(set(&format!("CONFIG_ESP_CONSOLE_UART_CUSTOM_NUM_{}", uart)));
+            }
+            None => {}
+        }
+        if let Some(partitions) = &self.partitions {
+            lines.push(set("CONFIG_PARTITION_TABLE_CUSTOM"));
+            lines.push((
+                "CONFIG_PARTITION_TABLE_CUSTOM_FILENAME".to_string(),
+                Some(format!("\"{}\"", partitions.display())),
+            ));
+        }
+
+        lines
+            .into_iter()
+            .map(|(key, value)| SdkconfigOption {
+                key,
+                value,
+                source: PathBuf::from(PROJECT_CONFIG_FILE),
+            })
+            .collect()
+    }
+
+    /// sdkconfig options overriding a board's own options.
+    ///
+    /// Choices selected by the metadata (e.g. the flash size) also unset the
+    /// member the board's files selected, so only one stays enabled.
+    pub fn sdkconfig_overrides(
+        &self,
+        target: Option<&str>,
+        base: &[SdkconfigOption],
+    ) -> Vec<SdkconfigOption> {
+        let mut overrides = self.sdkconfig_options(target);
+        let deselected = deselected_choices(&overrides, base);
+        overrides.extend(deselected);
+        overrides
+    }
+}
+
+/// Options of `base` to unset because `overrides` select another member of their choice
+pub fn deselected_choices(
+    overrides: &[SdkconfigOption],
+    base: &[SdkconfigOption],
+) -> Vec<SdkconfigOption> {
+    base.iter()
+        .filter(|option| option.value.as_deref() == Some("y"))
+        .filter(|option| {
+            choice_of(&option.key).is_some_and(|choice| {
+                overrides.iter().any(|o| {
+                    o.key != option.key
+                        && o.value.as_deref() == Some("y")
+                        && choice_of(&o.key) == Some(choice)
+                })
+            })
+        })
+        .map(|option| SdkconfigOption {
+            key: option.key.clone(),
+            value: None,
+            source: PathBuf::from(PROJECT_CONFIG_FILE),
+        })
+        .collect()
+}
+
+/// Choice an option belongs to, if any
+fn choice_of(key: &str) -> Option<&str> {
+    if CONSOLE_CHOICE.contains(&key) {
+        return Some("CONFIG_ESP_CONSOLE_");
+    }
+    if PARTITION_TABLE_CHOICE.contains(&key) {
+        return Some("CONFIG_PARTITION_TABLE_");
+    }
+    if key.contains("_REV_MIN_") && !key.ends_with("_FULL") {
+        return key.split_once("_REV_MIN_").map(|(chip, _)| chip);
+    }
+    CHOICE_PREFIXES
+        .iter()
+        .find(|prefix| key.starts_with(*prefix))
+        .copied()
+}
+
+/// Minimum revision choice of a chip, e.g. `CONFIG_ESP32C3_REV_MIN_3` for v0.3.
+///
+/// The original ESP32 names its choices after the major revision
+/// (`CONFIG_ESP32_REV_MIN_3`, `CONFIG_ESP32_REV_MIN_3_1`), newer chips use
+/// `major * 100 + minor`.
+fn revision_option(chip: &str, revision: &str) -> Option<String> {
+    let revision = revision.trim().trim_start_matches(['v', 'V']);
+    let (major, minor) = revision.split_once('.').unwrap_or((revision, "0"));
+    let major: u32 = major.parse().ok()?;
+    let minor: u32 = minor.parse().ok()?;
+
+    let prefix = format!("CONFIG_{}_REV_MIN", chip.to_uppercase());
+    if chip.eq_ignore_ascii_case("esp32") {
+        Some(match minor {
+            0 => format!("{}_{}", prefix, major),
+            minor => format!("{}_{}_{}", prefix, major, minor),
+        })
+    } else {
+        Some(format!("{}_{}", prefix, major * 100 + minor))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::sdkconfig_fragments::read_options;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_board_metadata() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "CONFIG_ESPTOOLPY_FLASHSIZE_4MB=y\nCONFIG_FREERTOS_HZ=1000\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  box:\n    chip: esp32s3\n    flash_size: 16M\n    psram: octal\n    revision: v0.2\n    crystal: 40\n    console_uart: 1\n    tags: [psram]\n",
+        )
+        .unwrap();
+
+        let metadata = BoardMetadata::load(project, "box");
+        assert_eq!(metadata.psram, Some(PsramMode::Octal));
+        assert_eq!(metadata.esptool_flash_size().as_deref(), Some("16MB"));
+        assert_eq!(
+            metadata.esptool_write_flash_args(),
+            vec!["--flash_size", "16MB"]
+        );
+        assert!(BoardMetadata::load(project, "other").is_empty());
+
+        let base = read_options(&project.join("sdkconfig.defaults.box")).unwrap();
+        let lines: Vec<String> = metadata
+            .sdkconfig_overrides(None, &base)
+            .iter()
+            .map(|o| o.to_line())
+            .collect();
+        assert_eq!(
+            lines,
+            vec![
+                "CONFIG_IDF_TARGET=\"esp32s3\"",
+                "CONFIG_ESPTOOLPY_FLASHSIZE_16MB=y",
+                "CONFIG_SPIRAM=y",
+                "CONFIG_SPIRAM_MODE_OCT=y",
+                "CONFIG_ESP32S3_REV_MIN_2=y",
+                "CONFIG_XTAL_FREQ_40=y",
+                "CONFIG_ESP_CONSOLE_UART_CUSTOM=y",
+                "CONFIG_ESP_CONSOLE_UART_CUSTOM_NUM_1=y",
+                "# CONFIG_ESPTOOLPY_FLASHSIZE_4MB is not set",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_flash_options() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+boards:
+  c3_mini:
+    chip: esp32c3
+    flash_backend: esptool
+    upload_speed: 921600
+    flash_mode: DIO
+    flash_freq: 80MHz
+    no_stub: true
+"#,
+        )
+        .unwrap();
+
+        let metadata = BoardMetadata::load(project, "c3_mini");
+        assert_eq!(
+            metadata.esptool_write_flash_args(),
+            ["--flash_mode", "dio", "--flash_freq", "80m"]
+        );
+        assert_eq!(metadata.esptool_args(), ["--no-stub"]);
+        let options: Vec<String> = metadata
+            .sdkconfig_options(None)
+            .iter()
+            .map(|o| o.to_line())
+            .collect();
+        assert!(options.contains(&"CONFIG_ESPTOOLPY_FLASHMODE_DIO=y".to_string()));
+        assert!(options.contains(&"CONFIG_ESPTOOLPY_FLASHFREQ_80M=y".to_string()));
+    }
+}
@@ -0,0 +1,263 @@
+//! Build profiles crossed with board configs
+//!
+//! Every ESP-IDF board is built once per profile declared in `espbrew.yaml`,
+//! as `<board>-<profile>` with its own build directory:
+//!
+//! ```yaml
+//! profiles:
+//!   debug:
+//!     optimization: debug
+//!     log_level: debug
+//!     assertions: enabled
+//!   release:
+//!     optimization: size
+//!     log_level: warn
+//!     assertions: silent
+//! ```
+
+use serde::{Deserialize, Serialize};
+use std::path::PathBuf;
+
+use crate::config::project_config::{PROJECT_CONFIG_FILE, ProjectConfig};
+use crate::config::sdkconfig_fragments::SdkconfigOption;
+use crate::models::ProjectBoardConfig;
+
+/// Compiler optimization level
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Optimization {
+    Debug,
+    Size,
+    Perf,
+    None,
+}
+
+/// Default log verbosity
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LogLevel {
+    None,
+    Error,
+    Warn,
+    Info,
+    Debug,
+    Verbose,
+}
+
+/// Behavior of `assert()`
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Assertions {
+    Enabled,
+    Silent,
+    Disabled,
+}
+
+/// A build profile; unset fields keep the board's own options
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct BuildProfile {
+    #[serde(default)]
+    pub optimization: Option<Optimization>,
+    #[serde(default)]
+    pub log_level: Option<LogLevel>,
+    #[serde(default)]
+    pub assertions: Option<Assertions>,
+}
+
+impl BuildProfile {
+    /// sdkconfig options selecting the profile's settings
+    pub fn sdkconfig_options(&self) -> Vec<SdkconfigOption> {
+        let mut keys = Vec::new();
+
+        if let Some(optimization) = self.optimization {
+            keys.push(match optimization {
+                Optimization::Debug => "CONFIG_COMPILER_OPTIMIZATION_DEBUG",
+                Optimization::Size => "CONFIG_COMPILER_OPTIMIZATION_SIZE",
+                Optimization::Perf => "CONFIG_COMPILER_OPTIMIZATION_PERF",
+                Optimization::None => "CONFIG_COMPILER_OPTIMIZATION_NONE",
+            });
+        }
+        if let Some(log_level) = self.log_level {
+            keys.push(match log_level {
+                LogLevel::None => "CONFIG_LOG_DEFAULT_LEVEL_NONE",
+                LogLevel::Error => "CONFIG_LOG_DEFAULT_LEVEL_ERROR",
+                LogLevel::Warn => "CONFIG_LOG_DEFAULT_LEVEL_WARN",
+                LogLevel::Info => "CONFIG_LOG_DEFAULT_LEVEL_INFO",
+                LogLevel::Debug => "CONFIG_LOG_DEFAULT_LEVEL_DEBUG",
+                LogLevel::Verbose => "CONFIG_LOG_DEFAULT_LEVEL_VERBOSE",
+            });
+        }
+        if let Some(assertions) = self.assertions {
+            keys.push(match assertions {
+                Assertions::Enabled => "CONFIG_COMPILER_OPTIMIZATION_ASSERTIONS_ENABLE",
+                Assertions::Silent => "CONFIG_COMPILER_OPTIMIZATION_ASSERTIONS_SILENT",
+                Assertions::Disabled => "CONFIG_COMPILER_OPTIMIZATION_ASSERTIONS_DISABLE",
+            });
+        }
+
+        keys.into_iter()
+            .map(|key| SdkconfigOption {
+                key: key.to_string(),
+                value: Some("y".to_string()),
+                source: PathBuf::from(PROJECT_CONFIG_FILE),
+            })
+            .collect()
+    }
+}
+
+/// Name of the board built with a profile
+pub fn cell_name(board_name: &str, profile: &str) -> String {
+    format!("{}-{}", board_name, profile)
+}
+
+/// Board name and profile of a `<board>-<profile>` cell; the longest matching
+/// profile name wins
+pub fn split_cell<'a>(
+    config: &'a ProjectConfig,
+    cell: &str,
+) -> Option<(String, &'a str, &'a BuildProfile)> {
+    config
+        .profiles
+        .iter()
+        .filter_map(|(name, profile)| {
+            cell.strip_suffix(name.as_str())
+                .and_then(|rest| rest.strip_suffix('-'))
+                .filter(|board| !board.is_empty())
+                .map(|board| (board.to_string(), name.as_str(), profile))
+        })
+        .max_by_key(|(_, name, _)| name.len())
+}
+
+/// Cross boards with the project's profiles; without profiles the boards are returned as they are
+pub fn expand_profiles(
+    config: Option<&ProjectConfig>,
+    boards: Vec<ProjectBoardConfig>,
+) -> Vec<ProjectBoardConfig> {
+    let Some(config) = config.filter(|c| !c.profiles.is_empty()) else {
+        return boards;
+    };
+
+    boards
+        .into_iter()
+        .flat_map(|board| {
+            config
+                .profiles
+                .keys()
+                .map(move |profile| ProjectBoardConfig {
+                    name: cell_name(&board.name, profile),
+                    config_file: board.config_file.clone(),
+                    build_dir: PathBuf::from(format!("{}-{}", board.build_dir.display(), profile)),
+                    target: board.target.clone(),
+                    project_type: board.project_type.clone(),
+                })
+        })
+        .collect()
+}
+
+/// Boards × profiles grid of board names, for building rows, columns or cells
+#[derive(Debug, Clone, PartialEq)]
+pub struct ProfileMatrix {
+    pub boards: Vec<String>,
+    pub profiles: Vec<String>,
+    /// `cells[row][column]`, `None` where the cell isn't among the boards
+    pub cells: Vec<Vec<Option<String>>>,
+}
+
+impl ProfileMatrix {
+    /// Arrange profile cells by board and profile; `None` if no board is a profile cell
+    pub fn from_board_names(config: &ProjectConfig, names: &[String]) -> Option<Self> {
+        let split: Vec<(String, &str)> = names
+            .iter()
+            .filter_map(|name| split_cell(config, name).map(|(board, profile, _)| (board, profile)))
+            .collect();
+        if split.is_empty() {
+            return None;
+        }
+
+        let mut boards: Vec<String> = Vec::new();
+        for (board, _) in &split {
+            if !boards.contains(board) {
+                boards.push(board.clone());
+            }
+        }
+        let profiles: Vec<String> = config.profiles.keys().cloned().collect();
+
+        let cells = boards
+            .iter()
+            .map(|board| {
+                profiles
+                    .iter()
+                    .map(|profile| {
+                        let cell = cell_name(board, profile);
+                        names.contains(&cell).then_some(cell)
+                    })
+                    .collect()
+            })
+            .collect();
+
+        Some(Self {
+            boards,
+            profiles,
+            cells,
+        })
+    }
+
+    pub fn cell(&self, row: usize, column: usize) -> Option<&str> {
+        self.cells.get(row)?.get(column)?.as_deref()
+    }
+
+    /// Cells of a board across all profiles
+    pub fn row(&self, row: usize) -> Vec<&str> {
+        self.cells
+            .get(row)
+            .map(|cells| cells.iter().flatten().map(|c| c.as_str()).collect())
+            .unwrap_or_default()
+    }
+
+    /// Cells of a profile across all boards
+    pub fn column(&self, column: usize) -> Vec<&str> {
+        self.cells
+            .iter()
+            .filter_map(|cells| cells.get(column)?.as_deref())
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_profile_matrix() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "profiles:\n  debug:\n    optimization: debug\n  release:\n    optimization: size\n",
+        )
+        .unwrap();
+
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        let (board, profile, _) = split_cell(&config, "esp32s3-release").unwrap();
+        assert_eq!((board.as_str(), profile), ("esp32s3", "release"));
+        assert!(split_cell(&config, "esp32s3").is_none());
+
+        let names: Vec<String> = [
+            "esp32c3-debug",
+            "esp32c3-release",
+            "esp32s3-debug",
+            "esp32s3-release",
+        ]
+        .iter()
+        .map(|name| name.to_string())
+        .collect();
+        let matrix = ProfileMatrix::from_board_names(&config, &names).unwrap();
+        assert_eq!(matrix.boards, vec!["esp32c3", "esp32s3"]);
+        assert_eq!(matrix.profiles, vec!["debug", "release"]);
+        assert_eq!(matrix.cell(1, 0), Some("esp32s3-debug"));
+        assert_eq!(matrix.row(0), vec!["esp32c3-debug", "esp32c3-release"]);
+        assert_eq!(matrix.column(1), vec!["esp32c3-release", "esp32s3-release"]);
+    }
+}
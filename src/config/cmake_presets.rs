@@ -0,0 +1,219 @@
+//! CMake presets (`CMakePresets.json`) used as ESP-IDF board configurations
+
+use anyhow::{Context, Result};
+use serde::Deserialize;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+/// Project presets file, usually committed with the sources
+pub const CMAKE_PRESETS_FILE: &str = "CMakePresets.json";
+/// Per-user presets file, layered on top of the project presets
+pub const CMAKE_USER_PRESETS_FILE: &str = "CMakeUserPresets.json";
+
+#[derive(Debug, Deserialize)]
+struct PresetsFile {
+    #[serde(default, rename = "configurePresets")]
+    configure_presets: Vec<RawConfigurePreset>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+struct RawConfigurePreset {
+    name: String,
+    #[serde(default)]
+    hidden: bool,
+    #[serde(default)]
+    inherits: Inherits,
+    #[serde(default, rename = "displayName")]
+    display_name: Option<String>,
+    #[serde(default, rename = "binaryDir")]
+    binary_dir: Option<String>,
+    #[serde(default, rename = "cacheVariables")]
+    cache_variables: HashMap<String, CacheVariable>,
+}
+
+/// `inherits` is either a single preset name or a list of names
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(untagged)]
+enum Inherits {
+    #[default]
+    None,
+    One(String),
+    Many(Vec<String>),
+}
+
+impl Inherits {
+    fn names(&self) -> Vec<String> {
+        match self {
+            Inherits::None => Vec::new(),
+            Inherits::One(name) => vec![name.clone()],
+            Inherits::Many(names) => names.clone(),
+        }
+    }
+}
+
+/// Cache variables are plain strings or `{ "type": ..., "value": ... }` objects
+#[derive(Debug, Clone, Deserialize)]
+#[serde(untagged)]
+enum CacheVariable {
+    Value(String),
+    Typed { value: String },
+    Bool(bool),
+}
+
+impl CacheVariable {
+    fn as_string(&self) -> String {
+        match self {
+            CacheVariable::Value(value) | CacheVariable::Typed { value } => value.clone(),
+            CacheVariable::Bool(value) => if *value { "ON" } else { "OFF" }.to_string(),
+        }
+    }
+}
+
+/// A visible configure preset with inheritance and macros resolved
+#[derive(Debug, Clone)]
+pub struct CmakePreset {
+    pub name: String,
+    pub display_name: Option<String>,
+    /// Absolute build directory
+    pub binary_dir: PathBuf,
+    pub cache_variables: HashMap<String, String>,
+    /// Presets file the preset was defined in
+    pub source_file: PathBuf,
+}
+
+impl CmakePreset {
+    /// Chip the preset builds for (`IDF_TARGET` cache variable)
+    pub fn idf_target(&self) -> Option<&str> {
+        self.cache_variables.get("IDF_TARGET").map(|s| s.as_str())
+    }
+
+    /// Files listed in the `SDKCONFIG_DEFAULTS` cache variable, resolved against the project
+    pub fn sdkconfig_defaults(&self, project_dir: &Path) -> Vec<PathBuf> {
+        self.cache_variables
+            .get("SDKCONFIG_DEFAULTS")
+            .map(|value| {
+                value
+                    .split(';')
+                    .filter(|s| !s.is_empty())
+                    .map(|s| project_dir.join(s))
+                    .collect()
+            })
+            .unwrap_or_default()
+    }
+}
+
+/// Check whether a board's config file is a CMake presets file
+pub fn is_cmake_presets_file(path: &Path) -> bool {
+    path.file_name()
+        .and_then(|n| n.to_str())
+        .map(|n| n == CMAKE_PRESETS_FILE || n == CMAKE_USER_PRESETS_FILE)
+        .unwrap_or(false)
+}
+
+/// Load all visible configure presets of a project.
+///
+/// Presets from `CMakeUserPresets.json` may inherit from and override presets
+/// of `CMakePresets.json`. Hidden presets are only used as inheritance bases.
+pub fn load_cmake_presets(project_dir: &Path) -> Result<Vec<CmakePreset>> {
+    let mut raw: Vec<(RawConfigurePreset, PathBuf)> = Vec::new();
+
+    for file_name in [CMAKE_PRESETS_FILE, CMAKE_USER_PRESETS_FILE] {
+        let path = project_dir.join(file_name);
+        if !path.exists() {
+            continue;
+        }
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        let file: PresetsFile = serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", path.display()))?;
+        for preset in file.configure_presets {
+            raw.retain(|(existing, _)| existing.name != preset.name);
+            raw.push((preset, path.clone()));
+        }
+    }
+
+    let by_name: HashMap<&str, &RawConfigurePreset> =
+        raw.iter().map(|(p, _)| (p.name.as_str(), p)).collect();
+
+    let mut presets = Vec::new();
+    for (preset, source_file) in raw.iter().filter(|(p, _)| !p.hidden) {
+        let mut binary_dir = None;
+        let mut cache_variables = HashMap::new();
+        resolve(preset, &by_name, &mut binary_dir, &mut cache_variables, 0)?;
+
+        let binary_dir = binary_dir
+            .map(|dir| expand_macros(&dir, project_dir, &preset.name))
+            .map(|dir| project_dir.join(dir))
+            .unwrap_or_else(|| project_dir.join("build"));
+
+        presets.push(CmakePreset {
+            name: preset.name.clone(),
+            display_name: preset.display_name.clone(),
+            binary_dir,
+            cache_variables: cache_variables
+                .into_iter()
+                .map(|(k, v)| (k, expand_macros(&v, project_dir, &preset.name)))
+                .collect(),
+            source_file: source_file.clone(),
+        });
+    }
+
+    Ok(presets)
+}
+
+/// Apply inherited values first so the preset's own values win
+fn resolve(
+    preset: &RawConfigurePreset,
+    by_name: &HashMap<&str, &RawConfigurePreset>,
+    binary_dir: &mut Option<String>,
+    cache_variables: &mut HashMap<String, String>,
+    depth: usize,
+) -> Result<()> {
+    if depth > 16 {
+        return Err(anyhow::anyhow!(
+            "Preset inheritance too deep at '{}'",
+            preset.name
+        ));
+    }
+
+    // The first listed parent takes precedence, so apply parents in reverse
+    for parent_name in preset.inherits.names().iter().rev() {
+        let parent = by_name.get(parent_name.as_str()).ok_or_else(|| {
+            anyhow::anyhow!(
+                "Preset '{}' inherits unknown preset '{}'",
+                preset.name,
+                parent_name
+            )
+        })?;
+        resolve(parent, by_name, binary_dir, cache_variables, depth + 1)?;
+    }
+
+    if let Some(dir) = &preset.binary_dir {
+        *binary_dir = Some(dir.clone());
+    }
+    for (key, value) in &preset.cache_variables {
+        cache_variables.insert(key.clone(), value.as_string());
+    }
+
+    Ok(())
+}
+
+/// Expand the CMake preset macros espbrew needs to locate build directories
+fn expand_macros(value: &str, project_dir: &Path, preset_name: &str) -> String {
+    let source_dir = project_dir.to_string_lossy();
+    let source_parent = project_dir
+        .parent()
+        .map(|p| p.to_string_lossy().to_string())
+        .unwrap_or_default();
+    let source_dir_name = project_dir
+        .file_name()
+        .map(|n| n.to_string_lossy().to_string())
+        .unwrap_or_default();
+
+    value
+        .replace("${sourceDir}", &source_dir)
+        .replace("${sourceParentDir}", &source_parent)
+        .replace("${sourceDirName}", &source_dir_name)
+        .replace("${presetName}", preset_name)
+        .replace("${dollar}", "$")
+}
@@ -1,7 +1,19 @@
 //! Configuration management for ESPBrew
 
 pub mod app_config;
+pub mod board_metadata;
 pub mod board_types;
+pub mod build_profiles;
+pub mod cmake_presets;
+pub mod project_config;
+pub mod sdkconfig_diff;
+pub mod sdkconfig_fragments;
+pub mod sdkconfig_lint;
+pub mod toolchain;
 
 pub use app_config::*;
+pub use board_metadata::*;
 pub use board_types::*;
+pub use cmake_presets::*;
+pub use project_config::*;
+pub use toolchain::*;
@@ -0,0 +1,748 @@
+//! Per-project configuration loaded from `espbrew.yaml`
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use crate::config::board_metadata::BoardMetadata;
+use crate::config::build_profiles::{BuildProfile, split_cell};
+use crate::config::toolchain::ToolchainPins;
+use crate::models::ProjectType;
+
+/// File name of the project configuration, looked up in the project root
+pub const PROJECT_CONFIG_FILE: &str = "espbrew.yaml";
+
+/// Project configuration stored next to the sources
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ProjectConfig {
+    /// ESP-IDF build settings
+    #[serde(default)]
+    pub esp_idf: Option<EspIdfSection>,
+    /// Arduino CLI settings
+    #[serde(default)]
+    pub arduino: Option<ArduinoSection>,
+    /// MicroPython deployment settings
+    #[serde(default)]
+    pub micropython: Option<MicroPythonSection>,
+    /// TinyGo target selection
+    #[serde(default)]
+    pub tinygo: Option<TinyGoSection>,
+    /// Per-board settings, keyed by board configuration name
+    #[serde(default)]
+    pub boards: BTreeMap<String, BoardSection>,
+    /// Build profiles crossed with every board, keyed by profile name
+    #[serde(default)]
+    pub profiles: BTreeMap<String, BuildProfile>,
+    /// Toolchain versions every build must use
+    #[serde(default)]
+    pub toolchain: ToolchainPins,
+    /// Limits of parallel board builds
+    #[serde(default)]
+    pub build: BuildSection,
+    /// Retries of transiently failing fetch, build and flash steps
+    #[serde(default)]
+    pub retry: RetrySection,
+    /// Command templates replacing the handler's commands, keyed by project type, e.g. `esp_idf`
+    #[serde(default)]
+    pub commands: BTreeMap<String, CommandTemplates>,
+    /// Scheduled builds of `espbrew daemon`
+    #[serde(default)]
+    pub daemon: DaemonSection,
+    /// Devices `espbrew ota deploy` updates over the air
+    #[serde(default)]
+    pub ota: OtaSection,
+    /// Secure Boot v2 signing of the bootloader and app after every ESP-IDF build
+    #[serde(default)]
+    pub signing: Option<SigningSection>,
+    /// Flash encryption: eFuse checks before flashing, and the key release-mode images are pre-encrypted with
+    #[serde(default)]
+    pub flash_encryption: Option<FlashEncryptionSection>,
+    /// Filters and highlight rules the TUI's serial monitor panes start with
+    #[serde(default)]
+    pub monitor: MonitorSection,
+    /// Desktop notifications of finished builds and flashes
+    #[serde(default)]
+    pub notifications: NotificationsSection,
+}
+
+/// Events the desktop is told about, none by default
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct NotificationsSection {
+    /// `builds_finished`, `first_failure` and/or `flashes_finished`
+    #[serde(default)]
+    pub events: Vec<String>,
+    /// Seconds the boards were busy below which the finished events are skipped
+    #[serde(default)]
+    pub min_duration_s: Option<u64>,
+    /// Notify while the TUI's terminal has focus as well
+    #[serde(default)]
+    pub when_focused: bool,
+}
+
+/// Initial filters of the serial monitor panes, changed live in the TUI, and
+/// recording of the monitor sessions
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct MonitorSection {
+    /// Least severe ESP-IDF log level shown, `warning` or `error`; all by default
+    #[serde(default)]
+    pub level: Option<String>,
+    /// ESP-IDF log tags shown; all by default
+    #[serde(default)]
+    pub tags: Vec<String>,
+    /// Regexes whose matching lines are colored, e.g. `heap|wifi`
+    #[serde(default)]
+    pub highlights: Vec<String>,
+    /// Regexes whose capture groups are plotted besides `>>name:value`,
+    /// e.g. `T=(?P<temp>[-\d.]+)`
+    #[serde(default)]
+    pub plot: Vec<String>,
+    /// Record every session to `logs/<board>/<device>/<timestamp>.log`
+    #[serde(default)]
+    pub record: bool,
+    /// Size in MB after which a recording continues in a new file; 10 by default
+    #[serde(default)]
+    pub rotate_mb: Option<u64>,
+    /// Recordings kept per device, the oldest removed first; 20 by default
+    #[serde(default)]
+    pub keep: Option<usize>,
+    /// Line ending of the lines sent to the console, `crlf`, `lf`, `cr` or
+    /// `none`; `crlf` by default
+    #[serde(default)]
+    pub line_ending: Option<String>,
+    /// Actions taken on the lines matching a regex
+    #[serde(default)]
+    pub triggers: Vec<TriggerSection>,
+    /// When a device counts as crash-looping, and who is told
+    #[serde(default)]
+    pub crash_loop: CrashLoopSection,
+    /// Console interactions run against a device, e.g. bring-up checks
+    #[serde(default)]
+    pub scripts: Vec<ScriptSection>,
+}
+
+/// Steps a console script takes against a monitored device, in order
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ScriptSection {
+    pub name: String,
+    /// Seconds an `expect` waits for its output; 10 by default
+    #[serde(default)]
+    pub timeout_s: Option<u64>,
+    #[serde(default)]
+    pub steps: Vec<ScriptStepSection>,
+}
+
+/// One step of a console script: waiting for output matching the `expect`
+/// regex, sending a line or sleeping
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ScriptStepSection {
+    #[serde(default)]
+    pub expect: Option<String>,
+    /// Line sent with the console's line ending, `${NAME}` taken from the
+    /// environment
+    #[serde(default)]
+    pub send: Option<String>,
+    #[serde(default)]
+    pub sleep_ms: Option<u64>,
+    /// Seconds this `expect` waits, instead of the script's
+    #[serde(default)]
+    pub timeout_s: Option<u64>,
+}
+
+/// Crash loop detection of the monitored devices
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct CrashLoopSection {
+    /// Resets in a minute above which a device is crash-looping; 3 by default
+    #[serde(default)]
+    pub resets_per_minute: Option<usize>,
+    /// Show a desktop notification when a device starts crash-looping
+    #[serde(default)]
+    pub desktop: bool,
+    /// Shell command run with the device in `ESPBREW_CRASH_*` variables
+    #[serde(default)]
+    pub command: Option<String>,
+    /// URL the alert is posted to as JSON, with a Slack compatible `text`
+    #[serde(default)]
+    pub webhook: Option<String>,
+}
+
+/// What a serial monitor pane does when its device prints a line matching
+/// `match`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TriggerSection {
+    /// Name in the pane and the session summary; the regex by default
+    #[serde(default)]
+    pub name: Option<String>,
+    #[serde(rename = "match")]
+    pub pattern: String,
+    /// `save_log` and `flash`, in the order taken
+    #[serde(default)]
+    pub actions: Vec<String>,
+    /// Shell command run from the project after the actions
+    #[serde(default)]
+    pub run: Option<String>,
+    /// Seconds before the trigger fires again; 30 by default
+    #[serde(default)]
+    pub cooldown_s: Option<u64>,
+}
+
+/// Flash encryption settings of the project's devices
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct FlashEncryptionSection {
+    /// Host-generated key burned into the devices' eFuses, relative to the
+    /// project; release-mode images are pre-encrypted with it
+    #[serde(default)]
+    pub key: Option<String>,
+}
+
+/// Key the images are signed with, exactly one of `key` and `signer`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct SigningSection {
+    /// RSA-3072 or ECDSA private key, relative to the project, signed with via `espsecure.py`
+    #[serde(default)]
+    pub key: Option<String>,
+    /// Shell command writing the signed image of `{input}` to `{output}`, for keys held in an HSM
+    #[serde(default)]
+    pub signer: Option<String>,
+    /// Profiles whose builds must be signed before they are flashed, deployed
+    /// or exported; `release` by default
+    #[serde(default)]
+    pub release_profiles: Vec<String>,
+}
+
+/// Devices updated over the air, and how the images are served to them
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct OtaSection {
+    /// Address the images are served on for devices that download them,
+    /// `0.0.0.0:8070` by default
+    #[serde(default)]
+    pub serve: Option<String>,
+    /// Base URL devices download the images from, e.g. `http://192.168.1.10:8070`;
+    /// by default the served address, with this machine's LAN address for `0.0.0.0`
+    #[serde(default)]
+    pub public_url: Option<String>,
+    /// Seconds a device may take to receive its image, 300 by default
+    #[serde(default)]
+    pub timeout_secs: Option<u64>,
+    #[serde(default)]
+    pub devices: Vec<OtaDevice>,
+}
+
+/// A device updated over the air, with exactly one of `upload`, `trigger`
+/// and `trigger_command`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct OtaDevice {
+    pub name: String,
+    /// Board configuration whose app binary the device runs
+    pub board: String,
+    /// Endpoint the app binary is POSTed to, e.g. `https://192.168.1.40/ota`
+    #[serde(default)]
+    pub upload: Option<String>,
+    /// URL requested to make the device download the image from the URL in `{url}`,
+    /// e.g. `http://192.168.1.41/update?url={url}`
+    #[serde(default)]
+    pub trigger: Option<String>,
+    /// Shell command making the device download the image, with its URL in
+    /// `{url}`, e.g. `mosquitto_pub -t devices/hall/ota -m {url}`
+    #[serde(default)]
+    pub trigger_command: Option<String>,
+    /// Accept the device's self-signed certificate
+    #[serde(default)]
+    pub insecure: bool,
+}
+
+/// When `espbrew daemon` pulls and builds, and whom it tells about the result
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct DaemonSection {
+    /// Branch pulled before every run, defaults to the checked out branch
+    #[serde(default)]
+    pub branch: Option<String>,
+    /// Remote pulled from, defaults to `origin`
+    #[serde(default)]
+    pub remote: Option<String>,
+    /// Daily run at this local time, e.g. `02:00`
+    #[serde(default)]
+    pub at: Option<String>,
+    /// Minutes between runs, instead of a daily run
+    #[serde(default)]
+    pub interval_minutes: Option<u64>,
+    /// Rebuild every board, not only those whose inputs changed
+    #[serde(default)]
+    pub force: bool,
+    /// Address a webhook triggering a run is served on, e.g. `0.0.0.0:8087`
+    #[serde(default)]
+    pub listen: Option<String>,
+    /// Token a webhook call must pass as `?token=` or `X-Espbrew-Token` header
+    #[serde(default)]
+    pub token: Option<String>,
+    #[serde(default)]
+    pub notify: NotifySection,
+}
+
+/// Notifications after a daemon run
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct NotifySection {
+    /// Shell command run with the result in `ESPBREW_DAEMON_*` variables
+    #[serde(default)]
+    pub command: Option<String>,
+    /// URL the result is posted to as JSON, with a Slack compatible `text`
+    #[serde(default)]
+    pub webhook: Option<String>,
+    /// Only notify about runs with failed boards
+    #[serde(default)]
+    pub only_failures: bool,
+}
+
+/// Build, flash and monitor commands run in the shell instead of the handler's
+/// own, with placeholders like `{board}`, `{build_dir}` and `{port}`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct CommandTemplates {
+    #[serde(default)]
+    pub build: Option<String>,
+    #[serde(default)]
+    pub flash: Option<String>,
+    #[serde(default)]
+    pub monitor: Option<String>,
+}
+
+/// Parallel build limits and agents; `--jobs`, `--max-load` and `--agent` take precedence
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct BuildSection {
+    /// Build slots shared by all running builds, weighted per board
+    #[serde(default)]
+    pub jobs: Option<usize>,
+    /// Load average above which no further build starts
+    #[serde(default)]
+    pub max_load: Option<f64>,
+    /// Remote build agents, `user@host` for SSH or `http://host:9090` for `espbrew agent`
+    #[serde(default)]
+    pub agents: Vec<String>,
+    /// Root of out-of-tree build directories, e.g. `/fastdisk/espbrew-builds`;
+    /// `{project}` and `{board}` place the boards, `<out_dir>/{project}/{board}` by default
+    #[serde(default)]
+    pub out_dir: Option<String>,
+    /// Write `merged-<board>.bin`, flashed at offset 0, after every successful ESP-IDF build
+    #[serde(default)]
+    pub merged_binary: bool,
+}
+
+/// Retry policies per step; unset steps use the step's default policy
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct RetrySection {
+    /// Component dependency resolution, e.g. registry downloads
+    #[serde(default)]
+    pub fetch: Option<RetryPolicy>,
+    #[serde(default)]
+    pub build: Option<RetryPolicy>,
+    #[serde(default)]
+    pub flash: Option<RetryPolicy>,
+}
+
+/// How often a failed step is tried again and how long to wait in between
+#[derive(Debug, Clone, Copy, PartialEq, Serialize, Deserialize)]
+pub struct RetryPolicy {
+    /// Attempts after the first one
+    #[serde(default)]
+    pub retries: u32,
+    /// Wait before the first retry, doubled for every further retry
+    #[serde(default = "default_backoff_ms")]
+    pub backoff_ms: u64,
+}
+
+fn default_backoff_ms() -> u64 {
+    1000
+}
+
+/// Settings of a single board configuration
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct BoardSection {
+    /// Commands run around the board build
+    #[serde(default)]
+    pub hooks: BoardHooks,
+    /// Tags for selecting groups of boards, e.g. `psram` or `customer-x`
+    #[serde(default)]
+    pub tags: Vec<String>,
+    /// Toolchain versions overriding the project pins for this board
+    #[serde(default)]
+    pub toolchain: ToolchainPins,
+    /// Build slots the board takes while building, defaults to its project type's weight
+    #[serde(default)]
+    pub weight: Option<u32>,
+    /// Start priority among waiting builds, higher first; 0 by default
+    #[serde(default)]
+    pub priority: Option<i32>,
+    /// Port the board is flashed and monitored on without `--port`, e.g.
+    /// `/dev/ttyUSB0` or `rfc2217://rack-host:4001` for a device behind ser2net
+    #[serde(default)]
+    pub port: Option<String>,
+    /// Serial ports or MAC addresses of the devices `flash --all-devices`
+    /// flashes with this board, whatever hardware they report
+    #[serde(default)]
+    pub devices: Vec<String>,
+    /// Tool the board is flashed with, the built-in espflash flasher by default
+    #[serde(default)]
+    pub flash_backend: FlashBackendKind,
+    /// OpenOCD board configuration, e.g. `board/esp32s3-builtin.cfg`; chips
+    /// with a built-in USB-JTAG default to theirs
+    #[serde(default)]
+    pub openocd_config: Option<String>,
+    /// Check the flash against the images after writing them
+    #[serde(default)]
+    pub verify: bool,
+    /// NVS image generated from a CSV at flash time and written with the images
+    #[serde(default)]
+    pub nvs: Option<NvsImage>,
+    /// Filesystem image packed from a data directory and written with the images
+    #[serde(default)]
+    pub filesystem: Option<FilesystemImage>,
+    /// Write `<board>.uf2` of the app after every successful build, for TinyUF2 bootloaders
+    #[serde(default)]
+    pub uf2: bool,
+    /// Container image the board is built in, e.g. `espressif/idf:v5.3`
+    #[serde(default)]
+    pub container: Option<BoardContainer>,
+    /// Command templates overriding the project type's templates for this board
+    #[serde(default)]
+    pub commands: CommandTemplates,
+    /// Memory budget; a build that exceeds it fails
+    #[serde(default)]
+    pub limits: Option<MemoryLimits>,
+    /// Chip, flash size, PSRAM and other hardware details
+    #[serde(flatten)]
+    pub metadata: BoardMetadata,
+}
+
+/// Tool a board's images are written with
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum FlashBackendKind {
+    /// The built-in espflash flasher, over the serial port
+    #[default]
+    Espflash,
+    /// `esptool.py write_flash`, over the serial port
+    Esptool,
+    /// OpenOCD `program_esp`, over JTAG
+    Openocd,
+    /// `dfu-util` with the DFU image of `idf.py dfu`, over the USB-OTG of the S2 and S3
+    Dfu,
+}
+
+/// Filesystem image of a board's data directory
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct FilesystemImage {
+    /// Directory packed, relative to the project; `data.<board>/` or `data/` by default
+    #[serde(default)]
+    pub dir: Option<String>,
+    /// Filesystem, by default the one of the partition's subtype
+    #[serde(default, rename = "type")]
+    pub kind: Option<FilesystemKind>,
+    /// Partition written, by label or data subtype; the first `spiffs` or
+    /// `littlefs` data partition by default
+    #[serde(default)]
+    pub partition: Option<String>,
+}
+
+/// Filesystem a data directory is packed into
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum FilesystemKind {
+    /// `spiffsgen.py` of ESP-IDF
+    Spiffs,
+    /// `mklittlefs`, for the `joltwallet/littlefs` component
+    Littlefs,
+}
+
+/// NVS partition image of a board, generated with `nvs_partition_gen`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct NvsImage {
+    /// `key,type,encoding,value` CSV relative to the project, with `${NAME}`
+    /// placeholders for values that differ between devices
+    pub csv: String,
+    /// Partition written, by label or data subtype; `nvs` by default
+    #[serde(default)]
+    pub partition: Option<String>,
+    /// Placeholder values of every device
+    #[serde(default)]
+    pub values: BTreeMap<String, String>,
+    /// CSV and placeholder values of single devices, keyed by MAC address or serial port
+    #[serde(default)]
+    pub devices: BTreeMap<String, NvsDevice>,
+    /// Source of a unique identity for every device flashed
+    #[serde(default)]
+    pub provision: Option<Provisioning>,
+}
+
+/// Where the placeholder values of each device's identity come from, one of
+/// `identities` and `command`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct Provisioning {
+    /// CSV relative to the project: a header row of placeholder names, then
+    /// one row per identity
+    #[serde(default)]
+    pub identities: Option<String>,
+    /// Command writing `NAME=VALUE` lines of one device's identity to
+    /// `$ESPBREW_PROVISION_OUTPUT`
+    #[serde(default)]
+    pub command: Option<String>,
+    /// Placeholder naming the identity in the record; the first column or line by default
+    #[serde(default)]
+    pub id: Option<String>,
+}
+
+/// What one device's NVS image differs in
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct NvsDevice {
+    /// CSV replacing the board's
+    #[serde(default)]
+    pub csv: Option<String>,
+    /// Placeholder values taking precedence over the board's
+    #[serde(default)]
+    pub values: BTreeMap<String, String>,
+}
+
+/// Largest image and RAM usage a board build may have, e.g. `1.5MB` or `180KB`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct MemoryLimits {
+    #[serde(default)]
+    pub flash: Option<SizeLimit>,
+    #[serde(default)]
+    pub iram: Option<SizeLimit>,
+    #[serde(default)]
+    pub dram: Option<SizeLimit>,
+}
+
+/// A size in bytes or with a unit
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(untagged)]
+pub enum SizeLimit {
+    Bytes(u64),
+    Text(String),
+}
+
+/// Shell commands run from the project root before and after a board build
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct BoardHooks {
+    #[serde(default)]
+    pub pre_build: Option<HookCommands>,
+    #[serde(default)]
+    pub post_build: Option<HookCommands>,
+}
+
+/// Container of a board build, either an image name or a full specification
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(untagged)]
+pub enum BoardContainer {
+    Image(String),
+    Spec(ContainerSpec),
+}
+
+impl BoardContainer {
+    pub fn spec(&self) -> ContainerSpec {
+        match self {
+            BoardContainer::Image(image) => ContainerSpec {
+                image: image.clone(),
+                engine: None,
+                args: Vec::new(),
+            },
+            BoardContainer::Spec(spec) => spec.clone(),
+        }
+    }
+}
+
+/// Image and engine a board is built with
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct ContainerSpec {
+    pub image: String,
+    /// `docker` or `podman`; defaults to whichever is installed
+    #[serde(default)]
+    pub engine: Option<String>,
+    /// Extra arguments for `<engine> run`, e.g. `--network=host`
+    #[serde(default)]
+    pub args: Vec<String>,
+}
+
+/// Hook commands, either a single command or a list run in order
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(untagged)]
+pub enum HookCommands {
+    One(String),
+    Many(Vec<String>),
+}
+
+impl HookCommands {
+    /// Commands in execution order
+    pub fn commands(&self) -> &[String] {
+        match self {
+            HookCommands::One(command) => std::slice::from_ref(command),
+            HookCommands::Many(commands) => commands,
+        }
+    }
+}
+
+/// ESP-IDF section of `espbrew.yaml`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct EspIdfSection {
+    /// Additional application images built next to the main project
+    #[serde(default)]
+    pub apps: Vec<EspIdfApp>,
+    /// Chips a component repository is compiled for in component-only mode
+    #[serde(default)]
+    pub component_targets: Vec<String>,
+    /// `ccache`, `sccache` or `off`; defaults to whichever cache is installed
+    #[serde(default)]
+    pub compiler_cache: Option<String>,
+}
+
+/// An extra ESP-IDF application sharing the main project's partition table
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct EspIdfApp {
+    /// Name used for the artifact and the per-app build directory
+    pub name: String,
+    /// App source directory, relative to the project root
+    pub path: PathBuf,
+    /// Label of the partition the image is flashed to (e.g. `ota_0`)
+    #[serde(default)]
+    pub partition: Option<String>,
+    /// Explicit flash offset (e.g. `0x110000`), used when no partition is given
+    #[serde(default)]
+    pub offset: Option<String>,
+}
+
+/// Arduino CLI section of `espbrew.yaml`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct ArduinoSection {
+    /// Fully qualified board names to build, one board configuration each
+    #[serde(default)]
+    pub fqbns: Vec<ArduinoFqbnEntry>,
+}
+
+/// MicroPython section of `espbrew.yaml`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct MicroPythonSection {
+    /// Firmware image flashed before syncing files, relative to the project root
+    #[serde(default)]
+    pub firmware: Option<PathBuf>,
+    /// Directory whose contents are copied to the device filesystem (defaults to the project root)
+    #[serde(default)]
+    pub source_dir: Option<PathBuf>,
+}
+
+/// TinyGo section of `espbrew.yaml`
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct TinyGoSection {
+    /// `-target` values to build, overriding source-based detection
+    #[serde(default)]
+    pub targets: Vec<String>,
+    /// Vendor module dependencies into `vendor/` before building, for offline builds
+    #[serde(default)]
+    pub vendor: bool,
+}
+
+/// An FQBN entry, either a bare string or a named mapping
+#[derive(Debug, Clone, Serialize, Deserialize)]
+#[serde(untagged)]
+pub enum ArduinoFqbnEntry {
+    Fqbn(String),
+    Named { name: String, fqbn: String },
+}
+
+impl ArduinoFqbnEntry {
+    /// The FQBN passed to arduino-cli
+    pub fn fqbn(&self) -> &str {
+        match self {
+            ArduinoFqbnEntry::Fqbn(fqbn) => fqbn,
+            ArduinoFqbnEntry::Named { fqbn, .. } => fqbn,
+        }
+    }
+
+    /// Board name shown in espbrew; defaults to the board id part of the FQBN
+    /// followed by its option values, e.g. `esp32-huge_app` for
+    /// `esp32:esp32:esp32:PartitionScheme=huge_app`
+    pub fn name(&self) -> String {
+        match self {
+            ArduinoFqbnEntry::Fqbn(fqbn) => {
+                let mut parts = fqbn.split(':');
+                let Some(board) = parts.nth(2) else {
+                    return fqbn.clone();
+                };
+                let mut name = board.to_string();
+                for option in parts.flat_map(|options| options.split(',')) {
+                    let value = option.split_once('=').map_or(option, |(_, value)| value);
+                    name.push('-');
+                    name.push_str(value);
+                }
+                name
+            }
+            ArduinoFqbnEntry::Named { name, .. } => name.clone(),
+        }
+    }
+}
+
+impl ProjectConfig {
+    /// Path of the configuration file for a project
+    pub fn path(project_dir: &Path) -> PathBuf {
+        project_dir.join(PROJECT_CONFIG_FILE)
+    }
+
+    /// Settings of a board; profile builds like `box-debug` use the settings of `box`
+    pub fn board_section(&self, board_name: &str) -> Option<&BoardSection> {
+        self.boards.get(board_name).or_else(|| {
+            split_cell(self, board_name).and_then(|(board, _, _)| self.boards.get(&board))
+        })
+    }
+
+    /// Hooks configured for a board, if any
+    pub fn board_hooks(&self, board_name: &str) -> Option<&BoardHooks> {
+        self.board_section(board_name).map(|board| &board.hooks)
+    }
+
+    /// Container a board is built in, if any
+    pub fn board_container(&self, board_name: &str) -> Option<ContainerSpec> {
+        self.board_section(board_name)
+            .and_then(|board| board.container.as_ref())
+            .map(BoardContainer::spec)
+    }
+
+    /// Memory budget of a board, if any
+    pub fn board_limits(&self, board_name: &str) -> Option<&MemoryLimits> {
+        self.board_section(board_name)
+            .and_then(|board| board.limits.as_ref())
+    }
+
+    /// Command templates of a board: its own, falling back to its project type's
+    pub fn command_templates(
+        &self,
+        board_name: &str,
+        project_type: &ProjectType,
+    ) -> CommandTemplates {
+        let board = self
+            .board_section(board_name)
+            .map(|board| board.commands.clone())
+            .unwrap_or_default();
+        let project = self
+            .commands
+            .get(project_type.config_key())
+            .cloned()
+            .unwrap_or_default();
+        CommandTemplates {
+            build: board.build.or(project.build),
+            flash: board.flash.or(project.flash),
+            monitor: board.monitor.or(project.monitor),
+        }
+    }
+
+    /// Load `espbrew.yaml` from the project directory, if it exists
+    pub fn load(project_dir: &Path) -> Result<Option<Self>> {
+        let config_path = Self::path(project_dir);
+        if !config_path.exists() {
+            return Ok(None);
+        }
+
+        let content = std::fs::read_to_string(&config_path)
+            .with_context(|| format!("Failed to read {}", config_path.display()))?;
+        let config: ProjectConfig = serde_yaml::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", config_path.display()))?;
+
+        Ok(Some(config))
+    }
+}
@@ -0,0 +1,188 @@
+//! Differences between the effective sdkconfig of two board configs
+
+use anyhow::Result;
+use std::path::Path;
+
+use crate::config::sdkconfig_fragments::{SdkconfigOption, effective_options};
+
+/// Marker of options set on both sides with different values
+pub const CHANGED_MARKER: &str = "≠";
+/// Marker of options only set by the left board
+pub const LEFT_ONLY_MARKER: &str = "◀";
+/// Marker of options only set by the right board
+pub const RIGHT_ONLY_MARKER: &str = "▶";
+
+/// An option whose effective value differs between two boards
+#[derive(Debug, Clone, PartialEq)]
+pub struct OptionDiff {
+    pub key: String,
+    /// `None` if the left board doesn't set the option
+    pub left: Option<SdkconfigOption>,
+    /// `None` if the right board doesn't set the option
+    pub right: Option<SdkconfigOption>,
+}
+
+impl OptionDiff {
+    /// One readable line, prefixed with the marker of the kind of difference
+    pub fn to_line(&self, left_name: &str, right_name: &str) -> String {
+        match (&self.left, &self.right) {
+            (Some(left), Some(right)) => format!(
+                "{} {}: {} → {}",
+                CHANGED_MARKER,
+                self.key,
+                display_value(left),
+                display_value(right)
+            ),
+            (Some(left), None) => format!(
+                "{} {}  (only {})",
+                LEFT_ONLY_MARKER,
+                left.to_line(),
+                left_name
+            ),
+            (None, Some(right)) => format!(
+                "{} {}  (only {})",
+                RIGHT_ONLY_MARKER,
+                right.to_line(),
+                right_name
+            ),
+            (None, None) => self.key.clone(),
+        }
+    }
+}
+
+fn display_value(option: &SdkconfigOption) -> &str {
+    option.value.as_deref().unwrap_or("not set")
+}
+
+/// Result of comparing two board configs
+#[derive(Debug, Clone, Default)]
+pub struct SdkconfigDiff {
+    /// Differing options, sorted by key
+    pub differences: Vec<OptionDiff>,
+    /// Number of options with the same value on both sides
+    pub identical: usize,
+}
+
+impl SdkconfigDiff {
+    pub fn is_empty(&self) -> bool {
+        self.differences.is_empty()
+    }
+
+    /// Header and one line per difference, for the CLI and the TUI log pane
+    pub fn report_lines(&self, left_name: &str, right_name: &str) -> Vec<String> {
+        let mut lines = vec![format!(
+            "🔍 sdkconfig diff: {} {} {} {}",
+            left_name, LEFT_ONLY_MARKER, RIGHT_ONLY_MARKER, right_name
+        )];
+
+        if self.is_empty() {
+            lines.push(format!(
+                "✅ No differences ({} identical option(s))",
+                self.identical
+            ));
+            return lines;
+        }
+
+        lines.extend(
+            self.differences
+                .iter()
+                .map(|diff| diff.to_line(left_name, right_name)),
+        );
+        lines.push(format!(
+            "📋 {} differing, {} identical option(s)",
+            self.differences.len(),
+            self.identical
+        ));
+        lines
+    }
+}
+
+/// Compare two option lists
+pub fn diff_options(left: &[SdkconfigOption], right: &[SdkconfigOption]) -> SdkconfigDiff {
+    let mut diff = SdkconfigDiff::default();
+
+    for option in left {
+        match right.iter().find(|o| o.key == option.key) {
+            Some(other) if other.value == option.value => diff.identical += 1,
+            other => diff.differences.push(OptionDiff {
+                key: option.key.clone(),
+                left: Some(option.clone()),
+                right: other.cloned(),
+            }),
+        }
+    }
+    for option in right {
+        if !left.iter().any(|o| o.key == option.key) {
+            diff.differences.push(OptionDiff {
+                key: option.key.clone(),
+                left: None,
+                right: Some(option.clone()),
+            });
+        }
+    }
+
+    diff.differences.sort_by(|a, b| a.key.cmp(&b.key));
+    diff
+}
+
+/// Compare the merged fragments of two board config files
+pub fn diff_board_configs(left_config: &Path, right_config: &Path) -> Result<SdkconfigDiff> {
+    let left = effective_options(left_config)?;
+    let right = effective_options(right_config)?;
+    Ok(diff_options(&left, &right))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_sdkconfig_diff() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "CONFIG_FREERTOS_HZ=1000\nCONFIG_SPIRAM=y\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_ESPTOOLPY_FLASHSIZE_16MB=y\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.c3"),
+            "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32c3\"\n# CONFIG_SPIRAM is not set\nCONFIG_BT_ENABLED=y\n",
+        )
+        .unwrap();
+
+        let diff = diff_board_configs(
+            &project.join("sdkconfig.defaults.box"),
+            &project.join("sdkconfig.defaults.c3"),
+        )
+        .unwrap();
+
+        assert_eq!(diff.identical, 1);
+        let keys: Vec<&str> = diff.differences.iter().map(|d| d.key.as_str()).collect();
+        assert_eq!(
+            keys,
+            vec![
+                "CONFIG_BT_ENABLED",
+                "CONFIG_ESPTOOLPY_FLASHSIZE_16MB",
+                "CONFIG_IDF_TARGET",
+                "CONFIG_SPIRAM"
+            ]
+        );
+
+        let lines = diff.report_lines("box", "c3");
+        assert!(lines.contains(&"▶ CONFIG_BT_ENABLED=y  (only c3)".to_string()));
+        assert!(lines.contains(&"◀ CONFIG_ESPTOOLPY_FLASHSIZE_16MB=y  (only box)".to_string()));
+        assert!(lines.contains(&"≠ CONFIG_SPIRAM: y → not set".to_string()));
+        assert_eq!(
+            lines.last().unwrap(),
+            "📋 4 differing, 1 identical option(s)"
+        );
+    }
+}
@@ -0,0 +1,343 @@
+//! Board config inheritance between sdkconfig fragments
+//!
+//! A board file declares its base fragments with a comment, which ESP-IDF
+//! itself ignores:
+//!
+//! ```text
+//! # extends: sdkconfig.defaults.common
+//! CONFIG_ESPTOOLPY_FLASHSIZE_16MB=y
+//! ```
+//!
+//! Bases are applied first and may extend further fragments; options of the
+//! board file override everything it inherits.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+/// Comment directive naming the base fragments of a config file
+pub const EXTENDS_DIRECTIVE: &str = "extends:";
+/// Merged defaults written to the board's build directory
+pub const EFFECTIVE_DEFAULTS_FILE: &str = "sdkconfig.defaults.effective";
+/// Heading of the backward compatibility section of a generated `sdkconfig`
+const DEPRECATED_OPTIONS_MARKER: &str = "# Deprecated options for backward compatibility";
+
+/// An option of the merged configuration
+#[derive(Debug, Clone, PartialEq)]
+pub struct SdkconfigOption {
+    pub key: String,
+    /// `None` for `# CONFIG_FOO is not set`
+    pub value: Option<String>,
+    /// Fragment that set the effective value
+    pub source: PathBuf,
+}
+
+impl SdkconfigOption {
+    /// The option as an sdkconfig line
+    pub fn to_line(&self) -> String {
+        match &self.value {
+            Some(value) => format!("{}={}", self.key, value),
+            None => format!("# {} is not set", self.key),
+        }
+    }
+}
+
+/// Base fragments declared by a config file, resolved relative to its directory
+pub fn declared_bases(config_file: &Path) -> Result<Vec<PathBuf>> {
+    let content = std::fs::read_to_string(config_file)
+        .with_context(|| format!("Failed to read {}", config_file.display()))?;
+    let dir = config_file.parent().unwrap_or(Path::new("."));
+
+    Ok(content
+        .lines()
+        .filter_map(|line| {
+            line.trim()
+                .strip_prefix('#')
+                .and_then(|rest| rest.trim_start().strip_prefix(EXTENDS_DIRECTIVE))
+        })
+        .flat_map(|bases| {
+            bases
+                .split([',', ' '])
+                .filter(|base| !base.is_empty())
+                .map(|base| dir.join(base))
+                .collect::<Vec<_>>()
+        })
+        .collect())
+}
+
+/// Whether a config file inherits from other fragments
+pub fn has_bases(config_file: &Path) -> bool {
+    declared_bases(config_file)
+        .map(|bases| !bases.is_empty())
+        .unwrap_or(false)
+}
+
+/// Fragments making up a config file, bases first and the file itself last
+pub fn fragment_chain(config_file: &Path) -> Result<Vec<PathBuf>> {
+    let mut chain = Vec::new();
+    collect_chain(config_file, &mut Vec::new(), &mut chain)?;
+    Ok(chain)
+}
+
+fn collect_chain(
+    config_file: &Path,
+    visiting: &mut Vec<PathBuf>,
+    chain: &mut Vec<PathBuf>,
+) -> Result<()> {
+    if visiting.iter().any(|f| f == config_file) {
+        return Err(anyhow::anyhow!(
+            "Config inheritance cycle: {} extends itself",
+            config_file.display()
+        ));
+    }
+    if chain.iter().any(|f| f == config_file) {
+        return Ok(());
+    }
+    if !config_file.exists() {
+        return Err(anyhow::anyhow!(
+            "Base config {} does not exist",
+            config_file.display()
+        ));
+    }
+
+    visiting.push(config_file.to_path_buf());
+    for base in declared_bases(config_file)? {
+        collect_chain(&base, visiting, chain)?;
+    }
+    visiting.pop();
+
+    chain.push(config_file.to_path_buf());
+    Ok(())
+}
+
+/// Options of the merged configuration, in first-seen order with the last value winning
+pub fn effective_options(config_file: &Path) -> Result<Vec<SdkconfigOption>> {
+    let mut options: Vec<SdkconfigOption> = Vec::new();
+
+    for fragment in fragment_chain(config_file)? {
+        for parsed in read_options(&fragment)? {
+            match options.iter_mut().find(|o| o.key == parsed.key) {
+                Some(option) => {
+                    option.value = parsed.value;
+                    option.source = parsed.source;
+                }
+                None => options.push(parsed),
+            }
+        }
+    }
+
+    Ok(options)
+}
+
+/// Options set by a single file, without following its bases.
+///
+/// The legacy aliases ESP-IDF appends to a generated `sdkconfig` are skipped.
+pub fn read_options(path: &Path) -> Result<Vec<SdkconfigOption>> {
+    let content = std::fs::read_to_string(path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+
+    Ok(content
+        .lines()
+        .map(str::trim)
+        .take_while(|line| *line != DEPRECATED_OPTIONS_MARKER)
+        .filter_map(parse_option_line)
+        .map(|(key, value)| SdkconfigOption {
+            key: key.to_string(),
+            value,
+            source: path.to_path_buf(),
+        })
+        .collect())
+}
+
+fn parse_option_line(line: &str) -> Option<(&str, Option<String>)> {
+    if let Some(key) = line
+        .strip_prefix("# ")
+        .and_then(|rest| rest.strip_suffix(" is not set"))
+    {
+        key.starts_with("CONFIG_").then(|| (key.trim(), None))
+    } else if line.starts_with("CONFIG_") {
+        line.split_once('=')
+            .map(|(key, value)| (key.trim(), Some(value.trim().to_string())))
+    } else {
+        None
+    }
+}
+
+/// Options of `after` that are new or have a different value than in `before`
+pub fn changed_options(
+    before: &[SdkconfigOption],
+    after: &[SdkconfigOption],
+) -> Vec<SdkconfigOption> {
+    after
+        .iter()
+        .filter(|option| {
+            !before
+                .iter()
+                .any(|o| o.key == option.key && o.value == option.value)
+        })
+        .cloned()
+        .collect()
+}
+
+/// Write options into a fragment, replacing lines that already set them and
+/// appending the rest, so comments and `# extends:` lines are kept
+pub fn update_fragment(fragment: &Path, options: &[SdkconfigOption]) -> Result<()> {
+    let content = if fragment.exists() {
+        std::fs::read_to_string(fragment)
+            .with_context(|| format!("Failed to read {}", fragment.display()))?
+    } else {
+        String::new()
+    };
+
+    let mut lines: Vec<String> = content.lines().map(|l| l.to_string()).collect();
+    for option in options {
+        let existing = lines.iter().position(|line| {
+            parse_option_line(line.trim()).is_some_and(|(key, _)| key == option.key)
+        });
+        match existing {
+            Some(index) => lines[index] = option.to_line(),
+            None => lines.push(option.to_line()),
+        }
+    }
+
+    let mut updated = lines.join("\n");
+    updated.push('\n');
+    std::fs::write(fragment, updated)
+        .with_context(|| format!("Failed to write {}", fragment.display()))
+}
+
+/// Replace options with the overrides of the same key, appending new ones
+pub fn apply_overrides(options: &mut Vec<SdkconfigOption>, overrides: &[SdkconfigOption]) {
+    for parsed in overrides {
+        match options.iter_mut().find(|o| o.key == parsed.key) {
+            Some(option) => *option = parsed.clone(),
+            None => options.push(parsed.clone()),
+        }
+    }
+}
+
+/// Defaults file to hand to ESP-IDF for a board.
+///
+/// Files without bases or overrides are used as they are; otherwise the merged
+/// fragments, followed by the overrides, are written to
+/// `<build_dir>/sdkconfig.defaults.effective`.
+pub fn effective_defaults_file(
+    config_file: &Path,
+    build_dir: &Path,
+    overrides: &[SdkconfigOption],
+) -> Result<PathBuf> {
+    if !has_bases(config_file) && overrides.is_empty() {
+        return Ok(config_file.to_path_buf());
+    }
+
+    let chain = fragment_chain(config_file)?;
+    let mut content = String::from("# Generated by espbrew from:\n");
+    for fragment in &chain {
+        content.push_str(&format!("#   {}\n", fragment.display()));
+    }
+    if let Some(source) = overrides.first().map(|o| &o.source) {
+        content.push_str(&format!("#   {}\n", source.display()));
+    }
+
+    let mut options = effective_options(config_file)?;
+    apply_overrides(&mut options, overrides);
+    for option in options {
+        content.push_str(&option.to_line());
+        content.push('\n');
+    }
+
+    std::fs::create_dir_all(build_dir)
+        .with_context(|| format!("Failed to create {}", build_dir.display()))?;
+    let merged = build_dir.join(EFFECTIVE_DEFAULTS_FILE);
+    if std::fs::read_to_string(&merged).ok().as_deref() != Some(content.as_str()) {
+        std::fs::write(&merged, content)
+            .with_context(|| format!("Failed to write {}", merged.display()))?;
+    }
+
+    Ok(merged)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_fragment_inheritance() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "CONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_LOG_DEFAULT_LEVEL_INFO=y\nCONFIG_SPIRAM=y\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.c6"),
+            "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32c6\"\n# CONFIG_SPIRAM is not set\n",
+        )
+        .unwrap();
+
+        let c6 = project.join("sdkconfig.defaults.c6");
+        assert_eq!(
+            fragment_chain(&c6).unwrap(),
+            vec![project.join("sdkconfig.defaults.common"), c6.clone()]
+        );
+        let options = effective_options(&c6).unwrap();
+        let spiram = options.iter().find(|o| o.key == "CONFIG_SPIRAM").unwrap();
+        assert_eq!(spiram.value, None);
+        assert_eq!(spiram.source, c6);
+        assert_eq!(options[0].to_line(), "CONFIG_IDF_TARGET=\"esp32c6\"");
+
+        let build_dir = project.join("build.c6");
+        let merged = effective_defaults_file(&c6, &build_dir, &[]).unwrap();
+        assert_eq!(merged, build_dir.join(EFFECTIVE_DEFAULTS_FILE));
+        let content = fs::read_to_string(&merged).unwrap();
+        assert!(content.contains("CONFIG_LOG_DEFAULT_LEVEL_INFO=y"));
+        assert!(content.contains("# CONFIG_SPIRAM is not set"));
+
+        // Cycles are reported instead of recursing forever
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "# extends: sdkconfig.defaults.c6\n",
+        )
+        .unwrap();
+        assert!(fragment_chain(&c6).is_err());
+    }
+
+    #[test]
+    fn test_menuconfig_option_sync() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        let before_file = project.join("sdkconfig.before");
+        let after_file = project.join("sdkconfig");
+        fs::write(
+            &before_file,
+            "CONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_FREERTOS_HZ=100\n# CONFIG_SPIRAM is not set\n",
+        )
+        .unwrap();
+        fs::write(
+            &after_file,
+            "CONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_FREERTOS_HZ=1000\nCONFIG_SPIRAM=y\n\n# Deprecated options for backward compatibility\nCONFIG_SPIRAM_SUPPORT=y\n",
+        )
+        .unwrap();
+
+        let changed = changed_options(
+            &read_options(&before_file).unwrap(),
+            &read_options(&after_file).unwrap(),
+        );
+        let lines: Vec<String> = changed.iter().map(|o| o.to_line()).collect();
+        assert_eq!(lines, vec!["CONFIG_FREERTOS_HZ=1000", "CONFIG_SPIRAM=y"]);
+
+        let fragment = project.join("sdkconfig.defaults.box");
+        fs::write(
+            &fragment,
+            "# extends: sdkconfig.defaults.common\n# CONFIG_SPIRAM is not set\n",
+        )
+        .unwrap();
+        update_fragment(&fragment, &changed).unwrap();
+        assert_eq!(
+            fs::read_to_string(&fragment).unwrap(),
+            "# extends: sdkconfig.defaults.common\nCONFIG_SPIRAM=y\nCONFIG_FREERTOS_HZ=1000\n"
+        );
+    }
+}
@@ -0,0 +1,193 @@
+//! Checks of sdkconfig options against the board's target chip
+//!
+//! ESP-IDF silently drops options its Kconfig doesn't offer for a target, so a
+//! PSRAM setting on an ESP32-C3 or a 26 MHz crystal on an ESP32-S3 only shows up
+//! as a board that doesn't behave as configured.
+
+use std::path::{Path, PathBuf};
+
+use crate::config::sdkconfig_fragments::SdkconfigOption;
+
+/// ESP-IDF targets
+const KNOWN_TARGETS: &[&str] = &[
+    "esp32", "esp32s2", "esp32s3", "esp32c2", "esp32c3", "esp32c5", "esp32c6", "esp32c61",
+    "esp32h2", "esp32p4",
+];
+/// Targets without PSRAM support
+const NO_PSRAM_TARGETS: &[&str] = &["esp32c2", "esp32c3", "esp32c6", "esp32h2"];
+/// Targets without a USB Serial/JTAG controller
+const NO_USB_SERIAL_JTAG_TARGETS: &[&str] = &["esp32", "esp32s2"];
+/// Targets with a USB OTG peripheral for the USB CDC console
+const USB_CDC_TARGETS: &[&str] = &["esp32s2", "esp32s3"];
+/// Targets without Bluetooth
+const NO_BLUETOOTH_TARGETS: &[&str] = &["esp32s2", "esp32p4"];
+
+/// How serious a finding is
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum LintSeverity {
+    /// Ignored by ESP-IDF, most likely a leftover
+    Warning,
+    /// The board won't get the configured behavior
+    Error,
+}
+
+/// A problem with an option of a board config
+#[derive(Debug, Clone, PartialEq)]
+pub struct LintIssue {
+    pub severity: LintSeverity,
+    pub key: String,
+    pub message: String,
+    /// Fragment that set the option
+    pub source: PathBuf,
+}
+
+impl LintIssue {
+    /// One readable line, e.g. `❌ CONFIG_SPIRAM (sdkconfig.defaults.c3): esp32c3 has no PSRAM`
+    pub fn to_line(&self) -> String {
+        let marker = match self.severity {
+            LintSeverity::Warning => "⚠️ ",
+            LintSeverity::Error => "❌",
+        };
+        let source = self
+            .source
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .unwrap_or_else(|| self.source.display().to_string());
+        format!("{} {} ({}): {}", marker, self.key, source, self.message)
+    }
+}
+
+/// Whether any issue would break the build
+pub fn has_errors(issues: &[LintIssue]) -> bool {
+    issues.iter().any(|i| i.severity == LintSeverity::Error)
+}
+
+/// Target chip selected by the options, e.g. `esp32c3`
+pub fn configured_target(options: &[SdkconfigOption]) -> Option<String> {
+    options
+        .iter()
+        .find(|o| o.key == "CONFIG_IDF_TARGET")
+        .and_then(|o| o.value.as_deref())
+        .map(|value| value.trim_matches('"').to_lowercase())
+}
+
+/// Issues of enabled options that don't apply to the target; unknown targets aren't checked
+pub fn lint_options(target: &str, options: &[SdkconfigOption]) -> Vec<LintIssue> {
+    let target = target.to_lowercase();
+    if !KNOWN_TARGETS.contains(&target.as_str()) {
+        return Vec::new();
+    }
+
+    let mut issues = Vec::new();
+    for option in options
+        .iter()
+        .filter(|o| o.value.as_deref().is_some_and(|v| v != "n"))
+    {
+        if let Some((severity, message)) = check_option(&target, &option.key) {
+            issues.push(LintIssue {
+                severity,
+                key: option.key.clone(),
+                message,
+                source: option.source.clone(),
+            });
+        }
+    }
+    issues
+}
+
+fn check_option(target: &str, key: &str) -> Option<(LintSeverity, String)> {
+    if key.starts_with("CONFIG_SPIRAM") && NO_PSRAM_TARGETS.contains(&target) {
+        return Some((LintSeverity::Error, format!("{} has no PSRAM", target)));
+    }
+    if key == "CONFIG_SPIRAM_MODE_OCT" && target != "esp32s3" {
+        return Some((
+            LintSeverity::Error,
+            format!("octal PSRAM is only available on esp32s3, not {}", target),
+        ));
+    }
+    if let Some(frequency) = key.strip_prefix("CONFIG_XTAL_FREQ_") {
+        let valid = crystal_frequencies(target);
+        if !valid.contains(&frequency) {
+            return Some((
+                LintSeverity::Error,
+                format!(
+                    "{} supports a {} MHz crystal, not {}",
+                    target,
+                    valid.join(" or "),
+                    frequency
+                ),
+            ));
+        }
+    }
+    if key == "CONFIG_ESP_CONSOLE_USB_SERIAL_JTAG" && NO_USB_SERIAL_JTAG_TARGETS.contains(&target) {
+        return Some((
+            LintSeverity::Error,
+            format!("{} has no USB Serial/JTAG controller", target),
+        ));
+    }
+    if key == "CONFIG_ESP_CONSOLE_USB_CDC" && !USB_CDC_TARGETS.contains(&target) {
+        return Some((
+            LintSeverity::Error,
+            format!("the USB CDC console needs USB OTG, which {} lacks", target),
+        ));
+    }
+    if key == "CONFIG_BT_ENABLED" && NO_BLUETOOTH_TARGETS.contains(&target) {
+        return Some((LintSeverity::Error, format!("{} has no Bluetooth", target)));
+    }
+    if let Some(chip) = chip_of_option(key)
+        && chip != target
+    {
+        return Some((
+            LintSeverity::Warning,
+            format!("{} option, ignored on {}", chip, target),
+        ));
+    }
+    None
+}
+
+/// Supported crystal frequencies of a target, as used in `CONFIG_XTAL_FREQ_<n>`
+fn crystal_frequencies(target: &str) -> &'static [&'static str] {
+    match target {
+        "esp32" => &["26", "40", "AUTO"],
+        "esp32c2" => &["26", "40"],
+        "esp32c5" => &["40", "48"],
+        "esp32h2" => &["32"],
+        _ => &["40"],
+    }
+}
+
+/// Chip named by a chip specific option, e.g. `esp32s3` for `CONFIG_ESP32S3_REV_MIN_2`.
+///
+/// `CONFIG_ESP32_` is left out: ESP-IDF keeps many of those as aliases on every target.
+fn chip_of_option(key: &str) -> Option<&'static str> {
+    KNOWN_TARGETS
+        .iter()
+        .filter(|chip| **chip != "esp32")
+        .filter(|chip| {
+            key.strip_prefix("CONFIG_")
+                .and_then(|rest| rest.strip_prefix(chip.to_uppercase().as_str()))
+                .is_some_and(|rest| rest.starts_with('_'))
+        })
+        .max_by_key(|chip| chip.len())
+        .copied()
+}
+
+/// Report lines of a board's lint result, for the CLI and the build log
+pub fn report_lines(board_name: &str, config_file: &Path, issues: &[LintIssue]) -> Vec<String> {
+    if issues.is_empty() {
+        return vec![format!(
+            "✅ {}: {} passes the target checks",
+            board_name,
+            config_file.display()
+        )];
+    }
+
+    let mut lines = vec![format!(
+        "🔎 {}: {} issue(s) in {}",
+        board_name,
+        issues.len(),
+        config_file.display()
+    )];
+    lines.extend(issues.iter().map(|issue| format!("  {}", issue.to_line())));
+    lines
+}
@@ -0,0 +1,164 @@
+//! Toolchain versions pinned in `espbrew.yaml`
+//!
+//! ```yaml
+//! toolchain:
+//!   esp_idf: "5.3"      # any 5.3.x
+//!   tinygo: "0.33.0"
+//!   rust: esp           # a rustup toolchain name or a rustc version
+//! boards:
+//!   legacy:
+//!     toolchain:
+//!       esp_idf: "4.4"
+//! ```
+//!
+//! Board pins override the project pins of the same toolchain.
+
+use serde::{Deserialize, Serialize};
+use std::path::Path;
+
+use crate::config::project_config::ProjectConfig;
+use crate::models::ProjectType;
+
+/// A toolchain that can be pinned
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Toolchain {
+    EspIdf,
+    TinyGo,
+    Rust,
+}
+
+impl Toolchain {
+    pub fn name(&self) -> &'static str {
+        match self {
+            Toolchain::EspIdf => "ESP-IDF",
+            Toolchain::TinyGo => "TinyGo",
+            Toolchain::Rust => "Rust",
+        }
+    }
+
+    /// Toolchain building projects of a type, if it can be pinned
+    pub fn for_project_type(project_type: &ProjectType) -> Option<Self> {
+        match project_type {
+            ProjectType::EspIdf => Some(Toolchain::EspIdf),
+            ProjectType::TinyGo => Some(Toolchain::TinyGo),
+            ProjectType::RustNoStd => Some(Toolchain::Rust),
+            _ => None,
+        }
+    }
+}
+
+/// Pinned versions; unset toolchains aren't checked
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct ToolchainPins {
+    #[serde(default)]
+    pub esp_idf: Option<String>,
+    #[serde(default)]
+    pub tinygo: Option<String>,
+    #[serde(default)]
+    pub rust: Option<String>,
+}
+
+impl ToolchainPins {
+    /// Pins of a board merged over the project pins
+    pub fn load(project_dir: &Path, board_name: &str) -> Self {
+        let Some(config) = ProjectConfig::load(project_dir).ok().flatten() else {
+            return Self::default();
+        };
+        match config.board_section(board_name) {
+            Some(board) => board.toolchain.merged_over(&config.toolchain),
+            None => config.toolchain,
+        }
+    }
+
+    /// These pins, falling back to `base` for unset toolchains
+    pub fn merged_over(&self, base: &ToolchainPins) -> Self {
+        ToolchainPins {
+            esp_idf: self.esp_idf.clone().or_else(|| base.esp_idf.clone()),
+            tinygo: self.tinygo.clone().or_else(|| base.tinygo.clone()),
+            rust: self.rust.clone().or_else(|| base.rust.clone()),
+        }
+    }
+
+    pub fn pin(&self, toolchain: Toolchain) -> Option<&str> {
+        match toolchain {
+            Toolchain::EspIdf => self.esp_idf.as_deref(),
+            Toolchain::TinyGo => self.tinygo.as_deref(),
+            Toolchain::Rust => self.rust.as_deref(),
+        }
+    }
+}
+
+/// Whether a pin is a version number rather than a toolchain name like `esp`
+pub fn is_version_pin(pin: &str) -> bool {
+    pin.trim_start_matches(['v', 'V'])
+        .starts_with(|c: char| c.is_ascii_digit())
+}
+
+/// First version number in a tool's output, e.g. `5.3.1` in `ESP-IDF v5.3.1-dirty`
+pub fn extract_version(text: &str) -> Option<String> {
+    text.split(|c: char| c.is_whitespace() || c == '-' || c == '(')
+        .map(|word| word.trim_start_matches(['v', 'V']))
+        .find(|word| word.starts_with(|c: char| c.is_ascii_digit()) && word.contains('.'))
+        .map(|word| {
+            word.trim_end_matches(|c: char| !c.is_ascii_digit())
+                .to_string()
+        })
+}
+
+/// Whether a version satisfies a pin; `5.3` accepts every `5.3.x`, `5.3.1` only itself
+pub fn version_matches(pin: &str, version: &str) -> bool {
+    let pin = pin.trim().trim_start_matches(['v', 'V']);
+    let version = version.trim().trim_start_matches(['v', 'V']);
+    let version: Vec<&str> = version.split('.').collect();
+    pin.split('.')
+        .enumerate()
+        .all(|(i, part)| version.get(i) == Some(&part))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_version_matches() {
+        assert!(version_matches("5.3", "5.3.1"));
+        assert!(version_matches("v5.3.1", "5.3.1"));
+        assert!(!version_matches("5.3", "5.30.0"));
+        assert!(!version_matches("5.3.1", "5.3"));
+        assert_eq!(
+            extract_version("ESP-IDF v5.3.1-dirty").as_deref(),
+            Some("5.3.1")
+        );
+        assert_eq!(
+            extract_version("tinygo version 0.33.0 linux/amd64 (using go version go1.22.5)")
+                .as_deref(),
+            Some("0.33.0")
+        );
+        assert_eq!(
+            extract_version("rustc 1.85.0 (4d91de4e4 2025-02-17)").as_deref(),
+            Some("1.85.0")
+        );
+    }
+
+    #[test]
+    fn test_board_pins() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "toolchain:\n  esp_idf: \"5.3\"\n  tinygo: \"0.0.1\"\nboards:\n  legacy:\n    toolchain:\n      esp_idf: \"4.4\"\n",
+        )
+        .unwrap();
+
+        // Board pins override the project pins of the same toolchain only
+        let legacy = ToolchainPins::load(project, "legacy");
+        assert_eq!(legacy.esp_idf.as_deref(), Some("4.4"));
+        assert_eq!(legacy.tinygo.as_deref(), Some("0.0.1"));
+        assert_eq!(
+            ToolchainPins::load(project, "box").esp_idf.as_deref(),
+            Some("5.3")
+        );
+    }
+}
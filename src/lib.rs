@@ -2,7 +2,7 @@
 //!
 //! ESPBrew is a comprehensive build manager for ESP32 projects supporting multiple
 //! frameworks including ESP-IDF, Rust no_std, Arduino, MicroPython, CircuitPython,
-//! TinyGo, Zephyr, NuttX, and PlatformIO.
+//! TinyGo, Zephyr, NuttX, PlatformIO, and the legacy ESP8266 RTOS SDK.
 
 pub mod cli;
 pub mod config;
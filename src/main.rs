@@ -7,16 +7,41 @@ use clap::Parser;
 use log::{error, info, warn};
 
 use espbrew::cli::args::{Cli, Commands};
-use espbrew::cli::commands::boards::execute_boards_command;
+use espbrew::cli::commands::agent::execute_agent_command;
+use espbrew::cli::commands::boards::{execute_boards_action, execute_boards_command};
 use espbrew::cli::commands::build::execute_build_command;
+use espbrew::cli::commands::config::execute_config_command;
+use espbrew::cli::commands::daemon::execute_daemon_command;
+use espbrew::cli::commands::device::execute_device_command;
 use espbrew::cli::commands::discover::execute_discover_command;
+use espbrew::cli::commands::erase::execute_erase_command;
+use espbrew::cli::commands::export::execute_export_command;
 use espbrew::cli::commands::flash::execute_flash_command;
-use espbrew::cli::commands::monitor::execute_monitor_command;
+use espbrew::cli::commands::logs::execute_logs_command;
+use espbrew::cli::commands::monitor::{
+    execute_monitor_command, monitor_elf, monitor_port, monitor_recording,
+};
+use espbrew::cli::commands::new::execute_new_command;
+use espbrew::cli::commands::ota::execute_ota_command;
 use espbrew::cli::commands::remote_flash::execute_remote_flash_command;
 use espbrew::cli::commands::remote_monitor::execute_remote_monitor_command;
+use espbrew::cli::commands::replay::execute_replay_command;
+use espbrew::cli::commands::resume::execute_resume_command;
+use espbrew::cli::commands::serve::{execute_serve_command, start_web_dashboard};
+use espbrew::cli::commands::setup::execute_setup_command;
+use espbrew::cli::commands::stats::execute_stats_command;
+use espbrew::cli::commands::watch::{WatchOptions, execute_watch_command};
+use espbrew::cli::commands::workspace::execute_workspace_command;
 use espbrew::cli::tui::event_loop::run_tui_event_loop;
+use espbrew::cli::tui::keymap::Keymap;
 use espbrew::cli::tui::main_app::App;
+use espbrew::cli::tui::theme::Theme;
 use espbrew::projects::ProjectRegistry;
+use espbrew::projects::build_plan::PlanFormat;
+use espbrew::projects::build_scheduler::{BuildScheduler, SchedulerSettings};
+use espbrew::projects::json_output::OutputFormat;
+use espbrew::projects::remote_build::AgentPool;
+use espbrew::projects::workspace::{DEFAULT_WORKSPACE_DEPTH, discover_workspace};
 use espbrew::utils::logging::init_cli_logging;
 
 #[tokio::main]
@@ -24,8 +49,17 @@ async fn main() -> Result<()> {
     let cli = Cli::parse();
 
     // Initialize logging based on CLI mode
-    let is_tui_mode = !cli.cli && cli.command.is_none() && cli.handle_url.is_none();
-    init_cli_logging(cli.verbose, cli.quiet, is_tui_mode)?;
+    // `espbrew watch`, `espbrew serve` and `espbrew replay` run in the TUI unless --cli
+    // or --plain is given
+    let plain = cli.plain_output();
+    let cli_mode = cli.cli || plain || cli.json_output();
+    let tui_watch = !cli_mode && matches!(cli.command, Some(Commands::Watch { .. }));
+    let tui_serve = !cli_mode && matches!(cli.command, Some(Commands::Serve { .. }));
+    let tui_replay = !cli_mode && matches!(cli.command, Some(Commands::Replay { .. }));
+    let is_tui_mode = !cli_mode
+        && (cli.command.is_none() || tui_watch || tui_serve || tui_replay)
+        && cli.handle_url.is_none();
+    init_cli_logging(cli.verbose, cli.quiet, is_tui_mode, plain)?;
 
     // Handle URL handler operations first
     if cli.register_handler {
@@ -45,6 +79,36 @@ async fn main() -> Result<()> {
         return handle_espbrew_url(url).await;
     }
 
+    // Scaffolding creates the project directory, so it runs before project detection
+    if let Some(Commands::New { template, chips }) = &cli.command {
+        return execute_new_command(&cli, *template, chips).await;
+    }
+
+    // The agent builds the projects it is sent, not the one it is started in
+    if let Some(Commands::Agent {
+        listen,
+        work_dir,
+        token,
+    }) = &cli.command
+    {
+        return execute_agent_command(listen, work_dir.clone(), token.clone()).await;
+    }
+
+    // Setup runs ahead of the detection output, so `--print-env` can be eval'd
+    if let Some(Commands::Setup { dry_run, print_env }) = &cli.command {
+        return execute_setup_command(&cli, *dry_run, *print_env).await;
+    }
+
+    // Log searches print only the matches, so they can be piped
+    if let Some(Commands::Logs { action }) = &cli.command {
+        return execute_logs_command(&cli, action.clone()).await;
+    }
+
+    // A replay shows the recorded project's boards, not the one it is started in
+    if let Some(Commands::Replay { file, speed }) = &cli.command {
+        return execute_replay_command(&cli, file, *speed).await;
+    }
+
     let project_dir = cli
         .project_dir
         .clone()
@@ -92,23 +156,53 @@ async fn main() -> Result<()> {
                 error!("❌ Error discovering boards: {}", e);
             }
         }
-        println!();
+        if !cli.json_output() {
+            println!();
+        }
     } else {
-        warn!(
-            "⚠️  Unknown project type in {}. Falling back to ESP-IDF mode.",
-            project_dir.display()
-        );
-        info!("   Supported project types: ESP-IDF, Rust no_std, Arduino");
-        println!();
+        let workspace =
+            discover_workspace(&project_dir, DEFAULT_WORKSPACE_DEPTH).unwrap_or_default();
+        if workspace.is_empty() {
+            warn!(
+                "⚠️  Unknown project type in {}. Falling back to ESP-IDF mode.",
+                project_dir.display()
+            );
+            info!("   Supported project types: ESP-IDF, Rust no_std, Arduino");
+        } else {
+            info!(
+                "📦 Detected workspace with {} project(s) in {}",
+                workspace.len(),
+                project_dir.display()
+            );
+            for project in &workspace {
+                info!(
+                    "  - {} [{}] - {} board(s)",
+                    project.name(),
+                    project.project_type.name(),
+                    project.boards.len()
+                );
+            }
+        }
+        if !cli.json_output() {
+            println!();
+        }
     }
 
-    let app = App::new(
+    let mut app = App::new(
         project_dir,
         cli.build_strategy.clone(),
         cli.server_url.clone(),
         cli.board_mac.clone(),
         boxed_project_handler,
     )?;
+    app.build_scheduler = BuildScheduler::new(SchedulerSettings::resolve(
+        &app.project_dir,
+        cli.jobs,
+        cli.max_load,
+    ));
+    if !cli.agents.is_empty() {
+        app.agent_pool = AgentPool::resolve(&app.project_dir, &cli.agents)?;
+    }
 
     // Generate support scripts
     info!("🍺 Generating build and flash scripts...");
@@ -117,8 +211,29 @@ async fn main() -> Result<()> {
     info!("📦 Professional multi-board build: ./support/build-all-idf-build-apps.sh");
 
     // Route to appropriate UI mode
-    if cli.cli || cli.command.is_some() {
-        return run_cli_only(app, cli.command).await;
+    if cli_mode || (cli.command.is_some() && !tui_watch && !tui_serve) {
+        return run_cli_only(app, cli.output, cli.command).await;
+    }
+
+    app.theme = Theme::resolve(cli.theme.as_deref())?;
+    app.keymap = Keymap::resolve()?;
+
+    if let Some(Commands::Watch {
+        boards, debounce, ..
+    }) = &cli.command
+    {
+        app.watch_boards = boards.clone();
+        app.watch_debounce = std::time::Duration::from_millis(*debounce);
+        app.watch_on_start = true;
+    }
+
+    if let Some(Commands::Serve { web }) = &cli.command {
+        app.web_dashboard = Some(start_web_dashboard(web)?);
+    }
+
+    if let Some(path) = &cli.record {
+        app.start_recording(path)?;
+        info!("⏺️  Recording the session to {}", path.display());
     }
 
     println!();
@@ -139,15 +254,26 @@ async fn main() -> Result<()> {
 }
 
 // CLI-only mode with actual command implementations
-async fn run_cli_only(app: App, command: Option<Commands>) -> Result<()> {
+async fn run_cli_only(app: App, output: OutputFormat, command: Option<Commands>) -> Result<()> {
     let cli = Cli {
         project_dir: Some(app.project_dir.clone()),
         cli: true,
         verbose: 0,
         quiet: false,
+        plain: espbrew::utils::logging::is_plain_output(),
+        output,
         build_strategy: app.build_strategy.clone(),
+        jobs: Some(app.build_scheduler.settings().jobs),
+        max_load: Some(app.build_scheduler.settings().max_load.unwrap_or(0.0)),
+        agents: app
+            .agent_pool
+            .as_ref()
+            .map(|pool| pool.agents().iter().map(ToString::to_string).collect())
+            .unwrap_or_default(),
         server_url: app.server_url.clone(),
         board_mac: app.board_mac.clone(),
+        record: None,
+        theme: None,
         handle_url: None,
         register_handler: false,
         unregister_handler: false,
@@ -159,11 +285,104 @@ async fn run_cli_only(app: App, command: Option<Commands>) -> Result<()> {
         Some(Commands::List) => {
             info!("📋 CLI List mode not yet implemented");
         }
-        Some(Commands::Boards) => {
+        Some(Commands::Boards { action: None }) => {
             execute_boards_command().await?;
         }
-        Some(Commands::Build { board }) => {
-            execute_build_command(&cli, board.as_deref()).await?;
+        Some(Commands::Boards {
+            action: Some(action),
+        }) => {
+            execute_boards_action(&cli, action).await?;
+        }
+        Some(Commands::Build {
+            board,
+            tags,
+            locked,
+            force,
+            pick,
+            dry_run,
+            json,
+        }) => {
+            let plan = dry_run.then_some(if json || output == OutputFormat::Json {
+                PlanFormat::Json
+            } else {
+                PlanFormat::Text
+            });
+            execute_build_command(
+                &cli,
+                board.as_deref(),
+                tags.as_deref(),
+                locked,
+                force,
+                pick,
+                plan,
+            )
+            .await?;
+        }
+        Some(Commands::Resume { discard }) => {
+            execute_resume_command(&cli, discard).await?;
+        }
+        Some(Commands::Stats { board, limit }) => {
+            execute_stats_command(&cli, board.as_deref(), limit).await?;
+        }
+        Some(Commands::Setup { dry_run, print_env }) => {
+            execute_setup_command(&cli, dry_run, print_env).await?;
+        }
+        Some(Commands::Daemon { once, listen }) => {
+            execute_daemon_command(&cli, once, listen).await?;
+        }
+        Some(Commands::Serve { web }) => {
+            execute_serve_command(&cli, &web).await?;
+        }
+        Some(Commands::Replay { file, speed }) => {
+            execute_replay_command(&cli, &file, speed).await?;
+        }
+        Some(Commands::Watch {
+            boards,
+            tags,
+            debounce,
+            flash,
+            monitor,
+            port,
+            baud_rate,
+        }) => {
+            execute_watch_command(
+                &cli,
+                WatchOptions {
+                    boards,
+                    tags,
+                    debounce,
+                    flash,
+                    monitor,
+                    port,
+                    baud_rate,
+                },
+            )
+            .await?;
+        }
+        Some(Commands::Config { action }) => {
+            execute_config_command(&cli, action).await?;
+        }
+        Some(Commands::New { template, chips }) => {
+            execute_new_command(&cli, template, &chips).await?;
+        }
+        Some(Commands::Ota { action }) => {
+            execute_ota_command(&cli, action).await?;
+        }
+        Some(Commands::Export { action }) => {
+            execute_export_command(&cli, action).await?;
+        }
+        Some(Commands::Logs { action }) => {
+            execute_logs_command(&cli, action).await?;
+        }
+        Some(Commands::Workspace { action }) => {
+            execute_workspace_command(&cli, action).await?;
+        }
+        Some(Commands::Agent {
+            listen,
+            work_dir,
+            token,
+        }) => {
+            execute_agent_command(&listen, work_dir, token).await?;
         }
         Some(Commands::Discover { timeout }) => {
             execute_discover_command(timeout).await?;
@@ -173,8 +392,29 @@ async fn run_cli_only(app: App, command: Option<Commands>) -> Result<()> {
             config,
             port,
             force_rebuild,
+            all_devices,
+            only,
         }) => {
-            execute_flash_command(&cli, binary, config, port, force_rebuild).await?;
+            execute_flash_command(
+                &cli,
+                binary,
+                config,
+                port,
+                force_rebuild,
+                all_devices,
+                &only,
+            )
+            .await?;
+        }
+        Some(Commands::Erase {
+            board,
+            port,
+            region,
+        }) => {
+            execute_erase_command(&cli, board, port, region).await?;
+        }
+        Some(Commands::Device { action }) => {
+            execute_device_command(&cli, action).await?;
         }
         Some(Commands::RemoteFlash {
             binary,
@@ -216,16 +456,23 @@ async fn run_cli_only(app: App, command: Option<Commands>) -> Result<()> {
         }
         Some(Commands::Monitor {
             port,
+            board,
             baud_rate,
             elf,
             log_format,
             reset,
             non_interactive,
             no_addresses,
+            record,
+            jsonl,
             timeout,
             success_pattern,
             failure_pattern,
         }) => {
+            let elf = monitor_elf(&cli, board.as_deref(), elf);
+            let export = jsonl.map(|path| (path, board.clone()));
+            let record = monitor_recording(&cli, board.as_deref(), record);
+            let port = monitor_port(&cli, board, port).await?;
             execute_monitor_command(
                 port,
                 baud_rate,
@@ -237,6 +484,8 @@ async fn run_cli_only(app: App, command: Option<Commands>) -> Result<()> {
                 timeout,
                 success_pattern,
                 failure_pattern,
+                record,
+                export,
             )
             .await?;
         }
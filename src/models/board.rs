@@ -158,10 +158,36 @@ pub struct BoardConfig {
     pub build_dir: PathBuf,
     pub status: crate::models::project::BuildStatus,
     pub log_lines: Vec<String>,
+    /// Counts the times the log was cleared or replaced, so mirrors of it
+    /// know to start over rather than append
+    pub log_resets: u64,
     pub build_time: Option<std::time::Duration>,
     pub last_updated: DateTime<Local>,
     pub target: Option<String>, // ESP32, ESP32-S3, etc.
     pub project_type: crate::models::project::ProjectType,
+    /// Set when the board belongs to a nested project of a monorepo workspace
+    pub workspace: Option<WorkspaceMember>,
+    /// Tags from `espbrew.yaml` plus the target chip, used by the tag filter
+    pub tags: Vec<String>,
+}
+
+impl BoardConfig {
+    /// Replace the log with `lines`, e.g. none to clear it
+    pub fn reset_log(&mut self, lines: Vec<String>) {
+        self.log_lines = lines;
+        self.log_resets += 1;
+    }
+}
+
+/// Location of a board inside a monorepo workspace
+#[derive(Debug, Clone)]
+pub struct WorkspaceMember {
+    /// Project path relative to the workspace root, used as the group label
+    pub project: String,
+    /// Absolute project directory the handler runs in
+    pub project_dir: PathBuf,
+    /// Board name as reported by the project handler
+    pub board_name: String,
 }
 
 /// Remote board representation
@@ -186,11 +212,19 @@ pub enum BoardAction {
     Flash,
     FlashAppOnly,
     Monitor,
+    Debug,
     Clean,
     Purge,
     GenerateBinary,
     RemoteFlash,
     RemoteMonitor,
+    Deploy,
+    EffectiveConfig,
+    DiffConfig,
+    CompareLogs,
+    PartitionTable,
+    EraseFlash,
+    EraseNvs,
 }
 
 impl BoardAction {
@@ -200,11 +234,19 @@ impl BoardAction {
             BoardAction::Flash => "Flash",
             BoardAction::FlashAppOnly => "Flash App Only",
             BoardAction::Monitor => "Monitor",
+            BoardAction::Debug => "Debug",
             BoardAction::Clean => "Clean",
             BoardAction::Purge => "Purge (Delete build dir)",
             BoardAction::GenerateBinary => "Generate Binary",
             BoardAction::RemoteFlash => "Remote Flash",
             BoardAction::RemoteMonitor => "Remote Monitor",
+            BoardAction::Deploy => "Deploy",
+            BoardAction::EffectiveConfig => "Show Effective Config",
+            BoardAction::DiffConfig => "Diff Config",
+            BoardAction::CompareLogs => "Compare Logs",
+            BoardAction::PartitionTable => "Partition Table",
+            BoardAction::EraseFlash => "Erase Flash",
+            BoardAction::EraseNvs => "Erase NVS",
         }
     }
 
@@ -213,16 +255,1090 @@ impl BoardAction {
             BoardAction::Build => "Build the project for this board",
             BoardAction::Flash => "Flash all partitions (bootloader, app, data)",
             BoardAction::FlashAppOnly => "Flash only the application partition (faster)",
-            BoardAction::Monitor => "Flash and start serial monitor",
+            BoardAction::Monitor => "Open the board's device in a serial monitor pane",
+            BoardAction::Debug => {
+                "Start OpenOCD and GDB on the board's ELF, GDB takes over the terminal"
+            }
             BoardAction::Clean => "Clean build files (idf.py clean)",
             BoardAction::Purge => "Force delete build directory",
             BoardAction::GenerateBinary => "Create single binary file for distribution",
             BoardAction::RemoteFlash => "Flash to remote board via ESPBrew server",
             BoardAction::RemoteMonitor => "Monitor remote board via ESPBrew server",
+            BoardAction::Deploy => "Flash MicroPython firmware and sync the Python tree",
+            BoardAction::EffectiveConfig => {
+                "List the merged sdkconfig options and their source files"
+            }
+            BoardAction::DiffConfig => {
+                "Mark this board, then compare its sdkconfig with another board"
+            }
+            BoardAction::CompareLogs => {
+                "Mark this board, then show its log side by side with another board's"
+            }
+            BoardAction::PartitionTable => {
+                "Show the board's partition offsets and sizes and check them against its flash"
+            }
+            BoardAction::EraseFlash => "Erase the whole flash of the board's device",
+            BoardAction::EraseNvs => "Erase only the NVS partition of the board's partition table",
+        }
+    }
+}
+
+/// Part of the boards × profiles matrix to build
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum MatrixSelection {
+    /// The board and profile under the cursor
+    Cell,
+    /// The board under the cursor with every profile
+    Row,
+    /// The profile under the cursor for every board
+    Column,
+}
+
+/// A board action running in the background of the TUI
+#[derive(Debug)]
+pub struct RunningAction {
+    pub action: BoardAction,
+    /// Process groups started by the action
+    pub job: crate::utils::process_group::BoardJob,
+    pub task: tokio::task::JoinHandle<()>,
+}
+
+/// Build or flash a board of the TUI's list is busy with, for its progress
+#[derive(Debug, Clone)]
+pub struct BoardActivity {
+    /// Building or flashing, `None` while idle or waiting for a build slot
+    pub running: Option<crate::models::project::BuildStatus>,
+    /// Since when the board is running or idle
+    pub since: std::time::Instant,
+}
+
+impl BoardActivity {
+    pub fn new(now: std::time::Instant) -> Self {
+        Self {
+            running: None,
+            since: now,
+        }
+    }
+
+    /// Track the board's status seen at `now`; how long the build or flash
+    /// took when it just ended
+    pub fn observe(
+        &mut self,
+        status: &crate::models::project::BuildStatus,
+        queued: bool,
+        now: std::time::Instant,
+    ) -> Option<std::time::Duration> {
+        use crate::models::project::BuildStatus;
+        let running = (!queued && matches!(status, BuildStatus::Building | BuildStatus::Flashing))
+            .then(|| status.clone());
+        let unchanged = match (&self.running, &running) {
+            (Some(was), Some(is)) => std::mem::discriminant(was) == std::mem::discriminant(is),
+            (None, None) => true,
+            _ => false,
+        };
+        if unchanged {
+            return None;
+        }
+        let took = self
+            .running
+            .is_some()
+            .then(|| now.duration_since(self.since));
+        self.running = running;
+        self.since = now;
+        took
+    }
+
+    /// How long the board has been building or flashing
+    pub fn elapsed(&self, now: std::time::Instant) -> Option<std::time::Duration> {
+        self.running
+            .as_ref()
+            .map(|_| now.duration_since(self.since))
+    }
+}
+
+/// Two boards' logs side by side, opened with 'L'
+#[derive(Debug, Clone)]
+pub struct LogComparison {
+    pub left: String,
+    pub right: String,
+    pub rows: Vec<crate::projects::log_diff::DiffRow>,
+    /// Lengths of the logs the rows were aligned from
+    pub lengths: (usize, usize),
+    /// First row shown
+    pub scroll: usize,
+    /// Whether only the rows that differ are shown
+    pub differences_only: bool,
+}
+
+impl LogComparison {
+    /// Rows shown, all or only the differing ones
+    pub fn visible_rows(&self) -> Vec<crate::projects::log_diff::DiffRow> {
+        use crate::projects::log_diff::DiffKind;
+        self.rows
+            .iter()
+            .filter(|row| !self.differences_only || row.kind != DiffKind::Same)
+            .copied()
+            .collect()
+    }
+}
+
+/// Quick filter of the TUI's board list, on top of its tag filter
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum BoardListFilter {
+    /// Boards whose last build or flash failed
+    Failed,
+    /// Boards building, flashing or waiting for a build slot
+    Building,
+    /// Boards whose name contains the text, ignoring case
+    Name(String),
+}
+
+impl BoardListFilter {
+    /// The status filter 'F' switches to from this one: failed, building,
+    /// then none
+    pub fn next_status(filter: Option<&BoardListFilter>) -> Option<BoardListFilter> {
+        match filter {
+            Some(BoardListFilter::Failed) => Some(BoardListFilter::Building),
+            Some(BoardListFilter::Building) => None,
+            _ => Some(BoardListFilter::Failed),
+        }
+    }
+
+    pub fn matches(&self, board: &BoardConfig, queued: bool) -> bool {
+        use crate::models::project::BuildStatus;
+        match self {
+            BoardListFilter::Failed => matches!(board.status, BuildStatus::Failed),
+            BoardListFilter::Building => {
+                queued || matches!(board.status, BuildStatus::Building | BuildStatus::Flashing)
+            }
+            BoardListFilter::Name(text) => board.name.to_lowercase().contains(&text.to_lowercase()),
+        }
+    }
+}
+
+impl std::fmt::Display for BoardListFilter {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            BoardListFilter::Failed => write!(f, "failed"),
+            BoardListFilter::Building => write!(f, "building"),
+            BoardListFilter::Name(text) => write!(f, "\"{}\"", text),
+        }
+    }
+}
+
+/// Connected devices flashed at once from the TUI
+#[derive(Debug, Clone, Default)]
+pub struct DeviceFlashRun {
+    /// Still identifying the devices on the serial ports
+    pub probing: bool,
+    pub devices: Vec<DeviceFlash>,
+    /// Ports left alone, with the reason
+    pub skipped: Vec<(String, String)>,
+}
+
+impl DeviceFlashRun {
+    pub fn is_running(&self) -> bool {
+        self.probing
+            || self.devices.iter().any(|device| {
+                matches!(device.status, crate::models::project::BuildStatus::Flashing)
+            })
+    }
+}
+
+/// One device of a [`DeviceFlashRun`]
+#[derive(Debug, Clone)]
+pub struct DeviceFlash {
+    /// Board configuration and port, e.g. `esp32s3_devkit@/dev/ttyUSB0`
+    pub label: String,
+    /// Hardware the device reported
+    pub hardware: String,
+    pub progress: u8,
+    pub status: crate::models::project::BuildStatus,
+    pub last_line: String,
+    /// The flash was read back and matches the images
+    pub verified: bool,
+}
+
+/// Where a device of an OTA rollout is at
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum OtaStatus {
+    Pending,
+    /// The app binary is being POSTed to the device
+    Uploading,
+    /// The device was told to download its image and hasn't started yet
+    Triggered,
+    /// The device is downloading its image, percent sent
+    Downloading(u8),
+    /// The device received its image
+    Done,
+    Failed(String),
+}
+
+impl OtaStatus {
+    pub fn is_finished(&self) -> bool {
+        matches!(self, OtaStatus::Done | OtaStatus::Failed(_))
+    }
+
+    pub fn progress(&self) -> u8 {
+        match self {
+            OtaStatus::Downloading(percent) => *percent,
+            OtaStatus::Done => 100,
+            _ => 0,
+        }
+    }
+
+    pub fn describe(&self) -> String {
+        match self {
+            OtaStatus::Pending => "⏳ pending".to_string(),
+            OtaStatus::Uploading => "📤 uploading".to_string(),
+            OtaStatus::Triggered => "📣 triggered, waiting for the download".to_string(),
+            OtaStatus::Downloading(percent) => format!("📥 downloading {}%", percent),
+            OtaStatus::Done => "✅ image received".to_string(),
+            OtaStatus::Failed(reason) => format!("❌ {}", reason),
+        }
+    }
+}
+
+/// OTA rollout started from the TUI, one entry per device
+#[derive(Debug, Clone, Default)]
+pub struct OtaRollout {
+    /// Whether the devices and their images are still being looked up
+    pub preparing: bool,
+    pub devices: Vec<(String, OtaStatus)>,
+    /// Why the rollout couldn't start, e.g. no `ota:` devices
+    pub error: Option<String>,
+}
+
+impl OtaRollout {
+    pub fn is_running(&self) -> bool {
+        self.preparing || self.devices.iter().any(|(_, status)| !status.is_finished())
+    }
+}
+
+/// Lines kept per serial monitor pane
+pub const MONITOR_SCROLLBACK: usize = 5000;
+/// Output without a line end is shown once this long
+const MONITOR_MAX_LINE: usize = 4096;
+/// Frames decoded this soon after the previous ones belong to the same crash
+const BACKTRACE_WINDOW: std::time::Duration = std::time::Duration::from_secs(2);
+
+/// How the serial monitor view shows its panes
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum MonitorLayout {
+    /// One pane at a time, a tab per device
+    #[default]
+    Tabs,
+    /// All panes side by side
+    Tiled,
+    /// The output of all panes interleaved, each line prefixed with its device
+    Merged,
+}
+
+impl MonitorLayout {
+    pub fn next(self) -> Self {
+        match self {
+            MonitorLayout::Tabs => MonitorLayout::Tiled,
+            MonitorLayout::Tiled => MonitorLayout::Merged,
+            MonitorLayout::Merged => MonitorLayout::Tabs,
+        }
+    }
+
+    pub fn name(&self) -> &'static str {
+        match self {
+            MonitorLayout::Tabs => "tabs",
+            MonitorLayout::Tiled => "tiled",
+            MonitorLayout::Merged => "merged",
         }
     }
 }
 
+/// Rows and columns of the tiled layout for `count` panes, as square as
+/// possible with the extra column first
+pub fn tile_grid(count: usize) -> (usize, usize) {
+    if count == 0 {
+        return (0, 0);
+    }
+    let mut columns = 1;
+    while columns * columns < count {
+        columns += 1;
+    }
+    (count.div_ceil(columns), columns)
+}
+
+/// Line of the merged view: the pane's title, then its line
+pub fn merged_line(title: &str, line: &str) -> String {
+    format!("[{}] {}", title, line)
+}
+
+/// Title of the pane a line of the merged view came from
+pub fn merged_source(line: &str) -> Option<&str> {
+    line.strip_prefix('[')?
+        .split_once("] ")
+        .map(|(title, _)| title)
+}
+
+/// Severity of an ESP-IDF log line, most severe first
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord)]
+pub enum IdfLogLevel {
+    Error,
+    Warning,
+    Info,
+    Debug,
+    Verbose,
+}
+
+impl IdfLogLevel {
+    fn from_letter(letter: char) -> Option<Self> {
+        match letter {
+            'E' => Some(IdfLogLevel::Error),
+            'W' => Some(IdfLogLevel::Warning),
+            'I' => Some(IdfLogLevel::Info),
+            'D' => Some(IdfLogLevel::Debug),
+            'V' => Some(IdfLogLevel::Verbose),
+            _ => None,
+        }
+    }
+}
+
+/// Level and tag of an ESP-IDF log line, e.g. `W (1234) wifi: ...`
+pub fn idf_log_line(line: &str) -> Option<(IdfLogLevel, &str)> {
+    let level = IdfLogLevel::from_letter(line.chars().next()?)?;
+    let (_, rest) = line[1..].strip_prefix(" (")?.split_once(") ")?;
+    let (tag, _) = rest.split_once(':')?;
+    (!tag.is_empty() && !tag.contains(' ')).then_some((level, tag))
+}
+
+/// Log levels the serial monitor view shows, switched with `L`
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum MonitorLevel {
+    #[default]
+    All,
+    /// Warnings and errors
+    Warnings,
+    Errors,
+}
+
+impl MonitorLevel {
+    pub fn next(self) -> Self {
+        match self {
+            MonitorLevel::All => MonitorLevel::Warnings,
+            MonitorLevel::Warnings => MonitorLevel::Errors,
+            MonitorLevel::Errors => MonitorLevel::All,
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            MonitorLevel::All => "all levels",
+            MonitorLevel::Warnings => "W/E only",
+            MonitorLevel::Errors => "E only",
+        }
+    }
+
+    /// `warning` or `error` of `espbrew.yaml`'s `monitor:` section
+    pub fn parse(level: &str) -> Option<Self> {
+        match level.to_lowercase().as_str() {
+            "all" => Some(MonitorLevel::All),
+            "w" | "warn" | "warning" | "warnings" => Some(MonitorLevel::Warnings),
+            "e" | "error" | "errors" => Some(MonitorLevel::Errors),
+            _ => None,
+        }
+    }
+
+    fn shows(self, level: IdfLogLevel) -> bool {
+        match self {
+            MonitorLevel::All => true,
+            MonitorLevel::Warnings => level <= IdfLogLevel::Warning,
+            MonitorLevel::Errors => level == IdfLogLevel::Error,
+        }
+    }
+}
+
+/// Lines matching the regex are colored
+#[derive(Debug, Clone)]
+pub struct HighlightRule {
+    pub pattern: String,
+    pub regex: regex::Regex,
+}
+
+impl HighlightRule {
+    pub fn new(pattern: &str) -> Result<Self, regex::Error> {
+        Ok(Self {
+            pattern: pattern.to_string(),
+            regex: regex::Regex::new(pattern)?,
+        })
+    }
+}
+
+/// Filters and highlight rules of the serial monitor view, applied to what
+/// is shown so changing them takes effect on the scrollback as well
+#[derive(Debug, Clone)]
+pub struct MonitorFilter {
+    pub level: MonitorLevel,
+    /// ESP-IDF log tags shown, all when empty
+    pub tags: Vec<String>,
+    pub highlights: Vec<HighlightRule>,
+    /// Whether the highlight rules are applied, toggled with `H`
+    pub highlighting: bool,
+}
+
+impl Default for MonitorFilter {
+    fn default() -> Self {
+        Self {
+            level: MonitorLevel::All,
+            tags: Vec::new(),
+            highlights: Vec::new(),
+            highlighting: true,
+        }
+    }
+}
+
+impl MonitorFilter {
+    /// Whether the line is shown; output that isn't an ESP-IDF log line,
+    /// e.g. a panic or `printf`, always is. Lines of the merged view are
+    /// filtered without their device prefix.
+    pub fn shows(&self, line: &str) -> bool {
+        let log_line = idf_log_line(line).or_else(|| {
+            merged_source(line)?;
+            idf_log_line(line.split_once("] ")?.1)
+        });
+        let Some((level, tag)) = log_line else {
+            return true;
+        };
+        self.level.shows(level)
+            && (self.tags.is_empty() || self.tags.iter().any(|t| t.eq_ignore_ascii_case(tag)))
+    }
+
+    /// Index of the first highlight rule matching the line
+    pub fn highlight(&self, line: &str) -> Option<usize> {
+        if !self.highlighting {
+            return None;
+        }
+        self.highlights
+            .iter()
+            .position(|rule| rule.regex.is_match(line))
+    }
+
+    pub fn is_filtering(&self) -> bool {
+        self.level != MonitorLevel::All || !self.tags.is_empty()
+    }
+
+    /// Summary for the status line, e.g. `W/E only, tags wifi,heap`
+    pub fn describe(&self) -> String {
+        let mut parts = vec![self.level.name().to_string()];
+        if !self.tags.is_empty() {
+            parts.push(format!("tags {}", self.tags.join(",")));
+        }
+        if !self.highlights.is_empty() {
+            parts.push(format!(
+                "{} highlight{}{}",
+                self.highlights.len(),
+                if self.highlights.len() == 1 { "" } else { "s" },
+                if self.highlighting { "" } else { " off" }
+            ));
+        }
+        parts.join(", ")
+    }
+}
+
+/// Tags typed in the monitor view, separated by commas or spaces
+pub fn parse_tags(input: &str) -> Vec<String> {
+    input
+        .split([',', ' '])
+        .map(str::trim)
+        .filter(|tag| !tag.is_empty())
+        .map(str::to_string)
+        .collect()
+}
+
+/// Prompt of the serial monitor view being edited
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum MonitorInput {
+    /// Tags to show, `T`
+    Tags,
+    /// Regex of a new highlight rule, `/`
+    Highlight,
+    /// Line sent to the selected pane's device console, `i`
+    Console,
+    /// Name of the console script run against the selected pane's device, `E`
+    Script,
+}
+
+/// Line ending appended to the lines sent to a device's console
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum LineEnding {
+    /// `\r\n`, like `idf.py monitor`
+    #[default]
+    CrLf,
+    Lf,
+    /// `\r`, the Enter of a MicroPython REPL
+    Cr,
+    None,
+}
+
+impl LineEnding {
+    pub fn next(self) -> Self {
+        match self {
+            LineEnding::CrLf => LineEnding::Lf,
+            LineEnding::Lf => LineEnding::Cr,
+            LineEnding::Cr => LineEnding::None,
+            LineEnding::None => LineEnding::CrLf,
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            LineEnding::CrLf => "CRLF",
+            LineEnding::Lf => "LF",
+            LineEnding::Cr => "CR",
+            LineEnding::None => "none",
+        }
+    }
+
+    /// `crlf`, `lf`, `cr` or `none` of `espbrew.yaml`'s `monitor:` section
+    pub fn parse(ending: &str) -> Option<Self> {
+        match ending.to_lowercase().as_str() {
+            "crlf" | "\r\n" => Some(LineEnding::CrLf),
+            "lf" | "\n" => Some(LineEnding::Lf),
+            "cr" | "\r" => Some(LineEnding::Cr),
+            "none" => Some(LineEnding::None),
+            _ => None,
+        }
+    }
+
+    pub fn bytes(self) -> &'static [u8] {
+        match self {
+            LineEnding::CrLf => b"\r\n",
+            LineEnding::Lf => b"\n",
+            LineEnding::Cr => b"\r",
+            LineEnding::None => b"",
+        }
+    }
+
+    /// The line as sent to the device
+    pub fn terminate(self, line: &str) -> Vec<u8> {
+        [line.as_bytes(), self.bytes()].concat()
+    }
+}
+
+/// Lines kept in the console input's history
+pub const INPUT_HISTORY_LINES: usize = 100;
+
+/// Lines sent to the devices' consoles, recalled with ↑↓ like in a shell
+#[derive(Debug, Clone, Default)]
+pub struct InputHistory {
+    /// Oldest first
+    lines: std::collections::VecDeque<String>,
+    /// Line recalled, `None` while typing a new one
+    recalled: Option<usize>,
+}
+
+impl InputHistory {
+    /// Add a sent line, unless it is empty or the last one again
+    pub fn push(&mut self, line: &str) {
+        self.recalled = None;
+        if line.trim().is_empty() || self.lines.back().is_some_and(|last| last == line) {
+            return;
+        }
+        if self.lines.len() == INPUT_HISTORY_LINES {
+            self.lines.pop_front();
+        }
+        self.lines.push_back(line.to_string());
+    }
+
+    pub fn lines(&self) -> &std::collections::VecDeque<String> {
+        &self.lines
+    }
+
+    /// The line before the one recalled, the newest one at first
+    pub fn previous(&mut self) -> Option<&str> {
+        let index = match self.recalled {
+            _ if self.lines.is_empty() => return None,
+            None => self.lines.len() - 1,
+            Some(index) => index.saturating_sub(1),
+        };
+        self.recalled = Some(index);
+        self.lines.get(index).map(String::as_str)
+    }
+
+    /// The line after the one recalled; `None` past the newest one, back to
+    /// a new line
+    pub fn next(&mut self) -> Option<&str> {
+        let index = self.recalled? + 1;
+        if index >= self.lines.len() {
+            self.recalled = None;
+            return None;
+        }
+        self.recalled = Some(index);
+        self.lines.get(index).map(String::as_str)
+    }
+
+    /// Typing starts on a new line
+    pub fn reset(&mut self) {
+        self.recalled = None;
+    }
+}
+
+/// Points kept per plotted series
+pub const PLOT_POINTS: usize = 600;
+
+fn plot_convention_regex() -> &'static regex::Regex {
+    static REGEX: std::sync::OnceLock<regex::Regex> = std::sync::OnceLock::new();
+    REGEX.get_or_init(|| {
+        regex::Regex::new(r">>([A-Za-z_][\w.]*):\s*(-?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?)").unwrap()
+    })
+}
+
+/// Values of a line to plot, read by the regex's capture groups; named groups
+/// name their series, an unnamed one is named by the pattern
+#[derive(Debug, Clone)]
+pub struct PlotRule {
+    pub pattern: String,
+    pub regex: regex::Regex,
+}
+
+impl PlotRule {
+    pub fn new(pattern: &str) -> Result<Self, regex::Error> {
+        Ok(Self {
+            pattern: pattern.to_string(),
+            regex: regex::Regex::new(pattern)?,
+        })
+    }
+
+    fn values(&self, line: &str, values: &mut Vec<(String, f64)>) {
+        let Some(captures) = self.regex.captures(line) else {
+            return;
+        };
+        let groups = self.regex.captures_len() - 1;
+        for (index, name) in self.regex.capture_names().enumerate().skip(1) {
+            let Some(value) = captures
+                .get(index)
+                .and_then(|value| value.as_str().trim().parse::<f64>().ok())
+            else {
+                continue;
+            };
+            let name = match name {
+                Some(name) => name.to_string(),
+                None if groups == 1 => self.pattern.clone(),
+                None => format!("{}#{}", self.pattern, index),
+            };
+            values.push((name, value));
+        }
+    }
+}
+
+/// Values to plot of a monitor line: `>>name:value` anywhere in it, e.g.
+/// `>>temp:21.5 >>hum:40`, and those the rules read
+pub fn plot_values(line: &str, rules: &[PlotRule]) -> Vec<(String, f64)> {
+    let mut values: Vec<(String, f64)> = plot_convention_regex()
+        .captures_iter(line)
+        .filter_map(|capture| Some((capture[1].to_string(), capture[2].parse().ok()?)))
+        .collect();
+    for rule in rules {
+        rule.values(line, &mut values);
+    }
+    values
+}
+
+/// Values of one series over the seconds since the pane's plot started
+#[derive(Debug, Clone, Default)]
+pub struct PlotSeries {
+    pub name: String,
+    pub points: std::collections::VecDeque<(f64, f64)>,
+}
+
+/// Numeric telemetry of a pane, shown as line charts with `g`
+#[derive(Debug, Clone, Default)]
+pub struct Plotter {
+    pub series: Vec<PlotSeries>,
+    started: Option<std::time::Instant>,
+}
+
+impl Plotter {
+    /// Add a value received now
+    pub fn push(&mut self, name: &str, value: f64) {
+        let started = *self.started.get_or_insert_with(std::time::Instant::now);
+        self.push_at(name, started.elapsed().as_secs_f64(), value);
+    }
+
+    pub fn push_at(&mut self, name: &str, seconds: f64, value: f64) {
+        if !value.is_finite() {
+            return;
+        }
+        let index = match self.series.iter().position(|series| series.name == name) {
+            Some(index) => index,
+            None => {
+                self.series.push(PlotSeries {
+                    name: name.to_string(),
+                    points: Default::default(),
+                });
+                self.series.len() - 1
+            }
+        };
+        let points = &mut self.series[index].points;
+        if points.len() >= PLOT_POINTS {
+            points.pop_front();
+        }
+        points.push_back((seconds, value));
+    }
+
+    pub fn clear(&mut self) {
+        self.series.clear();
+        self.started = None;
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.series.is_empty()
+    }
+
+    /// Seconds spanned by the kept points
+    pub fn x_bounds(&self) -> [f64; 2] {
+        let points = || self.series.iter().flat_map(|series| series.points.iter());
+        let start = points().map(|(x, _)| *x).fold(f64::INFINITY, f64::min);
+        let end = points().map(|(x, _)| *x).fold(f64::NEG_INFINITY, f64::max);
+        if !start.is_finite() {
+            return [0.0, 1.0];
+        }
+        [start, end.max(start + 1.0)]
+    }
+
+    /// Range of the kept values with a margin, so a flat line is visible
+    pub fn y_bounds(&self) -> [f64; 2] {
+        let values = || {
+            self.series
+                .iter()
+                .flat_map(|series| series.points.iter().map(|(_, y)| *y))
+        };
+        let low = values().fold(f64::INFINITY, f64::min);
+        let high = values().fold(f64::NEG_INFINITY, f64::max);
+        if !low.is_finite() {
+            return [0.0, 1.0];
+        }
+        let margin = ((high - low) * 0.05).max(if high == low { 1.0 } else { 0.0 });
+        [low - margin, high + margin]
+    }
+}
+
+/// Whether a serial monitor pane reads its port
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum MonitorState {
+    Connected,
+    /// The port is released while the named boards, or the device flash, use it
+    Suspended(Vec<String>),
+    /// The device's port went away, e.g. on a reset, and the reader waits
+    /// for it to come back
+    Reconnecting,
+    /// The reader stopped, with the error if it failed
+    Closed(Option<String>),
+}
+
+/// Serial monitor pane of a device in the TUI
+#[derive(Debug, Clone)]
+pub struct SerialMonitor {
+    pub port: String,
+    /// Board whose device is on the port, if known
+    pub board: Option<String>,
+    pub state: MonitorState,
+    pub lines: std::collections::VecDeque<String>,
+    /// Output of the line not ended yet
+    pub partial: Vec<u8>,
+    /// New lines are held back instead of scrolling the pane
+    pub paused: bool,
+    /// Lines received while paused
+    pub held: std::collections::VecDeque<String>,
+    /// Lines scrolled back from the newest one
+    pub scroll_offset: usize,
+    /// Reader the pane takes output from; output of readers stopped before is dropped
+    pub reader: u64,
+    /// Set to stop the reader
+    pub stop: std::sync::Arc<std::sync::atomic::AtomicBool>,
+    /// Lines with code addresses are sent here to be decoded, when the
+    /// board's ELF is known
+    pub backtraces: Option<tokio::sync::mpsc::UnboundedSender<String>>,
+    /// Lines of the last crash with their decoded frames, for copying
+    pub backtrace: Vec<String>,
+    pub backtrace_at: Option<std::time::Instant>,
+    /// Base64 lines of a core dump being printed
+    pub core_dump: Option<Vec<String>>,
+    /// Numeric telemetry the device printed
+    pub plot: Plotter,
+    /// Splitter of the output's defmt frames and where they are sent to be
+    /// decoded, for firmware logging with defmt
+    pub defmt: Option<(
+        crate::utils::defmt::DefmtSplitter,
+        tokio::sync::mpsc::UnboundedSender<Vec<u8>>,
+    )>,
+    /// What is sent here is written to the device while the reader runs
+    pub console: Option<tokio::sync::mpsc::UnboundedSender<Vec<u8>>>,
+    /// Lines received and triggers fired since the pane opened
+    pub session: crate::projects::monitor_triggers::MonitorSession,
+    /// Resets and panics of the device, telling whether it is crash-looping
+    pub resets: crate::projects::crash_loop::ResetTracker,
+    /// Console script running against the device
+    pub script: Option<crate::projects::console_script::ScriptRun>,
+    /// Free heap and stack watermarks the device reported
+    pub memory: crate::projects::memory_watch::MemoryWatch,
+}
+
+impl SerialMonitor {
+    pub fn new(port: &str, board: Option<String>) -> Self {
+        Self {
+            port: port.to_string(),
+            board,
+            state: MonitorState::Closed(None),
+            lines: Default::default(),
+            partial: Vec::new(),
+            paused: false,
+            held: Default::default(),
+            scroll_offset: 0,
+            reader: 0,
+            stop: Default::default(),
+            backtraces: None,
+            backtrace: Vec::new(),
+            backtrace_at: None,
+            core_dump: None,
+            plot: Plotter::default(),
+            defmt: None,
+            console: None,
+            session: Default::default(),
+            resets: Default::default(),
+            script: None,
+            memory: Default::default(),
+        }
+    }
+
+    /// `board@port`, or the port of an unknown device
+    pub fn title(&self) -> String {
+        match &self.board {
+            Some(board) => format!("{}@{}", board, self.port),
+            None => self.port.clone(),
+        }
+    }
+
+    /// Write to the device while its port is open, whether it was
+    pub fn send_console(&self, data: Vec<u8>) -> bool {
+        self.state == MonitorState::Connected
+            && self
+                .console
+                .as_ref()
+                .is_some_and(|console| console.send(data).is_ok())
+    }
+
+    /// Output read from the port; each complete line is added without its
+    /// line end and terminal colors. Returns the lines added.
+    pub fn push_output(&mut self, data: &[u8]) -> Vec<String> {
+        self.partial.extend_from_slice(data);
+        let mut lines = Vec::new();
+        while let Some(end) = self.partial.iter().position(|byte| *byte == b'\n') {
+            let line: Vec<u8> = self.partial.drain(..=end).collect();
+            let text = String::from_utf8_lossy(&line[..end]);
+            lines.push(strip_ansi(text.trim_end_matches('\r')));
+        }
+        if self.partial.len() >= MONITOR_MAX_LINE {
+            let line = std::mem::take(&mut self.partial);
+            lines.push(strip_ansi(&String::from_utf8_lossy(&line)));
+        }
+        for line in &lines {
+            self.push_line(line.clone());
+        }
+        lines
+    }
+
+    pub fn push_line(&mut self, line: String) {
+        if self.paused {
+            push_capped(&mut self.held, line);
+            return;
+        }
+        push_capped(&mut self.lines, line);
+        // A pane scrolled back keeps showing the same lines
+        if self.scroll_offset > 0 {
+            self.scroll_offset = (self.scroll_offset + 1).min(self.lines.len().saturating_sub(1));
+        }
+    }
+
+    /// Frames decoded from `line`, shown after it and kept with the frames of
+    /// the same crash for copying. Returns the lines added.
+    pub fn push_frames(&mut self, line: &str, frames: &[String]) -> Vec<String> {
+        let now = std::time::Instant::now();
+        if !self
+            .backtrace_at
+            .is_some_and(|at| now.duration_since(at) < BACKTRACE_WINDOW)
+        {
+            self.backtrace.clear();
+        }
+        self.backtrace_at = Some(now);
+        self.backtrace.push(line.to_string());
+        let lines: Vec<String> = frames
+            .iter()
+            .map(|frame| crate::utils::backtrace::frame_line(frame))
+            .collect();
+        self.backtrace.extend(lines.iter().cloned());
+        for frame_line in &lines {
+            self.push_line(frame_line.clone());
+        }
+        lines
+    }
+
+    /// Pause or resume; resuming adds the lines held back meanwhile
+    pub fn toggle_pause(&mut self) {
+        self.paused = !self.paused;
+        if !self.paused {
+            for line in std::mem::take(&mut self.held) {
+                self.push_line(line);
+            }
+        }
+    }
+
+    pub fn clear(&mut self) {
+        self.lines.clear();
+        self.held.clear();
+        self.partial.clear();
+        self.scroll_offset = 0;
+        self.plot.clear();
+        self.memory.clear();
+    }
+
+    pub fn scroll_up(&mut self, lines: usize) {
+        self.scroll_offset = (self.scroll_offset + lines).min(self.lines.len().saturating_sub(1));
+    }
+
+    pub fn scroll_down(&mut self, lines: usize) {
+        self.scroll_offset = self.scroll_offset.saturating_sub(lines);
+    }
+
+    /// The `height` lines ending `scroll_offset` lines before the newest one
+    pub fn visible_lines(&self, height: usize) -> Vec<&str> {
+        let end = self.lines.len().saturating_sub(self.scroll_offset);
+        let start = end.saturating_sub(height);
+        self.lines.range(start..end).map(String::as_str).collect()
+    }
+
+    /// Like [`Self::visible_lines`], of the lines the filter shows; scrolling
+    /// goes back through those
+    pub fn filtered_lines(&self, height: usize, filter: &MonitorFilter) -> Vec<&str> {
+        if !filter.is_filtering() {
+            return self.visible_lines(height);
+        }
+        let shown: Vec<&str> = self
+            .lines
+            .iter()
+            .map(String::as_str)
+            .filter(|line| filter.shows(line))
+            .collect();
+        let end = shown.len().saturating_sub(self.scroll_offset);
+        let start = end.saturating_sub(height);
+        shown[start..end].to_vec()
+    }
+
+    /// Release the port for `holder`; whether the reader has to be stopped
+    pub fn suspend(&mut self, holder: &str) -> bool {
+        match &mut self.state {
+            MonitorState::Connected | MonitorState::Reconnecting => {
+                self.state = MonitorState::Suspended(vec![holder.to_string()]);
+                self.push_line(format!("⏸️  Port released for {}", holder));
+                true
+            }
+            MonitorState::Suspended(holders) => {
+                if !holders.iter().any(|h| h == holder) {
+                    holders.push(holder.to_string());
+                }
+                false
+            }
+            MonitorState::Closed(_) => false,
+        }
+    }
+
+    /// `holder` is done with the port; whether the pane can read it again
+    pub fn release(&mut self, holder: &str) -> bool {
+        let MonitorState::Suspended(holders) = &mut self.state else {
+            return false;
+        };
+        holders.retain(|h| h != holder);
+        holders.is_empty()
+    }
+}
+
+fn push_capped(lines: &mut std::collections::VecDeque<String>, line: String) {
+    if lines.len() >= MONITOR_SCROLLBACK {
+        lines.pop_front();
+    }
+    lines.push_back(line);
+}
+
+/// `line` without ANSI escape sequences, e.g. the colors of ESP-IDF's log
+pub fn strip_ansi(line: &str) -> String {
+    let mut stripped = String::with_capacity(line.len());
+    let mut chars = line.chars().peekable();
+    while let Some(c) = chars.next() {
+        if c != '\x1b' {
+            stripped.push(c);
+            continue;
+        }
+        if chars.peek() == Some(&'[') {
+            chars.next();
+            // Parameters up to the final byte of the sequence
+            for c in chars.by_ref() {
+                if ('@'..='~').contains(&c) {
+                    break;
+                }
+            }
+        }
+    }
+    stripped
+}
+
+/// Crash report decoded from a core dump a device printed or saved to its flash
+#[derive(Debug, Clone)]
+pub struct CoreDumpReport {
+    pub port: String,
+    pub board: Option<String>,
+    pub captured: DateTime<Local>,
+    /// Read from the device's flash rather than printed to the monitor
+    pub from_flash: bool,
+    pub elf: Option<PathBuf>,
+    /// espcoredump's report, or why the dump couldn't be decoded
+    pub report: Result<String, String>,
+    /// The dump as printed, kept to decode it again
+    pub dump_file: Option<PathBuf>,
+    /// Where the report was saved, or why it couldn't be
+    pub saved: Option<Result<PathBuf, String>>,
+    /// Report lines scrolled down from the top
+    pub scroll_offset: usize,
+}
+
+impl CoreDumpReport {
+    /// `board@port`, or the port of an unknown device
+    pub fn title(&self) -> String {
+        match &self.board {
+            Some(board) => format!("{}@{}", board, self.port),
+            None => self.port.clone(),
+        }
+    }
+
+    /// The report headed by where it comes from, as saved for bug reports
+    pub fn text(&self) -> String {
+        let mut text = format!(
+            "Core dump of {} captured {} from {}\n",
+            self.title(),
+            self.captured.format("%Y-%m-%d %H:%M:%S"),
+            if self.from_flash { "flash" } else { "UART" }
+        );
+        if let Some(elf) = &self.elf {
+            text.push_str(&format!("ELF: {}\n", elf.display()));
+        }
+        if let Some(dump_file) = &self.dump_file {
+            text.push_str(&format!("Dump: {}\n", dump_file.display()));
+        }
+        text.push('\n');
+        match &self.report {
+            Ok(report) => text.push_str(report),
+            Err(error) => text.push_str(&format!("Not decoded: {}\n", error)),
+        }
+        text
+    }
+}
+
 /// Board reset request
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct ResetRequest {
@@ -236,3 +1352,319 @@ pub struct ResetResponse {
     pub success: bool,
     pub message: String,
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::ProjectConfig;
+    use crate::models::project::BuildStatus;
+    use std::time::{Duration, Instant};
+
+    #[test]
+    fn test_serial_monitor_pane() {
+        assert_eq!(
+            strip_ansi("\x1b[0;32mI (312) main: ready\x1b[0m"),
+            "I (312) main: ready"
+        );
+
+        let mut monitor = SerialMonitor::new("/dev/ttyUSB0", Some("esp32s3_box".to_string()));
+        assert_eq!(monitor.title(), "esp32s3_box@/dev/ttyUSB0");
+        // Lines split across reads, with CRLF line ends and colors
+        monitor.push_output(b"\x1b[0;32mI (1) boot: he");
+        assert!(monitor.lines.is_empty());
+        monitor.push_output(b"llo\x1b[0m\r\nsecond\nthi");
+        assert_eq!(monitor.lines, ["I (1) boot: hello", "second"]);
+        assert_eq!(monitor.partial, b"thi");
+
+        // A paused pane holds new lines back until resumed
+        monitor.toggle_pause();
+        monitor.push_output(b"rd\n");
+        assert_eq!(monitor.lines.len(), 2);
+        assert_eq!(monitor.held, ["third"]);
+        monitor.toggle_pause();
+        assert_eq!(monitor.visible_lines(2), ["second", "third"]);
+        assert!(monitor.held.is_empty());
+
+        // Scrolled back, the view stays on the same lines as output arrives
+        monitor.scroll_up(1);
+        assert_eq!(monitor.visible_lines(1), ["second"]);
+        monitor.push_line("fourth".to_string());
+        assert_eq!(monitor.visible_lines(1), ["second"]);
+        monitor.scroll_down(10);
+        assert_eq!(monitor.visible_lines(1), ["fourth"]);
+
+        monitor.clear();
+        for i in 0..MONITOR_SCROLLBACK + 10 {
+            monitor.push_line(i.to_string());
+        }
+        assert_eq!(monitor.lines.len(), MONITOR_SCROLLBACK);
+        assert_eq!(monitor.lines.front().map(String::as_str), Some("10"));
+
+        // Flashes of two boards hold the port until both are done
+        monitor.state = MonitorState::Connected;
+        assert!(monitor.suspend("esp32s3_box"));
+        assert!(!monitor.suspend("esp32c6_devkit"));
+        assert!(!monitor.release("esp32s3_box"));
+        assert!(monitor.release("esp32c6_devkit"));
+        let mut closed = SerialMonitor::new("/dev/ttyUSB1", None);
+        assert!(!closed.suspend("esp32s3_box"));
+        assert_eq!(closed.state, MonitorState::Closed(None));
+    }
+
+    #[test]
+    fn test_serial_monitor_layouts() {
+        assert_eq!(MonitorLayout::default(), MonitorLayout::Tabs);
+        assert_eq!(MonitorLayout::Tabs.next(), MonitorLayout::Tiled);
+        assert_eq!(MonitorLayout::Tiled.next(), MonitorLayout::Merged);
+        assert_eq!(MonitorLayout::Merged.next(), MonitorLayout::Tabs);
+
+        assert_eq!(tile_grid(0), (0, 0));
+        assert_eq!(tile_grid(1), (1, 1));
+        // Two devices side by side, three as two over one
+        assert_eq!(tile_grid(2), (1, 2));
+        assert_eq!(tile_grid(3), (2, 2));
+        assert_eq!(tile_grid(5), (2, 3));
+        assert_eq!(tile_grid(9), (3, 3));
+
+        // The lines each read completes go on to the merged view
+        let mut central = SerialMonitor::new("/dev/ttyACM0", Some("ble_central".to_string()));
+        assert_eq!(
+            central.push_output(b"I (10) BLE: scanning\r\nI (20) BLE: conn"),
+            ["I (10) BLE: scanning"]
+        );
+        assert_eq!(central.push_output(b"ected\n"), ["I (20) BLE: connected"]);
+        let line = merged_line(&central.title(), "I (20) BLE: connected");
+        assert_eq!(line, "[ble_central@/dev/ttyACM0] I (20) BLE: connected");
+        assert_eq!(merged_source(&line), Some("ble_central@/dev/ttyACM0"));
+        assert_eq!(merged_source("no prefix"), None);
+    }
+
+    #[test]
+    fn test_backtrace_frames() {
+        // The frames of one crash are kept together for copying
+        let mut monitor = SerialMonitor::new("/dev/ttyUSB0", Some("esp32c3".to_string()));
+        let added = monitor.push_frames(
+            "MEPC    : 0x42009a3c",
+            &["0x42009a3c: app_main at /src/main.c:7".to_string()],
+        );
+        assert_eq!(added, ["  ↳ 0x42009a3c: app_main at /src/main.c:7"]);
+        monitor.push_frames(
+            "RA      : 0x4200998e",
+            &["0x4200998e: main at /src/main.c:3".to_string()],
+        );
+        assert_eq!(monitor.backtrace.len(), 4);
+        assert_eq!(monitor.lines.len(), 2);
+    }
+
+    #[test]
+    fn test_monitor_filters_and_highlights() {
+        assert_eq!(
+            idf_log_line("W (1234) wifi: Haven't to connect to a suitable AP now!"),
+            Some((IdfLogLevel::Warning, "wifi"))
+        );
+        assert_eq!(
+            idf_log_line("E (12:01:02.345) esp_netif: no IP"),
+            Some((IdfLogLevel::Error, "esp_netif"))
+        );
+        assert_eq!(
+            idf_log_line("Guru Meditation Error: Core  0 panic'ed"),
+            None
+        );
+        assert_eq!(idf_log_line("ets Jun  8 2016 00:22:57"), None);
+
+        let mut filter = MonitorFilter::default();
+        assert_eq!(MonitorLevel::All.next(), MonitorLevel::Warnings);
+        assert_eq!(MonitorLevel::parse("warning"), Some(MonitorLevel::Warnings));
+        assert_eq!(MonitorLevel::parse("loud"), None);
+        filter.level = MonitorLevel::Warnings;
+        assert!(filter.shows("W (10) wifi: retrying"));
+        assert!(filter.shows("E (11) heap: out of memory"));
+        assert!(!filter.shows("I (12) wifi: connected"));
+        // Output that isn't an ESP-IDF log always shows
+        assert!(filter.shows("Guru Meditation Error: Core  0 panic'ed"));
+        // Merged lines are filtered without their device prefix
+        assert!(!filter.shows(&merged_line(
+            "sensor@/dev/ttyUSB0",
+            "I (12) wifi: connected"
+        )));
+
+        filter.level = MonitorLevel::All;
+        filter.tags = parse_tags("wifi, esp_netif");
+        assert_eq!(filter.tags, ["wifi", "esp_netif"]);
+        assert!(filter.shows("I (12) WIFI: connected"));
+        assert!(!filter.shows("I (13) heap_init: At 3FFAE6E0"));
+        assert_eq!(filter.describe(), "all levels, tags wifi,esp_netif");
+
+        // The scrollback is filtered as well
+        let mut monitor = SerialMonitor::new("/dev/ttyUSB0", None);
+        monitor.push_output(
+            b"I (1) boot: start\nI (2) wifi: init\nW (3) wifi: retry\nI (4) main: ok\n",
+        );
+        assert_eq!(
+            monitor.filtered_lines(10, &filter),
+            ["I (2) wifi: init", "W (3) wifi: retry"]
+        );
+        monitor.scroll_offset = 1;
+        assert_eq!(monitor.filtered_lines(10, &filter), ["I (2) wifi: init"]);
+        assert_eq!(
+            monitor.filtered_lines(10, &MonitorFilter::default()).len(),
+            3
+        );
+
+        filter.highlights = vec![
+            HighlightRule::new("heap|wifi").unwrap(),
+            HighlightRule::new("retry").unwrap(),
+        ];
+        assert!(HighlightRule::new("(unclosed").is_err());
+        assert_eq!(filter.highlight("W (3) wifi: retry"), Some(0));
+        assert_eq!(filter.highlight("I (5) ota: retry"), Some(1));
+        assert_eq!(filter.highlight("I (4) main: ok"), None);
+        filter.highlighting = false;
+        assert_eq!(filter.highlight("W (3) wifi: retry"), None);
+
+        let config: ProjectConfig = serde_yaml::from_str(
+            "monitor:\n  level: error\n  tags: [wifi]\n  highlights: [\"heap|wifi\"]\n",
+        )
+        .unwrap();
+        assert_eq!(config.monitor.level.as_deref(), Some("error"));
+        assert_eq!(config.monitor.highlights, ["heap|wifi"]);
+    }
+
+    #[test]
+    fn test_serial_plotter_values() {
+        assert_eq!(
+            plot_values("I (120) sensor: >>temp:21.5 >>hum:40", &[]),
+            [("temp".to_string(), 21.5), ("hum".to_string(), 40.0)]
+        );
+        assert_eq!(
+            plot_values(">>accel.x: -1.5e-2", &[]),
+            [("accel.x".to_string(), -0.015)]
+        );
+        assert!(plot_values("I (121) wifi: connected >>", &[]).is_empty());
+
+        let rules = [
+            PlotRule::new(r"T=(?P<temp>-?[\d.]+)C").unwrap(),
+            PlotRule::new(r"rssi (-?\d+)").unwrap(),
+        ];
+        assert!(PlotRule::new("(unclosed").is_err());
+        assert_eq!(
+            plot_values("T=-3.25C", &rules),
+            [("temp".to_string(), -3.25)]
+        );
+        assert_eq!(
+            plot_values("rssi -67 >>snr:12", &rules),
+            [
+                ("snr".to_string(), 12.0),
+                (r"rssi (-?\d+)".to_string(), -67.0)
+            ]
+        );
+
+        let mut plotter = Plotter::default();
+        assert_eq!(plotter.y_bounds(), [0.0, 1.0]);
+        for i in 0..PLOT_POINTS + 10 {
+            plotter.push_at("temp", i as f64, 20.0 + (i % 2) as f64);
+        }
+        plotter.push_at("temp", 1e6, f64::NAN);
+        assert_eq!(plotter.series.len(), 1);
+        assert_eq!(plotter.series[0].points.len(), PLOT_POINTS);
+        assert_eq!(plotter.x_bounds(), [10.0, (PLOT_POINTS + 9) as f64]);
+        let [low, high] = plotter.y_bounds();
+        assert!(low < 20.0 && high > 21.0);
+
+        // A flat line gets a visible range, clearing the pane clears the plot
+        let mut monitor = SerialMonitor::new("/dev/ttyUSB0", None);
+        monitor.plot.push("level", 5.0);
+        assert_eq!(monitor.plot.y_bounds(), [4.0, 6.0]);
+        monitor.clear();
+        assert!(monitor.plot.is_empty());
+    }
+
+    #[test]
+    fn test_reconnecting_monitor_suspends() {
+        // A flash takes the port of a pane waiting for its device
+        let mut monitor = SerialMonitor::new("/dev/ttyACM0", None);
+        monitor.state = MonitorState::Reconnecting;
+        assert!(monitor.suspend("esp32s3"));
+        assert_eq!(
+            monitor.state,
+            MonitorState::Suspended(vec!["esp32s3".to_string()])
+        );
+    }
+
+    #[test]
+    fn test_monitor_console_input() {
+        assert_eq!(LineEnding::default().terminate("help"), b"help\r\n");
+        assert_eq!(LineEnding::Cr.terminate("print(1)"), b"print(1)\r");
+        assert_eq!(LineEnding::None.terminate("x"), b"x");
+        assert_eq!(LineEnding::parse("LF"), Some(LineEnding::Lf));
+        assert_eq!(LineEnding::parse("\r"), Some(LineEnding::Cr));
+        assert_eq!(LineEnding::parse("crlfx"), None);
+        assert_eq!(LineEnding::None.next(), LineEnding::CrLf);
+
+        let mut history = InputHistory::default();
+        assert_eq!(history.previous(), None);
+        history.push("free");
+        history.push("heap");
+        history.push("heap");
+        history.push("  ");
+        assert_eq!(history.lines().len(), 2);
+
+        assert_eq!(history.previous(), Some("heap"));
+        assert_eq!(history.previous(), Some("free"));
+        // The oldest line stays recalled
+        assert_eq!(history.previous(), Some("free"));
+        assert_eq!(history.next(), Some("heap"));
+        assert_eq!(history.next(), None);
+        assert_eq!(history.next(), None);
+
+        // Sending a line starts over at the newest one
+        history.previous();
+        history.previous();
+        history.push("version");
+        assert_eq!(history.previous(), Some("version"));
+
+        for i in 0..200 {
+            history.push(&format!("cmd {}", i));
+        }
+        assert_eq!(history.lines().len(), INPUT_HISTORY_LINES);
+        assert_eq!(history.lines().back().map(String::as_str), Some("cmd 199"));
+    }
+
+    #[test]
+    fn test_board_activity() {
+        assert_eq!(BuildStatus::Success.label(), "ok");
+        assert_eq!(BuildStatus::Pending.label(), "");
+
+        let start = Instant::now();
+        let mut activity = BoardActivity::new(start);
+        assert_eq!(activity.observe(&BuildStatus::Pending, false, start), None);
+        assert_eq!(activity.elapsed(start), None);
+
+        // Waiting for a build slot doesn't count as building
+        let queued = start + Duration::from_secs(5);
+        assert_eq!(activity.observe(&BuildStatus::Building, true, queued), None);
+        assert_eq!(activity.elapsed(queued), None);
+
+        let building = start + Duration::from_secs(10);
+        assert_eq!(
+            activity.observe(&BuildStatus::Building, false, building),
+            None
+        );
+        let later = building + Duration::from_secs(30);
+        assert_eq!(activity.observe(&BuildStatus::Building, false, later), None);
+        assert_eq!(activity.elapsed(later), Some(Duration::from_secs(30)));
+
+        // Flashing after the build starts a new timing
+        let flashing = building + Duration::from_secs(40);
+        assert_eq!(
+            activity.observe(&BuildStatus::Flashing, false, flashing),
+            Some(Duration::from_secs(40))
+        );
+        let flashed = flashing + Duration::from_secs(8);
+        assert_eq!(
+            activity.observe(&BuildStatus::Flashed, false, flashed),
+            Some(Duration::from_secs(8))
+        );
+        assert_eq!(activity.elapsed(flashed), None);
+    }
+}
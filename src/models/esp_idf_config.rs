@@ -1,7 +1,7 @@
 //! ESP-IDF configuration models for environment detection and management
 
 use serde::{Deserialize, Serialize};
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap};
 use std::path::PathBuf;
 
 /// EIM (ESP-IDF Installation Manager) configuration structure
@@ -77,10 +77,24 @@ pub enum EspIdfDetectionSource {
     EnvironmentVariable,
     /// Found in standard installation locations
     StandardLocation,
+    /// Installed by `espbrew setup`
+    Managed,
     /// Manually configured by user
     Manual,
 }
 
+/// Environment `export.sh` sets up for an installation made by `espbrew setup`
+#[derive(Debug, Clone, Default, PartialEq, Deserialize, Serialize)]
+pub struct ManagedEnvironment {
+    /// Directories put in front of `PATH`
+    #[serde(default)]
+    pub path: Vec<PathBuf>,
+
+    /// Other variables, e.g. `IDF_PATH`, `IDF_TOOLS_PATH` and `IDF_PYTHON_ENV_PATH`
+    #[serde(default)]
+    pub vars: BTreeMap<String, String>,
+}
+
 /// ESP-IDF detection result
 #[derive(Debug, Clone)]
 pub struct EspIdfDetectionResult {
@@ -154,6 +168,7 @@ impl DetectedEspIdfInstallation {
                 EspIdfDetectionSource::SystemPath => "PATH",
                 EspIdfDetectionSource::EnvironmentVariable => "IDF_PATH",
                 EspIdfDetectionSource::StandardLocation => "standard location",
+                EspIdfDetectionSource::Managed => "espbrew setup",
                 EspIdfDetectionSource::Manual => "manual configuration",
             }
         )
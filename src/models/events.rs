@@ -1,6 +1,6 @@
 //! Application events for TUI and CLI operations
 
-use crate::models::board::RemoteBoard;
+use crate::models::board::{CoreDumpReport, RemoteBoard};
 use crate::models::server::DiscoveredServer;
 
 /// Application events for communication between components
@@ -11,6 +11,17 @@ pub enum AppEvent {
     BuildFinished(String, bool),          // board_name, success
     BuildCompleted,                       // All builds completed
     ActionFinished(String, String, bool), // board_name, action, success
+    StepRetried(String, String),          // board_name, step (fetch, build or flash)
+    FlashProgress(String, u8),            // board_name or device label, percent written
+    FlashVerified(String),                // board_name or device label, flash matches the images
+
+    // Flashing all connected devices
+    DevicesMatched(Vec<(String, String)>, Vec<(String, String)>), // (device label, hardware), (port, why skipped)
+    DeviceFlashFinished(String, bool),                            // device label, success
+
+    // Over-the-air updates
+    OtaRolloutStarted(Vec<String>, Option<String>), // device names, why nothing was deployed
+    OtaStatusChanged(String, crate::models::board::OtaStatus), // device name, status
 
     // Component events
     ComponentActionStarted(String, String), // component_name, action_name
@@ -23,6 +34,17 @@ pub enum AppEvent {
     MonitorDisconnected,        // monitoring session ended
     MonitorError(String),       // error_message
 
+    // Serial monitor panes of the TUI
+    SerialMonitorRequested(String, String), // board_name, port to monitor
+    SerialOutput(String, u64, Vec<u8>),     // port, reader, data read
+    SerialClosed(String, u64, Option<String>), // port, reader, error if the port failed
+    SerialDecoded(String, u64, String, Vec<String>), // port, reader, line, its decoded frames
+    SerialDefmt(String, u64, String),       // port, reader, line decoded from a defmt frame
+    SerialReconnecting(String, u64, String), // port, reader, why the port went away
+    SerialReconnected(String, u64, String), // port, reader, port the device came back on
+    MonitorTriggerRan(String, String, String), // port, trigger, what its command did
+    CoreDumpDecoded(CoreDumpReport),
+
     // Local board scanning events
     LocalBoardScanStarted,                           // scan started
     LocalBoardFound(crate::models::tui::LocalBoard), // board discovered incrementally
@@ -47,6 +69,9 @@ pub enum AppEvent {
     ServerDiscoveryCompleted(Vec<DiscoveredServer>),
     ServerDiscoveryFailed(String),
 
+    // Watch mode events
+    SourcesChanged(Vec<std::path::PathBuf>), // debounced batch of changed sources
+
     // General events
     Tick,
 
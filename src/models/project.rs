@@ -16,7 +16,7 @@ pub enum BuildStrategy {
 }
 
 /// Build status for TUI display
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum BuildStatus {
     Pending,
     Building,
@@ -25,6 +25,7 @@ pub enum BuildStatus {
     Flashing,
     Flashed,
     Monitoring,
+    Cancelled,
 }
 
 impl BuildStatus {
@@ -37,6 +38,7 @@ impl BuildStatus {
             BuildStatus::Flashing => Color::Cyan,
             BuildStatus::Flashed => Color::Blue,
             BuildStatus::Monitoring => Color::Magenta,
+            BuildStatus::Cancelled => Color::DarkGray,
         }
     }
 
@@ -49,6 +51,21 @@ impl BuildStatus {
             BuildStatus::Flashing => "📡",
             BuildStatus::Flashed => "🔥",
             BuildStatus::Monitoring => "📺",
+            BuildStatus::Cancelled => "🛑",
+        }
+    }
+
+    /// Short state of the board list, e.g. `building` or `ok`
+    pub fn label(&self) -> &'static str {
+        match self {
+            BuildStatus::Pending => "",
+            BuildStatus::Building => "building",
+            BuildStatus::Success => "ok",
+            BuildStatus::Failed => "failed",
+            BuildStatus::Flashing => "flashing",
+            BuildStatus::Flashed => "flashed",
+            BuildStatus::Monitoring => "monitoring",
+            BuildStatus::Cancelled => "cancelled",
         }
     }
 }
@@ -121,7 +138,7 @@ pub struct ComponentManifest {
 }
 
 /// Build artifacts information
-#[derive(Debug, Clone)]
+#[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct BuildArtifact {
     pub name: String,
     pub file_path: PathBuf,
@@ -130,7 +147,7 @@ pub struct BuildArtifact {
 }
 
 /// Types of build artifacts
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum ArtifactType {
     Application,
     Bootloader,
@@ -153,6 +170,7 @@ pub enum ProjectType {
     NuttX,
     TinyGo,
     Jaculus,
+    Esp8266Rtos,
 }
 
 impl ProjectType {
@@ -168,6 +186,24 @@ impl ProjectType {
             ProjectType::NuttX => "NuttX RTOS",
             ProjectType::TinyGo => "TinyGo",
             ProjectType::Jaculus => "Jaculus",
+            ProjectType::Esp8266Rtos => "ESP8266 RTOS SDK",
+        }
+    }
+
+    /// Key of the project type in `espbrew.yaml`, e.g. under `commands:`
+    pub fn config_key(&self) -> &'static str {
+        match self {
+            ProjectType::EspIdf => "esp_idf",
+            ProjectType::RustNoStd => "rust_nostd",
+            ProjectType::Arduino => "arduino",
+            ProjectType::PlatformIO => "platformio",
+            ProjectType::MicroPython => "micropython",
+            ProjectType::CircuitPython => "circuitpython",
+            ProjectType::Zephyr => "zephyr",
+            ProjectType::NuttX => "nuttx",
+            ProjectType::TinyGo => "tinygo",
+            ProjectType::Jaculus => "jaculus",
+            ProjectType::Esp8266Rtos => "esp8266_rtos",
         }
     }
 
@@ -183,6 +219,7 @@ impl ProjectType {
             ProjectType::NuttX => "NuttX real-time operating system",
             ProjectType::TinyGo => "TinyGo embedded Go",
             ProjectType::Jaculus => "JavaScript runtime for ESP32 devices",
+            ProjectType::Esp8266Rtos => "Legacy ESP8266_RTOS_SDK project (Make or CMake)",
         }
     }
 }
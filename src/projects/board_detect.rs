@@ -0,0 +1,203 @@
+//! Board configurations generated from connected hardware for `espbrew boards detect`
+//!
+//! Every probed device becomes an `sdkconfig.defaults.<chip>-<flash>[-<psram>]`
+//! file, so devkits with the same hardware share one board configuration.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+use crate::config::{BoardMetadata, PsramMode};
+use crate::utils::espflash_utils::EspBoardInfo;
+
+/// Hardware of a device identified on a serial port
+#[derive(Debug, Clone, PartialEq)]
+pub struct DetectedBoard {
+    pub port: String,
+    /// Chip as used for `IDF_TARGET`, e.g. `esp32s3`
+    pub chip: String,
+    /// Flash size in esptool notation, e.g. `16MB`
+    pub flash_size: Option<String>,
+    /// `None` if the chip doesn't report embedded PSRAM
+    pub psram: Option<PsramMode>,
+    /// Crystal frequency in MHz
+    pub crystal: Option<u32>,
+    pub mac_address: String,
+}
+
+impl DetectedBoard {
+    /// Board details from the identification of a device
+    pub fn from_board_info(info: &EspBoardInfo) -> Self {
+        let chip = info.chip_type.to_lowercase().replace('-', "");
+        let flash_size = Some(info.flash_size.trim().to_uppercase())
+            .filter(|size| size.ends_with("MB") && size[..size.len() - 2].parse::<u32>().is_ok());
+        let crystal = info
+            .crystal_frequency
+            .trim()
+            .split(|c: char| !c.is_ascii_digit())
+            .next()
+            .and_then(|mhz| mhz.parse().ok());
+
+        DetectedBoard {
+            port: info.port.clone(),
+            psram: psram_from_features(&chip, &info.features),
+            chip,
+            flash_size,
+            crystal,
+            mac_address: info.mac_address.clone(),
+        }
+    }
+
+    /// Metadata describing the hardware; the chip revision is left out so the
+    /// firmware keeps running on older revisions of the same board
+    pub fn metadata(&self) -> BoardMetadata {
+        BoardMetadata {
+            chip: Some(self.chip.clone()),
+            flash_size: self.flash_size.clone(),
+            psram: self.psram,
+            crystal: self.crystal,
+            ..Default::default()
+        }
+    }
+
+    /// Board configuration name, e.g. `esp32s3-16mb-octal`
+    pub fn config_name(&self) -> String {
+        let mut name = self.chip.clone();
+        if let Some(size) = &self.flash_size {
+            name.push_str(&format!("-{}", size.to_lowercase()));
+        }
+        match self.psram {
+            Some(PsramMode::Quad) => name.push_str("-quad"),
+            Some(PsramMode::Octal) => name.push_str("-octal"),
+            Some(PsramMode::Enabled) => name.push_str("-psram"),
+            Some(PsramMode::None) | None => {}
+        }
+        name
+    }
+
+    /// One line summary for the CLI
+    pub fn summary(&self) -> String {
+        let psram = match self.psram {
+            Some(PsramMode::Quad) => "quad PSRAM",
+            Some(PsramMode::Octal) => "octal PSRAM",
+            Some(PsramMode::Enabled) => "PSRAM",
+            Some(PsramMode::None) | None => "no PSRAM",
+        };
+        format!(
+            "{}, {} flash, {}",
+            self.chip,
+            self.flash_size.as_deref().unwrap_or("unknown"),
+            psram
+        )
+    }
+
+    /// Contents of the board's `sdkconfig.defaults.<name>` file
+    pub fn sdkconfig_defaults(&self) -> String {
+        let mut content = format!(
+            "# Generated by espbrew boards detect from {} ({})\n",
+            self.port, self.mac_address
+        );
+        for option in self.metadata().sdkconfig_options(None) {
+            content.push_str(&option.to_line());
+            content.push('\n');
+        }
+        content
+    }
+}
+
+/// PSRAM reported in the chip features, e.g. `Embedded PSRAM 8MB (AP_3v3)`.
+///
+/// ESP32-S3 parts with 8 MB or more embedded PSRAM use octal mode.
+pub fn psram_from_features(chip: &str, features: &str) -> Option<PsramMode> {
+    let feature = features
+        .split(',')
+        .map(str::trim)
+        .find(|feature| feature.contains("PSRAM"))?;
+
+    if chip != "esp32s3" {
+        return Some(PsramMode::Enabled);
+    }
+    let megabytes = feature
+        .split_whitespace()
+        .find_map(|word| word.strip_suffix("MB")?.parse::<u32>().ok());
+    match megabytes {
+        Some(size) if size >= 8 => Some(PsramMode::Octal),
+        Some(_) => Some(PsramMode::Quad),
+        None => Some(PsramMode::Enabled),
+    }
+}
+
+/// Write the board configuration of a detected device to an ESP-IDF project.
+///
+/// Returns `None` if the project already has a configuration of that name.
+pub fn write_detected_board(project_dir: &Path, board: &DetectedBoard) -> Result<Option<PathBuf>> {
+    if !project_dir.join("CMakeLists.txt").exists() {
+        return Err(anyhow::anyhow!(
+            "{} is not an ESP-IDF project (expected CMakeLists.txt)",
+            project_dir.display()
+        ));
+    }
+
+    let config_file = project_dir.join(format!("sdkconfig.defaults.{}", board.config_name()));
+    if config_file.exists() {
+        return Ok(None);
+    }
+
+    std::fs::write(&config_file, board.sdkconfig_defaults())
+        .with_context(|| format!("Failed to write {}", config_file.display()))?;
+    Ok(Some(config_file))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    fn board_info() -> EspBoardInfo {
+        EspBoardInfo {
+            port: "/dev/ttyACM0".to_string(),
+            chip_type: "esp32s3".to_string(),
+            crystal_frequency: "40 MHz".to_string(),
+            flash_size: "16MB".to_string(),
+            features: "WiFi, BLE, Embedded PSRAM 8MB (AP_3v3)".to_string(),
+            mac_address: "F4:12:FA:00:00:01".to_string(),
+            device_description: "ESP Development Board".to_string(),
+            chip_revision: Some("0.2".to_string()),
+        }
+    }
+
+    #[test]
+    fn test_psram_from_features() {
+        assert_eq!(
+            psram_from_features("esp32s3", "WiFi, BLE, Embedded PSRAM 8MB (AP_3v3)"),
+            Some(PsramMode::Octal)
+        );
+        assert_eq!(
+            psram_from_features("esp32s3", "WiFi, BLE, Embedded PSRAM 2MB (AP_3v3)"),
+            Some(PsramMode::Quad)
+        );
+        assert_eq!(psram_from_features("esp32c3", "WiFi, BLE"), None);
+    }
+
+    #[test]
+    fn test_write_detected_board() {
+        let board = DetectedBoard::from_board_info(&board_info());
+        assert_eq!(board.config_name(), "esp32s3-16mb-octal");
+        assert_eq!(board.crystal, Some(40));
+
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert!(write_detected_board(project, &board).is_err());
+
+        fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+        let file = write_detected_board(project, &board).unwrap().unwrap();
+        let content = fs::read_to_string(&file).unwrap();
+        assert!(content.contains("CONFIG_IDF_TARGET=\"esp32s3\""));
+        assert!(content.contains("CONFIG_ESPTOOLPY_FLASHSIZE_16MB=y"));
+        assert!(content.contains("CONFIG_SPIRAM_MODE_OCT=y"));
+        assert!(!content.contains("REV_MIN"));
+
+        // A second devkit with the same hardware reuses the config
+        assert!(write_detected_board(project, &board).unwrap().is_none());
+    }
+}
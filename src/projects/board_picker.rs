@@ -0,0 +1,209 @@
+//! Picking the boards of a build run, and their devices, before it starts
+//!
+//! `espbrew build --pick` lists the board configurations with the ones the
+//! run would build checked (all of them, or those matching `--tags`) and the
+//! device registered for each on the port it is on now. Boards are checked
+//! and unchecked, and a connected device assigned to a board, before the
+//! build starts; the devices assigned are registered for their boards as
+//! `espbrew boards assign` does, so flashing and monitoring find them later.
+
+use crate::models::ProjectBoardConfig;
+use crate::projects::device_registry::{ConnectedPort, DeviceRegistry, find_by_usb};
+
+/// A board configuration of the picker
+#[derive(Debug, Clone, PartialEq)]
+pub struct PickerBoard {
+    pub name: String,
+    pub target: Option<String>,
+    pub checked: bool,
+    /// Port of the device assigned to the board
+    pub port: Option<String>,
+    /// Port its registered device was found on when the picker opened
+    pub registered_port: Option<String>,
+}
+
+/// The boards, the connected devices and the selected board
+#[derive(Debug, Clone, PartialEq)]
+pub struct BoardPicker {
+    pub boards: Vec<PickerBoard>,
+    pub ports: Vec<String>,
+    pub selected: usize,
+}
+
+impl BoardPicker {
+    /// Picker with the `checked` boards checked and each board's registered
+    /// device on the connected port it is on
+    pub fn new(
+        boards: &[ProjectBoardConfig],
+        checked: &[String],
+        ports: &[ConnectedPort],
+        registry: &DeviceRegistry,
+    ) -> Self {
+        let boards = boards
+            .iter()
+            .map(|board| {
+                let registered_port = registry
+                    .device(&board.name)
+                    .and_then(|device| find_by_usb(device, ports));
+                PickerBoard {
+                    name: board.name.clone(),
+                    target: board.target.clone(),
+                    checked: checked.contains(&board.name),
+                    port: registered_port.clone(),
+                    registered_port,
+                }
+            })
+            .collect();
+        Self {
+            boards,
+            ports: ports.iter().map(|port| port.port.clone()).collect(),
+            selected: 0,
+        }
+    }
+
+    /// Move the selection, wrapping around the boards
+    pub fn move_selection(&mut self, delta: isize) {
+        let count = self.boards.len() as isize;
+        if count > 0 {
+            self.selected = (self.selected as isize + delta).rem_euclid(count) as usize;
+        }
+    }
+
+    pub fn toggle(&mut self) {
+        if let Some(board) = self.boards.get_mut(self.selected) {
+            board.checked = !board.checked;
+        }
+    }
+
+    /// Check every board, or uncheck them all if they all are
+    pub fn toggle_all(&mut self) {
+        let checked = !self.boards.iter().all(|board| board.checked);
+        for board in &mut self.boards {
+            board.checked = checked;
+        }
+    }
+
+    /// Assign the selected board the next or previous connected device, or
+    /// none. A device belongs to one board, so another board it was assigned
+    /// to loses it.
+    pub fn cycle_port(&mut self, delta: isize) {
+        let Some(board) = self.boards.get(self.selected) else {
+            return;
+        };
+        // Index 0 is no device, the ports follow
+        let count = self.ports.len() as isize + 1;
+        let current = board
+            .port
+            .as_ref()
+            .and_then(|port| self.ports.iter().position(|p| p == port))
+            .map_or(0, |index| index as isize + 1);
+        let next = (current + delta).rem_euclid(count) as usize;
+        let port = next.checked_sub(1).map(|index| self.ports[index].clone());
+
+        if let Some(port) = &port {
+            for other in &mut self.boards {
+                if other.port.as_ref() == Some(port) {
+                    other.port = None;
+                }
+            }
+        }
+        self.boards[self.selected].port = port;
+    }
+
+    /// Names of the checked boards
+    pub fn picked(&self) -> Vec<String> {
+        self.boards
+            .iter()
+            .filter(|board| board.checked)
+            .map(|board| board.name.clone())
+            .collect()
+    }
+
+    /// Boards assigned a device other than the one registered for them, with
+    /// its port
+    pub fn assignments(&self) -> Vec<(String, String)> {
+        self.boards
+            .iter()
+            .filter(|board| board.port.is_some() && board.port != board.registered_port)
+            .filter_map(|board| Some((board.name.clone(), board.port.clone()?)))
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use crate::projects::device_registry::{RegisteredDevice, UsbIdentity};
+
+    #[test]
+    fn test_board_picker() {
+        let usb = |serial: &str| UsbIdentity {
+            vid: 0x303a,
+            pid: 0x1001,
+            serial_number: Some(serial.to_string()),
+        };
+        let boards: Vec<ProjectBoardConfig> = ["box", "c3_mini", "devkit"]
+            .iter()
+            .map(|name| ProjectBoardConfig {
+                name: name.to_string(),
+                config_file: format!("sdkconfig.defaults.{}", name).into(),
+                build_dir: format!("build.{}", name).into(),
+                target: None,
+                project_type: ProjectType::EspIdf,
+            })
+            .collect();
+        let ports = vec![
+            ConnectedPort {
+                port: "/dev/ttyACM0".to_string(),
+                usb: Some(usb("A")),
+            },
+            ConnectedPort {
+                port: "/dev/ttyACM1".to_string(),
+                usb: Some(usb("B")),
+            },
+        ];
+        let mut registry = DeviceRegistry::default();
+        registry.assign(
+            "devkit",
+            RegisteredDevice {
+                usb: Some(usb("B")),
+                ..RegisteredDevice::default()
+            },
+        );
+
+        // The run's boards start checked, registered devices on their ports
+        let checked = vec!["box".to_string(), "devkit".to_string()];
+        let mut picker = BoardPicker::new(&boards, &checked, &ports, &registry);
+        assert_eq!(picker.picked(), vec!["box", "devkit"]);
+        assert_eq!(picker.boards[2].port.as_deref(), Some("/dev/ttyACM1"));
+        assert!(picker.assignments().is_empty());
+
+        picker.move_selection(1);
+        picker.toggle();
+        picker.move_selection(-2);
+        assert_eq!(picker.selected, 2);
+        picker.toggle();
+        assert_eq!(picker.picked(), vec!["box", "c3_mini"]);
+        picker.toggle_all();
+        assert_eq!(picker.picked().len(), 3);
+        picker.toggle_all();
+        assert!(picker.picked().is_empty());
+
+        // Devices cycle through the ports and none, and belong to one board
+        picker.move_selection(-1);
+        picker.cycle_port(1);
+        assert_eq!(picker.boards[1].port.as_deref(), Some("/dev/ttyACM0"));
+        picker.cycle_port(1);
+        assert_eq!(picker.boards[1].port.as_deref(), Some("/dev/ttyACM1"));
+        assert_eq!(picker.boards[2].port, None);
+        assert_eq!(
+            picker.assignments(),
+            vec![("c3_mini".to_string(), "/dev/ttyACM1".to_string())]
+        );
+        picker.cycle_port(1);
+        assert_eq!(picker.boards[1].port, None);
+        picker.cycle_port(-1);
+        assert_eq!(picker.boards[1].port.as_deref(), Some("/dev/ttyACM1"));
+    }
+}
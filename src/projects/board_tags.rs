@@ -0,0 +1,152 @@
+//! Board tags from `espbrew.yaml` and tag expressions like `psram,!c3`
+
+use anyhow::Result;
+use std::fmt;
+use std::path::Path;
+
+use crate::config::ProjectConfig;
+use crate::config::build_profiles::split_cell;
+use crate::models::ProjectBoardConfig;
+
+/// A parsed tag expression: every included tag must be present, no excluded one may be
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct TagFilter {
+    pub include: Vec<String>,
+    pub exclude: Vec<String>,
+}
+
+impl TagFilter {
+    /// Parse a comma separated list of tags, `!tag` excludes a tag
+    pub fn parse(spec: &str) -> Result<Self> {
+        let mut filter = TagFilter::default();
+
+        for term in spec.split(',').map(str::trim).filter(|t| !t.is_empty()) {
+            match term.strip_prefix('!') {
+                Some(tag) => {
+                    let tag = tag.trim();
+                    if tag.is_empty() {
+                        return Err(anyhow::anyhow!("Empty excluded tag in '{}'", spec));
+                    }
+                    filter.exclude.push(tag.to_lowercase());
+                }
+                None => filter.include.push(term.to_lowercase()),
+            }
+        }
+
+        Ok(filter)
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.include.is_empty() && self.exclude.is_empty()
+    }
+
+    /// Whether a board with these tags passes the filter
+    pub fn matches(&self, tags: &[String]) -> bool {
+        let has = |tag: &String| tags.iter().any(|t| t.eq_ignore_ascii_case(tag));
+        self.include.iter().all(has) && !self.exclude.iter().any(has)
+    }
+}
+
+impl fmt::Display for TagFilter {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let terms: Vec<String> = self
+            .include
+            .iter()
+            .cloned()
+            .chain(self.exclude.iter().map(|tag| format!("!{}", tag)))
+            .collect();
+        write!(f, "{}", terms.join(","))
+    }
+}
+
+/// Tags of a board: the ones configured in `espbrew.yaml`, its profile and its target chip
+pub fn board_tags(project_dir: &Path, board_name: &str, target: Option<&str>) -> Vec<String> {
+    let config = ProjectConfig::load(project_dir).ok().flatten();
+    tags_from_config(config.as_ref(), board_name, target)
+}
+
+/// Tags of a board from an already loaded configuration
+pub fn tags_from_config(
+    config: Option<&ProjectConfig>,
+    board_name: &str,
+    target: Option<&str>,
+) -> Vec<String> {
+    let mut tags: Vec<String> = config
+        .and_then(|config| config.board_section(board_name))
+        .map(|board| board.tags.iter().map(|t| t.to_lowercase()).collect())
+        .unwrap_or_default();
+
+    // Profile builds are tagged with their profile, e.g. `release`
+    if let Some((_, profile, _)) = config.and_then(|config| split_cell(config, board_name)) {
+        let profile = profile.to_lowercase();
+        if !tags.contains(&profile) {
+            tags.push(profile);
+        }
+    }
+
+    if let Some(target) = target {
+        let target = target.to_lowercase();
+        if !tags.contains(&target) {
+            tags.push(target);
+        }
+    }
+
+    tags
+}
+
+/// Boards of a project passing the filter
+pub fn filter_boards_by_tags(
+    project_dir: &Path,
+    boards: Vec<ProjectBoardConfig>,
+    filter: &TagFilter,
+) -> Vec<ProjectBoardConfig> {
+    if filter.is_empty() {
+        return boards;
+    }
+
+    let config = ProjectConfig::load(project_dir).ok().flatten();
+    boards
+        .into_iter()
+        .filter(|board| {
+            filter.matches(&tags_from_config(
+                config.as_ref(),
+                &board.name,
+                board.target.as_deref(),
+            ))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_tag_filter_parse() {
+        let filter = TagFilter::parse("psram, !C3").unwrap();
+        assert_eq!(filter.include, vec!["psram"]);
+        assert_eq!(filter.exclude, vec!["c3"]);
+        assert_eq!(filter.to_string(), "psram,!c3");
+        assert!(TagFilter::parse("psram,!").is_err());
+        assert!(TagFilter::parse("").unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_board_tags() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  c3_mini:\n    tags: [PSRAM, c3]\n",
+        )
+        .unwrap();
+
+        assert_eq!(
+            board_tags(project, "c3_mini", Some("esp32c3")),
+            vec!["psram", "c3", "esp32c3"]
+        );
+        assert_eq!(board_tags(project, "box", Some("esp32s3")), vec!["esp32s3"]);
+    }
+}
@@ -0,0 +1,307 @@
+//! ESP-BSP board catalog for `espbrew boards add`
+//!
+//! A built-in snapshot of the boards published by
+//! [espressif/esp-bsp](https://github.com/espressif/esp-bsp), so a board
+//! configuration can be generated without network access.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+use crate::utils::idf_components::COMPONENT_MANIFEST_FILE;
+
+/// PSRAM configuration of a board
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum Psram {
+    None,
+    /// PSRAM enabled with the chip's default mode
+    Default,
+    Quad,
+    Octal,
+}
+
+/// A board of the ESP-BSP catalog
+#[derive(Debug, Clone, PartialEq)]
+pub struct BspBoard {
+    /// BSP component name, e.g. `m5stack_core_s3`
+    pub name: &'static str,
+    pub description: &'static str,
+    pub target: &'static str,
+    /// Flash size as used in `CONFIG_ESPTOOLPY_FLASHSIZE_<size>`
+    pub flash_size: &'static str,
+    pub psram: Psram,
+}
+
+impl BspBoard {
+    /// Component registry name of the BSP
+    pub fn component(&self) -> String {
+        format!("espressif/{}", self.name)
+    }
+
+    /// Contents of the board's `sdkconfig.bsp.<name>` file
+    pub fn sdkconfig_defaults(&self) -> String {
+        let mut content = format!(
+            "# {} ({})\n# Generated by espbrew from the ESP-BSP catalog\nCONFIG_IDF_TARGET=\"{}\"\nCONFIG_ESPTOOLPY_FLASHSIZE_{}=y\n",
+            self.description,
+            self.component(),
+            self.target,
+            self.flash_size
+        );
+
+        match self.psram {
+            Psram::None => {}
+            Psram::Default => content.push_str("CONFIG_SPIRAM=y\n"),
+            Psram::Quad => content.push_str("CONFIG_SPIRAM=y\nCONFIG_SPIRAM_MODE_QUAD=y\n"),
+            Psram::Octal => content.push_str("CONFIG_SPIRAM=y\nCONFIG_SPIRAM_MODE_OCT=y\n"),
+        }
+
+        content
+    }
+}
+
+const fn bsp(
+    name: &'static str,
+    description: &'static str,
+    target: &'static str,
+    flash_size: &'static str,
+    psram: Psram,
+) -> BspBoard {
+    BspBoard {
+        name,
+        description,
+        target,
+        flash_size,
+        psram,
+    }
+}
+
+/// Boards of the ESP-BSP repository
+pub const BSP_CATALOG: &[BspBoard] = &[
+    bsp(
+        "esp_box_3",
+        "ESP32-S3-BOX-3",
+        "esp32s3",
+        "16MB",
+        Psram::Octal,
+    ),
+    bsp(
+        "esp32_s3_eye",
+        "ESP32-S3-EYE",
+        "esp32s3",
+        "8MB",
+        Psram::Octal,
+    ),
+    bsp(
+        "esp32_s3_korvo_2",
+        "ESP32-S3-Korvo-2",
+        "esp32s3",
+        "16MB",
+        Psram::Octal,
+    ),
+    bsp(
+        "esp32_s3_lcd_ev_board",
+        "ESP32-S3-LCD-EV-Board",
+        "esp32s3",
+        "16MB",
+        Psram::Octal,
+    ),
+    bsp(
+        "esp32_s3_usb_otg",
+        "ESP32-S3-USB-OTG",
+        "esp32s3",
+        "8MB",
+        Psram::None,
+    ),
+    bsp(
+        "esp32_s2_kaluga_kit",
+        "ESP32-S2-Kaluga-Kit",
+        "esp32s2",
+        "4MB",
+        Psram::Quad,
+    ),
+    bsp(
+        "esp32_c3_lcdkit",
+        "ESP32-C3-LCDkit",
+        "esp32c3",
+        "4MB",
+        Psram::None,
+    ),
+    bsp(
+        "esp32_p4_function_ev_board",
+        "ESP32-P4-Function-EV-Board",
+        "esp32p4",
+        "16MB",
+        Psram::Default,
+    ),
+    bsp(
+        "esp_wrover_kit",
+        "ESP-WROVER-KIT",
+        "esp32",
+        "4MB",
+        Psram::Default,
+    ),
+    bsp("esp32_lyrat", "ESP32-LyraT", "esp32", "4MB", Psram::Default),
+    bsp(
+        "esp32_azure_iot_kit",
+        "ESP32-Azure IoT Kit",
+        "esp32",
+        "4MB",
+        Psram::None,
+    ),
+    bsp(
+        "m5stack_core_s3",
+        "M5Stack CoreS3",
+        "esp32s3",
+        "16MB",
+        Psram::Quad,
+    ),
+    bsp(
+        "m5stack_core_2",
+        "M5Stack Core2",
+        "esp32",
+        "16MB",
+        Psram::Default,
+    ),
+    bsp("m5stack_core", "M5Stack Core", "esp32", "16MB", Psram::None),
+    bsp(
+        "m5_atom_s3",
+        "M5Stack AtomS3",
+        "esp32s3",
+        "8MB",
+        Psram::None,
+    ),
+    bsp("m5dial", "M5Stack Dial", "esp32s3", "8MB", Psram::None),
+];
+
+/// Look up a BSP by component name; `espressif/` prefixes and dashes are accepted
+pub fn find_bsp(name: &str) -> Option<&'static BspBoard> {
+    let name = name.trim_start_matches("espressif/").replace('-', "_");
+    BSP_CATALOG.iter().find(|board| board.name == name)
+}
+
+/// Add a catalog board to an ESP-IDF project and return the files written.
+///
+/// Writes `sdkconfig.bsp.<board_name>` and adds the BSP component to
+/// `main/idf_component.yml`, limited to the board's target.
+pub fn add_bsp_board(
+    project_dir: &Path,
+    bsp: &BspBoard,
+    board_name: Option<&str>,
+) -> Result<Vec<PathBuf>> {
+    if !project_dir.join("CMakeLists.txt").exists() || !project_dir.join("main").is_dir() {
+        return Err(anyhow::anyhow!(
+            "{} is not an ESP-IDF project (expected CMakeLists.txt and main/)",
+            project_dir.display()
+        ));
+    }
+
+    let board_name = board_name.unwrap_or(bsp.name);
+    if board_name.contains('/') {
+        return Err(anyhow::anyhow!(
+            "Board name '{}' must not contain '/'",
+            board_name
+        ));
+    }
+
+    let config_file = project_dir.join(format!("sdkconfig.bsp.{}", board_name));
+    if config_file.exists() {
+        return Err(anyhow::anyhow!(
+            "Board configuration {} already exists",
+            config_file.display()
+        ));
+    }
+
+    std::fs::write(&config_file, bsp.sdkconfig_defaults())
+        .with_context(|| format!("Failed to write {}", config_file.display()))?;
+
+    let mut written = vec![config_file];
+    let manifest = project_dir.join("main").join(COMPONENT_MANIFEST_FILE);
+    if add_component_dependency(&manifest, bsp)? {
+        written.push(manifest);
+    }
+
+    Ok(written)
+}
+
+/// Add the BSP to a component manifest, keeping the rest of the file untouched.
+///
+/// Returns `false` if the dependency is already declared.
+fn add_component_dependency(manifest: &Path, bsp: &BspBoard) -> Result<bool> {
+    let content = if manifest.exists() {
+        std::fs::read_to_string(manifest)
+            .with_context(|| format!("Failed to read {}", manifest.display()))?
+    } else {
+        String::new()
+    };
+
+    let component = bsp.component();
+    let already_declared = content.lines().any(|line| {
+        let key = line.trim().trim_end_matches(':');
+        key == component || key == bsp.name || key.starts_with(&format!("{}:", component))
+    });
+    if already_declared {
+        return Ok(false);
+    }
+
+    let entry = format!(
+        "  {}:\n    version: \"*\"\n    rules:\n      - if: \"target in [{}]\"\n",
+        component, bsp.target
+    );
+
+    let mut lines: Vec<String> = content.lines().map(|l| l.to_string()).collect();
+    match lines.iter().position(|l| l.trim_end() == "dependencies:") {
+        Some(index) => lines.insert(index + 1, entry.trim_end().to_string()),
+        None => {
+            if !lines.is_empty() {
+                lines.push(String::new());
+            }
+            lines.push("dependencies:".to_string());
+            lines.push(entry.trim_end().to_string());
+        }
+    }
+
+    let mut updated = lines.join("\n");
+    updated.push('\n');
+    std::fs::write(manifest, updated)
+        .with_context(|| format!("Failed to write {}", manifest.display()))?;
+
+    Ok(true)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_add_bsp_board() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+        fs::create_dir_all(project.join("main")).unwrap();
+        fs::write(
+            project.join("main/idf_component.yml"),
+            "## Project dependencies\ndependencies:\n  idf: \">=5.3\"\n",
+        )
+        .unwrap();
+
+        assert!(find_bsp("unknown_board").is_none());
+        let core_s3 = find_bsp("espressif/m5stack-core-s3").expect("catalog entry");
+        assert_eq!(core_s3.target, "esp32s3");
+
+        add_bsp_board(project, core_s3, None).unwrap();
+        add_bsp_board(project, core_s3, Some("cores3-debug")).unwrap();
+        add_bsp_board(project, find_bsp("esp_box_3").unwrap(), None).unwrap();
+        assert!(add_bsp_board(project, core_s3, None).is_err());
+
+        let manifest = fs::read_to_string(project.join("main/idf_component.yml")).unwrap();
+        assert!(manifest.starts_with("## Project dependencies\n"));
+        assert_eq!(manifest.matches("espressif/m5stack_core_s3:").count(), 1);
+        assert!(manifest.contains("espressif/esp_box_3:"));
+        assert!(manifest.contains("idf: \">=5.3\""));
+
+        let sdkconfig = fs::read_to_string(project.join("sdkconfig.bsp.m5stack_core_s3")).unwrap();
+        assert!(sdkconfig.contains("CONFIG_ESPTOOLPY_FLASHSIZE_16MB=y"));
+        assert!(sdkconfig.contains("CONFIG_SPIRAM=y"));
+    }
+}
@@ -0,0 +1,313 @@
+//! Build history: every board build with its duration, result, size and commit
+//!
+//! Entries are appended to `.espbrew/history.jsonl`, one JSON object per
+//! line, so concurrent builds never rewrite each other's results and a
+//! truncated last line only loses that entry. `espbrew stats` and the TUI
+//! history panel summarize the entries per board, and the average duration
+//! of recent builds estimates how long the next build of a board takes.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::io::Write;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+use tokio::process::Command;
+
+/// History file, relative to the project
+pub const BUILD_HISTORY_FILE: &str = ".espbrew/history.jsonl";
+/// Successful builds averaged for the duration estimate and trend
+const RECENT_BUILDS: usize = 5;
+
+/// A finished board build
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct BuildHistoryEntry {
+    pub finished: chrono::DateTime<chrono::Local>,
+    pub board: String,
+    pub duration_ms: u64,
+    pub success: bool,
+    /// Flash size of the image, if the build produced an ELF
+    #[serde(default)]
+    pub flash_size: Option<u64>,
+    /// Short hash of `HEAD`, with `-dirty` for uncommitted changes
+    #[serde(default)]
+    pub commit: Option<String>,
+}
+
+impl BuildHistoryEntry {
+    pub fn duration(&self) -> Duration {
+        Duration::from_millis(self.duration_ms)
+    }
+}
+
+pub fn history_path(project_dir: &Path) -> PathBuf {
+    project_dir.join(BUILD_HISTORY_FILE)
+}
+
+/// Append an entry to the project's history
+pub fn append_entry(project_dir: &Path, entry: &BuildHistoryEntry) -> Result<()> {
+    let path = history_path(project_dir);
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)
+            .with_context(|| format!("Failed to create {}", parent.display()))?;
+    }
+    let mut file = std::fs::OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(&path)
+        .with_context(|| format!("Failed to open {}", path.display()))?;
+    // A single write per line keeps lines of parallel builds apart
+    let line = format!("{}\n", serde_json::to_string(entry)?);
+    file.write_all(line.as_bytes())
+        .with_context(|| format!("Failed to write {}", path.display()))
+}
+
+/// Record a finished build of a board at the project's current commit
+pub async fn record_build(
+    project_dir: &Path,
+    board_name: &str,
+    duration: Duration,
+    success: bool,
+    flash_size: Option<u64>,
+) -> Result<()> {
+    let entry = BuildHistoryEntry {
+        finished: chrono::Local::now(),
+        board: board_name.to_string(),
+        duration_ms: duration.as_millis() as u64,
+        success,
+        flash_size,
+        commit: current_commit(project_dir).await,
+    };
+    append_entry(project_dir, &entry)
+}
+
+/// Entries of the project's history, oldest first; unreadable lines are skipped
+pub fn load_history(project_dir: &Path) -> Vec<BuildHistoryEntry> {
+    std::fs::read_to_string(history_path(project_dir))
+        .map(|content| {
+            content
+                .lines()
+                .filter_map(|line| serde_json::from_str(line).ok())
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Short hash of the project's `HEAD`, `None` outside a git repository
+pub async fn current_commit(project_dir: &Path) -> Option<String> {
+    let output = Command::new("git")
+        .args(["rev-parse", "--short", "HEAD"])
+        .current_dir(project_dir)
+        .output()
+        .await
+        .ok()
+        .filter(|output| output.status.success())?;
+    let commit = String::from_utf8_lossy(&output.stdout).trim().to_string();
+
+    let dirty = Command::new("git")
+        .args(["status", "--porcelain", "--untracked-files=no"])
+        .current_dir(project_dir)
+        .output()
+        .await
+        .map(|status| !status.stdout.is_empty())
+        .unwrap_or(false);
+    Some(if dirty {
+        format!("{}-dirty", commit)
+    } else {
+        commit
+    })
+}
+
+/// Summary of a board's builds
+#[derive(Debug, Clone)]
+pub struct BoardStats {
+    pub board: String,
+    pub builds: usize,
+    pub failures: usize,
+    /// Average of the recent successful builds
+    pub average: Option<Duration>,
+    pub last: BuildHistoryEntry,
+    /// Average of the recent successful builds minus the average of the ones before them
+    pub trend: Option<i64>,
+    /// Flash size change between the last two successful builds with a size
+    pub size_delta: Option<i64>,
+    /// Durations of the recent builds in seconds, oldest first
+    pub recent_durations: Vec<u64>,
+}
+
+impl BoardStats {
+    /// Share of successful builds, in percent
+    pub fn success_rate(&self) -> f64 {
+        (self.builds - self.failures) as f64 * 100.0 / self.builds as f64
+    }
+}
+
+/// Statistics per board, in order of the boards' first build
+pub fn board_stats(entries: &[BuildHistoryEntry]) -> Vec<BoardStats> {
+    let mut boards: Vec<&str> = Vec::new();
+    for entry in entries {
+        if !boards.contains(&entry.board.as_str()) {
+            boards.push(&entry.board);
+        }
+    }
+
+    boards
+        .into_iter()
+        .filter_map(|board| {
+            let builds: Vec<&BuildHistoryEntry> =
+                entries.iter().filter(|e| e.board == board).collect();
+            let successful: Vec<u64> = builds
+                .iter()
+                .filter(|e| e.success)
+                .map(|e| e.duration_ms)
+                .collect();
+            let sizes: Vec<u64> = builds
+                .iter()
+                .filter(|e| e.success)
+                .filter_map(|e| e.flash_size)
+                .collect();
+
+            let recent = &successful[successful.len().saturating_sub(RECENT_BUILDS)..];
+            let earlier = &successful[..successful.len().saturating_sub(RECENT_BUILDS)];
+            let earlier = &earlier[earlier.len().saturating_sub(RECENT_BUILDS)..];
+
+            Some(BoardStats {
+                board: board.to_string(),
+                builds: builds.len(),
+                failures: builds.iter().filter(|e| !e.success).count(),
+                average: average_ms(recent).map(Duration::from_millis),
+                last: (*builds.last()?).clone(),
+                trend: average_ms(recent)
+                    .zip(average_ms(earlier))
+                    .map(|(recent, earlier)| recent as i64 - earlier as i64),
+                size_delta: match sizes.as_slice() {
+                    [.., before, last] => Some(*last as i64 - *before as i64),
+                    _ => None,
+                },
+                recent_durations: builds[builds.len().saturating_sub(2 * RECENT_BUILDS)..]
+                    .iter()
+                    .map(|e| e.duration_ms / 1000)
+                    .collect(),
+            })
+        })
+        .collect()
+}
+
+/// Expected duration of a board's next build, from its recent successful builds
+pub fn estimate_duration(entries: &[BuildHistoryEntry], board: &str) -> Option<Duration> {
+    let successful: Vec<u64> = entries
+        .iter()
+        .filter(|e| e.board == board && e.success)
+        .map(|e| e.duration_ms)
+        .collect();
+    average_ms(&successful[successful.len().saturating_sub(RECENT_BUILDS)..])
+        .map(Duration::from_millis)
+}
+
+fn average_ms(durations: &[u64]) -> Option<u64> {
+    (!durations.is_empty()).then(|| durations.iter().sum::<u64>() / durations.len() as u64)
+}
+
+/// e.g. `45s` or `2m 05s`
+pub fn format_duration(duration: Duration) -> String {
+    let secs = duration.as_secs();
+    if secs < 60 {
+        format!("{}s", secs)
+    } else {
+        format!("{}m {:02}s", secs / 60, secs % 60)
+    }
+}
+
+/// Share of the estimate elapsed, held at 99% until the build finishes
+pub fn estimated_progress(elapsed: Duration, estimate: Duration) -> u8 {
+    if estimate.is_zero() {
+        return 99;
+    }
+    (elapsed.as_secs_f64() / estimate.as_secs_f64() * 100.0).min(99.0) as u8
+}
+
+/// Bar per value, scaled to the largest one, e.g. `▂▃▃█▄`
+pub fn sparkline(values: &[u64]) -> String {
+    const BARS: [char; 8] = ['▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'];
+    let max = values.iter().copied().max().unwrap_or(0).max(1);
+    values
+        .iter()
+        .map(|value| BARS[(value * (BARS.len() as u64 - 1) / max) as usize])
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_build_history_stats() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert!(load_history(project).is_empty());
+
+        let entry =
+            |board: &str, secs: u64, success: bool, flash_size: Option<u64>| BuildHistoryEntry {
+                finished: chrono::Local::now(),
+                board: board.to_string(),
+                duration_ms: secs * 1000,
+                success,
+                flash_size,
+                commit: Some("abc1234".to_string()),
+            };
+        // One slow build, a failure and five faster builds on box; one build on c3
+        append_entry(project, &entry("box", 60, true, Some(1000))).unwrap();
+        append_entry(project, &entry("c3", 90, true, None)).unwrap();
+        append_entry(project, &entry("box", 5, false, None)).unwrap();
+        for _ in 0..4 {
+            append_entry(project, &entry("box", 40, true, Some(1000))).unwrap();
+        }
+        append_entry(project, &entry("box", 40, true, Some(1200))).unwrap();
+
+        // A truncated line only loses that entry
+        let mut content = fs::read_to_string(project.join(".espbrew/history.jsonl")).unwrap();
+        content.push_str("{\"board\":\"bo");
+        fs::write(project.join(".espbrew/history.jsonl"), content).unwrap();
+
+        let entries = load_history(project);
+        assert_eq!(entries.len(), 8);
+
+        let stats = board_stats(&entries);
+        assert_eq!(stats.len(), 2);
+        let box_stats = &stats[0];
+        assert_eq!(box_stats.board, "box");
+        assert_eq!(box_stats.builds, 7);
+        assert_eq!(box_stats.failures, 1);
+        assert_eq!(box_stats.average, Some(Duration::from_secs(40)));
+        assert_eq!(box_stats.trend, Some(-20_000));
+        assert_eq!(box_stats.size_delta, Some(200));
+        assert_eq!(box_stats.recent_durations, vec![60, 5, 40, 40, 40, 40, 40]);
+
+        let c3_stats = &stats[1];
+        assert_eq!(c3_stats.builds, 1);
+        assert_eq!(c3_stats.trend, None);
+        assert_eq!(c3_stats.size_delta, None);
+        assert_eq!(c3_stats.success_rate(), 100.0);
+
+        assert_eq!(
+            estimate_duration(&entries, "box"),
+            Some(Duration::from_secs(40))
+        );
+        assert_eq!(estimate_duration(&entries, "p4"), None);
+
+        assert_eq!(format_duration(Duration::from_secs(45)), "45s");
+        assert_eq!(format_duration(Duration::from_secs(125)), "2m 05s");
+        assert_eq!(sparkline(&[0, 4, 8]), "▁▄█");
+        assert_eq!(sparkline(&[]), "");
+    }
+
+    #[test]
+    fn test_estimated_progress() {
+        let estimate = Duration::from_secs(120);
+        assert_eq!(estimated_progress(Duration::ZERO, estimate), 0);
+        assert_eq!(estimated_progress(Duration::from_secs(60), estimate), 50);
+        // Builds slower than usual stay short of done
+        assert_eq!(estimated_progress(Duration::from_secs(300), estimate), 99);
+    }
+}
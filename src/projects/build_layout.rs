@@ -0,0 +1,96 @@
+//! Out-of-tree build directories from the `build.out_dir` setting of `espbrew.yaml`
+//!
+//! Builds write thousands of object files, which is slow on network mounted
+//! source trees. With `out_dir` set, the handlers that pass the build
+//! directory to their build tool place every board's build under that root
+//! instead of next to the sources, by default as `<out_dir>/<project>/<board>`.
+
+use std::path::{Path, PathBuf};
+
+use crate::config::ProjectConfig;
+use crate::models::ProjectBoardConfig;
+
+/// Layout used when `out_dir` names neither `{project}` nor `{board}`
+const DEFAULT_LAYOUT: &str = "{project}/{board}";
+
+/// Build directory of a board under the project's `out_dir`, `None` for in-tree builds
+pub fn out_of_tree_build_dir(
+    project_dir: &Path,
+    config: Option<&ProjectConfig>,
+    board_name: &str,
+) -> Option<PathBuf> {
+    let out_dir = config?.build.out_dir.as_deref()?;
+    let layout = if out_dir.contains("{project}") || out_dir.contains("{board}") {
+        out_dir.to_string()
+    } else {
+        format!(
+            "{}/{}",
+            out_dir.trim_end_matches(['/', '\\']),
+            DEFAULT_LAYOUT
+        )
+    };
+
+    let project_name = std::path::absolute(project_dir)
+        .ok()
+        .and_then(|dir| {
+            dir.file_name()
+                .map(|name| name.to_string_lossy().to_string())
+        })
+        .unwrap_or_else(|| "project".to_string());
+    let expanded = layout
+        .replace("{project}", &project_name)
+        .replace("{board}", &board_name.replace(['/', '\\', ':'], "_"));
+
+    let path = match expanded.strip_prefix("~/") {
+        Some(rest) => std::env::var_os("HOME")
+            .map(|home| PathBuf::from(home).join(rest))
+            .unwrap_or_else(|| PathBuf::from(&expanded)),
+        None => PathBuf::from(&expanded),
+    };
+    // A relative root is taken from the project, e.g. `../builds`
+    Some(project_dir.join(path))
+}
+
+/// Move the build directories of discovered boards under the project's `out_dir`
+pub fn place_build_dirs(
+    project_dir: &Path,
+    config: Option<&ProjectConfig>,
+    boards: Vec<ProjectBoardConfig>,
+) -> Vec<ProjectBoardConfig> {
+    boards
+        .into_iter()
+        .map(|mut board| {
+            if let Some(build_dir) = out_of_tree_build_dir(project_dir, config, &board.name) {
+                board.build_dir = build_dir;
+            }
+            board
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_out_of_tree_build_dir() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path().join("blinky");
+        fs::create_dir_all(&project).unwrap();
+
+        // Placeholders choose the layout, relative roots start at the project
+        fs::write(
+            project.join("espbrew.yaml"),
+            "build:\n  out_dir: ../builds/{board}-{project}\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(&project).unwrap();
+        assert_eq!(
+            out_of_tree_build_dir(&project, config.as_ref(), "esp32c3").unwrap(),
+            project.join("../builds/esp32c3-blinky")
+        );
+        assert!(out_of_tree_build_dir(&project, None, "esp32c3").is_none());
+    }
+}
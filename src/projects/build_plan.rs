@@ -0,0 +1,321 @@
+//! Build plans: the commands a board build would run, for `espbrew build --dry-run`
+//!
+//! Handlers describe their build as [`PlannedCommand`]s. The plan of a board
+//! adds its hooks around them and moves them into the board's container, in
+//! the order `build_board_with_hooks` runs them. Only the environment
+//! variables espbrew sets are listed, everything else is inherited.
+
+use anyhow::Result;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use crate::models::ProjectBoardConfig;
+use crate::projects::ProjectHandler;
+use crate::projects::command_templates::{TemplateStep, command_template, expand_template};
+use crate::projects::container_build::{
+    board_container, container_engine, container_run_args, shell_quote,
+};
+use crate::projects::hooks::{HookStage, board_hook_commands, hook_env};
+use crate::projects::incremental::{BuildRecord, input_hash};
+
+/// How `espbrew build --dry-run` prints the plan
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PlanFormat {
+    Text,
+    Json,
+}
+
+/// A command of a build, as it would be spawned
+#[derive(Debug, Clone, Serialize)]
+pub struct PlannedCommand {
+    /// What the command is for, e.g. `set-target`, `build` or `pre_build hook`
+    pub step: String,
+    pub program: String,
+    pub args: Vec<String>,
+    pub working_dir: PathBuf,
+    /// Variables set on top of the inherited environment
+    pub env: BTreeMap<String, String>,
+}
+
+impl PlannedCommand {
+    pub fn new(step: &str, program: &str, working_dir: &Path) -> Self {
+        Self {
+            step: step.to_string(),
+            program: program.to_string(),
+            args: Vec::new(),
+            working_dir: working_dir.to_path_buf(),
+            env: BTreeMap::new(),
+        }
+    }
+
+    /// A command line run by the platform's shell
+    pub fn shell(step: &str, working_dir: &Path, command: &str) -> Self {
+        if cfg!(windows) {
+            Self::new(step, "cmd", working_dir).args(["/C", command])
+        } else {
+            Self::new(step, "sh", working_dir).args(["-c", command])
+        }
+    }
+
+    pub fn arg(mut self, arg: impl Into<String>) -> Self {
+        self.args.push(arg.into());
+        self
+    }
+
+    pub fn args<I, S>(mut self, args: I) -> Self
+    where
+        I: IntoIterator<Item = S>,
+        S: Into<String>,
+    {
+        self.args.extend(args.into_iter().map(Into::into));
+        self
+    }
+
+    pub fn env(mut self, key: &str, value: impl Into<String>) -> Self {
+        self.env.insert(key.to_string(), value.into());
+        self
+    }
+
+    pub fn envs<I>(mut self, vars: I) -> Self
+    where
+        I: IntoIterator<Item = (String, String)>,
+    {
+        self.env.extend(vars);
+        self
+    }
+
+    /// Program and arguments as one line for `sh`, quoting where needed
+    pub fn command_line(&self) -> String {
+        std::iter::once(&self.program)
+            .chain(&self.args)
+            .map(|word| quote_if_needed(word))
+            .collect::<Vec<_>>()
+            .join(" ")
+    }
+}
+
+/// A word as-is when the shell leaves it alone, quoted otherwise
+pub fn quote_if_needed(word: &str) -> String {
+    let plain = !word.is_empty()
+        && word
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || "-_./=:,+@%".contains(c));
+    if plain {
+        word.to_string()
+    } else {
+        shell_quote(word)
+    }
+}
+
+/// Everything a build of one board would do
+#[derive(Debug, Clone, Serialize)]
+pub struct BoardPlan {
+    pub board: String,
+    pub project_type: String,
+    pub target: Option<String>,
+    pub config_file: PathBuf,
+    pub build_dir: PathBuf,
+    /// Image the build runs in, if the board builds in a container
+    pub container: Option<String>,
+    /// The inputs match the last successful build, so the build would be skipped
+    pub up_to_date: bool,
+    pub commands: Vec<PlannedCommand>,
+}
+
+/// Plan of a board build: pre-build hooks, the handler's commands, post-build hooks
+pub async fn board_plan(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    other_configs: &[PathBuf],
+    force: bool,
+) -> Result<BoardPlan> {
+    let up_to_date = !force
+        && match input_hash(project_dir, board_config, other_configs).await {
+            Ok(inputs) => BuildRecord::load(project_dir, &board_config.name)
+                .is_some_and(|record| record.inputs == inputs && record.artifacts_exist()),
+            Err(_) => false,
+        };
+
+    let mut commands = hook_commands(HookStage::PreBuild, project_dir, board_config)?;
+
+    let container = board_container(project_dir, &board_config.name);
+    // A build template replaces the handler's commands
+    let build_commands = match command_template(project_dir, board_config, TemplateStep::Build)? {
+        Some(template) => vec![PlannedCommand::shell(
+            "build template",
+            project_dir,
+            &expand_template(&template, project_dir, board_config, None, None)?,
+        )],
+        None => handler.build_plan(project_dir, board_config)?,
+    };
+    match &container {
+        // The build commands run in one container, chained like the handlers do
+        Some(spec) => {
+            let engine = container_engine(spec).unwrap_or_else(|_| "docker".to_string());
+            let env: Vec<(String, String)> = build_commands
+                .iter()
+                .flat_map(|command| command.env.clone())
+                .collect::<BTreeMap<_, _>>()
+                .into_iter()
+                .collect();
+            let command_line = build_commands
+                .iter()
+                .map(PlannedCommand::command_line)
+                .collect::<Vec<_>>()
+                .join(" && ");
+            commands.push(PlannedCommand::new("build", &engine, project_dir).args(
+                container_run_args(&engine, spec, project_dir, &env, &command_line),
+            ));
+        }
+        None => commands.extend(build_commands),
+    }
+
+    commands.extend(hook_commands(
+        HookStage::PostBuild,
+        project_dir,
+        board_config,
+    )?);
+
+    Ok(BoardPlan {
+        board: board_config.name.clone(),
+        project_type: board_config.project_type.name().to_string(),
+        target: board_config.target.clone(),
+        config_file: board_config.config_file.clone(),
+        build_dir: board_config.build_dir.clone(),
+        container: container.map(|spec| spec.image),
+        up_to_date,
+        commands,
+    })
+}
+
+/// Hooks of a stage as they are run, from the project root with the hook environment
+fn hook_commands(
+    stage: HookStage,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+) -> Result<Vec<PlannedCommand>> {
+    let env = hook_env(project_dir, board_config, stage, &[]);
+    Ok(board_hook_commands(project_dir, &board_config.name, stage)?
+        .iter()
+        .map(|command| {
+            PlannedCommand::shell(&format!("{} hook", stage.name()), project_dir, command)
+                .envs(env.iter().cloned())
+        })
+        .collect())
+}
+
+/// Human readable plan of a board, one line per command
+pub fn format_board_plan(plan: &BoardPlan) -> String {
+    let mut out = format!(
+        "📋 {} ({}, {})",
+        plan.board,
+        plan.project_type,
+        plan.target.as_deref().unwrap_or("unknown target")
+    );
+    out.push_str(&format!("\n   config:    {}", plan.config_file.display()));
+    out.push_str(&format!("\n   build dir: {}", plan.build_dir.display()));
+    if let Some(image) = &plan.container {
+        out.push_str(&format!("\n   container: {}", image));
+    }
+    if plan.up_to_date {
+        out.push_str("\n   ⏭️  Inputs unchanged since the last successful build, would be skipped (--force rebuilds)");
+    }
+
+    for (index, command) in plan.commands.iter().enumerate() {
+        out.push_str(&format!("\n   {}. [{}]", index + 1, command.step));
+        out.push_str(&format!("\n      cd {}", command.working_dir.display()));
+        for (key, value) in &command.env {
+            out.push_str(&format!("\n      {}={}", key, quote_if_needed(value)));
+        }
+        out.push_str(&format!("\n      {}", command.command_line()));
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use crate::projects::ProjectRegistry;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_build_plan_dry_run() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("CMakeLists.txt"),
+            "cmake_minimum_required(VERSION 3.16)\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.esp32s3"),
+            "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"boards:
+  esp32s3:
+    hooks:
+      pre_build: ./gen-version.sh
+      post_build: echo done
+"#,
+        )
+        .unwrap();
+
+        let board = ProjectBoardConfig {
+            name: "esp32s3".to_string(),
+            config_file: project.join("sdkconfig.defaults.esp32s3"),
+            build_dir: project.join("build.esp32s3"),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        let handler = ProjectRegistry::create_handler(ProjectType::EspIdf);
+        let plan = board_plan(handler.as_ref(), project, &board, &[], false)
+            .await
+            .unwrap();
+
+        assert!(!plan.up_to_date);
+        assert!(plan.container.is_none());
+        let steps: Vec<&str> = plan.commands.iter().map(|c| c.step.as_str()).collect();
+        assert_eq!(
+            steps,
+            vec!["pre_build hook", "set-target", "build", "post_build hook"]
+        );
+
+        // Hooks run from the project root with the board's hook environment
+        let hook = &plan.commands[0];
+        assert_eq!(hook.working_dir, project);
+        assert_eq!(hook.args.last().unwrap(), "./gen-version.sh");
+        assert_eq!(hook.env["ESPBREW_BOARD"], "esp32s3");
+        assert_eq!(hook.env["ESPBREW_HOOK"], "pre_build");
+
+        let build = &plan.commands[2];
+        assert_eq!(build.working_dir, project);
+        assert_eq!(
+            Path::new(&build.env["SDKCONFIG_DEFAULTS"]),
+            project.join("sdkconfig.defaults.esp32s3")
+        );
+        assert!(
+            build
+                .args
+                .contains(&project.join("build.esp32s3").display().to_string())
+        );
+        assert_eq!(build.args.last().unwrap(), "build");
+
+        let text = format_board_plan(&plan);
+        assert!(text.contains("1. [pre_build hook]"));
+        assert!(text.contains("SDKCONFIG_DEFAULTS="));
+
+        let json = serde_json::to_value(&plan).unwrap();
+        assert_eq!(json["board"], "esp32s3");
+        assert_eq!(json["commands"][2]["step"], "build");
+
+        let command = PlannedCommand::new("build", "idf.py", project).args(["-D", "A=it's here"]);
+        assert_eq!(command.command_line(), r#"idf.py -D 'A=it'\''s here'"#);
+    }
+}
@@ -0,0 +1,440 @@
+//! Scheduling of concurrent board builds
+//!
+//! Builds share `jobs` slots. Every board takes as many slots as its weight,
+//! ESP-IDF and the other CMake based builds more than TinyGo or MicroPython.
+//! While a build is running, no further build starts as long as the load
+//! average is above `max_load`.
+//!
+//! Waiting builds form a queue ordered by the boards' `priority:` from
+//! `espbrew.yaml`, highest first and in arrival order otherwise. Only the
+//! build at the head of the queue may take slots, and the TUI can move a
+//! waiting board forward or back.
+
+use std::path::Path;
+use std::sync::atomic::{AtomicU64, AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::sync::{Notify, OwnedSemaphorePermit, Semaphore};
+
+use crate::config::ProjectConfig;
+use crate::models::{ProjectBoardConfig, ProjectType};
+
+/// How often a throttled build checks the load average again
+const LOAD_POLL_INTERVAL: Duration = Duration::from_secs(2);
+
+/// Concurrency limits of the scheduler
+#[derive(Debug, Clone, PartialEq)]
+pub struct SchedulerSettings {
+    /// Build slots shared by all running builds
+    pub jobs: usize,
+    /// Load average above which no further build starts, `None` to never throttle
+    pub max_load: Option<f64>,
+}
+
+impl SchedulerSettings {
+    /// Settings from the command line, falling back to the `build:` section of
+    /// `espbrew.yaml` and then to one slot and a maximum load per CPU
+    pub fn resolve(project_dir: &Path, jobs: Option<usize>, max_load: Option<f64>) -> Self {
+        let section = ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .map(|config| config.build)
+            .unwrap_or_default();
+        let cpus = std::thread::available_parallelism()
+            .map(|n| n.get())
+            .unwrap_or(1);
+
+        SchedulerSettings {
+            jobs: jobs.or(section.jobs).unwrap_or(cpus).max(1),
+            max_load: max_load
+                .or(section.max_load)
+                .or(Some(cpus as f64))
+                .filter(|load| *load > 0.0),
+        }
+    }
+}
+
+/// Slots a build of the project type takes unless `espbrew.yaml` sets a weight
+pub fn default_weight(project_type: &ProjectType) -> u32 {
+    match project_type {
+        ProjectType::EspIdf
+        | ProjectType::Esp8266Rtos
+        | ProjectType::Zephyr
+        | ProjectType::NuttX
+        | ProjectType::RustNoStd
+        | ProjectType::Arduino
+        | ProjectType::PlatformIO => 2,
+        ProjectType::TinyGo
+        | ProjectType::MicroPython
+        | ProjectType::CircuitPython
+        | ProjectType::Jaculus => 1,
+    }
+}
+
+/// Weight of a board build, from its `weight:` in `espbrew.yaml` or its project type
+pub fn board_weight(project_dir: &Path, board_config: &ProjectBoardConfig) -> u32 {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.board_section(&board_config.name)?.weight)
+        .unwrap_or_else(|| default_weight(&board_config.project_type))
+        .max(1)
+}
+
+/// Start priority of a board from its `priority:` in `espbrew.yaml`, 0 without one
+pub fn board_priority(project_dir: &Path, board_name: &str) -> i32 {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.board_section(board_name)?.priority)
+        .unwrap_or(0)
+}
+
+/// 1 minute load average, where the platform reports one
+pub fn load_average() -> Option<f64> {
+    #[cfg(target_os = "linux")]
+    {
+        let content = std::fs::read_to_string("/proc/loadavg").ok()?;
+        content.split_whitespace().next()?.parse().ok()
+    }
+
+    #[cfg(target_os = "macos")]
+    {
+        // `{ 1.52 1.71 1.80 }`
+        let output = std::process::Command::new("sysctl")
+            .args(["-n", "vm.loadavg"])
+            .output()
+            .ok()?;
+        String::from_utf8_lossy(&output.stdout)
+            .split_whitespace()
+            .find_map(|field| field.parse().ok())
+    }
+
+    #[cfg(not(any(target_os = "linux", target_os = "macos")))]
+    {
+        None
+    }
+}
+
+/// A build waiting for slots
+#[derive(Debug, Clone)]
+struct QueuedBuild {
+    id: u64,
+    board: String,
+    priority: i32,
+}
+
+/// Where a queued board moves to
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum QueueMove {
+    Front,
+    Earlier,
+    Later,
+}
+
+/// Hands out build slots; clones share the same slots and queue
+#[derive(Debug, Clone)]
+pub struct BuildScheduler {
+    settings: SchedulerSettings,
+    slots: Arc<Semaphore>,
+    running: Arc<AtomicUsize>,
+    queue: Arc<Mutex<Vec<QueuedBuild>>>,
+    /// Signalled when slots are released or the queue changes
+    changed: Arc<Notify>,
+    next_id: Arc<AtomicU64>,
+}
+
+impl BuildScheduler {
+    pub fn new(settings: SchedulerSettings) -> Self {
+        BuildScheduler {
+            slots: Arc::new(Semaphore::new(settings.jobs)),
+            running: Arc::new(AtomicUsize::new(0)),
+            queue: Arc::new(Mutex::new(Vec::new())),
+            changed: Arc::new(Notify::new()),
+            next_id: Arc::new(AtomicU64::new(0)),
+            settings,
+        }
+    }
+
+    pub fn settings(&self) -> &SchedulerSettings {
+        &self.settings
+    }
+
+    /// Number of builds holding a slot
+    pub fn running(&self) -> usize {
+        self.running.load(Ordering::SeqCst)
+    }
+
+    /// Whether a build of this weight would have to wait for slots
+    pub fn is_saturated(&self, weight: u32) -> bool {
+        !self.queue.lock().unwrap().is_empty()
+            || self.slots.available_permits() < self.capped(weight) as usize
+    }
+
+    /// A weight never exceeds the slots, so every board can build eventually
+    fn capped(&self, weight: u32) -> u32 {
+        weight.clamp(1, self.settings.jobs.min(u32::MAX as usize) as u32)
+    }
+
+    /// Boards waiting for slots, in the order they will start
+    pub fn queued(&self) -> Vec<String> {
+        self.queue
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|build| !build.board.is_empty())
+            .map(|build| build.board.clone())
+            .collect()
+    }
+
+    /// Move a waiting board within the queue; `false` if it isn't waiting
+    /// or already at that end
+    pub fn move_queued(&self, board: &str, to: QueueMove) -> bool {
+        let mut queue = self.queue.lock().unwrap();
+        let Some(index) = queue.iter().position(|build| build.board == board) else {
+            return false;
+        };
+        let target = match to {
+            QueueMove::Front => 0,
+            QueueMove::Earlier => index.saturating_sub(1),
+            QueueMove::Later => (index + 1).min(queue.len() - 1),
+        };
+        if target == index {
+            return false;
+        }
+        let build = queue.remove(index);
+        queue.insert(target, build);
+        // Between its new neighbours' priorities, so later arrivals still
+        // line up by priority
+        let upper = target
+            .checked_sub(1)
+            .map_or(i32::MAX, |i| queue[i].priority);
+        let lower = queue
+            .get(target + 1)
+            .map_or(i32::MIN, |build| build.priority);
+        queue[target].priority = queue[target].priority.clamp(lower, upper);
+        drop(queue);
+        self.changed.notify_waiters();
+        true
+    }
+
+    /// Wait until `weight` slots are free and, while other builds run, the load
+    /// average is below the limit. The slots are released when the returned
+    /// guard is dropped.
+    pub async fn acquire(&self, weight: u32) -> BuildSlot {
+        self.acquire_queued("", weight, 0).await
+    }
+
+    /// Like [`Self::acquire`], waiting in the queue under the board's name
+    /// until it is at the head, so higher priorities start first
+    pub async fn acquire_queued(&self, board: &str, weight: u32, priority: i32) -> BuildSlot {
+        let ticket = self.enqueue(board, priority);
+        let weight = self.capped(weight);
+
+        let permit = loop {
+            let changed = self.changed.notified();
+            tokio::pin!(changed);
+            changed.as_mut().enable();
+
+            if self.is_head(ticket.id)
+                && let Ok(permit) = self.slots.clone().try_acquire_many_owned(weight)
+            {
+                break permit;
+            }
+            changed.await;
+        };
+        drop(ticket);
+
+        if let Some(max_load) = self.settings.max_load {
+            while self.running() > 0 && load_average().is_some_and(|load| load > max_load) {
+                tokio::time::sleep(LOAD_POLL_INTERVAL).await;
+            }
+        }
+
+        self.running.fetch_add(1, Ordering::SeqCst);
+        BuildSlot {
+            permit: Some(permit),
+            running: self.running.clone(),
+            changed: self.changed.clone(),
+        }
+    }
+
+    fn enqueue(&self, board: &str, priority: i32) -> QueueTicket {
+        let id = self.next_id.fetch_add(1, Ordering::SeqCst);
+        let mut queue = self.queue.lock().unwrap();
+        // Behind every build of the same or a higher priority
+        let index = queue
+            .iter()
+            .position(|build| build.priority < priority)
+            .unwrap_or(queue.len());
+        queue.insert(
+            index,
+            QueuedBuild {
+                id,
+                board: board.to_string(),
+                priority,
+            },
+        );
+        QueueTicket {
+            id,
+            queue: self.queue.clone(),
+            changed: self.changed.clone(),
+        }
+    }
+
+    fn is_head(&self, id: u64) -> bool {
+        self.queue
+            .lock()
+            .unwrap()
+            .first()
+            .is_some_and(|build| build.id == id)
+    }
+}
+
+/// Place of a build in the queue, left when it starts or is cancelled
+struct QueueTicket {
+    id: u64,
+    queue: Arc<Mutex<Vec<QueuedBuild>>>,
+    changed: Arc<Notify>,
+}
+
+impl Drop for QueueTicket {
+    fn drop(&mut self) {
+        self.queue
+            .lock()
+            .unwrap()
+            .retain(|build| build.id != self.id);
+        self.changed.notify_waiters();
+    }
+}
+
+/// Slots held by a running build
+#[derive(Debug)]
+pub struct BuildSlot {
+    permit: Option<OwnedSemaphorePermit>,
+    running: Arc<AtomicUsize>,
+    changed: Arc<Notify>,
+}
+
+impl Drop for BuildSlot {
+    fn drop(&mut self) {
+        self.running.fetch_sub(1, Ordering::SeqCst);
+        // Release the slots before waking the queue
+        drop(self.permit.take());
+        self.changed.notify_waiters();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_build_scheduler() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "build:\n  jobs: 4\n  max_load: 0\nboards:\n  heavy:\n    weight: 3\n",
+        )
+        .unwrap();
+
+        // --jobs wins over espbrew.yaml; a max load of 0 disables throttling
+        let settings = SchedulerSettings::resolve(project, None, None);
+        assert_eq!(settings.jobs, 4);
+        assert_eq!(settings.max_load, None);
+        assert_eq!(
+            SchedulerSettings::resolve(project, Some(2), Some(3.5)).jobs,
+            2
+        );
+        assert_eq!(
+            SchedulerSettings::resolve(project, Some(2), Some(3.5)).max_load,
+            Some(3.5)
+        );
+
+        let board = |name: &str, project_type: ProjectType| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: None,
+            project_type,
+        };
+        assert!(default_weight(&ProjectType::EspIdf) > default_weight(&ProjectType::TinyGo));
+        assert_eq!(
+            board_weight(project, &board("heavy", ProjectType::TinyGo)),
+            3
+        );
+        assert_eq!(
+            board_weight(project, &board("box", ProjectType::EspIdf)),
+            default_weight(&ProjectType::EspIdf)
+        );
+
+        let scheduler = BuildScheduler::new(settings);
+        let first = scheduler.acquire(3).await;
+        assert_eq!(scheduler.running(), 1);
+        assert!(scheduler.is_saturated(2));
+        assert!(!scheduler.is_saturated(1));
+
+        // Weights above the slot count are capped, so the build waits for all slots
+        let waiting = tokio::spawn({
+            let scheduler = scheduler.clone();
+            async move {
+                let _slot = scheduler.acquire(10).await;
+            }
+        });
+        tokio::time::sleep(std::time::Duration::from_millis(50)).await;
+        assert!(!waiting.is_finished());
+
+        drop(first);
+        waiting.await.unwrap();
+        assert_eq!(scheduler.running(), 0);
+    }
+
+    #[tokio::test]
+    async fn test_build_queue_priority() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "build:\n  jobs: 1\n  max_load: 0\nboards:\n  devkit:\n    priority: 10\n  legacy:\n    priority: -1\n",
+        )
+        .unwrap();
+        assert_eq!(board_priority(project, "devkit"), 10);
+        assert_eq!(board_priority(project, "legacy"), -1);
+        assert_eq!(board_priority(project, "box"), 0);
+
+        let scheduler = BuildScheduler::new(SchedulerSettings::resolve(project, None, None));
+        let running = scheduler.acquire(1).await;
+
+        let (started_tx, mut started) = tokio::sync::mpsc::unbounded_channel();
+        for board in ["legacy", "box", "lcd", "devkit"] {
+            let scheduler = scheduler.clone();
+            let started_tx = started_tx.clone();
+            let priority = board_priority(project, board);
+            tokio::spawn(async move {
+                let _slot = scheduler.acquire_queued(board, 1, priority).await;
+                started_tx.send(board).unwrap();
+            });
+            tokio::time::sleep(Duration::from_millis(20)).await;
+        }
+        // Higher priorities first, arrival order among equal ones
+        assert_eq!(scheduler.queued(), ["devkit", "box", "lcd", "legacy"]);
+        assert!(scheduler.is_saturated(1));
+
+        assert!(scheduler.move_queued("lcd", QueueMove::Front));
+        assert!(scheduler.move_queued("devkit", QueueMove::Later));
+        assert!(!scheduler.move_queued("legacy", QueueMove::Later));
+        assert!(!scheduler.move_queued("missing", QueueMove::Front));
+        assert_eq!(scheduler.queued(), ["lcd", "box", "devkit", "legacy"]);
+
+        drop(running);
+        let mut order = Vec::new();
+        for _ in 0..4 {
+            order.push(started.recv().await.unwrap());
+        }
+        assert_eq!(order, ["lcd", "box", "devkit", "legacy"]);
+        assert!(scheduler.queued().is_empty());
+    }
+}
@@ -0,0 +1,169 @@
+//! Build sessions: resume a build run that was interrupted
+//!
+//! `espbrew build` records the boards it is going to build in
+//! `.espbrew/session.json` and marks each one as soon as it finishes, so
+//! after Ctrl-C, a crash or a sleeping machine the file still tells which
+//! boards completed. `espbrew resume` rebuilds the pending and failed boards
+//! of that session; the file is removed once every board has succeeded.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+
+use crate::models::ProjectBoardConfig;
+
+/// Session file, relative to the project
+pub const BUILD_SESSION_FILE: &str = ".espbrew/session.json";
+
+/// Progress of a board within a session
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum SessionBoardState {
+    Pending,
+    Succeeded,
+    Failed,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SessionBoard {
+    pub name: String,
+    pub state: SessionBoardState,
+}
+
+/// Boards of a build run and the options they are built with
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct BuildSession {
+    pub started: chrono::DateTime<chrono::Local>,
+    #[serde(default)]
+    pub locked: bool,
+    #[serde(default)]
+    pub force: bool,
+    pub boards: Vec<SessionBoard>,
+}
+
+impl BuildSession {
+    /// A session with every board pending
+    pub fn new(boards: &[ProjectBoardConfig], locked: bool, force: bool) -> Self {
+        Self {
+            started: chrono::Local::now(),
+            locked,
+            force,
+            boards: boards
+                .iter()
+                .map(|board| SessionBoard {
+                    name: board.name.clone(),
+                    state: SessionBoardState::Pending,
+                })
+                .collect(),
+        }
+    }
+
+    pub fn path(project_dir: &Path) -> PathBuf {
+        project_dir.join(BUILD_SESSION_FILE)
+    }
+
+    /// The session of the project, if a build run left one behind
+    pub fn load(project_dir: &Path) -> Result<Option<Self>> {
+        let path = Self::path(project_dir);
+        if !path.exists() {
+            return Ok(None);
+        }
+
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        let session = serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", path.display()))?;
+        Ok(Some(session))
+    }
+
+    pub fn save(&self, project_dir: &Path) -> Result<()> {
+        let path = Self::path(project_dir);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        // Written aside and renamed, so an interruption never leaves half a file
+        let tmp = path.with_extension("json.tmp");
+        std::fs::write(&tmp, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("Failed to write {}", tmp.display()))?;
+        std::fs::rename(&tmp, &path).with_context(|| format!("Failed to write {}", path.display()))
+    }
+
+    /// Remove the session file of a project, if there is one
+    pub fn remove(project_dir: &Path) -> Result<()> {
+        let path = Self::path(project_dir);
+        if path.exists() {
+            std::fs::remove_file(&path)
+                .with_context(|| format!("Failed to remove {}", path.display()))?;
+        }
+        Ok(())
+    }
+
+    /// Record the result of a board's build
+    pub fn mark(&mut self, board_name: &str, success: bool) {
+        if let Some(board) = self.boards.iter_mut().find(|b| b.name == board_name) {
+            board.state = if success {
+                SessionBoardState::Succeeded
+            } else {
+                SessionBoardState::Failed
+            };
+        }
+    }
+
+    /// Boards that are pending or failed, in session order
+    pub fn unfinished(&self) -> Vec<&str> {
+        self.boards
+            .iter()
+            .filter(|b| b.state != SessionBoardState::Succeeded)
+            .map(|b| b.name.as_str())
+            .collect()
+    }
+
+    pub fn count(&self, state: SessionBoardState) -> usize {
+        self.boards.iter().filter(|b| b.state == state).count()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_build_session_resume_state() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert!(BuildSession::load(project).unwrap().is_none());
+
+        let boards: Vec<ProjectBoardConfig> = ["box", "c3", "p4"]
+            .iter()
+            .map(|name| ProjectBoardConfig {
+                name: name.to_string(),
+                config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+                build_dir: project.join(format!("build.{}", name)),
+                target: None,
+                project_type: ProjectType::EspIdf,
+            })
+            .collect();
+        let mut session = BuildSession::new(&boards, false, true);
+        session.save(project).unwrap();
+        assert_eq!(session.unfinished(), vec!["box", "c3", "p4"]);
+
+        // The build was interrupted after box succeeded and c3 failed
+        session.mark("box", true);
+        session.mark("c3", false);
+        session.save(project).unwrap();
+
+        let loaded = BuildSession::load(project).unwrap().unwrap();
+        assert!(loaded.force && !loaded.locked);
+        assert_eq!(loaded.unfinished(), vec!["c3", "p4"]);
+        assert_eq!(loaded.count(SessionBoardState::Succeeded), 1);
+        assert_eq!(loaded.count(SessionBoardState::Failed), 1);
+        assert_eq!(loaded.count(SessionBoardState::Pending), 1);
+
+        BuildSession::remove(project).unwrap();
+        assert!(BuildSession::load(project).unwrap().is_none());
+        BuildSession::remove(project).unwrap();
+    }
+}
@@ -0,0 +1,329 @@
+//! Command templates: build, flash and monitor commands from `espbrew.yaml`
+//!
+//! A project type's `commands:` entry, or a board's own `commands:`, replaces
+//! the command espbrew would run for that step with a shell command line, so
+//! custom wrappers and SDK forks still get espbrew's scheduling, hooks, retries
+//! and TUI. Placeholders such as `{board}` or `{port}` are replaced with the
+//! board's values; `{{` and `}}` stand for literal braces and `${VAR}` is left
+//! to the shell.
+
+use anyhow::{Context, Result};
+use std::path::Path;
+use tokio::sync::mpsc;
+
+use crate::config::{ContainerSpec, ProjectConfig};
+use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig};
+use crate::projects::ProjectHandler;
+use crate::projects::build_plan::quote_if_needed;
+use crate::projects::container_build::run_in_container;
+use crate::projects::device_registry::port_or_registered;
+use crate::projects::hooks::run_shell_command;
+
+/// Placeholders a template may use
+pub const PLACEHOLDERS: &[&str] = &[
+    "board",
+    "target",
+    "config_file",
+    "build_dir",
+    "project_dir",
+    "project_type",
+    "port",
+    "baud",
+];
+
+/// Step of a board a template replaces
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TemplateStep {
+    Build,
+    Flash,
+    Monitor,
+}
+
+impl TemplateStep {
+    /// Key of the template in `espbrew.yaml`
+    pub fn name(&self) -> &'static str {
+        match self {
+            TemplateStep::Build => "build",
+            TemplateStep::Flash => "flash",
+            TemplateStep::Monitor => "monitor",
+        }
+    }
+}
+
+/// Template configured for a board's step, if any
+pub fn command_template(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    step: TemplateStep,
+) -> Result<Option<String>> {
+    let Some(config) = ProjectConfig::load(project_dir)? else {
+        return Ok(None);
+    };
+    let templates = config.command_templates(&board_config.name, &board_config.project_type);
+    Ok(match step {
+        TemplateStep::Build => templates.build,
+        TemplateStep::Flash => templates.flash,
+        TemplateStep::Monitor => templates.monitor,
+    })
+}
+
+/// Replace the placeholders of a template with the board's values, quoted for the shell
+pub fn expand_template(
+    template: &str,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: Option<&str>,
+    baud_rate: Option<u32>,
+) -> Result<String> {
+    let value = |name: &str| -> Result<String> {
+        Ok(match name {
+            "board" => board_config.name.clone(),
+            "target" => board_config.target.clone().unwrap_or_default(),
+            "config_file" => board_config.config_file.display().to_string(),
+            "build_dir" => board_config.build_dir.display().to_string(),
+            "project_dir" => project_dir.display().to_string(),
+            "project_type" => board_config.project_type.config_key().to_string(),
+            "port" => port
+                .map(str::to_string)
+                .ok_or_else(|| anyhow::anyhow!("{{port}} is used but no port was given"))?,
+            "baud" => baud_rate
+                .map(|baud| baud.to_string())
+                .ok_or_else(|| anyhow::anyhow!("{{baud}} is used but no baud rate was given"))?,
+            _ => {
+                return Err(anyhow::anyhow!(
+                    "unknown placeholder {{{}}}, expected one of {}",
+                    name,
+                    PLACEHOLDERS
+                        .iter()
+                        .map(|p| format!("{{{}}}", p))
+                        .collect::<Vec<_>>()
+                        .join(", ")
+                ));
+            }
+        })
+    };
+
+    let mut out = String::new();
+    let mut rest = template;
+    while let Some(index) = rest.find(['{', '}']) {
+        out.push_str(&rest[..index]);
+        let tail = &rest[index..];
+        if tail.starts_with("{{") || tail.starts_with("}}") {
+            out.push_str(&tail[..1]);
+            rest = &tail[2..];
+        } else if tail.starts_with('}') || out.ends_with('$') {
+            // `${VAR}` belongs to the shell, as does its closing brace
+            out.push_str(&tail[..1]);
+            rest = &tail[1..];
+        } else {
+            let end = tail
+                .find('}')
+                .ok_or_else(|| anyhow::anyhow!("unclosed placeholder in '{}'", template))?;
+            out.push_str(&quote_if_needed(&value(&tail[1..end])?));
+            rest = &tail[end + 1..];
+        }
+    }
+    out.push_str(rest);
+    Ok(out)
+}
+
+/// Run a board's expanded template from the project root, or in the board's
+/// container for builds that have one
+pub async fn run_template(
+    step: TemplateStep,
+    command: &str,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    container: Option<&ContainerSpec>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    if let Some(container) = container {
+        return run_in_container(
+            project_dir,
+            board_config,
+            container,
+            &[],
+            command,
+            tx.clone(),
+        )
+        .await;
+    }
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("🧩 Running {} template: {}", step.name(), command),
+    ));
+    let status = run_shell_command(project_dir, command, &[], &board_config.name, tx)
+        .await
+        .with_context(|| format!("Failed to run {} template: {}", step.name(), command))?;
+    if !status.success() {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("❌ {} template failed: {}", step.name(), command),
+        ));
+        return Err(anyhow::anyhow!(
+            "{} template '{}' failed with {}",
+            step.name(),
+            command,
+            status
+        ));
+    }
+    Ok(())
+}
+
+/// Build a board with its build template and collect the images it left in the build directory
+pub async fn build_with_template(
+    template: &str,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    container: Option<&ContainerSpec>,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<BuildArtifact>> {
+    let command = expand_template(template, project_dir, board_config, None, None)?;
+    run_template(
+        TemplateStep::Build,
+        &command,
+        project_dir,
+        board_config,
+        container,
+        &tx,
+    )
+    .await?;
+
+    let artifacts = template_artifacts(&project_dir.join(&board_config.build_dir));
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "✅ Template build completed, {} image(s) in {}",
+            artifacts.len(),
+            board_config.build_dir.display()
+        ),
+    ));
+    Ok(artifacts)
+}
+
+/// Monitor a board with its monitor template, or the handler's monitor without
+/// one. Without a port the board's registered device is monitored, if it has one.
+pub async fn monitor_board(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: Option<&str>,
+    baud_rate: u32,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let port = port_or_registered(project_dir, &board_config.name, port, &tx).await?;
+    let port = port.as_deref();
+    match command_template(project_dir, board_config, TemplateStep::Monitor)? {
+        Some(template) => {
+            let command =
+                expand_template(&template, project_dir, board_config, port, Some(baud_rate))?;
+            run_template(
+                TemplateStep::Monitor,
+                &command,
+                project_dir,
+                board_config,
+                None,
+                &tx,
+            )
+            .await
+        }
+        None => {
+            handler
+                .monitor_board(project_dir, board_config, port, baud_rate, tx)
+                .await
+        }
+    }
+}
+
+/// `.elf` and `.bin` files at the top of a build directory
+pub fn template_artifacts(build_dir: &Path) -> Vec<BuildArtifact> {
+    let Ok(entries) = std::fs::read_dir(build_dir) else {
+        return Vec::new();
+    };
+    let mut artifacts: Vec<BuildArtifact> = entries
+        .filter_map(|entry| entry.ok().map(|entry| entry.path()))
+        .filter_map(|path| {
+            let artifact_type = match path.extension()?.to_str()? {
+                "elf" => ArtifactType::Elf,
+                "bin" => ArtifactType::Binary,
+                _ => return None,
+            };
+            Some(BuildArtifact {
+                name: path.file_stem()?.to_string_lossy().to_string(),
+                file_path: path,
+                artifact_type,
+                offset: None,
+            })
+        })
+        .collect();
+    artifacts.sort_by(|a, b| a.file_path.cmp(&b.file_path));
+    artifacts
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_command_templates() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"commands:
+  esp_idf:
+    build: "mkdir -p {build_dir} && echo ${NO_SUCH_VAR:-home} {board} > {build_dir}/{board}.bin"
+    monitor: "miniterm {port} {baud}"
+boards:
+  special:
+    commands:
+      build: "./vendor-build.sh {{custom}} {target}"
+"#,
+        )
+        .unwrap();
+
+        let board = |name: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build dir.{}", name)),
+            target: Some("esp32c3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+
+        // A board's own template wins over its project type's
+        let special = board("special");
+        let build = command_template(project, &special, TemplateStep::Build)
+            .unwrap()
+            .unwrap();
+        assert_eq!(
+            expand_template(&build, project, &special, None, None).unwrap(),
+            "./vendor-build.sh {custom} esp32c3"
+        );
+        assert!(
+            command_template(project, &special, TemplateStep::Flash)
+                .unwrap()
+                .is_none()
+        );
+
+        let monitor = command_template(project, &special, TemplateStep::Monitor)
+            .unwrap()
+            .unwrap();
+        assert_eq!(
+            expand_template(
+                &monitor,
+                project,
+                &special,
+                Some("/dev/ttyUSB0"),
+                Some(115200)
+            )
+            .unwrap(),
+            "miniterm /dev/ttyUSB0 115200"
+        );
+        assert!(expand_template(&monitor, project, &special, None, Some(115200)).is_err());
+        assert!(expand_template("make {bord}", project, &special, None, None).is_err());
+    }
+}
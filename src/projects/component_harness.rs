@@ -0,0 +1,173 @@
+//! Component-only build mode for ESP-IDF component repositories
+//!
+//! A repository that only contains an IDF component has no application to
+//! build. espbrew generates a minimal harness app per target chip in
+//! `build.component/<target>/` that depends on the component through
+//! `override_path`, so every chip becomes a board of a compile matrix.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+use crate::config::ProjectConfig;
+use crate::models::ProjectBoardConfig;
+use crate::utils::idf_components::COMPONENT_MANIFEST_FILE;
+
+/// Directory holding the generated harness apps, relative to the component root
+pub const HARNESS_DIR: &str = "build.component";
+
+/// Chips a component is built for when neither `espbrew.yaml` nor the manifest restrict them
+pub const DEFAULT_COMPONENT_TARGETS: &[&str] = &[
+    "esp32", "esp32s2", "esp32s3", "esp32c2", "esp32c3", "esp32c5", "esp32c6", "esp32h2", "esp32p4",
+];
+
+/// Whether the directory is a bare IDF component: it registers a component
+/// but has no top-level `project.cmake` application
+pub fn is_component_repository(project_dir: &Path) -> bool {
+    let Ok(cmake) = std::fs::read_to_string(project_dir.join("CMakeLists.txt")) else {
+        return false;
+    };
+
+    cmake.contains("idf_component_register") && !cmake.contains("tools/cmake/project.cmake")
+}
+
+/// Component name as seen by the build system (the directory name)
+pub fn component_name(project_dir: &Path) -> String {
+    let dir = project_dir
+        .canonicalize()
+        .unwrap_or_else(|_| project_dir.to_path_buf());
+    dir.file_name()
+        .map(|n| n.to_string_lossy().to_string())
+        .unwrap_or_else(|| "component".to_string())
+}
+
+/// Targets to build: `esp_idf.component_targets` in `espbrew.yaml`, then the
+/// manifest's `targets` list, then every ESP-IDF chip
+pub fn component_targets(project_dir: &Path) -> Vec<String> {
+    let configured = ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.esp_idf)
+        .map(|section| section.component_targets)
+        .unwrap_or_default();
+    if !configured.is_empty() {
+        return configured;
+    }
+
+    let manifest_targets: Vec<String> =
+        std::fs::read_to_string(project_dir.join(COMPONENT_MANIFEST_FILE))
+            .ok()
+            .and_then(|content| serde_yaml::from_str::<serde_yaml::Value>(&content).ok())
+            .and_then(|manifest| {
+                manifest
+                    .get("targets")
+                    .and_then(|t| t.as_sequence())
+                    .map(|targets| {
+                        targets
+                            .iter()
+                            .filter_map(|t| t.as_str().map(|t| t.to_string()))
+                            .collect()
+                    })
+            })
+            .unwrap_or_default();
+    if !manifest_targets.is_empty() {
+        return manifest_targets;
+    }
+
+    DEFAULT_COMPONENT_TARGETS
+        .iter()
+        .map(|t| t.to_string())
+        .collect()
+}
+
+/// Harness app directory of a target
+pub fn harness_dir(project_dir: &Path, target: &str) -> PathBuf {
+    project_dir.join(HARNESS_DIR).join(target)
+}
+
+/// One board per target, each building its own harness app
+pub fn discover_component_boards(project_dir: &Path) -> Vec<ProjectBoardConfig> {
+    component_targets(project_dir)
+        .into_iter()
+        .map(|target| {
+            let harness = harness_dir(project_dir, &target);
+            ProjectBoardConfig {
+                name: target.clone(),
+                config_file: harness.join("sdkconfig.defaults"),
+                build_dir: harness.join("build"),
+                target: Some(target),
+                project_type: crate::models::ProjectType::EspIdf,
+            }
+        })
+        .collect()
+}
+
+/// Harness directory of a board, if the board is a component-mode board
+pub fn board_harness_dir(project_dir: &Path, board_config: &ProjectBoardConfig) -> Option<PathBuf> {
+    if !board_config
+        .config_file
+        .starts_with(project_dir.join(HARNESS_DIR))
+    {
+        return None;
+    }
+    board_config.config_file.parent().map(Path::to_path_buf)
+}
+
+/// Write (or refresh) the harness app of a target and return its directory.
+///
+/// Files are only rewritten when their content changes, so repeated builds
+/// don't trigger a CMake reconfigure.
+pub fn write_harness(project_dir: &Path, target: &str) -> Result<PathBuf> {
+    let harness = harness_dir(project_dir, target);
+    let name = component_name(project_dir);
+    let component_path = project_dir
+        .canonicalize()
+        .unwrap_or_else(|_| project_dir.to_path_buf());
+
+    let files = [
+        (
+            harness.join("CMakeLists.txt"),
+            format!(
+                "# Generated by espbrew: {} test harness ({})\ncmake_minimum_required(VERSION 3.16)\ninclude($ENV{{IDF_PATH}}/tools/cmake/project.cmake)\nproject({}_harness)\n",
+                name, target, name
+            ),
+        ),
+        (
+            harness.join("sdkconfig.defaults"),
+            format!("CONFIG_IDF_TARGET=\"{}\"\n", target),
+        ),
+        (
+            harness.join("main").join("CMakeLists.txt"),
+            format!(
+                "idf_component_register(SRCS \"main.c\" PRIV_REQUIRES {})\n",
+                name
+            ),
+        ),
+        (
+            harness.join("main").join("main.c"),
+            "// Generated by espbrew: links the component under test\nvoid app_main(void)\n{\n}\n"
+                .to_string(),
+        ),
+        (
+            harness.join("main").join(COMPONENT_MANIFEST_FILE),
+            format!(
+                "dependencies:\n  {}:\n    override_path: '{}'\n",
+                name,
+                component_path.display().to_string().replace('\'', "''")
+            ),
+        ),
+    ];
+
+    for (path, content) in &files {
+        if std::fs::read_to_string(path).ok().as_deref() == Some(content.as_str()) {
+            continue;
+        }
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        std::fs::write(path, content)
+            .with_context(|| format!("Failed to write {}", path.display()))?;
+    }
+
+    Ok(harness)
+}
@@ -0,0 +1,312 @@
+//! Console scripts run against monitored devices
+//!
+//! The `monitor: scripts:` of `espbrew.yaml` are small interactions for
+//! bring-up and smoke checks: wait for a prompt, send `wifi join ...`, expect
+//! `got ip`. **E** in the serial monitor view runs one against the selected
+//! pane's device. An `expect` step waits for a line, or the prompt being
+//! printed, matching its regex; `send` writes a line with the console's line
+//! ending, `${NAME}` taken from the environment so credentials stay out of
+//! the project; `sleep_ms` pauses. The script fails when an `expect` times
+//! out.
+
+use anyhow::{Context, Result};
+use regex::Regex;
+use std::path::Path;
+use std::time::{Duration, Instant};
+
+use crate::config::{ProjectConfig, ScriptSection, ScriptStepSection};
+
+/// Seconds an `expect` step waits by default
+pub const DEFAULT_EXPECT_TIMEOUT_S: u64 = 10;
+
+/// A step of a console script
+#[derive(Debug, Clone)]
+pub enum ScriptStep {
+    /// Wait for output matching the regex
+    Expect {
+        regex: Regex,
+        timeout: Duration,
+    },
+    /// Send the line, before the line ending and expanding `${NAME}`
+    Send(String),
+    Sleep(Duration),
+}
+
+impl ScriptStep {
+    fn new(section: &ScriptStepSection, default_timeout: Duration) -> Result<Self> {
+        match (&section.expect, &section.send, section.sleep_ms) {
+            (Some(pattern), None, None) => Ok(ScriptStep::Expect {
+                regex: Regex::new(pattern)
+                    .with_context(|| format!("Invalid expect regex '{}'", pattern))?,
+                timeout: section
+                    .timeout_s
+                    .map_or(default_timeout, Duration::from_secs),
+            }),
+            (None, Some(line), None) => Ok(ScriptStep::Send(line.clone())),
+            (None, None, Some(ms)) => Ok(ScriptStep::Sleep(Duration::from_millis(ms))),
+            _ => Err(anyhow::anyhow!(
+                "A step has one of expect, send or sleep_ms"
+            )),
+        }
+    }
+}
+
+/// A script of `espbrew.yaml`, its regexes compiled
+#[derive(Debug, Clone)]
+pub struct ConsoleScript {
+    pub name: String,
+    pub steps: Vec<ScriptStep>,
+}
+
+impl ConsoleScript {
+    pub fn new(section: &ScriptSection) -> Result<Self> {
+        let timeout = Duration::from_secs(section.timeout_s.unwrap_or(DEFAULT_EXPECT_TIMEOUT_S));
+        let steps = section
+            .steps
+            .iter()
+            .enumerate()
+            .map(|(index, step)| {
+                ScriptStep::new(step, timeout)
+                    .with_context(|| format!("Step {} of script {}", index + 1, section.name))
+            })
+            .collect::<Result<Vec<_>>>()?;
+        if steps.is_empty() {
+            return Err(anyhow::anyhow!("Script {} has no steps", section.name));
+        }
+        Ok(Self {
+            name: section.name.clone(),
+            steps,
+        })
+    }
+}
+
+/// The scripts of the project's `espbrew.yaml`, skipping invalid ones
+pub fn configured_scripts(project_dir: &Path) -> Vec<ConsoleScript> {
+    let Ok(Some(config)) = ProjectConfig::load(project_dir) else {
+        return Vec::new();
+    };
+    config
+        .monitor
+        .scripts
+        .iter()
+        .filter_map(|section| match ConsoleScript::new(section) {
+            Ok(script) => Some(script),
+            Err(e) => {
+                log::warn!("Console script skipped: {:#}", e);
+                None
+            }
+        })
+        .collect()
+}
+
+/// `${NAME}` of the text replaced by the environment variable
+pub fn expand_env(text: &str) -> Result<String> {
+    let mut expanded = String::new();
+    let mut rest = text;
+    while let Some(start) = rest.find("${") {
+        let end = rest[start..]
+            .find('}')
+            .ok_or_else(|| anyhow::anyhow!("Unclosed ${{ in '{}'", text))?;
+        let name = &rest[start + 2..start + end];
+        let value = std::env::var(name)
+            .with_context(|| format!("{} isn't set in the environment", name))?;
+        expanded.push_str(&rest[..start]);
+        expanded.push_str(&value);
+        rest = &rest[start + end + 1..];
+    }
+    expanded.push_str(rest);
+    Ok(expanded)
+}
+
+/// What running a script does
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ScriptEvent {
+    /// Line to write to the device, without the line ending
+    Send(String),
+    /// Output an `expect` step waited for
+    Matched(String),
+    Passed,
+    Failed(String),
+}
+
+/// A script running against a pane's device
+#[derive(Debug, Clone)]
+pub struct ScriptRun {
+    pub script: ConsoleScript,
+    /// Step being taken
+    pub step: usize,
+    /// Since when the step is being taken
+    since: Instant,
+    /// Prompt an `expect` matched, not matched again until its line ends
+    matched_partial: Option<String>,
+    pub finished: bool,
+}
+
+impl ScriptRun {
+    /// Start the script at `now`; its first steps are taken on the next poll
+    pub fn start(script: ConsoleScript, now: Instant) -> Self {
+        Self {
+            script,
+            step: 0,
+            since: now,
+            matched_partial: None,
+            finished: false,
+        }
+    }
+
+    /// A line the device printed
+    pub fn on_line(&mut self, line: &str, now: Instant) -> Vec<ScriptEvent> {
+        self.matched_partial = None;
+        self.advance(Some(line), false, now)
+    }
+
+    /// Take the steps due at `now`; `partial` is the line being printed,
+    /// e.g. a prompt waiting for input
+    pub fn poll(&mut self, partial: &str, now: Instant) -> Vec<ScriptEvent> {
+        let output = (!partial.trim().is_empty()
+            && self.matched_partial.as_deref() != Some(partial))
+        .then_some(partial);
+        self.advance(output, true, now)
+    }
+
+    fn advance(
+        &mut self,
+        mut output: Option<&str>,
+        partial: bool,
+        now: Instant,
+    ) -> Vec<ScriptEvent> {
+        let mut events = Vec::new();
+        while !self.finished {
+            let Some(step) = self.script.steps.get(self.step) else {
+                self.finished = true;
+                events.push(ScriptEvent::Passed);
+                break;
+            };
+            match step {
+                ScriptStep::Send(line) => match expand_env(line) {
+                    Ok(line) => events.push(ScriptEvent::Send(line)),
+                    Err(e) => {
+                        self.finished = true;
+                        events.push(ScriptEvent::Failed(format!("{:#}", e)));
+                        break;
+                    }
+                },
+                ScriptStep::Sleep(duration) => {
+                    if now.duration_since(self.since) < *duration {
+                        break;
+                    }
+                }
+                ScriptStep::Expect { regex, timeout } => {
+                    if let Some(text) = output.take()
+                        && regex.is_match(text)
+                    {
+                        if partial {
+                            self.matched_partial = Some(text.to_string());
+                        }
+                        events.push(ScriptEvent::Matched(text.trim().to_string()));
+                    } else if now.duration_since(self.since) >= *timeout {
+                        self.finished = true;
+                        events.push(ScriptEvent::Failed(format!(
+                            "no output matched '{}' within {}s",
+                            regex.as_str(),
+                            timeout.as_secs()
+                        )));
+                        break;
+                    } else {
+                        break;
+                    }
+                }
+            }
+            self.step += 1;
+            self.since = now;
+        }
+        events
+    }
+
+    /// e.g. `wifi 2/5`
+    pub fn progress(&self) -> String {
+        format!(
+            "{} {}/{}",
+            self.script.name,
+            (self.step + 1).min(self.script.steps.len()),
+            self.script.steps.len()
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_console_scripts() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"monitor:
+  scripts:
+    - name: wifi
+      steps:
+        - expect: 'esp32> $'
+        - send: wifi join ${ESPBREW_TEST_SSID}
+        - expect: 'got ip'
+          timeout_s: 30
+        - sleep_ms: 500
+        - send: ping
+    - name: broken
+      steps:
+        - expect: 'a'
+          send: 'b'
+    - name: empty
+"#,
+        )
+        .unwrap();
+        let scripts = configured_scripts(project);
+        assert_eq!(scripts.len(), 1);
+        assert_eq!(scripts[0].steps.len(), 5);
+
+        unsafe { std::env::set_var("ESPBREW_TEST_SSID", "lab") };
+        assert_eq!(
+            expand_env("join ${ESPBREW_TEST_SSID} now").unwrap(),
+            "join lab now"
+        );
+        assert!(expand_env("join ${ESPBREW_TEST_UNSET_VAR}").is_err());
+
+        let start = Instant::now();
+        let mut run = ScriptRun::start(scripts[0].clone(), start);
+        assert!(run.poll("", start).is_empty());
+        assert_eq!(run.progress(), "wifi 1/5");
+        // The prompt has no newline yet
+        assert_eq!(
+            run.poll("esp32> ", start),
+            [
+                ScriptEvent::Matched("esp32>".to_string()),
+                ScriptEvent::Send("wifi join lab".to_string()),
+            ]
+        );
+        assert!(run.on_line("I (100) wifi: connecting", start).is_empty());
+        let t = start + Duration::from_secs(2);
+        assert_eq!(
+            run.on_line("I (2000) esp_netif: got ip:192.168.1.5", t),
+            [ScriptEvent::Matched(
+                "I (2000) esp_netif: got ip:192.168.1.5".to_string()
+            )]
+        );
+        assert!(run.poll("", t + Duration::from_millis(100)).is_empty());
+        assert_eq!(
+            run.poll("", t + Duration::from_millis(600)),
+            [ScriptEvent::Send("ping".to_string()), ScriptEvent::Passed]
+        );
+        assert!(run.finished);
+
+        let mut run = ScriptRun::start(scripts[0].clone(), start);
+        assert!(run.poll("", start + Duration::from_secs(9)).is_empty());
+        match run.poll("", start + Duration::from_secs(10)).as_slice() {
+            [ScriptEvent::Failed(error)] => assert!(error.contains("within 10s")),
+            events => panic!("Expected a timeout, got {:?}", events),
+        }
+    }
+}
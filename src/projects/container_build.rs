@@ -0,0 +1,212 @@
+//! Board builds inside Docker or Podman containers
+//!
+//! The workspace is mounted at its host path, so build directories, CMake
+//! caches and artifact paths are the same inside and outside the container
+//! and flashing and monitoring keep running on the host.
+
+use anyhow::{Context, Result};
+use std::path::Path;
+use tokio::io::{AsyncBufReadExt, BufReader};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::{ContainerSpec, ProjectConfig};
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::utils::compiler_cache::workspace_root;
+use crate::utils::process_group;
+
+/// Supported container engines, in order of preference
+const ENGINES: &[&str] = &["docker", "podman"];
+
+/// Container configured for a board in `espbrew.yaml`
+pub fn board_container(project_dir: &Path, board_name: &str) -> Option<ContainerSpec> {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.board_container(board_name))
+}
+
+/// Engine to run a container with: the spec's, `$ESPBREW_CONTAINER_ENGINE`, or
+/// the first one installed
+pub fn container_engine(spec: &ContainerSpec) -> Result<String> {
+    if let Some(engine) = spec
+        .engine
+        .clone()
+        .or_else(|| std::env::var("ESPBREW_CONTAINER_ENGINE").ok())
+    {
+        return Ok(engine);
+    }
+    ENGINES
+        .iter()
+        .find(|engine| which::which(engine).is_ok())
+        .map(|engine| engine.to_string())
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "Building in {} needs docker or podman, neither was found",
+                spec.image
+            )
+        })
+}
+
+/// `<engine> run` arguments for running `command` in the project directory
+pub fn container_run_args(
+    engine: &str,
+    spec: &ContainerSpec,
+    project_dir: &Path,
+    env: &[(String, String)],
+    command: &str,
+) -> Vec<String> {
+    let mount = workspace_root(project_dir).display().to_string();
+    let mut args = vec![
+        "run".to_string(),
+        "--rm".to_string(),
+        "-v".to_string(),
+        format!("{}:{}", mount, mount),
+        "-w".to_string(),
+        project_dir.display().to_string(),
+    ];
+
+    // Docker runs as root unless told otherwise, which would leave root owned
+    // build directories behind; rootless Podman already maps the host user
+    if engine.ends_with("docker")
+        && let Some(user) = host_user()
+    {
+        args.extend(["--user".to_string(), user]);
+        args.extend(["-e".to_string(), "HOME=/tmp".to_string()]);
+    }
+
+    for (key, value) in env {
+        args.extend(["-e".to_string(), format!("{}={}", key, value)]);
+    }
+    args.extend(spec.args.iter().cloned());
+    args.push(spec.image.clone());
+    args.extend(["sh".to_string(), "-c".to_string(), command.to_string()]);
+    args
+}
+
+/// `uid:gid` of the current user on Unix hosts
+fn host_user() -> Option<String> {
+    if !cfg!(unix) {
+        return None;
+    }
+    let id = |flag: &str| -> Option<String> {
+        let output = std::process::Command::new("id").arg(flag).output().ok()?;
+        output
+            .status
+            .success()
+            .then(|| String::from_utf8_lossy(&output.stdout).trim().to_string())
+    };
+    Some(format!("{}:{}", id("-u")?, id("-g")?))
+}
+
+/// Run a shell command for a board inside its container, streaming the output
+pub async fn run_in_container(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    spec: &ContainerSpec,
+    env: &[(String, String)],
+    command: &str,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let engine = container_engine(spec)?;
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("🐳 Building in {} with {}: {}", spec.image, engine, command),
+    ));
+
+    let mut cmd = Command::new(&engine);
+    cmd.args(container_run_args(&engine, spec, project_dir, env, command))
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped());
+    let mut child =
+        process_group::spawn(&mut cmd).with_context(|| format!("Failed to start {}", engine))?;
+    let stdout = child.stdout.take().unwrap();
+    let stderr = child.stderr.take().unwrap();
+
+    let tx_stdout = tx.clone();
+    let tx_stderr = tx.clone();
+    let board_name_stdout = board_config.name.clone();
+    let board_name_stderr = board_config.name.clone();
+
+    tokio::spawn(async move {
+        let mut lines = BufReader::new(stdout).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+        }
+    });
+
+    tokio::spawn(async move {
+        let mut lines = BufReader::new(stderr).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+        }
+    });
+
+    let status = child
+        .wait()
+        .await
+        .with_context(|| format!("Failed to wait for {}", engine))?;
+    if !status.success() {
+        return Err(anyhow::anyhow!(
+            "Container build of {} in {} failed",
+            board_config.name,
+            spec.image
+        ));
+    }
+    Ok(())
+}
+
+/// Quote a value for `sh -c`
+pub fn shell_quote(value: &str) -> String {
+    format!("'{}'", value.replace('\'', r"'\''"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_board_container() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  box:\n    container: espressif/idf:v5.3\n  legacy:\n    container:\n      image: espressif/idf:v4.4\n      engine: podman\n      args: [--network=host]\n",
+        )
+        .unwrap();
+
+        let box_container = board_container(project, "box").unwrap();
+        assert_eq!(box_container.image, "espressif/idf:v5.3");
+        assert_eq!(box_container.engine, None);
+        // Boards without a container build on the host
+        assert!(board_container(project, "c3").is_none());
+
+        let legacy = board_container(project, "legacy").unwrap();
+        assert_eq!(
+            legacy,
+            ContainerSpec {
+                image: "espressif/idf:v4.4".to_string(),
+                engine: Some("podman".to_string()),
+                args: vec!["--network=host".to_string()],
+            }
+        );
+        assert_eq!(container_engine(&legacy).unwrap(), "podman");
+
+        let env = vec![(
+            "SDKCONFIG_DEFAULTS".to_string(),
+            "/w/sdkconfig.defaults".to_string(),
+        )];
+        let args = container_run_args("podman", &legacy, project, &env, "idf.py build");
+        let mount = format!("{}:{}", project.display(), project.display());
+        assert_eq!(&args[..4], &["run", "--rm", "-v", mount.as_str()]);
+        assert!(args.contains(&"SDKCONFIG_DEFAULTS=/w/sdkconfig.defaults".to_string()));
+        // Engine arguments go before the image, the command after it
+        let image = args.iter().position(|a| a == "espressif/idf:v4.4").unwrap();
+        assert!(args.iter().position(|a| a == "--network=host").unwrap() < image);
+        assert_eq!(&args[image + 1..], &["sh", "-c", "idf.py build"]);
+
+        assert_eq!(shell_quote("it's"), r"'it'\''s'");
+    }
+}
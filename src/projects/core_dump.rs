@@ -0,0 +1,269 @@
+//! Core dumps of crashed ESP-IDF devices
+//!
+//! A device built with `CONFIG_ESP_COREDUMP_ENABLE_TO_UART` prints its core
+//! dump base64-encoded between `CORE DUMP START` and `CORE DUMP END` lines;
+//! one built with `CONFIG_ESP_COREDUMP_ENABLE_TO_FLASH` reports that it saved
+//! the dump to its `coredump` partition, where it is read from after the
+//! reboot. Either way `espcoredump.py info_corefile` decodes it with the ELF
+//! of the board's last build into a crash report: the panic reason, the
+//! registers and the backtraces of all tasks. Printed dumps are kept in
+//! `.espbrew/coredumps/`, next to the reports saved for bug reports.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+
+use crate::models::board::CoreDumpReport;
+use crate::projects::nvs_image::port_slug;
+
+/// Dumps and saved reports, relative to the project
+pub const CORE_DUMPS_DIR: &str = ".espbrew/coredumps";
+
+/// What a monitor line means for capturing a core dump
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum CoreDumpLine {
+    /// A dump is printed from the next line on
+    Start,
+    End,
+    /// The device saved a dump to its flash
+    SavedToFlash,
+    Other,
+}
+
+pub fn core_dump_line(line: &str) -> CoreDumpLine {
+    if line.contains("CORE DUMP START") {
+        CoreDumpLine::Start
+    } else if line.contains("CORE DUMP END") {
+        CoreDumpLine::End
+    } else if line
+        .to_lowercase()
+        .contains("core dump has been saved to flash")
+    {
+        CoreDumpLine::SavedToFlash
+    } else {
+        CoreDumpLine::Other
+    }
+}
+
+/// `.espbrew/coredumps/<board or port>-<time>`, the path of a dump's files
+/// without extension
+pub fn core_dump_stem(
+    project_dir: &Path,
+    board: Option<&str>,
+    port: &str,
+    captured: DateTime<Local>,
+) -> PathBuf {
+    let name = board.map_or_else(|| port_slug(port), str::to_string);
+    project_dir
+        .join(CORE_DUMPS_DIR)
+        .join(format!("{}-{}", name, captured.format("%Y%m%d-%H%M%S")))
+}
+
+/// Board names may have dots, which `Path::with_extension` would cut off
+fn with_extension(stem: &Path, extension: &str) -> PathBuf {
+    PathBuf::from(format!("{}.{}", stem.display(), extension))
+}
+
+/// `espcoredump.py` arguments decoding a dump with `elf`: the base64
+/// `core_file` of a printed dump, or the dump in the flash of the device on `port`
+pub fn espcoredump_args(
+    chip: Option<&str>,
+    port: &str,
+    core_file: Option<&Path>,
+    elf: &Path,
+) -> Vec<String> {
+    let mut args = Vec::new();
+    if let Some(chip) = chip {
+        args.extend(["--chip".to_string(), chip.to_string()]);
+    }
+    if core_file.is_none() {
+        args.extend(["--port".to_string(), port.to_string()]);
+    }
+    args.push("info_corefile".to_string());
+    if let Some(core_file) = core_file {
+        args.extend([
+            "--core-format".to_string(),
+            "b64".to_string(),
+            "--core".to_string(),
+            core_file.display().to_string(),
+        ]);
+    }
+    args.push(elf.display().to_string());
+    args
+}
+
+async fn run_espcoredump(args: &[String]) -> Result<String> {
+    let output = Command::new("espcoredump.py")
+        .args(args)
+        .output()
+        .await
+        .context("Failed to start espcoredump.py, is ESP-IDF's environment set up?")?;
+    if !output.status.success() {
+        let stderr = String::from_utf8_lossy(&output.stderr);
+        return Err(anyhow::anyhow!(
+            "espcoredump.py failed: {}",
+            stderr.lines().last().unwrap_or("").trim()
+        ));
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).into_owned())
+}
+
+/// Decode the dump the device on `port` printed, the base64 lines between its
+/// markers, or with `dump` `None` the one it saved to its flash
+pub async fn decode_core_dump(
+    project_dir: &Path,
+    port: &str,
+    board: Option<String>,
+    elf: Option<PathBuf>,
+    chip: Option<String>,
+    dump: Option<Vec<String>>,
+) -> CoreDumpReport {
+    let captured = Local::now();
+    let stem = core_dump_stem(project_dir, board.as_deref(), port, captured);
+    let mut dump_file = None;
+    let report: Result<String> = async {
+        // Kept before anything else, to decode it again once the ELF is there
+        if let Some(lines) = &dump {
+            let path = with_extension(&stem, "b64");
+            if let Some(parent) = path.parent() {
+                std::fs::create_dir_all(parent)
+                    .with_context(|| format!("Failed to create {}", parent.display()))?;
+            }
+            std::fs::write(&path, lines.join("\n") + "\n")
+                .with_context(|| format!("Failed to write {}", path.display()))?;
+            dump_file = Some(path);
+        }
+        let elf = elf.as_deref().ok_or_else(|| match &board {
+            Some(board) => anyhow::anyhow!("No ELF of {} found, build it first", board),
+            None => anyhow::anyhow!("The device's board is unknown, so is its ELF"),
+        })?;
+        run_espcoredump(&espcoredump_args(
+            chip.as_deref(),
+            port,
+            dump_file.as_deref(),
+            elf,
+        ))
+        .await
+    }
+    .await;
+
+    CoreDumpReport {
+        port: port.to_string(),
+        board,
+        captured,
+        from_flash: dump.is_none(),
+        elf,
+        report: report.map_err(|e| format!("{:#}", e)),
+        dump_file,
+        saved: None,
+        scroll_offset: 0,
+    }
+}
+
+/// Save the report next to its dump, for bug reports
+pub fn save_report(project_dir: &Path, report: &CoreDumpReport) -> Result<PathBuf> {
+    let stem = core_dump_stem(
+        project_dir,
+        report.board.as_deref(),
+        &report.port,
+        report.captured,
+    );
+    let path = with_extension(&stem, "txt");
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)
+            .with_context(|| format!("Failed to create {}", parent.display()))?;
+    }
+    std::fs::write(&path, report.text())
+        .with_context(|| format!("Failed to write {}", path.display()))?;
+    Ok(path)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_core_dump_capture() {
+        assert_eq!(
+            core_dump_line("================= CORE DUMP START ================="),
+            CoreDumpLine::Start
+        );
+        assert_eq!(
+            core_dump_line("================= CORE DUMP END ================="),
+            CoreDumpLine::End
+        );
+        assert_eq!(
+            core_dump_line("I (1807) esp_core_dump_flash: Core dump has been saved to flash."),
+            CoreDumpLine::SavedToFlash
+        );
+        assert_eq!(core_dump_line("FAAAAAkAAAAXAQAA..."), CoreDumpLine::Other);
+
+        // A printed dump is decoded from its file, one saved to flash from the device
+        let elf = Path::new("build/sensor.elf");
+        assert_eq!(
+            espcoredump_args(
+                Some("esp32s3"),
+                "/dev/ttyUSB0",
+                Some(Path::new("dump.b64")),
+                elf
+            ),
+            [
+                "--chip",
+                "esp32s3",
+                "info_corefile",
+                "--core-format",
+                "b64",
+                "--core",
+                "dump.b64",
+                "build/sensor.elf"
+            ]
+        );
+        assert_eq!(
+            espcoredump_args(None, "/dev/ttyUSB0", None, elf),
+            [
+                "--port",
+                "/dev/ttyUSB0",
+                "info_corefile",
+                "build/sensor.elf"
+            ]
+        );
+
+        let temp_dir = TempDir::new().unwrap();
+        let captured = chrono::Local::now();
+        let stem = core_dump_stem(temp_dir.path(), None, "/dev/ttyUSB0", captured);
+        assert!(
+            stem.file_name()
+                .unwrap()
+                .to_string_lossy()
+                .starts_with("_dev_ttyUSB0-")
+        );
+
+        let report = CoreDumpReport {
+            port: "/dev/ttyUSB0".to_string(),
+            board: Some("esp32.s3".to_string()),
+            captured,
+            from_flash: false,
+            elf: Some(PathBuf::from("build/sensor.elf")),
+            report: Ok("Crashed task: main\n".to_string()),
+            dump_file: None,
+            saved: None,
+            scroll_offset: 0,
+        };
+        let saved = save_report(temp_dir.path(), &report).unwrap();
+        // Dots of board names stay in the file name
+        assert!(saved.to_string_lossy().ends_with(".txt"));
+        assert!(
+            saved
+                .file_name()
+                .unwrap()
+                .to_string_lossy()
+                .starts_with("esp32.s3-")
+        );
+        let text = std::fs::read_to_string(saved).unwrap();
+        assert!(text.starts_with("Core dump of esp32.s3@/dev/ttyUSB0 captured"));
+        assert!(text.contains("ELF: build/sensor.elf\n"));
+        assert!(text.ends_with("Crashed task: main\n"));
+    }
+}
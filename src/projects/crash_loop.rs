@@ -0,0 +1,307 @@
+//! Reboot loops of the monitored devices
+//!
+//! Every boot of an ESP chip starts with the ROM's `rst:0x1 (POWERON_RESET)`
+//! line, and a crash prints a panic before the reset: the Guru Meditation
+//! Error or abort of ESP-IDF, or the panic of esp-backtrace and Rust. A
+//! device resetting more than `resets_per_minute` times in a minute is taken
+//! to be crash-looping. The TUI flags it in the board list and its pane, and
+//! tells the desktop, a shell command and/or a webhook once when it starts,
+//! so devices soak-tested overnight don't need their logs read the next
+//! morning.
+
+use regex::Regex;
+use serde::Serialize;
+use std::collections::VecDeque;
+use std::path::Path;
+use std::sync::OnceLock;
+use std::time::{Duration, Instant};
+
+use crate::config::{CrashLoopSection, ProjectConfig};
+use crate::projects::build_plan::PlannedCommand;
+use crate::projects::notifications::{desktop_notification, run_notifier};
+
+/// Resets in a minute a device may have before it is crash-looping
+pub const DEFAULT_RESETS_PER_MINUTE: usize = 3;
+/// Time the resets are counted over
+const WINDOW: Duration = Duration::from_secs(60);
+/// Lines of the panics of ESP-IDF, esp-backtrace and Rust's std
+const PANIC_MARKERS: &[&str] = &[
+    "Guru Meditation Error",
+    "abort() was called",
+    "panicked at",
+    "=== PANIC ===",
+];
+
+fn reset_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| Regex::new(r"\brst:0x[0-9a-fA-F]+ \(([A-Za-z0-9_]+)\)").unwrap())
+}
+
+/// What a monitor line tells about the device's boots
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum BootLine {
+    /// The ROM's boot banner, with the reason of the reset
+    Reset(String),
+    Panic,
+    Other,
+}
+
+pub fn boot_line(line: &str) -> BootLine {
+    if let Some(captures) = reset_regex().captures(line) {
+        BootLine::Reset(captures[1].to_string())
+    } else if PANIC_MARKERS.iter().any(|marker| line.contains(marker)) {
+        BootLine::Panic
+    } else {
+        BootLine::Other
+    }
+}
+
+/// The `monitor: crash_loop:` settings of the project's `espbrew.yaml`
+pub fn configured_crash_loop(project_dir: &Path) -> CrashLoopSection {
+    let Ok(Some(config)) = ProjectConfig::load(project_dir) else {
+        return CrashLoopSection::default();
+    };
+    config.monitor.crash_loop
+}
+
+/// `resets_per_minute` of the section, else the default
+pub fn resets_per_minute(section: &CrashLoopSection) -> usize {
+    section
+        .resets_per_minute
+        .unwrap_or(DEFAULT_RESETS_PER_MINUTE)
+}
+
+/// Resets and panics a pane's device showed
+#[derive(Debug, Clone, Default)]
+pub struct ResetTracker {
+    /// Times of the resets of the last minute
+    recent: VecDeque<Instant>,
+    pub resets: usize,
+    pub panics: usize,
+    pub last_reason: Option<String>,
+    pub last_panic: Option<String>,
+    /// The current crash loop was alerted about
+    alerted: bool,
+}
+
+impl ResetTracker {
+    /// Track the line read at `now`; `true` when the device just started
+    /// crash-looping
+    pub fn observe(&mut self, line: &str, now: Instant, resets_per_minute: usize) -> bool {
+        match boot_line(line) {
+            BootLine::Reset(reason) => {
+                self.resets += 1;
+                self.last_reason = Some(reason);
+                self.recent.push_back(now);
+                while self
+                    .recent
+                    .front()
+                    .is_some_and(|reset| now.duration_since(*reset) >= WINDOW)
+                {
+                    self.recent.pop_front();
+                }
+                let looping = self.recent.len() > resets_per_minute;
+                let started = looping && !self.alerted;
+                self.alerted = looping;
+                started
+            }
+            BootLine::Panic => {
+                self.panics += 1;
+                self.last_panic = Some(line.trim().to_string());
+                false
+            }
+            BootLine::Other => false,
+        }
+    }
+
+    /// Resets in the minute before `now`
+    pub fn recent_resets(&self, now: Instant) -> usize {
+        self.recent
+            .iter()
+            .filter(|reset| now.duration_since(**reset) < WINDOW)
+            .count()
+    }
+
+    pub fn is_crash_looping(&self, now: Instant, resets_per_minute: usize) -> bool {
+        self.recent_resets(now) > resets_per_minute
+    }
+
+    /// e.g. `🔁 12 resets, the last TG1WDT_SYS_RST; 11 panics, the last: ...`
+    pub fn summary(&self) -> String {
+        let mut summary = format!("🔁 {} resets", self.resets);
+        if let Some(reason) = &self.last_reason {
+            summary.push_str(&format!(", the last {}", reason));
+        }
+        summary.push_str(&format!("; {} panics", self.panics));
+        if let Some(panic) = &self.last_panic {
+            summary.push_str(&format!(", the last: {}", panic));
+        }
+        summary
+    }
+}
+
+/// What the alert about a crash-looping device tells
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct CrashLoopAlert {
+    /// `board@port`, or the port
+    pub device: String,
+    pub board: Option<String>,
+    pub port: String,
+    /// Resets in the last minute
+    pub resets: usize,
+    pub last_reason: Option<String>,
+    pub last_panic: Option<String>,
+}
+
+impl CrashLoopAlert {
+    pub fn new(device: &str, board: Option<&str>, port: &str, tracker: &ResetTracker) -> Self {
+        Self {
+            device: device.to_string(),
+            board: board.map(str::to_string),
+            port: port.to_string(),
+            resets: tracker.recent.len(),
+            last_reason: tracker.last_reason.clone(),
+            last_panic: tracker.last_panic.clone(),
+        }
+    }
+
+    pub fn text(&self) -> String {
+        let mut text = format!(
+            "🔁 {} is crash-looping: {} resets in the last minute",
+            self.device, self.resets
+        );
+        if let Some(reason) = &self.last_reason {
+            text.push_str(&format!(" ({})", reason));
+        }
+        if let Some(panic) = &self.last_panic {
+            text.push_str(&format!(", last panic: {}", panic));
+        }
+        text
+    }
+}
+
+/// Tell the desktop, command and webhook of the section about a crash loop;
+/// failures are logged, not returned
+pub async fn notify_crash_loop(
+    project_dir: &Path,
+    section: &CrashLoopSection,
+    alert: &CrashLoopAlert,
+) {
+    let text = alert.text();
+
+    if section.desktop {
+        match desktop_notification("espbrew", &text, project_dir) {
+            Some(planned) => run_notifier(&planned, "the desktop notification").await,
+            None => log::warn!("⚠️  No desktop notifications on this platform"),
+        }
+    }
+
+    if let Some(command) = &section.command {
+        let planned = PlannedCommand::shell("notify", project_dir, command)
+            .env("ESPBREW_CRASH_DEVICE", alert.device.clone())
+            .env(
+                "ESPBREW_CRASH_BOARD",
+                alert.board.clone().unwrap_or_default(),
+            )
+            .env("ESPBREW_CRASH_PORT", alert.port.clone())
+            .env("ESPBREW_CRASH_RESETS", alert.resets.to_string())
+            .env(
+                "ESPBREW_CRASH_PANIC",
+                alert.last_panic.clone().unwrap_or_default(),
+            )
+            .env("ESPBREW_CRASH_SUMMARY", text.clone());
+        run_notifier(&planned, &format!("crash loop command '{}'", command)).await;
+    }
+
+    if let Some(url) = &section.webhook {
+        let payload = serde_json::json!({
+            "text": text,
+            "alert": alert,
+        });
+        let result = reqwest::Client::new()
+            .post(url)
+            .timeout(Duration::from_secs(30))
+            .json(&payload)
+            .send()
+            .await
+            .and_then(|response| response.error_for_status());
+        if let Err(e) = result {
+            log::warn!("⚠️  Failed to post the crash loop alert to {}: {}", url, e);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_crash_loop_detection() {
+        assert_eq!(
+            boot_line("rst:0x1 (POWERON_RESET),boot:0x8 (SPI_FAST_FLASH_BOOT)"),
+            BootLine::Reset("POWERON_RESET".to_string())
+        );
+        assert_eq!(
+            boot_line("Guru Meditation Error: Core  0 panic'ed (LoadProhibited)."),
+            BootLine::Panic
+        );
+        assert_eq!(
+            boot_line("panicked at src/main.rs:12:5: boom"),
+            BootLine::Panic
+        );
+        assert_eq!(boot_line("I (312) app: first_rst: 1"), BootLine::Other);
+
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert_eq!(
+            resets_per_minute(&configured_crash_loop(project)),
+            DEFAULT_RESETS_PER_MINUTE
+        );
+        fs::write(
+            project.join("espbrew.yaml"),
+            "monitor:\n  crash_loop:\n    resets_per_minute: 2\n    desktop: true\n    webhook: http://localhost:9/hook\n",
+        )
+        .unwrap();
+        let section = ProjectConfig::load(project)
+            .unwrap()
+            .unwrap()
+            .monitor
+            .crash_loop;
+        assert_eq!(resets_per_minute(&section), 2);
+        assert!(section.desktop);
+        assert_eq!(section.webhook.as_deref(), Some("http://localhost:9/hook"));
+
+        let reset = "rst:0x7 (TG0WDT_SYS_RESET),boot:0x13 (SPI_FAST_FLASH_BOOT)";
+        let start = Instant::now();
+        let mut tracker = ResetTracker::default();
+        assert!(!tracker.observe(reset, start, 2));
+        assert!(!tracker.observe("abort() was called at PC 0x40081234", start, 2));
+        assert!(!tracker.observe(reset, start + Duration::from_secs(10), 2));
+        assert!(tracker.observe(reset, start + Duration::from_secs(20), 2));
+        // Alerted once per loop
+        assert!(!tracker.observe(reset, start + Duration::from_secs(30), 2));
+        assert!(tracker.is_crash_looping(start + Duration::from_secs(30), 2));
+        assert_eq!(tracker.resets, 4);
+        assert_eq!(tracker.panics, 1);
+
+        let alert = CrashLoopAlert::new(
+            "esp32@/dev/ttyUSB0",
+            Some("esp32"),
+            "/dev/ttyUSB0",
+            &tracker,
+        );
+        assert_eq!(alert.resets, 4);
+        assert!(alert.text().contains("esp32@/dev/ttyUSB0 is crash-looping"));
+        assert!(alert.text().contains("TG0WDT_SYS_RESET"));
+        assert!(tracker.summary().contains("4 resets"));
+        assert!(tracker.summary().contains("abort() was called"));
+
+        // Settled once the resets are over a minute old
+        let later = start + Duration::from_secs(120);
+        assert!(!tracker.is_crash_looping(later, 2));
+        assert!(!tracker.observe(reset, later, 2));
+        assert!(!tracker.is_crash_looping(later, 2));
+    }
+}
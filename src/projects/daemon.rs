@@ -0,0 +1,343 @@
+//! Daemon mode: pull a branch and build every board on a schedule
+//!
+//! `espbrew daemon` runs from a clone of the project. Each run fast-forwards
+//! the configured branch, builds the full board matrix like `espbrew build`
+//! and so records every board in the build history. A run starts at the
+//! daily time or interval of the `daemon:` section, or when its webhook is
+//! called. Afterwards a shell command and/or a webhook are notified.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local, NaiveTime, TimeZone};
+use serde::Serialize;
+use std::path::Path;
+use std::time::Duration;
+use tokio::process::Command;
+
+use crate::config::{DaemonSection, NotifySection};
+use crate::projects::build_history::{BuildHistoryEntry, format_duration, load_history};
+use crate::projects::build_plan::PlannedCommand;
+
+/// Daily time of runs when the `daemon:` section sets no schedule
+pub const DEFAULT_RUN_TIME: &str = "02:00";
+
+/// When runs start, besides webhook calls
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Schedule {
+    /// Every day at this local time
+    Daily(NaiveTime),
+    /// Right away, then again after every interval
+    Interval(Duration),
+    /// Only when the webhook is called
+    WebhookOnly,
+}
+
+impl Schedule {
+    /// Schedule of a `daemon:` section; a section with neither `at`,
+    /// `interval_minutes` nor `listen` runs daily at [`DEFAULT_RUN_TIME`]
+    pub fn from_config(section: &DaemonSection) -> Result<Self> {
+        match (&section.at, section.interval_minutes) {
+            (Some(_), Some(_)) => Err(anyhow::anyhow!(
+                "daemon.at and daemon.interval_minutes exclude each other"
+            )),
+            (Some(at), None) => parse_time(at).map(Schedule::Daily),
+            (None, Some(0)) => Err(anyhow::anyhow!(
+                "daemon.interval_minutes must be at least 1"
+            )),
+            (None, Some(minutes)) => Ok(Schedule::Interval(Duration::from_secs(minutes * 60))),
+            (None, None) if section.listen.is_some() => Ok(Schedule::WebhookOnly),
+            (None, None) => parse_time(DEFAULT_RUN_TIME).map(Schedule::Daily),
+        }
+    }
+
+    /// Start of the next scheduled run after `now`, given when the last run started
+    pub fn next_run(
+        &self,
+        now: DateTime<Local>,
+        last_run: Option<DateTime<Local>>,
+    ) -> Option<DateTime<Local>> {
+        match self {
+            Schedule::Daily(time) => {
+                let today = now.date_naive().and_time(*time);
+                let next = if today > now.naive_local() {
+                    today
+                } else {
+                    today + chrono::Duration::days(1)
+                };
+                // A time skipped by a DST change moves to the next hour
+                Local.from_local_datetime(&next).earliest().or_else(|| {
+                    Local
+                        .from_local_datetime(&(next + chrono::Duration::hours(1)))
+                        .earliest()
+                })
+            }
+            Schedule::Interval(interval) => Some(match last_run {
+                Some(last) => (last + chrono::Duration::from_std(*interval).ok()?).max(now),
+                None => now,
+            }),
+            Schedule::WebhookOnly => None,
+        }
+    }
+
+    pub fn describe(&self) -> String {
+        match self {
+            Schedule::Daily(time) => format!("daily at {}", time.format("%H:%M")),
+            Schedule::Interval(interval) => format!("every {}", format_duration(*interval)),
+            Schedule::WebhookOnly => "on webhook calls only".to_string(),
+        }
+    }
+}
+
+fn parse_time(text: &str) -> Result<NaiveTime> {
+    NaiveTime::parse_from_str(text.trim(), "%H:%M")
+        .with_context(|| format!("Invalid daemon.at '{}', expected HH:MM", text))
+}
+
+async fn git(project_dir: &Path, args: &[&str]) -> Result<String> {
+    let output = Command::new("git")
+        .args(args)
+        .current_dir(project_dir)
+        .output()
+        .await
+        .context("Failed to run git")?;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "git {} failed: {}",
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).trim().to_string())
+}
+
+/// Check out the daemon's branch and fast-forward it, returning the branch
+/// and the full hash of its new `HEAD`
+pub async fn pull_branch(project_dir: &Path, section: &DaemonSection) -> Result<(String, String)> {
+    let current = git(project_dir, &["rev-parse", "--abbrev-ref", "HEAD"]).await?;
+    let branch = section.branch.clone().unwrap_or(current.clone());
+    if branch == "HEAD" {
+        return Err(anyhow::anyhow!(
+            "The project is on a detached HEAD, set daemon.branch in espbrew.yaml"
+        ));
+    }
+    if branch != current {
+        git(project_dir, &["checkout", &branch]).await?;
+    }
+
+    let remote = section.remote.as_deref().unwrap_or("origin");
+    git(project_dir, &["pull", "--ff-only", remote, &branch]).await?;
+    let head = git(project_dir, &["rev-parse", "HEAD"]).await?;
+    Ok((branch, head))
+}
+
+/// Result of one daemon run
+#[derive(Debug, Clone, Serialize)]
+pub struct RunSummary {
+    pub started: DateTime<Local>,
+    pub branch: Option<String>,
+    pub commit: Option<String>,
+    /// Board builds the run recorded in the history
+    pub boards: Vec<BuildHistoryEntry>,
+    /// Why the run failed before or besides failing boards, e.g. a failed pull
+    pub error: Option<String>,
+}
+
+impl RunSummary {
+    /// A run that recorded its board builds in the history since `started`
+    pub fn from_history(
+        project_dir: &Path,
+        started: DateTime<Local>,
+        branch: Option<String>,
+        commit: Option<String>,
+        error: Option<String>,
+    ) -> Self {
+        let boards = load_history(project_dir)
+            .into_iter()
+            .filter(|entry| entry.finished >= started)
+            .collect();
+        Self {
+            started,
+            branch,
+            commit,
+            boards,
+            error,
+        }
+    }
+
+    pub fn failed_boards(&self) -> Vec<&str> {
+        self.boards
+            .iter()
+            .filter(|entry| !entry.success)
+            .map(|entry| entry.board.as_str())
+            .collect()
+    }
+
+    pub fn success(&self) -> bool {
+        self.error.is_none() && self.failed_boards().is_empty()
+    }
+
+    /// One line, e.g. `✅ main@1a2b3c4d: 4 board(s) built in 3m 12s`
+    pub fn text(&self) -> String {
+        let revision = match (&self.branch, &self.commit) {
+            (Some(branch), Some(commit)) => {
+                format!("{}@{}", branch, &commit[..commit.len().min(8)])
+            }
+            (Some(branch), None) => branch.clone(),
+            _ => "espbrew daemon".to_string(),
+        };
+        let elapsed = (Local::now() - self.started).to_std().unwrap_or_default();
+
+        let failed = self.failed_boards();
+        if !failed.is_empty() {
+            format!(
+                "❌ {}: {} of {} board(s) failed: {}",
+                revision,
+                failed.len(),
+                self.boards.len(),
+                failed.join(", ")
+            )
+        } else if let Some(error) = &self.error {
+            format!("❌ {}: {}", revision, error)
+        } else {
+            format!(
+                "✅ {}: {} board(s) built in {}",
+                revision,
+                self.boards.len(),
+                format_duration(elapsed)
+            )
+        }
+    }
+}
+
+/// Tell the configured command and webhook about a run; failures are logged, not returned
+pub async fn notify(project_dir: &Path, notify: &NotifySection, summary: &RunSummary) {
+    if notify.only_failures && summary.success() {
+        return;
+    }
+    let text = summary.text();
+
+    if let Some(command) = &notify.command {
+        let planned = PlannedCommand::shell("notify", project_dir, command)
+            .env(
+                "ESPBREW_DAEMON_RESULT",
+                if summary.success() {
+                    "success"
+                } else {
+                    "failure"
+                },
+            )
+            .env("ESPBREW_DAEMON_SUMMARY", text.clone())
+            .env("ESPBREW_DAEMON_FAILED", summary.failed_boards().join(","))
+            .env(
+                "ESPBREW_DAEMON_COMMIT",
+                summary.commit.clone().unwrap_or_default(),
+            );
+        let status = Command::new(&planned.program)
+            .args(&planned.args)
+            .current_dir(project_dir)
+            .envs(&planned.env)
+            .status()
+            .await;
+        match status {
+            Ok(status) if status.success() => {}
+            Ok(status) => log::warn!("⚠️  Notify command failed with {}: {}", status, command),
+            Err(e) => log::warn!("⚠️  Failed to run notify command '{}': {}", command, e),
+        }
+    }
+
+    if let Some(url) = &notify.webhook {
+        let payload = serde_json::json!({
+            "text": text,
+            "success": summary.success(),
+            "run": summary,
+        });
+        let result = reqwest::Client::new()
+            .post(url)
+            .timeout(Duration::from_secs(30))
+            .json(&payload)
+            .send()
+            .await
+            .and_then(|response| response.error_for_status());
+        if let Err(e) = result {
+            log::warn!("⚠️  Failed to post the run result to {}: {}", url, e);
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::ProjectConfig;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_daemon_schedule() {
+        let temp_dir = TempDir::new().expect("Failed to create temp dir");
+        let project_path = temp_dir.path();
+        fs::write(
+        project_path.join("espbrew.yaml"),
+            "daemon:\n  branch: main\n  at: \"02:30\"\n  notify:\n    webhook: https://hooks.example.com/x\n    only_failures: true\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project_path).unwrap().unwrap();
+        assert_eq!(config.daemon.branch.as_deref(), Some("main"));
+        assert!(config.daemon.notify.only_failures);
+
+        let schedule = Schedule::from_config(&config.daemon).unwrap();
+        assert_eq!(
+            schedule,
+            Schedule::Daily(NaiveTime::from_hms_opt(2, 30, 0).unwrap())
+        );
+        let evening = Local.with_ymd_and_hms(2025, 3, 10, 22, 0, 0).unwrap();
+        assert_eq!(
+            schedule.next_run(evening, None),
+            Some(Local.with_ymd_and_hms(2025, 3, 11, 2, 30, 0).unwrap())
+        );
+        let night = Local.with_ymd_and_hms(2025, 3, 10, 1, 0, 0).unwrap();
+        assert_eq!(
+            schedule.next_run(night, None),
+            Some(Local.with_ymd_and_hms(2025, 3, 10, 2, 30, 0).unwrap())
+        );
+
+        let mut section = config.daemon.clone();
+        section.at = None;
+        section.interval_minutes = Some(90);
+        let schedule = Schedule::from_config(&section).unwrap();
+        assert_eq!(schedule, Schedule::Interval(Duration::from_secs(90 * 60)));
+        assert_eq!(schedule.next_run(evening, None), Some(evening));
+        assert_eq!(
+            schedule.next_run(evening, Some(evening)),
+            Some(evening + chrono::Duration::minutes(90))
+        );
+
+        section.interval_minutes = None;
+        section.listen = Some("127.0.0.1:8087".to_string());
+        assert_eq!(
+            Schedule::from_config(&section).unwrap(),
+            Schedule::WebhookOnly
+        );
+        section.at = Some("25:00".to_string());
+        assert!(Schedule::from_config(&section).is_err());
+
+        let entry = |board: &str, success: bool| BuildHistoryEntry {
+            finished: Local::now(),
+            board: board.to_string(),
+            duration_ms: 1000,
+            success,
+            flash_size: None,
+            commit: None,
+        };
+        let summary = RunSummary {
+            started: Local::now(),
+            branch: Some("main".to_string()),
+            commit: Some("1a2b3c4d5e6f".to_string()),
+            boards: vec![entry("esp32c3", true), entry("esp32s3", false)],
+            error: Some("Some builds failed".to_string()),
+        };
+        assert!(!summary.success());
+        assert_eq!(
+            summary.text(),
+            "❌ main@1a2b3c4d: 1 of 2 board(s) failed: esp32s3"
+        );
+    }
+}
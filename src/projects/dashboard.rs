@@ -0,0 +1,348 @@
+//! Summary of a run of the TUI, for status updates
+//!
+//! **i** in the TUI opens a dashboard of the boards' last builds: how many
+//! passed, failed or were skipped, how long the run and each board took,
+//! the application sizes, the compiler cache's hit rates and the connected
+//! devices with what uses them. **y** copies it to the clipboard as
+//! Markdown, ready to be pasted into a status update:
+//!
+//! ```text
+//! ## espbrew: 7 passed, 1 failed, 2 skipped
+//!
+//! Wall time 12m 05s, board time 35m 10s, 1482.7 KiB of applications, ccache 3012/3400 hits (88.6%)
+//! ```
+
+use std::time::Duration;
+
+use crate::models::project::BuildStatus;
+use crate::projects::build_history::format_duration;
+use crate::projects::device_registry::{ConnectedPort, DeviceRegistry};
+use crate::utils::compiler_cache::CacheStats;
+use crate::utils::firmware_size::format_bytes;
+
+/// How a board ended up in the run
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum RunOutcome {
+    Passed,
+    Failed,
+    /// Not built, or cancelled
+    Skipped,
+    /// Building, flashing or queued
+    Running,
+}
+
+impl RunOutcome {
+    pub fn of(status: &BuildStatus, queued: bool) -> Self {
+        match status {
+            BuildStatus::Success | BuildStatus::Flashed | BuildStatus::Monitoring => {
+                RunOutcome::Passed
+            }
+            BuildStatus::Failed => RunOutcome::Failed,
+            BuildStatus::Building | BuildStatus::Flashing => RunOutcome::Running,
+            BuildStatus::Pending if queued => RunOutcome::Running,
+            BuildStatus::Pending | BuildStatus::Cancelled => RunOutcome::Skipped,
+        }
+    }
+
+    pub fn label(&self) -> &'static str {
+        match self {
+            RunOutcome::Passed => "passed",
+            RunOutcome::Failed => "failed",
+            RunOutcome::Skipped => "skipped",
+            RunOutcome::Running => "running",
+        }
+    }
+}
+
+/// A board's row of the dashboard
+#[derive(Debug, Clone, PartialEq)]
+pub struct BoardSummary {
+    pub board: String,
+    pub outcome: RunOutcome,
+    /// Of its last build or flash, or so far while running
+    pub duration: Option<Duration>,
+    /// Of its application
+    pub size: Option<u64>,
+    /// Of its last build
+    pub cache: Option<CacheStats>,
+}
+
+/// What a connected device is used for
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum DeviceState {
+    Idle,
+    Monitored,
+    /// Its monitor pane let go of the port for a flash
+    Flashing,
+    Reconnecting,
+    MonitorClosed,
+    CrashLooping,
+}
+
+impl DeviceState {
+    pub fn label(&self) -> &'static str {
+        match self {
+            DeviceState::Idle => "idle",
+            DeviceState::Monitored => "monitored",
+            DeviceState::Flashing => "flashing",
+            DeviceState::Reconnecting => "reconnecting",
+            DeviceState::MonitorClosed => "monitor closed",
+            DeviceState::CrashLooping => "crash-looping",
+        }
+    }
+}
+
+/// A connected device, the board registered for it and what uses it
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DeviceSummary {
+    pub port: String,
+    pub board: Option<String>,
+    pub state: DeviceState,
+}
+
+/// The board whose registered device is on the port, by USB identity
+pub fn registered_board(registry: &DeviceRegistry, port: &ConnectedPort) -> Option<String> {
+    let usb = port.usb.as_ref()?;
+    registry
+        .boards
+        .iter()
+        .find(|(_, device)| device.matches_usb(usb))
+        .map(|(board, _)| board.clone())
+}
+
+/// What the dashboard's rows add up to
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct DashboardTotals {
+    pub passed: usize,
+    pub failed: usize,
+    pub skipped: usize,
+    pub running: usize,
+    /// The boards' durations added up, more than the wall time of boards
+    /// building in parallel
+    pub board_time: Duration,
+    pub size: u64,
+    pub cache: CacheStats,
+}
+
+impl DashboardTotals {
+    pub fn new(boards: &[BoardSummary]) -> Self {
+        let mut totals = Self::default();
+        for board in boards {
+            match board.outcome {
+                RunOutcome::Passed => totals.passed += 1,
+                RunOutcome::Failed => totals.failed += 1,
+                RunOutcome::Skipped => totals.skipped += 1,
+                RunOutcome::Running => totals.running += 1,
+            }
+            totals.board_time += board.duration.unwrap_or_default();
+            totals.size += board.size.unwrap_or(0);
+            if let Some(cache) = &board.cache {
+                totals.cache.cache = totals.cache.cache.or(cache.cache);
+                totals.cache.hits += cache.hits;
+                totals.cache.misses += cache.misses;
+            }
+        }
+        totals
+    }
+
+    /// e.g. `7 passed, 1 failed, 2 skipped`, with the running boards if any
+    pub fn headline(&self) -> String {
+        let mut text = format!(
+            "{} passed, {} failed, {} skipped",
+            self.passed, self.failed, self.skipped
+        );
+        if self.running > 0 {
+            text.push_str(&format!(", {} running", self.running));
+        }
+        text
+    }
+
+    /// Wall time, board time, sizes and cache hits in a line
+    pub fn timings(&self, wall_time: Option<Duration>) -> String {
+        let mut parts = vec![
+            format!("Wall time {}", or_dash(wall_time, format_duration)),
+            format!("board time {}", format_duration(self.board_time)),
+        ];
+        if self.size > 0 {
+            parts.push(format!("{} of applications", format_bytes(self.size)));
+        }
+        if self.cache.hits + self.cache.misses > 0 {
+            parts.push(self.cache.summary());
+        }
+        parts.join(", ")
+    }
+}
+
+fn or_dash<T>(value: Option<T>, format: impl Fn(T) -> String) -> String {
+    value.map_or_else(|| "-".to_string(), format)
+}
+
+/// The board's duration, size and cache hit rate as the dashboard shows them
+pub fn board_columns(board: &BoardSummary) -> [String; 3] {
+    [
+        or_dash(board.duration, format_duration),
+        or_dash(board.size, format_bytes),
+        or_dash(board.cache.and_then(|c| c.hit_rate()), |rate| {
+            format!("{:.0}%", rate)
+        }),
+    ]
+}
+
+/// The dashboard as Markdown
+pub fn dashboard_markdown(
+    boards: &[BoardSummary],
+    devices: &[DeviceSummary],
+    wall_time: Option<Duration>,
+) -> String {
+    let totals = DashboardTotals::new(boards);
+    let mut lines = vec![
+        format!("## espbrew: {}", totals.headline()),
+        String::new(),
+        totals.timings(wall_time),
+        String::new(),
+        "| Board | Result | Time | Size | Cache hits |".to_string(),
+        "|---|---|---|---|---|".to_string(),
+    ];
+    for board in boards {
+        let [duration, size, cache] = board_columns(board);
+        lines.push(format!(
+            "| {} | {} | {} | {} | {} |",
+            board.board,
+            board.outcome.label(),
+            duration,
+            size,
+            cache
+        ));
+    }
+    if !devices.is_empty() {
+        lines.push(String::new());
+        lines.push("| Device | Board | State |".to_string());
+        lines.push("|---|---|---|".to_string());
+        for device in devices {
+            lines.push(format!(
+                "| {} | {} | {} |",
+                device.port,
+                device.board.as_deref().unwrap_or("-"),
+                device.state.label()
+            ));
+        }
+    }
+    lines.join("\n")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::projects::device_registry::{RegisteredDevice, UsbIdentity};
+    use crate::utils::compiler_cache::CompilerCache;
+
+    #[test]
+    fn test_run_dashboard() {
+        assert_eq!(
+            RunOutcome::of(&BuildStatus::Flashed, false),
+            RunOutcome::Passed
+        );
+        assert_eq!(
+            RunOutcome::of(&BuildStatus::Cancelled, false),
+            RunOutcome::Skipped
+        );
+        assert_eq!(
+            RunOutcome::of(&BuildStatus::Pending, true),
+            RunOutcome::Running
+        );
+
+        let cache = |hits, misses| CacheStats {
+            cache: Some(CompilerCache::Ccache),
+            hits,
+            misses,
+        };
+        let board = |name: &str, outcome, secs: Option<u64>, size, cache| BoardSummary {
+            board: name.to_string(),
+            outcome,
+            duration: secs.map(Duration::from_secs),
+            size,
+            cache,
+        };
+        let boards = vec![
+            board(
+                "esp32s3",
+                RunOutcome::Passed,
+                Some(65),
+                Some(204800),
+                Some(cache(90, 10)),
+            ),
+            board(
+                "esp32c3",
+                RunOutcome::Failed,
+                Some(5),
+                None,
+                Some(cache(10, 30)),
+            ),
+            board("esp32", RunOutcome::Skipped, None, None, None),
+            board("esp32c6", RunOutcome::Running, None, None, None),
+        ];
+
+        let totals = DashboardTotals::new(&boards);
+        assert_eq!(
+            totals.headline(),
+            "1 passed, 1 failed, 1 skipped, 1 running"
+        );
+        assert_eq!(
+            totals.timings(Some(Duration::from_secs(45))),
+            "Wall time 45s, board time 1m 10s, 200.0 KiB of applications, ccache 100/140 hits (71.4%)"
+        );
+        assert_eq!(
+            DashboardTotals::new(&[]).timings(None),
+            "Wall time -, board time 0s"
+        );
+        assert_eq!(board_columns(&boards[0]), ["1m 05s", "200.0 KiB", "90%"]);
+        assert_eq!(board_columns(&boards[2]), ["-", "-", "-"]);
+
+        let devices = vec![DeviceSummary {
+            port: "/dev/ttyACM0".to_string(),
+            board: Some("esp32s3".to_string()),
+            state: DeviceState::Monitored,
+        }];
+        let markdown = dashboard_markdown(&boards, &devices, Some(Duration::from_secs(45)));
+        let lines: Vec<&str> = markdown.lines().collect();
+        assert_eq!(
+            lines[0],
+            "## espbrew: 1 passed, 1 failed, 1 skipped, 1 running"
+        );
+        assert!(lines.contains(&"| esp32c3 | failed | 5s | - | 25% |"));
+        assert!(lines.contains(&"| esp32 | skipped | - | - | - |"));
+        assert_eq!(
+            lines.last().unwrap(),
+            &"| /dev/ttyACM0 | esp32s3 | monitored |"
+        );
+        assert!(!dashboard_markdown(&boards, &[], None).contains("| Device |"));
+
+        // Devices are told apart by their USB serial numbers
+        let usb = |serial: &str| UsbIdentity {
+            vid: 0x303a,
+            pid: 0x1001,
+            serial_number: Some(serial.to_string()),
+        };
+        let mut registry = DeviceRegistry::default();
+        registry.assign(
+            "esp32s3",
+            RegisteredDevice {
+                usb: Some(usb("7C:DF:A1:00:00:01")),
+                ..Default::default()
+            },
+        );
+        let port = |usb| ConnectedPort {
+            port: "/dev/ttyACM0".to_string(),
+            usb,
+        };
+        assert_eq!(
+            registered_board(&registry, &port(Some(usb("7C:DF:A1:00:00:01")))),
+            Some("esp32s3".to_string())
+        );
+        assert_eq!(
+            registered_board(&registry, &port(Some(usb("7C:DF:A1:00:00:02")))),
+            None
+        );
+        assert_eq!(registered_board(&registry, &port(None)), None);
+    }
+}
@@ -0,0 +1,277 @@
+//! GDB debug sessions on a board's device
+//!
+//! The debug action starts OpenOCD with the board's `openocd_config` in
+//! `espbrew.yaml`, or the configuration of the chip's built-in USB-JTAG, and
+//! the GDB of the chip's architecture on the ELF of the board's last build.
+//! Like `idf.py gdb`, GDB connects to OpenOCD's GDB server, resets and halts
+//! the chip and runs to the firmware's entry, e.g. `app_main`, then has the
+//! terminal until it quits; OpenOCD stops with it. OpenOCD's output goes to
+//! `logs/<board>-openocd.log`.
+
+use anyhow::{Context, Result};
+use std::net::TcpStream;
+use std::path::{Path, PathBuf};
+use std::process::{Child, Command, Stdio};
+use std::time::{Duration, Instant};
+
+use crate::config::ProjectConfig;
+use crate::models::ProjectBoardConfig;
+use crate::models::project::ProjectType;
+use crate::services::flash_backend::builtin_openocd_config;
+use crate::utils::backtrace::board_elf;
+
+/// Environment variable naming the GDB to use for every chip
+pub const GDB_ENV: &str = "ESPBREW_GDB";
+/// Port of OpenOCD's GDB server
+pub const GDB_PORT: u16 = 3333;
+/// Time OpenOCD gets to find the chip and open its GDB server
+const OPENOCD_START_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// Whether the chip is a RISC-V one, e.g. the ESP32-C3, C6, H2 or P4
+pub fn is_riscv_chip(chip: &str) -> bool {
+    ["esp32c", "esp32h", "esp32p"]
+        .iter()
+        .any(|prefix| chip.starts_with(prefix))
+}
+
+/// GDB tools debugging the chip, preferred first
+pub fn gdb_tools(chip: &str) -> Vec<String> {
+    if is_riscv_chip(chip) {
+        vec![
+            "riscv32-esp-elf-gdb".to_string(),
+            "gdb-multiarch".to_string(),
+        ]
+    } else {
+        vec![
+            format!("xtensa-{}-elf-gdb", chip),
+            "xtensa-esp-elf-gdb".to_string(),
+        ]
+    }
+}
+
+/// `ESPBREW_GDB`, else the first of the chip's GDB tools on the `PATH`
+pub fn find_gdb(chip: &str) -> Option<PathBuf> {
+    if let Ok(tool) = std::env::var(GDB_ENV)
+        && !tool.is_empty()
+    {
+        return Some(PathBuf::from(tool));
+    }
+    gdb_tools(chip)
+        .iter()
+        .find_map(|tool| which::which(tool).ok())
+}
+
+/// Function the session runs to before handing over
+pub fn entry_function(project_type: &ProjectType) -> &'static str {
+    match project_type {
+        ProjectType::RustNoStd | ProjectType::Zephyr => "main",
+        ProjectType::TinyGo => "main.main",
+        ProjectType::NuttX => "nsh_main",
+        _ => "app_main",
+    }
+}
+
+/// GDB commands starting the session, those of ESP-IDF's `gdbinit`
+pub fn gdb_init_commands(entry: &str) -> Vec<String> {
+    vec![
+        format!("target extended-remote :{}", GDB_PORT),
+        "set remote hardware-watchpoint-limit 2".to_string(),
+        "mon reset halt".to_string(),
+        "maintenance flush register-cache".to_string(),
+        format!("thb {}", entry),
+        "c".to_string(),
+    ]
+}
+
+/// Everything a debug session of a board needs
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DebugTarget {
+    pub chip: String,
+    /// OpenOCD board configuration, e.g. `board/esp32s3-builtin.cfg`
+    pub openocd_config: String,
+    pub gdb: PathBuf,
+    pub elf: PathBuf,
+    pub entry: &'static str,
+}
+
+impl DebugTarget {
+    pub fn openocd_args(&self) -> Vec<String> {
+        vec!["-f".to_string(), self.openocd_config.clone()]
+    }
+
+    pub fn gdb_args(&self) -> Vec<String> {
+        let mut args = Vec::new();
+        for command in gdb_init_commands(self.entry) {
+            args.extend(["-ex".to_string(), command]);
+        }
+        args.push(self.elf.display().to_string());
+        args
+    }
+}
+
+/// The board's chip, OpenOCD configuration, GDB and ELF
+pub fn debug_target(project_dir: &Path, board_config: &ProjectBoardConfig) -> Result<DebugTarget> {
+    let config = ProjectConfig::load(project_dir)?;
+    let section = config
+        .as_ref()
+        .and_then(|config| config.board_section(&board_config.name));
+    let chip = section
+        .and_then(|section| section.metadata.chip.clone())
+        .or(board_config.target.clone())
+        .map(|chip| chip.to_lowercase().replace('-', ""))
+        .ok_or_else(|| anyhow::anyhow!("The chip of {} is unknown", board_config.name))?;
+    let openocd_config = section
+        .and_then(|section| section.openocd_config.clone())
+        .or_else(|| builtin_openocd_config(&chip))
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "{} has no built-in USB-JTAG, set the openocd_config of {} in espbrew.yaml",
+                chip,
+                board_config.name
+            )
+        })?;
+    let elf = board_elf(&project_dir.join(&board_config.build_dir))
+        .ok_or_else(|| anyhow::anyhow!("No ELF of {} found, build it first", board_config.name))?;
+    let gdb = find_gdb(&chip).ok_or_else(|| {
+        anyhow::anyhow!(
+            "No GDB for {} found, install the ESP toolchain or set {}",
+            chip,
+            GDB_ENV
+        )
+    })?;
+    Ok(DebugTarget {
+        chip,
+        openocd_config,
+        gdb,
+        elf,
+        entry: entry_function(&board_config.project_type),
+    })
+}
+
+/// OpenOCD of a session, stopped when dropped
+struct OpenOcd(Child);
+
+impl Drop for OpenOcd {
+    fn drop(&mut self) {
+        let _ = self.0.kill();
+        let _ = self.0.wait();
+    }
+}
+
+/// Start OpenOCD, logging to `log_file`, and wait for its GDB server
+fn start_openocd(target: &DebugTarget, log_file: &Path) -> Result<OpenOcd> {
+    let log = std::fs::File::create(log_file)
+        .with_context(|| format!("Failed to create {}", log_file.display()))?;
+    let mut command = Command::new("openocd");
+    command
+        .args(target.openocd_args())
+        .stdin(Stdio::null())
+        .stdout(log.try_clone()?)
+        .stderr(log);
+    // Out of the terminal's process group, so Ctrl-C in GDB doesn't stop it
+    #[cfg(unix)]
+    std::os::unix::process::CommandExt::process_group(&mut command, 0);
+    let child = command
+        .spawn()
+        .context("Failed to start openocd, is ESP-IDF's environment set up?")?;
+    let mut openocd = OpenOcd(child);
+    let started = Instant::now();
+    while TcpStream::connect(("127.0.0.1", GDB_PORT)).is_err() {
+        if let Some(status) = openocd.0.try_wait()? {
+            return Err(anyhow::anyhow!(
+                "openocd exited with {}, see {}",
+                status,
+                log_file.display()
+            ));
+        }
+        if started.elapsed() > OPENOCD_START_TIMEOUT {
+            return Err(anyhow::anyhow!(
+                "openocd opened no GDB server on port {}, see {}",
+                GDB_PORT,
+                log_file.display()
+            ));
+        }
+        std::thread::sleep(Duration::from_millis(100));
+    }
+    Ok(openocd)
+}
+
+/// Debug the board's device with GDB in the terminal until it quits
+pub fn run_debug_session(target: &DebugTarget, log_file: &Path) -> Result<()> {
+    // Ctrl-C interrupts the target in GDB; with a handler of its own the
+    // SIGINT doesn't stop espbrew as well
+    #[cfg(unix)]
+    let _interrupts = tokio::runtime::Handle::try_current()
+        .ok()
+        .map(|_| tokio::signal::unix::signal(tokio::signal::unix::SignalKind::interrupt()));
+    let _openocd = start_openocd(target, log_file)?;
+    println!(
+        "🐞 Debugging {} on the {} with {}, quit GDB to return",
+        target.elf.display(),
+        target.chip,
+        target.openocd_config
+    );
+    Command::new(&target.gdb)
+        .args(target.gdb_args())
+        .status()
+        .with_context(|| format!("Failed to start {}", target.gdb.display()))?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_debug_session_target() {
+        assert!(is_riscv_chip("esp32c6"));
+        assert!(is_riscv_chip("esp32p4"));
+        assert!(!is_riscv_chip("esp32s3"));
+        assert_eq!(gdb_tools("esp32s3")[0], "xtensa-esp32s3-elf-gdb");
+        assert_eq!(gdb_tools("esp32c3")[0], "riscv32-esp-elf-gdb");
+        assert_eq!(entry_function(&ProjectType::EspIdf), "app_main");
+        assert_eq!(entry_function(&ProjectType::RustNoStd), "main");
+        assert_eq!(
+            gdb_init_commands("app_main"),
+            [
+                "target extended-remote :3333",
+                "set remote hardware-watchpoint-limit 2",
+                "mon reset halt",
+                "maintenance flush register-cache",
+                "thb app_main",
+                "c",
+            ]
+        );
+
+        let target = DebugTarget {
+            chip: "esp32s3".to_string(),
+            openocd_config: "board/esp32s3-builtin.cfg".to_string(),
+            gdb: "xtensa-esp32s3-elf-gdb".into(),
+            elf: "/tmp/build/app.elf".into(),
+            entry: "app_main",
+        };
+        assert_eq!(target.openocd_args(), ["-f", "board/esp32s3-builtin.cfg"]);
+        let args = target.gdb_args();
+        assert_eq!(args[..2], ["-ex", "target extended-remote :3333"]);
+        assert_eq!(args.last().unwrap(), "/tmp/build/app.elf");
+
+        // An ESP32 has no built-in USB-JTAG, its adapter has to be configured
+        let dir = tempfile::tempdir().unwrap();
+        let board = ProjectBoardConfig {
+            name: "wrover_kit".to_string(),
+            config_file: dir.path().join("sdkconfig.defaults.wrover_kit"),
+            build_dir: dir.path().join("build.wrover_kit"),
+            target: Some("esp32".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        let error = debug_target(dir.path(), &board).unwrap_err().to_string();
+        assert!(error.contains("openocd_config"), "{}", error);
+        std::fs::write(
+            dir.path().join("espbrew.yaml"),
+            "boards:\n  wrover_kit:\n    openocd_config: board/esp32-wrover-kit-3.3v.cfg\n",
+        )
+        .unwrap();
+        let error = debug_target(dir.path(), &board).unwrap_err().to_string();
+        assert!(error.contains("build it first"), "{}", error);
+    }
+}
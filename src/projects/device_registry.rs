@@ -0,0 +1,373 @@
+//! Physical devices registered for board configurations
+//!
+//! Serial port names change whenever devices are replugged, so
+//! `espbrew boards assign` records the USB vendor id, product id and serial
+//! number of the device on a port, plus the MAC address esptool reads from
+//! it, in `.espbrew/devices.json`. Flashing or monitoring a board without an
+//! explicit port then uses whichever port its device is on now.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::ProjectConfig;
+use crate::models::AppEvent;
+use crate::utils::espflash_utils::{find_esp_ports, identify_esp_board};
+
+/// Registered devices, relative to the project
+pub const DEVICE_REGISTRY_FILE: &str = ".espbrew/devices.json";
+
+/// USB identity of a serial adapter or native USB port
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct UsbIdentity {
+    pub vid: u16,
+    pub pid: u16,
+    #[serde(default)]
+    pub serial_number: Option<String>,
+}
+
+impl std::fmt::Display for UsbIdentity {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "USB {:04x}:{:04x}", self.vid, self.pid)?;
+        if let Some(serial) = &self.serial_number {
+            write!(f, " serial {}", serial)?;
+        }
+        Ok(())
+    }
+}
+
+/// The physical device a board configuration is flashed to
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct RegisteredDevice {
+    #[serde(default)]
+    pub usb: Option<UsbIdentity>,
+    #[serde(default)]
+    pub mac_address: Option<String>,
+    /// Hardware and port at registration, for listings
+    #[serde(default)]
+    pub description: String,
+}
+
+impl RegisteredDevice {
+    /// Whether a port's USB identity is this device's; adapters without a
+    /// serial number all look alike, so they never match
+    pub fn matches_usb(&self, usb: &UsbIdentity) -> bool {
+        self.usb
+            .as_ref()
+            .is_some_and(|own| own.serial_number.is_some() && own == usb)
+    }
+
+    pub fn matches_mac(&self, mac_address: &str) -> bool {
+        self.mac_address
+            .as_deref()
+            .is_some_and(|own| same_mac(own, mac_address))
+    }
+
+    /// Whether both describe the same physical device
+    fn is_same(&self, other: &RegisteredDevice) -> bool {
+        other.usb.as_ref().is_some_and(|usb| self.matches_usb(usb))
+            || other
+                .mac_address
+                .as_deref()
+                .is_some_and(|mac| self.matches_mac(mac))
+    }
+
+    /// `USB 303a:1001 serial 7C:DF:A1:00:00:01, MAC 7c:df:a1:00:00:01`
+    pub fn identity(&self) -> String {
+        let mut parts = Vec::new();
+        if let Some(usb) = &self.usb {
+            parts.push(usb.to_string());
+        }
+        if let Some(mac) = &self.mac_address {
+            parts.push(format!("MAC {}", mac));
+        }
+        parts.join(", ")
+    }
+}
+
+/// Whether two MAC addresses are equal, whatever their separators and case
+pub fn same_mac(left: &str, right: &str) -> bool {
+    let normalize = |mac: &str| mac.replace([':', '-'], "").to_lowercase();
+    normalize(left) == normalize(right)
+}
+
+/// The device of every board that has one registered
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct DeviceRegistry {
+    #[serde(default)]
+    pub boards: BTreeMap<String, RegisteredDevice>,
+}
+
+impl DeviceRegistry {
+    pub fn path(project_dir: &Path) -> PathBuf {
+        project_dir.join(DEVICE_REGISTRY_FILE)
+    }
+
+    /// The project's registry, empty if no device was registered yet
+    pub fn load(project_dir: &Path) -> Result<Self> {
+        let path = Self::path(project_dir);
+        if !path.exists() {
+            return Ok(Self::default());
+        }
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        serde_json::from_str(&content).with_context(|| format!("Invalid {}", path.display()))
+    }
+
+    pub fn save(&self, project_dir: &Path) -> Result<()> {
+        let path = Self::path(project_dir);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)?;
+        }
+        std::fs::write(&path, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("Failed to write {}", path.display()))
+    }
+
+    pub fn device(&self, board_name: &str) -> Option<&RegisteredDevice> {
+        self.boards.get(board_name)
+    }
+
+    /// Register a device for a board. A device belongs to one board, so
+    /// another board it was registered for loses it.
+    pub fn assign(&mut self, board_name: &str, device: RegisteredDevice) {
+        self.boards.retain(|_, other| !other.is_same(&device));
+        self.boards.insert(board_name.to_string(), device);
+    }
+
+    /// Board the device with this MAC address is registered for
+    pub fn board_for_mac(&self, mac_address: &str) -> Option<&str> {
+        self.boards
+            .iter()
+            .find(|(_, device)| device.matches_mac(mac_address))
+            .map(|(board, _)| board.as_str())
+    }
+}
+
+/// An ESP-compatible serial port and the USB device behind it
+#[derive(Debug, Clone, PartialEq)]
+pub struct ConnectedPort {
+    pub port: String,
+    pub usb: Option<UsbIdentity>,
+}
+
+/// ESP-compatible serial ports with their USB identities
+pub fn connected_ports() -> Result<Vec<ConnectedPort>> {
+    let esp_ports = find_esp_ports()?;
+    let ports = serialport::available_ports()?
+        .into_iter()
+        .filter(|info| esp_ports.contains(&info.port_name))
+        .map(|info| ConnectedPort {
+            usb: match info.port_type {
+                serialport::SerialPortType::UsbPort(usb) => Some(UsbIdentity {
+                    vid: usb.vid,
+                    pid: usb.pid,
+                    serial_number: usb.serial_number,
+                }),
+                _ => None,
+            },
+            port: info.port_name,
+        })
+        .collect();
+    Ok(ports)
+}
+
+/// Port of the registered device among the connected ports, by USB identity only
+pub fn find_by_usb(device: &RegisteredDevice, ports: &[ConnectedPort]) -> Option<String> {
+    ports
+        .iter()
+        .find(|port| port.usb.as_ref().is_some_and(|usb| device.matches_usb(usb)))
+        .map(|port| port.port.clone())
+}
+
+/// Port the board's registered device is on now; `None` if no device is
+/// registered for the board, an error if it isn't connected
+pub async fn resolve_port(project_dir: &Path, board_name: &str) -> Result<Option<String>> {
+    let registry = DeviceRegistry::load(project_dir)?;
+    let Some(device) = registry.device(board_name) else {
+        return Ok(None);
+    };
+
+    let ports = connected_ports()?;
+    if let Some(port) = find_by_usb(device, &ports) {
+        return Ok(Some(port));
+    }
+    // Adapters without a USB serial number are told apart by the chip's MAC
+    if device.mac_address.is_some() {
+        for port in &ports {
+            if let Ok(Some(info)) = identify_esp_board(&port.port).await
+                && device.matches_mac(&info.mac_address)
+            {
+                return Ok(Some(port.port.clone()));
+            }
+        }
+    }
+    Err(anyhow::anyhow!(
+        "The device registered for {} ({}) is not connected",
+        board_name,
+        device.identity()
+    ))
+}
+
+/// `port:` of the board in `espbrew.yaml`, which may be a serial-over-TCP URL
+pub fn configured_port(project_dir: &Path, board_name: &str) -> Option<String> {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.board_section(board_name)?.port.clone())
+}
+
+/// `port` if given, else the board's `port:` in `espbrew.yaml`, else the port
+/// of its registered device, if any
+pub async fn port_or_registered(
+    project_dir: &Path,
+    board_name: &str,
+    port: Option<&str>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<Option<String>> {
+    if let Some(port) = port {
+        return Ok(Some(port.to_string()));
+    }
+    if let Some(port) = configured_port(project_dir, board_name) {
+        return Ok(Some(port));
+    }
+    let resolved = resolve_port(project_dir, board_name).await?;
+    if let Some(port) = &resolved {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_name.to_string(),
+            format!("📌 Registered device found on {}", port),
+        ));
+    }
+    Ok(resolved)
+}
+
+/// Identify the device on a port and register it for a board
+pub async fn register_device(
+    project_dir: &Path,
+    board_name: &str,
+    port: &str,
+) -> Result<RegisteredDevice> {
+    let usb = connected_ports()?
+        .into_iter()
+        .find(|connected| connected.port == port)
+        .and_then(|connected| connected.usb);
+    let info = identify_esp_board(port).await?;
+    let mac_address = info
+        .as_ref()
+        .map(|info| info.mac_address.clone())
+        .filter(|mac| mac != "Unknown" && !mac.contains('*'));
+
+    let has_serial = usb.as_ref().is_some_and(|usb| usb.serial_number.is_some());
+    if !has_serial && mac_address.is_none() {
+        return Err(anyhow::anyhow!(
+            "The device on {} has neither a USB serial number nor a readable MAC address, \
+             so it can't be told apart from other devices",
+            port
+        ));
+    }
+
+    let description = match &info {
+        Some(info) => format!("{} on {}", info.chip_type, port),
+        None => format!("device on {}", port),
+    };
+    let device = RegisteredDevice {
+        usb,
+        mac_address,
+        description,
+    };
+    let mut registry = DeviceRegistry::load(project_dir)?;
+    registry.assign(board_name, device.clone());
+    registry.save(project_dir)?;
+    Ok(device)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_device_registry() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert!(DeviceRegistry::load(project).unwrap().boards.is_empty());
+
+        let usb = |serial: Option<&str>| UsbIdentity {
+            vid: 0x303a,
+            pid: 0x1001,
+            serial_number: serial.map(str::to_string),
+        };
+        let devkit = RegisteredDevice {
+            usb: Some(usb(Some("7C:DF:A1:00:00:01"))),
+            mac_address: Some("7c:df:a1:00:00:01".to_string()),
+            description: "ESP32-S3 on /dev/ttyACM0".to_string(),
+        };
+        let mut registry = DeviceRegistry::default();
+        registry.assign("s3_devkit", devkit.clone());
+        registry.save(project).unwrap();
+
+        let mut registry = DeviceRegistry::load(project).unwrap();
+        assert_eq!(registry.device("s3_devkit"), Some(&devkit));
+        assert_eq!(
+            registry.board_for_mac("7C-DF-A1-00-00-01"),
+            Some("s3_devkit")
+        );
+
+        // Registering the same device for another board moves it there
+        registry.assign(
+            "s3_box",
+            RegisteredDevice {
+                usb: None,
+                mac_address: Some("7C:DF:A1:00:00:01".to_string()),
+                description: String::new(),
+            },
+        );
+        assert!(registry.device("s3_devkit").is_none());
+        assert!(registry.device("s3_box").is_some());
+
+        assert!(same_mac("AA-BB-CC-DD-EE-FF", "aa:bb:cc:dd:ee:ff"));
+        assert!(!same_mac("aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:00"));
+
+        // Adapters without a serial number can't be told apart by USB
+        let anonymous = RegisteredDevice {
+            usb: Some(usb(None)),
+            ..RegisteredDevice::default()
+        };
+        assert!(!anonymous.matches_usb(&usb(None)));
+        assert!(devkit.matches_usb(&usb(Some("7C:DF:A1:00:00:01"))));
+
+        let ports = vec![
+            ConnectedPort {
+                port: "/dev/ttyUSB0".to_string(),
+                usb: Some(usb(None)),
+            },
+            ConnectedPort {
+                port: "/dev/ttyACM3".to_string(),
+                usb: Some(usb(Some("7C:DF:A1:00:00:01"))),
+            },
+        ];
+        assert_eq!(
+            find_by_usb(&devkit, &ports).as_deref(),
+            Some("/dev/ttyACM3")
+        );
+        assert_eq!(find_by_usb(&anonymous, &ports), None);
+    }
+
+    #[test]
+    fn test_configured_network_port() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  rack:\n    port: rfc2217://rack-host:4001\n",
+        )
+        .unwrap();
+        assert_eq!(
+            configured_port(project, "rack").as_deref(),
+            Some("rfc2217://rack-host:4001")
+        );
+        assert_eq!(configured_port(project, "desk"), None);
+    }
+}
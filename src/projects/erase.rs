@@ -0,0 +1,323 @@
+//! Erasing the flash of a board with esptool
+//!
+//! `espbrew erase` and the TUI's erase actions run `esptool.py erase_flash`,
+//! or `erase_region` for a part of the flash. A region is given as
+//! `offset:size` or by the name of a partition, e.g. `nvs`, which is looked
+//! up in the board's partition table: the one of its last build, else its
+//! custom CSV, else ESP-IDF's default table.
+
+use anyhow::Result;
+use std::path::Path;
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::BoardMetadata;
+use crate::models::{AppEvent, ProjectBoardConfig, ProjectType};
+use crate::projects::device_registry::port_or_registered;
+use crate::projects::handlers::esp_idf::EspIdfHandler;
+use crate::services::{ESPTOOL_DEFAULT_BAUD, run_flash_tool};
+use crate::utils::espflash_utils::select_esp_port;
+use crate::utils::partition_table::{PartitionEntry, read_build_partition_table};
+
+/// Granularity of `erase_region`
+const SECTOR_SIZE: u32 = 0x1000;
+
+/// The single factory app table ESP-IDF builds without a custom one
+const DEFAULT_PARTITIONS: &[(&str, u8, u8, u32, u32)] = &[
+    ("nvs", 0x01, 0x02, 0x9000, 0x6000),
+    ("phy_init", 0x01, 0x01, 0xf000, 0x1000),
+    ("factory", 0x00, 0x00, 0x10000, 0x100000),
+];
+
+/// What to erase
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum EraseTarget {
+    /// The whole flash
+    All,
+    /// A region, with the partition it was looked up from
+    Region {
+        offset: u32,
+        size: u32,
+        partition: Option<String>,
+    },
+}
+
+impl EraseTarget {
+    pub fn describe(&self) -> String {
+        match self {
+            EraseTarget::All => "the whole flash".to_string(),
+            EraseTarget::Region {
+                offset,
+                size,
+                partition: Some(name),
+            } => format!("partition {} (0x{:x}, {} KB)", name, offset, size / 1024),
+            EraseTarget::Region { offset, size, .. } => {
+                format!("0x{:x}..0x{:x}", offset, offset + size)
+            }
+        }
+    }
+}
+
+/// `offset:size` in hex or decimal, e.g. `0x9000:0x6000`
+fn parse_range(region: &str) -> Option<(u32, u32)> {
+    let parse = |value: &str| {
+        let value = value.trim();
+        match value
+            .strip_prefix("0x")
+            .or_else(|| value.strip_prefix("0X"))
+        {
+            Some(hex) => u32::from_str_radix(hex, 16).ok(),
+            None => value.parse().ok(),
+        }
+    };
+    let (offset, size) = region.split_once(':')?;
+    Some((parse(offset)?, parse(size)?))
+}
+
+/// Partition table the board's flash holds, or will hold once flashed
+pub fn board_partitions(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+) -> Result<Vec<PartitionEntry>> {
+    if let Ok(entries) = read_build_partition_table(&board_config.build_dir) {
+        return Ok(entries);
+    }
+    if board_config.project_type == ProjectType::EspIdf
+        && let Some(layout) = EspIdfHandler::partition_layout(project_dir, board_config)?
+    {
+        return Ok(layout.entries);
+    }
+    Ok(DEFAULT_PARTITIONS
+        .iter()
+        .map(
+            |(label, partition_type, subtype, offset, size)| PartitionEntry {
+                label: label.to_string(),
+                partition_type: *partition_type,
+                subtype: *subtype,
+                offset: *offset,
+                size: *size,
+            },
+        )
+        .collect())
+}
+
+/// Partition by label, else the first data partition of that subtype, e.g. `nvs`
+pub fn find_partition<'a>(
+    partitions: &'a [PartitionEntry],
+    name: &str,
+) -> Result<&'a PartitionEntry> {
+    partitions
+        .iter()
+        .find(|entry| entry.label == name)
+        .or_else(|| {
+            partitions
+                .iter()
+                .find(|entry| !entry.is_app() && entry.subtype_name() == name)
+        })
+        .ok_or_else(|| {
+            let labels: Vec<&str> = partitions.iter().map(|e| e.label.as_str()).collect();
+            anyhow::anyhow!(
+                "No partition '{}' in the partition table ({})",
+                name,
+                labels.join(", ")
+            )
+        })
+}
+
+/// Region to erase: `offset:size`, or a partition by label or data subtype
+pub fn resolve_region(partitions: &[PartitionEntry], region: &str) -> Result<EraseTarget> {
+    let (offset, size, partition) = if let Some((offset, size)) = parse_range(region) {
+        (offset, size, None)
+    } else {
+        let entry = find_partition(partitions, region)?;
+        (entry.offset, entry.size, Some(entry.label.clone()))
+    };
+
+    if size == 0 || offset % SECTOR_SIZE != 0 || size % SECTOR_SIZE != 0 {
+        return Err(anyhow::anyhow!(
+            "Region 0x{:x}:0x{:x} must be a non-empty multiple of 0x{:x} bytes at a 0x{:x} boundary",
+            offset,
+            size,
+            SECTOR_SIZE,
+            SECTOR_SIZE
+        ));
+    }
+    Ok(EraseTarget::Region {
+        offset,
+        size,
+        partition,
+    })
+}
+
+/// Arguments of the `esptool.py` call erasing `target` over `port`
+pub fn esptool_erase_args(
+    metadata: &BoardMetadata,
+    chip: Option<&str>,
+    port: &str,
+    target: &EraseTarget,
+) -> Vec<String> {
+    let mut args = Vec::new();
+    if let Some(chip) = chip {
+        args.extend(["--chip".to_string(), chip.to_string()]);
+    }
+    args.extend([
+        "--port".to_string(),
+        port.to_string(),
+        "--baud".to_string(),
+        metadata.upload_baud(ESPTOOL_DEFAULT_BAUD),
+    ]);
+    args.extend(metadata.esptool_args());
+    match target {
+        EraseTarget::All => args.push("erase_flash".to_string()),
+        EraseTarget::Region { offset, size, .. } => args.extend([
+            "erase_region".to_string(),
+            format!("0x{:x}", offset),
+            format!("0x{:x}", size),
+        ]),
+    }
+    args
+}
+
+/// Erase `target` on the board's device: on `port`, else the board's
+/// configured or registered port, else the only ESP device connected
+pub async fn erase_board(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: Option<&str>,
+    target: &EraseTarget,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let port = match port_or_registered(project_dir, &board_config.name, port, tx).await? {
+        Some(port) => port,
+        None => select_esp_port()?,
+    };
+    let metadata = BoardMetadata::load(project_dir, &board_config.name);
+    let chip = metadata
+        .chip
+        .clone()
+        .or(board_config.target.clone())
+        .map(|chip| chip.to_lowercase().replace('-', ""));
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("🧹 Erasing {} on {}", target.describe(), port),
+    ));
+    let mut command = Command::new("esptool.py");
+    command.current_dir(project_dir).args(esptool_erase_args(
+        &metadata,
+        chip.as_deref(),
+        &port,
+        target,
+    ));
+    run_flash_tool(command, "esptool.py", &board_config.name, Some(tx), |_| {
+        None
+    })
+    .await?;
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("✅ Erased {}", target.describe()),
+    ));
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_erase_regions() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        let board = |name: &str, config_file: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(config_file),
+            build_dir: project.join(format!("build.{}", name)),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+
+        // Without a build or custom table, the board has ESP-IDF's default table
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        let partitions =
+            board_partitions(project, &board("box", "sdkconfig.defaults.box")).unwrap();
+        assert_eq!(
+            resolve_region(&partitions, "nvs").unwrap(),
+            EraseTarget::Region {
+                offset: 0x9000,
+                size: 0x6000,
+                partition: Some("nvs".to_string()),
+            }
+        );
+
+        // A custom table's NVS partition is found by its data subtype
+        fs::write(
+            project.join("sdkconfig.defaults.custom"),
+            "CONFIG_PARTITION_TABLE_CUSTOM=y\nCONFIG_PARTITION_TABLE_CUSTOM_FILENAME=\"partitions.csv\"\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("partitions.csv"),
+            "# Name, Type, SubType, Offset, Size\nsettings, data, nvs, 0x9000, 0x4000,\nfactory, app, factory, 0x10000, 1M,\n",
+        )
+        .unwrap();
+        let partitions =
+            board_partitions(project, &board("custom", "sdkconfig.defaults.custom")).unwrap();
+        let nvs = resolve_region(&partitions, "nvs").unwrap();
+        assert_eq!(
+            nvs,
+            EraseTarget::Region {
+                offset: 0x9000,
+                size: 0x4000,
+                partition: Some("settings".to_string()),
+            }
+        );
+
+        // Ranges must be sector aligned, names must exist
+        assert_eq!(
+            resolve_region(&partitions, "0x110000:0x2000").unwrap(),
+            EraseTarget::Region {
+                offset: 0x110000,
+                size: 0x2000,
+                partition: None,
+            }
+        );
+        assert!(resolve_region(&partitions, "0x9100:0x1000").is_err());
+        assert!(resolve_region(&partitions, "coredump").is_err());
+
+        let metadata = BoardMetadata {
+            upload_speed: Some(460800),
+            no_stub: true,
+            ..Default::default()
+        };
+        assert_eq!(
+            esptool_erase_args(&metadata, Some("esp32s3"), "/dev/ttyUSB0", &nvs),
+            [
+                "--chip",
+                "esp32s3",
+                "--port",
+                "/dev/ttyUSB0",
+                "--baud",
+                "460800",
+                "--no-stub",
+                "erase_region",
+                "0x9000",
+                "0x4000",
+            ]
+        );
+        assert_eq!(
+            esptool_erase_args(
+                &BoardMetadata::default(),
+                None,
+                "/dev/ttyACM0",
+                &EraseTarget::All
+            ),
+            ["--port", "/dev/ttyACM0", "--baud", "460800", "erase_flash"]
+        );
+    }
+}
@@ -0,0 +1,435 @@
+//! Flashing boards built with flash encryption
+//!
+//! The mode comes from the build's `sdkconfig`, the device's state from its
+//! eFuses, read with `espefuse.py` before every flash of a project that uses
+//! flash encryption:
+//!
+//! - a device with encrypted flash never gets plaintext images of a build
+//!   without flash encryption, which it couldn't boot
+//! - in development mode, an encrypted device is flashed with `--encrypt`
+//! - in release mode, where the device no longer encrypts what it is sent,
+//!   an encrypted device gets the images pre-encrypted after the build with
+//!   the key of the `flash_encryption:` section
+//!
+//! A plaintext device is flashed with plaintext images, which its bootloader
+//! encrypts on the first boot.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::sdkconfig_fragments::read_options;
+use crate::config::{BoardMetadata, ProjectConfig};
+use crate::models::flash::FlashBinaryInfo;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::services::{UnifiedFlashService, run_flash_tool};
+
+/// Directory of the pre-encrypted images, inside the build directory
+pub const ENCRYPTED_DIR: &str = "encrypted";
+
+/// Flash encryption mode a board is built with
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum EncryptionMode {
+    Development,
+    Release,
+}
+
+/// How the images of a build are written to a device
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum EncryptedFlash {
+    /// Plaintext images as built
+    Plaintext,
+    /// Plaintext images the device encrypts as they are written
+    Encrypt,
+    /// The images pre-encrypted after the build
+    PreEncrypted,
+}
+
+/// Flash encryption mode of the build in `build_dir`, `None` without flash encryption
+pub fn build_encryption_mode(build_dir: &Path) -> Option<EncryptionMode> {
+    let options = read_options(&build_dir.join("sdkconfig")).ok()?;
+    let enabled = |key: &str| {
+        options
+            .iter()
+            .any(|option| option.key == key && option.value.as_deref() == Some("y"))
+    };
+    if !enabled("CONFIG_SECURE_FLASH_ENC_ENABLED") {
+        return None;
+    }
+    Some(if enabled("CONFIG_SECURE_FLASH_ENCRYPTION_MODE_RELEASE") {
+        EncryptionMode::Release
+    } else {
+        EncryptionMode::Development
+    })
+}
+
+/// Whether a `FLASH_CRYPT_CNT` or `SPI_BOOT_CRYPT_CNT` eFuse value enables
+/// flash encryption: an odd number of its bits is set
+pub fn crypt_count_enabled(value: &serde_json::Value) -> Option<bool> {
+    match value {
+        serde_json::Value::Number(number) => Some(number.as_u64()?.count_ones() % 2 == 1),
+        serde_json::Value::Bool(enabled) => Some(*enabled),
+        serde_json::Value::String(text) => {
+            if let Some(bits) = text.split("0b").nth(1) {
+                let bits: String = bits
+                    .chars()
+                    .take_while(|c| matches!(c, '0' | '1'))
+                    .collect();
+                return Some(bits.chars().filter(|c| *c == '1').count() % 2 == 1);
+            }
+            let text = text.to_lowercase();
+            if text.starts_with("enable") {
+                Some(true)
+            } else if text.starts_with("disable") {
+                Some(false)
+            } else {
+                None
+            }
+        }
+        _ => None,
+    }
+}
+
+/// Whether the eFuses of an `espefuse.py summary --format json` enable flash encryption
+pub fn device_encrypted(summary: &serde_json::Value) -> Option<bool> {
+    ["SPI_BOOT_CRYPT_CNT", "FLASH_CRYPT_CNT"]
+        .iter()
+        .find_map(|name| crypt_count_enabled(summary.get(*name)?.get("value")?))
+}
+
+/// Read whether the device on `port` has flash encryption enabled
+pub async fn read_device_encryption(port: &str, chip: Option<&str>) -> Result<bool> {
+    let mut command = Command::new("espefuse.py");
+    if let Some(chip) = chip {
+        command.args(["--chip", chip]);
+    }
+    let output = command
+        .args(["--port", port, "summary", "--format", "json"])
+        .output()
+        .await
+        .context("Failed to start espefuse.py, is it installed?")?;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "espefuse.py failed: {}",
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+
+    // The JSON follows espefuse's connection messages
+    let stdout = String::from_utf8_lossy(&output.stdout);
+    let json = stdout
+        .find('{')
+        .zip(stdout.rfind('}'))
+        .map(|(start, end)| &stdout[start..=end])
+        .ok_or_else(|| anyhow::anyhow!("espefuse.py printed no eFuse summary"))?;
+    let summary: serde_json::Value =
+        serde_json::from_str(json).context("Failed to parse the eFuse summary")?;
+    device_encrypted(&summary)
+        .ok_or_else(|| anyhow::anyhow!("The eFuse summary has no flash encryption counter"))
+}
+
+/// How to flash a build with `mode` to a device whose flash is `encrypted`
+pub fn encrypted_flash(
+    board_name: &str,
+    mode: Option<EncryptionMode>,
+    encrypted: bool,
+) -> Result<EncryptedFlash> {
+    match (mode, encrypted) {
+        (_, false) => Ok(EncryptedFlash::Plaintext),
+        (None, true) => Err(anyhow::anyhow!(
+            "The device has flash encryption enabled but {} is built without it; \
+             its plaintext images would leave the device unbootable",
+            board_name
+        )),
+        (Some(EncryptionMode::Development), true) => Ok(EncryptedFlash::Encrypt),
+        (Some(EncryptionMode::Release), true) => Ok(EncryptedFlash::PreEncrypted),
+    }
+}
+
+/// Check the device on `port` before flashing the board, if the project uses
+/// flash encryption. Without a readable eFuse state nothing is flashed.
+pub async fn check_flash_encryption(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<EncryptedFlash> {
+    let mode = build_encryption_mode(&board_config.build_dir);
+    let configured =
+        ProjectConfig::load(project_dir)?.is_some_and(|config| config.flash_encryption.is_some());
+    if mode.is_none() && !configured {
+        return Ok(EncryptedFlash::Plaintext);
+    }
+
+    let chip = board_chip(project_dir, board_config);
+    let encrypted = read_device_encryption(port, chip.as_deref())
+        .await
+        .with_context(|| {
+            format!(
+                "Can't read the flash encryption eFuses of {}, not flashing {}",
+                port, board_config.name
+            )
+        })?;
+    let plan = encrypted_flash(&board_config.name, mode, encrypted)?;
+    let message = match plan {
+        EncryptedFlash::Plaintext if mode.is_some() => {
+            "🔐 The device's flash is plaintext yet, its first boot encrypts it"
+        }
+        EncryptedFlash::Plaintext => "🔓 The device's flash is not encrypted",
+        EncryptedFlash::Encrypt => {
+            "🔐 Encrypted device in development mode, writing with --encrypt"
+        }
+        EncryptedFlash::PreEncrypted => {
+            "🔐 Encrypted device in release mode, writing the pre-encrypted images"
+        }
+    };
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        message.to_string(),
+    ));
+    Ok(plan)
+}
+
+fn board_chip(project_dir: &Path, board_config: &ProjectBoardConfig) -> Option<String> {
+    BoardMetadata::load(project_dir, &board_config.name)
+        .chip
+        .or(board_config.target.clone())
+        .map(|chip| chip.to_lowercase().replace('-', ""))
+}
+
+/// `espsecure.py` arguments encrypting `input` for `offset` into `output`;
+/// all chips but the ESP32 use AES-XTS
+pub fn encrypt_flash_data_args(
+    chip: &str,
+    key: &Path,
+    offset: u32,
+    input: &Path,
+    output: &Path,
+) -> Vec<String> {
+    let mut args = vec!["encrypt_flash_data".to_string()];
+    if chip != "esp32" {
+        args.push("--aes_xts".to_string());
+    }
+    args.extend([
+        "--keyfile".to_string(),
+        key.display().to_string(),
+        "--address".to_string(),
+        format!("0x{:x}", offset),
+        "--output".to_string(),
+        output.display().to_string(),
+        input.display().to_string(),
+    ]);
+    args
+}
+
+/// The build's binaries at their pre-encrypted paths
+pub fn pre_encrypted_binaries(
+    build_dir: &Path,
+    binaries: &[FlashBinaryInfo],
+) -> Vec<FlashBinaryInfo> {
+    binaries
+        .iter()
+        .map(|binary| FlashBinaryInfo {
+            file_path: encrypted_path(build_dir, binary),
+            ..binary.clone()
+        })
+        .collect()
+}
+
+fn encrypted_path(build_dir: &Path, binary: &FlashBinaryInfo) -> PathBuf {
+    build_dir
+        .join(ENCRYPTED_DIR)
+        .join(format!("0x{:x}-{}", binary.offset, binary.file_name))
+}
+
+/// Pre-encrypt the images of a release-mode build with the project's key,
+/// for devices that already have encrypted flash
+pub async fn write_encrypted_images(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    if build_encryption_mode(&board_config.build_dir) != Some(EncryptionMode::Release) {
+        return Ok(());
+    }
+    let Some(key) = ProjectConfig::load(project_dir)?
+        .and_then(|config| config.flash_encryption)
+        .and_then(|section| section.key)
+    else {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "⚠️  Release-mode flash encryption without flash_encryption.key in espbrew.yaml: \
+             devices with encrypted flash can't be reflashed"
+                .to_string(),
+        ));
+        return Ok(());
+    };
+    let chip = board_chip(project_dir, board_config).ok_or_else(|| {
+        anyhow::anyhow!(
+            "No chip known for {}, set `chip:` in its section to encrypt its images",
+            board_config.name
+        )
+    })?;
+
+    let (_, binaries) = UnifiedFlashService::parse_flash_args(
+        &board_config.build_dir.join("flash_args"),
+        &board_config.build_dir,
+    )?;
+    let encrypted_dir = board_config.build_dir.join(ENCRYPTED_DIR);
+    std::fs::create_dir_all(&encrypted_dir)
+        .with_context(|| format!("Failed to create {}", encrypted_dir.display()))?;
+    for binary in &binaries {
+        let mut command = Command::new("espsecure.py");
+        command
+            .current_dir(project_dir)
+            .args(encrypt_flash_data_args(
+                &chip,
+                &project_dir.join(&key),
+                binary.offset,
+                &binary.file_path,
+                &encrypted_path(&board_config.build_dir, binary),
+            ));
+        run_flash_tool(
+            command,
+            "espsecure.py",
+            &board_config.name,
+            Some(tx),
+            |_| None,
+        )
+        .await?;
+    }
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🔐 Pre-encrypted {} images into {}",
+            binaries.len(),
+            encrypted_dir.display()
+        ),
+    ));
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::services::{EsptoolBackend, FlashBackend, FlashOperation};
+    use serde_json::json;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_flash_encryption_plan() {
+        let temp_dir = TempDir::new().unwrap();
+        let build_dir = temp_dir.path();
+        assert_eq!(build_encryption_mode(build_dir), None);
+        fs::write(
+            build_dir.join("sdkconfig"),
+            "CONFIG_SECURE_FLASH_ENC_ENABLED=y\nCONFIG_SECURE_FLASH_ENCRYPTION_MODE_DEVELOPMENT=y\n",
+        )
+        .unwrap();
+        assert_eq!(
+            build_encryption_mode(build_dir),
+            Some(EncryptionMode::Development)
+        );
+        fs::write(
+            build_dir.join("sdkconfig"),
+            "CONFIG_SECURE_FLASH_ENC_ENABLED=y\nCONFIG_SECURE_FLASH_ENCRYPTION_MODE_RELEASE=y\n",
+        )
+        .unwrap();
+        assert_eq!(
+            build_encryption_mode(build_dir),
+            Some(EncryptionMode::Release)
+        );
+
+        assert_eq!(crypt_count_enabled(&json!(0)), Some(false));
+        assert_eq!(crypt_count_enabled(&json!(1)), Some(true));
+        assert_eq!(crypt_count_enabled(&json!(3)), Some(false));
+        assert_eq!(crypt_count_enabled(&json!("Enable (0b001)")), Some(true));
+        assert_eq!(crypt_count_enabled(&json!("Disable (0b000)")), Some(false));
+        assert_eq!(
+            device_encrypted(&json!({ "SPI_BOOT_CRYPT_CNT": { "value": "Enable" } })),
+            Some(true)
+        );
+        assert_eq!(
+            device_encrypted(&json!({ "FLASH_CRYPT_CNT": { "value": 0 } })),
+            Some(false)
+        );
+        assert_eq!(device_encrypted(&json!({})), None);
+
+        assert_eq!(
+            encrypted_flash("s3", None, false).unwrap(),
+            EncryptedFlash::Plaintext
+        );
+        assert_eq!(
+            encrypted_flash("s3", Some(EncryptionMode::Release), false).unwrap(),
+            EncryptedFlash::Plaintext
+        );
+        assert_eq!(
+            encrypted_flash("s3", Some(EncryptionMode::Development), true).unwrap(),
+            EncryptedFlash::Encrypt
+        );
+        assert_eq!(
+            encrypted_flash("s3", Some(EncryptionMode::Release), true).unwrap(),
+            EncryptedFlash::PreEncrypted
+        );
+        assert!(encrypted_flash("s3", None, true).is_err());
+
+        let args = encrypt_flash_data_args(
+            "esp32s3",
+            Path::new("key.bin"),
+            0x10000,
+            Path::new("app.bin"),
+            Path::new("encrypted/app.bin"),
+        );
+        assert_eq!(
+            args.join(" "),
+            "encrypt_flash_data --aes_xts --keyfile key.bin --address 0x10000 --output encrypted/app.bin app.bin"
+        );
+        let args = encrypt_flash_data_args(
+            "esp32",
+            Path::new("key.bin"),
+            0x1000,
+            Path::new("bootloader.bin"),
+            Path::new("encrypted/bootloader.bin"),
+        );
+        assert!(!args.contains(&"--aes_xts".to_string()));
+
+        let binaries = vec![FlashBinaryInfo {
+            name: "app".to_string(),
+            file_name: "app.bin".to_string(),
+            file_path: build_dir.join("app.bin"),
+            offset: 0x10000,
+        }];
+        let encrypted = pre_encrypted_binaries(build_dir, &binaries);
+        assert_eq!(
+            encrypted[0].file_path,
+            build_dir.join("encrypted").join("0x10000-app.bin")
+        );
+        assert_eq!(encrypted[0].offset, 0x10000);
+
+        // Development mode has esptool encrypt the images as it writes them
+        let esptool = EsptoolBackend {
+            chip: Some("esp32s3".to_string()),
+            baud: 460800,
+            no_stub: false,
+            flash_mode: None,
+            flash_freq: None,
+        };
+        assert!(esptool.encrypts());
+        let operation = FlashOperation {
+            port: "/dev/ttyUSB0".to_string(),
+            binaries,
+            flash_config: None,
+            board_name: Some("s3".to_string()),
+            verify: false,
+            encrypt: true,
+        };
+        assert!(
+            esptool
+                .args(&operation)
+                .join(" ")
+                .contains("write_flash -z --encrypt")
+        );
+    }
+}
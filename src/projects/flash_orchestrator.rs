@@ -0,0 +1,382 @@
+//! Flash every connected device with the board configuration matching it
+//!
+//! `espbrew flash --all-devices` and the TUI probe the serial ports, pick a
+//! board configuration for each device and flash all of them at once. The
+//! `devices:` of a board in `espbrew.yaml` (ports or MAC addresses) and the
+//! device registry assign devices to it; any other device gets the board
+//! whose chip, flash size and PSRAM describe it most closely. A device two boards fit equally well is
+//! skipped rather than flashed with a guess.
+
+use anyhow::Result;
+use regex::Regex;
+use std::path::Path;
+use std::sync::OnceLock;
+use tokio::sync::mpsc;
+
+use crate::config::{BoardMetadata, ProjectConfig, PsramMode};
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::ProjectRegistry;
+use crate::projects::board_detect::DetectedBoard;
+use crate::projects::device_registry::{DeviceRegistry, same_mac};
+use crate::projects::retry::flash_board_with_retries;
+use crate::utils::espflash_utils::{find_esp_ports, identify_esp_board};
+
+/// A connected device and the board configuration it is flashed with
+#[derive(Debug, Clone)]
+pub struct FlashTarget {
+    pub board: ProjectBoardConfig,
+    pub device: DetectedBoard,
+}
+
+impl FlashTarget {
+    /// Name of the device in output and progress, e.g. `esp32s3_devkit@/dev/ttyUSB0`
+    pub fn label(&self) -> String {
+        format!("{}@{}", self.board.name, self.device.port)
+    }
+}
+
+/// The board configuration of every connected device
+#[derive(Debug, Clone, Default)]
+pub struct FlashPlan {
+    pub targets: Vec<FlashTarget>,
+    /// Devices left alone, with the reason
+    pub skipped: Vec<(DetectedBoard, String)>,
+}
+
+/// Identify the devices on the ESP serial ports; ports nothing answers on are left out
+pub async fn probe_devices() -> Result<Vec<DetectedBoard>> {
+    let mut devices = Vec::new();
+    for port in find_esp_ports()? {
+        match identify_esp_board(&port).await {
+            Ok(Some(info)) => devices.push(DetectedBoard::from_board_info(&info)),
+            Ok(None) => log::debug!("No ESP device responded on {}", port),
+            Err(e) => log::debug!("Failed to identify the device on {}: {}", port, e),
+        }
+    }
+    Ok(devices)
+}
+
+/// Pick the board configuration each device is flashed with
+pub fn match_devices(
+    project_dir: &Path,
+    boards: &[ProjectBoardConfig],
+    devices: Vec<DetectedBoard>,
+) -> FlashPlan {
+    let config = ProjectConfig::load(project_dir).ok().flatten();
+    let section = |board: &ProjectBoardConfig| {
+        config
+            .as_ref()
+            .and_then(|config| config.board_section(&board.name))
+    };
+
+    let registry = DeviceRegistry::load(project_dir).unwrap_or_default();
+
+    let mut plan = FlashPlan::default();
+    for device in devices {
+        let assigned: Vec<&ProjectBoardConfig> = boards
+            .iter()
+            .filter(|&board| {
+                section(board).is_some_and(|section| {
+                    section
+                        .devices
+                        .iter()
+                        .any(|entry| names_device(entry, &device))
+                }) || registry
+                    .device(&board.name)
+                    .is_some_and(|registered| registered.matches_mac(&device.mac_address))
+            })
+            .collect();
+
+        let candidates = if assigned.is_empty() {
+            let fits: Vec<(u32, &ProjectBoardConfig)> = boards
+                .iter()
+                .filter_map(|board| {
+                    let metadata = section(board)
+                        .map(|section| section.metadata.clone())
+                        .unwrap_or_default();
+                    fit_score(board, &metadata, &device).map(|score| (score, board))
+                })
+                .collect();
+            let best = fits.iter().map(|(score, _)| *score).max();
+            fits.into_iter()
+                .filter(|(score, _)| Some(*score) == best)
+                .map(|(_, board)| board)
+                .collect()
+        } else {
+            assigned
+        };
+
+        match candidates.as_slice() {
+            [] => {
+                let reason = format!("no board configuration for {}", device.summary());
+                plan.skipped.push((device, reason));
+            }
+            [board] => plan.targets.push(FlashTarget {
+                board: (*board).clone(),
+                device,
+            }),
+            several => {
+                let names: Vec<&str> = several.iter().map(|board| board.name.as_str()).collect();
+                let reason = format!(
+                    "fits {}; list it under the devices: of one board in espbrew.yaml",
+                    names.join(", ")
+                );
+                plan.skipped.push((device, reason));
+            }
+        }
+    }
+    plan
+}
+
+/// Whether a `devices:` entry is the device's port or MAC address
+fn names_device(entry: &str, device: &DetectedBoard) -> bool {
+    entry == device.port || same_mac(entry, &device.mac_address)
+}
+
+/// How closely a board describes a device, `None` if it contradicts it.
+/// A board without a chip or target fits no device.
+fn fit_score(
+    board: &ProjectBoardConfig,
+    metadata: &BoardMetadata,
+    device: &DetectedBoard,
+) -> Option<u32> {
+    let chip = metadata.chip.as_deref().or(board.target.as_deref())?;
+    if chip.to_lowercase().replace('-', "") != device.chip {
+        return None;
+    }
+
+    let mut score = 1;
+    if let (Some(size), Some(device_size)) = (metadata.esptool_flash_size(), &device.flash_size) {
+        if size != *device_size {
+            return None;
+        }
+        score += 1;
+    }
+    if let Some(psram) = metadata.psram {
+        if !psram_fits(psram, device.psram) {
+            return None;
+        }
+        score += 1;
+    }
+    // Configurations written by `boards detect` are named after the hardware
+    if board.name == device.config_name() {
+        score += 1;
+    }
+    Some(score)
+}
+
+fn psram_fits(board: PsramMode, device: Option<PsramMode>) -> bool {
+    match (board, device.unwrap_or(PsramMode::None)) {
+        (PsramMode::None, device) => device == PsramMode::None,
+        (_, PsramMode::None) => false,
+        (PsramMode::Enabled, _) | (_, PsramMode::Enabled) => true,
+        (board, device) => board == device,
+    }
+}
+
+fn percent_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| Regex::new(r"\b(\d{1,3}) ?%").unwrap())
+}
+
+/// Percentage in a line of flashing tool output, e.g. esptool's
+/// `Writing at 0x00010000... (42 %)`
+pub fn flash_progress(line: &str) -> Option<u8> {
+    percent_regex()
+        .captures_iter(line)
+        .last()
+        .and_then(|captures| captures[1].parse().ok())
+        .filter(|percent| *percent <= 100)
+}
+
+/// Flash all targets at once. Output and progress of each device arrive under
+/// its [`FlashTarget::label`], then a `DeviceFlashFinished` for it.
+/// Returns the labels of the devices that failed.
+pub async fn flash_devices(
+    project_dir: &Path,
+    plan: &FlashPlan,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Vec<String> {
+    let tasks: Vec<_> = plan
+        .targets
+        .iter()
+        .cloned()
+        .map(|target| {
+            let project_dir = project_dir.to_path_buf();
+            let tx = tx.clone();
+            tokio::spawn(async move {
+                let label = target.label();
+                let result = flash_device(&project_dir, &target, &label, &tx).await;
+                if let Err(e) = &result {
+                    let _ = tx.send(AppEvent::BuildOutput(label.clone(), format!("❌ {:#}", e)));
+                }
+                let _ = tx.send(AppEvent::DeviceFlashFinished(label.clone(), result.is_ok()));
+                (label, result.is_ok())
+            })
+        })
+        .collect();
+
+    let mut failed = Vec::new();
+    for task in tasks {
+        match task.await {
+            Ok((_, true)) => {}
+            Ok((label, false)) => failed.push(label),
+            Err(e) => log::error!("❌ Flash task failed: {}", e),
+        }
+    }
+    failed
+}
+
+async fn flash_device(
+    project_dir: &Path,
+    target: &FlashTarget,
+    label: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let handler = ProjectRegistry::create_handler(target.board.project_type.clone());
+    if !handler.check_artifacts_exist(project_dir, &target.board) {
+        return Err(anyhow::anyhow!(
+            "No build artifacts in {}, build {} first",
+            target.board.build_dir.display(),
+            target.board.name
+        ));
+    }
+    let _ = tx.send(AppEvent::BuildOutput(
+        label.to_string(),
+        format!(
+            "🔥 Flashing {} ({})",
+            target.board.name,
+            target.device.summary()
+        ),
+    ));
+
+    // The handler reports under the board's name, shared by every device it goes to
+    let (relay_tx, mut relay_rx) = mpsc::unbounded_channel();
+    let relay = tokio::spawn({
+        let tx = tx.clone();
+        let label = label.to_string();
+        async move {
+            while let Some(event) = relay_rx.recv().await {
+                let event = match event {
+                    AppEvent::BuildOutput(_, line) => {
+                        if let Some(percent) = flash_progress(&line) {
+                            let _ = tx.send(AppEvent::FlashProgress(label.clone(), percent));
+                        }
+                        AppEvent::BuildOutput(label.clone(), line)
+                    }
+                    AppEvent::FlashProgress(_, percent) => {
+                        AppEvent::FlashProgress(label.clone(), percent)
+                    }
+                    AppEvent::StepRetried(_, step) => AppEvent::StepRetried(label.clone(), step),
+                    AppEvent::FlashVerified(_) => AppEvent::FlashVerified(label.clone()),
+                    other => other,
+                };
+                let _ = tx.send(event);
+            }
+        }
+    });
+
+    let result = flash_board_with_retries(
+        handler.as_ref(),
+        project_dir,
+        &target.board,
+        &[],
+        Some(&target.device.port),
+        relay_tx,
+    )
+    .await;
+    let _ = relay.await;
+    result
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_flash_device_matching() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            concat!(
+                "boards:\n",
+                "  s3_box:\n    chip: esp32s3\n    flash_size: 16MB\n    psram: octal\n",
+                "  s3_mini:\n    chip: esp32s3\n    flash_size: 4MB\n",
+                "  c6_probe:\n    devices: [\"AA:BB:CC:DD:EE:01\"]\n",
+            ),
+        )
+        .unwrap();
+
+        let board = |name: &str, target: Option<&str>| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: target.map(str::to_string),
+            project_type: ProjectType::EspIdf,
+        };
+        let boards = vec![
+            board("s3_box", None),
+            board("s3_mini", None),
+            board("c6_probe", Some("esp32c6")),
+            board("c6_sensor", Some("esp32c6")),
+            board("c3_a", Some("esp32c3")),
+            board("c3_b", Some("esp32-c3")),
+        ];
+        let device = |port: &str, chip: &str, flash: &str, psram, mac: &str| DetectedBoard {
+            port: port.to_string(),
+            chip: chip.to_string(),
+            flash_size: Some(flash.to_string()),
+            psram,
+            crystal: Some(40),
+            mac_address: mac.to_string(),
+        };
+        let devices = vec![
+            device(
+                "/dev/ttyUSB0",
+                "esp32s3",
+                "16MB",
+                Some(PsramMode::Octal),
+                "aa:00:00:00:00:01",
+            ),
+            device("/dev/ttyUSB1", "esp32s3", "4MB", None, "aa:00:00:00:00:02"),
+            device("/dev/ttyUSB2", "esp32s3", "8MB", None, "aa:00:00:00:00:03"),
+            device("/dev/ttyACM0", "esp32c6", "4MB", None, "aa:bb:cc:dd:ee:01"),
+            device("/dev/ttyACM1", "esp32c3", "4MB", None, "aa:00:00:00:00:05"),
+            device("/dev/ttyACM2", "esp32c5", "4MB", None, "aa:00:00:00:00:06"),
+        ];
+
+        let plan = match_devices(project, &boards, devices);
+        let matched: Vec<(String, String)> = plan
+            .targets
+            .iter()
+            .map(|target| (target.device.port.clone(), target.board.name.clone()))
+            .collect();
+        // The c6 device is assigned by MAC although c6_sensor fits it as well
+        assert_eq!(
+            matched,
+            [
+                ("/dev/ttyUSB0".to_string(), "s3_box".to_string()),
+                ("/dev/ttyUSB1".to_string(), "s3_mini".to_string()),
+                ("/dev/ttyACM0".to_string(), "c6_probe".to_string()),
+            ]
+        );
+        assert_eq!(plan.targets[0].label(), "s3_box@/dev/ttyUSB0");
+
+        let skipped: Vec<&str> = plan
+            .skipped
+            .iter()
+            .map(|(device, _)| device.port.as_str())
+            .collect();
+        assert_eq!(skipped, ["/dev/ttyUSB2", "/dev/ttyACM1", "/dev/ttyACM2"]);
+        assert!(plan.skipped[1].1.contains("c3_a, c3_b"));
+        assert!(plan.skipped[2].1.contains("no board configuration"));
+
+        assert_eq!(flash_progress("Writing at 0x00010000... (42 %)"), Some(42));
+        assert_eq!(flash_progress("[00:00:03] segment 2/3 100%"), Some(100));
+        assert_eq!(flash_progress("Hash of data verified."), None);
+    }
+}
@@ -0,0 +1,148 @@
+//! Flashing only some of a build's images
+//!
+//! `espbrew flash --only app` rewrites the app partitions and leaves the
+//! rest of the flash alone, `--only bootloader` the bootloader, so neither
+//! touches the NVS partition. Each image of a build belongs to one part:
+//!
+//! - `bootloader`: the second stage bootloader
+//! - `partition-table`: the partition table and the initial OTA data, which
+//!   selects the app to boot within it
+//! - `app`: images of app partitions
+//! - `storage`: images of other data partitions, such as the NVS and
+//!   filesystem images espbrew generates
+
+use std::fmt;
+
+use crate::models::flash::FlashBinaryInfo;
+use crate::utils::partition_table::PartitionEntry;
+
+/// Where ESP-IDF puts the partition table unless configured otherwise;
+/// the bootloader always comes before it
+const DEFAULT_PARTITION_TABLE_OFFSET: u32 = 0x8000;
+
+/// Part of a build's images to flash
+#[derive(Debug, Clone, Copy, PartialEq, Eq, clap::ValueEnum)]
+pub enum FlashPart {
+    App,
+    Bootloader,
+    PartitionTable,
+    Storage,
+}
+
+impl fmt::Display for FlashPart {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(match self {
+            FlashPart::App => "app",
+            FlashPart::Bootloader => "bootloader",
+            FlashPart::PartitionTable => "partition-table",
+            FlashPart::Storage => "storage",
+        })
+    }
+}
+
+/// Part an image belongs to, by its name in `flash_args` and the partition it is
+/// written to
+pub fn classify(binary: &FlashBinaryInfo, partitions: &[PartitionEntry]) -> FlashPart {
+    match binary.name.as_str() {
+        "bootloader" => return FlashPart::Bootloader,
+        "partition-table" => return FlashPart::PartitionTable,
+        _ => {}
+    }
+    let partition = partitions
+        .iter()
+        .find(|entry| entry.offset <= binary.offset && binary.offset < entry.end());
+    match partition {
+        Some(entry) if entry.is_app() => FlashPart::App,
+        Some(entry) if entry.subtype_name() == "ota" => FlashPart::PartitionTable,
+        Some(_) => FlashPart::Storage,
+        None if binary.offset < DEFAULT_PARTITION_TABLE_OFFSET => FlashPart::Bootloader,
+        None => FlashPart::PartitionTable,
+    }
+}
+
+/// Whether `only` flashes images of `part`; nothing in `only` flashes everything
+pub fn includes(only: &[FlashPart], part: FlashPart) -> bool {
+    only.is_empty() || only.contains(&part)
+}
+
+/// The images of `binaries` belonging to the parts of `only`
+pub fn select_binaries(
+    binaries: Vec<FlashBinaryInfo>,
+    partitions: &[PartitionEntry],
+    only: &[FlashPart],
+) -> Vec<FlashBinaryInfo> {
+    binaries
+        .into_iter()
+        .filter(|binary| includes(only, classify(binary, partitions)))
+        .collect()
+}
+
+/// `app, bootloader` for messages
+pub fn describe(only: &[FlashPart]) -> String {
+    only.iter()
+        .map(|part| part.to_string())
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::partition_table::parse_partition_csv;
+    use std::path::PathBuf;
+
+    #[test]
+    fn test_flash_parts() {
+        let partitions = parse_partition_csv(
+            "nvs,data,nvs,0x9000,0x4000\notadata,data,ota,0xd000,0x2000\nphy_init,data,phy,0xf000,0x1000\nota_0,app,ota_0,0x10000,0x100000\nota_1,app,ota_1,0x110000,0x100000\nstorage,data,spiffs,0x210000,0x100000\n",
+        )
+        .unwrap();
+        let binary = |name: &str, offset: u32| FlashBinaryInfo {
+            name: name.to_string(),
+            file_name: format!("{}.bin", name),
+            file_path: PathBuf::from(format!("{}.bin", name)),
+            offset,
+        };
+        let binaries = vec![
+            binary("bootloader", 0x0),
+            binary("partition-table", 0x8000),
+            binary("app", 0xd000),
+            binary("app", 0x10000),
+            binary("nvs", 0x9000),
+            binary("app", 0x210000),
+        ];
+        let parts: Vec<FlashPart> = binaries.iter().map(|b| classify(b, &partitions)).collect();
+        assert_eq!(
+            parts,
+            vec![
+                FlashPart::Bootloader,
+                FlashPart::PartitionTable,
+                FlashPart::PartitionTable,
+                FlashPart::App,
+                FlashPart::Storage,
+                FlashPart::Storage,
+            ]
+        );
+        // An image of an unknown name before the partition table is a bootloader
+        assert_eq!(
+            classify(&binary("app", 0x1000), &partitions),
+            FlashPart::Bootloader
+        );
+
+        assert!(includes(&[], FlashPart::Storage));
+        assert!(!includes(&[FlashPart::App], FlashPart::Storage));
+        let offsets = |only: &[FlashPart]| -> Vec<u32> {
+            select_binaries(binaries.clone(), &partitions, only)
+                .iter()
+                .map(|b| b.offset)
+                .collect()
+        };
+        assert_eq!(offsets(&[FlashPart::App]), vec![0x10000]);
+        assert_eq!(offsets(&[FlashPart::Bootloader]), vec![0x0]);
+        assert_eq!(
+            offsets(&[FlashPart::PartitionTable, FlashPart::Storage]),
+            vec![0x8000, 0xd000, 0x9000, 0x210000]
+        );
+        assert_eq!(offsets(&[]).len(), binaries.len());
+    }
+}
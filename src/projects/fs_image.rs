@@ -0,0 +1,278 @@
+//! SPIFFS and LittleFS images of a board's data directory
+//!
+//! Web assets and config files live in `data.<board>/`, or `data/` for every
+//! board. When the board is flashed, the directory is packed into an image of
+//! the storage partition's size and written with the other images:
+//!
+//! ```yaml
+//! boards:
+//!   s3_box:
+//!     filesystem:
+//!       dir: web/dist         # data.<board>/ or data/ by default
+//!       type: littlefs        # spiffs or littlefs, by default the partition's subtype
+//!       partition: storage    # the first spiffs or littlefs partition by default
+//! ```
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::{FilesystemImage, FilesystemKind, ProjectConfig};
+use crate::models::flash::FlashBinaryInfo;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::erase::{board_partitions, find_partition};
+use crate::services::run_flash_tool;
+use crate::utils::esp_idf_utils::find_python;
+use crate::utils::partition_table::PartitionEntry;
+
+/// Directory packed for every board without its own
+pub const DATA_DIR: &str = "data";
+
+/// Generator script of an ESP-IDF checkout, relative to `IDF_PATH`
+const SPIFFS_GENERATOR: &str = "components/spiffs/spiffsgen.py";
+
+/// Flash sector and page size the ESP-IDF SPIFFS and LittleFS drivers default to
+const BLOCK_SIZE: u32 = 4096;
+const PAGE_SIZE: u32 = 256;
+
+/// Directory packed for a board: the configured one, else `data.<board>/`,
+/// else `data/`, if it exists
+pub fn data_dir(
+    project_dir: &Path,
+    board_name: &str,
+    image: Option<&FilesystemImage>,
+) -> Option<PathBuf> {
+    if let Some(dir) = image.and_then(|image| image.dir.as_deref()) {
+        return Some(project_dir.join(dir));
+    }
+    [
+        project_dir.join(format!("{}.{}", DATA_DIR, board_name)),
+        project_dir.join(DATA_DIR),
+    ]
+    .into_iter()
+    .find(|dir| dir.is_dir())
+}
+
+/// Partition the image is written to, and the filesystem it gets
+pub fn storage_partition<'a>(
+    partitions: &'a [PartitionEntry],
+    image: Option<&FilesystemImage>,
+) -> Result<(&'a PartitionEntry, FilesystemKind)> {
+    let partition = match image.and_then(|image| image.partition.as_deref()) {
+        Some(name) => find_partition(partitions, name)?,
+        None => partitions
+            .iter()
+            .find(|entry| {
+                !entry.is_app() && matches!(entry.subtype_name().as_str(), "spiffs" | "littlefs")
+            })
+            .ok_or_else(|| {
+                anyhow::anyhow!("The partition table has no spiffs or littlefs data partition")
+            })?,
+    };
+    let kind = image.and_then(|image| image.kind).unwrap_or_else(|| {
+        if partition.subtype_name() == "littlefs" {
+            FilesystemKind::Littlefs
+        } else {
+            FilesystemKind::Spiffs
+        }
+    });
+    Ok((partition, kind))
+}
+
+/// Command packing `dir` into a `size` bytes image at `output`
+pub fn image_command(
+    kind: FilesystemKind,
+    dir: &Path,
+    output: &Path,
+    size: u32,
+) -> Result<Command> {
+    let size = format!("0x{:x}", size);
+    Ok(match kind {
+        FilesystemKind::Spiffs => {
+            let idf_path = std::env::var_os("IDF_PATH").ok_or_else(|| {
+                anyhow::anyhow!("IDF_PATH is not set, spiffsgen.py comes with ESP-IDF")
+            })?;
+            let mut command = Command::new(find_python());
+            command
+                .arg(PathBuf::from(idf_path).join(SPIFFS_GENERATOR))
+                .arg(size)
+                .arg(dir)
+                .arg(output);
+            command
+        }
+        FilesystemKind::Littlefs => {
+            let mut command = Command::new("mklittlefs");
+            command
+                .arg("-c")
+                .arg(dir)
+                .args(["-b", &BLOCK_SIZE.to_string(), "-p", &PAGE_SIZE.to_string()])
+                .args(["-s", &size])
+                .arg(output);
+            command
+        }
+    })
+}
+
+/// Pack the board's data directory, if it has one, into an image to flash
+/// with its other images. Without a `filesystem:` section a board whose
+/// partition table has no storage partition is flashed without the image.
+pub async fn prepare_filesystem_image(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<Option<FlashBinaryInfo>> {
+    let image = ProjectConfig::load(project_dir)?
+        .as_ref()
+        .and_then(|config| config.board_section(&board_config.name))
+        .and_then(|section| section.filesystem.clone());
+    let Some(dir) = data_dir(project_dir, &board_config.name, image.as_ref()) else {
+        return Ok(None);
+    };
+    if !dir.is_dir() {
+        return Err(anyhow::anyhow!(
+            "Data directory {} does not exist",
+            dir.display()
+        ));
+    }
+
+    let partitions = board_partitions(project_dir, board_config)?;
+    let (partition, kind) = match storage_partition(&partitions, image.as_ref()) {
+        Ok(found) => found,
+        Err(e) if image.is_none() => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("⚠️  Not flashing {}: {}", dir.display(), e),
+            ));
+            return Ok(None);
+        }
+        Err(e) => return Err(e),
+    };
+
+    let fs_dir = board_config.build_dir.join("filesystem");
+    std::fs::create_dir_all(&fs_dir)
+        .with_context(|| format!("Failed to create {}", fs_dir.display()))?;
+    let output = fs_dir.join(format!("{}.bin", partition.label));
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🗂️  Packing {} into a {} image for {} (0x{:x}, {} KB)",
+            dir.display(),
+            match kind {
+                FilesystemKind::Spiffs => "SPIFFS",
+                FilesystemKind::Littlefs => "LittleFS",
+            },
+            partition.label,
+            partition.offset,
+            partition.size / 1024
+        ),
+    ));
+    let tool = match kind {
+        FilesystemKind::Spiffs => "spiffsgen.py",
+        FilesystemKind::Littlefs => "mklittlefs",
+    };
+    run_flash_tool(
+        image_command(kind, &dir, &output, partition.size)?,
+        tool,
+        &board_config.name,
+        Some(tx),
+        |_| None,
+    )
+    .await?;
+
+    Ok(Some(FlashBinaryInfo {
+        name: partition.label.clone(),
+        file_name: format!("{}.bin", partition.label),
+        file_path: output,
+        offset: partition.offset,
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::partition_table::parse_partition_csv;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_filesystem_image_partition() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+
+        // A board's own data directory wins over the shared one
+        assert_eq!(data_dir(project, "box", None), None);
+        fs::create_dir_all(project.join("data")).unwrap();
+        assert_eq!(data_dir(project, "box", None), Some(project.join("data")));
+        fs::create_dir_all(project.join("data.box")).unwrap();
+        assert_eq!(
+            data_dir(project, "box", None),
+            Some(project.join("data.box"))
+        );
+        assert_eq!(data_dir(project, "other", None), Some(project.join("data")));
+
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  box:\n    filesystem:\n      dir: web/dist\n      type: spiffs\n      partition: assets\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        let image = config
+            .board_section("box")
+            .unwrap()
+            .filesystem
+            .clone()
+            .unwrap();
+        assert_eq!(image.kind, Some(FilesystemKind::Spiffs));
+        assert_eq!(
+            data_dir(project, "box", Some(&image)),
+            Some(project.join("web/dist"))
+        );
+
+        // The filesystem follows the partition's subtype unless configured
+        let partitions = parse_partition_csv(
+            "nvs, data, nvs, 0x9000, 0x6000,\nfactory, app, factory, 0x10000, 1M,\nstorage, data, littlefs, 0x110000, 0x40000,\nassets, data, spiffs, 0x150000, 0x20000,\n",
+        )
+        .unwrap();
+        let (partition, kind) = storage_partition(&partitions, None).unwrap();
+        assert_eq!(
+            (partition.label.as_str(), partition.offset),
+            ("storage", 0x110000)
+        );
+        assert_eq!(kind, FilesystemKind::Littlefs);
+        let (partition, kind) = storage_partition(&partitions, Some(&image)).unwrap();
+        assert_eq!(partition.label, "assets");
+        assert_eq!(kind, FilesystemKind::Spiffs);
+        let no_storage = parse_partition_csv("nvs, data, nvs, 0x9000, 0x6000,\n").unwrap();
+        assert!(storage_partition(&no_storage, None).is_err());
+
+        let command = image_command(
+            FilesystemKind::Littlefs,
+            Path::new("data"),
+            Path::new("storage.bin"),
+            0x40000,
+        )
+        .unwrap();
+        assert_eq!(command.as_std().get_program(), "mklittlefs");
+        let args: Vec<String> = command
+            .as_std()
+            .get_args()
+            .map(|arg| arg.to_string_lossy().to_string())
+            .collect();
+        assert_eq!(
+            args,
+            [
+                "-c",
+                "data",
+                "-b",
+                "4096",
+                "-p",
+                "256",
+                "-s",
+                "0x40000",
+                "storage.bin"
+            ]
+        );
+    }
+}
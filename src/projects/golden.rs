@@ -0,0 +1,321 @@
+//! Golden images returning test devices to a known state
+//!
+//! `espbrew device golden` copies the images of a board's last build, e.g. a
+//! release build, into `.espbrew/golden/<board>/`: bootloader, partition
+//! table and factory app from its `flash_args`, the other apps of a multi-app
+//! project, the board's filesystem image and optionally a default NVS image,
+//! listed with their offsets in `golden.json`. `espbrew device factory-reset`
+//! erases a device's whole flash and writes those images, whatever has been
+//! built since.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::ProjectConfig;
+use crate::models::flash::{FlashBinaryInfo, FlashConfig};
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::build_history::current_commit;
+use crate::projects::device_registry::port_or_registered;
+use crate::projects::erase::{EraseTarget, board_partitions, erase_board, find_partition};
+use crate::projects::fs_image::prepare_filesystem_image;
+use crate::projects::handlers::esp_idf::EspIdfHandler;
+use crate::projects::nvs_image::NVS_PARTITION;
+use crate::projects::signing::ensure_signed;
+use crate::services::{FlashOperation, UnifiedFlashService};
+use crate::utils::espflash_utils::select_esp_port;
+
+/// Golden images of the boards, relative to the project
+pub const GOLDEN_DIR: &str = ".espbrew/golden";
+/// Manifest in a board's golden directory
+const GOLDEN_MANIFEST: &str = "golden.json";
+
+/// Images recorded for a board, relative to its golden directory
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct GoldenManifest {
+    pub recorded: chrono::DateTime<chrono::Local>,
+    pub board: String,
+    /// Short hash of `HEAD` when recorded, with `-dirty` for uncommitted changes
+    #[serde(default)]
+    pub commit: Option<String>,
+    pub flash_config: FlashConfig,
+    pub images: Vec<GoldenImage>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct GoldenImage {
+    pub name: String,
+    pub file_name: String,
+    pub offset: u32,
+}
+
+/// `.espbrew/golden/<board>/`
+pub fn golden_dir(project_dir: &Path, board_name: &str) -> PathBuf {
+    project_dir.join(GOLDEN_DIR).join(board_name)
+}
+
+/// The board's recorded golden images, if any
+pub fn load_golden(project_dir: &Path, board_name: &str) -> Result<Option<GoldenManifest>> {
+    let path = golden_dir(project_dir, board_name).join(GOLDEN_MANIFEST);
+    if !path.exists() {
+        return Ok(None);
+    }
+    let content = std::fs::read_to_string(&path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+    let manifest =
+        serde_json::from_str(&content).with_context(|| format!("Invalid {}", path.display()))?;
+    Ok(Some(manifest))
+}
+
+/// The manifest's images in `dir`, to flash
+pub fn golden_binaries(dir: &Path, manifest: &GoldenManifest) -> Vec<FlashBinaryInfo> {
+    manifest
+        .images
+        .iter()
+        .map(|image| FlashBinaryInfo {
+            name: image.name.clone(),
+            file_name: image.file_name.clone(),
+            file_path: dir.join(&image.file_name),
+            offset: image.offset,
+        })
+        .collect()
+}
+
+/// Record the images of the board's last build, plus `nvs` as the default
+/// content of its NVS partition, as the board's golden images
+pub async fn record_golden(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    nvs: Option<&Path>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<GoldenManifest> {
+    ensure_signed(project_dir, board_config)?;
+    let flash_args = board_config.build_dir.join("flash_args");
+    if !flash_args.exists() {
+        return Err(anyhow::anyhow!(
+            "No flash_args in {}, build {} first",
+            board_config.build_dir.display(),
+            board_config.name
+        ));
+    }
+    let (flash_config, mut binaries) = EspIdfHandler.build_images(project_dir, board_config)?;
+    if let Some(image) = prepare_filesystem_image(project_dir, board_config, tx).await? {
+        binaries.retain(|binary| binary.offset != image.offset);
+        binaries.push(image);
+    }
+    if let Some(nvs) = nvs {
+        let partition_name = ProjectConfig::load(project_dir)?
+            .as_ref()
+            .and_then(|config| config.board_section(&board_config.name))
+            .and_then(|section| section.nvs.as_ref())
+            .and_then(|image| image.partition.clone())
+            .unwrap_or_else(|| NVS_PARTITION.to_string());
+        let partitions = board_partitions(project_dir, board_config)?;
+        let partition = find_partition(&partitions, &partition_name)?;
+        let size = std::fs::metadata(nvs)
+            .with_context(|| format!("Failed to read NVS image {}", nvs.display()))?
+            .len();
+        if size > partition.size as u64 {
+            return Err(anyhow::anyhow!(
+                "{} ({} KB) doesn't fit the {} partition ({} KB)",
+                nvs.display(),
+                size / 1024,
+                partition.label,
+                partition.size / 1024
+            ));
+        }
+        binaries.retain(|binary| binary.offset != partition.offset);
+        binaries.push(FlashBinaryInfo {
+            name: partition.label.clone(),
+            file_name: format!("{}.bin", partition.label),
+            file_path: nvs.to_path_buf(),
+            offset: partition.offset,
+        });
+    }
+    binaries.sort_by_key(|binary| binary.offset);
+
+    let dir = golden_dir(project_dir, &board_config.name);
+    if dir.exists() {
+        std::fs::remove_dir_all(&dir)
+            .with_context(|| format!("Failed to clear {}", dir.display()))?;
+    }
+    std::fs::create_dir_all(&dir).with_context(|| format!("Failed to create {}", dir.display()))?;
+    let mut images = Vec::new();
+    for binary in &binaries {
+        // Images of different build directories may share a file name
+        let file_name = format!("0x{:x}-{}", binary.offset, binary.file_name);
+        std::fs::copy(&binary.file_path, dir.join(&file_name))
+            .with_context(|| format!("Failed to copy {}", binary.file_path.display()))?;
+        images.push(GoldenImage {
+            name: binary.name.clone(),
+            file_name,
+            offset: binary.offset,
+        });
+    }
+
+    let manifest = GoldenManifest {
+        recorded: chrono::Local::now(),
+        board: board_config.name.clone(),
+        commit: current_commit(project_dir).await,
+        flash_config,
+        images,
+    };
+    let manifest_path = dir.join(GOLDEN_MANIFEST);
+    std::fs::write(&manifest_path, serde_json::to_string_pretty(&manifest)?)
+        .with_context(|| format!("Failed to write {}", manifest_path.display()))?;
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🏅 Recorded {} golden images{} in {}",
+            manifest.images.len(),
+            manifest
+                .commit
+                .as_deref()
+                .map(|commit| format!(" of {}", commit))
+                .unwrap_or_default(),
+            dir.display()
+        ),
+    ));
+    Ok(manifest)
+}
+
+/// Erase the whole flash of the board's device and write its golden images
+pub async fn factory_reset(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: Option<&str>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let manifest = load_golden(project_dir, &board_config.name)?.ok_or_else(|| {
+        anyhow::anyhow!(
+            "No golden images of {}, record them with `espbrew device golden -b {}`",
+            board_config.name,
+            board_config.name
+        )
+    })?;
+    let binaries = golden_binaries(&golden_dir(project_dir, &board_config.name), &manifest);
+    if let Some(missing) = binaries.iter().find(|b| !b.file_path.exists()) {
+        return Err(anyhow::anyhow!(
+            "Golden image {} is missing, record the golden images again",
+            missing.file_path.display()
+        ));
+    }
+    let flash_service = UnifiedFlashService::for_board(project_dir, board_config)?;
+    if !flash_service.writes_images() {
+        return Err(anyhow::anyhow!(
+            "{} flashes with {}, which writes the image of the last build and not the golden images",
+            board_config.name,
+            flash_service.backend_name()
+        ));
+    }
+
+    let port = match port_or_registered(project_dir, &board_config.name, port, tx).await? {
+        Some(port) => port,
+        None => select_esp_port()?,
+    };
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🏭 Factory reset of {} on {} to the golden images recorded {}",
+            board_config.name,
+            port,
+            manifest.recorded.format("%Y-%m-%d %H:%M")
+        ),
+    ));
+    erase_board(
+        project_dir,
+        board_config,
+        Some(&port),
+        &EraseTarget::All,
+        tx,
+    )
+    .await?;
+
+    let result = flash_service
+        .flash_board(
+            FlashOperation {
+                port: port.clone(),
+                binaries,
+                flash_config: Some(manifest.flash_config),
+                board_name: Some(board_config.name.clone()),
+                verify: false,
+                encrypt: false,
+            },
+            Some(tx.clone()),
+        )
+        .await?;
+    if !result.success {
+        return Err(anyhow::anyhow!("Factory reset failed: {}", result.message));
+    }
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("✅ {} is back on its golden images", port),
+    ));
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_golden_images() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        let build_dir = project.join("build.box");
+        fs::create_dir_all(build_dir.join("bootloader")).unwrap();
+        fs::write(
+        build_dir.join("flash_args"),
+            "--flash_mode dio --flash_freq 80m --flash_size 8MB\n0x0 bootloader/bootloader.bin\n0x8000 partition_table/partition-table.bin\n0x10000 app.bin\n",
+        )
+        .unwrap();
+        fs::create_dir_all(build_dir.join("partition_table")).unwrap();
+        fs::write(build_dir.join("bootloader/bootloader.bin"), b"boot").unwrap();
+        fs::write(
+            build_dir.join("partition_table/partition-table.bin"),
+            b"table",
+        )
+        .unwrap();
+        fs::write(build_dir.join("app.bin"), b"app v1").unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        let nvs = project.join("nvs-defaults.bin");
+        fs::write(&nvs, vec![0xffu8; 0x1000]).unwrap();
+
+        let board = ProjectBoardConfig {
+            name: "box".to_string(),
+            config_file: project.join("sdkconfig.defaults.box"),
+            build_dir: build_dir.clone(),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        assert!(load_golden(project, "box").unwrap().is_none());
+
+        let (tx, _rx) = tokio::sync::mpsc::unbounded_channel::<AppEvent>();
+        let manifest = record_golden(project, &board, Some(&nvs), &tx)
+            .await
+            .unwrap();
+        let offsets: Vec<u32> = manifest.images.iter().map(|image| image.offset).collect();
+        assert_eq!(offsets, vec![0x0, 0x8000, 0x9000, 0x10000]);
+        assert_eq!(manifest.flash_config.flash_size, "8MB");
+
+        // Later builds leave the golden images alone
+        fs::write(build_dir.join("app.bin"), b"app v2").unwrap();
+        let dir = golden_dir(project, "box");
+        let loaded = load_golden(project, "box").unwrap().unwrap();
+        let binaries = golden_binaries(&dir, &loaded);
+        let app = binaries.iter().find(|b| b.offset == 0x10000).unwrap();
+        assert_eq!(app.file_path, dir.join("0x10000-app.bin"));
+        assert_eq!(fs::read(&app.file_path).unwrap(), b"app v1");
+        assert_eq!(fs::read(dir.join("0x9000-nvs.bin")).unwrap().len(), 0x1000);
+        assert!(binaries.iter().all(|b| b.file_path.starts_with(&dir)));
+    }
+}
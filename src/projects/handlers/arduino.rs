@@ -1,5 +1,8 @@
+use crate::config::ProjectConfig;
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
+use crate::projects::build_layout;
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 use anyhow::{Context, Result, anyhow};
 use async_trait::async_trait;
 use serde::{Deserialize, Serialize};
@@ -19,6 +22,20 @@ struct ArduinoProjectBoardConfig {
     build_properties: std::collections::HashMap<String, String>,
 }
 
+/// Subset of arduino-cli's sketch.yaml used for board discovery
+#[derive(Debug, Clone, Default, Deserialize)]
+struct SketchProject {
+    #[serde(default)]
+    default_fqbn: Option<String>,
+    #[serde(default)]
+    profiles: std::collections::BTreeMap<String, SketchProfile>,
+}
+
+#[derive(Debug, Clone, Deserialize)]
+struct SketchProfile {
+    fqbn: String,
+}
+
 #[derive(Debug, Clone, Deserialize, Serialize)]
 struct ArduinoProjectConfig {
     project_type: String,
@@ -72,10 +89,37 @@ impl ArduinoHandler {
         Ok(sketch_files)
     }
 
-    /// Parse the Arduino project configuration from boards.json
+    /// Parse the Arduino project configuration.
+    ///
+    /// Boards come from the `arduino.fqbns` list in espbrew.yaml, then boards.json,
+    /// then the profiles/default_fqbn of sketch.yaml, falling back to a single ESP32-C6 board.
     fn parse_project_config(&self, project_dir: &Path) -> Result<ArduinoProjectConfig> {
+        if let Some(section) = ProjectConfig::load(project_dir)?.and_then(|c| c.arduino) {
+            if !section.fqbns.is_empty() {
+                let mut names = std::collections::HashSet::new();
+                for entry in &section.fqbns {
+                    if !names.insert(entry.name()) {
+                        return Err(anyhow!(
+                            "Two arduino.fqbns entries are named '{}'; give them distinct names with `name:` and `fqbn:`",
+                            entry.name()
+                        ));
+                    }
+                }
+                let boards = section
+                    .fqbns
+                    .iter()
+                    .map(|entry| self.board_from_fqbn(entry.name(), entry.fqbn()))
+                    .collect();
+                return Ok(self.config_with_boards(boards));
+            }
+        }
+
         let config_path = project_dir.join("boards.json");
         if !config_path.exists() {
+            if let Some(boards) = self.boards_from_sketch_yaml(project_dir)? {
+                return Ok(self.config_with_boards(boards));
+            }
+
             // Create a default configuration for single-board projects
             return Ok(ArduinoProjectConfig {
                 project_type: "arduino".to_string(),
@@ -101,14 +145,117 @@ impl ArduinoHandler {
         Ok(config)
     }
 
+    /// Read board configurations from arduino-cli's sketch.yaml, if present
+    fn boards_from_sketch_yaml(
+        &self,
+        project_dir: &Path,
+    ) -> Result<Option<Vec<ArduinoProjectBoardConfig>>> {
+        let sketch_path = project_dir.join("sketch.yaml");
+        if !sketch_path.exists() {
+            return Ok(None);
+        }
+
+        let content = std::fs::read_to_string(&sketch_path)
+            .with_context(|| format!("Failed to read {}", sketch_path.display()))?;
+        let sketch: SketchProject = serde_yaml::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", sketch_path.display()))?;
+
+        let mut boards: Vec<ArduinoProjectBoardConfig> = sketch
+            .profiles
+            .iter()
+            .map(|(name, profile)| self.board_from_fqbn(name.clone(), &profile.fqbn))
+            .collect();
+
+        if boards.is_empty() {
+            if let Some(fqbn) = sketch.default_fqbn {
+                let name = fqbn.split(':').nth(2).unwrap_or("default").to_string();
+                boards.push(self.board_from_fqbn(name, &fqbn));
+            }
+        }
+
+        Ok(if boards.is_empty() {
+            None
+        } else {
+            Some(boards)
+        })
+    }
+
+    /// Build a board entry from an FQBN such as `esp32:esp32:esp32s3:CDCOnBoot=cdc`
+    fn board_from_fqbn(&self, name: String, fqbn: &str) -> ArduinoProjectBoardConfig {
+        let target = self.fqbn_to_target(fqbn);
+        ArduinoProjectBoardConfig {
+            description: format!("{} ({})", target, fqbn),
+            name,
+            fqbn: fqbn.to_string(),
+            target,
+            build_properties: std::collections::HashMap::new(),
+        }
+    }
+
+    fn config_with_boards(&self, boards: Vec<ArduinoProjectBoardConfig>) -> ArduinoProjectConfig {
+        ArduinoProjectConfig {
+            project_type: "arduino".to_string(),
+            description: Some("Arduino project".to_string()),
+            boards,
+            libraries: Vec::new(),
+            build_settings: std::collections::HashMap::new(),
+        }
+    }
+
+    /// Map the board id of an ESP32 FQBN to an espbrew target name
+    fn fqbn_to_target(&self, fqbn: &str) -> String {
+        let board_id = fqbn.split(':').nth(2).unwrap_or(fqbn).to_lowercase();
+        let targets = [
+            ("esp32s3", "ESP32-S3"),
+            ("esp32s2", "ESP32-S2"),
+            ("esp32c6", "ESP32-C6"),
+            ("esp32c3", "ESP32-C3"),
+            ("esp32h2", "ESP32-H2"),
+            ("esp32p4", "ESP32-P4"),
+        ];
+
+        targets
+            .iter()
+            .find(|(id, _)| board_id.contains(id))
+            .map(|(_, target)| target.to_string())
+            .unwrap_or_else(|| "ESP32".to_string())
+    }
+
+    /// Find the Arduino board entry that corresponds to a discovered board configuration
+    fn find_board<'a>(
+        &self,
+        project_dir: &Path,
+        project_config: &'a ArduinoProjectConfig,
+        board_config: &ProjectBoardConfig,
+    ) -> Option<&'a ArduinoProjectBoardConfig> {
+        // Format: "project-name-board-config-name" -> "board-config-name"
+        let project_name = project_dir
+            .file_name()
+            .and_then(|n| n.to_str())
+            .unwrap_or("arduino");
+        let board_name = board_config
+            .name
+            .strip_prefix(&format!("{}-", project_name))
+            .unwrap_or(&board_config.name);
+
+        project_config
+            .boards
+            .iter()
+            .find(|b| b.name == board_name)
+            .or_else(|| {
+                let suffix = board_config.name.split('-').last().unwrap_or("default");
+                project_config.boards.iter().find(|b| b.name == suffix)
+            })
+    }
+
     /// Find build artifacts after compilation
     fn find_build_artifacts(
         &self,
         project_dir: &Path,
-        _board_name: &str,
+        board_config: &ProjectBoardConfig,
     ) -> Result<Vec<BuildArtifact>> {
         let mut artifacts = Vec::new();
-        let build_dir = project_dir.join("build");
+        let build_dir = &board_config.build_dir;
 
         // Arduino build artifacts have predictable names based on the sketch
         let sketch_files = self.find_sketch_files(project_dir)?;
@@ -202,16 +349,16 @@ impl ProjectHandler for ArduinoHandler {
 
     fn check_artifacts_exist(
         &self,
-        project_dir: &Path,
-        _board_config: &ProjectBoardConfig,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
     ) -> bool {
-        // For Arduino, check if build directory contains .bin files
-        let build_dir = project_dir.join("build");
+        // For Arduino, check if the board's build directory contains .bin files
+        let build_dir = &board_config.build_dir;
         if !build_dir.exists() {
             return false;
         }
         // Check for any .bin files in build directory
-        if let Ok(entries) = std::fs::read_dir(&build_dir) {
+        if let Ok(entries) = std::fs::read_dir(build_dir) {
             for entry in entries.flatten() {
                 if let Some(ext) = entry.path().extension() {
                     if ext == "bin" {
@@ -235,9 +382,9 @@ impl ProjectHandler for ArduinoHandler {
             }
         }
 
-        // Check for arduino-cli.yaml configuration
-        let arduino_cli_config = project_dir.join("arduino-cli.yaml");
-        if arduino_cli_config.exists() {
+        // Check for arduino-cli.yaml or sketch.yaml configuration
+        if project_dir.join("arduino-cli.yaml").exists() || project_dir.join("sketch.yaml").exists()
+        {
             return true;
         }
 
@@ -266,8 +413,12 @@ impl ProjectHandler for ArduinoHandler {
         let mut boards = Vec::new();
 
         for board_config in config.boards {
-            let config_file = if project_dir.join("boards.json").exists() {
+            let config_file = if ProjectConfig::path(project_dir).exists() {
+                ProjectConfig::path(project_dir)
+            } else if project_dir.join("boards.json").exists() {
                 project_dir.join("boards.json")
+            } else if project_dir.join("sketch.yaml").exists() {
+                project_dir.join("sketch.yaml")
             } else {
                 // Create a virtual config file path for boards without explicit config
                 project_dir.join(format!("{}.json", board_config.name))
@@ -283,13 +434,19 @@ impl ProjectHandler for ArduinoHandler {
                     board_config.name
                 ),
                 config_file,
-                build_dir: project_dir.join("build"),
+                // Separate build paths let boards compile in parallel without clobbering each other
+                build_dir: project_dir.join("build").join(&board_config.name),
                 target: Some(board_config.target),
                 project_type: ProjectType::Arduino,
             });
         }
 
-        Ok(boards)
+        let config = ProjectConfig::load(project_dir).ok().flatten();
+        Ok(build_layout::place_build_dirs(
+            project_dir,
+            config.as_ref(),
+            boards,
+        ))
     }
 
     async fn build_board(
@@ -309,23 +466,14 @@ impl ProjectHandler for ArduinoHandler {
 
         // Parse project configuration to get FQBN for this board
         let project_config = self.parse_project_config(project_dir)?;
-        // Extract the actual board name from the full board config name
-        // Format: "project-name-board-config-name" -> "board-config-name"
-        let project_name = project_dir
-            .file_name()
-            .and_then(|n| n.to_str())
-            .unwrap_or("arduino");
-        let board_name = if board_config.name.starts_with(&format!("{}-", project_name)) {
-            &board_config.name[project_name.len() + 1..]
-        } else {
-            board_config.name.split('-').last().unwrap_or("default")
-        };
-
-        let arduino_board = project_config
-            .boards
-            .iter()
-            .find(|b| b.name == board_name)
-            .ok_or_else(|| anyhow!("Board configuration '{}' not found in config", board_name))?;
+        let arduino_board = self
+            .find_board(project_dir, &project_config, board_config)
+            .ok_or_else(|| {
+                anyhow!(
+                    "Board configuration '{}' not found in config",
+                    board_config.name
+                )
+            })?;
 
         let main_sketch = self.get_main_sketch(project_dir)?;
         let build_dir = board_config.build_dir.clone();
@@ -361,7 +509,8 @@ impl ProjectHandler for ArduinoHandler {
             format!("🔨 Executing: {}", build_command_str),
         ));
 
-        let mut child = cmd.spawn().context("Failed to start arduino-cli compile")?;
+        let mut child =
+            process_group::spawn(&mut cmd).context("Failed to start arduino-cli compile")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -406,7 +555,7 @@ impl ProjectHandler for ArduinoHandler {
             ));
 
             // Find build artifacts
-            match self.find_build_artifacts(project_dir, &board_config.name) {
+            match self.find_build_artifacts(project_dir, board_config) {
                 Ok(artifacts) => {
                     let _ = tx.send(AppEvent::BuildOutput(
                         board_config.name.clone(),
@@ -435,7 +584,7 @@ impl ProjectHandler for ArduinoHandler {
         &self,
         project_dir: &Path,
         board_config: &ProjectBoardConfig,
-        _artifacts: &[BuildArtifact],
+        artifacts: &[BuildArtifact],
         port: Option<&str>,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
@@ -450,22 +599,14 @@ impl ProjectHandler for ArduinoHandler {
 
         // Parse project configuration to get FQBN for this board
         let project_config = self.parse_project_config(project_dir)?;
-        // Extract the actual board name from the full board config name
-        let project_name = project_dir
-            .file_name()
-            .and_then(|n| n.to_str())
-            .unwrap_or("arduino");
-        let board_name = if board_config.name.starts_with(&format!("{}-", project_name)) {
-            &board_config.name[project_name.len() + 1..]
-        } else {
-            board_config.name.split('-').last().unwrap_or("default")
-        };
-
-        let arduino_board = project_config
-            .boards
-            .iter()
-            .find(|b| b.name == board_name)
-            .ok_or_else(|| anyhow!("Board configuration '{}' not found in config", board_name))?;
+        let arduino_board = self
+            .find_board(project_dir, &project_config, board_config)
+            .ok_or_else(|| {
+                anyhow!(
+                    "Board configuration '{}' not found in config",
+                    board_config.name
+                )
+            })?;
 
         let main_sketch = self.get_main_sketch(project_dir)?;
 
@@ -479,6 +620,11 @@ impl ProjectHandler for ArduinoHandler {
             cmd.args(["--port", port_str]);
         }
 
+        // Upload the binaries from this board's build path instead of the shared sketch cache
+        if !artifacts.is_empty() || self.check_artifacts_exist(project_dir, board_config) {
+            cmd.arg("--input-dir").arg(&board_config.build_dir);
+        }
+
         cmd.arg(&main_sketch)
             .stdout(Stdio::piped())
             .stderr(Stdio::piped());
@@ -495,7 +641,8 @@ impl ProjectHandler for ArduinoHandler {
             format!("🔨 Executing: {}", upload_command_str),
         ));
 
-        let mut child = cmd.spawn().context("Failed to start arduino-cli upload")?;
+        let mut child =
+            process_group::spawn(&mut cmd).context("Failed to start arduino-cli upload")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -646,9 +793,8 @@ impl ProjectHandler for ArduinoHandler {
     fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String {
         if let Ok(project_config) = self.parse_project_config(project_dir) {
             if let Ok(main_sketch) = self.get_main_sketch(project_dir) {
-                let board_name = board_config.name.split('-').last().unwrap_or("default");
                 if let Some(arduino_board) =
-                    project_config.boards.iter().find(|b| b.name == board_name)
+                    self.find_board(project_dir, &project_config, board_config)
                 {
                     return format!(
                         "arduino-cli compile --fqbn {} --build-path {} {}",
@@ -670,9 +816,8 @@ impl ProjectHandler for ArduinoHandler {
     ) -> String {
         if let Ok(project_config) = self.parse_project_config(project_dir) {
             if let Ok(main_sketch) = self.get_main_sketch(project_dir) {
-                let board_name = board_config.name.split('-').last().unwrap_or("default");
                 if let Some(arduino_board) =
-                    project_config.boards.iter().find(|b| b.name == board_name)
+                    self.find_board(project_dir, &project_config, board_config)
                 {
                     return format!(
                         "arduino-cli upload --fqbn {} {} {}",
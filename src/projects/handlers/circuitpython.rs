@@ -1,5 +1,6 @@
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -520,7 +521,9 @@ impl CircuitPythonHandler {
             cmd.args(["--port", port]);
         }
 
-        let output = cmd.output().await.context("Failed to run circup")?;
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run circup")?;
 
         if output.status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -561,7 +564,9 @@ impl CircuitPythonHandler {
                     .stdout(std::process::Stdio::piped())
                     .stderr(std::process::Stdio::piped());
 
-                let output = cmd.output().await.context("Failed to run mpremote")?;
+                let output = process_group::output(&mut cmd)
+                    .await
+                    .context("Failed to run mpremote")?;
 
                 if output.status.success() {
                     let _ = tx.send(AppEvent::BuildOutput(
@@ -604,7 +609,9 @@ impl CircuitPythonHandler {
                     .stdout(std::process::Stdio::piped())
                     .stderr(std::process::Stdio::piped());
 
-                let output = cmd.output().await.context("Failed to run ampy")?;
+                let output = process_group::output(&mut cmd)
+                    .await
+                    .context("Failed to run ampy")?;
 
                 if output.status.success() {
                     let _ = tx.send(AppEvent::BuildOutput(
@@ -0,0 +1,619 @@
+use crate::config::{BoardMetadata, ProjectConfig};
+use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
+use crate::projects::build_layout;
+use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
+
+use anyhow::{Context, Result};
+use async_trait::async_trait;
+use glob::glob;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tokio::io::{AsyncBufReadExt, BufReader};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+/// Handler for legacy ESP8266_RTOS_SDK projects (GNU Make or CMake based)
+pub struct Esp8266RtosHandler;
+
+/// Build system used by an ESP8266_RTOS_SDK project
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum Esp8266BuildSystem {
+    /// `include $(IDF_PATH)/make/project.mk`
+    Make,
+    /// `include($ENV{IDF_PATH}/tools/cmake/project.cmake)`, built with idf.py
+    CMake,
+}
+
+#[async_trait]
+impl ProjectHandler for Esp8266RtosHandler {
+    fn as_any(&self) -> &dyn std::any::Any {
+        self
+    }
+
+    fn project_type(&self) -> ProjectType {
+        ProjectType::Esp8266Rtos
+    }
+
+    fn check_artifacts_exist(
+        &self,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> bool {
+        board_config
+            .build_dir
+            .join("bootloader")
+            .join("bootloader.bin")
+            .exists()
+    }
+
+    fn can_handle(&self, project_dir: &Path) -> bool {
+        // Both build systems look like ESP-IDF, the sdkconfig tells the chip apart
+        Self::build_system(project_dir).is_some()
+            && self
+                .config_files(project_dir)
+                .iter()
+                .any(|config| Self::is_esp8266_config(config))
+    }
+
+    fn discover_boards(&self, project_dir: &Path) -> Result<Vec<ProjectBoardConfig>> {
+        let mut boards = Vec::new();
+
+        // Multi-board configurations (sdkconfig.defaults.*)
+        let defaults_pattern = project_dir.join("sdkconfig.defaults.*");
+        for entry in glob(&defaults_pattern.to_string_lossy())? {
+            let config_file = entry?;
+            let Some(board_name) = config_file
+                .file_name()
+                .and_then(|n| n.to_str())
+                .and_then(|n| n.strip_prefix("sdkconfig.defaults."))
+                .map(|n| n.to_string())
+            else {
+                continue;
+            };
+
+            boards.push(ProjectBoardConfig {
+                build_dir: project_dir.join(format!("build.{}", board_name)),
+                name: board_name,
+                config_file,
+                target: Some("esp8266".to_string()),
+                project_type: ProjectType::Esp8266Rtos,
+            });
+        }
+
+        // Single-board project
+        if boards.is_empty() {
+            let config_file = [
+                project_dir.join("sdkconfig.defaults"),
+                project_dir.join("sdkconfig"),
+            ]
+            .into_iter()
+            .find(|path| path.exists());
+
+            if let Some(config_file) = config_file {
+                boards.push(ProjectBoardConfig {
+                    name: "default".to_string(),
+                    config_file,
+                    build_dir: project_dir.join("build"),
+                    target: Some("esp8266".to_string()),
+                    project_type: ProjectType::Esp8266Rtos,
+                });
+            }
+        }
+
+        let config = ProjectConfig::load(project_dir).ok().flatten();
+        let mut boards = build_layout::place_build_dirs(project_dir, config.as_ref(), boards);
+        boards.sort_by(|a, b| a.name.cmp(&b.name));
+        Ok(boards)
+    }
+
+    async fn build_board(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<Vec<BuildArtifact>> {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "🏗️  Starting ESP8266 RTOS SDK build...".to_string(),
+        ));
+
+        let build_command = self.get_build_command(project_dir, board_config);
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🔨 Executing: {}", build_command),
+        ));
+
+        let mut cmd = self.sdk_command(project_dir, board_config)?;
+        cmd.arg(match Self::build_system(project_dir) {
+            Some(Esp8266BuildSystem::Make) => "all",
+            _ => "build",
+        });
+
+        if self.run_streaming(cmd, board_config, &tx).await? {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "✅ ESP8266 RTOS SDK build completed successfully".to_string(),
+            ));
+            self.find_build_artifacts(project_dir, board_config)
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "❌ ESP8266 RTOS SDK build failed".to_string(),
+            ));
+            Err(anyhow::anyhow!("ESP8266 RTOS SDK build failed"))
+        }
+    }
+
+    async fn flash_board(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        artifacts: &[BuildArtifact],
+        port: Option<&str>,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "🔥 Starting ESP8266 flash with esptool.py...".to_string(),
+        ));
+
+        // Fall back to the last build output when no artifacts were handed in
+        let found_artifacts;
+        let artifacts = if artifacts.is_empty() {
+            found_artifacts = self.find_build_artifacts(project_dir, board_config)?;
+            found_artifacts.as_slice()
+        } else {
+            artifacts
+        };
+
+        let flash_port = match port {
+            Some(p) => p.to_string(),
+            None => crate::utils::espflash_utils::select_esp_port()?,
+        };
+
+        // esptool detects the flash size unless the board metadata declares it
+        let metadata = BoardMetadata::load(project_dir, &board_config.name);
+        let flash_size = metadata
+            .esptool_flash_size()
+            .unwrap_or_else(|| "detect".to_string());
+        let baud = metadata.upload_baud(460800);
+
+        let mut cmd = Command::new("esptool.py");
+        cmd.current_dir(project_dir)
+            .args(["--chip", "esp8266", "--port", &flash_port, "--baud", &baud])
+            .args(metadata.esptool_args())
+            .args(["write_flash", "-z", "--flash_size", &flash_size]);
+        for artifact in artifacts {
+            if let Some(offset) = artifact.offset {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!(
+                        "📤 {} @ 0x{:x}: {}",
+                        artifact.name,
+                        offset,
+                        artifact.file_path.display()
+                    ),
+                ));
+                cmd.arg(format!("0x{:x}", offset)).arg(&artifact.file_path);
+            }
+        }
+
+        if self.run_streaming(cmd, board_config, &tx).await? {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "✅ ESP8266 flash completed successfully".to_string(),
+            ));
+            Ok(())
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "❌ ESP8266 flash failed".to_string(),
+            ));
+            Err(anyhow::anyhow!("ESP8266 flash failed"))
+        }
+    }
+
+    async fn monitor_board(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        port: Option<&str>,
+        baud_rate: u32,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "📺 Starting ESP8266 monitor on {} at {} baud",
+                port.unwrap_or("auto-detect"),
+                baud_rate
+            ),
+        ));
+
+        let mut cmd = self.sdk_command(project_dir, board_config)?;
+        match Self::build_system(project_dir) {
+            Some(Esp8266BuildSystem::Make) => {
+                cmd.arg(format!("MONITORBAUD={}", baud_rate));
+                if let Some(port) = port {
+                    cmd.arg(format!("ESPPORT={}", port));
+                }
+                cmd.arg("monitor");
+            }
+            _ => {
+                if let Some(port) = port {
+                    cmd.args(["-p", port]);
+                }
+                cmd.args(["-b", &baud_rate.to_string(), "monitor"]);
+            }
+        }
+
+        let success = self.run_streaming(cmd, board_config, &tx).await?;
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            if success {
+                "✅ ESP8266 monitoring session completed".to_string()
+            } else {
+                "❌ ESP8266 monitoring failed".to_string()
+            },
+        ));
+
+        Ok(())
+    }
+
+    async fn clean_board(
+        &self,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "🧹 Cleaning ESP8266 build artifacts...".to_string(),
+        ));
+
+        // Every board has its own build directory and sdkconfig inside it
+        if board_config.build_dir.exists() {
+            fs::remove_dir_all(&board_config.build_dir).with_context(|| {
+                format!("Failed to remove {}", board_config.build_dir.display())
+            })?;
+        }
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "✅ Clean completed successfully".to_string(),
+        ));
+
+        Ok(())
+    }
+
+    fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String {
+        let sdkconfig = board_config.build_dir.join("sdkconfig");
+        match Self::build_system(project_dir) {
+            Some(Esp8266BuildSystem::Make) => format!(
+                "cd {} && make BATCH_BUILD=1 BUILD_DIR_BASE='{}' SDKCONFIG='{}' SDKCONFIG_DEFAULTS='{}' all",
+                project_dir.display(),
+                board_config.build_dir.display(),
+                sdkconfig.display(),
+                board_config.config_file.display()
+            ),
+            _ => format!(
+                "cd {} && idf.py -B '{}' -D SDKCONFIG='{}' -D SDKCONFIG_DEFAULTS='{}' build",
+                project_dir.display(),
+                board_config.build_dir.display(),
+                sdkconfig.display(),
+                board_config.config_file.display()
+            ),
+        }
+    }
+
+    fn get_flash_command(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        port: Option<&str>,
+    ) -> String {
+        let images = self
+            .find_build_artifacts(project_dir, board_config)
+            .map(|artifacts| {
+                artifacts
+                    .iter()
+                    .filter_map(|a| {
+                        a.offset
+                            .map(|offset| format!("0x{:x} {}", offset, a.file_path.display()))
+                    })
+                    .collect::<Vec<_>>()
+                    .join(" ")
+            })
+            .unwrap_or_else(|_| {
+                format!(
+                    "0x0 {}/bootloader/bootloader.bin 0x8000 <partition table> 0x10000 <app>.bin",
+                    board_config.build_dir.display()
+                )
+            });
+
+        let metadata = BoardMetadata::load(project_dir, &board_config.name);
+        let flash_size = metadata
+            .esptool_flash_size()
+            .unwrap_or_else(|| "detect".to_string());
+
+        format!(
+            "esptool.py --chip esp8266 --port {} --baud {} write_flash -z --flash_size {} {}",
+            port.unwrap_or("/dev/ttyUSB0"),
+            metadata.upload_baud(460800),
+            flash_size,
+            images
+        )
+    }
+
+    fn check_tools_available(&self) -> Result<(), String> {
+        if std::env::var_os("IDF_PATH").is_none() {
+            return Err("IDF_PATH is not set (point it to ESP8266_RTOS_SDK)".to_string());
+        }
+        if !self.is_tool_available("xtensa-lx106-elf-gcc") {
+            return Err("xtensa-lx106-elf-gcc not found in PATH".to_string());
+        }
+        if !self.is_tool_available("esptool.py") {
+            return Err("esptool.py not found in PATH".to_string());
+        }
+
+        Ok(())
+    }
+
+    fn get_missing_tools_message(&self) -> String {
+        "⚠️  ESP8266 RTOS SDK environment is not properly set up.\n".to_string()
+            + "   Please ensure the following are installed:\n"
+            + "   - ESP8266_RTOS_SDK with IDF_PATH pointing to it: https://github.com/espressif/ESP8266_RTOS_SDK\n"
+            + "   - xtensa-lx106-elf toolchain in PATH\n"
+            + "   - make (Make projects) or idf.py (CMake projects)\n"
+            + "   - esptool.py (pip install esptool)\n"
+            + "   Press Enter to continue anyway, or 'q' to quit."
+    }
+}
+
+impl Esp8266RtosHandler {
+    /// Build system of the project, if it is an IDF-style project at all
+    pub fn build_system(project_dir: &Path) -> Option<Esp8266BuildSystem> {
+        let cmake = fs::read_to_string(project_dir.join("CMakeLists.txt")).unwrap_or_default();
+        if cmake.contains("tools/cmake/project.cmake") {
+            return Some(Esp8266BuildSystem::CMake);
+        }
+
+        let makefile = fs::read_to_string(project_dir.join("Makefile")).unwrap_or_default();
+        if makefile.contains("make/project.mk") {
+            return Some(Esp8266BuildSystem::Make);
+        }
+
+        None
+    }
+
+    /// Check whether an sdkconfig (or defaults) file selects the ESP8266
+    fn is_esp8266_config(config_file: &Path) -> bool {
+        fs::read_to_string(config_file)
+            .map(|content| {
+                content.lines().any(|line| {
+                    let line = line.trim();
+                    line == "CONFIG_IDF_TARGET_ESP8266=y"
+                        || line == "CONFIG_IDF_TARGET=\"esp8266\""
+                        || line.starts_with("CONFIG_ESP8266_")
+                })
+            })
+            .unwrap_or(false)
+    }
+
+    /// sdkconfig files of the project, including per-board defaults
+    fn config_files(&self, project_dir: &Path) -> Vec<PathBuf> {
+        fs::read_dir(project_dir)
+            .map(|entries| {
+                entries
+                    .flatten()
+                    .map(|e| e.path())
+                    .filter(|path| {
+                        path.file_name()
+                            .and_then(|n| n.to_str())
+                            .map(|n| n.starts_with("sdkconfig"))
+                            .unwrap_or(false)
+                    })
+                    .collect()
+            })
+            .unwrap_or_default()
+    }
+
+    /// make or idf.py invocation with the board's build directory and sdkconfig
+    fn sdk_command(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Command> {
+        let sdkconfig = board_config.build_dir.join("sdkconfig");
+
+        let mut cmd = match Self::build_system(project_dir) {
+            Some(Esp8266BuildSystem::Make) => {
+                let mut cmd = Command::new("make");
+                cmd.arg(format!(
+                    "-j{}",
+                    std::thread::available_parallelism()
+                        .map(|n| n.get())
+                        .unwrap_or(4)
+                ))
+                .arg("BATCH_BUILD=1")
+                .arg(format!(
+                    "BUILD_DIR_BASE={}",
+                    board_config.build_dir.display()
+                ))
+                .arg(format!("SDKCONFIG={}", sdkconfig.display()))
+                .arg(format!(
+                    "SDKCONFIG_DEFAULTS={}",
+                    board_config.config_file.display()
+                ));
+                cmd
+            }
+            Some(Esp8266BuildSystem::CMake) => {
+                let mut cmd = Command::new("idf.py");
+                cmd.arg("-B")
+                    .arg(&board_config.build_dir)
+                    .arg("-D")
+                    .arg(format!("SDKCONFIG={}", sdkconfig.display()))
+                    .arg("-D")
+                    .arg(format!(
+                        "SDKCONFIG_DEFAULTS={}",
+                        board_config.config_file.display()
+                    ));
+                cmd
+            }
+            None => {
+                return Err(anyhow::anyhow!(
+                    "No ESP8266_RTOS_SDK Makefile or CMakeLists.txt in {}",
+                    project_dir.display()
+                ));
+            }
+        };
+
+        cmd.current_dir(project_dir).env("PYTHONUNBUFFERED", "1");
+        Ok(cmd)
+    }
+
+    /// Images to flash: from `flash_project_args` when the build wrote one, otherwise from
+    /// the fixed ESP8266 layout (bootloader 0x0, partition table 0x8000, app 0x10000)
+    pub fn find_build_artifacts(
+        &self,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<BuildArtifact>> {
+        let build_dir = &board_config.build_dir;
+
+        let flash_args = build_dir.join("flash_project_args");
+        if flash_args.exists() {
+            let (_, binaries) =
+                crate::services::UnifiedFlashService::parse_flash_args(&flash_args, build_dir)?;
+            return Ok(binaries
+                .into_iter()
+                .map(|binary| BuildArtifact {
+                    artifact_type: match binary.offset {
+                        0x0 => ArtifactType::Bootloader,
+                        0x8000 => ArtifactType::PartitionTable,
+                        _ => ArtifactType::Application,
+                    },
+                    name: binary.name,
+                    file_path: binary.file_path,
+                    offset: Some(binary.offset),
+                })
+                .collect());
+        }
+
+        let bootloader = build_dir.join("bootloader").join("bootloader.bin");
+        if !bootloader.exists() {
+            return Err(anyhow::anyhow!(
+                "No ESP8266 build artifacts found in {}. Build the project first.",
+                build_dir.display()
+            ));
+        }
+
+        let mut artifacts = vec![BuildArtifact {
+            name: "bootloader".to_string(),
+            file_path: bootloader,
+            artifact_type: ArtifactType::Bootloader,
+            offset: Some(0x0),
+        }];
+
+        let mut top_level_bins: Vec<PathBuf> = fs::read_dir(build_dir)?
+            .flatten()
+            .map(|e| e.path())
+            .filter(|p| p.extension().map(|e| e == "bin").unwrap_or(false))
+            .collect();
+        top_level_bins.sort();
+
+        // Make builds write partitions_<table>.bin next to the app image
+        for bin in top_level_bins {
+            let file_name = bin
+                .file_name()
+                .map(|n| n.to_string_lossy().to_string())
+                .unwrap_or_default();
+            if file_name.starts_with("partition") {
+                artifacts.push(BuildArtifact {
+                    name: "partition-table".to_string(),
+                    file_path: bin,
+                    artifact_type: ArtifactType::PartitionTable,
+                    offset: Some(0x8000),
+                });
+            } else {
+                artifacts.push(BuildArtifact {
+                    name: file_name.trim_end_matches(".bin").to_string(),
+                    file_path: bin,
+                    artifact_type: ArtifactType::Application,
+                    offset: Some(0x10000),
+                });
+            }
+        }
+
+        let partition_table = build_dir
+            .join("partition_table")
+            .join("partition-table.bin");
+        if partition_table.exists() {
+            artifacts.push(BuildArtifact {
+                name: "partition-table".to_string(),
+                file_path: partition_table,
+                artifact_type: ArtifactType::PartitionTable,
+                offset: Some(0x8000),
+            });
+        }
+
+        Ok(artifacts)
+    }
+
+    /// Run a command, streaming stdout and stderr to the board's log
+    async fn run_streaming(
+        &self,
+        mut cmd: Command,
+        board_config: &ProjectBoardConfig,
+        tx: &mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<bool> {
+        cmd.stdout(std::process::Stdio::piped())
+            .stderr(std::process::Stdio::piped());
+
+        let mut child =
+            process_group::spawn(&mut cmd).context("Failed to start ESP8266 SDK tool")?;
+        let stdout = child.stdout.take().unwrap();
+        let stderr = child.stderr.take().unwrap();
+
+        let tx_stdout = tx.clone();
+        let tx_stderr = tx.clone();
+        let board_name_stdout = board_config.name.clone();
+        let board_name_stderr = board_config.name.clone();
+
+        // Handle stdout
+        tokio::spawn(async move {
+            let mut reader = BufReader::new(stdout);
+            let mut buffer = String::new();
+
+            while reader.read_line(&mut buffer).await.unwrap_or(0) > 0 {
+                let line = buffer.trim().to_string();
+                let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+                buffer.clear();
+            }
+        });
+
+        // Handle stderr
+        tokio::spawn(async move {
+            let mut reader = BufReader::new(stderr);
+            let mut buffer = String::new();
+
+            while reader.read_line(&mut buffer).await.unwrap_or(0) > 0 {
+                let line = buffer.trim().to_string();
+                let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+                buffer.clear();
+            }
+        });
+
+        let status = child.wait().await.context("Failed to wait for process")?;
+        Ok(status.success())
+    }
+
+    fn is_tool_available(&self, tool: &str) -> bool {
+        std::process::Command::new("which")
+            .arg(tool)
+            .output()
+            .map(|output| output.status.success())
+            .unwrap_or(false)
+    }
+}
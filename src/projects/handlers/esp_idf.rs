@@ -1,7 +1,37 @@
+use crate::config::build_profiles;
+use crate::config::sdkconfig_fragments::{
+    EFFECTIVE_DEFAULTS_FILE, SdkconfigOption, apply_overrides, effective_defaults_file,
+    effective_options, fragment_chain, has_bases,
+};
+use crate::config::sdkconfig_lint::{self, LintIssue};
+use crate::config::{
+    BoardMetadata, CMAKE_PRESETS_FILE, CmakePreset, ContainerSpec, EspIdfApp, ProjectConfig,
+    deselected_choices, is_cmake_presets_file, load_cmake_presets,
+};
 use crate::models::flash::{FlashBinaryInfo, FlashConfig};
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
+use crate::projects::build_layout;
+use crate::projects::build_plan::PlannedCommand;
+use crate::projects::component_harness;
+use crate::projects::container_build::{board_container, run_in_container, shell_quote};
+use crate::projects::erase::board_partitions;
+use crate::projects::flash_encryption::{
+    EncryptedFlash, check_flash_encryption, pre_encrypted_binaries,
+};
+use crate::projects::flash_parts::{FlashPart, describe, includes, select_binaries};
+use crate::projects::fs_image::prepare_filesystem_image;
+use crate::projects::nvs_image::prepare_nvs_image;
 use crate::projects::registry::ProjectHandler;
+use crate::utils::compiler_cache;
+use crate::utils::idf_components::{
+    DEPENDENCIES_LOCK_FILE, MANAGED_COMPONENTS_DIR, collect_component_dependencies,
+    dependencies_resolved,
+};
 use crate::utils::idf_native::{IdfNativeConfig, IdfNativeHandler};
+use crate::utils::partition_table::{
+    DEFAULT_FLASH_SIZE, PartitionLayout, flash_size_bytes, read_partition_csv,
+};
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -27,15 +57,16 @@ impl ProjectHandler for EspIdfHandler {
         ProjectType::EspIdf
     }
 
-    fn check_artifacts_exist(
-        &self,
-        _project_dir: &Path,
-        board_config: &ProjectBoardConfig,
-    ) -> bool {
+    fn check_artifacts_exist(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> bool {
         // For ESP-IDF, check if flash_args file exists in build directory
         // This file is generated during build and contains all binary information
         let flash_args_path = board_config.build_dir.join("flash_args");
         flash_args_path.exists()
+            && Self::extra_apps(project_dir).iter().all(|app| {
+                Self::app_build_dir(board_config, app)
+                    .join("flash_args")
+                    .exists()
+            })
     }
 
     fn can_handle(&self, project_dir: &Path) -> bool {
@@ -56,10 +87,113 @@ impl ProjectHandler for EspIdfHandler {
                 })
                 .unwrap_or(false);
 
-        cmake_file.exists() && sdkconfig_exists
+        (cmake_file.exists() && (sdkconfig_exists || Self::has_idf_presets(project_dir)))
+            || component_harness::is_component_repository(project_dir)
+    }
+
+    async fn prepare_build(
+        &self,
+        project_dir: &Path,
+        boards: &[ProjectBoardConfig],
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let Some(board_config) = boards.first() else {
+            return Ok(());
+        };
+
+        // Parallel builds share one cache, and for sccache one server
+        if let Some(cache) = compiler_cache::select_cache(project_dir) {
+            match compiler_cache::prepare_cache(project_dir, cache).await {
+                Ok(()) => {
+                    let _ = tx.send(AppEvent::BuildOutput(
+                        board_config.name.clone(),
+                        format!(
+                            "🗃️  Using {} in {}",
+                            cache.name(),
+                            compiler_cache::cache_dir(project_dir, cache).display()
+                        ),
+                    ));
+                }
+                Err(e) => {
+                    let _ = tx.send(AppEvent::BuildOutput(
+                        board_config.name.clone(),
+                        format!("⚠️  Unable to prepare {}: {}", cache.name(), e),
+                    ));
+                }
+            }
+        }
+
+        // Every component harness resolves its dependencies in its own directory
+        if component_harness::is_component_repository(project_dir) {
+            return Ok(());
+        }
+
+        let dependencies = collect_component_dependencies(project_dir)?;
+        let remote_count = dependencies.iter().filter(|d| d.is_remote()).count();
+        if remote_count == 0 {
+            return Ok(());
+        }
+
+        if dependencies_resolved(project_dir, &dependencies) {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!(
+                    "📦 {} component dependencies already resolved in {}",
+                    remote_count, DEPENDENCIES_LOCK_FILE
+                ),
+            ));
+            return Ok(());
+        }
+
+        // Resolve once so parallel board builds reuse managed_components/ and
+        // dependencies.lock instead of each querying the registry
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "📦 Resolving {} component dependencies once for {} board(s)...",
+                remote_count,
+                boards.len()
+            ),
+        ));
+
+        let success = if is_cmake_presets_file(&board_config.config_file) {
+            self.run_idf_command(project_dir, board_config, &["reconfigure"], tx.clone())
+                .await?
+        } else {
+            let target = self.board_target(board_config)?;
+            self.run_idf_command(
+                project_dir,
+                board_config,
+                &["set-target", target.as_str()],
+                tx.clone(),
+            )
+            .await?
+        };
+
+        if success {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!(
+                    "✅ Component dependencies resolved into {}/",
+                    MANAGED_COMPONENTS_DIR
+                ),
+            ));
+            Ok(())
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "❌ Component dependency resolution failed".to_string(),
+            ));
+            Err(anyhow::anyhow!("Component dependency resolution failed"))
+        }
     }
 
     fn discover_boards(&self, project_dir: &Path) -> Result<Vec<ProjectBoardConfig>> {
+        // Component repositories build one generated harness app per target chip
+        if component_harness::is_component_repository(project_dir) {
+            return Ok(component_harness::discover_component_boards(project_dir));
+        }
+
         let mut boards = Vec::new();
 
         // Check for multi-board configurations (sdkconfig.defaults.*)
@@ -106,6 +240,35 @@ impl ProjectHandler for EspIdfHandler {
             }
         }
 
+        // Fragments other boards extend are shared bases, not boards of their own
+        let bases: Vec<PathBuf> = boards
+            .iter()
+            .filter_map(|board| fragment_chain(&board.config_file).ok())
+            .flat_map(|chain| chain.into_iter().rev().skip(1))
+            .collect();
+        boards.retain(|board| !bases.contains(&board.config_file));
+
+        // CMake configure presets are build targets too; sdkconfig boards win on name clashes
+        for preset in self.load_presets(project_dir) {
+            if boards.iter().any(|b| b.name == preset.name) {
+                continue;
+            }
+            let target = preset.idf_target().map(|t| t.to_string()).or_else(|| {
+                preset
+                    .sdkconfig_defaults(project_dir)
+                    .first()
+                    .and_then(|defaults| self.determine_target(defaults).ok())
+            });
+
+            boards.push(ProjectBoardConfig {
+                name: preset.name.clone(),
+                config_file: preset.source_file.clone(),
+                build_dir: preset.binary_dir.clone(),
+                target,
+                project_type: ProjectType::EspIdf,
+            });
+        }
+
         // If no multi-board configurations found, check for single board project
         if boards.is_empty() {
             // First, try sdkconfig.defaults
@@ -139,6 +302,28 @@ impl ProjectHandler for EspIdfHandler {
             }
         }
 
+        // A chip declared in espbrew.yaml wins over the one guessed from sdkconfig
+        let config = ProjectConfig::load(project_dir).ok().flatten();
+        if let Some(config) = &config {
+            for board in &mut boards {
+                if let Some(chip) = config
+                    .boards
+                    .get(&board.name)
+                    .and_then(|b| b.metadata.chip.clone())
+                {
+                    board.target = Some(chip);
+                }
+            }
+        }
+
+        // sdkconfig boards are built once per profile; presets bring their own settings
+        let (presets, boards): (Vec<_>, Vec<_>) = boards
+            .into_iter()
+            .partition(|board| is_cmake_presets_file(&board.config_file));
+        let boards = build_profiles::expand_profiles(config.as_ref(), boards);
+        let mut boards = build_layout::place_build_dirs(project_dir, config.as_ref(), boards);
+        boards.extend(presets);
+
         boards.sort_by(|a, b| a.name.cmp(&b.name));
         Ok(boards)
     }
@@ -154,32 +339,147 @@ impl ProjectHandler for EspIdfHandler {
             "🏗️  Starting ESP-IDF build...".to_string(),
         ));
 
-        // Try native operations first, fallback to traditional if needed
-        if IdfNativeHandler::is_available() {
+        if let Some(harness) = component_harness::board_harness_dir(project_dir, board_config) {
+            return self
+                .build_board_component(project_dir, &harness, board_config, tx)
+                .await;
+        }
+
+        Self::validate_board(project_dir, board_config, &tx)?;
+
+        let cache = compiler_cache::select_cache(project_dir);
+        let cache_before = match cache {
+            Some(cache) => compiler_cache::begin_board_stats(cache, &board_config.build_dir).await,
+            None => None,
+        };
+
+        // Presets are resolved by idf.py itself, so they always use the idf.py path
+        let artifacts = if is_cmake_presets_file(&board_config.config_file) {
+            self.build_board_preset(project_dir, board_config, tx.clone())
+                .await?
+        } else if IdfNativeHandler::is_available() {
             let _ = tx.send(AppEvent::BuildOutput(
                 board_config.name.clone(),
                 "⚡ Using native ESP-IDF operations (idf-rs)".to_string(),
             ));
 
-            return self.build_board_native(project_dir, board_config, tx).await;
+            self.build_board_native(project_dir, board_config, tx.clone())
+                .await?
         } else {
             let _ = tx.send(AppEvent::BuildOutput(
                 board_config.name.clone(),
                 "🔄 Falling back to traditional ESP-IDF operations".to_string(),
             ));
 
-            return self
-                .build_board_traditional(project_dir, board_config, tx)
-                .await;
+            self.build_board_traditional(project_dir, board_config, tx.clone())
+                .await?
+        };
+
+        if let Some(cache) = cache
+            && let Some(stats) =
+                compiler_cache::finish_board_stats(cache, &board_config.build_dir, cache_before)
+                    .await
+        {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("📊 {}", stats.summary()),
+            ));
         }
+
+        // Additional application images share the main build's partition table
+        let extra_apps = Self::extra_apps(project_dir);
+        if extra_apps.is_empty() {
+            return Ok(artifacts);
+        }
+
+        for app in &extra_apps {
+            self.build_extra_app(project_dir, board_config, app, tx.clone())
+                .await?;
+        }
+
+        self.find_build_artifacts(project_dir, board_config)
+    }
+
+    async fn build_board_in_container(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        container: &ContainerSpec,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<Vec<BuildArtifact>> {
+        if component_harness::board_harness_dir(project_dir, board_config).is_some() {
+            return Err(anyhow::anyhow!(
+                "Component-mode boards can't be built in a container yet"
+            ));
+        }
+        Self::validate_board(project_dir, board_config, &tx)?;
+
+        // Paths are the same inside the container, the workspace is mounted at its host path
+        let (command, mut env) = if is_cmake_presets_file(&board_config.config_file) {
+            (
+                format!("idf.py --preset {} build", shell_quote(&board_config.name)),
+                Vec::new(),
+            )
+        } else {
+            let target = self.board_target(board_config)?;
+            let defaults_file = self.defaults_file(project_dir, board_config)?;
+            let idf_args = format!(
+                "-D SDKCONFIG={} -B {}",
+                shell_quote(&board_config.build_dir.join("sdkconfig").to_string_lossy()),
+                shell_quote(&board_config.build_dir.to_string_lossy())
+            );
+            (
+                format!(
+                    "idf.py {} set-target {} && idf.py {} build",
+                    idf_args, target, idf_args
+                ),
+                vec![(
+                    "SDKCONFIG_DEFAULTS".to_string(),
+                    defaults_file.display().to_string(),
+                )],
+            )
+        };
+        env.push(("PYTHONUNBUFFERED".to_string(), "1".to_string()));
+
+        run_in_container(
+            project_dir,
+            board_config,
+            container,
+            &env,
+            &command,
+            tx.clone(),
+        )
+        .await?;
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "✅ ESP-IDF build completed successfully in {}",
+                container.image
+            ),
+        ));
+        self.find_app_artifacts(project_dir, board_config)
     }
 
     async fn flash_board(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        artifacts: &[BuildArtifact],
+        port: Option<&str>,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        self.flash_board_parts(project_dir, board_config, artifacts, port, &[], tx)
+            .await
+    }
+
+    async fn flash_board_parts(
         &self,
         project_dir: &Path,
         board_config: &ProjectBoardConfig,
         _artifacts: &[BuildArtifact],
         port: Option<&str>,
+        only: &[FlashPart],
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
         let _ = tx.send(AppEvent::BuildOutput(
@@ -188,12 +488,22 @@ impl ProjectHandler for EspIdfHandler {
         ));
 
         // Use the unified flash service instead of calling idf.py flash
-        use crate::services::UnifiedFlashService;
-        let flash_service = UnifiedFlashService::new();
+        use crate::services::{FlashOperation, UnifiedFlashService};
+        let flash_service = UnifiedFlashService::for_board(project_dir, board_config)?;
+        if !flash_service.writes_images() && !only.is_empty() {
+            return Err(anyhow::anyhow!(
+                "{} flashes with {}, which writes the whole build and can't flash only the {} images",
+                board_config.name,
+                flash_service.backend_name(),
+                describe(only)
+            ));
+        }
 
-        // Determine port to use
+        // Determine port to use; over JTAG there is none
         let flash_port = if let Some(p) = port {
             p.to_string()
+        } else if !flash_service.uses_serial_port() {
+            "JTAG".to_string()
         } else {
             // If no port specified, try to auto-detect
             crate::utils::espflash_utils::select_esp_port().map_err(|e| {
@@ -210,16 +520,123 @@ impl ProjectHandler for EspIdfHandler {
             format!("🔌 Using flash port: {}", flash_port),
         ));
 
-        // Use the unified flash service to flash ESP-IDF project
-        let result = flash_service
-            .flash_esp_idf_project(
-                project_dir,
-                &flash_port,
-                Some(board_config.build_dir.clone()),
-                Some(tx.clone()),
-                Some(board_config.name.clone()),
-            )
-            .await?;
+        // An NVS image declared for the board is generated for this device,
+        // and the data directory packed into the storage partition, unless
+        // only other parts are flashed
+        let mut data_binaries = Vec::new();
+        if includes(only, FlashPart::Storage) {
+            data_binaries
+                .extend(prepare_nvs_image(project_dir, board_config, &flash_port, &tx).await?);
+            data_binaries.extend(prepare_filesystem_image(project_dir, board_config, &tx).await?);
+        }
+        if !flash_service.writes_images()
+            && (!data_binaries.is_empty() || !Self::extra_apps(project_dir).is_empty())
+        {
+            return Err(anyhow::anyhow!(
+                "{} flashes with {}, which writes only the image of the build and not its \
+                 extra app, NVS or filesystem images; flash it with another flash_backend",
+                board_config.name,
+                flash_service.backend_name()
+            ));
+        }
+
+        // A device with encrypted flash is checked against the build's flash
+        // encryption mode; over JTAG its eFuses can't be read first
+        let encrypted_flash = if flash_service.uses_serial_port() {
+            check_flash_encryption(project_dir, board_config, &flash_port, &tx).await?
+        } else {
+            EncryptedFlash::Plaintext
+        };
+
+        // Multi-app projects flash every app image to its own partition
+        let result = if Self::extra_apps(project_dir).is_empty()
+            && data_binaries.is_empty()
+            && encrypted_flash == EncryptedFlash::Plaintext
+            && only.is_empty()
+        {
+            flash_service
+                .flash_esp_idf_project(
+                    project_dir,
+                    &flash_port,
+                    Some(board_config.build_dir.clone()),
+                    Some(tx.clone()),
+                    Some(board_config.name.clone()),
+                )
+                .await?
+        } else {
+            let (flash_config, mut binaries) = self.build_images(project_dir, board_config)?;
+            // The images replace any the build flashes at the same offset,
+            // e.g. from spiffs_create_partition_image(... FLASH_IN_PROJECT)
+            binaries.retain(|binary| {
+                !data_binaries
+                    .iter()
+                    .any(|data| data.offset == binary.offset)
+            });
+            if !only.is_empty() {
+                let partitions = board_partitions(project_dir, board_config)?;
+                binaries = select_binaries(binaries, &partitions, only);
+                if binaries.is_empty() && data_binaries.is_empty() {
+                    return Err(anyhow::anyhow!(
+                        "The build of {} has no {} images",
+                        board_config.name,
+                        describe(only)
+                    ));
+                }
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!("🎯 Flashing only the {} images", describe(only)),
+                ));
+            }
+            if encrypted_flash == EncryptedFlash::PreEncrypted {
+                binaries = pre_encrypted_binaries(&board_config.build_dir, &binaries);
+                if let Some(missing) = binaries.iter().find(|b| !b.file_path.exists()) {
+                    return Err(anyhow::anyhow!(
+                        "{} is missing, set flash_encryption.key in espbrew.yaml and rebuild {}",
+                        missing.file_path.display(),
+                        board_config.name
+                    ));
+                }
+            }
+
+            // Data partitions stay plaintext, so an encrypting write leaves them
+            // to a second, plain write
+            let encrypt = encrypted_flash == EncryptedFlash::Encrypt;
+            let plaintext = if encrypt {
+                data_binaries
+            } else {
+                binaries.extend(data_binaries);
+                Vec::new()
+            };
+            let mut result = flash_service
+                .flash_board(
+                    FlashOperation {
+                        port: flash_port.clone(),
+                        binaries,
+                        flash_config: Some(flash_config.clone()),
+                        board_name: Some(board_config.name.clone()),
+                        verify: false,
+                        encrypt,
+                    },
+                    Some(tx.clone()),
+                )
+                .await?;
+            if result.success && !plaintext.is_empty() {
+                result = flash_service
+                    .flash_board(
+                        FlashOperation {
+                            port: flash_port.clone(),
+                            binaries: plaintext,
+                            flash_config: Some(flash_config),
+                            board_name: Some(board_config.name.clone()),
+                            verify: false,
+                            encrypt: false,
+                        },
+                        Some(tx.clone()),
+                    )
+                    .await?;
+            }
+            result
+        };
 
         if result.success {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -253,6 +670,33 @@ impl ProjectHandler for EspIdfHandler {
             ),
         ));
 
+        if is_cmake_presets_file(&board_config.config_file)
+            || component_harness::board_harness_dir(project_dir, board_config).is_some()
+        {
+            let mut args = vec!["monitor"];
+            if let Some(port) = port {
+                args.extend(["-p", port]);
+            }
+            let success = self
+                .run_idf_command(
+                    &Self::idf_project_dir(project_dir, board_config),
+                    board_config,
+                    &args,
+                    tx.clone(),
+                )
+                .await?;
+            let message = if success {
+                "✅ ESP-IDF monitoring session completed"
+            } else {
+                "❌ ESP-IDF monitoring failed"
+            };
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                message.to_string(),
+            ));
+            return Ok(());
+        }
+
         // Try native operations first, fallback to traditional if needed
         if IdfNativeHandler::is_available() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -286,6 +730,31 @@ impl ProjectHandler for EspIdfHandler {
             "🧹 Cleaning ESP-IDF build artifacts...".to_string(),
         ));
 
+        if is_cmake_presets_file(&board_config.config_file)
+            || component_harness::board_harness_dir(project_dir, board_config).is_some()
+        {
+            if self
+                .run_idf_command(
+                    &Self::idf_project_dir(project_dir, board_config),
+                    board_config,
+                    &["clean"],
+                    tx.clone(),
+                )
+                .await?
+            {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    "✅ Clean completed successfully".to_string(),
+                ));
+                return Ok(());
+            }
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "❌ Clean failed".to_string(),
+            ));
+            return Err(anyhow::anyhow!("ESP-IDF clean failed"));
+        }
+
         // Try native operations first, fallback to traditional if needed
         if IdfNativeHandler::is_available() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -306,8 +775,98 @@ impl ProjectHandler for EspIdfHandler {
         }
     }
 
+    fn build_plan(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<PlannedCommand>> {
+        let in_container = board_container(project_dir, &board_config.name).is_some();
+        let cache_env = if in_container {
+            Vec::new()
+        } else {
+            Self::compiler_cache_env(project_dir, board_config)
+        };
+        let build_dir = board_config.build_dir.display().to_string();
+        let sdkconfig = board_config
+            .build_dir
+            .join("sdkconfig")
+            .display()
+            .to_string();
+
+        if is_cmake_presets_file(&board_config.config_file) {
+            return Ok(vec![
+                PlannedCommand::new("build", "idf.py", project_dir)
+                    .args(["--preset", board_config.name.as_str(), "build"])
+                    .env("PYTHONUNBUFFERED", "1")
+                    .envs(cache_env),
+            ]);
+        }
+
+        let defaults = Self::defaults_path(project_dir, board_config)
+            .display()
+            .to_string();
+        if let Some(harness) = component_harness::board_harness_dir(project_dir, board_config) {
+            return Ok(vec![
+                PlannedCommand::new("build", "idf.py", &harness)
+                    .args(["-D", &format!("SDKCONFIG={}", sdkconfig), "-B", &build_dir])
+                    .arg("build")
+                    .env("SDKCONFIG_DEFAULTS", defaults)
+                    .env("PYTHONUNBUFFERED", "1")
+                    .envs(cache_env),
+            ]);
+        }
+
+        let target = self.board_target(board_config)?;
+        // The native path hands the sdkconfig over in the environment
+        if !in_container && IdfNativeHandler::is_available() {
+            return Ok(vec![
+                PlannedCommand::new("set-target", "idf-rs", project_dir)
+                    .args(["-B", build_dir.as_str(), "set-target", target.as_str()])
+                    .env("SDKCONFIG_DEFAULTS", defaults.clone())
+                    .env("PYTHONUNBUFFERED", "1")
+                    .envs(cache_env.iter().cloned()),
+                PlannedCommand::new("build", "idf-rs", project_dir)
+                    .args(["-B", build_dir.as_str(), "build"])
+                    .env("SDKCONFIG_DEFAULTS", defaults)
+                    .env("SDKCONFIG", sdkconfig)
+                    .env("PYTHONUNBUFFERED", "1")
+                    .envs(cache_env),
+            ]);
+        }
+
+        let idf_args = [
+            "-D".to_string(),
+            format!("SDKCONFIG={}", sdkconfig),
+            "-B".to_string(),
+            build_dir,
+        ];
+        Ok(vec![
+            PlannedCommand::new("set-target", "idf.py", project_dir)
+                .args(idf_args.iter().cloned())
+                .args(["set-target", target.as_str()])
+                .env("SDKCONFIG_DEFAULTS", defaults.clone())
+                .envs(cache_env.iter().cloned()),
+            PlannedCommand::new("build", "idf.py", project_dir)
+                .args(idf_args)
+                .arg("build")
+                .env("SDKCONFIG_DEFAULTS", defaults)
+                .env("PYTHONUNBUFFERED", "1")
+                .envs(cache_env),
+        ])
+    }
+
     fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String {
-        let config_path = board_config.config_file.display();
+        let project_dir = &Self::idf_project_dir(project_dir, board_config);
+        if is_cmake_presets_file(&board_config.config_file) {
+            return format!(
+                "cd {} && idf.py --preset '{}' build",
+                project_dir.display(),
+                board_config.name
+            );
+        }
+
+        let defaults_path = Self::defaults_path(project_dir, board_config);
+        let config_path = defaults_path.display();
         let build_dir = board_config.build_dir.display();
         let sdkconfig_file = board_config.build_dir.join("sdkconfig");
         let sdkconfig_path = sdkconfig_file.display();
@@ -334,12 +893,26 @@ impl ProjectHandler for EspIdfHandler {
         board_config: &ProjectBoardConfig,
         port: Option<&str>,
     ) -> String {
-        let config_path = board_config.config_file.display();
+        let project_dir = &Self::idf_project_dir(project_dir, board_config);
+        let defaults_path = Self::defaults_path(project_dir, board_config);
+        let config_path = defaults_path.display();
         let build_dir = board_config.build_dir.display();
         let sdkconfig_file = board_config.build_dir.join("sdkconfig");
         let sdkconfig_path = sdkconfig_file.display();
 
-        let port_arg = port.map(|p| format!(" -p {}", p)).unwrap_or_default();
+        let mut port_arg = port.map(|p| format!(" -p {}", p)).unwrap_or_default();
+        if let Some(speed) = BoardMetadata::load(project_dir, &board_config.name).upload_speed {
+            port_arg.push_str(&format!(" -b {}", speed));
+        }
+
+        if is_cmake_presets_file(&board_config.config_file) {
+            return format!(
+                "cd {} && idf.py --preset '{}' flash{}",
+                project_dir.display(),
+                board_config.name,
+                port_arg
+            );
+        }
 
         if std::env::current_dir().unwrap_or_else(|_| PathBuf::from(".")) != *project_dir {
             format!(
@@ -420,14 +993,14 @@ impl EspIdfHandler {
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<Vec<BuildArtifact>> {
         // Determine target
-        let target = self.determine_target(&board_config.config_file)?;
+        let target = self.board_target(board_config)?;
 
         // Create native configuration
         let config = IdfNativeConfig::new(
             project_dir,
             &board_config.build_dir,
             &target,
-            Some(&board_config.config_file),
+            Some(&self.defaults_file(project_dir, board_config)?),
         );
 
         // Add ESP-IDF environment variables
@@ -437,6 +1010,9 @@ impl EspIdfHandler {
         for (key, value) in esp_idf_env {
             config = config.with_env_var(key, value);
         }
+        for (key, value) in Self::compiler_cache_env(project_dir, board_config) {
+            config = config.with_env_var(key, value);
+        }
         config = config.with_verbose(true);
 
         let native_handler = IdfNativeHandler::new();
@@ -452,7 +1028,7 @@ impl EspIdfHandler {
             .await?;
 
         // Find build artifacts
-        self.find_build_artifacts(project_dir, board_config)
+        self.find_app_artifacts(project_dir, board_config)
     }
 
     /// Build using traditional ESP-IDF operations (fallback)
@@ -469,8 +1045,9 @@ impl EspIdfHandler {
         ));
 
         // First determine target
-        let target = self.determine_target(&board_config.config_file)?;
-        let config_path = board_config.config_file.to_string_lossy();
+        let target = self.board_target(board_config)?;
+        let defaults_file = self.defaults_file(project_dir, board_config)?;
+        let config_path = defaults_file.to_string_lossy();
 
         // Use board-specific sdkconfig file to avoid conflicts
         let sdkconfig_path = board_config.build_dir.join("sdkconfig");
@@ -482,12 +1059,14 @@ impl EspIdfHandler {
         // Set up environment for ESP-IDF
         let esp_idf_env =
             crate::utils::esp_idf_utils::get_esp_idf_environment().unwrap_or_default();
+        let cache_env = Self::compiler_cache_env(project_dir, board_config);
 
         // Set target command
         let mut cmd = Command::new(&idf_command);
         cmd.current_dir(project_dir)
             .env("SDKCONFIG_DEFAULTS", &*config_path)
             .envs(&esp_idf_env)
+            .envs(cache_env.iter().cloned())
             .args([
                 "-D",
                 &format!("SDKCONFIG={}", sdkconfig_path.display()),
@@ -499,8 +1078,7 @@ impl EspIdfHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let output = cmd
-            .output()
+        let output = process_group::output(&mut cmd)
             .await
             .context("Failed to run idf.py set-target")?;
 
@@ -519,6 +1097,7 @@ impl EspIdfHandler {
             .env("SDKCONFIG_DEFAULTS", &*config_path)
             .env("PYTHONUNBUFFERED", "1") // Force Python to not buffer output
             .envs(&esp_idf_env)
+            .envs(cache_env)
             .args([
                 "-D",
                 &format!("SDKCONFIG={}", sdkconfig_path.display()),
@@ -529,7 +1108,7 @@ impl EspIdfHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start idf.py build")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start idf.py build")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -574,7 +1153,7 @@ impl EspIdfHandler {
             ));
 
             // Find build artifacts
-            self.find_build_artifacts(project_dir, board_config)
+            self.find_app_artifacts(project_dir, board_config)
         } else {
             let _ = tx.send(AppEvent::BuildOutput(
                 board_config.name.clone(),
@@ -594,14 +1173,14 @@ impl EspIdfHandler {
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
         // Determine target
-        let target = self.determine_target(&board_config.config_file)?;
+        let target = self.board_target(board_config)?;
 
         // Create native configuration
         let config = IdfNativeConfig::new(
             project_dir,
             &board_config.build_dir,
             &target,
-            Some(&board_config.config_file),
+            Some(&self.defaults_file(project_dir, board_config)?),
         );
 
         // Add ESP-IDF environment variables
@@ -630,7 +1209,8 @@ impl EspIdfHandler {
         _baud_rate: u32,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
-        let config_path = board_config.config_file.to_string_lossy();
+        let defaults_file = self.defaults_file(project_dir, board_config)?;
+        let config_path = defaults_file.to_string_lossy();
         let sdkconfig_path = board_config.build_dir.join("sdkconfig");
 
         // Get cross-platform ESP-IDF command
@@ -657,8 +1237,10 @@ impl EspIdfHandler {
             cmd.args(["-p", port]);
         }
 
+        // Watch mode drops the monitor when the sources change, freeing the port
         cmd.stdout(std::process::Stdio::piped())
-            .stderr(std::process::Stdio::piped());
+            .stderr(std::process::Stdio::piped())
+            .kill_on_drop(true);
 
         let mut child = cmd.spawn().context("Failed to start idf.py monitor")?;
         let stdout = child.stdout.take().unwrap();
@@ -721,14 +1303,14 @@ impl EspIdfHandler {
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
         // Determine target
-        let target = self.determine_target(&board_config.config_file)?;
+        let target = self.board_target(board_config)?;
 
         // Create native configuration
         let config = IdfNativeConfig::new(
             project_dir,
             &board_config.build_dir,
             &target,
-            Some(&board_config.config_file),
+            Some(&self.defaults_file(project_dir, board_config)?),
         );
 
         // Add ESP-IDF environment variables
@@ -755,7 +1337,8 @@ impl EspIdfHandler {
         board_config: &ProjectBoardConfig,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
-        let config_path = board_config.config_file.to_string_lossy();
+        let defaults_file = self.defaults_file(project_dir, board_config)?;
+        let config_path = defaults_file.to_string_lossy();
         let sdkconfig_path = board_config.build_dir.join("sdkconfig");
 
         // Get cross-platform ESP-IDF command
@@ -778,7 +1361,9 @@ impl EspIdfHandler {
                 "clean",
             ]);
 
-        let output = cmd.output().await.context("Failed to run idf.py clean")?;
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run idf.py clean")?;
 
         if output.status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -796,8 +1381,424 @@ impl EspIdfHandler {
         }
     }
 
+    /// Build using the board's CMake configure preset (`idf.py --preset <name> build`)
+    async fn build_board_preset(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<Vec<BuildArtifact>> {
+        let build_command = self.get_build_command(project_dir, board_config);
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🔨 Executing: {}", build_command),
+        ));
+
+        if self
+            .run_idf_command(project_dir, board_config, &["build"], tx.clone())
+            .await?
+        {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "✅ ESP-IDF build completed successfully".to_string(),
+            ));
+            self.find_app_artifacts(project_dir, board_config)
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "❌ ESP-IDF build failed".to_string(),
+            ));
+            Err(anyhow::anyhow!("ESP-IDF build failed"))
+        }
+    }
+
+    /// Build a component-mode board: refresh its harness app and build it with idf.py
+    async fn build_board_component(
+        &self,
+        project_dir: &Path,
+        harness: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<Vec<BuildArtifact>> {
+        let target = self.board_target(board_config)?;
+        component_harness::write_harness(project_dir, &target)?;
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "📦 Building component '{}' for {} in {}",
+                component_harness::component_name(project_dir),
+                target,
+                harness.display()
+            ),
+        ));
+        let build_command = self.get_build_command(project_dir, board_config);
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🔨 Executing: {}", build_command),
+        ));
+
+        if self
+            .run_idf_command(harness, board_config, &["build"], tx.clone())
+            .await?
+        {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("✅ Component builds for {}", target),
+            ));
+            self.find_app_artifacts(harness, board_config)
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("❌ Component build failed for {}", target),
+            ));
+            Err(anyhow::anyhow!("Component build failed for {}", target))
+        }
+    }
+
+    /// Directory idf.py runs in: the harness app for component-mode boards, otherwise the project
+    fn idf_project_dir(project_dir: &Path, board_config: &ProjectBoardConfig) -> PathBuf {
+        component_harness::board_harness_dir(project_dir, board_config)
+            .unwrap_or_else(|| project_dir.to_path_buf())
+    }
+
+    /// Run idf.py for a board and stream its output, returning whether it succeeded.
+    ///
+    /// Preset boards run `idf.py --preset <board> <args>`, all others get the
+    /// board's sdkconfig defaults and build directory.
+    async fn run_idf_command(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        args: &[&str],
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<bool> {
+        let idf_command = crate::utils::esp_idf_utils::get_esp_idf_command()
+            .map_err(|e| anyhow::anyhow!("ESP-IDF not available: {}", e))?;
+        let esp_idf_env =
+            crate::utils::esp_idf_utils::get_esp_idf_environment().unwrap_or_default();
+
+        let mut cmd = Command::new(&idf_command);
+        cmd.current_dir(project_dir)
+            .env("PYTHONUNBUFFERED", "1")
+            .envs(&esp_idf_env)
+            .envs(Self::compiler_cache_env(project_dir, board_config));
+        if is_cmake_presets_file(&board_config.config_file) {
+            cmd.args(["--preset", &board_config.name]);
+        } else {
+            cmd.env(
+                "SDKCONFIG_DEFAULTS",
+                self.defaults_file(project_dir, board_config)?,
+            )
+            .args([
+                "-D",
+                &format!(
+                    "SDKCONFIG={}",
+                    board_config.build_dir.join("sdkconfig").display()
+                ),
+                "-B",
+                &board_config.build_dir.to_string_lossy(),
+            ]);
+        }
+        // Cancelling the future, e.g. a monitor stopped by watch mode, stops idf.py
+        cmd.args(args)
+            .stdout(std::process::Stdio::piped())
+            .stderr(std::process::Stdio::piped())
+            .kill_on_drop(true);
+
+        let mut child = process_group::spawn(&mut cmd)
+            .with_context(|| format!("Failed to start idf.py {}", args.join(" ")))?;
+        let stdout = child.stdout.take().unwrap();
+        let stderr = child.stderr.take().unwrap();
+
+        let tx_stdout = tx.clone();
+        let tx_stderr = tx.clone();
+        let board_name_stdout = board_config.name.clone();
+        let board_name_stderr = board_config.name.clone();
+
+        tokio::spawn(async move {
+            let mut lines = BufReader::new(stdout).lines();
+            while let Ok(Some(line)) = lines.next_line().await {
+                let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+            }
+        });
+
+        tokio::spawn(async move {
+            let mut lines = BufReader::new(stderr).lines();
+            while let Ok(Some(line)) = lines.next_line().await {
+                let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+            }
+        });
+
+        let status = child.wait().await.context("Failed to wait for idf.py")?;
+        Ok(status.success())
+    }
+
+    /// Check the board's sdkconfig options and partition table before idf.py runs
+    fn validate_board(
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: &mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        // Options the target doesn't offer would be dropped by ESP-IDF without a word
+        if !is_cmake_presets_file(&board_config.config_file) {
+            let issues = Self::lint_board(project_dir, board_config)?;
+            for issue in &issues {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    issue.to_line(),
+                ));
+            }
+            if sdkconfig_lint::has_errors(&issues) {
+                return Err(anyhow::anyhow!(
+                    "{} has sdkconfig options its target doesn't support, see espbrew config lint",
+                    board_config.name
+                ));
+            }
+        }
+
+        // A custom partition table has to fit the board's flash before idf.py sees it
+        if !is_cmake_presets_file(&board_config.config_file)
+            && let Some(layout) = Self::partition_layout(project_dir, board_config)?
+        {
+            let problems = layout.problems();
+            if !problems.is_empty() {
+                for problem in &problems {
+                    let _ = tx.send(AppEvent::BuildOutput(
+                        board_config.name.clone(),
+                        format!("❌ {}", problem),
+                    ));
+                }
+                return Err(anyhow::anyhow!(
+                    "Partition table {} is invalid for {}: {}",
+                    layout.csv.display(),
+                    board_config.name,
+                    problems.join("; ")
+                ));
+            }
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("🗂️  Using partition table {}", layout.csv.display()),
+            ));
+        }
+
+        Ok(())
+    }
+
+    /// Environment enabling the compiler cache for a board, empty without one
+    fn compiler_cache_env(
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Vec<(String, String)> {
+        compiler_cache::select_cache(project_dir)
+            .map(|cache| compiler_cache::cache_env(project_dir, cache, &board_config.build_dir))
+            .unwrap_or_default()
+    }
+
+    /// idf.py for a board attached to the terminal, for interactive targets like `menuconfig`
+    pub fn interactive_idf_command(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        args: &[&str],
+    ) -> Result<std::process::Command> {
+        let idf_command = crate::utils::esp_idf_utils::get_esp_idf_command()
+            .map_err(|e| anyhow::anyhow!("ESP-IDF not available: {}", e))?;
+        let esp_idf_env =
+            crate::utils::esp_idf_utils::get_esp_idf_environment().unwrap_or_default();
+
+        let mut cmd = std::process::Command::new(&idf_command);
+        cmd.current_dir(Self::idf_project_dir(project_dir, board_config))
+            .envs(&esp_idf_env)
+            .env(
+                "SDKCONFIG_DEFAULTS",
+                self.defaults_file(project_dir, board_config)?,
+            )
+            .args([
+                "-D",
+                &format!(
+                    "SDKCONFIG={}",
+                    board_config.build_dir.join("sdkconfig").display()
+                ),
+                "-B",
+                &board_config.build_dir.to_string_lossy(),
+            ])
+            .args(args);
+        Ok(cmd)
+    }
+
+    /// Whether the project ships CMake presets and its CMakeLists.txt is an IDF project
+    fn has_idf_presets(project_dir: &Path) -> bool {
+        project_dir.join(CMAKE_PRESETS_FILE).exists()
+            && fs::read_to_string(project_dir.join("CMakeLists.txt"))
+                .map(|content| content.contains("tools/cmake/project.cmake"))
+                .unwrap_or(false)
+    }
+
+    /// Configure presets of the project; parse errors are logged and ignored
+    fn load_presets(&self, project_dir: &Path) -> Vec<CmakePreset> {
+        match load_cmake_presets(project_dir) {
+            Ok(presets) => presets,
+            Err(e) => {
+                log::warn!("⚠️  Ignoring CMake presets: {:#}", e);
+                Vec::new()
+            }
+        }
+    }
+
+    /// Look up the configure preset backing a preset board
+    fn find_preset(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<CmakePreset> {
+        load_cmake_presets(project_dir)?
+            .into_iter()
+            .find(|preset| preset.name == board_config.name)
+            .ok_or_else(|| anyhow::anyhow!("CMake preset '{}' not found", board_config.name))
+    }
+
+    /// Defaults file passed to ESP-IDF, merging inherited fragments, the
+    /// board metadata and the build profile into the build directory
+    fn defaults_file(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<PathBuf> {
+        let overrides = Self::board_overrides(project_dir, board_config)?;
+        effective_defaults_file(
+            &board_config.config_file,
+            &board_config.build_dir,
+            &overrides,
+        )
+    }
+
+    /// sdkconfig options from the board's `espbrew.yaml` metadata and profile
+    pub fn board_overrides(
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<SdkconfigOption>> {
+        let mut overrides = BoardMetadata::load(project_dir, &board_config.name)
+            .sdkconfig_options(board_config.target.as_deref());
+        if let Some(config) = ProjectConfig::load(project_dir).ok().flatten()
+            && let Some((_, _, profile)) = build_profiles::split_cell(&config, &board_config.name)
+        {
+            overrides.extend(profile.sdkconfig_options());
+        }
+        if overrides.is_empty() {
+            return Ok(overrides);
+        }
+
+        let base = effective_options(&board_config.config_file)?;
+        let deselected = deselected_choices(&overrides, &base);
+        overrides.extend(deselected);
+        Ok(overrides)
+    }
+
+    /// Custom partition table selected by a board's effective options, with the
+    /// flash size it has to fit; `None` when the board uses a built-in table
+    pub fn partition_layout(
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Option<PartitionLayout>> {
+        let mut options = effective_options(&board_config.config_file)?;
+        apply_overrides(
+            &mut options,
+            &Self::board_overrides(project_dir, board_config)?,
+        );
+        let enabled = |key: &str| {
+            options
+                .iter()
+                .any(|o| o.key == key && o.value.as_deref() == Some("y"))
+        };
+        if !enabled("CONFIG_PARTITION_TABLE_CUSTOM") {
+            return Ok(None);
+        }
+
+        // ESP-IDF's defaults apply to options the board doesn't set
+        let file_name = options
+            .iter()
+            .find(|o| o.key == "CONFIG_PARTITION_TABLE_CUSTOM_FILENAME")
+            .and_then(|o| o.value.as_deref())
+            .map(|value| value.trim_matches('"').to_string())
+            .unwrap_or_else(|| "partitions.csv".to_string());
+        let flash_size = options
+            .iter()
+            .filter(|o| o.value.as_deref() == Some("y"))
+            .find_map(|o| o.key.strip_prefix("CONFIG_ESPTOOLPY_FLASHSIZE_"))
+            .and_then(flash_size_bytes)
+            .unwrap_or(DEFAULT_FLASH_SIZE);
+
+        let csv = project_dir.join(file_name);
+        let entries = read_partition_csv(&csv)?;
+        Ok(Some(PartitionLayout {
+            csv,
+            entries,
+            flash_size,
+        }))
+    }
+
+    /// Options of a board's effective config that its target chip doesn't support
+    pub fn lint_board(
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<LintIssue>> {
+        let mut options = effective_options(&board_config.config_file)?;
+        apply_overrides(
+            &mut options,
+            &Self::board_overrides(project_dir, board_config)?,
+        );
+
+        let Some(target) =
+            sdkconfig_lint::configured_target(&options).or_else(|| board_config.target.clone())
+        else {
+            return Ok(Vec::new());
+        };
+        Ok(sdkconfig_lint::lint_options(&target, &options))
+    }
+
+    /// Path of the defaults file for display, without writing the merged fragments
+    fn defaults_path(project_dir: &Path, board_config: &ProjectBoardConfig) -> PathBuf {
+        let has_overrides = Self::board_overrides(project_dir, board_config)
+            .map(|overrides| !overrides.is_empty())
+            .unwrap_or(false);
+        if has_bases(&board_config.config_file) || has_overrides {
+            board_config.build_dir.join(EFFECTIVE_DEFAULTS_FILE)
+        } else {
+            board_config.config_file.clone()
+        }
+    }
+
+    /// Target of a board, preferring the one found during discovery
+    fn board_target(&self, board_config: &ProjectBoardConfig) -> Result<String> {
+        match &board_config.target {
+            Some(target) => Ok(target.clone()),
+            None => self.determine_target(&board_config.config_file),
+        }
+    }
+
     fn determine_target(&self, config_file: &Path) -> Result<String> {
-        let content = fs::read_to_string(config_file)?;
+        // Inherited fragments count, with the board's own options winning
+        let content = if has_bases(config_file) {
+            effective_options(config_file)?
+                .iter()
+                .map(|option| option.to_line())
+                .collect::<Vec<_>>()
+                .join("\n")
+        } else {
+            fs::read_to_string(config_file)?
+        };
+
+        // An explicit CONFIG_IDF_TARGET always wins
+        if let Some(target) = content.lines().find_map(|line| {
+            line.trim()
+                .strip_prefix("CONFIG_IDF_TARGET=")
+                .map(|value| value.trim_matches('"').to_string())
+        }) {
+            if !target.is_empty() {
+                return Ok(target);
+            }
+        }
 
         if content.contains("esp32p4") || content.contains("CONFIG_IDF_TARGET=\"esp32p4\"") {
             Ok("esp32p4".to_string())
@@ -810,7 +1811,178 @@ impl EspIdfHandler {
         }
     }
 
+    /// Find all artifacts of a board build, including additional app images
     pub fn find_build_artifacts(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<BuildArtifact>> {
+        let mut artifacts = self.find_app_artifacts(project_dir, board_config)?;
+
+        let extra_apps = Self::extra_apps(project_dir);
+        if extra_apps.is_empty() {
+            return Ok(artifacts);
+        }
+
+        let partitions =
+            crate::utils::partition_table::read_build_partition_table(&board_config.build_dir)?;
+        for app in &extra_apps {
+            let app_build_dir = Self::app_build_dir(board_config, app);
+            if !app_build_dir.join("flash_args").exists() {
+                continue;
+            }
+            artifacts.push(self.extra_app_artifact(app, &app_build_dir, &partitions)?);
+        }
+
+        Ok(artifacts)
+    }
+
+    /// Flash parameters and images of the board's last build: those of its
+    /// `flash_args`, and for multi-app projects every app at its partition
+    pub fn build_images(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<(FlashConfig, Vec<FlashBinaryInfo>)> {
+        let flash_args_path = board_config.build_dir.join("flash_args");
+        let (flash_config, mut binaries) =
+            self.parse_flash_args(&flash_args_path, &board_config.build_dir)?;
+        if !Self::extra_apps(project_dir).is_empty() {
+            binaries = self
+                .find_build_artifacts(project_dir, board_config)?
+                .into_iter()
+                .map(|artifact| FlashBinaryInfo {
+                    file_name: artifact
+                        .file_path
+                        .file_name()
+                        .map(|n| n.to_string_lossy().to_string())
+                        .unwrap_or_default(),
+                    name: artifact.name,
+                    offset: artifact.offset.unwrap_or(0x10000),
+                    file_path: artifact.file_path,
+                })
+                .collect();
+        }
+        Ok((flash_config, binaries))
+    }
+
+    /// Additional apps configured in `espbrew.yaml`
+    fn extra_apps(project_dir: &Path) -> Vec<EspIdfApp> {
+        ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .and_then(|config| config.esp_idf)
+            .map(|section| section.apps)
+            .unwrap_or_default()
+    }
+
+    /// Build directory of an additional app, nested in the board's build directory
+    fn app_build_dir(board_config: &ProjectBoardConfig, app: &EspIdfApp) -> PathBuf {
+        board_config.build_dir.join("apps").join(&app.name)
+    }
+
+    /// Build an additional app with the board's sdkconfig defaults
+    async fn build_extra_app(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        app: &EspIdfApp,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let app_dir = project_dir.join(&app.path);
+        if !app_dir.join("CMakeLists.txt").exists() {
+            return Err(anyhow::anyhow!(
+                "App '{}' has no CMakeLists.txt in {}",
+                app.name,
+                app_dir.display()
+            ));
+        }
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🏗️  Building app '{}' from {}", app.name, app_dir.display()),
+        ));
+
+        let mut app_board = ProjectBoardConfig {
+            build_dir: Self::app_build_dir(board_config, app),
+            ..board_config.clone()
+        };
+
+        // Apps are plain IDF projects; preset boards hand them the preset's sdkconfig defaults
+        if is_cmake_presets_file(&board_config.config_file) {
+            let preset = self.find_preset(project_dir, board_config)?;
+            app_board.config_file = preset
+                .sdkconfig_defaults(project_dir)
+                .into_iter()
+                .next()
+                .unwrap_or_else(|| project_dir.join("sdkconfig.defaults"));
+        }
+
+        if IdfNativeHandler::is_available() {
+            self.build_board_native(&app_dir, &app_board, tx).await?;
+        } else {
+            self.build_board_traditional(&app_dir, &app_board, tx)
+                .await?;
+        }
+
+        Ok(())
+    }
+
+    /// Artifact of an additional app, placed at its partition's offset
+    fn extra_app_artifact(
+        &self,
+        app: &EspIdfApp,
+        app_build_dir: &Path,
+        partitions: &[crate::utils::partition_table::PartitionEntry],
+    ) -> Result<BuildArtifact> {
+        let offset = match (&app.partition, &app.offset) {
+            (Some(label), _) => {
+                let partition = partitions
+                    .iter()
+                    .find(|p| &p.label == label)
+                    .ok_or_else(|| {
+                        anyhow::anyhow!(
+                            "Partition '{}' for app '{}' not found in partition table",
+                            label,
+                            app.name
+                        )
+                    })?;
+                if !partition.is_app() {
+                    return Err(anyhow::anyhow!(
+                        "Partition '{}' for app '{}' is not an app partition",
+                        label,
+                        app.name
+                    ));
+                }
+                partition.offset
+            }
+            (None, Some(offset)) => u32::from_str_radix(offset.trim_start_matches("0x"), 16)
+                .with_context(|| format!("Invalid offset '{}' for app '{}'", offset, app.name))?,
+            (None, None) => {
+                return Err(anyhow::anyhow!(
+                    "App '{}' needs either a partition or an offset",
+                    app.name
+                ));
+            }
+        };
+
+        let (_, binaries) =
+            self.parse_flash_args(&app_build_dir.join("flash_args"), app_build_dir)?;
+        let binary = binaries
+            .into_iter()
+            .find(|b| b.name == "app")
+            .ok_or_else(|| anyhow::anyhow!("No application image found for app '{}'", app.name))?;
+
+        Ok(BuildArtifact {
+            name: app.name.clone(),
+            file_path: binary.file_path,
+            artifact_type: ArtifactType::Application,
+            offset: Some(offset),
+        })
+    }
+
+    /// Find the artifacts of the main application build from its flash_args
+    fn find_app_artifacts(
         &self,
         _project_dir: &Path,
         board_config: &ProjectBoardConfig,
@@ -1,5 +1,6 @@
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -242,7 +243,7 @@ impl ProjectHandler for JaculusHandler {
             format!("🔨 Executing: {}", upload_command_str),
         ));
 
-        let mut child = cmd.spawn().context("Failed to start jaculus upload")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start jaculus upload")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -1,5 +1,7 @@
+use crate::config::ProjectConfig;
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -357,43 +359,224 @@ impl MicroPythonHandler {
         &self,
         project_dir: &Path,
         board_config: &ProjectBoardConfig,
-        artifacts: &[BuildArtifact],
+        _artifacts: &[BuildArtifact],
         port: &str,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
-        for artifact in artifacts {
-            if artifact.artifact_type == ArtifactType::Python {
+        // Copy the whole tree so package directories keep their layout on the device
+        self.sync_tree_with_mpremote(project_dir, board_config, port, tx)
+            .await
+    }
+
+    /// Flash the MicroPython firmware image (if any) and sync the Python tree to the device
+    pub async fn deploy_board(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        port: Option<&str>,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let port = match port {
+            Some(p) => p.to_string(),
+            None => crate::utils::espflash_utils::select_esp_port()?,
+        };
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🚀 Deploying MicroPython project to {}", port),
+        ));
+
+        match self.find_firmware_image(project_dir) {
+            Some(firmware) => {
+                let offset = self.firmware_offset(board_config.target.as_deref());
                 let _ = tx.send(AppEvent::BuildOutput(
                     board_config.name.clone(),
-                    format!("📤 Uploading {}", artifact.file_path.display()),
+                    format!(
+                        "🔥 Flashing firmware {} at 0x{:x}",
+                        firmware.display(),
+                        offset
+                    ),
                 ));
 
-                let mut cmd = Command::new("mpremote");
-                cmd.current_dir(project_dir)
-                    .args(["connect", port])
-                    .args(["cp", &artifact.file_path.to_string_lossy(), ":"])
-                    .stdout(std::process::Stdio::piped())
-                    .stderr(std::process::Stdio::piped());
+                let data = fs::read(&firmware).with_context(|| {
+                    format!("Failed to read firmware image {}", firmware.display())
+                })?;
+                crate::utils::espflash_utils::flash_binary_data(&port, &data, offset).await?;
 
-                let output = cmd.output().await.context("Failed to run mpremote")?;
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    "✅ Firmware flashed, waiting for the board to boot...".to_string(),
+                ));
+                tokio::time::sleep(std::time::Duration::from_secs(2)).await;
+            }
+            None => {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    "⚠️ No firmware image found (set micropython.firmware in espbrew.yaml), syncing files only".to_string(),
+                ));
+            }
+        }
 
-                if output.status.success() {
-                    let _ = tx.send(AppEvent::BuildOutput(
-                        board_config.name.clone(),
-                        format!("✅ Uploaded {}", artifact.name),
-                    ));
+        self.sync_tree_with_mpremote(project_dir, board_config, &port, tx.clone())
+            .await?;
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "✅ Deploy completed".to_string(),
+        ));
+        Ok(())
+    }
+
+    /// Copy the project tree to the device filesystem with `mpremote cp -r` and soft-reset it
+    async fn sync_tree_with_mpremote(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        port: &str,
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let source_dir = self.source_dir(project_dir);
+        let entries = self.deploy_entries(&source_dir);
+        if entries.is_empty() {
+            return Err(anyhow::anyhow!(
+                "No Python files to deploy in {}",
+                source_dir.display()
+            ));
+        }
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "📤 Syncing {} item(s) from {} with mpremote",
+                entries.len(),
+                source_dir.display()
+            ),
+        ));
+
+        let mut cmd = Command::new("mpremote");
+        cmd.current_dir(&source_dir)
+            .args(["connect", port, "cp", "-r"])
+            .args(&entries)
+            .args([":", "+", "reset"])
+            .stdout(std::process::Stdio::piped())
+            .stderr(std::process::Stdio::piped());
+
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run mpremote")?;
+
+        for line in String::from_utf8_lossy(&output.stdout).lines() {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                line.to_string(),
+            ));
+        }
+
+        if output.status.success() {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                "✅ Files synced and board reset".to_string(),
+            ));
+            Ok(())
+        } else {
+            let stderr = String::from_utf8_lossy(&output.stderr);
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("❌ mpremote sync failed: {}", stderr.trim()),
+            ));
+            Err(anyhow::anyhow!("mpremote sync failed"))
+        }
+    }
+
+    /// Directory synced to the device, from espbrew.yaml or the project root
+    fn source_dir(&self, project_dir: &Path) -> PathBuf {
+        ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .and_then(|c| c.micropython)
+            .and_then(|m| m.source_dir)
+            .map(|dir| project_dir.join(dir))
+            .unwrap_or_else(|| project_dir.to_path_buf())
+    }
+
+    /// Top-level files and directories to copy to the device, relative to the source dir
+    pub fn deploy_entries(&self, source_dir: &Path) -> Vec<String> {
+        const SKIP_DIRS: [&str; 7] = [
+            "__pycache__",
+            "firmware",
+            "build",
+            "logs",
+            "support",
+            "tests",
+            "venv",
+        ];
+        const FILE_EXTENSIONS: [&str; 5] = ["py", "mpy", "json", "txt", "html"];
+
+        let mut entries = Vec::new();
+        if let Ok(dir) = source_dir.read_dir() {
+            for entry in dir.flatten() {
+                let path = entry.path();
+                let name = entry.file_name().to_string_lossy().to_string();
+                if name.starts_with('.') || name == "requirements.txt" {
+                    continue;
+                }
+
+                let include = if path.is_dir() {
+                    !SKIP_DIRS.contains(&name.as_str())
                 } else {
-                    let stderr = String::from_utf8_lossy(&output.stderr);
-                    let _ = tx.send(AppEvent::BuildOutput(
-                        board_config.name.clone(),
-                        format!("❌ Failed to upload {}: {}", artifact.name, stderr.trim()),
-                    ));
-                    return Err(anyhow::anyhow!("Upload failed"));
+                    path.extension()
+                        .and_then(|ext| ext.to_str())
+                        .is_some_and(|ext| FILE_EXTENSIONS.contains(&ext))
+                };
+
+                if include {
+                    entries.push(name);
                 }
             }
         }
 
-        Ok(())
+        entries.sort();
+        entries
+    }
+
+    /// Locate the firmware image: espbrew.yaml, then firmware/*.bin, then *.bin in the project root
+    pub fn find_firmware_image(&self, project_dir: &Path) -> Option<PathBuf> {
+        if let Some(firmware) = ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .and_then(|c| c.micropython)
+            .and_then(|m| m.firmware)
+        {
+            return Some(project_dir.join(firmware));
+        }
+
+        for dir in [project_dir.join("firmware"), project_dir.to_path_buf()] {
+            let mut images: Vec<PathBuf> = dir
+                .read_dir()
+                .into_iter()
+                .flatten()
+                .flatten()
+                .map(|entry| entry.path())
+                .filter(|path| path.is_file() && path.extension().is_some_and(|ext| ext == "bin"))
+                .collect();
+
+            // Release images are date/version stamped, so the last one sorts newest
+            images.sort();
+            if let Some(image) = images.pop() {
+                return Some(image);
+            }
+        }
+
+        None
+    }
+
+    /// Flash offset of the MicroPython image; ESP32 and ESP32-S2 keep the bootloader at 0x1000
+    fn firmware_offset(&self, target: Option<&str>) -> u32 {
+        match target.map(|t| t.to_uppercase()) {
+            Some(t) if t == "ESP32" || t == "ESP32-S2" => 0x1000,
+            Some(_) => 0x0,
+            None => 0x1000,
+        }
     }
 
     async fn upload_with_ampy(
@@ -418,7 +601,9 @@ impl MicroPythonHandler {
                     .stdout(std::process::Stdio::piped())
                     .stderr(std::process::Stdio::piped());
 
-                let output = cmd.output().await.context("Failed to run ampy")?;
+                let output = process_group::output(&mut cmd)
+                    .await
+                    .context("Failed to run ampy")?;
 
                 if output.status.success() {
                     let _ = tx.send(AppEvent::BuildOutput(
@@ -535,3 +720,54 @@ impl MicroPythonHandler {
             .unwrap_or(false)
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_micropython_deploy_layout() {
+        let temp_dir = TempDir::new().expect("Failed to create temp dir");
+        let project_path = temp_dir.path();
+
+        fs::write(project_path.join("main.py"), "import machine\n").unwrap();
+        fs::write(project_path.join("boot.py"), "").unwrap();
+        fs::create_dir_all(project_path.join("lib/sensors")).unwrap();
+        fs::write(project_path.join("lib/sensors/__init__.py"), "").unwrap();
+        fs::create_dir_all(project_path.join("firmware")).unwrap();
+        fs::write(
+            project_path.join("firmware/ESP32_GENERIC-20240222-v1.22.2.bin"),
+            b"old",
+        )
+        .unwrap();
+        fs::write(
+            project_path.join("firmware/ESP32_GENERIC-20240602-v1.23.0.bin"),
+            b"new",
+        )
+        .unwrap();
+        fs::create_dir_all(project_path.join("__pycache__")).unwrap();
+
+        let handler = MicroPythonHandler;
+
+        // Newest firmware image wins when espbrew.yaml does not pin one
+        let firmware = handler.find_firmware_image(project_path).unwrap();
+        assert!(firmware.ends_with("ESP32_GENERIC-20240602-v1.23.0.bin"));
+
+        // Only the Python tree is synced, with packages kept as directories
+        assert_eq!(
+            handler.deploy_entries(project_path),
+            vec!["boot.py", "lib", "main.py"]
+        );
+
+        fs::write(
+            project_path.join("espbrew.yaml"),
+            "micropython:\n  firmware: images/custom.bin\n",
+        )
+        .unwrap();
+        assert_eq!(
+            handler.find_firmware_image(project_path).unwrap(),
+            project_path.join("images/custom.bin")
+        );
+    }
+}
@@ -2,6 +2,7 @@
 
 pub mod arduino;
 pub mod circuitpython;
+pub mod esp8266_rtos;
 pub mod esp_idf;
 pub mod jaculus;
 pub mod micropython;
@@ -1,5 +1,7 @@
+use crate::config::BoardMetadata;
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -12,6 +14,17 @@ use tokio::sync::mpsc;
 /// Handler for NuttX RTOS projects
 pub struct NuttXHandler;
 
+/// A NuttX tree has a single .config, so configure + make runs one board at a time
+static NUTTX_TREE_LOCK: tokio::sync::Mutex<()> = tokio::sync::Mutex::const_new(());
+
+/// An ESP board configuration found under boards/<arch>/<chip>/<board>/configs/<config>
+struct NuttXDefconfig {
+    board: String,
+    config: String,
+    chip: String,
+    defconfig: PathBuf,
+}
+
 #[async_trait]
 impl ProjectHandler for NuttXHandler {
     fn as_any(&self) -> &dyn std::any::Any {
@@ -26,11 +39,16 @@ impl ProjectHandler for NuttXHandler {
         _project_dir: &Path,
         board_config: &ProjectBoardConfig,
     ) -> bool {
-        // Check if build directory exists as basic artifact validation
-        board_config.build_dir.exists()
+        // Tree builds copy nuttx.bin into the per-board build directory
+        board_config.build_dir.join("nuttx.bin").exists()
     }
 
     fn can_handle(&self, project_dir: &Path) -> bool {
+        // A full NuttX source tree (or a workspace containing one)
+        if self.nuttx_tree_root(project_dir).is_some() {
+            return true;
+        }
+
         // Look for NuttX-specific files: .config, defconfig, Makefile, and nuttx directory
         let config_file = project_dir.join(".config");
         let defconfig = project_dir.join("defconfig");
@@ -61,6 +79,25 @@ impl ProjectHandler for NuttXHandler {
     fn discover_boards(&self, project_dir: &Path) -> Result<Vec<ProjectBoardConfig>> {
         let mut boards = Vec::new();
 
+        // In a NuttX source tree every ESP defconfig is a board configuration
+        if let Some(nuttx_root) = self.nuttx_tree_root(project_dir) {
+            for defconfig in self.find_esp_defconfigs(&nuttx_root) {
+                let name = format!("{}-{}", defconfig.board, defconfig.config);
+                boards.push(ProjectBoardConfig {
+                    build_dir: project_dir.join("build").join(&name),
+                    name,
+                    config_file: defconfig.defconfig,
+                    target: Some(self.board_to_target(&defconfig.chip)),
+                    project_type: ProjectType::NuttX,
+                });
+            }
+
+            if !boards.is_empty() {
+                boards.sort_by(|a, b| a.name.cmp(&b.name));
+                return Ok(boards);
+            }
+        }
+
         // Look for board configurations in various places:
         // 1. .config file for current configuration
         // 2. configs/ directory for available board configurations
@@ -128,13 +165,56 @@ impl ProjectHandler for NuttXHandler {
             format!("🔨 Executing: {}", build_command),
         ));
 
+        // Tree builds: select the board with tools/configure.sh before running make
+        let tree_build = self.tree_configure_target(project_dir, board_config);
+        let _tree_guard = if tree_build.is_some() {
+            Some(NUTTX_TREE_LOCK.lock().await)
+        } else {
+            None
+        };
+        let build_root = self
+            .nuttx_tree_root(project_dir)
+            .filter(|_| tree_build.is_some())
+            .unwrap_or_else(|| project_dir.to_path_buf());
+
+        if let Some((ref nuttx_root, ref configure_target)) = tree_build {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("⚙️  Configuring {}", configure_target),
+            ));
+
+            let mut cmd = Command::new("./tools/configure.sh");
+            cmd.current_dir(nuttx_root).args(["-E", configure_target]);
+            let output = process_group::output(&mut cmd)
+                .await
+                .context("Failed to run tools/configure.sh")?;
+
+            for line in String::from_utf8_lossy(&output.stdout)
+                .lines()
+                .chain(String::from_utf8_lossy(&output.stderr).lines())
+            {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    line.to_string(),
+                ));
+            }
+
+            if !output.status.success() {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!("❌ configure.sh {} failed", configure_target),
+                ));
+                return Err(anyhow::anyhow!("NuttX configure failed"));
+            }
+        }
+
         // Build with make
         let mut cmd = Command::new("make");
-        cmd.current_dir(project_dir)
+        cmd.current_dir(&build_root)
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start make")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start make")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -175,6 +255,19 @@ impl ProjectHandler for NuttXHandler {
                 "✅ NuttX build completed successfully".to_string(),
             ));
 
+            // Keep a copy per board, the next configure.sh run wipes the tree outputs
+            if tree_build.is_some() {
+                fs::create_dir_all(&board_config.build_dir)?;
+                for file in ["nuttx.bin", "nuttx"] {
+                    let source = build_root.join(file);
+                    if source.exists() {
+                        fs::copy(&source, board_config.build_dir.join(file)).with_context(
+                            || format!("Failed to copy {} to build directory", source.display()),
+                        )?;
+                    }
+                }
+            }
+
             // Find build artifacts
             self.find_build_artifacts(project_dir, board_config)
         } else {
@@ -201,7 +294,15 @@ impl ProjectHandler for NuttXHandler {
 
         // NuttX flashing depends on the target board
         // For ESP32, we'll use esptool
-        if board_config.name.contains("esp32") {
+        if self.board_chip(project_dir, board_config).is_some() {
+            // Fall back to the last build output when no artifacts were handed in
+            let found_artifacts;
+            let artifacts = if artifacts.is_empty() {
+                found_artifacts = self.find_build_artifacts(project_dir, board_config)?;
+                found_artifacts.as_slice()
+            } else {
+                artifacts
+            };
             self.flash_esp32(project_dir, board_config, artifacts, port, tx)
                 .await
         } else {
@@ -271,7 +372,9 @@ impl ProjectHandler for NuttXHandler {
         let mut cmd = Command::new("make");
         cmd.current_dir(project_dir).args(["clean"]);
 
-        let output = cmd.output().await.context("Failed to run make clean")?;
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run make clean")?;
 
         if output.status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -289,7 +392,17 @@ impl ProjectHandler for NuttXHandler {
         }
     }
 
-    fn get_build_command(&self, project_dir: &Path, _board_config: &ProjectBoardConfig) -> String {
+    fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String {
+        if let Some((nuttx_root, configure_target)) =
+            self.tree_configure_target(project_dir, board_config)
+        {
+            return format!(
+                "cd {} && ./tools/configure.sh -E {} && make",
+                nuttx_root.display(),
+                configure_target
+            );
+        }
+
         if std::env::current_dir().unwrap_or_else(|_| PathBuf::from(".")) != *project_dir {
             format!("cd {} && make", project_dir.display())
         } else {
@@ -311,10 +424,37 @@ impl ProjectHandler for NuttXHandler {
                 String::new()
             };
 
-        if board_config.name.contains("esp32") {
+        if let Some(chip) = self.board_chip(project_dir, board_config) {
+            let binary = if board_config.build_dir.as_path() != project_dir {
+                board_config
+                    .build_dir
+                    .join("nuttx.bin")
+                    .display()
+                    .to_string()
+            } else {
+                "nuttx.bin".to_string()
+            };
+            let metadata = BoardMetadata::load(project_dir, &board_config.name);
+            let flash_args = metadata
+                .esptool_write_flash_args()
+                .iter()
+                .map(|arg| format!("{} ", arg))
+                .collect::<String>();
+            let esptool_args = metadata
+                .esptool_args()
+                .iter()
+                .map(|arg| format!(" {}", arg))
+                .collect::<String>();
             format!(
-                "{}esptool.py --chip esp32 --port {} --baud 921600 write_flash -z 0x1000 nuttx.bin",
-                project_dir_str, port_str
+                "{}esptool.py --chip {} --port {} --baud {}{} write_flash -z {}0x{:x} {}",
+                project_dir_str,
+                chip,
+                port_str,
+                metadata.upload_baud(921600),
+                esptool_args,
+                flash_args,
+                self.flash_offset(&chip),
+                binary
             )
         } else {
             format!(
@@ -354,6 +494,123 @@ impl NuttXHandler {
             .unwrap_or(false)
     }
 
+    /// Locate the NuttX source tree: the project itself or a `nuttx/` checkout next to apps
+    fn nuttx_tree_root(&self, project_dir: &Path) -> Option<PathBuf> {
+        [project_dir.to_path_buf(), project_dir.join("nuttx")]
+            .into_iter()
+            .find(|dir| {
+                dir.join("tools").join("configure.sh").exists() && dir.join("boards").is_dir()
+            })
+    }
+
+    /// Enumerate boards/<arch>/esp32*/<board>/configs/<config>/defconfig
+    fn find_esp_defconfigs(&self, nuttx_root: &Path) -> Vec<NuttXDefconfig> {
+        let mut defconfigs = Vec::new();
+        let subdirs = |dir: &Path| -> Vec<PathBuf> {
+            dir.read_dir()
+                .into_iter()
+                .flatten()
+                .flatten()
+                .map(|entry| entry.path())
+                .filter(|path| path.is_dir())
+                .collect()
+        };
+
+        for arch_dir in subdirs(&nuttx_root.join("boards")) {
+            for chip_dir in subdirs(&arch_dir) {
+                let chip = chip_dir
+                    .file_name()
+                    .and_then(|n| n.to_str())
+                    .unwrap_or("")
+                    .to_string();
+                if !chip.starts_with("esp32") {
+                    continue;
+                }
+
+                for board_dir in subdirs(&chip_dir) {
+                    let board = board_dir
+                        .file_name()
+                        .and_then(|n| n.to_str())
+                        .unwrap_or("")
+                        .to_string();
+
+                    for config_dir in subdirs(&board_dir.join("configs")) {
+                        let defconfig = config_dir.join("defconfig");
+                        if !defconfig.exists() {
+                            continue;
+                        }
+                        defconfigs.push(NuttXDefconfig {
+                            board: board.clone(),
+                            config: config_dir
+                                .file_name()
+                                .and_then(|n| n.to_str())
+                                .unwrap_or("")
+                                .to_string(),
+                            chip: chip.clone(),
+                            defconfig,
+                        });
+                    }
+                }
+            }
+        }
+
+        defconfigs
+    }
+
+    /// `board:config` argument for configure.sh when the board comes from a tree defconfig
+    fn tree_configure_target(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Option<(PathBuf, String)> {
+        let nuttx_root = self.nuttx_tree_root(project_dir)?;
+        let config_dir = board_config.config_file.parent()?;
+        let board_dir = config_dir.parent()?.parent()?;
+        if !board_config
+            .config_file
+            .starts_with(nuttx_root.join("boards"))
+        {
+            return None;
+        }
+
+        let board = board_dir.file_name()?.to_str()?;
+        let config = config_dir.file_name()?.to_str()?;
+        Some((nuttx_root.clone(), format!("{}:{}", board, config)))
+    }
+
+    /// esptool chip name for ESP boards, derived from the target or board name
+    fn esp_chip(&self, board_config: &ProjectBoardConfig) -> Option<String> {
+        let source = board_config
+            .target
+            .clone()
+            .unwrap_or_else(|| board_config.name.clone())
+            .to_lowercase()
+            .replace('-', "");
+        let known = [
+            "esp32s3", "esp32s2", "esp32c6", "esp32c3", "esp32h2", "esp32p4",
+        ];
+        known
+            .iter()
+            .find(|chip| source.contains(*chip))
+            .map(|chip| chip.to_string())
+            .or_else(|| source.contains("esp32").then(|| "esp32".to_string()))
+    }
+
+    /// ESP chip of a board, preferring the `chip` declared in `espbrew.yaml`
+    fn board_chip(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> Option<String> {
+        BoardMetadata::load(project_dir, &board_config.name)
+            .chip
+            .or_else(|| self.esp_chip(board_config))
+    }
+
+    /// NuttX simple-boot images start at 0x1000 on ESP32/ESP32-S2 and at 0x0 on newer chips
+    fn flash_offset(&self, chip: &str) -> u32 {
+        match chip {
+            "esp32" | "esp32s2" => 0x1000,
+            _ => 0x0,
+        }
+    }
+
     fn detect_boards_from_config(
         &self,
         config_content: &str,
@@ -428,6 +685,10 @@ impl NuttXHandler {
             "ESP32-C6".to_string()
         } else if board_name.contains("esp32c3") {
             "ESP32-C3".to_string()
+        } else if board_name.contains("esp32s2") {
+            "ESP32-S2".to_string()
+        } else if board_name.contains("esp32h2") {
+            "ESP32-H2".to_string()
         } else if board_name.contains("esp32p4") {
             "ESP32-P4".to_string()
         } else if board_name.contains("esp32") {
@@ -440,9 +701,35 @@ impl NuttXHandler {
     fn find_build_artifacts(
         &self,
         project_dir: &Path,
-        _board_config: &ProjectBoardConfig,
+        board_config: &ProjectBoardConfig,
     ) -> Result<Vec<BuildArtifact>> {
         let mut artifacts = Vec::new();
+        let offset = self
+            .board_chip(project_dir, board_config)
+            .map(|chip| self.flash_offset(&chip))
+            .unwrap_or(0x1000);
+
+        // Per-board copies made after a tree build take precedence
+        let board_bin = board_config.build_dir.join("nuttx.bin");
+        if board_config.build_dir.as_path() != project_dir && board_bin.exists() {
+            artifacts.push(BuildArtifact {
+                name: "nuttx".to_string(),
+                file_path: board_bin,
+                artifact_type: ArtifactType::Binary,
+                offset: Some(offset),
+            });
+
+            let board_elf = board_config.build_dir.join("nuttx");
+            if board_elf.exists() {
+                artifacts.push(BuildArtifact {
+                    name: "nuttx".to_string(),
+                    file_path: board_elf,
+                    artifact_type: ArtifactType::Elf,
+                    offset: None,
+                });
+            }
+            return Ok(artifacts);
+        }
 
         // NuttX typically produces nuttx.bin and nuttx.elf in the root directory
         let nuttx_bin = project_dir.join("nuttx.bin");
@@ -451,7 +738,7 @@ impl NuttXHandler {
                 name: "nuttx".to_string(),
                 file_path: nuttx_bin,
                 artifact_type: ArtifactType::Binary,
-                offset: Some(0x1000), // Common offset for ESP32
+                offset: Some(offset),
             });
         }
 
@@ -478,7 +765,7 @@ impl NuttXHandler {
                     name: "nuttx".to_string(),
                     file_path: nuttx_bin_sub,
                     artifact_type: ArtifactType::Binary,
-                    offset: Some(0x1000),
+                    offset: Some(offset),
                 });
             }
 
@@ -526,23 +813,31 @@ impl NuttXHandler {
         let _ = tx.send(AppEvent::BuildOutput(
             board_config.name.clone(),
             format!(
-                "📤 Flashing {} to ESP32",
-                binary_artifact.file_path.display()
+                "📤 Flashing {} to {}",
+                binary_artifact.file_path.display(),
+                board_config.target.as_deref().unwrap_or("ESP32")
             ),
         ));
 
+        let chip = self
+            .board_chip(project_dir, board_config)
+            .unwrap_or_else(|| "esp32".to_string());
+        let metadata = BoardMetadata::load(project_dir, &board_config.name);
+
         let mut cmd = Command::new("esptool.py");
         cmd.current_dir(project_dir)
-            .args(["--chip", "esp32"])
+            .args(["--chip", &chip])
             .args(["--port", port_str])
-            .args(["--baud", "921600"])
+            .args(["--baud", &metadata.upload_baud(921600)])
+            .args(metadata.esptool_args())
             .args(["write_flash", "-z"])
+            .args(metadata.esptool_write_flash_args())
             .args([&format!("0x{:x}", binary_artifact.offset.unwrap_or(0x1000))])
             .args([&binary_artifact.file_path.to_string_lossy().to_string()])
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start esptool.py")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start esptool.py")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
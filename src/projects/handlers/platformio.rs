@@ -1,5 +1,6 @@
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -26,8 +27,8 @@ impl ProjectHandler for PlatformIOHandler {
         _project_dir: &Path,
         board_config: &ProjectBoardConfig,
     ) -> bool {
-        // Check if build directory exists as basic artifact validation
-        board_config.build_dir.exists()
+        // PlatformIO writes firmware.bin into .pio/build/{environment}/
+        board_config.build_dir.join("firmware.bin").exists()
     }
 
     fn can_handle(&self, project_dir: &Path) -> bool {
@@ -40,66 +41,28 @@ impl ProjectHandler for PlatformIOHandler {
             return Ok(Vec::new());
         }
 
-        let mut boards = Vec::new();
         let content = fs::read_to_string(&platformio_ini)?;
 
-        // Parse [env:board_name] sections
-        let mut current_env: Option<String> = None;
-        let mut current_board: Option<String> = None;
-
-        for line in content.lines() {
-            let line = line.trim();
-
-            // Check for environment section
-            if line.starts_with("[env:") && line.ends_with("]") {
-                // Save previous environment if it exists
-                if let Some(env_name) = current_env.take() {
-                    let build_dir = project_dir.join(".pio").join("build").join(&env_name);
-                    let target = current_board
-                        .as_ref()
-                        .map(|board| self.board_to_target(board))
-                        .unwrap_or_else(|| "Unknown".to_string());
-
-                    boards.push(ProjectBoardConfig {
-                        name: env_name,
-                        config_file: platformio_ini.clone(),
-                        build_dir,
-                        target: Some(target),
-                        project_type: ProjectType::PlatformIO,
-                    });
+        // Each [env:name] section becomes one board configuration
+        let mut boards: Vec<ProjectBoardConfig> = parse_environments(&content)
+            .into_iter()
+            .map(|env| {
+                let target = env
+                    .mcu
+                    .as_deref()
+                    .or(env.board.as_deref())
+                    .map(|board| self.board_to_target(board))
+                    .unwrap_or_else(|| "Unknown".to_string());
+
+                ProjectBoardConfig {
+                    build_dir: project_dir.join(".pio").join("build").join(&env.name),
+                    name: env.name,
+                    config_file: platformio_ini.clone(),
+                    target: Some(target),
+                    project_type: ProjectType::PlatformIO,
                 }
-
-                // Extract environment name
-                current_env = line
-                    .strip_prefix("[env:")
-                    .and_then(|s| s.strip_suffix("]"))
-                    .map(|s| s.to_string());
-                current_board = None;
-            }
-            // Parse board parameter
-            else if line.starts_with("board = ") && current_env.is_some() {
-                current_board = line.strip_prefix("board = ").map(|s| s.to_string());
-            }
-            // Note: platform parameter parsing removed as it's not currently used
-            // If needed in future, can be re-added when actually utilized
-        }
-
-        // Handle the last environment
-        if let Some(env_name) = current_env {
-            let build_dir = project_dir.join(".pio").join("build").join(&env_name);
-            let target = current_board
-                .as_ref()
-                .map(|board| self.board_to_target(board))
-                .unwrap_or_else(|| "Unknown".to_string());
-
-            boards.push(ProjectBoardConfig {
-                name: env_name,
-                config_file: platformio_ini,
-                build_dir,
-                target: Some(target),
-                project_type: ProjectType::PlatformIO,
-            });
-        }
+            })
+            .collect();
 
         boards.sort_by(|a, b| a.name.cmp(&b.name));
         Ok(boards)
@@ -129,7 +92,7 @@ impl ProjectHandler for PlatformIOHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start pio run")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start pio run")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -185,7 +148,7 @@ impl ProjectHandler for PlatformIOHandler {
         &self,
         project_dir: &Path,
         board_config: &ProjectBoardConfig,
-        _artifacts: &[BuildArtifact],
+        artifacts: &[BuildArtifact],
         port: Option<&str>,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
@@ -194,24 +157,23 @@ impl ProjectHandler for PlatformIOHandler {
             "🔥 Starting PlatformIO flash...".to_string(),
         ));
 
-        let flash_command = self.get_flash_command(project_dir, board_config, port);
+        // Skip the implicit rebuild when we already have a firmware image
+        let skip_build =
+            !artifacts.is_empty() || self.check_artifacts_exist(project_dir, board_config);
+
+        let args = upload_args(board_config, skip_build, port);
         let _ = tx.send(AppEvent::BuildOutput(
             board_config.name.clone(),
-            format!("🔨 Executing: {}", flash_command),
+            format!("🔨 Executing: pio {}", args.join(" ")),
         ));
 
         let mut cmd = Command::new("pio");
-        cmd.current_dir(project_dir)
-            .args(["run", "-e", &board_config.name, "--target", "upload"]);
-
-        if let Some(port) = port {
-            cmd.args(["--upload-port", port]);
-        }
+        cmd.current_dir(project_dir).args(&args);
 
         cmd.stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start pio run upload")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start pio run upload")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -289,8 +251,16 @@ impl ProjectHandler for PlatformIOHandler {
             cmd.args(["--port", port]);
         }
 
-        cmd.args(["--baud", &baud_rate.to_string()])
-            .stdout(std::process::Stdio::piped())
+        // Let PlatformIO apply monitor_speed/monitor_filters from the environment when set
+        if self
+            .environment(project_dir, &board_config.name)
+            .and_then(|env| env.monitor_speed)
+            .is_none()
+        {
+            cmd.args(["--baud", &baud_rate.to_string()]);
+        }
+
+        cmd.stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
         let mut child = cmd.spawn().context("Failed to start pio device monitor")?;
@@ -361,7 +331,9 @@ impl ProjectHandler for PlatformIOHandler {
         cmd.current_dir(project_dir)
             .args(["run", "-e", &board_config.name, "--target", "clean"]);
 
-        let output = cmd.output().await.context("Failed to run pio clean")?;
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run pio clean")?;
 
         if output.status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -397,22 +369,13 @@ impl ProjectHandler for PlatformIOHandler {
         board_config: &ProjectBoardConfig,
         port: Option<&str>,
     ) -> String {
-        let port_arg = port
-            .map(|p| format!(" --upload-port {}", p))
-            .unwrap_or_default();
+        let skip_build = self.check_artifacts_exist(project_dir, board_config);
+        let args = upload_args(board_config, skip_build, port).join(" ");
 
         if std::env::current_dir().unwrap_or_else(|_| PathBuf::from(".")) != *project_dir {
-            format!(
-                "cd {} && pio run -e {} --target upload{}",
-                project_dir.display(),
-                board_config.name,
-                port_arg
-            )
+            format!("cd {} && pio {}", project_dir.display(), args)
         } else {
-            format!(
-                "pio run -e {} --target upload{}",
-                board_config.name, port_arg
-            )
+            format!("pio {}", args)
         }
     }
 
@@ -444,14 +407,27 @@ impl PlatformIOHandler {
             .unwrap_or(false)
     }
 
+    /// Look up the parsed [env:name] section for a board configuration
+    fn environment(&self, project_dir: &Path, env_name: &str) -> Option<PioEnvironment> {
+        let content = fs::read_to_string(project_dir.join("platformio.ini")).ok()?;
+        parse_environments(&content)
+            .into_iter()
+            .find(|env| env.name == env_name)
+    }
+
     fn board_to_target(&self, board: &str) -> String {
-        // Map common PlatformIO board names to ESP32 targets
+        // Map common PlatformIO board names (esp32-s3-devkitc-1, esp32s3box, ...) to ESP32 targets
+        let board = board.to_lowercase().replace(['-', '_'], "");
         if board.contains("esp32s3") {
             "ESP32-S3".to_string()
         } else if board.contains("esp32c6") {
             "ESP32-C6".to_string()
         } else if board.contains("esp32c3") {
             "ESP32-C3".to_string()
+        } else if board.contains("esp32s2") {
+            "ESP32-S2".to_string()
+        } else if board.contains("esp32h2") {
+            "ESP32-H2".to_string()
         } else if board.contains("esp32p4") {
             "ESP32-P4".to_string()
         } else if board.contains("esp32") {
@@ -541,3 +517,139 @@ impl PlatformIOHandler {
         Ok(artifacts)
     }
 }
+
+/// Settings of a single [env:name] section, with [env] defaults and `extends` applied
+#[derive(Debug, Clone, Default)]
+struct PioEnvironment {
+    name: String,
+    board: Option<String>,
+    mcu: Option<String>,
+    monitor_speed: Option<String>,
+}
+
+/// Arguments of the `pio run` uploading the board's firmware; with
+/// `skip_build` an existing firmware image is flashed without rebuilding
+fn upload_args(
+    board_config: &ProjectBoardConfig,
+    skip_build: bool,
+    port: Option<&str>,
+) -> Vec<String> {
+    let mut args = vec![
+        "run".to_string(),
+        "-e".to_string(),
+        board_config.name.clone(),
+    ];
+    if skip_build {
+        args.extend(["--target".to_string(), "nobuild".to_string()]);
+    }
+    args.extend(["--target".to_string(), "upload".to_string()]);
+    if let Some(port) = port {
+        args.extend(["--upload-port".to_string(), port.to_string()]);
+    }
+    args
+}
+
+/// Parse platformio.ini into its environments in file order
+fn parse_environments(content: &str) -> Vec<PioEnvironment> {
+    // Collect key/value pairs per section, ignoring comments and continuation lines
+    let mut sections: Vec<(String, Vec<(String, String)>)> = Vec::new();
+
+    for raw_line in content.lines() {
+        if raw_line.starts_with([' ', '\t']) {
+            continue;
+        }
+        let line = raw_line.trim();
+        if line.is_empty() || line.starts_with(';') || line.starts_with('#') {
+            continue;
+        }
+        let line = strip_inline_comment(line);
+
+        if let Some((section, _)) = line
+            .strip_prefix('[')
+            .and_then(|rest| rest.rsplit_once(']'))
+        {
+            sections.push((section.trim().to_string(), Vec::new()));
+        } else if let Some((key, value)) = line.split_once('=') {
+            if let Some((_, values)) = sections.last_mut() {
+                values.push((key.trim().to_string(), value.trim().to_string()));
+            }
+        }
+    }
+
+    let lookup = |section: &str, key: &str| -> Option<String> {
+        sections
+            .iter()
+            .find(|(name, _)| name == section)
+            .and_then(|(_, values)| values.iter().rev().find(|(k, _)| k == key))
+            .map(|(_, v)| v.clone())
+            .filter(|v| !v.is_empty())
+    };
+
+    // Resolve a key through the section, its `extends` chain and finally [env]
+    let resolve = |section: &str, key: &str| -> Option<String> {
+        let mut current = section.to_string();
+        for _ in 0..8 {
+            if let Some(value) = lookup(&current, key) {
+                return Some(value);
+            }
+            match lookup(&current, "extends") {
+                Some(parent) => current = parent.split(',').next().unwrap_or("").trim().to_string(),
+                None => break,
+            }
+        }
+        lookup("env", key)
+    };
+
+    sections
+        .iter()
+        .filter_map(|(section, _)| section.strip_prefix("env:").map(|name| (section, name)))
+        .map(|(section, name)| PioEnvironment {
+            name: name.trim().to_string(),
+            board: resolve(section, "board"),
+            mcu: resolve(section, "board_build.mcu"),
+            monitor_speed: resolve(section, "monitor_speed"),
+        })
+        .collect()
+}
+
+/// Drop a trailing `; comment` or `# comment`, which PlatformIO only takes after whitespace
+fn strip_inline_comment(line: &str) -> &str {
+    line.char_indices()
+        .find(|&(i, c)| (c == ';' || c == '#') && line[..i].ends_with(|p: char| p.is_whitespace()))
+        .map_or(line, |(i, _)| line[..i].trim_end())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_inline_comments() {
+        let environments = parse_environments(
+            "[platformio]\n\
+             default_envs = s3box ; the one on the desk\n\
+             \n\
+             [env:s3box] ; ESP32-S3-BOX-3\n\
+             board = esp32s3box # from the registry\n\
+             monitor_speed = 115200\n\
+             \n\
+             [env:c3]\n\
+             board = esp32-c3-devkitm-1\n\
+             build_flags = -DNAME=c3#1\n",
+        );
+        let names: Vec<&str> = environments.iter().map(|e| e.name.as_str()).collect();
+        assert_eq!(names, ["s3box", "c3"]);
+        assert_eq!(environments[0].board.as_deref(), Some("esp32s3box"));
+        assert_eq!(environments[0].monitor_speed.as_deref(), Some("115200"));
+
+        assert_eq!(
+            strip_inline_comment("default_envs = s3box, c3 ; both"),
+            "default_envs = s3box, c3"
+        );
+        // Without whitespace before it, the character is part of the value
+        assert_eq!(
+            strip_inline_comment("build_flags = -DNAME=c3#1"),
+            "build_flags = -DNAME=c3#1"
+        );
+    }
+}
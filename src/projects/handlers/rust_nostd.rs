@@ -1,5 +1,6 @@
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -37,12 +38,15 @@ impl ProjectHandler for RustNoStdHandler {
     }
 
     fn check_artifacts_exist(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> bool {
-        // For Rust no_std, check if ELF binary exists in target directory
-        let target_name = board_config.target.as_ref().map(|t| t.as_str());
+        // For Rust projects, check if ELF binary exists in target/{triple}/release
+        let target_name = self
+            .extract_build_info_from_board(project_dir, board_config)
+            .ok()
+            .and_then(|info| info.target);
 
         if let Some(target) = target_name {
             // Check in target/{target}/release/ directory
-            let release_dir = board_config.build_dir.join(target).join("release");
+            let release_dir = board_config.build_dir.join(&target).join("release");
             if release_dir.exists() {
                 // Look for any ELF binary (project name)
                 if let Ok(project_name) = self.get_project_name_from_dir(project_dir) {
@@ -74,6 +78,9 @@ impl ProjectHandler for RustNoStdHandler {
         if let Ok(content) = std::fs::read_to_string(&cargo_toml) {
             // Look for common embedded Rust dependencies
             content.contains("esp-hal")
+                || content.contains("esp-idf-sys")
+                || content.contains("esp-idf-svc")
+                || content.contains("esp-idf-hal")
                 || content.contains("esp-backtrace")
                 || content.contains("esp-println")
                 || content.contains("embedded-hal")
@@ -217,7 +224,7 @@ impl ProjectHandler for RustNoStdHandler {
                 cmd
             };
 
-        let mut child = cmd.spawn().context("Failed to start cargo build")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start cargo build")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -440,20 +447,32 @@ impl ProjectHandler for RustNoStdHandler {
             ),
         ));
 
-        // For Rust projects, we can use espflash monitor or cargo-espflash
-        let mut cmd = Command::new("cargo");
+        // Attach espflash monitor directly so the device is not re-flashed
+        let mut cmd = Command::new("espflash");
         cmd.current_dir(project_dir)
-            .args(["run", "--release"]) // This will flash and monitor
+            .args(["monitor", "--non-interactive"])
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
         if let Some(port) = port {
-            cmd.env("ESPFLASH_PORT", port);
+            cmd.args(["--port", port]);
+        }
+
+        if baud_rate != 115200 {
+            cmd.args(["--monitor-baud", &baud_rate.to_string()]);
         }
 
-        let mut child = cmd
-            .spawn()
-            .context("Failed to start cargo run for monitoring")?;
+        // Pass the ELF so espflash can resolve backtrace addresses to symbols
+        if let Ok(artifacts) = self.find_build_artifacts(project_dir, board_config) {
+            if let Some(elf) = artifacts
+                .iter()
+                .find(|artifact| matches!(artifact.artifact_type, ArtifactType::Elf))
+            {
+                cmd.arg("--elf").arg(&elf.file_path);
+            }
+        }
+
+        let mut child = cmd.spawn().context("Failed to start espflash monitor")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -468,7 +487,7 @@ impl ProjectHandler for RustNoStdHandler {
             let mut buffer = String::new();
 
             while reader.read_line(&mut buffer).await.unwrap_or(0) > 0 {
-                let line = buffer.trim().to_string();
+                let line = strip_ansi_codes(buffer.trim());
                 let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
                 buffer.clear();
             }
@@ -480,13 +499,16 @@ impl ProjectHandler for RustNoStdHandler {
             let mut buffer = String::new();
 
             while reader.read_line(&mut buffer).await.unwrap_or(0) > 0 {
-                let line = buffer.trim().to_string();
+                let line = strip_ansi_codes(buffer.trim());
                 let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
                 buffer.clear();
             }
         });
 
-        let status = child.wait().await.context("Failed to wait for cargo run")?;
+        let status = child
+            .wait()
+            .await
+            .context("Failed to wait for espflash monitor")?;
 
         if status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -520,7 +542,9 @@ impl ProjectHandler for RustNoStdHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let output = cmd.output().await.context("Failed to run cargo clean")?;
+        let output = process_group::output(&mut cmd)
+            .await
+            .context("Failed to run cargo clean")?;
 
         if output.status.success() {
             let _ = tx.send(AppEvent::BuildOutput(
@@ -811,22 +835,33 @@ impl RustNoStdHandler {
     pub fn find_build_artifacts(
         &self,
         project_dir: &Path,
-        _board_config: &ProjectBoardConfig,
+        board_config: &ProjectBoardConfig,
     ) -> Result<Vec<BuildArtifact>> {
         let mut artifacts = Vec::new();
 
         // Look for the compiled binary in target/xtensa-*/release/ or target/riscv32*/release/
         let target_dir = project_dir.join("target");
-        let release_dirs = vec![
+        let mut release_dirs = vec![
             target_dir.join("xtensa-esp32s3-none-elf/release"),
             target_dir.join("xtensa-esp32-none-elf/release"),
             target_dir.join("riscv32imc-unknown-none-elf/release"),
             target_dir.join("riscv32imac-unknown-none-elf/release"),
             target_dir.join("riscv32imc-esp-espidf/release"),
             target_dir.join("riscv32imac-esp-espidf/release"),
+            target_dir.join("xtensa-esp32s3-espidf/release"),
+            target_dir.join("xtensa-esp32-espidf/release"),
             // Add more target architectures as needed
         ];
 
+        // Check the board's own target first so multi-target projects pick the right binary
+        if let Some(target) = self
+            .extract_build_info_from_board(project_dir, board_config)
+            .ok()
+            .and_then(|info| info.target)
+        {
+            release_dirs.insert(0, target_dir.join(target).join("release"));
+        }
+
         for release_dir in release_dirs {
             if release_dir.exists() {
                 // Look for the project binary using package name from main Cargo.toml
@@ -1257,9 +1292,30 @@ impl RustNoStdHandler {
             }
         }
 
+        // esp-idf-sys (std) projects use the *-espidf targets and no chip features
+        if self.uses_esp_idf_std(project_dir) {
+            if let Some(chip) = build_info.features.first() {
+                if let Some(target) = espidf_target_for_chip(chip.trim_end_matches("-psram")) {
+                    build_info.target = Some(target.to_string());
+                }
+            }
+            build_info.features.clear();
+        }
+
         Ok(build_info)
     }
 
+    /// Check whether the project builds on top of ESP-IDF (std) rather than bare-metal esp-hal
+    fn uses_esp_idf_std(&self, project_dir: &Path) -> bool {
+        std::fs::read_to_string(project_dir.join("Cargo.toml"))
+            .map(|content| {
+                content.contains("esp-idf-sys")
+                    || content.contains("esp-idf-svc")
+                    || content.contains("esp-idf-hal")
+            })
+            .unwrap_or(false)
+    }
+
     /// Flash Rust no_std binary with multi-partition support (bootloader + partition table + app)
     /// This method creates a complete ESP32 flash image with all required components.
     pub async fn flash_multi_partition_rust_binary(
@@ -1360,8 +1416,7 @@ impl RustNoStdHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-            let output = cmd
-                .output()
+            let output = process_group::output(&mut cmd)
                 .await
                 .with_context(|| "Failed to run espflash save-image")?;
 
@@ -1447,6 +1502,7 @@ impl RustNoStdHandler {
                         total_size as f64 / 1024.0
                     ),
                     duration_ms: None,
+                    verified: false,
                 })
             }
             Err(e) => {
@@ -1460,6 +1516,7 @@ impl RustNoStdHandler {
                     success: false,
                     message: format!("Flash failed: {}", e),
                     duration_ms: None,
+                    verified: false,
                 })
             }
         }
@@ -1547,6 +1604,44 @@ impl RustNoStdHandler {
     }
 }
 
+/// Map a chip name to the Rust target triple used by esp-idf-sys (std) projects
+fn espidf_target_for_chip(chip: &str) -> Option<&'static str> {
+    match chip {
+        "esp32" => Some("xtensa-esp32-espidf"),
+        "esp32s2" => Some("xtensa-esp32s2-espidf"),
+        "esp32s3" => Some("xtensa-esp32s3-espidf"),
+        "esp32c2" | "esp32c3" => Some("riscv32imc-esp-espidf"),
+        "esp32c6" | "esp32h2" => Some("riscv32imac-esp-espidf"),
+        "esp32p4" => Some("riscv32imafc-esp-espidf"),
+        _ => None,
+    }
+}
+
+/// Strip ANSI escape sequences that espflash monitor forwards from the device
+fn strip_ansi_codes(text: &str) -> String {
+    let mut result = String::with_capacity(text.len());
+    let mut chars = text.chars().peekable();
+
+    while let Some(ch) = chars.next() {
+        if ch == '\x1b' {
+            // Skip CSI sequences of the form ESC [ ... <final byte>
+            if chars.peek() == Some(&'[') {
+                chars.next();
+                while let Some(&next) = chars.peek() {
+                    chars.next();
+                    if next.is_ascii_alphabetic() {
+                        break;
+                    }
+                }
+            }
+        } else {
+            result.push(ch);
+        }
+    }
+
+    result
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -1643,4 +1738,40 @@ mod tests {
             app_data.len()
         );
     }
+
+    #[test]
+    fn test_strip_ansi_codes() {
+        assert_eq!(
+            strip_ansi_codes("\x1b[0;32mI (312) app: ready\x1b[0m"),
+            "I (312) app: ready"
+        );
+        assert_eq!(strip_ansi_codes("plain line"), "plain line");
+    }
+
+    #[test]
+    fn test_esp_idf_std_target_selection() {
+        let handler = RustNoStdHandler;
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        std::fs::write(
+            temp_dir.path().join("Cargo.toml"),
+            "[package]\nname = \"std-demo\"\n\n[dependencies]\nesp-idf-svc = \"0.49\"\n",
+        )
+        .unwrap();
+
+        assert!(handler.can_handle(temp_dir.path()));
+
+        let config = ProjectBoardConfig {
+            name: "std-demo".to_string(),
+            config_file: temp_dir.path().join("Cargo.toml"),
+            build_dir: temp_dir.path().join("target"),
+            target: Some("ESP32-C3".to_string()),
+            project_type: ProjectType::RustNoStd,
+        };
+
+        let build_info = handler
+            .extract_build_info_from_board(temp_dir.path(), &config)
+            .unwrap();
+        assert_eq!(build_info.target.as_deref(), Some("riscv32imc-esp-espidf"));
+        assert!(build_info.features.is_empty());
+    }
 }
@@ -1,5 +1,7 @@
+use crate::config::ProjectConfig;
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -41,6 +43,94 @@ impl ProjectHandler for TinyGoHandler {
         self.has_tinygo_imports(project_dir)
     }
 
+    async fn prepare_build(
+        &self,
+        project_dir: &Path,
+        boards: &[ProjectBoardConfig],
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let Some(board_config) = boards.first() else {
+            return Ok(());
+        };
+
+        let vendor = ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .and_then(|config| config.tinygo)
+            .map(|section| section.vendor)
+            .unwrap_or(false);
+        let requirements = Self::module_requirements(project_dir);
+        if !vendor && requirements.is_empty() && boards.len() < 2 {
+            return Ok(());
+        }
+
+        if vendor {
+            if Self::vendor_up_to_date(project_dir) {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    "📦 vendor/ is up to date with go.mod".to_string(),
+                ));
+            } else {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!(
+                        "📦 Vendoring {} module dependencies into vendor/...",
+                        requirements.len()
+                    ),
+                ));
+                self.run_tool("go", &["mod", "vendor"], project_dir, board_config, &tx)
+                    .await?;
+            }
+        } else if !requirements.is_empty() {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!(
+                    "📦 Downloading {} module dependencies once for {} board(s)...",
+                    requirements.len(),
+                    boards.len()
+                ),
+            ));
+            self.run_tool("go", &["mod", "download"], project_dir, board_config, &tx)
+                .await?;
+        }
+
+        // A single warm-up build fills the TinyGo and Go build caches, so the
+        // parallel builds don't race on populating them
+        if boards.len() > 1 {
+            let warmup_output = std::env::temp_dir()
+                .join(format!("espbrew-tinygo-warmup-{}.elf", std::process::id()));
+            let warmup_path = warmup_output.to_string_lossy().to_string();
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("🔥 Warm-up build for {}...", board_config.name),
+            ));
+            let result = self
+                .run_tool(
+                    "tinygo",
+                    &[
+                        "build",
+                        "-target",
+                        board_config.name.as_str(),
+                        "-o",
+                        warmup_path.as_str(),
+                        ".",
+                    ],
+                    project_dir,
+                    board_config,
+                    &tx,
+                )
+                .await;
+            let _ = fs::remove_file(&warmup_output);
+            result?;
+        }
+
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "✅ Module dependencies ready".to_string(),
+        ));
+        Ok(())
+    }
+
     fn discover_boards(&self, project_dir: &Path) -> Result<Vec<ProjectBoardConfig>> {
         let mut boards = Vec::new();
 
@@ -97,7 +187,7 @@ impl ProjectHandler for TinyGoHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start tinygo build")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start tinygo build")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -183,7 +273,7 @@ impl ProjectHandler for TinyGoHandler {
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start tinygo flash")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start tinygo flash")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -396,6 +486,11 @@ impl TinyGoHandler {
         Ok(go_files)
     }
 
+    /// Pick TinyGo targets for the project.
+    ///
+    /// Order of precedence: `tinygo.targets` in espbrew.yaml, `//espbrew:target <target>`
+    /// comments, `//go:build` tags, the highest `machine.GPIO<n>` in use, and finally chip
+    /// names mentioned in the source.
     fn detect_boards_from_files(
         &self,
         project_dir: &Path,
@@ -403,41 +498,161 @@ impl TinyGoHandler {
     ) -> Result<Vec<ProjectBoardConfig>> {
         let mut boards = Vec::new();
 
-        // Look for board-specific configurations in comments or build tags
-        for go_file in go_files {
-            if let Ok(content) = fs::read_to_string(go_file) {
-                // Check for board hints in build tags or comments
+        // Explicit override in espbrew.yaml
+        if let Some(section) = ProjectConfig::load(project_dir)?.and_then(|c| c.tinygo) {
+            if !section.targets.is_empty() {
+                for target in &section.targets {
+                    self.add_board(
+                        &mut boards,
+                        project_dir,
+                        target,
+                        &ProjectConfig::path(project_dir),
+                    );
+                }
+                return Ok(boards);
+            }
+        }
+
+        let sources: Vec<(&PathBuf, String)> = go_files
+            .iter()
+            .filter_map(|file| fs::read_to_string(file).ok().map(|content| (file, content)))
+            .collect();
+
+        // `//espbrew:target esp32s3` directives
+        for (file, content) in &sources {
+            for line in content.lines() {
+                if let Some(target) = line.trim().strip_prefix("//espbrew:target") {
+                    for target in target.split_whitespace() {
+                        self.add_board(&mut boards, project_dir, target, file);
+                    }
+                }
+            }
+        }
+
+        // Build tags naming a chip, e.g. `//go:build esp32c3`
+        if boards.is_empty() {
+            for (file, content) in &sources {
+                for line in content.lines() {
+                    let constraint = line.trim();
+                    let expression = constraint
+                        .strip_prefix("//go:build")
+                        .or_else(|| constraint.strip_prefix("// +build"));
+                    if let Some(expression) = expression {
+                        for tag in expression
+                            .split(|c: char| !c.is_ascii_alphanumeric() && c != '!')
+                            .filter(|tag| !tag.starts_with('!'))
+                        {
+                            if let Some(target) = self.chip_to_default_target(tag) {
+                                self.add_board(&mut boards, project_dir, target, file);
+                            }
+                        }
+                    }
+                }
+            }
+        }
+
+        // Pin numbers that only exist on some chips
+        if boards.is_empty() {
+            for (file, content) in &sources {
+                if let Some(chip) = self.chip_from_gpio_usage(content) {
+                    if let Some(target) = self.chip_to_default_target(chip) {
+                        self.add_board(&mut boards, project_dir, target, file);
+                    }
+                }
+            }
+        }
+
+        // Chip names mentioned in comments or strings
+        if boards.is_empty() {
+            for (file, content) in &sources {
                 let target = if content.contains("esp32-c6") || content.contains("ESP32-C6") {
-                    ("esp32-c6-generic", "ESP32-C6")
+                    "esp32-c6-generic"
                 } else if content.contains("esp32s3") || content.contains("ESP32-S3") {
-                    ("esp32-s3-usb-otg", "ESP32-S3")
+                    "esp32-s3-usb-otg"
                 } else if content.contains("esp32-c3") || content.contains("ESP32-C3") {
-                    ("esp32-c3-mini", "ESP32-C3")
+                    "esp32-c3-mini"
                 } else if content.contains("esp32") || content.contains("ESP32") {
-                    ("esp32-coreboard-v2", "ESP32")
+                    "esp32-coreboard-v2"
                 } else {
                     continue; // Skip if no specific target found
                 };
-
-                // Avoid duplicates
-                if !boards
-                    .iter()
-                    .any(|b: &ProjectBoardConfig| b.name == target.0)
-                {
-                    boards.push(ProjectBoardConfig {
-                        name: target.0.to_string(),
-                        config_file: go_file.clone(),
-                        build_dir: project_dir.to_path_buf(),
-                        target: Some(target.1.to_string()),
-                        project_type: ProjectType::TinyGo,
-                    });
-                }
+                self.add_board(&mut boards, project_dir, target, file);
             }
         }
 
         Ok(boards)
     }
 
+    fn add_board(
+        &self,
+        boards: &mut Vec<ProjectBoardConfig>,
+        project_dir: &Path,
+        name: &str,
+        config_file: &Path,
+    ) {
+        // Avoid duplicates
+        if !boards.iter().any(|b| b.name == name) {
+            boards.push(ProjectBoardConfig {
+                name: name.to_string(),
+                config_file: config_file.to_path_buf(),
+                build_dir: project_dir.to_path_buf(),
+                target: Some(self.target_to_chip(name).to_string()),
+                project_type: ProjectType::TinyGo,
+            });
+        }
+    }
+
+    /// Default TinyGo `-target` for a chip name or build tag
+    fn chip_to_default_target(&self, chip: &str) -> Option<&'static str> {
+        match chip {
+            "esp32" => Some("esp32-coreboard-v2"),
+            "esp32s3" => Some("esp32-s3-usb-otg"),
+            "esp32c3" => Some("esp32-c3-mini"),
+            "esp32c6" => Some("esp32-c6-generic"),
+            "esp8266" => Some("nodemcu"),
+            _ => None,
+        }
+    }
+
+    /// Guess the chip from the highest `machine.GPIO<n>` referenced in the source
+    fn chip_from_gpio_usage(&self, content: &str) -> Option<&'static str> {
+        let highest_gpio = content
+            .match_indices("machine.GPIO")
+            .filter_map(|(index, pattern)| {
+                let digits: String = content[index + pattern.len()..]
+                    .chars()
+                    .take_while(|c| c.is_ascii_digit())
+                    .collect();
+                digits.parse::<u32>().ok()
+            })
+            .max()?;
+
+        // GPIO40-48 only exist on the ESP32-S3
+        match highest_gpio {
+            40..=48 => Some("esp32s3"),
+            _ => None,
+        }
+    }
+
+    /// Chip family shown in the board list for a TinyGo target name
+    fn target_to_chip(&self, target: &str) -> &'static str {
+        let normalized = target.to_lowercase().replace(['-', '_'], "");
+        if normalized.contains("esp32s3") {
+            "ESP32-S3"
+        } else if normalized.contains("esp32c6") {
+            "ESP32-C6"
+        } else if normalized.contains("esp32c3") {
+            "ESP32-C3"
+        } else if normalized.contains("esp8266")
+            || normalized == "nodemcu"
+            || normalized == "d1mini"
+        {
+            "ESP8266"
+        } else {
+            "ESP32"
+        }
+    }
+
     fn find_build_artifacts(
         &self,
         project_dir: &Path,
@@ -546,6 +761,107 @@ impl TinyGoHandler {
         Ok(())
     }
 
+    /// Modules listed in the `require` directives of go.mod
+    pub fn module_requirements(project_dir: &Path) -> Vec<String> {
+        let Ok(content) = fs::read_to_string(project_dir.join("go.mod")) else {
+            return Vec::new();
+        };
+
+        let mut requirements = Vec::new();
+        let mut in_block = false;
+        for line in content.lines() {
+            let line = line.split("//").next().unwrap_or("").trim();
+            if in_block {
+                if line == ")" {
+                    in_block = false;
+                } else if let Some(module) = line.split_whitespace().next() {
+                    requirements.push(module.to_string());
+                }
+            } else if line == "require (" {
+                in_block = true;
+            } else if let Some(rest) = line.strip_prefix("require ") {
+                if let Some(module) = rest.split_whitespace().next() {
+                    requirements.push(module.to_string());
+                }
+            }
+        }
+
+        requirements
+    }
+
+    /// Whether `vendor/modules.txt` exists and is newer than go.mod and go.sum
+    pub fn vendor_up_to_date(project_dir: &Path) -> bool {
+        let modified = |path: PathBuf| fs::metadata(path).and_then(|m| m.modified()).ok();
+
+        let Some(vendored) = modified(project_dir.join("vendor").join("modules.txt")) else {
+            return false;
+        };
+        ["go.mod", "go.sum"]
+            .iter()
+            .filter_map(|file| modified(project_dir.join(file)))
+            .all(|changed| changed <= vendored)
+    }
+
+    /// Run a Go or TinyGo tool in the project, streaming output to the board's log
+    async fn run_tool(
+        &self,
+        program: &str,
+        args: &[&str],
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        tx: &mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        let command_line = format!("{} {}", program, args.join(" "));
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🔨 Executing: {}", command_line),
+        ));
+
+        let mut cmd = Command::new(program);
+        cmd.current_dir(project_dir)
+            .args(args)
+            .stdout(std::process::Stdio::piped())
+            .stderr(std::process::Stdio::piped());
+        let mut child = process_group::spawn(&mut cmd)
+            .with_context(|| format!("Failed to start {}", command_line))?;
+        let stdout = child.stdout.take().unwrap();
+        let stderr = child.stderr.take().unwrap();
+
+        let tx_stdout = tx.clone();
+        let tx_stderr = tx.clone();
+        let board_name_stdout = board_config.name.clone();
+        let board_name_stderr = board_config.name.clone();
+
+        tokio::spawn(async move {
+            let mut lines = BufReader::new(stdout).lines();
+            while let Ok(Some(line)) = lines.next_line().await {
+                let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+            }
+        });
+
+        tokio::spawn(async move {
+            let mut lines = BufReader::new(stderr).lines();
+            while let Ok(Some(line)) = lines.next_line().await {
+                let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+            }
+        });
+
+        let status = child
+            .wait()
+            .await
+            .with_context(|| format!("Failed to wait for {}", command_line))?;
+
+        if status.success() {
+            Ok(())
+        } else {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("❌ {} failed", command_line),
+            ));
+            Err(anyhow::anyhow!("{} failed", command_line))
+        }
+    }
+
     fn is_tool_available(&self, tool: &str) -> bool {
         std::process::Command::new("which")
             .arg(tool)
@@ -1,5 +1,8 @@
+use crate::config::ProjectConfig;
 use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig, ProjectType};
+use crate::projects::build_layout;
 use crate::projects::registry::ProjectHandler;
+use crate::utils::process_group;
 
 use anyhow::{Context, Result};
 use async_trait::async_trait;
@@ -31,11 +34,12 @@ impl ProjectHandler for ZephyrHandler {
     }
 
     fn can_handle(&self, project_dir: &Path) -> bool {
-        // Look for prj.conf and CMakeLists.txt with Zephyr-specific content
+        // Look for prj.conf (or a west.yml manifest) and CMakeLists.txt with Zephyr-specific content
         let prj_conf = project_dir.join("prj.conf");
+        let west_manifest = project_dir.join("west.yml");
         let cmake_lists = project_dir.join("CMakeLists.txt");
 
-        if !prj_conf.exists() || !cmake_lists.exists() {
+        if (!prj_conf.exists() && !west_manifest.exists()) || !cmake_lists.exists() {
             return false;
         }
 
@@ -51,9 +55,8 @@ impl ProjectHandler for ZephyrHandler {
         let mut boards = Vec::new();
 
         // Look for board configurations in various places:
-        // 1. boards/ directory with board definitions
+        // 1. boards/ directory with board definitions and <board>.overlay/<board>.conf files
         // 2. prj.conf for default board hints
-        // 3. west.yml for board references
 
         // Check prj.conf for board hints
         let prj_conf = project_dir.join("prj.conf");
@@ -74,14 +77,21 @@ impl ProjectHandler for ZephyrHandler {
             boards.push(ProjectBoardConfig {
                 name: "esp32".to_string(),
                 config_file: prj_conf,
-                build_dir: project_dir.join("build"),
+                build_dir: Self::board_build_dir(project_dir, "esp32"),
                 target: Some("ESP32".to_string()),
                 project_type: ProjectType::Zephyr,
             });
         }
 
         boards.sort_by(|a, b| a.name.cmp(&b.name));
-        Ok(boards)
+        // A board may be found both via prj.conf hints and an overlay file
+        boards.dedup_by(|a, b| a.name == b.name);
+        let config = ProjectConfig::load(project_dir).ok().flatten();
+        Ok(build_layout::place_build_dirs(
+            project_dir,
+            config.as_ref(),
+            boards,
+        ))
     }
 
     async fn build_board(
@@ -101,14 +111,23 @@ impl ProjectHandler for ZephyrHandler {
             format!("🔨 Executing: {}", build_command),
         ));
 
-        // Build with west
+        // Build with west into a per-board build directory so boards can build in parallel
+        let build_dir = Self::absolute_build_dir(board_config);
         let mut cmd = Command::new("west");
         cmd.current_dir(project_dir)
-            .args(["build", "-b", &board_config.name])
+            .args([
+                "build",
+                "-p",
+                "auto",
+                "-b",
+                &board_config.name,
+                "-d",
+                &build_dir,
+            ])
             .stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start west build")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start west build")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -182,8 +201,10 @@ impl ProjectHandler for ZephyrHandler {
             format!("🔨 Executing: {}", flash_command),
         ));
 
+        let build_dir = Self::absolute_build_dir(board_config);
         let mut cmd = Command::new("west");
-        cmd.current_dir(project_dir).args(["flash"]);
+        cmd.current_dir(project_dir)
+            .args(["flash", "-d", &build_dir]);
 
         if let Some(port) = port {
             // Some boards support specifying the serial port
@@ -195,7 +216,7 @@ impl ProjectHandler for ZephyrHandler {
         cmd.stdout(std::process::Stdio::piped())
             .stderr(std::process::Stdio::piped());
 
-        let mut child = cmd.spawn().context("Failed to start west flash")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start west flash")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
@@ -283,7 +304,7 @@ impl ProjectHandler for ZephyrHandler {
 
     async fn clean_board(
         &self,
-        project_dir: &Path,
+        _project_dir: &Path,
         board_config: &ProjectBoardConfig,
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()> {
@@ -292,10 +313,10 @@ impl ProjectHandler for ZephyrHandler {
             "🧹 Cleaning Zephyr build artifacts...".to_string(),
         ));
 
-        // Remove build directory
-        let build_dir = project_dir.join("build");
+        // Remove this board's build directory only
+        let build_dir = &board_config.build_dir;
         if build_dir.exists() {
-            fs::remove_dir_all(&build_dir).context("Failed to remove build directory")?;
+            fs::remove_dir_all(build_dir).context("Failed to remove build directory")?;
         }
 
         let _ = tx.send(AppEvent::BuildOutput(
@@ -307,14 +328,16 @@ impl ProjectHandler for ZephyrHandler {
     }
 
     fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String {
+        let west_build = format!(
+            "west build -p auto -b {} -d {}",
+            board_config.name,
+            board_config.build_dir.display()
+        );
+
         if std::env::current_dir().unwrap_or_else(|_| PathBuf::from(".")) != *project_dir {
-            format!(
-                "cd {} && west build -b {}",
-                project_dir.display(),
-                board_config.name
-            )
+            format!("cd {} && {}", project_dir.display(), west_build)
         } else {
-            format!("west build -b {}", board_config.name)
+            west_build
         }
     }
 
@@ -334,10 +357,16 @@ impl ProjectHandler for ZephyrHandler {
             String::new()
         };
 
+        let west_flash = format!(
+            "west flash -d {}{}",
+            board_config.build_dir.display(),
+            port_arg
+        );
+
         if std::env::current_dir().unwrap_or_else(|_| PathBuf::from(".")) != *project_dir {
-            format!("cd {} && west flash{}", project_dir.display(), port_arg)
+            format!("cd {} && {}", project_dir.display(), west_flash)
         } else {
-            format!("west flash{}", port_arg)
+            west_flash
         }
     }
 
@@ -362,6 +391,19 @@ impl ProjectHandler for ZephyrHandler {
 }
 
 impl ZephyrHandler {
+    /// Per-board build directory, so parallel builds of different boards don't clobber each other
+    fn board_build_dir(project_dir: &Path, board_name: &str) -> PathBuf {
+        project_dir.join("build").join(board_name)
+    }
+
+    /// Build directory as an absolute path, since west runs from the project directory
+    fn absolute_build_dir(board_config: &ProjectBoardConfig) -> String {
+        std::path::absolute(&board_config.build_dir)
+            .unwrap_or_else(|_| board_config.build_dir.clone())
+            .to_string_lossy()
+            .to_string()
+    }
+
     fn is_tool_available(&self, tool: &str) -> bool {
         std::process::Command::new("which")
             .arg(tool)
@@ -384,9 +426,9 @@ impl ZephyrHandler {
                     let target = self.board_to_target(&board_hint);
 
                     boards.push(ProjectBoardConfig {
+                        build_dir: Self::board_build_dir(project_dir, &board_hint),
                         name: board_hint,
                         config_file: project_dir.join("prj.conf"),
-                        build_dir: project_dir.join("build"),
                         target: Some(target),
                         project_type: ProjectType::Zephyr,
                     });
@@ -420,24 +462,64 @@ impl ZephyrHandler {
             for entry in entries.flatten() {
                 let path = entry.path();
                 if path.is_dir() {
+                    // Out-of-tree board definition: boards/<board_name>/
                     if let Some(board_name) = path.file_name().and_then(|n| n.to_str()) {
                         let target = self.board_to_target(board_name);
 
                         boards.push(ProjectBoardConfig {
                             name: board_name.to_string(),
                             config_file: project_dir.join("prj.conf"),
-                            build_dir: project_dir.join("build"),
+                            build_dir: Self::board_build_dir(project_dir, board_name),
                             target: Some(target),
                             project_type: ProjectType::Zephyr,
                         });
                     }
+                } else if let Some(board_name) = Self::board_name_from_fragment(&path) {
+                    // Board overlay or Kconfig fragment: boards/<board_name>.overlay / .conf
+                    let target = self.board_to_target(&board_name);
+
+                    boards.push(ProjectBoardConfig {
+                        build_dir: Self::board_build_dir(project_dir, &board_name),
+                        name: board_name,
+                        config_file: path.clone(),
+                        target: Some(target),
+                        project_type: ProjectType::Zephyr,
+                    });
                 }
             }
         }
 
+        // Prefer the .overlay file as the board's config file when both fragments exist
+        boards.sort_by(|a, b| {
+            a.name.cmp(&b.name).then_with(|| {
+                let a_overlay = a.config_file.extension().is_some_and(|e| e == "overlay");
+                let b_overlay = b.config_file.extension().is_some_and(|e| e == "overlay");
+                b_overlay.cmp(&a_overlay)
+            })
+        });
+        boards.dedup_by(|a, b| a.name == b.name);
+
         Ok(boards)
     }
 
+    /// Extract the board name from a `boards/<board>.overlay` or `boards/<board>.conf` file.
+    ///
+    /// Zephyr picks these fragments up automatically when building for the matching board,
+    /// so each one is treated as a build target.
+    fn board_name_from_fragment(path: &Path) -> Option<String> {
+        let extension = path.extension()?.to_str()?;
+        if extension != "overlay" && extension != "conf" {
+            return None;
+        }
+
+        let stem = path.file_stem()?.to_str()?;
+        if stem.is_empty() {
+            None
+        } else {
+            Some(stem.to_string())
+        }
+    }
+
     fn board_to_target(&self, board_name: &str) -> String {
         // Map Zephyr board names to ESP32 targets
         if board_name.contains("esp32s3") {
@@ -457,13 +539,13 @@ impl ZephyrHandler {
 
     fn find_build_artifacts(
         &self,
-        project_dir: &Path,
-        _board_config: &ProjectBoardConfig,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
     ) -> Result<Vec<BuildArtifact>> {
         let mut artifacts = Vec::new();
 
-        // Zephyr build artifacts are in build/zephyr/
-        let build_dir = project_dir.join("build").join("zephyr");
+        // Zephyr build artifacts are in <board build dir>/zephyr/
+        let build_dir = board_config.build_dir.join("zephyr");
 
         if !build_dir.exists() {
             return Err(anyhow::anyhow!(
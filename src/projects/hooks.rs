@@ -0,0 +1,383 @@
+//! Per-board pre-build and post-build hooks from `espbrew.yaml`
+
+use anyhow::{Context, Result};
+use std::path::Path;
+use tokio::io::{AsyncBufReadExt, BufReader};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::ProjectConfig;
+use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
+use crate::projects::command_templates::{TemplateStep, build_with_template, command_template};
+use crate::projects::container_build::board_container;
+use crate::projects::flash_encryption::write_encrypted_images;
+use crate::projects::merged_binary::{merged_binary_enabled, write_merged_binary};
+use crate::projects::retry::{RetryStep, with_retries};
+use crate::projects::signing::sign_build;
+use crate::projects::toolchain_check::verify_toolchain;
+use crate::projects::uf2::{uf2_enabled, write_uf2};
+use crate::projects::{ProjectHandler, ProjectType};
+use crate::utils::process_group;
+
+/// Point in the build a hook runs at
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum HookStage {
+    PreBuild,
+    PostBuild,
+}
+
+impl HookStage {
+    /// Name used in `espbrew.yaml` and exposed as `ESPBREW_HOOK`
+    pub fn name(&self) -> &'static str {
+        match self {
+            HookStage::PreBuild => "pre_build",
+            HookStage::PostBuild => "post_build",
+        }
+    }
+}
+
+/// Build a board, running its configured hooks before and after the build.
+///
+/// The toolchain is checked against the pins in `espbrew.yaml` first, unless
+/// the board builds in a container that brings its own. A failing pre-build
+/// hook aborts the build; post-build hooks only run after a successful build
+/// and their failure fails the build as well. Hooks always run on the host,
+/// and only the build itself is retried by the build retry policy. A build
+/// template from `espbrew.yaml` replaces the handler's build. ESP-IDF images
+/// are signed when the project configures signing and pre-encrypted for
+/// release-mode flash encryption, and the boards also get their merged image
+/// when `build: merged_binary` is set; boards with `uf2: true` get their UF2
+/// image.
+pub async fn build_board_with_hooks(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<BuildArtifact>> {
+    let container = board_container(project_dir, &board_config.name);
+    let toolchain = match &container {
+        Some(_) => Ok(None),
+        None => verify_toolchain(project_dir, board_config).await,
+    };
+    match toolchain {
+        Ok(Some(toolchain)) => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("📌 Using {}", toolchain),
+            ));
+        }
+        Ok(None) => {}
+        Err(e) => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("❌ {:#}", e),
+            ));
+            return Err(e);
+        }
+    }
+
+    run_hooks(
+        HookStage::PreBuild,
+        project_dir,
+        board_config,
+        &[],
+        tx.clone(),
+    )
+    .await?;
+
+    let container = container.as_ref();
+    let template = command_template(project_dir, board_config, TemplateStep::Build)?;
+    let template = template.as_deref();
+    let build_tx = tx.clone();
+    let mut artifacts = with_retries(
+        RetryStep::Build,
+        RetryStep::Build.policy(project_dir),
+        &board_config.name,
+        &tx,
+        move || {
+            let build_tx = build_tx.clone();
+            async move {
+                match (template, container) {
+                    (Some(template), container) => {
+                        build_with_template(
+                            template,
+                            project_dir,
+                            board_config,
+                            container,
+                            build_tx,
+                        )
+                        .await
+                    }
+                    (None, Some(container)) => {
+                        handler
+                            .build_board_in_container(
+                                project_dir,
+                                board_config,
+                                container,
+                                build_tx,
+                            )
+                            .await
+                    }
+                    (None, None) => {
+                        handler
+                            .build_board(project_dir, board_config, build_tx)
+                            .await
+                    }
+                }
+            }
+        },
+    )
+    .await?;
+
+    if board_config.project_type == ProjectType::EspIdf {
+        sign_build(project_dir, board_config, &tx).await?;
+        write_encrypted_images(project_dir, board_config, &tx).await?;
+    }
+    if board_config.project_type == ProjectType::EspIdf && merged_binary_enabled(project_dir) {
+        artifacts.push(write_merged_binary(project_dir, board_config, &tx).await?);
+    }
+    if uf2_enabled(project_dir, &board_config.name) {
+        let uf2 = write_uf2(project_dir, board_config, &artifacts, &tx)?;
+        artifacts.push(uf2);
+    }
+
+    run_hooks(
+        HookStage::PostBuild,
+        project_dir,
+        board_config,
+        &artifacts,
+        tx,
+    )
+    .await?;
+
+    Ok(artifacts)
+}
+
+/// Commands configured for a board and stage
+pub fn board_hook_commands(
+    project_dir: &Path,
+    board_name: &str,
+    stage: HookStage,
+) -> Result<Vec<String>> {
+    let Some(config) = ProjectConfig::load(project_dir)? else {
+        return Ok(Vec::new());
+    };
+    let Some(hooks) = config.board_hooks(board_name) else {
+        return Ok(Vec::new());
+    };
+
+    let commands = match stage {
+        HookStage::PreBuild => hooks.pre_build.as_ref(),
+        HookStage::PostBuild => hooks.post_build.as_ref(),
+    };
+    Ok(commands.map(|c| c.commands().to_vec()).unwrap_or_default())
+}
+
+/// Environment variables describing the board, exposed to every hook
+pub fn hook_env(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    stage: HookStage,
+    artifacts: &[BuildArtifact],
+) -> Vec<(String, String)> {
+    let mut env = vec![
+        ("ESPBREW_HOOK".to_string(), stage.name().to_string()),
+        ("ESPBREW_BOARD".to_string(), board_config.name.clone()),
+        (
+            "ESPBREW_TARGET".to_string(),
+            board_config.target.clone().unwrap_or_default(),
+        ),
+        (
+            "ESPBREW_PROJECT_DIR".to_string(),
+            project_dir.display().to_string(),
+        ),
+        (
+            "ESPBREW_PROJECT_TYPE".to_string(),
+            board_config.project_type.name().to_string(),
+        ),
+        (
+            "ESPBREW_CONFIG_FILE".to_string(),
+            board_config.config_file.display().to_string(),
+        ),
+        (
+            "ESPBREW_BUILD_DIR".to_string(),
+            board_config.build_dir.display().to_string(),
+        ),
+    ];
+
+    if stage == HookStage::PostBuild {
+        let paths = std::env::join_paths(artifacts.iter().map(|a| &a.file_path))
+            .map(|p| p.to_string_lossy().to_string())
+            .unwrap_or_default();
+        env.push(("ESPBREW_ARTIFACTS".to_string(), paths));
+    }
+
+    env
+}
+
+/// Run the hooks of a stage from the project root, streaming output to the board's log
+pub async fn run_hooks(
+    stage: HookStage,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    artifacts: &[BuildArtifact],
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let commands = board_hook_commands(project_dir, &board_config.name, stage)?;
+    if commands.is_empty() {
+        return Ok(());
+    }
+
+    let env = hook_env(project_dir, board_config, stage, artifacts);
+
+    for command in &commands {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("🪝 Running {} hook: {}", stage.name(), command),
+        ));
+
+        let status = run_shell_command(project_dir, command, &env, &board_config.name, &tx)
+            .await
+            .with_context(|| format!("Failed to run {} hook: {}", stage.name(), command))?;
+
+        if !status.success() {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("❌ {} hook failed: {}", stage.name(), command),
+            ));
+            return Err(anyhow::anyhow!(
+                "{} hook '{}' failed with {}",
+                stage.name(),
+                command,
+                status
+            ));
+        }
+    }
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!("✅ {} hooks completed", stage.name()),
+    ));
+
+    Ok(())
+}
+
+/// Run a command line in the platform's shell from `working_dir`, streaming
+/// its output to the board's log
+pub async fn run_shell_command(
+    working_dir: &Path,
+    command: &str,
+    env: &[(String, String)],
+    board_name: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<std::process::ExitStatus> {
+    let mut cmd = if cfg!(windows) {
+        let mut cmd = Command::new("cmd");
+        cmd.args(["/C", command]);
+        cmd
+    } else {
+        let mut cmd = Command::new("sh");
+        cmd.args(["-c", command]);
+        cmd
+    };
+    cmd.current_dir(working_dir)
+        .envs(env.iter().map(|(k, v)| (k.as_str(), v.as_str())))
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped());
+
+    let mut child = process_group::spawn(&mut cmd).context("Failed to start the shell")?;
+    let stdout = child.stdout.take().unwrap();
+    let stderr = child.stderr.take().unwrap();
+
+    let tx_stdout = tx.clone();
+    let tx_stderr = tx.clone();
+    let board_name_stdout = board_name.to_string();
+    let board_name_stderr = board_name.to_string();
+
+    let stdout_task = tokio::spawn(async move {
+        let mut lines = BufReader::new(stdout).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+        }
+    });
+    let stderr_task = tokio::spawn(async move {
+        let mut lines = BufReader::new(stderr).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+        }
+    });
+
+    let status = child.wait().await.context("Failed to wait for the shell")?;
+    let _ = stdout_task.await;
+    let _ = stderr_task.await;
+    Ok(status)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[cfg(unix)]
+    #[tokio::test]
+    async fn test_board_build_hooks() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r##"boards:
+  esp32s3:
+    hooks:
+      pre_build: echo "#define BOARD \"$ESPBREW_BOARD\"" > board.h
+      post_build:
+        - echo "$ESPBREW_HOOK $ESPBREW_TARGET"
+        - exit 3
+"##,
+        )
+        .unwrap();
+
+        assert_eq!(
+            board_hook_commands(project, "esp32s3", HookStage::PostBuild)
+                .unwrap()
+                .len(),
+            2
+        );
+        assert!(
+            board_hook_commands(project, "esp32c3", HookStage::PreBuild)
+                .unwrap()
+                .is_empty()
+        );
+
+        let board = ProjectBoardConfig {
+            name: "esp32s3".to_string(),
+            config_file: project.join("sdkconfig.defaults.esp32s3"),
+            build_dir: project.join("build.esp32s3"),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+
+        run_hooks(HookStage::PreBuild, project, &board, &[], tx.clone())
+            .await
+            .unwrap();
+        assert_eq!(
+            fs::read_to_string(project.join("board.h")).unwrap().trim(),
+            "#define BOARD \"esp32s3\""
+        );
+
+        // The failing second post-build command fails the stage
+        assert!(
+            run_hooks(HookStage::PostBuild, project, &board, &[], tx)
+                .await
+                .is_err()
+        );
+
+        let mut lines = Vec::new();
+        while let Ok(AppEvent::BuildOutput(name, line)) = rx.try_recv() {
+            assert_eq!(name, "esp32s3");
+            lines.push(line);
+        }
+        assert!(lines.iter().any(|l| l == "post_build esp32s3"));
+    }
+}
@@ -0,0 +1,455 @@
+//! Incremental builds: boards whose inputs haven't changed aren't rebuilt
+//!
+//! The inputs of a board are the project sources, its board config and the
+//! identity of the toolchain. After a successful build their hash and the
+//! artifacts are recorded in `.espbrew/inputs/<board>.json`; the next build of
+//! the board is skipped while the hash matches and the artifacts still exist.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::Toolchain;
+use crate::config::sdkconfig_fragments::fragment_chain;
+use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
+use crate::projects::ProjectHandler;
+use crate::projects::build_history::record_build;
+use crate::projects::container_build::board_container;
+use crate::projects::hooks::build_board_with_hooks;
+use crate::projects::lockfile::BUILD_LOCK_FILE;
+use crate::projects::toolchain_check::active_version;
+use crate::utils::firmware_size::{enforce_memory_limits, record_build_size};
+
+/// Directory of the build records, relative to the project
+pub const BUILD_RECORDS_DIR: &str = ".espbrew/inputs";
+
+/// Directories that hold build output, caches or history rather than sources
+const IGNORED_DIRS: &[&str] = &[
+    ".git",
+    ".espbrew",
+    ".pio",
+    ".vscode",
+    ".idea",
+    ".cache",
+    "target",
+    "managed_components",
+    "node_modules",
+    "logs",
+    "support",
+];
+/// Files written by builds in the project root
+const IGNORED_FILES: &[&str] = &["sdkconfig", "sdkconfig.old", BUILD_LOCK_FILE];
+
+/// Inputs and artifacts of the last successful build of a board
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct BuildRecord {
+    pub inputs: String,
+    pub artifacts: Vec<BuildArtifact>,
+}
+
+impl BuildRecord {
+    /// `.espbrew/inputs/<board>.json` of a project
+    pub fn path(project_dir: &Path, board_name: &str) -> PathBuf {
+        let file_name = board_name.replace(['/', '\\', ':'], "_");
+        project_dir
+            .join(BUILD_RECORDS_DIR)
+            .join(format!("{}.json", file_name))
+    }
+
+    pub fn load(project_dir: &Path, board_name: &str) -> Option<Self> {
+        let content = std::fs::read_to_string(Self::path(project_dir, board_name)).ok()?;
+        serde_json::from_str(&content).ok()
+    }
+
+    pub fn save(&self, project_dir: &Path, board_name: &str) -> Result<()> {
+        let path = Self::path(project_dir, board_name);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        std::fs::write(&path, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("Failed to write {}", path.display()))
+    }
+
+    /// Whether the recorded artifacts are still on disk
+    pub fn artifacts_exist(&self) -> bool {
+        !self.artifacts.is_empty() && self.artifacts.iter().all(|a| a.file_path.exists())
+    }
+}
+
+/// Result of an incremental board build
+#[derive(Debug, Clone)]
+pub struct BuildOutcome {
+    pub artifacts: Vec<BuildArtifact>,
+    /// The inputs matched the last successful build, nothing was built
+    pub up_to_date: bool,
+}
+
+/// 64-bit FNV-1a, stable across runs and Rust versions unlike `DefaultHasher`
+struct InputHasher(u64);
+
+impl InputHasher {
+    fn new() -> Self {
+        InputHasher(0xcbf2_9ce4_8422_2325)
+    }
+
+    fn update(&mut self, bytes: &[u8]) {
+        for byte in bytes {
+            self.0 ^= u64::from(*byte);
+            self.0 = self.0.wrapping_mul(0x0000_0100_0000_01b3);
+        }
+        // Separate fields so that ("ab", "c") and ("a", "bc") differ
+        self.0 ^= 0xff;
+        self.0 = self.0.wrapping_mul(0x0000_0100_0000_01b3);
+    }
+
+    fn finish(&self) -> String {
+        format!("{:016x}", self.0)
+    }
+}
+
+/// Hash of everything a board build depends on.
+///
+/// `other_configs` are the config files of the project's other boards; they
+/// are left out unless the board's config extends them, so editing one board
+/// doesn't invalidate the rest.
+pub async fn input_hash(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    other_configs: &[PathBuf],
+) -> Result<String> {
+    let mut hasher = InputHasher::new();
+    hasher.update(env!("CARGO_PKG_VERSION").as_bytes());
+    hasher.update(board_config.name.as_bytes());
+    hasher.update(
+        board_config
+            .target
+            .as_deref()
+            .unwrap_or_default()
+            .as_bytes(),
+    );
+
+    // Container builds bring their toolchain with the image
+    let container = board_container(project_dir, &board_config.name);
+    let toolchain = match (
+        container,
+        Toolchain::for_project_type(&board_config.project_type),
+    ) {
+        (Some(container), _) => format!("container {}", container.image),
+        (None, Some(toolchain)) => active_version(toolchain, project_dir, false)
+            .await
+            .map(|version| format!("{} {}", toolchain.name(), version))
+            .unwrap_or_else(|_| format!("{} unknown", toolchain.name())),
+        (None, None) => board_config.project_type.name().to_string(),
+    };
+    hasher.update(toolchain.as_bytes());
+
+    let own_chain = fragment_chain(&board_config.config_file).unwrap_or_default();
+    let excluded: Vec<&PathBuf> = other_configs
+        .iter()
+        .filter(|config| **config != board_config.config_file && !own_chain.contains(config))
+        .collect();
+
+    let mut files = Vec::new();
+    collect_source_files(project_dir, project_dir, &excluded, &mut files)?;
+    if !board_config.config_file.starts_with(project_dir) {
+        files.push(board_config.config_file.clone());
+    }
+
+    for file in files {
+        let content =
+            std::fs::read(&file).with_context(|| format!("Failed to read {}", file.display()))?;
+        let relative = file.strip_prefix(project_dir).unwrap_or(&file);
+        hasher.update(relative.to_string_lossy().as_bytes());
+        hasher.update(&content);
+    }
+
+    Ok(hasher.finish())
+}
+
+/// Source files of a project in a stable order, without build output and caches
+pub fn source_files(project_dir: &Path) -> Result<Vec<PathBuf>> {
+    let mut files = Vec::new();
+    collect_source_files(project_dir, project_dir, &[], &mut files)?;
+    Ok(files)
+}
+
+/// Whether a path below the project is a source by the rules of
+/// [`source_files`]; the path doesn't have to exist, e.g. for a deleted file
+pub fn is_source_path(project_dir: &Path, path: &Path) -> bool {
+    let Ok(relative) = path.strip_prefix(project_dir) else {
+        return false;
+    };
+    let names: Vec<String> = relative
+        .components()
+        .map(|c| c.as_os_str().to_string_lossy().to_string())
+        .collect();
+    let Some((last, dirs)) = names.split_last() else {
+        return false;
+    };
+
+    let ignored_dir =
+        |name: &String| IGNORED_DIRS.contains(&name.as_str()) || name.starts_with("build");
+    if dirs.iter().any(ignored_dir) {
+        return false;
+    }
+    if path.is_dir() {
+        return !ignored_dir(last);
+    }
+    !(dirs.is_empty() && IGNORED_FILES.contains(&last.as_str()))
+}
+
+/// Source files below `dir` in a stable order
+fn collect_source_files(
+    project_dir: &Path,
+    dir: &Path,
+    excluded: &[&PathBuf],
+    files: &mut Vec<PathBuf>,
+) -> Result<()> {
+    let mut entries: Vec<PathBuf> = std::fs::read_dir(dir)
+        .with_context(|| format!("Failed to read {}", dir.display()))?
+        .flatten()
+        .map(|entry| entry.path())
+        .collect();
+    entries.sort();
+
+    for path in entries {
+        let name = path
+            .file_name()
+            .map(|n| n.to_string_lossy().to_string())
+            .unwrap_or_default();
+        if path.is_dir() {
+            // `build`, `build.box`, `build-esp32s3`, ...
+            if IGNORED_DIRS.contains(&name.as_str()) || name.starts_with("build") {
+                continue;
+            }
+            collect_source_files(project_dir, &path, excluded, files)?;
+        } else if path.is_file() {
+            let root_output = dir == project_dir && IGNORED_FILES.contains(&name.as_str());
+            if !root_output && !excluded.contains(&&path) {
+                files.push(path);
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Build a board unless `force` is unset and its inputs match its last
+/// successful build. Successful builds record their inputs for the next run.
+pub async fn build_board_incremental(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    other_configs: &[PathBuf],
+    force: bool,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<BuildOutcome> {
+    let inputs = input_hash(project_dir, board_config, other_configs).await;
+
+    if !force
+        && let Ok(inputs) = &inputs
+        && let Some(record) = BuildRecord::load(project_dir, &board_config.name)
+        && record.inputs == *inputs
+        && record.artifacts_exist()
+    {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            "⏭️  Inputs unchanged since the last successful build, skipping".to_string(),
+        ));
+        return Ok(BuildOutcome {
+            artifacts: record.artifacts,
+            up_to_date: true,
+        });
+    }
+
+    let artifacts = build_board_checked(handler, project_dir, board_config, tx.clone()).await?;
+
+    match inputs {
+        Ok(inputs) => {
+            let record = BuildRecord {
+                inputs,
+                artifacts: artifacts.clone(),
+            };
+            if let Err(e) = record.save(project_dir, &board_config.name) {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!("⚠️  Unable to record the build inputs: {}", e),
+                ));
+            }
+        }
+        Err(e) => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("⚠️  Unable to hash the build inputs: {}", e),
+            ));
+        }
+    }
+
+    Ok(BuildOutcome {
+        artifacts,
+        up_to_date: false,
+    })
+}
+
+/// Build a board with its hooks, the way every local build goes: the firmware
+/// size is recorded and held against the board's memory limits, and the
+/// build goes into the history. The build replaces the output the board's
+/// build record describes, so the record goes first; a build over budget
+/// thus leaves none, and the next incremental build doesn't skip it.
+pub async fn build_board_checked(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<BuildArtifact>> {
+    let _ = std::fs::remove_file(BuildRecord::path(project_dir, &board_config.name));
+    let started = std::time::Instant::now();
+    let artifacts =
+        match build_board_with_hooks(handler, project_dir, board_config, tx.clone()).await {
+            Ok(artifacts) => artifacts,
+            Err(e) => {
+                let _ = record_build(
+                    project_dir,
+                    &board_config.name,
+                    started.elapsed(),
+                    false,
+                    None,
+                )
+                .await;
+                return Err(e);
+            }
+        };
+    let duration = started.elapsed();
+
+    let report = match record_build_size(
+        project_dir,
+        &board_config.name,
+        &board_config.build_dir,
+        &artifacts,
+    ) {
+        Ok(Some(report)) => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!(
+                    "{} Size: {}",
+                    if report.grew() { "📈" } else { "📏" },
+                    report.summary()
+                ),
+            ));
+            Some(report)
+        }
+        Ok(None) => None,
+        Err(e) => {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                format!("⚠️  Unable to read the firmware size: {}", e),
+            ));
+            None
+        }
+    };
+    let size = report.as_ref().map(|report| report.size.flash);
+
+    if let Err(e) = enforce_memory_limits(project_dir, &board_config.name, report.as_ref(), &tx) {
+        let _ = record_build(project_dir, &board_config.name, duration, false, size).await;
+        return Err(e);
+    }
+
+    if let Err(e) = record_build(project_dir, &board_config.name, duration, true, size).await {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!("⚠️  Unable to record the build history: {}", e),
+        ));
+    }
+    Ok(artifacts)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::{ArtifactType, ProjectType};
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_incremental_input_hash() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::create_dir_all(project.join("main")).unwrap();
+        fs::create_dir_all(project.join("build.box")).unwrap();
+        fs::write(project.join("main/main.c"), "void app_main(void) {}\n").unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "CONFIG_LOG_DEFAULT_LEVEL_INFO=y\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.c3"),
+            "CONFIG_IDF_TARGET=\"esp32c3\"\n",
+        )
+        .unwrap();
+
+        let board = ProjectBoardConfig {
+            name: "box".to_string(),
+            config_file: project.join("sdkconfig.defaults.box"),
+            build_dir: project.join("build.box"),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::Arduino,
+        };
+        let configs = vec![
+            project.join("sdkconfig.defaults.box"),
+            project.join("sdkconfig.defaults.c3"),
+            project.join("sdkconfig.defaults.common"),
+        ];
+        let hash = || input_hash(project, &board, &configs);
+
+        let initial = hash().await.unwrap();
+        assert_eq!(hash().await.unwrap(), initial);
+
+        // Build output and other boards' configs don't count
+        fs::write(project.join("build.box/app.bin"), [0u8; 16]).unwrap();
+        fs::write(project.join("sdkconfig"), "CONFIG_X=y\n").unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.c3"),
+            "CONFIG_IDF_TARGET=\"esp32c6\"\n",
+        )
+        .unwrap();
+        assert_eq!(hash().await.unwrap(), initial);
+
+        // Inherited fragments and sources do
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "CONFIG_LOG_DEFAULT_LEVEL_DEBUG=y\n",
+        )
+        .unwrap();
+        let inherited = hash().await.unwrap();
+        assert_ne!(inherited, initial);
+        fs::write(
+            project.join("main/main.c"),
+            "void app_main(void) { for (;;) {} }\n",
+        )
+        .unwrap();
+        assert_ne!(hash().await.unwrap(), inherited);
+
+        let record = BuildRecord {
+            inputs: initial.clone(),
+            artifacts: vec![BuildArtifact {
+                name: "app".to_string(),
+                file_path: project.join("build.box/app.bin"),
+                artifact_type: ArtifactType::Binary,
+                offset: Some(0x10000),
+            }],
+        };
+        record.save(project, "box@release").unwrap();
+        let loaded = BuildRecord::load(project, "box@release").unwrap();
+        assert_eq!(loaded.inputs, initial);
+        assert!(loaded.artifacts_exist());
+        fs::remove_file(project.join("build.box/app.bin")).unwrap();
+        assert!(!loaded.artifacts_exist());
+    }
+}
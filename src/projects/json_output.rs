@@ -0,0 +1,233 @@
+//! Machine-readable output of the build and flash commands
+//!
+//! `espbrew --no-tui --output json build` runs the same pipeline as the text
+//! output but writes JSON lines on stdout instead of the boards' progress:
+//! an event when a board starts, for each line it prints and when it
+//! finishes, then a `summary` with every board's status, duration and
+//! artifacts, and for the failed ones the error and an excerpt of what led
+//! to it. The logs stay on stderr, so scripts and other tools read only the
+//! events.
+
+use serde::Serialize;
+use std::collections::{HashMap, VecDeque};
+use std::path::PathBuf;
+use std::time::Duration;
+
+/// Lines of a failed board's output its error excerpt has at most
+pub const ERROR_EXCERPT_LINES: usize = 20;
+
+/// What the build and flash commands write on stdout
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, clap::ValueEnum)]
+pub enum OutputFormat {
+    /// Progress lines for people
+    #[default]
+    Text,
+    /// JSON lines: events as they happen, then a summary
+    Json,
+}
+
+/// How a board came out of the run
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum BoardStatus {
+    Built,
+    /// Skipped, its inputs unchanged since the last build
+    UpToDate,
+    Flashed,
+    Failed,
+}
+
+/// A board's entry of the summary
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct BoardReport {
+    pub name: String,
+    pub status: BoardStatus,
+    pub duration_ms: u64,
+    pub artifacts: Vec<PathBuf>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+    /// The board's compiler errors, or the last lines of its output
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub error_excerpt: Vec<String>,
+}
+
+impl BoardReport {
+    pub fn new(name: &str, status: BoardStatus, duration: Duration) -> Self {
+        Self {
+            name: name.to_string(),
+            status,
+            duration_ms: duration.as_millis() as u64,
+            artifacts: Vec::new(),
+            error: None,
+            error_excerpt: Vec::new(),
+        }
+    }
+
+    pub fn failed(name: &str, duration: Duration, error: &anyhow::Error) -> Self {
+        Self {
+            error: Some(format!("{:#}", error)),
+            ..Self::new(name, BoardStatus::Failed, duration)
+        }
+    }
+}
+
+/// The document a run ends with
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct RunSummary {
+    /// `build` or `flash`
+    pub command: String,
+    pub success: bool,
+    pub duration_ms: u64,
+    pub boards: Vec<BoardReport>,
+}
+
+impl RunSummary {
+    pub fn new(command: &str, boards: Vec<BoardReport>, duration: Duration) -> Self {
+        Self {
+            command: command.to_string(),
+            success: boards.iter().all(|b| b.status != BoardStatus::Failed),
+            duration_ms: duration.as_millis() as u64,
+            boards,
+        }
+    }
+}
+
+/// A line of the output, as JSON with an `event`
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(tag = "event", rename_all = "snake_case")]
+pub enum JsonEvent {
+    BoardStarted {
+        board: String,
+    },
+    Output {
+        board: String,
+        line: String,
+    },
+    FlashProgress {
+        board: String,
+        percent: u8,
+    },
+    BoardFinished {
+        board: String,
+        status: BoardStatus,
+        duration_ms: u64,
+    },
+    Summary(RunSummary),
+}
+
+impl JsonEvent {
+    pub fn finished(board: &str, status: BoardStatus, duration: Duration) -> Self {
+        JsonEvent::BoardFinished {
+            board: board.to_string(),
+            status,
+            duration_ms: duration.as_millis() as u64,
+        }
+    }
+
+    pub fn to_line(&self) -> String {
+        serde_json::to_string(self).unwrap_or_default()
+    }
+}
+
+/// Write the event on stdout, a line of its own
+pub fn emit(event: &JsonEvent) {
+    println!("{}", event.to_line());
+}
+
+/// The last lines of each board's output, for the excerpts of failed boards
+#[derive(Debug, Default)]
+pub struct OutputTails {
+    lines: HashMap<String, VecDeque<String>>,
+}
+
+impl OutputTails {
+    pub fn push(&mut self, board: &str, line: &str) {
+        let tail = self.lines.entry(board.to_string()).or_default();
+        if tail.len() == ERROR_EXCERPT_LINES {
+            tail.pop_front();
+        }
+        tail.push_back(line.to_string());
+    }
+
+    /// What explains the board's failure: the compiler errors it reported
+    /// if there are any, its last lines of output otherwise
+    pub fn excerpt(&self, board: &str, compiler_errors: &[String]) -> Vec<String> {
+        if !compiler_errors.is_empty() {
+            return compiler_errors
+                .iter()
+                .take(ERROR_EXCERPT_LINES)
+                .cloned()
+                .collect();
+        }
+        self.lines
+            .get(board)
+            .map(|tail| tail.iter().cloned().collect())
+            .unwrap_or_default()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_json_output_events() {
+        assert_eq!(
+            JsonEvent::Output {
+                board: "esp32s3".to_string(),
+                line: "[1/2] app.c".to_string(),
+            }
+            .to_line(),
+            r#"{"event":"output","board":"esp32s3","line":"[1/2] app.c"}"#
+        );
+        assert_eq!(
+            JsonEvent::finished(
+                "esp32s3",
+                BoardStatus::UpToDate,
+                Duration::from_millis(1500)
+            )
+            .to_line(),
+            r#"{"event":"board_finished","board":"esp32s3","status":"up_to_date","duration_ms":1500}"#
+        );
+
+        // The tail keeps the last lines only, compiler errors take its place
+        let mut tails = OutputTails::default();
+        for i in 0..ERROR_EXCERPT_LINES + 5 {
+            tails.push("esp32c3", &format!("line {}", i));
+        }
+        let excerpt = tails.excerpt("esp32c3", &[]);
+        assert_eq!(excerpt.len(), ERROR_EXCERPT_LINES);
+        assert_eq!(excerpt[0], "line 5");
+        let errors = vec!["main/app.c:12:5: 'x' undeclared".to_string()];
+        assert_eq!(tails.excerpt("esp32c3", &errors), errors);
+        assert!(tails.excerpt("esp32h2", &[]).is_empty());
+
+        let mut built = BoardReport::new("esp32s3", BoardStatus::Built, Duration::from_secs(2));
+        built.artifacts = vec![PathBuf::from("build/app.bin")];
+        let failed = BoardReport {
+            error_excerpt: errors.clone(),
+            ..BoardReport::failed(
+                "esp32c3",
+                Duration::from_secs(1),
+                &anyhow::anyhow!("Build failed"),
+            )
+        };
+        let summary = RunSummary::new("build", vec![built], Duration::from_secs(3));
+        assert!(summary.success);
+        let document: serde_json::Value =
+            serde_json::from_str(&JsonEvent::Summary(summary).to_line()).unwrap();
+        assert_eq!(document["event"], "summary");
+        assert_eq!(document["command"], "build");
+        assert_eq!(document["duration_ms"], 3000);
+        assert_eq!(document["boards"][0]["artifacts"][0], "build/app.bin");
+        // Boards that succeeded have no error fields
+        assert!(document["boards"][0].get("error").is_none());
+
+        let summary = RunSummary::new("build", vec![failed], Duration::from_secs(3));
+        assert!(!summary.success);
+        let document = serde_json::to_value(&summary).unwrap();
+        assert_eq!(document["boards"][0]["status"], "failed");
+        assert_eq!(document["boards"][0]["error"], "Build failed");
+        assert_eq!(document["boards"][0]["error_excerpt"][0], errors[0]);
+    }
+}
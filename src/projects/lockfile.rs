@@ -0,0 +1,268 @@
+//! `espbrew.lock`: the inputs of the last successful build
+//!
+//! After every successful `espbrew build` the lock records the toolchain
+//! version, the component hashes from `dependencies.lock`, the module sums
+//! from `go.sum` and the commits of the git submodules. `espbrew build
+//! --locked` refuses to build when any of them differs from the lock.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::path::Path;
+use tokio::process::Command;
+
+use crate::config::Toolchain;
+use crate::models::ProjectType;
+use crate::projects::toolchain_check::active_version;
+use crate::utils::idf_components::DEPENDENCIES_LOCK_FILE;
+
+pub const BUILD_LOCK_FILE: &str = "espbrew.lock";
+
+/// Resolved build inputs of a project
+#[derive(Debug, Clone, Default, PartialEq, Serialize, Deserialize)]
+pub struct BuildLock {
+    /// Toolchain name to version, e.g. `ESP-IDF: 5.3.1`
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub toolchains: BTreeMap<String, String>,
+    /// Managed component to its `component_hash` (or version for `idf`)
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub components: BTreeMap<String, String>,
+    /// `module@version` to its `go.sum` hash
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub go_modules: BTreeMap<String, String>,
+    /// Submodule path to its checked out commit
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub submodules: BTreeMap<String, String>,
+}
+
+impl BuildLock {
+    /// The lock of a project, `None` if it has none yet
+    pub fn load(project_dir: &Path) -> Result<Option<Self>> {
+        let path = project_dir.join(BUILD_LOCK_FILE);
+        if !path.exists() {
+            return Ok(None);
+        }
+        let content = std::fs::read_to_string(&path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        let lock = serde_yaml::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", path.display()))?;
+        Ok(Some(lock))
+    }
+
+    pub fn save(&self, project_dir: &Path) -> Result<()> {
+        let path = project_dir.join(BUILD_LOCK_FILE);
+        let content = format!(
+            "# Generated by espbrew build, do not edit\n{}",
+            serde_yaml::to_string(self)?
+        );
+        std::fs::write(&path, content)
+            .with_context(|| format!("Failed to write {}", path.display()))
+    }
+
+    /// Current build inputs of a project
+    pub async fn capture(project_dir: &Path, project_type: &ProjectType) -> Result<Self> {
+        let mut toolchains = BTreeMap::new();
+        if let Some(toolchain) = Toolchain::for_project_type(project_type)
+            && let Ok(version) = active_version(toolchain, project_dir, false).await
+        {
+            toolchains.insert(toolchain.name().to_string(), version);
+        }
+
+        Ok(BuildLock {
+            toolchains,
+            components: component_hashes(project_dir)?,
+            go_modules: go_module_sums(project_dir)?,
+            submodules: submodule_commits(project_dir).await?,
+        })
+    }
+
+    /// Differences of `current` from this lock, one line each
+    pub fn drift(&self, current: &BuildLock) -> Vec<String> {
+        let sections = [
+            ("toolchain", &self.toolchains, &current.toolchains),
+            ("component", &self.components, &current.components),
+            ("Go module", &self.go_modules, &current.go_modules),
+            ("submodule", &self.submodules, &current.submodules),
+        ];
+        let mut lines = Vec::new();
+        for (kind, locked, now) in sections {
+            diff_section(kind, locked, now, &mut lines);
+        }
+        lines
+    }
+}
+
+fn diff_section(
+    kind: &str,
+    locked: &BTreeMap<String, String>,
+    current: &BTreeMap<String, String>,
+    lines: &mut Vec<String>,
+) {
+    for (name, value) in locked {
+        match current.get(name) {
+            Some(now) if now != value => {
+                lines.push(format!("{} {}: {} → {}", kind, name, value, now))
+            }
+            Some(_) => {}
+            None => lines.push(format!("{} {}: {} is gone", kind, name, value)),
+        }
+    }
+    for (name, value) in current {
+        if !locked.contains_key(name) {
+            lines.push(format!("{} {}: {} is not locked", kind, name, value));
+        }
+    }
+}
+
+/// Components resolved in `dependencies.lock`
+fn component_hashes(project_dir: &Path) -> Result<BTreeMap<String, String>> {
+    let path = project_dir.join(DEPENDENCIES_LOCK_FILE);
+    let mut components = BTreeMap::new();
+    if !path.exists() {
+        return Ok(components);
+    }
+
+    let content = std::fs::read_to_string(&path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+    let lock: serde_yaml::Value = serde_yaml::from_str(&content)
+        .with_context(|| format!("Failed to parse {}", path.display()))?;
+    let Some(dependencies) = lock.get("dependencies").and_then(|d| d.as_mapping()) else {
+        return Ok(components);
+    };
+
+    for (name, entry) in dependencies {
+        let Some(name) = name.as_str() else {
+            continue;
+        };
+        let value = entry
+            .get("component_hash")
+            .or_else(|| entry.get("version"))
+            .and_then(|v| v.as_str());
+        if let Some(value) = value {
+            components.insert(name.to_string(), value.to_string());
+        }
+    }
+    Ok(components)
+}
+
+/// Module hashes from `go.sum`; the `/go.mod` only hashes are left out
+fn go_module_sums(project_dir: &Path) -> Result<BTreeMap<String, String>> {
+    let path = project_dir.join("go.sum");
+    let mut modules = BTreeMap::new();
+    if !path.exists() {
+        return Ok(modules);
+    }
+
+    let content = std::fs::read_to_string(&path)
+        .with_context(|| format!("Failed to read {}", path.display()))?;
+    for line in content.lines() {
+        let mut fields = line.split_whitespace();
+        if let (Some(module), Some(version), Some(hash)) =
+            (fields.next(), fields.next(), fields.next())
+            && !version.ends_with("/go.mod")
+        {
+            modules.insert(format!("{}@{}", module, version), hash.to_string());
+        }
+    }
+    Ok(modules)
+}
+
+/// Checked out commits of the project's git submodules
+async fn submodule_commits(project_dir: &Path) -> Result<BTreeMap<String, String>> {
+    let mut submodules = BTreeMap::new();
+    if !project_dir.join(".gitmodules").exists() {
+        return Ok(submodules);
+    }
+
+    let output = Command::new("git")
+        .args(["submodule", "status", "--recursive"])
+        .current_dir(project_dir)
+        .output()
+        .await
+        .context("Failed to run git submodule status")?;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "git submodule status failed: {}",
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+
+    submodules.extend(parse_submodule_status(&String::from_utf8_lossy(
+        &output.stdout,
+    )));
+    Ok(submodules)
+}
+
+/// Submodule commits from `git submodule status` output, e.g.
+/// `+1a2b3c… components/lvgl (v9.1.0)`; the first column marks the state
+pub fn parse_submodule_status(output: &str) -> BTreeMap<String, String> {
+    output
+        .lines()
+        .filter_map(|line| {
+            let line = line.trim_start_matches([' ', '+', '-', 'U']);
+            let mut fields = line.split_whitespace();
+            let commit = fields.next()?;
+            let path = fields.next()?;
+            Some((path.to_string(), commit.to_string()))
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_build_lockfile() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("dependencies.lock"),
+            "dependencies:\n  espressif/led_strip:\n    component_hash: abc123\n    version: 2.5.3\n  idf:\n    version: 5.3.1\nmanifest_hash: ffff\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("go.sum"),
+            "tinygo.org/x/drivers v0.28.0 h1:aaa=\ntinygo.org/x/drivers v0.28.0/go.mod h1:bbb=\n",
+        )
+        .unwrap();
+
+        // Arduino has no pinnable toolchain, so only the files are captured
+        let lock = BuildLock::capture(project, &ProjectType::Arduino)
+            .await
+            .unwrap();
+        assert!(lock.toolchains.is_empty());
+        assert_eq!(lock.components["espressif/led_strip"], "abc123");
+        assert_eq!(lock.components["idf"], "5.3.1");
+        assert_eq!(lock.go_modules.len(), 1);
+        assert_eq!(lock.go_modules["tinygo.org/x/drivers@v0.28.0"], "h1:aaa=");
+        assert!(lock.submodules.is_empty());
+
+        lock.save(project).unwrap();
+        let saved = BuildLock::load(project).unwrap().unwrap();
+        assert_eq!(saved, lock);
+        assert!(saved.drift(&lock).is_empty());
+
+        fs::write(
+            project.join("dependencies.lock"),
+            "dependencies:\n  espressif/led_strip:\n    component_hash: def456\n  espressif/button:\n    component_hash: 999\n",
+        )
+        .unwrap();
+        let current = BuildLock::capture(project, &ProjectType::Arduino)
+            .await
+            .unwrap();
+        let drift = saved.drift(&current);
+        assert_eq!(drift.len(), 3);
+        assert!(drift.contains(&"component espressif/led_strip: abc123 → def456".to_string()));
+        assert!(drift.contains(&"component idf: 5.3.1 is gone".to_string()));
+        assert!(drift.contains(&"component espressif/button: 999 is not locked".to_string()));
+
+        let submodules = parse_submodule_status(
+            " 1a2b3c4d components/lvgl (v9.1.0)\n+5e6f7a8b third_party/mbedtls (heads/main)\n",
+        );
+        assert_eq!(submodules["components/lvgl"], "1a2b3c4d");
+        assert_eq!(submodules["third_party/mbedtls"], "5e6f7a8b");
+    }
+}
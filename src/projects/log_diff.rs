@@ -0,0 +1,221 @@
+//! Comparing the logs of two boards
+//!
+//! **L** in the TUI shows two boards' logs side by side, aligned line by
+//! line so the lines only one of them printed, or printed differently, stand
+//! out: why does the C3 build fail when the S3 build passes. Lines are
+//! compared with the boards' names and ninja's `[12/980]` progress taken
+//! out, since those differ in every line of two builds.
+
+use regex::Regex;
+use std::sync::OnceLock;
+
+/// Most line pairs the logs between their common start and end are aligned
+/// by; longer logs match each line with the next equal one instead
+pub const DIFF_MAX_CELLS: usize = 4_000_000;
+
+/// How the lines of a row compare
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum DiffKind {
+    Same,
+    /// Both logs have a line here, but different ones
+    Changed,
+    LeftOnly,
+    RightOnly,
+}
+
+/// A row of the side-by-side view: the indexes of its lines in the logs
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct DiffRow {
+    pub kind: DiffKind,
+    pub left: Option<usize>,
+    pub right: Option<usize>,
+}
+
+impl DiffRow {
+    fn new(left: Option<usize>, right: Option<usize>, kind: DiffKind) -> Self {
+        Self { kind, left, right }
+    }
+}
+
+fn progress_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| Regex::new(r"^\s*\[\d+/\d+\]\s*").unwrap())
+}
+
+/// The line as it is compared: without the ninja progress, and the boards'
+/// names replaced
+pub fn normalize_line(line: &str, boards: &[&str]) -> String {
+    let mut line = progress_regex().replace(line.trim_end(), "").into_owned();
+    for board in boards.iter().filter(|board| !board.is_empty()) {
+        line = line.replace(board, "<board>");
+    }
+    line
+}
+
+/// Matched line pairs of the logs, by longest common subsequence
+fn common_lines(left: &[String], right: &[String]) -> Vec<(usize, usize)> {
+    let width = right.len() + 1;
+    let mut lengths = vec![0u32; (left.len() + 1) * width];
+    for i in (0..left.len()).rev() {
+        for j in (0..right.len()).rev() {
+            lengths[i * width + j] = if left[i] == right[j] {
+                lengths[(i + 1) * width + j + 1] + 1
+            } else {
+                lengths[(i + 1) * width + j].max(lengths[i * width + j + 1])
+            };
+        }
+    }
+    let (mut i, mut j) = (0, 0);
+    let mut pairs = Vec::new();
+    while i < left.len() && j < right.len() {
+        if left[i] == right[j] {
+            pairs.push((i, j));
+            i += 1;
+            j += 1;
+        } else if lengths[(i + 1) * width + j] >= lengths[i * width + j + 1] {
+            i += 1;
+        } else {
+            j += 1;
+        }
+    }
+    pairs
+}
+
+/// Line pairs of logs too long to align: each line is matched with the
+/// next equal line of the other log, if there is one
+fn matching_lines(left: &[String], right: &[String]) -> Vec<(usize, usize)> {
+    let mut pairs = Vec::new();
+    let mut j = 0;
+    for (i, line) in left.iter().enumerate() {
+        if let Some(offset) = right[j..].iter().position(|other| other == line) {
+            pairs.push((i, j + offset));
+            j += offset + 1;
+        }
+    }
+    pairs
+}
+
+/// Rows between two matched lines: the lines differing pairwise, the rest
+/// on one side only
+fn push_unmatched(
+    rows: &mut Vec<DiffRow>,
+    left: std::ops::Range<usize>,
+    right: std::ops::Range<usize>,
+) {
+    let (left_len, right_len) = (left.len(), right.len());
+    let (mut left, mut right) = (left, right);
+    for _ in 0..left_len.min(right_len) {
+        rows.push(DiffRow::new(left.next(), right.next(), DiffKind::Changed));
+    }
+    rows.extend(left.map(|i| DiffRow::new(Some(i), None, DiffKind::LeftOnly)));
+    rows.extend(right.map(|j| DiffRow::new(None, Some(j), DiffKind::RightOnly)));
+}
+
+/// Rows of the logs side by side; `boards` are the names left out of the
+/// comparison
+pub fn diff_logs(left: &[String], right: &[String], boards: &[&str]) -> Vec<DiffRow> {
+    let left_lines: Vec<String> = left.iter().map(|l| normalize_line(l, boards)).collect();
+    let right_lines: Vec<String> = right.iter().map(|l| normalize_line(l, boards)).collect();
+
+    let prefix = left_lines
+        .iter()
+        .zip(&right_lines)
+        .take_while(|(l, r)| l == r)
+        .count();
+    let suffix = left_lines[prefix..]
+        .iter()
+        .rev()
+        .zip(right_lines[prefix..].iter().rev())
+        .take_while(|(l, r)| l == r)
+        .count();
+    let left_middle = &left_lines[prefix..left_lines.len() - suffix];
+    let right_middle = &right_lines[prefix..right_lines.len() - suffix];
+    let pairs = if (left_middle.len() + 1) * (right_middle.len() + 1) <= DIFF_MAX_CELLS {
+        common_lines(left_middle, right_middle)
+    } else {
+        matching_lines(left_middle, right_middle)
+    };
+
+    let mut rows: Vec<DiffRow> = (0..prefix)
+        .map(|i| DiffRow::new(Some(i), Some(i), DiffKind::Same))
+        .collect();
+    let (mut i, mut j) = (prefix, prefix);
+    for (l, r) in pairs {
+        let (l, r) = (l + prefix, r + prefix);
+        push_unmatched(&mut rows, i..l, j..r);
+        rows.push(DiffRow::new(Some(l), Some(r), DiffKind::Same));
+        i = l + 1;
+        j = r + 1;
+    }
+    push_unmatched(&mut rows, i..left.len() - suffix, j..right.len() - suffix);
+    rows.extend((0..suffix).map(|k| {
+        DiffRow::new(
+            Some(left.len() - suffix + k),
+            Some(right.len() - suffix + k),
+            DiffKind::Same,
+        )
+    }));
+    rows
+}
+
+/// Indexes of the rows that differ
+pub fn differing_rows(rows: &[DiffRow]) -> Vec<usize> {
+    rows.iter()
+        .enumerate()
+        .filter(|(_, row)| row.kind != DiffKind::Same)
+        .map(|(index, _)| index)
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_log_comparison() {
+        let boards = ["esp32s3", "esp32c3"];
+        assert_eq!(
+            normalize_line(
+                "[12/980] Building C object build.esp32c3/main.c.obj",
+                &boards
+            ),
+            "Building C object build.<board>/main.c.obj"
+        );
+
+        let lines = |text: &str| text.lines().map(str::to_string).collect::<Vec<_>>();
+        let passing = lines(
+            "Executing build for esp32s3\n[1/4] Compiling main.c\n[2/4] Compiling app.c\n[3/4] Linking\n[4/4] Generating binary\nBuild complete",
+        );
+        let failing = lines(
+            "Executing build for esp32c3\n[1/4] Compiling main.c\nmain.c:12: error: 'GPIO_NUM_48' undeclared\n[2/4] Compiling app.c\n[3/4] Linking failed\nBuild complete",
+        );
+        let rows = diff_logs(&passing, &failing, &boards);
+        let kinds: Vec<DiffKind> = rows.iter().map(|row| row.kind).collect();
+        assert_eq!(
+            kinds,
+            [
+                DiffKind::Same,
+                DiffKind::Same,
+                DiffKind::RightOnly,
+                DiffKind::Same,
+                DiffKind::Changed,
+                DiffKind::LeftOnly,
+                DiffKind::Same,
+            ]
+        );
+        // The error only the failing board printed lines up against nothing
+        assert_eq!(rows[2].left, None);
+        assert_eq!(rows[2].right, Some(2));
+        assert_eq!((rows[3].left, rows[3].right), (Some(2), Some(3)));
+        assert_eq!((rows[6].left, rows[6].right), (Some(5), Some(5)));
+        assert_eq!(differing_rows(&rows), [2, 4, 5]);
+
+        // Identical logs line up row by row
+        let rows = diff_logs(&passing, &passing, &boards);
+        assert!(rows.iter().all(|row| row.kind == DiffKind::Same));
+        assert_eq!(rows.len(), passing.len());
+
+        let rows = diff_logs(&passing, &[], &boards);
+        assert!(rows.iter().all(|row| row.kind == DiffKind::LeftOnly));
+    }
+}
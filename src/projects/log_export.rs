@@ -0,0 +1,194 @@
+//! Monitor output as JSON lines
+//!
+//! `espbrew monitor --jsonl <file>` writes every line a device prints as a
+//! JSON object: the host's `timestamp`, the `level`, device `uptime_ms` and
+//! `tag` of ESP-IDF's log format, the `message`, and the `device` and `board`
+//! it came from, so sessions can be shipped to Loki or Elasticsearch or
+//! queried with jq. Lines that aren't ESP-IDF log lines, e.g. a panic or
+//! `printf`, have no level and tag. With `-` the objects go to stdout instead
+//! of the text.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use serde::Serialize;
+use std::fs::File;
+use std::io::{BufWriter, Write};
+use std::path::Path;
+
+use crate::models::board::{IdfLogLevel, idf_log_line};
+
+/// Path writing the JSON lines to stdout
+pub const STDOUT_PATH: &str = "-";
+
+/// One line of a device's output with its parsed fields
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct LogRecord {
+    /// Host time the line arrived, RFC 3339 with milliseconds
+    pub timestamp: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub level: Option<&'static str>,
+    /// Milliseconds since the device booted, of `I (312) tag: ...`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub uptime_ms: Option<u64>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub tag: Option<String>,
+    pub message: String,
+    pub device: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub board: Option<String>,
+}
+
+/// Name of the level in the records, e.g. `warn`
+pub fn level_name(level: IdfLogLevel) -> &'static str {
+    match level {
+        IdfLogLevel::Error => "error",
+        IdfLogLevel::Warning => "warn",
+        IdfLogLevel::Info => "info",
+        IdfLogLevel::Debug => "debug",
+        IdfLogLevel::Verbose => "verbose",
+    }
+}
+
+/// The line that arrived at `time` from the board's device, its ESP-IDF
+/// fields parsed
+pub fn log_record(
+    line: &str,
+    time: DateTime<Local>,
+    device: &str,
+    board: Option<&str>,
+) -> LogRecord {
+    let line = line.trim_end();
+    // `idf_log_line` checked the line starts with the level's letter
+    let fields = idf_log_line(line).and_then(|(level, tag)| {
+        let (uptime, rest) = line[1..].strip_prefix(" (")?.split_once(") ")?;
+        let message = rest[tag.len()..].strip_prefix(':')?.trim_start();
+        Some((level, uptime.parse().ok(), tag, message))
+    });
+    let (level, uptime_ms, tag, message) = match fields {
+        Some((level, uptime, tag, message)) => (
+            Some(level_name(level)),
+            uptime,
+            Some(tag.to_string()),
+            message,
+        ),
+        None => (None, None, None, line),
+    };
+    LogRecord {
+        timestamp: time.to_rfc3339_opts(chrono::SecondsFormat::Millis, false),
+        level,
+        uptime_ms,
+        tag,
+        message: message.to_string(),
+        device: device.to_string(),
+        board: board.map(str::to_string),
+    }
+}
+
+/// Export of one device's session as JSON lines
+pub struct JsonlExport {
+    out: Box<dyn Write + Send>,
+    to_stdout: bool,
+    device: String,
+    board: Option<String>,
+}
+
+impl JsonlExport {
+    /// Export the session of the board's device to `path`, or stdout for `-`
+    pub fn create(path: &Path, device: &str, board: Option<&str>) -> Result<Self> {
+        let to_stdout = path.as_os_str() == STDOUT_PATH;
+        let out: Box<dyn Write + Send> = if to_stdout {
+            Box::new(std::io::stdout())
+        } else {
+            if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+                std::fs::create_dir_all(parent)
+                    .with_context(|| format!("Failed to create {}", parent.display()))?;
+            }
+            let file = File::create(path)
+                .with_context(|| format!("Failed to create {}", path.display()))?;
+            Box::new(BufWriter::new(file))
+        };
+        Ok(Self {
+            out,
+            to_stdout,
+            device: device.to_string(),
+            board: board.map(str::to_string),
+        })
+    }
+
+    /// Whether the records replace the text on stdout
+    pub fn to_stdout(&self) -> bool {
+        self.to_stdout
+    }
+
+    /// Write the line as a record, flushed so tailing tools see it at once
+    pub fn write(&mut self, line: &str) -> Result<()> {
+        let record = log_record(line, Local::now(), &self.device, self.board.as_deref());
+        serde_json::to_writer(&mut self.out, &record)?;
+        self.out.write_all(b"\n")?;
+        self.out.flush().context("Failed to write the JSON lines")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_jsonl_log_export() {
+        let time = chrono::Local::now();
+        let record = log_record(
+            "W (1432) wifi: Disconnected, reason 201\r",
+            time,
+            "/dev/ttyACM0",
+            Some("esp32s3"),
+        );
+        assert_eq!(record.level, Some("warn"));
+        assert_eq!(record.uptime_ms, Some(1432));
+        assert_eq!(record.tag.as_deref(), Some("wifi"));
+        assert_eq!(record.message, "Disconnected, reason 201");
+        assert_eq!(record.board.as_deref(), Some("esp32s3"));
+
+        let record = log_record(
+            "Guru Meditation Error: Core  0 panic'ed (LoadProhibited).",
+            time,
+            "/dev/ttyACM0",
+            None,
+        );
+        assert_eq!(record.level, None);
+        assert_eq!(record.tag, None);
+        assert_eq!(
+            record.message,
+            "Guru Meditation Error: Core  0 panic'ed (LoadProhibited)."
+        );
+
+        // Log timestamps of system time have no uptime
+        let record = log_record("I (10:15:12.345) app: ready", time, "/dev/ttyACM0", None);
+        assert_eq!(record.uptime_ms, None);
+        assert_eq!(record.message, "ready");
+
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("logs/session.jsonl");
+        let mut export = JsonlExport::create(&path, "/dev/ttyUSB0", Some("esp32")).unwrap();
+        assert!(!export.to_stdout());
+        export
+            .write("E (87) boot: Factory app partition is not bootable")
+            .unwrap();
+        export.write("rst:0x1 (POWERON_RESET)").unwrap();
+        drop(export);
+
+        let text = fs::read_to_string(&path).unwrap();
+        let records: Vec<serde_json::Value> = text
+            .lines()
+            .map(|line| serde_json::from_str(line).unwrap())
+            .collect();
+        assert_eq!(records.len(), 2);
+        assert_eq!(records[0]["level"], "error");
+        assert_eq!(records[0]["tag"], "boot");
+        assert_eq!(records[0]["device"], "/dev/ttyUSB0");
+        assert_eq!(records[0]["board"], "esp32");
+        assert!(records[1].get("level").is_none());
+        assert_eq!(records[1]["message"], "rst:0x1 (POWERON_RESET)");
+    }
+}
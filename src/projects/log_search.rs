@@ -0,0 +1,259 @@
+//! Searching the boards' logs
+//!
+//! `/` in the TUI searches the focused board's log, `n` and `N` going from
+//! match to match, and `espbrew logs search <regex>` greps the logs of past
+//! sessions: the build logs in `logs/` and in the build directories, and the
+//! serial monitor recordings, trigger logs and JSON lines below `logs/`.
+
+use anyhow::{Context, Result};
+use regex::{Regex, RegexBuilder};
+use std::io::{BufRead, BufReader};
+use std::path::{Path, PathBuf};
+
+use crate::projects::monitor_log::MONITOR_LOGS_DIR;
+
+/// Extensions of the files searched
+const LOG_EXTENSIONS: &[&str] = &["log", "jsonl"];
+
+/// Indexes of the lines matching the regex
+pub fn matching_lines(lines: &[String], regex: &Regex) -> Vec<usize> {
+    lines
+        .iter()
+        .enumerate()
+        .filter(|(_, line)| regex.is_match(line))
+        .map(|(index, _)| index)
+        .collect()
+}
+
+/// A search of the focused board's log
+#[derive(Debug, Clone)]
+pub struct LogSearch {
+    /// The pattern as typed
+    pub pattern: String,
+    pub regex: Regex,
+    /// Log line of the current match
+    pub current: Option<usize>,
+}
+
+impl LogSearch {
+    /// Search for the pattern, ignoring case unless it has an upper case
+    /// letter
+    pub fn new(pattern: &str) -> Result<Self> {
+        let regex = RegexBuilder::new(pattern)
+            .case_insensitive(!pattern.chars().any(char::is_uppercase))
+            .build()
+            .with_context(|| format!("Invalid search regex '{}'", pattern))?;
+        Ok(Self {
+            pattern: pattern.to_string(),
+            regex,
+            current: None,
+        })
+    }
+
+    /// Move to the match after the current one, or the first; wraps around
+    pub fn next(&mut self, lines: &[String]) -> Option<usize> {
+        let matches = matching_lines(lines, &self.regex);
+        self.current = matches
+            .iter()
+            .find(|line| self.current.is_none_or(|current| **line > current))
+            .or(matches.first())
+            .copied();
+        self.current
+    }
+
+    /// Move to the match before the current one, or the last; wraps around
+    pub fn previous(&mut self, lines: &[String]) -> Option<usize> {
+        let matches = matching_lines(lines, &self.regex);
+        self.current = matches
+            .iter()
+            .rev()
+            .find(|line| self.current.is_none_or(|current| **line < current))
+            .or(matches.last())
+            .copied();
+        self.current
+    }
+
+    /// e.g. `3/12`, or `0/12` before moving to a match
+    pub fn position(&self, lines: &[String]) -> String {
+        let matches = matching_lines(lines, &self.regex);
+        let index = self
+            .current
+            .and_then(|current| matches.iter().position(|line| *line == current))
+            .map_or(0, |index| index + 1);
+        format!("{}/{}", index, matches.len())
+    }
+}
+
+fn is_log_file(path: &Path) -> bool {
+    path.is_file()
+        && path
+            .extension()
+            .is_some_and(|ext| LOG_EXTENSIONS.iter().any(|log| ext == *log))
+}
+
+fn collect_logs(dir: &Path, files: &mut Vec<PathBuf>) {
+    let Ok(entries) = std::fs::read_dir(dir) else {
+        return;
+    };
+    for path in entries.flatten().map(|entry| entry.path()) {
+        if path.is_dir() {
+            collect_logs(&path, files);
+        } else if is_log_file(&path) {
+            files.push(path);
+        }
+    }
+}
+
+/// Logs of the project's past sessions: everything below `logs/`, and the
+/// `build.log` of every build directory
+pub fn stored_logs(project_dir: &Path) -> Vec<PathBuf> {
+    let mut files = Vec::new();
+    collect_logs(&project_dir.join(MONITOR_LOGS_DIR), &mut files);
+    if let Ok(entries) = std::fs::read_dir(project_dir) {
+        files.extend(
+            entries
+                .flatten()
+                .map(|entry| entry.path().join("build.log"))
+                .filter(|path| path.is_file()),
+        );
+    }
+    files.sort();
+    files
+}
+
+/// Whether the log's path below the project names the board, e.g.
+/// `logs/esp32s3.log`, `logs/esp32s3/<device>/` or `build.esp32s3/build.log`
+pub fn names_board(project_dir: &Path, path: &Path, board: &str) -> bool {
+    path.strip_prefix(project_dir)
+        .unwrap_or(path)
+        .components()
+        .any(|component| component.as_os_str().to_string_lossy().contains(board))
+}
+
+/// A line of a stored log matching the search
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct LogMatch {
+    pub path: PathBuf,
+    /// Counted from 1, as editors and grep do
+    pub line_number: usize,
+    pub line: String,
+}
+
+/// Lines of the files matching the regex, at most `limit`
+pub fn search_logs(files: &[PathBuf], regex: &Regex, limit: usize) -> Result<Vec<LogMatch>> {
+    let mut matches = Vec::new();
+    for path in files {
+        let file = std::fs::File::open(path)
+            .with_context(|| format!("Failed to open {}", path.display()))?;
+        let mut reader = BufReader::new(file);
+        let mut bytes = Vec::new();
+        let mut line_number = 0;
+        loop {
+            bytes.clear();
+            let read = reader
+                .read_until(b'\n', &mut bytes)
+                .with_context(|| format!("Failed to read {}", path.display()))?;
+            if read == 0 {
+                break;
+            }
+            line_number += 1;
+            let line = String::from_utf8_lossy(&bytes);
+            let line = line.trim_end_matches(['\r', '\n']);
+            if regex.is_match(line) {
+                matches.push(LogMatch {
+                    path: path.clone(),
+                    line_number,
+                    line: line.to_string(),
+                });
+                if matches.len() >= limit {
+                    return Ok(matches);
+                }
+            }
+        }
+    }
+    Ok(matches)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_log_search() {
+        let lines: Vec<String> = [
+            "I (10) boot: start",
+            "E (20) wifi: oops",
+            "W (30) app",
+            "E (40) wifi: again",
+        ]
+        .iter()
+        .map(|line| line.to_string())
+        .collect();
+        assert_eq!(matching_lines(&lines, &Regex::new("wifi").unwrap()), [1, 3]);
+
+        // Lower case patterns ignore case, n and N wrap around
+        let mut search = LogSearch::new("^e ").unwrap();
+        assert_eq!(search.position(&lines), "0/2");
+        assert_eq!(search.next(&lines), Some(1));
+        assert_eq!(search.next(&lines), Some(3));
+        assert_eq!(search.position(&lines), "2/2");
+        assert_eq!(search.next(&lines), Some(1));
+        assert_eq!(search.previous(&lines), Some(3));
+        assert_eq!(LogSearch::new("Boot").unwrap().next(&lines), None);
+        assert!(LogSearch::new("(").is_err());
+
+        let temp_dir = TempDir::new().unwrap();
+        let project_dir = temp_dir.path();
+        fs::create_dir_all(project_dir.join("logs/esp32s3/ttyACM0")).unwrap();
+        fs::create_dir_all(project_dir.join("build.esp32c3")).unwrap();
+        fs::create_dir_all(project_dir.join("main")).unwrap();
+        fs::write(project_dir.join("logs/esp32s3.log"), "ok\nerror: boom\n").unwrap();
+        fs::write(
+            project_dir.join("logs/esp32s3/ttyACM0/session.log"),
+            "Guru Meditation Error\r\n",
+        )
+        .unwrap();
+        fs::write(project_dir.join("logs/notes.txt"), "error: skipped").unwrap();
+        fs::write(
+            project_dir.join("build.esp32c3/build.log"),
+            "a\nb\nerror: c3\n",
+        )
+        .unwrap();
+        fs::write(project_dir.join("main/main.c"), "error").unwrap();
+
+        let files = stored_logs(project_dir);
+        assert_eq!(
+            files,
+            [
+                project_dir.join("build.esp32c3/build.log"),
+                project_dir.join("logs/esp32s3.log"),
+                project_dir.join("logs/esp32s3/ttyACM0/session.log"),
+            ]
+        );
+        assert!(names_board(project_dir, &files[0], "esp32c3"));
+        assert!(!names_board(project_dir, &files[0], "esp32s3"));
+        assert!(names_board(project_dir, &files[2], "esp32s3"));
+
+        let matches = search_logs(&files, &Regex::new("(?i)error").unwrap(), 10).unwrap();
+        let found: Vec<_> = matches
+            .iter()
+            .map(|m| (m.line_number, m.line.as_str()))
+            .collect();
+        assert_eq!(
+            found,
+            [
+                (3, "error: c3"),
+                (2, "error: boom"),
+                (1, "Guru Meditation Error")
+            ]
+        );
+        assert_eq!(
+            search_logs(&files, &Regex::new("error").unwrap(), 2)
+                .unwrap()
+                .len(),
+            2
+        );
+    }
+}
@@ -0,0 +1,288 @@
+//! Free heap and stack watermarks of the monitored devices
+//!
+//! The panes read the free heap and the tasks' stack high water marks from
+//! the lines their devices print: `Free heap: 123456` and hello_world's
+//! `Minimum free heap size: 298716 bytes`, or `>>heap:123456`, and
+//! `stack watermark <task>: <bytes>` or `>>stack.<task>:<bytes>` for a task
+//! logging `uxTaskGetStackHighWaterMark` now and then. **m** shows the
+//! trends of all devices over the session. A free heap or watermark whose
+//! fitted trend lost more than 1 KiB over at least a minute is flagged as a
+//! suspected leak, or a stack about to overflow.
+
+use regex::Regex;
+use std::collections::VecDeque;
+use std::sync::OnceLock;
+use std::time::{Duration, Instant};
+
+/// Samples kept per series
+pub const TREND_SAMPLES: usize = 600;
+/// Samples a trend needs before it can be flagged
+pub const LEAK_MIN_SAMPLES: usize = 5;
+/// Time a trend needs to span before it can be flagged
+pub const LEAK_MIN_SPAN: Duration = Duration::from_secs(60);
+/// Bytes a flagged trend lost over its span
+pub const LEAK_MIN_DROP: f64 = 1024.0;
+/// Series of the free heap
+pub const FREE_HEAP: &str = "free heap";
+/// Series of the lowest free heap since boot, which only ever falls
+pub const MIN_FREE_HEAP: &str = "min free heap";
+
+/// A memory figure a line reported
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum MemorySample {
+    FreeHeap(u64),
+    MinFreeHeap(u64),
+    /// Task and the bytes of its stack never used
+    StackWatermark(String, u64),
+}
+
+impl MemorySample {
+    /// Name of the sample's series, e.g. `stack main`
+    pub fn series(&self) -> String {
+        match self {
+            MemorySample::FreeHeap(_) => FREE_HEAP.to_string(),
+            MemorySample::MinFreeHeap(_) => MIN_FREE_HEAP.to_string(),
+            MemorySample::StackWatermark(task, _) => format!("stack {}", task),
+        }
+    }
+
+    pub fn bytes(&self) -> u64 {
+        match self {
+            MemorySample::FreeHeap(bytes)
+            | MemorySample::MinFreeHeap(bytes)
+            | MemorySample::StackWatermark(_, bytes) => *bytes,
+        }
+    }
+}
+
+struct SampleRegexes {
+    min_free_heap: Regex,
+    free_heap: Regex,
+    stack: Regex,
+}
+
+fn sample_regexes() -> &'static SampleRegexes {
+    static REGEXES: OnceLock<SampleRegexes> = OnceLock::new();
+    REGEXES.get_or_init(|| SampleRegexes {
+        min_free_heap: Regex::new(r"(?i)\bmin(?:imum)?[ _]free[ _]heap(?:[ _]size)?\s*[:=]\s*(\d+)")
+            .unwrap(),
+        free_heap: Regex::new(r"(?i)(?:\bfree[ _]heap(?:[ _]size)?\s*[:=]\s*|>>(?:free_)?heap:)(\d+)")
+            .unwrap(),
+        stack: Regex::new(
+            r"(?i)(?:\bstack (?:high[ _]?water[ _]?mark|watermark) (?:of )?([\w.-]+)\s*[:=]\s*|>>stack\.([\w.-]+):)(\d+)",
+        )
+        .unwrap(),
+    })
+}
+
+/// The heap and stack figures the line reports
+pub fn memory_samples(line: &str) -> Vec<MemorySample> {
+    let regexes = sample_regexes();
+    let number = |text: &str| text.parse::<u64>().ok();
+    let mut samples = Vec::new();
+    // The minimum's line matches the free heap's regex as well
+    if let Some(captures) = regexes.min_free_heap.captures(line) {
+        samples.extend(number(&captures[1]).map(MemorySample::MinFreeHeap));
+    } else if let Some(captures) = regexes.free_heap.captures(line) {
+        samples.extend(number(&captures[1]).map(MemorySample::FreeHeap));
+    }
+    for captures in regexes.stack.captures_iter(line) {
+        let Some(task) = captures.get(1).or(captures.get(2)) else {
+            continue;
+        };
+        if let Some(bytes) = number(&captures[3]) {
+            samples.push(MemorySample::StackWatermark(
+                task.as_str().to_string(),
+                bytes,
+            ));
+        }
+    }
+    samples
+}
+
+/// Bytes of one series over the session
+#[derive(Debug, Clone, Default)]
+pub struct MemoryTrend {
+    /// Seconds since the session's first sample and the bytes
+    samples: VecDeque<(f64, u64)>,
+}
+
+impl MemoryTrend {
+    pub fn push(&mut self, seconds: f64, bytes: u64) {
+        if self.samples.len() >= TREND_SAMPLES {
+            self.samples.pop_front();
+        }
+        self.samples.push_back((seconds, bytes));
+    }
+
+    pub fn values(&self) -> Vec<u64> {
+        self.samples.iter().map(|(_, bytes)| *bytes).collect()
+    }
+
+    pub fn first(&self) -> Option<u64> {
+        self.samples.front().map(|(_, bytes)| *bytes)
+    }
+
+    pub fn last(&self) -> Option<u64> {
+        self.samples.back().map(|(_, bytes)| *bytes)
+    }
+
+    pub fn min(&self) -> Option<u64> {
+        self.samples.iter().map(|(_, bytes)| *bytes).min()
+    }
+
+    /// Seconds from the first sample to the last
+    pub fn span(&self) -> f64 {
+        match (self.samples.front(), self.samples.back()) {
+            (Some((first, _)), Some((last, _))) => last - first,
+            _ => 0.0,
+        }
+    }
+
+    /// Least-squares slope of the samples in bytes per minute
+    pub fn slope_per_minute(&self) -> Option<f64> {
+        let n = self.samples.len() as f64;
+        if self.samples.len() < 2 || self.span() <= 0.0 {
+            return None;
+        }
+        let mean_x = self.samples.iter().map(|(x, _)| x).sum::<f64>() / n;
+        let mean_y = self.samples.iter().map(|(_, y)| *y as f64).sum::<f64>() / n;
+        let (covariance, variance) =
+            self.samples
+                .iter()
+                .fold((0.0, 0.0), |(covariance, variance), (x, y)| {
+                    let dx = x - mean_x;
+                    (covariance + dx * (*y as f64 - mean_y), variance + dx * dx)
+                });
+        Some(covariance / variance * 60.0)
+    }
+
+    /// Whether the bytes keep falling: the fitted trend lost more than
+    /// `LEAK_MIN_DROP` over a minute or more of samples
+    pub fn is_falling(&self) -> bool {
+        if self.samples.len() < LEAK_MIN_SAMPLES || self.span() < LEAK_MIN_SPAN.as_secs_f64() {
+            return false;
+        }
+        self.slope_per_minute()
+            .is_some_and(|slope| -slope * self.span() / 60.0 >= LEAK_MIN_DROP)
+    }
+}
+
+/// The memory series of a pane's device
+#[derive(Debug, Clone, Default)]
+pub struct MemoryWatch {
+    started: Option<Instant>,
+    /// Series in the order first reported
+    pub series: Vec<(String, MemoryTrend)>,
+    /// Series flagged as falling, so each is told once
+    flagged: Vec<String>,
+}
+
+impl MemoryWatch {
+    /// Track the figures of the line read at `now`; the names of the series
+    /// that just started falling
+    pub fn observe(&mut self, line: &str, now: Instant) -> Vec<String> {
+        let mut falling = Vec::new();
+        for sample in memory_samples(line) {
+            let started = *self.started.get_or_insert(now);
+            let name = sample.series();
+            let index = match self.series.iter().position(|(series, _)| *series == name) {
+                Some(index) => index,
+                None => {
+                    self.series.push((name.clone(), MemoryTrend::default()));
+                    self.series.len() - 1
+                }
+            };
+            let trend = &mut self.series[index].1;
+            trend.push(now.duration_since(started).as_secs_f64(), sample.bytes());
+            // The minimum since boot never rises, that it fell tells nothing
+            let is_falling = name != MIN_FREE_HEAP && trend.is_falling();
+            let was_flagged = self.flagged.contains(&name);
+            if is_falling && !was_flagged {
+                self.flagged.push(name.clone());
+                falling.push(name);
+            } else if !is_falling && was_flagged {
+                self.flagged.retain(|flagged| *flagged != name);
+            }
+        }
+        falling
+    }
+
+    /// Series falling now
+    pub fn falling(&self) -> &[String] {
+        &self.flagged
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.series.is_empty()
+    }
+
+    pub fn clear(&mut self) {
+        *self = Self::default();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_memory_watch() {
+        assert_eq!(
+            memory_samples("I (312) app: Free heap: 231456"),
+            [MemorySample::FreeHeap(231456)]
+        );
+        assert_eq!(
+            memory_samples("Minimum free heap size: 298716 bytes"),
+            [MemorySample::MinFreeHeap(298716)]
+        );
+        assert_eq!(
+            memory_samples(">>heap:120000 >>stack.main:1840 >>stack.wifi_task:900"),
+            [
+                MemorySample::FreeHeap(120000),
+                MemorySample::StackWatermark("main".to_string(), 1840),
+                MemorySample::StackWatermark("wifi_task".to_string(), 900),
+            ]
+        );
+        assert_eq!(
+            memory_samples("W (900) app: stack watermark sensor: 312"),
+            [MemorySample::StackWatermark("sensor".to_string(), 312)]
+        );
+        assert!(memory_samples("I (10) wifi: heap is fine").is_empty());
+
+        let start = Instant::now();
+        let mut watch = MemoryWatch::default();
+        // Steady heap and watermark, a minimum that only ever falls
+        for second in 0..120u64 {
+            let now = start + Duration::from_secs(second);
+            let heap = 200_000 - if second % 2 == 0 { 0 } else { 64 };
+            let line = format!(">>heap:{} >>stack.main:1800", heap);
+            assert!(watch.observe(&line, now).is_empty());
+            let line = format!("Minimum free heap size: {} bytes", 190_000 - second * 100);
+            assert!(watch.observe(&line, now).is_empty());
+        }
+        assert!(watch.falling().is_empty());
+        assert_eq!(watch.series.len(), 3);
+
+        // The heap loses 100 bytes every 5 seconds
+        let mut watch = MemoryWatch::default();
+        let mut flagged = Vec::new();
+        for step in 0..20u64 {
+            let now = start + Duration::from_secs(step * 5);
+            flagged.extend(watch.observe(&format!("Free heap: {}", 200_000 - step * 100), now));
+        }
+        assert_eq!(flagged, ["free heap"]);
+        assert_eq!(watch.falling(), ["free heap"]);
+        let trend = &watch.series[0].1;
+        assert!((trend.slope_per_minute().unwrap() + 1200.0).abs() < 1.0);
+        assert_eq!(trend.last(), Some(198_100));
+        assert_eq!(trend.min(), Some(198_100));
+
+        // Recovered heap is no longer flagged
+        for step in 20..200u64 {
+            let now = start + Duration::from_secs(step * 5);
+            watch.observe("Free heap: 200000", now);
+        }
+        assert!(watch.falling().is_empty());
+    }
+}
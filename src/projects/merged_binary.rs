@@ -0,0 +1,280 @@
+//! Single-file images for manufacturing
+//!
+//! With `build: merged_binary: true` in `espbrew.yaml`, every successful
+//! ESP-IDF board build also writes `merged-<board>.bin` into its build
+//! directory: bootloader, partition table, every app of a multi-app project
+//! and the filesystem image of the board's data directory at their offsets,
+//! merged with
+//! `esptool.py merge_bin` into one file flashed at offset 0.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::{BoardMetadata, ProjectConfig};
+use crate::models::flash::{FlashBinaryInfo, FlashConfig};
+use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig};
+use crate::projects::fs_image::prepare_filesystem_image;
+use crate::projects::handlers::esp_idf::EspIdfHandler;
+use crate::services::run_flash_tool;
+
+/// Name of the merged image among a build's artifacts
+pub const MERGED_ARTIFACT: &str = "merged";
+
+/// Whether builds write a merged image
+pub fn merged_binary_enabled(project_dir: &Path) -> bool {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .is_some_and(|config| config.build.merged_binary)
+}
+
+/// `<build dir>/merged-<board>.bin`
+pub fn merged_binary_path(build_dir: &Path, board_name: &str) -> PathBuf {
+    build_dir.join(format!("merged-{}.bin", board_name))
+}
+
+/// Arguments of the `esptool.py merge_bin` call writing `binaries` to `output`
+pub fn merge_bin_args(
+    chip: Option<&str>,
+    flash_config: &FlashConfig,
+    binaries: &[FlashBinaryInfo],
+    output: &Path,
+) -> Vec<String> {
+    let mut args = Vec::new();
+    if let Some(chip) = chip {
+        args.extend(["--chip".to_string(), chip.to_string()]);
+    }
+    args.extend([
+        "merge_bin".to_string(),
+        "-o".to_string(),
+        output.display().to_string(),
+        "--flash_mode".to_string(),
+        flash_config.flash_mode.clone(),
+        "--flash_freq".to_string(),
+        flash_config.flash_freq.clone(),
+        "--flash_size".to_string(),
+        flash_config.flash_size.clone(),
+    ]);
+    let mut binaries: Vec<&FlashBinaryInfo> = binaries.iter().collect();
+    binaries.sort_by_key(|binary| binary.offset);
+    for binary in binaries {
+        args.push(format!("0x{:x}", binary.offset));
+        args.push(binary.file_path.display().to_string());
+    }
+    args
+}
+
+/// Merge the images of the board's last build into `merged-<board>.bin`
+pub async fn write_merged_binary(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<BuildArtifact> {
+    let (flash_config, mut binaries) = EspIdfHandler
+        .build_images(project_dir, board_config)
+        .with_context(|| format!("Failed to read the build of {}", board_config.name))?;
+
+    // The filesystem image replaces one the build flashes at the same offset
+    if let Some(image) = prepare_filesystem_image(project_dir, board_config, tx).await? {
+        binaries.retain(|binary| binary.offset != image.offset);
+        binaries.push(image);
+    }
+
+    // Board metadata overrides the flash parameters of the build, as when flashing
+    let metadata = BoardMetadata::load(project_dir, &board_config.name);
+    let flash_config = FlashConfig {
+        flash_mode: metadata
+            .esptool_flash_mode()
+            .unwrap_or(flash_config.flash_mode),
+        flash_freq: metadata
+            .esptool_flash_freq()
+            .unwrap_or(flash_config.flash_freq),
+        flash_size: flash_config.flash_size,
+    };
+    let chip = metadata
+        .chip
+        .clone()
+        .or(board_config.target.clone())
+        .map(|chip| chip.to_lowercase().replace('-', ""));
+
+    let output = merged_binary_path(&board_config.build_dir, &board_config.name);
+    let mut command = Command::new("esptool.py");
+    command.current_dir(project_dir).args(merge_bin_args(
+        chip.as_deref(),
+        &flash_config,
+        &binaries,
+        &output,
+    ));
+    run_flash_tool(
+        command,
+        "esptool.py merge_bin",
+        &board_config.name,
+        Some(tx),
+        |_| None,
+    )
+    .await?;
+
+    let size = std::fs::metadata(&output)
+        .with_context(|| format!("esptool.py merge_bin wrote no {}", output.display()))?
+        .len();
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "📦 Merged {} images into {} ({} KB), flash it at 0x0",
+            binaries.len(),
+            output.display(),
+            size / 1024
+        ),
+    ));
+    Ok(BuildArtifact {
+        name: MERGED_ARTIFACT.to_string(),
+        file_path: output,
+        artifact_type: ArtifactType::Binary,
+        // Flashed on its own, never with the images it holds
+        offset: None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_merged_binary_args() {
+        let binary = |name: &str, offset: u32| FlashBinaryInfo {
+            name: name.to_string(),
+            file_name: format!("{}.bin", name),
+            file_path: PathBuf::from(format!("build/{}.bin", name)),
+            offset,
+        };
+        let flash_config = FlashConfig {
+            flash_mode: "qio".to_string(),
+            flash_freq: "80m".to_string(),
+            flash_size: "8MB".to_string(),
+        };
+        let output = merged_binary_path(Path::new("build"), "esp32s3_box");
+        assert_eq!(output, PathBuf::from("build/merged-esp32s3_box.bin"));
+
+        let args = merge_bin_args(
+            Some("esp32s3"),
+            &flash_config,
+            &[
+                binary("app", 0x10000),
+                binary("storage", 0x110000),
+                binary("bootloader", 0x0),
+                binary("partition-table", 0x8000),
+            ],
+            &output,
+        );
+        assert_eq!(
+            args,
+            [
+                "--chip",
+                "esp32s3",
+                "merge_bin",
+                "-o",
+                "build/merged-esp32s3_box.bin",
+                "--flash_mode",
+                "qio",
+                "--flash_freq",
+                "80m",
+                "--flash_size",
+                "8MB",
+                "0x0",
+                "build/bootloader.bin",
+                "0x8000",
+                "build/partition-table.bin",
+                "0x10000",
+                "build/app.bin",
+                "0x110000",
+                "build/storage.bin"
+            ]
+        );
+        assert_eq!(
+            merge_bin_args(None, &flash_config, &[], &output)[0],
+            "merge_bin"
+        );
+    }
+
+    #[test]
+    fn test_merged_binary_args_multi_app() {
+        use crate::projects::ProjectHandler;
+
+        let temp_dir = tempfile::TempDir::new().unwrap();
+        let project = temp_dir.path();
+        std::fs::write(project.join("CMakeLists.txt"), "project(factory)\n").unwrap();
+        std::fs::write(
+            project.join("sdkconfig.defaults.esp32s3"),
+            "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        std::fs::write(
+            project.join("espbrew.yaml"),
+            "esp_idf:\n  apps:\n    - name: updater\n      path: updater\n      partition: ota_0\n",
+        )
+        .unwrap();
+        let board = EspIdfHandler
+            .discover_boards(project)
+            .unwrap()
+            .into_iter()
+            .find(|b| b.name == "esp32s3")
+            .unwrap();
+
+        let build_dir = &board.build_dir;
+        std::fs::create_dir_all(build_dir.join("bootloader")).unwrap();
+        std::fs::create_dir_all(build_dir.join("partition_table")).unwrap();
+        std::fs::create_dir_all(build_dir.join("apps/updater")).unwrap();
+        let partition = |label: &str, subtype: u8, offset: u32| {
+            let mut entry = vec![0xAA, 0x50, 0x00, subtype];
+            entry.extend_from_slice(&offset.to_le_bytes());
+            entry.extend_from_slice(&0x100000u32.to_le_bytes());
+            let mut label_bytes = [0u8; 16];
+            label_bytes[..label.len()].copy_from_slice(label.as_bytes());
+            entry.extend_from_slice(&label_bytes);
+            entry.extend_from_slice(&0u32.to_le_bytes());
+            entry
+        };
+        let mut table = partition("factory", 0x00, 0x10000);
+        table.extend(partition("ota_0", 0x10, 0x110000));
+        table.extend([0xFF; 32]);
+        std::fs::write(
+            build_dir.join("partition_table/partition-table.bin"),
+            &table,
+        )
+        .unwrap();
+        for file in [
+            "bootloader/bootloader.bin",
+            "factory.bin",
+            "apps/updater/updater.bin",
+        ] {
+            std::fs::write(build_dir.join(file), [0u8; 16]).unwrap();
+        }
+        std::fs::write(
+            build_dir.join("flash_args"),
+            "--flash_mode dio --flash_freq 80m --flash_size 4MB\n0x0 bootloader/bootloader.bin\n0x8000 partition_table/partition-table.bin\n0x10000 factory.bin\n",
+        )
+        .unwrap();
+        std::fs::write(
+            build_dir.join("apps/updater/flash_args"),
+            "--flash_mode dio --flash_freq 80m --flash_size 4MB\n0x10000 updater.bin\n",
+        )
+        .unwrap();
+
+        let (flash_config, binaries) = EspIdfHandler.build_images(project, &board).unwrap();
+        assert_eq!(binaries.len(), 4);
+        let output = merged_binary_path(build_dir, &board.name);
+        let args = merge_bin_args(Some("esp32s3"), &flash_config, &binaries, &output);
+        let images: Vec<(&str, &str)> = args[11..]
+            .chunks(2)
+            .map(|pair| (pair[0].as_str(), pair[1].as_str()))
+            .collect();
+        assert_eq!(
+            images.iter().map(|(offset, _)| *offset).collect::<Vec<_>>(),
+            ["0x0", "0x8000", "0x10000", "0x110000"]
+        );
+        assert!(images[2].1.ends_with("factory.bin"));
+        assert!(images[3].1.ends_with("updater.bin"));
+    }
+}
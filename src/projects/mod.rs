@@ -3,10 +3,65 @@
 //! This module provides support for various ESP32 development frameworks
 //! including ESP-IDF, Arduino, Rust no_std, and many others.
 
+pub mod board_detect;
+pub mod board_picker;
+pub mod board_tags;
+pub mod bsp_catalog;
+pub mod build_history;
+pub mod build_layout;
+pub mod build_plan;
+pub mod build_scheduler;
+pub mod build_session;
+pub mod command_templates;
+pub mod component_harness;
 pub mod config;
+pub mod console_script;
+pub mod container_build;
+pub mod core_dump;
+pub mod crash_loop;
+pub mod daemon;
+pub mod dashboard;
+pub mod debug_session;
+pub mod device_registry;
+pub mod erase;
+pub mod flash_encryption;
+pub mod flash_orchestrator;
+pub mod flash_parts;
+pub mod fs_image;
+pub mod golden;
 pub mod handlers;
+pub mod hooks;
+pub mod incremental;
+pub mod json_output;
+pub mod lockfile;
+pub mod log_diff;
+pub mod log_export;
+pub mod log_search;
+pub mod memory_watch;
+pub mod merged_binary;
+pub mod monitor_log;
+pub mod monitor_triggers;
+pub mod notifications;
+pub mod nvs_image;
+pub mod ota;
+pub mod platformio_boards;
+pub mod provisioning;
 pub mod registry;
+pub mod remote_build;
+pub mod retry;
+pub mod session_recording;
+pub mod signing;
+pub mod source_links;
+pub mod templates;
+pub mod toolchain_check;
+pub mod toolchain_setup;
+pub mod uf2;
+pub mod watch;
+pub mod web_dashboard;
+pub mod webflash;
+pub mod workspace;
 
 // Re-export the new types
 pub use crate::models::ProjectType;
 pub use registry::{ProjectHandler, ProjectRegistry};
+pub use workspace::{WorkspaceProject, discover_workspace};
@@ -0,0 +1,250 @@
+//! Recordings of serial monitor sessions
+//!
+//! With `monitor: record: true` in `espbrew.yaml`, `espbrew monitor --record`
+//! or **w** in the TUI, every line a device prints is written with the host's
+//! time to `logs/<board>/<device>/<timestamp>.log`, the device named by its
+//! USB serial number, else by its port. A recording continues in a new file
+//! once it reaches `rotate_mb`, and only the newest `keep` files of a device
+//! are kept, so the boot log of a run hours ago is still there without the
+//! logs growing without bound.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use std::fs::File;
+use std::io::Write;
+use std::path::{Path, PathBuf};
+
+use crate::config::ProjectConfig;
+use crate::projects::device_registry::connected_ports;
+use crate::projects::nvs_image::port_slug;
+
+/// Recordings, relative to the project, next to the build logs
+pub const MONITOR_LOGS_DIR: &str = "logs";
+/// Size of a recording file before it rotates
+pub const DEFAULT_ROTATE_MB: u64 = 10;
+/// Recordings kept per device
+pub const DEFAULT_KEEP: usize = 20;
+/// Directory of the devices of no known board
+const UNKNOWN_BOARD: &str = "unknown";
+
+/// Where and how the sessions of a board's device are recorded
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RecordSettings {
+    pub project_dir: PathBuf,
+    /// Recording is on from the start
+    pub enabled: bool,
+    pub rotate_bytes: u64,
+    pub keep: usize,
+}
+
+impl RecordSettings {
+    /// The `monitor:` settings of the project's `espbrew.yaml`
+    pub fn load(project_dir: &Path) -> Self {
+        let section = ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .map(|config| config.monitor)
+            .unwrap_or_default();
+        Self {
+            project_dir: project_dir.to_path_buf(),
+            enabled: section.record,
+            rotate_bytes: section.rotate_mb.unwrap_or(DEFAULT_ROTATE_MB).max(1) * 1024 * 1024,
+            keep: section.keep.unwrap_or(DEFAULT_KEEP).max(1),
+        }
+    }
+}
+
+/// Name of the device on `port` in the recordings' paths: its USB serial
+/// number, which stays the same when replugged, else the port
+pub fn device_name(port: &str) -> String {
+    let serial_number = connected_ports().ok().and_then(|ports| {
+        ports
+            .into_iter()
+            .find(|connected| connected.port == port)
+            .and_then(|connected| connected.usb)
+            .and_then(|usb| usb.serial_number)
+    });
+    port_slug(serial_number.as_deref().unwrap_or(port))
+}
+
+/// `logs/<board>/<device>/`
+pub fn device_log_dir(project_dir: &Path, board: Option<&str>, device: &str) -> PathBuf {
+    project_dir
+        .join(MONITOR_LOGS_DIR)
+        .join(board.unwrap_or(UNKNOWN_BOARD))
+        .join(device)
+}
+
+/// The line as recorded, after the host's time it arrived
+pub fn timestamped_line(time: DateTime<Local>, line: &str) -> String {
+    format!("[{}] {}", time.format("%Y-%m-%d %H:%M:%S%.3f"), line)
+}
+
+/// Recordings in `dir`, oldest first
+pub fn recordings(dir: &Path) -> Vec<PathBuf> {
+    let Ok(entries) = std::fs::read_dir(dir) else {
+        return Vec::new();
+    };
+    let mut files: Vec<PathBuf> = entries
+        .flatten()
+        .map(|entry| entry.path())
+        .filter(|path| path.extension().is_some_and(|ext| ext == "log"))
+        .collect();
+    files.sort_by_key(|path| {
+        let modified = std::fs::metadata(path).and_then(|metadata| metadata.modified());
+        (
+            modified.unwrap_or(std::time::SystemTime::UNIX_EPOCH),
+            path.clone(),
+        )
+    });
+    files
+}
+
+/// Remove all but the newest `keep` recordings in `dir`, returning how many
+pub fn prune_recordings(dir: &Path, keep: usize) -> Result<usize> {
+    let files = recordings(dir);
+    let excess = files.len().saturating_sub(keep);
+    for path in &files[..excess] {
+        std::fs::remove_file(path)
+            .with_context(|| format!("Failed to remove {}", path.display()))?;
+    }
+    Ok(excess)
+}
+
+/// Recording of one device's session
+#[derive(Debug)]
+pub struct MonitorRecorder {
+    dir: PathBuf,
+    path: PathBuf,
+    file: File,
+    written: u64,
+    rotate_bytes: u64,
+    keep: usize,
+}
+
+impl MonitorRecorder {
+    /// Start recording the session of the board's device on `port`
+    pub fn start(settings: &RecordSettings, board: Option<&str>, port: &str) -> Result<Self> {
+        let dir = device_log_dir(&settings.project_dir, board, &device_name(port));
+        std::fs::create_dir_all(&dir)
+            .with_context(|| format!("Failed to create {}", dir.display()))?;
+        let (path, file) = Self::create(&dir)?;
+        let recorder = Self {
+            dir,
+            path,
+            file,
+            written: 0,
+            rotate_bytes: settings.rotate_bytes,
+            keep: settings.keep,
+        };
+        prune_recordings(&recorder.dir, recorder.keep)?;
+        Ok(recorder)
+    }
+
+    /// New `<timestamp>.log` in `dir`, numbered when one of the same second exists
+    fn create(dir: &Path) -> Result<(PathBuf, File)> {
+        let stamp = Local::now().format("%Y%m%d-%H%M%S").to_string();
+        let mut path = dir.join(format!("{}.log", stamp));
+        let mut number = 1;
+        while path.exists() {
+            path = dir.join(format!("{}-{}.log", stamp, number));
+            number += 1;
+        }
+        let file =
+            File::create(&path).with_context(|| format!("Failed to create {}", path.display()))?;
+        Ok((path, file))
+    }
+
+    /// File the lines are written to now
+    pub fn path(&self) -> &Path {
+        &self.path
+    }
+
+    /// Write the line with the current time, continuing in a new file once
+    /// this one is full
+    pub fn record(&mut self, line: &str) -> Result<()> {
+        if self.written >= self.rotate_bytes {
+            let (path, file) = Self::create(&self.dir)?;
+            self.path = path;
+            self.file = file;
+            self.written = 0;
+            prune_recordings(&self.dir, self.keep)?;
+        }
+        let line = timestamped_line(Local::now(), line) + "\n";
+        self.file
+            .write_all(line.as_bytes())
+            .with_context(|| format!("Failed to write {}", self.path.display()))?;
+        self.written += line.len() as u64;
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_monitor_session_recording() {
+        let dir = tempfile::tempdir().unwrap();
+        assert_eq!(
+            device_log_dir(dir.path(), Some("esp32s3_box"), "F4_12_FA_01"),
+            dir.path().join("logs/esp32s3_box/F4_12_FA_01")
+        );
+        assert_eq!(
+            device_log_dir(dir.path(), None, "_dev_ttyUSB0"),
+            dir.path().join("logs/unknown/_dev_ttyUSB0")
+        );
+        let time = chrono::TimeZone::with_ymd_and_hms(&chrono::Local, 2026, 10, 14, 10, 15, 12)
+            .unwrap()
+            + chrono::Duration::milliseconds(345);
+        assert_eq!(
+            timestamped_line(time, "I (31) boot: start"),
+            "[2026-10-14 10:15:12.345] I (31) boot: start"
+        );
+
+        let settings = RecordSettings::load(dir.path());
+        assert!(!settings.enabled);
+        assert_eq!(settings.rotate_bytes, 10 * 1024 * 1024);
+        assert_eq!(settings.keep, DEFAULT_KEEP);
+        std::fs::write(
+            dir.path().join("espbrew.yaml"),
+            "monitor:\n  record: true\n  rotate_mb: 2\n  keep: 5\n",
+        )
+        .unwrap();
+        let settings = RecordSettings::load(dir.path());
+        assert!(settings.enabled);
+        assert_eq!(settings.rotate_bytes, 2 * 1024 * 1024);
+        assert_eq!(settings.keep, 5);
+
+        let mut recorder =
+            MonitorRecorder::start(&settings, Some("esp32c3"), "/dev/ttyESPBREW0").unwrap();
+        recorder.record("I (31) boot: start").unwrap();
+        recorder.record("I (42) main: ready").unwrap();
+        let content = std::fs::read_to_string(recorder.path()).unwrap();
+        let lines: Vec<&str> = content.lines().collect();
+        assert_eq!(lines.len(), 2);
+        assert!(lines[0].starts_with('[') && lines[0].ends_with("] I (31) boot: start"));
+        let device_dir = recorder.path().parent().unwrap().to_path_buf();
+        assert!(device_dir.starts_with(dir.path().join("logs/esp32c3")));
+
+        // Every line past the size starts a new file, the oldest are removed
+        let tiny = RecordSettings {
+            rotate_bytes: 1,
+            keep: 2,
+            ..settings
+        };
+        let mut recorder =
+            MonitorRecorder::start(&tiny, Some("esp32c3"), "/dev/ttyESPBREW0").unwrap();
+        for line in ["one", "two", "three"] {
+            recorder.record(line).unwrap();
+        }
+        let files = recordings(&device_dir);
+        assert_eq!(files.len(), 2);
+        assert!(files.contains(&recorder.path().to_path_buf()));
+        assert!(
+            std::fs::read_to_string(recorder.path())
+                .unwrap()
+                .ends_with("] three\n")
+        );
+    }
+}
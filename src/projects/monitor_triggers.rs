@@ -0,0 +1,370 @@
+//! Actions the serial monitor panes take on the lines their devices print
+//!
+//! Each of the `monitor: triggers:` in `espbrew.yaml` has a regex and what to
+//! do when a line matches it: `save_log` saves the pane's lines to
+//! `logs/triggers/`, `flash` flashes the board's device again, and `run`
+//! runs a shell command from the project with the line in
+//! `ESPBREW_TRIGGER_LINE`. A trigger fires at most once per `cooldown_s`, so
+//! a crash loop doesn't flash the device over and over. The firings are kept
+//! with what their actions did for the pane's session summary.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use regex::Regex;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::time::{Duration, Instant};
+
+use crate::config::{ProjectConfig, TriggerSection};
+use crate::projects::build_history::format_duration;
+use crate::projects::monitor_log::MONITOR_LOGS_DIR;
+use crate::projects::nvs_image::port_slug;
+
+/// Logs saved by triggers, below the recordings' directory
+pub const TRIGGER_LOGS_DIR: &str = "triggers";
+/// Seconds before a trigger fires again
+pub const DEFAULT_COOLDOWN_S: u64 = 30;
+
+/// Something a trigger does
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum TriggerAction {
+    /// Save the pane's lines to `logs/triggers/`
+    SaveLog,
+    /// Flash the board's device again
+    Flash,
+    /// Run the shell command from the project
+    Run(String),
+}
+
+impl TriggerAction {
+    /// `save_log` or `flash` of `espbrew.yaml`
+    pub fn parse(action: &str) -> Option<Self> {
+        match action.to_lowercase().replace('-', "_").as_str() {
+            "save_log" | "log" => Some(TriggerAction::SaveLog),
+            "flash" | "reflash" => Some(TriggerAction::Flash),
+            _ => None,
+        }
+    }
+
+    pub fn name(&self) -> &str {
+        match self {
+            TriggerAction::SaveLog => "save_log",
+            TriggerAction::Flash => "flash",
+            TriggerAction::Run(command) => command,
+        }
+    }
+}
+
+/// A trigger of `espbrew.yaml`, its regex compiled
+#[derive(Debug, Clone)]
+pub struct MonitorTrigger {
+    pub name: String,
+    pub regex: Regex,
+    pub actions: Vec<TriggerAction>,
+    pub cooldown: Duration,
+}
+
+impl MonitorTrigger {
+    pub fn new(section: &TriggerSection) -> Result<Self> {
+        let regex = Regex::new(&section.pattern)
+            .with_context(|| format!("Invalid trigger regex '{}'", section.pattern))?;
+        let mut actions = section
+            .actions
+            .iter()
+            .map(|action| {
+                TriggerAction::parse(action).ok_or_else(|| {
+                    anyhow::anyhow!(
+                        "Unknown trigger action '{}', use save_log, flash or run",
+                        action
+                    )
+                })
+            })
+            .collect::<Result<Vec<_>>>()?;
+        if let Some(command) = &section.run {
+            actions.push(TriggerAction::Run(command.clone()));
+        }
+        if actions.is_empty() {
+            return Err(anyhow::anyhow!(
+                "The trigger on '{}' has no actions",
+                section.pattern
+            ));
+        }
+        Ok(Self {
+            name: section
+                .name
+                .clone()
+                .unwrap_or_else(|| section.pattern.clone()),
+            regex,
+            actions,
+            cooldown: Duration::from_secs(section.cooldown_s.unwrap_or(DEFAULT_COOLDOWN_S)),
+        })
+    }
+}
+
+/// The triggers of the project's `espbrew.yaml`, skipping invalid ones
+pub fn configured_triggers(project_dir: &Path) -> Vec<MonitorTrigger> {
+    let Ok(Some(config)) = ProjectConfig::load(project_dir) else {
+        return Vec::new();
+    };
+    config
+        .monitor
+        .triggers
+        .iter()
+        .filter_map(|section| match MonitorTrigger::new(section) {
+            Ok(trigger) => Some(trigger),
+            Err(e) => {
+                log::warn!("Monitor trigger skipped: {:#}", e);
+                None
+            }
+        })
+        .collect()
+}
+
+/// A trigger firing on a line
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TriggerFiring {
+    pub trigger: String,
+    pub line: String,
+    pub time: DateTime<Local>,
+    /// What the actions did, as they finish
+    pub outcomes: Vec<String>,
+}
+
+/// A pane's session: since when it reads, how much, and its triggers' firings
+#[derive(Debug, Clone)]
+pub struct MonitorSession {
+    pub started: DateTime<Local>,
+    /// Lines received, also those scrolled out of the pane
+    pub lines: usize,
+    pub firings: Vec<TriggerFiring>,
+    last_fired: HashMap<String, Instant>,
+}
+
+impl Default for MonitorSession {
+    fn default() -> Self {
+        Self {
+            started: Local::now(),
+            lines: 0,
+            firings: Vec::new(),
+            last_fired: HashMap::new(),
+        }
+    }
+}
+
+impl MonitorSession {
+    /// Triggers firing on the line at `now`, each recorded as a firing;
+    /// those that fired less than their cooldown ago don't
+    pub fn fire<'a>(
+        &mut self,
+        triggers: &'a [MonitorTrigger],
+        line: &str,
+        now: Instant,
+    ) -> Vec<&'a MonitorTrigger> {
+        let mut fired = Vec::new();
+        for trigger in triggers.iter().filter(|t| t.regex.is_match(line)) {
+            if self
+                .last_fired
+                .get(&trigger.name)
+                .is_some_and(|last| now.duration_since(*last) < trigger.cooldown)
+            {
+                continue;
+            }
+            self.last_fired.insert(trigger.name.clone(), now);
+            self.firings.push(TriggerFiring {
+                trigger: trigger.name.clone(),
+                line: line.to_string(),
+                time: Local::now(),
+                outcomes: Vec::new(),
+            });
+            fired.push(trigger);
+        }
+        fired
+    }
+
+    /// Note what an action of the trigger's last firing did
+    pub fn record_outcome(&mut self, trigger: &str, outcome: String) {
+        if let Some(firing) = self.firings.iter_mut().rev().find(|f| f.trigger == trigger) {
+            firing.outcomes.push(outcome);
+        }
+    }
+
+    /// Lines summing the session of the pane `title` up to `now`
+    pub fn summary(&self, title: &str, now: DateTime<Local>) -> Vec<String> {
+        let elapsed = (now - self.started).to_std().unwrap_or_default();
+        let mut lines = vec![format!(
+            "📋 Session of {} since {} ({}): {} lines, {} trigger firings",
+            title,
+            self.started.format("%H:%M:%S"),
+            format_duration(elapsed),
+            self.lines,
+            self.firings.len()
+        )];
+        for firing in &self.firings {
+            lines.push(format!(
+                "  ⚡ {} {}: {}",
+                firing.time.format("%H:%M:%S"),
+                firing.trigger,
+                firing.line.trim()
+            ));
+            for outcome in &firing.outcomes {
+                lines.push(format!("     {}", outcome));
+            }
+        }
+        lines
+    }
+}
+
+/// `logs/triggers/<board or port>-<trigger>-<time>.log`
+pub fn trigger_log_path(
+    project_dir: &Path,
+    board: Option<&str>,
+    port: &str,
+    trigger: &str,
+    time: DateTime<Local>,
+) -> PathBuf {
+    let name = board.map_or_else(|| port_slug(port), str::to_string);
+    project_dir
+        .join(MONITOR_LOGS_DIR)
+        .join(TRIGGER_LOGS_DIR)
+        .join(format!(
+            "{}-{}-{}.log",
+            name,
+            port_slug(trigger),
+            time.format("%Y%m%d-%H%M%S")
+        ))
+}
+
+/// Save the pane's lines for the trigger that fired
+pub fn save_trigger_log<'a>(
+    path: &Path,
+    lines: impl IntoIterator<Item = &'a String>,
+) -> Result<()> {
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)
+            .with_context(|| format!("Failed to create {}", parent.display()))?;
+    }
+    let mut text = String::new();
+    for line in lines {
+        text.push_str(line);
+        text.push('\n');
+    }
+    std::fs::write(path, text).with_context(|| format!("Failed to write {}", path.display()))
+}
+
+/// Environment of a trigger's command
+pub fn trigger_env(
+    trigger: &str,
+    line: &str,
+    board: Option<&str>,
+    port: &str,
+) -> Vec<(String, String)> {
+    vec![
+        ("ESPBREW_TRIGGER".to_string(), trigger.to_string()),
+        ("ESPBREW_TRIGGER_LINE".to_string(), line.to_string()),
+        (
+            "ESPBREW_BOARD".to_string(),
+            board.unwrap_or_default().to_string(),
+        ),
+        ("ESPBREW_PORT".to_string(), port.to_string()),
+    ]
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_monitor_triggers() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+monitor:
+  triggers:
+    - name: crash
+      match: 'Guru Meditation'
+      actions: [save_log, flash]
+    - match: '^READY$'
+      run: ./on_ready.sh
+      cooldown_s: 0
+    - match: 'oops'
+      actions: [explode]
+"#,
+        )
+        .unwrap();
+        let triggers = configured_triggers(project);
+        assert_eq!(triggers.len(), 2);
+        assert_eq!(triggers[0].name, "crash");
+        assert_eq!(
+            triggers[0].actions,
+            [TriggerAction::SaveLog, TriggerAction::Flash]
+        );
+        assert_eq!(triggers[0].cooldown, Duration::from_secs(30));
+        assert_eq!(triggers[1].name, "^READY$");
+        assert_eq!(
+            triggers[1].actions,
+            [TriggerAction::Run("./on_ready.sh".to_string())]
+        );
+        assert!(
+            MonitorTrigger::new(&TriggerSection {
+                pattern: "x".to_string(),
+                ..Default::default()
+            })
+            .is_err()
+        );
+
+        let mut session = MonitorSession::default();
+        let start = Instant::now();
+        let crash = "Guru Meditation Error: Core  0 panic'ed (LoadProhibited)";
+        assert_eq!(session.fire(&triggers, crash, start).len(), 1);
+        // Within its cooldown the crash loop doesn't fire it again
+        assert!(
+            session
+                .fire(&triggers, crash, start + Duration::from_secs(3))
+                .is_empty()
+        );
+        assert_eq!(
+            session
+                .fire(&triggers, crash, start + Duration::from_secs(31))
+                .len(),
+            1
+        );
+        assert_eq!(session.fire(&triggers, "READY", start).len(), 1);
+        assert_eq!(session.fire(&triggers, "READY", start).len(), 1);
+        assert!(session.fire(&triggers, "NOT READY", start).is_empty());
+        assert_eq!(session.firings.len(), 4);
+
+        session.record_outcome("crash", "💾 Log saved".to_string());
+        assert!(session.firings[0].outcomes.is_empty());
+        assert_eq!(session.firings[1].outcomes, ["💾 Log saved"]);
+
+        session.lines = 1200;
+        let summary = session.summary("esp32s3@/dev/ttyACM0", session.started);
+        assert!(summary[0].contains("esp32s3@/dev/ttyACM0"));
+        assert!(summary[0].contains("1200 lines, 4 trigger firings"));
+        assert!(
+            summary
+                .iter()
+                .any(|line| line.contains("crash: Guru Meditation"))
+        );
+        assert!(summary.iter().any(|line| line.contains("💾 Log saved")));
+
+        let path = trigger_log_path(project, None, "/dev/ttyACM0", "crash", chrono::Local::now());
+        assert!(path.starts_with(project.join("logs/triggers")));
+        assert!(
+            path.file_name()
+                .unwrap()
+                .to_string_lossy()
+                .starts_with("_dev_ttyACM0-crash-")
+        );
+        let lines = vec!["boot".to_string(), crash.to_string()];
+        save_trigger_log(&path, &lines).unwrap();
+        assert_eq!(
+            fs::read_to_string(&path).unwrap(),
+            format!("boot\n{}\n", crash)
+        );
+    }
+}
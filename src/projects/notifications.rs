@@ -0,0 +1,288 @@
+//! Desktop notifications of finished builds and flashes
+//!
+//! A matrix build takes long enough for its terminal to end up in the
+//! background. The `notifications:` section of `espbrew.yaml` picks what the
+//! desktop is told: `builds_finished` with the summary once all boards are
+//! idle again, `first_failure` as soon as a build or flash fails, and
+//! `flashes_finished`. The TUI skips them while its terminal has focus,
+//! unless `when_focused` is set; `espbrew build` tells `builds_finished` and
+//! `first_failure` too.
+//!
+//! ```yaml
+//! notifications:
+//!   events: [builds_finished, first_failure]
+//!   min_duration_s: 60  # no summary of builds taking less than a minute
+//! ```
+//!
+//! `notify-send` shows them on Linux, `osascript` on macOS and a toast of
+//! PowerShell on Windows.
+
+use std::path::{Path, PathBuf};
+use std::time::{Duration, Instant};
+use tokio::process::Command;
+
+use crate::config::ProjectConfig;
+use crate::projects::build_history::format_duration;
+use crate::projects::build_plan::PlannedCommand;
+
+/// What the desktop can be told about
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum NotificationEvent {
+    BuildsFinished,
+    FirstFailure,
+    FlashesFinished,
+}
+
+impl NotificationEvent {
+    /// Name used in `espbrew.yaml`
+    pub fn name(&self) -> &'static str {
+        match self {
+            NotificationEvent::BuildsFinished => "builds_finished",
+            NotificationEvent::FirstFailure => "first_failure",
+            NotificationEvent::FlashesFinished => "flashes_finished",
+        }
+    }
+
+    pub fn parse(name: &str) -> Option<Self> {
+        [
+            NotificationEvent::BuildsFinished,
+            NotificationEvent::FirstFailure,
+            NotificationEvent::FlashesFinished,
+        ]
+        .into_iter()
+        .find(|event| event.name() == name)
+    }
+}
+
+/// The `notifications:` of `espbrew.yaml`, checked
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct NotificationSettings {
+    pub events: Vec<NotificationEvent>,
+    pub min_duration: Duration,
+    pub when_focused: bool,
+}
+
+impl NotificationSettings {
+    pub fn wants(&self, event: NotificationEvent) -> bool {
+        self.events.contains(&event)
+    }
+}
+
+/// The project's notification settings, skipping unknown events
+pub fn configured_notifications(project_dir: &Path) -> NotificationSettings {
+    let Ok(Some(config)) = ProjectConfig::load(project_dir) else {
+        return NotificationSettings::default();
+    };
+    let section = config.notifications;
+    let events = section
+        .events
+        .iter()
+        .filter_map(|name| {
+            let event = NotificationEvent::parse(name);
+            if event.is_none() {
+                log::warn!("⚠️  Unknown notification event '{}' skipped", name);
+            }
+            event
+        })
+        .collect();
+    NotificationSettings {
+        events,
+        min_duration: Duration::from_secs(section.min_duration_s.unwrap_or(0)),
+        when_focused: section.when_focused,
+    }
+}
+
+/// Builds and flashes from a board getting busy until all boards are idle
+/// again
+#[derive(Debug, Clone, Default)]
+pub struct ActivityRun {
+    pub started: Option<Instant>,
+    /// Boards whose builds ended, and whether they succeeded
+    pub builds: Vec<(String, bool)>,
+    pub flashes: Vec<(String, bool)>,
+}
+
+impl ActivityRun {
+    /// Whether any board is busy at `now`; the run that just ended, and how
+    /// long it took
+    pub fn update(&mut self, busy: bool, now: Instant) -> Option<(ActivityRun, Duration)> {
+        match (busy, self.started) {
+            (true, None) => {
+                self.started = Some(now);
+                None
+            }
+            (false, Some(started)) => {
+                let run = std::mem::take(self);
+                Some((run, now.duration_since(started)))
+            }
+            _ => None,
+        }
+    }
+
+    /// A board's build or flash ended; whether it is the run's first failure
+    pub fn finished(&mut self, board: &str, flash: bool, success: bool) -> bool {
+        let first_failure = !success && self.failures() == 0;
+        let results = if flash {
+            &mut self.flashes
+        } else {
+            &mut self.builds
+        };
+        results.push((board.to_string(), success));
+        first_failure
+    }
+
+    pub fn failures(&self) -> usize {
+        self.builds
+            .iter()
+            .chain(&self.flashes)
+            .filter(|(_, success)| !success)
+            .count()
+    }
+}
+
+/// e.g. `8 build(s) finished in 12m 05s: 7 ok, 1 failed (esp32c3)`
+pub fn run_summary(what: &str, results: &[(String, bool)], duration: Duration) -> String {
+    let failed: Vec<&str> = results
+        .iter()
+        .filter(|(_, success)| !success)
+        .map(|(board, _)| board.as_str())
+        .collect();
+    let mut text = format!(
+        "{} {} finished in {}: {} ok",
+        results.len(),
+        what,
+        format_duration(duration),
+        results.len() - failed.len()
+    );
+    if !failed.is_empty() {
+        text.push_str(&format!(
+            ", {} failed ({})",
+            failed.len(),
+            failed.join(", ")
+        ));
+    }
+    text
+}
+
+/// Command showing a desktop notification, where the platform has one
+pub fn desktop_notification(title: &str, body: &str, working_dir: &Path) -> Option<PlannedCommand> {
+    if cfg!(target_os = "macos") {
+        let script = format!(
+            "display notification {:?} with title {:?}",
+            body.replace('"', "'"),
+            title
+        );
+        Some(PlannedCommand::new("notify", "osascript", working_dir).args(["-e", &script]))
+    } else if cfg!(windows) {
+        let quote = |text: &str| format!("'{}'", text.replace('\'', "''"));
+        let script = format!(
+            "$ErrorActionPreference = 'Stop'; \
+             [Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null; \
+             $toast = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02); \
+             $texts = $toast.GetElementsByTagName('text'); \
+             $texts.Item(0).AppendChild($toast.CreateTextNode({})) > $null; \
+             $texts.Item(1).AppendChild($toast.CreateTextNode({})) > $null; \
+             [Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('espbrew').Show([Windows.UI.Notifications.ToastNotification]::new($toast))",
+            quote(title),
+            quote(body)
+        );
+        Some(
+            PlannedCommand::new("notify", "powershell", working_dir).args([
+                "-NoProfile",
+                "-NonInteractive",
+                "-Command",
+                &script,
+            ]),
+        )
+    } else if cfg!(unix) {
+        Some(PlannedCommand::new("notify", "notify-send", working_dir).args([title, body]))
+    } else {
+        None
+    }
+}
+
+/// Run a notifier; failures are logged, not returned
+pub async fn run_notifier(planned: &PlannedCommand, what: &str) {
+    let status = Command::new(&planned.program)
+        .args(&planned.args)
+        .current_dir(&planned.working_dir)
+        .envs(&planned.env)
+        .status()
+        .await;
+    match status {
+        Ok(status) if status.success() => {}
+        Ok(status) => log::warn!("⚠️  {} failed with {}", what, status),
+        Err(e) => log::warn!("⚠️  Failed to run {}: {}", what, e),
+    }
+}
+
+/// Show the text as a desktop notification of espbrew
+pub async fn notify_desktop(project_dir: PathBuf, text: String) {
+    match desktop_notification("espbrew", &text, &project_dir) {
+        Some(planned) => run_notifier(&planned, "the desktop notification").await,
+        None => log::warn!("⚠️  No desktop notifications on this platform"),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_notifications() {
+        assert_eq!(
+            NotificationEvent::parse("first_failure"),
+            Some(NotificationEvent::FirstFailure)
+        );
+        assert_eq!(NotificationEvent::parse("builds"), None);
+
+        let temp_dir = TempDir::new().unwrap();
+        let settings = configured_notifications(temp_dir.path());
+        assert!(settings.events.is_empty());
+
+        fs::write(
+            temp_dir.path().join("espbrew.yaml"),
+            "notifications:\n  events: [builds_finished, first_failure, sometimes]\n  min_duration_s: 60\n",
+        )
+        .unwrap();
+        let settings = configured_notifications(temp_dir.path());
+        assert_eq!(
+            settings.events,
+            [
+                NotificationEvent::BuildsFinished,
+                NotificationEvent::FirstFailure
+            ]
+        );
+        assert!(!settings.wants(NotificationEvent::FlashesFinished));
+        assert_eq!(settings.min_duration, Duration::from_secs(60));
+        assert!(!settings.when_focused);
+
+        // A run lasts from the first busy board until all are idle again
+        let start = Instant::now();
+        let mut run = ActivityRun::default();
+        assert!(run.update(false, start).is_none());
+        assert!(run.update(true, start).is_none());
+        assert!(!run.finished("esp32s3", false, true));
+        assert!(run.finished("esp32c3", false, false));
+        assert!(!run.finished("esp32c6", false, false));
+        assert!(!run.finished("esp32s3", true, true));
+        assert!(run.update(true, start + Duration::from_secs(30)).is_none());
+        let (ended, duration) = run.update(false, start + Duration::from_secs(725)).unwrap();
+        assert_eq!(duration, Duration::from_secs(725));
+        assert_eq!(ended.builds.len(), 3);
+        assert_eq!(ended.flashes.len(), 1);
+        assert_eq!(ended.failures(), 2);
+        assert!(run.started.is_none() && run.builds.is_empty());
+
+        assert_eq!(
+            run_summary("build(s)", &ended.builds, duration),
+            "3 build(s) finished in 12m 05s: 1 ok, 2 failed (esp32c3, esp32c6)"
+        );
+        assert_eq!(
+            run_summary("flash(es)", &ended.flashes, Duration::from_secs(42)),
+            "1 flash(es) finished in 42s: 1 ok"
+        );
+    }
+}
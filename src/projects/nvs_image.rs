@@ -0,0 +1,336 @@
+//! NVS partition images generated at flash time
+//!
+//! A board's `nvs:` section names a `nvs_partition_gen` CSV whose values may
+//! hold `${NAME}` placeholders, e.g. for Wi-Fi credentials or device ids:
+//!
+//! ```yaml
+//! boards:
+//!   sensor:
+//!     nvs:
+//!       csv: provisioning/nvs.csv
+//!       values:
+//!         WIFI_SSID: lab
+//!       devices:
+//!         "7c:df:a1:00:00:01":
+//!           values:
+//!             DEVICE_ID: sensor-001
+//! ```
+//!
+//! A `provision:` source hands each device a unique identity on top, see
+//! [`crate::projects::provisioning`].
+//!
+//! When the board is flashed, the placeholders are filled for the device
+//! being flashed, the image is generated into the build directory and
+//! written to the NVS partition of the board's partition table along with
+//! the other images.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::{NvsDevice, NvsImage, ProjectConfig};
+use crate::models::flash::FlashBinaryInfo;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::device_registry::same_mac;
+use crate::projects::erase::{board_partitions, find_partition};
+use crate::projects::provisioning::provision_device;
+use crate::services::run_flash_tool;
+use crate::utils::esp_idf_utils::find_python;
+use crate::utils::espflash_utils::identify_esp_board;
+
+/// Partition an image is written to unless the section names another
+pub const NVS_PARTITION: &str = "nvs";
+
+/// Generator script of an ESP-IDF checkout, relative to `IDF_PATH`
+const IDF_GENERATOR: &str = "components/nvs_flash/nvs_partition_generator/nvs_partition_gen.py";
+
+/// Whether a `devices:` key is a MAC address rather than a serial port
+fn is_mac(key: &str) -> bool {
+    let parts: Vec<&str> = key.split([':', '-']).collect();
+    parts.len() == 6
+        && parts
+            .iter()
+            .all(|part| part.len() == 2 && part.chars().all(|c| c.is_ascii_hexdigit()))
+}
+
+/// Entry of the device on `port`, matched by port or MAC address
+pub fn device_entry<'a>(
+    image: &'a NvsImage,
+    port: &str,
+    mac_address: Option<&str>,
+) -> Option<(&'a str, &'a NvsDevice)> {
+    image
+        .devices
+        .iter()
+        .find(|(key, _)| {
+            key.as_str() == port || mac_address.is_some_and(|mac| is_mac(key) && same_mac(key, mac))
+        })
+        .map(|(key, device)| (key.as_str(), device))
+}
+
+/// Replace the `${NAME}` placeholders of a CSV with `lookup(NAME)`. A value
+/// filling a whole field is quoted when it holds commas or quotes.
+pub fn substitute(content: &str, lookup: impl Fn(&str) -> Option<String>) -> Result<String> {
+    let mut output = String::new();
+    for (index, line) in content.lines().enumerate() {
+        let mut filled = String::new();
+        let mut rest = line;
+        while let Some(start) = rest.find("${") {
+            let after = &rest[start + 2..];
+            let end = after
+                .find('}')
+                .ok_or_else(|| anyhow::anyhow!("Line {}: unterminated placeholder", index + 1))?;
+            let name = &after[..end];
+            let value = lookup(name).ok_or_else(|| {
+                anyhow::anyhow!(
+                    "Line {}: no value for ${{{}}}, set it in the nvs values or the environment",
+                    index + 1,
+                    name
+                )
+            })?;
+
+            filled.push_str(&rest[..start]);
+            rest = &after[end + 1..];
+            let field_start = filled.trim_end();
+            let field_end = rest.trim_start();
+            let whole_field = (field_start.is_empty() || field_start.ends_with(','))
+                && (field_end.is_empty() || field_end.starts_with(','));
+            if whole_field && value.contains([',', '"']) {
+                filled.push('"');
+                filled.push_str(&value.replace('"', "\"\""));
+                filled.push('"');
+            } else {
+                filled.push_str(&value);
+            }
+        }
+        filled.push_str(rest);
+        output.push_str(&filled);
+        output.push('\n');
+    }
+    Ok(output)
+}
+
+/// `nvs_partition_gen generate` writing the image of `csv` to `output`: the
+/// script of the ESP-IDF in `IDF_PATH`, else the `esp-idf-nvs-partition-gen` package
+pub fn generator_command(csv: &Path, output: &Path, size: u32) -> Command {
+    let script = std::env::var_os("IDF_PATH")
+        .map(|idf_path| PathBuf::from(idf_path).join(IDF_GENERATOR))
+        .filter(|script| script.exists());
+    let mut command = Command::new(find_python());
+    match script {
+        Some(script) => command.arg(script),
+        None => command.args(["-m", "esp_idf_nvs_partition_gen"]),
+    };
+    command
+        .arg("generate")
+        .arg(csv)
+        .arg(output)
+        .arg(format!("0x{:x}", size));
+    command
+}
+
+/// `port` as part of a file name, e.g. `_dev_ttyUSB0`
+pub fn port_slug(port: &str) -> String {
+    port.chars()
+        .map(|c| if c.is_ascii_alphanumeric() { c } else { '_' })
+        .collect()
+}
+
+/// MAC address of the device on `port`, read from the chip
+async fn read_mac(port: &str) -> Option<String> {
+    match identify_esp_board(port).await {
+        Ok(info) => info.map(|info| info.mac_address),
+        Err(e) => {
+            log::warn!("Failed to read the MAC address on {}: {}", port, e);
+            None
+        }
+    }
+}
+
+/// Generate the board's NVS image for the device on `port`, if the board
+/// declares one, as a binary to flash with its other images
+pub async fn prepare_nvs_image(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    port: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<Option<FlashBinaryInfo>> {
+    let Some(image) = ProjectConfig::load(project_dir)?
+        .as_ref()
+        .and_then(|config| config.board_section(&board_config.name))
+        .and_then(|section| section.nvs.clone())
+    else {
+        return Ok(None);
+    };
+    let partitions = board_partitions(project_dir, board_config)?;
+    let partition = find_partition(
+        &partitions,
+        image.partition.as_deref().unwrap_or(NVS_PARTITION),
+    )?;
+
+    // Devices keyed by MAC address are told apart by asking the chip
+    let mut mac_address = None;
+    if image.devices.keys().any(|key| is_mac(key)) {
+        mac_address = read_mac(port).await;
+    }
+    let device = device_entry(&image, port, mac_address.as_deref());
+    let csv_path = project_dir.join(
+        device
+            .and_then(|(_, device)| device.csv.as_deref())
+            .unwrap_or(image.csv.as_str()),
+    );
+    let content = std::fs::read_to_string(&csv_path)
+        .with_context(|| format!("Failed to read NVS CSV {}", csv_path.display()))?;
+    if mac_address.is_none() && content.contains("${MAC}") {
+        mac_address = read_mac(port).await;
+    }
+
+    // A provisioned device's identity is required to know which device got it
+    let identity = match &image.provision {
+        Some(provisioning) => {
+            if mac_address.is_none() {
+                mac_address = read_mac(port).await;
+            }
+            let mac = mac_address.as_deref().ok_or_else(|| {
+                anyhow::anyhow!(
+                    "Can't read the MAC address on {}, not provisioning {}",
+                    port,
+                    board_config.name
+                )
+            })?;
+            Some(provision_device(project_dir, board_config, provisioning, port, mac, tx).await?)
+        }
+        None => None,
+    };
+
+    let rendered = substitute(&content, |name| {
+        device
+            .and_then(|(_, device)| device.values.get(name))
+            .or_else(|| identity.as_ref()?.values.get(name))
+            .or_else(|| image.values.get(name))
+            .cloned()
+            .or_else(|| match name {
+                "BOARD" => Some(board_config.name.clone()),
+                "PORT" => Some(port.to_string()),
+                "MAC" => mac_address.clone(),
+                _ => None,
+            })
+            .or_else(|| std::env::var(name).ok())
+    })
+    .with_context(|| format!("Failed to fill in {}", csv_path.display()))?;
+
+    // Devices flashed at once each get their own files
+    let slug = port_slug(port);
+    let nvs_dir = board_config.build_dir.join("nvs");
+    std::fs::create_dir_all(&nvs_dir)
+        .with_context(|| format!("Failed to create {}", nvs_dir.display()))?;
+    let rendered_csv = nvs_dir.join(format!("{}-{}.csv", partition.label, slug));
+    let output = nvs_dir.join(format!("{}-{}.bin", partition.label, slug));
+    std::fs::write(&rendered_csv, rendered)
+        .with_context(|| format!("Failed to write {}", rendered_csv.display()))?;
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "📇 Generating the {} image (0x{:x}, {} KB) from {}{}",
+            partition.label,
+            partition.offset,
+            partition.size / 1024,
+            csv_path.display(),
+            device
+                .map(|(key, _)| format!(" for {}", key))
+                .unwrap_or_default()
+        ),
+    ));
+    run_flash_tool(
+        generator_command(&rendered_csv, &output, partition.size),
+        "nvs_partition_gen",
+        &board_config.name,
+        Some(tx),
+        |_| None,
+    )
+    .await?;
+
+    Ok(Some(FlashBinaryInfo {
+        name: partition.label.clone(),
+        file_name: output
+            .file_name()
+            .map(|name| name.to_string_lossy().to_string())
+            .unwrap_or_default(),
+        file_path: output,
+        offset: partition.offset,
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::HashMap;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_nvs_image_values() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+boards:
+  sensor:
+    nvs:
+      csv: provisioning/nvs.csv
+      values:
+        WIFI_SSID: lab
+      devices:
+        "7C:DF:A1:00:00:01":
+          values:
+            DEVICE_ID: sensor-001
+        /dev/ttyUSB1:
+          csv: provisioning/spare.csv
+"#,
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        let image = config.board_section("sensor").unwrap().nvs.clone().unwrap();
+        assert_eq!(image.csv, "provisioning/nvs.csv");
+        assert_eq!(image.partition, None);
+
+        // Devices are found by MAC address in any notation, or by port
+        let (key, device) =
+            device_entry(&image, "/dev/ttyUSB0", Some("7c-df-a1-00-00-01")).unwrap();
+        assert_eq!(key, "7C:DF:A1:00:00:01");
+        assert_eq!(device.values["DEVICE_ID"], "sensor-001");
+        let (_, spare) = device_entry(&image, "/dev/ttyUSB1", None).unwrap();
+        assert_eq!(spare.csv.as_deref(), Some("provisioning/spare.csv"));
+        assert!(device_entry(&image, "/dev/ttyUSB2", Some("7c:df:a1:00:00:02")).is_none());
+
+        let values = HashMap::from([
+            ("WIFI_SSID", "lab"),
+            ("WIFI_PASS", "a,b\"c"),
+            ("DEVICE_ID", "sensor-001"),
+        ]);
+        let lookup = |name: &str| values.get(name).map(|v| v.to_string());
+        let csv = "key,type,encoding,value\nwifi,namespace,,\nssid,data,string,${WIFI_SSID}\npass,data,string,${WIFI_PASS}\nname,data,string,node-${DEVICE_ID}\n";
+        assert_eq!(
+            substitute(csv, lookup).unwrap(),
+            "key,type,encoding,value\nwifi,namespace,,\nssid,data,string,lab\npass,data,string,\"a,b\"\"c\"\nname,data,string,node-sensor-001\n"
+        );
+        let error = substitute("id,data,string,${SERIAL}\n", lookup).unwrap_err();
+        assert!(error.to_string().contains("${SERIAL}"));
+
+        let command = generator_command(Path::new("nvs.csv"), Path::new("nvs.bin"), 0x6000);
+        let args: Vec<String> = command
+            .as_std()
+            .get_args()
+            .map(|arg| arg.to_string_lossy().to_string())
+            .collect();
+        assert!(args.ends_with(&[
+            "generate".to_string(),
+            "nvs.csv".to_string(),
+            "nvs.bin".to_string(),
+            "0x6000".to_string(),
+        ]));
+    }
+}
@@ -0,0 +1,505 @@
+//! Over-the-air updates of devices running an app built by espbrew
+//!
+//! `espbrew ota deploy` and the TUI give the app binary of a board to every
+//! device the `ota:` section of `espbrew.yaml` lists for it. A device with an
+//! `upload` endpoint gets the binary POSTed. A device that updates the
+//! standard ESP-IDF way, downloading the image itself with `esp_https_ota`,
+//! is told to through its `trigger` URL or `trigger_command`, e.g. an MQTT
+//! publish, and downloads it from the server espbrew runs meanwhile.
+//!
+//! That server speaks plain HTTP, which `esp_https_ota` only accepts in apps
+//! built with `CONFIG_ESP_HTTPS_OTA_ALLOW_HTTP=y`; other apps need a
+//! `public_url` of an HTTPS proxy in front of it.
+
+use anyhow::{Context, Result};
+use bytes::Bytes;
+use futures_util::StreamExt;
+use std::collections::HashMap;
+use std::net::{IpAddr, SocketAddr};
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::process::Command;
+use tokio::sync::{mpsc, watch};
+use warp::Filter;
+use warp::http::{Response, StatusCode, header};
+use warp::hyper::Body;
+
+use crate::config::{OtaDevice, OtaSection};
+use crate::models::{AppEvent, OtaStatus, ProjectBoardConfig};
+use crate::projects::build_plan::PlannedCommand;
+use crate::utils::process_group;
+
+/// Address the images are served on when the `ota:` section sets none
+pub const DEFAULT_SERVE: &str = "0.0.0.0:8070";
+
+/// Time a device has to receive its image when the `ota:` section sets none
+pub const DEFAULT_TIMEOUT: Duration = Duration::from_secs(300);
+
+/// Bytes sent at once, and so the granularity of the download progress
+const CHUNK_SIZE: usize = 16 * 1024;
+
+/// How a device gets its image
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum OtaMethod {
+    /// POST the binary to this endpoint
+    Upload(String),
+    /// Request this URL, then wait for the device to download the image
+    Trigger(String),
+    /// Run this shell command, then wait for the device to download the image
+    Command(String),
+}
+
+impl OtaMethod {
+    pub fn of(device: &OtaDevice) -> Result<Self> {
+        match (&device.upload, &device.trigger, &device.trigger_command) {
+            (Some(url), None, None) => Ok(OtaMethod::Upload(url.clone())),
+            (None, Some(url), None) => Ok(OtaMethod::Trigger(url.clone())),
+            (None, None, Some(command)) => Ok(OtaMethod::Command(command.clone())),
+            (None, None, None) => Err(anyhow::anyhow!(
+                "OTA device {} has neither upload, trigger nor trigger_command",
+                device.name
+            )),
+            _ => Err(anyhow::anyhow!(
+                "OTA device {} may have only one of upload, trigger and trigger_command",
+                device.name
+            )),
+        }
+    }
+
+    /// Whether the device downloads the image from espbrew
+    pub fn downloads(&self) -> bool {
+        !matches!(self, OtaMethod::Upload(_))
+    }
+}
+
+/// A device and the app binary it gets
+#[derive(Debug, Clone)]
+pub struct OtaTarget {
+    pub device: OtaDevice,
+    pub method: OtaMethod,
+    pub image: PathBuf,
+}
+
+/// App binary of an ESP-IDF build: the `app_bin` of its project description,
+/// else the image written by `flash_app_args`
+pub fn find_app_binary(build_dir: &Path) -> Option<PathBuf> {
+    let from_description = std::fs::read_to_string(build_dir.join("project_description.json"))
+        .ok()
+        .and_then(|text| serde_json::from_str::<serde_json::Value>(&text).ok())
+        .and_then(|description| Some(build_dir.join(description.get("app_bin")?.as_str()?)));
+    if let Some(binary) = from_description.filter(|binary| binary.exists()) {
+        return Some(binary);
+    }
+
+    let args = std::fs::read_to_string(build_dir.join("flash_app_args")).ok()?;
+    let binary = build_dir.join(args.split_whitespace().last()?);
+    binary.exists().then_some(binary)
+}
+
+/// Devices of the `ota:` section on the board and device names given, or
+/// all of them, each with its board's app binary
+pub fn plan_rollout(
+    section: &OtaSection,
+    boards: &[ProjectBoardConfig],
+    board_names: &[String],
+    device_names: &[String],
+) -> Result<Vec<OtaTarget>> {
+    section
+        .devices
+        .iter()
+        .filter(|device| board_names.is_empty() || board_names.contains(&device.board))
+        .filter(|device| device_names.is_empty() || device_names.contains(&device.name))
+        .map(|device| {
+            let board = boards
+                .iter()
+                .find(|board| board.name == device.board)
+                .ok_or_else(|| {
+                    anyhow::anyhow!(
+                        "OTA device {} runs board {}, which the project doesn't have",
+                        device.name,
+                        device.board
+                    )
+                })?;
+            let image = find_app_binary(&board.build_dir).ok_or_else(|| {
+                anyhow::anyhow!(
+                    "No app binary in {}, build {} first",
+                    board.build_dir.display(),
+                    board.name
+                )
+            })?;
+            Ok(OtaTarget {
+                device: device.clone(),
+                method: OtaMethod::of(device)?,
+                image,
+            })
+        })
+        .collect()
+}
+
+/// URL a device downloads its image from
+pub fn image_url(base_url: &str, device_name: &str) -> String {
+    format!("{}/ota/{}.bin", base_url.trim_end_matches('/'), device_name)
+}
+
+/// Base URL of the images served on `bound`
+pub fn public_url(section: &OtaSection, bound: SocketAddr) -> String {
+    if let Some(url) = &section.public_url {
+        return url.trim_end_matches('/').to_string();
+    }
+    let ip = if bound.ip().is_unspecified() {
+        lan_address().unwrap_or(bound.ip())
+    } else {
+        bound.ip()
+    };
+    format!("http://{}", SocketAddr::new(ip, bound.port()))
+}
+
+/// Address of the interface this machine reaches the network through
+fn lan_address() -> Option<IpAddr> {
+    // Connecting a UDP socket sends nothing, it only picks the interface
+    let socket = std::net::UdpSocket::bind("0.0.0.0:0").ok()?;
+    socket.connect("192.0.2.1:80").ok()?;
+    Some(socket.local_addr().ok()?.ip())
+}
+
+/// Image served to a device, with the download progress for its deploy task
+struct ServedImage {
+    data: Bytes,
+    progress: watch::Sender<OtaStatus>,
+}
+
+/// GET /ota/<device>.bin - The image of a device, reporting the share sent
+fn image_route(
+    images: Arc<HashMap<String, ServedImage>>,
+) -> impl Filter<Extract = (Response<Body>,), Error = warp::Rejection> + Clone {
+    warp::path!("ota" / String)
+        .and(warp::get())
+        .map(move |file: String| {
+            let name = file.strip_suffix(".bin").unwrap_or(&file);
+            let Some(image) = images.get(name) else {
+                return Response::builder()
+                    .status(StatusCode::NOT_FOUND)
+                    .body(Body::empty())
+                    .unwrap();
+            };
+
+            let data = image.data.clone();
+            let total = data.len();
+            let images = images.clone();
+            let name = name.to_string();
+            let chunks =
+                futures_util::stream::iter((0..total).step_by(CHUNK_SIZE)).map(move |start| {
+                    let end = (start + CHUNK_SIZE).min(total);
+                    images[&name].progress.send_replace(if end == total {
+                        OtaStatus::Done
+                    } else {
+                        OtaStatus::Downloading((end * 100 / total) as u8)
+                    });
+                    Ok::<_, std::io::Error>(data.slice(start..end))
+                });
+            Response::builder()
+                .header(header::CONTENT_TYPE, "application/octet-stream")
+                .header(header::CONTENT_LENGTH, total)
+                .body(Body::wrap_stream(chunks))
+                .unwrap()
+        })
+}
+
+/// Deploy to every target at once, reporting each device's status as an
+/// `OtaStatusChanged`. Returns the names of the devices that failed.
+pub async fn deploy(
+    project_dir: &Path,
+    section: &OtaSection,
+    targets: Vec<OtaTarget>,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<String>> {
+    let timeout = section
+        .timeout_secs
+        .map(Duration::from_secs)
+        .unwrap_or(DEFAULT_TIMEOUT);
+
+    let mut prepared = Vec::new();
+    let mut images = HashMap::new();
+    for target in targets {
+        let data = Bytes::from(
+            std::fs::read(&target.image)
+                .with_context(|| format!("Failed to read {}", target.image.display()))?,
+        );
+        let (progress, progress_rx) = watch::channel(OtaStatus::Pending);
+        if target.method.downloads() {
+            images.insert(
+                target.device.name.clone(),
+                ServedImage {
+                    data: data.clone(),
+                    progress,
+                },
+            );
+        }
+        let _ = tx.send(AppEvent::OtaStatusChanged(
+            target.device.name.clone(),
+            OtaStatus::Pending,
+        ));
+        prepared.push((target, data, progress_rx));
+    }
+
+    // Devices that download their image get it from a server living as long as the rollout
+    let mut server = None;
+    let mut base_url = String::new();
+    if !images.is_empty() {
+        let serve = section.serve.as_deref().unwrap_or(DEFAULT_SERVE);
+        let address: SocketAddr = serve
+            .parse()
+            .with_context(|| format!("Invalid ota.serve '{}', expected host:port", serve))?;
+        let (bound, future) =
+            warp::serve(image_route(Arc::new(images))).try_bind_ephemeral(address)?;
+        server = Some(tokio::spawn(future));
+        base_url = public_url(section, bound);
+        log::info!("🌐 Serving OTA images on {}", base_url);
+    }
+
+    let tasks: Vec<_> = prepared
+        .into_iter()
+        .map(|(target, data, progress)| {
+            let project_dir = project_dir.to_path_buf();
+            let url = image_url(&base_url, &target.device.name);
+            let tx = tx.clone();
+            tokio::spawn(async move {
+                let name = target.device.name.clone();
+                let report = |status: OtaStatus| {
+                    let _ = tx.send(AppEvent::OtaStatusChanged(name.clone(), status));
+                };
+                let result = deploy_device(
+                    &project_dir,
+                    &target,
+                    data,
+                    &url,
+                    progress,
+                    &report,
+                    timeout,
+                )
+                .await;
+                if let Err(e) = &result {
+                    report(OtaStatus::Failed(format!("{:#}", e)));
+                }
+                (name, result.is_ok())
+            })
+        })
+        .collect();
+    drop(tx);
+
+    let mut failed = Vec::new();
+    for task in tasks {
+        match task.await {
+            Ok((_, true)) => {}
+            Ok((name, false)) => failed.push(name),
+            Err(e) => log::error!("❌ OTA task failed: {}", e),
+        }
+    }
+    if let Some(server) = server {
+        server.abort();
+    }
+    Ok(failed)
+}
+
+async fn deploy_device(
+    project_dir: &Path,
+    target: &OtaTarget,
+    data: Bytes,
+    image_url: &str,
+    mut progress: watch::Receiver<OtaStatus>,
+    report: &impl Fn(OtaStatus),
+    timeout: Duration,
+) -> Result<()> {
+    let client = reqwest::Client::builder()
+        .danger_accept_invalid_certs(target.device.insecure)
+        .timeout(timeout)
+        .build()?;
+
+    match &target.method {
+        OtaMethod::Upload(url) => {
+            report(OtaStatus::Uploading);
+            client
+                .post(url)
+                .header("Content-Type", "application/octet-stream")
+                .body(data)
+                .send()
+                .await
+                .and_then(|response| response.error_for_status())
+                .with_context(|| format!("Upload to {} failed", url))?;
+            report(OtaStatus::Done);
+            return Ok(());
+        }
+        OtaMethod::Trigger(url) => {
+            let url = url.replace("{url}", image_url);
+            client
+                .get(&url)
+                .send()
+                .await
+                .and_then(|response| response.error_for_status())
+                .with_context(|| format!("Trigger {} failed", url))?;
+        }
+        OtaMethod::Command(command) => {
+            let planned =
+                PlannedCommand::shell("ota", project_dir, &command.replace("{url}", image_url))
+                    .env("ESPBREW_OTA_URL", image_url)
+                    .env("ESPBREW_OTA_DEVICE", target.device.name.clone());
+            let mut cmd = Command::new(&planned.program);
+            cmd.args(&planned.args)
+                .current_dir(project_dir)
+                .envs(&planned.env);
+            let output = process_group::output(&mut cmd)
+                .await
+                .with_context(|| format!("Failed to run '{}'", command))?;
+            if !output.status.success() {
+                return Err(anyhow::anyhow!(
+                    "Trigger command failed with {}: {}",
+                    output.status,
+                    String::from_utf8_lossy(&output.stderr).trim()
+                ));
+            }
+        }
+    }
+    report(OtaStatus::Triggered);
+
+    // A device quicker than the trigger call has its progress waiting already
+    let download = async {
+        loop {
+            progress.changed().await?;
+            let status = progress.borrow_and_update().clone();
+            report(status.clone());
+            if status == OtaStatus::Done {
+                return Ok::<_, anyhow::Error>(());
+            }
+        }
+    };
+    tokio::time::timeout(timeout, download)
+        .await
+        .map_err(|_| anyhow::anyhow!("didn't download its image within {}s", timeout.as_secs()))?
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::ProjectConfig;
+    use crate::models::ProjectType;
+    use std::fs;
+    use std::sync::Mutex;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_ota_deploy() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        let build_dir = project.join("build.sensor");
+        fs::create_dir_all(&build_dir).unwrap();
+        let board = ProjectBoardConfig {
+            name: "sensor".to_string(),
+            config_file: project.join("sdkconfig.defaults.sensor"),
+            build_dir: build_dir.clone(),
+            target: Some("esp32c6".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+
+        // Nothing built yet
+        assert_eq!(find_app_binary(&build_dir), None);
+        fs::write(build_dir.join("flash_app_args"), "0x10000 old.bin\n").unwrap();
+        fs::write(build_dir.join("old.bin"), b"old").unwrap();
+        assert_eq!(find_app_binary(&build_dir), Some(build_dir.join("old.bin")));
+        let image: Vec<u8> = (0..40_000u32).map(|i| i as u8).collect();
+        fs::write(build_dir.join("sensor.bin"), &image).unwrap();
+        fs::write(
+            build_dir.join("project_description.json"),
+            r#"{"app_bin": "sensor.bin"}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            find_app_binary(&build_dir),
+            Some(build_dir.join("sensor.bin"))
+        );
+
+        // A fake device taking uploads, and one downloading the image it is told about
+        let uploaded = Arc::new(Mutex::new(Vec::new()));
+        let downloaded = Arc::new(Mutex::new(Vec::new()));
+        let upload = {
+            let uploaded = uploaded.clone();
+            warp::path("ota")
+                .and(warp::post())
+                .and(warp::body::bytes())
+                .map(move |body: bytes::Bytes| {
+                    uploaded.lock().unwrap().extend_from_slice(&body);
+                    "ok"
+                })
+        };
+        let update = {
+            let downloaded = downloaded.clone();
+            warp::path("update")
+                .and(warp::query::<std::collections::HashMap<String, String>>())
+                .map(move |query: std::collections::HashMap<String, String>| {
+                    let url = query["url"].clone();
+                    let downloaded = downloaded.clone();
+                    tokio::spawn(async move {
+                        let body = reqwest::get(&url).await.unwrap().bytes().await.unwrap();
+                        downloaded.lock().unwrap().extend_from_slice(&body);
+                    });
+                    "downloading"
+                })
+        };
+        let (device, server) = warp::serve(upload.or(update)).bind_ephemeral(([127, 0, 0, 1], 0));
+        tokio::spawn(server);
+
+        fs::write(
+            project.join("espbrew.yaml"),
+            format!(
+                "ota:\n  serve: 127.0.0.1:0\n  timeout_secs: 10\n  devices:\n    \
+                 - name: hall\n      board: sensor\n      upload: http://{device}/ota\n    \
+                 - name: garage\n      board: sensor\n      trigger: http://{device}/update?url={{url}}\n    \
+                 - name: attic\n      board: sensor\n      upload: http://{device}/ota\n      \
+                 trigger: http://{device}/update\n    \
+                 - name: shed\n      board: display\n      upload: http://{device}/ota\n"
+            ),
+        )
+        .unwrap();
+        let section = ProjectConfig::load(project).unwrap().unwrap().ota;
+        assert_eq!(section.devices.len(), 4);
+
+        // A device needs exactly one method, and a board of the project
+        assert!(OtaMethod::of(&section.devices[2]).is_err());
+        assert!(plan_rollout(&section, &[board.clone()], &[], &[]).is_err());
+        let targets = plan_rollout(
+            &section,
+            &[board.clone()],
+            &[],
+            &["hall".to_string(), "garage".to_string()],
+        )
+        .unwrap();
+        assert_eq!(targets.len(), 2);
+        assert!(!targets[0].method.downloads());
+        assert!(targets[1].method.downloads());
+
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+        let failed = deploy(project, &section, targets, tx).await.unwrap();
+        assert!(failed.is_empty());
+        assert_eq!(*uploaded.lock().unwrap(), image);
+        // The device may still be reading the last chunk
+        for _ in 0..100 {
+            if downloaded.lock().unwrap().len() == image.len() {
+                break;
+            }
+            tokio::time::sleep(std::time::Duration::from_millis(20)).await;
+        }
+        assert_eq!(*downloaded.lock().unwrap(), image);
+
+        let mut garage = Vec::new();
+        while let Some(event) = rx.recv().await {
+            if let AppEvent::OtaStatusChanged(name, status) = event
+                && name == "garage"
+            {
+                garage.push(status);
+            }
+        }
+        assert_eq!(garage.first(), Some(&OtaStatus::Pending));
+        assert!(garage.contains(&OtaStatus::Triggered));
+        assert_eq!(garage.last(), Some(&OtaStatus::Done));
+    }
+}
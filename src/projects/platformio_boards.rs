@@ -0,0 +1,360 @@
+//! Board configurations imported from PlatformIO board manifests for `espbrew boards import`
+//!
+//! PlatformIO describes every board in `platforms/<platform>/boards/<id>.json`
+//! below its core directory. The MCU, flash and PSRAM settings become an
+//! `sdkconfig.defaults.<name>` file and the upload speed goes to the board's
+//! entry in `espbrew.yaml`.
+
+use anyhow::{Context, Result};
+use serde::Deserialize;
+use std::path::{Path, PathBuf};
+
+use crate::config::project_config::PROJECT_CONFIG_FILE;
+use crate::config::{BoardMetadata, PsramMode};
+
+/// Chips ESP-IDF can build for
+const ESP_IDF_CHIPS: &[&str] = &[
+    "esp32", "esp32s2", "esp32s3", "esp32c2", "esp32c3", "esp32c5", "esp32c6", "esp32c61",
+    "esp32h2", "esp32p4",
+];
+
+/// The parts of a PlatformIO board manifest espbrew uses
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct PioBoardManifest {
+    #[serde(default)]
+    pub name: String,
+    #[serde(default)]
+    pub build: PioBuild,
+    #[serde(default)]
+    pub upload: PioUpload,
+}
+
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct PioBuild {
+    #[serde(default)]
+    pub mcu: String,
+    /// Flash frequency in Hz, e.g. `80000000L`
+    #[serde(default)]
+    pub f_flash: Option<String>,
+    #[serde(default)]
+    pub flash_mode: Option<String>,
+    /// Compiler flags, a list or a single space separated string
+    #[serde(default)]
+    pub extra_flags: Option<serde_json::Value>,
+    #[serde(default)]
+    pub arduino: PioArduino,
+}
+
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct PioArduino {
+    /// Flash and PSRAM modes, e.g. `qio_opi`
+    #[serde(default)]
+    pub memory_type: Option<String>,
+}
+
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct PioUpload {
+    /// e.g. `8MB`
+    #[serde(default)]
+    pub flash_size: Option<String>,
+    /// Upload baud rate
+    #[serde(default)]
+    pub speed: Option<u32>,
+}
+
+impl PioBoardManifest {
+    /// Read a board manifest
+    pub fn load(path: &Path) -> Result<Self> {
+        let content = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        serde_json::from_str(&content)
+            .with_context(|| format!("Failed to parse {}", path.display()))
+    }
+
+    /// Chip as used for `IDF_TARGET`
+    pub fn chip(&self) -> String {
+        self.build.mcu.to_lowercase().replace('-', "")
+    }
+
+    fn extra_flags(&self) -> Vec<String> {
+        match &self.build.extra_flags {
+            Some(serde_json::Value::String(flags)) => {
+                flags.split_whitespace().map(String::from).collect()
+            }
+            Some(serde_json::Value::Array(flags)) => flags
+                .iter()
+                .filter_map(|flag| flag.as_str())
+                .flat_map(|flags| flags.split_whitespace().map(String::from))
+                .collect(),
+            _ => Vec::new(),
+        }
+    }
+
+    /// PSRAM of the board; boards without `BOARD_HAS_PSRAM` keep the chip default
+    pub fn psram(&self) -> Option<PsramMode> {
+        if !self.extra_flags().iter().any(|f| f == "-DBOARD_HAS_PSRAM") {
+            return None;
+        }
+        match self.build.arduino.memory_type.as_deref() {
+            Some(memory) if memory.ends_with("_opi") => Some(PsramMode::Octal),
+            Some(_) => Some(PsramMode::Quad),
+            None => Some(PsramMode::Enabled),
+        }
+    }
+
+    /// Hardware metadata of the board
+    pub fn metadata(&self) -> BoardMetadata {
+        BoardMetadata {
+            chip: Some(self.chip()),
+            flash_size: self.upload.flash_size.clone(),
+            psram: self.psram(),
+            upload_speed: self.upload.speed,
+            ..Default::default()
+        }
+    }
+
+    /// Contents of the board's `sdkconfig.defaults.<name>` file
+    pub fn sdkconfig_defaults(&self, board_id: &str) -> String {
+        let mut content = format!(
+            "# {} (PlatformIO board {})\n# Generated by espbrew boards import\n",
+            self.name, board_id
+        );
+        for option in self.metadata().sdkconfig_options(None) {
+            content.push_str(&option.to_line());
+            content.push('\n');
+        }
+
+        if let Some(mode) = &self.build.flash_mode {
+            content.push_str(&format!(
+                "CONFIG_ESPTOOLPY_FLASHMODE_{}=y\n",
+                mode.to_uppercase()
+            ));
+        }
+        let megahertz = self
+            .build
+            .f_flash
+            .as_deref()
+            .and_then(|hz| hz.trim_end_matches(['L', 'l']).parse::<u64>().ok())
+            .map(|hz| hz / 1_000_000);
+        if let Some(megahertz) = megahertz {
+            content.push_str(&format!("CONFIG_ESPTOOLPY_FLASHFREQ_{}M=y\n", megahertz));
+        }
+
+        content
+    }
+}
+
+/// Manifest of a PlatformIO board: a path to a `.json` file, the project's own
+/// `boards/` directory, or the boards of the installed PlatformIO platforms
+pub fn find_board_manifest(project_dir: &Path, board: &str) -> Result<PathBuf> {
+    let path = Path::new(board);
+    if path.extension().is_some_and(|ext| ext == "json") && path.exists() {
+        return Ok(path.to_path_buf());
+    }
+
+    let file_name = format!("{}.json", board);
+    let local = project_dir.join("boards").join(&file_name);
+    if local.exists() {
+        return Ok(local);
+    }
+
+    let core_dir = std::env::var_os("PLATFORMIO_CORE_DIR")
+        .map(PathBuf::from)
+        .or_else(|| dirs::home_dir().map(|home| home.join(".platformio")))
+        .ok_or_else(|| anyhow::anyhow!("Unable to locate the PlatformIO core directory"))?;
+    let pattern = core_dir
+        .join("platforms")
+        .join("*")
+        .join("boards")
+        .join(&file_name);
+    glob::glob(&pattern.to_string_lossy())?
+        .flatten()
+        .next()
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "PlatformIO board '{}' not found in {} (is the platform installed?)",
+                board,
+                core_dir.join("platforms").display()
+            )
+        })
+}
+
+/// Write the board configuration for a PlatformIO board to an ESP-IDF project.
+///
+/// Returns the files written or updated.
+pub fn import_platformio_board(
+    project_dir: &Path,
+    manifest: &PioBoardManifest,
+    board_id: &str,
+    board_name: Option<&str>,
+) -> Result<Vec<PathBuf>> {
+    if !project_dir.join("CMakeLists.txt").exists() {
+        return Err(anyhow::anyhow!(
+            "{} is not an ESP-IDF project (expected CMakeLists.txt)",
+            project_dir.display()
+        ));
+    }
+
+    let chip = manifest.chip();
+    if !ESP_IDF_CHIPS.contains(&chip.as_str()) {
+        return Err(anyhow::anyhow!(
+            "PlatformIO board '{}' uses {}, which ESP-IDF doesn't support",
+            board_id,
+            manifest.build.mcu
+        ));
+    }
+
+    let board_name = board_name.unwrap_or(board_id);
+    if board_name.contains('/') {
+        return Err(anyhow::anyhow!(
+            "Board name '{}' must not contain '/'",
+            board_name
+        ));
+    }
+
+    let config_file = project_dir.join(format!("sdkconfig.defaults.{}", board_name));
+    if config_file.exists() {
+        return Err(anyhow::anyhow!(
+            "Board configuration {} already exists",
+            config_file.display()
+        ));
+    }
+    std::fs::write(&config_file, manifest.sdkconfig_defaults(board_id))
+        .with_context(|| format!("Failed to write {}", config_file.display()))?;
+
+    let mut written = vec![config_file];
+    if let Some(speed) = manifest.upload.speed {
+        let config_path = project_dir.join(PROJECT_CONFIG_FILE);
+        if add_board_upload_speed(&config_path, board_name, speed)? {
+            written.push(config_path);
+        }
+    }
+
+    Ok(written)
+}
+
+/// Add `upload_speed` for a board to `espbrew.yaml`, keeping the rest of the file untouched.
+///
+/// Returns `false` if the board already has an entry.
+fn add_board_upload_speed(config_path: &Path, board_name: &str, speed: u32) -> Result<bool> {
+    let content = if config_path.exists() {
+        std::fs::read_to_string(config_path)
+            .with_context(|| format!("Failed to read {}", config_path.display()))?
+    } else {
+        String::new()
+    };
+
+    let mut lines: Vec<String> = content.lines().map(|l| l.to_string()).collect();
+    let boards_line = lines.iter().position(|l| l.trim_end() == "boards:");
+    let board_key = format!("  {}:", board_name);
+    if let Some(index) = boards_line
+        && lines[index + 1..]
+            .iter()
+            .take_while(|l| l.is_empty() || l.starts_with(' '))
+            .any(|l| l.trim_end() == board_key)
+    {
+        return Ok(false);
+    }
+
+    let entry = [board_key, format!("    upload_speed: {}", speed)];
+    match boards_line {
+        Some(index) => {
+            lines.splice(index + 1..index + 1, entry);
+        }
+        None => {
+            if !lines.is_empty() {
+                lines.push(String::new());
+            }
+            lines.push("boards:".to_string());
+            lines.extend(entry);
+        }
+    }
+
+    let mut updated = lines.join("\n");
+    updated.push('\n');
+    std::fs::write(config_path, updated)
+        .with_context(|| format!("Failed to write {}", config_path.display()))?;
+    Ok(true)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_import_platformio_board() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "# Project settings\nboards:\n  other:\n    tags: [lab]\n",
+        )
+        .unwrap();
+        fs::create_dir_all(project.join("boards")).unwrap();
+        fs::write(
+            project.join("boards").join("esp32-s3-devkitc-1-n8r8.json"),
+            r#"{
+  "build": {
+    "arduino": { "memory_type": "qio_opi" },
+    "core": "esp32",
+    "extra_flags": ["-DARDUINO_ESP32S3_DEV", "-DBOARD_HAS_PSRAM"],
+    "f_flash": "80000000L",
+    "flash_mode": "qio",
+    "mcu": "esp32s3"
+  },
+  "name": "Espressif ESP32-S3-DevKitC-1-N8R8",
+  "upload": { "flash_size": "8MB", "speed": 921600 }
+}"#,
+        )
+        .unwrap();
+
+        let path = find_board_manifest(project, "esp32-s3-devkitc-1-n8r8").unwrap();
+        let manifest = PioBoardManifest::load(&path).unwrap();
+        assert_eq!(manifest.psram(), Some(PsramMode::Octal));
+
+        let files = import_platformio_board(
+            project,
+            &manifest,
+            "esp32-s3-devkitc-1-n8r8",
+            Some("devkit"),
+        )
+        .unwrap();
+        assert_eq!(files.len(), 2);
+
+        let content = fs::read_to_string(project.join("sdkconfig.defaults.devkit")).unwrap();
+        assert!(content.contains("CONFIG_IDF_TARGET=\"esp32s3\""));
+        assert!(content.contains("CONFIG_ESPTOOLPY_FLASHSIZE_8MB=y"));
+        assert!(content.contains("CONFIG_SPIRAM_MODE_OCT=y"));
+        assert!(content.contains("CONFIG_ESPTOOLPY_FLASHMODE_QIO=y"));
+        assert!(content.contains("CONFIG_ESPTOOLPY_FLASHFREQ_80M=y"));
+
+        // The upload speed lands next to the existing boards
+        let yaml = fs::read_to_string(project.join("espbrew.yaml")).unwrap();
+        assert!(yaml.starts_with("# Project settings\n"));
+        assert_eq!(
+            BoardMetadata::load(project, "devkit").upload_speed,
+            Some(921600)
+        );
+
+        assert!(
+            import_platformio_board(
+                project,
+                &manifest,
+                "esp32-s3-devkitc-1-n8r8",
+                Some("devkit")
+            )
+            .is_err()
+        );
+        let esp8266 = PioBoardManifest {
+            build: PioBuild {
+                mcu: "esp8266".to_string(),
+                ..Default::default()
+            },
+            ..Default::default()
+        };
+        assert!(import_platformio_board(project, &esp8266, "nodemcuv2", None).is_err());
+    }
+}
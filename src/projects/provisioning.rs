@@ -0,0 +1,439 @@
+//! Unique identities baked into each device's NVS image
+//!
+//! A `provision:` source in a board's `nvs:` section hands every device
+//! flashed its own placeholder values, e.g. a serial number, keys or the
+//! paths of its certificates, from a CSV of identities or from a command:
+//!
+//! ```yaml
+//! boards:
+//!   sensor:
+//!     nvs:
+//!       csv: provisioning/nvs.csv
+//!       partition: factory_nvs
+//!       provision:
+//!         identities: provisioning/identities.csv
+//!         # or: command: "./mint-identity --out $ESPBREW_PROVISION_OUTPUT"
+//!         id: SERIAL
+//! ```
+//!
+//! Which device got which identity is appended to `.espbrew/provisioned.jsonl`
+//! by MAC address. A device flashed again gets its recorded identity back, a
+//! new device the first identity of the CSV no device has got yet.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
+use std::io::Write;
+use std::path::{Path, PathBuf};
+use std::sync::Mutex;
+use tokio::sync::mpsc;
+
+use crate::config::Provisioning;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::device_registry::same_mac;
+use crate::projects::hooks::run_shell_command;
+use crate::projects::nvs_image::port_slug;
+
+/// Record of the identities handed out, relative to the project
+pub const PROVISIONING_RECORD: &str = ".espbrew/provisioned.jsonl";
+
+/// Devices flashed at once must not pick the same free identity
+static RECORD_LOCK: Mutex<()> = Mutex::new(());
+
+/// An identity handed to a device
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct ProvisionRecord {
+    pub provisioned: chrono::DateTime<chrono::Local>,
+    pub board: String,
+    pub port: String,
+    pub mac_address: String,
+    pub identity: String,
+}
+
+/// Placeholder values of one device, named by its `id` value
+#[derive(Debug, Clone, PartialEq)]
+pub struct Identity {
+    pub id: String,
+    pub values: BTreeMap<String, String>,
+}
+
+pub fn record_path(project_dir: &Path) -> PathBuf {
+    project_dir.join(PROVISIONING_RECORD)
+}
+
+/// Records of the project, oldest first; unreadable lines are skipped
+pub fn load_records(project_dir: &Path) -> Vec<ProvisionRecord> {
+    std::fs::read_to_string(record_path(project_dir))
+        .map(|content| {
+            content
+                .lines()
+                .filter_map(|line| serde_json::from_str(line).ok())
+                .collect()
+        })
+        .unwrap_or_default()
+}
+
+/// Append a record to the project's record
+pub fn append_record(project_dir: &Path, record: &ProvisionRecord) -> Result<()> {
+    let path = record_path(project_dir);
+    if let Some(parent) = path.parent() {
+        std::fs::create_dir_all(parent)
+            .with_context(|| format!("Failed to create {}", parent.display()))?;
+    }
+    let mut file = std::fs::OpenOptions::new()
+        .create(true)
+        .append(true)
+        .open(&path)
+        .with_context(|| format!("Failed to open {}", path.display()))?;
+    let line = format!("{}\n", serde_json::to_string(record)?);
+    file.write_all(line.as_bytes())
+        .with_context(|| format!("Failed to write {}", path.display()))
+}
+
+/// Identity last recorded for the board's device with `mac_address`
+pub fn recorded_identity<'a>(
+    records: &'a [ProvisionRecord],
+    board_name: &str,
+    mac_address: &str,
+) -> Option<&'a str> {
+    records
+        .iter()
+        .rev()
+        .find(|record| record.board == board_name && same_mac(&record.mac_address, mac_address))
+        .map(|record| record.identity.as_str())
+}
+
+/// Fields of a CSV line; quoted fields may hold commas and `""` quotes
+pub fn split_csv_line(line: &str) -> Vec<String> {
+    let mut fields = Vec::new();
+    let mut field = String::new();
+    let mut quoted = false;
+    let mut chars = line.chars().peekable();
+    while let Some(c) = chars.next() {
+        match c {
+            '"' if quoted && chars.peek() == Some(&'"') => {
+                field.push('"');
+                chars.next();
+            }
+            '"' => quoted = !quoted,
+            ',' if !quoted => fields.push(std::mem::take(&mut field).trim().to_string()),
+            c => field.push(c),
+        }
+    }
+    fields.push(field.trim().to_string());
+    fields
+}
+
+/// Rows of an identities CSV as placeholder name and value pairs, in column order
+pub fn parse_identities(content: &str) -> Result<Vec<Vec<(String, String)>>> {
+    let mut lines = content
+        .lines()
+        .enumerate()
+        .filter(|(_, line)| !line.trim().is_empty() && !line.trim_start().starts_with('#'));
+    let Some((_, header)) = lines.next() else {
+        return Err(anyhow::anyhow!("The identities CSV has no header row"));
+    };
+    let names = split_csv_line(header);
+    lines
+        .map(|(index, line)| {
+            let fields = split_csv_line(line);
+            if fields.len() != names.len() {
+                return Err(anyhow::anyhow!(
+                    "Line {}: {} fields, the header names {}",
+                    index + 1,
+                    fields.len(),
+                    names.len()
+                ));
+            }
+            Ok(names.iter().cloned().zip(fields).collect())
+        })
+        .collect()
+}
+
+/// `NAME=VALUE` lines written by a provisioning command, in order
+pub fn parse_values(content: &str) -> Vec<(String, String)> {
+    content
+        .lines()
+        .map(str::trim)
+        .filter(|line| !line.is_empty() && !line.starts_with('#'))
+        .filter_map(|line| {
+            let (name, value) = line.split_once('=')?;
+            Some((name.trim().to_string(), value.trim().to_string()))
+        })
+        .collect()
+}
+
+/// Identity of the values, named by the `id` placeholder or the first one
+pub fn identity_of(values: Vec<(String, String)>, id: Option<&str>) -> Option<Identity> {
+    let id = match id {
+        Some(id) => values.iter().find(|(name, _)| name == id)?.1.clone(),
+        None => values.first()?.1.clone(),
+    };
+    (!id.is_empty()).then(|| Identity {
+        id,
+        values: values.into_iter().collect(),
+    })
+}
+
+/// Identity of the CSV for the board's device with `mac_address`: the one
+/// recorded for it before, else the first no device has got
+pub fn next_identity(
+    rows: Vec<Vec<(String, String)>>,
+    id: Option<&str>,
+    records: &[ProvisionRecord],
+    board_name: &str,
+    mac_address: &str,
+) -> Result<Identity> {
+    let identities: Vec<Identity> = rows
+        .into_iter()
+        .filter_map(|row| identity_of(row, id))
+        .collect();
+    if let Some(recorded) = recorded_identity(records, board_name, mac_address)
+        && let Some(identity) = identities.iter().find(|identity| identity.id == recorded)
+    {
+        return Ok(identity.clone());
+    }
+    identities
+        .into_iter()
+        .find(|identity| !records.iter().any(|record| record.identity == identity.id))
+        .ok_or_else(|| anyhow::anyhow!("Every identity of the CSV has been handed out"))
+}
+
+/// Identity of the command, which gets the device and any identity recorded
+/// for it in its environment
+async fn command_identity(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    command: &str,
+    id: Option<&str>,
+    port: &str,
+    mac_address: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<Identity> {
+    let nvs_dir = board_config.build_dir.join("nvs");
+    std::fs::create_dir_all(&nvs_dir)
+        .with_context(|| format!("Failed to create {}", nvs_dir.display()))?;
+    let output = nvs_dir.join(format!("provision-{}.env", port_slug(port)));
+    let _ = std::fs::remove_file(&output);
+    let mut env = vec![
+        ("ESPBREW_BOARD".to_string(), board_config.name.clone()),
+        ("ESPBREW_PORT".to_string(), port.to_string()),
+        ("ESPBREW_MAC".to_string(), mac_address.to_string()),
+        (
+            "ESPBREW_PROVISION_OUTPUT".to_string(),
+            output.display().to_string(),
+        ),
+    ];
+    if let Some(recorded) =
+        recorded_identity(&load_records(project_dir), &board_config.name, mac_address)
+    {
+        env.push(("ESPBREW_IDENTITY".to_string(), recorded.to_string()));
+    }
+
+    let status = run_shell_command(project_dir, command, &env, &board_config.name, tx).await?;
+    if !status.success() {
+        return Err(anyhow::anyhow!(
+            "Provisioning command '{}' failed with {}",
+            command,
+            status
+        ));
+    }
+    let content = std::fs::read_to_string(&output).with_context(|| {
+        format!(
+            "Provisioning command '{}' wrote no {}",
+            command,
+            output.display()
+        )
+    })?;
+    identity_of(parse_values(&content), id).ok_or_else(|| {
+        anyhow::anyhow!(
+            "Provisioning command '{}' wrote no {} value",
+            command,
+            id.unwrap_or("identity")
+        )
+    })
+}
+
+/// Hand the device on `port` its identity and record it
+pub async fn provision_device(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    provisioning: &Provisioning,
+    port: &str,
+    mac_address: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<Identity> {
+    let id = provisioning.id.as_deref();
+    let record = |identity: &Identity| ProvisionRecord {
+        provisioned: chrono::Local::now(),
+        board: board_config.name.clone(),
+        port: port.to_string(),
+        mac_address: mac_address.to_string(),
+        identity: identity.id.clone(),
+    };
+    let identity = match (&provisioning.identities, &provisioning.command) {
+        (Some(identities), None) => {
+            let path = project_dir.join(identities);
+            let content = std::fs::read_to_string(&path)
+                .with_context(|| format!("Failed to read identities {}", path.display()))?;
+            let rows = parse_identities(&content)
+                .with_context(|| format!("Invalid identities {}", path.display()))?;
+
+            let _guard = RECORD_LOCK.lock().unwrap_or_else(|e| e.into_inner());
+            let identity = next_identity(
+                rows,
+                id,
+                &load_records(project_dir),
+                &board_config.name,
+                mac_address,
+            )
+            .with_context(|| format!("No identity left in {}", path.display()))?;
+            append_record(project_dir, &record(&identity))?;
+            identity
+        }
+        (None, Some(command)) => {
+            let identity = command_identity(
+                project_dir,
+                board_config,
+                command,
+                id,
+                port,
+                mac_address,
+                tx,
+            )
+            .await?;
+            let _guard = RECORD_LOCK.lock().unwrap_or_else(|e| e.into_inner());
+            append_record(project_dir, &record(&identity))?;
+            identity
+        }
+        (None, None) => {
+            return Err(anyhow::anyhow!(
+                "The provision section needs identities or a command"
+            ));
+        }
+        (Some(_), Some(_)) => {
+            return Err(anyhow::anyhow!(
+                "The provision section may have only one of identities and command"
+            ));
+        }
+    };
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🪪 Provisioning {} as {} (recorded in {})",
+            mac_address, identity.id, PROVISIONING_RECORD
+        ),
+    ));
+    Ok(identity)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::ProjectConfig;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_provisioning_identities() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  sensor:\n    nvs:\n      csv: nvs.csv\n      provision:\n        identities: ids.csv\n        id: SERIAL\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        let provisioning = config
+            .board_section("sensor")
+            .unwrap()
+            .nvs
+            .as_ref()
+            .unwrap()
+            .provision
+            .clone()
+            .unwrap();
+        assert_eq!(provisioning.identities.as_deref(), Some("ids.csv"));
+        assert_eq!(provisioning.id.as_deref(), Some("SERIAL"));
+
+        assert_eq!(
+            split_csv_line(r#"a, "b,c" ,"say ""hi""""#),
+            vec!["a", "b,c", r#"say "hi""#]
+        );
+        let rows = parse_identities("KEY,SERIAL\n# spare\nk1,SN-1\n\nk2,SN-2\nk3,SN-3\n").unwrap();
+        assert_eq!(rows.len(), 3);
+        assert!(parse_identities("KEY,SERIAL\nk1\n").is_err());
+
+        // The first identity no device has got, unless the device had one
+        let record = |mac: &str, identity: &str| ProvisionRecord {
+            provisioned: chrono::Local::now(),
+            board: "sensor".to_string(),
+            port: "/dev/ttyUSB0".to_string(),
+            mac_address: mac.to_string(),
+            identity: identity.to_string(),
+        };
+        let records = vec![record("7c:df:a1:00:00:01", "SN-1")];
+        let identity = next_identity(
+            rows.clone(),
+            Some("SERIAL"),
+            &records,
+            "sensor",
+            "7C-DF-A1-00-00-01",
+        )
+        .unwrap();
+        assert_eq!(identity.id, "SN-1");
+        assert_eq!(identity.values["KEY"], "k1");
+        let identity = next_identity(
+            rows.clone(),
+            Some("SERIAL"),
+            &records,
+            "sensor",
+            "7c:df:a1:00:00:02",
+        )
+        .unwrap();
+        assert_eq!(identity.id, "SN-2");
+        assert_eq!(
+            next_identity(rows.clone(), None, &records, "sensor", "7c:df:a1:00:00:02")
+                .unwrap()
+                .id,
+            "k1"
+        );
+        let records = vec![
+            record("7c:df:a1:00:00:01", "SN-1"),
+            record("7c:df:a1:00:00:02", "SN-2"),
+            record("7c:df:a1:00:00:03", "SN-3"),
+        ];
+        assert!(
+            next_identity(
+                rows,
+                Some("SERIAL"),
+                &records,
+                "sensor",
+                "7c:df:a1:00:00:04"
+            )
+            .is_err()
+        );
+
+        let values = parse_values("# minted\nSERIAL=SN-9\nCERT_FILE = certs/SN-9.pem\n");
+        assert_eq!(identity_of(values.clone(), None).unwrap().id, "SN-9");
+        assert_eq!(
+            identity_of(values.clone(), Some("CERT_FILE")).unwrap().id,
+            "certs/SN-9.pem"
+        );
+        assert!(identity_of(values, Some("DEVICE_KEY")).is_none());
+
+        append_record(project, &record("7c:df:a1:00:00:01", "SN-1")).unwrap();
+        append_record(project, &record("7c:df:a1:00:00:01", "SN-4")).unwrap();
+        let loaded = load_records(project);
+        assert_eq!(loaded.len(), 2);
+        assert_eq!(
+            recorded_identity(&loaded, "sensor", "7c:df:a1:00:00:01"),
+            Some("SN-4")
+        );
+        assert_eq!(
+            recorded_identity(&loaded, "other", "7c:df:a1:00:00:01"),
+            None
+        );
+    }
+}
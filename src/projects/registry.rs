@@ -5,7 +5,10 @@ use async_trait::async_trait;
 use std::path::Path;
 use tokio::sync::mpsc;
 
+use crate::config::ContainerSpec;
 use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig, ProjectType};
+use crate::projects::build_plan::PlannedCommand;
+use crate::projects::flash_parts::{FlashPart, describe};
 
 /// Common operations that all project types must support
 #[async_trait]
@@ -25,6 +28,17 @@ pub trait ProjectHandler: Send + Sync {
     /// Check if build artifacts exist for this board configuration
     fn check_artifacts_exist(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> bool;
 
+    /// Prepare state shared by the builds of several boards, e.g. fetch
+    /// dependencies once instead of in every board build
+    async fn prepare_build(
+        &self,
+        _project_dir: &Path,
+        _boards: &[ProjectBoardConfig],
+        _tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        Ok(())
+    }
+
     /// Build a specific board configuration
     async fn build_board(
         &self,
@@ -33,6 +47,22 @@ pub trait ProjectHandler: Send + Sync {
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<Vec<BuildArtifact>>;
 
+    /// Build a board inside a container with the workspace mounted; handlers
+    /// without container support refuse, so the board never silently builds on the host
+    async fn build_board_in_container(
+        &self,
+        _project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        _container: &ContainerSpec,
+        _tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<Vec<BuildArtifact>> {
+        Err(anyhow::anyhow!(
+            "{} boards can't be built in a container yet, remove container: from {} in espbrew.yaml",
+            self.project_type().name(),
+            board_config.name
+        ))
+    }
+
     /// Flash build artifacts to a device
     async fn flash_board(
         &self,
@@ -43,6 +73,28 @@ pub trait ProjectHandler: Send + Sync {
         tx: mpsc::UnboundedSender<AppEvent>,
     ) -> Result<()>;
 
+    /// Flash only the images of the parts in `only`, or all of them when it
+    /// is empty; handlers that can't tell their images apart refuse
+    async fn flash_board_parts(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+        artifacts: &[BuildArtifact],
+        port: Option<&str>,
+        only: &[FlashPart],
+        tx: mpsc::UnboundedSender<AppEvent>,
+    ) -> Result<()> {
+        if !only.is_empty() {
+            return Err(anyhow::anyhow!(
+                "{} boards can't flash only the {} images",
+                self.project_type().name(),
+                describe(only)
+            ));
+        }
+        self.flash_board(project_dir, board_config, artifacts, port, tx)
+            .await
+    }
+
     /// Monitor serial output from a device
     async fn monitor_board(
         &self,
@@ -64,6 +116,20 @@ pub trait ProjectHandler: Send + Sync {
     /// Get the build command for display purposes
     fn get_build_command(&self, project_dir: &Path, board_config: &ProjectBoardConfig) -> String;
 
+    /// Commands a build of the board runs, in order, for `espbrew build --dry-run`;
+    /// handlers without a finer plan run their build command in the shell
+    fn build_plan(
+        &self,
+        project_dir: &Path,
+        board_config: &ProjectBoardConfig,
+    ) -> Result<Vec<PlannedCommand>> {
+        Ok(vec![PlannedCommand::shell(
+            "build",
+            project_dir,
+            &self.get_build_command(project_dir, board_config),
+        )])
+    }
+
     /// Get the flash command for display purposes
     fn get_flash_command(
         &self,
@@ -91,6 +157,10 @@ impl ProjectRegistry {
 
         // Add all project handler implementations
         handlers.push(Box::new(crate::projects::handlers::arduino::ArduinoHandler));
+        // ESP8266_RTOS_SDK projects look like ESP-IDF ones, so check them first
+        handlers.push(Box::new(
+            crate::projects::handlers::esp8266_rtos::Esp8266RtosHandler,
+        ));
         handlers.push(Box::new(crate::projects::handlers::esp_idf::EspIdfHandler));
         handlers.push(Box::new(
             crate::projects::handlers::rust_nostd::RustNoStdHandler,
@@ -127,6 +197,10 @@ impl ProjectRegistry {
             h.as_any().type_id() == std::any::TypeId::of::<crate::projects::handlers::arduino::ArduinoHandler>() && h.can_handle(project_dir)
         }) {
             Some(Box::new(crate::projects::handlers::arduino::ArduinoHandler))
+        } else if self.handlers.iter().any(|h| {
+            h.as_any().type_id() == std::any::TypeId::of::<crate::projects::handlers::esp8266_rtos::Esp8266RtosHandler>() && h.can_handle(project_dir)
+        }) {
+            Some(Box::new(crate::projects::handlers::esp8266_rtos::Esp8266RtosHandler))
         } else if self.handlers.iter().any(|h| {
             h.as_any().type_id() == std::any::TypeId::of::<crate::projects::handlers::esp_idf::EspIdfHandler>() && h.can_handle(project_dir)
         }) {
@@ -168,6 +242,25 @@ impl ProjectRegistry {
         }
     }
 
+    /// Create a new boxed handler for a known project type
+    pub fn create_handler(project_type: ProjectType) -> Box<dyn ProjectHandler> {
+        use crate::projects::handlers::*;
+
+        match project_type {
+            ProjectType::EspIdf => Box::new(esp_idf::EspIdfHandler),
+            ProjectType::RustNoStd => Box::new(rust_nostd::RustNoStdHandler),
+            ProjectType::Arduino => Box::new(arduino::ArduinoHandler),
+            ProjectType::PlatformIO => Box::new(platformio::PlatformIOHandler),
+            ProjectType::MicroPython => Box::new(micropython::MicroPythonHandler),
+            ProjectType::CircuitPython => Box::new(circuitpython::CircuitPythonHandler),
+            ProjectType::Zephyr => Box::new(zephyr::ZephyrHandler),
+            ProjectType::NuttX => Box::new(nuttx::NuttXHandler),
+            ProjectType::TinyGo => Box::new(tinygo::TinyGoHandler),
+            ProjectType::Jaculus => Box::new(jaculus::JaculusHandler),
+            ProjectType::Esp8266Rtos => Box::new(esp8266_rtos::Esp8266RtosHandler),
+        }
+    }
+
     /// Get all registered handlers
     pub fn get_all_handlers(&self) -> &[Box<dyn ProjectHandler>] {
         &self.handlers
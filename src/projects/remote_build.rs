@@ -0,0 +1,778 @@
+//! Board builds on remote machines
+//!
+//! A board build is farmed out to an agent: the source tree is shipped as a
+//! tarball, the agent runs `espbrew --cli build --board <board>` in a work
+//! directory kept between builds, its output is streamed back as build output
+//! of the board, and the build directory is fetched into the local project.
+//!
+//! Agents are reached over SSH (`user@host`, `espbrew` must be on the remote
+//! PATH) or over HTTP from `espbrew agent --listen` (`http://host:9090`),
+//! sending the agent's token from `ESPBREW_AGENT_TOKEN`.
+//!
+//! ```yaml
+//! build:
+//!   agents:
+//!     - builder@ci-mac-1
+//!     - http://ci-linux-1:9090
+//! ```
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
+use tokio::process::Command;
+use tokio::sync::{OwnedSemaphorePermit, Semaphore, mpsc};
+
+use crate::config::ProjectConfig;
+use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
+use crate::projects::container_build::shell_quote;
+use crate::projects::incremental::{BuildRecord, source_files};
+use crate::utils::firmware_size::{enforce_memory_limits, record_build_size};
+use crate::utils::process_group;
+
+/// Work directories of SSH agents, relative to the remote home
+const SSH_WORK_ROOT: &str = ".espbrew-agent";
+/// How often the log of an agent job is polled
+const LOG_POLL_INTERVAL: Duration = Duration::from_millis(500);
+/// Variable holding the token of `espbrew agent`, on both ends
+pub const AGENT_TOKEN_ENV: &str = "ESPBREW_AGENT_TOKEN";
+/// Header the token travels in
+pub const AGENT_TOKEN_HEADER: &str = "x-espbrew-token";
+
+/// The agent token of the environment, if set
+pub fn agent_token() -> Option<String> {
+    std::env::var(AGENT_TOKEN_ENV)
+        .ok()
+        .filter(|token| !token.is_empty())
+}
+
+/// Whether `given` is the token, compared in constant time so the time a
+/// rejection takes doesn't tell how much of it was right
+pub fn token_matches(token: &str, given: &str) -> bool {
+    let (token, given) = (token.as_bytes(), given.as_bytes());
+    token.len() == given.len()
+        && token
+            .iter()
+            .zip(given)
+            .fold(0, |diff, (a, b)| diff | (a ^ b))
+            == 0
+}
+
+/// A machine board builds can be sent to
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum BuildAgent {
+    /// SSH destination, e.g. `builder@ci-mac-1`
+    Ssh(String),
+    /// Base URL of `espbrew agent`, e.g. `http://ci-linux-1:9090`
+    Http(String),
+}
+
+impl BuildAgent {
+    /// `http://` and `https://` URLs are agents, anything else an SSH
+    /// destination with an optional `ssh://` prefix
+    pub fn parse(spec: &str) -> Result<Self> {
+        let spec = spec.trim();
+        if spec.is_empty() {
+            return Err(anyhow::anyhow!("Empty build agent"));
+        }
+        if spec.starts_with("http://") || spec.starts_with("https://") {
+            return Ok(BuildAgent::Http(spec.trim_end_matches('/').to_string()));
+        }
+        Ok(BuildAgent::Ssh(
+            spec.trim_start_matches("ssh://")
+                .trim_end_matches('/')
+                .to_string(),
+        ))
+    }
+}
+
+impl std::fmt::Display for BuildAgent {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            BuildAgent::Ssh(destination) => write!(f, "ssh://{}", destination),
+            BuildAgent::Http(url) => write!(f, "{}", url),
+        }
+    }
+}
+
+/// Job accepted by `espbrew agent`
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct AgentJob {
+    pub id: String,
+    /// Absolute work directory the board is built in on the agent
+    pub work_dir: PathBuf,
+}
+
+/// Output of an agent job from a line offset on
+#[derive(Debug, Clone, Default, Serialize, Deserialize)]
+pub struct AgentJobLog {
+    pub lines: Vec<String>,
+    pub finished: bool,
+    pub success: bool,
+}
+
+/// Agents handing out one board build at a time each; clones share the agents
+#[derive(Debug, Clone)]
+pub struct AgentPool {
+    agents: Vec<BuildAgent>,
+    idle: Arc<Mutex<Vec<BuildAgent>>>,
+    available: Arc<Semaphore>,
+}
+
+impl AgentPool {
+    /// Pool of the given agents, `None` if there are none
+    pub fn new(agents: Vec<BuildAgent>) -> Option<Self> {
+        if agents.is_empty() {
+            return None;
+        }
+        // Handed out from the end, so the first agent is used first
+        let idle = agents.iter().rev().cloned().collect();
+        Some(AgentPool {
+            available: Arc::new(Semaphore::new(agents.len())),
+            idle: Arc::new(Mutex::new(idle)),
+            agents,
+        })
+    }
+
+    /// Agents from `--agent`, falling back to the `build.agents` of `espbrew.yaml`
+    pub fn resolve(project_dir: &Path, agents: &[String]) -> Result<Option<Self>> {
+        let specs = if agents.is_empty() {
+            ProjectConfig::load(project_dir)?
+                .map(|config| config.build.agents)
+                .unwrap_or_default()
+        } else {
+            agents.to_vec()
+        };
+        let agents = specs
+            .iter()
+            .map(|spec| BuildAgent::parse(spec))
+            .collect::<Result<Vec<_>>>()?;
+        Ok(Self::new(agents))
+    }
+
+    /// All agents of the pool, busy or not
+    pub fn agents(&self) -> &[BuildAgent] {
+        &self.agents
+    }
+
+    /// Whether every agent is busy
+    pub fn is_saturated(&self) -> bool {
+        self.available.available_permits() == 0
+    }
+
+    /// Wait for an idle agent; it returns to the pool when the lease is dropped
+    pub async fn acquire(&self) -> AgentLease {
+        let permit = self
+            .available
+            .clone()
+            .acquire_owned()
+            .await
+            .expect("agent pool semaphore is never closed");
+        let agent = self
+            .idle
+            .lock()
+            .expect("agent pool lock poisoned")
+            .pop()
+            .expect("a permit guarantees an idle agent");
+        AgentLease {
+            agent: Some(agent),
+            idle: self.idle.clone(),
+            _permit: permit,
+        }
+    }
+}
+
+/// An agent taken from the pool for one board build
+#[derive(Debug)]
+pub struct AgentLease {
+    agent: Option<BuildAgent>,
+    idle: Arc<Mutex<Vec<BuildAgent>>>,
+    _permit: OwnedSemaphorePermit,
+}
+
+impl AgentLease {
+    pub fn agent(&self) -> &BuildAgent {
+        self.agent.as_ref().expect("agent is only taken on drop")
+    }
+}
+
+impl Drop for AgentLease {
+    fn drop(&mut self) {
+        // Runs before the permit is released, so the agent is back in time
+        if let (Some(agent), Ok(mut idle)) = (self.agent.take(), self.idle.lock()) {
+            idle.push(agent);
+        }
+    }
+}
+
+/// Arguments of the `espbrew` invocation building a board on an agent
+pub fn remote_build_args(board_name: &str, force: bool) -> Vec<String> {
+    let mut args = vec![
+        "--cli".to_string(),
+        "build".to_string(),
+        "--board".to_string(),
+        board_name.to_string(),
+    ];
+    if force {
+        args.push("--force".to_string());
+    }
+    args
+}
+
+/// Work directory of a board on an agent, relative to the agent's work root.
+/// Names that would leave or collapse onto the work root, like `..`, `.` or
+/// an empty one, are refused.
+pub fn agent_work_path(project_name: &str, board_name: &str) -> Result<PathBuf> {
+    let component = |name: &str| {
+        let sanitized = name.replace(['/', '\\', ':', ' '], "_");
+        if sanitized.is_empty() || sanitized == "." || sanitized == ".." {
+            return Err(anyhow::anyhow!(
+                "'{}' can't name a work directory on the agent",
+                name
+            ));
+        }
+        Ok(sanitized)
+    };
+    Ok(Path::new(&component(project_name)?).join(component(board_name)?))
+}
+
+/// A line of remote `espbrew` output without the log header and board prefix,
+/// e.g. `[2026-10-14T09:12:03Z INFO ] [box] ✅ Done` becomes `✅ Done`
+pub fn remote_log_line(board_name: &str, line: &str) -> String {
+    let line = match line
+        .strip_prefix('[')
+        .and_then(|rest| rest.split_once("] "))
+    {
+        Some((header, rest)) if header.contains(' ') => rest,
+        _ => line,
+    };
+    line.strip_prefix(&format!("[{}] ", board_name))
+        .unwrap_or(line)
+        .to_string()
+}
+
+/// Gzipped tarball of the project sources, the files incremental builds hash
+pub async fn source_archive(project_dir: &Path) -> Result<Vec<u8>> {
+    let mut list = Vec::new();
+    for file in source_files(project_dir)? {
+        let relative = file.strip_prefix(project_dir).unwrap_or(&file);
+        list.extend_from_slice(relative.to_string_lossy().as_bytes());
+        list.push(0);
+    }
+
+    let mut tar = Command::new("tar");
+    tar.arg("-C")
+        .arg(project_dir)
+        .args(["-czf", "-", "--null", "-T", "-"]);
+    pipe_through(tar, list)
+        .await
+        .context("Failed to archive the project sources")
+}
+
+/// Gzipped tarball of a board's build directory and its build record in `work_dir`
+pub async fn output_archive(
+    work_dir: &Path,
+    board_name: &str,
+    build_dir: &Path,
+) -> Result<Vec<u8>> {
+    let mut members = Vec::new();
+    if work_dir.join(build_dir).exists() {
+        members.push(build_dir.to_path_buf());
+    }
+    let record = BuildRecord::path(work_dir, board_name);
+    if record.exists() {
+        members.push(record.strip_prefix(work_dir)?.to_path_buf());
+    }
+    if members.is_empty() {
+        return Err(anyhow::anyhow!(
+            "{} has no build output in {}",
+            board_name,
+            work_dir.display()
+        ));
+    }
+
+    let mut tar = Command::new("tar");
+    tar.arg("-C")
+        .arg(work_dir)
+        .args(["-czf", "-"])
+        .args(members);
+    pipe_through(tar, Vec::new())
+        .await
+        .with_context(|| format!("Failed to archive the build output of {}", board_name))
+}
+
+/// Unpack a gzipped tarball into `dir`
+pub async fn extract_archive(dir: &Path, archive: Vec<u8>) -> Result<()> {
+    std::fs::create_dir_all(dir).with_context(|| format!("Failed to create {}", dir.display()))?;
+    let mut tar = Command::new("tar");
+    tar.arg("-C").arg(dir).args(["-xzf", "-"]);
+    pipe_through(tar, archive)
+        .await
+        .with_context(|| format!("Failed to unpack into {}", dir.display()))?;
+    Ok(())
+}
+
+/// Run a command with `input` on stdin and return its stdout
+async fn pipe_through(mut command: Command, input: Vec<u8>) -> Result<Vec<u8>> {
+    let mut child = command
+        .stdin(std::process::Stdio::piped())
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped())
+        .spawn()?;
+    let mut stdin = child.stdin.take().unwrap();
+    let writer = tokio::spawn(async move {
+        let result = stdin.write_all(&input).await;
+        drop(stdin);
+        result
+    });
+
+    let output = child.wait_with_output().await?;
+    writer.await??;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "{}",
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+    Ok(output.stdout)
+}
+
+/// Build a board on an agent and fetch its build directory into the project
+pub async fn build_board_on_agent(
+    agent: &BuildAgent,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    force: bool,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<Vec<BuildArtifact>> {
+    let build_dir = board_config
+        .build_dir
+        .strip_prefix(project_dir)
+        .map(Path::to_path_buf)
+        .map_err(|_| {
+            anyhow::anyhow!(
+                "Build directory {} is outside the project and can't be built remotely",
+                board_config.build_dir.display()
+            )
+        })?;
+    let project_name = project_dir
+        .canonicalize()
+        .unwrap_or_else(|_| project_dir.to_path_buf())
+        .file_name()
+        .map(|name| name.to_string_lossy().to_string())
+        .unwrap_or_else(|| "project".to_string());
+
+    let archive = source_archive(project_dir).await?;
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🌐 Shipping the source tree ({} KiB) to {}",
+            archive.len() / 1024,
+            agent
+        ),
+    ));
+
+    let (remote_dir, output) = match agent {
+        BuildAgent::Ssh(destination) => {
+            ssh_build(
+                destination,
+                &project_name,
+                board_config,
+                &build_dir,
+                force,
+                archive,
+                &tx,
+            )
+            .await?
+        }
+        BuildAgent::Http(url) => {
+            http_build(
+                url,
+                &project_name,
+                board_config,
+                &build_dir,
+                force,
+                archive,
+                &tx,
+            )
+            .await?
+        }
+    };
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "📥 Fetched {} KiB of build output from {}",
+            output.len() / 1024,
+            agent
+        ),
+    ));
+    let _ = std::fs::remove_file(BuildRecord::path(project_dir, &board_config.name));
+    extract_archive(project_dir, output).await?;
+    let artifacts = adopt_remote_record(project_dir, &board_config.name, &remote_dir)?;
+
+    // The agent compares with its own builds, the local history holds the previous size
+    let report = record_build_size(
+        project_dir,
+        &board_config.name,
+        &board_config.build_dir,
+        &artifacts,
+    )
+    .ok()
+    .flatten();
+    if let Some(report) = &report {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_config.name.clone(),
+            format!(
+                "{} Size: {}",
+                if report.grew() { "📈" } else { "📏" },
+                report.summary()
+            ),
+        ));
+    }
+    if let Err(e) = enforce_memory_limits(project_dir, &board_config.name, report.as_ref(), &tx) {
+        // A fetched record would let the next build skip the board
+        let _ = std::fs::remove_file(BuildRecord::path(project_dir, &board_config.name));
+        return Err(e);
+    }
+    Ok(artifacts)
+}
+
+/// Point the artifacts of a fetched build record at the local project, so that
+/// flashing and incremental builds use the fetched build directory
+pub fn adopt_remote_record(
+    project_dir: &Path,
+    board_name: &str,
+    remote_dir: &Path,
+) -> Result<Vec<BuildArtifact>> {
+    let mut record = BuildRecord::load(project_dir, board_name).ok_or_else(|| {
+        anyhow::anyhow!(
+            "The agent returned no build record for {}, is its espbrew too old?",
+            board_name
+        )
+    })?;
+    for artifact in &mut record.artifacts {
+        if let Ok(relative) = artifact.file_path.strip_prefix(remote_dir) {
+            artifact.file_path = project_dir.join(relative);
+        }
+    }
+    record.save(project_dir, board_name)?;
+    Ok(record.artifacts)
+}
+
+/// `ssh` without password prompts, which would hang a background build
+fn ssh(destination: &str, remote_command: &str) -> Command {
+    let mut command = Command::new("ssh");
+    command.args(["-o", "BatchMode=yes", destination, remote_command]);
+    command
+}
+
+async fn ssh_build(
+    destination: &str,
+    project_name: &str,
+    board_config: &ProjectBoardConfig,
+    build_dir: &Path,
+    force: bool,
+    archive: Vec<u8>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<(PathBuf, Vec<u8>)> {
+    let work_dir = shell_quote(
+        &Path::new(SSH_WORK_ROOT)
+            .join(agent_work_path(project_name, &board_config.name)?)
+            .to_string_lossy(),
+    );
+
+    let unpacked = pipe_through(
+        ssh(
+            destination,
+            &format!(
+                "mkdir -p {dir} && cd {dir} && tar -xzf - && pwd",
+                dir = work_dir
+            ),
+        ),
+        archive,
+    )
+    .await
+    .with_context(|| format!("Failed to ship the sources to {}", destination))?;
+    let remote_dir = PathBuf::from(String::from_utf8_lossy(&unpacked).trim());
+
+    let build_command = std::iter::once("espbrew".to_string())
+        .chain(remote_build_args(&board_config.name, force))
+        .map(|arg| shell_quote(&arg))
+        .collect::<Vec<_>>()
+        .join(" ");
+    let mut cmd = ssh(
+        destination,
+        &format!("cd {} && {}", work_dir, build_command),
+    );
+    cmd.stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped());
+    let mut child = process_group::spawn(&mut cmd).context("Failed to start ssh")?;
+    let stdout = child.stdout.take().unwrap();
+    let stderr = child.stderr.take().unwrap();
+
+    let tx_stdout = tx.clone();
+    let tx_stderr = tx.clone();
+    let board_name_stdout = board_config.name.clone();
+    let board_name_stderr = board_config.name.clone();
+
+    tokio::spawn(async move {
+        let mut lines = BufReader::new(stdout).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let line = remote_log_line(&board_name_stdout, &line);
+            let _ = tx_stdout.send(AppEvent::BuildOutput(board_name_stdout.clone(), line));
+        }
+    });
+
+    tokio::spawn(async move {
+        let mut lines = BufReader::new(stderr).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let line = remote_log_line(&board_name_stderr, &line);
+            let _ = tx_stderr.send(AppEvent::BuildOutput(board_name_stderr.clone(), line));
+        }
+    });
+
+    let status = child.wait().await.context("Failed to wait for ssh")?;
+    if !status.success() {
+        return Err(anyhow::anyhow!(
+            "Remote build of {} on {} failed",
+            board_config.name,
+            destination
+        ));
+    }
+
+    let output = pipe_through(
+        ssh(
+            destination,
+            &format!(
+                "cd {} && tar -czf - {}",
+                work_dir,
+                remote_output_members(&board_config.name, build_dir)
+            ),
+        ),
+        Vec::new(),
+    )
+    .await
+    .with_context(|| format!("Failed to fetch the build output from {}", destination))?;
+
+    Ok((remote_dir, output))
+}
+
+/// Quoted `tar` members of a board's build output on an SSH agent
+fn remote_output_members(board_name: &str, build_dir: &Path) -> String {
+    let record = BuildRecord::path(Path::new("."), board_name);
+    [build_dir.to_path_buf(), record]
+        .iter()
+        .map(|member| shell_quote(&member.to_string_lossy()))
+        .collect::<Vec<_>>()
+        .join(" ")
+}
+
+async fn http_build(
+    url: &str,
+    project_name: &str,
+    board_config: &ProjectBoardConfig,
+    build_dir: &Path,
+    force: bool,
+    archive: Vec<u8>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<(PathBuf, Vec<u8>)> {
+    let mut headers = reqwest::header::HeaderMap::new();
+    if let Some(token) = agent_token() {
+        headers.insert(
+            AGENT_TOKEN_HEADER,
+            token
+                .parse()
+                .with_context(|| format!("Invalid {}", AGENT_TOKEN_ENV))?,
+        );
+    }
+    let client = reqwest::Client::builder()
+        .default_headers(headers)
+        .build()?;
+    let response = client
+        .post(format!("{}/api/v1/agent/jobs", url))
+        .query(&[
+            ("project", project_name),
+            ("board", board_config.name.as_str()),
+            ("force", if force { "true" } else { "false" }),
+        ])
+        .body(archive)
+        .send()
+        .await
+        .with_context(|| format!("Failed to reach build agent {}", url))?;
+    if !response.status().is_success() {
+        return Err(anyhow::anyhow!(
+            "Build agent {} rejected the job: {}",
+            url,
+            response.text().await.unwrap_or_default()
+        ));
+    }
+    let job: AgentJob = response.json().await?;
+
+    let mut offset = 0;
+    let log = loop {
+        let log: AgentJobLog = client
+            .get(format!("{}/api/v1/agent/jobs/{}/log", url, job.id))
+            .query(&[("from", offset)])
+            .send()
+            .await?
+            .error_for_status()?
+            .json()
+            .await?;
+        offset += log.lines.len();
+        for line in &log.lines {
+            let _ = tx.send(AppEvent::BuildOutput(
+                board_config.name.clone(),
+                remote_log_line(&board_config.name, line),
+            ));
+        }
+        if log.finished {
+            break log;
+        }
+        tokio::time::sleep(LOG_POLL_INTERVAL).await;
+    };
+    if !log.success {
+        // Its output won't be fetched, so the agent can forget the job
+        let _ = client
+            .delete(format!("{}/api/v1/agent/jobs/{}", url, job.id))
+            .send()
+            .await;
+        return Err(anyhow::anyhow!(
+            "Remote build of {} on {} failed",
+            board_config.name,
+            url
+        ));
+    }
+
+    let output = client
+        .get(format!("{}/api/v1/agent/jobs/{}/artifacts", url, job.id))
+        .query(&[("build_dir", &*build_dir.to_string_lossy())])
+        .send()
+        .await?
+        .error_for_status()
+        .with_context(|| format!("Failed to fetch the build output from {}", url))?
+        .bytes()
+        .await?;
+
+    Ok((job.work_dir, output.to_vec()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ArtifactType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_agent_work_path() {
+        assert_eq!(
+            agent_work_path("my app", "esp32:s3/box").unwrap(),
+            Path::new("my_app").join("esp32_s3_box")
+        );
+        assert!(agent_work_path("..", "esp32s3").is_err());
+        assert!(agent_work_path("app", ".").is_err());
+        assert!(agent_work_path("", "esp32s3").is_err());
+        // Separators are replaced, so dots next to them are harmless
+        assert_eq!(
+            agent_work_path("app", "../esp32").unwrap(),
+            Path::new("app").join(".._esp32")
+        );
+    }
+
+    #[test]
+    fn test_token_matches() {
+        assert!(token_matches("secret", "secret"));
+        assert!(!token_matches("secret", "secreT"));
+        assert!(!token_matches("secret", "secrets"));
+        assert!(!token_matches("secret", ""));
+    }
+
+    #[tokio::test]
+    async fn test_remote_build_archives() {
+        assert_eq!(
+            BuildAgent::parse("builder@ci-mac-1").unwrap(),
+            BuildAgent::Ssh("builder@ci-mac-1".to_string())
+        );
+        assert_eq!(
+            BuildAgent::parse("ssh://builder@ci-mac-1").unwrap(),
+            BuildAgent::Ssh("builder@ci-mac-1".to_string())
+        );
+        assert_eq!(
+            BuildAgent::parse("http://ci-linux-1:9090/").unwrap(),
+            BuildAgent::Http("http://ci-linux-1:9090".to_string())
+        );
+        assert_eq!(
+            remote_log_line("box", "[2026-10-14T09:12:03Z INFO ] [box] ✅ Done"),
+            "✅ Done"
+        );
+        assert_eq!(remote_log_line("box", "idf.py build"), "idf.py build");
+
+        // Leases hand the agents out in order and take them back when dropped
+        let pool = AgentPool::new(vec![
+            BuildAgent::parse("a@one").unwrap(),
+            BuildAgent::parse("b@two").unwrap(),
+        ])
+        .unwrap();
+        let first = pool.acquire().await;
+        let second = pool.acquire().await;
+        assert_eq!(first.agent(), &BuildAgent::Ssh("a@one".to_string()));
+        assert_eq!(second.agent(), &BuildAgent::Ssh("b@two".to_string()));
+        assert!(pool.is_saturated());
+        drop(first);
+        assert!(!pool.is_saturated());
+        assert_eq!(
+            pool.acquire().await.agent(),
+            &BuildAgent::Ssh("a@one".to_string())
+        );
+        assert!(AgentPool::new(Vec::new()).is_none());
+
+        // Sources are shipped without build output
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path().join("sensor");
+        fs::create_dir_all(project.join("main")).unwrap();
+        fs::create_dir_all(project.join("build.box")).unwrap();
+        fs::write(project.join("main/main.c"), "void app_main(void) {}\n").unwrap();
+        fs::write(project.join("build.box/stale.bin"), [0u8; 4]).unwrap();
+
+        let agent_dir = temp_dir.path().join("agent");
+        extract_archive(&agent_dir, source_archive(&project).await.unwrap())
+            .await
+            .unwrap();
+        assert!(agent_dir.join("main/main.c").exists());
+        assert!(!agent_dir.join("build.box").exists());
+
+        // The agent's build output comes back with the artifacts pointing at the project
+        fs::create_dir_all(agent_dir.join("build.box")).unwrap();
+        fs::write(agent_dir.join("build.box/app.bin"), [1u8; 8]).unwrap();
+        BuildRecord {
+            inputs: "0123456789abcdef".to_string(),
+            artifacts: vec![BuildArtifact {
+                name: "app".to_string(),
+                file_path: agent_dir.join("build.box/app.bin"),
+                artifact_type: ArtifactType::Binary,
+                offset: Some(0x10000),
+            }],
+        }
+        .save(&agent_dir, "box")
+        .unwrap();
+
+        let output = output_archive(&agent_dir, "box", Path::new("build.box"))
+            .await
+            .unwrap();
+        extract_archive(&project, output).await.unwrap();
+        let artifacts = adopt_remote_record(&project, "box", &agent_dir).unwrap();
+        assert_eq!(artifacts[0].file_path, project.join("build.box/app.bin"));
+        assert_eq!(
+            fs::read(project.join("build.box/app.bin")).unwrap(),
+            [1u8; 8]
+        );
+        assert!(
+            BuildRecord::load(&project, "box")
+                .unwrap()
+                .artifacts_exist()
+        );
+    }
+}
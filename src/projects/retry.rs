@@ -0,0 +1,328 @@
+//! Retries of transiently failing fetch, build and flash steps
+//!
+//! Component registry downloads and serial flashing fail now and then for
+//! reasons that are gone a moment later. Each step type has a retry policy,
+//! set in the `retry:` section of `espbrew.yaml`. Every retry is written to the
+//! board's log and reported as [`AppEvent::StepRetried`], so commands can count
+//! them in their summary.
+
+use anyhow::Result;
+use std::collections::BTreeMap;
+use std::future::Future;
+use std::path::Path;
+use std::time::Duration;
+use tokio::sync::mpsc;
+
+use crate::config::{ProjectConfig, RetryPolicy};
+use crate::models::{AppEvent, BuildArtifact, ProjectBoardConfig};
+use crate::projects::ProjectHandler;
+use crate::projects::command_templates::{
+    TemplateStep, command_template, expand_template, run_template,
+};
+use crate::projects::device_registry::port_or_registered;
+use crate::projects::flash_parts::{FlashPart, describe};
+use crate::projects::signing::ensure_signed;
+
+/// Longest wait between two attempts, however many retries are configured
+const MAX_BACKOFF: Duration = Duration::from_secs(60);
+
+/// Kind of step a retry policy applies to
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum RetryStep {
+    Fetch,
+    Build,
+    Flash,
+}
+
+impl RetryStep {
+    /// Name used in `espbrew.yaml` and in log messages
+    pub fn name(&self) -> &'static str {
+        match self {
+            RetryStep::Fetch => "fetch",
+            RetryStep::Build => "build",
+            RetryStep::Flash => "flash",
+        }
+    }
+
+    /// Policy without configuration: downloads and flashing are retried,
+    /// builds are not since a failing compiler rarely succeeds on a rerun
+    pub fn default_policy(&self) -> RetryPolicy {
+        let retries = match self {
+            RetryStep::Fetch => 2,
+            RetryStep::Build => 0,
+            RetryStep::Flash => 1,
+        };
+        RetryPolicy {
+            retries,
+            backoff_ms: 1000,
+        }
+    }
+
+    /// Policy from the `retry:` section of `espbrew.yaml`, else the default
+    pub fn policy(&self, project_dir: &Path) -> RetryPolicy {
+        let section = ProjectConfig::load(project_dir)
+            .ok()
+            .flatten()
+            .map(|config| config.retry)
+            .unwrap_or_default();
+        let configured = match self {
+            RetryStep::Fetch => section.fetch,
+            RetryStep::Build => section.build,
+            RetryStep::Flash => section.flash,
+        };
+        configured.unwrap_or_else(|| self.default_policy())
+    }
+}
+
+/// Wait before retry number `retry`, counting from 1
+pub fn backoff_delay(policy: &RetryPolicy, retry: u32) -> Duration {
+    let factor = 2u64.saturating_pow(retry.saturating_sub(1));
+    Duration::from_millis(policy.backoff_ms.saturating_mul(factor)).min(MAX_BACKOFF)
+}
+
+/// Run `attempt` until it succeeds or the policy's retries are used up,
+/// returning the last error in the latter case
+pub async fn with_retries<T, F, Fut>(
+    step: RetryStep,
+    policy: RetryPolicy,
+    board_name: &str,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+    mut attempt: F,
+) -> Result<T>
+where
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T>>,
+{
+    let attempts = policy.retries + 1;
+    let mut retry = 0;
+    loop {
+        match attempt().await {
+            Ok(value) => return Ok(value),
+            Err(e) if retry < policy.retries => {
+                retry += 1;
+                let delay = backoff_delay(&policy, retry);
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_name.to_string(),
+                    format!(
+                        "🔁 {} failed (attempt {}/{}): {:#} - retrying in {:.1}s",
+                        step.name(),
+                        retry,
+                        attempts,
+                        e,
+                        delay.as_secs_f64()
+                    ),
+                ));
+                let _ = tx.send(AppEvent::StepRetried(
+                    board_name.to_string(),
+                    step.name().to_string(),
+                ));
+                tokio::time::sleep(delay).await;
+            }
+            Err(e) => return Err(e),
+        }
+    }
+}
+
+/// Resolve the shared dependencies of `boards`, retrying with the fetch policy
+pub async fn prepare_build_with_retries(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    boards: &[ProjectBoardConfig],
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let board_name = boards.first().map(|b| b.name.as_str()).unwrap_or_default();
+    let attempt_tx = tx.clone();
+    with_retries(
+        RetryStep::Fetch,
+        RetryStep::Fetch.policy(project_dir),
+        board_name,
+        &tx,
+        move || handler.prepare_build(project_dir, boards, attempt_tx.clone()),
+    )
+    .await
+}
+
+/// Flash a board, retrying with the flash policy; a flash template from
+/// `espbrew.yaml` replaces the handler's flash. Without a port the board's
+/// registered device is flashed, if it has one. Unsigned release builds are
+/// refused.
+pub async fn flash_board_with_retries(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    artifacts: &[BuildArtifact],
+    port: Option<&str>,
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    flash_board_parts_with_retries(handler, project_dir, board_config, artifacts, port, &[], tx)
+        .await
+}
+
+/// [`flash_board_with_retries`] writing only the images of the parts in
+/// `only`, which a flash template can't tell apart
+pub async fn flash_board_parts_with_retries(
+    handler: &dyn ProjectHandler,
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    artifacts: &[BuildArtifact],
+    port: Option<&str>,
+    only: &[FlashPart],
+    tx: mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    ensure_signed(project_dir, board_config)?;
+    let port = port_or_registered(project_dir, &board_config.name, port, &tx).await?;
+    let port = port.as_deref();
+    let command = command_template(project_dir, board_config, TemplateStep::Flash)?
+        .map(|template| expand_template(&template, project_dir, board_config, port, None))
+        .transpose()?;
+    if command.is_some() && !only.is_empty() {
+        return Err(anyhow::anyhow!(
+            "{} flashes with the flash command of espbrew.yaml, which can't flash only the {} images",
+            board_config.name,
+            describe(only)
+        ));
+    }
+    let command = command.as_deref();
+    let attempt_tx = tx.clone();
+    with_retries(
+        RetryStep::Flash,
+        RetryStep::Flash.policy(project_dir),
+        &board_config.name,
+        &tx,
+        move || {
+            let attempt_tx = attempt_tx.clone();
+            async move {
+                match command {
+                    Some(command) => {
+                        run_template(
+                            TemplateStep::Flash,
+                            command,
+                            project_dir,
+                            board_config,
+                            None,
+                            &attempt_tx,
+                        )
+                        .await
+                    }
+                    None => {
+                        handler
+                            .flash_board_parts(
+                                project_dir,
+                                board_config,
+                                artifacts,
+                                port,
+                                only,
+                                attempt_tx,
+                            )
+                            .await
+                    }
+                }
+            }
+        },
+    )
+    .await
+}
+
+/// Retries seen by a command, per board and step
+#[derive(Debug, Clone, Default)]
+pub struct RetryTally {
+    counts: BTreeMap<(String, String), usize>,
+}
+
+impl RetryTally {
+    /// Count a [`AppEvent::StepRetried`]
+    pub fn record(&mut self, board_name: &str, step: &str) {
+        *self
+            .counts
+            .entry((board_name.to_string(), step.to_string()))
+            .or_default() += 1;
+    }
+
+    pub fn total(&self) -> usize {
+        self.counts.values().sum()
+    }
+
+    /// e.g. `esp32s3_box flash ×2, esp32c3 fetch ×1`
+    pub fn summary(&self) -> String {
+        self.counts
+            .iter()
+            .map(|((board, step), count)| format!("{} {} ×{}", board, step, count))
+            .collect::<Vec<_>>()
+            .join(", ")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_retry_policy_and_backoff() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        assert_eq!(RetryStep::Fetch.policy(project).retries, 2);
+        assert_eq!(RetryStep::Build.policy(project).retries, 0);
+
+        fs::write(
+            project.join("espbrew.yaml"),
+            "retry:\n  flash:\n    retries: 3\n    backoff_ms: 0\n  build:\n    retries: 1\n",
+        )
+        .unwrap();
+        let flash = RetryStep::Flash.policy(project);
+        assert_eq!(
+            flash,
+            RetryPolicy {
+                retries: 3,
+                backoff_ms: 0
+            }
+        );
+        assert_eq!(RetryStep::Build.policy(project).backoff_ms, 1000);
+        assert_eq!(RetryStep::Fetch.policy(project).retries, 2);
+
+        let policy = RetryStep::Build.policy(project);
+        assert_eq!(backoff_delay(&policy, 1), Duration::from_secs(1));
+        assert_eq!(backoff_delay(&policy, 3), Duration::from_secs(4));
+        assert_eq!(backoff_delay(&policy, 30), Duration::from_secs(60));
+
+        // Two transient failures, then success
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+        let mut calls = 0;
+        let result = with_retries(RetryStep::Flash, flash, "box", &tx, || {
+            calls += 1;
+            let attempt = calls;
+            async move {
+                if attempt < 3 {
+                    Err(anyhow::anyhow!("port busy"))
+                } else {
+                    Ok(attempt)
+                }
+            }
+        })
+        .await;
+        assert_eq!(result.unwrap(), 3);
+
+        // Out of retries: the last error is returned
+        let result: anyhow::Result<()> =
+            with_retries(RetryStep::Flash, flash, "c3", &tx, || async {
+                Err(anyhow::anyhow!("no device"))
+            })
+            .await;
+        assert!(result.unwrap_err().to_string().contains("no device"));
+        drop(tx);
+
+        let mut tally = RetryTally::default();
+        let mut lines = Vec::new();
+        while let Some(event) = rx.recv().await {
+            match event {
+                AppEvent::StepRetried(board, step) => tally.record(&board, &step),
+                AppEvent::BuildOutput(_, line) => lines.push(line),
+                _ => {}
+            }
+        }
+        assert_eq!(tally.total(), 5);
+        assert_eq!(tally.summary(), "box flash ×2, c3 flash ×3");
+        assert!(lines[0].starts_with("🔁 flash failed (attempt 1/4): port busy"));
+    }
+}
@@ -0,0 +1,404 @@
+//! Recording of a TUI session, and its replay
+//!
+//! `espbrew --record session.jsonl` writes what the TUI's boards go through
+//! to a file as it runs: each board's status changes and log lines, with the
+//! time since the session started. `espbrew replay session.jsonl` plays the
+//! file back in the TUI at the pace it happened (`--speed 10` ten times as
+//! fast), without the project, so a recording can be attached to a bug
+//! report or an overnight run reviewed in the morning. `--cli replay` prints
+//! it as text instead.
+//!
+//! The file is JSON lines: a header with the project and its boards, then an
+//! event per line. It is flushed on every tick, so a session that crashed is
+//! recorded up to the crash. Serial monitor panes are not recorded.
+
+use anyhow::{Context, Result};
+use chrono::{DateTime, Local};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::fs::File;
+use std::io::{BufWriter, Write};
+use std::path::Path;
+use std::time::{Duration, Instant};
+
+use crate::models::board::BoardConfig;
+use crate::models::project::BuildStatus;
+
+/// Version of the file format, raised when old espbrews can't replay it
+pub const RECORDING_VERSION: u32 = 1;
+
+/// A board of the recorded session
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct RecordedBoard {
+    pub name: String,
+    #[serde(default)]
+    pub target: Option<String>,
+    #[serde(default)]
+    pub tags: Vec<String>,
+}
+
+/// First line of a recording
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct SessionHeader {
+    pub version: u32,
+    /// Version of the espbrew that recorded it
+    pub espbrew: String,
+    pub project: String,
+    pub started: DateTime<Local>,
+    pub boards: Vec<RecordedBoard>,
+}
+
+impl SessionHeader {
+    pub fn new(project: &str, boards: &[RecordedBoard]) -> Self {
+        Self {
+            version: RECORDING_VERSION,
+            espbrew: env!("CARGO_PKG_VERSION").to_string(),
+            project: project.to_string(),
+            started: Local::now(),
+            boards: boards.to_vec(),
+        }
+    }
+}
+
+/// What happened to a board
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(tag = "kind", rename_all = "snake_case")]
+pub enum SessionEvent {
+    Status {
+        board: String,
+        status: BuildStatus,
+    },
+    Log {
+        board: String,
+        lines: Vec<String>,
+    },
+    /// The board's log was cleared, e.g. by an action starting
+    Clear {
+        board: String,
+    },
+}
+
+/// An event and when it happened
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct SessionEntry {
+    /// Milliseconds since the session started
+    pub at_ms: u64,
+    pub event: SessionEvent,
+}
+
+impl SessionEntry {
+    /// The entry as lines of text, e.g. `[01:05] esp32s3: ninja: build stopped`
+    pub fn text(&self) -> Vec<String> {
+        let at = format_offset(self.at_ms);
+        match &self.event {
+            SessionEvent::Status { board, status } => {
+                vec![format!("[{}] {} is {:?}", at, board, status)]
+            }
+            SessionEvent::Log { board, lines } => lines
+                .iter()
+                .map(|line| format!("[{}] {}: {}", at, board, line))
+                .collect(),
+            SessionEvent::Clear { board } => vec![format!("[{}] {}: log cleared", at, board)],
+        }
+    }
+}
+
+/// `mm:ss`, or `h:mm:ss` past an hour
+pub fn format_offset(at_ms: u64) -> String {
+    let seconds = at_ms / 1000;
+    if seconds >= 3600 {
+        format!(
+            "{}:{:02}:{:02}",
+            seconds / 3600,
+            seconds / 60 % 60,
+            seconds % 60
+        )
+    } else {
+        format!("{:02}:{:02}", seconds / 60, seconds % 60)
+    }
+}
+
+/// What the recording has of a board so far
+#[derive(Debug, Default)]
+struct RecordedState {
+    status: Option<BuildStatus>,
+    lines: usize,
+    last_line: Option<String>,
+}
+
+/// Writes the session's events as the boards change
+pub struct SessionRecorder {
+    writer: BufWriter<File>,
+    started: Instant,
+    boards: HashMap<String, RecordedState>,
+}
+
+impl SessionRecorder {
+    pub fn create(path: &Path, header: &SessionHeader) -> Result<Self> {
+        if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        let file =
+            File::create(path).with_context(|| format!("Failed to create {}", path.display()))?;
+        let mut recorder = Self {
+            writer: BufWriter::new(file),
+            started: Instant::now(),
+            boards: HashMap::new(),
+        };
+        serde_json::to_writer(&mut recorder.writer, header)?;
+        recorder.writer.write_all(b"\n")?;
+        recorder.writer.flush()?;
+        Ok(recorder)
+    }
+
+    /// Record the boards' changes since the last call: new statuses, new
+    /// log lines, and logs cleared or rewritten
+    pub fn record<'a>(&mut self, boards: impl IntoIterator<Item = &'a BoardConfig>) -> Result<()> {
+        let at_ms = self.started.elapsed().as_millis() as u64;
+        let mut events = Vec::new();
+        for board in boards {
+            let state = self.boards.entry(board.name.clone()).or_default();
+            if state.status.as_ref() != Some(&board.status) {
+                events.push(SessionEvent::Status {
+                    board: board.name.clone(),
+                    status: board.status.clone(),
+                });
+                state.status = Some(board.status.clone());
+            }
+
+            let lines = &board.log_lines;
+            let appended = lines.len() >= state.lines
+                && (state.lines == 0 || lines.get(state.lines - 1) == state.last_line.as_ref());
+            let from = if appended {
+                state.lines
+            } else {
+                events.push(SessionEvent::Clear {
+                    board: board.name.clone(),
+                });
+                0
+            };
+            if lines.len() > from {
+                events.push(SessionEvent::Log {
+                    board: board.name.clone(),
+                    lines: lines[from..].to_vec(),
+                });
+            }
+            state.lines = lines.len();
+            state.last_line = lines.last().cloned();
+        }
+
+        for event in events {
+            serde_json::to_writer(&mut self.writer, &SessionEntry { at_ms, event })?;
+            self.writer.write_all(b"\n")?;
+        }
+        self.writer.flush()?;
+        Ok(())
+    }
+}
+
+/// A recording being played back
+#[derive(Debug, Clone)]
+pub struct SessionReplay {
+    pub header: SessionHeader,
+    pub entries: Vec<SessionEntry>,
+    /// How many times as fast as it happened
+    pub speed: f64,
+    next: usize,
+    started: Option<Instant>,
+}
+
+impl SessionReplay {
+    pub fn parse(content: &str) -> Result<Self> {
+        let lines: Vec<(usize, &str)> = content
+            .lines()
+            .enumerate()
+            .filter(|(_, line)| !line.trim().is_empty())
+            .collect();
+        let Some(((_, first), events)) = lines.split_first() else {
+            return Err(anyhow::anyhow!("The recording is empty"));
+        };
+        let header: SessionHeader =
+            serde_json::from_str(first).context("Not an espbrew recording")?;
+        if header.version > RECORDING_VERSION {
+            return Err(anyhow::anyhow!(
+                "Recorded by espbrew {} in format {}, this espbrew replays up to format {}",
+                header.espbrew,
+                header.version,
+                RECORDING_VERSION
+            ));
+        }
+
+        let mut entries = Vec::new();
+        for (position, (index, line)) in events.iter().enumerate() {
+            match serde_json::from_str(line) {
+                Ok(entry) => entries.push(entry),
+                // Every event ends in a newline, so a last line without one
+                // is half an event a crash cut off
+                Err(_) if position + 1 == events.len() && !content.ends_with('\n') => {}
+                Err(e) => {
+                    return Err(e).with_context(|| format!("Invalid event on line {}", index + 1));
+                }
+            }
+        }
+        Ok(Self {
+            header,
+            entries,
+            speed: 1.0,
+            next: 0,
+            started: None,
+        })
+    }
+
+    pub fn load(path: &Path) -> Result<Self> {
+        let content = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read {}", path.display()))?;
+        Self::parse(&content).with_context(|| format!("Failed to replay {}", path.display()))
+    }
+
+    /// Entries due `elapsed` into the replay that were not returned yet
+    pub fn due(&mut self, elapsed: Duration) -> &[SessionEntry] {
+        let now_ms = elapsed.as_secs_f64() * 1000.0 * self.speed.max(f64::MIN_POSITIVE);
+        let start = self.next;
+        while self
+            .entries
+            .get(self.next)
+            .is_some_and(|entry| entry.at_ms as f64 <= now_ms)
+        {
+            self.next += 1;
+        }
+        &self.entries[start..self.next]
+    }
+
+    /// Entries due now, the replay's clock starting at the first call
+    pub fn advance(&mut self) -> Vec<SessionEntry> {
+        let started = *self.started.get_or_insert_with(Instant::now);
+        self.due(started.elapsed()).to_vec()
+    }
+
+    pub fn is_finished(&self) -> bool {
+        self.next >= self.entries.len()
+    }
+
+    /// How long the recorded session ran
+    pub fn duration(&self) -> Duration {
+        Duration::from_millis(self.entries.last().map_or(0, |entry| entry.at_ms))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::project::ProjectType;
+    use std::path::PathBuf;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_session_recording_replay() {
+        let mut board = BoardConfig {
+            name: "esp32s3".to_string(),
+            config_file: PathBuf::from("sdkconfig.defaults.esp32s3"),
+            build_dir: PathBuf::from("build.esp32s3"),
+            status: BuildStatus::Pending,
+            log_lines: Vec::new(),
+            log_resets: 0,
+            build_time: None,
+            last_updated: Local::now(),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+            workspace: None,
+            tags: vec!["esp32s3".to_string()],
+        };
+        let temp_dir = TempDir::new().unwrap();
+        let path = temp_dir.path().join("sessions/run.jsonl");
+        let header = SessionHeader::new(
+            "app",
+            &[RecordedBoard {
+                name: board.name.clone(),
+                target: board.target.clone(),
+                tags: board.tags.clone(),
+            }],
+        );
+        let mut recorder = SessionRecorder::create(&path, &header).unwrap();
+
+        recorder.record([&board]).unwrap();
+        board.status = BuildStatus::Building;
+        board.log_lines = vec!["🔨 Building".to_string(), "[1/2] app.c".to_string()];
+        recorder.record([&board]).unwrap();
+        // Nothing changed, nothing recorded
+        recorder.record([&board]).unwrap();
+        board.log_lines.push("[2/2] Linking".to_string());
+        board.status = BuildStatus::Success;
+        recorder.record([&board]).unwrap();
+        // A new action clears the log
+        board.log_lines = vec!["🔥 Flashing".to_string()];
+        recorder.record([&board]).unwrap();
+
+        let mut replay = SessionReplay::load(&path).unwrap();
+        assert_eq!(replay.header.project, "app");
+        assert_eq!(replay.header.boards[0].tags, vec!["esp32s3"]);
+        let events: Vec<SessionEvent> = replay.entries.iter().map(|e| e.event.clone()).collect();
+        let board_name = "esp32s3".to_string();
+        assert_eq!(
+            events,
+            vec![
+                SessionEvent::Status {
+                    board: board_name.clone(),
+                    status: BuildStatus::Pending,
+                },
+                SessionEvent::Status {
+                    board: board_name.clone(),
+                    status: BuildStatus::Building,
+                },
+                SessionEvent::Log {
+                    board: board_name.clone(),
+                    lines: vec!["🔨 Building".to_string(), "[1/2] app.c".to_string()],
+                },
+                SessionEvent::Status {
+                    board: board_name.clone(),
+                    status: BuildStatus::Success,
+                },
+                SessionEvent::Log {
+                    board: board_name.clone(),
+                    lines: vec!["[2/2] Linking".to_string()],
+                },
+                SessionEvent::Clear {
+                    board: board_name.clone(),
+                },
+                SessionEvent::Log {
+                    board: board_name.clone(),
+                    lines: vec!["🔥 Flashing".to_string()],
+                },
+            ]
+        );
+
+        // Entries come due by their time, sped up
+        let content = std::fs::read_to_string(&path).unwrap();
+        let header_line = content.lines().next().unwrap();
+        let recording = format!(
+            "{}\n{}\n{}\n{}",
+            header_line,
+            r#"{"at_ms":0,"event":{"kind":"status","board":"esp32s3","status":"Building"}}"#,
+            r#"{"at_ms":10000,"event":{"kind":"log","board":"esp32s3","lines":["done"]}}"#,
+            // Cut off by a crash
+            r#"{"at_ms":20000,"event":{"kind":"lo"#
+        );
+        replay = SessionReplay::parse(&recording).unwrap();
+        replay.speed = 10.0;
+        assert_eq!(replay.entries.len(), 2);
+        assert_eq!(replay.due(Duration::ZERO).len(), 1);
+        assert!(replay.due(Duration::from_millis(500)).is_empty());
+        assert_eq!(replay.due(Duration::from_secs(1)).len(), 1);
+        assert!(replay.is_finished());
+        assert_eq!(replay.duration(), Duration::from_secs(10));
+        assert_eq!(
+            replay.entries[1].text(),
+            vec!["[00:10] esp32s3: done".to_string()]
+        );
+
+        assert!(SessionReplay::parse(&format!("{}\nnot json\n", header_line)).is_err());
+        assert!(SessionReplay::parse("").is_err());
+        assert_eq!(format_offset(65_000), "01:05");
+        assert_eq!(format_offset(3_723_000), "1:02:03");
+    }
+}
@@ -0,0 +1,304 @@
+//! Secure Boot v2 signing of bootloader and app images
+//!
+//! With a `signing:` section in `espbrew.yaml`, the bootloader and app of
+//! every ESP-IDF build are signed in place right after the build, with a key
+//! file through `espsecure.py sign_data` or with an external signer for keys
+//! held in an HSM:
+//!
+//! ```yaml
+//! signing:
+//!   key: keys/secure_boot_signing_key.pem
+//!   # or: signer: "hsm-sign --slot 2 {input} {output}"
+//!   release_profiles: [release]
+//! ```
+//!
+//! Builds of the release profiles fail when signing fails, and their images
+//! are never flashed, deployed or exported unsigned.
+
+use anyhow::{Context, Result};
+use std::io::{Read, Seek, SeekFrom};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::build_profiles::split_cell;
+use crate::config::{ProjectConfig, SigningSection};
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::container_build::shell_quote;
+use crate::projects::hooks::run_shell_command;
+use crate::projects::ota::find_app_binary;
+use crate::services::run_flash_tool;
+
+/// Profile whose builds are release builds unless `release_profiles` names others
+pub const RELEASE_PROFILE: &str = "release";
+
+/// Secure Boot v2 appends its signature blocks in a 4 KB sector after the
+/// padded image; each block starts with this magic byte and version
+const SIGNATURE_SECTOR_SIZE: u64 = 4096;
+const SIGNATURE_BLOCK_MAGIC: u8 = 0xE7;
+const SIGNATURE_BLOCK_VERSION: u8 = 0x02;
+
+/// Whether an image ends in a Secure Boot v2 signature sector, given its
+/// length and the first bytes of its last 4 KB sector
+pub fn has_signature_block(len: u64, last_sector: &[u8]) -> bool {
+    len >= SIGNATURE_SECTOR_SIZE
+        && len % SIGNATURE_SECTOR_SIZE == 0
+        && last_sector.starts_with(&[SIGNATURE_BLOCK_MAGIC, SIGNATURE_BLOCK_VERSION])
+}
+
+/// Whether the image at `path` is signed
+pub fn is_signed(path: &Path) -> Result<bool> {
+    let mut file =
+        std::fs::File::open(path).with_context(|| format!("Failed to open {}", path.display()))?;
+    let len = file.metadata()?.len();
+    if len < SIGNATURE_SECTOR_SIZE {
+        return Ok(false);
+    }
+    let mut header = [0u8; 2];
+    file.seek(SeekFrom::Start(len - SIGNATURE_SECTOR_SIZE))?;
+    file.read_exact(&mut header)?;
+    Ok(has_signature_block(len, &header))
+}
+
+/// Bootloader and app images of an ESP-IDF build that exist
+pub fn signable_images(build_dir: &Path) -> Vec<(&'static str, PathBuf)> {
+    let bootloader = build_dir.join("bootloader").join("bootloader.bin");
+    [
+        ("bootloader", bootloader.exists().then_some(bootloader)),
+        ("app", find_app_binary(build_dir)),
+    ]
+    .into_iter()
+    .filter_map(|(name, path)| Some((name, path?)))
+    .collect()
+}
+
+/// Whether the board is built with one of the release profiles
+pub fn is_release_build(
+    config: &ProjectConfig,
+    signing: &SigningSection,
+    board_name: &str,
+) -> bool {
+    split_cell(config, board_name).is_some_and(|(_, profile, _)| {
+        if signing.release_profiles.is_empty() {
+            profile == RELEASE_PROFILE
+        } else {
+            signing.release_profiles.iter().any(|p| p == profile)
+        }
+    })
+}
+
+/// `espsecure.py` arguments signing `input` with `key` into `output`
+pub fn espsecure_args(key: &Path, input: &Path, output: &Path) -> Vec<String> {
+    vec![
+        "sign_data".to_string(),
+        "--version".to_string(),
+        "2".to_string(),
+        "--keyfile".to_string(),
+        key.display().to_string(),
+        "--output".to_string(),
+        output.display().to_string(),
+        input.display().to_string(),
+    ]
+}
+
+/// External signer command line with its `{input}` and `{output}` filled in
+pub fn signer_command(signer: &str, input: &Path, output: &Path) -> String {
+    signer
+        .replace("{input}", &shell_quote(&input.display().to_string()))
+        .replace("{output}", &shell_quote(&output.display().to_string()))
+}
+
+/// Sign the image at `path` in place
+async fn sign_image(
+    project_dir: &Path,
+    signing: &SigningSection,
+    board_name: &str,
+    path: &Path,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let output = path.with_extension("signed.bin");
+    match (&signing.key, &signing.signer) {
+        (Some(key), None) => {
+            let mut command = Command::new("espsecure.py");
+            command.current_dir(project_dir).args(espsecure_args(
+                &project_dir.join(key),
+                path,
+                &output,
+            ));
+            run_flash_tool(command, "espsecure.py", board_name, Some(tx), |_| None).await?;
+        }
+        (None, Some(signer)) => {
+            let status = run_shell_command(
+                project_dir,
+                &signer_command(signer, path, &output),
+                &[
+                    ("ESPBREW_SIGN_INPUT".to_string(), path.display().to_string()),
+                    (
+                        "ESPBREW_SIGN_OUTPUT".to_string(),
+                        output.display().to_string(),
+                    ),
+                ],
+                board_name,
+                tx,
+            )
+            .await?;
+            if !status.success() {
+                return Err(anyhow::anyhow!("The signer failed with {}", status));
+            }
+        }
+        (None, None) => {
+            return Err(anyhow::anyhow!(
+                "The signing section needs a key or a signer"
+            ));
+        }
+        (Some(_), Some(_)) => {
+            return Err(anyhow::anyhow!(
+                "The signing section may have only one of key and signer"
+            ));
+        }
+    }
+
+    if !is_signed(&output).unwrap_or(false) {
+        return Err(anyhow::anyhow!(
+            "{} has no Secure Boot v2 signature block",
+            output.display()
+        ));
+    }
+    std::fs::rename(&output, path).with_context(|| format!("Failed to replace {}", path.display()))
+}
+
+/// Sign the bootloader and app of the board's build, if the project
+/// configures signing. Images signed before are left alone. A release build
+/// fails when an image can't be signed, any other build keeps it unsigned.
+pub async fn sign_build(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let Some(config) = ProjectConfig::load(project_dir)? else {
+        return Ok(());
+    };
+    let Some(signing) = &config.signing else {
+        return Ok(());
+    };
+    let release = is_release_build(&config, signing, &board_config.name);
+
+    let images = signable_images(&board_config.build_dir);
+    if images.is_empty() {
+        return Err(anyhow::anyhow!(
+            "No bootloader or app image to sign in {}",
+            board_config.build_dir.display()
+        ));
+    }
+    for (name, path) in images {
+        if is_signed(&path)? {
+            continue;
+        }
+        match sign_image(project_dir, signing, &board_config.name, &path, tx).await {
+            Ok(()) => {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!("🔏 Signed the {} ({})", name, path.display()),
+                ));
+            }
+            Err(e) if release => {
+                return Err(e.context(format!("Release build {} left unsigned", board_config.name)));
+            }
+            Err(e) => {
+                let _ = tx.send(AppEvent::BuildOutput(
+                    board_config.name.clone(),
+                    format!("⚠️  The {} stays unsigned: {:#}", name, e),
+                ));
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Refuse to let the images of a release build leave the machine unsigned
+pub fn ensure_signed(project_dir: &Path, board_config: &ProjectBoardConfig) -> Result<()> {
+    let Some(config) = ProjectConfig::load(project_dir)? else {
+        return Ok(());
+    };
+    let Some(signing) = &config.signing else {
+        return Ok(());
+    };
+    if !is_release_build(&config, signing, &board_config.name) {
+        return Ok(());
+    }
+    for (name, path) in signable_images(&board_config.build_dir) {
+        if !is_signed(&path)? {
+            return Err(anyhow::anyhow!(
+                "The {} of release build {} is unsigned ({}), rebuild it to sign it",
+                name,
+                board_config.name,
+                path.display()
+            ));
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_signing_release_builds() {
+        assert!(has_signature_block(8192, &[0xE7, 0x02, 0x00]));
+        assert!(!has_signature_block(8192, &[0xE9, 0x02]));
+        assert!(!has_signature_block(8000, &[0xE7, 0x02]));
+
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "profiles:\n  debug:\n    optimization: debug\n  release:\n    optimization: size\nsigning:\n  key: keys/signing.pem\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        let signing = config.signing.clone().unwrap();
+        assert_eq!(signing.key.as_deref(), Some("keys/signing.pem"));
+        assert!(is_release_build(&config, &signing, "esp32s3-release"));
+        assert!(!is_release_build(&config, &signing, "esp32s3-debug"));
+        assert!(!is_release_build(&config, &signing, "esp32s3"));
+
+        let board = |name: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join("sdkconfig.defaults.esp32s3"),
+            build_dir: project.join(format!("build.{}", name)),
+            target: Some("esp32s3".to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        for name in ["esp32s3-release", "esp32s3-debug"] {
+            let bootloader_dir = board(name).build_dir.join("bootloader");
+            fs::create_dir_all(&bootloader_dir).unwrap();
+            fs::write(bootloader_dir.join("bootloader.bin"), vec![0xE9; 5000]).unwrap();
+        }
+        assert!(ensure_signed(project, &board("esp32s3-release")).is_err());
+        assert!(ensure_signed(project, &board("esp32s3-debug")).is_ok());
+
+        let mut signed = vec![0xE9; 4096];
+        signed.extend([0xE7, 0x02]);
+        signed.resize(8192, 0xFF);
+        let bootloader = board("esp32s3-release")
+            .build_dir
+            .join("bootloader")
+            .join("bootloader.bin");
+        fs::write(&bootloader, &signed).unwrap();
+        assert!(is_signed(&bootloader).unwrap());
+        assert!(ensure_signed(project, &board("esp32s3-release")).is_ok());
+
+        assert_eq!(
+            signer_command(
+                "hsm-sign --slot 2 {input} {output}",
+                Path::new("build/app.bin"),
+                Path::new("build/app.signed.bin")
+            ),
+            "hsm-sign --slot 2 'build/app.bin' 'build/app.signed.bin'"
+        );
+    }
+}
@@ -0,0 +1,232 @@
+//! Source locations of build logs, as terminal hyperlinks and editor commands
+//!
+//! `espbrew build` prints the `file:line:column` locations of its board logs
+//! as OSC 8 hyperlinks when its output is a terminal, so a click on a
+//! compiler error opens the file. They link to `file://<path>` unless
+//! `$ESPBREW_LINK_URL` gives a template, e.g.
+//! `vscode://file{path}:{line}:{column}` to open the line in VS Code.
+//!
+//! **e** in the TUI opens the selected board's next compiler diagnostic, or
+//! the one on the current search match, in `$VISUAL` or `$EDITOR` at its
+//! line. Locations ninja printed relative to the build directory
+//! (`../main/app.c`) are resolved against it, other relative ones against
+//! the project.
+
+use regex::Regex;
+use std::path::{Path, PathBuf};
+use std::sync::OnceLock;
+
+use crate::projects::build_plan::PlannedCommand;
+use crate::utils::diagnostics::lexical_join;
+
+/// Environment variable of the hyperlinks' URL template
+pub const LINK_URL_VAR: &str = "ESPBREW_LINK_URL";
+
+/// URL of the hyperlinks without a template
+pub const DEFAULT_LINK_URL: &str = "file://{path}";
+
+/// A line, and maybe column, of a source file
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SourceLocation {
+    pub path: PathBuf,
+    pub line: u32,
+    pub column: Option<u32>,
+}
+
+impl SourceLocation {
+    /// The `file:line[:column]` text, resolved against the build directory
+    /// and the project
+    pub fn parse(text: &str, build_dir: &Path, project_dir: &Path) -> Option<Self> {
+        let captures = location_regex().captures(text)?;
+        Some(Self {
+            path: resolve_path(&captures["path"], build_dir, project_dir),
+            line: captures["line"].parse().ok()?,
+            column: captures
+                .name("column")
+                .and_then(|column| column.as_str().parse().ok()),
+        })
+    }
+
+    /// e.g. `/work/app/main/app.c:12:5`
+    pub fn display(&self) -> String {
+        match self.column {
+            Some(column) => format!("{}:{}:{}", self.path.display(), self.line, column),
+            None => format!("{}:{}", self.path.display(), self.line),
+        }
+    }
+}
+
+fn location_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    // A path with a file extension, after the start of the line, a space, a
+    // quote or a parenthesis
+    REGEX.get_or_init(|| {
+        Regex::new(concat!(
+            r#"(?:^|[\s('"])(?P<path>(?:[A-Za-z]:)?[\w.~/\\+-]*\.[A-Za-z][\w+]*)"#,
+            r":(?P<line>\d+)(?::(?P<column>\d+))?"
+        ))
+        .unwrap()
+    })
+}
+
+/// Where a path of a board's log is: as is if absolute, in the build
+/// directory if it starts with `..`, else in the project
+pub fn resolve_path(path: &str, build_dir: &Path, project_dir: &Path) -> PathBuf {
+    if Path::new(path).is_absolute() {
+        PathBuf::from(path)
+    } else if path.starts_with("..") {
+        lexical_join(build_dir, path)
+    } else {
+        lexical_join(project_dir, path)
+    }
+}
+
+/// URL of a location by the template's `{path}`, `{line}` and `{column}`
+pub fn location_url(template: &str, location: &SourceLocation) -> String {
+    template
+        .replace("{path}", &location.path.display().to_string())
+        .replace("{line}", &location.line.to_string())
+        .replace("{column}", &location.column.unwrap_or(1).to_string())
+}
+
+/// The `$ESPBREW_LINK_URL` template, or `file://{path}`
+pub fn link_url_template() -> String {
+    std::env::var(LINK_URL_VAR)
+        .ok()
+        .filter(|template| !template.trim().is_empty())
+        .unwrap_or_else(|| DEFAULT_LINK_URL.to_string())
+}
+
+/// The line with each of its source locations as a terminal hyperlink (OSC 8)
+pub fn hyperlink_locations(
+    line: &str,
+    build_dir: &Path,
+    project_dir: &Path,
+    template: &str,
+) -> String {
+    let mut linked = String::new();
+    let mut last = 0;
+    for captures in location_regex().captures_iter(line) {
+        let path = captures.name("path").unwrap();
+        let end = captures.get(0).unwrap().end();
+        let text = &line[path.start()..end];
+        let Some(location) = SourceLocation::parse(text, build_dir, project_dir) else {
+            continue;
+        };
+        linked.push_str(&line[last..path.start()]);
+        linked.push_str(&format!(
+            "\x1b]8;;{}\x1b\\{}\x1b]8;;\x1b\\",
+            location_url(template, &location),
+            text
+        ));
+        last = end;
+    }
+    linked.push_str(&line[last..]);
+    linked
+}
+
+/// `$VISUAL`, else `$EDITOR`
+pub fn configured_editor() -> Option<String> {
+    ["VISUAL", "EDITOR"]
+        .iter()
+        .filter_map(|var| std::env::var(var).ok())
+        .find(|editor| !editor.trim().is_empty())
+}
+
+/// Command opening the location in the editor, which may come with
+/// arguments like `code -w`. Editors are told the line the way they take it:
+/// `--goto file:line:column`, `file:line:column` or `+line file`.
+pub fn editor_command(
+    editor: &str,
+    location: &SourceLocation,
+    working_dir: &Path,
+) -> PlannedCommand {
+    let mut words = editor.split_whitespace();
+    let program = words.next().unwrap_or("vi");
+    let mut command = PlannedCommand::new("editor", program, working_dir).args(words);
+
+    let name = Path::new(program)
+        .file_stem()
+        .map(|stem| stem.to_string_lossy().to_lowercase())
+        .unwrap_or_default();
+    let path = location.path.display().to_string();
+    let with_column = format!(
+        "{}:{}:{}",
+        path,
+        location.line,
+        location.column.unwrap_or(1)
+    );
+    command = match name.as_str() {
+        "code" | "code-insiders" | "codium" | "cursor" => command.args(["--goto", &with_column]),
+        "subl" | "sublime_text" | "zed" | "hx" | "helix" | "micro" => command.arg(with_column),
+        "idea" | "clion" => command.args(["--line", &location.line.to_string(), &path]),
+        _ => command.args([format!("+{}", location.line), path]),
+    };
+    command
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::diagnostics::diagnostic_location;
+
+    #[test]
+    fn test_source_links() {
+        let project = Path::new("/work/app");
+        let build = Path::new("/work/app/build.esp32s3");
+
+        // Ninja's locations are in the build directory, the rest in the project
+        let line = "../main/app.c:12:5: error: 'x' undeclared";
+        let location = SourceLocation::parse(&diagnostic_location(line).unwrap(), build, project);
+        assert_eq!(
+            location,
+            Some(SourceLocation {
+                path: PathBuf::from("/work/app/main/app.c"),
+                line: 12,
+                column: Some(5),
+            })
+        );
+        let location = SourceLocation::parse("components/led/led.h:3", build, project).unwrap();
+        assert_eq!(
+            location.path,
+            PathBuf::from("/work/app/components/led/led.h")
+        );
+        assert_eq!(location.column, None);
+        assert!(diagnostic_location("[12/980] Building C object app.c.obj").is_none());
+
+        // Each location becomes a hyperlink, the rest of the line stays as is
+        let linked = hyperlink_locations(
+            "In file included from /idf/esp.h:4, from ../main/app.c:2:",
+            build,
+            project,
+            "file://{path}",
+        );
+        assert_eq!(
+            linked,
+            "In file included from \x1b]8;;file:///idf/esp.h\x1b\\/idf/esp.h:4\x1b]8;;\x1b\\, \
+             from \x1b]8;;file:///work/app/main/app.c\x1b\\../main/app.c:2\x1b]8;;\x1b\\:"
+        );
+        assert_eq!(
+            hyperlink_locations("Version 5.1 at 12:30", build, project, "file://{path}"),
+            "Version 5.1 at 12:30"
+        );
+        assert_eq!(
+            location_url("vscode://file{path}:{line}:{column}", &location),
+            "vscode://file/work/app/components/led/led.h:3:1"
+        );
+
+        // Editors are told the line the way they take it
+        let location = SourceLocation::parse("/work/app/main/app.c:12:5", build, project).unwrap();
+        let args = |editor: &str| editor_command(editor, &location, project).args;
+        assert_eq!(args("nvim"), vec!["+12", "/work/app/main/app.c"]);
+        assert_eq!(
+            args("/usr/bin/code -w"),
+            vec!["-w", "--goto", "/work/app/main/app.c:12:5"]
+        );
+        assert_eq!(args("zed"), vec!["/work/app/main/app.c:12:5"]);
+        assert_eq!(
+            editor_command("code -w", &location, project).program,
+            "code"
+        );
+    }
+}
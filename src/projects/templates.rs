@@ -0,0 +1,414 @@
+//! Starter project templates for `espbrew new`
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+use crate::config::PROJECT_CONFIG_FILE;
+
+/// Chips a new project is configured for when none are given
+pub const DEFAULT_TEMPLATE_CHIPS: &[&str] = &["esp32", "esp32s3", "esp32c3", "esp32c6"];
+
+/// Starter projects that `espbrew new` can generate
+#[derive(Debug, Clone, Copy, PartialEq, clap::ValueEnum)]
+pub enum ProjectTemplate {
+    /// ESP-IDF hello_world with one sdkconfig.defaults.<chip> per board
+    EspIdf,
+    /// TinyGo LED blink with one `-target` per board
+    Tinygo,
+    /// Rust no_std esp-hal blinky with one .cargo/config_<chip>.toml per board
+    RustEspHal,
+}
+
+impl ProjectTemplate {
+    pub fn name(&self) -> &'static str {
+        match self {
+            ProjectTemplate::EspIdf => "esp-idf",
+            ProjectTemplate::Tinygo => "tinygo",
+            ProjectTemplate::RustEspHal => "rust-esp-hal",
+        }
+    }
+
+    /// Check that the template can target the chip
+    fn supports_chip(&self, chip: &str) -> bool {
+        match self {
+            ProjectTemplate::EspIdf => matches!(
+                chip,
+                "esp32"
+                    | "esp32s2"
+                    | "esp32s3"
+                    | "esp32c2"
+                    | "esp32c3"
+                    | "esp32c5"
+                    | "esp32c6"
+                    | "esp32h2"
+                    | "esp32p4"
+            ),
+            ProjectTemplate::Tinygo => tinygo_target(chip).is_some(),
+            ProjectTemplate::RustEspHal => rust_target(chip).is_some(),
+        }
+    }
+}
+
+/// TinyGo `-target` for a chip, matching the targets espbrew detects
+fn tinygo_target(chip: &str) -> Option<&'static str> {
+    match chip {
+        "esp32" => Some("esp32-coreboard-v2"),
+        "esp32s3" => Some("esp32-s3-usb-otg"),
+        "esp32c3" => Some("esp32-c3-mini"),
+        "esp32c6" => Some("esp32-c6-generic"),
+        "esp8266" => Some("nodemcu"),
+        _ => None,
+    }
+}
+
+/// Rust target triple for a chip supported by esp-hal
+fn rust_target(chip: &str) -> Option<&'static str> {
+    match chip {
+        "esp32" => Some("xtensa-esp32-none-elf"),
+        "esp32s2" => Some("xtensa-esp32s2-none-elf"),
+        "esp32s3" => Some("xtensa-esp32s3-none-elf"),
+        "esp32c2" | "esp32c3" => Some("riscv32imc-unknown-none-elf"),
+        "esp32c6" | "esp32h2" => Some("riscv32imac-unknown-none-elf"),
+        _ => None,
+    }
+}
+
+/// Generate a starter project in `dest` and return the files written.
+///
+/// `dest` must not exist yet or be empty; the project name is taken from the
+/// directory name.
+pub fn generate_project(
+    template: ProjectTemplate,
+    dest: &Path,
+    chips: &[String],
+) -> Result<Vec<PathBuf>> {
+    let chips: Vec<String> = if chips.is_empty() {
+        DEFAULT_TEMPLATE_CHIPS
+            .iter()
+            .map(|c| c.to_string())
+            .collect()
+    } else {
+        chips
+            .iter()
+            .map(|c| c.to_lowercase().replace('-', ""))
+            .collect()
+    };
+
+    for chip in &chips {
+        if !template.supports_chip(chip) {
+            return Err(anyhow::anyhow!(
+                "Template '{}' does not support chip '{}'",
+                template.name(),
+                chip
+            ));
+        }
+    }
+
+    if dest.exists() && dest.read_dir()?.next().is_some() {
+        return Err(anyhow::anyhow!(
+            "Destination {} already exists and is not empty",
+            dest.display()
+        ));
+    }
+
+    let project_name = dest
+        .file_name()
+        .and_then(|n| n.to_str())
+        .map(|n| n.replace(|c: char| !c.is_ascii_alphanumeric() && c != '_', "_"))
+        .filter(|n| !n.is_empty())
+        .unwrap_or_else(|| "espbrew_project".to_string());
+
+    let files = match template {
+        ProjectTemplate::EspIdf => esp_idf_files(&project_name, &chips),
+        ProjectTemplate::Tinygo => tinygo_files(&project_name, &chips),
+        ProjectTemplate::RustEspHal => rust_esp_hal_files(&project_name, &chips),
+    };
+
+    let mut written = Vec::new();
+    for (relative_path, content) in files {
+        let path = dest.join(relative_path);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        std::fs::write(&path, content)
+            .with_context(|| format!("Failed to write {}", path.display()))?;
+        written.push(path);
+    }
+
+    Ok(written)
+}
+
+fn espbrew_yaml(template: ProjectTemplate, section: &str) -> String {
+    format!(
+        "# espbrew project configuration (generated from the {} template)\n\
+         # Run `espbrew` in this directory to build all boards from the TUI,\n\
+         # or `espbrew --cli build` to build them from a script.\n{}",
+        template.name(),
+        section
+    )
+}
+
+fn esp_idf_files(project_name: &str, chips: &[String]) -> Vec<(String, String)> {
+    let mut files = vec![
+        (
+            "CMakeLists.txt".to_string(),
+            format!(
+                "# The following lines of boilerplate have to be in your project's\n\
+                 # CMakeLists in this exact order for cmake to work correctly\n\
+                 cmake_minimum_required(VERSION 3.16)\n\n\
+                 include($ENV{{IDF_PATH}}/tools/cmake/project.cmake)\n\
+                 project({})\n",
+                project_name
+            ),
+        ),
+        (
+            "main/CMakeLists.txt".to_string(),
+            "idf_component_register(SRCS \"hello_world_main.c\"\n                       INCLUDE_DIRS \"\")\n"
+                .to_string(),
+        ),
+        (
+            "main/hello_world_main.c".to_string(),
+            r#"#include <stdio.h>
+#include "freertos/FreeRTOS.h"
+#include "freertos/task.h"
+#include "esp_chip_info.h"
+#include "esp_system.h"
+
+void app_main(void)
+{
+    esp_chip_info_t chip_info;
+    esp_chip_info(&chip_info);
+    printf("Hello world from %s with %d CPU core(s)!\n", CONFIG_IDF_TARGET, chip_info.cores);
+
+    for (int i = 10; i >= 0; i--) {
+        printf("Restarting in %d seconds...\n", i);
+        vTaskDelay(1000 / portTICK_PERIOD_MS);
+    }
+    printf("Restarting now.\n");
+    fflush(stdout);
+    esp_restart();
+}
+"#
+            .to_string(),
+        ),
+        (
+            ".gitignore".to_string(),
+            "build/\nbuild.*/\nsdkconfig\nsdkconfig.old\nlogs/\nsupport/\n".to_string(),
+        ),
+        (
+            PROJECT_CONFIG_FILE.to_string(),
+            espbrew_yaml(
+                ProjectTemplate::EspIdf,
+                "# Boards are discovered from sdkconfig.defaults.<board> files.\n\
+                 esp_idf:\n  apps: []\n",
+            ),
+        ),
+    ];
+
+    for chip in chips {
+        files.push((
+            format!("sdkconfig.defaults.{}", chip),
+            format!(
+                "CONFIG_IDF_TARGET=\"{}\"\nCONFIG_ESPTOOLPY_FLASHSIZE_4MB=y\n",
+                chip
+            ),
+        ));
+    }
+
+    files
+}
+
+fn tinygo_files(project_name: &str, chips: &[String]) -> Vec<(String, String)> {
+    let targets: Vec<String> = chips
+        .iter()
+        .filter_map(|chip| tinygo_target(chip))
+        .map(|target| format!("    - {}\n", target))
+        .collect();
+
+    vec![
+        (
+            "go.mod".to_string(),
+            format!("module {}\n\ngo 1.21\n", project_name),
+        ),
+        (
+            "main.go".to_string(),
+            r#"package main
+
+import (
+	"machine"
+	"time"
+)
+
+// Built-in LED pin on most ESP32 development boards
+const LED_PIN = machine.GPIO2
+
+func main() {
+	LED_PIN.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	println("Starting TinyGo LED blink")
+
+	for {
+		LED_PIN.High()
+		time.Sleep(500 * time.Millisecond)
+
+		LED_PIN.Low()
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+"#
+            .to_string(),
+        ),
+        (
+            ".gitignore".to_string(),
+            "build/\nlogs/\nsupport/\n".to_string(),
+        ),
+        (
+            PROJECT_CONFIG_FILE.to_string(),
+            espbrew_yaml(
+                ProjectTemplate::Tinygo,
+                &format!("tinygo:\n  targets:\n{}", targets.concat()),
+            ),
+        ),
+    ]
+}
+
+fn rust_esp_hal_files(project_name: &str, chips: &[String]) -> Vec<(String, String)> {
+    let features: Vec<String> = chips
+        .iter()
+        .map(|chip| {
+            format!(
+                "{chip} = [\"esp-hal/{chip}\", \"esp-backtrace/{chip}\", \"esp-println/{chip}\", \"esp-bootloader-esp-idf/{chip}\"]\n"
+            )
+        })
+        .collect();
+
+    let needs_xtensa = chips
+        .iter()
+        .any(|chip| rust_target(chip).is_some_and(|t| t.starts_with("xtensa")));
+    let toolchain = if needs_xtensa {
+        // Xtensa chips need the Espressif toolchain installed with espup
+        "[toolchain]\nchannel = \"esp\"\n".to_string()
+    } else {
+        let mut targets: Vec<&str> = chips.iter().filter_map(|c| rust_target(c)).collect();
+        targets.dedup();
+        format!(
+            "[toolchain]\nchannel = \"stable\"\ncomponents = [\"rust-src\"]\ntargets = [{}]\n",
+            targets
+                .iter()
+                .map(|t| format!("\"{}\"", t))
+                .collect::<Vec<_>>()
+                .join(", ")
+        )
+    };
+
+    let mut files = vec![
+        (
+            "Cargo.toml".to_string(),
+            format!(
+                r#"[package]
+name = "{project_name}"
+version = "0.1.0"
+edition = "2021"
+
+[dependencies]
+esp-hal = "1.0.0"
+esp-backtrace = {{ version = "0.18.0", features = ["panic-handler", "println"] }}
+esp-println = {{ version = "0.16.0", features = ["log-04"] }}
+esp-bootloader-esp-idf = "0.4.0"
+
+[features]
+{features}
+[profile.dev]
+# Rust debug is too slow; always build with some optimization
+opt-level = "s"
+
+[profile.release]
+codegen-units = 1
+debug = 2
+lto = "fat"
+opt-level = "s"
+"#,
+                features = features.concat(),
+            ),
+        ),
+        (
+            "src/main.rs".to_string(),
+            r#"#![no_std]
+#![no_main]
+
+use esp_backtrace as _;
+use esp_hal::delay::Delay;
+use esp_hal::gpio::{Level, Output, OutputConfig};
+use esp_hal::main;
+use esp_println::println;
+
+esp_bootloader_esp_idf::esp_app_desc!();
+
+#[main]
+fn main() -> ! {
+    let peripherals = esp_hal::init(esp_hal::Config::default());
+
+    // Built-in LED on many ESP32 development boards
+    let mut led = Output::new(peripherals.GPIO2, Level::Low, OutputConfig::default());
+    let delay = Delay::new();
+
+    println!("Starting esp-hal blinky");
+
+    loop {
+        led.toggle();
+        delay.delay_millis(500);
+    }
+}
+"#
+            .to_string(),
+        ),
+        (
+            "build.rs".to_string(),
+            "fn main() {\n    println!(\"cargo:rustc-link-arg=-Tlinkall.x\");\n}\n".to_string(),
+        ),
+        ("rust-toolchain.toml".to_string(), toolchain),
+        (
+            ".gitignore".to_string(),
+            "target/\nlogs/\nsupport/\n".to_string(),
+        ),
+        (
+            PROJECT_CONFIG_FILE.to_string(),
+            espbrew_yaml(
+                ProjectTemplate::RustEspHal,
+                "# Boards are discovered from .cargo/config_<board>.toml files.\n",
+            ),
+        ),
+    ];
+
+    for chip in chips {
+        let Some(target) = rust_target(chip) else {
+            continue;
+        };
+        let xtensa_flags = if target.starts_with("xtensa") {
+            "rustflags = [\"-C\", \"link-arg=-nostartfiles\"]\n"
+        } else {
+            ""
+        };
+        files.push((
+            format!(".cargo/config_{}.toml", chip),
+            format!(
+                r#"[build]
+target = "{target}"
+
+[target.{target}]
+runner = "espflash flash --monitor --chip {chip}"
+{xtensa_flags}
+[env]
+ESP_CONFIG_CHIP = "{chip}"
+ESP_LOG = "info"
+
+[unstable]
+build-std = ["core"]
+"#
+            ),
+        ));
+    }
+
+    files
+}
@@ -0,0 +1,161 @@
+//! Checks of the active toolchain against the versions pinned in `espbrew.yaml`
+
+use anyhow::{Context, Result};
+use std::path::Path;
+use tokio::process::Command;
+
+use crate::config::{Toolchain, ToolchainPins, extract_version, is_version_pin, version_matches};
+use crate::models::ProjectBoardConfig;
+use crate::utils::esp_idf_utils::detect_esp_idf_installations;
+
+/// Version of the toolchain espbrew would build with, or the rustup toolchain
+/// name when `by_name` is set
+pub async fn active_version(
+    toolchain: Toolchain,
+    project_dir: &Path,
+    by_name: bool,
+) -> Result<String> {
+    match toolchain {
+        Toolchain::EspIdf => {
+            let installation = detect_esp_idf_installations()
+                .default_installation
+                .ok_or_else(|| anyhow::anyhow!("No ESP-IDF installation found"))?;
+            Ok(extract_version(&installation.installation.version)
+                .unwrap_or(installation.installation.version))
+        }
+        Toolchain::TinyGo => command_version(project_dir, "tinygo", &["version"]).await,
+        Toolchain::Rust if by_name => {
+            // rustup resolves rust-toolchain.toml from the project directory
+            let output =
+                command_output(project_dir, "rustup", &["show", "active-toolchain"]).await?;
+            output
+                .split_whitespace()
+                .next()
+                .map(String::from)
+                .ok_or_else(|| anyhow::anyhow!("rustup reported no active toolchain"))
+        }
+        Toolchain::Rust => command_version(project_dir, "rustc", &["--version"]).await,
+    }
+}
+
+async fn command_version(project_dir: &Path, program: &str, args: &[&str]) -> Result<String> {
+    let output = command_output(project_dir, program, args).await?;
+    extract_version(&output)
+        .ok_or_else(|| anyhow::anyhow!("Unable to read the version from '{}'", output.trim()))
+}
+
+async fn command_output(project_dir: &Path, program: &str, args: &[&str]) -> Result<String> {
+    let output = Command::new(program)
+        .args(args)
+        .current_dir(project_dir)
+        .output()
+        .await
+        .with_context(|| format!("Failed to run {}", program))?;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "{} {} failed: {}",
+            program,
+            args.join(" "),
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+    Ok(String::from_utf8_lossy(&output.stdout).to_string())
+}
+
+/// Whether a rustup toolchain name satisfies a pin like `esp` or `nightly-2024-05-01`
+fn toolchain_name_matches(pin: &str, name: &str) -> bool {
+    name == pin || name.starts_with(&format!("{}-", pin))
+}
+
+/// Verify the toolchain of a board build against its pin.
+///
+/// Returns a description of the active toolchain, e.g. `ESP-IDF 5.3.1 (pinned
+/// 5.3)`, when a pin is set and satisfied, `None` when the toolchain isn't
+/// pinned, and an error naming both versions otherwise.
+pub async fn verify_toolchain(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+) -> Result<Option<String>> {
+    let Some(toolchain) = Toolchain::for_project_type(&board_config.project_type) else {
+        return Ok(None);
+    };
+    let pins = ToolchainPins::load(project_dir, &board_config.name);
+    let Some(pin) = pins.pin(toolchain) else {
+        return Ok(None);
+    };
+
+    let by_name = toolchain == Toolchain::Rust && !is_version_pin(pin);
+    let active = active_version(toolchain, project_dir, by_name)
+        .await
+        .with_context(|| {
+            format!(
+                "{} {} is pinned for {} in espbrew.yaml, but no {} toolchain could be found",
+                toolchain.name(),
+                pin,
+                board_config.name,
+                toolchain.name()
+            )
+        })?;
+
+    let matches = if by_name {
+        toolchain_name_matches(pin, &active)
+    } else {
+        version_matches(pin, &active)
+    };
+    if !matches {
+        return Err(anyhow::anyhow!(
+            "{} {} is pinned for {} in espbrew.yaml, but the active environment has {}. Switch the environment (e.g. source the matching export script) or update the pin",
+            toolchain.name(),
+            pin,
+            board_config.name,
+            active
+        ));
+    }
+
+    Ok(Some(format!(
+        "{} {} (pinned {})",
+        toolchain.name(),
+        active,
+        pin
+    )))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_verify_toolchain() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "toolchain:\n  tinygo: \"0.0.1\"\n",
+        )
+        .unwrap();
+
+        let board = |project_type: ProjectType| ProjectBoardConfig {
+            name: "box".to_string(),
+            config_file: project.join("main.go"),
+            build_dir: project.join("build"),
+            target: None,
+            project_type,
+        };
+
+        // Project types without a pinnable toolchain are never checked
+        assert!(
+            verify_toolchain(project, &board(ProjectType::Arduino))
+                .await
+                .unwrap()
+                .is_none()
+        );
+        // No TinyGo 0.0.1 exists: either tinygo is missing or its version differs
+        let error = verify_toolchain(project, &board(ProjectType::TinyGo))
+            .await
+            .unwrap_err();
+        assert!(format!("{:#}", error).contains("TinyGo 0.0.1 is pinned for box"));
+    }
+}
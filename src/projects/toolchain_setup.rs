@@ -0,0 +1,662 @@
+//! Toolchain setup for `espbrew setup`
+//!
+//! Installs what a project's boards build with into espbrew's toolchains
+//! directory (`~/.espbrew/toolchains`, or `ESPBREW_TOOLCHAINS_DIR`): the
+//! pinned ESP-IDF release with its tools, the Xtensa Rust toolchain through
+//! espup, and espflash. TinyGo ships its own LLVM and is only checked. ESP-IDF
+//! builds find the installation by themselves; `espbrew setup --print-env`
+//! prints the shell exports for everything else.
+
+use anyhow::{Context, Result};
+use std::collections::HashMap;
+use std::fs;
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+
+use crate::config::{
+    ProjectConfig, Toolchain, ToolchainPins, extract_version, is_version_pin, version_matches,
+};
+use crate::models::esp_idf_config::{
+    DetectedEspIdfInstallation, EspIdfDetectionSource, ManagedEnvironment,
+};
+use crate::models::{ProjectBoardConfig, ProjectType};
+use crate::projects::build_plan::PlannedCommand;
+use crate::projects::container_build::shell_quote;
+use crate::projects::toolchain_check::active_version;
+use crate::utils::esp_idf_utils::{
+    MANAGED_ACTIVE_FILE, MANAGED_ENV_FILE, active_managed_esp_idf, detect_esp_idf_installations,
+    find_in_path, managed_esp_idf_dir,
+};
+
+/// ESP-IDF release installed for projects that don't pin one
+pub const DEFAULT_ESP_IDF_VERSION: &str = "5.4";
+
+const ESP_IDF_REPOSITORY: &str = "https://github.com/espressif/esp-idf.git";
+
+/// Chips whose Rust targets need espup's Xtensa toolchain
+const XTENSA_CHIPS: &[&str] = &["esp32", "esp32s2", "esp32s3"];
+
+/// Variables of `export.sh` that describe the shell rather than ESP-IDF
+const SHELL_VARS: &[&str] = &["PWD", "OLDPWD", "SHLVL", "_"];
+
+/// What a project needs installed
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct SetupPlan {
+    pub toolchain: Option<Toolchain>,
+    /// Distinct pins of the project and its boards, the project pin first
+    pub pins: Vec<String>,
+    /// Chips of the boards, lowercase
+    pub targets: Vec<String>,
+    /// A board targets an Xtensa chip from Rust
+    pub xtensa_rust: bool,
+}
+
+/// Toolchains needed by a project's boards
+pub fn setup_plan(
+    project_dir: &Path,
+    project_type: &ProjectType,
+    boards: &[ProjectBoardConfig],
+) -> SetupPlan {
+    let Some(toolchain) = Toolchain::for_project_type(project_type) else {
+        return SetupPlan::default();
+    };
+
+    let project_pins = ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .map(|config| config.toolchain)
+        .unwrap_or_default();
+    let mut pins: Vec<String> = Vec::new();
+    let board_pins = boards
+        .iter()
+        .map(|board| ToolchainPins::load(project_dir, &board.name));
+    for board_pins in std::iter::once(project_pins).chain(board_pins) {
+        if let Some(pin) = board_pins.pin(toolchain)
+            && !pins.iter().any(|p| p == pin)
+        {
+            pins.push(pin.to_string());
+        }
+    }
+
+    let mut targets: Vec<String> = boards
+        .iter()
+        .filter_map(|board| board.target.as_deref())
+        .map(|target| target.to_lowercase())
+        .collect();
+    targets.sort();
+    targets.dedup();
+
+    let xtensa_rust = toolchain == Toolchain::Rust
+        && (targets
+            .iter()
+            .any(|target| XTENSA_CHIPS.contains(&target.as_str()))
+            || pins.iter().any(|pin| pin == "esp"));
+
+    SetupPlan {
+        toolchain: Some(toolchain),
+        pins,
+        targets,
+        xtensa_rust,
+    }
+}
+
+/// Git ref of an ESP-IDF version: `5.3` is the `release/v5.3` branch, `5.3.1`
+/// the `v5.3.1` tag, and names like `master` are used as they are
+pub fn esp_idf_git_ref(version: &str) -> String {
+    if !is_version_pin(version) {
+        return version.to_string();
+    }
+    let version = version.trim_start_matches(['v', 'V']);
+    if version.split('.').count() == 2 {
+        format!("release/v{}", version)
+    } else {
+        format!("v{}", version)
+    }
+}
+
+/// Directory name of a managed ESP-IDF version, e.g. `v5.3`
+pub fn esp_idf_install_name(version: &str) -> String {
+    if is_version_pin(version) {
+        format!("v{}", version.trim_start_matches(['v', 'V']))
+    } else {
+        version.replace(['/', '\\'], "_")
+    }
+}
+
+/// `IDF_TOOLS_PATH` of the managed ESP-IDF installations
+pub fn esp_idf_tools_dir(toolchains_dir: &Path) -> PathBuf {
+    toolchains_dir.join("espressif")
+}
+
+/// Where `cargo install --root` puts espflash and espup
+pub fn bin_dir(toolchains_dir: &Path) -> PathBuf {
+    toolchains_dir.join("bin")
+}
+
+/// Export file espup writes for the Xtensa Rust toolchain
+pub fn espup_export_file(toolchains_dir: &Path) -> PathBuf {
+    toolchains_dir.join("export-esp.sh")
+}
+
+/// Script sourcing every installed toolchain, written by `espbrew setup`
+pub fn env_script_path(toolchains_dir: &Path) -> PathBuf {
+    toolchains_dir.join("env.sh")
+}
+
+/// Install and check the toolchains of a plan; a dry run only prints the commands
+pub async fn run_setup(
+    project_dir: &Path,
+    toolchains_dir: &Path,
+    plan: &SetupPlan,
+    dry_run: bool,
+) -> Result<()> {
+    match plan.toolchain {
+        Some(Toolchain::EspIdf) => {
+            if plan.pins.is_empty() {
+                setup_esp_idf(toolchains_dir, None, &plan.targets, true, dry_run).await?;
+            }
+            // The project pin is the one builds use, board pins are installed next to it
+            for (index, pin) in plan.pins.iter().enumerate() {
+                setup_esp_idf(
+                    toolchains_dir,
+                    Some(pin),
+                    &plan.targets,
+                    index == 0,
+                    dry_run,
+                )
+                .await?;
+            }
+        }
+        Some(Toolchain::TinyGo) => check_tinygo(project_dir, plan.pins.first()).await?,
+        Some(Toolchain::Rust) => {
+            if plan.xtensa_rust {
+                setup_xtensa_rust(toolchains_dir, &plan.targets, dry_run).await?;
+            }
+        }
+        None => {}
+    }
+    setup_espflash(toolchains_dir, dry_run).await
+}
+
+/// Make an installation of an ESP-IDF version the one builds use, installing it when needed
+async fn setup_esp_idf(
+    toolchains_dir: &Path,
+    pin: Option<&str>,
+    targets: &[String],
+    activate: bool,
+    dry_run: bool,
+) -> Result<()> {
+    let detection = detect_esp_idf_installations();
+
+    // Without a pin any installation builds
+    let Some(pin) = pin else {
+        if let Some(default) = &detection.default_installation {
+            println!("✅ {}", default.get_description());
+            return Ok(());
+        }
+        return install_esp_idf(
+            toolchains_dir,
+            DEFAULT_ESP_IDF_VERSION,
+            targets,
+            activate,
+            dry_run,
+        )
+        .await;
+    };
+
+    let matching = |installation: &&DetectedEspIdfInstallation| {
+        let version = &installation.installation.version;
+        installation.is_available
+            && version_matches(pin, &extract_version(version).unwrap_or(version.clone()))
+    };
+    if let Some(default) = detection.default_installation.as_ref().filter(matching) {
+        println!("✅ {}", default.get_description());
+        return Ok(());
+    }
+
+    // Only installations of ours can be activated
+    let found = detection
+        .installations
+        .iter()
+        .filter(matching)
+        .find(|installation| {
+            !activate || installation.detection_source == EspIdfDetectionSource::Managed
+        });
+    match found {
+        Some(installation) => {
+            println!("✅ {}", installation.get_description());
+            if activate && !dry_run {
+                let name = installation
+                    .installation
+                    .path
+                    .file_name()
+                    .map(|name| name.to_string_lossy().to_string())
+                    .unwrap_or_default();
+                activate_esp_idf(toolchains_dir, &name)?;
+            }
+        }
+        None => install_esp_idf(toolchains_dir, pin, targets, activate, dry_run).await?,
+    }
+
+    // An explicit IDF_PATH or idf.py in PATH still wins over the activated installation
+    if activate
+        && let Some(default) = &detection.default_installation
+        && matches!(
+            default.detection_source,
+            EspIdfDetectionSource::EnvironmentVariable | EspIdfDetectionSource::SystemPath
+        )
+    {
+        println!(
+            "⚠️  {} is selected by the environment; unset IDF_PATH and remove idf.py from PATH to build with ESP-IDF {}",
+            default.get_description(),
+            pin
+        );
+    }
+    Ok(())
+}
+
+/// Clone an ESP-IDF version into the toolchains directory, install its tools
+/// and record the environment of its export script
+async fn install_esp_idf(
+    toolchains_dir: &Path,
+    version: &str,
+    targets: &[String],
+    activate: bool,
+    dry_run: bool,
+) -> Result<()> {
+    let parent = managed_esp_idf_dir(toolchains_dir);
+    let name = esp_idf_install_name(version);
+    let idf_dir = parent.join(&name);
+    let tools_dir = esp_idf_tools_dir(toolchains_dir);
+    println!(
+        "📦 Installing ESP-IDF {} into {}",
+        version,
+        idf_dir.display()
+    );
+
+    if !idf_dir.join("tools").join("idf.py").exists() {
+        if !dry_run {
+            fs::create_dir_all(&parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        let clone = PlannedCommand::new("clone", "git", &parent).args([
+            "clone".to_string(),
+            "--depth".to_string(),
+            "1".to_string(),
+            "--recursive".to_string(),
+            "--shallow-submodules".to_string(),
+            "--branch".to_string(),
+            esp_idf_git_ref(version),
+            ESP_IDF_REPOSITORY.to_string(),
+            idf_dir.display().to_string(),
+        ]);
+        run_step(&clone, dry_run).await?;
+    }
+
+    let install_script = if cfg!(windows) {
+        "install.bat"
+    } else {
+        "install.sh"
+    };
+    let chips = if targets.is_empty() {
+        "all".to_string()
+    } else {
+        targets.join(",")
+    };
+    let install = PlannedCommand::new(
+        "install",
+        &idf_dir.join(install_script).display().to_string(),
+        &idf_dir,
+    )
+    .arg(chips)
+    .env("IDF_TOOLS_PATH", tools_dir.display().to_string());
+    run_step(&install, dry_run).await?;
+
+    if dry_run {
+        println!("   # record the environment of export.sh");
+        return Ok(());
+    }
+    let environment = capture_export_env(&idf_dir, &tools_dir).await?;
+    fs::write(
+        idf_dir.join(MANAGED_ENV_FILE),
+        serde_json::to_string_pretty(&environment)?,
+    )
+    .with_context(|| format!("Failed to write {}", MANAGED_ENV_FILE))?;
+    if activate {
+        activate_esp_idf(toolchains_dir, &name)?;
+    }
+    println!("✅ ESP-IDF {} installed in {}", version, idf_dir.display());
+    Ok(())
+}
+
+fn activate_esp_idf(toolchains_dir: &Path, name: &str) -> Result<()> {
+    let path = managed_esp_idf_dir(toolchains_dir).join(MANAGED_ACTIVE_FILE);
+    fs::write(&path, format!("{}\n", name))
+        .with_context(|| format!("Failed to write {}", path.display()))
+}
+
+/// Environment the export script of an ESP-IDF installation sets up
+async fn capture_export_env(idf_dir: &Path, tools_dir: &Path) -> Result<ManagedEnvironment> {
+    let mut cmd = if cfg!(windows) {
+        let mut cmd = Command::new("cmd");
+        cmd.args(["/C", "export.bat >nul 2>&1 && set"]);
+        cmd
+    } else {
+        let mut cmd = Command::new("sh");
+        cmd.args(["-c", ". ./export.sh >/dev/null 2>&1 && env"]);
+        cmd
+    };
+    let output = cmd
+        .current_dir(idf_dir)
+        .env("IDF_TOOLS_PATH", tools_dir)
+        .output()
+        .await
+        .context("Failed to run the ESP-IDF export script")?;
+    if !output.status.success() {
+        return Err(anyhow::anyhow!(
+            "The export script of {} failed: {}",
+            idf_dir.display(),
+            String::from_utf8_lossy(&output.stderr).trim()
+        ));
+    }
+
+    let current: HashMap<String, String> = std::env::vars().collect();
+    Ok(parse_export_env(
+        &String::from_utf8_lossy(&output.stdout),
+        &current,
+    ))
+}
+
+/// The variables of an `env` listing that differ from `current`; new `PATH`
+/// entries are kept apart so they can be put in front of a later `PATH`
+pub fn parse_export_env(output: &str, current: &HashMap<String, String>) -> ManagedEnvironment {
+    let mut environment = ManagedEnvironment::default();
+    for line in output.lines() {
+        let Some((key, value)) = line.split_once('=') else {
+            continue;
+        };
+        if SHELL_VARS.contains(&key) || current.get(key).is_some_and(|v| v == value) {
+            continue;
+        }
+        if key.eq_ignore_ascii_case("PATH") {
+            let known: Vec<PathBuf> = current
+                .get(key)
+                .map(|path| std::env::split_paths(path).collect())
+                .unwrap_or_default();
+            environment.path = std::env::split_paths(value)
+                .filter(|dir| !known.contains(dir))
+                .collect();
+        } else {
+            environment.vars.insert(key.to_string(), value.to_string());
+        }
+    }
+    environment
+}
+
+/// TinyGo can't be installed into a directory of ours, only checked
+async fn check_tinygo(project_dir: &Path, pin: Option<&String>) -> Result<()> {
+    let version = active_version(Toolchain::TinyGo, project_dir, false)
+        .await
+        .map_err(|_| {
+            anyhow::anyhow!(
+                "TinyGo not found. Install it from https://tinygo.org/getting-started/install/, it brings its own Xtensa LLVM"
+            )
+        })?;
+    match pin {
+        Some(pin) if !version_matches(pin, &version) => Err(anyhow::anyhow!(
+            "TinyGo {} is pinned in espbrew.yaml, but {} is installed",
+            pin,
+            version
+        )),
+        _ => {
+            println!("✅ TinyGo {}", version);
+            Ok(())
+        }
+    }
+}
+
+/// Install the Xtensa Rust toolchain and its LLVM with espup unless rustup has one
+async fn setup_xtensa_rust(toolchains_dir: &Path, targets: &[String], dry_run: bool) -> Result<()> {
+    let output = Command::new("rustup")
+        .args(["toolchain", "list"])
+        .output()
+        .await
+        .map_err(|_| anyhow::anyhow!("rustup not found. Install Rust from https://rustup.rs"))?;
+    let toolchains = String::from_utf8_lossy(&output.stdout);
+    if let Some(toolchain) = toolchains.lines().find(|line| line.starts_with("esp")) {
+        println!("✅ Xtensa Rust toolchain {}", toolchain.trim());
+        return Ok(());
+    }
+
+    let espup = cargo_tool(toolchains_dir, "espup", dry_run).await?;
+    let chips: Vec<&str> = targets
+        .iter()
+        .map(String::as_str)
+        .filter(|target| XTENSA_CHIPS.contains(target))
+        .collect();
+    let mut install =
+        PlannedCommand::new("espup", &espup.display().to_string(), toolchains_dir).arg("install");
+    if !chips.is_empty() {
+        install = install.args(["--targets".to_string(), chips.join(",")]);
+    }
+    let install = install.args([
+        "--export-file".to_string(),
+        espup_export_file(toolchains_dir).display().to_string(),
+    ]);
+    run_step(&install, dry_run).await?;
+    if !dry_run {
+        println!("✅ Xtensa Rust toolchain installed");
+    }
+    Ok(())
+}
+
+async fn setup_espflash(toolchains_dir: &Path, dry_run: bool) -> Result<()> {
+    let espflash = cargo_tool(toolchains_dir, "espflash", dry_run).await?;
+    println!("✅ espflash at {}", espflash.display());
+    Ok(())
+}
+
+/// A tool from PATH or the toolchains directory, installed there with `cargo install` when missing
+async fn cargo_tool(toolchains_dir: &Path, name: &str, dry_run: bool) -> Result<PathBuf> {
+    if let Some(path) = find_in_path(name) {
+        return Ok(path);
+    }
+    let installed = bin_dir(toolchains_dir).join(if cfg!(windows) {
+        format!("{}.exe", name)
+    } else {
+        name.to_string()
+    });
+    if installed.exists() {
+        return Ok(installed);
+    }
+
+    if find_in_path("cargo").is_none() {
+        return Err(anyhow::anyhow!(
+            "{} not found and cargo isn't available to install it. Install Rust from https://rustup.rs",
+            name
+        ));
+    }
+    println!("📦 Installing {} into {}", name, toolchains_dir.display());
+    let install = PlannedCommand::new("cargo install", "cargo", toolchains_dir).args([
+        "install".to_string(),
+        name.to_string(),
+        "--locked".to_string(),
+        "--root".to_string(),
+        toolchains_dir.display().to_string(),
+    ]);
+    if !dry_run {
+        fs::create_dir_all(toolchains_dir)
+            .with_context(|| format!("Failed to create {}", toolchains_dir.display()))?;
+    }
+    run_step(&install, dry_run).await?;
+    Ok(installed)
+}
+
+/// Run a setup command with the terminal attached, or only print it on a dry run
+async fn run_step(command: &PlannedCommand, dry_run: bool) -> Result<()> {
+    let env_prefix: String = command
+        .env
+        .iter()
+        .map(|(key, value)| format!("{}={} ", key, shell_quote(value)))
+        .collect();
+    println!("   $ {}{}", env_prefix, command.command_line());
+    if dry_run {
+        return Ok(());
+    }
+
+    let status = Command::new(&command.program)
+        .args(&command.args)
+        .current_dir(&command.working_dir)
+        .envs(&command.env)
+        .status()
+        .await
+        .with_context(|| format!("Failed to run {}", command.program))?;
+    if !status.success() {
+        return Err(anyhow::anyhow!(
+            "{} failed with {}: {}",
+            command.step,
+            status,
+            command.command_line()
+        ));
+    }
+    Ok(())
+}
+
+/// POSIX shell exports activating the installed toolchains, for
+/// `eval "$(espbrew setup --print-env)"`
+pub fn shell_exports(toolchains_dir: &Path) -> String {
+    let mut out = String::from("# Toolchains installed by espbrew setup\n");
+    let mut path = vec![bin_dir(toolchains_dir)];
+
+    let active = active_managed_esp_idf(toolchains_dir).and_then(|name| {
+        let env_file = managed_esp_idf_dir(toolchains_dir)
+            .join(name)
+            .join(MANAGED_ENV_FILE);
+        let content = fs::read_to_string(env_file).ok()?;
+        serde_json::from_str::<ManagedEnvironment>(&content).ok()
+    });
+    if let Some(environment) = active {
+        for (key, value) in &environment.vars {
+            out.push_str(&format!("export {}={}\n", key, shell_quote(value)));
+        }
+        path.extend(environment.path);
+    }
+
+    let path: Vec<String> = path
+        .iter()
+        .map(|dir| shell_quote(&dir.display().to_string()))
+        .collect();
+    out.push_str(&format!("export PATH={}:\"$PATH\"\n", path.join(":")));
+
+    let espup_export = espup_export_file(toolchains_dir);
+    if espup_export.exists() {
+        out.push_str(&format!(
+            ". {}\n",
+            shell_quote(&espup_export.display().to_string())
+        ));
+    }
+    out
+}
+
+/// Write the exports to the toolchains directory's `env.sh`
+pub fn write_env_script(toolchains_dir: &Path) -> Result<PathBuf> {
+    let path = env_script_path(toolchains_dir);
+    fs::create_dir_all(toolchains_dir)
+        .with_context(|| format!("Failed to create {}", toolchains_dir.display()))?;
+    fs::write(&path, shell_exports(toolchains_dir))
+        .with_context(|| format!("Failed to write {}", path.display()))?;
+    Ok(path)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::utils::esp_idf_utils::detect_from_managed;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_toolchain_setup() {
+        assert_eq!(esp_idf_git_ref("5.3"), "release/v5.3");
+        assert_eq!(esp_idf_git_ref("v5.3.1"), "v5.3.1");
+        assert_eq!(esp_idf_git_ref("master"), "master");
+        assert_eq!(esp_idf_install_name("5.3"), "v5.3");
+
+        let temp_dir = TempDir::new().expect("Failed to create temp dir");
+        let project = temp_dir.path().join("app");
+        fs::create_dir_all(&project).unwrap();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "toolchain:\n  esp_idf: \"5.3\"\nboards:\n  legacy:\n    toolchain:\n      esp_idf: \"4.4\"\n",
+        )
+        .unwrap();
+        let board = |name: &str, target: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: Some(target.to_string()),
+            project_type: ProjectType::EspIdf,
+        };
+        let boards = vec![
+            board("box", "ESP32S3"),
+            board("legacy", "esp32"),
+            board("c3", "esp32s3"),
+        ];
+        let plan = setup_plan(&project, &ProjectType::EspIdf, &boards);
+        assert_eq!(plan.pins, vec!["5.3", "4.4"]);
+        assert_eq!(plan.targets, vec!["esp32", "esp32s3"]);
+        assert!(!plan.xtensa_rust);
+        assert!(
+            setup_plan(&project, &ProjectType::Arduino, &boards)
+                .toolchain
+                .is_none()
+        );
+
+        let current: HashMap<String, String> = [
+            ("PATH".to_string(), "/usr/bin:/bin".to_string()),
+            ("HOME".to_string(), "/home/dev".to_string()),
+        ]
+        .into_iter()
+        .collect();
+        let environment = parse_export_env(
+            "HOME=/home/dev\nPATH=/idf/tools/bin:/usr/bin:/bin\nIDF_PATH=/idf\nPWD=/idf\n",
+            &current,
+        );
+        assert_eq!(
+            environment.path,
+            vec![std::path::PathBuf::from("/idf/tools/bin")]
+        );
+        assert_eq!(
+            environment.vars.keys().collect::<Vec<_>>(),
+            vec!["IDF_PATH"]
+        );
+
+        // An installation `espbrew setup` made and activated
+        let toolchains = temp_dir.path().join("toolchains");
+        let idf_dir = toolchains.join("esp-idf").join("v5.3");
+        fs::create_dir_all(idf_dir.join("tools")).unwrap();
+        fs::write(idf_dir.join("tools").join("idf.py"), "").unwrap();
+        fs::write(idf_dir.join("version.txt"), "v5.3.1\n").unwrap();
+        fs::write(
+            idf_dir.join("espbrew-env.json"),
+            r#"{"path": ["/idf/tools/bin"], "vars": {"IDF_TOOLS_PATH": "/tools"}}"#,
+        )
+        .unwrap();
+        fs::write(toolchains.join("esp-idf").join("active"), "v5.3\n").unwrap();
+
+        let detected = detect_from_managed(&toolchains);
+        assert_eq!(detected.len(), 1);
+        assert_eq!(detected[0].detection_source, EspIdfDetectionSource::Managed);
+        assert_eq!(detected[0].installation.version, "v5.3.1");
+        assert_eq!(detected[0].installation.active, Some(true));
+        assert!(detected[0].is_available);
+        assert_eq!(detected[0].environment["IDF_TOOLS_PATH"], "/tools");
+        assert!(detected[0].environment["PATH"].starts_with("/idf/tools/bin"));
+
+        let exports = shell_exports(&toolchains);
+        assert!(exports.contains("export IDF_TOOLS_PATH='/tools'\n"));
+        assert!(exports.contains(&format!(
+            "export PATH='{}':'/idf/tools/bin':\"$PATH\"\n",
+            toolchains.join("bin").display()
+        )));
+    }
+}
@@ -0,0 +1,174 @@
+//! UF2 images for boards with a TinyUF2 bootloader
+//!
+//! With `uf2: true` in a board's section of `espbrew.yaml`, every successful
+//! build of the board also writes `<board>.uf2` into its build directory:
+//! the app binary in UF2 blocks tagged with the chip's family ID. Copied onto
+//! the drive TinyUF2 exposes over USB, it is written to the app partition.
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::{BoardMetadata, ProjectConfig};
+use crate::models::{AppEvent, ArtifactType, BuildArtifact, ProjectBoardConfig};
+
+/// Name of the UF2 image among a build's artifacts
+pub const UF2_ARTIFACT: &str = "uf2";
+
+const UF2_MAGIC_START0: u32 = 0x0A32_4655;
+const UF2_MAGIC_START1: u32 = 0x9E5D_5157;
+const UF2_MAGIC_END: u32 = 0x0AB1_6F30;
+/// The block carries a family ID instead of a file size
+const UF2_FLAG_FAMILY_ID: u32 = 0x0000_2000;
+const UF2_BLOCK_SIZE: usize = 512;
+const UF2_DATA_SIZE: usize = 476;
+/// App bytes per block, as written by ESP-IDF's `mkuf2.py`
+pub const UF2_PAYLOAD_SIZE: usize = 256;
+
+/// UF2 family IDs of the ESP chips, from the UF2 specification's `uf2families.json`
+const FAMILY_IDS: &[(&str, u32)] = &[
+    ("esp32", 0x1c5f_21b0),
+    ("esp32s2", 0xbfdd_4eee),
+    ("esp32s3", 0xc47e_5767),
+    ("esp32c2", 0x2b88_d29c),
+    ("esp32c3", 0xd42b_a06c),
+    ("esp32c5", 0xf71c_0343),
+    ("esp32c6", 0x540d_df62),
+    ("esp32h2", 0x3327_26f6),
+    ("esp32p4", 0x3d30_8e94),
+];
+
+/// UF2 family ID of a chip, e.g. `esp32s3` or `ESP32-S3`
+pub fn family_id(chip: &str) -> Option<u32> {
+    let chip = chip.to_lowercase().replace(['-', '_'], "");
+    FAMILY_IDS
+        .iter()
+        .find(|(name, _)| *name == chip)
+        .map(|(_, id)| *id)
+}
+
+/// UF2 blocks holding `data` from address 0 of the app partition, where
+/// TinyUF2 writes it
+pub fn encode_uf2(data: &[u8], family_id: u32) -> Vec<u8> {
+    let chunks: Vec<&[u8]> = data.chunks(UF2_PAYLOAD_SIZE).collect();
+    let mut output = Vec::with_capacity(chunks.len() * UF2_BLOCK_SIZE);
+    for (index, chunk) in chunks.iter().enumerate() {
+        let header = [
+            UF2_MAGIC_START0,
+            UF2_MAGIC_START1,
+            UF2_FLAG_FAMILY_ID,
+            (index * UF2_PAYLOAD_SIZE) as u32,
+            UF2_PAYLOAD_SIZE as u32,
+            index as u32,
+            chunks.len() as u32,
+            family_id,
+        ];
+        for word in header {
+            output.extend_from_slice(&word.to_le_bytes());
+        }
+        let mut payload = [0u8; UF2_DATA_SIZE];
+        payload[..chunk.len()].copy_from_slice(chunk);
+        output.extend_from_slice(&payload);
+        output.extend_from_slice(&UF2_MAGIC_END.to_le_bytes());
+    }
+    output
+}
+
+/// Whether a board's builds write a UF2 image
+pub fn uf2_enabled(project_dir: &Path, board_name: &str) -> bool {
+    ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .as_ref()
+        .and_then(|config| config.board_section(board_name))
+        .is_some_and(|section| section.uf2)
+}
+
+/// `<build dir>/<board>.uf2`
+pub fn uf2_path(build_dir: &Path, board_name: &str) -> PathBuf {
+    build_dir.join(format!("{}.uf2", board_name))
+}
+
+/// Convert the app binary among the build's artifacts into `<board>.uf2`
+pub fn write_uf2(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    artifacts: &[BuildArtifact],
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<BuildArtifact> {
+    let app = artifacts
+        .iter()
+        .find(|a| a.artifact_type == ArtifactType::Application && a.file_path.exists())
+        .ok_or_else(|| anyhow::anyhow!("The build produced no app binary to convert to UF2"))?;
+    let chip = BoardMetadata::load(project_dir, &board_config.name)
+        .chip
+        .or(board_config.target.clone())
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "No chip known for {}, set `chip:` in its section to pick the UF2 family",
+                board_config.name
+            )
+        })?;
+    let family =
+        family_id(&chip).ok_or_else(|| anyhow::anyhow!("{} has no UF2 family ID", chip))?;
+
+    let data = std::fs::read(&app.file_path)
+        .with_context(|| format!("Failed to read {}", app.file_path.display()))?;
+    let output = uf2_path(&board_config.build_dir, &board_config.name);
+    std::fs::write(&output, encode_uf2(&data, family))
+        .with_context(|| format!("Failed to write {}", output.display()))?;
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🪄 Wrote {} ({} KB, {} family 0x{:08x}) for TinyUF2 drag-and-drop",
+            output.display(),
+            data.len() / 1024,
+            chip,
+            family
+        ),
+    ));
+    Ok(BuildArtifact {
+        name: UF2_ARTIFACT.to_string(),
+        file_path: output,
+        artifact_type: ArtifactType::Binary,
+        // Copied onto the bootloader's drive, never flashed over serial
+        offset: None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_uf2_encoding() {
+        assert_eq!(family_id("esp32s3"), Some(0xc47e5767));
+        assert_eq!(family_id("ESP32-S2"), Some(0xbfdd4eee));
+        assert_eq!(family_id("esp8266"), None);
+
+        let data: Vec<u8> = (0..600u32).map(|i| i as u8).collect();
+        let uf2 = encode_uf2(&data, 0xc47e5767);
+        assert_eq!(uf2.len(), 3 * 512);
+
+        let word = |block: usize, index: usize| {
+            let at = block * 512 + index * 4;
+            u32::from_le_bytes(uf2[at..at + 4].try_into().unwrap())
+        };
+        for block in 0..3 {
+            assert_eq!(word(block, 0), 0x0A324655);
+            assert_eq!(word(block, 1), 0x9E5D5157);
+            assert_eq!(word(block, 2), 0x2000);
+            assert_eq!(word(block, 3), (block * UF2_PAYLOAD_SIZE) as u32);
+            assert_eq!(word(block, 4), UF2_PAYLOAD_SIZE as u32);
+            assert_eq!(word(block, 5), block as u32);
+            assert_eq!(word(block, 6), 3);
+            assert_eq!(word(block, 7), 0xc47e5767);
+            assert_eq!(word(block, 127), 0x0AB16F30);
+        }
+        assert_eq!(&uf2[512 + 32..512 + 32 + 256], &data[256..512]);
+        // The last block is padded with zeros
+        assert_eq!(&uf2[1024 + 32..1024 + 32 + 88], &data[512..]);
+        assert!(uf2[1024 + 32 + 88..1024 + 508].iter().all(|b| *b == 0));
+    }
+}
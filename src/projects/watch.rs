@@ -0,0 +1,187 @@
+//! Watch mode: rebuild the boards affected by source changes
+//!
+//! File system notifications are collected until no further change arrives
+//! for the debounce interval, so saving several files or switching branches
+//! triggers one rebuild. Build output and caches are ignored by the same rules
+//! incremental builds use for their input hash.
+
+use anyhow::{Context, Result};
+use notify::{EventKind, RecommendedWatcher, RecursiveMode, Watcher};
+use std::collections::BTreeSet;
+use std::path::{Path, PathBuf};
+use std::time::Duration;
+use tokio::sync::mpsc;
+
+use crate::config::sdkconfig_fragments::fragment_chain;
+use crate::projects::incremental::is_source_path;
+
+/// Quiet period after the last change before a rebuild starts
+pub const DEFAULT_DEBOUNCE_MS: u64 = 500;
+
+/// Whether changing `changed` calls for rebuilding the board built from
+/// `config_file`. `board_configs` are the config files of all boards of the
+/// project: another board's config only affects boards that extend it.
+pub fn affects_board(
+    project_dir: &Path,
+    config_file: &Path,
+    board_configs: &[PathBuf],
+    changed: &[PathBuf],
+) -> bool {
+    let own_chain = fragment_chain(config_file).unwrap_or_default();
+    changed
+        .iter()
+        .filter(|path| is_source_path(project_dir, path))
+        .any(|path| {
+            path == config_file || own_chain.contains(path) || !board_configs.contains(path)
+        })
+}
+
+/// Changed project sources, reported in debounced batches
+pub struct SourceWatcher {
+    project_dir: PathBuf,
+    /// Canonical project directory, as notifications report it on macOS
+    canonical_dir: PathBuf,
+    debounce: Duration,
+    events: mpsc::UnboundedReceiver<PathBuf>,
+    _watcher: RecommendedWatcher,
+}
+
+impl SourceWatcher {
+    pub fn new(project_dir: &Path, debounce: Duration) -> Result<Self> {
+        let (tx, events) = mpsc::unbounded_channel();
+        let mut watcher =
+            notify::recommended_watcher(move |result: notify::Result<notify::Event>| {
+                if let Ok(event) = result
+                    && !matches!(event.kind, EventKind::Access(_))
+                {
+                    for path in event.paths {
+                        let _ = tx.send(path);
+                    }
+                }
+            })
+            .context("Failed to create the file watcher")?;
+        watcher
+            .watch(project_dir, RecursiveMode::Recursive)
+            .with_context(|| format!("Failed to watch {}", project_dir.display()))?;
+
+        Ok(Self {
+            project_dir: project_dir.to_path_buf(),
+            canonical_dir: project_dir
+                .canonicalize()
+                .unwrap_or_else(|_| project_dir.to_path_buf()),
+            debounce,
+            events,
+            _watcher: watcher,
+        })
+    }
+
+    /// The next batch of changed sources, once no change arrived for the
+    /// debounce interval; `None` if the watcher stopped
+    pub async fn next_change(&mut self) -> Option<Vec<PathBuf>> {
+        let mut changed = BTreeSet::new();
+        loop {
+            let path = if changed.is_empty() {
+                self.events.recv().await?
+            } else {
+                match tokio::time::timeout(self.debounce, self.events.recv()).await {
+                    Ok(Some(path)) => path,
+                    Ok(None) | Err(_) => return Some(changed.into_iter().collect()),
+                }
+            };
+
+            let path = match path.strip_prefix(&self.canonical_dir) {
+                Ok(relative) => self.project_dir.join(relative),
+                Err(_) => path,
+            };
+            if is_source_path(&self.project_dir, &path) {
+                changed.insert(path);
+            }
+        }
+    }
+}
+
+/// Project relative names of changed files for log messages, e.g. `main/main.c, +2 more`
+pub fn describe_changes(project_dir: &Path, changed: &[PathBuf]) -> String {
+    const SHOWN: usize = 3;
+    let mut names: Vec<String> = changed
+        .iter()
+        .take(SHOWN)
+        .map(|path| {
+            path.strip_prefix(project_dir)
+                .unwrap_or(path)
+                .display()
+                .to_string()
+        })
+        .collect();
+    if changed.len() > SHOWN {
+        names.push(format!("+{} more", changed.len() - SHOWN));
+    }
+    names.join(", ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_watch_affected_boards() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::create_dir_all(project.join("main")).unwrap();
+        fs::create_dir_all(project.join("build.box")).unwrap();
+        fs::write(project.join("main/main.c"), "void app_main(void) {}\n").unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.common"),
+            "CONFIG_LOG_DEFAULT_LEVEL_INFO=y\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.box"),
+            "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32s3\"\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("sdkconfig.defaults.c3"),
+            "CONFIG_IDF_TARGET=\"esp32c3\"\n",
+        )
+        .unwrap();
+
+        let box_config = project.join("sdkconfig.defaults.box");
+        let c3_config = project.join("sdkconfig.defaults.c3");
+        let configs = vec![
+            box_config.clone(),
+            c3_config.clone(),
+            project.join("sdkconfig.defaults.common"),
+        ];
+        let affects = |config: &std::path::Path, changed: &[&str]| {
+            let changed: Vec<_> = changed.iter().map(|p| project.join(p)).collect();
+            affects_board(project, config, &configs, &changed)
+        };
+
+        // Shared sources rebuild every board
+        assert!(affects(&box_config, &["main/main.c"]));
+        assert!(affects(&c3_config, &["main/main.c"]));
+        // A board config only rebuilds the boards built from it or extending it
+        assert!(affects(&box_config, &["sdkconfig.defaults.box"]));
+        assert!(!affects(&c3_config, &["sdkconfig.defaults.box"]));
+        assert!(affects(&box_config, &["sdkconfig.defaults.common"]));
+        assert!(!affects(&c3_config, &["sdkconfig.defaults.common"]));
+        // Build output, generated files and deleted build directories are ignored
+        assert!(!affects(&box_config, &["build.box/app.bin", "sdkconfig"]));
+        assert!(!is_source_path(project, &project.join("build.gone/x.o")));
+        assert!(is_source_path(project, &project.join("main/deleted.c")));
+        assert!(is_source_path(project, &project.join("main/build_info.h")));
+        assert!(!is_source_path(project, &project.join(".git/index")));
+
+        let changed: Vec<_> = ["a.c", "b.c", "c.c", "d.c", "e.c"]
+            .iter()
+            .map(|p| project.join("main").join(p))
+            .collect();
+        assert_eq!(
+            describe_changes(project, &changed),
+            "main/a.c, main/b.c, main/c.c, +2 more"
+        );
+    }
+}
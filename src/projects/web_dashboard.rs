@@ -0,0 +1,327 @@
+//! Browser dashboard of the TUI, for watching a shared build machine
+//!
+//! `espbrew serve --web :8080` runs the TUI and serves a page mirroring it:
+//! the boards with their build status, times and sizes, their logs and the
+//! serial monitor panes, streamed over a websocket as they come in, and
+//! buttons to build, flash and monitor a board or build them all. The TUI
+//! publishes what the page shows on every tick; the page's actions are
+//! queued to the TUI, which runs them as if chosen in its action menu,
+//! without moving its selection.
+//!
+//! The page's status, logs and actions all need the token of the
+//! dashboard's URL, made up anew by every `espbrew serve`: the logs may hold
+//! secrets and the actions run hooks and flash devices. Pages of other sites
+//! have no way to learn it.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::net::SocketAddr;
+use std::sync::{Arc, RwLock};
+use tokio::sync::mpsc;
+
+use crate::projects::remote_build::token_matches;
+
+/// Lines of a board's log sent to a page that has none of it yet
+pub const LOG_TAIL: usize = 1000;
+
+/// Lines of a serial monitor pane the page shows
+pub const MONITOR_TAIL: usize = 200;
+
+/// Header the page sends the dashboard's token in with its actions
+pub const WEB_TOKEN_HEADER: &str = "x-espbrew-token";
+
+/// `:8080` listens on this machine only, `0.0.0.0:8080` on every interface
+pub fn parse_listen_address(listen: &str) -> Result<SocketAddr> {
+    let address = match listen.strip_prefix(':') {
+        Some(port) => format!("127.0.0.1:{}", port),
+        None => listen.to_string(),
+    };
+    address.parse().with_context(|| {
+        format!(
+            "Invalid web address '{}', expected :port or host:port",
+            listen
+        )
+    })
+}
+
+/// A board's row of the page
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct WebBoard {
+    pub name: String,
+    pub target: Option<String>,
+    /// e.g. `building` or `ok`, empty if not built yet
+    pub status: String,
+    /// `passed`, `failed`, `skipped` or `running`
+    pub outcome: String,
+    pub duration: String,
+    pub size: String,
+    pub cache: String,
+    pub selected: bool,
+}
+
+/// A serial monitor pane of the TUI with its newest lines
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct WebMonitor {
+    pub port: String,
+    pub board: Option<String>,
+    pub state: String,
+    pub lines: Vec<String>,
+}
+
+/// What the page shows besides the boards' logs
+#[derive(Debug, Clone, Default, PartialEq, Serialize)]
+pub struct WebSnapshot {
+    pub project: String,
+    /// e.g. `7 passed, 1 failed, 2 skipped`
+    pub headline: String,
+    pub timings: String,
+    pub build_in_progress: bool,
+    pub boards: Vec<WebBoard>,
+    pub monitors: Vec<WebMonitor>,
+}
+
+/// A board's log, replaced rather than extended when it was cleared
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct WebLog {
+    /// Counts the replacements, so pages know to start over
+    pub generation: u64,
+    /// The TUI's count of the log's resets the lines go with
+    pub resets: u64,
+    pub lines: Vec<String>,
+}
+
+/// How much of a log a page has: its generation and line count
+pub type LogCursor = (u64, usize);
+
+/// Messages of the websocket, as JSON with a `type`
+#[derive(Debug, Clone, PartialEq, Serialize)]
+#[serde(tag = "type", rename_all = "snake_case")]
+pub enum WebMessage {
+    Snapshot(WebSnapshot),
+    /// New lines of a board's log; with `reset` they replace what the page has
+    Log {
+        board: String,
+        reset: bool,
+        lines: Vec<String>,
+    },
+}
+
+/// What the TUI last published
+#[derive(Debug, Clone, Default)]
+pub struct WebDashboard {
+    pub snapshot: WebSnapshot,
+    /// Counts the snapshot's changes
+    pub version: u64,
+    pub logs: HashMap<String, WebLog>,
+}
+
+/// The dashboard the TUI publishes to and the server reads
+pub type SharedWebDashboard = Arc<RwLock<WebDashboard>>;
+
+impl WebDashboard {
+    pub fn publish(&mut self, snapshot: WebSnapshot) {
+        if snapshot != self.snapshot {
+            self.snapshot = snapshot;
+            self.version += 1;
+        }
+    }
+
+    /// Mirror a board's log: new lines are appended, a log that was cleared
+    /// or rewritten since, as told by its count of `resets`, replaces the old one
+    pub fn publish_log(&mut self, board: &str, resets: u64, lines: &[String]) {
+        let log = self.logs.entry(board.to_string()).or_default();
+        let known = log.lines.len();
+        if resets == log.resets && lines.len() >= known {
+            log.lines.extend_from_slice(&lines[known..]);
+        } else {
+            log.generation += 1;
+            log.resets = resets;
+            log.lines = lines.to_vec();
+        }
+    }
+
+    /// What a page that has `cursor` of the board's log is sent next, with
+    /// its cursor after it
+    pub fn log_message(
+        &self,
+        board: &str,
+        cursor: Option<LogCursor>,
+    ) -> Option<(WebMessage, LogCursor)> {
+        let log = self.logs.get(board)?;
+        let total = log.lines.len();
+        let (reset, from) = match cursor {
+            Some((generation, sent)) if generation == log.generation && sent <= total => {
+                if sent == total {
+                    return None;
+                }
+                (false, sent)
+            }
+            _ => (true, total.saturating_sub(LOG_TAIL)),
+        };
+        let message = WebMessage::Log {
+            board: board.to_string(),
+            reset,
+            lines: log.lines[from..].to_vec(),
+        };
+        Some((message, (log.generation, total)))
+    }
+}
+
+/// What a button of the page does
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum WebAction {
+    Build,
+    Flash,
+    Monitor,
+    BuildAll,
+}
+
+/// An action of the page, e.g. `{"action": "flash", "board": "esp32s3"}`
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+pub struct WebCommand {
+    pub action: WebAction,
+    /// Every action but `build_all` is for a board
+    #[serde(default)]
+    pub board: Option<String>,
+}
+
+impl WebCommand {
+    /// Why the TUI can't run the command on the boards it lists, if it can't
+    pub fn check(&self, boards: &[WebBoard]) -> Option<String> {
+        match (&self.action, &self.board) {
+            (WebAction::BuildAll, _) => None,
+            (_, None) => Some("No board given".to_string()),
+            (_, Some(board)) if !boards.iter().any(|b| &b.name == board) => {
+                Some(format!("Unknown board '{}'", board))
+            }
+            _ => None,
+        }
+    }
+}
+
+/// A fresh token for the dashboard's actions
+pub fn new_web_token() -> String {
+    uuid::Uuid::new_v4().simple().to_string()
+}
+
+/// Whether a call brought the dashboard's token
+pub fn is_authorized(token: &str, given: Option<&str>) -> bool {
+    given.is_some_and(|given| token_matches(token, given))
+}
+
+/// The TUI's end of the dashboard: where it publishes and the actions the
+/// page queued
+pub struct WebDashboardLink {
+    /// The page's address with the token, shown under the board list
+    pub url: String,
+    pub dashboard: SharedWebDashboard,
+    pub commands: mpsc::UnboundedReceiver<WebCommand>,
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_actions_need_the_token() {
+        let token = new_web_token();
+        assert_eq!(token.len(), 32);
+        assert_ne!(token, new_web_token());
+        assert!(is_authorized(&token, Some(&token)));
+        assert!(!is_authorized(&token, Some("guess")));
+        assert!(!is_authorized(&token, None));
+    }
+
+    #[test]
+    fn test_web_dashboard_messages() {
+        assert_eq!(
+            parse_listen_address(":8080").unwrap().to_string(),
+            "127.0.0.1:8080"
+        );
+        assert_eq!(
+            parse_listen_address("127.0.0.1:9000").unwrap().to_string(),
+            "127.0.0.1:9000"
+        );
+        assert!(parse_listen_address("8080").is_err());
+
+        let board = WebBoard {
+            name: "esp32s3".to_string(),
+            target: Some("esp32s3".to_string()),
+            status: "building".to_string(),
+            outcome: "running".to_string(),
+            duration: "0m 12s".to_string(),
+            size: "-".to_string(),
+            cache: "-".to_string(),
+            selected: true,
+        };
+        let mut dashboard = WebDashboard::default();
+        let snapshot = WebSnapshot {
+            boards: vec![board.clone()],
+            ..Default::default()
+        };
+        dashboard.publish(snapshot.clone());
+        dashboard.publish(snapshot);
+        assert_eq!(dashboard.version, 1);
+        let json = serde_json::to_value(WebMessage::Snapshot(dashboard.snapshot.clone())).unwrap();
+        assert_eq!(json["type"], "snapshot");
+        assert_eq!(json["boards"][0]["status"], "building");
+
+        // A page gets the whole log first, then the lines it doesn't have
+        let lines: Vec<String> = (1..=3).map(|i| format!("line {}", i)).collect();
+        dashboard.publish_log("esp32s3", 0, &lines[..2]);
+        let (message, cursor) = dashboard.log_message("esp32s3", None).unwrap();
+        assert_eq!(
+            message,
+            WebMessage::Log {
+                board: "esp32s3".to_string(),
+                reset: true,
+                lines: lines[..2].to_vec(),
+            }
+        );
+        assert!(dashboard.log_message("esp32s3", Some(cursor)).is_none());
+        dashboard.publish_log("esp32s3", 0, &lines);
+        let (message, cursor) = dashboard.log_message("esp32s3", Some(cursor)).unwrap();
+        assert_eq!(
+            message,
+            WebMessage::Log {
+                board: "esp32s3".to_string(),
+                reset: false,
+                lines: vec!["line 3".to_string()],
+            }
+        );
+
+        // A cleared log starts over, even with as many lines as before
+        let rebuilt: Vec<String> = (1..=3).map(|i| format!("rebuild {}", i)).collect();
+        dashboard.publish_log("esp32s3", 1, &rebuilt);
+        let (message, _) = dashboard.log_message("esp32s3", Some(cursor)).unwrap();
+        assert!(
+            matches!(message, WebMessage::Log { reset: true, ref lines, .. } if *lines == rebuilt)
+        );
+
+        // Long logs are sent from their tail
+        let long: Vec<String> = (0..LOG_TAIL + 5).map(|i| i.to_string()).collect();
+        dashboard.publish_log("esp32s3", 2, &long);
+        match dashboard.log_message("esp32s3", None).unwrap().0 {
+            WebMessage::Log { lines, .. } => {
+                assert_eq!(lines.len(), LOG_TAIL);
+                assert_eq!(lines[0], "5");
+            }
+            other => panic!("expected a log message, got {:?}", other),
+        }
+
+        let command: WebCommand =
+            serde_json::from_str(r#"{"action": "flash", "board": "esp32s3"}"#).unwrap();
+        assert_eq!(command.action, WebAction::Flash);
+        assert!(command.check(&[board.clone()]).is_none());
+        let command: WebCommand = serde_json::from_str(r#"{"action": "build_all"}"#).unwrap();
+        assert!(command.check(&[]).is_none());
+        let command: WebCommand =
+            serde_json::from_str(r#"{"action": "monitor", "board": "esp32c3"}"#).unwrap();
+        assert_eq!(
+            command.check(&[board]).as_deref(),
+            Some("Unknown board 'esp32c3'")
+        );
+    }
+}
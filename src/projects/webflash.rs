@@ -0,0 +1,243 @@
+//! ESP Web Tools installers
+//!
+//! `espbrew export webflash` lays out every board's images next to a
+//! `manifest.json` in the format of [ESP Web Tools](https://esphome.github.io/esp-web-tools/),
+//! so the directory can be published as a browser-based installer:
+//!
+//! ```text
+//! webflash/
+//!   esp32s3_box/
+//!     manifest.json
+//!     bootloader.bin
+//!     partition-table.bin
+//!     app.bin
+//! ```
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::BoardMetadata;
+use crate::models::flash::FlashBinaryInfo;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::fs_image::prepare_filesystem_image;
+use crate::projects::handlers::esp_idf::EspIdfHandler;
+use crate::projects::signing::ensure_signed;
+
+/// Directory the installers are written to unless `--out` names another
+pub const WEBFLASH_DIR: &str = "webflash";
+
+/// `manifest.json` of an ESP Web Tools installer
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct WebFlashManifest {
+    pub name: String,
+    pub version: String,
+    /// Offer to erase the device first, as the installer writes the bootloader too
+    pub new_install_prompt_erase: bool,
+    pub builds: Vec<WebFlashBuild>,
+}
+
+/// Images of one chip family
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct WebFlashBuild {
+    #[serde(rename = "chipFamily")]
+    pub chip_family: String,
+    pub parts: Vec<WebFlashPart>,
+}
+
+/// Image written at an offset, relative to the manifest
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct WebFlashPart {
+    pub path: String,
+    pub offset: u32,
+}
+
+/// ESP Web Tools chip family of a chip, e.g. `ESP32-S3` for `esp32s3`
+pub fn chip_family(chip: &str) -> Option<&'static str> {
+    Some(match chip.to_lowercase().replace(['-', '_'], "").as_str() {
+        "esp32" => "ESP32",
+        "esp32s2" => "ESP32-S2",
+        "esp32s3" => "ESP32-S3",
+        "esp32c2" => "ESP32-C2",
+        "esp32c3" => "ESP32-C3",
+        "esp32c6" => "ESP32-C6",
+        "esp32h2" => "ESP32-H2",
+        "esp32p4" => "ESP32-P4",
+        "esp8266" => "ESP8266",
+        _ => return None,
+    })
+}
+
+/// Manifest flashing `binaries` from the manifest's directory
+pub fn webflash_manifest(
+    name: &str,
+    version: &str,
+    chip_family: &str,
+    binaries: &[FlashBinaryInfo],
+) -> WebFlashManifest {
+    let mut parts: Vec<WebFlashPart> = binaries
+        .iter()
+        .map(|binary| WebFlashPart {
+            path: binary.file_name.clone(),
+            offset: binary.offset,
+        })
+        .collect();
+    parts.sort_by_key(|part| part.offset);
+    WebFlashManifest {
+        name: name.to_string(),
+        version: version.to_string(),
+        new_install_prompt_erase: true,
+        builds: vec![WebFlashBuild {
+            chip_family: chip_family.to_string(),
+            parts,
+        }],
+    }
+}
+
+/// `project_name` and `project_version` of an ESP-IDF build
+pub fn project_description(build_dir: &Path) -> (Option<String>, Option<String>) {
+    let description = std::fs::read_to_string(build_dir.join("project_description.json"))
+        .ok()
+        .and_then(|text| serde_json::from_str::<serde_json::Value>(&text).ok());
+    let field = |key: &str| {
+        description
+            .as_ref()
+            .and_then(|description| description.get(key)?.as_str().map(str::to_string))
+    };
+    (field("project_name"), field("project_version"))
+}
+
+/// Write the installer of a board's last build to `<out_dir>/<board>/`,
+/// returning the path of its manifest
+pub async fn export_webflash(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+    out_dir: &Path,
+    name: Option<&str>,
+    version: Option<&str>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<PathBuf> {
+    ensure_signed(project_dir, board_config)?;
+    let flash_args = board_config.build_dir.join("flash_args");
+    if !flash_args.exists() {
+        return Err(anyhow::anyhow!(
+            "No flash_args in {}, build {} first",
+            board_config.build_dir.display(),
+            board_config.name
+        ));
+    }
+    let (_, mut binaries) = EspIdfHandler.build_images(project_dir, board_config)?;
+    if let Some(image) = prepare_filesystem_image(project_dir, board_config, tx).await? {
+        binaries.retain(|binary| binary.offset != image.offset);
+        binaries.push(image);
+    }
+
+    let chip = BoardMetadata::load(project_dir, &board_config.name)
+        .chip
+        .or(board_config.target.clone())
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "No chip known for {}, set `chip:` in its section of espbrew.yaml",
+                board_config.name
+            )
+        })?;
+    let family =
+        chip_family(&chip).ok_or_else(|| anyhow::anyhow!("ESP Web Tools can't flash {}", chip))?;
+
+    let board_dir = out_dir.join(&board_config.name);
+    std::fs::create_dir_all(&board_dir)
+        .with_context(|| format!("Failed to create {}", board_dir.display()))?;
+    for binary in &binaries {
+        std::fs::copy(&binary.file_path, board_dir.join(&binary.file_name))
+            .with_context(|| format!("Failed to copy {}", binary.file_path.display()))?;
+    }
+
+    let (project_name, project_version) = project_description(&board_config.build_dir);
+    let manifest = webflash_manifest(
+        name.or(project_name.as_deref())
+            .unwrap_or(&board_config.name),
+        version.or(project_version.as_deref()).unwrap_or("dev"),
+        family,
+        &binaries,
+    );
+    let manifest_path = board_dir.join("manifest.json");
+    std::fs::write(&manifest_path, serde_json::to_string_pretty(&manifest)?)
+        .with_context(|| format!("Failed to write {}", manifest_path.display()))?;
+
+    let _ = tx.send(AppEvent::BuildOutput(
+        board_config.name.clone(),
+        format!(
+            "🌐 Wrote {} ({} {} images, version {})",
+            manifest_path.display(),
+            binaries.len(),
+            family,
+            manifest.version
+        ),
+    ));
+    Ok(manifest_path)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_webflash_manifest() {
+        assert_eq!(chip_family("esp32s3"), Some("ESP32-S3"));
+        assert_eq!(chip_family("ESP32-C6"), Some("ESP32-C6"));
+        assert_eq!(chip_family("esp32"), Some("ESP32"));
+        assert_eq!(chip_family("rp2040"), None);
+
+        let binary = |file_name: &str, offset: u32| FlashBinaryInfo {
+            name: file_name.trim_end_matches(".bin").to_string(),
+            file_name: file_name.to_string(),
+            file_path: std::path::PathBuf::from("build").join(file_name),
+            offset,
+        };
+        let manifest = webflash_manifest(
+            "blink",
+            "1.4.0",
+            "ESP32-S3",
+            &[
+                binary("blink.bin", 0x10000),
+                binary("bootloader.bin", 0x0),
+                binary("partition-table.bin", 0x8000),
+            ],
+        );
+        let json: serde_json::Value = serde_json::to_value(&manifest).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({
+                "name": "blink",
+                "version": "1.4.0",
+                "new_install_prompt_erase": true,
+                "builds": [{
+                    "chipFamily": "ESP32-S3",
+                    "parts": [
+                        { "path": "bootloader.bin", "offset": 0 },
+                        { "path": "partition-table.bin", "offset": 32768 },
+                        { "path": "blink.bin", "offset": 65536 }
+                    ]
+                }]
+            })
+        );
+
+        let temp_dir = TempDir::new().unwrap();
+        fs::write(
+            temp_dir.path().join("project_description.json"),
+            r#"{"project_name": "blink", "project_version": "v1.4.0-3-gabc"}"#,
+        )
+        .unwrap();
+        assert_eq!(
+            project_description(temp_dir.path()),
+            (Some("blink".to_string()), Some("v1.4.0-3-gabc".to_string()))
+        );
+        assert_eq!(
+            project_description(std::path::Path::new("/nonexistent")),
+            (None, None)
+        );
+    }
+}
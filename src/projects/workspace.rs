@@ -0,0 +1,222 @@
+//! Monorepo workspace discovery
+//!
+//! Walks a directory tree and collects every buildable project below it, so a
+//! repository with several independent apps can be built in one run.
+
+use anyhow::Result;
+use std::path::{Path, PathBuf};
+
+use crate::models::{ProjectBoardConfig, ProjectType};
+use crate::projects::ProjectRegistry;
+
+/// Default recursion limit for workspace discovery
+pub const DEFAULT_WORKSPACE_DEPTH: usize = 4;
+
+/// Directories never searched for nested projects
+const SKIPPED_DIRS: &[&str] = &[
+    "build",
+    "target",
+    "node_modules",
+    "managed_components",
+    "components",
+    "logs",
+    "support",
+    "venv",
+    "__pycache__",
+];
+
+/// A project found somewhere below the workspace root
+#[derive(Debug, Clone)]
+pub struct WorkspaceProject {
+    /// Absolute path of the project directory
+    pub path: PathBuf,
+    /// Path relative to the workspace root, used as the display name
+    pub relative_path: PathBuf,
+    pub project_type: ProjectType,
+    pub boards: Vec<ProjectBoardConfig>,
+}
+
+impl WorkspaceProject {
+    /// Display name of the project, e.g. `apps/sensor`
+    pub fn name(&self) -> String {
+        if self.relative_path.as_os_str().is_empty() {
+            ".".to_string()
+        } else {
+            self.relative_path.to_string_lossy().replace('\\', "/")
+        }
+    }
+
+    /// Name safe to use as a file name component (no path separators)
+    pub fn slug(&self) -> String {
+        self.name().replace('/', "-")
+    }
+
+    /// Check whether the project is selected by a `--project` filter.
+    ///
+    /// A filter matches the full relative path, or any prefix of it ending at a
+    /// path separator, so `apps` selects both `apps/sensor` and `apps/gateway`.
+    pub fn matches(&self, filter: &str) -> bool {
+        let name = self.name();
+        let filter = filter.trim_end_matches('/');
+        name == filter
+            || name.starts_with(&format!("{}/", filter))
+            || self
+                .path
+                .file_name()
+                .map(|n| n.to_string_lossy() == filter)
+                .unwrap_or(false)
+    }
+}
+
+/// Recursively discover all projects below `root`.
+///
+/// Descent stops at the first directory a handler recognizes, since nested
+/// directories of a project (components, examples of a vendored library, ...)
+/// belong to that project. Hidden directories and common build output
+/// directories are skipped.
+pub fn discover_workspace(root: &Path, max_depth: usize) -> Result<Vec<WorkspaceProject>> {
+    let registry = ProjectRegistry::new();
+    let mut projects = Vec::new();
+    walk(&registry, root, root, 0, max_depth, &mut projects)?;
+    projects.sort_by(|a, b| a.relative_path.cmp(&b.relative_path));
+    Ok(projects)
+}
+
+fn walk(
+    registry: &ProjectRegistry,
+    root: &Path,
+    dir: &Path,
+    depth: usize,
+    max_depth: usize,
+    projects: &mut Vec<WorkspaceProject>,
+) -> Result<()> {
+    if let Some(handler) = registry.detect_project(dir) {
+        let boards = match handler.discover_boards(dir) {
+            Ok(boards) => boards,
+            Err(e) => {
+                log::warn!("⚠️  Failed to discover boards in {}: {}", dir.display(), e);
+                Vec::new()
+            }
+        };
+
+        projects.push(WorkspaceProject {
+            path: dir.to_path_buf(),
+            relative_path: dir.strip_prefix(root).unwrap_or(dir).to_path_buf(),
+            project_type: handler.project_type(),
+            boards,
+        });
+        return Ok(());
+    }
+
+    if depth >= max_depth {
+        return Ok(());
+    }
+
+    let mut subdirs: Vec<PathBuf> = std::fs::read_dir(dir)?
+        .flatten()
+        .map(|entry| entry.path())
+        .filter(|path| path.is_dir())
+        .filter(|path| {
+            path.file_name()
+                .and_then(|n| n.to_str())
+                .map(|name| {
+                    !name.starts_with('.')
+                        && !name.starts_with("build.")
+                        && !SKIPPED_DIRS.contains(&name)
+                })
+                .unwrap_or(false)
+        })
+        .collect();
+    subdirs.sort();
+
+    for subdir in subdirs {
+        walk(registry, root, &subdir, depth + 1, max_depth, projects)?;
+    }
+
+    Ok(())
+}
+
+/// Select projects matching any of the filters; an empty filter list selects all
+pub fn select_projects(
+    projects: Vec<WorkspaceProject>,
+    filters: &[String],
+) -> Result<Vec<WorkspaceProject>> {
+    if filters.is_empty() {
+        return Ok(projects);
+    }
+
+    for filter in filters {
+        if !projects.iter().any(|p| p.matches(filter)) {
+            let available: Vec<String> = projects.iter().map(|p| p.name()).collect();
+            return Err(anyhow::anyhow!(
+                "No workspace project matches '{}'. Available projects: {}",
+                filter,
+                available.join(", ")
+            ));
+        }
+    }
+
+    Ok(projects
+        .into_iter()
+        .filter(|p| filters.iter().any(|f| p.matches(f)))
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_workspace_discovery() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+
+        for app in ["apps/sensor", "apps/gateway"] {
+            let app_dir = root.join(app);
+            fs::create_dir_all(app_dir.join("main")).unwrap();
+            fs::write(
+                app_dir.join("CMakeLists.txt"),
+                "cmake_minimum_required(VERSION 3.16)\ninclude($ENV{IDF_PATH}/tools/cmake/project.cmake)\nproject(app)\n",
+            )
+            .unwrap();
+            fs::write(
+                app_dir.join("sdkconfig.defaults.esp32s3"),
+                "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+            )
+            .unwrap();
+            // Build output of a project must not be picked up as a project
+            fs::create_dir_all(app_dir.join("build.esp32s3")).unwrap();
+        }
+
+        let tool_dir = root.join("tools/blink");
+        fs::create_dir_all(&tool_dir).unwrap();
+        fs::write(tool_dir.join("go.mod"), "module blink\n").unwrap();
+        fs::write(
+            tool_dir.join("main.go"),
+            "package main\n\nimport \"machine\"\n\nfunc main() { machine.LED.Configure(machine.PinConfig{}) }\n",
+        )
+        .unwrap();
+
+        // Hidden directories are ignored
+        let hidden = root.join(".cache/idf");
+        fs::create_dir_all(&hidden).unwrap();
+        fs::write(hidden.join("CMakeLists.txt"), "project(hidden)\n").unwrap();
+        fs::write(hidden.join("sdkconfig"), "").unwrap();
+
+        let projects = discover_workspace(root, 4).unwrap();
+        let names: Vec<String> = projects.iter().map(|p| p.name()).collect();
+        assert_eq!(names, vec!["apps/gateway", "apps/sensor", "tools/blink"]);
+        assert_eq!(projects[0].project_type, ProjectType::EspIdf);
+        assert_eq!(projects[2].project_type, ProjectType::TinyGo);
+        assert!(projects[0].boards.iter().any(|b| b.name == "esp32s3"));
+        assert_eq!(projects[0].slug(), "apps-gateway");
+
+        let selected = select_projects(projects.clone(), &["apps".to_string()]).unwrap();
+        assert_eq!(selected.len(), 2);
+        let selected = select_projects(projects.clone(), &["blink".to_string()]).unwrap();
+        assert_eq!(selected[0].name(), "tools/blink");
+        assert!(select_projects(projects, &["missing".to_string()]).is_err());
+    }
+}
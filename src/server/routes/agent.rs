@@ -0,0 +1,255 @@
+//! Build agent routes served by `espbrew agent`
+
+use serde::Deserialize;
+use serde_json::json;
+use std::path::PathBuf;
+use std::sync::Arc;
+use warp::Filter;
+use warp::http::StatusCode;
+
+use crate::projects::remote_build::{AGENT_TOKEN_HEADER, token_matches};
+use crate::server::services::build_agent::{BuildAgentService, Submission};
+
+/// Largest source tarball a coordinator may ship
+const MAX_SOURCE_ARCHIVE_BYTES: u64 = 2 * 1024 * 1024 * 1024;
+
+#[derive(Debug, Deserialize)]
+struct SubmitQuery {
+    project: String,
+    board: String,
+    #[serde(default)]
+    force: bool,
+}
+
+#[derive(Debug, Deserialize)]
+struct LogQuery {
+    #[serde(default)]
+    from: usize,
+}
+
+#[derive(Debug, Deserialize)]
+struct ArtifactsQuery {
+    build_dir: PathBuf,
+}
+
+/// Rejection of a job call without the agent's token
+#[derive(Debug)]
+struct InvalidToken;
+
+impl warp::reject::Reject for InvalidToken {}
+
+/// Create all build agent routes. With a `token` set every call must pass
+/// it in the `X-Espbrew-Token` header.
+pub fn create_agent_routes(
+    service: Arc<BuildAgentService>,
+    token: Option<String>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    let submit = submit_route(service.clone());
+    let log = log_route(service.clone());
+    let artifacts = artifacts_route(service.clone());
+    let discard = discard_route(service);
+
+    warp::path("api")
+        .and(warp::path("v1"))
+        .and(warp::path("agent"))
+        .and(warp::path("jobs"))
+        .and(with_token(token))
+        .and(submit.or(log).or(artifacts).or(discard))
+        .recover(reject_invalid_token)
+}
+
+/// Passes calls with the token, if there is one
+fn with_token(token: Option<String>) -> impl Filter<Extract = (), Error = warp::Rejection> + Clone {
+    warp::header::optional::<String>(AGENT_TOKEN_HEADER)
+        .and_then(move |header: Option<String>| {
+            let authorized = match (&token, &header) {
+                (None, _) => true,
+                (Some(token), Some(header)) => token_matches(token, header),
+                (Some(_), None) => false,
+            };
+            async move {
+                if authorized {
+                    Ok(())
+                } else {
+                    Err(warp::reject::custom(InvalidToken))
+                }
+            }
+        })
+        .untuple_one()
+}
+
+async fn reject_invalid_token(
+    rejection: warp::Rejection,
+) -> Result<warp::reply::Response, warp::Rejection> {
+    if rejection.find::<InvalidToken>().is_some() {
+        return Ok(error_reply(
+            StatusCode::UNAUTHORIZED,
+            "Invalid token".to_string(),
+        ));
+    }
+    Err(rejection)
+}
+
+/// POST /api/v1/agent/jobs?project=..&board=.. - Build a board from a source tarball
+fn submit_route(
+    service: Arc<BuildAgentService>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    warp::path::end()
+        .and(warp::post())
+        .and(warp::query::<SubmitQuery>())
+        .and(warp::body::content_length_limit(MAX_SOURCE_ARCHIVE_BYTES))
+        .and(warp::body::bytes())
+        .and(with_agent_service(service))
+        .and_then(submit_handler)
+}
+
+/// GET /api/v1/agent/jobs/{id}/log?from=N - Job output from line N on
+fn log_route(
+    service: Arc<BuildAgentService>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    warp::path!(String / "log")
+        .and(warp::get())
+        .and(warp::query::<LogQuery>())
+        .and(with_agent_service(service))
+        .and_then(log_handler)
+}
+
+/// GET /api/v1/agent/jobs/{id}/artifacts?build_dir=.. - Tarball of the build output
+fn artifacts_route(
+    service: Arc<BuildAgentService>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    warp::path!(String / "artifacts")
+        .and(warp::get())
+        .and(warp::query::<ArtifactsQuery>())
+        .and(with_agent_service(service))
+        .and_then(artifacts_handler)
+}
+
+/// DELETE /api/v1/agent/jobs/{id} - Forget a finished job whose output isn't wanted
+fn discard_route(
+    service: Arc<BuildAgentService>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    warp::path!(String)
+        .and(warp::delete())
+        .and(with_agent_service(service))
+        .and_then(discard_handler)
+}
+
+/// Helper function to pass the agent service to handlers
+fn with_agent_service(
+    service: Arc<BuildAgentService>,
+) -> impl Filter<Extract = (Arc<BuildAgentService>,), Error = std::convert::Infallible> + Clone {
+    warp::any().map(move || Arc::clone(&service))
+}
+
+async fn submit_handler(
+    query: SubmitQuery,
+    body: bytes::Bytes,
+    service: Arc<BuildAgentService>,
+) -> Result<warp::reply::Response, warp::Rejection> {
+    use warp::Reply;
+
+    match service
+        .submit(&query.project, &query.board, query.force, body.to_vec())
+        .await
+    {
+        Ok(Submission::Started(job)) => Ok(warp::reply::json(&job).into_response()),
+        Ok(Submission::Busy(job)) => Ok(warp::reply::with_status(
+            warp::reply::json(&json!({
+                "error": format!("{} of {} is being built already", query.board, query.project),
+                "job": job,
+            })),
+            StatusCode::CONFLICT,
+        )
+        .into_response()),
+        Err(e) => Ok(error_reply(StatusCode::BAD_REQUEST, format!("{:#}", e))),
+    }
+}
+
+async fn log_handler(
+    id: String,
+    query: LogQuery,
+    service: Arc<BuildAgentService>,
+) -> Result<warp::reply::Response, warp::Rejection> {
+    use warp::Reply;
+
+    match service.log(&id, query.from).await {
+        Some(log) => Ok(warp::reply::json(&log).into_response()),
+        None => Ok(error_reply(
+            StatusCode::NOT_FOUND,
+            format!("Unknown job {}", id),
+        )),
+    }
+}
+
+async fn artifacts_handler(
+    id: String,
+    query: ArtifactsQuery,
+    service: Arc<BuildAgentService>,
+) -> Result<warp::reply::Response, warp::Rejection> {
+    use warp::Reply;
+
+    match service.artifacts(&id, &query.build_dir).await {
+        Ok(archive) => Ok(
+            warp::reply::with_header(archive, "content-type", "application/gzip").into_response(),
+        ),
+        Err(e) => Ok(error_reply(StatusCode::BAD_REQUEST, format!("{:#}", e))),
+    }
+}
+
+async fn discard_handler(
+    id: String,
+    service: Arc<BuildAgentService>,
+) -> Result<warp::reply::Response, warp::Rejection> {
+    use warp::Reply;
+
+    match service.discard(&id).await {
+        Ok(true) => {
+            Ok(warp::reply::with_status(warp::reply(), StatusCode::NO_CONTENT).into_response())
+        }
+        Ok(false) => Ok(error_reply(
+            StatusCode::NOT_FOUND,
+            format!("Unknown job {}", id),
+        )),
+        Err(e) => Ok(error_reply(StatusCode::CONFLICT, format!("{:#}", e))),
+    }
+}
+
+fn error_reply(status: StatusCode, message: String) -> warp::reply::Response {
+    use warp::Reply;
+
+    warp::reply::with_status(warp::reply::json(&json!({ "error": message })), status)
+        .into_response()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_job_routes_need_the_token() {
+        let work_root = tempfile::TempDir::new().unwrap();
+        let service = Arc::new(BuildAgentService::new(work_root.path().to_path_buf()));
+        let routes = create_agent_routes(service, Some("secret".to_string()));
+
+        let response = warp::test::request()
+            .path("/api/v1/agent/jobs/unknown/log")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+
+        let response = warp::test::request()
+            .path("/api/v1/agent/jobs/unknown/log")
+            .header(AGENT_TOKEN_HEADER, "wrong")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+
+        let response = warp::test::request()
+            .path("/api/v1/agent/jobs/unknown/log")
+            .header(AGENT_TOKEN_HEADER, "secret")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::NOT_FOUND);
+    }
+}
@@ -0,0 +1,54 @@
+//! Webhook route served by `espbrew daemon`
+
+use serde::Deserialize;
+use serde_json::json;
+use tokio::sync::mpsc;
+use warp::Filter;
+use warp::http::StatusCode;
+
+use crate::projects::remote_build::token_matches;
+
+#[derive(Debug, Deserialize)]
+struct TriggerQuery {
+    #[serde(default)]
+    token: Option<String>,
+}
+
+/// POST /api/v1/daemon/trigger - Queue a pull and build of the daemon's branch.
+///
+/// The body, e.g. a forge's push event, is ignored. With a `token` set the
+/// call must pass it as `?token=` or in the `X-Espbrew-Token` header.
+pub fn create_daemon_routes(
+    token: Option<String>,
+    triggers: mpsc::UnboundedSender<String>,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    warp::path!("api" / "v1" / "daemon" / "trigger")
+        .and(warp::post())
+        .and(warp::query::<TriggerQuery>())
+        .and(warp::header::optional::<String>("x-espbrew-token"))
+        .and(warp::addr::remote())
+        .map(
+            move |query: TriggerQuery,
+                  header: Option<String>,
+                  remote: Option<std::net::SocketAddr>| {
+                let given = header.or(query.token).unwrap_or_default();
+                if token
+                    .as_deref()
+                    .is_some_and(|token| !token_matches(token, &given))
+                {
+                    return warp::reply::with_status(
+                        warp::reply::json(&json!({ "error": "Invalid token" })),
+                        StatusCode::UNAUTHORIZED,
+                    );
+                }
+                let caller = remote
+                    .map(|addr| format!("webhook from {}", addr.ip()))
+                    .unwrap_or_else(|| "webhook".to_string());
+                let _ = triggers.send(caller);
+                warp::reply::with_status(
+                    warp::reply::json(&json!({ "status": "queued" })),
+                    StatusCode::ACCEPTED,
+                )
+            },
+        )
+}
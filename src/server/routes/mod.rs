@@ -1,10 +1,13 @@
 //! HTTP routes for the ESPBrew server
 
+pub mod agent;
 pub mod board_types;
 pub mod boards;
+pub mod daemon;
 pub mod flash;
 pub mod health;
 pub mod monitor;
+pub mod serve;
 pub mod static_files;
 pub mod websocket;
 
@@ -0,0 +1,225 @@
+//! Browser dashboard routes served by `espbrew serve --web`
+
+use futures_util::{SinkExt, StreamExt};
+use serde::Deserialize;
+use serde_json::json;
+use std::collections::HashMap;
+use std::time::Duration;
+use tokio::sync::mpsc;
+use warp::http::StatusCode;
+use warp::ws::{Message, WebSocket};
+use warp::{Filter, Reply};
+
+use crate::projects::web_dashboard::{
+    LogCursor, SharedWebDashboard, WEB_TOKEN_HEADER, WebCommand, WebMessage, is_authorized,
+};
+use crate::server::routes::static_files::{WEB_ASSETS, serve_static_file};
+
+/// How often the websocket looks for changes the TUI published
+const STREAM_INTERVAL: Duration = Duration::from_millis(250);
+
+/// The dashboard's token, for the websocket which can't send headers
+#[derive(Debug, Deserialize)]
+struct TokenQuery {
+    #[serde(default)]
+    token: Option<String>,
+}
+
+/// GET / - The dashboard page, its assets under /static
+/// GET /api/v1/serve/status - The boards, their status and the monitor panes
+/// POST /api/v1/serve/actions - Queue an action, e.g. `{"action": "build", "board": "esp32s3"}`
+/// WS /ws/serve - Status changes and the boards' new log lines as they come
+///
+/// All but the page and its assets need the dashboard's token in the
+/// `X-Espbrew-Token` header or as `?token=`.
+pub fn create_serve_routes(
+    dashboard: SharedWebDashboard,
+    commands: mpsc::UnboundedSender<WebCommand>,
+    token: String,
+) -> impl Filter<Extract = impl warp::Reply, Error = warp::Rejection> + Clone {
+    let page = warp::path::end().and(warp::get()).and_then(serve_page);
+    let static_files = warp::path("static")
+        .and(warp::path::tail())
+        .and_then(serve_static_file);
+
+    // The token of the header, else of the query
+    let given = warp::header::optional::<String>(WEB_TOKEN_HEADER)
+        .and(warp::query::<TokenQuery>())
+        .map(|header: Option<String>, query: TokenQuery| header.or(query.token));
+
+    let status_dashboard = dashboard.clone();
+    let status_token = token.clone();
+    let status = warp::path!("api" / "v1" / "serve" / "status")
+        .and(warp::get())
+        .and(given.clone())
+        .map(move |given: Option<String>| {
+            if !is_authorized(&status_token, given.as_deref()) {
+                return unauthorized();
+            }
+            warp::reply::with_status(
+                warp::reply::json(&status_dashboard.read().unwrap().snapshot),
+                StatusCode::OK,
+            )
+        });
+
+    let actions_dashboard = dashboard.clone();
+    let actions_token = token.clone();
+    let actions = warp::path!("api" / "v1" / "serve" / "actions")
+        .and(warp::post())
+        .and(given.clone())
+        .and(warp::body::json())
+        .map(move |given: Option<String>, command: WebCommand| {
+            if !is_authorized(&actions_token, given.as_deref()) {
+                return unauthorized();
+            }
+            let problem = command.check(&actions_dashboard.read().unwrap().snapshot.boards);
+            if let Some(problem) = problem {
+                return warp::reply::with_status(
+                    warp::reply::json(&json!({ "error": problem })),
+                    StatusCode::BAD_REQUEST,
+                );
+            }
+            if commands.send(command).is_err() {
+                return warp::reply::with_status(
+                    warp::reply::json(&json!({ "error": "The TUI has quit" })),
+                    StatusCode::SERVICE_UNAVAILABLE,
+                );
+            }
+            warp::reply::with_status(
+                warp::reply::json(&json!({ "status": "queued" })),
+                StatusCode::ACCEPTED,
+            )
+        });
+
+    let socket = warp::path!("ws" / "serve").and(warp::ws()).and(given).map(
+        move |ws: warp::ws::Ws, given: Option<String>| {
+            if !is_authorized(&token, given.as_deref()) {
+                return unauthorized().into_response();
+            }
+            let dashboard = dashboard.clone();
+            ws.on_upgrade(move |socket| stream_dashboard(socket, dashboard))
+                .into_response()
+        },
+    );
+
+    page.or(static_files).or(status).or(actions).or(socket)
+}
+
+fn unauthorized() -> warp::reply::WithStatus<warp::reply::Json> {
+    warp::reply::with_status(
+        warp::reply::json(
+            &json!({ "error": "Invalid token, open the dashboard's URL from the TUI's log" }),
+        ),
+        StatusCode::UNAUTHORIZED,
+    )
+}
+
+async fn serve_page() -> Result<impl warp::Reply, warp::Rejection> {
+    match WEB_ASSETS.get_file("serve.html") {
+        Some(file) => Ok(warp::reply::with_header(
+            file.contents(),
+            "content-type",
+            "text/html; charset=utf-8",
+        )
+        .into_response()),
+        None => Ok(warp::reply::with_status(
+            "Dashboard page not found".to_string(),
+            StatusCode::NOT_FOUND,
+        )
+        .into_response()),
+    }
+}
+
+/// Send the page the snapshot whenever it changed and the boards' log lines
+/// it doesn't have yet, until it goes away
+async fn stream_dashboard(socket: WebSocket, dashboard: SharedWebDashboard) {
+    let (mut sender, mut receiver) = socket.split();
+    let mut version = None;
+    let mut cursors: HashMap<String, LogCursor> = HashMap::new();
+    let mut interval = tokio::time::interval(STREAM_INTERVAL);
+
+    loop {
+        tokio::select! {
+            _ = interval.tick() => {}
+            message = receiver.next() => match message {
+                // The page only listens; pings are answered by warp
+                Some(Ok(message)) if !message.is_close() => continue,
+                _ => break,
+            },
+        }
+
+        let messages = {
+            let dashboard = dashboard.read().unwrap();
+            let mut messages = Vec::new();
+            if version != Some(dashboard.version) {
+                version = Some(dashboard.version);
+                messages.push(WebMessage::Snapshot(dashboard.snapshot.clone()));
+            }
+            for board in &dashboard.snapshot.boards {
+                let cursor = cursors.get(&board.name).copied();
+                if let Some((message, cursor)) = dashboard.log_message(&board.name, cursor) {
+                    cursors.insert(board.name.clone(), cursor);
+                    messages.push(message);
+                }
+            }
+            messages
+        };
+        for message in messages {
+            let Ok(text) = serde_json::to_string(&message) else {
+                continue;
+            };
+            if sender.send(Message::text(text)).await.is_err() {
+                return;
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_status_and_logs_need_the_token() {
+        let (commands, _commands) = mpsc::unbounded_channel();
+        let routes = create_serve_routes(
+            SharedWebDashboard::default(),
+            commands,
+            "secret".to_string(),
+        );
+
+        let response = warp::test::request()
+            .path("/api/v1/serve/status")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+
+        let response = warp::test::request()
+            .path("/api/v1/serve/status?token=secret")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::OK);
+
+        let response = warp::test::request()
+            .path("/api/v1/serve/status")
+            .header(WEB_TOKEN_HEADER, "secret")
+            .reply(&routes)
+            .await;
+        assert_eq!(response.status(), StatusCode::OK);
+
+        assert!(
+            warp::test::ws()
+                .path("/ws/serve?token=wrong")
+                .handshake(routes.clone())
+                .await
+                .is_err()
+        );
+        assert!(
+            warp::test::ws()
+                .path("/ws/serve?token=secret")
+                .handshake(routes)
+                .await
+                .is_ok()
+        );
+    }
+}
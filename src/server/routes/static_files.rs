@@ -3,7 +3,7 @@ use warp::http::StatusCode;
 use warp::{Filter, Reply};
 
 // Include the web assets directory at compile time
-static WEB_ASSETS: Dir<'_> = include_dir!("$CARGO_MANIFEST_DIR/web");
+pub static WEB_ASSETS: Dir<'_> = include_dir!("$CARGO_MANIFEST_DIR/web");
 
 /// Create static file serving routes for web dashboard
 pub fn create_static_routes()
@@ -22,7 +22,9 @@ pub fn create_static_routes()
 }
 
 /// Serve static files from embedded directory
-async fn serve_static_file(path: warp::path::Tail) -> Result<impl warp::Reply, warp::Rejection> {
+pub async fn serve_static_file(
+    path: warp::path::Tail,
+) -> Result<impl warp::Reply, warp::Rejection> {
     let file_path = path.as_str();
 
     // Security: prevent directory traversal
@@ -0,0 +1,396 @@
+//! Build jobs of `espbrew agent`
+//!
+//! Every job unpacks the shipped sources into the work directory of its
+//! project and board, which is kept between jobs so incremental builds and
+//! compiler caches work on the agent too, and runs `espbrew --cli build` there.
+//!
+//! A finished job is forgotten once its output is fetched, its coordinator
+//! gives up on it, or after an hour. Work directories no job used for two
+//! weeks are removed.
+
+use anyhow::{Context, Result};
+use log::info;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use std::time::{Duration, Instant, SystemTime};
+use tokio::io::{AsyncBufReadExt, BufReader};
+use tokio::process::Command;
+use tokio::sync::{Mutex, RwLock};
+
+use crate::projects::remote_build::{
+    AgentJob, AgentJobLog, agent_work_path, extract_archive, output_archive, remote_build_args,
+};
+
+/// How long a finished job's output can be fetched
+const FINISHED_JOB_TTL: Duration = Duration::from_secs(60 * 60);
+/// Unused work directories older than this are removed
+const WORK_DIR_TTL: Duration = Duration::from_secs(14 * 24 * 60 * 60);
+/// File in a work directory touched whenever a job finishes there
+const WORK_DIR_STAMP: &str = ".espbrew-agent-used";
+
+/// State of a running or finished job
+#[derive(Debug)]
+struct JobState {
+    board_name: String,
+    work_dir: PathBuf,
+    lines: Vec<String>,
+    finished: bool,
+    success: bool,
+    finished_at: Option<Instant>,
+}
+
+/// What became of a submitted job
+#[derive(Debug)]
+pub enum Submission {
+    Started(AgentJob),
+    /// Another job builds the board in the work directory, with its id
+    /// unless it is still unpacking its sources
+    Busy(Option<String>),
+}
+
+/// Runs the build jobs sent by coordinators
+#[derive(Debug)]
+pub struct BuildAgentService {
+    work_root: PathBuf,
+    jobs: RwLock<HashMap<String, Arc<Mutex<JobState>>>>,
+    /// Held by the job using a work directory; a second job of the board is
+    /// turned away while it runs
+    work_dirs: Mutex<HashMap<PathBuf, Arc<Mutex<()>>>>,
+}
+
+impl BuildAgentService {
+    pub fn new(work_root: PathBuf) -> Self {
+        Self {
+            work_root,
+            jobs: RwLock::new(HashMap::new()),
+            work_dirs: Mutex::new(HashMap::new()),
+        }
+    }
+
+    pub fn work_root(&self) -> &Path {
+        &self.work_root
+    }
+
+    /// Unpack the sources and start building the board in the background,
+    /// unless a job builds it already
+    pub async fn submit(
+        &self,
+        project_name: &str,
+        board_name: &str,
+        force: bool,
+        archive: Vec<u8>,
+    ) -> Result<Submission> {
+        self.evict_finished_jobs().await;
+        self.prune_work_dirs().await;
+
+        let work_dir = self
+            .work_root
+            .join(agent_work_path(project_name, board_name)?);
+        let work_lock = self
+            .work_dirs
+            .lock()
+            .await
+            .entry(work_dir.clone())
+            .or_default()
+            .clone();
+        let Ok(guard) = work_lock.try_lock_owned() else {
+            return Ok(Submission::Busy(self.running_job(&work_dir).await));
+        };
+
+        extract_archive(&work_dir, archive).await?;
+        let work_dir = work_dir.canonicalize().unwrap_or(work_dir);
+
+        let id = uuid::Uuid::new_v4().to_string();
+        let state = Arc::new(Mutex::new(JobState {
+            board_name: board_name.to_string(),
+            work_dir: work_dir.clone(),
+            lines: Vec::new(),
+            finished: false,
+            success: false,
+            finished_at: None,
+        }));
+        self.jobs.write().await.insert(id.clone(), state.clone());
+        info!(
+            "🔨 Job {} builds {} in {}",
+            id,
+            board_name,
+            work_dir.display()
+        );
+
+        let args = remote_build_args(board_name, force);
+        let job_id = id.clone();
+        let job_dir = work_dir.clone();
+        tokio::spawn(async move {
+            let success = match run_build(&job_dir, &args, &state).await {
+                Ok(success) => success,
+                Err(e) => {
+                    state.lock().await.lines.push(format!("❌ {:#}", e));
+                    false
+                }
+            };
+            let _ = std::fs::write(job_dir.join(WORK_DIR_STAMP), job_id.as_bytes());
+            let mut state = state.lock().await;
+            state.finished = true;
+            state.success = success;
+            state.finished_at = Some(Instant::now());
+            info!(
+                "{} Job {} finished",
+                if success { "✅" } else { "❌" },
+                job_id
+            );
+            drop(guard);
+        });
+
+        Ok(Submission::Started(AgentJob { id, work_dir }))
+    }
+
+    /// Id of the unfinished job building in `work_dir`
+    async fn running_job(&self, work_dir: &Path) -> Option<String> {
+        let work_dir = work_dir
+            .canonicalize()
+            .unwrap_or_else(|_| work_dir.to_path_buf());
+        for (id, state) in self.jobs.read().await.iter() {
+            let state = state.lock().await;
+            if !state.finished && state.work_dir == work_dir {
+                return Some(id.clone());
+            }
+        }
+        None
+    }
+
+    /// Output of a job from line `from` on, `None` for unknown jobs
+    pub async fn log(&self, id: &str, from: usize) -> Option<AgentJobLog> {
+        let state = self.jobs.read().await.get(id)?.clone();
+        let state = state.lock().await;
+        Some(AgentJobLog {
+            lines: state.lines.iter().skip(from).cloned().collect(),
+            finished: state.finished,
+            success: state.success,
+        })
+    }
+
+    /// Build output of a finished job; the job is forgotten afterwards, its
+    /// work directory is kept for the next build of the board
+    pub async fn artifacts(&self, id: &str, build_dir: &Path) -> Result<Vec<u8>> {
+        if build_dir.is_absolute()
+            || build_dir
+                .components()
+                .any(|c| matches!(c, std::path::Component::ParentDir))
+        {
+            return Err(anyhow::anyhow!(
+                "Build directory {} must be relative to the project",
+                build_dir.display()
+            ));
+        }
+
+        let state = self
+            .jobs
+            .read()
+            .await
+            .get(id)
+            .cloned()
+            .ok_or_else(|| anyhow::anyhow!("Unknown job {}", id))?;
+        let (board_name, work_dir) = {
+            let state = state.lock().await;
+            if !state.finished {
+                return Err(anyhow::anyhow!("Job {} is still running", id));
+            }
+            (state.board_name.clone(), state.work_dir.clone())
+        };
+
+        let archive = output_archive(&work_dir, &board_name, build_dir).await?;
+        self.jobs.write().await.remove(id);
+        Ok(archive)
+    }
+
+    /// Forget a job whose output won't be fetched, e.g. a failed build.
+    /// Returns whether it was known; running jobs are kept.
+    pub async fn discard(&self, id: &str) -> Result<bool> {
+        let mut jobs = self.jobs.write().await;
+        let Some(state) = jobs.get(id) else {
+            return Ok(false);
+        };
+        if !state.lock().await.finished {
+            return Err(anyhow::anyhow!("Job {} is still running", id));
+        }
+        jobs.remove(id);
+        Ok(true)
+    }
+
+    /// Forget the jobs that finished longer than [`FINISHED_JOB_TTL`] ago
+    async fn evict_finished_jobs(&self) {
+        let mut jobs = self.jobs.write().await;
+        let before = jobs.len();
+        jobs.retain(|_, state| {
+            // A job busy with its output is still wanted
+            state.try_lock().map_or(true, |state| {
+                state
+                    .finished_at
+                    .is_none_or(|finished| finished.elapsed() < FINISHED_JOB_TTL)
+            })
+        });
+        if jobs.len() < before {
+            info!("🧹 Forgot {} finished job(s)", before - jobs.len());
+        }
+    }
+
+    /// Remove `<project>/<board>` work directories no job finished in for
+    /// [`WORK_DIR_TTL`], skipping those a job is using
+    async fn prune_work_dirs(&self) {
+        let mut work_dirs = self.work_dirs.lock().await;
+        let Ok(projects) = std::fs::read_dir(&self.work_root) else {
+            return;
+        };
+        for project in projects.flatten().map(|entry| entry.path()) {
+            let Ok(boards) = std::fs::read_dir(&project) else {
+                continue;
+            };
+            for board in boards.flatten().map(|entry| entry.path()) {
+                if work_dirs
+                    .get(&board)
+                    .is_some_and(|lock| lock.try_lock().is_err())
+                    || !is_stale(&board)
+                {
+                    continue;
+                }
+                match std::fs::remove_dir_all(&board) {
+                    Ok(()) => {
+                        info!("🧹 Removed unused work directory {}", board.display());
+                        work_dirs.remove(&board);
+                    }
+                    Err(e) => log::warn!("⚠️  Failed to remove {}: {}", board.display(), e),
+                }
+            }
+            // Only removed when empty
+            let _ = std::fs::remove_dir(&project);
+        }
+    }
+}
+
+/// Whether the work directory's last job finished more than [`WORK_DIR_TTL`]
+/// ago; directories without a stamp are left alone
+fn is_stale(work_dir: &Path) -> bool {
+    std::fs::metadata(work_dir.join(WORK_DIR_STAMP))
+        .and_then(|metadata| metadata.modified())
+        .ok()
+        .and_then(|modified| SystemTime::now().duration_since(modified).ok())
+        .is_some_and(|age| age > WORK_DIR_TTL)
+}
+
+/// Run this executable's CLI build in the work directory, collecting its output
+async fn run_build(work_dir: &Path, args: &[String], state: &Arc<Mutex<JobState>>) -> Result<bool> {
+    let espbrew = std::env::current_exe().context("Failed to locate the espbrew executable")?;
+    let mut child = Command::new(espbrew)
+        .args(args)
+        .current_dir(work_dir)
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped())
+        .spawn()
+        .context("Failed to start the build")?;
+    let stdout = child.stdout.take().unwrap();
+    let stderr = child.stderr.take().unwrap();
+
+    let state_stdout = state.clone();
+    let state_stderr = state.clone();
+    let stdout_task = tokio::spawn(async move {
+        let mut lines = BufReader::new(stdout).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            state_stdout.lock().await.lines.push(line);
+        }
+    });
+    let stderr_task = tokio::spawn(async move {
+        let mut lines = BufReader::new(stderr).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            state_stderr.lock().await.lines.push(line);
+        }
+    });
+
+    let status = child.wait().await.context("Failed to wait for the build")?;
+    // All output is collected before the job is reported finished
+    let _ = stdout_task.await;
+    let _ = stderr_task.await;
+    Ok(status.success())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn finished_job(finished_at: Option<Instant>) -> Arc<Mutex<JobState>> {
+        Arc::new(Mutex::new(JobState {
+            board_name: "esp32s3".to_string(),
+            work_dir: PathBuf::from("app/esp32s3"),
+            lines: Vec::new(),
+            finished: finished_at.is_some(),
+            success: false,
+            finished_at,
+        }))
+    }
+
+    #[tokio::test]
+    async fn test_finished_jobs_are_forgotten() {
+        let work_root = tempfile::TempDir::new().unwrap();
+        let service = BuildAgentService::new(work_root.path().to_path_buf());
+        let expired = Instant::now().checked_sub(FINISHED_JOB_TTL + Duration::from_secs(1));
+        {
+            let mut jobs = service.jobs.write().await;
+            jobs.insert("running".to_string(), finished_job(None));
+            jobs.insert("recent".to_string(), finished_job(Some(Instant::now())));
+            if let Some(expired) = expired {
+                jobs.insert("expired".to_string(), finished_job(Some(expired)));
+            }
+        }
+
+        service.evict_finished_jobs().await;
+        let mut left: Vec<String> = service.jobs.read().await.keys().cloned().collect();
+        left.sort();
+        assert_eq!(left, vec!["recent".to_string(), "running".to_string()]);
+
+        // A failed job's coordinator lets it go, a running one can't be dropped
+        assert!(service.discard("recent").await.unwrap());
+        assert!(!service.discard("recent").await.unwrap());
+        assert!(service.discard("running").await.is_err());
+    }
+
+    #[tokio::test]
+    async fn test_second_job_of_a_board_is_busy() {
+        let work_root = tempfile::TempDir::new().unwrap();
+        let service = BuildAgentService::new(work_root.path().to_path_buf());
+        let work_dir = work_root
+            .path()
+            .join(agent_work_path("app", "esp32s3").unwrap());
+        std::fs::create_dir_all(&work_dir).unwrap();
+        let running = finished_job(None);
+        running.lock().await.work_dir = work_dir.canonicalize().unwrap();
+        service
+            .jobs
+            .write()
+            .await
+            .insert("first".to_string(), running);
+        let _guard = service
+            .work_dirs
+            .lock()
+            .await
+            .entry(work_dir)
+            .or_default()
+            .clone()
+            .try_lock_owned()
+            .unwrap();
+
+        // Turned away at once instead of waiting for the build to end
+        let submission = service
+            .submit("app", "esp32s3", false, Vec::new())
+            .await
+            .unwrap();
+        assert!(matches!(submission, Submission::Busy(Some(id)) if id == "first"));
+    }
+
+    #[test]
+    fn test_work_dirs_without_a_recent_job_are_stale() {
+        let work_dir = tempfile::TempDir::new().unwrap();
+        assert!(!is_stale(work_dir.path()));
+        std::fs::write(work_dir.path().join(WORK_DIR_STAMP), "job").unwrap();
+        assert!(!is_stale(work_dir.path()));
+    }
+}
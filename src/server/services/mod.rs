@@ -1,9 +1,11 @@
 //! Business logic services for the ESPBrew server
 
 pub mod board_scanner;
+pub mod build_agent;
 pub mod flash_service;
 pub mod mdns_service;
 pub mod monitoring_service;
+pub use build_agent::BuildAgentService;
 pub use flash_service::FlashService;
 pub use mdns_service::MdnsService;
 pub use monitoring_service::MonitoringService;
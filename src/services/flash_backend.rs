@@ -0,0 +1,793 @@
+//! Tools that write a board's images to its flash
+//!
+//! The built-in espflash flasher is used unless the board picks another
+//! backend in `espbrew.yaml`:
+//!
+//! ```yaml
+//! boards:
+//!   s3_box:
+//!     flash_backend: openocd    # espflash (default), esptool, openocd or dfu
+//!     openocd_config: board/esp32s3-builtin.cfg
+//! ```
+//!
+//! The serial backends take `upload_speed` and `no_stub` from the board
+//! metadata, esptool also `flash_mode` and `flash_freq`. A write that fails
+//! at a high baud rate is retried once at 115200.
+//!
+//! With `verify: true` in the board's section the written regions are checked
+//! against the images: espflash compares the MD5 the stub computes, esptool
+//! runs `verify_flash` and OpenOCD verifies every image it programs anyway.
+//!
+//! espflash and esptool write over the serial port, which may be the chip's
+//! own USB-Serial-JTAG. OpenOCD writes over JTAG, e.g. the built-in USB-JTAG
+//! of the ESP32-S3, C3 and C6, and ignores the port, as does DFU over the
+//! USB-OTG of the S2 and S3.
+
+use anyhow::{Context, Result};
+use async_trait::async_trait;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+use tokio::io::{AsyncBufReadExt, AsyncRead, BufReader};
+use tokio::process::Command;
+use tokio::sync::mpsc;
+
+use crate::config::{FlashBackendKind, ProjectConfig};
+use crate::models::flash::FlashBinaryInfo;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::projects::flash_orchestrator::flash_progress;
+use crate::services::flash_service::FlashOperation;
+use crate::utils::espflash_utils::{NATIVE_FLASH_BAUD, NativeFlashOptions};
+use crate::utils::native_usb::{self, REENUMERATION_TIMEOUT, UsbInterface};
+use crate::utils::{espflash_utils, process_group};
+
+/// Baud rate of esptool when the board declares no `upload_speed`
+pub const ESPTOOL_DEFAULT_BAUD: u32 = 460800;
+
+/// Baud rate a write that failed faster is retried at
+pub const FALLBACK_BAUD: u32 = 115200;
+
+/// Baud rate to retry a write that failed at `baud`, if that was faster
+pub fn fallback_baud(baud: u32) -> Option<u32> {
+    (baud > FALLBACK_BAUD).then_some(FALLBACK_BAUD)
+}
+
+/// Chips whose built-in USB-JTAG has an OpenOCD board configuration
+const BUILTIN_USB_JTAG_CHIPS: &[&str] = &[
+    "esp32s3", "esp32c3", "esp32c6", "esp32c5", "esp32c61", "esp32h2", "esp32p4",
+];
+
+/// Writes the binaries of a flash operation to a board
+#[async_trait]
+pub trait FlashBackend: Send + Sync {
+    /// Name in output, e.g. `esptool`
+    fn name(&self) -> &'static str;
+
+    /// Whether the backend talks to the board over `operation.port`
+    fn uses_serial_port(&self) -> bool {
+        true
+    }
+
+    /// Whether the port may be an `rfc2217://` or `socket://` URL
+    fn supports_network_ports(&self) -> bool {
+        true
+    }
+
+    /// Baud rate of the serial connection, for backends that have one
+    fn baud(&self) -> Option<u32> {
+        None
+    }
+
+    /// The same backend at another baud rate, to retry a failed write slower
+    fn with_baud(&self, _baud: u32) -> Option<Arc<dyn FlashBackend>> {
+        None
+    }
+
+    /// Whether `write` checks the flash against the binaries when the
+    /// operation asks for verification
+    fn verifies(&self) -> bool {
+        false
+    }
+
+    /// Whether `write` has the device encrypt the binaries when the
+    /// operation asks for it
+    fn encrypts(&self) -> bool {
+        false
+    }
+
+    /// Whether `write` writes the operation's binaries; one that writes an
+    /// image of the whole build can't flash only some parts or extra images
+    fn writes_images(&self) -> bool {
+        true
+    }
+
+    /// Write the binaries, reporting output and progress under `board_name`
+    async fn write(
+        &self,
+        operation: &FlashOperation,
+        board_name: &str,
+        progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    ) -> Result<()>;
+}
+
+/// The backend a board is flashed with, from its `espbrew.yaml` section
+pub fn board_backend(
+    project_dir: &Path,
+    board_config: &ProjectBoardConfig,
+) -> Result<Arc<dyn FlashBackend>> {
+    let config = ProjectConfig::load(project_dir)?;
+    let Some(section) = config
+        .as_ref()
+        .and_then(|config| config.board_section(&board_config.name))
+    else {
+        return Ok(Arc::new(EspflashBackend::default()));
+    };
+    let chip = section
+        .metadata
+        .chip
+        .clone()
+        .or(board_config.target.clone())
+        .map(|chip| chip.to_lowercase().replace('-', ""));
+
+    Ok(match section.flash_backend {
+        FlashBackendKind::Espflash => Arc::new(EspflashBackend {
+            options: NativeFlashOptions {
+                baud: section.metadata.upload_speed.unwrap_or(NATIVE_FLASH_BAUD),
+                use_stub: !section.metadata.no_stub,
+                ..Default::default()
+            },
+        }),
+        FlashBackendKind::Esptool => Arc::new(EsptoolBackend {
+            chip,
+            baud: section
+                .metadata
+                .upload_speed
+                .unwrap_or(ESPTOOL_DEFAULT_BAUD),
+            no_stub: section.metadata.no_stub,
+            flash_mode: section.metadata.esptool_flash_mode(),
+            flash_freq: section.metadata.esptool_flash_freq(),
+        }),
+        FlashBackendKind::Openocd => {
+            let openocd_config = section
+                .openocd_config
+                .clone()
+                .or_else(|| chip.as_deref().and_then(builtin_openocd_config))
+                .ok_or_else(|| {
+                    anyhow::anyhow!(
+                        "Board {} has no built-in USB-JTAG, set its openocd_config in espbrew.yaml",
+                        board_config.name
+                    )
+                })?;
+            Arc::new(OpenOcdBackend {
+                config: openocd_config,
+            })
+        }
+        FlashBackendKind::Dfu => {
+            let pid = chip
+                .as_deref()
+                .and_then(native_usb::dfu_pid)
+                .ok_or_else(|| {
+                    anyhow::anyhow!(
+                        "Board {} has no USB-OTG for DFU, only the ESP32-S2 and S3 have one",
+                        board_config.name
+                    )
+                })?;
+            Arc::new(DfuBackend {
+                pid,
+                image: board_config.build_dir.join("dfu.bin"),
+            })
+        }
+    })
+}
+
+/// OpenOCD board configuration of a chip's built-in USB-JTAG, e.g.
+/// `board/esp32s3-builtin.cfg`
+pub fn builtin_openocd_config(chip: &str) -> Option<String> {
+    BUILTIN_USB_JTAG_CHIPS
+        .contains(&chip)
+        .then(|| format!("board/{}-builtin.cfg", chip))
+}
+
+/// The built-in flasher, using the espflash library over the serial port
+#[derive(Debug, Clone, Copy, Default)]
+pub struct EspflashBackend {
+    pub options: NativeFlashOptions,
+}
+
+#[async_trait]
+impl FlashBackend for EspflashBackend {
+    fn name(&self) -> &'static str {
+        "espflash"
+    }
+
+    fn supports_network_ports(&self) -> bool {
+        false
+    }
+
+    fn baud(&self) -> Option<u32> {
+        Some(self.options.baud)
+    }
+
+    fn with_baud(&self, baud: u32) -> Option<Arc<dyn FlashBackend>> {
+        Some(Arc::new(EspflashBackend {
+            options: NativeFlashOptions {
+                baud,
+                ..self.options
+            },
+        }))
+    }
+
+    fn verifies(&self) -> bool {
+        true
+    }
+
+    async fn write(
+        &self,
+        operation: &FlashOperation,
+        board_name: &str,
+        progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    ) -> Result<()> {
+        let mut flash_data_map = HashMap::new();
+        for binary in &operation.binaries {
+            let data = std::fs::read(&binary.file_path).with_context(|| {
+                format!("Failed to read binary: {}", binary.file_path.display())
+            })?;
+            flash_data_map.insert(binary.offset, data);
+        }
+
+        let usb = espflash_utils::port_usb_info(&operation.port);
+        let options = NativeFlashOptions {
+            verify: operation.verify,
+            ..self.options
+        };
+
+        // With a progress channel the written share is reported as it changes
+        let Some(tx) = progress_tx else {
+            return espflash_utils::flash_multi_binary_with_options(
+                &operation.port,
+                flash_data_map,
+                None,
+                None,
+                options,
+            )
+            .await;
+        };
+        let (update_tx, mut updates) = mpsc::unbounded_channel::<espflash_utils::ProgressUpdate>();
+        let forward = tokio::spawn({
+            let tx = tx.clone();
+            let board_name = board_name.to_string();
+            async move {
+                let mut last = None;
+                while let Some(update) = updates.recv().await {
+                    let percent = update.overall_progress.clamp(0.0, 100.0) as u8;
+                    if last != Some(percent) {
+                        last = Some(percent);
+                        let _ = tx.send(AppEvent::FlashProgress(board_name.clone(), percent));
+                    }
+                }
+            }
+        });
+        let result = espflash_utils::flash_multi_binary_with_options(
+            &operation.port,
+            flash_data_map,
+            Some(board_name.to_string()),
+            Some(update_tx),
+            options,
+        )
+        .await;
+        let _ = forward.await;
+        result?;
+
+        // The chip's own USB port goes away while it resets into the new firmware
+        if let Some(usb) = usb.filter(|usb| UsbInterface::from_ids(usb.vid, usb.pid).is_native()) {
+            match native_usb::wait_for_port(&operation.port, &usb, REENUMERATION_TIMEOUT).await {
+                Ok(port) if port != operation.port => {
+                    let _ = tx.send(AppEvent::BuildOutput(
+                        board_name.to_string(),
+                        format!("🔌 The board came back on {}", port),
+                    ));
+                }
+                Ok(_) => {}
+                Err(e) => {
+                    let _ = tx.send(AppEvent::BuildOutput(
+                        board_name.to_string(),
+                        format!("⚠️  {}", e),
+                    ));
+                }
+            }
+        }
+        Ok(())
+    }
+}
+
+/// `esptool.py write_flash` over the serial port
+#[derive(Debug, Clone)]
+pub struct EsptoolBackend {
+    /// Chip passed as `--chip`; esptool detects it when `None`
+    pub chip: Option<String>,
+    pub baud: u32,
+    /// Write through the ROM loader instead of the flasher stub
+    pub no_stub: bool,
+    /// Flash mode and frequency overriding those of the build
+    pub flash_mode: Option<String>,
+    pub flash_freq: Option<String>,
+}
+
+impl EsptoolBackend {
+    /// Arguments of the `esptool.py` call flashing `operation`
+    pub fn args(&self, operation: &FlashOperation) -> Vec<String> {
+        let mut args = self.connection_args(operation);
+        args.extend(["write_flash".to_string(), "-z".to_string()]);
+        if operation.encrypt {
+            args.push("--encrypt".to_string());
+        }
+        args.extend(self.image_args(operation));
+        args
+    }
+
+    /// Arguments of the `esptool.py verify_flash` call reading back the
+    /// regions `operation` wrote
+    pub fn verify_args(&self, operation: &FlashOperation) -> Vec<String> {
+        let mut args = self.connection_args(operation);
+        args.push("verify_flash".to_string());
+        args.extend(self.image_args(operation));
+        args
+    }
+
+    fn connection_args(&self, operation: &FlashOperation) -> Vec<String> {
+        let mut args = Vec::new();
+        if let Some(chip) = &self.chip {
+            args.extend(["--chip".to_string(), chip.clone()]);
+        }
+        args.extend([
+            "--port".to_string(),
+            operation.port.clone(),
+            "--baud".to_string(),
+            self.baud.to_string(),
+            "--before".to_string(),
+            "default_reset".to_string(),
+            "--after".to_string(),
+            "hard_reset".to_string(),
+        ]);
+        if self.no_stub {
+            args.push("--no-stub".to_string());
+        }
+        args
+    }
+
+    /// Flash parameters, then each binary's offset and file; `verify_flash`
+    /// needs the same parameters to patch the bootloader header like `write_flash`
+    fn image_args(&self, operation: &FlashOperation) -> Vec<String> {
+        let mut args = Vec::new();
+        let config = operation.flash_config.as_ref();
+        let flash_mode = self
+            .flash_mode
+            .clone()
+            .or_else(|| config.map(|config| config.flash_mode.clone()));
+        let flash_freq = self
+            .flash_freq
+            .clone()
+            .or_else(|| config.map(|config| config.flash_freq.clone()));
+        if let Some(mode) = flash_mode {
+            args.extend(["--flash_mode".to_string(), mode]);
+        }
+        if let Some(freq) = flash_freq {
+            args.extend(["--flash_freq".to_string(), freq]);
+        }
+        if let Some(config) = config {
+            args.extend(["--flash_size".to_string(), config.flash_size.clone()]);
+        }
+        for binary in &operation.binaries {
+            args.push(format!("0x{:x}", binary.offset));
+            args.push(binary.file_path.display().to_string());
+        }
+        args
+    }
+}
+
+#[async_trait]
+impl FlashBackend for EsptoolBackend {
+    fn name(&self) -> &'static str {
+        "esptool"
+    }
+
+    fn baud(&self) -> Option<u32> {
+        Some(self.baud)
+    }
+
+    fn with_baud(&self, baud: u32) -> Option<Arc<dyn FlashBackend>> {
+        Some(Arc::new(EsptoolBackend {
+            baud,
+            ..self.clone()
+        }))
+    }
+
+    fn verifies(&self) -> bool {
+        true
+    }
+
+    fn encrypts(&self) -> bool {
+        true
+    }
+
+    async fn write(
+        &self,
+        operation: &FlashOperation,
+        board_name: &str,
+        progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    ) -> Result<()> {
+        // Each image is written from 0 to 100 %, so the total is derived from
+        // the number of images finished before
+        let count = operation.binaries.len().max(1) as u32;
+        let mut finished = 0;
+        let mut last = 0;
+        let mut command = Command::new("esptool.py");
+        command.args(self.args(operation));
+        run_flash_tool(command, "esptool.py", board_name, progress_tx, |line| {
+            let percent = flash_progress(line)? as u32;
+            if percent < last {
+                finished += 1;
+            }
+            last = percent;
+            Some(((finished.min(count - 1) * 100 + percent) / count) as u8)
+        })
+        .await?;
+
+        if operation.verify {
+            let mut command = Command::new("esptool.py");
+            command.args(self.verify_args(operation));
+            run_flash_tool(
+                command,
+                "esptool.py verify_flash",
+                board_name,
+                progress_tx,
+                |_| None,
+            )
+            .await?;
+        }
+        Ok(())
+    }
+}
+
+/// OpenOCD `program_esp` over JTAG
+#[derive(Debug, Clone)]
+pub struct OpenOcdBackend {
+    /// Board configuration, e.g. `board/esp32s3-builtin.cfg`
+    pub config: String,
+}
+
+impl OpenOcdBackend {
+    /// Arguments of the `openocd` call flashing the binaries, verifying each
+    /// and resetting the board afterwards
+    pub fn args(&self, binaries: &[FlashBinaryInfo]) -> Vec<String> {
+        let mut args = vec!["-f".to_string(), self.config.clone()];
+        for binary in binaries {
+            args.push("-c".to_string());
+            args.push(format!(
+                "program_esp {} 0x{:x} verify",
+                binary.file_path.display(),
+                binary.offset
+            ));
+        }
+        args.extend([
+            "-c".to_string(),
+            "reset run".to_string(),
+            "-c".to_string(),
+            "shutdown".to_string(),
+        ]);
+        args
+    }
+}
+
+#[async_trait]
+impl FlashBackend for OpenOcdBackend {
+    fn name(&self) -> &'static str {
+        "openocd"
+    }
+
+    fn uses_serial_port(&self) -> bool {
+        false
+    }
+
+    fn verifies(&self) -> bool {
+        true
+    }
+
+    async fn write(
+        &self,
+        operation: &FlashOperation,
+        board_name: &str,
+        progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    ) -> Result<()> {
+        // OpenOCD reports no percentage, only each image it finished
+        let count = operation.binaries.len().max(1);
+        let mut finished = 0;
+        let mut command = Command::new("openocd");
+        command.args(self.args(&operation.binaries));
+        run_flash_tool(command, "openocd", board_name, progress_tx, |line| {
+            if !line.contains("** Verify OK") {
+                return None;
+            }
+            finished += 1;
+            Some((finished.min(count) * 100 / count) as u8)
+        })
+        .await
+    }
+}
+
+/// `dfu-util` over the USB-OTG of the ESP32-S2 and S3 in ROM download mode
+#[derive(Debug, Clone)]
+pub struct DfuBackend {
+    /// USB product id of the chip's ROM DFU device
+    pub pid: u16,
+    /// Image with every binary, written by `idf.py dfu`
+    pub image: PathBuf,
+}
+
+impl DfuBackend {
+    pub fn args(&self) -> Vec<String> {
+        vec![
+            "-d".to_string(),
+            format!("{:04x}:{:04x}", native_usb::ESPRESSIF_VID, self.pid),
+            "-D".to_string(),
+            self.image.display().to_string(),
+            "-R".to_string(),
+        ]
+    }
+}
+
+#[async_trait]
+impl FlashBackend for DfuBackend {
+    fn name(&self) -> &'static str {
+        "dfu-util"
+    }
+
+    fn uses_serial_port(&self) -> bool {
+        false
+    }
+
+    fn writes_images(&self) -> bool {
+        false
+    }
+
+    async fn write(
+        &self,
+        _operation: &FlashOperation,
+        board_name: &str,
+        progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    ) -> Result<()> {
+        // The image holds the binaries of the build, not those of the operation
+        if !self.image.exists() {
+            let build_dir = self.image.parent().unwrap_or(Path::new("build"));
+            return Err(anyhow::anyhow!(
+                "No DFU image {}, create it with: idf.py -B {} dfu",
+                self.image.display(),
+                build_dir.display()
+            ));
+        }
+        let mut command = Command::new("dfu-util");
+        command.args(self.args());
+        run_flash_tool(command, "dfu-util", board_name, progress_tx, flash_progress).await
+    }
+}
+
+/// Run a flashing tool, forwarding its output under `board_name` and the
+/// percentage `progress` reads from the lines whenever it changes
+pub async fn run_flash_tool(
+    mut command: Command,
+    tool: &str,
+    board_name: &str,
+    progress_tx: Option<&mpsc::UnboundedSender<AppEvent>>,
+    mut progress: impl FnMut(&str) -> Option<u8> + Send,
+) -> Result<()> {
+    command
+        .stdout(std::process::Stdio::piped())
+        .stderr(std::process::Stdio::piped());
+    let mut child = process_group::spawn(&mut command)
+        .with_context(|| format!("Failed to start {}, is it installed?", tool))?;
+
+    let (line_tx, mut lines) = mpsc::unbounded_channel();
+    forward_lines(child.stdout.take().unwrap(), line_tx.clone());
+    forward_lines(child.stderr.take().unwrap(), line_tx);
+
+    let mut last = None;
+    while let Some(line) = lines.recv().await {
+        let Some(tx) = progress_tx else {
+            continue;
+        };
+        if let Some(percent) = progress(&line)
+            && last != Some(percent)
+        {
+            last = Some(percent);
+            let _ = tx.send(AppEvent::FlashProgress(board_name.to_string(), percent));
+        }
+        let _ = tx.send(AppEvent::BuildOutput(board_name.to_string(), line));
+    }
+
+    let status = child
+        .wait()
+        .await
+        .with_context(|| format!("Failed to wait for {}", tool))?;
+    if !status.success() {
+        return Err(anyhow::anyhow!("{} failed with {}", tool, status));
+    }
+    Ok(())
+}
+
+fn forward_lines(
+    reader: impl AsyncRead + Unpin + Send + 'static,
+    tx: mpsc::UnboundedSender<String>,
+) {
+    tokio::spawn(async move {
+        let mut lines = BufReader::new(reader).lines();
+        while let Ok(Some(line)) = lines.next_line().await {
+            let line = line.trim().to_string();
+            if !line.is_empty() {
+                let _ = tx.send(line);
+            }
+        }
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::ProjectType;
+    use crate::models::flash::FlashConfig;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_flash_backends() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+boards:
+  s3_box:
+    chip: esp32s3
+    flash_backend: openocd
+  wrover:
+    chip: esp32
+    flash_backend: openocd
+  wrover_kit:
+    chip: esp32
+    flash_backend: openocd
+    openocd_config: board/esp32-wrover-kit-3.3v.cfg
+  c3_mini:
+    flash_backend: esptool
+    upload_speed: 921600
+"#,
+        )
+        .unwrap();
+
+        let board = |name: &str, target: Option<&str>| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: target.map(str::to_string),
+            project_type: ProjectType::EspIdf,
+        };
+
+        let backend = board_backend(project, &board("s3_box", None)).unwrap();
+        assert_eq!(backend.name(), "openocd");
+        assert!(!backend.uses_serial_port());
+        // The ESP32 has no built-in USB-JTAG, so it needs an adapter configuration
+        assert!(board_backend(project, &board("wrover", None)).is_err());
+        assert_eq!(
+            board_backend(project, &board("wrover_kit", None))
+                .unwrap()
+                .name(),
+            "openocd"
+        );
+        let backend = board_backend(project, &board("c3_mini", Some("esp32-c3"))).unwrap();
+        assert_eq!(backend.name(), "esptool");
+        assert!(backend.uses_serial_port());
+        assert_eq!(
+            board_backend(project, &board("unlisted", None))
+                .unwrap()
+                .name(),
+            "espflash"
+        );
+
+        assert_eq!(
+            builtin_openocd_config("esp32c6").as_deref(),
+            Some("board/esp32c6-builtin.cfg")
+        );
+        assert_eq!(builtin_openocd_config("esp32s2"), None);
+
+        let binary = |name: &str, offset: u32| FlashBinaryInfo {
+            name: name.to_string(),
+            file_name: format!("{}.bin", name),
+            file_path: PathBuf::from(format!("build/{}.bin", name)),
+            offset,
+        };
+        let operation = FlashOperation {
+            port: "/dev/ttyACM0".to_string(),
+            binaries: vec![binary("bootloader", 0x0), binary("app", 0x10000)],
+            flash_config: Some(FlashConfig {
+                flash_mode: "dio".to_string(),
+                flash_freq: "80m".to_string(),
+                flash_size: "4MB".to_string(),
+            }),
+            board_name: Some("c3_mini".to_string()),
+            verify: false,
+            encrypt: false,
+        };
+
+        let esptool = EsptoolBackend {
+            chip: Some("esp32c3".to_string()),
+            baud: 921600,
+            no_stub: false,
+            flash_mode: None,
+            flash_freq: None,
+        };
+        let args = esptool.args(&operation).join(" ");
+        assert!(args.starts_with("--chip esp32c3 --port /dev/ttyACM0 --baud 921600"));
+        assert!(args.contains("write_flash -z --flash_mode dio --flash_freq 80m --flash_size 4MB"));
+        assert!(args.ends_with("0x0 build/bootloader.bin 0x10000 build/app.bin"));
+
+        let openocd = OpenOcdBackend {
+            config: "board/esp32s3-builtin.cfg".to_string(),
+        };
+        assert_eq!(
+            openocd.args(&operation.binaries),
+            [
+                "-f",
+                "board/esp32s3-builtin.cfg",
+                "-c",
+                "program_esp build/bootloader.bin 0x0 verify",
+                "-c",
+                "program_esp build/app.bin 0x10000 verify",
+                "-c",
+                "reset run",
+                "-c",
+                "shutdown",
+            ]
+        );
+    }
+
+    #[test]
+    fn test_dfu_backend() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+boards:
+  s3_otg:
+    chip: esp32s3
+    flash_backend: dfu
+  c3_mini:
+    chip: esp32c3
+    flash_backend: dfu
+"#,
+        )
+        .unwrap();
+        let board = |name: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: None,
+            project_type: ProjectType::EspIdf,
+        };
+        let backend = board_backend(project, &board("s3_otg")).unwrap();
+        assert_eq!(backend.name(), "dfu-util");
+        assert!(!backend.uses_serial_port());
+        assert!(!backend.writes_images());
+        assert!(
+            board_backend(project, &board("unlisted"))
+                .unwrap()
+                .writes_images()
+        );
+        // The C3 has USB-Serial-JTAG but no USB-OTG
+        assert!(board_backend(project, &board("c3_mini")).is_err());
+
+        let dfu = DfuBackend {
+            pid: 0x0009,
+            image: PathBuf::from("build/dfu.bin"),
+        };
+        assert_eq!(dfu.args(), ["-d", "303a:0009", "-D", "build/dfu.bin", "-R"]);
+    }
+}
@@ -5,13 +5,18 @@
 //! same underlying flashing mechanism is used regardless of the interface.
 
 use anyhow::{Context, Result};
-use std::collections::HashMap;
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
 use tokio::sync::mpsc;
 
-use crate::models::AppEvent;
+use crate::config::ProjectConfig;
 use crate::models::flash::{FlashBinaryInfo, FlashConfig};
-use crate::utils::espflash_utils;
+use crate::models::{AppEvent, ProjectBoardConfig};
+use crate::services::flash_backend::{
+    ESPTOOL_DEFAULT_BAUD, EspflashBackend, EsptoolBackend, FlashBackend, board_backend,
+    fallback_baud,
+};
+use crate::utils::serial_tcp::is_network_port;
 
 /// Unified flash operation request for internal use
 #[derive(Debug, Clone)]
@@ -24,6 +29,11 @@ pub struct FlashOperation {
     pub flash_config: Option<FlashConfig>,
     /// Optional board name for progress reporting
     pub board_name: Option<String>,
+    /// Check the written regions against the binaries
+    pub verify: bool,
+    /// Have the device encrypt the binaries as they are written, for devices
+    /// with flash encryption in development mode
+    pub encrypt: bool,
 }
 
 /// Result of a flash operation
@@ -32,24 +42,68 @@ pub struct FlashResult {
     pub success: bool,
     pub message: String,
     pub duration_ms: Option<u64>,
+    /// The flash was read back and matches the binaries
+    pub verified: bool,
 }
 
 /// Unified flash service that works for both local and remote operations
 #[derive(Clone)]
-pub struct UnifiedFlashService;
+pub struct UnifiedFlashService {
+    backend: Arc<dyn FlashBackend>,
+    /// Verify every operation, as the board's `verify` setting asks
+    verify: bool,
+}
 
 impl UnifiedFlashService {
+    /// Service flashing with the built-in espflash flasher
     pub fn new() -> Self {
-        Self
+        Self::with_backend(Arc::new(EspflashBackend::default()))
+    }
+
+    pub fn with_backend(backend: Arc<dyn FlashBackend>) -> Self {
+        Self {
+            backend,
+            verify: false,
+        }
+    }
+
+    /// Service flashing with the backend the board's `espbrew.yaml` section
+    /// picks, verifying the writes if the section asks for it
+    pub fn for_board(project_dir: &Path, board_config: &ProjectBoardConfig) -> Result<Self> {
+        let verify = ProjectConfig::load(project_dir)?
+            .as_ref()
+            .and_then(|config| config.board_section(&board_config.name))
+            .is_some_and(|section| section.verify);
+        Ok(Self {
+            backend: board_backend(project_dir, board_config)?,
+            verify,
+        })
+    }
+
+    /// Whether flashing needs the board's serial port; OpenOCD uses JTAG instead
+    pub fn uses_serial_port(&self) -> bool {
+        self.backend.uses_serial_port()
+    }
+
+    /// Whether flashing writes the binaries it is given; DFU writes the
+    /// build's whole image instead
+    pub fn writes_images(&self) -> bool {
+        self.backend.writes_images()
+    }
+
+    /// Name of the backend, e.g. `dfu-util`
+    pub fn backend_name(&self) -> &'static str {
+        self.backend.name()
     }
 
     /// Flash binaries to ESP32 board using unified service
     pub async fn flash_board(
         &self,
-        operation: FlashOperation,
+        mut operation: FlashOperation,
         progress_tx: Option<mpsc::UnboundedSender<AppEvent>>,
     ) -> Result<FlashResult> {
         let start_time = std::time::Instant::now();
+        operation.verify |= self.verify;
         let board_name = operation
             .board_name
             .clone()
@@ -69,6 +123,7 @@ impl UnifiedFlashService {
                 success: false,
                 message: "No binaries to flash".to_string(),
                 duration_ms: Some(0),
+                verified: false,
             });
         }
 
@@ -79,6 +134,7 @@ impl UnifiedFlashService {
                     success: false,
                     message: format!("Binary file not found: {}", binary.file_path.display()),
                     duration_ms: Some(0),
+                    verified: false,
                 });
             }
         }
@@ -121,10 +177,8 @@ impl UnifiedFlashService {
             }
         }
 
-        // Prepare flash data with memory optimization for large binaries
-        let mut flash_data_map = HashMap::new();
+        // Empty images are rejected before anything is written
         for binary in &operation.binaries {
-            // Performance optimization: check file size before reading to optimize memory allocation
             let file_size = std::fs::metadata(&binary.file_path).with_context(|| {
                 format!("Failed to get metadata for: {}", binary.file_path.display())
             })?;
@@ -134,40 +188,101 @@ impl UnifiedFlashService {
                     success: false,
                     message: format!("Binary file is empty: {}", binary.file_path.display()),
                     duration_ms: Some(0),
+                    verified: false,
                 });
             }
+        }
 
-            // Read binary data efficiently with memory optimization for large files
-            let data = std::fs::read(&binary.file_path).with_context(|| {
-                format!("Failed to read binary: {}", binary.file_path.display())
-            })?;
-
-            // Note: Modern std::fs::read already optimizes memory allocation internally
-            // The main optimization here is avoiding unnecessary data cloning later in the pipeline
+        // The built-in flasher opens local ports only and doesn't encrypt;
+        // esptool speaks serial-over-TCP itself and writes with --encrypt
+        let backend: Arc<dyn FlashBackend> = if (is_network_port(&operation.port)
+            && !self.backend.supports_network_ports())
+            || (operation.encrypt && !self.backend.encrypts())
+        {
+            Arc::new(EsptoolBackend {
+                chip: None,
+                baud: self.backend.baud().unwrap_or(ESPTOOL_DEFAULT_BAUD),
+                no_stub: false,
+                flash_mode: None,
+                flash_freq: None,
+            })
+        } else {
+            self.backend.clone()
+        };
 
-            flash_data_map.insert(binary.offset, data);
+        // A backend that can't read the flash back still flashes, but the
+        // result doesn't claim it was verified; encrypted flash reads back
+        // as ciphertext
+        if operation.verify && operation.encrypt {
+            let message =
+                "⚠️  Encrypted writes can't be read back, the write won't be verified".to_string();
+            log::warn!("{}", message);
+            if let Some(tx) = &progress_tx {
+                let _ = tx.send(AppEvent::BuildOutput(board_name.clone(), message));
+            }
+            operation.verify = false;
+        } else if operation.verify && !backend.verifies() {
+            let message = format!(
+                "⚠️  {} can't read the flash back, the write won't be verified",
+                backend.name()
+            );
+            log::warn!("{}", message);
+            if let Some(tx) = &progress_tx {
+                let _ = tx.send(AppEvent::BuildOutput(board_name.clone(), message));
+            }
         }
+        let verified = operation.verify && backend.verifies();
 
         // Send progress update
         if let Some(tx) = &progress_tx {
+            let what = if backend.writes_images() {
+                format!("{} binaries", operation.binaries.len())
+            } else {
+                "the build's image".to_string()
+            };
             let _ = tx.send(AppEvent::BuildOutput(
                 board_name.clone(),
                 format!(
-                    "🔥 Flashing {} binaries to {}...",
-                    flash_data_map.len(),
-                    operation.port
+                    "🔥 Flashing {} to {} with {}...",
+                    what,
+                    operation.port,
+                    backend.name()
                 ),
             ));
         }
 
         // Perform the actual flash operation
-        let result = espflash_utils::flash_multi_binary(&operation.port, flash_data_map).await;
+        let mut result = backend
+            .write(&operation, &board_name, progress_tx.as_ref())
+            .await;
+
+        // Long cables and cheap adapters drop bytes at high baud rates, so a
+        // failed write is retried once slower
+        if let Err(e) = &result
+            && let Some(baud) = backend.baud().and_then(fallback_baud)
+            && let Some(slower) = backend.with_baud(baud)
+        {
+            let message = format!(
+                "⚠️  Flashing at {} baud failed ({}), retrying at {} baud",
+                backend.baud().unwrap_or_default(),
+                e,
+                baud
+            );
+            log::warn!("{}", message);
+            if let Some(tx) = &progress_tx {
+                let _ = tx.send(AppEvent::BuildOutput(board_name.clone(), message));
+            }
+            result = slower
+                .write(&operation, &board_name, progress_tx.as_ref())
+                .await;
+        }
         let duration_ms = start_time.elapsed().as_millis() as u64;
 
         match result {
             Ok(_) => {
                 let success_msg = format!(
-                    "✅ Successfully flashed {} binaries ({:.1} KB) in {}ms",
+                    "✅ Successfully flashed {}{} binaries ({:.1} KB) in {}ms",
+                    if verified { "and verified " } else { "" },
                     operation.binaries.len(),
                     total_size as f64 / 1024.0,
                     duration_ms
@@ -178,12 +293,16 @@ impl UnifiedFlashService {
                         board_name.clone(),
                         success_msg.clone(),
                     ));
+                    if verified {
+                        let _ = tx.send(AppEvent::FlashVerified(board_name.clone()));
+                    }
                 }
 
                 Ok(FlashResult {
                     success: true,
                     message: success_msg,
                     duration_ms: Some(duration_ms),
+                    verified,
                 })
             }
             Err(e) => {
@@ -197,6 +316,7 @@ impl UnifiedFlashService {
                     success: false,
                     message: error_msg,
                     duration_ms: Some(duration_ms),
+                    verified: false,
                 })
             }
         }
@@ -326,6 +446,7 @@ impl UnifiedFlashService {
                     success: false,
                     message: format!("Build directory not found: {}", specific_dir.display()),
                     duration_ms: Some(0),
+                    verified: false,
                 });
             }
             vec![specific_dir]
@@ -339,6 +460,7 @@ impl UnifiedFlashService {
                 message: "No ESP-IDF build directories found. Run 'idf.py build' first."
                     .to_string(),
                 duration_ms: Some(0),
+                verified: false,
             });
         }
 
@@ -384,6 +506,8 @@ impl UnifiedFlashService {
                         binaries,
                         flash_config: Some(flash_config),
                         board_name: Some(board_name.clone()),
+                        verify: false,
+                        encrypt: false,
                     };
 
                     return self.flash_board(operation, progress_tx).await;
@@ -405,6 +529,7 @@ impl UnifiedFlashService {
             message: "No valid ESP-IDF build artifacts found. Run 'idf.py build' first."
                 .to_string(),
             duration_ms: Some(0),
+            verified: false,
         })
     }
 
@@ -437,6 +562,8 @@ impl UnifiedFlashService {
             binaries: vec![binary_info],
             flash_config: None,
             board_name,
+            verify: false,
+            encrypt: false,
         };
 
         self.flash_board(operation, progress_tx).await
@@ -448,3 +575,242 @@ impl Default for UnifiedFlashService {
         Self::new()
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::BoardMetadata;
+    use crate::models::ProjectType;
+    use std::fs;
+    use std::sync::Mutex;
+    use tempfile::TempDir;
+
+    #[tokio::test]
+    async fn test_baud_fallback() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"
+boards:
+  c3_mini:
+    chip: esp32c3
+    flash_backend: esptool
+    upload_speed: 921600
+    flash_mode: DIO
+    flash_freq: 80MHz
+    no_stub: true
+  s3_box:
+    chip: esp32s3
+    upload_speed: 921600
+"#,
+        )
+        .unwrap();
+
+        let metadata = BoardMetadata::load(project, "c3_mini");
+        let board = |name: &str| ProjectBoardConfig {
+            name: name.to_string(),
+            config_file: project.join(format!("sdkconfig.defaults.{}", name)),
+            build_dir: project.join(format!("build.{}", name)),
+            target: None,
+            project_type: ProjectType::EspIdf,
+        };
+        let binary = |name: &str, offset: u32| {
+            let file_path = project.join(format!("{}.bin", name));
+            fs::write(&file_path, b"\xe9image").unwrap();
+            FlashBinaryInfo {
+                name: name.to_string(),
+                file_name: format!("{}.bin", name),
+                file_path,
+                offset,
+            }
+        };
+        let operation = FlashOperation {
+            port: "/dev/ttyUSB0".to_string(),
+            binaries: vec![binary("bootloader", 0x0), binary("app", 0x10000)],
+            flash_config: Some(FlashConfig {
+                flash_mode: "qio".to_string(),
+                flash_freq: "40m".to_string(),
+                flash_size: "4MB".to_string(),
+            }),
+            board_name: Some("c3_mini".to_string()),
+            verify: false,
+            encrypt: false,
+        };
+
+        // The board's mode and frequency win over those of the build
+        let esptool = board_backend(project, &board("c3_mini")).unwrap();
+        assert_eq!(esptool.baud(), Some(921600));
+        let esptool = EsptoolBackend {
+            chip: Some("esp32c3".to_string()),
+            baud: 921600,
+            no_stub: true,
+            flash_mode: metadata.esptool_flash_mode(),
+            flash_freq: metadata.esptool_flash_freq(),
+        };
+        assert!(esptool.args(&operation).join(" ").contains(
+            "--no-stub write_flash -z --flash_mode dio --flash_freq 80m --flash_size 4MB"
+        ));
+        let espflash = board_backend(project, &board("s3_box")).unwrap();
+        assert_eq!(espflash.name(), "espflash");
+        assert_eq!(espflash.baud(), Some(921600));
+        assert_eq!(espflash.with_baud(115200).unwrap().baud(), Some(115200));
+
+        assert_eq!(fallback_baud(921600), Some(115200));
+        assert_eq!(fallback_baud(115200), None);
+
+        // A backend failing above 115200 baud succeeds on the retry
+        struct FlakyBackend {
+            baud: u32,
+            attempts: Arc<Mutex<Vec<u32>>>,
+        }
+        #[async_trait::async_trait]
+        impl FlashBackend for FlakyBackend {
+            fn name(&self) -> &'static str {
+                "flaky"
+            }
+            fn baud(&self) -> Option<u32> {
+                Some(self.baud)
+            }
+            fn with_baud(&self, baud: u32) -> Option<Arc<dyn FlashBackend>> {
+                Some(Arc::new(FlakyBackend {
+                    baud,
+                    attempts: self.attempts.clone(),
+                }))
+            }
+            async fn write(
+                &self,
+                _operation: &FlashOperation,
+                _board_name: &str,
+                _progress_tx: Option<&tokio::sync::mpsc::UnboundedSender<AppEvent>>,
+            ) -> anyhow::Result<()> {
+                self.attempts.lock().unwrap().push(self.baud);
+                if self.baud > 115200 {
+                    anyhow::bail!("Timed out waiting for packet header");
+                }
+                Ok(())
+            }
+        }
+
+        let attempts = Arc::new(Mutex::new(Vec::new()));
+        let service = UnifiedFlashService::with_backend(Arc::new(FlakyBackend {
+            baud: 921600,
+            attempts: attempts.clone(),
+        }));
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+        let result = service.flash_board(operation, Some(tx)).await.unwrap();
+        assert!(result.success);
+        assert_eq!(*attempts.lock().unwrap(), [921600, 115200]);
+        let mut retried = false;
+        while let Ok(event) = rx.try_recv() {
+            if let AppEvent::BuildOutput(_, line) = event {
+                retried |= line.contains("retrying at 115200 baud");
+            }
+        }
+        assert!(retried);
+    }
+
+    #[tokio::test]
+    async fn test_flash_verification() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            "boards:\n  line_a:\n    verify: true\n  line_b:\n    flash_backend: esptool\n",
+        )
+        .unwrap();
+        let config = ProjectConfig::load(project).unwrap().unwrap();
+        assert!(config.board_section("line_a").unwrap().verify);
+        assert!(!config.board_section("line_b").unwrap().verify);
+
+        let file_path = project.join("app.bin");
+        fs::write(&file_path, b"\xe9image").unwrap();
+        let operation = FlashOperation {
+            port: "/dev/ttyUSB0".to_string(),
+            binaries: vec![FlashBinaryInfo {
+                name: "app".to_string(),
+                file_name: "app.bin".to_string(),
+                file_path: file_path.clone(),
+                offset: 0x10000,
+            }],
+            flash_config: None,
+            board_name: Some("line_a".to_string()),
+            verify: true,
+            encrypt: false,
+        };
+
+        // esptool reads back the same regions with the same flash parameters
+        let esptool = EsptoolBackend {
+            chip: Some("esp32s3".to_string()),
+            baud: 460800,
+            no_stub: false,
+            flash_mode: Some("dio".to_string()),
+            flash_freq: None,
+        };
+        let args = esptool.verify_args(&operation).join(" ");
+        assert!(args.starts_with("--chip esp32s3 --port /dev/ttyUSB0 --baud 460800"));
+        assert!(args.ends_with(&format!(
+            "verify_flash --flash_mode dio 0x10000 {}",
+            file_path.display()
+        )));
+
+        struct RecordingBackend {
+            verifies: bool,
+            asked: Arc<Mutex<Vec<bool>>>,
+        }
+        #[async_trait::async_trait]
+        impl FlashBackend for RecordingBackend {
+            fn name(&self) -> &'static str {
+                "recording"
+            }
+            fn verifies(&self) -> bool {
+                self.verifies
+            }
+            async fn write(
+                &self,
+                operation: &FlashOperation,
+                _board_name: &str,
+                _progress_tx: Option<&tokio::sync::mpsc::UnboundedSender<AppEvent>>,
+            ) -> anyhow::Result<()> {
+                self.asked.lock().unwrap().push(operation.verify);
+                Ok(())
+            }
+        }
+
+        // A verifying backend marks the result and reports the board verified
+        let asked = Arc::new(Mutex::new(Vec::new()));
+        let service = UnifiedFlashService::with_backend(Arc::new(RecordingBackend {
+            verifies: true,
+            asked: asked.clone(),
+        }));
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+        let result = service
+            .flash_board(operation.clone(), Some(tx))
+            .await
+            .unwrap();
+        assert!(result.success && result.verified);
+        assert!(result.message.contains("flashed and verified"));
+        assert_eq!(*asked.lock().unwrap(), [true]);
+        let mut reported = false;
+        while let Ok(event) = rx.try_recv() {
+            reported |= matches!(event, AppEvent::FlashVerified(name) if name == "line_a");
+        }
+        assert!(reported);
+
+        // One that can't read back still flashes, unverified and with a warning
+        let service = UnifiedFlashService::with_backend(Arc::new(RecordingBackend {
+            verifies: false,
+            asked: asked.clone(),
+        }));
+        let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+        let result = service.flash_board(operation, Some(tx)).await.unwrap();
+        assert!(result.success && !result.verified);
+        let mut warned = false;
+        while let Ok(event) = rx.try_recv() {
+            if let AppEvent::BuildOutput(_, line) = event {
+                warned |= line.contains("can't read the flash back");
+            }
+        }
+        assert!(warned);
+    }
+}
@@ -3,6 +3,8 @@
 //! This module provides unified services that can be used by both
 //! local and remote operations to ensure consistency.
 
+pub mod flash_backend;
 pub mod flash_service;
 
+pub use flash_backend::*;
 pub use flash_service::*;
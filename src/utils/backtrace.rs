@@ -0,0 +1,363 @@
+//! Backtraces of the serial monitors decoded with the board's ELF
+//!
+//! Like `idf.py monitor`, code addresses a device prints, e.g. the
+//! `Backtrace:` of an Xtensa panic, the `MEPC` and `RA` registers of a RISC-V
+//! one or the frames of esp-backtrace, are looked up in the firmware's ELF
+//! with the `addr2line` of its architecture. The decoded frames follow the
+//! line as `0x400d1234: app_main at /path/to/main.c:42`, which terminals
+//! and editors open as file locations. The ELF is found the same way for
+//! ESP-IDF, Arduino, TinyGo and Rust builds: by its architecture in the
+//! board's build directory.
+
+use anyhow::{Context, Result};
+use regex::Regex;
+use std::collections::HashMap;
+use std::io::Read;
+use std::path::{Path, PathBuf};
+use std::sync::OnceLock;
+use std::time::SystemTime;
+
+use crate::utils::firmware_size::find_application_elf;
+
+/// Environment variable naming the addr2line to use for every ELF
+pub const ADDR2LINE_ENV: &str = "ESPBREW_ADDR2LINE";
+/// Start of the lines of decoded frames
+pub const FRAME_MARKER: &str = "  ↳ ";
+
+const EM_XTENSA: u16 = 94;
+const EM_RISCV: u16 = 243;
+/// Depth of the build directory searched for an ELF, enough for
+/// `target/<triple>/release/` of Rust builds
+const SEARCH_DEPTH: usize = 3;
+/// Directories of intermediate binaries, not the firmware
+const SKIPPED_DIRS: &[&str] = &["deps", "incremental", "examples", "node_modules"];
+
+fn address_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| Regex::new(r"\b0x(4[0-9a-fA-F]{7})\b").unwrap())
+}
+
+/// Code addresses of a line, in the order printed, each once
+pub fn code_addresses(line: &str) -> Vec<u32> {
+    let mut addresses = Vec::new();
+    for capture in address_regex().captures_iter(line) {
+        if let Ok(address) = u32::from_str_radix(&capture[1], 16)
+            && !addresses.contains(&address)
+        {
+            addresses.push(address);
+        }
+    }
+    addresses
+}
+
+/// Line showing a decoded frame below the line it was decoded from
+pub fn frame_line(frame: &str) -> String {
+    format!("{}{}", FRAME_MARKER, frame)
+}
+
+/// Architecture (`e_machine`) of a little-endian ELF from its header
+pub fn elf_machine(header: &[u8]) -> Option<u16> {
+    if header.len() < 20 || &header[..4] != b"\x7fELF" || header[5] != 1 {
+        return None;
+    }
+    Some(u16::from_le_bytes([header[18], header[19]]))
+}
+
+fn firmware_machine(path: &Path) -> Option<u16> {
+    let mut header = [0u8; 20];
+    std::fs::File::open(path)
+        .ok()?
+        .read_exact(&mut header)
+        .ok()?;
+    elf_machine(&header).filter(|machine| matches!(*machine, EM_XTENSA | EM_RISCV))
+}
+
+/// addr2line tools reading ELFs of the architecture, preferred first
+pub fn addr2line_tools(machine: u16) -> &'static [&'static str] {
+    match machine {
+        EM_XTENSA => &[
+            "xtensa-esp-elf-addr2line",
+            "xtensa-esp32-elf-addr2line",
+            "xtensa-esp32s3-elf-addr2line",
+            "xtensa-esp32s2-elf-addr2line",
+            "xtensa-lx106-elf-addr2line",
+        ],
+        EM_RISCV => &[
+            "riscv32-esp-elf-addr2line",
+            "riscv64-unknown-elf-addr2line",
+            "llvm-addr2line",
+        ],
+        _ => &[],
+    }
+}
+
+/// `ESPBREW_ADDR2LINE`, else the first of the architecture's tools on the `PATH`
+pub fn find_addr2line(machine: u16) -> Option<PathBuf> {
+    if let Ok(tool) = std::env::var(ADDR2LINE_ENV)
+        && !tool.is_empty()
+    {
+        return Some(PathBuf::from(tool));
+    }
+    addr2line_tools(machine)
+        .iter()
+        .find_map(|tool| which::which(tool).ok())
+}
+
+/// Firmware ELF of the build in `build_dir`: the application ELF of an
+/// ESP-IDF build, else the newest Xtensa or RISC-V ELF below it
+pub fn board_elf(build_dir: &Path) -> Option<PathBuf> {
+    if let Some(elf) = find_application_elf(build_dir, &[]) {
+        return Some(elf);
+    }
+    let mut found = Vec::new();
+    collect_firmware(build_dir, SEARCH_DEPTH, &mut found);
+    found
+        .into_iter()
+        .max_by_key(|(modified, _)| *modified)
+        .map(|(_, path)| path)
+}
+
+fn collect_firmware(dir: &Path, depth: usize, found: &mut Vec<(SystemTime, PathBuf)>) {
+    let Ok(entries) = std::fs::read_dir(dir) else {
+        return;
+    };
+    for entry in entries.flatten() {
+        let path = entry.path();
+        let Ok(metadata) = entry.metadata() else {
+            continue;
+        };
+        if metadata.is_dir() {
+            let name = entry.file_name().to_string_lossy().to_string();
+            if depth > 0 && !name.starts_with('.') && !SKIPPED_DIRS.contains(&name.as_str()) {
+                collect_firmware(&path, depth - 1, found);
+            }
+        } else if metadata.is_file() && firmware_machine(&path).is_some() {
+            found.push((metadata.modified().unwrap_or(SystemTime::UNIX_EPOCH), path));
+        }
+    }
+}
+
+/// Frames of `addr2line -pfiaC` output by address; addresses it couldn't
+/// resolve get none
+pub fn parse_addr2line(output: &str) -> Vec<(u32, Vec<String>)> {
+    let mut frames: Vec<(u32, Vec<String>)> = Vec::new();
+    for line in output.lines() {
+        let line = line.trim_end();
+        if let Some(inlined) = line.trim_start().strip_prefix("(inlined by) ") {
+            if let Some((_, address_frames)) = frames.last_mut()
+                && !address_frames.is_empty()
+            {
+                address_frames.push(format!("  (inlined by) {}", inlined));
+            }
+            continue;
+        }
+        let Some((address, frame)) = line.split_once(": ") else {
+            continue;
+        };
+        let Ok(address) = u32::from_str_radix(address.trim_start_matches("0x"), 16) else {
+            continue;
+        };
+        let resolved = !frame.starts_with("?? ");
+        frames.push((
+            address,
+            if resolved {
+                vec![format!("0x{:08x}: {}", address, frame)]
+            } else {
+                Vec::new()
+            },
+        ));
+    }
+    frames
+}
+
+/// Decoder of the code addresses printed by a firmware
+pub struct BacktraceDecoder {
+    elf: PathBuf,
+    tool: PathBuf,
+    frames: HashMap<u32, Vec<String>>,
+}
+
+impl BacktraceDecoder {
+    /// Decoder for `elf` with the addr2line of its architecture
+    pub fn new(elf: &Path) -> Result<Self> {
+        let machine = firmware_machine(elf)
+            .ok_or_else(|| anyhow::anyhow!("{} is not an Xtensa or RISC-V ELF", elf.display()))?;
+        let tool = find_addr2line(machine).ok_or_else(|| {
+            anyhow::anyhow!(
+                "No {} addr2line found, install the ESP toolchain or set {}",
+                if machine == EM_XTENSA {
+                    "Xtensa"
+                } else {
+                    "RISC-V"
+                },
+                ADDR2LINE_ENV
+            )
+        })?;
+        Ok(Self {
+            elf: elf.to_path_buf(),
+            tool,
+            frames: HashMap::new(),
+        })
+    }
+
+    pub fn elf(&self) -> &Path {
+        &self.elf
+    }
+
+    /// Frames of the code addresses in the line, none if it has none
+    pub fn decode_line(&mut self, line: &str) -> Vec<String> {
+        let addresses = code_addresses(line);
+        let unknown: Vec<u32> = addresses
+            .iter()
+            .copied()
+            .filter(|address| !self.frames.contains_key(address))
+            .collect();
+        if !unknown.is_empty() {
+            match self.lookup(&unknown) {
+                Ok(frames) => self.frames.extend(frames),
+                Err(e) => {
+                    log::debug!("Backtrace decoding failed: {:#}", e);
+                    return Vec::new();
+                }
+            }
+            // Addresses addr2line skipped aren't looked up again
+            for address in unknown {
+                self.frames.entry(address).or_default();
+            }
+        }
+        addresses
+            .iter()
+            .flat_map(|address| self.frames.get(address).cloned().unwrap_or_default())
+            .collect()
+    }
+
+    fn lookup(&self, addresses: &[u32]) -> Result<Vec<(u32, Vec<String>)>> {
+        let output = std::process::Command::new(&self.tool)
+            .arg("-pfiaC")
+            .arg("-e")
+            .arg(&self.elf)
+            .args(addresses.iter().map(|address| format!("0x{:08x}", address)))
+            .output()
+            .with_context(|| format!("Failed to run {}", self.tool.display()))?;
+        if !output.status.success() {
+            return Err(anyhow::anyhow!(
+                "{} failed: {}",
+                self.tool.display(),
+                String::from_utf8_lossy(&output.stderr).trim()
+            ));
+        }
+        Ok(parse_addr2line(&String::from_utf8_lossy(&output.stdout)))
+    }
+}
+
+/// The frame with its source location as a terminal hyperlink (OSC 8)
+pub fn frame_hyperlink(frame: &str) -> String {
+    let Some((function, location)) = frame.rsplit_once(" at ") else {
+        return frame.to_string();
+    };
+    let path = location.rsplit_once(':').map_or(location, |(path, _)| path);
+    if !path.starts_with('/') {
+        return frame.to_string();
+    }
+    format!(
+        "{} at \x1b]8;;file://{}\x1b\\{}\x1b]8;;\x1b\\",
+        function, path, location
+    )
+}
+
+/// Terminal sequence copying `text` to the clipboard (OSC 52), which works
+/// over SSH as well
+pub fn osc52_copy(text: &str) -> String {
+    const ALPHABET: &[u8; 64] = b"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+    let mut encoded = String::new();
+    for chunk in text.as_bytes().chunks(3) {
+        let value = chunk.iter().enumerate().fold(0u32, |value, (i, byte)| {
+            value | (u32::from(*byte) << (16 - 8 * i))
+        });
+        for i in 0..4 {
+            if i <= chunk.len() {
+                encoded.push(ALPHABET[((value >> (18 - 6 * i)) & 0x3f) as usize] as char);
+            } else {
+                encoded.push('=');
+            }
+        }
+    }
+    format!("\x1b]52;c;{}\x07", encoded)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_backtrace_decoding() {
+        // Stack pointers and data addresses are not code
+        assert_eq!(
+            code_addresses("Backtrace: 0x400d1e2a:0x3ffb5c40 0x420012f4:0x3ffb5c60 0x400d1e2a"),
+            [0x400d1e2a, 0x420012f4]
+        );
+        assert_eq!(
+            code_addresses("MEPC    : 0x42009a3c  RA      : 0x4200998e"),
+            [0x42009a3c, 0x4200998e]
+        );
+        assert!(code_addresses("I (312) heap_init: At 3FFAE6E0 len 00001920").is_empty());
+
+        let frames = parse_addr2line(
+            "0x400d1e2a: sensor_read at /src/main/sensor.c:88\n \
+             (inlined by) poll at /src/main/poll.c:12\n\
+             0x40081234: ?? ??:0\n",
+        );
+        assert_eq!(frames.len(), 2);
+        assert_eq!(
+            frames[0],
+            (
+                0x400d1e2a,
+                vec![
+                    "0x400d1e2a: sensor_read at /src/main/sensor.c:88".to_string(),
+                    "  (inlined by) poll at /src/main/poll.c:12".to_string(),
+                ]
+            )
+        );
+        assert_eq!(frames[1], (0x40081234, Vec::new()));
+
+        assert_eq!(
+            frame_hyperlink("0x400d1e2a: sensor_read at /src/main/sensor.c:88"),
+            "0x400d1e2a: sensor_read at \x1b]8;;file:///src/main/sensor.c\x1b\\/src/main/sensor.c:88\x1b]8;;\x1b\\"
+        );
+        assert_eq!(
+            frame_hyperlink("0x40081234: rom_func at ??:?"),
+            "0x40081234: rom_func at ??:?"
+        );
+        assert_eq!(osc52_copy("panic"), "\x1b]52;c;cGFuaWM=\x07");
+
+        // Xtensa and RISC-V ELFs; the host's build scripts are skipped
+        let elf_header = |machine: u16| {
+            let mut header = b"\x7fELF\x01\x01\x01".to_vec();
+            header.resize(18, 0);
+            header.extend_from_slice(&machine.to_le_bytes());
+            header.resize(52, 0);
+            header
+        };
+        assert_eq!(elf_machine(&elf_header(94)), Some(94));
+        assert_eq!(elf_machine(b"not an elf at all here"), None);
+        assert!(addr2line_tools(94).contains(&"xtensa-esp-elf-addr2line"));
+        assert!(addr2line_tools(243).contains(&"riscv32-esp-elf-addr2line"));
+        assert!(addr2line_tools(62).is_empty());
+
+        let target = TempDir::new().unwrap();
+        let release = target.path().join("riscv32imac-unknown-none-elf/release");
+        std::fs::create_dir_all(release.join("build/foo-1234")).unwrap();
+        std::fs::create_dir_all(release.join("deps")).unwrap();
+        std::fs::write(
+            release.join("build/foo-1234/build-script-build"),
+            elf_header(62),
+        )
+        .unwrap();
+        std::fs::write(release.join("deps/blinky-1234"), elf_header(243)).unwrap();
+        std::fs::write(release.join("blinky.d"), "blinky: src/main.rs").unwrap();
+        assert_eq!(board_elf(target.path()), None);
+        std::fs::write(release.join("blinky"), elf_header(243)).unwrap();
+        assert_eq!(board_elf(target.path()), Some(release.join("blinky")));
+    }
+}
@@ -0,0 +1,341 @@
+//! ccache and sccache support for ESP-IDF builds
+//!
+//! The cache lives in `.espbrew/<cache>` of the workspace, the git root above
+//! the project or the project itself, so every board and every project of a
+//! monorepo share one cache. ccache locks its cache files and sccache serves
+//! all compilers from one server, so parallel board builds can share it.
+//!
+//! ```yaml
+//! esp_idf:
+//!   compiler_cache: sccache   # ccache (default if installed), sccache or off
+//! ```
+
+use anyhow::Result;
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use tokio::process::Command;
+
+use crate::config::ProjectConfig;
+
+/// Per-compilation results ccache appends while a board builds
+const CCACHE_STATS_LOG: &str = "ccache-stats.log";
+/// Cache statistics of a board's last build, in its build directory
+pub const CACHE_STATS_FILE: &str = "espbrew-cache-stats.json";
+
+/// A supported compiler cache
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum CompilerCache {
+    Ccache,
+    Sccache,
+}
+
+impl CompilerCache {
+    pub fn name(&self) -> &'static str {
+        match self {
+            CompilerCache::Ccache => "ccache",
+            CompilerCache::Sccache => "sccache",
+        }
+    }
+
+    fn is_installed(&self) -> bool {
+        which::which(self.name()).is_ok()
+    }
+}
+
+/// Hits and misses of one board build
+#[derive(Debug, Clone, Copy, Default, PartialEq, Serialize, Deserialize)]
+pub struct CacheStats {
+    pub cache: Option<CompilerCache>,
+    pub hits: u64,
+    pub misses: u64,
+}
+
+impl CacheStats {
+    /// Share of cacheable compilations served from the cache, in percent
+    pub fn hit_rate(&self) -> Option<f64> {
+        let total = self.hits + self.misses;
+        (total > 0).then(|| self.hits as f64 * 100.0 / total as f64)
+    }
+
+    /// e.g. `ccache 412/450 hits (91.6%)`
+    pub fn summary(&self) -> String {
+        let name = self.cache.map(|c| c.name()).unwrap_or("cache");
+        match self.hit_rate() {
+            Some(rate) => format!(
+                "{} {}/{} hits ({:.1}%)",
+                name,
+                self.hits,
+                self.hits + self.misses,
+                rate
+            ),
+            None => format!("{} had nothing to compile", name),
+        }
+    }
+
+    /// Statistics of a board's last build
+    pub fn load(build_dir: &Path) -> Option<Self> {
+        let content = std::fs::read_to_string(build_dir.join(CACHE_STATS_FILE)).ok()?;
+        serde_json::from_str(&content).ok()
+    }
+
+    fn save(&self, build_dir: &Path) -> Result<()> {
+        std::fs::create_dir_all(build_dir)?;
+        std::fs::write(
+            build_dir.join(CACHE_STATS_FILE),
+            serde_json::to_string_pretty(self)?,
+        )?;
+        Ok(())
+    }
+}
+
+/// Cache used for a project: the `esp_idf.compiler_cache` setting, otherwise
+/// ccache or sccache, whichever is installed
+pub fn select_cache(project_dir: &Path) -> Option<CompilerCache> {
+    let setting = ProjectConfig::load(project_dir)
+        .ok()
+        .flatten()
+        .and_then(|config| config.esp_idf)
+        .and_then(|section| section.compiler_cache);
+
+    match setting.as_deref().map(str::to_lowercase).as_deref() {
+        Some("off") | Some("none") | Some("false") => None,
+        Some("ccache") => Some(CompilerCache::Ccache),
+        Some("sccache") => Some(CompilerCache::Sccache),
+        _ => [CompilerCache::Ccache, CompilerCache::Sccache]
+            .into_iter()
+            .find(|cache| cache.is_installed()),
+    }
+}
+
+/// Root the cache is shared below: the enclosing git repository, or the project
+pub fn workspace_root(project_dir: &Path) -> PathBuf {
+    project_dir
+        .ancestors()
+        .find(|dir| dir.join(".git").exists())
+        .unwrap_or(project_dir)
+        .to_path_buf()
+}
+
+/// Cache directory, unless `CCACHE_DIR` or `SCCACHE_DIR` already point elsewhere
+pub fn cache_dir(project_dir: &Path, cache: CompilerCache) -> PathBuf {
+    let variable = match cache {
+        CompilerCache::Ccache => "CCACHE_DIR",
+        CompilerCache::Sccache => "SCCACHE_DIR",
+    };
+    std::env::var_os(variable)
+        .map(PathBuf::from)
+        .unwrap_or_else(|| {
+            workspace_root(project_dir)
+                .join(".espbrew")
+                .join(cache.name())
+        })
+}
+
+/// Environment enabling the cache for idf.py
+pub fn cache_env(
+    project_dir: &Path,
+    cache: CompilerCache,
+    build_dir: &Path,
+) -> Vec<(String, String)> {
+    let dir = cache_dir(project_dir, cache).display().to_string();
+    match cache {
+        CompilerCache::Ccache => vec![
+            ("IDF_CCACHE_ENABLE".to_string(), "1".to_string()),
+            ("CCACHE_DIR".to_string(), dir),
+            // Relative paths let projects of the workspace hit each other's entries
+            (
+                "CCACHE_BASEDIR".to_string(),
+                workspace_root(project_dir).display().to_string(),
+            ),
+            (
+                "CCACHE_STATSLOG".to_string(),
+                build_dir.join(CCACHE_STATS_LOG).display().to_string(),
+            ),
+        ],
+        CompilerCache::Sccache => vec![
+            ("SCCACHE_DIR".to_string(), dir),
+            (
+                "CMAKE_C_COMPILER_LAUNCHER".to_string(),
+                "sccache".to_string(),
+            ),
+            (
+                "CMAKE_CXX_COMPILER_LAUNCHER".to_string(),
+                "sccache".to_string(),
+            ),
+        ],
+    }
+}
+
+/// Create the cache directory and, for sccache, start the shared server once
+/// so parallel builds don't race to spawn it
+pub async fn prepare_cache(project_dir: &Path, cache: CompilerCache) -> Result<()> {
+    let dir = cache_dir(project_dir, cache);
+    std::fs::create_dir_all(&dir)?;
+
+    if cache == CompilerCache::Sccache {
+        // Fails harmlessly if a server is already running
+        let _ = Command::new("sccache")
+            .arg("--start-server")
+            .env("SCCACHE_DIR", &dir)
+            .output()
+            .await?;
+    }
+    Ok(())
+}
+
+/// Counters before a board build: clears ccache's per-board log, or takes a
+/// snapshot of the sccache server statistics
+pub async fn begin_board_stats(cache: CompilerCache, build_dir: &Path) -> Option<CacheStats> {
+    let _ = std::fs::remove_file(build_dir.join(CACHE_STATS_FILE));
+    match cache {
+        CompilerCache::Ccache => {
+            let _ = std::fs::create_dir_all(build_dir);
+            let _ = std::fs::remove_file(build_dir.join(CCACHE_STATS_LOG));
+            None
+        }
+        CompilerCache::Sccache => sccache_stats().await,
+    }
+}
+
+/// Statistics of the board build that just finished, also saved to its build directory.
+///
+/// sccache only reports server wide counters, so with parallel builds the
+/// numbers include compilations of the boards building at the same time.
+pub async fn finish_board_stats(
+    cache: CompilerCache,
+    build_dir: &Path,
+    before: Option<CacheStats>,
+) -> Option<CacheStats> {
+    let stats = match cache {
+        CompilerCache::Ccache => {
+            // No log at all if everything was up to date
+            let log = std::fs::read_to_string(build_dir.join(CCACHE_STATS_LOG)).unwrap_or_default();
+            parse_ccache_stats_log(&log)
+        }
+        CompilerCache::Sccache => {
+            let after = sccache_stats().await?;
+            let before = before.unwrap_or_default();
+            CacheStats {
+                cache: Some(cache),
+                hits: after.hits.saturating_sub(before.hits),
+                misses: after.misses.saturating_sub(before.misses),
+            }
+        }
+    };
+    let _ = stats.save(build_dir);
+    Some(stats)
+}
+
+/// Hits and misses in a ccache stats log, which lists a `# <source>` header
+/// followed by the counters of every compilation
+pub fn parse_ccache_stats_log(log: &str) -> CacheStats {
+    let mut stats = CacheStats {
+        cache: Some(CompilerCache::Ccache),
+        ..Default::default()
+    };
+    for line in log.lines().map(str::trim) {
+        match line {
+            "direct_cache_hit" | "preprocessed_cache_hit" => stats.hits += 1,
+            "cache_miss" => stats.misses += 1,
+            _ => {}
+        }
+    }
+    stats
+}
+
+/// Total hits and misses of the running sccache server
+async fn sccache_stats() -> Option<CacheStats> {
+    let output = Command::new("sccache")
+        .args(["--show-stats", "--stats-format", "json"])
+        .output()
+        .await
+        .ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    let json: serde_json::Value = serde_json::from_slice(&output.stdout).ok()?;
+    Some(parse_sccache_stats(&json))
+}
+
+/// Hits and misses summed over all languages of `sccache --show-stats --stats-format json`
+pub fn parse_sccache_stats(json: &serde_json::Value) -> CacheStats {
+    let count = |key: &str| -> u64 {
+        json.pointer(&format!("/stats/{}/counts", key))
+            .and_then(|counts| counts.as_object())
+            .map(|counts| counts.values().filter_map(|v| v.as_u64()).sum())
+            .unwrap_or(0)
+    };
+    CacheStats {
+        cache: Some(CompilerCache::Sccache),
+        hits: count("cache_hits"),
+        misses: count("cache_misses"),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_compiler_cache() {
+        let temp_dir = TempDir::new().unwrap();
+        let root = temp_dir.path();
+        let project = root.join("apps/sensor");
+        fs::create_dir_all(root.join(".git")).unwrap();
+        fs::create_dir_all(&project).unwrap();
+
+        // Projects of one repository share the cache below its root
+        assert_eq!(workspace_root(&project), root);
+        fs::write(
+            project.join("espbrew.yaml"),
+            "esp_idf:\n  compiler_cache: off\n",
+        )
+        .unwrap();
+        assert_eq!(select_cache(&project), None);
+        fs::write(
+            project.join("espbrew.yaml"),
+            "esp_idf:\n  compiler_cache: sccache\n",
+        )
+        .unwrap();
+        assert_eq!(select_cache(&project), Some(CompilerCache::Sccache));
+
+        let env = cache_env(&project, CompilerCache::Ccache, &project.join("build.box"));
+        let value = |key: &str| env.iter().find(|(k, _)| k == key).map(|(_, v)| v.clone());
+        assert_eq!(value("IDF_CCACHE_ENABLE").as_deref(), Some("1"));
+        assert_eq!(
+            value("CCACHE_STATSLOG"),
+            Some(
+                project
+                    .join("build.box/ccache-stats.log")
+                    .display()
+                    .to_string()
+            )
+        );
+        if std::env::var_os("CCACHE_DIR").is_none() {
+            assert_eq!(
+                value("CCACHE_DIR"),
+                Some(root.join(".espbrew/ccache").display().to_string())
+            );
+        }
+
+        let stats = parse_ccache_stats_log(
+            "# main/main.c\ndirect_cache_hit\n# main/wifi.c\ncache_miss\n# main/ui.c\npreprocessed_cache_hit\n# main/app.c\ndirect_cache_hit\n",
+        );
+        assert_eq!((stats.hits, stats.misses), (3, 1));
+        assert_eq!(stats.hit_rate(), Some(75.0));
+        assert_eq!(stats.summary(), "ccache 3/4 hits (75.0%)");
+        assert_eq!(CacheStats::default().hit_rate(), None);
+
+        let json = serde_json::json!({
+            "stats": {
+                "cache_hits": { "counts": { "C/C++": 120, "Assembler": 4 } },
+            "cache_misses": { "counts": { "C/C++": 6 } }
+            }
+        });
+        let stats = parse_sccache_stats(&json);
+        assert_eq!((stats.hits, stats.misses), (124, 6));
+    }
+}
@@ -0,0 +1,173 @@
+//! defmt logs of Rust firmware over the UART
+//!
+//! With esp-println's `defmt-espflash` feature, esp-hal firmware interleaves
+//! plain text with defmt frames: `0xFF 0x00`, the rzCOBS-encoded frame and a
+//! closing `0x00`. [`DefmtSplitter`] takes the frames out of the stream, and
+//! `defmt-print` decodes them with the format strings the firmware's ELF
+//! keeps in its `.defmt` section into log lines like
+//! `INFO  Temperature: 21.5 °C`.
+
+use anyhow::{Context, Result};
+use std::io::{BufRead, BufReader, Write};
+use std::path::Path;
+use std::process::{Child, ChildStdin, Command, Stdio};
+
+use crate::utils::firmware_size::elf_section_names;
+
+/// Start of a frame in the output of `defmt-espflash`
+pub const FRAME_START: [u8; 2] = [0xFF, 0x00];
+/// End of a frame, also the delimiter of frames in `defmt-print`'s input
+pub const FRAME_END: u8 = 0x00;
+/// Frames never get this long; a stream of them without end is text
+const MAX_FRAME: usize = 16 * 1024;
+
+/// Part of the output read from a port
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum DefmtChunk {
+    Text(Vec<u8>),
+    /// An encoded frame without its start and end bytes
+    Frame(Vec<u8>),
+}
+
+/// Splits what a port outputs into text and defmt frames, also when a
+/// frame is split across reads
+#[derive(Debug, Clone, Default)]
+pub struct DefmtSplitter {
+    buffer: Vec<u8>,
+    in_frame: bool,
+}
+
+impl DefmtSplitter {
+    pub fn push(&mut self, data: &[u8]) -> Vec<DefmtChunk> {
+        self.buffer.extend_from_slice(data);
+        let mut chunks = Vec::new();
+        loop {
+            if self.in_frame {
+                let Some(end) = self.buffer.iter().position(|byte| *byte == FRAME_END) else {
+                    if self.buffer.len() > MAX_FRAME {
+                        self.in_frame = false;
+                        chunks.push(DefmtChunk::Text(std::mem::take(&mut self.buffer)));
+                    }
+                    break;
+                };
+                let frame: Vec<u8> = self.buffer.drain(..=end).take(end).collect();
+                self.in_frame = false;
+                if !frame.is_empty() {
+                    chunks.push(DefmtChunk::Frame(frame));
+                }
+            } else if let Some(start) = self
+                .buffer
+                .windows(FRAME_START.len())
+                .position(|window| window == FRAME_START)
+            {
+                let text: Vec<u8> = self.buffer.drain(..start + FRAME_START.len()).collect();
+                if start > 0 {
+                    chunks.push(DefmtChunk::Text(text[..start].to_vec()));
+                }
+                self.in_frame = true;
+            } else {
+                // A trailing 0xFF may start the next frame
+                let keep = usize::from(self.buffer.last() == Some(&FRAME_START[0]));
+                let text: Vec<u8> = self.buffer.drain(..self.buffer.len() - keep).collect();
+                if !text.is_empty() {
+                    chunks.push(DefmtChunk::Text(text));
+                }
+                break;
+            }
+        }
+        chunks
+    }
+}
+
+/// Whether the ELF has the table of defmt format strings
+pub fn has_defmt_table(elf: &Path) -> bool {
+    elf_section_names(elf).is_ok_and(|names| names.iter().any(|name| name == ".defmt"))
+}
+
+/// `defmt-print` decoding the frames written to it with an ELF's table
+pub struct DefmtDecoder {
+    child: Child,
+    stdin: ChildStdin,
+}
+
+impl DefmtDecoder {
+    /// Start `defmt-print` for `elf`; each log line it decodes is passed to `on_line`
+    pub fn spawn(elf: &Path, on_line: impl Fn(String) + Send + 'static) -> Result<Self> {
+        let mut child = Command::new("defmt-print")
+            .arg("-e")
+            .arg(elf)
+            .stdin(Stdio::piped())
+            .stdout(Stdio::piped())
+            .stderr(Stdio::null())
+            .spawn()
+            .context("Failed to start defmt-print, install it with: cargo install defmt-print")?;
+        let stdin = child
+            .stdin
+            .take()
+            .ok_or_else(|| anyhow::anyhow!("defmt-print has no input"))?;
+        let stdout = child
+            .stdout
+            .take()
+            .ok_or_else(|| anyhow::anyhow!("defmt-print has no output"))?;
+        std::thread::spawn(move || {
+            for line in BufReader::new(stdout).lines() {
+                let Ok(line) = line else {
+                    break;
+                };
+                on_line(line);
+            }
+        });
+        Ok(Self { child, stdin })
+    }
+
+    pub fn decode(&mut self, frame: &[u8]) -> Result<()> {
+        self.stdin
+            .write_all(frame)
+            .and_then(|_| self.stdin.write_all(&[FRAME_END]))
+            .and_then(|_| self.stdin.flush())
+            .context("defmt-print stopped")
+    }
+}
+
+impl Drop for DefmtDecoder {
+    fn drop(&mut self) {
+        let _ = self.child.kill();
+        let _ = self.child.wait();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_defmt_splitter() {
+        let mut splitter = DefmtSplitter::default();
+        assert_eq!(
+            splitter.push(b"boot\n\xff\x00\x01\x02\x03\x00done\n"),
+            [
+                DefmtChunk::Text(b"boot\n".to_vec()),
+                DefmtChunk::Frame(vec![1, 2, 3]),
+                DefmtChunk::Text(b"done\n".to_vec()),
+            ]
+        );
+
+        // Frames split across reads, even between their start bytes
+        assert_eq!(splitter.push(b"ok\xff"), [DefmtChunk::Text(b"ok".to_vec())]);
+        assert!(splitter.push(b"\x00\x04").is_empty());
+        assert_eq!(splitter.push(b"\x05\x00"), [DefmtChunk::Frame(vec![4, 5])]);
+
+        // Empty frames are skipped
+        assert!(splitter.push(b"\xff\x00\x00").is_empty());
+        assert_eq!(
+            splitter.push(b"plain text\n"),
+            [DefmtChunk::Text(b"plain text\n".to_vec())]
+        );
+
+        let dir = tempfile::tempdir().unwrap();
+        let not_elf = dir.path().join("firmware.bin");
+        std::fs::write(&not_elf, b"not an ELF").unwrap();
+        assert!(!has_defmt_table(&not_elf));
+        assert!(!has_defmt_table(&dir.path().join("missing.elf")));
+    }
+}
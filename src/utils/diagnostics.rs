@@ -0,0 +1,248 @@
+//! Compiler diagnostics shared by several boards
+//!
+//! Boards that build the same component print the same warnings, once per
+//! board. The collector picks GCC and Clang style diagnostics out of the board
+//! logs and keeps each distinct one once, together with the boards it occurred
+//! on. Locations inside a board's build directory are written as `<build>/…`
+//! and locations in the project relative to it, so that a warning in a
+//! generated or shared file matches across boards.
+
+use regex::Regex;
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::sync::OnceLock;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, PartialOrd, Ord)]
+pub enum Severity {
+    Error,
+    Warning,
+}
+
+impl Severity {
+    pub fn icon(&self) -> &'static str {
+        match self {
+            Severity::Error => "❌",
+            Severity::Warning => "⚠️ ",
+        }
+    }
+}
+
+/// A diagnostic and the boards it occurred on, in the order they reported it
+#[derive(Debug, Clone, PartialEq)]
+pub struct SharedDiagnostic {
+    pub severity: Severity,
+    /// `file:line:column`
+    pub location: String,
+    pub message: String,
+    pub boards: Vec<String>,
+}
+
+impl SharedDiagnostic {
+    /// e.g. `⚠️  main/app.c:12:5: unused variable 'x' [-Wunused-variable] (2 boards: c3, s3)`
+    pub fn summary(&self) -> String {
+        format!(
+            "{} {}: {} ({} board{}: {})",
+            self.severity.icon(),
+            self.location,
+            self.message,
+            self.boards.len(),
+            if self.boards.len() == 1 { "" } else { "s" },
+            self.boards.join(", ")
+        )
+    }
+}
+
+fn diagnostic_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| {
+        Regex::new(concat!(
+            r"^(?P<location>\S.*?:\d+(?::\d+)?): ",
+            r"(?P<severity>fatal error|error|warning): (?P<message>.+)$"
+        ))
+        .unwrap()
+    })
+}
+
+fn ansi_regex() -> &'static Regex {
+    static REGEX: OnceLock<Regex> = OnceLock::new();
+    REGEX.get_or_init(|| Regex::new(r"\x1b\[[0-9;]*[A-Za-z]").unwrap())
+}
+
+/// The `file:line:column` of a compiler diagnostic line, as the compiler
+/// printed it
+pub fn diagnostic_location(line: &str) -> Option<String> {
+    let line = ansi_regex().replace_all(line, "");
+    diagnostic_regex()
+        .captures(line.trim_end())
+        .map(|captures| captures["location"].to_string())
+}
+
+/// Distinct diagnostics of a set of board logs
+#[derive(Debug, Clone, Default)]
+pub struct DiagnosticsCollector {
+    project_dir: PathBuf,
+    diagnostics: Vec<SharedDiagnostic>,
+    index: HashMap<(Severity, String, String), usize>,
+}
+
+impl DiagnosticsCollector {
+    pub fn new(project_dir: &Path) -> Self {
+        Self {
+            project_dir: project_dir.to_path_buf(),
+            ..Self::default()
+        }
+    }
+
+    /// Record a log line of a board, if it is a compiler diagnostic
+    pub fn add_line(&mut self, board_name: &str, build_dir: &Path, line: &str) {
+        let line = ansi_regex().replace_all(line, "");
+        let Some(captures) = diagnostic_regex().captures(line.trim_end()) else {
+            return;
+        };
+        let severity = match &captures["severity"] {
+            "warning" => Severity::Warning,
+            _ => Severity::Error,
+        };
+        let location = self.normalize_location(build_dir, &captures["location"]);
+        let message = captures["message"].trim().to_string();
+
+        let key = (severity, location, message);
+        match self.index.get(&key) {
+            Some(&position) => {
+                let boards = &mut self.diagnostics[position].boards;
+                if !boards.iter().any(|b| b == board_name) {
+                    boards.push(board_name.to_string());
+                }
+            }
+            None => {
+                self.index.insert(key.clone(), self.diagnostics.len());
+                let (severity, location, message) = key;
+                self.diagnostics.push(SharedDiagnostic {
+                    severity,
+                    location,
+                    message,
+                    boards: vec![board_name.to_string()],
+                });
+            }
+        }
+    }
+
+    fn normalize_location(&self, build_dir: &Path, location: &str) -> String {
+        // Ninja runs the compiler in the build directory, e.g. `../main/app.c`
+        let path = if location.starts_with("..") {
+            lexical_join(build_dir, location)
+        } else {
+            PathBuf::from(location)
+        };
+        if let Ok(rest) = path.strip_prefix(build_dir) {
+            format!("<build>/{}", rest.display())
+        } else if let Ok(rest) = path.strip_prefix(&self.project_dir) {
+            rest.display().to_string()
+        } else {
+            location.to_string()
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.diagnostics.is_empty()
+    }
+
+    pub fn count(&self, severity: Severity) -> usize {
+        self.diagnostics
+            .iter()
+            .filter(|d| d.severity == severity)
+            .count()
+    }
+
+    /// Errors first, then the diagnostics seen on the most boards
+    pub fn diagnostics(&self) -> Vec<&SharedDiagnostic> {
+        let mut diagnostics: Vec<&SharedDiagnostic> = self.diagnostics.iter().collect();
+        diagnostics.sort_by(|a, b| {
+            a.severity
+                .cmp(&b.severity)
+                .then_with(|| b.boards.len().cmp(&a.boards.len()))
+                .then_with(|| a.location.cmp(&b.location))
+        });
+        diagnostics
+    }
+}
+
+/// `base` joined with `relative`, resolving `..` without touching the filesystem
+pub fn lexical_join(base: &Path, relative: &str) -> PathBuf {
+    let mut path = base.to_path_buf();
+    for component in Path::new(relative).components() {
+        match component {
+            std::path::Component::ParentDir => {
+                path.pop();
+            }
+            std::path::Component::CurDir => {}
+            other => path.push(other),
+        }
+    }
+    path
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_shared_diagnostics() {
+        let project = Path::new("/work/app");
+        let mut collector = DiagnosticsCollector::new(project);
+        for board in ["esp32c3", "esp32s3"] {
+            let build_dir = project.join(format!("build.{}", board));
+            let lines = [
+                "[1/42] Building C object esp-idf/main/CMakeFiles/main.dir/app.c.obj".to_string(),
+                "/work/app/main/app.c:12:9: warning: unused variable 'x' [-Wunused-variable]"
+                    .to_string(),
+                // Printed once per translation unit including the header
+                "../main/app.h:3:1: warning: 'helper' defined but not used [-Wunused-function]"
+                    .to_string(),
+                "../main/app.h:3:1: warning: 'helper' defined but not used [-Wunused-function]"
+                    .to_string(),
+                format!(
+                    "\u{1b}[0;33m{}/config/sdkconfig.h:40:9: warning: \"CONFIG_X\" redefined\u{1b}[0m",
+                    build_dir.display()
+                ),
+            ];
+            for line in &lines {
+                collector.add_line(board, &build_dir, line);
+            }
+        }
+        collector.add_line(
+            "esp32s3",
+            &project.join("build.esp32s3"),
+            "/work/app/main/psram.c:7:2: error: 'MALLOC_CAP_SPIRAM' undeclared",
+        );
+
+        assert_eq!(collector.count(Severity::Warning), 3);
+        assert_eq!(collector.count(Severity::Error), 1);
+
+        let diagnostics = collector.diagnostics();
+        assert_eq!(diagnostics[0].severity, Severity::Error);
+        assert_eq!(diagnostics[0].boards, vec!["esp32s3"]);
+
+        let locations: Vec<&str> = diagnostics[1..]
+            .iter()
+            .map(|d| d.location.as_str())
+            .collect();
+        assert_eq!(
+            locations,
+            vec![
+                "<build>/config/sdkconfig.h:40:9",
+                "main/app.c:12:9",
+                "main/app.h:3:1"
+            ]
+        );
+        assert!(
+            diagnostics[1..]
+                .iter()
+                .all(|d| d.boards == vec!["esp32c3", "esp32s3"])
+        );
+        assert_eq!(
+            diagnostics[2].summary(),
+            "⚠️  main/app.c:12:9: unused variable 'x' [-Wunused-variable] (2 boards: esp32c3, esp32s3)"
+        );
+    }
+}
@@ -2,7 +2,7 @@
 
 use crate::models::esp_idf_config::{
     DetectedEspIdfInstallation, EimConfig, EspIdfDetectionResult, EspIdfDetectionSource,
-    EspIdfInstallation,
+    EspIdfInstallation, ManagedEnvironment,
 };
 
 use anyhow::Result;
@@ -31,6 +31,11 @@ pub fn detect_esp_idf_installations() -> EspIdfDetectionResult {
         result.installations.push(env_installation);
     }
 
+    // Try installations made by `espbrew setup`
+    result
+        .installations
+        .extend(detect_from_managed(&managed_toolchains_dir()));
+
     // Try standard location detection
     result
         .installations
@@ -188,6 +193,110 @@ fn detect_from_environment() -> Option<DetectedEspIdfInstallation> {
     None
 }
 
+/// File in a managed ESP-IDF installation holding the environment of its `export.sh`
+pub const MANAGED_ENV_FILE: &str = "espbrew-env.json";
+
+/// File in the managed ESP-IDF directory naming the installation builds use
+pub const MANAGED_ACTIVE_FILE: &str = "active";
+
+/// Directory `espbrew setup` installs toolchains into, `ESPBREW_TOOLCHAINS_DIR`
+/// or `~/.espbrew/toolchains`
+pub fn managed_toolchains_dir() -> PathBuf {
+    if let Some(dir) = env::var_os("ESPBREW_TOOLCHAINS_DIR") {
+        return PathBuf::from(dir);
+    }
+    let home = if cfg!(windows) {
+        env::var_os("USERPROFILE")
+    } else {
+        env::var_os("HOME")
+    };
+    home.map(PathBuf::from)
+        .unwrap_or_default()
+        .join(".espbrew")
+        .join("toolchains")
+}
+
+/// Directory holding the ESP-IDF versions of a managed toolchains directory
+pub fn managed_esp_idf_dir(toolchains_dir: &Path) -> PathBuf {
+    toolchains_dir.join("esp-idf")
+}
+
+/// Name of the active managed ESP-IDF installation, e.g. `v5.3`
+pub fn active_managed_esp_idf(toolchains_dir: &Path) -> Option<String> {
+    fs::read_to_string(managed_esp_idf_dir(toolchains_dir).join(MANAGED_ACTIVE_FILE))
+        .ok()
+        .map(|name| name.trim().to_string())
+        .filter(|name| !name.is_empty())
+}
+
+/// Environment of a managed installation, with its `PATH` entries in front of ours
+pub fn managed_environment_vars(environment: &ManagedEnvironment) -> HashMap<String, String> {
+    let mut vars: HashMap<String, String> = environment
+        .vars
+        .iter()
+        .map(|(key, value)| (key.clone(), value.clone()))
+        .collect();
+    if !environment.path.is_empty() {
+        let current = env::var_os("PATH").unwrap_or_default();
+        let paths = environment
+            .path
+            .iter()
+            .cloned()
+            .chain(env::split_paths(&current));
+        if let Ok(path) = env::join_paths(paths) {
+            vars.insert("PATH".to_string(), path.to_string_lossy().to_string());
+        }
+    }
+    vars
+}
+
+/// Detect the ESP-IDF installations `espbrew setup` made in a toolchains directory
+pub fn detect_from_managed(toolchains_dir: &Path) -> Vec<DetectedEspIdfInstallation> {
+    let Ok(entries) = fs::read_dir(managed_esp_idf_dir(toolchains_dir)) else {
+        return Vec::new();
+    };
+    let active = active_managed_esp_idf(toolchains_dir);
+
+    let mut locations: Vec<PathBuf> = entries
+        .flatten()
+        .map(|entry| entry.path())
+        .filter(|path| path.join("tools").join("idf.py").exists())
+        .collect();
+    locations.sort();
+
+    locations
+        .into_iter()
+        .map(|location| {
+            let name = location
+                .file_name()
+                .map(|name| name.to_string_lossy().to_string());
+            let version = get_esp_idf_version(&location).unwrap_or_else(|| "unknown".to_string());
+            let mut installation = EspIdfInstallation::new(version, location.clone());
+            installation.active = Some(name.is_some() && name == active);
+
+            // Without the tools' PATH entries idf.py can't find its Python environment
+            let environment = fs::read_to_string(location.join(MANAGED_ENV_FILE))
+                .ok()
+                .and_then(|content| serde_json::from_str::<ManagedEnvironment>(&content).ok());
+            let is_set_up = environment.is_some();
+
+            let command_name = location.join("tools").join("idf.py");
+            let mut detected = DetectedEspIdfInstallation::new(
+                installation,
+                EspIdfDetectionSource::Managed,
+                command_name.to_string_lossy().to_string(),
+            );
+            if let Some(environment) = environment {
+                detected
+                    .environment
+                    .extend(managed_environment_vars(&environment));
+            }
+            detected.is_available = is_set_up;
+            detected
+        })
+        .collect()
+}
+
 /// Detect ESP-IDF from standard installation locations
 fn detect_from_standard_locations() -> Vec<DetectedEspIdfInstallation> {
     let mut installations = Vec::new();
@@ -336,6 +445,25 @@ pub fn find_in_path(command: &str) -> Option<PathBuf> {
     None
 }
 
+/// Python running ESP-IDF's scripts: that of the virtual environment in
+/// `IDF_PYTHON_ENV_PATH`, else `python3` or `python` on the PATH
+pub fn find_python() -> PathBuf {
+    env::var_os("IDF_PYTHON_ENV_PATH")
+        .map(|env_path| env_python(Path::new(&env_path)))
+        .filter(|python| python.is_file())
+        .or_else(|| ["python3", "python"].iter().find_map(|c| find_in_path(c)))
+        .unwrap_or_else(|| PathBuf::from("python"))
+}
+
+/// The interpreter of a Python virtual environment
+fn env_python(env_path: &Path) -> PathBuf {
+    if cfg!(windows) {
+        env_path.join("Scripts").join("python.exe")
+    } else {
+        env_path.join("bin").join("python")
+    }
+}
+
 /// Check if a command is available in PATH or as a file
 pub fn is_command_available(command: &str) -> bool {
     // Try direct path first
@@ -378,8 +506,9 @@ fn select_default_installation(
     // 1. EIM installations marked as active
     // 2. Environment variable installations
     // 3. PATH installations
-    // 4. Most recent EIM installation
-    // 5. Most recent standard location installation
+    // 4. Installation activated by `espbrew setup`
+    // 5. Most recent EIM installation
+    // 6. Most recent standard location installation
 
     // Check for active EIM installation
     for installation in installations {
@@ -404,6 +533,16 @@ fn select_default_installation(
         }
     }
 
+    // Check for the installation `espbrew setup` activated
+    for installation in installations {
+        if installation.detection_source == EspIdfDetectionSource::Managed
+            && installation.is_available
+            && installation.installation.active == Some(true)
+        {
+            return Some(installation.clone());
+        }
+    }
+
     // Use the first available installation as fallback
     installations.first().cloned()
 }
@@ -412,6 +551,16 @@ fn select_default_installation(
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_env_python() {
+        let python = env_python(Path::new("/opt/idf-env"));
+        #[cfg(unix)]
+        assert_eq!(python, PathBuf::from("/opt/idf-env/bin/python"));
+        #[cfg(windows)]
+        assert!(python.ends_with("Scripts/python.exe"));
+        assert!(find_python().file_name().is_some());
+    }
+
     #[test]
     fn test_command_availability() {
         // Test with a command that should always be available
@@ -3,12 +3,37 @@ use std::borrow::Cow;
 use std::path::Path;
 use std::time::Duration;
 
-use espflash::connection::{Connection, ResetAfterOperation, ResetBeforeOperation};
+use espflash::connection::Connection;
 use espflash::flasher::Flasher;
 use espflash::image_format::Segment;
 use espflash::target::ProgressCallbacks;
 use serialport::SerialPortType;
 
+use crate::utils::native_usb::UsbInterface;
+
+/// Baud rate of the native flasher when the board declares no `upload_speed`
+pub const NATIVE_FLASH_BAUD: u32 = 460800;
+
+/// How the native flasher talks to the chip
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct NativeFlashOptions {
+    pub baud: u32,
+    /// Load the flasher stub; without it the ROM loader writes the flash
+    pub use_stub: bool,
+    /// Have the chip hash every written segment and compare it with the image
+    pub verify: bool,
+}
+
+impl Default for NativeFlashOptions {
+    fn default() -> Self {
+        Self {
+            baud: NATIVE_FLASH_BAUD,
+            use_stub: true,
+            verify: false,
+        }
+    }
+}
+
 /// Information about an ESP32 board discovered on a serial port
 #[derive(Debug, Clone)]
 pub struct EspBoardInfo {
@@ -22,6 +47,18 @@ pub struct EspBoardInfo {
     pub chip_revision: Option<String>,
 }
 
+/// USB identity of a serial port, `None` for ports that aren't USB or aren't connected
+pub fn port_usb_info(port: &str) -> Option<serialport::UsbPortInfo> {
+    serialport::available_ports()
+        .ok()?
+        .into_iter()
+        .find(|info| info.port_name == port)
+        .and_then(|info| match info.port_type {
+            SerialPortType::UsbPort(usb) => Some(usb),
+            _ => None,
+        })
+}
+
 /// Find all available ESP32-compatible serial ports
 pub fn find_esp_ports() -> Result<Vec<String>> {
     log::debug!("Scanning for ESP32-compatible serial ports");
@@ -180,6 +217,24 @@ pub async fn flash_multi_binary_with_progress(
     flash_data: std::collections::HashMap<u32, Vec<u8>>,
     board_id: Option<String>,
     progress_sender: Option<tokio::sync::mpsc::UnboundedSender<ProgressUpdate>>,
+) -> Result<()> {
+    flash_multi_binary_with_options(
+        port,
+        flash_data,
+        board_id,
+        progress_sender,
+        NativeFlashOptions::default(),
+    )
+    .await
+}
+
+/// Flash multiple binaries at the baud rate and with the loader of `options`
+pub async fn flash_multi_binary_with_options(
+    port: &str,
+    flash_data: std::collections::HashMap<u32, Vec<u8>>,
+    board_id: Option<String>,
+    progress_sender: Option<tokio::sync::mpsc::UnboundedSender<ProgressUpdate>>,
+    options: NativeFlashOptions,
 ) -> Result<()> {
     log::info!(
         "Native multi-binary flash: {} binaries on port {}",
@@ -197,7 +252,7 @@ pub async fn flash_multi_binary_with_progress(
         segments.push((offset, data, format!("segment_{}", i + 1)));
     }
 
-    write_segments_native_with_progress(port, segments, board_id, progress_sender).await
+    write_segments_native_with_progress(port, segments, board_id, progress_sender, options).await
 }
 
 /// Flash ELF file to ESP32 using native espflash API
@@ -330,11 +385,12 @@ pub async fn identify_esp_board_with_logging(
     };
 
     // Create connection
+    let interface = UsbInterface::of_port(&port_info.port_type);
     let connection = Connection::new(
         *Box::new(serial_port),
         usb_info,
-        ResetAfterOperation::HardReset,
-        ResetBeforeOperation::DefaultReset,
+        interface.reset_after(),
+        interface.reset_before(),
         115200,
     );
 
@@ -447,7 +503,14 @@ pub async fn identify_esp_board_with_logging(
 
 /// Internal helper: write one or more segments using native espflash API
 async fn write_segments_native(port: &str, segments_in: Vec<(u32, Vec<u8>, String)>) -> Result<()> {
-    write_segments_native_with_progress(port, segments_in, None, None).await
+    write_segments_native_with_progress(
+        port,
+        segments_in,
+        None,
+        None,
+        NativeFlashOptions::default(),
+    )
+    .await
 }
 
 /// Write segments with optional progress reporting
@@ -456,6 +519,7 @@ async fn write_segments_native_with_progress(
     segments_in: Vec<(u32, Vec<u8>, String)>,
     board_id: Option<String>,
     progress_sender: Option<tokio::sync::mpsc::UnboundedSender<ProgressUpdate>>,
+    options: NativeFlashOptions,
 ) -> Result<()> {
     log::info!(
         "Starting native flash on {} with {} segment(s)",
@@ -484,18 +548,28 @@ async fn write_segments_native_with_progress(
         },
     };
 
+    // The ROM loader syncs at up to the default rate; faster rates are
+    // switched to once connected
+    let connect_baud = options.baud.min(NATIVE_FLASH_BAUD);
+    let flash_baud = (options.baud > connect_baud).then_some(options.baud);
+
     // Open serial
-    let serial_port = serialport::new(port, 460800)
+    let serial_port = serialport::new(port, connect_baud)
         .timeout(Duration::from_millis(3000))
         .open_native()
         .map_err(|e| anyhow::anyhow!("Failed to open serial port {}: {}", port, e))?;
 
+    // The chip's own USB controllers reset differently from a UART bridge
+    let interface = UsbInterface::of_port(&port_info.port_type);
+    if interface.is_native() {
+        log::info!("Flashing over the {} of the chip", interface.describe());
+    }
     let connection = Connection::new(
         *Box::new(serial_port),
         usb_info,
-        ResetAfterOperation::HardReset,
-        ResetBeforeOperation::DefaultReset,
-        460800,
+        interface.reset_after(),
+        interface.reset_before(),
+        connect_baud,
     );
 
     // Prepare progress tracker
@@ -506,8 +580,9 @@ async fn write_segments_native_with_progress(
 
     // Connect and flash in a blocking task
     let result = tokio::task::spawn_blocking(move || -> Result<()> {
-        let mut flasher = Flasher::connect(connection, true, true, true, None, None)
-            .map_err(|e| anyhow::anyhow!("Failed to connect to ESP32: {}", e))?;
+        let mut flasher =
+            Flasher::connect(connection, options.use_stub, true, true, None, flash_baud)
+                .map_err(|e| anyhow::anyhow!("Failed to connect to ESP32: {}", e))?;
 
         // Create appropriate progress reporter based on whether we have progress reporting enabled
         let mut progress =
@@ -530,6 +605,11 @@ async fn write_segments_native_with_progress(
         flasher
             .write_bins_to_flash(&segments, &mut progress)
             .map_err(|e| anyhow::anyhow!("Failed to write binaries to flash: {}", e))?;
+        if options.verify {
+            for segment in &segments {
+                verify_segment(&mut flasher, segment)?;
+            }
+        }
         Ok(())
     })
     .await
@@ -538,6 +618,28 @@ async fn write_segments_native_with_progress(
     result
 }
 
+/// Compare the MD5 the chip computes over a written segment with the image's
+fn verify_segment(flasher: &mut Flasher, segment: &Segment) -> Result<()> {
+    let expected = u128::from_be_bytes(md5::compute(segment.data.as_ref()).0);
+    let actual = flasher
+        .checksum_md5(segment.addr, segment.data.len() as u32)
+        .map_err(|e| anyhow::anyhow!("Failed to read back 0x{:x}: {}", segment.addr, e))?;
+    if actual != expected {
+        return Err(anyhow::anyhow!(
+            "Flash at 0x{:x} doesn't match the image: MD5 {:032x} read back, {:032x} expected",
+            segment.addr,
+            actual,
+            expected
+        ));
+    }
+    log::info!(
+        "Verified {} bytes at 0x{:x}",
+        segment.data.len(),
+        segment.addr
+    );
+    Ok(())
+}
+
 /// Progress reporter for native flashing
 struct NativeProgress {
     total_size: usize,
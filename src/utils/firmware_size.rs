@@ -0,0 +1,523 @@
+//! Firmware size reports read from the application ELF
+//!
+//! Like `idf.py size`, usage is split into the image written to flash, the
+//! code and data placed in IRAM, and the static data and BSS in DRAM. The
+//! section headers are read directly, so the report works the same for
+//! ESP-IDF, Arduino, Rust, TinyGo and Zephyr builds. Every build's report is
+//! kept next to the build records together with the previous build's sizes,
+//! so growth shows up as a delta right away.
+
+use anyhow::{Context, Result};
+use serde::{Deserialize, Serialize};
+use std::path::{Path, PathBuf};
+use tokio::sync::mpsc;
+
+use crate::config::{MemoryLimits, ProjectConfig, SizeLimit};
+use crate::models::{AppEvent, ArtifactType, BuildArtifact};
+
+/// Directory of the size reports, relative to the project
+pub const SIZE_REPORTS_DIR: &str = ".espbrew/sizes";
+
+const SHT_NOBITS: u32 = 8;
+const SHF_WRITE: u64 = 0x1;
+const SHF_ALLOC: u64 = 0x2;
+const SHF_EXECINSTR: u64 = 0x4;
+
+/// Memory used by a firmware image, in bytes
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct FirmwareSize {
+    /// Everything loaded from the image: code, read-only data and initial values
+    pub flash: u64,
+    pub iram: u64,
+    pub dram: u64,
+}
+
+/// Sizes of a board's last build and the build before it
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SizeReport {
+    pub size: FirmwareSize,
+    #[serde(default)]
+    pub previous: Option<FirmwareSize>,
+}
+
+impl SizeReport {
+    /// `.espbrew/sizes/<board>.json` of a project
+    pub fn path(project_dir: &Path, board_name: &str) -> PathBuf {
+        let file_name = board_name.replace(['/', '\\', ':'], "_");
+        project_dir
+            .join(SIZE_REPORTS_DIR)
+            .join(format!("{}.json", file_name))
+    }
+
+    pub fn load(project_dir: &Path, board_name: &str) -> Option<Self> {
+        let content = std::fs::read_to_string(Self::path(project_dir, board_name)).ok()?;
+        serde_json::from_str(&content).ok()
+    }
+
+    fn save(&self, project_dir: &Path, board_name: &str) -> Result<()> {
+        let path = Self::path(project_dir, board_name);
+        if let Some(parent) = path.parent() {
+            std::fs::create_dir_all(parent)
+                .with_context(|| format!("Failed to create {}", parent.display()))?;
+        }
+        std::fs::write(&path, serde_json::to_string_pretty(self)?)
+            .with_context(|| format!("Failed to write {}", path.display()))
+    }
+
+    /// e.g. `flash 812.4 KiB (+1.2 KiB), IRAM 98.1 KiB, DRAM 45.0 KiB (-256 B)`
+    pub fn summary(&self) -> String {
+        let previous = self.previous.unwrap_or(self.size);
+        [
+            ("flash", self.size.flash, previous.flash),
+            ("IRAM", self.size.iram, previous.iram),
+            ("DRAM", self.size.dram, previous.dram),
+        ]
+        .iter()
+        .map(|(region, bytes, before)| {
+            let delta = *bytes as i64 - *before as i64;
+            if delta == 0 {
+                format!("{} {}", region, format_bytes(*bytes))
+            } else {
+                format!(
+                    "{} {} ({}{})",
+                    region,
+                    format_bytes(*bytes),
+                    if delta > 0 { "+" } else { "-" },
+                    format_bytes(delta.unsigned_abs())
+                )
+            }
+        })
+        .collect::<Vec<_>>()
+        .join(", ")
+    }
+
+    /// Whether any region grew since the previous build
+    pub fn grew(&self) -> bool {
+        self.previous.is_some_and(|previous| {
+            self.size.flash > previous.flash
+                || self.size.iram > previous.iram
+                || self.size.dram > previous.dram
+        })
+    }
+}
+
+/// Sizes in bytes below 1 KiB, in KiB with one decimal otherwise
+pub fn format_bytes(bytes: u64) -> String {
+    if bytes < 1024 {
+        format!("{} B", bytes)
+    } else {
+        format!("{:.1} KiB", bytes as f64 / 1024.0)
+    }
+}
+
+/// Size in bytes of a limit like `1.5MB`, `180KB`, `180KiB` or `4096`;
+/// K and M are powers of 1024, as in `idf.py size`
+pub fn parse_size(value: &str) -> Result<u64> {
+    let value = value.trim();
+    let split = value
+        .find(|c: char| !(c.is_ascii_digit() || c == '.'))
+        .unwrap_or(value.len());
+    let (number, unit) = value.split_at(split);
+    let number: f64 = number
+        .parse()
+        .with_context(|| format!("Invalid size '{}'", value))?;
+    let multiplier = match unit.trim().to_uppercase().as_str() {
+        "" | "B" => 1,
+        "K" | "KB" | "KIB" => 1024,
+        "M" | "MB" | "MIB" => 1024 * 1024,
+        _ => return Err(anyhow::anyhow!("Invalid size unit in '{}'", value)),
+    };
+    Ok((number * multiplier as f64).round() as u64)
+}
+
+/// Regions of a build that exceed the limits, e.g.
+/// `DRAM 185.2 KiB exceeds the 180.0 KiB limit by 5.2 KiB`
+pub fn limit_violations(size: &FirmwareSize, limits: &MemoryLimits) -> Result<Vec<String>> {
+    let mut violations = Vec::new();
+    for (region, used, limit) in [
+        ("flash", size.flash, &limits.flash),
+        ("IRAM", size.iram, &limits.iram),
+        ("DRAM", size.dram, &limits.dram),
+    ] {
+        let Some(limit) = limit else {
+            continue;
+        };
+        let limit = match limit {
+            SizeLimit::Bytes(bytes) => *bytes,
+            SizeLimit::Text(text) => {
+                parse_size(text).with_context(|| format!("Invalid {} limit", region))?
+            }
+        };
+        if used > limit {
+            violations.push(format!(
+                "{} {} exceeds the {} limit by {}",
+                region,
+                format_bytes(used),
+                format_bytes(limit),
+                format_bytes(used - limit)
+            ));
+        }
+    }
+    Ok(violations)
+}
+
+/// Fail a board build whose size exceeds the board's `limits` in
+/// `espbrew.yaml`, or whose size can't be told because it has no ELF
+pub fn enforce_memory_limits(
+    project_dir: &Path,
+    board_name: &str,
+    report: Option<&SizeReport>,
+    tx: &mpsc::UnboundedSender<AppEvent>,
+) -> Result<()> {
+    let Some(config) = ProjectConfig::load(project_dir)? else {
+        return Ok(());
+    };
+    let Some(limits) = config.board_limits(board_name) else {
+        return Ok(());
+    };
+    let Some(report) = report else {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_name.to_string(),
+            "❌ No application ELF found to check the memory limits against".to_string(),
+        ));
+        return Err(anyhow::anyhow!(
+            "{} has memory limits, but its build has no application ELF to check them against",
+            board_name
+        ));
+    };
+
+    let violations = limit_violations(&report.size, limits)?;
+    if violations.is_empty() {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_name.to_string(),
+            "✅ Within the memory limits".to_string(),
+        ));
+        return Ok(());
+    }
+    for violation in &violations {
+        let _ = tx.send(AppEvent::BuildOutput(
+            board_name.to_string(),
+            format!("❌ {}", violation),
+        ));
+    }
+    Err(anyhow::anyhow!(
+        "{} exceeds its memory limits: {}",
+        board_name,
+        violations.join(", ")
+    ))
+}
+
+/// Application ELF of a build: an ELF artifact, the `.elf` next to the
+/// application binary, or the `app_elf` of ESP-IDF's project description
+pub fn find_application_elf(build_dir: &Path, artifacts: &[BuildArtifact]) -> Option<PathBuf> {
+    if let Some(elf) = artifacts
+        .iter()
+        .find(|a| a.artifact_type == ArtifactType::Elf && a.file_path.exists())
+    {
+        return Some(elf.file_path.clone());
+    }
+
+    let next_to_binary = artifacts
+        .iter()
+        .filter(|a| a.artifact_type == ArtifactType::Application)
+        .map(|a| a.file_path.with_extension("elf"))
+        .find(|elf| elf.exists());
+    if next_to_binary.is_some() {
+        return next_to_binary;
+    }
+
+    let description = std::fs::read_to_string(build_dir.join("project_description.json")).ok()?;
+    let description: serde_json::Value = serde_json::from_str(&description).ok()?;
+    let elf = build_dir.join(description.get("app_elf")?.as_str()?);
+    elf.exists().then_some(elf)
+}
+
+/// Names of the sections of an ELF file
+pub fn elf_section_names(elf: &Path) -> Result<Vec<String>> {
+    let data = std::fs::read(elf).with_context(|| format!("Failed to read {}", elf.display()))?;
+    let sections = elf_sections(&data).with_context(|| format!("Invalid ELF {}", elf.display()))?;
+    Ok(sections.into_iter().map(|section| section.name).collect())
+}
+
+/// Memory usage of an ELF file, from its allocated sections
+pub fn elf_size(elf: &Path) -> Result<FirmwareSize> {
+    let data = std::fs::read(elf).with_context(|| format!("Failed to read {}", elf.display()))?;
+    let sections = elf_sections(&data).with_context(|| format!("Invalid ELF {}", elf.display()))?;
+
+    let mut size = FirmwareSize::default();
+    for section in sections.iter().filter(|s| s.flags & SHF_ALLOC != 0) {
+        if section.kind != SHT_NOBITS {
+            size.flash += section.size;
+        }
+        // RTC memory and PSRAM are neither IRAM nor DRAM
+        if section.name.contains("rtc") || section.name.contains("ext_ram") {
+            continue;
+        }
+        if section.name.contains("iram") || section.name.contains("rwtext") {
+            size.iram += section.size;
+        } else if section.name.contains("dram")
+            || (section.flags & SHF_WRITE != 0 && section.flags & SHF_EXECINSTR == 0)
+        {
+            size.dram += section.size;
+        }
+    }
+    Ok(size)
+}
+
+/// Read the size of a board's new build and store it with the previous
+/// build's sizes for the delta
+pub fn record_build_size(
+    project_dir: &Path,
+    board_name: &str,
+    build_dir: &Path,
+    artifacts: &[BuildArtifact],
+) -> Result<Option<SizeReport>> {
+    let Some(elf) = find_application_elf(build_dir, artifacts) else {
+        return Ok(None);
+    };
+    let report = SizeReport {
+        size: elf_size(&elf)?,
+        previous: SizeReport::load(project_dir, board_name).map(|last| last.size),
+    };
+    report.save(project_dir, board_name)?;
+    Ok(Some(report))
+}
+
+struct ElfSection {
+    name: String,
+    kind: u32,
+    flags: u64,
+    size: u64,
+}
+
+/// Section headers of a little-endian ELF32 or ELF64 file
+fn elf_sections(data: &[u8]) -> Result<Vec<ElfSection>> {
+    if data.len() < 0x40 || &data[..4] != b"\x7fELF" {
+        return Err(anyhow::anyhow!("not an ELF file"));
+    }
+    if data[5] != 1 {
+        return Err(anyhow::anyhow!("big-endian ELF files are not supported"));
+    }
+    let is_64 = match data[4] {
+        1 => false,
+        2 => true,
+        class => return Err(anyhow::anyhow!("unknown ELF class {}", class)),
+    };
+
+    let read = |offset: usize, len: usize| -> Result<u64> {
+        let bytes = data
+            .get(offset..offset + len)
+            .ok_or_else(|| anyhow::anyhow!("truncated at offset {:#x}", offset))?;
+        Ok(bytes
+            .iter()
+            .rev()
+            .fold(0u64, |value, byte| (value << 8) | u64::from(*byte)))
+    };
+    let word = if is_64 { 8 } else { 4 };
+
+    let (shoff, shentsize, shnum, shstrndx) = if is_64 {
+        (
+            read(0x28, 8)?,
+            read(0x3a, 2)?,
+            read(0x3c, 2)?,
+            read(0x3e, 2)?,
+        )
+    } else {
+        (
+            read(0x20, 4)?,
+            read(0x2e, 2)?,
+            read(0x30, 2)?,
+            read(0x32, 2)?,
+        )
+    };
+
+    let mut headers = Vec::new();
+    for index in 0..shnum {
+        let base = (shoff + index * shentsize) as usize;
+        let name = read(base, 4)?;
+        let kind = read(base + 4, 4)? as u32;
+        let flags = read(base + 8, word)?;
+        // sh_addr comes after the flags, then sh_offset and sh_size
+        let offset = read(base + 8 + 2 * word, word)?;
+        let size = read(base + 8 + 3 * word, word)?;
+        headers.push((name, kind, flags, offset, size));
+    }
+
+    let strtab_offset = headers
+        .get(shstrndx as usize)
+        .map(|(_, _, _, offset, _)| *offset as usize)
+        .ok_or_else(|| anyhow::anyhow!("missing section name table"))?;
+    let section_name = |name: u64| -> String {
+        let start = strtab_offset + name as usize;
+        data.get(start..)
+            .and_then(|rest| rest.split(|b| *b == 0).next())
+            .map(|name| String::from_utf8_lossy(name).to_string())
+            .unwrap_or_default()
+    };
+
+    Ok(headers
+        .into_iter()
+        .map(|(name, kind, flags, _, size)| ElfSection {
+            name: section_name(name),
+            kind,
+            flags,
+            size,
+        })
+        .collect())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    /// Minimal little-endian ELF32 with the given (name, type, flags, size) sections
+    fn write_test_elf(path: &Path, sections: &[(&str, u32, u32, u32)]) {
+        let mut names = vec![0u8];
+        let mut name_offsets = Vec::new();
+        for (name, ..) in sections.iter().chain([&(".shstrtab", 3, 0, 0)]) {
+            name_offsets.push(names.len() as u32);
+            names.extend_from_slice(name.as_bytes());
+            names.push(0);
+        }
+        let shoff = 0x34 + names.len() as u32;
+        let shnum = sections.len() as u16 + 2;
+
+        let mut elf = vec![0x7f, b'E', b'L', b'F', 1, 1, 1];
+        elf.resize(0x20, 0);
+        elf.extend_from_slice(&shoff.to_le_bytes());
+        elf.resize(0x2e, 0);
+        elf.extend_from_slice(&40u16.to_le_bytes());
+        elf.extend_from_slice(&shnum.to_le_bytes());
+        elf.extend_from_slice(&(shnum - 1).to_le_bytes());
+        elf.extend_from_slice(&names);
+
+        let mut header = |name: u32, kind: u32, flags: u32, offset: u32, size: u32| {
+            for field in [name, kind, flags, 0, offset, size, 0, 0, 0, 0] {
+                elf.extend_from_slice(&field.to_le_bytes());
+            }
+        };
+        header(0, 0, 0, 0, 0);
+        for ((_, kind, flags, size), name) in sections.iter().zip(&name_offsets) {
+            header(*name, *kind, *flags, 0, *size);
+        }
+        header(name_offsets[sections.len()], 3, 0, 0x34, names.len() as u32);
+        fs::write(path, elf).unwrap();
+    }
+
+    #[test]
+    fn test_firmware_size_report() {
+        const PROGBITS: u32 = 1;
+        const NOBITS: u32 = 8;
+        const AX: u32 = 0x6;
+        const WA: u32 = 0x3;
+
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        let build_dir = project.join("build.box");
+        fs::create_dir_all(&build_dir).unwrap();
+        let elf = build_dir.join("app.elf");
+        let sections = [
+            (".flash.text", PROGBITS, AX, 0x8000),
+            (".flash.rodata", PROGBITS, 0x2, 0x2000),
+            (".iram0.text", PROGBITS, AX, 0x1000),
+            (".dram0.data", PROGBITS, WA, 0x400),
+            (".dram0.bss", NOBITS, WA, 0x800),
+            (".rtc.text", PROGBITS, AX, 0x180),
+            (".debug_info", PROGBITS, 0, 0x10000),
+        ];
+        write_test_elf(&elf, &sections);
+
+        let size = elf_size(&elf).unwrap();
+        assert_eq!(size.flash, 0x8000 + 0x2000 + 0x1000 + 0x400 + 0x180);
+        assert_eq!(size.iram, 0x1000);
+        assert_eq!(size.dram, 0x400 + 0x800);
+
+        // The ELF is found next to the application binary
+        let artifacts = vec![BuildArtifact {
+            name: "app".to_string(),
+            file_path: build_dir.join("app.bin"),
+            artifact_type: ArtifactType::Application,
+            offset: Some(0x10000),
+        }];
+        let first = record_build_size(project, "box", &build_dir, &artifacts)
+            .unwrap()
+            .unwrap();
+        assert!(first.previous.is_none() && !first.grew());
+        assert_eq!(
+            first.summary(),
+            "flash 45.4 KiB, IRAM 4.0 KiB, DRAM 3.0 KiB"
+        );
+
+        let mut grown = sections;
+        grown[0].3 += 0x800;
+        grown[4].3 -= 0x80;
+        write_test_elf(&elf, &grown);
+        let second = record_build_size(project, "box", &build_dir, &artifacts)
+            .unwrap()
+            .unwrap();
+        assert!(second.grew());
+        assert_eq!(
+            second.summary(),
+            "flash 47.4 KiB (+2.0 KiB), IRAM 4.0 KiB, DRAM 2.9 KiB (-128 B)"
+        );
+        assert_eq!(SizeReport::load(project, "box").unwrap().size, second.size);
+
+        assert!(
+            record_build_size(project, "c3", &project.join("build.c3"), &[])
+                .unwrap()
+                .is_none()
+        );
+    }
+
+    #[test]
+    fn test_memory_limits() {
+        assert_eq!(parse_size("1.5MB").unwrap(), 1536 * 1024);
+        assert_eq!(parse_size("180KB").unwrap(), 180 * 1024);
+        assert_eq!(parse_size("90 KiB").unwrap(), 90 * 1024);
+        assert_eq!(parse_size("4096").unwrap(), 4096);
+        assert!(parse_size("1.5GB").is_err());
+        assert!(parse_size("lots").is_err());
+
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::write(
+            project.join("espbrew.yaml"),
+            r#"boards:
+  esp32c3:
+    limits: { flash: 1.5MB, dram: 180KB, iram: 92160 }
+"#,
+        )
+        .unwrap();
+
+        let report = |dram: u64| SizeReport {
+            size: FirmwareSize {
+                flash: 1024 * 1024,
+                iram: 64 * 1024,
+                dram,
+            },
+            previous: None,
+        };
+        let (tx, mut rx) = mpsc::unbounded_channel();
+
+        assert!(enforce_memory_limits(project, "esp32c3", Some(&report(100 * 1024)), &tx).is_ok());
+        // Boards without limits aren't gated, builds of boards with limits but
+        // without a size fail
+        assert!(enforce_memory_limits(project, "esp32s3", Some(&report(200 * 1024)), &tx).is_ok());
+        assert!(enforce_memory_limits(project, "esp32s3", None, &tx).is_ok());
+        assert!(enforce_memory_limits(project, "esp32c3", None, &tx).is_err());
+
+        let error = enforce_memory_limits(project, "esp32c3", Some(&report(185 * 1024)), &tx)
+            .unwrap_err()
+            .to_string();
+        assert!(error.contains("DRAM 185.0 KiB exceeds the 180.0 KiB limit by 5.0 KiB"));
+        assert!(!error.contains("flash"));
+
+        let mut log = Vec::new();
+        while let Ok(AppEvent::BuildOutput(_, line)) = rx.try_recv() {
+            log.push(line);
+        }
+        assert!(log.iter().any(|line| line.starts_with("❌ DRAM")));
+    }
+}
@@ -0,0 +1,238 @@
+//! ESP-IDF component manager manifests (`idf_component.yml`)
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+use std::time::SystemTime;
+
+/// Component manager manifest file name
+pub const COMPONENT_MANIFEST_FILE: &str = "idf_component.yml";
+/// Lock file written by the component manager after resolution
+pub const DEPENDENCIES_LOCK_FILE: &str = "dependencies.lock";
+/// Directory the component manager downloads dependencies into
+pub const MANAGED_COMPONENTS_DIR: &str = "managed_components";
+
+/// Where a component dependency comes from
+#[derive(Debug, Clone, PartialEq)]
+pub enum DependencySource {
+    /// ESP Component Registry (components.espressif.com)
+    Registry,
+    Git(String),
+    Local(PathBuf),
+}
+
+/// A single entry of a manifest's `dependencies` map
+#[derive(Debug, Clone)]
+pub struct ComponentDependency {
+    pub name: String,
+    pub version: Option<String>,
+    pub source: DependencySource,
+    /// Manifest declaring the dependency
+    pub manifest: PathBuf,
+}
+
+impl ComponentDependency {
+    /// Whether resolving this dependency needs network access
+    pub fn is_remote(&self) -> bool {
+        !matches!(self.source, DependencySource::Local(_))
+    }
+
+    /// Name as written to `dependencies.lock` (registry names default to the `espressif` namespace)
+    pub fn lock_name(&self) -> String {
+        if self.source == DependencySource::Registry && !self.name.contains('/') {
+            format!("espressif/{}", self.name)
+        } else {
+            self.name.clone()
+        }
+    }
+}
+
+/// Manifests of a project: the project root, `main/` and every component in `components/`
+pub fn find_component_manifests(project_dir: &Path) -> Vec<PathBuf> {
+    let mut manifests = Vec::new();
+
+    for dir in [project_dir.to_path_buf(), project_dir.join("main")] {
+        let manifest = dir.join(COMPONENT_MANIFEST_FILE);
+        if manifest.exists() {
+            manifests.push(manifest);
+        }
+    }
+
+    if let Ok(entries) = std::fs::read_dir(project_dir.join("components")) {
+        let mut component_manifests: Vec<PathBuf> = entries
+            .flatten()
+            .map(|entry| entry.path().join(COMPONENT_MANIFEST_FILE))
+            .filter(|manifest| manifest.exists())
+            .collect();
+        component_manifests.sort();
+        manifests.extend(component_manifests);
+    }
+
+    manifests
+}
+
+/// Parse the `dependencies` of a manifest, skipping the `idf` version constraint
+pub fn parse_component_manifest(manifest: &Path) -> Result<Vec<ComponentDependency>> {
+    let content = std::fs::read_to_string(manifest)
+        .with_context(|| format!("Failed to read {}", manifest.display()))?;
+    let value: serde_yaml::Value = serde_yaml::from_str(&content)
+        .with_context(|| format!("Failed to parse {}", manifest.display()))?;
+
+    let Some(dependencies) = value.get("dependencies").and_then(|d| d.as_mapping()) else {
+        return Ok(Vec::new());
+    };
+
+    let manifest_dir = manifest.parent().unwrap_or(Path::new("."));
+    let mut result = Vec::new();
+
+    for (name, spec) in dependencies {
+        let Some(name) = name.as_str() else {
+            continue;
+        };
+        if name == "idf" {
+            continue;
+        }
+
+        let (version, source) = match spec {
+            serde_yaml::Value::String(version) => {
+                (Some(version.clone()), DependencySource::Registry)
+            }
+            serde_yaml::Value::Mapping(_) => {
+                let version = spec
+                    .get("version")
+                    .and_then(|v| v.as_str())
+                    .map(|v| v.to_string());
+                let source = if let Some(path) = spec.get("path").and_then(|p| p.as_str()) {
+                    DependencySource::Local(manifest_dir.join(path))
+                } else if let Some(path) = spec.get("override_path").and_then(|p| p.as_str()) {
+                    DependencySource::Local(manifest_dir.join(path))
+                } else if let Some(git) = spec.get("git").and_then(|g| g.as_str()) {
+                    DependencySource::Git(git.to_string())
+                } else {
+                    DependencySource::Registry
+                };
+                (version, source)
+            }
+            _ => (None, DependencySource::Registry),
+        };
+
+        result.push(ComponentDependency {
+            name: name.to_string(),
+            version,
+            source,
+            manifest: manifest.to_path_buf(),
+        });
+    }
+
+    Ok(result)
+}
+
+/// All dependencies declared by the project's manifests
+pub fn collect_component_dependencies(project_dir: &Path) -> Result<Vec<ComponentDependency>> {
+    let mut dependencies = Vec::new();
+    for manifest in find_component_manifests(project_dir) {
+        dependencies.extend(parse_component_manifest(&manifest)?);
+    }
+    Ok(dependencies)
+}
+
+/// Check whether `dependencies.lock` and `managed_components/` already satisfy the manifests.
+///
+/// The lock must be newer than every manifest and list every remote dependency,
+/// otherwise the component manager would resolve (and download) again.
+pub fn dependencies_resolved(project_dir: &Path, dependencies: &[ComponentDependency]) -> bool {
+    let remote: Vec<&ComponentDependency> = dependencies.iter().filter(|d| d.is_remote()).collect();
+    if remote.is_empty() {
+        return true;
+    }
+
+    let lock_path = project_dir.join(DEPENDENCIES_LOCK_FILE);
+    if !project_dir.join(MANAGED_COMPONENTS_DIR).is_dir() {
+        return false;
+    }
+
+    let Some(lock_modified) = modified(&lock_path) else {
+        return false;
+    };
+    if dependencies
+        .iter()
+        .filter_map(|d| modified(&d.manifest))
+        .any(|manifest_modified| manifest_modified > lock_modified)
+    {
+        return false;
+    }
+
+    let Ok(content) = std::fs::read_to_string(&lock_path) else {
+        return false;
+    };
+    let Ok(lock) = serde_yaml::from_str::<serde_yaml::Value>(&content) else {
+        return false;
+    };
+    let Some(locked) = lock.get("dependencies").and_then(|d| d.as_mapping()) else {
+        return false;
+    };
+
+    remote.iter().all(|dependency| {
+        locked.contains_key(dependency.lock_name().as_str())
+            || locked.contains_key(dependency.name.as_str())
+    })
+}
+
+fn modified(path: &Path) -> Option<SystemTime> {
+    std::fs::metadata(path).and_then(|m| m.modified()).ok()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::fs;
+    use tempfile::TempDir;
+
+    #[test]
+    fn test_idf_component_dependencies() {
+        let temp_dir = TempDir::new().unwrap();
+        let project = temp_dir.path();
+        fs::create_dir_all(project.join("main")).unwrap();
+        fs::create_dir_all(project.join("components/display")).unwrap();
+        fs::write(
+            project.join("main/idf_component.yml"),
+            "dependencies:\n  idf: \">=5.1\"\n  led_strip: \"^2.5\"\n  display:\n    path: ../components/display\n",
+        )
+        .unwrap();
+        fs::write(
+            project.join("components/display/idf_component.yml"),
+            "dependencies:\n  lvgl/lvgl:\n    version: \"~9.2\"\n  esp_lcd_touch:\n    git: https://github.com/espressif/esp-bsp.git\n",
+        )
+        .unwrap();
+
+        let dependencies = collect_component_dependencies(project).unwrap();
+        let names: Vec<&str> = dependencies.iter().map(|d| d.name.as_str()).collect();
+        assert_eq!(
+            names,
+            vec!["led_strip", "display", "lvgl/lvgl", "esp_lcd_touch"]
+        );
+        assert_eq!(dependencies[0].lock_name(), "espressif/led_strip");
+        assert!(matches!(dependencies[1].source, DependencySource::Local(_)));
+        assert_eq!(dependencies[2].version.as_deref(), Some("~9.2"));
+        assert!(matches!(dependencies[3].source, DependencySource::Git(_)));
+        assert_eq!(dependencies.iter().filter(|d| d.is_remote()).count(), 3);
+
+        // Nothing resolved yet
+        assert!(!dependencies_resolved(project, &dependencies));
+
+        // A lock missing one of the remote dependencies still needs resolution
+        fs::create_dir_all(project.join("managed_components")).unwrap();
+        fs::write(
+            project.join("dependencies.lock"),
+            "dependencies:\n  espressif/led_strip:\n    version: 2.5.5\n  lvgl/lvgl:\n    version: 9.2.2\n",
+        )
+        .unwrap();
+        assert!(!dependencies_resolved(project, &dependencies));
+
+        fs::write(
+            project.join("dependencies.lock"),
+            "dependencies:\n  espressif/led_strip:\n    version: 2.5.5\n  lvgl/lvgl:\n    version: 9.2.2\n  esp_lcd_touch:\n    version: 1.1.2\n",
+        )
+        .unwrap();
+        assert!(dependencies_resolved(project, &dependencies));
+    }
+}
@@ -8,6 +8,7 @@
 //! - Fallback to traditional idf.py when needed
 
 use crate::models::AppEvent;
+use crate::utils::process_group;
 use anyhow::{Context, Result};
 use log::{debug, error, info};
 use std::collections::HashMap;
@@ -374,7 +375,8 @@ impl IdfNativeHandler {
             .envs(env_vars)
             .env("PYTHONUNBUFFERED", "1") // For Python idf.py fallback
             .stdout(std::process::Stdio::piped())
-            .stderr(std::process::Stdio::piped());
+            .stderr(std::process::Stdio::piped())
+            .kill_on_drop(true); // e.g. a monitor cancelled by watch mode
 
         if verbose {
             debug!("Running command: {} {}", idf_command, args.join(" "));
@@ -386,7 +388,7 @@ impl IdfNativeHandler {
             }
         }
 
-        let mut child = cmd.spawn().context("Failed to start command")?;
+        let mut child = process_group::spawn(&mut cmd).context("Failed to start command")?;
         let stdout = child.stdout.take().unwrap();
         let stderr = child.stderr.take().unwrap();
 
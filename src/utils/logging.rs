@@ -1,15 +1,26 @@
 //! Logging utilities and initialization for ESPBrew
 
 use anyhow::Result;
-use env_logger::{Builder, Target};
-use log::LevelFilter;
+use env_logger::{Builder, Target, WriteStyle};
+use log::{Level, LevelFilter};
 use std::io::Write;
+use std::sync::atomic::{AtomicBool, Ordering};
 use tokio::sync::mpsc;
 
 use crate::models::AppEvent;
 
-/// Initialize logging for ESPBrew CLI
-pub fn init_cli_logging(verbose: u8, quiet: bool, tui_mode: bool) -> Result<()> {
+/// Whether the CLI writes plain text, set by `--plain`
+static PLAIN_OUTPUT: AtomicBool = AtomicBool::new(false);
+
+/// Whether output is plain sequential text: no colors, emoji, hyperlinks or
+/// redraws, for screen readers, dumb terminals and pipes
+pub fn is_plain_output() -> bool {
+    PLAIN_OUTPUT.load(Ordering::Relaxed)
+}
+
+/// Initialize logging for ESPBrew CLI; `plain` logs sequential lines with a
+/// level prefix, without colors, timestamps or emoji
+pub fn init_cli_logging(verbose: u8, quiet: bool, tui_mode: bool, plain: bool) -> Result<()> {
     let level = match (quiet, verbose) {
         (true, _) => LevelFilter::Error,
         (false, 0) => LevelFilter::Info,
@@ -17,9 +28,24 @@ pub fn init_cli_logging(verbose: u8, quiet: bool, tui_mode: bool) -> Result<()>
         (false, _) => LevelFilter::Trace,
     };
 
+    PLAIN_OUTPUT.store(plain, Ordering::Relaxed);
     if tui_mode {
         // File logging only for TUI mode to avoid terminal interference
         init_file_logger(level)?;
+    } else if plain {
+        Builder::from_default_env()
+            .target(Target::Stderr)
+            .filter_level(level)
+            .write_style(WriteStyle::Never)
+            .format(|buf, record| {
+                writeln!(
+                    buf,
+                    "{}: {}",
+                    plain_level(record.level()),
+                    plain_text(&record.args().to_string())
+                )
+            })
+            .init();
     } else {
         // Stderr logging for CLI mode
         Builder::from_default_env()
@@ -38,6 +64,73 @@ pub fn init_cli_logging(verbose: u8, quiet: bool, tui_mode: bool) -> Result<()>
     Ok(())
 }
 
+/// Prefix of a plain log line
+fn plain_level(level: Level) -> &'static str {
+    match level {
+        Level::Error => "error",
+        Level::Warn => "warning",
+        Level::Info => "info",
+        Level::Debug => "debug",
+        Level::Trace => "trace",
+    }
+}
+
+fn is_pictograph(c: char) -> bool {
+    matches!(
+        u32::from(c),
+        0x2300..=0x23FF       // ⌛ ⏳ ⏭
+            | 0x2600..=0x27BF // ⚠ ⚙ ✅ ❌
+            | 0x2B00..=0x2BFF // ⬆ ⭐
+            | 0x1F000..=0x1FAFF
+            | 0xFE0E..=0xFE0F // variation selectors
+            | 0x200D          // zero width joiner
+    )
+}
+
+/// The text without ANSI escape sequences (colors and OSC 8 hyperlinks) and
+/// emoji, which screen readers spell out; the space after a leading emoji
+/// goes with it
+pub fn plain_text(text: &str) -> String {
+    let mut plain = String::with_capacity(text.len());
+    let mut chars = text.chars().peekable();
+    while let Some(c) = chars.next() {
+        if c == '\x1b' {
+            match chars.next() {
+                // CSI: parameters up to a final letter
+                Some('[') => {
+                    for c in chars.by_ref() {
+                        if c.is_ascii_alphabetic() || c == '~' {
+                            break;
+                        }
+                    }
+                }
+                // OSC: up to BEL or ESC \
+                Some(']') => {
+                    while let Some(c) = chars.next() {
+                        if c == '\x07' {
+                            break;
+                        }
+                        if c == '\x1b' {
+                            chars.next_if_eq(&'\\');
+                            break;
+                        }
+                    }
+                }
+                _ => {}
+            }
+        } else if !is_pictograph(c) {
+            plain.push(c);
+        }
+    }
+
+    let leading_emoji = text.trim_start().chars().next().is_some_and(is_pictograph);
+    if leading_emoji {
+        plain.trim_start().to_string()
+    } else {
+        plain
+    }
+}
+
 /// Initialize logging for ESPBrew server
 pub fn init_server_logging(
     structured: bool,
@@ -274,4 +367,24 @@ mod tests {
         };
         assert_eq!(level, LevelFilter::Trace);
     }
+
+    #[test]
+    fn test_plain_output_text() {
+        // Leading emoji go with their space, colors and hyperlinks with their text kept
+        assert_eq!(plain_text("⚠️  Tool check failed"), "Tool check failed");
+        assert_eq!(
+            plain_text("🔨 ESPBrew Build Command"),
+            "ESPBrew Build Command"
+        );
+        assert_eq!(
+            plain_text("[esp32c3] \x1b[1;31merror:\x1b[0m 'x' undeclared"),
+            "[esp32c3] error: 'x' undeclared"
+        );
+        assert_eq!(
+            plain_text("from \x1b]8;;file:///work/app.c\x1b\\../app.c:2\x1b]8;;\x1b\\:"),
+            "from ../app.c:2:"
+        );
+        assert_eq!(plain_text("  - box (esp32s3)"), "  - box (esp32s3)");
+        assert_eq!(plain_text("ok ✅ done"), "ok  done");
+    }
 }
@@ -1,9 +1,19 @@
 //! Utility functions and helpers used throughout ESPBrew
 
+pub mod backtrace;
 pub mod build_utils;
+pub mod compiler_cache;
+pub mod defmt;
+pub mod diagnostics;
 pub mod esp_idf_utils;
 pub mod espflash_utils;
 pub mod file_utils;
+pub mod firmware_size;
+pub mod idf_components;
 pub mod idf_native;
 pub mod logging;
+pub mod native_usb;
+pub mod partition_table;
+pub mod process_group;
+pub mod serial_tcp;
 pub mod serial_utils;
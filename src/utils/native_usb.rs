@@ -0,0 +1,242 @@
+//! Built-in USB interfaces of the ESP32-S2, S3, C3, C6, H2 and P4
+//!
+//! Chips with a USB-Serial-JTAG controller show up as Espressif `303a:1001`
+//! without a UART bridge, and the USB-OTG controller of the S2 and S3
+//! enumerates as a ROM CDC or DFU device. Both are reset through the USB
+//! controller instead of the DTR/RTS lines of a bridge, and their port goes
+//! away while the chip resets, possibly coming back under another name.
+
+use anyhow::Result;
+use espflash::connection::{ResetAfterOperation, ResetBeforeOperation};
+use serialport::{SerialPortInfo, SerialPortType, UsbPortInfo};
+use std::time::{Duration, Instant};
+
+pub const ESPRESSIF_VID: u16 = 0x303a;
+pub const USB_SERIAL_JTAG_PID: u16 = 0x1001;
+
+/// How long a native USB device may take to come back after a reset
+pub const REENUMERATION_TIMEOUT: Duration = Duration::from_secs(10);
+/// How long a monitor waits for a device whose port went away, e.g. on a
+/// reset of a native USB device or a replugged cable
+pub const RECONNECT_TIMEOUT: Duration = Duration::from_secs(60);
+/// Time for a port that went away to be gone from the list of ports
+const SETTLE_DELAY: Duration = Duration::from_millis(500);
+const POLL_INTERVAL: Duration = Duration::from_millis(200);
+
+/// USB vendor ids of the UART bridges found on devkits: Silicon Labs
+/// CP210x, WCH CH34x, FTDI and Prolific
+const UART_BRIDGE_VIDS: &[u16] = &[0x10c4, 0x1a86, 0x0403, 0x067b];
+
+/// The interface a serial port reaches the chip through
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum UsbInterface {
+    /// The USB-Serial-JTAG controller of the S3, C3, C6, H2 and later chips
+    UsbSerialJtag,
+    /// The USB-OTG controller of the S2 and S3 in ROM download mode
+    UsbOtg,
+    /// An external USB to UART bridge
+    UartBridge,
+    /// Not a USB port, or an adapter espbrew doesn't know
+    Unknown,
+}
+
+impl UsbInterface {
+    pub fn from_ids(vid: u16, pid: u16) -> Self {
+        match (vid, pid) {
+            (ESPRESSIF_VID, USB_SERIAL_JTAG_PID) => UsbInterface::UsbSerialJtag,
+            (ESPRESSIF_VID, _) => UsbInterface::UsbOtg,
+            (vid, _) if UART_BRIDGE_VIDS.contains(&vid) => UsbInterface::UartBridge,
+            _ => UsbInterface::Unknown,
+        }
+    }
+
+    pub fn of_port(port_type: &SerialPortType) -> Self {
+        match port_type {
+            SerialPortType::UsbPort(usb) => Self::from_ids(usb.vid, usb.pid),
+            _ => UsbInterface::Unknown,
+        }
+    }
+
+    /// Whether the port belongs to the chip itself rather than a bridge
+    pub fn is_native(&self) -> bool {
+        matches!(self, UsbInterface::UsbSerialJtag | UsbInterface::UsbOtg)
+    }
+
+    /// Reset into the bootloader before flashing; the native controllers
+    /// have no DTR/RTS wired to EN and IO0
+    pub fn reset_before(&self) -> ResetBeforeOperation {
+        if self.is_native() {
+            ResetBeforeOperation::UsbReset
+        } else {
+            ResetBeforeOperation::DefaultReset
+        }
+    }
+
+    /// Reset after flashing. The RTS reset would drop the USB-OTG port in the
+    /// middle of the operation, so it is reset by the watchdog.
+    pub fn reset_after(&self) -> ResetAfterOperation {
+        match self {
+            UsbInterface::UsbOtg => ResetAfterOperation::WatchdogReset,
+            _ => ResetAfterOperation::HardReset,
+        }
+    }
+
+    pub fn describe(&self) -> &'static str {
+        match self {
+            UsbInterface::UsbSerialJtag => "built-in USB-Serial-JTAG",
+            UsbInterface::UsbOtg => "built-in USB-OTG",
+            UsbInterface::UartBridge => "USB to UART bridge",
+            UsbInterface::Unknown => "serial port",
+        }
+    }
+}
+
+/// USB product id of a chip's ROM DFU device, for chips with USB-OTG
+pub fn dfu_pid(chip: &str) -> Option<u16> {
+    match chip {
+        "esp32s2" => Some(0x0002),
+        "esp32s3" => Some(0x0009),
+        _ => None,
+    }
+}
+
+/// Whether a port is the device with this USB identity; devices without a
+/// serial number are told apart by nothing else
+fn is_device(port_type: &SerialPortType, device: &UsbPortInfo) -> bool {
+    match port_type {
+        SerialPortType::UsbPort(usb) => {
+            usb.vid == device.vid
+                && usb.pid == device.pid
+                && usb.serial_number == device.serial_number
+        }
+        _ => false,
+    }
+}
+
+/// USB identity of the device on `port`, `None` for ports not on USB
+pub fn usb_device(port: &str) -> Option<UsbPortInfo> {
+    serialport::available_ports()
+        .unwrap_or_default()
+        .into_iter()
+        .find(|info| info.port_name == port)
+        .and_then(|info| match info.port_type {
+            SerialPortType::UsbPort(usb) => Some(usb),
+            _ => None,
+        })
+}
+
+/// Port of the device among `ports`. Without a serial number another device
+/// of the same kind could be mistaken for it, so the old name is preferred.
+pub fn matching_port(ports: &[SerialPortInfo], port: &str, device: &UsbPortInfo) -> Option<String> {
+    ports
+        .iter()
+        .filter(|info| is_device(&info.port_type, device))
+        .min_by_key(|info| info.port_name != port)
+        .map(|info| info.port_name.clone())
+}
+
+/// Wait for a device that resets to come back, returning its port, which may
+/// differ from the one it had. A port that is still there after settling is
+/// taken to have come back already.
+pub async fn wait_for_port(port: &str, device: &UsbPortInfo, timeout: Duration) -> Result<String> {
+    wait_for_reconnect(port, device, timeout, || false)
+        .await
+        .ok_or_else(|| {
+            anyhow::anyhow!(
+                "{} didn't come back within {}s after the reset",
+                port,
+                timeout.as_secs()
+            )
+        })
+}
+
+/// Like [`wait_for_port`], but giving up as soon as `cancelled` is true;
+/// `None` then or after `timeout`
+pub async fn wait_for_reconnect(
+    port: &str,
+    device: &UsbPortInfo,
+    timeout: Duration,
+    cancelled: impl Fn() -> bool,
+) -> Option<String> {
+    let started = Instant::now();
+    tokio::time::sleep(SETTLE_DELAY).await;
+
+    loop {
+        if cancelled() {
+            return None;
+        }
+        let ports = serialport::available_ports().unwrap_or_default();
+        if let Some(found) = matching_port(&ports, port, device) {
+            return Some(found);
+        }
+        if started.elapsed() >= timeout {
+            return None;
+        }
+        tokio::time::sleep(POLL_INTERVAL).await;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_native_usb_interfaces() {
+        assert_eq!(
+            UsbInterface::from_ids(0x303a, 0x1001),
+            UsbInterface::UsbSerialJtag
+        );
+        assert_eq!(UsbInterface::from_ids(0x303a, 0x0009), UsbInterface::UsbOtg);
+        assert_eq!(
+            UsbInterface::from_ids(0x10c4, 0xea60),
+            UsbInterface::UartBridge
+        );
+        assert_eq!(
+            UsbInterface::from_ids(0x1234, 0x5678),
+            UsbInterface::Unknown
+        );
+        assert!(UsbInterface::UsbSerialJtag.is_native());
+        assert!(!UsbInterface::UartBridge.is_native());
+
+        assert_eq!(dfu_pid("esp32s3"), Some(0x0009));
+        assert_eq!(dfu_pid("esp32c3"), None);
+    }
+
+    #[test]
+    fn test_matching_port() {
+        let usb = |pid: u16, serial_number: Option<&str>| UsbPortInfo {
+            vid: 0x303a,
+            pid,
+            serial_number: serial_number.map(str::to_string),
+            manufacturer: None,
+            product: None,
+        };
+        let port = |name: &str, device: UsbPortInfo| SerialPortInfo {
+            port_name: name.to_string(),
+            port_type: SerialPortType::UsbPort(device),
+        };
+        let device = usb(0x1001, Some("F4:12:FA:00:11:22"));
+
+        // An S3 coming back under another name after its reset
+        let ports = vec![
+            port("/dev/ttyACM0", usb(0x1001, Some("F4:12:FA:33:44:55"))),
+            port("/dev/ttyACM1", device.clone()),
+        ];
+        assert_eq!(
+            matching_port(&ports, "/dev/ttyACM0", &device).as_deref(),
+            Some("/dev/ttyACM1")
+        );
+        assert_eq!(matching_port(&ports[..1], "/dev/ttyACM0", &device), None);
+
+        // Devices without a serial number keep their old name if it is there
+        let anonymous = usb(0x1001, None);
+        let ports = vec![
+            port("/dev/ttyACM0", anonymous.clone()),
+            port("/dev/ttyACM2", anonymous.clone()),
+        ];
+        assert_eq!(
+            matching_port(&ports, "/dev/ttyACM2", &anonymous).as_deref(),
+            Some("/dev/ttyACM2")
+        );
+    }
+}
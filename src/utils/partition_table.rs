@@ -0,0 +1,366 @@
+//! ESP-IDF partition tables, binary and CSV
+
+use anyhow::{Context, Result};
+use std::path::{Path, PathBuf};
+
+/// Size of a single partition table entry
+const ENTRY_SIZE: usize = 32;
+/// Magic bytes of a partition entry (0xAA50, little endian)
+const ENTRY_MAGIC: [u8; 2] = [0xAA, 0x50];
+/// Magic bytes of the MD5 checksum entry that terminates the table
+const MD5_MAGIC: [u8; 2] = [0xEB, 0xEB];
+/// First offset after the partition table at its default location (0x8000)
+const FIRST_PARTITION_OFFSET: u32 = 0x9000;
+/// Alignment of application partitions
+const APP_ALIGNMENT: u32 = 0x10000;
+/// Alignment of data partitions
+const DATA_ALIGNMENT: u32 = 0x1000;
+/// Flash size ESP-IDF assumes when none is configured
+pub const DEFAULT_FLASH_SIZE: u32 = 2 * 1024 * 1024;
+
+/// Data partition subtypes by name
+const DATA_SUBTYPES: &[(&str, u8)] = &[
+    ("ota", 0x00),
+    ("phy", 0x01),
+    ("nvs", 0x02),
+    ("coredump", 0x03),
+    ("nvs_keys", 0x04),
+    ("efuse", 0x05),
+    ("undefined", 0x06),
+    ("esphttpd", 0x80),
+    ("fat", 0x81),
+    ("spiffs", 0x82),
+    ("littlefs", 0x83),
+];
+
+/// A single entry of an ESP-IDF partition table
+#[derive(Debug, Clone, PartialEq)]
+pub struct PartitionEntry {
+    pub label: String,
+    pub partition_type: u8,
+    pub subtype: u8,
+    pub offset: u32,
+    pub size: u32,
+}
+
+impl PartitionEntry {
+    /// Whether this is an application partition (factory, ota_N, test)
+    pub fn is_app(&self) -> bool {
+        self.partition_type == 0x00
+    }
+
+    /// First byte after the partition
+    pub fn end(&self) -> u32 {
+        self.offset.saturating_add(self.size)
+    }
+
+    /// Type as written in a partition CSV
+    pub fn type_name(&self) -> String {
+        match self.partition_type {
+            0x00 => "app".to_string(),
+            0x01 => "data".to_string(),
+            other => format!("0x{:02x}", other),
+        }
+    }
+
+    /// Subtype as written in a partition CSV
+    pub fn subtype_name(&self) -> String {
+        let name = match (self.partition_type, self.subtype) {
+            (0x00, 0x00) => Some("factory".to_string()),
+            (0x00, 0x20) => Some("test".to_string()),
+            (0x00, subtype @ 0x10..=0x1F) => Some(format!("ota_{}", subtype - 0x10)),
+            (0x01, subtype) => DATA_SUBTYPES
+                .iter()
+                .find(|(_, value)| *value == subtype)
+                .map(|(name, _)| name.to_string()),
+            _ => None,
+        };
+        name.unwrap_or_else(|| format!("0x{:02x}", self.subtype))
+    }
+}
+
+/// Parse a binary partition table as generated into `build/partition_table/partition-table.bin`
+pub fn parse_partition_table(data: &[u8]) -> Result<Vec<PartitionEntry>> {
+    let mut entries = Vec::new();
+
+    for chunk in data.chunks_exact(ENTRY_SIZE) {
+        if chunk[0..2] == MD5_MAGIC || chunk.iter().all(|b| *b == 0xFF) {
+            break;
+        }
+        if chunk[0..2] != ENTRY_MAGIC {
+            return Err(anyhow::anyhow!(
+                "Invalid partition table entry magic: {:02x}{:02x}",
+                chunk[0],
+                chunk[1]
+            ));
+        }
+
+        let label_bytes = &chunk[12..28];
+        let label_len = label_bytes
+            .iter()
+            .position(|b| *b == 0)
+            .unwrap_or(label_bytes.len());
+
+        entries.push(PartitionEntry {
+            label: String::from_utf8_lossy(&label_bytes[..label_len]).to_string(),
+            partition_type: chunk[2],
+            subtype: chunk[3],
+            offset: u32::from_le_bytes([chunk[4], chunk[5], chunk[6], chunk[7]]),
+            size: u32::from_le_bytes([chunk[8], chunk[9], chunk[10], chunk[11]]),
+        });
+    }
+
+    if entries.is_empty() {
+        return Err(anyhow::anyhow!("Partition table contains no entries"));
+    }
+
+    Ok(entries)
+}
+
+/// Read and parse the partition table of an ESP-IDF build directory
+pub fn read_build_partition_table(build_dir: &Path) -> Result<Vec<PartitionEntry>> {
+    let path = build_dir
+        .join("partition_table")
+        .join("partition-table.bin");
+    let data = std::fs::read(&path)
+        .with_context(|| format!("Failed to read partition table {}", path.display()))?;
+    parse_partition_table(&data)
+}
+
+/// Parse a partition CSV as accepted by ESP-IDF's `gen_esp32part.py`.
+///
+/// Empty offsets follow the previous partition, aligned to 64 KiB for
+/// application partitions and 4 KiB for data partitions.
+pub fn parse_partition_csv(content: &str) -> Result<Vec<PartitionEntry>> {
+    let mut entries: Vec<PartitionEntry> = Vec::new();
+    let mut next_offset = FIRST_PARTITION_OFFSET;
+
+    for (index, line) in content.lines().enumerate() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with('#') {
+            continue;
+        }
+        let line_error = |message: String| anyhow::anyhow!("Line {}: {}", index + 1, message);
+
+        let fields: Vec<&str> = line.split(',').map(str::trim).collect();
+        if fields.len() < 5 {
+            return Err(line_error(format!(
+                "expected name, type, subtype, offset, size in '{}'",
+                line
+            )));
+        }
+
+        let partition_type = match fields[1] {
+            "app" => 0x00,
+            "data" => 0x01,
+            other => parse_number(other)
+                .and_then(|value| u8::try_from(value).ok())
+                .ok_or_else(|| line_error(format!("unknown partition type '{}'", other)))?,
+        };
+        let subtype = parse_subtype(partition_type, fields[2])
+            .ok_or_else(|| line_error(format!("unknown partition subtype '{}'", fields[2])))?;
+        let alignment = if partition_type == 0x00 {
+            APP_ALIGNMENT
+        } else {
+            DATA_ALIGNMENT
+        };
+
+        let offset = if fields[3].is_empty() {
+            next_offset.div_ceil(alignment) * alignment
+        } else {
+            parse_number(fields[3])
+                .ok_or_else(|| line_error(format!("invalid offset '{}'", fields[3])))?
+        };
+        let size = parse_number(fields[4])
+            .ok_or_else(|| line_error(format!("invalid size '{}'", fields[4])))?;
+
+        let entry = PartitionEntry {
+            label: fields[0].to_string(),
+            partition_type,
+            subtype,
+            offset,
+            size,
+        };
+        next_offset = entry.end();
+        entries.push(entry);
+    }
+
+    if entries.is_empty() {
+        return Err(anyhow::anyhow!("Partition table contains no entries"));
+    }
+
+    Ok(entries)
+}
+
+/// Read and parse a partition CSV file
+pub fn read_partition_csv(path: &Path) -> Result<Vec<PartitionEntry>> {
+    let content = std::fs::read_to_string(path)
+        .with_context(|| format!("Failed to read partition table {}", path.display()))?;
+    parse_partition_csv(&content).with_context(|| format!("Invalid {}", path.display()))
+}
+
+/// Flash size in bytes of an esptool size like `4MB`
+pub fn flash_size_bytes(size: &str) -> Option<u32> {
+    let size = size.trim().to_uppercase();
+    let megabytes: u32 = size
+        .strip_suffix("MB")
+        .or_else(|| size.strip_suffix('M'))
+        .unwrap_or(&size)
+        .parse()
+        .ok()?;
+    megabytes.checked_mul(1024 * 1024)
+}
+
+/// Partition layout of a board: its CSV, the parsed entries and the flash they must fit
+#[derive(Debug, Clone)]
+pub struct PartitionLayout {
+    pub csv: PathBuf,
+    pub entries: Vec<PartitionEntry>,
+    pub flash_size: u32,
+}
+
+impl PartitionLayout {
+    /// Problems ESP-IDF would reject or that break flashing, empty for a valid layout
+    pub fn problems(&self) -> Vec<String> {
+        let mut problems = Vec::new();
+
+        for (index, entry) in self.entries.iter().enumerate() {
+            if self.entries[..index].iter().any(|e| e.label == entry.label) {
+                problems.push(format!("Duplicate partition name '{}'", entry.label));
+            }
+            if entry.offset < FIRST_PARTITION_OFFSET {
+                problems.push(format!(
+                    "'{}' at 0x{:x} overlaps the bootloader or partition table",
+                    entry.label, entry.offset
+                ));
+            }
+            if entry.is_app() && entry.offset % APP_ALIGNMENT != 0 {
+                problems.push(format!(
+                    "App partition '{}' at 0x{:x} is not aligned to 0x{:x}",
+                    entry.label, entry.offset, APP_ALIGNMENT
+                ));
+            }
+            if entry.end() > self.flash_size {
+                problems.push(format!(
+                    "'{}' ends at 0x{:x}, beyond the {} flash",
+                    entry.label,
+                    entry.end(),
+                    format_size(self.flash_size)
+                ));
+            }
+            for other in &self.entries[..index] {
+                if entry.offset < other.end() && other.offset < entry.end() {
+                    problems.push(format!("'{}' overlaps '{}'", entry.label, other.label));
+                }
+            }
+        }
+
+        problems
+    }
+
+    /// Table of the partitions followed by the validation result, for the TUI and the CLI
+    pub fn report_lines(&self) -> Vec<String> {
+        let mut lines = vec![
+            format!(
+                "🗂️  Partition table {} ({} flash)",
+                self.csv.display(),
+                format_size(self.flash_size)
+            ),
+            format!(
+                "{:<16} {:<5} {:<10} {:>10} {:>10}",
+                "Name", "Type", "SubType", "Offset", "Size"
+            ),
+        ];
+        for entry in &self.entries {
+            lines.push(format!(
+                "{:<16} {:<5} {:<10} {:>10} {:>10}",
+                entry.label,
+                entry.type_name(),
+                entry.subtype_name(),
+                format!("0x{:x}", entry.offset),
+                format_size(entry.size)
+            ));
+        }
+
+        let used = self.entries.iter().map(|e| e.end()).max().unwrap_or(0);
+        let problems = self.problems();
+        if problems.is_empty() {
+            lines.push(format!(
+                "✅ {} partition(s), {} of {} flash used",
+                self.entries.len(),
+                format_size(used),
+                format_size(self.flash_size)
+            ));
+        } else {
+            lines.extend(problems.iter().map(|problem| format!("❌ {}", problem)));
+        }
+        lines
+    }
+}
+
+/// Size in the largest whole unit, e.g. `1M`, `24K` or `0x1800`
+fn format_size(size: u32) -> String {
+    if size >= 1024 * 1024 && size % (1024 * 1024) == 0 {
+        format!("{}M", size / (1024 * 1024))
+    } else if size >= 1024 && size % 1024 == 0 {
+        format!("{}K", size / 1024)
+    } else {
+        format!("0x{:x}", size)
+    }
+}
+
+/// A CSV number: decimal or `0x` hex, optionally with a `K` or `M` suffix
+fn parse_number(value: &str) -> Option<u32> {
+    let value = value.trim();
+    let (digits, multiplier) = match value.chars().last()? {
+        'k' | 'K' => (&value[..value.len() - 1], 1024),
+        'm' | 'M' => (&value[..value.len() - 1], 1024 * 1024),
+        _ => (value, 1),
+    };
+    let number = match digits
+        .strip_prefix("0x")
+        .or_else(|| digits.strip_prefix("0X"))
+    {
+        Some(hex) => u32::from_str_radix(hex, 16).ok()?,
+        None => digits.parse().ok()?,
+    };
+    number.checked_mul(multiplier)
+}
+
+/// Subtype number of a CSV subtype name or number
+fn parse_subtype(partition_type: u8, value: &str) -> Option<u8> {
+    let named = match partition_type {
+        0x00 => match value {
+            "factory" => Some(0x00),
+            "test" => Some(0x20),
+            _ => value
+                .strip_prefix("ota_")
+                .and_then(|n| n.parse::<u8>().ok())
+                .filter(|n| *n < 16)
+                .map(|n| 0x10 + n),
+        },
+        0x01 => DATA_SUBTYPES
+            .iter()
+            .find(|(name, _)| *name == value)
+            .map(|(_, subtype)| *subtype),
+        _ => None,
+    };
+    named.or_else(|| parse_number(value).and_then(|n| u8::try_from(n).ok()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_partition_csv() {
+        let csv = "# Name, Type, SubType, Offset, Size, Flags\nnvs, data, nvs, , 24K\nphy_init, data, phy, , 4K\nfactory, app, factory, , 3M\nstorage, data, spiffs, , 1M\n";
+
+        // Empty offsets follow the previous partition with ESP-IDF's alignment
+        let entries = parse_partition_csv(csv).unwrap();
+        let offsets: Vec<u32> = entries.iter().map(|e| e.offset).collect();
+        assert_eq!(offsets, vec![0x9000, 0xf000, 0x10000, 0x310000]);
+        assert_eq!(entries[3].subtype_name(), "spiffs");
+        assert!(parse_partition_csv("nvs, data, bogus, , 4K\n").is_err());
+    }
+}
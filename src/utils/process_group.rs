@@ -0,0 +1,203 @@
+//! Process groups of board actions, so one board can be cancelled on its own
+//!
+//! A build starts a tool such as idf.py, which starts cmake, ninja and a
+//! compiler per source file. Commands spawned through [`spawn`] while a
+//! [`BoardJob`] is running lead a process group of their own, and cancelling
+//! the job terminates those groups together with every process they started.
+//! Outside a job, e.g. in CLI commands, [`spawn`] is a plain spawn.
+//!
+//! A group leaves its job once its leader is reaped, so cancelling never
+//! signals a pid the system has handed to another process since.
+
+use std::future::Future;
+use std::ops::{Deref, DerefMut};
+use std::process::{Output, Stdio};
+use std::sync::{Arc, Mutex};
+use tokio::io::AsyncReadExt;
+use tokio::process::{Child, Command};
+
+tokio::task_local! {
+    static CURRENT_JOB: BoardJob;
+}
+
+/// Commands started by one board action
+#[derive(Debug, Clone, Default)]
+pub struct BoardJob {
+    groups: Arc<Mutex<Vec<u32>>>,
+}
+
+impl BoardJob {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Run `future` with the commands it spawns belonging to this job
+    pub async fn scope<F: Future>(self, future: F) -> F::Output {
+        CURRENT_JOB.scope(self, future).await
+    }
+
+    /// Terminate the process groups started by the job, returning how many
+    /// were signalled
+    pub fn terminate(&self) -> usize {
+        let groups = std::mem::take(&mut *self.groups.lock().unwrap());
+        for &group in &groups {
+            terminate_group(group);
+        }
+        groups.len()
+    }
+}
+
+/// A command started by [`spawn`], used like the [`Child`] it wraps
+#[derive(Debug)]
+pub struct GroupChild {
+    child: Child,
+    group: Option<(BoardJob, u32)>,
+}
+
+impl Deref for GroupChild {
+    type Target = Child;
+
+    fn deref(&self) -> &Child {
+        &self.child
+    }
+}
+
+impl DerefMut for GroupChild {
+    fn deref_mut(&mut self) -> &mut Child {
+        &mut self.child
+    }
+}
+
+impl Drop for GroupChild {
+    fn drop(&mut self) {
+        // A leader still running stays cancellable, a reaped one's pid is
+        // free for reuse and must not be signalled any more
+        if matches!(self.child.try_wait(), Ok(None)) {
+            return;
+        }
+        if let Some((job, pid)) = self.group.take() {
+            job.groups.lock().unwrap().retain(|&group| group != pid);
+        }
+    }
+}
+
+/// Spawn `cmd`, as the leader of a new process group when running inside a
+/// [`BoardJob`]
+pub fn spawn(cmd: &mut Command) -> std::io::Result<GroupChild> {
+    let job = CURRENT_JOB.try_with(|job| job.clone()).ok();
+    if job.is_some() {
+        // A background group must not read the terminal the TUI owns
+        cmd.stdin(Stdio::null());
+        #[cfg(unix)]
+        cmd.process_group(0);
+    }
+
+    let child = cmd.spawn()?;
+    let group = match (job, child.id()) {
+        (Some(job), Some(pid)) => {
+            job.groups.lock().unwrap().push(pid);
+            Some((job, pid))
+        }
+        _ => None,
+    };
+    Ok(GroupChild { child, group })
+}
+
+/// Run `cmd` to completion through [`spawn`] and collect its output, like
+/// [`Command::output`] but cancellable with the job
+pub async fn output(cmd: &mut Command) -> std::io::Result<Output> {
+    cmd.stdin(Stdio::null())
+        .stdout(Stdio::piped())
+        .stderr(Stdio::piped());
+    let mut child = spawn(cmd)?;
+    let mut stdout = child.stdout.take().unwrap();
+    let mut stderr = child.stderr.take().unwrap();
+
+    let (mut out, mut err) = (Vec::new(), Vec::new());
+    let (status, read_out, read_err) = tokio::join!(
+        child.wait(),
+        stdout.read_to_end(&mut out),
+        stderr.read_to_end(&mut err)
+    );
+    read_out?;
+    read_err?;
+    Ok(Output {
+        status: status?,
+        stdout: out,
+        stderr: err,
+    })
+}
+
+#[cfg(unix)]
+fn terminate_group(group: u32) {
+    // The negative pid addresses the whole group
+    let _ = std::process::Command::new("kill")
+        .args(["-TERM", "--", &format!("-{}", group)])
+        .stderr(Stdio::null())
+        .status();
+}
+
+#[cfg(windows)]
+fn terminate_group(group: u32) {
+    // Windows has no process groups to signal, /T ends the process tree
+    let _ = std::process::Command::new("taskkill")
+        .args(["/T", "/F", "/PID", &group.to_string()])
+        .stdout(Stdio::null())
+        .stderr(Stdio::null())
+        .status();
+}
+
+#[cfg(all(test, unix))]
+mod tests {
+    use super::*;
+    use std::time::Duration;
+
+    #[tokio::test]
+    async fn test_terminate_process_group() {
+        // Outside a job commands are spawned as usual and nothing is tracked
+        let mut plain = spawn(&mut Command::new("true")).unwrap();
+        assert!(plain.wait().await.unwrap().success());
+
+        let job = BoardJob::new();
+        let mut child = job
+            .clone()
+            .scope(async {
+                // The shell waits on a grandchild, like idf.py on ninja
+                let mut cmd = Command::new("sh");
+                cmd.args(["-c", "sleep 30 & wait"]);
+                spawn(&mut cmd).unwrap()
+            })
+            .await;
+
+        assert_eq!(job.terminate(), 1);
+        let status = tokio::time::timeout(Duration::from_secs(5), child.wait())
+            .await
+            .expect("the process group should be terminated")
+            .unwrap();
+        assert!(!status.success());
+        assert_eq!(job.terminate(), 0);
+    }
+
+    #[tokio::test]
+    async fn test_reaped_groups_leave_the_job() {
+        let job = BoardJob::new();
+        let output = job
+            .clone()
+            .scope(async {
+                let mut configure = Command::new("sh");
+                configure.args(["-c", "echo configured; echo warning >&2"]);
+                let output = output(&mut configure).await.unwrap();
+
+                let mut build = spawn(&mut Command::new("true")).unwrap();
+                build.wait().await.unwrap();
+                drop(build);
+                output
+            })
+            .await;
+
+        assert!(output.status.success());
+        assert_eq!(output.stdout, b"configured\n");
+        assert_eq!(output.stderr, b"warning\n");
+        assert_eq!(job.terminate(), 0);
+    }
+}
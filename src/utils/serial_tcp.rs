@@ -0,0 +1,279 @@
+//! Serial ports reached over TCP, e.g. devices on a test rack behind ser2net
+//!
+//! A port can be given as `rfc2217://host:4001`, ser2net's `telnet(rfc2217)`
+//! mode with baud rate and DTR/RTS control, or as `socket://host:4001` for a
+//! raw TCP connection, like pyserial's URLs. esptool and `idf.py monitor`
+//! open these URLs themselves. espbrew's monitor speaks both protocols, and
+//! its built-in flasher leaves such ports to esptool.
+
+use anyhow::{Context, Result};
+use std::time::Duration;
+use tokio::io::{AsyncReadExt, AsyncWriteExt};
+use tokio::net::TcpStream;
+
+const IAC: u8 = 255;
+const DONT: u8 = 254;
+const DO: u8 = 253;
+const WONT: u8 = 252;
+const WILL: u8 = 251;
+const SB: u8 = 250;
+const SE: u8 = 240;
+/// Telnet option of RFC 2217
+const COM_PORT_OPTION: u8 = 44;
+const SET_BAUDRATE: u8 = 1;
+const SET_CONTROL: u8 = 5;
+const DTR_OFF: u8 = 9;
+const RTS_ON: u8 = 11;
+const RTS_OFF: u8 = 12;
+
+const CONNECT_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// Whether a port is a serial-over-TCP URL rather than a local device
+pub fn is_network_port(port: &str) -> bool {
+    port.starts_with("rfc2217://") || port.starts_with("socket://")
+}
+
+/// A serial port behind a TCP server
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct NetworkPort {
+    /// `host:port`
+    pub address: String,
+    /// Whether the server speaks RFC 2217 rather than passing raw bytes
+    pub rfc2217: bool,
+}
+
+impl NetworkPort {
+    /// Parse `rfc2217://host:port` or `socket://host:port`; pyserial options
+    /// after a `?` are ignored
+    pub fn parse(port: &str) -> Result<Self> {
+        let (rfc2217, rest) = if let Some(rest) = port.strip_prefix("rfc2217://") {
+            (true, rest)
+        } else if let Some(rest) = port.strip_prefix("socket://") {
+            (false, rest)
+        } else {
+            return Err(anyhow::anyhow!(
+                "{} is not an rfc2217:// or socket:// URL",
+                port
+            ));
+        };
+        let address = rest.split(['?', '/']).next().unwrap_or_default();
+        let valid = address
+            .rsplit_once(':')
+            .is_some_and(|(host, port)| !host.is_empty() && port.parse::<u16>().is_ok());
+        if !valid {
+            return Err(anyhow::anyhow!("{} has no host:port", port));
+        }
+        Ok(Self {
+            address: address.to_string(),
+            rfc2217,
+        })
+    }
+}
+
+/// A COM-PORT-OPTION subnegotiation, with `IAC` bytes of the value doubled
+pub fn rfc2217_command(command: u8, value: &[u8]) -> Vec<u8> {
+    let mut bytes = vec![IAC, SB, COM_PORT_OPTION, command];
+    for &byte in value {
+        bytes.push(byte);
+        if byte == IAC {
+            bytes.push(IAC);
+        }
+    }
+    bytes.extend([IAC, SE]);
+    bytes
+}
+
+/// Separates the data of a telnet stream from its commands
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct TelnetFilter {
+    state: TelnetState,
+}
+
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+enum TelnetState {
+    #[default]
+    Data,
+    Command,
+    Negotiation,
+    Subnegotiation,
+    SubnegotiationIac,
+}
+
+impl TelnetFilter {
+    /// The data bytes of the next chunk; commands split across chunks are handled
+    pub fn feed(&mut self, bytes: &[u8]) -> Vec<u8> {
+        let mut data = Vec::with_capacity(bytes.len());
+        for &byte in bytes {
+            self.state = match (self.state, byte) {
+                (TelnetState::Data, IAC) => TelnetState::Command,
+                (TelnetState::Data, _) => {
+                    data.push(byte);
+                    TelnetState::Data
+                }
+                (TelnetState::Command, IAC) => {
+                    data.push(IAC);
+                    TelnetState::Data
+                }
+                (TelnetState::Command, WILL | WONT | DO | DONT) => TelnetState::Negotiation,
+                (TelnetState::Command, SB) => TelnetState::Subnegotiation,
+                (TelnetState::Command, _) | (TelnetState::Negotiation, _) => TelnetState::Data,
+                (TelnetState::Subnegotiation, IAC) => TelnetState::SubnegotiationIac,
+                (TelnetState::Subnegotiation, _) => TelnetState::Subnegotiation,
+                (TelnetState::SubnegotiationIac, SE) => TelnetState::Data,
+                (TelnetState::SubnegotiationIac, _) => TelnetState::Subnegotiation,
+            };
+        }
+        data
+    }
+}
+
+/// An open serial-over-TCP connection
+#[derive(Debug)]
+pub struct NetworkSerial {
+    stream: TcpStream,
+    port: NetworkPort,
+    filter: TelnetFilter,
+}
+
+impl NetworkSerial {
+    /// Connect, and set the baud rate where the server lets us
+    pub async fn connect(port: &NetworkPort, baud_rate: u32) -> Result<Self> {
+        let stream = tokio::time::timeout(CONNECT_TIMEOUT, TcpStream::connect(&port.address))
+            .await
+            .with_context(|| format!("Timed out connecting to {}", port.address))?
+            .with_context(|| format!("Failed to connect to {}", port.address))?;
+        let mut serial = Self {
+            stream,
+            port: port.clone(),
+            filter: TelnetFilter::default(),
+        };
+        if port.rfc2217 {
+            serial.send(&[IAC, WILL, COM_PORT_OPTION]).await?;
+            serial
+                .send(&rfc2217_command(SET_BAUDRATE, &baud_rate.to_be_bytes()))
+                .await?;
+        }
+        Ok(serial)
+    }
+
+    async fn send(&mut self, bytes: &[u8]) -> Result<()> {
+        self.stream
+            .write_all(bytes)
+            .await
+            .with_context(|| format!("Failed to write to {}", self.port.address))
+    }
+
+    /// Reset the chip through RTS, which devkits wire to EN; raw sockets
+    /// have no control lines
+    pub async fn reset(&mut self) -> Result<()> {
+        if !self.port.rfc2217 {
+            return Err(anyhow::anyhow!(
+                "socket://{} can't reset the device, use rfc2217:// for DTR/RTS control",
+                self.port.address
+            ));
+        }
+        self.send(&rfc2217_command(SET_CONTROL, &[DTR_OFF])).await?;
+        self.send(&rfc2217_command(SET_CONTROL, &[RTS_ON])).await?;
+        tokio::time::sleep(Duration::from_millis(100)).await;
+        self.send(&rfc2217_command(SET_CONTROL, &[RTS_OFF])).await
+    }
+
+    /// Send data to the device; a data byte equal to IAC is doubled on
+    /// RFC 2217 connections, so it isn't taken for a command
+    pub async fn write(&mut self, data: &[u8]) -> Result<()> {
+        if !self.port.rfc2217 {
+            return self.send(data).await;
+        }
+        let mut escaped = Vec::with_capacity(data.len());
+        for &byte in data {
+            escaped.push(byte);
+            if byte == IAC {
+                escaped.push(IAC);
+            }
+        }
+        self.send(&escaped).await
+    }
+
+    /// The next data received, empty once the server closed the connection
+    pub async fn read(&mut self) -> Result<Vec<u8>> {
+        let mut buffer = [0u8; 1024];
+        loop {
+            let read = self
+                .stream
+                .read(&mut buffer)
+                .await
+                .with_context(|| format!("Failed to read from {}", self.port.address))?;
+            if read == 0 {
+                return Ok(Vec::new());
+            }
+            let data = if self.port.rfc2217 {
+                self.filter.feed(&buffer[..read])
+            } else {
+                buffer[..read].to_vec()
+            };
+            if !data.is_empty() {
+                return Ok(data);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_serial_over_tcp() {
+        assert!(is_network_port("rfc2217://rack-host:4001"));
+        assert!(!is_network_port("/dev/ttyUSB0"));
+        assert_eq!(
+            NetworkPort::parse("rfc2217://rack-host:4001?ign_set_control").unwrap(),
+            NetworkPort {
+                address: "rack-host:4001".to_string(),
+                rfc2217: true,
+            }
+        );
+        assert!(
+            !NetworkPort::parse("socket://rack-host:4001")
+                .unwrap()
+                .rfc2217
+        );
+        assert!(NetworkPort::parse("rfc2217://rack-host").is_err());
+        assert!(NetworkPort::parse("/dev/ttyUSB0").is_err());
+
+        // SET-BAUDRATE 115200, and an IAC in a value is doubled
+        assert_eq!(
+            rfc2217_command(1, &115200u32.to_be_bytes()),
+            [255, 250, 44, 1, 0, 1, 194, 0, 255, 240]
+        );
+        assert_eq!(
+            rfc2217_command(5, &[255]),
+            [255, 250, 44, 5, 255, 255, 255, 240]
+        );
+
+        // Negotiations and subnegotiations are dropped, also when split across chunks
+        let mut filter = TelnetFilter::default();
+        assert_eq!(filter.feed(b"boot\xff\xfd\x2c ok\xff\xfa\x2c"), b"boot ok");
+        assert_eq!(filter.feed(b"\x65\x00\xff\xf0!\xff\xff"), b"!\xff");
+
+        // A raw socket passes the bytes through untouched
+        let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let address = listener.local_addr().unwrap();
+        tokio::spawn(async move {
+            let (mut stream, _) = listener.accept().await.unwrap();
+            stream.write_all(b"I (31) boot: ESP-IDF\r\n").await.unwrap();
+        });
+        let port = NetworkPort::parse(&format!("socket://{}", address)).unwrap();
+        let mut serial = NetworkSerial::connect(&port, 115200).await.unwrap();
+        let mut received = Vec::new();
+        loop {
+            let data = serial.read().await.unwrap();
+            if data.is_empty() {
+                break;
+            }
+            received.extend(data);
+        }
+        assert_eq!(received, b"I (31) boot: ESP-IDF\r\n");
+        assert!(serial.reset().await.is_err());
+    }
+}
@@ -0,0 +1,131 @@
+use espbrew::models::ProjectType;
+use espbrew::projects::handlers::arduino::ArduinoHandler;
+use espbrew::projects::registry::ProjectHandler;
+use std::fs;
+use std::path::Path;
+use tempfile::TempDir;
+
+fn write_sketch(project_path: &Path) {
+    fs::write(
+        project_path.join("blink.ino"),
+        "void setup() {}\nvoid loop() {}\n",
+    )
+    .unwrap();
+}
+
+#[tokio::test]
+async fn test_arduino_fqbns_from_espbrew_yaml() {
+    let handler = ArduinoHandler::new();
+    let temp_dir = TempDir::new().unwrap();
+    let project_path = temp_dir.path();
+    write_sketch(project_path);
+
+    fs::write(
+        project_path.join("espbrew.yaml"),
+        r#"arduino:
+  fqbns:
+    - esp32:esp32:esp32s3
+    - name: c6-cdc
+      fqbn: esp32:esp32:esp32c6:CDCOnBoot=cdc
+"#,
+    )
+    .unwrap();
+
+    assert!(handler.can_handle(project_path));
+    assert_eq!(handler.project_type(), ProjectType::Arduino);
+
+    let boards = handler.discover_boards(project_path).unwrap();
+    assert_eq!(boards.len(), 2);
+    assert!(boards[0].name.ends_with("-esp32s3"));
+    assert_eq!(boards[0].target.as_deref(), Some("ESP32-S3"));
+    assert!(boards[1].name.ends_with("-c6-cdc"));
+    assert_eq!(boards[1].target.as_deref(), Some("ESP32-C6"));
+
+    // Every FQBN gets its own build path so parallel builds don't collide
+    assert_ne!(boards[0].build_dir, boards[1].build_dir);
+
+    let build_cmd = handler.get_build_command(project_path, &boards[1]);
+    assert!(build_cmd.contains("arduino-cli compile --fqbn esp32:esp32:esp32c6:CDCOnBoot=cdc"));
+    assert!(build_cmd.contains(&boards[1].build_dir.display().to_string()));
+
+    let flash_cmd = handler.get_flash_command(project_path, &boards[0], Some("/dev/ttyUSB0"));
+    assert!(flash_cmd.contains("arduino-cli upload --fqbn esp32:esp32:esp32s3"));
+    assert!(flash_cmd.contains("--port /dev/ttyUSB0"));
+}
+
+#[tokio::test]
+async fn test_arduino_fqbn_options_name_boards_apart() {
+    let handler = ArduinoHandler::new();
+    let temp_dir = TempDir::new().unwrap();
+    let project_path = temp_dir.path();
+    write_sketch(project_path);
+
+    fs::write(
+        project_path.join("espbrew.yaml"),
+        r#"arduino:
+  fqbns:
+    - esp32:esp32:esp32
+    - esp32:esp32:esp32:PartitionScheme=huge_app,PSRAM=enabled
+"#,
+    )
+    .unwrap();
+    let boards = handler.discover_boards(project_path).unwrap();
+    assert!(boards[0].name.ends_with("-esp32"));
+    assert!(boards[1].name.ends_with("-esp32-huge_app-enabled"));
+    assert_ne!(boards[0].build_dir, boards[1].build_dir);
+
+    // Entries ending up with the same name are refused rather than sharing a build
+    fs::write(
+        project_path.join("espbrew.yaml"),
+        r#"arduino:
+  fqbns:
+    - esp32:esp32:esp32s3
+    - name: esp32s3
+      fqbn: esp32:esp32:esp32s3:CDCOnBoot=cdc
+"#,
+    )
+    .unwrap();
+    let error = handler.discover_boards(project_path).unwrap_err();
+    assert!(error.to_string().contains("named 'esp32s3'"));
+}
+
+#[tokio::test]
+async fn test_arduino_profiles_from_sketch_yaml() {
+    let handler = ArduinoHandler::new();
+    let temp_dir = TempDir::new().unwrap();
+    let project_path = temp_dir.path();
+    write_sketch(project_path);
+
+    fs::write(
+        project_path.join("sketch.yaml"),
+        r#"profiles:
+  xiao_c3:
+    fqbn: esp32:esp32:XIAO_ESP32C3
+    platforms:
+      - platform: esp32:esp32 (3.0.7)
+  devkit:
+    fqbn: esp32:esp32:esp32
+default_profile: devkit
+"#,
+    )
+    .unwrap();
+
+    let boards = handler.discover_boards(project_path).unwrap();
+    let targets: Vec<(String, String)> = boards
+        .iter()
+        .map(|b| {
+            (
+                b.name.rsplit('-').next().unwrap().to_string(),
+                b.target.clone().unwrap(),
+            )
+        })
+        .collect();
+
+    assert_eq!(
+        targets,
+        vec![
+            ("devkit".to_string(), "ESP32".to_string()),
+            ("xiao_c3".to_string(), "ESP32-C3".to_string()),
+        ]
+    );
+}
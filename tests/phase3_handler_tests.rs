@@ -1,6 +1,9 @@
 use espbrew::models::ProjectType;
 use espbrew::projects::handlers::{
-    nuttx::NuttXHandler, tinygo::TinyGoHandler, zephyr::ZephyrHandler,
+    esp8266_rtos::{Esp8266BuildSystem, Esp8266RtosHandler},
+    nuttx::NuttXHandler,
+    tinygo::TinyGoHandler,
+    zephyr::ZephyrHandler,
 };
 use espbrew::projects::registry::ProjectHandler;
 use std::fs;
@@ -99,6 +102,71 @@ async fn test_zephyr_commands() {
     assert!(flash_cmd.contains("--esp-device /dev/ttyUSB0"));
 }
 
+#[tokio::test]
+async fn test_zephyr_west_manifest_detection() {
+    let handler = ZephyrHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    // west.yml manifest without prj.conf
+    fs::write(
+        temp_path.join("CMakeLists.txt"),
+        "find_package(Zephyr REQUIRED HINTS $ENV{ZEPHYR_BASE})",
+    )
+    .unwrap();
+    fs::write(
+        temp_path.join("west.yml"),
+        "manifest:\n  projects:\n    - name: zephyr\n",
+    )
+    .unwrap();
+
+    assert!(handler.can_handle(temp_path));
+}
+
+#[tokio::test]
+async fn test_zephyr_board_overlay_discovery() {
+    let handler = ZephyrHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    fs::write(
+        temp_path.join("CMakeLists.txt"),
+        "find_package(Zephyr REQUIRED HINTS $ENV{ZEPHYR_BASE})",
+    )
+    .unwrap();
+    fs::write(temp_path.join("prj.conf"), "CONFIG_GPIO=y").unwrap();
+
+    let boards_dir = temp_path.join("boards");
+    fs::create_dir_all(&boards_dir).unwrap();
+    fs::write(boards_dir.join("esp32c3_devkitm.overlay"), "/ { };").unwrap();
+    fs::write(boards_dir.join("esp32s3_devkitc.overlay"), "/ { };").unwrap();
+    fs::write(boards_dir.join("esp32s3_devkitc.conf"), "CONFIG_LOG=y").unwrap();
+    fs::write(boards_dir.join("README.md"), "# Board overlays").unwrap();
+
+    let boards = handler.discover_boards(temp_path).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["esp32c3_devkitm", "esp32s3_devkitc"]);
+
+    let s3 = &boards[1];
+    assert_eq!(s3.target, Some("ESP32-S3".to_string()));
+    assert_eq!(
+        s3.config_file,
+        boards_dir.join("esp32s3_devkitc.overlay"),
+        "overlay should be preferred over the .conf fragment"
+    );
+
+    // Each board gets its own build directory so boards can build in parallel
+    assert_eq!(
+        boards[0].build_dir,
+        temp_path.join("build").join("esp32c3_devkitm")
+    );
+    assert_ne!(boards[0].build_dir, boards[1].build_dir);
+
+    let build_cmd = handler.get_build_command(temp_path, s3);
+    assert!(build_cmd.contains("-b esp32s3_devkitc"));
+    assert!(build_cmd.contains(&format!("-d {}", s3.build_dir.display())));
+}
+
 #[tokio::test]
 async fn test_zephyr_tool_availability() {
     let handler = ZephyrHandler;
@@ -196,6 +264,59 @@ async fn test_nuttx_commands() {
     assert!(flash_cmd.contains("nuttx.bin"));
 }
 
+#[tokio::test]
+async fn test_nuttx_tree_defconfig_discovery() {
+    let handler = NuttXHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let nuttx_root = temp_dir.path().join("nuttx");
+
+    fs::create_dir_all(nuttx_root.join("tools")).unwrap();
+    fs::write(nuttx_root.join("tools/configure.sh"), "#!/bin/sh\n").unwrap();
+    for (arch, chip, board, config) in [
+        ("xtensa", "esp32", "esp32-devkitc", "nsh"),
+        ("xtensa", "esp32s3", "esp32s3-devkit", "wifi"),
+        ("risc-v", "esp32c3", "esp32c3-devkit", "nsh"),
+        ("arm", "stm32", "nucleo-f401re", "nsh"),
+    ] {
+        let config_dir = nuttx_root
+            .join("boards")
+            .join(arch)
+            .join(chip)
+            .join(board)
+            .join("configs")
+            .join(config);
+        fs::create_dir_all(&config_dir).unwrap();
+        fs::write(config_dir.join("defconfig"), "CONFIG_ARCH_BOARD_COMMON=y\n").unwrap();
+    }
+
+    assert!(handler.can_handle(temp_dir.path()));
+
+    // Only ESP chips are offered, one board per defconfig
+    let boards = handler.discover_boards(temp_dir.path()).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(
+        names,
+        vec![
+            "esp32-devkitc-nsh",
+            "esp32c3-devkit-nsh",
+            "esp32s3-devkit-wifi"
+        ]
+    );
+    assert_eq!(boards[1].target, Some("ESP32-C3".to_string()));
+
+    let build_cmd = handler.get_build_command(temp_dir.path(), &boards[2]);
+    assert!(build_cmd.contains("./tools/configure.sh -E esp32s3-devkit:wifi && make"));
+
+    let flash_cmd = handler.get_flash_command(temp_dir.path(), &boards[1], Some("/dev/ttyUSB0"));
+    assert!(flash_cmd.contains("--chip esp32c3"));
+    assert!(flash_cmd.contains("write_flash -z 0x0"));
+    assert!(flash_cmd.contains("esp32c3-devkit-nsh/nuttx.bin"));
+
+    let flash_cmd = handler.get_flash_command(temp_dir.path(), &boards[0], Some("/dev/ttyUSB0"));
+    assert!(flash_cmd.contains("--chip esp32 "));
+    assert!(flash_cmd.contains("write_flash -z 0x1000"));
+}
+
 #[tokio::test]
 async fn test_nuttx_tool_availability() {
     let handler = NuttXHandler;
@@ -306,6 +427,58 @@ async fn test_tinygo_board_discovery_esp32s3() {
     assert_eq!(board.target, Some("ESP32-S3".to_string()));
 }
 
+#[tokio::test]
+async fn test_tinygo_target_autodetection() {
+    let handler = TinyGoHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+    fs::write(temp_path.join("go.mod"), "module blinky\n\ngo 1.22\n").unwrap();
+
+    // High GPIO numbers only exist on the ESP32-S3
+    fs::write(
+        temp_path.join("main.go"),
+        "package main\n\nimport \"machine\"\n\nvar led = machine.GPIO48\n\nfunc main() {}\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(temp_path).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].target, Some("ESP32-S3".to_string()));
+
+    // Build tags win over pin heuristics
+    fs::write(
+        temp_path.join("board_c3.go"),
+        "//go:build esp32c3 && !debug\n\npackage main\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(temp_path).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].name, "esp32-c3-mini");
+    assert_eq!(boards[0].target, Some("ESP32-C3".to_string()));
+
+    // An explicit directive selects the exact -target
+    fs::write(
+        temp_path.join("target.go"),
+        "//espbrew:target esp32s3 esp32c3\npackage main\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(temp_path).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["esp32c3", "esp32s3"]);
+    let build_cmd = handler.get_build_command(temp_path, &boards[1]);
+    assert!(build_cmd.contains("-target esp32s3"));
+
+    // espbrew.yaml overrides everything found in the sources
+    fs::write(
+        temp_path.join("espbrew.yaml"),
+        "tinygo:\n  targets:\n    - xiao-esp32c3\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(temp_path).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].name, "xiao-esp32c3");
+    assert_eq!(boards[0].target, Some("ESP32-C3".to_string()));
+}
+
 #[tokio::test]
 async fn test_tinygo_commands() {
     let handler = TinyGoHandler;
@@ -407,3 +580,169 @@ async fn test_tinygo_clean_operation() {
     assert!(!temp_path.join("firmware.elf").exists());
     assert!(!temp_path.join("main").exists());
 }
+
+// ==== DEPENDENCY PREFETCH TESTS ====
+
+#[test]
+fn test_tinygo_module_requirements_and_vendor_state() {
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    fs::write(
+        temp_path.join("go.mod"),
+        "module example.com/blink\n\ngo 1.22\n\nrequire tinygo.org/x/drivers v0.28.0\n\nrequire (\n\tgithub.com/example/display v1.2.0 // indirect\n\tgolang.org/x/exp v0.0.0-20240506185415-9bf2ced13842\n)\n",
+    )
+    .unwrap();
+
+    assert_eq!(
+        TinyGoHandler::module_requirements(temp_path),
+        vec![
+            "tinygo.org/x/drivers",
+            "github.com/example/display",
+            "golang.org/x/exp"
+        ]
+    );
+
+    // Nothing vendored yet
+    assert!(!TinyGoHandler::vendor_up_to_date(temp_path));
+
+    fs::create_dir_all(temp_path.join("vendor")).unwrap();
+    fs::write(
+        temp_path.join("vendor/modules.txt"),
+        "# tinygo.org/x/drivers v0.28.0\n",
+    )
+    .unwrap();
+    assert!(TinyGoHandler::vendor_up_to_date(temp_path));
+}
+
+#[tokio::test]
+async fn test_tinygo_prepare_build_without_dependencies() {
+    let handler = TinyGoHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+    fs::write(
+        temp_path.join("go.mod"),
+        "module example.com/blink\n\ngo 1.22\n",
+    )
+    .unwrap();
+
+    let boards = vec![espbrew::models::ProjectBoardConfig {
+        name: "esp32-coreboard-v2".to_string(),
+        config_file: temp_path.join("go.mod"),
+        build_dir: temp_path.to_path_buf(),
+        target: Some("ESP32".to_string()),
+        project_type: ProjectType::TinyGo,
+    }];
+
+    // A single board without module dependencies needs no go or tinygo invocation
+    let (tx, mut rx) = tokio::sync::mpsc::unbounded_channel();
+    assert!(handler.prepare_build(temp_path, &boards, tx).await.is_ok());
+    assert!(rx.try_recv().is_err());
+}
+
+// ==== ESP8266 RTOS SDK HANDLER TESTS ====
+
+#[tokio::test]
+async fn test_esp8266_rtos_make_project() {
+    let handler = Esp8266RtosHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    fs::write(
+        temp_path.join("Makefile"),
+        "PROJECT_NAME := hello-world\n\ninclude $(IDF_PATH)/make/project.mk\n",
+    )
+    .unwrap();
+    fs::create_dir_all(temp_path.join("main")).unwrap();
+
+    // Without an ESP8266 sdkconfig it is not recognized
+    assert!(!handler.can_handle(temp_path));
+
+    fs::write(
+        temp_path.join("sdkconfig.defaults.nodemcu"),
+        "CONFIG_IDF_TARGET_ESP8266=y\nCONFIG_ESPTOOLPY_FLASHSIZE_4MB=y\n",
+    )
+    .unwrap();
+    fs::write(
+        temp_path.join("sdkconfig.defaults.esp01"),
+        "CONFIG_IDF_TARGET_ESP8266=y\nCONFIG_ESPTOOLPY_FLASHSIZE_1MB=y\n",
+    )
+    .unwrap();
+
+    assert!(handler.can_handle(temp_path));
+    assert_eq!(handler.project_type(), ProjectType::Esp8266Rtos);
+    assert_eq!(
+        Esp8266RtosHandler::build_system(temp_path),
+        Some(Esp8266BuildSystem::Make)
+    );
+
+    let boards = handler.discover_boards(temp_path).unwrap();
+    assert_eq!(boards.len(), 2);
+    assert_eq!(boards[0].name, "esp01");
+    assert_eq!(boards[0].build_dir, temp_path.join("build.esp01"));
+    assert_eq!(boards[1].name, "nodemcu");
+    assert_eq!(boards[1].target.as_deref(), Some("esp8266"));
+
+    let build_cmd = handler.get_build_command(temp_path, &boards[1]);
+    assert!(build_cmd.contains("make BATCH_BUILD=1"));
+    assert!(build_cmd.contains("sdkconfig.defaults.nodemcu"));
+
+    // The registry must prefer this handler over ESP-IDF
+    let registry = espbrew::projects::ProjectRegistry::new();
+    let detected = registry.detect_project(temp_path).unwrap();
+    assert_eq!(detected.project_type(), ProjectType::Esp8266Rtos);
+}
+
+#[tokio::test]
+async fn test_esp8266_rtos_cmake_project_artifacts() {
+    let handler = Esp8266RtosHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    fs::write(
+        temp_path.join("CMakeLists.txt"),
+        "cmake_minimum_required(VERSION 3.5)\ninclude($ENV{IDF_PATH}/tools/cmake/project.cmake)\nproject(blink)\n",
+    )
+    .unwrap();
+    fs::write(
+        temp_path.join("sdkconfig.defaults"),
+        "CONFIG_IDF_TARGET=\"esp8266\"\n",
+    )
+    .unwrap();
+
+    assert!(handler.can_handle(temp_path));
+    assert_eq!(
+        Esp8266RtosHandler::build_system(temp_path),
+        Some(Esp8266BuildSystem::CMake)
+    );
+
+    let boards = handler.discover_boards(temp_path).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].name, "default");
+    assert!(
+        handler
+            .get_build_command(temp_path, &boards[0])
+            .contains("idf.py -B")
+    );
+
+    // Make-style output without flash_project_args uses the fixed layout
+    let build_dir = temp_path.join("build");
+    fs::create_dir_all(build_dir.join("bootloader")).unwrap();
+    fs::write(build_dir.join("bootloader").join("bootloader.bin"), b"boot").unwrap();
+    fs::write(build_dir.join("partitions_singleapp.bin"), b"parts").unwrap();
+    fs::write(build_dir.join("blink.bin"), b"app").unwrap();
+
+    assert!(handler.check_artifacts_exist(temp_path, &boards[0]));
+    let artifacts = handler.find_build_artifacts(temp_path, &boards[0]).unwrap();
+    let offsets: Vec<(String, Option<u32>)> = artifacts
+        .iter()
+        .map(|a| (a.name.clone(), a.offset))
+        .collect();
+    assert!(offsets.contains(&("bootloader".to_string(), Some(0x0))));
+    assert!(offsets.contains(&("partition-table".to_string(), Some(0x8000))));
+    assert!(offsets.contains(&("blink".to_string(), Some(0x10000))));
+
+    let flash_cmd = handler.get_flash_command(temp_path, &boards[0], Some("/dev/ttyUSB1"));
+    assert!(flash_cmd.contains("--chip esp8266 --port /dev/ttyUSB1"));
+    assert!(flash_cmd.contains("0x10000"));
+}
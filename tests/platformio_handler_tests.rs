@@ -0,0 +1,128 @@
+use espbrew::models::ProjectType;
+use espbrew::projects::handlers::platformio::PlatformIOHandler;
+use espbrew::projects::registry::ProjectHandler;
+use std::fs;
+use std::path::Path;
+use tempfile::TempDir;
+
+#[tokio::test]
+async fn test_platformio_envs_become_boards() {
+    let handler = PlatformIOHandler;
+    let fixture_path = Path::new("tests/fixtures/platformio_project");
+
+    assert_eq!(handler.project_type(), ProjectType::PlatformIO);
+    assert!(handler.can_handle(fixture_path));
+
+    let boards = handler.discover_boards(fixture_path).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["esp32c3", "esp32c6", "esp32s2", "esp32s3"]);
+
+    // Hyphenated PlatformIO board ids map onto the right chip
+    let targets: Vec<&str> = boards
+        .iter()
+        .map(|b| b.target.as_deref().unwrap_or(""))
+        .collect();
+    assert_eq!(
+        targets,
+        vec!["ESP32-C3", "ESP32-C6", "ESP32-S2", "ESP32-S3"]
+    );
+
+    for board in &boards {
+        assert_eq!(board.project_type, ProjectType::PlatformIO);
+        assert!(
+            board
+                .build_dir
+                .ends_with(Path::new(".pio/build").join(&board.name))
+        );
+    }
+}
+
+#[tokio::test]
+async fn test_platformio_env_inheritance_and_comments() {
+    let handler = PlatformIOHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+
+    fs::write(
+        temp_path.join("platformio.ini"),
+        r#"; shared settings
+[env]
+platform = espressif32
+board=esp32dev
+
+[env:base_s3]
+board = esp32-s3-devkitc-1
+; board = esp32-c3-devkitm-1
+
+[env:s3_debug]
+extends = env:base_s3
+build_type = debug
+
+[env:classic]
+
+[env:custom]
+board = my_custom_board
+board_build.mcu = esp32c6
+"#,
+    )
+    .unwrap();
+
+    let boards = handler.discover_boards(temp_path).unwrap();
+    let target_of = |name: &str| {
+        boards
+            .iter()
+            .find(|b| b.name == name)
+            .and_then(|b| b.target.clone())
+            .unwrap()
+    };
+
+    assert_eq!(boards.len(), 4);
+    assert_eq!(target_of("base_s3"), "ESP32-S3");
+    assert_eq!(target_of("s3_debug"), "ESP32-S3");
+    assert_eq!(target_of("classic"), "ESP32");
+    assert_eq!(target_of("custom"), "ESP32-C6");
+}
+
+#[tokio::test]
+async fn test_platformio_commands_per_env() {
+    let handler = PlatformIOHandler;
+    let fixture_path = Path::new("tests/fixtures/platformio_project");
+
+    let boards = handler.discover_boards(fixture_path).unwrap();
+    let board = boards.iter().find(|b| b.name == "esp32s3").unwrap();
+
+    let build_cmd = handler.get_build_command(fixture_path, board);
+    assert!(build_cmd.contains("pio run -e esp32s3"));
+
+    let flash_cmd = handler.get_flash_command(fixture_path, board, Some("/dev/ttyUSB0"));
+    assert!(flash_cmd.contains("--target upload"));
+    assert!(flash_cmd.contains("--upload-port /dev/ttyUSB0"));
+
+    // Nothing has been built in the fixture
+    assert!(!handler.check_artifacts_exist(fixture_path, board));
+}
+
+#[tokio::test]
+async fn test_platformio_flash_command_skips_the_build_of_existing_firmware() {
+    let handler = PlatformIOHandler;
+    let temp_dir = TempDir::new().unwrap();
+    let temp_path = temp_dir.path();
+    fs::write(
+        temp_path.join("platformio.ini"),
+        "[env:esp32s3]\nplatform = espressif32\nboard = esp32-s3-devkitc-1\n",
+    )
+    .unwrap();
+
+    let boards = handler.discover_boards(temp_path).unwrap();
+    let board = &boards[0];
+    let flash_cmd = handler.get_flash_command(temp_path, board, None);
+    assert!(flash_cmd.ends_with("pio run -e esp32s3 --target upload"));
+
+    // With firmware built, the shown command flashes it without rebuilding, as flashing does
+    fs::create_dir_all(&board.build_dir).unwrap();
+    fs::write(board.build_dir.join("firmware.bin"), [0u8; 16]).unwrap();
+    let flash_cmd = handler.get_flash_command(temp_path, board, Some("/dev/ttyUSB0"));
+    assert!(flash_cmd.ends_with(
+        "pio run -e esp32s3 --target nobuild --target upload --upload-port /dev/ttyUSB0"
+    ));
+}
@@ -650,3 +650,839 @@ async fn test_project_handler_performance() {
     );
     assert!(!boards.is_empty(), "Should discover at least one board");
 }
+
+/// Build a binary partition table entry as produced by gen_esp32part.py
+fn partition_entry(label: &str, ptype: u8, subtype: u8, offset: u32, size: u32) -> Vec<u8> {
+    let mut entry = vec![0xAA, 0x50, ptype, subtype];
+    entry.extend_from_slice(&offset.to_le_bytes());
+    entry.extend_from_slice(&size.to_le_bytes());
+    let mut label_bytes = [0u8; 16];
+    label_bytes[..label.len()].copy_from_slice(label.as_bytes());
+    entry.extend_from_slice(&label_bytes);
+    entry.extend_from_slice(&0u32.to_le_bytes());
+    entry
+}
+
+/// Test that additional ESP-IDF apps are flashed to their partition offsets
+#[test]
+fn test_esp_idf_multi_app_artifacts() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(factory)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.esp32s3"),
+        "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+    )
+    .unwrap();
+    fs::create_dir_all(project.join("updater")).unwrap();
+    fs::write(project.join("updater/CMakeLists.txt"), "project(updater)\n").unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "esp_idf:\n  apps:\n    - name: updater\n      path: updater\n      partition: ota_0\n",
+    )
+    .unwrap();
+
+    let handler = EspIdfHandler;
+    let board = handler
+        .discover_boards(project)
+        .unwrap()
+        .into_iter()
+        .find(|b| b.name == "esp32s3")
+        .expect("board from sdkconfig.defaults.esp32s3");
+
+    // Main build with a shared partition table
+    let build_dir = &board.build_dir;
+    fs::create_dir_all(build_dir.join("bootloader")).unwrap();
+    fs::create_dir_all(build_dir.join("partition_table")).unwrap();
+    fs::write(build_dir.join("bootloader/bootloader.bin"), [0u8; 16]).unwrap();
+    fs::write(build_dir.join("factory.bin"), [0u8; 16]).unwrap();
+    let mut table = Vec::new();
+    table.extend(partition_entry("nvs", 0x01, 0x02, 0x9000, 0x6000));
+    table.extend(partition_entry("factory", 0x00, 0x00, 0x10000, 0x100000));
+    table.extend(partition_entry("ota_0", 0x00, 0x10, 0x110000, 0x100000));
+    table.extend([0xFF; 32]);
+    fs::write(
+        build_dir.join("partition_table/partition-table.bin"),
+        &table,
+    )
+    .unwrap();
+    fs::write(
+        build_dir.join("flash_args"),
+        "--flash_mode dio --flash_freq 80m --flash_size 4MB\n0x0 bootloader/bootloader.bin\n0x8000 partition_table/partition-table.bin\n0x10000 factory.bin\n",
+    )
+    .unwrap();
+
+    // The updater app has not been built yet
+    assert!(!handler.check_artifacts_exist(project, &board));
+
+    let app_build_dir = build_dir.join("apps/updater");
+    fs::create_dir_all(&app_build_dir).unwrap();
+    fs::write(app_build_dir.join("updater.bin"), [0u8; 16]).unwrap();
+    fs::write(
+        app_build_dir.join("flash_args"),
+        "--flash_mode dio --flash_freq 80m --flash_size 4MB\n0x10000 updater.bin\n",
+    )
+    .unwrap();
+    assert!(handler.check_artifacts_exist(project, &board));
+
+    let artifacts = handler.find_build_artifacts(project, &board).unwrap();
+    assert_eq!(artifacts.len(), 4);
+    let updater = artifacts.iter().find(|a| a.name == "updater").unwrap();
+    assert_eq!(updater.offset, Some(0x110000));
+    assert!(updater.file_path.ends_with("updater.bin"));
+    let factory = artifacts
+        .iter()
+        .find(|a| a.offset == Some(0x10000))
+        .unwrap();
+    assert!(factory.file_path.ends_with("factory.bin"));
+}
+
+/// Test that `espbrew new` templates produce detectable multi-board projects
+#[test]
+fn test_new_project_templates() {
+    use espbrew::projects::templates::{ProjectTemplate, generate_project};
+
+    let temp_dir = TempDir::new().unwrap();
+    let registry = ProjectRegistry::new();
+    let chips = vec!["esp32s3".to_string(), "esp32c6".to_string()];
+
+    for (template, project_type) in [
+        (ProjectTemplate::EspIdf, ProjectType::EspIdf),
+        (ProjectTemplate::Tinygo, ProjectType::TinyGo),
+        (ProjectTemplate::RustEspHal, ProjectType::RustNoStd),
+    ] {
+        let dest = temp_dir.path().join(template.name());
+        let files = generate_project(template, &dest, &chips).unwrap();
+        assert!(files.iter().any(|f| f.ends_with("espbrew.yaml")));
+
+        let handler = registry
+            .detect_project(&dest)
+            .unwrap_or_else(|| panic!("{} project should be detected", template.name()));
+        assert_eq!(handler.project_type(), project_type);
+        assert_eq!(
+            handler.discover_boards(&dest).unwrap().len(),
+            2,
+            "{} should have one board per chip",
+            template.name()
+        );
+
+        // Generating into a non-empty directory is refused
+        assert!(generate_project(template, &dest, &chips).is_err());
+    }
+
+    let esp_idf = temp_dir.path().join("esp-idf");
+    let boards = registry
+        .detect_project(&esp_idf)
+        .unwrap()
+        .discover_boards(&esp_idf)
+        .unwrap();
+    assert!(
+        boards
+            .iter()
+            .any(|b| b.name == "esp32c6" && b.target.as_deref() == Some("esp32c6"))
+    );
+
+    assert!(
+        generate_project(
+            ProjectTemplate::Tinygo,
+            &temp_dir.path().join("bad"),
+            &["esp32p4".to_string()]
+        )
+        .is_err()
+    );
+}
+
+/// Test that CMake configure presets are discovered as ESP-IDF boards
+#[test]
+fn test_esp_idf_cmake_presets() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(
+        project.join("CMakeLists.txt"),
+        "cmake_minimum_required(VERSION 3.16)\ninclude($ENV{IDF_PATH}/tools/cmake/project.cmake)\nproject(presets)\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("CMakePresets.json"),
+        r#"{
+  "version": 3,
+  "configurePresets": [
+    {
+      "name": "base",
+      "hidden": true,
+      "binaryDir": "${sourceDir}/build/${presetName}",
+      "cacheVariables": { "SDKCONFIG": "${sourceDir}/build/${presetName}/sdkconfig" }
+    },
+    {
+      "name": "esp32c6-devkit",
+      "inherits": "base",
+      "cacheVariables": { "IDF_TARGET": "esp32c6" }
+    },
+    {
+      "name": "esp32s3-box",
+      "inherits": ["base"],
+      "binaryDir": "out/box",
+      "cacheVariables": {
+        "IDF_TARGET": { "type": "STRING", "value": "esp32s3" },
+        "SDKCONFIG_DEFAULTS": "sdkconfig.defaults;sdkconfig.box"
+      }
+    }
+  ]
+}"#,
+    )
+    .unwrap();
+
+    // Presets alone make the directory an ESP-IDF project
+    let handler = EspIdfHandler;
+    assert!(handler.can_handle(project));
+
+    let boards = handler.discover_boards(project).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["esp32c6-devkit", "esp32s3-box"]);
+
+    let devkit = &boards[0];
+    assert_eq!(devkit.target.as_deref(), Some("esp32c6"));
+    assert_eq!(devkit.build_dir, project.join("build/esp32c6-devkit"));
+    assert!(devkit.config_file.ends_with("CMakePresets.json"));
+
+    let boxed = &boards[1];
+    assert_eq!(boxed.target.as_deref(), Some("esp32s3"));
+    assert_eq!(boxed.build_dir, project.join("out/box"));
+
+    let command = handler.get_build_command(project, boxed);
+    assert!(command.contains("idf.py --preset 'esp32s3-box' build"));
+
+    // sdkconfig.defaults.* boards take precedence over presets with the same name
+    fs::write(
+        project.join("sdkconfig.defaults.esp32c6-devkit"),
+        "CONFIG_IDF_TARGET=\"esp32c6\"\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(project).unwrap();
+    assert_eq!(boards.len(), 2);
+    let devkit = boards.iter().find(|b| b.name == "esp32c6-devkit").unwrap();
+    assert!(
+        devkit
+            .config_file
+            .ends_with("sdkconfig.defaults.esp32c6-devkit")
+    );
+}
+
+/// Test that ESP-BSP catalog boards become sdkconfig.bsp.* board configurations
+#[test]
+fn test_bsp_catalog_add_board() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::bsp_catalog::{add_bsp_board, find_bsp};
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::create_dir_all(project.join("main")).unwrap();
+
+    let core_s3 = find_bsp("espressif/m5stack-core-s3").expect("catalog entry");
+    add_bsp_board(project, core_s3, None).unwrap();
+    add_bsp_board(project, core_s3, Some("cores3-debug")).unwrap();
+    add_bsp_board(project, find_bsp("esp_box_3").unwrap(), None).unwrap();
+
+    let handler = EspIdfHandler;
+    assert!(handler.can_handle(project));
+    let boards = handler.discover_boards(project).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["cores3-debug", "esp_box_3", "m5stack_core_s3"]);
+    assert!(
+        boards
+            .iter()
+            .all(|b| b.target.as_deref() == Some("esp32s3"))
+    );
+}
+
+/// Test that a bare IDF component becomes one generated harness app per target
+#[test]
+fn test_component_only_mode() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::component_harness::{
+        DEFAULT_COMPONENT_TARGETS, board_harness_dir, write_harness,
+    };
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let component = temp_dir.path().join("led_strip");
+    fs::create_dir_all(component.join("include")).unwrap();
+    fs::write(
+        component.join("CMakeLists.txt"),
+        "idf_component_register(SRCS \"led_strip.c\" INCLUDE_DIRS \"include\")\n",
+    )
+    .unwrap();
+    fs::write(component.join("idf_component.yml"), "version: \"1.0.0\"\n").unwrap();
+
+    let handler = EspIdfHandler;
+    assert!(handler.can_handle(&component));
+    let boards = handler.discover_boards(&component).unwrap();
+    assert_eq!(boards.len(), DEFAULT_COMPONENT_TARGETS.len());
+
+    // The manifest's targets restrict the matrix, espbrew.yaml overrides it
+    fs::write(
+        component.join("idf_component.yml"),
+        "version: \"1.0.0\"\ntargets:\n  - esp32s3\n  - esp32c6\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(&component).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["esp32s3", "esp32c6"]);
+
+    fs::write(
+        component.join("espbrew.yaml"),
+        "esp_idf:\n  component_targets: [esp32c3]\n",
+    )
+    .unwrap();
+    let boards = handler.discover_boards(&component).unwrap();
+    assert_eq!(boards.len(), 1);
+    let board = &boards[0];
+    assert_eq!(board.target.as_deref(), Some("esp32c3"));
+    assert_eq!(
+        board.build_dir,
+        component.join("build.component/esp32c3/build")
+    );
+
+    let harness = write_harness(&component, "esp32c3").unwrap();
+    assert_eq!(board_harness_dir(&component, board), Some(harness.clone()));
+    let main_cmake = fs::read_to_string(harness.join("main/CMakeLists.txt")).unwrap();
+    assert!(main_cmake.contains("PRIV_REQUIRES led_strip"));
+    let manifest = fs::read_to_string(harness.join("main/idf_component.yml")).unwrap();
+    assert!(manifest.contains("led_strip:\n    override_path:"));
+    let defaults = fs::read_to_string(harness.join("sdkconfig.defaults")).unwrap();
+    assert_eq!(defaults, "CONFIG_IDF_TARGET=\"esp32c3\"\n");
+
+    let build_cmd = handler.get_build_command(&component, board);
+    assert!(build_cmd.contains("build.component/esp32c3"));
+}
+
+/// Test that board configs inherit options from `# extends:` base fragments
+#[test]
+fn test_sdkconfig_fragment_inheritance() {
+    use espbrew::config::sdkconfig_fragments::EFFECTIVE_DEFAULTS_FILE;
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.common"),
+        "CONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_LOG_DEFAULT_LEVEL_INFO=y\nCONFIG_SPIRAM=y\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.box"),
+        "# extends: sdkconfig.defaults.common\nCONFIG_ESPTOOLPY_FLASHSIZE_16MB=y\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.c6"),
+        "# extends: sdkconfig.defaults.common\nCONFIG_IDF_TARGET=\"esp32c6\"\n# CONFIG_SPIRAM is not set\n",
+    )
+    .unwrap();
+
+    // The shared base is not a board, targets come from the merged config
+    let handler = EspIdfHandler;
+    let boards = handler.discover_boards(project).unwrap();
+    let names: Vec<(&str, Option<&str>)> = boards
+        .iter()
+        .map(|b| (b.name.as_str(), b.target.as_deref()))
+        .collect();
+    assert_eq!(
+        names,
+        vec![("box", Some("esp32s3")), ("c6", Some("esp32c6"))]
+    );
+    assert!(
+        handler
+            .get_build_command(project, &boards[1])
+            .contains(EFFECTIVE_DEFAULTS_FILE)
+    );
+}
+
+/// Test selecting discovered boards by their tags and target chips
+#[test]
+fn test_board_tag_filter() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::board_tags::{TagFilter, filter_boards_by_tags};
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    for (board, target) in [
+        ("box", "esp32s3"),
+        ("c3_mini", "esp32c3"),
+        ("c6", "esp32c6"),
+    ] {
+        fs::write(
+            project.join(format!("sdkconfig.defaults.{}", board)),
+            format!("CONFIG_IDF_TARGET=\"{}\"\n", target),
+        )
+        .unwrap();
+    }
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    tags: [psram, customer-x]\n  c3_mini:\n    tags: [PSRAM, c3]\n",
+    )
+    .unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let filter = TagFilter::parse("psram, !C3").unwrap();
+    let selected = filter_boards_by_tags(project, boards.clone(), &filter);
+    let names: Vec<&str> = selected.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(names, vec!["box"]);
+
+    // The target chip is an implicit tag
+    let selected = filter_boards_by_tags(project, boards, &TagFilter::parse("esp32c6").unwrap());
+    assert_eq!(selected.len(), 1);
+    assert_eq!(selected[0].name, "c6");
+}
+
+/// Test board metadata from espbrew.yaml feeding board discovery and the build
+#[test]
+fn test_board_metadata() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.box"),
+        "CONFIG_ESPTOOLPY_FLASHSIZE_4MB=y\nCONFIG_FREERTOS_HZ=1000\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    chip: esp32s3\n    flash_size: 16M\n    psram: octal\n",
+    )
+    .unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    assert_eq!(boards[0].target.as_deref(), Some("esp32s3"));
+
+    // The build gets the merged defaults with the metadata applied last
+    let build_cmd = EspIdfHandler.get_build_command(project, &boards[0]);
+    assert!(build_cmd.contains("sdkconfig.defaults.effective"));
+}
+
+#[test]
+fn test_build_profile_matrix() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::board_tags::board_tags;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.esp32s3"),
+        "CONFIG_COMPILER_OPTIMIZATION_DEBUG=y\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.esp32c3"),
+        "CONFIG_FREERTOS_HZ=1000\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "profiles:\n  debug:\n    optimization: debug\n    log_level: debug\n  release:\n    optimization: size\n    log_level: warn\n    assertions: silent\n",
+    )
+    .unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let names: Vec<&str> = boards.iter().map(|b| b.name.as_str()).collect();
+    assert_eq!(
+        names,
+        vec![
+            "esp32c3-debug",
+            "esp32c3-release",
+            "esp32s3-debug",
+            "esp32s3-release"
+        ]
+    );
+    let release = &boards[3];
+    assert_eq!(release.build_dir, project.join("build.esp32s3-release"));
+    assert_eq!(
+        release.config_file,
+        project.join("sdkconfig.defaults.esp32s3")
+    );
+
+    assert!(
+        board_tags(project, "esp32s3-release", Some("esp32s3")).contains(&"release".to_string())
+    );
+
+    // Choices selected by the profile replace the ones in the board files
+    let lines: Vec<String> = EspIdfHandler::board_overrides(project, release)
+        .unwrap()
+        .iter()
+        .map(|o| o.to_line())
+        .collect();
+    assert_eq!(
+        lines,
+        vec![
+            "CONFIG_COMPILER_OPTIMIZATION_SIZE=y",
+            "CONFIG_LOG_DEFAULT_LEVEL_WARN=y",
+            "CONFIG_COMPILER_OPTIMIZATION_ASSERTIONS_SILENT=y",
+            "# CONFIG_COMPILER_OPTIMIZATION_DEBUG is not set",
+        ]
+    );
+}
+
+#[test]
+fn test_board_partition_table() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.box"),
+        "CONFIG_PARTITION_TABLE_SINGLE_APP=y\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.small"),
+        "CONFIG_ESPTOOLPY_FLASHSIZE_4MB=y\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("partitions.box.csv"),
+        "# Name, Type, SubType, Offset, Size, Flags\nnvs, data, nvs, , 24K\nphy_init, data, phy, , 4K\nfactory, app, factory, , 3M\nstorage, data, spiffs, , 1M\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  box:\n    flash_size: 8MB\n    partitions: partitions.box.csv\n  small:\n    partitions: partitions.box.csv\n",
+    )
+    .unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let board = |name: &str| boards.iter().find(|b| b.name == name).unwrap();
+
+    let overrides: Vec<String> = EspIdfHandler::board_overrides(project, board("box"))
+        .unwrap()
+        .iter()
+        .map(|o| o.to_line())
+        .collect();
+    assert!(overrides.contains(&"CONFIG_PARTITION_TABLE_CUSTOM=y".to_string()));
+    assert!(
+        overrides
+            .contains(&"CONFIG_PARTITION_TABLE_CUSTOM_FILENAME=\"partitions.box.csv\"".to_string())
+    );
+    assert!(overrides.contains(&"# CONFIG_PARTITION_TABLE_SINGLE_APP is not set".to_string()));
+
+    let layout = EspIdfHandler::partition_layout(project, board("box"))
+        .unwrap()
+        .unwrap();
+    assert_eq!(layout.flash_size, 8 * 1024 * 1024);
+    assert!(layout.problems().is_empty());
+    assert!(layout.report_lines().last().unwrap().starts_with("✅"));
+
+    // The 4 MiB board can't hold the storage partition ending at 0x410000
+    let small = EspIdfHandler::partition_layout(project, board("small"))
+        .unwrap()
+        .unwrap();
+    let problems = small.problems();
+    assert_eq!(problems.len(), 1);
+    assert!(problems[0].contains("storage"));
+}
+
+#[test]
+fn test_detected_board_config() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::board_detect::{DetectedBoard, write_detected_board};
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+    use espbrew::utils::espflash_utils::EspBoardInfo;
+
+    let info = EspBoardInfo {
+        port: "/dev/ttyACM0".to_string(),
+        chip_type: "esp32s3".to_string(),
+        crystal_frequency: "40 MHz".to_string(),
+        flash_size: "16MB".to_string(),
+        features: "WiFi, BLE, Embedded PSRAM 8MB (AP_3v3)".to_string(),
+        mac_address: "F4:12:FA:00:00:01".to_string(),
+        device_description: "ESP Development Board".to_string(),
+        chip_revision: Some("0.2".to_string()),
+    };
+    let board = DetectedBoard::from_board_info(&info);
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    write_detected_board(project, &board).unwrap().unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].name, "esp32s3-16mb-octal");
+    assert_eq!(boards[0].target.as_deref(), Some("esp32s3"));
+}
+
+#[test]
+fn test_sdkconfig_lint() {
+    use espbrew::config::sdkconfig_lint::{LintSeverity, has_errors};
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.c3"),
+        "CONFIG_IDF_TARGET=\"esp32c3\"\nCONFIG_SPIRAM=y\nCONFIG_XTAL_FREQ_26=y\nCONFIG_ESP32S3_REV_MIN_2=y\n# CONFIG_BT_ENABLED is not set\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.s3"),
+        "CONFIG_IDF_TARGET=\"esp32s3\"\nCONFIG_SPIRAM=y\nCONFIG_SPIRAM_MODE_OCT=y\nCONFIG_XTAL_FREQ_40=y\nCONFIG_ESP32_WIFI_STATIC_RX_BUFFER_NUM=10\n",
+    )
+    .unwrap();
+
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let board = |name: &str| boards.iter().find(|b| b.name == name).unwrap();
+
+    let issues = EspIdfHandler::lint_board(project, board("c3")).unwrap();
+    let keys: Vec<(&str, LintSeverity)> = issues
+        .iter()
+        .map(|i| (i.key.as_str(), i.severity))
+        .collect();
+    assert_eq!(
+        keys,
+        vec![
+            ("CONFIG_SPIRAM", LintSeverity::Error),
+            ("CONFIG_XTAL_FREQ_26", LintSeverity::Error),
+            ("CONFIG_ESP32S3_REV_MIN_2", LintSeverity::Warning),
+        ]
+    );
+    assert!(has_errors(&issues));
+    assert!(issues[0].to_line().contains("sdkconfig.defaults.c3"));
+
+    // Legacy CONFIG_ESP32_ aliases are valid on every target
+    assert!(
+        EspIdfHandler::lint_board(project, board("s3"))
+            .unwrap()
+            .is_empty()
+    );
+
+    // Board metadata takes part in the check: the s3 config on a C3 loses its PSRAM
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  s3:\n    chip: esp32c3\n",
+    )
+    .unwrap();
+    let issues = EspIdfHandler::lint_board(project, board("s3")).unwrap();
+    assert!(issues.iter().any(|i| i.key == "CONFIG_SPIRAM_MODE_OCT"));
+}
+
+#[test]
+fn test_platformio_board_import() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+    use espbrew::projects::platformio_boards::{
+        PioBoardManifest, find_board_manifest, import_platformio_board,
+    };
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "# Project settings\nboards:\n  other:\n    tags: [lab]\n",
+    )
+    .unwrap();
+    fs::create_dir_all(project.join("boards")).unwrap();
+    fs::write(
+        project.join("boards").join("esp32-s3-devkitc-1-n8r8.json"),
+        r#"{
+  "build": {
+    "arduino": { "memory_type": "qio_opi" },
+    "core": "esp32",
+    "extra_flags": ["-DARDUINO_ESP32S3_DEV", "-DBOARD_HAS_PSRAM"],
+    "f_flash": "80000000L",
+    "flash_mode": "qio",
+    "mcu": "esp32s3"
+  },
+  "name": "Espressif ESP32-S3-DevKitC-1-N8R8",
+  "upload": { "flash_size": "8MB", "speed": 921600 }
+}"#,
+    )
+    .unwrap();
+
+    let path = find_board_manifest(project, "esp32-s3-devkitc-1-n8r8").unwrap();
+    let manifest = PioBoardManifest::load(&path).unwrap();
+
+    import_platformio_board(
+        project,
+        &manifest,
+        "esp32-s3-devkitc-1-n8r8",
+        Some("devkit"),
+    )
+    .unwrap();
+
+    // The upload speed imported with the board is used for flashing
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let devkit = boards.iter().find(|b| b.name == "devkit").unwrap();
+    assert!(
+        EspIdfHandler
+            .get_flash_command(project, devkit, Some("/dev/ttyUSB0"))
+            .contains("-p /dev/ttyUSB0 -b 921600")
+    );
+}
+
+/// Test command templates from espbrew.yaml replacing a board's build
+#[cfg(unix)]
+#[tokio::test]
+async fn test_command_templates() {
+    use espbrew::models::{AppEvent, ArtifactType, ProjectBoardConfig};
+    use espbrew::projects::hooks::build_board_with_hooks;
+    use tokio::sync::mpsc;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(
+        project.join("CMakeLists.txt"),
+        "cmake_minimum_required(VERSION 3.16)\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        r#"commands:
+  esp_idf:
+    build: "mkdir -p {build_dir} && echo ${NO_SUCH_VAR:-home} {board} > {build_dir}/{board}.bin"
+"#,
+    )
+    .unwrap();
+
+    // The template build replaces the handler's build and reports its images
+    let c3 = ProjectBoardConfig {
+        name: "c3".to_string(),
+        config_file: project.join("sdkconfig.defaults.c3"),
+        build_dir: project.join("build dir.c3"),
+        target: Some("esp32c3".to_string()),
+        project_type: ProjectType::EspIdf,
+    };
+    let (tx, mut rx) = mpsc::unbounded_channel();
+    let handler = ProjectRegistry::create_handler(ProjectType::EspIdf);
+    let artifacts = build_board_with_hooks(handler.as_ref(), project, &c3, tx)
+        .await
+        .unwrap();
+    assert_eq!(artifacts.len(), 1);
+    assert_eq!(artifacts[0].artifact_type, ArtifactType::Binary);
+    assert_eq!(
+        fs::read_to_string(project.join("build dir.c3/c3.bin")).unwrap(),
+        "home c3\n"
+    );
+
+    let mut log = Vec::new();
+    while let Ok(AppEvent::BuildOutput(_, line)) = rx.try_recv() {
+        log.push(line);
+    }
+    assert!(
+        log.iter()
+            .any(|line| line.contains("Running build template"))
+    );
+}
+
+/// Test build directories placed under build.out_dir of espbrew.yaml
+#[test]
+fn test_out_of_tree_build_dirs() {
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path().join("blinky");
+    fs::create_dir_all(&project).unwrap();
+    fs::write(
+        project.join("CMakeLists.txt"),
+        "cmake_minimum_required(VERSION 3.16)\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.esp32c3"),
+        "CONFIG_IDF_TARGET=\"esp32c3\"\n",
+    )
+    .unwrap();
+
+    let handler = ProjectRegistry::create_handler(ProjectType::EspIdf);
+    let in_tree = handler.discover_boards(&project).unwrap();
+    assert_eq!(in_tree[0].build_dir, project.join("build.esp32c3"));
+
+    let out_dir = temp_dir.path().join("fastdisk");
+    fs::write(
+        project.join("espbrew.yaml"),
+        format!("build:\n  out_dir: {}\n", out_dir.display()),
+    )
+    .unwrap();
+    let boards = handler.discover_boards(&project).unwrap();
+    assert_eq!(boards.len(), 1);
+    assert_eq!(boards[0].name, "esp32c3");
+    assert_eq!(boards[0].build_dir, out_dir.join("blinky").join("esp32c3"));
+}
+
+/// Test a DFU board refusing flashes its whole-build image can't do
+#[tokio::test]
+async fn test_dfu_refuses_partial_flashes() {
+    use espbrew::projects::ProjectHandler;
+    use espbrew::projects::flash_parts::FlashPart;
+    use espbrew::projects::handlers::esp_idf::EspIdfHandler;
+
+    let temp_dir = TempDir::new().unwrap();
+    let project = temp_dir.path();
+    fs::write(project.join("CMakeLists.txt"), "project(app)\n").unwrap();
+    fs::write(
+        project.join("sdkconfig.defaults.s3_otg"),
+        "CONFIG_IDF_TARGET=\"esp32s3\"\n",
+    )
+    .unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  s3_otg:\n    chip: esp32s3\n    flash_backend: dfu\n",
+    )
+    .unwrap();
+    let boards = EspIdfHandler.discover_boards(project).unwrap();
+    let (tx, _rx) = tokio::sync::mpsc::unbounded_channel();
+
+    let error = EspIdfHandler
+        .flash_board_parts(
+            project,
+            &boards[0],
+            &[],
+            None,
+            &[FlashPart::App],
+            tx.clone(),
+        )
+        .await
+        .unwrap_err();
+    assert!(
+        error
+            .to_string()
+            .contains("can't flash only the app images")
+    );
+
+    // Nor does the image have the apps of a multi-app project
+    fs::create_dir_all(project.join("updater")).unwrap();
+    fs::write(project.join("updater/CMakeLists.txt"), "project(updater)\n").unwrap();
+    fs::write(
+        project.join("espbrew.yaml"),
+        "boards:\n  s3_otg:\n    chip: esp32s3\n    flash_backend: dfu\n\
+         esp_idf:\n  apps:\n    - name: updater\n      path: updater\n      partition: ota_0\n",
+    )
+    .unwrap();
+    let error = EspIdfHandler
+        .flash_board(project, &boards[0], &[], None, tx)
+        .await
+        .unwrap_err();
+    assert!(
+        error
+            .to_string()
+            .contains("extra app, NVS or filesystem images")
+    );
+}
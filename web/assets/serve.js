@@ -0,0 +1,146 @@
+/**
+ * ESPBrew - Build dashboard of `espbrew serve --web`
+ * Mirrors the TUI: board status and logs over the websocket, actions by POST
+ */
+
+class ServeDashboard {
+    constructor() {
+        this.snapshot = null;
+        this.logs = {};
+        this.selectedBoard = null;
+        this.socket = null;
+        // Status, logs and actions need the token of the URL the TUI logged; it outlives reloads
+        const token = new URLSearchParams(window.location.search).get('token');
+        if (token) sessionStorage.setItem('espbrew-token', token);
+        this.token = sessionStorage.getItem('espbrew-token') || '';
+
+        document.getElementById('build-all').addEventListener('click', () => this.runAction('build_all'));
+        document.querySelectorAll('.board-action').forEach(button => {
+            button.addEventListener('click', () => this.runAction(button.dataset.action, this.selectedBoard));
+        });
+
+        this.connect();
+    }
+
+    connect() {
+        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const token = encodeURIComponent(this.token);
+        this.socket = new WebSocket(`${protocol}//${window.location.host}/ws/serve?token=${token}`);
+        this.socket.onopen = () => this.setConnection(true);
+        this.socket.onmessage = event => this.handleMessage(JSON.parse(event.data));
+        this.socket.onclose = () => {
+            this.setConnection(false);
+            // The page starts over from the TUI's state when it reconnects
+            this.logs = {};
+            setTimeout(() => this.connect(), 2000);
+        };
+    }
+
+    setConnection(connected) {
+        const indicator = document.getElementById('connection');
+        indicator.textContent = connected ? 'live' : 'disconnected';
+        indicator.className = `status-indicator connection ${connected ? 'status-online' : 'status-offline'}`;
+    }
+
+    handleMessage(message) {
+        if (message.type === 'snapshot') {
+            this.snapshot = message;
+            if (!this.selectedBoard) {
+                const selected = message.boards.find(board => board.selected);
+                this.selectedBoard = selected ? selected.name : null;
+            }
+            this.renderSnapshot();
+        } else if (message.type === 'log') {
+            const lines = message.reset ? [] : (this.logs[message.board] || []);
+            this.logs[message.board] = lines.concat(message.lines);
+            if (message.board === this.selectedBoard) {
+                this.renderLog(message.reset ? null : message.lines);
+            }
+        }
+    }
+
+    renderSnapshot() {
+        const snapshot = this.snapshot;
+        document.getElementById('project-name').textContent = snapshot.project;
+        document.getElementById('headline').textContent = snapshot.headline;
+        document.getElementById('timings').textContent = snapshot.timings;
+
+        const rows = document.getElementById('boards');
+        rows.innerHTML = '';
+        snapshot.boards.forEach(board => {
+            const row = document.createElement('tr');
+            row.className = 'board-row';
+            if (board.name === this.selectedBoard) row.classList.add('active');
+            if (board.selected) row.classList.add('tui-selected');
+            [board.name, board.target || '-', board.status || board.outcome, board.duration, board.size, board.cache]
+                .forEach((text, index) => {
+                    const cell = document.createElement('td');
+                    cell.textContent = text;
+                    if (index === 2) cell.className = `outcome-${board.outcome}`;
+                    row.appendChild(cell);
+                });
+            row.addEventListener('click', () => this.selectBoard(board.name));
+            rows.appendChild(row);
+        });
+
+        document.querySelectorAll('.board-action').forEach(button => {
+            button.disabled = !this.selectedBoard;
+        });
+        this.renderMonitors();
+    }
+
+    selectBoard(name) {
+        this.selectedBoard = name;
+        this.renderSnapshot();
+        this.renderLog(null);
+    }
+
+    // Appends the new lines, or shows the whole log without them
+    renderLog(newLines) {
+        const log = document.getElementById('log');
+        document.getElementById('log-title').textContent = this.selectedBoard || 'Select a board';
+        const atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 20;
+        if (newLines) {
+            log.textContent += newLines.map(line => line + '\n').join('');
+        } else {
+            const lines = this.logs[this.selectedBoard] || [];
+            log.textContent = lines.map(line => line + '\n').join('');
+        }
+        if (atBottom || !newLines) log.scrollTop = log.scrollHeight;
+    }
+
+    renderMonitors() {
+        const container = document.getElementById('monitors');
+        container.innerHTML = '';
+        this.snapshot.monitors.forEach(monitor => {
+            const title = document.createElement('h3');
+            title.className = 'mb-sm';
+            title.textContent = `📺 ${monitor.port}${monitor.board ? ' (' + monitor.board + ')' : ''} - ${monitor.state}`;
+            const lines = document.createElement('div');
+            lines.className = 'log-container';
+            lines.textContent = monitor.lines.join('\n');
+            container.appendChild(title);
+            container.appendChild(lines);
+            lines.scrollTop = lines.scrollHeight;
+        });
+    }
+
+    async runAction(action, board) {
+        const status = document.getElementById('action-status');
+        try {
+            const response = await fetch('/api/v1/serve/actions', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'X-Espbrew-Token': this.token },
+                body: JSON.stringify({ action, board })
+            });
+            const result = await response.json();
+            status.textContent = response.ok
+                ? `✅ ${action.replace('_', ' ')} queued${board ? ' for ' + board : ''}`
+                : `❌ ${result.error}`;
+        } catch (error) {
+            status.textContent = `❌ ${error}`;
+        }
+    }
+}
+
+document.addEventListener('DOMContentLoaded', () => new ServeDashboard());